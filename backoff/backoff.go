@@ -0,0 +1,28 @@
+package backoff
+
+import "time"
+
+// Exponential computes exponentially increasing delays, starting with Initial and doubling up to Max.
+// The zero value is not useful:  Initial and Max must be set.  An Exponential is not safe for concurrent use.
+type Exponential struct {
+	Initial time.Duration
+	Max     time.Duration
+
+	current time.Duration
+}
+
+// Next returns the delay to use for the next attempt
+func (e *Exponential) Next() time.Duration {
+	if e.current <= 0 {
+		e.current = e.Initial
+	} else if e.current *= 2; e.current > e.Max {
+		e.current = e.Max
+	}
+
+	return e.current
+}
+
+// Reset starts the delays over, once an attempt has succeeded
+func (e *Exponential) Reset() {
+	e.current = 0
+}
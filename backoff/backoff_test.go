@@ -0,0 +1,24 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponential(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		e      = Exponential{Initial: time.Second, Max: 5 * time.Second}
+	)
+
+	assert.Equal(time.Second, e.Next())
+	assert.Equal(2*time.Second, e.Next())
+	assert.Equal(4*time.Second, e.Next())
+	assert.Equal(5*time.Second, e.Next())
+	assert.Equal(5*time.Second, e.Next())
+
+	e.Reset()
+	assert.Equal(time.Second, e.Next())
+}
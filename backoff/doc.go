@@ -0,0 +1,5 @@
+/*
+Package backoff computes the delays between attempts of operations which are retried, such as
+reestablishing a lost watch or subscribing to a topic which is not yet usable.
+*/
+package backoff
@@ -0,0 +1,82 @@
+package clock
+
+import "time"
+
+// Interface is a source of time.  Each method mirrors the time package function of the same name.
+type Interface interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// NewTimer creates a Timer that delivers the time on its channel after the given delay
+	NewTimer(delay time.Duration) Timer
+
+	// NewTicker creates a Ticker that fires every period
+	NewTicker(period time.Duration) Ticker
+
+	// AfterFunc invokes the given function in its own goroutine after the given delay.  The
+	// returned Timer's channel is nil.
+	AfterFunc(delay time.Duration, f func()) Timer
+}
+
+// Ticker is the behavior of a time.Ticker obtained from a clock
+type Ticker interface {
+	// C returns the channel on which ticks are delivered
+	C() <-chan time.Time
+
+	// Stop turns off this ticker.  No more ticks will be delivered after this method returns.
+	Stop()
+}
+
+// Timer is the behavior of a time.Timer obtained from a clock
+type Timer interface {
+	// C returns the channel on which the time is delivered when this timer fires.  Timers created
+	// with AfterFunc return a nil channel.
+	C() <-chan time.Time
+
+	// Stop prevents this timer from firing.  It returns false if the timer has already
+	// fired or been stopped.
+	Stop() bool
+
+	// Reset changes this timer to fire after the given delay.  It returns true if the timer had been active.
+	Reset(delay time.Duration) bool
+}
+
+// systemClock is the Interface implementation backed by the time package
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(delay time.Duration) Timer {
+	return systemTimer{time.NewTimer(delay)}
+}
+
+func (systemClock) NewTicker(period time.Duration) Ticker {
+	return systemTicker{time.NewTicker(period)}
+}
+
+func (systemClock) AfterFunc(delay time.Duration, f func()) Timer {
+	return systemTimer{time.AfterFunc(delay, f)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// System returns the Interface backed by the time package.  This is the default clock for every component.
+func System() Interface {
+	return systemClock{}
+}
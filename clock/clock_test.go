@@ -0,0 +1,53 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystem(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		clock   = System()
+	)
+
+	require.NotNil(clock)
+	before := time.Now()
+	assert.False(clock.Now().Before(before))
+
+	timer := clock.NewTimer(time.Millisecond)
+	require.NotNil(timer.C())
+	select {
+	case <-timer.C():
+	case <-time.After(5 * time.Second):
+		assert.Fail("The timer did not fire")
+	}
+
+	assert.False(timer.Stop())
+	assert.False(timer.Reset(time.Hour))
+	assert.True(timer.Stop())
+
+	ticker := clock.NewTicker(time.Millisecond)
+	select {
+	case <-ticker.C():
+	case <-time.After(5 * time.Second):
+		assert.Fail("The ticker did not fire")
+	}
+
+	ticker.Stop()
+
+	fired := make(chan struct{})
+	afterFunc := clock.AfterFunc(time.Millisecond, func() { close(fired) })
+	assert.Nil(afterFunc.C())
+	select {
+	case <-fired:
+	case <-time.After(5 * time.Second):
+		assert.Fail("The function was not invoked")
+	}
+
+	assert.True(clock.AfterFunc(time.Hour, func() {}).Stop())
+}
@@ -0,0 +1,218 @@
+package clocktest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock"
+)
+
+// Clock is a clock.Interface whose time only moves when Add is called.  Tickers and timers created
+// by this Clock fire synchronously with respect to Add, in the order of their deadlines.
+type Clock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*waiter
+	changed chan struct{}
+}
+
+// NewClock creates a fake Clock starting at the given time
+func NewClock(now time.Time) *Clock {
+	return &Clock{
+		now:     now,
+		changed: make(chan struct{}),
+	}
+}
+
+var _ clock.Interface = (*Clock)(nil)
+
+// waiter is a pending ticker or timer.  A waiter with a nonpositive period is a one-shot timer, which
+// either invokes f or, if f is nil, delivers the time on c.
+type waiter struct {
+	clock    *Clock
+	deadline time.Time
+	period   time.Duration
+	c        chan time.Time
+	f        func()
+}
+
+// ticker is the clock.Ticker view of a waiter
+type ticker struct {
+	*waiter
+}
+
+func (t ticker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t ticker) Stop() {
+	t.clock.remove(t.waiter)
+}
+
+// timer is the clock.Timer view of a waiter
+type timer struct {
+	*waiter
+}
+
+func (t timer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t timer) Stop() bool {
+	return t.clock.remove(t.waiter)
+}
+
+func (t timer) Reset(delay time.Duration) bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	active := t.clock.removeLocked(t.waiter)
+	t.clock.addLocked(t.waiter, delay)
+	return active
+}
+
+// Now returns the current fake time
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// NewTimer creates a timer which delivers the fake time once Add moves past the given delay
+func (c *Clock) NewTimer(delay time.Duration) clock.Timer {
+	w := &waiter{clock: c, c: make(chan time.Time, 1)}
+	c.add(w, delay)
+	return timer{w}
+}
+
+// NewTicker creates a ticker which delivers the fake time each time Add moves past one of its periods.
+// As with time.Ticker, ticks are dropped if the receiver falls behind.
+func (c *Clock) NewTicker(period time.Duration) clock.Ticker {
+	if period <= 0 {
+		panic("clocktest: nonpositive period for NewTicker")
+	}
+
+	w := &waiter{clock: c, period: period, c: make(chan time.Time, 1)}
+	c.add(w, period)
+	return ticker{w}
+}
+
+// AfterFunc schedules f to run in its own goroutine once Add moves past the given delay
+func (c *Clock) AfterFunc(delay time.Duration, f func()) clock.Timer {
+	w := &waiter{clock: c, f: f}
+	c.add(w, delay)
+	return timer{w}
+}
+
+// Waiters returns the number of tickers and timers that have not yet been stopped or fired
+func (c *Clock) Waiters() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil waits until at least n tickers and timers are pending.  Since code under test creates
+// its tickers in other goroutines, tests use this method to ensure that a subsequent Add is observed.
+func (c *Clock) BlockUntil(n int) {
+	for {
+		c.lock.Lock()
+		count, changed := len(c.waiters), c.changed
+		c.lock.Unlock()
+
+		if count >= n {
+			return
+		}
+
+		<-changed
+	}
+}
+
+// Add advances the fake time, firing each ticker and timer whose deadline has been reached
+func (c *Clock) Add(d time.Duration) {
+	c.lock.Lock()
+	end := c.now.Add(d)
+
+	for {
+		w := c.next(end)
+		if w == nil {
+			break
+		}
+
+		c.now = w.deadline
+		switch {
+		case w.period > 0:
+			w.deadline = w.deadline.Add(w.period)
+			select {
+			case w.c <- c.now:
+			default:
+			}
+
+		case w.f != nil:
+			c.removeLocked(w)
+			go w.f()
+
+		default:
+			c.removeLocked(w)
+			select {
+			case w.c <- c.now:
+			default:
+			}
+		}
+	}
+
+	c.now = end
+	c.lock.Unlock()
+}
+
+// next returns the waiter with the earliest deadline not after end, or nil if there is no such waiter
+func (c *Clock) next(end time.Time) *waiter {
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+	})
+
+	if len(c.waiters) > 0 && !c.waiters[0].deadline.After(end) {
+		return c.waiters[0]
+	}
+
+	return nil
+}
+
+func (c *Clock) add(w *waiter, d time.Duration) {
+	c.lock.Lock()
+	c.addLocked(w, d)
+	c.lock.Unlock()
+}
+
+func (c *Clock) addLocked(w *waiter, d time.Duration) {
+	w.deadline = c.now.Add(d)
+	c.waiters = append(c.waiters, w)
+	c.signal()
+}
+
+func (c *Clock) remove(w *waiter) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.removeLocked(w)
+}
+
+func (c *Clock) removeLocked(w *waiter) bool {
+	for i, candidate := range c.waiters {
+		if candidate == w {
+			last := len(c.waiters) - 1
+			copy(c.waiters[i:], c.waiters[i+1:])
+			c.waiters[last] = nil
+			c.waiters = c.waiters[:last]
+			c.signal()
+			return true
+		}
+	}
+
+	return false
+}
+
+// signal wakes up any goroutines in BlockUntil.  This method must be called under the lock.
+func (c *Clock) signal() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
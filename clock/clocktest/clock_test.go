@@ -0,0 +1,153 @@
+package clocktest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockTicker(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		start   = time.Date(2017, time.June, 1, 0, 0, 0, 0, time.UTC)
+		clock   = NewClock(start)
+		ticker  = clock.NewTicker(time.Second)
+	)
+
+	require.NotNil(ticker)
+	assert.Equal(start, clock.Now())
+	assert.Equal(1, clock.Waiters())
+
+	clock.Add(999 * time.Millisecond)
+	select {
+	case <-ticker.C():
+		assert.Fail("The ticker should not have fired")
+	default:
+	}
+
+	clock.Add(time.Millisecond)
+	select {
+	case tick := <-ticker.C():
+		assert.Equal(start.Add(time.Second), tick)
+	default:
+		assert.Fail("The ticker should have fired")
+	}
+
+	// ticks are dropped when the receiver falls behind
+	clock.Add(5 * time.Second)
+	assert.Equal(start.Add(6*time.Second), clock.Now())
+	assert.Equal(start.Add(2*time.Second), <-ticker.C())
+	select {
+	case <-ticker.C():
+		assert.Fail("Only one tick should have been buffered")
+	default:
+	}
+
+	ticker.Stop()
+	assert.Zero(clock.Waiters())
+	clock.Add(time.Hour)
+	select {
+	case <-ticker.C():
+		assert.Fail("A stopped ticker should not fire")
+	default:
+	}
+}
+
+func TestClockAfterFunc(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		clock  = NewClock(time.Time{})
+		fired  = make(chan time.Time, 1)
+		timer  = clock.AfterFunc(time.Minute, func() { fired <- clock.Now() })
+	)
+
+	assert.Equal(1, clock.Waiters())
+	clock.Add(30 * time.Second)
+	assert.Equal(1, clock.Waiters())
+
+	clock.Add(time.Hour)
+	assert.Zero(clock.Waiters())
+	assert.Equal(time.Time{}.Add(time.Hour+30*time.Second), <-fired)
+	assert.False(timer.Stop())
+
+	assert.True(clock.AfterFunc(time.Minute, func() { assert.Fail("A stopped timer should not fire") }).Stop())
+	clock.Add(time.Hour)
+}
+
+func TestClockBlockUntil(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		clock  = NewClock(time.Time{})
+		done   = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+		clock.BlockUntil(2)
+	}()
+
+	clock.NewTicker(time.Second)
+	clock.AfterFunc(time.Second, func() {})
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail("BlockUntil did not return")
+	}
+}
+
+func TestClockTimer(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		start  = time.Date(2017, time.June, 1, 0, 0, 0, 0, time.UTC)
+		clock  = NewClock(start)
+		timer  = clock.NewTimer(time.Minute)
+	)
+
+	assert.NotNil(timer.C())
+	assert.Equal(1, clock.Waiters())
+
+	clock.Add(30 * time.Second)
+	select {
+	case <-timer.C():
+		assert.Fail("The timer should not have fired")
+	default:
+	}
+
+	clock.Add(time.Hour)
+	assert.Zero(clock.Waiters())
+	select {
+	case fired := <-timer.C():
+		assert.Equal(start.Add(time.Minute), fired)
+	default:
+		assert.Fail("The timer should have fired")
+	}
+
+	assert.False(timer.Stop())
+
+	// resetting a fired timer schedules it again
+	assert.False(timer.Reset(time.Second))
+	assert.Equal(1, clock.Waiters())
+
+	// resetting an active timer moves its deadline
+	assert.True(timer.Reset(time.Minute))
+	assert.Equal(1, clock.Waiters())
+	clock.Add(time.Second)
+	select {
+	case <-timer.C():
+		assert.Fail("The reset timer should not have fired")
+	default:
+	}
+
+	clock.Add(time.Minute)
+	select {
+	case <-timer.C():
+	default:
+		assert.Fail("The reset timer should have fired")
+	}
+
+	assert.Nil(clock.AfterFunc(time.Second, func() {}).C())
+}
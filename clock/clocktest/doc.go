@@ -0,0 +1,5 @@
+/*
+Package clocktest provides a fake clock.Interface for tests.  Time only moves when a test calls
+Clock.Add, so code driven by timers and tickers can be tested without sleeping.
+*/
+package clocktest
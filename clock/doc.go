@@ -0,0 +1,7 @@
+/*
+Package clock provides a source of time shared by the components of this library.  Components which
+sleep, poll, or expire state obtain the current time, timers, and tickers from a clock.Interface
+injected via their options, which defaults to System().  Tests may inject the fake clock from the
+clocktest package to move time deterministically instead of waiting on it.
+*/
+package clock
@@ -0,0 +1,95 @@
+package concurrent
+
+import (
+	"context"
+	"sync"
+)
+
+// Task is a unit of background work executed by a Group.  A Task must return promptly
+// once the supplied context is cancelled.
+type Task func(context.Context) error
+
+// Group runs a collection of tasks that share a single lifetime.  The first task to fail
+// cancels the group's context, which signals all other tasks to stop.  This is similar to
+// golang.org/x/sync/errgroup, except that a Group also implements Runnable so that it can
+// be stopped with the rest of an application's goroutines.
+//
+// Instances must be created with NewGroup.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	waitGroup sync.WaitGroup
+	errOnce   sync.Once
+	err       error
+}
+
+// NewGroup creates a Group whose context derives from the given parent.  If parent is nil,
+// context.Background() is used.
+func NewGroup(parent context.Context) *Group {
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	return &Group{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Context returns the context passed to each task.  This context is cancelled when any task
+// fails, when Cancel is called, or when the parent context is cancelled.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go starts the given task in its own goroutine.  If the task returns a non-nil error, and it
+// is the first task to do so, that error is retained and the group's context is cancelled.
+// Tasks started after the group has been cancelled still run, but with a cancelled context.
+func (g *Group) Go(task Task) {
+	g.waitGroup.Add(1)
+	go func() {
+		defer g.waitGroup.Done()
+		if err := task(g.ctx); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				g.cancel()
+			})
+		}
+	}()
+}
+
+// Cancel signals all tasks in this group to stop.  It does not wait for them to do so.
+// This method is idempotent.
+func (g *Group) Cancel() {
+	g.cancel()
+}
+
+// Wait blocks until all tasks have returned, then returns the first error encountered, if any.
+// The group's context is always cancelled once Wait returns.
+func (g *Group) Wait() error {
+	g.waitGroup.Wait()
+	g.cancel()
+	return g.err
+}
+
+// Run cancels this group when the shutdown channel is closed.  The tasks are part of the
+// WaitGroup, so that waiting on the WaitGroup waits for every task to return.  This method
+// implements Runnable, which allows a Group to participate in an application's shutdown via
+// Execute or Await.
+func (g *Group) Run(waitGroup *sync.WaitGroup, shutdown <-chan struct{}) error {
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		select {
+		case <-shutdown:
+			g.Cancel()
+		case <-g.ctx.Done():
+		}
+
+		g.Wait()
+	}()
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package concurrent
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingTask returns a Task which runs until its context is cancelled
+func blockingTask(stopped *int32) Task {
+	return func(ctx context.Context) error {
+		<-ctx.Done()
+		atomic.AddInt32(stopped, 1)
+		return nil
+	}
+}
+
+func TestGroupSuccess(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		group  = NewGroup(nil)
+		count  int32
+	)
+
+	for i := 0; i < 5; i++ {
+		group.Go(func(context.Context) error {
+			atomic.AddInt32(&count, 1)
+			return nil
+		})
+	}
+
+	assert.NoError(group.Wait())
+	assert.Equal(int32(5), atomic.LoadInt32(&count))
+	assert.Error(group.Context().Err())
+}
+
+func TestGroupFirstError(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		group    = NewGroup(context.Background())
+		expected = errors.New("expected")
+		stopped  int32
+	)
+
+	group.Go(blockingTask(&stopped))
+	group.Go(blockingTask(&stopped))
+	group.Go(func(context.Context) error {
+		return expected
+	})
+
+	assert.Equal(expected, group.Wait())
+	assert.Equal(int32(2), atomic.LoadInt32(&stopped))
+
+	// later errors do not replace the first
+	group.Go(func(context.Context) error {
+		return errors.New("later")
+	})
+
+	assert.Equal(expected, group.Wait())
+}
+
+func TestGroupCancel(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		group   = NewGroup(nil)
+		stopped int32
+	)
+
+	group.Go(blockingTask(&stopped))
+	group.Cancel()
+	group.Cancel()
+
+	assert.NoError(group.Wait())
+	assert.Equal(int32(1), atomic.LoadInt32(&stopped))
+}
+
+func TestGroupParentCancel(t *testing.T) {
+	var (
+		assert         = assert.New(t)
+		parent, cancel = context.WithCancel(context.Background())
+		group          = NewGroup(parent)
+		stopped        int32
+	)
+
+	group.Go(blockingTask(&stopped))
+	cancel()
+
+	assert.NoError(group.Wait())
+	assert.Equal(int32(1), atomic.LoadInt32(&stopped))
+}
+
+func TestGroupRun(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		group   = NewGroup(nil)
+		stopped int32
+	)
+
+	group.Go(blockingTask(&stopped))
+	group.Go(blockingTask(&stopped))
+
+	waitGroup, shutdown, err := Execute(group)
+	require.NoError(err)
+	assert.False(WaitTimeout(waitGroup, 100*time.Millisecond))
+
+	close(shutdown)
+	require.True(WaitTimeout(waitGroup, 5*time.Second))
+	assert.Equal(int32(2), atomic.LoadInt32(&stopped))
+}
+
+func TestGroupRunTaskFailure(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		group    = NewGroup(nil)
+		expected = errors.New("expected")
+		stopped  int32
+
+		waitGroup = new(sync.WaitGroup)
+		shutdown  = make(chan struct{})
+	)
+
+	defer close(shutdown)
+	group.Go(blockingTask(&stopped))
+	assert.NoError(group.Run(waitGroup, shutdown))
+
+	// a failed task terminates the group without waiting for shutdown
+	group.Go(func(context.Context) error {
+		return expected
+	})
+
+	assert.True(WaitTimeout(waitGroup, 5*time.Second))
+	assert.Equal(int32(1), atomic.LoadInt32(&stopped))
+	assert.Equal(expected, group.Wait())
+}
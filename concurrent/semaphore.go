@@ -0,0 +1,196 @@
+package concurrent
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// SemaphoreWaitHistogram is the time, in seconds, spent waiting to acquire a Semaphore
+	SemaphoreWaitHistogram = "semaphore_wait_seconds"
+
+	// SemaphoreRejectionCounter is the number of acquisitions of a Semaphore which failed, either
+	// because the context was done first or because the Semaphore was busy
+	SemaphoreRejectionCounter = "semaphore_rejection_count"
+
+	// SemaphoreLabel is the label identifying the Semaphore of a metric
+	SemaphoreLabel = "semaphore"
+)
+
+var (
+	// ErrorSemaphoreWeight is returned when an acquisition asks for more than the size of a Semaphore,
+	// which could never succeed
+	ErrorSemaphoreWeight = errors.New("The requested weight exceeds the size of the semaphore")
+)
+
+// Metrics is the xmetrics.Module for this package
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name:       SemaphoreWaitHistogram,
+			Type:       xmetrics.HistogramType,
+			Help:       "The time in seconds spent waiting to acquire a semaphore",
+			LabelNames: []string{SemaphoreLabel},
+			Buckets:    []float64{0.0001, 0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30},
+		},
+		{
+			Name:       SemaphoreRejectionCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The number of failed acquisitions of a semaphore",
+			LabelNames: []string{SemaphoreLabel},
+		},
+	}
+}
+
+// semaphoreWaiter is a blocked acquisition.  The ready channel is closed once the weight is acquired.
+type semaphoreWaiter struct {
+	weight int64
+	ready  chan struct{}
+}
+
+// Semaphore is a weighted semaphore which bounds the use of a resource, such as the number of concurrent
+// outbound requests.  Acquisitions are granted in FIFO order:  a large acquisition at the front of the queue
+// blocks smaller ones behind it, so that it cannot be starved.  Blocked acquisitions honor the deadline and
+// cancellation of their context.
+//
+// A Semaphore is safe for concurrent use.
+type Semaphore struct {
+	size        int64
+	waitTime    metrics.Histogram
+	rejections  metrics.Counter
+	currentTime func() time.Time
+
+	lock    sync.Mutex
+	current int64
+	waiters list.List
+}
+
+// NewSemaphore creates a Semaphore with the given total weight.  The name labels the metrics of this
+// Semaphore, which are obtained from the given provider.  If the provider is nil, metrics are discarded.
+func NewSemaphore(name string, size int64, p xmetrics.Provider) *Semaphore {
+	if p == nil {
+		p = xmetrics.NewDiscardProvider()
+	}
+
+	return &Semaphore{
+		size:        size,
+		waitTime:    p.NewHistogram(SemaphoreWaitHistogram).With(SemaphoreLabel, name),
+		rejections:  p.NewCounter(SemaphoreRejectionCounter).With(SemaphoreLabel, name),
+		currentTime: time.Now,
+	}
+}
+
+// Size returns the total weight of this Semaphore
+func (s *Semaphore) Size() int64 {
+	return s.size
+}
+
+// Acquire blocks until the given weight is available, returning nil, or until the context is done,
+// returning the context's error.  If the weight exceeds the size of this Semaphore, ErrorSemaphoreWeight
+// is returned immediately.
+func (s *Semaphore) Acquire(ctx context.Context, weight int64) error {
+	if weight > s.size {
+		s.rejections.Add(1)
+		return ErrorSemaphoreWeight
+	}
+
+	start := s.currentTime()
+	s.lock.Lock()
+	if s.size-s.current >= weight && s.waiters.Len() == 0 {
+		s.current += weight
+		s.lock.Unlock()
+		s.waitTime.Observe(0)
+		return nil
+	}
+
+	waiter := semaphoreWaiter{weight: weight, ready: make(chan struct{})}
+	element := s.waiters.PushBack(waiter)
+	s.lock.Unlock()
+
+	select {
+	case <-waiter.ready:
+		s.waitTime.Observe(s.currentTime().Sub(start).Seconds())
+		return nil
+
+	case <-ctx.Done():
+		s.lock.Lock()
+		select {
+		case <-waiter.ready:
+			// the weight was granted as the context finished, so honor the acquisition
+			s.lock.Unlock()
+			s.waitTime.Observe(s.currentTime().Sub(start).Seconds())
+			return nil
+
+		default:
+			front := s.waiters.Front() == element
+			s.waiters.Remove(element)
+			if front {
+				// waiters behind this one may now fit
+				s.notifyWaiters()
+			}
+
+			s.lock.Unlock()
+			s.rejections.Add(1)
+			return ctx.Err()
+		}
+	}
+}
+
+// TryAcquire acquires the given weight only if it is available immediately and no other acquisition is
+// waiting, returning true on success
+func (s *Semaphore) TryAcquire(weight int64) bool {
+	s.lock.Lock()
+	acquired := s.size-s.current >= weight && s.waiters.Len() == 0
+	if acquired {
+		s.current += weight
+	}
+
+	s.lock.Unlock()
+	if acquired {
+		s.waitTime.Observe(0)
+	} else {
+		s.rejections.Add(1)
+	}
+
+	return acquired
+}
+
+// Release returns the given weight to this Semaphore, granting it to waiting acquisitions in FIFO order.
+// This method panics if more weight is released than is held.
+func (s *Semaphore) Release(weight int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.current -= weight
+	if s.current < 0 {
+		panic("concurrent: released more weight than held by the semaphore")
+	}
+
+	s.notifyWaiters()
+}
+
+// notifyWaiters grants weight to waiters from the front of the queue until the next one does not fit.
+// This method must be called under the lock.
+func (s *Semaphore) notifyWaiters() {
+	for {
+		next := s.waiters.Front()
+		if next == nil {
+			return
+		}
+
+		waiter := next.Value.(semaphoreWaiter)
+		if s.size-s.current < waiter.weight {
+			return
+		}
+
+		s.current += waiter.weight
+		s.waiters.Remove(next)
+		close(waiter.ready)
+	}
+}
@@ -0,0 +1,180 @@
+package concurrent
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// acquireAsync starts an acquisition in a separate goroutine, returning the channel which receives its result
+func acquireAsync(ctx context.Context, s *Semaphore, weight int64) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- s.Acquire(ctx, weight)
+	}()
+
+	return result
+}
+
+// waitForWaiters blocks until the semaphore has the given number of waiters
+func waitForWaiters(t *testing.T, s *Semaphore, count int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.lock.Lock()
+		actual := s.waiters.Len()
+		s.lock.Unlock()
+
+		if actual == count {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	require.FailNow(t, "The semaphore did not reach the expected number of waiters")
+}
+
+func assertPending(t *testing.T, result <-chan error) {
+	select {
+	case err := <-result:
+		assert.Fail(t, "The acquisition should still be waiting", "result: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func assertAcquired(t *testing.T, result <-chan error) {
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "The acquisition did not complete")
+	}
+}
+
+func TestSemaphoreAcquireAndRelease(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		semaphore = NewSemaphore("test", 3, nil)
+	)
+
+	assert.Equal(int64(3), semaphore.Size())
+	assert.NoError(semaphore.Acquire(context.Background(), 2))
+	assert.True(semaphore.TryAcquire(1))
+	assert.False(semaphore.TryAcquire(1))
+
+	result := acquireAsync(context.Background(), semaphore, 2)
+	waitForWaiters(t, semaphore, 1)
+	assertPending(t, result)
+
+	semaphore.Release(1)
+	assertPending(t, result)
+
+	semaphore.Release(1)
+	assertAcquired(t, result)
+
+	semaphore.Release(3)
+	assert.True(semaphore.TryAcquire(3))
+	semaphore.Release(3)
+
+	assert.Panics(func() { semaphore.Release(1) })
+}
+
+func TestSemaphoreWeightTooLarge(t *testing.T) {
+	assert := assert.New(t)
+	semaphore := NewSemaphore("test", 1, nil)
+
+	assert.Equal(ErrorSemaphoreWeight, semaphore.Acquire(context.Background(), 2))
+	assert.False(semaphore.TryAcquire(2))
+}
+
+func TestSemaphoreFairness(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		semaphore = NewSemaphore("test", 2, nil)
+	)
+
+	assert.NoError(semaphore.Acquire(context.Background(), 1))
+
+	large := acquireAsync(context.Background(), semaphore, 2)
+	waitForWaiters(t, semaphore, 1)
+
+	// weight is available, but a small acquisition cannot jump ahead of the large one
+	small := acquireAsync(context.Background(), semaphore, 1)
+	waitForWaiters(t, semaphore, 2)
+	assert.False(semaphore.TryAcquire(1))
+	assertPending(t, large)
+	assertPending(t, small)
+
+	semaphore.Release(1)
+	assertAcquired(t, large)
+	assertPending(t, small)
+
+	semaphore.Release(2)
+	assertAcquired(t, small)
+}
+
+func TestSemaphoreDeadline(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		semaphore = NewSemaphore("test", 2, nil)
+	)
+
+	assert.NoError(semaphore.Acquire(context.Background(), 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(context.DeadlineExceeded, semaphore.Acquire(ctx, 2))
+
+	// the abandoned acquisition no longer blocks the queue
+	assert.True(semaphore.TryAcquire(1))
+}
+
+func TestSemaphoreCancelFront(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		semaphore = NewSemaphore("test", 2, nil)
+	)
+
+	assert.NoError(semaphore.Acquire(context.Background(), 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	large := acquireAsync(ctx, semaphore, 2)
+	waitForWaiters(t, semaphore, 1)
+
+	small := acquireAsync(context.Background(), semaphore, 1)
+	waitForWaiters(t, semaphore, 2)
+	assertPending(t, small)
+
+	cancel()
+	assert.Equal(context.Canceled, <-large)
+	assertAcquired(t, small)
+}
+
+func TestSemaphoreMetrics(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+	)
+
+	require.NoError(err)
+	semaphore := NewSemaphore("test", 1, registry)
+
+	assert.NoError(semaphore.Acquire(context.Background(), 1))
+	assert.False(semaphore.TryAcquire(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(context.Canceled, semaphore.Acquire(ctx, 1))
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(response.Body.String(), `semaphore_rejection_count{semaphore="test"} 2`)
+	assert.Contains(response.Body.String(), `semaphore_wait_seconds_count{semaphore="test"} 1`)
+}
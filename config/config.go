@@ -0,0 +1,208 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Comcast/webpa-common/device"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/secure/handler"
+	"github.com/Comcast/webpa-common/server"
+	"github.com/Comcast/webpa-common/service"
+	"github.com/Comcast/webpa-common/webhook"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"strings"
+)
+
+const (
+	// JWTValidatorsKey is the Viper key under which the list of handler.JWTValidatorConfig objects is stored
+	JWTValidatorsKey = "jwtValidators"
+
+	// WebhookKey is the Viper subkey under which the webhook Factory configuration, including AWS SNS, is stored
+	WebhookKey = "webhook"
+)
+
+// Config is the typed configuration of every subsystem of a WebPA server.  With the exception
+// of Server, each subsystem is optional and is nil when absent from the configuration.
+type Config struct {
+	// Server describes the servers, logging, and shutdown of the application.  These settings
+	// are unmarshalled from the root of the configuration, exactly as with server.Initialize.
+	Server server.WebPA
+
+	// Device is the device Manager configuration, stored under device.DeviceManagerKey
+	Device *device.Options
+
+	// Discovery is the service discovery configuration, stored under service.DiscoveryKey
+	Discovery *service.Options
+
+	// Secure is the configuration of the standard secure middleware stack, stored under handler.StackKey
+	Secure *handler.StackOptions
+
+	// JWTValidators are the validators for JWS tokens, stored under JWTValidatorsKey
+	JWTValidators []handler.JWTValidatorConfig
+
+	// Webhook is the webhook Factory, including its AWS SNS notifier, created from the configuration
+	// stored under WebhookKey
+	Webhook *webhook.Factory
+}
+
+// Load reads the configuration file for an application, using the standard WebPA settings established
+// by server.Configure, and returns the validated Config.  Environment variables override settings, with
+// the periods in each key replaced by underscores.
+//
+// The FlagSet is optional.  If supplied, the standard flags are added to it and parsed from the arguments.
+func Load(applicationName string, arguments []string, f *pflag.FlagSet, v *viper.Viper, logger logging.Logger) (*Config, error) {
+	if err := server.Configure(applicationName, arguments, f, v); err != nil {
+		return nil, err
+	}
+
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	return New(v, logger)
+}
+
+// New unmarshals a Config from a Viper environment whose configuration has already been read, then
+// validates it.  The logger is used by the subsystems, such as the device Manager, that accept one.
+//
+// The returned error is an Errors containing every problem found, including any unmarshalling failures.
+// The Config is only returned when there are no errors.
+func New(v *viper.Viper, logger logging.Logger) (*Config, error) {
+	var (
+		c    = new(Config)
+		errs Errors
+	)
+
+	if err := v.Unmarshal(&c.Server); err != nil {
+		errs = append(errs, fmt.Errorf("server: %s", err))
+	}
+
+	if s := sub(v, device.DeviceManagerKey); s != nil {
+		var err error
+		if c.Device, err = device.NewOptions(logger, s); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", device.DeviceManagerKey, err))
+		}
+	}
+
+	if s := sub(v, service.DiscoveryKey); s != nil {
+		var err error
+		if c.Discovery, err = service.NewOptions(logger, nil, s); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", service.DiscoveryKey, err))
+		}
+	}
+
+	if s := sub(v, handler.StackKey); s != nil {
+		var err error
+		if c.Secure, err = handler.NewStackOptions(s); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", handler.StackKey, err))
+		}
+	}
+
+	if raw := v.Get(JWTValidatorsKey); raw != nil {
+		// the validators are decoded as JSON, which honors the custom unmarshalling of types
+		// such as types.Duration, and the flattening of the embedded resource.Factory
+		if err := decodeJSON(raw, &c.JWTValidators); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", JWTValidatorsKey, err))
+		}
+	}
+
+	if s := sub(v, WebhookKey); s != nil {
+		var err error
+		if c.Webhook, err = webhook.NewFactory(s); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", WebhookKey, err))
+		}
+	}
+
+	errs = append(errs, c.validate()...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return c, nil
+}
+
+// Validate checks this Config for consistency, returning an Errors containing every problem found.
+// If this Config is valid, this method returns nil.
+func (c *Config) Validate() error {
+	if errs := c.validate(); len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (c *Config) validate() (errs Errors) {
+	errs = append(errs, validateServer(&c.Server)...)
+	errs = append(errs, validateDevice(c.Device)...)
+	errs = append(errs, validateDiscovery(c.Discovery)...)
+	errs = append(errs, validateSecure(c.Secure)...)
+	errs = append(errs, validateJWTValidators(c.JWTValidators)...)
+	return
+}
+
+// sub returns a Viper containing the settings under the given key, or nil if there are no such settings.
+// Unlike viper.Sub, each setting is read individually from the original Viper, so any environment
+// overrides are honored.
+func sub(v *viper.Viper, key string) *viper.Viper {
+	var (
+		prefix = strings.ToLower(key) + "."
+		s      *viper.Viper
+	)
+
+	for _, k := range v.AllKeys() {
+		if strings.HasPrefix(k, prefix) {
+			if s == nil {
+				s = viper.New()
+			}
+
+			s.Set(strings.TrimPrefix(k, prefix), v.Get(k))
+		}
+	}
+
+	return s
+}
+
+// decodeJSON decodes a value obtained from Viper into a target by way of encoding/json
+func decodeJSON(raw interface{}, target interface{}) error {
+	data, err := json.Marshal(jsonCompatible(raw))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, target)
+}
+
+// jsonCompatible converts the map[interface{}]interface{} values produced by some configuration
+// formats, such as YAML, into map[string]interface{} so that they can be marshalled as JSON
+func jsonCompatible(raw interface{}) interface{} {
+	switch value := raw.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			converted[fmt.Sprint(k)] = jsonCompatible(v)
+		}
+
+		return converted
+
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			converted[k] = jsonCompatible(v)
+		}
+
+		return converted
+
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, v := range value {
+			converted[i] = jsonCompatible(v)
+		}
+
+		return converted
+
+	default:
+		return raw
+	}
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/secure/key"
+	"github.com/Comcast/webpa-common/service"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newViper produces a Viper from literal JSON configuration
+func newViper(t *testing.T, configuration string) *viper.Viper {
+	v := viper.New()
+	v.SetConfigType("json")
+	require.NoError(t, v.ReadConfig(strings.NewReader(configuration)))
+	return v
+}
+
+func TestLoad(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		logger  = logging.TestLogger(t)
+
+		f = pflag.NewFlagSet("example", pflag.ContinueOnError)
+		v = viper.New()
+	)
+
+	require.NoError(os.Setenv("EXAMPLE_DEVICE_MANAGER_PINGPERIOD", "15s"))
+	defer os.Unsetenv("EXAMPLE_DEVICE_MANAGER_PINGPERIOD")
+
+	// simulates passing `-f example` on the command line
+	c, err := Load("example", []string{"-f", "example"}, f, v, logger)
+	require.NoError(err)
+	require.NotNil(c)
+
+	assert.Equal(":8080", c.Server.Primary.Address)
+	assert.Equal("example", c.Server.Primary.Name)
+	assert.Equal(30*time.Second, c.Server.Health.LogInterval)
+	assert.Equal("INFO", c.Server.Log.Level)
+
+	if assert.NotNil(c.Device) {
+		// the environment overrides the file
+		assert.Equal(15*time.Second, c.Device.PingPeriod)
+		assert.Equal(time.Minute, c.Device.KeepalivePeriod)
+		assert.Equal(10*time.Second, c.Device.DispatchTimeout)
+		assert.Equal(logger, c.Device.Logger)
+	}
+
+	if assert.NotNil(c.Discovery) {
+		assert.Equal(service.ConsulBackend, c.Discovery.Backend)
+		assert.Equal("example", c.Discovery.ServiceName)
+		assert.Equal(logger, c.Discovery.Logger)
+	}
+
+	if assert.NotNil(c.Secure) {
+		assert.Equal([]string{"10.0.0.0/8"}, c.Secure.Allow)
+		assert.Equal(float64(50), c.Secure.RateLimit)
+	}
+
+	if assert.Len(c.JWTValidators, 1) {
+		validator := c.JWTValidators[0]
+		assert.Equal("http://keys.example.com/keys/{keyId}", validator.Keys.URI)
+		assert.Equal(key.PurposeVerify, validator.Keys.Purpose)
+		assert.Equal(time.Hour, time.Duration(validator.Keys.UpdateInterval))
+		assert.Equal(30, validator.Custom.ExpLeeway)
+	}
+
+	if assert.NotNil(c.Webhook) {
+		assert.Equal(2*time.Minute, c.Webhook.UndertakerInterval)
+		assert.NotNil(c.Webhook.Notifier)
+	}
+
+	assert.NoError(c.Validate())
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f      = pflag.NewFlagSet("example", pflag.ContinueOnError)
+		v      = viper.New()
+	)
+
+	c, err := Load("example", []string{"-f", "thisfiledoesnotexist"}, f, v, nil)
+	assert.Nil(c)
+	assert.Error(err)
+}
+
+func TestLoadBadArguments(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f      = pflag.NewFlagSet("example", pflag.ContinueOnError)
+		v      = viper.New()
+	)
+
+	c, err := Load("example", []string{"-unknown"}, f, v, nil)
+	assert.Nil(c)
+	assert.Error(err)
+}
+
+func TestNewMinimal(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	c, err := New(newViper(t, `{"primary": {"address": ":8080"}}`), nil)
+	require.NoError(err)
+	require.NotNil(c)
+
+	assert.Equal(":8080", c.Server.Primary.Address)
+	assert.Nil(c.Device)
+	assert.Nil(c.Discovery)
+	assert.Nil(c.Secure)
+	assert.Empty(c.JWTValidators)
+	assert.Nil(c.Webhook)
+}
+
+func TestNewReportsAllErrors(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		v = newViper(t, `{
+			"device": {
+				"manager": {
+					"pingPeriod": "this is not a duration"
+				}
+			},
+			"discovery": {
+				"backend": "etcd"
+			},
+			"secure": {
+				"deny": ["not an address"]
+			},
+			"jwtValidators": [
+				{"keys": {}}
+			],
+			"webhook": {
+				"undertakerInterval": "1m"
+			}
+		}`)
+	)
+
+	c, err := New(v, nil)
+	assert.Nil(c)
+	require.Error(err)
+
+	errs, ok := err.(Errors)
+	require.True(ok)
+
+	// unmarshalling errors are reported along with validation errors
+	var messages []string
+	for _, e := range errs {
+		messages = append(messages, e.Error())
+	}
+
+	assert.Len(messages, 6, "%v", messages)
+	joined := strings.Join(messages, "\n")
+	assert.Contains(joined, "device.manager")
+	assert.Contains(joined, "discovery.backend")
+	assert.Contains(joined, "secure.deny")
+	assert.Contains(joined, "jwtValidators[0].keys")
+	assert.Contains(joined, "webhook")
+	assert.Contains(joined, "primary")
+	assert.Contains(err.Error(), "6 configuration error(s)")
+}
+
+func TestSub(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		v      = newViper(t, `{"device": {"manager": {"pingPeriod": "45s"}}}`)
+	)
+
+	assert.Nil(sub(v, "nosuch"))
+	assert.Nil(sub(v, "device.manager.pingPeriod"))
+
+	s := sub(v, "device")
+	if assert.NotNil(s) {
+		assert.Equal("45s", s.GetString("manager.pingPeriod"))
+	}
+
+	s = sub(v, "device.manager")
+	if assert.NotNil(s) {
+		assert.Equal(45*time.Second, s.GetDuration("pingPeriod"))
+	}
+}
+
+func TestJSONCompatible(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(
+		map[string]interface{}{
+			"a": []interface{}{
+				map[string]interface{}{"b": 1},
+			},
+			"c": map[string]interface{}{"d": "value"},
+		},
+		jsonCompatible(map[interface{}]interface{}{
+			"a": []interface{}{
+				map[interface{}]interface{}{"b": 1},
+			},
+			"c": map[string]interface{}{"d": "value"},
+		}),
+	)
+
+	assert.Equal("value", jsonCompatible("value"))
+}
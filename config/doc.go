@@ -0,0 +1,66 @@
+/*
+Package config loads the complete, typed configuration of a WebPA server from a single file.
+
+Rather than each server hand-wiring the configuration of every subsystem, Load reads one file
+and unmarshals the servers, device Manager, service discovery, secure middleware, JWT validators,
+and webhooks from their standard keys:
+
+	{
+		"primary": {
+			"address": ":8080"
+		},
+		"log": {
+			"file": "console",
+			"level": "INFO"
+		},
+
+		"device": {
+			"manager": {
+				"pingPeriod": "45s"
+			}
+		},
+
+		"discovery": {
+			"backend": "consul",
+			"serviceName": "talaria"
+		},
+
+		"secure": {
+			"rateLimit": 50
+		},
+
+		"jwtValidators": [
+			{
+				"keys": {
+					"uri": "http://keys.example.com/keys/{keyId}",
+					"purpose": "verify"
+				}
+			}
+		],
+
+		"webhook": {
+			"aws": {
+				"accessKey": "...",
+				"secretKey": "...",
+				"sns": {
+					"region": "us-east-1",
+					"topicArn": "arn:aws:sns:us-east-1:1234:topic",
+					"urlPath": "/api/v2/aws/sns"
+				}
+			}
+		}
+	}
+
+Only the server settings are required.  Every other subsystem is optional, and is nil in the Config when
+its key is absent.  Defaults come from the server package's standard Viper settings and from each subsystem's
+own defaults.
+
+Any setting can be overridden with an environment variable named for the application and the setting's key,
+with periods replaced by underscores.  For example, TALARIA_DEVICE_MANAGER_PINGPERIOD overrides
+device.manager.pingPeriod for the talaria application.  As with Viper generally, only settings that appear in the
+configuration file or have defaults can be overridden this way.
+
+Once loaded, a Config is validated in its entirety.  All the problems found are reported together as Errors,
+so that a broken configuration can be fixed in one pass.
+*/
+package config
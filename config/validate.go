@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"github.com/Comcast/webpa-common/device"
+	"github.com/Comcast/webpa-common/secure/handler"
+	"github.com/Comcast/webpa-common/server"
+	"github.com/Comcast/webpa-common/service"
+	"net"
+	"strings"
+	"time"
+)
+
+// Errors is the set of problems found in a configuration.  Rather than stopping at the first
+// problem, loading and validation report them all at once.
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d configuration error(s): %s", len(e), strings.Join(messages, "; "))
+}
+
+// validateAddress checks that a server address, if supplied, is a valid host and port
+func validateAddress(name, address string) error {
+	if len(address) > 0 {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("%s.address: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateCertificate checks that either both or neither of a server's certificate and key files are supplied
+func validateCertificate(name string, s server.Secure) error {
+	certificateFile, keyFile := s.Certificate()
+	if (len(certificateFile) > 0) != (len(keyFile) > 0) {
+		return fmt.Errorf("%s: certificateFile and keyFile must be supplied together", name)
+	}
+
+	return nil
+}
+
+func validateServer(w *server.WebPA) (errs Errors) {
+	if len(w.Primary.Address) == 0 {
+		errs = append(errs, fmt.Errorf("primary: %s", server.ErrorNoPrimaryAddress))
+	}
+
+	basics := []struct {
+		name  string
+		basic *server.Basic
+	}{
+		{"primary", &w.Primary},
+		{"alternate", &w.Alternate},
+		{"pprof", &w.Pprof},
+	}
+
+	for _, b := range basics {
+		if err := validateAddress(b.name, b.basic.Address); err != nil {
+			errs = append(errs, err)
+		}
+
+		if err := validateCertificate(b.name, b.basic); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := validateAddress("health", w.Health.Address); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateCertificate("health", &w.Health); err != nil {
+		errs = append(errs, err)
+	}
+
+	if w.Health.LogInterval < 0 {
+		errs = append(errs, fmt.Errorf("health.logInterval cannot be negative"))
+	}
+
+	return
+}
+
+func validateDevice(o *device.Options) (errs Errors) {
+	if o == nil {
+		return
+	}
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"handshakeTimeout", o.HandshakeTimeout},
+		{"idlePeriod", o.IdlePeriod},
+		{"pingPeriod", o.PingPeriod},
+		{"authDelay", o.AuthDelay},
+		{"writeTimeout", o.WriteTimeout},
+		{"keepalivePeriod", o.KeepalivePeriod},
+		{"keepaliveTimeout", o.KeepaliveTimeout},
+		{"dedupeWindow", o.DedupeWindow},
+		{"dispatchTimeout", o.DispatchTimeout},
+	}
+
+	for _, d := range durations {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%s.%s cannot be negative", device.DeviceManagerKey, d.name))
+		}
+	}
+
+	if o.KeepalivePeriod > 0 && o.KeepaliveTimeout > 0 && o.KeepaliveTimeout <= o.KeepalivePeriod {
+		errs = append(errs, fmt.Errorf("%s.keepaliveTimeout must be longer than keepalivePeriod", device.DeviceManagerKey))
+	}
+
+	for level, weight := range o.QOSWeights {
+		if weight < 0 {
+			errs = append(errs, fmt.Errorf("%s.qosWeights[%d] cannot be negative", device.DeviceManagerKey, level))
+		}
+	}
+
+	return
+}
+
+func validateDiscovery(o *service.Options) (errs Errors) {
+	if o == nil {
+		return
+	}
+
+	switch o.Backend {
+	case "", service.ZookeeperBackend, service.ConsulBackend:
+	default:
+		errs = append(errs, fmt.Errorf("%s.backend: unsupported backend [%s]", service.DiscoveryKey, o.Backend))
+	}
+
+	if o.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("%s.timeout cannot be negative", service.DiscoveryKey))
+	}
+
+	return
+}
+
+func validateSecure(o *handler.StackOptions) (errs Errors) {
+	if o == nil {
+		return
+	}
+
+	if _, err := handler.ParseNetworks(o.Allow); err != nil {
+		errs = append(errs, fmt.Errorf("%s.allow: %s", handler.StackKey, err))
+	}
+
+	if _, err := handler.ParseNetworks(o.Deny); err != nil {
+		errs = append(errs, fmt.Errorf("%s.deny: %s", handler.StackKey, err))
+	}
+
+	if o.RateBurst < 0 {
+		errs = append(errs, fmt.Errorf("%s.rateBurst cannot be negative", handler.StackKey))
+	}
+
+	return
+}
+
+func validateJWTValidators(validators []handler.JWTValidatorConfig) (errs Errors) {
+	for i := range validators {
+		if _, err := validators[i].Keys.URL(); err != nil {
+			errs = append(errs, fmt.Errorf("%s[%d].keys: %s", JWTValidatorsKey, i, err))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"errors"
+	"github.com/Comcast/webpa-common/device"
+	"github.com/Comcast/webpa-common/resource"
+	"github.com/Comcast/webpa-common/secure/handler"
+	"github.com/Comcast/webpa-common/secure/key"
+	"github.com/Comcast/webpa-common/server"
+	"github.com/Comcast/webpa-common/service"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestErrors(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(
+		"2 configuration error(s): first; second",
+		Errors{errors.New("first"), errors.New("second")}.Error(),
+	)
+}
+
+func TestValidateServer(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(validateServer(&server.WebPA{
+		Primary: server.Basic{Address: ":8080", CertificateFile: "file.cert", KeyFile: "file.key"},
+		Health:  server.Health{Address: "localhost:8081"},
+	}))
+
+	errs := validateServer(&server.WebPA{
+		Alternate: server.Basic{Address: "no port here"},
+		Pprof:     server.Basic{Address: ":9999", CertificateFile: "file.cert"},
+		Health:    server.Health{KeyFile: "file.key", LogInterval: -time.Second},
+	})
+
+	assert.Len(errs, 5)
+}
+
+func TestValidateDevice(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(validateDevice(nil))
+	assert.Empty(validateDevice(&device.Options{
+		KeepalivePeriod:  time.Minute,
+		KeepaliveTimeout: 3 * time.Minute,
+		QOSWeights:       []int{1, 2},
+	}))
+
+	errs := validateDevice(&device.Options{
+		PingPeriod:       -time.Second,
+		DispatchTimeout:  -time.Second,
+		KeepalivePeriod:  time.Minute,
+		KeepaliveTimeout: time.Minute,
+		QOSWeights:       []int{1, -2},
+	})
+
+	assert.Len(errs, 4)
+}
+
+func TestValidateDiscovery(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(validateDiscovery(nil))
+	assert.Empty(validateDiscovery(&service.Options{}))
+	assert.Empty(validateDiscovery(&service.Options{Backend: service.ZookeeperBackend}))
+	assert.Empty(validateDiscovery(&service.Options{Backend: service.ConsulBackend}))
+	assert.Len(validateDiscovery(&service.Options{Backend: "etcd", Timeout: -time.Second}), 2)
+}
+
+func TestValidateSecure(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(validateSecure(nil))
+	assert.Empty(validateSecure(&handler.StackOptions{Allow: []string{"10.0.0.0/8", "127.0.0.1"}, Deny: []string{"10.1.2.3"}}))
+	assert.Len(validateSecure(&handler.StackOptions{Allow: []string{"10.0.0.0/99"}, Deny: []string{"nope"}, RateBurst: -1}), 3)
+}
+
+func TestValidateJWTValidators(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(validateJWTValidators(nil))
+	assert.Empty(validateJWTValidators([]handler.JWTValidatorConfig{
+		{Keys: key.ResolverFactory{Factory: resource.Factory{URI: "http://keys.example.com/{keyId}"}}},
+	}))
+
+	assert.Len(
+		validateJWTValidators([]handler.JWTValidatorConfig{
+			{},
+			{Keys: key.ResolverFactory{Factory: resource.Factory{URI: "ftp://keys.example.com"}}},
+		}),
+		2,
+	)
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Config{Server: server.WebPA{Primary: server.Basic{Address: ":8080"}}}).Validate())
+
+	err := new(Config).Validate()
+	if assert.Error(err) {
+		assert.IsType(Errors{}, err)
+	}
+}
@@ -0,0 +1,316 @@
+package device
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// DefaultChurnResolution is the granularity with which a Churn tracks events when ChurnOptions.Resolution
+	// is not set.  Events are counted in buckets of this width, so windows slide in steps of this size.
+	DefaultChurnResolution = time.Second
+)
+
+// DefaultChurnWindows returns the sliding windows tracked by a Churn when ChurnOptions.Windows is not set
+func DefaultChurnWindows() []time.Duration {
+	return []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+}
+
+// ChurnOptions configures a Churn
+type ChurnOptions struct {
+	// Windows are the lengths of the sliding windows over which events are counted.  Nonpositive windows
+	// are ignored.  If no windows are supplied, DefaultChurnWindows is used.
+	Windows []time.Duration
+
+	// Resolution is the width of the buckets in which events are counted.  If not supplied,
+	// DefaultChurnResolution is used.
+	Resolution time.Duration
+
+	// MetricsProvider is the source of the churn gauges declared by Metrics.  If not supplied,
+	// the gauges are discarded.
+	MetricsProvider xmetrics.Provider `json:"-"`
+
+	// Clock is the source of time for the windows.  If not supplied, SystemClock() is used.
+	Clock Clock `json:"-"`
+}
+
+func (o *ChurnOptions) windows() []time.Duration {
+	var windows []time.Duration
+	if o != nil {
+		for _, w := range o.Windows {
+			if w > 0 {
+				windows = append(windows, w)
+			}
+		}
+	}
+
+	if len(windows) == 0 {
+		return DefaultChurnWindows()
+	}
+
+	sort.Sort(durations(windows))
+	return windows
+}
+
+func (o *ChurnOptions) resolution() time.Duration {
+	if o != nil && o.Resolution > 0 {
+		return o.Resolution
+	}
+
+	return DefaultChurnResolution
+}
+
+func (o *ChurnOptions) metricsProvider() xmetrics.Provider {
+	if o != nil && o.MetricsProvider != nil {
+		return o.MetricsProvider
+	}
+
+	return xmetrics.NewDiscardProvider()
+}
+
+func (o *ChurnOptions) clock() Clock {
+	if o != nil && o.Clock != nil {
+		return o.Clock
+	}
+
+	return SystemClock()
+}
+
+// durations implements sort.Interface for time.Duration slices
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// ChurnStats describes the device activity within a single sliding window.  Rates are per second.
+type ChurnStats struct {
+	// Window is the label of the window, e.g. "5m"
+	Window string `json:"window"`
+
+	Connects         int `json:"connects"`
+	Disconnects      int `json:"disconnects"`
+	MessagesReceived int `json:"messagesReceived"`
+	MessagesSent     int `json:"messagesSent"`
+
+	ConnectRate    float64 `json:"connectRate"`
+	DisconnectRate float64 `json:"disconnectRate"`
+	MessageRate    float64 `json:"messageRate"`
+
+	// ChurnRate is the average of the connect and disconnect rates, i.e. the rate at which connections are
+	// replaced.  Unlike the number of connected devices, this rate exposes devices which repeatedly reconnect.
+	ChurnRate float64 `json:"churnRate"`
+}
+
+// churnBucket holds the events counted during a single slot of time
+type churnBucket struct {
+	slot             int64
+	connects         int
+	disconnects      int
+	messagesReceived int
+	messagesSent     int
+}
+
+// churnWindow is a tracked window along with the gauges which report it
+type churnWindow struct {
+	length time.Duration
+	label  string
+	slots  int64
+
+	churnRate      metrics.Gauge
+	connectRate    metrics.Gauge
+	disconnectRate metrics.Gauge
+	messageRate    metrics.Gauge
+}
+
+// Churn tracks device connections, disconnections, and messages over sliding windows.  Since churn reflects
+// how often devices reconnect, rather than how many are connected, it is a better signal for autoscaling and
+// alerting than instantaneous counts.
+//
+// A Churn is fed by a Manager's events, typically by adding OnDeviceEvent to Options.Listeners.  Its gauges
+// are refreshed by Run, while Stats always computes the current values.
+type Churn struct {
+	clock      Clock
+	resolution time.Duration
+	started    time.Time
+	windows    []churnWindow
+
+	lock    sync.Mutex
+	buckets []churnBucket
+}
+
+// NewChurn creates a Churn from a set of options, which may be nil
+func NewChurn(o *ChurnOptions) *Churn {
+	var (
+		provider = o.metricsProvider()
+		lengths  = o.windows()
+
+		churnRate      = provider.NewGauge(ChurnRateGauge)
+		connectRate    = provider.NewGauge(ConnectRateGauge)
+		disconnectRate = provider.NewGauge(DisconnectRateGauge)
+		messageRate    = provider.NewGauge(MessageRateGauge)
+
+		c = &Churn{
+			clock:      o.clock(),
+			resolution: o.resolution(),
+			windows:    make([]churnWindow, len(lengths)),
+		}
+	)
+
+	for i, length := range lengths {
+		label := windowLabel(length)
+		slots := int64(length / c.resolution)
+		if slots < 1 {
+			slots = 1
+		}
+
+		c.windows[i] = churnWindow{
+			length: length,
+			label:  label,
+			slots:  slots,
+
+			churnRate:      churnRate.With(WindowLabel, label),
+			connectRate:    connectRate.With(WindowLabel, label),
+			disconnectRate: disconnectRate.With(WindowLabel, label),
+			messageRate:    messageRate.With(WindowLabel, label),
+		}
+	}
+
+	// the windows are sorted, so the last one determines how much history is kept
+	c.buckets = make([]churnBucket, c.windows[len(c.windows)-1].slots)
+	c.started = c.clock.Now()
+	return c
+}
+
+// windowLabel produces the compact label of a window, e.g. "1m" rather than "1m0s"
+func windowLabel(length time.Duration) string {
+	switch {
+	case length%time.Hour == 0:
+		return fmt.Sprintf("%dh", length/time.Hour)
+	case length%time.Minute == 0:
+		return fmt.Sprintf("%dm", length/time.Minute)
+	case length%time.Second == 0:
+		return fmt.Sprintf("%ds", length/time.Second)
+	default:
+		return length.String()
+	}
+}
+
+// slot returns the slot of time into which an instant falls
+func (c *Churn) slot(t time.Time) int64 {
+	return t.UnixNano() / int64(c.resolution)
+}
+
+// bucket returns the bucket for the current slot, clearing it if it last held an earlier slot.
+// The lock must be held.
+func (c *Churn) bucket() *churnBucket {
+	slot := c.slot(c.clock.Now())
+	b := &c.buckets[slot%int64(len(c.buckets))]
+	if b.slot != slot {
+		*b = churnBucket{slot: slot}
+	}
+
+	return b
+}
+
+// OnDeviceEvent counts connections, disconnections, and messages.  This method is a Listener.
+// Other events are ignored without taking the lock.
+func (c *Churn) OnDeviceEvent(e *Event) {
+	switch e.Type {
+	case Connect, Disconnect, MessageReceived, MessageSent:
+	default:
+		return
+	}
+
+	c.lock.Lock()
+	switch e.Type {
+	case Connect:
+		c.bucket().connects++
+	case Disconnect:
+		c.bucket().disconnects++
+	case MessageReceived:
+		c.bucket().messagesReceived++
+	case MessageSent:
+		c.bucket().messagesSent++
+	}
+
+	c.lock.Unlock()
+}
+
+// Stats computes the activity within each window, in order of increasing window length
+func (c *Churn) Stats() []ChurnStats {
+	now := c.clock.Now()
+	current := c.slot(now)
+	elapsed := now.Sub(c.started)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	stats := make([]ChurnStats, len(c.windows))
+	for i, w := range c.windows {
+		s := ChurnStats{Window: w.label}
+		for slot := current - w.slots + 1; slot <= current; slot++ {
+			if b := &c.buckets[slot%int64(len(c.buckets))]; b.slot == slot {
+				s.Connects += b.connects
+				s.Disconnects += b.disconnects
+				s.MessagesReceived += b.messagesReceived
+				s.MessagesSent += b.messagesSent
+			}
+		}
+
+		// until a window has filled, rates are computed over the time actually tracked
+		seconds := w.length.Seconds()
+		if elapsed < w.length {
+			seconds = elapsed.Seconds()
+			if min := c.resolution.Seconds(); seconds < min {
+				seconds = min
+			}
+		}
+
+		s.ConnectRate = float64(s.Connects) / seconds
+		s.DisconnectRate = float64(s.Disconnects) / seconds
+		s.MessageRate = float64(s.MessagesReceived+s.MessagesSent) / seconds
+		s.ChurnRate = (s.ConnectRate + s.DisconnectRate) / 2
+		stats[i] = s
+	}
+
+	return stats
+}
+
+// Update sets the churn gauges from the current Stats
+func (c *Churn) Update() {
+	for i, s := range c.Stats() {
+		w := &c.windows[i]
+		w.churnRate.Set(s.ChurnRate)
+		w.connectRate.Set(s.ConnectRate)
+		w.disconnectRate.Set(s.DisconnectRate)
+		w.messageRate.Set(s.MessageRate)
+	}
+}
+
+// Run updates the churn gauges once per resolution until shutdown is closed.  This method
+// allows a Churn to be used as a concurrent.Runnable.
+func (c *Churn) Run(waitGroup *sync.WaitGroup, shutdown <-chan struct{}) error {
+	ticker := c.clock.NewTicker(c.resolution)
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-shutdown:
+				return
+			case <-ticker.C():
+				c.Update()
+			}
+		}
+	}()
+
+	return nil
+}
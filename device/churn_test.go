@@ -0,0 +1,182 @@
+package device
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock/clocktest"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChurnOptionsDefault(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, o := range []*ChurnOptions{nil, new(ChurnOptions), {Windows: []time.Duration{0, -time.Second}}} {
+		t.Log(o)
+
+		assert.Equal(DefaultChurnWindows(), o.windows())
+		assert.Equal(DefaultChurnResolution, o.resolution())
+		assert.NotNil(o.metricsProvider())
+		assert.Equal(SystemClock(), o.clock())
+	}
+}
+
+func TestChurnOptions(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		clock  = clocktest.NewClock(time.Now())
+
+		o = ChurnOptions{
+			Windows:         []time.Duration{10 * time.Minute, time.Minute, 0},
+			Resolution:      5 * time.Second,
+			MetricsProvider: xmetrics.NewDiscardProvider(),
+			Clock:           clock,
+		}
+	)
+
+	assert.Equal([]time.Duration{time.Minute, 10 * time.Minute}, o.windows())
+	assert.Equal(o.Resolution, o.resolution())
+	assert.Equal(o.MetricsProvider, o.metricsProvider())
+	assert.Equal(clock, o.clock())
+}
+
+func TestWindowLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("2h", windowLabel(2*time.Hour))
+	assert.Equal("90m", windowLabel(90*time.Minute))
+	assert.Equal("15m", windowLabel(15*time.Minute))
+	assert.Equal("45s", windowLabel(45*time.Second))
+	assert.Equal("1.5s", windowLabel(1500*time.Millisecond))
+}
+
+func TestChurnStats(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		clock  = clocktest.NewClock(time.Unix(1000, 0))
+		churn  = NewChurn(&ChurnOptions{
+			Windows: []time.Duration{time.Minute, 5 * time.Minute},
+			Clock:   clock,
+		})
+	)
+
+	for _, eventType := range []EventType{Connect, Connect, Disconnect, MessageReceived, MessageSent, MessageFailed, Pong} {
+		churn.OnDeviceEvent(&Event{Type: eventType})
+	}
+
+	// until a window fills, rates are computed over the time tracked so far
+	clock.Add(30 * time.Second)
+	assert.Equal(
+		[]ChurnStats{
+			{Window: "1m", Connects: 2, Disconnects: 1, MessagesReceived: 1, MessagesSent: 1, ConnectRate: 2.0 / 30, DisconnectRate: 1.0 / 30, MessageRate: 2.0 / 30, ChurnRate: 1.5 / 30},
+			{Window: "5m", Connects: 2, Disconnects: 1, MessagesReceived: 1, MessagesSent: 1, ConnectRate: 2.0 / 30, DisconnectRate: 1.0 / 30, MessageRate: 2.0 / 30, ChurnRate: 1.5 / 30},
+		},
+		churn.Stats(),
+	)
+
+	// the first events slide out of the shorter window, but not the longer one
+	churn.OnDeviceEvent(&Event{Type: Disconnect})
+	clock.Add(45 * time.Second)
+	stats := churn.Stats()
+	assert.Equal(ChurnStats{Window: "1m", Disconnects: 1, DisconnectRate: 1.0 / 60, ChurnRate: 0.5 / 60}, stats[0])
+	assert.Equal(2, stats[1].Connects)
+	assert.Equal(2, stats[1].Disconnects)
+	assert.Equal(2.0/75, stats[1].DisconnectRate)
+
+	// once every window has passed, nothing remains
+	clock.Add(5 * time.Minute)
+	for _, s := range churn.Stats() {
+		assert.Zero(s.Connects)
+		assert.Zero(s.Disconnects)
+		assert.Zero(s.ChurnRate)
+	}
+}
+
+func TestChurnBucketReuse(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		clock  = clocktest.NewClock(time.Unix(1000, 0))
+		churn  = NewChurn(&ChurnOptions{
+			Windows:    []time.Duration{10 * time.Second},
+			Resolution: time.Second,
+			Clock:      clock,
+		})
+	)
+
+	// events exactly one ring apart land in the same bucket, which must not accumulate stale counts
+	churn.OnDeviceEvent(&Event{Type: Connect})
+	clock.Add(10 * time.Second)
+	churn.OnDeviceEvent(&Event{Type: Connect})
+
+	stats := churn.Stats()
+	assert.Equal(1, stats[0].Connects)
+	assert.Equal(0.1, stats[0].ConnectRate)
+}
+
+func TestChurnRun(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+		clock         = clocktest.NewClock(time.Unix(1000, 0))
+	)
+
+	require.NoError(err)
+	// the resolution is the ticker period, so advancing the clock by one resolution produces exactly one update
+	churn := NewChurn(&ChurnOptions{
+		Windows:         []time.Duration{time.Minute},
+		Resolution:      30 * time.Second,
+		MetricsProvider: registry,
+		Clock:           clock,
+	})
+
+	var (
+		waitGroup = new(sync.WaitGroup)
+		shutdown  = make(chan struct{})
+	)
+
+	require.NoError(churn.Run(waitGroup, shutdown))
+	churn.OnDeviceEvent(&Event{Type: Connect})
+	churn.OnDeviceEvent(&Event{Type: Disconnect})
+
+	clock.BlockUntil(1)
+	clock.Add(30 * time.Second)
+
+	scrape := func() string {
+		response := httptest.NewRecorder()
+		registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+		return response.Body.String()
+	}
+
+	// the ticker fires asynchronously, so wait for every gauge to be updated
+	updated := func(metrics string) bool {
+		for _, name := range []string{ChurnRateGauge, ConnectRateGauge, DisconnectRateGauge, MessageRateGauge} {
+			if !strings.Contains(metrics, name+`{window="1m"}`) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	var metrics string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if metrics = scrape(); updated(metrics) {
+			break
+		}
+	}
+
+	assert.Contains(metrics, `device_churn_rate{window="1m"} 0.0333`)
+	assert.Contains(metrics, `device_connect_rate{window="1m"} 0.0333`)
+	assert.Contains(metrics, `device_disconnect_rate{window="1m"} 0.0333`)
+	assert.Contains(metrics, `device_message_rate{window="1m"} 0`)
+
+	close(shutdown)
+	waitGroup.Wait()
+}
@@ -0,0 +1,25 @@
+package device
+
+import "github.com/Comcast/webpa-common/clock"
+
+// Clock is the source of time for a Manager.  Pings, keepalives, the authorization delay,
+// and draining are all driven by a Manager's Clock, which allows tests to control time
+// rather than waiting on it.  Any clock.Interface, such as a clocktest.Clock, is a Clock.
+type Clock interface {
+	clock.Interface
+}
+
+// Ticker is the behavior of a time.Ticker obtained from a Clock
+type Ticker interface {
+	clock.Ticker
+}
+
+// Timer is the behavior of a time.Timer obtained from a Clock
+type Timer interface {
+	clock.Timer
+}
+
+// SystemClock returns the Clock backed by the time package.  This is the default Clock for a Manager.
+func SystemClock() Clock {
+	return clock.System()
+}
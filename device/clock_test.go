@@ -0,0 +1,41 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemClock(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		clock   = SystemClock()
+	)
+
+	require.NotNil(clock)
+	before := time.Now()
+	assert.False(clock.Now().Before(before))
+
+	ticker := clock.NewTicker(time.Millisecond)
+	select {
+	case <-ticker.C():
+	case <-time.After(5 * time.Second):
+		assert.Fail("The ticker did not fire")
+	}
+
+	ticker.Stop()
+
+	fired := make(chan struct{})
+	timer := clock.AfterFunc(time.Millisecond, func() { close(fired) })
+	select {
+	case <-fired:
+	case <-time.After(5 * time.Second):
+		assert.Fail("The timer did not fire")
+	}
+
+	assert.False(timer.Stop())
+	assert.True(clock.AfterFunc(time.Hour, func() {}).Stop())
+}
@@ -0,0 +1,56 @@
+package device
+
+import (
+	"net/http"
+)
+
+// ConnectAuthentication is the decision of a ConnectAuthenticator about a single connection attempt
+type ConnectAuthentication struct {
+	// Allow indicates whether the device may connect.  The zero value denies the device.
+	Allow bool
+
+	// StatusCode is the HTTP status returned to a denied device.  If not set, http.StatusForbidden is used.
+	StatusCode int
+
+	// Reason is an optional description of a denial, returned to the device in the response body
+	Reason string
+
+	// Attributes is optional metadata attached to an allowed device, available via Attributed.Attributes.
+	// For example, an authenticator may attach the account or entitlements looked up for the device.
+	Attributes map[string]interface{}
+}
+
+// Attributed is an optional interface implemented by devices which carry the metadata attached by a
+// ConnectAuthenticator.  Devices connected through a Manager implement this interface.
+type Attributed interface {
+	// Attributes returns the metadata attached to this device by the Manager's ConnectAuthenticator,
+	// or nil if there is none.  The returned map must not be modified.
+	Attributes() map[string]interface{}
+}
+
+// statusCode returns the HTTP status for a denial
+func (a *ConnectAuthentication) statusCode() int {
+	if a.StatusCode > 0 {
+		return a.StatusCode
+	}
+
+	return http.StatusForbidden
+}
+
+// ConnectAuthenticator decides whether a device may connect.  A Manager consults its ConnectAuthenticator
+// after the device's ID and convey are established, but before the websocket upgrade, so denied devices never
+// hold a websocket.  The request carries everything the device presented, including headers and any TLS client
+// certificate.
+//
+// An error indicates that the authenticator could not reach a decision, e.g. because an entitlement service
+// was unavailable.  The device is refused with http.StatusServiceUnavailable, so that it retries later.
+type ConnectAuthenticator interface {
+	AuthenticateConnect(id ID, convey Convey, request *http.Request) (ConnectAuthentication, error)
+}
+
+// ConnectAuthenticatorFunc is a function type that implements ConnectAuthenticator
+type ConnectAuthenticatorFunc func(ID, Convey, *http.Request) (ConnectAuthentication, error)
+
+func (f ConnectAuthenticatorFunc) AuthenticateConnect(id ID, convey Convey, request *http.Request) (ConnectAuthentication, error) {
+	return f(id, convey, request)
+}
@@ -0,0 +1,139 @@
+package device
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectAuthenticatorFunc(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		request  = httptest.NewRequest("GET", "/", nil)
+		expected = ConnectAuthentication{Allow: true, Attributes: map[string]interface{}{"account": "1234"}}
+
+		authenticator = ConnectAuthenticatorFunc(func(id ID, convey Convey, actual *http.Request) (ConnectAuthentication, error) {
+			assert.Equal(ID("mac:112233445566"), id)
+			assert.Equal(Convey{"foo": "bar"}, convey)
+			assert.True(request == actual)
+			return expected, nil
+		})
+	)
+
+	actual, err := authenticator.AuthenticateConnect(ID("mac:112233445566"), Convey{"foo": "bar"}, request)
+	assert.Equal(expected, actual)
+	assert.NoError(err)
+}
+
+func TestConnectAuthenticationStatusCode(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(http.StatusForbidden, new(ConnectAuthentication).statusCode())
+	assert.Equal(http.StatusUnauthorized, (&ConnectAuthentication{StatusCode: http.StatusUnauthorized}).statusCode())
+}
+
+func TestManagerConnectAuthenticatorDenied(t *testing.T) {
+	testData := []struct {
+		authentication     ConnectAuthentication
+		authError          error
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{ConnectAuthentication{}, nil, http.StatusForbidden, ErrorConnectDenied.Error()},
+		{ConnectAuthentication{StatusCode: http.StatusUnauthorized, Reason: "unknown partner"}, nil, http.StatusUnauthorized, "unknown partner"},
+		{ConnectAuthentication{Allow: true}, errors.New("entitlements unavailable"), http.StatusServiceUnavailable, "entitlements unavailable"},
+	}
+
+	for _, record := range testData {
+		t.Run(record.expectedBody, func(t *testing.T) {
+			var (
+				assert      = assert.New(t)
+				connections = new(mockConnectionFactory)
+				manager     = NewManager(
+					&Options{
+						Logger: logging.TestLogger(t),
+						ConnectAuthenticator: ConnectAuthenticatorFunc(func(ID, Convey, *http.Request) (ConnectAuthentication, error) {
+							return record.authentication, record.authError
+						}),
+					},
+					connections,
+				)
+
+				response = httptest.NewRecorder()
+				request  = WithIDRequest(ID("mac:112233445566"), httptest.NewRequest("GET", "/", nil))
+			)
+
+			d, err := manager.Connect(response, request, nil)
+			assert.Nil(d)
+			assert.Error(err)
+			assert.Equal(record.expectedStatusCode, response.Code)
+			assert.Contains(response.Body.String(), record.expectedBody)
+
+			// the websocket upgrade is never attempted
+			connections.AssertExpectations(t)
+		})
+	}
+}
+
+func TestManagerConnectAuthenticatorAllowed(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		attributes = map[string]interface{}{"account": "1234"}
+		connected  = make(chan Interface, 1)
+
+		options = &Options{
+			Logger: logging.TestLogger(t),
+			ConnectAuthenticator: ConnectAuthenticatorFunc(func(id ID, convey Convey, request *http.Request) (ConnectAuthentication, error) {
+				if request.Header.Get("X-Test-Credential") != "secret" {
+					return ConnectAuthentication{}, nil
+				}
+
+				return ConnectAuthentication{Allow: true, Attributes: attributes}, nil
+			}),
+			Listeners: []Listener{
+				func(e *Event) {
+					if e.Type == Connect {
+						connected <- e.Device
+					}
+				},
+			},
+		}
+	)
+
+	manager, server, connectURL := startWebsocketServer(options)
+	defer server.Close()
+
+	dialer := NewDialer(options, nil)
+	connection, response, err := dialer.Dial(connectURL, "mac:112233445566", nil, nil)
+	assert.Nil(connection)
+	assert.Error(err)
+	if assert.NotNil(response) {
+		assert.Equal(http.StatusForbidden, response.StatusCode)
+	}
+
+	connection, _, err = dialer.Dial(connectURL, "mac:112233445566", nil, http.Header{"X-Test-Credential": {"secret"}})
+	require.NoError(err)
+	require.NotNil(connection)
+	defer connection.Close()
+
+	select {
+	case d := <-connected:
+		if attributed, ok := d.(Attributed); assert.True(ok) {
+			assert.Equal(attributes, attributed.Attributes())
+		}
+	case <-time.After(5 * time.Second):
+		require.Fail("The device did not connect")
+	}
+
+	page := manager.(Enumerator).Devices(Filter{}, Cursor{})
+	if assert.Len(page.Devices, 1) {
+		assert.Equal(attributes, page.Devices[0].Attributes)
+	}
+}
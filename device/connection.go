@@ -62,6 +62,19 @@ type Connection interface {
 	// SendClose transmits a close frame to the device.  After this method is invoked,
 	// the only method that should be invoked is Close()
 	SendClose() error
+
+	// SendControl transmits a control frame with an arbitrary payload to the device.  As with Ping,
+	// this method may be invoked concurrently with any other method of this interface.  After a
+	// CloseFrame is sent, the only method that should be invoked is Close().
+	SendControl(ControlFrameType, []byte) error
+
+	// SetControlCallback registers the given function to be invoked whenever this connection
+	// receives a ping or close frame from the device.  Pongs are reported via SetPongCallback instead.
+	// The callback does not replace the standard handling of these frames, i.e. pings are still answered
+	// with pongs and close frames are still echoed.  The callback can be nil, which removes any callback.
+	//
+	// This method cannot be called concurrently with Write().
+	SetControlCallback(func(ControlFrameType, []byte))
 }
 
 // connection is the internal implementation of Connection
@@ -116,6 +129,27 @@ func (c *connection) SetPongCallback(callback func(string)) {
 	}
 }
 
+func (c *connection) SetControlCallback(callback func(ControlFrameType, []byte)) {
+	// start from the default handlers, so that the standard handling of each frame is preserved
+	c.webSocket.SetPingHandler(nil)
+	c.webSocket.SetCloseHandler(nil)
+	if callback == nil {
+		return
+	}
+
+	pingHandler := c.webSocket.PingHandler()
+	c.webSocket.SetPingHandler(func(data string) error {
+		callback(PingFrame, []byte(data))
+		return pingHandler(data)
+	})
+
+	closeHandler := c.webSocket.CloseHandler()
+	c.webSocket.SetCloseHandler(func(code int, text string) error {
+		callback(CloseFrame, websocket.FormatCloseMessage(code, text))
+		return closeHandler(code, text)
+	})
+}
+
 func (c *connection) NextReader() (frame io.Reader, err error) {
 	if err = c.updateReadDeadline(); err != nil {
 		return
@@ -140,6 +174,10 @@ func (c *connection) Read(target io.ReaderFrom) (frameRead bool, err error) {
 		_, err = target.ReadFrom(frame)
 	}
 
+	if err == websocket.ErrReadLimit {
+		err = ErrorMessageTooLarge
+	}
+
 	return
 }
 
@@ -173,6 +211,10 @@ func (c *connection) SendClose() error {
 	)
 }
 
+func (c *connection) SendControl(frameType ControlFrameType, data []byte) error {
+	return c.webSocket.WriteControl(int(frameType), data, c.nextWriteDeadline())
+}
+
 func (c *connection) Ping(data []byte) error {
 	return c.webSocket.WriteControl(websocket.PingMessage, data, c.nextWriteDeadline())
 }
@@ -192,21 +234,26 @@ func NewConnectionFactory(o *Options) ConnectionFactory {
 			ReadBufferSize:   o.readBufferSize(),
 			WriteBufferSize:  o.writeBufferSize(),
 			Subprotocols:     o.subprotocols(),
+			CheckOrigin:      o.checkOrigin(),
 		},
-		idlePeriod:   o.idlePeriod(),
-		writeTimeout: o.writeTimeout(),
+		responseHeader: o.responseHeader(),
+		idlePeriod:     o.idlePeriod(),
+		writeTimeout:   o.writeTimeout(),
+		maxMessageSize: o.maxMessageSize(),
 	}
 }
 
 // connectionFactory is the default ConnectionFactory implementation
 type connectionFactory struct {
-	upgrader     websocket.Upgrader
-	idlePeriod   time.Duration
-	writeTimeout time.Duration
+	upgrader       websocket.Upgrader
+	responseHeader http.Header
+	idlePeriod     time.Duration
+	writeTimeout   time.Duration
+	maxMessageSize int
 }
 
 func (cf *connectionFactory) NewConnection(response http.ResponseWriter, request *http.Request, responseHeader http.Header) (Connection, error) {
-	webSocket, err := cf.upgrader.Upgrade(response, request, responseHeader)
+	webSocket, err := cf.upgrader.Upgrade(response, request, mergeHeader(cf.responseHeader, responseHeader))
 	if err != nil {
 		return nil, err
 	}
@@ -217,6 +264,11 @@ func (cf *connectionFactory) NewConnection(response http.ResponseWriter, request
 		writeTimeout: cf.writeTimeout,
 	}
 
+	if cf.maxMessageSize > 0 {
+		// gorilla closes the connection as soon as a frame exceeds the limit, before buffering it
+		webSocket.SetReadLimit(int64(cf.maxMessageSize))
+	}
+
 	// initialize the pong callback to the default, which
 	// also registers the handler that enforces the idle policy
 	c.SetPongCallback(nil)
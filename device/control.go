@@ -0,0 +1,44 @@
+package device
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// MaxControlPayloadSize is the largest payload permitted in a websocket control frame
+	MaxControlPayloadSize = 125
+
+	InvalidControlFrameString = "!!INVALID CONTROL FRAME TYPE!!"
+)
+
+// ControlFrameType identifies a kind of websocket control frame
+type ControlFrameType int
+
+const (
+	PingFrame  ControlFrameType = websocket.PingMessage
+	PongFrame  ControlFrameType = websocket.PongMessage
+	CloseFrame ControlFrameType = websocket.CloseMessage
+)
+
+func (cft ControlFrameType) String() string {
+	switch cft {
+	case PingFrame:
+		return "ping"
+	case PongFrame:
+		return "pong"
+	case CloseFrame:
+		return "close"
+	default:
+		return InvalidControlFrameString
+	}
+}
+
+// ControlFrameListener is notified of each control frame received from a device.  The payload of a close
+// frame is in its wire format, i.e. a 2-byte status code followed by the text.  Listeners are invoked on the
+// device's read pump, so they must not block and must not retain the payload after returning.
+type ControlFrameListener func(d Interface, frameType ControlFrameType, payload []byte)
+
+// FormatClosePayload produces the payload of a close frame with the given status code and text
+func FormatClosePayload(code int, text string) []byte {
+	return websocket.FormatCloseMessage(code, text)
+}
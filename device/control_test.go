@@ -0,0 +1,20 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControlFrameTypeString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("ping", PingFrame.String())
+	assert.Equal("pong", PongFrame.String())
+	assert.Equal("close", CloseFrame.String())
+	assert.Equal(InvalidControlFrameString, ControlFrameType(-1).String())
+}
+
+func TestFormatClosePayload(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]byte{0x0f, 0xa0, 'b', 'y', 'e'}, FormatClosePayload(4000, "bye"))
+}
@@ -0,0 +1,99 @@
+package device
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/wrp"
+)
+
+// dedupeKey identifies a single logical message from a device.  Retries of a message come from
+// the same authenticated device and carry the same transaction UUID, or failing that the same content hash.
+// The message's Source is not used, since it is supplied by the device and cannot be trusted.
+type dedupeKey struct {
+	device ID
+	id     string
+}
+
+// dedupeEntry records when a message was first seen
+type dedupeEntry struct {
+	key  dedupeKey
+	seen time.Time
+}
+
+// deduper is a bounded, expiring set of recently received messages.  Entries are kept in the order in which
+// they were first seen, so that the oldest entries are both the first to expire and the first to be evicted
+// when the set is full.  Retries do not extend the window of the original message.
+type deduper struct {
+	maxSize int
+	window  time.Duration
+	hashing *wrp.Hashing
+	now     func() time.Time
+
+	lock    sync.Mutex
+	entries map[dedupeKey]*list.Element
+	order   *list.List
+}
+
+func newDeduper(maxSize int, window time.Duration, hashing *wrp.Hashing) *deduper {
+	return &deduper{
+		maxSize: maxSize,
+		window:  window,
+		hashing: hashing,
+		now:     time.Now,
+		entries: make(map[dedupeKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// purge discards entries which have fallen outside the window.  This method must be called under the lock.
+func (d *deduper) purge(now time.Time) {
+	for back := d.order.Back(); back != nil; back = d.order.Back() {
+		entry := back.Value.(*dedupeEntry)
+		if now.Sub(entry.seen) < d.window {
+			return
+		}
+
+		d.order.Remove(back)
+		delete(d.entries, entry.key)
+	}
+}
+
+// id returns the identifier of a message for deduplication, which is its transaction UUID.  Messages
+// without a transaction UUID are identified by their content hash, provided this deduper has a Hashing.
+func (d *deduper) id(message *wrp.Message) string {
+	if len(message.TransactionUUID) > 0 || d.hashing == nil {
+		return message.TransactionUUID
+	}
+
+	return d.hashing.Key(message)
+}
+
+// duplicate tests if a message with the given id has already been seen from the given device within the window.
+// If not, the message is recorded.  Messages without an id are never duplicates.
+func (d *deduper) duplicate(device ID, id string) bool {
+	if len(id) == 0 {
+		return false
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := d.now()
+	d.purge(now)
+
+	key := dedupeKey{device, id}
+	if _, ok := d.entries[key]; ok {
+		return true
+	}
+
+	d.entries[key] = d.order.PushFront(&dedupeEntry{key: key, seen: now})
+	if d.order.Len() > d.maxSize {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.entries, oldest.Value.(*dedupeEntry).key)
+	}
+
+	return false
+}
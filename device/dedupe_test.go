@@ -0,0 +1,61 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeduper(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		now     = time.Now()
+		deduper = newDeduper(2, time.Minute, nil)
+	)
+
+	deduper.now = func() time.Time { return now }
+
+	// messages without a transaction UUID are never deduplicated
+	assert.False(deduper.duplicate("source", ""))
+	assert.False(deduper.duplicate("source", ""))
+	assert.Zero(deduper.order.Len())
+
+	assert.False(deduper.duplicate("source", "first"))
+	assert.True(deduper.duplicate("source", "first"))
+	assert.False(deduper.duplicate("other", "first"))
+	assert.True(deduper.duplicate("other", "first"))
+
+	// retries do not extend the window
+	now = now.Add(time.Minute - time.Second)
+	assert.True(deduper.duplicate("source", "first"))
+	now = now.Add(time.Second)
+	assert.False(deduper.duplicate("source", "first"))
+
+	// ("other", "first") has expired, and the oldest entry is evicted when the set is full
+	assert.False(deduper.duplicate("source", "second"))
+	assert.False(deduper.duplicate("source", "third"))
+	assert.Equal(2, deduper.order.Len())
+	assert.False(deduper.duplicate("source", "first"))
+	assert.True(deduper.duplicate("source", "third"))
+
+	now = now.Add(time.Minute)
+	assert.False(deduper.duplicate("source", "third"))
+	assert.Equal(1, deduper.order.Len())
+	assert.Len(deduper.entries, 1)
+}
+
+func TestDeduperID(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		message = &wrp.Message{Type: wrp.SimpleEventMessageType, Source: "source", Destination: "event:test"}
+	)
+
+	assert.Empty(newDeduper(2, time.Minute, nil).id(message))
+	assert.Equal(wrp.IdempotencyKey(message), newDeduper(2, time.Minute, new(wrp.Hashing)).id(message))
+
+	message.TransactionUUID = "first"
+	assert.Equal("first", newDeduper(2, time.Minute, nil).id(message))
+	assert.Equal("first", newDeduper(2, time.Minute, new(wrp.Hashing)).id(message))
+}
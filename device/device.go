@@ -23,6 +23,7 @@ var (
 type envelope struct {
 	request  *Request
 	complete chan<- error
+	enqueued time.Time
 }
 
 // Interface is the core type for this package.  It provides
@@ -68,6 +69,10 @@ type Interface interface {
 	// If this device has no convey data, this method does nothing.
 	SetConveyHeader(http.Header)
 
+	// Partner returns the partner, i.e. the tenant, to which this device belongs, or the empty string if the
+	// device has no partner.  Messages received from this device carry the partner in their metadata.
+	Partner() string
+
 	// Pending returns the count of pending messages for this device
 	Pending() int
 
@@ -92,6 +97,19 @@ type Interface interface {
 
 	// Statistics returns the current, tracked Statistics instance for this device
 	Statistics() Statistics
+
+	// SendPing transmits a websocket ping frame with a custom payload to this device, independently of the
+	// pings sent by the enclosing Manager.  The device's pong is reported to any ControlFrameListener.
+	// The payload cannot exceed MaxControlPayloadSize bytes.
+	SendPing(payload []byte) error
+
+	// SendClose disconnects this device after transmitting a websocket close frame with the given
+	// status code and text.  The encoded close payload cannot exceed MaxControlPayloadSize bytes.
+	SendClose(code int, text string) error
+
+	// SetControlFrameListener registers a listener for the control frames received from this device.
+	// This allows for application-level keepalive protocols.  A nil listener removes any existing listener.
+	SetControlFrameListener(ControlFrameListener)
 }
 
 // device is the internal Interface implementation.  This type holds the internal
@@ -108,12 +126,36 @@ type device struct {
 	state int32
 
 	shutdown     chan struct{}
-	messages     chan *envelope
+	messages     *messageQueue
 	transactions *Transactions
+
+	// history holds this device's recent events.  If nil, event history is disabled.
+	history *eventHistory
+
+	// connection is used to send control frames.  It is nil until the device's pumps have started.
+	connection Connection
+
+	// now is the source of the enqueue times of messages sent to this device
+	now func() time.Time
+
+	// closePayload is the payload of the close frame sent when this device is shut down
+	closePayload atomic.Value
+
+	controlListener atomic.Value
+
+	// partner is the partner established when this device connected, if any
+	partner string
+
+	// attributes is the metadata attached by the ConnectAuthenticator when this device connected, if any
+	attributes map[string]interface{}
+
+	// lastActivity is the UnixNano time at which a data frame was last received from this device.  Control
+	// frames, such as pongs, do not count as activity.
+	lastActivity int64
 }
 
 // newDevice is an internal factory function for devices
-func newDevice(id ID, initialKey Key, convey Convey, encodedConvey string, queueSize int) *device {
+func newDevice(id ID, initialKey Key, convey Convey, encodedConvey string, queueSize int, weights qosWeights) *device {
 	d := &device{
 		id:            id,
 		convey:        convey,
@@ -121,11 +163,13 @@ func newDevice(id ID, initialKey Key, convey Convey, encodedConvey string, queue
 		statistics:    NewStatistics(time.Now().UTC()),
 		state:         stateOpen,
 		shutdown:      make(chan struct{}),
-		messages:      make(chan *envelope, queueSize),
+		messages:      newMessageQueue(queueSize, weights),
 		transactions:  NewTransactions(),
+		now:           time.Now,
 	}
 
 	d.updateKey(initialKey)
+	d.touch(d.statistics.ConnectedAt())
 	return d
 }
 
@@ -182,6 +226,14 @@ func (d *device) Convey() Convey {
 	return d.convey
 }
 
+func (d *device) Attributes() map[string]interface{} {
+	return d.attributes
+}
+
+func (d *device) Partner() string {
+	return d.partner
+}
+
 func (d *device) EncodedConvey() string {
 	return d.encodedConvey
 }
@@ -192,8 +244,19 @@ func (d *device) SetConveyHeader(header http.Header) {
 	}
 }
 
+// touch records activity from this device at the given time
+func (d *device) touch(t time.Time) {
+	atomic.StoreInt64(&d.lastActivity, t.UnixNano())
+}
+
+// LastActivity returns the time at which a data frame was last received from this device, or the
+// connection time if nothing has been received
+func (d *device) LastActivity() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&d.lastActivity)).UTC()
+}
+
 func (d *device) Pending() int {
-	return len(d.messages)
+	return d.messages.len()
 }
 
 func (d *device) Closed() bool {
@@ -201,7 +264,8 @@ func (d *device) Closed() bool {
 }
 
 // sendRequest attempts to enqueue the given request for the write pump that is
-// servicing this device.  This method honors the request context's cancellation semantics.
+// servicing this device.  The request is queued according to its QOS level.  This method
+// honors the request context's cancellation semantics.
 //
 // This function returns when either (1) the write pump has attempted to send the message to
 // the device, or (2) the request's context has been cancelled, which includes timing out.
@@ -210,8 +274,9 @@ func (d *device) sendRequest(request *Request) error {
 		done     = request.Context().Done()
 		complete = make(chan error, 1)
 		envelope = &envelope{
-			request,
-			complete,
+			request:  request,
+			complete: complete,
+			enqueued: d.now(),
 		}
 	)
 
@@ -221,7 +286,8 @@ func (d *device) sendRequest(request *Request) error {
 		return request.Context().Err()
 	case <-d.shutdown:
 		return ErrorDeviceClosed
-	case d.messages <- envelope:
+	case d.messages.reserve() <- struct{}{}:
+		d.messages.put(envelope)
 	}
 
 	// once enqueued, wait until the context is cancelled
@@ -236,6 +302,31 @@ func (d *device) sendRequest(request *Request) error {
 	}
 }
 
+// trySendRequest enqueues a request without waiting, either for room in the queue or for the request
+// to be written.  If the device's queue is full, ErrorDeviceBusy is returned.
+func (d *device) trySendRequest(request *Request) error {
+	select {
+	case <-d.shutdown:
+		return ErrorDeviceClosed
+	default:
+	}
+
+	envelope := &envelope{
+		request: request,
+		// the write pump reports the result, which nothing waits on, so the channel must never block
+		complete: make(chan error, 1),
+		enqueued: d.now(),
+	}
+
+	select {
+	case d.messages.reserve() <- struct{}{}:
+		d.messages.put(envelope)
+		return nil
+	default:
+		return ErrorDeviceBusy
+	}
+}
+
 // awaitResponse waits for the read pump to acquire a response that corresponds to the
 // request's transaction key.  The result channel will receive the response from the
 // read pump.
@@ -291,3 +382,46 @@ func (d *device) Send(request *Request) (*Response, error) {
 func (d *device) Statistics() Statistics {
 	return d.statistics
 }
+
+func (d *device) History() []HistoryRecord {
+	if d.history == nil {
+		return []HistoryRecord{}
+	}
+
+	return d.history.get()
+}
+
+func (d *device) SendPing(payload []byte) error {
+	if len(payload) > MaxControlPayloadSize {
+		return ErrorControlPayloadTooLarge
+	} else if d.Closed() || d.connection == nil {
+		return ErrorDeviceClosed
+	}
+
+	return d.connection.SendControl(PingFrame, payload)
+}
+
+func (d *device) SendClose(code int, text string) error {
+	payload := FormatClosePayload(code, text)
+	if len(payload) > MaxControlPayloadSize {
+		return ErrorControlPayloadTooLarge
+	} else if d.Closed() {
+		return ErrorDeviceClosed
+	}
+
+	// the close frame itself is sent by the write pump as part of shutting down
+	d.closePayload.Store(payload)
+	d.requestClose()
+	return nil
+}
+
+func (d *device) SetControlFrameListener(listener ControlFrameListener) {
+	d.controlListener.Store(listener)
+}
+
+// controlFrame notifies this device's ControlFrameListener, if any, of a control frame
+func (d *device) controlFrame(frameType ControlFrameType, payload []byte) {
+	if listener, _ := d.controlListener.Load().(ControlFrameListener); listener != nil {
+		listener(d, frameType, payload)
+	}
+}
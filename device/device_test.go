@@ -69,6 +69,7 @@ func TestDevice(t *testing.T) {
 				record.expectedConvey,
 				expectedEncodedConvey,
 				record.expectedQueueSize,
+				defaultQOSWeights,
 			)
 		)
 
@@ -135,3 +136,58 @@ func TestDevice(t *testing.T) {
 		assert.Error(err)
 	}
 }
+
+func TestDeviceControlFrames(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		device = newDevice(ID("test"), Key("test"), nil, "", 1, defaultQOSWeights)
+		frames []ControlFrameType
+	)
+
+	// with no listener, control frames are ignored
+	device.controlFrame(PingFrame, []byte("ignored"))
+
+	device.SetControlFrameListener(func(d Interface, frameType ControlFrameType, payload []byte) {
+		assert.Equal(device, d)
+		assert.Equal("payload", string(payload))
+		frames = append(frames, frameType)
+	})
+
+	device.controlFrame(PingFrame, []byte("payload"))
+	device.controlFrame(PongFrame, []byte("payload"))
+	assert.Equal([]ControlFrameType{PingFrame, PongFrame}, frames)
+
+	device.SetControlFrameListener(nil)
+	device.controlFrame(PingFrame, []byte("ignored"))
+	assert.Len(frames, 2)
+
+	// without a connection, pings cannot be sent
+	assert.Equal(ErrorDeviceClosed, device.SendPing([]byte("ping")))
+	assert.Equal(ErrorControlPayloadTooLarge, device.SendPing(make([]byte, MaxControlPayloadSize+1)))
+
+	assert.Equal(ErrorControlPayloadTooLarge, device.SendClose(4000, string(make([]byte, MaxControlPayloadSize))))
+	assert.False(device.Closed())
+
+	assert.NoError(device.SendClose(4000, "goodbye"))
+	assert.True(device.Closed())
+	assert.Equal(FormatClosePayload(4000, "goodbye"), device.closePayload.Load())
+	assert.Equal(ErrorDeviceClosed, device.SendClose(4000, "goodbye"))
+}
+
+func TestDeviceTrySendRequest(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		device  = newDevice(ID("test"), Key("test"), nil, "", 1, defaultQOSWeights)
+		request = &Request{Message: &wrp.Message{Type: wrp.SimpleRequestResponseMessageType}, Format: wrp.Msgpack}
+	)
+
+	assert.NoError(device.trySendRequest(request))
+	assert.Equal(1, device.messages.len())
+
+	// a full queue drops the request rather than waiting
+	assert.Equal(ErrorDeviceBusy, device.trySendRequest(request))
+	assert.Equal(1, device.messages.len())
+
+	device.requestClose()
+	assert.Equal(ErrorDeviceClosed, device.trySendRequest(request))
+}
@@ -0,0 +1,21 @@
+package devicetest
+
+import (
+	"time"
+
+	"github.com/Comcast/webpa-common/clock/clocktest"
+	"github.com/Comcast/webpa-common/device"
+)
+
+// Clock is a device.Clock whose time only moves when Add is called.  It is a clocktest.Clock,
+// and is retained here so that device tests need only this package.
+type Clock struct {
+	*clocktest.Clock
+}
+
+// NewClock creates a fake Clock starting at the given time
+func NewClock(now time.Time) *Clock {
+	return &Clock{clocktest.NewClock(now)}
+}
+
+var _ device.Clock = (*Clock)(nil)
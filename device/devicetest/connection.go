@@ -0,0 +1,449 @@
+package devicetest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/device"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultTimeout is the default length of time a Peer waits on its connection before giving up.
+	// This is only a safeguard against hung tests, and is not part of any test's timing.
+	DefaultTimeout = 5 * time.Second
+
+	// pingBufferSize is the number of pings, and of pongs, a Peer remembers
+	pingBufferSize = 16
+)
+
+var (
+	ErrorClosed                  = errors.New("The connection has been closed")
+	ErrorTimeout                 = errors.New("Timed out waiting on the connection")
+	ErrorUnsupportedControlFrame = errors.New("Unsupported control frame type")
+)
+
+// frame is a single websocket frame.  Text frames are not part of the WRP protocol
+// and are skipped by the server side of a pipe.
+type frame struct {
+	text bool
+	data []byte
+}
+
+// pipe is the shared state between the two ends of an in-memory connection
+type pipe struct {
+	toServer chan frame
+	toDevice chan []byte
+	pings    chan []byte
+	pongs    chan []byte
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	closeSent     chan struct{}
+	closeSentOnce sync.Once
+
+	lock            sync.Mutex
+	pongCallback    func(string)
+	controlCallback func(device.ControlFrameType, []byte)
+	closePayload    []byte
+	autoPong        bool
+}
+
+// Pipe creates an in-memory device.Connection together with the Peer that plays the part
+// of the device.  The bufferSize is the number of frames that may be in flight in each direction.
+// Once that many frames are buffered, the sender blocks until the other side reads.  A bufferSize
+// of zero means that each frame is handed off directly, which is useful for testing backpressure.
+//
+// By default, the Peer answers each ping with a pong immediately.
+func Pipe(bufferSize int) (*Connection, *Peer) {
+	if bufferSize < 0 {
+		bufferSize = 0
+	}
+
+	p := &pipe{
+		toServer:  make(chan frame, bufferSize),
+		toDevice:  make(chan []byte, bufferSize),
+		pings:     make(chan []byte, pingBufferSize),
+		pongs:     make(chan []byte, pingBufferSize),
+		closed:    make(chan struct{}),
+		closeSent: make(chan struct{}),
+		autoPong:  true,
+	}
+
+	return &Connection{p}, &Peer{pipe: p, Timeout: DefaultTimeout}
+}
+
+func (p *pipe) isClosed() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *pipe) close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	return nil
+}
+
+// Connection is the server side of an in-memory pipe.  It implements device.Connection.
+type Connection struct {
+	pipe *pipe
+}
+
+var _ device.Connection = (*Connection)(nil)
+
+func (c *Connection) NextReader() (io.Reader, error) {
+	var f frame
+
+	// frames sent before the peer closed are still delivered
+	select {
+	case f = <-c.pipe.toServer:
+	default:
+		select {
+		case f = <-c.pipe.toServer:
+		case <-c.pipe.closed:
+			return nil, ErrorClosed
+		}
+	}
+
+	if f.text {
+		return nil, nil
+	}
+
+	return bytes.NewReader(f.data), nil
+}
+
+func (c *Connection) Read(target io.ReaderFrom) (frameRead bool, err error) {
+	var frame io.Reader
+	frame, err = c.NextReader()
+	frameRead = (frame != nil)
+	if err == nil && frameRead {
+		_, err = target.ReadFrom(frame)
+	}
+
+	return
+}
+
+func (c *Connection) NextWriter() (io.WriteCloser, error) {
+	if c.pipe.isClosed() {
+		return nil, ErrorClosed
+	}
+
+	return &frameWriter{pipe: c.pipe}, nil
+}
+
+func (c *Connection) Write(message []byte) (int, error) {
+	frame, err := c.NextWriter()
+	if err != nil {
+		return 0, err
+	}
+
+	count, _ := frame.Write(message)
+	return count, frame.Close()
+}
+
+func (c *Connection) Ping(data []byte) error {
+	if c.pipe.isClosed() {
+		return ErrorClosed
+	}
+
+	select {
+	case c.pipe.pings <- append([]byte(nil), data...):
+	default:
+	}
+
+	c.pipe.lock.Lock()
+	callback, autoPong := c.pipe.pongCallback, c.pipe.autoPong
+	c.pipe.lock.Unlock()
+
+	if autoPong && callback != nil {
+		callback(string(data))
+	}
+
+	return nil
+}
+
+func (c *Connection) SetPongCallback(callback func(string)) {
+	c.pipe.lock.Lock()
+	c.pipe.pongCallback = callback
+	c.pipe.lock.Unlock()
+}
+
+func (c *Connection) SetControlCallback(callback func(device.ControlFrameType, []byte)) {
+	c.pipe.lock.Lock()
+	c.pipe.controlCallback = callback
+	c.pipe.lock.Unlock()
+}
+
+func (c *Connection) SendClose() error {
+	return c.SendControl(device.CloseFrame, device.FormatClosePayload(websocket.CloseNormalClosure, "close"))
+}
+
+func (c *Connection) SendControl(frameType device.ControlFrameType, data []byte) error {
+	if c.pipe.isClosed() {
+		return ErrorClosed
+	}
+
+	switch frameType {
+	case device.PingFrame:
+		return c.Ping(data)
+
+	case device.PongFrame:
+		select {
+		case c.pipe.pongs <- append([]byte(nil), data...):
+		default:
+		}
+
+	case device.CloseFrame:
+		c.pipe.closeSentOnce.Do(func() {
+			c.pipe.lock.Lock()
+			c.pipe.closePayload = append([]byte(nil), data...)
+			c.pipe.lock.Unlock()
+			close(c.pipe.closeSent)
+		})
+
+	default:
+		return ErrorUnsupportedControlFrame
+	}
+
+	return nil
+}
+
+func (c *Connection) Close() error {
+	return c.pipe.close()
+}
+
+// frameWriter accumulates a frame, which is delivered to the Peer on Close
+type frameWriter struct {
+	pipe   *pipe
+	buffer bytes.Buffer
+}
+
+func (fw *frameWriter) Write(data []byte) (int, error) {
+	return fw.buffer.Write(data)
+}
+
+func (fw *frameWriter) Close() error {
+	if fw.pipe.isClosed() {
+		return ErrorClosed
+	}
+
+	select {
+	case fw.pipe.toDevice <- fw.buffer.Bytes():
+		return nil
+	case <-fw.pipe.closed:
+		return ErrorClosed
+	}
+}
+
+// Peer is the device side of an in-memory pipe.  Tests use a Peer to script the behavior of a device.
+type Peer struct {
+	pipe *pipe
+
+	// Timeout is the length of time this Peer waits for the server side to accept or produce a frame.
+	// This field must not be changed after the Peer is in use.
+	Timeout time.Duration
+}
+
+func (p *Peer) timeout() <-chan time.Time {
+	return time.After(p.Timeout)
+}
+
+// SendFrame transmits a binary frame to the server.  This method blocks while the server isn't reading.
+func (p *Peer) SendFrame(data []byte) error {
+	return p.send(frame{data: data})
+}
+
+// SendText transmits a text frame to the server, which the server should skip
+func (p *Peer) SendText(data []byte) error {
+	return p.send(frame{text: true, data: data})
+}
+
+func (p *Peer) send(f frame) error {
+	if p.pipe.isClosed() {
+		return ErrorClosed
+	}
+
+	select {
+	case p.pipe.toServer <- f:
+		return nil
+	case <-p.pipe.closed:
+		return ErrorClosed
+	case <-p.timeout():
+		return ErrorTimeout
+	}
+}
+
+// Send encodes a WRP message and transmits it to the server
+func (p *Peer) Send(message *wrp.Message) error {
+	var data []byte
+	if err := wrp.NewEncoderBytes(&data, wrp.Msgpack).Encode(message); err != nil {
+		return err
+	}
+
+	return p.SendFrame(data)
+}
+
+// ReceiveFrame returns the next frame written by the server.  After the server has sent a close frame
+// or either side has closed the connection, and no more frames are pending, this method returns ErrorClosed.
+func (p *Peer) ReceiveFrame() ([]byte, error) {
+	select {
+	case data := <-p.pipe.toDevice:
+		return data, nil
+	default:
+	}
+
+	select {
+	case data := <-p.pipe.toDevice:
+		return data, nil
+	case <-p.pipe.closeSent:
+		return nil, ErrorClosed
+	case <-p.pipe.closed:
+		return nil, ErrorClosed
+	case <-p.timeout():
+		return nil, ErrorTimeout
+	}
+}
+
+// Receive decodes the next frame written by the server as a WRP message.  Protocol-level
+// keepalives are returned like any other message, with a type of wrp.ServiceAliveMessageType.
+func (p *Peer) Receive() (*wrp.Message, error) {
+	data, err := p.ReceiveFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	message := new(wrp.Message)
+	if err := wrp.NewDecoderBytes(data, wrp.Msgpack).Decode(message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// Respond starts a goroutine which answers each message received from the server.  The handler's
+// return value is sent back to the server, unless it is nil.  The goroutine exits when the connection closes.
+func (p *Peer) Respond(handler func(*wrp.Message) *wrp.Message) {
+	go func() {
+		for {
+			message, err := p.Receive()
+			switch err {
+			case nil:
+			case ErrorTimeout:
+				continue
+			case ErrorClosed:
+				return
+			default:
+				// skip frames which aren't valid WRP
+				continue
+			}
+
+			if reply := handler(message); reply != nil {
+				if err := p.Send(reply); err == ErrorClosed {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Pings returns the channel on which each ping sent by the server is delivered.  If pings are not
+// consumed, subsequent pings are dropped once the channel is full.
+func (p *Peer) Pings() <-chan []byte {
+	return p.pipe.pings
+}
+
+// SetAutoPong controls whether this Peer answers each ping with a pong.  When disabled, a test may
+// answer pings explicitly via Pong.
+func (p *Peer) SetAutoPong(autoPong bool) {
+	p.pipe.lock.Lock()
+	p.pipe.autoPong = autoPong
+	p.pipe.lock.Unlock()
+}
+
+// Pong simulates a pong from the device
+func (p *Peer) Pong(data string) {
+	p.pipe.lock.Lock()
+	callback := p.pipe.pongCallback
+	p.pipe.lock.Unlock()
+
+	if callback != nil {
+		callback(data)
+	}
+}
+
+// Pongs returns the channel on which each pong sent by the server, in answer to Ping, is delivered.
+// If pongs are not consumed, subsequent pongs are dropped once the channel is full.
+func (p *Peer) Pongs() <-chan []byte {
+	return p.pipe.pongs
+}
+
+// Ping simulates a ping from the device, which the server answers with a pong
+func (p *Peer) Ping(data []byte) error {
+	if p.pipe.isClosed() {
+		return ErrorClosed
+	}
+
+	p.pipe.lock.Lock()
+	callback := p.pipe.controlCallback
+	p.pipe.lock.Unlock()
+
+	if callback != nil {
+		callback(device.PingFrame, data)
+	}
+
+	select {
+	case p.pipe.pongs <- append([]byte(nil), data...):
+	default:
+	}
+
+	return nil
+}
+
+// CloseWith simulates the device sending a close frame with the given status code and text,
+// after which the connection is closed
+func (p *Peer) CloseWith(code int, text string) error {
+	if p.pipe.isClosed() {
+		return ErrorClosed
+	}
+
+	p.pipe.lock.Lock()
+	callback := p.pipe.controlCallback
+	p.pipe.lock.Unlock()
+
+	if callback != nil {
+		callback(device.CloseFrame, device.FormatClosePayload(code, text))
+	}
+
+	return p.pipe.close()
+}
+
+// ClosePayload returns the payload of the close frame sent by the server, or nil if the server
+// has not sent a close frame
+func (p *Peer) ClosePayload() []byte {
+	p.pipe.lock.Lock()
+	defer p.pipe.lock.Unlock()
+	return p.pipe.closePayload
+}
+
+// CloseSent returns a channel that is closed once the server has sent a close frame
+func (p *Peer) CloseSent() <-chan struct{} {
+	return p.pipe.closeSent
+}
+
+// Closed returns a channel that is closed once either side has closed the connection
+func (p *Peer) Closed() <-chan struct{} {
+	return p.pipe.closed
+}
+
+// Close simulates the device dropping its connection
+func (p *Peer) Close() error {
+	return p.pipe.close()
+}
@@ -0,0 +1,257 @@
+package devicetest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/device"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeToServer(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		c, peer  = Pipe(2)
+		expected = &wrp.Message{Type: wrp.SimpleEventMessageType, Source: "mac:112233445566", Destination: "event:test"}
+	)
+
+	require.NoError(peer.SendText([]byte("skipped")))
+	require.NoError(peer.Send(expected))
+
+	frameRead, err := c.Read(new(bytes.Buffer))
+	assert.False(frameRead)
+	assert.NoError(err)
+
+	var frame bytes.Buffer
+	frameRead, err = c.Read(&frame)
+	assert.True(frameRead)
+	require.NoError(err)
+
+	actual := new(wrp.Message)
+	require.NoError(wrp.NewDecoderBytes(frame.Bytes(), wrp.Msgpack).Decode(actual))
+	assert.Equal(*expected, *actual)
+
+	// frames sent prior to the device closing are still delivered
+	require.NoError(peer.SendFrame([]byte("last")))
+	require.NoError(peer.Close())
+
+	reader, err := c.NextReader()
+	require.NoError(err)
+	data, err := ioutil.ReadAll(reader)
+	assert.Equal("last", string(data))
+	assert.NoError(err)
+
+	reader, err = c.NextReader()
+	assert.Nil(reader)
+	assert.Equal(ErrorClosed, err)
+	assert.Equal(ErrorClosed, peer.Send(expected))
+}
+
+func TestPipeToDevice(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		c, peer  = Pipe(1)
+		expected = &wrp.Message{Type: wrp.SimpleEventMessageType, Source: "dns:server", Destination: "mac:112233445566"}
+	)
+
+	_, err := c.Write(wrp.MustEncode(expected, wrp.Msgpack))
+	require.NoError(err)
+
+	actual, err := peer.Receive()
+	require.NoError(err)
+	assert.Equal(*expected, *actual)
+
+	count, err := c.Write([]byte("frame"))
+	assert.Equal(5, count)
+	assert.NoError(err)
+
+	require.NoError(c.SendClose())
+	data, err := peer.ReceiveFrame()
+	assert.Equal("frame", string(data))
+	assert.NoError(err)
+
+	<-peer.CloseSent()
+	data, err = peer.ReceiveFrame()
+	assert.Empty(data)
+	assert.Equal(ErrorClosed, err)
+
+	require.NoError(c.Close())
+	<-peer.Closed()
+	_, err = c.NextWriter()
+	assert.Equal(ErrorClosed, err)
+	assert.Equal(ErrorClosed, c.SendClose())
+	assert.Equal(ErrorClosed, c.Ping(nil))
+}
+
+func TestPipeBackpressure(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		c, peer = Pipe(0)
+		written = make(chan error, 1)
+	)
+
+	peer.Timeout = time.Millisecond
+	_, err := peer.ReceiveFrame()
+	assert.Equal(ErrorTimeout, err)
+	assert.Equal(ErrorTimeout, peer.SendFrame([]byte("nobody is reading")))
+
+	go func() {
+		_, err := c.Write([]byte("blocked"))
+		written <- err
+	}()
+
+	peer.Timeout = DefaultTimeout
+	data, err := peer.ReceiveFrame()
+	require.NoError(err)
+	assert.Equal("blocked", string(data))
+	assert.NoError(<-written)
+
+	// closing the connection releases a blocked writer
+	go func() {
+		_, err := c.Write([]byte("never read"))
+		written <- err
+	}()
+
+	c.Close()
+	assert.Equal(ErrorClosed, <-written)
+}
+
+func TestPipePing(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		c, peer = Pipe(0)
+		pongs   = make(chan string, 10)
+	)
+
+	// with no callback, pings are still recorded
+	assert.NoError(c.Ping([]byte("first")))
+	assert.Equal("first", string(<-peer.Pings()))
+
+	c.SetPongCallback(func(data string) { pongs <- data })
+	assert.NoError(c.Ping([]byte("second")))
+	assert.Equal("second", string(<-peer.Pings()))
+	assert.Equal("second", <-pongs)
+
+	peer.SetAutoPong(false)
+	assert.NoError(c.Ping([]byte("third")))
+	assert.Equal("third", string(<-peer.Pings()))
+	assert.Empty(pongs)
+
+	peer.Pong("explicit")
+	assert.Equal("explicit", <-pongs)
+
+	c.SetPongCallback(nil)
+	peer.Pong("ignored")
+	assert.Empty(pongs)
+}
+
+func TestPipeControl(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		c, peer  = Pipe(0)
+		received = make(chan device.ControlFrameType, 10)
+	)
+
+	// with no callback, device control frames are still handled
+	assert.NoError(peer.Ping([]byte("first")))
+	assert.Equal("first", string(<-peer.Pongs()))
+
+	c.SetControlCallback(func(frameType device.ControlFrameType, data []byte) {
+		assert.Equal("second", string(data))
+		received <- frameType
+	})
+
+	assert.NoError(peer.Ping([]byte("second")))
+	assert.Equal(device.PingFrame, <-received)
+	assert.Equal("second", string(<-peer.Pongs()))
+
+	assert.NoError(c.SendControl(device.PingFrame, []byte("ping")))
+	assert.Equal("ping", string(<-peer.Pings()))
+	assert.NoError(c.SendControl(device.PongFrame, []byte("pong")))
+	assert.Equal("pong", string(<-peer.Pongs()))
+	assert.Equal(ErrorUnsupportedControlFrame, c.SendControl(device.ControlFrameType(-1), nil))
+
+	assert.Nil(peer.ClosePayload())
+	assert.NoError(c.SendControl(device.CloseFrame, device.FormatClosePayload(4000, "custom")))
+	assert.Equal(device.FormatClosePayload(4000, "custom"), peer.ClosePayload())
+
+	// only the first close frame is sent
+	assert.NoError(c.SendClose())
+	assert.Equal(device.FormatClosePayload(4000, "custom"), peer.ClosePayload())
+	select {
+	case <-peer.CloseSent():
+	default:
+		assert.Fail("The close frame was not sent")
+	}
+
+	c.SetControlCallback(func(frameType device.ControlFrameType, data []byte) {
+		assert.Equal(device.FormatClosePayload(4001, "goodbye"), data)
+		received <- frameType
+	})
+
+	assert.NoError(peer.CloseWith(4001, "goodbye"))
+	assert.Equal(device.CloseFrame, <-received)
+	assert.Equal(ErrorClosed, peer.Ping(nil))
+	assert.Equal(ErrorClosed, peer.CloseWith(4001, "goodbye"))
+	assert.Equal(ErrorClosed, c.SendControl(device.PingFrame, nil))
+}
+
+func TestPeerRespond(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		c, peer = Pipe(1)
+	)
+
+	peer.Respond(func(request *wrp.Message) *wrp.Message {
+		if request.Type != wrp.SimpleRequestResponseMessageType {
+			return nil
+		}
+
+		return &wrp.Message{
+			Type:            wrp.SimpleRequestResponseMessageType,
+			Source:          request.Destination,
+			Destination:     request.Source,
+			TransactionUUID: request.TransactionUUID,
+			Payload:         []byte("response"),
+		}
+	})
+
+	// frames that aren't WRP and messages that get no reply are skipped
+	_, err := c.Write([]byte("garbage"))
+	require.NoError(err)
+	_, err = c.Write(wrp.MustEncode(&wrp.Message{Type: wrp.SimpleEventMessageType}, wrp.Msgpack))
+	require.NoError(err)
+
+	_, err = c.Write(wrp.MustEncode(
+		&wrp.Message{
+			Type:            wrp.SimpleRequestResponseMessageType,
+			Source:          "dns:server",
+			Destination:     "mac:112233445566",
+			TransactionUUID: "1234",
+		},
+		wrp.Msgpack,
+	))
+
+	require.NoError(err)
+
+	var frame bytes.Buffer
+	frameRead, err := c.Read(&frame)
+	assert.True(frameRead)
+	require.NoError(err)
+
+	response := new(wrp.Message)
+	require.NoError(wrp.NewDecoderBytes(frame.Bytes(), wrp.Msgpack).Decode(response))
+	assert.Equal("1234", response.TransactionUUID)
+	assert.Equal("dns:server", response.Destination)
+	assert.Equal([]byte("response"), response.Payload)
+
+	c.Close()
+}
@@ -0,0 +1,9 @@
+/*
+Package devicetest provides an in-memory harness for testing code built on device.Manager.
+
+A ConnectionFactory supplied to device.NewManager replaces websocket upgrades with in-memory pipes,
+and its Connect method attaches a scripted device, represented by a Peer.  A fake Clock supplied via
+device.Options drives pings, keepalives, the authorization delay, and draining, so that tests never
+have to sleep.  Routing, draining, and backpressure can therefore be tested without network sockets.
+*/
+package devicetest
@@ -0,0 +1,70 @@
+package devicetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/Comcast/webpa-common/device"
+)
+
+// ConnectionFactory is a device.ConnectionFactory that produces in-memory connections instead
+// of upgrading HTTP requests to websockets.  Supply an instance to device.NewManager, then use
+// Connect to attach scripted devices.
+type ConnectionFactory struct {
+	// BufferSize is the number of frames that may be in flight in each direction of each connection.
+	// See Pipe.
+	BufferSize int
+
+	connectLock sync.Mutex
+	lock        sync.Mutex
+	peer        *Peer
+}
+
+var _ device.ConnectionFactory = (*ConnectionFactory)(nil)
+
+// NewConnection creates an in-memory pipe.  The request and headers are ignored.
+func (f *ConnectionFactory) NewConnection(http.ResponseWriter, *http.Request, http.Header) (device.Connection, error) {
+	c, p := Pipe(f.BufferSize)
+
+	f.lock.Lock()
+	f.peer = p
+	f.lock.Unlock()
+
+	return c, nil
+}
+
+// Connect attaches a device with the given ID to a Connector, which must have been created with
+// this factory.  The returned Peer is the device's end of the connection.  Any convey header and
+// other request details may be supplied with ConnectRequest instead.
+func (f *ConnectionFactory) Connect(connector device.Connector, id device.ID) (device.Interface, *Peer, error) {
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(device.DeviceNameHeader, string(id))
+	return f.ConnectRequest(connector, device.WithIDRequest(id, request))
+}
+
+// ConnectRequest attaches a device to a Connector using an arbitrary connection request
+func (f *ConnectionFactory) ConnectRequest(connector device.Connector, request *http.Request) (device.Interface, *Peer, error) {
+	f.connectLock.Lock()
+	defer f.connectLock.Unlock()
+
+	f.lock.Lock()
+	f.peer = nil
+	f.lock.Unlock()
+
+	d, err := connector.Connect(httptest.NewRecorder(), request, nil)
+
+	f.lock.Lock()
+	p := f.peer
+	f.lock.Unlock()
+
+	if err != nil {
+		if p != nil {
+			p.Close()
+		}
+
+		return nil, nil, err
+	}
+
+	return d, p, nil
+}
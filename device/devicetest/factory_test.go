@@ -0,0 +1,780 @@
+package devicetest
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/device"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// advanceUntil moves the clock forward in steps until the given channel is closed or receives a value.
+// Since the manager reacts to the clock in other goroutines, this gives each step a chance to be observed.
+func advanceUntil(t *testing.T, clock *Clock, step time.Duration, done <-chan struct{}) {
+	deadline := time.After(DefaultTimeout)
+	for {
+		clock.Add(step)
+		select {
+		case <-done:
+			return
+		case <-deadline:
+			require.FailNow(t, "The manager did not respond to the clock")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func newManager(t *testing.T, bufferSize int, o device.Options) (device.Manager, *ConnectionFactory, *Clock) {
+	var (
+		factory = &ConnectionFactory{BufferSize: bufferSize}
+		clock   = NewClock(time.Date(2017, time.June, 1, 0, 0, 0, 0, time.UTC))
+	)
+
+	o.Logger = logging.TestLogger(t)
+	o.Clock = clock
+	return device.NewManager(&o, factory), factory, clock
+}
+
+// connected returns the number of devices registered with a manager
+func connected(manager device.Manager) int {
+	return manager.VisitAll(func(device.Interface) {})
+}
+
+func respondWith(payload string) func(*wrp.Message) *wrp.Message {
+	return func(request *wrp.Message) *wrp.Message {
+		if request.Type != wrp.SimpleRequestResponseMessageType {
+			return nil
+		}
+
+		return &wrp.Message{
+			Type:            wrp.SimpleRequestResponseMessageType,
+			Source:          request.Destination,
+			Destination:     request.Source,
+			TransactionUUID: request.TransactionUUID,
+			Payload:         []byte(payload),
+		}
+	}
+}
+
+func TestConnectionFactoryRoute(t *testing.T) {
+	var (
+		assert              = assert.New(t)
+		require             = require.New(t)
+		manager, factory, _ = newManager(t, 1, device.Options{})
+
+		first  = device.ID("mac:112233445566")
+		second = device.ID("mac:665544332211")
+	)
+
+	firstDevice, firstPeer, err := factory.Connect(manager, first)
+	require.NoError(err)
+	require.NotNil(firstDevice)
+	require.NotNil(firstPeer)
+	assert.Equal(first, firstDevice.ID())
+	firstPeer.Respond(respondWith("first"))
+
+	secondDevice, secondPeer, err := factory.Connect(manager, second)
+	require.NoError(err)
+	require.NotNil(secondDevice)
+	require.NotNil(secondPeer)
+	secondPeer.Respond(respondWith("second"))
+
+	assert.Equal(2, connected(manager))
+
+	for id, expected := range map[device.ID]string{first: "first", second: "second"} {
+		response, err := manager.Route(&device.Request{
+			Message: &wrp.Message{
+				Type:            wrp.SimpleRequestResponseMessageType,
+				Source:          "dns:server",
+				Destination:     string(id),
+				TransactionUUID: "transaction-" + string(id),
+			},
+		})
+
+		require.NoError(err)
+		require.NotNil(response)
+		assert.Equal(id, response.Device.ID())
+		assert.Equal(expected, string(response.Message.Payload))
+	}
+
+	// a device that drops its connection can no longer be routed to
+	firstPeer.Close()
+	for !firstDevice.Closed() {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err = manager.Route(&device.Request{
+		Message: &wrp.Message{Type: wrp.SimpleEventMessageType, Source: "dns:server", Destination: string(first)},
+	})
+
+	assert.Equal(device.ErrorDeviceClosed, err)
+	assert.Equal(1, manager.DisconnectOne(firstDevice.Key()))
+	assert.Equal(1, connected(manager))
+
+	secondPeer.Close()
+}
+
+func TestConnectionFactoryConnectError(t *testing.T) {
+	var (
+		assert              = assert.New(t)
+		manager, factory, _ = newManager(t, 1, device.Options{IDExtractor: device.HeaderIDExtractor("X-Missing")})
+	)
+
+	d, peer, err := factory.Connect(manager, device.ID("mac:112233445566"))
+	assert.Nil(d)
+	assert.Nil(peer)
+	assert.Error(err)
+	assert.Zero(connected(manager))
+}
+
+func TestConnectionFactoryDrain(t *testing.T) {
+	var (
+		assert                  = assert.New(t)
+		require                 = require.New(t)
+		manager, factory, clock = newManager(t, 1, device.Options{})
+
+		peers []*Peer
+	)
+
+	for _, id := range []device.ID{"mac:111111111111", "mac:222222222222", "mac:333333333333"} {
+		_, peer, err := factory.Connect(manager, id)
+		require.NoError(err)
+		peers = append(peers, peer)
+	}
+
+	var (
+		drained = make(chan struct{})
+		result  error
+	)
+
+	go func() {
+		defer close(drained)
+		result = manager.Drain(context.Background())
+	}()
+
+	for _, peer := range peers {
+		<-peer.CloseSent()
+		<-peer.Closed()
+	}
+
+	advanceUntil(t, clock, time.Second, drained)
+	assert.NoError(result)
+	assert.Zero(connected(manager))
+}
+
+func TestConnectionFactoryBackpressure(t *testing.T) {
+	var (
+		assert              = assert.New(t)
+		require             = require.New(t)
+		manager, factory, _ = newManager(t, 0, device.Options{DeviceMessageQueueSize: 1})
+		id                  = device.ID("mac:112233445566")
+
+		ctx, cancel = context.WithCancel(context.Background())
+		routed      = make(chan error, 1)
+	)
+
+	_, peer, err := factory.Connect(manager, id)
+	require.NoError(err)
+
+	// the device isn't reading, so nothing can be delivered until the route is cancelled
+	go func() {
+		_, err := manager.Route(
+			(&device.Request{
+				Message: &wrp.Message{Type: wrp.SimpleEventMessageType, Source: "dns:server", Destination: string(id)},
+			}).WithContext(ctx),
+		)
+
+		routed <- err
+	}()
+
+	select {
+	case err := <-routed:
+		assert.Fail("The route should have blocked", "error: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cancel()
+	assert.Equal(context.Canceled, <-routed)
+
+	// once the device reads, routing resumes
+	peer.Respond(respondWith("caught up"))
+	response, err := manager.Route(&device.Request{
+		Message: &wrp.Message{
+			Type:            wrp.SimpleRequestResponseMessageType,
+			Source:          "dns:server",
+			Destination:     string(id),
+			TransactionUUID: "after-backpressure",
+		},
+	})
+
+	require.NoError(err)
+	assert.Equal("caught up", string(response.Message.Payload))
+	peer.Close()
+}
+
+func TestConnectionFactoryKeepaliveTimeout(t *testing.T) {
+	var (
+		assert       = assert.New(t)
+		require      = require.New(t)
+		disconnected = make(chan struct{})
+		pumpError    error
+
+		manager, factory, clock = newManager(t, 10, device.Options{
+			KeepalivePeriod: time.Minute,
+			Listeners: []device.Listener{
+				func(e *device.Event) {
+					if e.Type == device.Disconnect {
+						pumpError = e.Error
+						close(disconnected)
+					}
+				},
+			},
+		})
+	)
+
+	_, peer, err := factory.Connect(manager, device.ID("mac:112233445566"))
+	require.NoError(err)
+
+	// the device receives keepalives, but never sends anything back
+	keepalives := make(chan struct{}, 10)
+	peer.Respond(func(message *wrp.Message) *wrp.Message {
+		if message.Type == wrp.ServiceAliveMessageType {
+			select {
+			case keepalives <- struct{}{}:
+			default:
+			}
+		}
+
+		return nil
+	})
+
+	// the ping ticker, the keepalive ticker, and the authorization delay
+	clock.BlockUntil(3)
+	advanceUntil(t, clock, time.Minute, disconnected)
+	assert.Equal(device.ErrorKeepaliveTimeout, pumpError)
+	assert.NotEmpty(keepalives)
+	<-peer.Closed()
+}
+
+func TestConnectionFactoryDedupeContent(t *testing.T) {
+	var (
+		assert       = assert.New(t)
+		require      = require.New(t)
+		received     = make(chan string, 10)
+		disconnected = make(chan struct{})
+
+		manager, factory, _ = newManager(t, 10, device.Options{
+			DedupeWindow:  time.Minute,
+			DedupeHashing: &wrp.Hashing{ExcludedMetadata: []string{"/sent"}},
+			Listeners: []device.Listener{
+				func(event *device.Event) {
+					switch event.Type {
+					case device.MessageReceived:
+						received <- string(event.Message.(*wrp.Message).Payload)
+					case device.Disconnect:
+						close(disconnected)
+					}
+				},
+			},
+		})
+	)
+
+	_, peer, err := factory.Connect(manager, device.ID("mac:112233445566"))
+	require.NoError(err)
+	require.NotNil(peer)
+
+	send := func(payload, sent string) {
+		require.NoError(peer.Send(&wrp.Message{
+			Type:        wrp.SimpleEventMessageType,
+			Source:      "mac:112233445566",
+			Destination: "event:test",
+			Metadata:    map[string]string{"/sent": sent},
+			Payload:     []byte(payload),
+		}))
+	}
+
+	expect := func(payload string) {
+		select {
+		case actual := <-received:
+			assert.Equal(payload, actual)
+		case <-time.After(DefaultTimeout):
+			require.Fail("No message was received", payload)
+		}
+	}
+
+	// messages without a transaction UUID are duplicates when their content is the same,
+	// ignoring the excluded metadata
+	send("first", "1")
+	send("first", "2")
+	send("second", "3")
+	expect("first")
+	expect("second")
+	assert.Empty(received)
+
+	peer.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(DefaultTimeout):
+		assert.Fail("The device was not disconnected")
+	}
+}
+
+func TestConnectionFactoryDedupe(t *testing.T) {
+	var (
+		assert       = assert.New(t)
+		require      = require.New(t)
+		received     = make(chan string, 10)
+		disconnected = make(chan struct{})
+
+		manager, factory, clock = newManager(t, 10, device.Options{
+			DedupeWindow: time.Minute,
+			Listeners: []device.Listener{
+				func(event *device.Event) {
+					// inbound messages with a transaction UUID are reported as broken transactions,
+					// since nothing is waiting on them
+					switch event.Type {
+					case device.MessageReceived, device.TransactionBroken:
+						received <- event.Message.(*wrp.Message).TransactionUUID
+					case device.Disconnect:
+						close(disconnected)
+					}
+				},
+			},
+		})
+	)
+
+	_, peer, err := factory.Connect(manager, device.ID("mac:112233445566"))
+	require.NoError(err)
+	require.NotNil(peer)
+
+	send := func(transactionUUID string) {
+		require.NoError(peer.Send(&wrp.Message{
+			Type:            wrp.SimpleEventMessageType,
+			Source:          "mac:112233445566",
+			Destination:     "event:test",
+			TransactionUUID: transactionUUID,
+		}))
+	}
+
+	expect := func(transactionUUID string) {
+		select {
+		case actual := <-received:
+			assert.Equal(transactionUUID, actual)
+		case <-time.After(DefaultTimeout):
+			require.Fail("No message was received", transactionUUID)
+		}
+	}
+
+	// the retry of the first message is dropped, so the next event seen is the second message
+	send("first")
+	send("first")
+	send("second")
+	expect("first")
+	expect("second")
+
+	// the source is supplied by the device, so changing it does not evade deduplication
+	require.NoError(peer.Send(&wrp.Message{
+		Type:            wrp.SimpleEventMessageType,
+		Source:          "mac:ffffffffffff",
+		Destination:     "event:test",
+		TransactionUUID: "second",
+	}))
+
+	send("third")
+	expect("third")
+
+	// once the window has passed, the same transaction is no longer a duplicate
+	clock.Add(time.Minute)
+	send("first")
+	expect("first")
+	assert.Empty(received)
+
+	peer.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(DefaultTimeout):
+		assert.Fail("The device was not disconnected")
+	}
+}
+
+func TestConnectionFactoryQOS(t *testing.T) {
+	var (
+		assert       = assert.New(t)
+		require      = require.New(t)
+		id           = device.ID("mac:112233445566")
+		routed       = make(chan error, 10)
+		disconnected = make(chan struct{})
+
+		manager, factory, _ = newManager(t, 0, device.Options{
+			DeviceMessageQueueSize: 10,
+			Listeners: []device.Listener{
+				func(e *device.Event) {
+					if e.Type == device.Disconnect {
+						close(disconnected)
+					}
+				},
+			},
+		})
+	)
+
+	d, peer, err := factory.Connect(manager, id)
+	require.NoError(err)
+
+	route := func(payload string, qos wrp.QOSValue) {
+		go func() {
+			_, err := manager.Route(&device.Request{
+				Message: &wrp.Message{
+					Type:             wrp.SimpleEventMessageType,
+					Source:           "dns:server",
+					Destination:      string(id),
+					Payload:          []byte(payload),
+					QualityOfService: qos,
+				},
+			})
+
+			routed <- err
+		}()
+	}
+
+	// the device isn't reading, so the write pump blocks on the first message it dequeues while the rest queue up
+	for _, payload := range []string{"telemetry-1", "telemetry-2", "telemetry-3", "telemetry-4"} {
+		route(payload, wrp.QOSLowValue)
+	}
+
+	for d.Pending() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	route("reboot", wrp.QOSCriticalValue)
+	for d.Pending() < 4 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the critical message preempts all of the telemetry, except for any message already being written
+	var payloads []string
+	for len(payloads) < 5 {
+		message, err := peer.Receive()
+		require.NoError(err)
+		payloads = append(payloads, string(message.Payload))
+	}
+
+	assert.Contains(payloads[:2], "reboot")
+
+	for repeat := 0; repeat < 5; repeat++ {
+		assert.NoError(<-routed)
+	}
+
+	peer.Close()
+	<-disconnected
+}
+
+func TestConnectionFactoryEventHistory(t *testing.T) {
+	var (
+		assert       = assert.New(t)
+		require      = require.New(t)
+		received     = make(chan struct{}, 2)
+		disconnected = make(chan struct{})
+
+		manager, factory, _ = newManager(t, 10, device.Options{
+			EventHistorySize: 10,
+			Listeners: []device.Listener{
+				func(event *device.Event) {
+					switch event.Type {
+					case device.Connect, device.MessageReceived:
+						received <- struct{}{}
+					case device.Disconnect:
+						close(disconnected)
+					}
+				},
+			},
+		})
+	)
+
+	d, peer, err := factory.Connect(manager, device.ID("mac:112233445566"))
+	require.NoError(err)
+	require.NotNil(peer)
+
+	historian, ok := d.(device.Historian)
+	require.True(ok)
+
+	require.NoError(peer.Send(&wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566",
+		Destination: "event:test",
+		Payload:     []byte("payload"),
+	}))
+
+	// wait for both the Connect and MessageReceived events
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(DefaultTimeout):
+			require.Fail("No event was received")
+		}
+	}
+
+	// the Connect event is dispatched by the write pump, so it may be recorded after the message
+	history := historian.History()
+	if assert.Len(history, 2) {
+		received, connected := history[0], history[1]
+		if received.Event == device.Connect.String() {
+			received, connected = connected, received
+		}
+
+		assert.Equal(device.MessageReceived.String(), received.Event)
+		assert.Equal(wrp.SimpleEventMessageType.String(), received.MessageType)
+		assert.NotZero(received.Size)
+		assert.Equal(device.Connect.String(), connected.Event)
+	}
+
+	peer.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(DefaultTimeout):
+		assert.Fail("The device was not disconnected")
+	}
+
+	assert.Equal(device.Disconnect.String(), historian.History()[0].Event)
+}
+
+func TestConnectionFactoryDispatchTimeout(t *testing.T) {
+	var (
+		assert       = assert.New(t)
+		require      = require.New(t)
+		expired      = make(chan struct{})
+		disconnected = make(chan struct{})
+		dispatchErr  error
+
+		manager, factory, clock = newManager(t, 10, device.Options{
+			DispatchTimeout:         10 * time.Second,
+			DispatchTimeoutResponse: true,
+			Listeners: []device.Listener{
+				func(event *device.Event) {
+					switch event.Type {
+					case device.TransactionBroken:
+						// simulates a stuck downstream, such as a webhook that never responds
+						<-event.Context().Done()
+						dispatchErr = event.Context().Err()
+						close(expired)
+					case device.Disconnect:
+						close(disconnected)
+					}
+				},
+			},
+		})
+	)
+
+	_, peer, err := factory.Connect(manager, device.ID("mac:112233445566"))
+	require.NoError(err)
+	require.NotNil(peer)
+
+	require.NoError(peer.Send(&wrp.Message{
+		Type:            wrp.SimpleRequestResponseMessageType,
+		Source:          "mac:112233445566",
+		Destination:     "dns:stuck.example.com",
+		TransactionUUID: "stuck",
+	}))
+
+	advanceUntil(t, clock, time.Second, expired)
+	assert.Equal(context.Canceled, dispatchErr)
+
+	// the device is told that its request timed out, after the authorization status message
+	for {
+		response, err := peer.Receive()
+		require.NoError(err)
+		if response.Type == wrp.AuthMessageType {
+			continue
+		}
+
+		assert.Equal(wrp.SimpleRequestResponseMessageType, response.Type)
+		assert.Equal("stuck", response.TransactionUUID)
+		assert.Equal("dns:stuck.example.com", response.Source)
+		assert.Equal("mac:112233445566", response.Destination)
+		if assert.NotNil(response.Status) {
+			assert.Equal(int64(http.StatusGatewayTimeout), *response.Status)
+		}
+
+		break
+	}
+
+	peer.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(DefaultTimeout):
+		assert.Fail("The device was not disconnected")
+	}
+}
+
+func TestConnectionFactoryControlFrames(t *testing.T) {
+	type controlFrame struct {
+		frameType device.ControlFrameType
+		payload   string
+	}
+
+	var (
+		assert       = assert.New(t)
+		require      = require.New(t)
+		frames       = make(chan controlFrame, 10)
+		received     = make(chan struct{}, 1)
+		disconnected = make(chan struct{})
+
+		manager, factory, _ = newManager(t, 10, device.Options{
+			Listeners: []device.Listener{
+				func(event *device.Event) {
+					switch event.Type {
+					case device.MessageReceived:
+						received <- struct{}{}
+					case device.Disconnect:
+						close(disconnected)
+					}
+				},
+			},
+		})
+
+		expect = func(expected controlFrame) {
+			select {
+			case actual := <-frames:
+				assert.Equal(expected, actual)
+			case <-time.After(DefaultTimeout):
+				assert.Fail("No control frame was received", "expected %v", expected)
+			}
+		}
+	)
+
+	d, peer, err := factory.Connect(manager, device.ID("mac:112233445566"))
+	require.NoError(err)
+	require.NotNil(peer)
+
+	// ensure that the read pump is running, so that it does not outlive this test
+	require.NoError(peer.Send(&wrp.Message{Type: wrp.SimpleEventMessageType, Source: "mac:112233445566", Destination: "event:test"}))
+	select {
+	case <-received:
+	case <-time.After(DefaultTimeout):
+		require.Fail("No message was received")
+	}
+
+	d.SetControlFrameListener(func(actual device.Interface, frameType device.ControlFrameType, payload []byte) {
+		assert.Equal(d, actual)
+		frames <- controlFrame{frameType, string(payload)}
+	})
+
+	// a device's own heartbeat is reported, and still answered
+	require.NoError(peer.Ping([]byte("heartbeat")))
+	expect(controlFrame{device.PingFrame, "heartbeat"})
+	assert.Equal("heartbeat", string(<-peer.Pongs()))
+
+	// an application-level ping with a custom payload is answered with a pong
+	require.NoError(d.SendPing([]byte("custom")))
+	assert.Equal("custom", string(<-peer.Pings()))
+	expect(controlFrame{device.PongFrame, "custom"})
+
+	require.NoError(d.SendClose(4000, "firmware upgrade"))
+	select {
+	case <-peer.CloseSent():
+	case <-time.After(DefaultTimeout):
+		require.Fail("No close frame was sent")
+	}
+
+	assert.Equal(device.FormatClosePayload(4000, "firmware upgrade"), peer.ClosePayload())
+	assert.Equal(device.ErrorDeviceClosed, d.SendPing(nil))
+	assert.Equal(device.ErrorDeviceClosed, d.SendClose(4000, "again"))
+
+	peer.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(DefaultTimeout):
+		assert.Fail("The device was not disconnected")
+	}
+}
+
+func TestConnectionFactoryMirror(t *testing.T) {
+	var (
+		assert       = assert.New(t)
+		require      = require.New(t)
+		received     = make(chan string, 10)
+		mirrored     = make(chan string, 10)
+		disconnected = make(chan struct{})
+
+		manager, factory, _ = newManager(t, 10, device.Options{
+			DedupeWindow: time.Minute,
+			MirrorSink: &device.ListenerMirrorSink{
+				Listeners: []device.Listener{
+					func(event *device.Event) {
+						mirrored <- string(event.Message.(*wrp.Message).Payload)
+					},
+				},
+			},
+			Listeners: []device.Listener{
+				func(event *device.Event) {
+					// inbound messages with a transaction UUID are reported as broken transactions,
+					// since nothing is waiting on them
+					switch event.Type {
+					case device.MessageReceived, device.TransactionBroken:
+						received <- string(event.Message.(*wrp.Message).Payload)
+					case device.Disconnect:
+						close(disconnected)
+					}
+				},
+			},
+		})
+	)
+
+	_, peer, err := factory.Connect(manager, device.ID("mac:112233445566"))
+	require.NoError(err)
+	require.NotNil(peer)
+
+	send := func(transactionUUID, payload string) {
+		require.NoError(peer.Send(&wrp.Message{
+			Type:            wrp.SimpleEventMessageType,
+			Source:          "mac:112233445566",
+			Destination:     "event:test",
+			TransactionUUID: transactionUUID,
+			Payload:         []byte(payload),
+		}))
+	}
+
+	expect := func(messages <-chan string, payload string) {
+		select {
+		case actual := <-messages:
+			assert.Equal(payload, actual)
+		case <-time.After(DefaultTimeout):
+			require.Fail("No message was received", payload)
+		}
+	}
+
+	// both pipelines see every message, and duplicates are mirrored no more than they are dispatched
+	send("1", "first")
+	send("1", "first")
+	send("2", "second")
+	expect(received, "first")
+	expect(received, "second")
+
+	// mirroring is asynchronous, so the sink may see messages in any order
+	var shadowed []string
+	for range []int{0, 1} {
+		select {
+		case payload := <-mirrored:
+			shadowed = append(shadowed, payload)
+		case <-time.After(DefaultTimeout):
+			require.Fail("No message was mirrored")
+		}
+	}
+
+	sort.Strings(shadowed)
+	assert.Equal([]string{"first", "second"}, shadowed)
+	assert.Empty(received)
+	assert.Empty(mirrored)
+
+	peer.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(DefaultTimeout):
+		assert.Fail("The device was not disconnected")
+	}
+}
@@ -0,0 +1,123 @@
+package device
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// DisconnectReasonRequested is the reason recorded when a device was disconnected through
+	// the Manager, e.g. via Disconnect, rather than due to a connection error
+	DisconnectReasonRequested = "disconnect requested"
+
+	// disconnectsPerDevice is the maximum number of disconnections remembered for any one device ID
+	disconnectsPerDevice = 5
+)
+
+// DisconnectRecord describes a single disconnection of a device
+type DisconnectRecord struct {
+	ID          ID        `json:"id"`
+	Key         Key       `json:"key"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	Time        time.Time `json:"time"`
+	Reason      string    `json:"reason"`
+}
+
+// disconnectEntry holds the recent disconnections of a single device ID, oldest first
+type disconnectEntry struct {
+	id      ID
+	records []DisconnectRecord
+}
+
+func (e *disconnectEntry) last() time.Time {
+	return e.records[len(e.records)-1].Time
+}
+
+// disconnectHistory is a bounded, expiring map of device IDs to their recent disconnections.
+// Entries are kept in order of their most recent disconnection, so that the stalest entries are
+// both the first to expire and the first to be evicted when the history is full.
+type disconnectHistory struct {
+	maxSize int
+	ttl     time.Duration
+	now     func() time.Time
+
+	lock    sync.Mutex
+	entries map[ID]*list.Element
+	order   *list.List
+}
+
+func newDisconnectHistory(maxSize int, ttl time.Duration) *disconnectHistory {
+	return &disconnectHistory{
+		maxSize: maxSize,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[ID]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// purge discards entries whose most recent disconnection has expired.  This method must be called under the lock.
+func (h *disconnectHistory) purge(now time.Time) {
+	for back := h.order.Back(); back != nil; back = h.order.Back() {
+		entry := back.Value.(*disconnectEntry)
+		if now.Sub(entry.last()) < h.ttl {
+			return
+		}
+
+		h.order.Remove(back)
+		delete(h.entries, entry.id)
+	}
+}
+
+// add records a disconnection, evicting the stalest device ID if the history is full
+func (h *disconnectHistory) add(record DisconnectRecord) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.purge(h.now())
+	if element, ok := h.entries[record.ID]; ok {
+		entry := element.Value.(*disconnectEntry)
+		entry.records = append(entry.records, record)
+		if len(entry.records) > disconnectsPerDevice {
+			entry.records = entry.records[len(entry.records)-disconnectsPerDevice:]
+		}
+
+		h.order.MoveToFront(element)
+		return
+	}
+
+	h.entries[record.ID] = h.order.PushFront(&disconnectEntry{id: record.ID, records: []DisconnectRecord{record}})
+	if h.order.Len() > h.maxSize {
+		stalest := h.order.Back()
+		h.order.Remove(stalest)
+		delete(h.entries, stalest.Value.(*disconnectEntry).id)
+	}
+}
+
+// get returns the unexpired disconnections for a device ID, most recent first
+func (h *disconnectHistory) get(id ID) []DisconnectRecord {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := h.now()
+	h.purge(now)
+
+	element, ok := h.entries[id]
+	if !ok {
+		return nil
+	}
+
+	var (
+		records = element.Value.(*disconnectEntry).records
+		result  = make([]DisconnectRecord, 0, len(records))
+	)
+
+	for index := len(records) - 1; index >= 0; index-- {
+		if now.Sub(records[index].Time) < h.ttl {
+			result = append(result, records[index])
+		}
+	}
+
+	return result
+}
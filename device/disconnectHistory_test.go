@@ -0,0 +1,54 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisconnectHistory(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		now     = time.Now()
+		history = newDisconnectHistory(2, time.Minute)
+	)
+
+	history.now = func() time.Time { return now }
+	assert.Nil(history.get(ID("nosuch")))
+
+	for index := 0; index < disconnectsPerDevice+2; index++ {
+		history.add(DisconnectRecord{ID: ID("first"), Time: now, Reason: string(rune('a' + index))})
+		now = now.Add(time.Second)
+	}
+
+	records := history.get(ID("first"))
+	if assert.Len(records, disconnectsPerDevice) {
+		assert.Equal(string(rune('a'+disconnectsPerDevice+1)), records[0].Reason)
+		assert.Equal("c", records[disconnectsPerDevice-1].Reason)
+	}
+
+	history.add(DisconnectRecord{ID: ID("second"), Time: now, Reason: "second"})
+	now = now.Add(time.Second)
+	history.add(DisconnectRecord{ID: ID("first"), Time: now, Reason: "again"})
+	now = now.Add(time.Second)
+
+	// "second" is now the stalest entry, so it is evicted when the history is full
+	history.add(DisconnectRecord{ID: ID("third"), Time: now, Reason: "third"})
+	assert.Empty(history.get(ID("second")))
+	assert.Len(history.get(ID("third")), 1)
+	assert.Equal("again", history.get(ID("first"))[0].Reason)
+
+	// older records of a device expire individually
+	now = now.Add(time.Minute - 2*time.Second)
+	records = history.get(ID("first"))
+	if assert.Len(records, 1) {
+		assert.Equal("again", records[0].Reason)
+	}
+
+	now = now.Add(2 * time.Second)
+	assert.Empty(history.get(ID("first")))
+	assert.Empty(history.get(ID("third")))
+	assert.Zero(history.order.Len())
+	assert.Empty(history.entries)
+}
@@ -0,0 +1,160 @@
+package device
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPageSize is the number of devices in a page when a Cursor specifies no limit
+	DefaultPageSize = 100
+
+	// MaxPageSize is the greatest number of devices returned in a single page
+	MaxPageSize = 1000
+)
+
+// Enumerator is an optional interface implemented by a Registry which can list its devices one page at a
+// time.  The Manager returned by NewManager implements this interface.
+type Enumerator interface {
+	// Devices returns one page of summaries of the connected devices matching the given Filter, ordered by ID.
+	// The page's Next cursor, if any, is passed to the subsequent call to obtain the following page.  Unlike
+	// the visitation methods, this method holds no lock for longer than it takes to select the matching IDs,
+	// which makes it suitable for exposing very large numbers of devices over HTTP.
+	Devices(Filter, Cursor) Page
+}
+
+// Filter selects the devices returned by Enumerator.Devices.  The zero value selects every device.
+type Filter struct {
+	// IDPrefix, if supplied, selects devices whose ID begins with this string, e.g. "mac:1122"
+	IDPrefix string `json:"idPrefix,omitempty"`
+
+	// Partner, if supplied, selects devices which belong to this partner
+	Partner string `json:"partner,omitempty"`
+
+	// MinIdle, if positive, selects devices which have sent no messages for at least this long.  Pongs and
+	// other control frames do not count.
+	MinIdle time.Duration `json:"minIdle,omitempty"`
+}
+
+// matchID tests the filter criteria which depend only upon the device ID
+func (f *Filter) matchID(id ID) bool {
+	return strings.HasPrefix(string(id), f.IDPrefix)
+}
+
+// matchDevice tests the remaining filter criteria against a device, using the given current time
+func (f *Filter) matchDevice(d *device, now time.Time) bool {
+	if len(f.Partner) > 0 && f.Partner != d.partner {
+		return false
+	}
+
+	if f.MinIdle > 0 && now.Sub(d.LastActivity()) < f.MinIdle {
+		return false
+	}
+
+	return true
+}
+
+// Cursor identifies a page of devices.  The zero value identifies the first page of DefaultPageSize devices.
+type Cursor struct {
+	// After is the last device ID of the previous page.  The page begins with the first ID after this one.
+	After ID `json:"after,omitempty"`
+
+	// Limit is the maximum number of devices in the page.  If nonpositive, DefaultPageSize is used,
+	// and it cannot exceed MaxPageSize.
+	Limit int `json:"limit,omitempty"`
+}
+
+func (c Cursor) limit() int {
+	switch {
+	case c.Limit <= 0:
+		return DefaultPageSize
+	case c.Limit > MaxPageSize:
+		return MaxPageSize
+	default:
+		return c.Limit
+	}
+}
+
+// Summary describes a single connected device
+type Summary struct {
+	ID           ID        `json:"id"`
+	Key          Key       `json:"key"`
+	Partner      string    `json:"partner,omitempty"`
+	ConnectedAt  time.Time `json:"connectedAt"`
+	LastActivity time.Time `json:"lastActivity"`
+	Metadata     Convey    `json:"metadata,omitempty"`
+
+	// Attributes is the metadata attached by the Manager's ConnectAuthenticator, if any
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Page is a single page of device summaries
+type Page struct {
+	Devices []Summary `json:"devices"`
+
+	// Next is the cursor for the following page, or nil if this is the last page
+	Next *Cursor `json:"next,omitempty"`
+}
+
+// newSummary produces the Summary of an internal device
+func newSummary(d *device) Summary {
+	return Summary{
+		ID:           d.id,
+		Key:          d.Key(),
+		Partner:      d.partner,
+		ConnectedAt:  d.statistics.ConnectedAt(),
+		LastActivity: d.LastActivity(),
+		Metadata:     d.convey,
+		Attributes:   d.attributes,
+	}
+}
+
+// idSlice sorts device IDs
+type idSlice []ID
+
+func (s idSlice) Len() int           { return len(s) }
+func (s idSlice) Less(i, j int) bool { return s[i] < s[j] }
+func (s idSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// idHeap is a max-heap of device IDs, which selects the lowest IDs without sorting every ID
+type idHeap []ID
+
+func (h idHeap) Len() int            { return len(h) }
+func (h idHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h idHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *idHeap) Push(x interface{}) { *h = append(*h, x.(ID)) }
+
+func (h *idHeap) Pop() interface{} {
+	last := (*h)[len(*h)-1]
+	*h = (*h)[:len(*h)-1]
+	return last
+}
+
+func (m *manager) Devices(filter Filter, cursor Cursor) Page {
+	var (
+		limit = cursor.limit()
+		now   = m.clock.Now()
+		page  = Page{Devices: make([]Summary, 0, limit)}
+	)
+
+	// one more ID than the limit is selected, to determine whether there is a following page
+	ids := m.registry.lowestIDs(limit+1, func(d *device) bool {
+		return d.id > cursor.After && filter.matchID(d.id) && filter.matchDevice(d, now)
+	})
+
+	if len(ids) > limit {
+		page.Next = &Cursor{After: ids[limit-1], Limit: cursor.Limit}
+		ids = ids[:limit]
+	}
+
+	for _, id := range ids {
+		// duplicates of an ID are never split across pages, so a page may slightly exceed its limit
+		m.registry.visitID(id, func(d *device) {
+			if filter.matchDevice(d, now) {
+				page.Devices = append(page.Devices, newSummary(d))
+			}
+		})
+	}
+
+	return page
+}
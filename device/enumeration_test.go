@@ -0,0 +1,178 @@
+package device
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedClock is a Clock whose current time never changes.  Its timers and tickers are those of the system clock.
+type fixedClock struct {
+	clock.Interface
+	now time.Time
+}
+
+func newFixedClock(now time.Time) fixedClock {
+	return fixedClock{Interface: clock.System(), now: now}
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestCursorLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(DefaultPageSize, Cursor{}.limit())
+	assert.Equal(DefaultPageSize, Cursor{Limit: -1}.limit())
+	assert.Equal(10, Cursor{Limit: 10}.limit())
+	assert.Equal(MaxPageSize, Cursor{Limit: MaxPageSize + 1}.limit())
+}
+
+// newEnumerationManager creates a manager holding devices with the IDs mac:000000000000 through
+// mac:000000000009.  Even devices belong to partner "even" and were last active an hour ago, while odd devices
+// belong to partner "odd" and are active now.
+func newEnumerationManager(t *testing.T) (*manager, time.Time) {
+	var (
+		now = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+		m   = NewManager(&Options{Clock: newFixedClock(now)}, nil).(*manager)
+	)
+
+	// add the devices out of order, to verify sorting
+	for _, i := range []int{7, 3, 9, 0, 5, 1, 8, 2, 6, 4} {
+		var (
+			id = ID(fmt.Sprintf("mac:%012d", i))
+			d  = newDevice(id, Key(id), Convey{"index": i}, "", 1, defaultQOSWeights)
+		)
+
+		if i%2 == 0 {
+			d.partner = "even"
+			d.touch(now.Add(-time.Hour))
+		} else {
+			d.partner = "odd"
+			d.touch(now)
+		}
+
+		require.NoError(t, m.registry.add(d))
+	}
+
+	return m, now
+}
+
+func summaryIDs(page Page) []ID {
+	ids := make([]ID, len(page.Devices))
+	for i, s := range page.Devices {
+		ids[i] = s.ID
+	}
+
+	return ids
+}
+
+func TestManagerDevices(t *testing.T) {
+	t.Run("All", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			m, now  = newEnumerationManager(t)
+			page    = m.Devices(Filter{}, Cursor{})
+			summary = page.Devices[4]
+		)
+
+		assert.Len(page.Devices, 10)
+		assert.Nil(page.Next)
+		assert.Equal(ID("mac:000000000000"), page.Devices[0].ID)
+		assert.Equal(ID("mac:000000000009"), page.Devices[9].ID)
+
+		assert.Equal(ID("mac:000000000004"), summary.ID)
+		assert.Equal(Key("mac:000000000004"), summary.Key)
+		assert.Equal("even", summary.Partner)
+		assert.Equal(now.Add(-time.Hour), summary.LastActivity)
+		assert.False(summary.ConnectedAt.IsZero())
+		assert.Equal(Convey{"index": 4}, summary.Metadata)
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			m, _   = newEnumerationManager(t)
+			cursor = Cursor{Limit: 4}
+			pages  [][]ID
+		)
+
+		for {
+			page := m.Devices(Filter{}, cursor)
+			pages = append(pages, summaryIDs(page))
+			if page.Next == nil {
+				break
+			}
+
+			assert.Equal(4, page.Next.Limit)
+			cursor = *page.Next
+		}
+
+		assert.Equal(
+			[][]ID{
+				{"mac:000000000000", "mac:000000000001", "mac:000000000002", "mac:000000000003"},
+				{"mac:000000000004", "mac:000000000005", "mac:000000000006", "mac:000000000007"},
+				{"mac:000000000008", "mac:000000000009"},
+			},
+			pages,
+		)
+
+		// a cursor after the last device yields an empty, final page
+		page := m.Devices(Filter{}, Cursor{After: "mac:000000000009"})
+		assert.Empty(page.Devices)
+		assert.Nil(page.Next)
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			m, _   = newEnumerationManager(t)
+		)
+
+		assert.Equal(
+			[]ID{"mac:000000000003"},
+			summaryIDs(m.Devices(Filter{IDPrefix: "mac:000000000003"}, Cursor{})),
+		)
+
+		assert.Empty(m.Devices(Filter{IDPrefix: "uuid:"}, Cursor{}).Devices)
+
+		assert.Equal(
+			[]ID{"mac:000000000001", "mac:000000000003", "mac:000000000005", "mac:000000000007", "mac:000000000009"},
+			summaryIDs(m.Devices(Filter{Partner: "odd"}, Cursor{})),
+		)
+
+		assert.Equal(
+			[]ID{"mac:000000000000", "mac:000000000002", "mac:000000000004", "mac:000000000006", "mac:000000000008"},
+			summaryIDs(m.Devices(Filter{MinIdle: 30 * time.Minute}, Cursor{})),
+		)
+
+		assert.Empty(m.Devices(Filter{Partner: "odd", MinIdle: time.Minute}, Cursor{}).Devices)
+
+		page := m.Devices(Filter{Partner: "even"}, Cursor{Limit: 2})
+		assert.Equal([]ID{"mac:000000000000", "mac:000000000002"}, summaryIDs(page))
+		if assert.NotNil(page.Next) {
+			assert.Equal(ID("mac:000000000002"), page.Next.After)
+		}
+	})
+
+	t.Run("Duplicates", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			m, _   = newEnumerationManager(t)
+		)
+
+		require.NoError(t, m.registry.add(newDevice("mac:000000000000", "duplicate", nil, "", 1, defaultQOSWeights)))
+
+		// duplicates of an ID always appear on the same page
+		page := m.Devices(Filter{}, Cursor{Limit: 1})
+		assert.Equal([]ID{"mac:000000000000", "mac:000000000000"}, summaryIDs(page))
+		if assert.NotNil(page.Next) {
+			assert.Equal(ID("mac:000000000000"), page.Next.After)
+		}
+	})
+}
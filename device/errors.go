@@ -2,15 +2,21 @@ package device
 
 import (
 	"errors"
+
+	"github.com/Comcast/webpa-common/httperror"
 )
 
 var (
 	ErrorMissingDeviceNameContext     = errors.New("Missing device ID in request context")
 	ErrorMissingDeviceNameHeader      = errors.New("Missing device name header")
 	ErrorMissingDeviceNameVar         = errors.New("Missing device name path variable")
+	ErrorMissingDeviceNameConvey      = errors.New("Missing device name convey field")
+	ErrorMissingClientCertificate     = errors.New("Missing TLS client certificate")
+	ErrorUnverifiedClientCertificate  = errors.New("The TLS client certificate was not verified")
+	ErrorNoIDExtractors               = errors.New("No device ID extractors are configured")
 	ErrorMissingPathVars              = errors.New("Missing URI path variables")
 	ErrorInvalidDeviceName            = errors.New("Invalid device name")
-	ErrorDeviceNotFound               = errors.New("The device does not exist")
+	ErrorDeviceNotFound               = error(httperror.New(httperror.DeviceNotFound, "The device does not exist"))
 	ErrorNonUniqueID                  = errors.New("More than once device with that identifier is connected")
 	ErrorDuplicateKey                 = errors.New("That key is a duplicate")
 	ErrorDuplicateDevice              = errors.New("That device is already in this registry")
@@ -19,6 +25,15 @@ var (
 	ErrorTransactionAlreadyRegistered = errors.New("That transaction is already registered")
 	ErrorTransactionCancelled         = errors.New("The transaction has been cancelled")
 	ErrorResponseNoContents           = errors.New("The response has no contents")
-	ErrorDeviceBusy                   = errors.New("That device is busy")
+	ErrorDeviceBusy                   = error(httperror.New(httperror.DeviceBusy, "That device is busy"))
 	ErrorDeviceClosed                 = errors.New("That device has been closed")
+	ErrorKeepaliveTimeout             = errors.New("The device did not respond to protocol keepalives")
+	ErrorControlPayloadTooLarge       = errors.New("Control frame payloads cannot exceed 125 bytes")
+	ErrorConnectDenied                = errors.New("The device is not authorized to connect")
+	ErrorMessageTooLarge              = errors.New("The device sent a message larger than the maximum message size")
+	ErrorPayloadTooLarge              = errors.New("The device sent a payload larger than the maximum payload size")
+	ErrorMessageTypeNotAllowed        = errors.New("The device sent a message type that is not allowed")
+	ErrorInboundRateExceeded          = errors.New("The device exceeded its inbound message rate")
+	ErrorGateClosed                   = errors.New("New device connections are not being admitted")
+	ErrorDeviceForwarded              = errors.New("The device is not connected, and the message will be sent when it reconnects")
 )
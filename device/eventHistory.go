@@ -0,0 +1,98 @@
+package device
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/wrp"
+)
+
+// HistoryRecord summarizes a single event in a device's history
+type HistoryRecord struct {
+	Time            time.Time `json:"time"`
+	Event           string    `json:"event"`
+	MessageType     string    `json:"messageType,omitempty"`
+	Size            int       `json:"size,omitempty"`
+	TransactionUUID string    `json:"transactionUUID,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// Historian is an optional interface implemented by devices which record their recent events.
+// Devices connected through a Manager implement this interface.
+type Historian interface {
+	// History returns this device's most recent events, most recent first.  If event history
+	// is disabled, this method returns an empty slice.
+	History() []HistoryRecord
+}
+
+// newHistoryRecord summarizes an event.  None of the event's transient data, such as its Contents,
+// is retained by the returned record.
+func newHistoryRecord(now time.Time, e *Event) HistoryRecord {
+	record := HistoryRecord{
+		Time:  now,
+		Event: e.Type.String(),
+		Size:  len(e.Contents),
+	}
+
+	if e.Message != nil {
+		record.MessageType = e.Message.MessageType().String()
+		if routable, ok := e.Message.(wrp.Routable); ok {
+			record.TransactionUUID = routable.TransactionKey()
+		}
+	}
+
+	if e.Error != nil {
+		record.Error = e.Error.Error()
+	}
+
+	return record
+}
+
+// eventHistory is a fixed-size ring buffer of a single device's most recent events
+type eventHistory struct {
+	lock    sync.Mutex
+	records []HistoryRecord
+	next    int
+	full    bool
+}
+
+func newEventHistory(size int) *eventHistory {
+	return &eventHistory{
+		records: make([]HistoryRecord, size),
+	}
+}
+
+// add records an event, overwriting the oldest record if the history is full
+func (h *eventHistory) add(record HistoryRecord) {
+	h.lock.Lock()
+	h.records[h.next] = record
+	h.next++
+	if h.next == len(h.records) {
+		h.next = 0
+		h.full = true
+	}
+
+	h.lock.Unlock()
+}
+
+// get returns a copy of the records in this history, most recent first
+func (h *eventHistory) get() []HistoryRecord {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.records)
+	}
+
+	result := make([]HistoryRecord, 0, count)
+	for index, remaining := h.next-1, count; remaining > 0; index, remaining = index-1, remaining-1 {
+		if index < 0 {
+			index = len(h.records) - 1
+		}
+
+		result = append(result, h.records[index])
+	}
+
+	return result
+}
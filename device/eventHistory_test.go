@@ -0,0 +1,78 @@
+package device
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHistoryRecord(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		now    = time.Date(2017, time.June, 1, 12, 30, 0, 0, time.UTC)
+	)
+
+	assert.Equal(
+		HistoryRecord{Time: now, Event: "Connect"},
+		newHistoryRecord(now, &Event{Type: Connect}),
+	)
+
+	assert.Equal(
+		HistoryRecord{Time: now, Event: "Disconnect", Error: ErrorKeepaliveTimeout.Error()},
+		newHistoryRecord(now, &Event{Type: Disconnect, Error: ErrorKeepaliveTimeout}),
+	)
+
+	assert.Equal(
+		HistoryRecord{
+			Time:            now,
+			Event:           "MessageFailed",
+			MessageType:     wrp.SimpleRequestResponseMessageType.String(),
+			Size:            3,
+			TransactionUUID: "transaction",
+			Error:           "expected",
+		},
+		newHistoryRecord(now, &Event{
+			Type:     MessageFailed,
+			Message:  &wrp.Message{Type: wrp.SimpleRequestResponseMessageType, TransactionUUID: "transaction"},
+			Contents: []byte("abc"),
+			Error:    errors.New("expected"),
+		}),
+	)
+}
+
+func TestEventHistory(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		history = newEventHistory(3)
+	)
+
+	assert.Empty(history.get())
+
+	history.add(HistoryRecord{Event: "a"})
+	history.add(HistoryRecord{Event: "b"})
+	assert.Equal([]HistoryRecord{{Event: "b"}, {Event: "a"}}, history.get())
+
+	history.add(HistoryRecord{Event: "c"})
+	assert.Equal([]HistoryRecord{{Event: "c"}, {Event: "b"}, {Event: "a"}}, history.get())
+
+	// the oldest records are overwritten once the history is full
+	history.add(HistoryRecord{Event: "d"})
+	history.add(HistoryRecord{Event: "e"})
+	assert.Equal([]HistoryRecord{{Event: "e"}, {Event: "d"}, {Event: "c"}}, history.get())
+}
+
+func TestDeviceHistory(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		device = newDevice(ID("test"), Key("test"), nil, "", 1, defaultQOSWeights)
+	)
+
+	assert.Equal([]HistoryRecord{}, device.History())
+
+	device.history = newEventHistory(2)
+	device.history.add(HistoryRecord{Event: "Connect"})
+	assert.Equal([]HistoryRecord{{Event: "Connect"}}, device.History())
+}
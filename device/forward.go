@@ -0,0 +1,306 @@
+package device
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/go-kit/kit/metrics"
+)
+
+// forwardEntry is a single message retained for a disconnected device
+type forwardEntry struct {
+	id      ID
+	expires time.Time
+
+	// contents is the Msgpack encoding of the message, or nil if the message was spilled to disk
+	contents []byte
+
+	// file is the path of the spilled message, or empty if the message is held in memory
+	file string
+	size int
+
+	// removed indicates that this entry was flushed or expired and must be skipped by pruning
+	removed bool
+}
+
+// forwardBuffer is a store-and-forward buffer which retains messages routed to devices that are not connected,
+// so that short disconnections do not lose pending commands.  Messages are held in memory up to a limit, after
+// which they are spilled to disk if a spill directory is configured.  Expired messages are discarded whenever
+// messages are buffered or flushed.
+type forwardBuffer struct {
+	logger      logging.Logger
+	clock       Clock
+	ttl         time.Duration
+	maxMessages int
+	maxMemory   int
+	maxSpill    int
+	spillDir    string
+
+	lock   sync.Mutex
+	byID   map[ID][]*forwardEntry
+	order  []*forwardEntry
+	memory int
+	spill  int
+	seq    uint64
+
+	outcomes metrics.Counter
+	pending  metrics.Gauge
+}
+
+// newForwardBuffer creates a forwardBuffer from a set of options.  If a spill directory is configured, spilled
+// messages are written to a new, uniquely named directory beneath it.
+func newForwardBuffer(o *Options, logger logging.Logger, clock Clock, m measures) (*forwardBuffer, error) {
+	fb := &forwardBuffer{
+		logger:      logger,
+		clock:       clock,
+		ttl:         o.forwardTTL(),
+		maxMessages: o.forwardMaxMessages(),
+		maxMemory:   o.forwardMaxMemory(),
+		maxSpill:    o.forwardMaxSpill(),
+		byID:        make(map[ID][]*forwardEntry),
+		outcomes:    m.forward,
+		pending:     m.forwardPending,
+	}
+
+	if dir := o.forwardSpillDirectory(); len(dir) > 0 {
+		spillDir, err := ioutil.TempDir(dir, "forward")
+		if err != nil {
+			return nil, err
+		}
+
+		fb.spillDir = spillDir
+	}
+
+	return fb, nil
+}
+
+// encodeForward produces the Msgpack form of a request, which is what a forwardBuffer retains
+func encodeForward(request *Request) ([]byte, error) {
+	if request.Format == wrp.Msgpack && len(request.Contents) > 0 {
+		contents := make([]byte, len(request.Contents))
+		copy(contents, request.Contents)
+		return contents, nil
+	}
+
+	var contents []byte
+	if err := wrp.NewEncoderBytes(&contents, wrp.Msgpack).Encode(request.Message); err != nil {
+		return nil, err
+	}
+
+	return contents, nil
+}
+
+// buffer retains a request for the given device.  This method returns false if the request could not be
+// retained, either because it could not be encoded or because the buffer is full.
+func (fb *forwardBuffer) buffer(id ID, request *Request) bool {
+	contents, err := encodeForward(request)
+	if err != nil {
+		fb.logger.Error("Unable to encode message for disconnected device [%s]: %s", id, err)
+		fb.outcomes.With(ForwardOutcomeLabel, ForwardDropped).Add(1)
+		return false
+	}
+
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	return fb.bufferLocked(id, contents)
+}
+
+// bufferMissing retains a request for a device unless the device is connected.  The lookup is made while holding
+// this buffer's lock, which flush also holds while registering a device, so a request is never retained after its
+// device has been flushed.  If the device is connected, it is returned.  Otherwise, if the request was retained,
+// ErrorDeviceForwarded is returned, and if it was not, ErrorDeviceNotFound is returned.
+func (fb *forwardBuffer) bufferMissing(id ID, request *Request, lookup func(ID) (*device, error)) (*device, error) {
+	contents, err := encodeForward(request)
+	if err != nil {
+		fb.logger.Error("Unable to encode message for disconnected device [%s]: %s", id, err)
+		fb.outcomes.With(ForwardOutcomeLabel, ForwardDropped).Add(1)
+		return nil, ErrorDeviceNotFound
+	}
+
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	if d, err := lookup(id); err != ErrorDeviceNotFound {
+		return d, err
+	}
+
+	if fb.bufferLocked(id, contents) {
+		return nil, ErrorDeviceForwarded
+	}
+
+	return nil, ErrorDeviceNotFound
+}
+
+func (fb *forwardBuffer) bufferLocked(id ID, contents []byte) bool {
+	fb.pruneLocked()
+	if len(fb.byID[id]) >= fb.maxMessages {
+		fb.outcomes.With(ForwardOutcomeLabel, ForwardDropped).Add(1)
+		return false
+	}
+
+	entry := &forwardEntry{
+		id:      id,
+		expires: fb.clock.Now().Add(fb.ttl),
+		size:    len(contents),
+	}
+
+	switch {
+	case fb.memory+entry.size <= fb.maxMemory:
+		entry.contents = contents
+		fb.memory += entry.size
+
+	case len(fb.spillDir) > 0 && fb.spill+entry.size <= fb.maxSpill:
+		fb.seq++
+		entry.file = filepath.Join(fb.spillDir, fmt.Sprintf("%d.wrp", fb.seq))
+		if err := ioutil.WriteFile(entry.file, contents, 0600); err != nil {
+			fb.logger.Error("Unable to spill message for disconnected device [%s]: %s", id, err)
+			fb.outcomes.With(ForwardOutcomeLabel, ForwardDropped).Add(1)
+			return false
+		}
+
+		fb.spill += entry.size
+
+	default:
+		fb.outcomes.With(ForwardOutcomeLabel, ForwardDropped).Add(1)
+		return false
+	}
+
+	fb.byID[id] = append(fb.byID[id], entry)
+	fb.order = append(fb.order, entry)
+	fb.outcomes.With(ForwardOutcomeLabel, ForwardBuffered).Add(1)
+	fb.pending.Add(1)
+	return true
+}
+
+// take removes and returns all of the unexpired entries for the given device
+func (fb *forwardBuffer) take(id ID) []*forwardEntry {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	return fb.takeLocked(id)
+}
+
+func (fb *forwardBuffer) takeLocked(id ID) []*forwardEntry {
+	fb.pruneLocked()
+
+	entries := fb.byID[id]
+	delete(fb.byID, id)
+	for _, entry := range entries {
+		entry.removed = true
+	}
+
+	return entries
+}
+
+// release frees the storage held by an entry which has been removed from this buffer.  If the entry was
+// spilled, its contents are read back before the file is deleted.
+func (fb *forwardBuffer) release(entry *forwardEntry) ([]byte, error) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	return fb.releaseLocked(entry)
+}
+
+func (fb *forwardBuffer) releaseLocked(entry *forwardEntry) (contents []byte, err error) {
+	fb.pending.Add(-1)
+	if len(entry.file) == 0 {
+		fb.memory -= entry.size
+		contents, entry.contents = entry.contents, nil
+		return
+	}
+
+	fb.spill -= entry.size
+	contents, err = ioutil.ReadFile(entry.file)
+	os.Remove(entry.file)
+	entry.file = ""
+	return
+}
+
+// pruneLocked discards expired entries along with the bookkeeping of entries already removed.  Since every entry
+// has the same time to live, expired entries are always at the front of both the buffer-wide and per-device lists.
+func (fb *forwardBuffer) pruneLocked() {
+	now := fb.clock.Now()
+	for len(fb.order) > 0 {
+		entry := fb.order[0]
+		if !entry.removed {
+			if now.Before(entry.expires) {
+				break
+			}
+
+			entry.removed = true
+			if remaining := fb.byID[entry.id][1:]; len(remaining) > 0 {
+				fb.byID[entry.id] = remaining
+			} else {
+				delete(fb.byID, entry.id)
+			}
+
+			fb.releaseLocked(entry)
+			fb.outcomes.With(ForwardOutcomeLabel, ForwardExpired).Add(1)
+		}
+
+		fb.order[0] = nil
+		fb.order = fb.order[1:]
+	}
+}
+
+// flush enqueues each message retained for a device which has just connected, then registers the device.  Both
+// happen while holding this buffer's lock, so retained messages are always queued ahead of any message routed to
+// the device once it is registered.  Messages are enqueued without waiting, and are dropped if the device's queue
+// fills up.
+func (fb *forwardBuffer) flush(d *device, register func()) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	defer register()
+
+	for _, entry := range fb.takeLocked(d.ID()) {
+		contents, err := fb.releaseLocked(entry)
+		if err != nil {
+			fb.logger.Error("Unable to read spilled message for device [%s]: %s", d.ID(), err)
+			fb.outcomes.With(ForwardOutcomeLabel, ForwardDropped).Add(1)
+			continue
+		}
+
+		message := new(wrp.Message)
+		if err := wrp.NewDecoderBytes(contents, wrp.Msgpack).Decode(message); err != nil {
+			fb.logger.Error("Unable to decode buffered message for device [%s]: %s", d.ID(), err)
+			fb.outcomes.With(ForwardOutcomeLabel, ForwardDropped).Add(1)
+			continue
+		}
+
+		if err := d.trySendRequest(&Request{Message: message, Format: wrp.Msgpack, Contents: contents}); err != nil {
+			fb.logger.Debug("Unable to flush buffered message to device [%s]: %s", d.ID(), err)
+			fb.outcomes.With(ForwardOutcomeLabel, ForwardDropped).Add(1)
+			continue
+		}
+
+		fb.outcomes.With(ForwardOutcomeLabel, ForwardFlushed).Add(1)
+	}
+}
+
+// close discards every retained message and removes the spill directory, if any.  Once closed, this buffer
+// no longer spills messages to disk.
+func (fb *forwardBuffer) close() {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	for _, entry := range fb.order {
+		if !entry.removed {
+			entry.removed = true
+			fb.releaseLocked(entry)
+			fb.outcomes.With(ForwardOutcomeLabel, ForwardDropped).Add(1)
+		}
+	}
+
+	fb.byID = make(map[ID][]*forwardEntry)
+	fb.order = nil
+	if len(fb.spillDir) > 0 {
+		if err := os.RemoveAll(fb.spillDir); err != nil {
+			fb.logger.Error("Unable to remove spill directory [%s]: %s", fb.spillDir, err)
+		}
+
+		fb.spillDir = ""
+	}
+}
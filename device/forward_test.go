@@ -0,0 +1,270 @@
+package device
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestForwardBuffer(t *testing.T, o *Options, now time.Time) *forwardBuffer {
+	fb, err := newForwardBuffer(o, logging.TestLogger(t), newFixedClock(now), newMeasures(xmetrics.NewDiscardProvider()))
+	require.NoError(t, err)
+	require.NotNil(t, fb)
+	return fb
+}
+
+func testForwardRequest(destination, payload string) *Request {
+	return &Request{
+		Message: &wrp.Message{
+			Type:        wrp.SimpleEventMessageType,
+			Source:      "dns:scytale.example.com",
+			Destination: destination,
+			Payload:     []byte(payload),
+		},
+		Format: wrp.Msgpack,
+	}
+}
+
+func TestForwardBuffer(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		now     = time.Now()
+		fb      = newTestForwardBuffer(t, &Options{ForwardTTL: time.Minute, ForwardMaxMessages: 2}, now)
+	)
+
+	assert.Empty(fb.spillDir)
+	assert.True(fb.buffer(ID("mac:112233445566"), testForwardRequest("mac:112233445566", "first")))
+	assert.True(fb.buffer(ID("mac:112233445566"), testForwardRequest("mac:112233445566", "second")))
+	assert.False(fb.buffer(ID("mac:112233445566"), testForwardRequest("mac:112233445566", "too many")))
+	assert.True(fb.buffer(ID("mac:665544332211"), testForwardRequest("mac:665544332211", "other")))
+	assert.NotZero(fb.memory)
+
+	entries := fb.take(ID("mac:112233445566"))
+	require.Len(entries, 2)
+	assert.Empty(fb.take(ID("mac:112233445566")))
+
+	for _, expected := range []string{"first", "second"} {
+		contents, err := fb.release(entries[0])
+		require.NoError(err)
+		entries = entries[1:]
+
+		var message wrp.Message
+		require.NoError(wrp.NewDecoderBytes(contents, wrp.Msgpack).Decode(&message))
+		assert.Equal(expected, string(message.Payload))
+	}
+
+	// the remaining entry expires once the clock moves past the TTL
+	fb.clock = newFixedClock(now.Add(time.Minute))
+	assert.Empty(fb.take(ID("mac:665544332211")))
+	assert.Zero(fb.memory)
+	assert.Empty(fb.order)
+	assert.Empty(fb.byID)
+}
+
+func TestForwardBufferMemoryLimit(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		fb     = newTestForwardBuffer(t, &Options{ForwardTTL: time.Minute, ForwardMaxMemory: 1}, time.Now())
+	)
+
+	assert.False(fb.buffer(ID("mac:112233445566"), testForwardRequest("mac:112233445566", "this will not fit")))
+	assert.Empty(fb.byID)
+	assert.Zero(fb.memory)
+}
+
+func TestForwardBufferSpill(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	dir, err := ioutil.TempDir("", "forward-test")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	var (
+		request = testForwardRequest("mac:112233445566", "this is spilled to disk")
+		fb      = newTestForwardBuffer(
+			t,
+			&Options{ForwardTTL: time.Minute, ForwardMaxMemory: 1, ForwardSpillDirectory: dir, ForwardMaxSpill: 100},
+			time.Now(),
+		)
+	)
+
+	require.NotEmpty(fb.spillDir)
+	assert.Equal(dir, filepath.Dir(fb.spillDir))
+
+	assert.True(fb.buffer(ID("mac:112233445566"), request))
+	assert.Zero(fb.memory)
+	assert.NotZero(fb.spill)
+
+	files, err := ioutil.ReadDir(fb.spillDir)
+	require.NoError(err)
+	assert.Len(files, 1)
+
+	// the spill limit bounds the disk usage
+	assert.False(fb.buffer(ID("mac:112233445566"), testForwardRequest("mac:112233445566", string(make([]byte, 100)))))
+
+	entries := fb.take(ID("mac:112233445566"))
+	require.Len(entries, 1)
+	contents, err := fb.release(entries[0])
+	require.NoError(err)
+
+	var message wrp.Message
+	require.NoError(wrp.NewDecoderBytes(contents, wrp.Msgpack).Decode(&message))
+	assert.Equal("this is spilled to disk", string(message.Payload))
+	assert.Zero(fb.spill)
+
+	files, err = ioutil.ReadDir(fb.spillDir)
+	require.NoError(err)
+	assert.Empty(files)
+}
+
+func TestForwardBufferClose(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	dir, err := ioutil.TempDir("", "forward-test")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fb := newTestForwardBuffer(
+		t,
+		&Options{ForwardTTL: time.Minute, ForwardMaxMemory: 1, ForwardSpillDirectory: dir, ForwardMaxSpill: 100},
+		time.Now(),
+	)
+
+	require.True(fb.buffer(ID("mac:112233445566"), testForwardRequest("mac:112233445566", "spilled")))
+	spillDir := fb.spillDir
+
+	fb.close()
+	_, err = os.Stat(spillDir)
+	assert.True(os.IsNotExist(err))
+	assert.Zero(fb.spill)
+	assert.Empty(fb.take(ID("mac:112233445566")))
+
+	// once closed, nothing more is spilled
+	assert.False(fb.buffer(ID("mac:112233445566"), testForwardRequest("mac:112233445566", "not spilled")))
+}
+
+func TestForwardBufferMissing(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		fb        = newTestForwardBuffer(t, &Options{ForwardTTL: time.Minute, ForwardMaxMessages: 1}, time.Now())
+		connected = newDevice(ID("mac:112233445566"), Key("test"), nil, "", 1, defaultQOSWeights)
+		lookup    = func(id ID) (*device, error) { return nil, ErrorDeviceNotFound }
+	)
+
+	d, err := fb.bufferMissing(connected.ID(), testForwardRequest("mac:112233445566", "first"), lookup)
+	assert.Nil(d)
+	assert.Equal(ErrorDeviceForwarded, err)
+
+	d, err = fb.bufferMissing(connected.ID(), testForwardRequest("mac:112233445566", "too many"), lookup)
+	assert.Nil(d)
+	assert.Equal(ErrorDeviceNotFound, err)
+
+	// a device which connected after the caller's lookup is returned instead
+	d, err = fb.bufferMissing(
+		connected.ID(),
+		testForwardRequest("mac:112233445566", "second"),
+		func(ID) (*device, error) { return connected, nil },
+	)
+
+	assert.Equal(connected, d)
+	assert.NoError(err)
+
+	var registered bool
+	fb.flush(connected, func() { registered = true })
+	assert.True(registered)
+	assert.Equal(1, connected.messages.len())
+}
+
+func TestForwardBufferBadSpillDirectory(t *testing.T) {
+	fb, err := newForwardBuffer(
+		&Options{ForwardTTL: time.Minute, ForwardSpillDirectory: "/this/does/not/exist"},
+		logging.TestLogger(t),
+		SystemClock(),
+		newMeasures(xmetrics.NewDiscardProvider()),
+	)
+
+	assert.Nil(t, fb)
+	assert.Error(t, err)
+}
+
+func TestManagerForward(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		connects = make(chan ID, 1)
+		options  = &Options{
+			Logger:     &logging.LoggerWriter{Writer: ioutil.Discard},
+			AuthDelay:  10 * time.Millisecond,
+			ForwardTTL: time.Minute,
+			Listeners: []Listener{
+				func(event *Event) {
+					if event.Type == Connect {
+						connects <- event.Device.ID()
+					}
+				},
+			},
+		}
+
+		manager, server, connectURL = startWebsocketServer(options)
+		dialer                      = NewDialer(options, nil)
+	)
+
+	defer server.Close()
+
+	// transactions await a response, so they are never retained
+	transaction := testForwardRequest("mac:112233445566", "transaction")
+	transaction.Message.(*wrp.Message).Type = wrp.SimpleRequestResponseMessageType
+	transaction.Message.(*wrp.Message).TransactionUUID = "test-transaction"
+	response, err := manager.Route(transaction)
+	assert.Nil(response)
+	assert.Equal(ErrorDeviceNotFound, err)
+
+	for _, payload := range []string{"first", "second"} {
+		response, err := manager.Route(testForwardRequest("mac:112233445566", payload))
+		assert.Nil(response)
+		assert.Equal(ErrorDeviceForwarded, err)
+	}
+
+	connection, _, err := dialer.Dial(connectURL, "mac:112233445566", nil, nil)
+	require.NoError(err)
+	require.NotNil(connection)
+	defer connection.Close()
+
+	select {
+	case id := <-connects:
+		assert.Equal(ID("mac:112233445566"), id)
+	case <-time.After(5 * time.Second):
+		require.Fail("The device did not connect")
+	}
+
+	// retained messages are queued before the device is routable, so they precede anything routed afterward
+	_, err = manager.Route(testForwardRequest("mac:112233445566", "third"))
+	require.NoError(err)
+
+	for _, expected := range []string{"first", "second", "third"} {
+		message, err := expectMessage(connection)
+		require.NoError(err)
+		assert.Equal(wrp.SimpleEventMessageType, message.Type)
+		assert.Equal(expected, string(message.Payload))
+	}
+
+	message, err := expectMessage(connection)
+	require.NoError(err)
+	assert.Equal(wrp.AuthMessageType, message.Type)
+}
@@ -0,0 +1,186 @@
+package device
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/httperror"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+)
+
+// DefaultGateRejectStatus is the HTTP status returned to devices which attempt to connect while a Gate is closed
+const DefaultGateRejectStatus = http.StatusServiceUnavailable
+
+// GateOptions configures a Gate
+type GateOptions struct {
+	// Closed indicates that the Gate starts out closed.  By default, a Gate starts out open.
+	Closed bool
+
+	// RejectStatus is the HTTP status returned to devices which attempt to connect while the Gate is closed.
+	// If not supplied, DefaultGateRejectStatus is used.
+	RejectStatus int
+
+	// MetricsProvider is the source of the GateStatusGauge.  If not supplied, the gauge is discarded.
+	MetricsProvider xmetrics.Provider
+
+	// Clock is the source of the times at which the Gate changes state.  If not supplied, SystemClock() is used.
+	Clock Clock `json:"-"`
+}
+
+func (o *GateOptions) rejectStatus() int {
+	if o != nil && o.RejectStatus > 0 {
+		return o.RejectStatus
+	}
+
+	return DefaultGateRejectStatus
+}
+
+func (o *GateOptions) metricsProvider() xmetrics.Provider {
+	if o != nil && o.MetricsProvider != nil {
+		return o.MetricsProvider
+	}
+
+	return xmetrics.NewDiscardProvider()
+}
+
+func (o *GateOptions) clock() Clock {
+	if o != nil && o.Clock != nil {
+		return o.Clock
+	}
+
+	return SystemClock()
+}
+
+// GateStatus is the JSON representation of the state of a Gate
+type GateStatus struct {
+	Open  bool      `json:"open"`
+	Since time.Time `json:"since"`
+}
+
+// Gate controls the admission of new device connections, e.g. to shed load during an incident.  While a Gate
+// is closed, a Manager rejects connection attempts with the Gate's RejectStatus.  Devices which are already
+// connected are unaffected by the state of the Gate.  A Gate is safe for concurrent use.
+type Gate struct {
+	lock         sync.RWMutex
+	open         bool
+	since        time.Time
+	rejectStatus int
+	clock        Clock
+	gauge        metrics.Gauge
+}
+
+// NewGate creates a Gate from a set of options, which may be nil
+func NewGate(o *GateOptions) *Gate {
+	g := &Gate{
+		open:         o == nil || !o.Closed,
+		rejectStatus: o.rejectStatus(),
+		clock:        o.clock(),
+		gauge:        o.metricsProvider().NewGauge(GateStatusGauge),
+	}
+
+	g.since = g.clock.Now()
+	g.updateGauge()
+	return g
+}
+
+func (g *Gate) updateGauge() {
+	if g.open {
+		g.gauge.Set(1.0)
+	} else {
+		g.gauge.Set(0.0)
+	}
+}
+
+// set changes the state of this gate, returning true if the state actually changed
+func (g *Gate) set(open bool) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.open == open {
+		return false
+	}
+
+	g.open = open
+	g.since = g.clock.Now()
+	g.updateGauge()
+	return true
+}
+
+// Open admits new device connections.  This method returns true if the gate was closed.
+func (g *Gate) Open() bool {
+	return g.set(true)
+}
+
+// Close rejects new device connections.  This method returns true if the gate was open.
+func (g *Gate) Close() bool {
+	return g.set(false)
+}
+
+// IsOpen tests if this gate currently admits new device connections
+func (g *Gate) IsOpen() bool {
+	g.lock.RLock()
+	open := g.open
+	g.lock.RUnlock()
+	return open
+}
+
+// Status returns the current state of this gate along with the time it entered that state
+func (g *Gate) Status() GateStatus {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return GateStatus{Open: g.open, Since: g.since}
+}
+
+// RejectStatus returns the HTTP status with which connection attempts are rejected while this gate is closed
+func (g *Gate) RejectStatus() int {
+	return g.rejectStatus
+}
+
+// GateHandler is the administrative HTTP handler for a Gate.  A GET returns the gate's GateStatus.  A POST or PUT
+// with an open parameter, e.g. open=false, opens or closes the gate and returns the resulting GateStatus.
+type GateHandler struct {
+	Gate *Gate
+}
+
+func (gh *GateHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead:
+
+	case http.MethodPost, http.MethodPut:
+		value := request.FormValue("open")
+		if len(value) == 0 {
+			httperror.Formatf(response, http.StatusBadRequest, "Missing open parameter")
+			return
+		}
+
+		open, err := strconv.ParseBool(value)
+		if err != nil {
+			httperror.Formatf(response, http.StatusBadRequest, "Invalid open parameter [%s]: %s", value, err)
+			return
+		}
+
+		if open {
+			gh.Gate.Open()
+		} else {
+			gh.Gate.Close()
+		}
+
+	default:
+		response.Header().Set("Allow", "GET, HEAD, POST, PUT")
+		httperror.Formatf(response, http.StatusMethodNotAllowed, "Method not allowed: %s", request.Method)
+		return
+	}
+
+	data, err := json.Marshal(gh.Gate.Status())
+	if err != nil {
+		httperror.Format(response, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(data)
+}
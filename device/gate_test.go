@@ -0,0 +1,201 @@
+package device
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGateOptions(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		assert := assert.New(t)
+		for _, o := range []*GateOptions{nil, new(GateOptions)} {
+			assert.Equal(DefaultGateRejectStatus, o.rejectStatus())
+			assert.NotNil(o.metricsProvider())
+			assert.Equal(SystemClock(), o.clock())
+		}
+	})
+
+	t.Run("Custom", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			clock  = newFixedClock(time.Now())
+			o      = &GateOptions{
+				RejectStatus: http.StatusTooManyRequests,
+				Clock:        clock,
+			}
+		)
+
+		assert.Equal(http.StatusTooManyRequests, o.rejectStatus())
+		assert.Equal(clock, o.clock())
+	})
+}
+
+func TestGate(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+	)
+
+	require.NoError(err)
+	scrape := func() string {
+		response := httptest.NewRecorder()
+		registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+		return response.Body.String()
+	}
+
+	started := time.Now()
+	g := NewGate(&GateOptions{MetricsProvider: registry, Clock: newFixedClock(started)})
+	require.NotNil(g)
+	assert.True(g.IsOpen())
+	assert.Equal(GateStatus{Open: true, Since: started}, g.Status())
+	assert.Equal(DefaultGateRejectStatus, g.RejectStatus())
+	assert.Contains(scrape(), GateStatusGauge+" 1")
+
+	closed := started.Add(time.Minute)
+	g.clock = newFixedClock(closed)
+	assert.True(g.Close())
+	assert.False(g.Close())
+	assert.False(g.IsOpen())
+	assert.Equal(GateStatus{Open: false, Since: closed}, g.Status())
+	assert.Contains(scrape(), GateStatusGauge+" 0")
+
+	opened := closed.Add(time.Minute)
+	g.clock = newFixedClock(opened)
+	assert.True(g.Open())
+	assert.False(g.Open())
+	assert.True(g.IsOpen())
+	assert.Equal(GateStatus{Open: true, Since: opened}, g.Status())
+	assert.Contains(scrape(), GateStatusGauge+" 1")
+}
+
+func TestNewGateClosed(t *testing.T) {
+	assert := assert.New(t)
+	g := NewGate(&GateOptions{Closed: true, RejectStatus: http.StatusTooManyRequests})
+	assert.False(g.IsOpen())
+	assert.False(g.Status().Open)
+	assert.Equal(http.StatusTooManyRequests, g.RejectStatus())
+}
+
+func TestGateHandler(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		gate    = NewGate(nil)
+		handler = &GateHandler{Gate: gate}
+	)
+
+	serve := func(method, target string) (*httptest.ResponseRecorder, GateStatus) {
+		var (
+			response = httptest.NewRecorder()
+			status   GateStatus
+		)
+
+		handler.ServeHTTP(response, httptest.NewRequest(method, target, nil))
+		if response.Code == http.StatusOK {
+			assert.Equal("application/json", response.Header().Get("Content-Type"))
+			require.NoError(json.Unmarshal(response.Body.Bytes(), &status))
+		}
+
+		return response, status
+	}
+
+	response, status := serve("GET", "/gate")
+	assert.Equal(http.StatusOK, response.Code)
+	assert.True(status.Open)
+
+	response, status = serve("POST", "/gate?open=false")
+	assert.Equal(http.StatusOK, response.Code)
+	assert.False(status.Open)
+	assert.False(gate.IsOpen())
+
+	response, status = serve("GET", "/gate")
+	assert.Equal(http.StatusOK, response.Code)
+	assert.False(status.Open)
+
+	response, status = serve("PUT", "/gate?open=true")
+	assert.Equal(http.StatusOK, response.Code)
+	assert.True(status.Open)
+	assert.True(gate.IsOpen())
+
+	response, _ = serve("POST", "/gate")
+	assert.Equal(http.StatusBadRequest, response.Code)
+
+	response, _ = serve("POST", "/gate?open=maybe")
+	assert.Equal(http.StatusBadRequest, response.Code)
+
+	response, _ = serve("DELETE", "/gate")
+	assert.Equal(http.StatusMethodNotAllowed, response.Code)
+	assert.True(strings.Contains(response.Header().Get("Allow"), "POST"))
+	assert.True(gate.IsOpen())
+}
+
+func TestManagerGate(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		connects = make(chan ID, 2)
+		gate     = NewGate(&GateOptions{RejectStatus: http.StatusTooManyRequests})
+		options  = &Options{
+			Logger: &logging.LoggerWriter{Writer: ioutil.Discard},
+			Gate:   gate,
+			Listeners: []Listener{
+				func(event *Event) {
+					if event.Type == Connect {
+						connects <- event.Device.ID()
+					}
+				},
+			},
+		}
+
+		manager, server, connectURL = startWebsocketServer(options)
+		dialer                      = NewDialer(options, nil)
+	)
+
+	defer server.Close()
+
+	existing, _, err := dialer.Dial(connectURL, "mac:112233445566", nil, nil)
+	require.NoError(err)
+	require.NotNil(existing)
+	defer existing.Close()
+
+	select {
+	case id := <-connects:
+		assert.Equal(ID("mac:112233445566"), id)
+	case <-time.After(5 * time.Second):
+		require.Fail("The device did not connect")
+	}
+
+	assert.True(gate.Close())
+
+	rejected, response, err := dialer.Dial(connectURL, "mac:665544332211", nil, nil)
+	assert.Error(err)
+	assert.Nil(rejected)
+	if assert.NotNil(response) {
+		assert.Equal(http.StatusTooManyRequests, response.StatusCode)
+	}
+
+	// connections established before the gate closed are left alone
+	assert.Equal(1, manager.VisitAll(func(d Interface) {
+		assert.Equal(ID("mac:112233445566"), d.ID())
+	}))
+
+	assert.True(gate.Open())
+	admitted, _, err := dialer.Dial(connectURL, "mac:665544332211", nil, nil)
+	require.NoError(err)
+	require.NotNil(admitted)
+	admitted.Close()
+}
@@ -3,6 +3,7 @@ package device
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"sync"
@@ -12,7 +13,6 @@ import (
 	"github.com/Comcast/webpa-common/httperror"
 	"github.com/Comcast/webpa-common/logging"
 	"github.com/Comcast/webpa-common/wrp"
-	"github.com/gorilla/mux"
 )
 
 const (
@@ -50,36 +50,21 @@ var UseID = struct {
 	// from the URI path using the supplied variable name.  This constructor is
 	// configurable: device.UseID.FromPath("deviceId").
 	FromPath func(string) func(http.Handler) http.Handler
+
+	// FromExtractor is a configurable constructor that uses an IDExtractor, such as a chain
+	// of IDExtractors, to extract the device identifier.
+	FromExtractor func(IDExtractor) func(http.Handler) http.Handler
 }{
 	F: useID,
 
-	FromHeader: useID(
-		func(request *http.Request) (ID, error) {
-			deviceName := request.Header.Get(DeviceNameHeader)
-			if len(deviceName) == 0 {
-				return invalidID, ErrorMissingDeviceNameHeader
-			}
-
-			return ParseID(deviceName)
-		},
-	),
+	FromHeader: useID(HeaderIDExtractor(DeviceNameHeader).ExtractID),
 
 	FromPath: func(variableName string) func(http.Handler) http.Handler {
-		return useID(
-			func(request *http.Request) (ID, error) {
-				vars := mux.Vars(request)
-				if vars == nil {
-					return invalidID, ErrorMissingPathVars
-				}
-
-				deviceName := vars[variableName]
-				if len(deviceName) == 0 {
-					return invalidID, ErrorMissingDeviceNameVar
-				}
+		return useID(PathIDExtractor(variableName).ExtractID)
+	},
 
-				return ParseID(deviceName)
-			},
-		)
+	FromExtractor: func(extractor IDExtractor) func(http.Handler) http.Handler {
+		return useID(extractor.ExtractID)
 	},
 }
 
@@ -110,6 +95,7 @@ func useID(f IDFromRequest) func(http.Handler) http.Handler {
 // to be sent to devices.
 type MessageHandler struct {
 	// Logger is the sink for logging output.  If not set, logging will be sent to logging.DefaultLogger().
+	// Requests whose Context carries a logger, as installed by a logging.RequestHandler, are logged there instead.
 	Logger logging.Logger
 
 	// Decoders is the pool of wrp.Decoder objects used to decode http.Request bodies
@@ -148,7 +134,7 @@ func (mh *MessageHandler) ServeHTTP(httpResponse http.ResponseWriter, httpReques
 	if err != nil {
 		httperror.Formatf(
 			httpResponse,
-			http.StatusBadRequest,
+			httperror.StatusCode(err, http.StatusBadRequest),
 			"Could not decode WRP message: %s",
 			err,
 		)
@@ -157,19 +143,22 @@ func (mh *MessageHandler) ServeHTTP(httpResponse http.ResponseWriter, httpReques
 	}
 
 	// deviceRequest carries the context through the routing infrastructure
-	if deviceResponse, err := mh.Router.Route(deviceRequest); err != nil {
-		code := http.StatusInternalServerError
+	if deviceResponse, err := mh.Router.Route(deviceRequest); err == ErrorDeviceForwarded {
+		// the message was retained, and will be sent once the device reconnects
+		httpResponse.WriteHeader(http.StatusAccepted)
+	} else if err != nil {
+		code := httperror.StatusCode(err, http.StatusInternalServerError)
 		switch err {
 		case ErrorInvalidDeviceName:
 			code = http.StatusBadRequest
-		case ErrorDeviceNotFound:
-			code = http.StatusNotFound
 		case ErrorNonUniqueID:
 			code = http.StatusBadRequest
 		case ErrorInvalidTransactionKey:
 			code = http.StatusBadRequest
 		case ErrorTransactionAlreadyRegistered:
 			code = http.StatusBadRequest
+		case context.DeadlineExceeded:
+			code = http.StatusGatewayTimeout
 		}
 
 		httperror.Formatf(
@@ -180,7 +169,7 @@ func (mh *MessageHandler) ServeHTTP(httpResponse http.ResponseWriter, httpReques
 		)
 	} else if deviceResponse != nil {
 		if err := EncodeResponse(httpResponse, deviceResponse, mh.Encoders); err != nil {
-			mh.logger().Error("Error while writing transaction response: %s", err)
+			logging.PrintfFromContext(httpRequest.Context(), mh.logger()).Error("Error while writing transaction response: %s", err)
 		}
 	}
 
@@ -377,3 +366,245 @@ func (lh *ListHandler) ServeHTTP(response http.ResponseWriter, request *http.Req
 		response.WriteHeader(http.StatusServiceUnavailable)
 	}
 }
+
+// deviceStatus is the JSON representation of a device ID served by StatusHandler
+type deviceStatus struct {
+	ID          ID                 `json:"id"`
+	Devices     []json.RawMessage  `json:"devices"`
+	Disconnects []DisconnectRecord `json:"disconnects"`
+}
+
+// StatusHandler is an HTTP handler which describes a single device ID, typically mapped to
+// a path like /devices/{id} and decorated with UseID.FromPath.  The response includes every device
+// currently connected with that ID along with the ID's recent disconnections, which allows support to
+// find out why a device dropped.  If the ID is neither connected nor recently disconnected, this
+// handler returns http.StatusNotFound.
+type StatusHandler struct {
+	Registry Registry
+}
+
+func (sh *StatusHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	id, ok := GetID(request.Context())
+	if !ok {
+		httperror.Format(
+			response,
+			http.StatusInternalServerError,
+			ErrorMissingDeviceNameContext,
+		)
+
+		return
+	}
+
+	status := deviceStatus{
+		ID:          id,
+		Devices:     []json.RawMessage{},
+		Disconnects: sh.Registry.DisconnectHistory(id),
+	}
+
+	sh.Registry.VisitIf(
+		func(candidate ID) bool { return candidate == id },
+		func(d Interface) { status.Devices = append(status.Devices, json.RawMessage(d.String())) },
+	)
+
+	if len(status.Devices) == 0 && len(status.Disconnects) == 0 {
+		httperror.Format(
+			response,
+			http.StatusNotFound,
+			ErrorDeviceNotFound,
+		)
+
+		return
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		httperror.Format(
+			response,
+			http.StatusInternalServerError,
+			err,
+		)
+
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(data)
+}
+
+// deviceHistory is the JSON representation of a single device's events served by HistoryHandler
+type deviceHistory struct {
+	Key     Key             `json:"key"`
+	History []HistoryRecord `json:"history"`
+}
+
+// idHistory is the JSON representation of a device ID served by HistoryHandler
+type idHistory struct {
+	ID      ID              `json:"id"`
+	Devices []deviceHistory `json:"devices"`
+}
+
+// HistoryHandler is a debug HTTP handler which returns the recent events of a single device ID, typically
+// mapped to a path like /devices/{id}/history and decorated with UseID.FromPath.  Each device connected
+// with the ID is described separately.  The optional since query parameter, e.g. since=5m, limits the
+// response to events that occurred within that duration.  If no device with the ID is connected, this
+// handler returns http.StatusNotFound.
+//
+// Devices only remember events when the Manager's Options.EventHistorySize is set.
+type HistoryHandler struct {
+	Registry Registry
+}
+
+func (hh *HistoryHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	id, ok := GetID(request.Context())
+	if !ok {
+		httperror.Format(
+			response,
+			http.StatusInternalServerError,
+			ErrorMissingDeviceNameContext,
+		)
+
+		return
+	}
+
+	var cutoff time.Time
+	if value := request.URL.Query().Get("since"); len(value) > 0 {
+		since, err := time.ParseDuration(value)
+		if err != nil || since <= 0 {
+			httperror.Formatf(
+				response,
+				http.StatusBadRequest,
+				"Invalid since parameter: %s",
+				value,
+			)
+
+			return
+		}
+
+		cutoff = time.Now().Add(-since)
+	}
+
+	result := idHistory{
+		ID:      id,
+		Devices: []deviceHistory{},
+	}
+
+	hh.Registry.VisitIf(
+		func(candidate ID) bool { return candidate == id },
+		func(d Interface) {
+			history := []HistoryRecord{}
+			if historian, ok := d.(Historian); ok {
+				history = historian.History()
+			}
+
+			if !cutoff.IsZero() {
+				// records are most recent first, so truncate at the first record before the cutoff
+				for index, record := range history {
+					if record.Time.Before(cutoff) {
+						history = history[:index]
+						break
+					}
+				}
+			}
+
+			result.Devices = append(result.Devices, deviceHistory{Key: d.Key(), History: history})
+		},
+	)
+
+	if len(result.Devices) == 0 {
+		httperror.Format(
+			response,
+			http.StatusNotFound,
+			ErrorDeviceNotFound,
+		)
+
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		httperror.Format(
+			response,
+			http.StatusInternalServerError,
+			err,
+		)
+
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(data)
+}
+
+// DevicesHandler is an HTTP handler which enumerates the connected devices one page at a time, typically
+// mapped to a path like /devices.  The following optional query parameters are supported:
+//
+//	prefix:  only devices whose ID begins with this value, e.g. prefix=mac:1122
+//	partner: only devices which connected with this partner id
+//	idle:    only devices which have sent no messages for at least this duration, e.g. idle=10m
+//	after:   the ID after which the page begins, taken from the next cursor of the previous page
+//	limit:   the maximum number of devices in the page, which cannot exceed MaxPageSize
+//
+// The response is the JSON representation of a Page.
+type DevicesHandler struct {
+	Enumerator Enumerator
+}
+
+func (dh *DevicesHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	var (
+		query  = request.URL.Query()
+		filter = Filter{
+			IDPrefix: query.Get("prefix"),
+			Partner:  query.Get("partner"),
+		}
+
+		cursor = Cursor{
+			After: ID(query.Get("after")),
+		}
+	)
+
+	if value := query.Get("idle"); len(value) > 0 {
+		idle, err := time.ParseDuration(value)
+		if err != nil || idle <= 0 {
+			httperror.Formatf(
+				response,
+				http.StatusBadRequest,
+				"Invalid idle parameter: %s",
+				value,
+			)
+
+			return
+		}
+
+		filter.MinIdle = idle
+	}
+
+	if value := query.Get("limit"); len(value) > 0 {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > MaxPageSize {
+			httperror.Formatf(
+				response,
+				http.StatusBadRequest,
+				"Invalid limit parameter: %s",
+				value,
+			)
+
+			return
+		}
+
+		cursor.Limit = limit
+	}
+
+	data, err := json.Marshal(dh.Enumerator.Devices(filter, cursor))
+	if err != nil {
+		httperror.Format(
+			response,
+			http.StatusInternalServerError,
+			err,
+		)
+
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(data)
+}
@@ -5,9 +5,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -200,6 +202,33 @@ func testUseIDFromPathMissingDeviceNameVar(t *testing.T) {
 	assert.Equal(http.StatusBadRequest, response.Code)
 }
 
+func testUseIDFromExtractor(t *testing.T) {
+	var (
+		assert         = assert.New(t)
+		request        = httptest.NewRequest("GET", "/", nil)
+		response       = httptest.NewRecorder()
+		delegateCalled bool
+
+		handler = alice.New(UseID.FromExtractor(IDExtractors{HeaderIDExtractor("X-Custom"), HeaderIDExtractor("")})).
+			Then(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				delegateCalled = true
+				id, ok := GetID(request.Context())
+				assert.Equal(id, ID("mac:112233445566"))
+				assert.True(ok)
+			}))
+	)
+
+	request.Header.Set(DeviceNameHeader, "mac:112233445566")
+	handler.ServeHTTP(response, request)
+	assert.True(delegateCalled)
+
+	delegateCalled = false
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.False(delegateCalled)
+	assert.Equal(http.StatusBadRequest, response.Code)
+}
+
 func TestUseID(t *testing.T) {
 	t.Run("F", func(t *testing.T) {
 		t.Run("NilStrategy", testUseIDFNilStrategy)
@@ -216,6 +245,8 @@ func TestUseID(t *testing.T) {
 		t.Run("MissingVars", testUseIDFromPathMissingVars)
 		t.Run("MissingDeviceNameVar", testUseIDFromPathMissingDeviceNameVar)
 	})
+
+	t.Run("FromExtractor", testUseIDFromExtractor)
 }
 
 func testMessageHandlerLogger(t *testing.T) {
@@ -508,12 +539,49 @@ func testMessageHandlerServeHTTPEncodeError(t *testing.T) {
 	device.AssertExpectations(t)
 }
 
+func testMessageHandlerServeHTTPForwarded(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		setupEncoders   = wrp.NewEncoderPool(1, wrp.Msgpack)
+		requestContents []byte
+	)
+
+	require.NoError(setupEncoders.EncodeBytes(&requestContents, &wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "test.com",
+		Destination: "mac:123412341234",
+	}))
+
+	var (
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/foo", bytes.NewReader(requestContents))
+
+		router  = new(mockRouter)
+		handler = MessageHandler{
+			Router:   router,
+			Decoders: wrp.NewDecoderPool(1, wrp.Msgpack),
+		}
+	)
+
+	router.On("Route", mock.AnythingOfType("*device.Request")).Once().Return(nil, ErrorDeviceForwarded)
+
+	// a retained message is accepted, and will be sent once the device reconnects
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusAccepted, response.Code)
+	assert.Zero(response.Body.Len())
+
+	router.AssertExpectations(t)
+}
+
 func TestMessageHandler(t *testing.T) {
 	t.Run("Logger", testMessageHandlerLogger)
 
 	t.Run("ServeHTTP", func(t *testing.T) {
 		t.Run("DecodeError", testMessageHandlerServeHTTPDecodeError)
 		t.Run("EncodeError", testMessageHandlerServeHTTPEncodeError)
+		t.Run("Forwarded", testMessageHandlerServeHTTPForwarded)
 
 		t.Run("RouteError", func(t *testing.T) {
 			testMessageHandlerServeHTTPRouteError(t, ErrorInvalidDeviceName, http.StatusBadRequest)
@@ -521,6 +589,7 @@ func TestMessageHandler(t *testing.T) {
 			testMessageHandlerServeHTTPRouteError(t, ErrorNonUniqueID, http.StatusBadRequest)
 			testMessageHandlerServeHTTPRouteError(t, ErrorInvalidTransactionKey, http.StatusBadRequest)
 			testMessageHandlerServeHTTPRouteError(t, ErrorTransactionAlreadyRegistered, http.StatusBadRequest)
+			testMessageHandlerServeHTTPRouteError(t, context.DeadlineExceeded, http.StatusGatewayTimeout)
 			testMessageHandlerServeHTTPRouteError(t, errors.New("random error"), http.StatusInternalServerError)
 		})
 
@@ -831,3 +900,303 @@ func TestListHandler(t *testing.T) {
 		t.Run("WhileConsuming", testListHandlerServeHTTPWhileConsuming)
 	})
 }
+
+func testStatusHandlerServeHTTPMissingID(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		registry = new(mockRegistry)
+		handler  = StatusHandler{Registry: registry}
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/devices/nosuch", nil)
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusInternalServerError, response.Code)
+	registry.AssertExpectations(t)
+}
+
+func testStatusHandlerServeHTTPNotFound(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		id       = ID("mac:112233445566")
+		registry = new(mockRegistry)
+		handler  = StatusHandler{Registry: registry}
+		response = httptest.NewRecorder()
+		request  = WithIDRequest(id, httptest.NewRequest("GET", "/devices/mac:112233445566", nil))
+	)
+
+	registry.On("DisconnectHistory", id).Return([]DisconnectRecord{}).Once()
+	registry.On("VisitIf", mock.AnythingOfType("func(device.ID) bool"), mock.AnythingOfType("func(device.Interface)")).Return(0).Once()
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusNotFound, response.Code)
+	registry.AssertExpectations(t)
+}
+
+func testStatusHandlerServeHTTP(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		id       = ID("mac:112233445566")
+		device   = newDevice(id, Key("connected"), nil, "", 1, defaultQOSWeights)
+		registry = new(mockRegistry)
+		handler  = StatusHandler{Registry: registry}
+		response = httptest.NewRecorder()
+		request  = WithIDRequest(id, httptest.NewRequest("GET", "/devices/mac:112233445566", nil))
+
+		disconnectedAt = time.Date(2017, time.June, 1, 12, 30, 0, 0, time.UTC)
+		connectedAt    = disconnectedAt.Add(-time.Hour)
+	)
+
+	registry.On("DisconnectHistory", id).Return([]DisconnectRecord{
+		{ID: id, Key: Key("previous"), ConnectedAt: connectedAt, Time: disconnectedAt, Reason: ErrorKeepaliveTimeout.Error()},
+	}).Once()
+
+	registry.On("VisitIf", mock.AnythingOfType("func(device.ID) bool"), mock.AnythingOfType("func(device.Interface)")).
+		Run(func(arguments mock.Arguments) {
+			filter := arguments.Get(0).(func(ID) bool)
+			visitor := arguments.Get(1).(func(Interface))
+			assert.False(filter(ID("mac:aabbccddeeff")))
+			if assert.True(filter(id)) {
+				visitor(device)
+			}
+		}).
+		Return(1).
+		Once()
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal("application/json", response.HeaderMap.Get("Content-Type"))
+	assert.JSONEq(
+		`{
+			"id": "mac:112233445566",
+			"devices": [{"id": "mac:112233445566", "key": "connected", "closed": false, "convey": null}],
+			"disconnects": [{
+				"id": "mac:112233445566",
+				"key": "previous",
+				"connectedAt": "2017-06-01T11:30:00Z",
+				"time": "2017-06-01T12:30:00Z",
+				"reason": "The device did not respond to protocol keepalives"
+			}]
+		}`,
+		response.Body.String(),
+	)
+
+	registry.AssertExpectations(t)
+}
+
+func TestStatusHandler(t *testing.T) {
+	t.Run("ServeHTTP", func(t *testing.T) {
+		t.Run("MissingID", testStatusHandlerServeHTTPMissingID)
+		t.Run("NotFound", testStatusHandlerServeHTTPNotFound)
+		t.Run("Success", testStatusHandlerServeHTTP)
+	})
+}
+
+func testHistoryHandlerServeHTTPMissingID(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		registry = new(mockRegistry)
+		handler  = HistoryHandler{Registry: registry}
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/devices/nosuch/history", nil)
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusInternalServerError, response.Code)
+	registry.AssertExpectations(t)
+}
+
+func testHistoryHandlerServeHTTPBadSince(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		id       = ID("mac:112233445566")
+		registry = new(mockRegistry)
+		handler  = HistoryHandler{Registry: registry}
+		response = httptest.NewRecorder()
+		request  = WithIDRequest(id, httptest.NewRequest("GET", "/devices/mac:112233445566/history?since=yesterday", nil))
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusBadRequest, response.Code)
+	registry.AssertExpectations(t)
+}
+
+func testHistoryHandlerServeHTTPNotFound(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		id       = ID("mac:112233445566")
+		registry = new(mockRegistry)
+		handler  = HistoryHandler{Registry: registry}
+		response = httptest.NewRecorder()
+		request  = WithIDRequest(id, httptest.NewRequest("GET", "/devices/mac:112233445566/history", nil))
+	)
+
+	registry.On("VisitIf", mock.AnythingOfType("func(device.ID) bool"), mock.AnythingOfType("func(device.Interface)")).Return(0).Once()
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusNotFound, response.Code)
+	registry.AssertExpectations(t)
+}
+
+func testHistoryHandlerServeHTTP(t *testing.T, query string, expectedHistory string) {
+	var (
+		assert   = assert.New(t)
+		id       = ID("mac:112233445566")
+		device   = newDevice(id, Key("connected"), nil, "", 1, defaultQOSWeights)
+		registry = new(mockRegistry)
+		handler  = HistoryHandler{Registry: registry}
+		response = httptest.NewRecorder()
+		request  = WithIDRequest(id, httptest.NewRequest("GET", "/devices/mac:112233445566/history"+query, nil))
+
+		recent = time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	)
+
+	device.history = newEventHistory(5)
+	device.history.add(HistoryRecord{Time: time.Date(2017, time.June, 1, 12, 30, 0, 0, time.UTC), Event: "Connect"})
+	device.history.add(HistoryRecord{Time: recent, Event: "MessageReceived", MessageType: "SimpleEvent", Size: 34})
+
+	registry.On("VisitIf", mock.AnythingOfType("func(device.ID) bool"), mock.AnythingOfType("func(device.Interface)")).
+		Run(func(arguments mock.Arguments) {
+			filter := arguments.Get(0).(func(ID) bool)
+			visitor := arguments.Get(1).(func(Interface))
+			assert.False(filter(ID("mac:aabbccddeeff")))
+			if assert.True(filter(id)) {
+				visitor(device)
+			}
+		}).
+		Return(1).
+		Once()
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal("application/json", response.HeaderMap.Get("Content-Type"))
+	assert.JSONEq(
+		fmt.Sprintf(
+			`{"id": "mac:112233445566", "devices": [{"key": "connected", "history": %s}]}`,
+			strings.Replace(expectedHistory, "RECENT", recent.Format(time.RFC3339), -1),
+		),
+		response.Body.String(),
+	)
+
+	registry.AssertExpectations(t)
+}
+
+func TestHistoryHandler(t *testing.T) {
+	t.Run("ServeHTTP", func(t *testing.T) {
+		t.Run("MissingID", testHistoryHandlerServeHTTPMissingID)
+		t.Run("BadSince", testHistoryHandlerServeHTTPBadSince)
+		t.Run("NotFound", testHistoryHandlerServeHTTPNotFound)
+		t.Run("All", func(t *testing.T) {
+			testHistoryHandlerServeHTTP(
+				t,
+				"",
+				`[
+					{"time": "RECENT", "event": "MessageReceived", "messageType": "SimpleEvent", "size": 34},
+					{"time": "2017-06-01T12:30:00Z", "event": "Connect"}
+				]`,
+			)
+		})
+
+		t.Run("Since", func(t *testing.T) {
+			testHistoryHandlerServeHTTP(
+				t,
+				"?since=5m",
+				`[{"time": "RECENT", "event": "MessageReceived", "messageType": "SimpleEvent", "size": 34}]`,
+			)
+		})
+	})
+}
+
+func testDevicesHandlerServeHTTPBadParameter(t *testing.T, query string) {
+	var (
+		assert   = assert.New(t)
+		registry = new(mockRegistry)
+		handler  = DevicesHandler{Enumerator: registry}
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/devices?"+query, nil)
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusBadRequest, response.Code)
+	registry.AssertExpectations(t)
+}
+
+func testDevicesHandlerServeHTTP(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = new(mockRegistry)
+		handler  = DevicesHandler{Enumerator: registry}
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/devices?prefix=mac:1122&partner=comcast&idle=10m&after=mac:112233445566&limit=2", nil)
+
+		connectedAt = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+		page        = Page{
+			Devices: []Summary{
+				{
+					ID:           "mac:112233445567",
+					Key:          "key",
+					Partner:      "comcast",
+					ConnectedAt:  connectedAt,
+					LastActivity: connectedAt.Add(time.Minute),
+				},
+			},
+			Next: &Cursor{After: "mac:112233445567", Limit: 2},
+		}
+	)
+
+	registry.On(
+		"Devices",
+		Filter{IDPrefix: "mac:1122", Partner: "comcast", MinIdle: 10 * time.Minute},
+		Cursor{After: "mac:112233445566", Limit: 2},
+	).Return(page).Once()
+
+	handler.ServeHTTP(response, request)
+	require.Equal(http.StatusOK, response.Code)
+	assert.Equal("application/json", response.Header().Get("Content-Type"))
+	assert.JSONEq(
+		`{
+			"devices": [{
+				"id": "mac:112233445567",
+				"key": "key",
+				"partner": "comcast",
+				"connectedAt": "2017-06-01T12:00:00Z",
+				"lastActivity": "2017-06-01T12:01:00Z"
+			}],
+			"next": {"after": "mac:112233445567", "limit": 2}
+		}`,
+		response.Body.String(),
+	)
+
+	registry.AssertExpectations(t)
+}
+
+func testDevicesHandlerServeHTTPDefaults(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		registry = new(mockRegistry)
+		handler  = DevicesHandler{Enumerator: registry}
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/devices", nil)
+	)
+
+	registry.On("Devices", Filter{}, Cursor{}).Return(Page{Devices: []Summary{}}).Once()
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.JSONEq(`{"devices": []}`, response.Body.String())
+	registry.AssertExpectations(t)
+}
+
+func TestDevicesHandler(t *testing.T) {
+	t.Run("ServeHTTP", func(t *testing.T) {
+		t.Run("Defaults", testDevicesHandlerServeHTTPDefaults)
+		t.Run("Parameters", testDevicesHandlerServeHTTP)
+
+		for _, query := range []string{"idle=yesterday", "idle=-1m", "limit=abc", "limit=0", fmt.Sprintf("limit=%d", MaxPageSize+1)} {
+			t.Run(query, func(t *testing.T) {
+				testDevicesHandlerServeHTTPBadParameter(t, query)
+			})
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package device
+
+import (
+	"github.com/Comcast/webpa-common/health"
+)
+
+const (
+	// HealthSource is the source of the health events published by NewHealthListener
+	HealthSource = "device"
+
+	ConnectedDevices        health.Stat = "ConnectedDevices"
+	TotalConnections        health.Stat = "TotalConnections"
+	TotalDisconnections     health.Stat = "TotalDisconnections"
+	TotalMessagesSent       health.Stat = "TotalMessagesSent"
+	TotalMessagesReceived   health.Stat = "TotalMessagesReceived"
+	TotalMessagesFailed     health.Stat = "TotalMessagesFailed"
+	TotalTransactionsBroken health.Stat = "TotalTransactionsBroken"
+)
+
+// NewHealthListener returns a Listener which publishes a health event for each device event, so that
+// a manager's activity is aggregated into the application's health snapshot.  Each event is attributed
+// to HealthSource.
+func NewHealthListener(p health.Publisher) Listener {
+	p = health.SourcePublisher(p, HealthSource)
+	return func(e *Event) {
+		switch e.Type {
+		case Connect:
+			p.Publish(health.Counter(TotalConnections, 1))
+			p.Publish(health.Counter(ConnectedDevices, 1))
+		case Disconnect:
+			p.Publish(health.Counter(TotalDisconnections, 1))
+			p.Publish(health.Counter(ConnectedDevices, -1))
+		case MessageSent:
+			p.Publish(health.Counter(TotalMessagesSent, 1))
+		case MessageReceived:
+			p.Publish(health.Counter(TotalMessagesReceived, 1))
+		case MessageFailed:
+			p.Publish(health.Counter(TotalMessagesFailed, 1))
+		case TransactionBroken:
+			p.Publish(health.Counter(TotalTransactionsBroken, 1))
+		}
+	}
+}
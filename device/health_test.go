@@ -0,0 +1,41 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/Comcast/webpa-common/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHealthListener(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		published []health.Event
+		listener  = NewHealthListener(health.PublisherFunc(func(e health.Event) {
+			published = append(published, e)
+		}))
+	)
+
+	for _, eventType := range []EventType{Connect, MessageSent, MessageReceived, MessageFailed, TransactionComplete, TransactionBroken, Pong, Disconnect} {
+		listener(&Event{Type: eventType})
+	}
+
+	assert.Equal(
+		[]health.Event{
+			{Source: HealthSource, Type: health.CounterEvent, Stat: TotalConnections, Value: 1},
+			{Source: HealthSource, Type: health.CounterEvent, Stat: ConnectedDevices, Value: 1},
+			{Source: HealthSource, Type: health.CounterEvent, Stat: TotalMessagesSent, Value: 1},
+			{Source: HealthSource, Type: health.CounterEvent, Stat: TotalMessagesReceived, Value: 1},
+			{Source: HealthSource, Type: health.CounterEvent, Stat: TotalMessagesFailed, Value: 1},
+			{Source: HealthSource, Type: health.CounterEvent, Stat: TotalTransactionsBroken, Value: 1},
+			{Source: HealthSource, Type: health.CounterEvent, Stat: TotalDisconnections, Value: 1},
+			{Source: HealthSource, Type: health.CounterEvent, Stat: ConnectedDevices, Value: -1},
+		},
+		published,
+	)
+
+	// a nil publisher discards events
+	assert.NotPanics(func() {
+		NewHealthListener(nil)(&Event{Type: Connect})
+	})
+}
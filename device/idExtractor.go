@@ -0,0 +1,121 @@
+package device
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// IDExtractor derives a device ID from a connection request.  A Manager configured with an IDExtractor
+// uses it to identify each device as it connects, rather than requiring the ID in the request Context.
+type IDExtractor interface {
+	ExtractID(*http.Request) (ID, error)
+}
+
+// ExtractID allows an IDFromRequest function to be used as an IDExtractor
+func (f IDFromRequest) ExtractID(request *http.Request) (ID, error) {
+	return f(request)
+}
+
+// IDExtractors is a chain of fallbacks.  Each IDExtractor is tried in order, and the first ID
+// successfully extracted is used.  If every IDExtractor fails, the error from the last one is returned.
+type IDExtractors []IDExtractor
+
+func (e IDExtractors) ExtractID(request *http.Request) (ID, error) {
+	err := ErrorNoIDExtractors
+	for _, extractor := range e {
+		var id ID
+		if id, err = extractor.ExtractID(request); err == nil {
+			return id, nil
+		}
+	}
+
+	return invalidID, err
+}
+
+// HeaderIDExtractor returns an IDExtractor which parses the value of an HTTP header.
+// If header is the empty string, DeviceNameHeader is used.
+func HeaderIDExtractor(header string) IDExtractor {
+	if len(header) == 0 {
+		header = DeviceNameHeader
+	}
+
+	return IDFromRequest(func(request *http.Request) (ID, error) {
+		deviceName := request.Header.Get(header)
+		if len(deviceName) == 0 {
+			return invalidID, ErrorMissingDeviceNameHeader
+		}
+
+		return ParseID(deviceName)
+	})
+}
+
+// ConveyIDExtractor returns an IDExtractor which parses a field of the convey sent in ConveyHeader.
+// The field's value must be a string, e.g. "mac:112233445566".
+func ConveyIDExtractor(field string) IDExtractor {
+	return IDFromRequest(func(request *http.Request) (ID, error) {
+		encodedConvey := request.Header.Get(ConveyHeader)
+		if len(encodedConvey) == 0 {
+			return invalidID, ErrorMissingDeviceNameConvey
+		}
+
+		convey, err := ParseConvey(encodedConvey, nil)
+		if err != nil {
+			return invalidID, fmt.Errorf("Bad convey value [%s]: %s", encodedConvey, err)
+		}
+
+		deviceName, ok := convey[field].(string)
+		if !ok || len(deviceName) == 0 {
+			return invalidID, ErrorMissingDeviceNameConvey
+		}
+
+		return ParseID(deviceName)
+	})
+}
+
+// CertificateIDExtractor returns an IDExtractor which parses the common name of the TLS client certificate.
+// If prefix is supplied, it is prepended to common names which have no prefix of their own.  For example,
+// with a prefix of "mac", a common name of "112233445566" produces the ID "mac:112233445566".
+//
+// Only a certificate which the TLS server verified against its client CAs is trusted.  A certificate which
+// was presented but not verified, e.g. when the server requests but does not require client certificates,
+// results in ErrorUnverifiedClientCertificate.
+func CertificateIDExtractor(prefix string) IDExtractor {
+	return IDFromRequest(func(request *http.Request) (ID, error) {
+		if request.TLS == nil || len(request.TLS.PeerCertificates) == 0 {
+			return invalidID, ErrorMissingClientCertificate
+		} else if len(request.TLS.VerifiedChains) == 0 || len(request.TLS.VerifiedChains[0]) == 0 {
+			return invalidID, ErrorUnverifiedClientCertificate
+		}
+
+		deviceName := request.TLS.VerifiedChains[0][0].Subject.CommonName
+		if len(deviceName) == 0 {
+			return invalidID, ErrorInvalidDeviceName
+		}
+
+		if len(prefix) > 0 && !strings.Contains(deviceName, ":") {
+			deviceName = prefix + ":" + deviceName
+		}
+
+		return ParseID(deviceName)
+	})
+}
+
+// PathIDExtractor returns an IDExtractor which parses a gorilla/mux URI path variable
+func PathIDExtractor(variableName string) IDExtractor {
+	return IDFromRequest(func(request *http.Request) (ID, error) {
+		vars := mux.Vars(request)
+		if vars == nil {
+			return invalidID, ErrorMissingPathVars
+		}
+
+		deviceName := vars[variableName]
+		if len(deviceName) == 0 {
+			return invalidID, ErrorMissingDeviceNameVar
+		}
+
+		return ParseID(deviceName)
+	})
+}
@@ -0,0 +1,145 @@
+package device
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func testIDExtractorExpect(t *testing.T, extractor IDExtractor, request *http.Request, expectedID ID, expectedError error) {
+	assert := assert.New(t)
+	actualID, actualError := extractor.ExtractID(request)
+	assert.Equal(expectedID, actualID)
+	if expectedError != nil {
+		assert.Equal(expectedError, actualError)
+	} else {
+		assert.NoError(actualError)
+	}
+}
+
+func TestHeaderIDExtractor(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+		testIDExtractorExpect(t, HeaderIDExtractor(""), request, invalidID, ErrorMissingDeviceNameHeader)
+
+		request.Header.Set(DeviceNameHeader, "MAC:11-22-33-44-55-66")
+		testIDExtractorExpect(t, HeaderIDExtractor(""), request, ID("mac:112233445566"), nil)
+	})
+
+	t.Run("Custom", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set(DeviceNameHeader, "mac:112233445566")
+		testIDExtractorExpect(t, HeaderIDExtractor("X-Custom"), request, invalidID, ErrorMissingDeviceNameHeader)
+
+		request.Header.Set("X-Custom", "uuid:1234")
+		testIDExtractorExpect(t, HeaderIDExtractor("X-Custom"), request, ID("uuid:1234"), nil)
+
+		request.Header.Set("X-Custom", "this is not valid")
+		testIDExtractorExpect(t, HeaderIDExtractor("X-Custom"), request, invalidID, ErrorInvalidDeviceName)
+	})
+}
+
+func TestConveyIDExtractor(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		extractor = ConveyIDExtractor("hw-mac")
+		encode    = func(value string) string {
+			return base64.StdEncoding.EncodeToString([]byte(value))
+		}
+	)
+
+	request := httptest.NewRequest("GET", "/", nil)
+	testIDExtractorExpect(t, extractor, request, invalidID, ErrorMissingDeviceNameConvey)
+
+	request.Header.Set(ConveyHeader, "this is not valid")
+	id, err := extractor.ExtractID(request)
+	assert.Equal(invalidID, id)
+	assert.Error(err)
+
+	request.Header.Set(ConveyHeader, encode(`{"fw-name": "foo"}`))
+	testIDExtractorExpect(t, extractor, request, invalidID, ErrorMissingDeviceNameConvey)
+
+	request.Header.Set(ConveyHeader, encode(`{"hw-mac": 123}`))
+	testIDExtractorExpect(t, extractor, request, invalidID, ErrorMissingDeviceNameConvey)
+
+	request.Header.Set(ConveyHeader, encode(`{"hw-mac": "mac:112233445566"}`))
+	testIDExtractorExpect(t, extractor, request, ID("mac:112233445566"), nil)
+}
+
+func TestCertificateIDExtractor(t *testing.T) {
+	withCommonName := func(commonName string) *http.Request {
+		certificate := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		request := httptest.NewRequest("GET", "/", nil)
+		request.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{certificate},
+			VerifiedChains:   [][]*x509.Certificate{{certificate}},
+		}
+
+		return request
+	}
+
+	unverified := httptest.NewRequest("GET", "/", nil)
+	unverified.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "mac:112233445566"}}},
+	}
+
+	testIDExtractorExpect(t, CertificateIDExtractor(""), httptest.NewRequest("GET", "/", nil), invalidID, ErrorMissingClientCertificate)
+	testIDExtractorExpect(t, CertificateIDExtractor(""), unverified, invalidID, ErrorUnverifiedClientCertificate)
+	testIDExtractorExpect(t, CertificateIDExtractor(""), withCommonName(""), invalidID, ErrorInvalidDeviceName)
+	testIDExtractorExpect(t, CertificateIDExtractor(""), withCommonName("112233445566"), invalidID, ErrorInvalidDeviceName)
+	testIDExtractorExpect(t, CertificateIDExtractor(""), withCommonName("serial:ABC123"), ID("serial:ABC123"), nil)
+	testIDExtractorExpect(t, CertificateIDExtractor("mac"), withCommonName("112233445566"), ID("mac:112233445566"), nil)
+	testIDExtractorExpect(t, CertificateIDExtractor("mac"), withCommonName("serial:ABC123"), ID("serial:ABC123"), nil)
+}
+
+func TestPathIDExtractor(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		extractor = PathIDExtractor("did")
+		router    = mux.NewRouter()
+
+		actualID    ID
+		actualError error
+	)
+
+	testIDExtractorExpect(t, extractor, httptest.NewRequest("GET", "/test/mac:112233445566", nil), invalidID, ErrorMissingPathVars)
+
+	router.HandleFunc("/test/{did}", func(response http.ResponseWriter, request *http.Request) {
+		actualID, actualError = extractor.ExtractID(request)
+	})
+
+	router.HandleFunc("/other/{other}", func(response http.ResponseWriter, request *http.Request) {
+		actualID, actualError = extractor.ExtractID(request)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test/mac:112233445566", nil))
+	assert.Equal(ID("mac:112233445566"), actualID)
+	assert.NoError(actualError)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/other/value", nil))
+	assert.Equal(invalidID, actualID)
+	assert.Equal(ErrorMissingDeviceNameVar, actualError)
+}
+
+func TestIDExtractors(t *testing.T) {
+	var (
+		expectedError = errors.New("expected")
+		failing       = IDFromRequest(func(*http.Request) (ID, error) { return invalidID, expectedError })
+		request       = httptest.NewRequest("GET", "/", nil)
+	)
+
+	testIDExtractorExpect(t, IDExtractors{}, request, invalidID, ErrorNoIDExtractors)
+	testIDExtractorExpect(t, IDExtractors{HeaderIDExtractor(""), failing}, request, invalidID, expectedError)
+
+	request.Header.Set(DeviceNameHeader, "mac:112233445566")
+	testIDExtractorExpect(t, IDExtractors{failing, HeaderIDExtractor("")}, request, ID("mac:112233445566"), nil)
+	testIDExtractorExpect(t, IDExtractors{HeaderIDExtractor(""), failing}, request, ID("mac:112233445566"), nil)
+}
@@ -0,0 +1,142 @@
+package device
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/Comcast/webpa-common/wrp"
+)
+
+const (
+	// PolicyPayloadTooLarge is the reason for violations of Options.MaxPayloadSize
+	PolicyPayloadTooLarge = "payload_too_large"
+
+	// PolicyMessageType is the reason for violations of Options.AllowedMessageTypes
+	PolicyMessageType = "message_type"
+
+	// PolicyRateExceeded is the reason for violations of Options.InboundRate
+	PolicyRateExceeded = "rate_exceeded"
+)
+
+// inboundPolicy is the set of limits a manager enforces on the WRP messages it receives from devices.
+// The zero value enforces no limits.
+type inboundPolicy struct {
+	// maxPayloadSize is the largest decoded payload accepted.  If zero, payloads are not limited.
+	maxPayloadSize int
+
+	// allowedTypes is the set of message types accepted.  If nil, all types are accepted.
+	allowedTypes map[wrp.MessageType]bool
+
+	// rate and burst define each device's inbound token bucket.  If rate is zero, messages are not rate limited.
+	rate  float64
+	burst float64
+
+	// disconnect indicates whether a violation closes the device's connection
+	disconnect bool
+}
+
+// newInboundPolicy creates the inboundPolicy described by a set of Options.  Any message type names
+// that are not recognized are returned, so that the caller can report them.
+func newInboundPolicy(o *Options) (p inboundPolicy, unknownTypes []string) {
+	p.maxPayloadSize = o.maxPayloadSize()
+	p.rate = o.inboundRate()
+	p.burst = float64(o.inboundBurst())
+	p.disconnect = o.disconnectOnPolicyViolation()
+
+	if names := o.allowedMessageTypes(); len(names) > 0 {
+		p.allowedTypes = make(map[wrp.MessageType]bool, len(names))
+		for _, name := range names {
+			if messageType := wrp.StringToMessageType(name); messageType.String() != wrp.InvalidMessageTypeString {
+				p.allowedTypes[messageType] = true
+			} else {
+				unknownTypes = append(unknownTypes, name)
+			}
+		}
+	}
+
+	return
+}
+
+// enabled tests if this policy enforces any limits
+func (p *inboundPolicy) enabled() bool {
+	return p.maxPayloadSize > 0 || p.allowedTypes != nil || p.rate > 0
+}
+
+// newBucket creates the token bucket for a single device, which starts full
+func (p *inboundPolicy) newBucket(now time.Time) *inboundBucket {
+	if p.rate <= 0 {
+		return nil
+	}
+
+	return &inboundBucket{tokens: p.burst, last: now}
+}
+
+// check applies this policy to a message received from a device, returning the violated policy's
+// reason along with the corresponding error.  A nil error indicates that the message is acceptable.
+// The bucket may be nil, in which case no rate limit is enforced.
+func (p *inboundPolicy) check(message *wrp.Message, bucket *inboundBucket, now time.Time) (string, error) {
+	if p.allowedTypes != nil && !p.allowedTypes[message.Type] {
+		return PolicyMessageType, ErrorMessageTypeNotAllowed
+	}
+
+	if p.maxPayloadSize > 0 && len(message.Payload) > p.maxPayloadSize {
+		return PolicyPayloadTooLarge, ErrorPayloadTooLarge
+	}
+
+	if bucket != nil && !bucket.take(p.rate, p.burst, now) {
+		return PolicyRateExceeded, ErrorInboundRateExceeded
+	}
+
+	return "", nil
+}
+
+// inboundBucket is the token bucket for a single device's inbound messages.  Only the device's read pump
+// uses its bucket, so no locking is necessary.
+type inboundBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take attempts to remove a token from this bucket, returning true if a token was available
+func (b *inboundBucket) take(rate, burst float64, now time.Time) bool {
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+
+	return false
+}
+
+// policyViolationStatus returns the WRP status sent to a device for a request that violated a policy
+func policyViolationStatus(reason string) int64 {
+	switch reason {
+	case PolicyPayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case PolicyRateExceeded:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// expectsResponse tests if a message received from a device is a request that the device expects an answer to
+func expectsResponse(message *wrp.Message) bool {
+	if len(message.TransactionUUID) == 0 {
+		return false
+	}
+
+	switch message.Type {
+	case wrp.SimpleRequestResponseMessageType,
+		wrp.CreateMessageType,
+		wrp.RetrieveMessageType,
+		wrp.UpdateMessageType,
+		wrp.DeleteMessageType:
+		return true
+	default:
+		return false
+	}
+}
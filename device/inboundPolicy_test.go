@@ -0,0 +1,238 @@
+package device
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInboundPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	p, unknownTypes := newInboundPolicy(nil)
+	assert.False(p.enabled())
+	assert.Empty(unknownTypes)
+	assert.Nil(p.newBucket(time.Now()))
+
+	p, unknownTypes = newInboundPolicy(&Options{
+		MaxPayloadSize:              100,
+		AllowedMessageTypes:         []string{"SimpleEvent", "SimpleRequestResponse", "Bogus"},
+		InboundRate:                 5,
+		DisconnectOnPolicyViolation: true,
+	})
+
+	assert.True(p.enabled())
+	assert.Equal([]string{"Bogus"}, unknownTypes)
+	assert.Equal(100, p.maxPayloadSize)
+	assert.Equal(map[wrp.MessageType]bool{wrp.SimpleEventMessageType: true, wrp.SimpleRequestResponseMessageType: true}, p.allowedTypes)
+	assert.Equal(5.0, p.rate)
+	assert.Equal(float64(DefaultInboundBurst), p.burst)
+	assert.True(p.disconnect)
+	assert.NotNil(p.newBucket(time.Now()))
+}
+
+func TestInboundPolicyCheck(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		now    = time.Now()
+		p, _   = newInboundPolicy(&Options{
+			MaxPayloadSize:      4,
+			AllowedMessageTypes: []string{"SimpleEvent"},
+			InboundRate:         1,
+			InboundBurst:        2,
+		})
+
+		bucket = p.newBucket(now)
+	)
+
+	reason, err := p.check(&wrp.Message{Type: wrp.SimpleRequestResponseMessageType}, bucket, now)
+	assert.Equal(PolicyMessageType, reason)
+	assert.Equal(ErrorMessageTypeNotAllowed, err)
+
+	reason, err = p.check(&wrp.Message{Type: wrp.SimpleEventMessageType, Payload: []byte("too large")}, bucket, now)
+	assert.Equal(PolicyPayloadTooLarge, reason)
+	assert.Equal(ErrorPayloadTooLarge, err)
+
+	// rejected messages do not consume tokens
+	for repeat := 0; repeat < 2; repeat++ {
+		reason, err = p.check(&wrp.Message{Type: wrp.SimpleEventMessageType, Payload: []byte("ok")}, bucket, now)
+		assert.Empty(reason)
+		assert.NoError(err)
+	}
+
+	reason, err = p.check(&wrp.Message{Type: wrp.SimpleEventMessageType}, bucket, now)
+	assert.Equal(PolicyRateExceeded, reason)
+	assert.Equal(ErrorInboundRateExceeded, err)
+
+	// the bucket refills at the configured rate
+	now = now.Add(time.Second)
+	reason, err = p.check(&wrp.Message{Type: wrp.SimpleEventMessageType}, bucket, now)
+	assert.Empty(reason)
+	assert.NoError(err)
+
+	reason, err = p.check(&wrp.Message{Type: wrp.SimpleEventMessageType}, nil, now)
+	assert.Empty(reason)
+	assert.NoError(err)
+}
+
+func TestPolicyViolationStatus(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(http.StatusRequestEntityTooLarge), policyViolationStatus(PolicyPayloadTooLarge))
+	assert.Equal(int64(http.StatusTooManyRequests), policyViolationStatus(PolicyRateExceeded))
+	assert.Equal(int64(http.StatusBadRequest), policyViolationStatus(PolicyMessageType))
+}
+
+func TestExpectsResponse(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(expectsResponse(&wrp.Message{Type: wrp.SimpleRequestResponseMessageType, TransactionUUID: "123"}))
+	assert.True(expectsResponse(&wrp.Message{Type: wrp.RetrieveMessageType, TransactionUUID: "123"}))
+	assert.False(expectsResponse(&wrp.Message{Type: wrp.SimpleRequestResponseMessageType}))
+	assert.False(expectsResponse(&wrp.Message{Type: wrp.SimpleEventMessageType, TransactionUUID: "123"}))
+}
+
+// startPolicyTest connects a single device to a manager with the given options, returning the device's
+// connection along with channels that receive the messages dispatched to listeners and the disconnect error
+func startPolicyTest(t *testing.T, o *Options) (Connection, <-chan *wrp.Message, <-chan error, func()) {
+	var (
+		received     = make(chan *wrp.Message, 10)
+		disconnected = make(chan error, 1)
+	)
+
+	o.Logger = logging.TestLogger(t)
+	o.AuthDelay = time.Millisecond
+	o.Listeners = []Listener{
+		func(e *Event) {
+			switch e.Type {
+			case MessageReceived:
+				received <- e.Message.(*wrp.Message)
+			case Disconnect:
+				disconnected <- e.Error
+			}
+		},
+	}
+
+	_, server, connectURL := startWebsocketServer(o)
+	connection, _, err := NewDialer(o, nil).Dial(connectURL, "mac:112233445566", nil, nil)
+	if err != nil {
+		server.Close()
+		require.NoError(t, err)
+	}
+
+	// the auth status is always sent first
+	message, err := expectMessage(connection)
+	require.NoError(t, err)
+	require.Equal(t, wrp.AuthMessageType, message.Type)
+
+	return connection, received, disconnected, func() {
+		connection.Close()
+		server.Close()
+	}
+}
+
+func TestManagerInboundPolicyResponse(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		connection, received, _, shutdown = startPolicyTest(t, &Options{MaxPayloadSize: 4})
+	)
+
+	defer shutdown()
+
+	require.NoError(writeMessage(&wrp.Message{
+		Type:            wrp.SimpleRequestResponseMessageType,
+		Source:          "mac:112233445566",
+		Destination:     "dns:somewhere.com",
+		TransactionUUID: "policy-test",
+		Payload:         []byte("this payload is too large"),
+	}, connection))
+
+	response, err := expectMessage(connection)
+	require.NoError(err)
+	assert.Equal(wrp.SimpleRequestResponseMessageType, response.Type)
+	assert.Equal("policy-test", response.TransactionUUID)
+	assert.Equal("mac:112233445566", response.Destination)
+	if assert.NotNil(response.Status) {
+		assert.Equal(int64(http.StatusRequestEntityTooLarge), *response.Status)
+	}
+
+	// the device remains connected, and acceptable messages are still processed
+	require.NoError(writeMessage(&wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566",
+		Destination: "event:test",
+		Payload:     []byte("ok"),
+	}, connection))
+
+	select {
+	case message := <-received:
+		assert.Equal("event:test", message.Destination)
+	case <-time.After(5 * time.Second):
+		assert.Fail("The acceptable message was not dispatched")
+	}
+
+	assert.Empty(received)
+}
+
+func TestManagerInboundPolicyDisconnect(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		connection, received, disconnected, shutdown = startPolicyTest(t, &Options{
+			AllowedMessageTypes:         []string{"SimpleEvent"},
+			DisconnectOnPolicyViolation: true,
+		})
+	)
+
+	defer shutdown()
+
+	require.NoError(writeMessage(&wrp.Message{
+		Type:            wrp.SimpleRequestResponseMessageType,
+		Source:          "mac:112233445566",
+		Destination:     "dns:somewhere.com",
+		TransactionUUID: "policy-test",
+	}, connection))
+
+	select {
+	case err := <-disconnected:
+		assert.Equal(ErrorMessageTypeNotAllowed, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail("The device was not disconnected")
+	}
+
+	assert.Empty(received)
+}
+
+func TestManagerMaxMessageSize(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		connection, received, disconnected, shutdown = startPolicyTest(t, &Options{MaxMessageSize: 128})
+	)
+
+	defer shutdown()
+
+	require.NoError(writeMessage(&wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566",
+		Destination: "event:test",
+		Payload:     []byte(strings.Repeat("x", 1024)),
+	}, connection))
+
+	select {
+	case err := <-disconnected:
+		assert.Equal(ErrorMessageTooLarge, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail("The device was not disconnected")
+	}
+
+	assert.Empty(received)
+}
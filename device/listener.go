@@ -1,6 +1,8 @@
 package device
 
 import (
+	"context"
+
 	"github.com/Comcast/webpa-common/wrp"
 )
 
@@ -103,10 +105,27 @@ type Event struct {
 	// Error is the error which occurred during an attempt to send a message.  This field is only populated
 	// for MessageFailed events when there was an actual error.  For MessageFailed events that indicate a
 	// device was disconnected with enqueued messages, this field will be nil.
+	//
+	// For Disconnect events, this field holds the error, if any, that caused the disconnection.  For example,
+	// a device which stops responding to protocol-level keepalives is disconnected with ErrorKeepaliveTimeout.
 	Error error
 
 	// Data is the pong data associated with this event.  This field is only set for a Pong event.
 	Data string
+
+	// ctx is the dispatch context for this event, which can be nil
+	ctx context.Context
+}
+
+// Context returns the context under which this event is being dispatched.  When a Manager is configured
+// with a DispatchTimeout, this context is cancelled once that timeout elapses, and listeners which call
+// downstream services should abandon their work at that point.  This method never returns nil.
+func (e *Event) Context() context.Context {
+	if e.ctx != nil {
+		return e.ctx
+	}
+
+	return context.Background()
 }
 
 // Clear resets all fields in this Event.  This is most often in preparation to reuse the Event instance.
@@ -118,6 +137,7 @@ func (e *Event) Clear() {
 	e.Contents = nil
 	e.Error = nil
 	e.Data = emptyString
+	e.ctx = nil
 }
 
 // SetRequestFailed is a convenience for setting an Event appropriate for a message failure
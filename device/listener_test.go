@@ -1,6 +1,7 @@
 package device
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -45,6 +46,24 @@ func testEventClear(t *testing.T, event Event) {
 	assert.Nil(event.Contents)
 	assert.Nil(event.Error)
 	assert.Empty(event.Data)
+	assert.Equal(context.Background(), event.Context())
+}
+
+func testEventContext(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		ctx, cancel = context.WithCancel(context.Background())
+		event       Event
+	)
+
+	defer cancel()
+	assert.Equal(context.Background(), event.Context())
+
+	event.ctx = ctx
+	assert.Equal(ctx, event.Context())
+
+	event.Clear()
+	assert.Equal(context.Background(), event.Context())
 }
 
 func TestEvent(t *testing.T) {
@@ -52,6 +71,10 @@ func TestEvent(t *testing.T) {
 		testEventString(t)
 	})
 
+	t.Run("Context", func(t *testing.T) {
+		testEventContext(t)
+	})
+
 	var (
 		device = new(mockDevice)
 		events = []Event{
@@ -88,6 +111,11 @@ func TestEvent(t *testing.T) {
 				Device: device,
 				Data:   "some pong data",
 			},
+			Event{
+				Type:   MessageReceived,
+				Device: device,
+				ctx:    context.WithValue(context.Background(), "key", "value"),
+			},
 		}
 	)
 
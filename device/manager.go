@@ -2,14 +2,18 @@ package device
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Comcast/webpa-common/httperror"
 	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/tracing"
 	"github.com/Comcast/webpa-common/wrp"
 )
 
@@ -25,8 +29,14 @@ var (
 		),
 		Format: wrp.Msgpack,
 	}
+
+	// keepaliveContents is the encoded WRP message sent to devices as a protocol-level keepalive
+	keepaliveContents = wrp.MustEncode(&wrp.ServiceAlive{}, wrp.Msgpack)
 )
 
+// drainPollInterval is how often Drain checks for the closure of device connections
+const drainPollInterval = 100 * time.Millisecond
+
 // Connector is a strategy interface for managing device connections to a server.
 // Implementations are responsible for upgrading websocket connections and providing
 // for explicit disconnection.
@@ -57,6 +67,11 @@ type Connector interface {
 	// No methods on this Manager should be called from within the predicate function, or
 	// a deadlock will likely occur.
 	DisconnectIf(func(ID) bool) int
+
+	// Drain disconnects every device and waits until all of their connections have closed.
+	// Devices which connect while draining are disconnected as well.  If the context is done first, its error is returned.
+	// This method is intended for graceful shutdown, and satisfies server.Drainer.
+	Drain(context.Context) error
 }
 
 // Router handles dispatching messages to devices.
@@ -67,6 +82,17 @@ type Router interface {
 	Route(*Request) (*Response, error)
 }
 
+// ContextRouter is an optional interface for Routers which can bound routing with a context other than the
+// Request's.  The Router returned by NewManager implements this interface.
+type ContextRouter interface {
+	// RouteContext is like Route, but additionally bounds the routing with the given context.  Routing stops
+	// when either the given context or the Request's context is done, and governs both waiting for space in
+	// the device's queue and waiting for the device's response to a transaction.  The error of whichever
+	// context is done first is returned as is, e.g. context.DeadlineExceeded, so that callers can distinguish
+	// timeouts from routing errors.  The Request is not modified.
+	RouteContext(context.Context, *Request) (*Response, error)
+}
+
 // Registry is the strategy interface for querying the set of connected devices.  Methods
 // in this interface follow the Visitor pattern and are typically executed under a read lock.
 type Registry interface {
@@ -84,6 +110,25 @@ type Registry interface {
 	// No methods on this Manager should be called from within the visitor function, or
 	// a deadlock will likely occur.
 	VisitAll(func(Interface)) int
+
+	// VisitConcurrently applies the given visitor to each device known to this manager, using up to
+	// the given number of goroutines.  If parallelism is nonpositive, one goroutine per CPU is used.
+	// This method returns the number of devices visited.
+	//
+	// The registry is partitioned into shards which are visited in parallel, and no lock is held while
+	// visiting.  The visitor must therefore be safe for concurrent use, and it may see devices that have
+	// since disconnected.  Unlike the other visitation methods, the visitor may call methods on this Manager.
+	VisitConcurrently(int, func(Interface)) int
+
+	// VisitConcurrentlyContext is like VisitConcurrently, but stops visiting devices once the context
+	// is cancelled.  The number of devices visited is returned along with the context's error, if any.
+	VisitConcurrentlyContext(context.Context, int, func(Interface)) (int, error)
+
+	// DisconnectHistory returns the recent disconnections of devices with the given ID, most
+	// recent first.  Each record carries the reason for the disconnection, which is either
+	// DisconnectReasonRequested or the text of the error that closed the connection.  This method
+	// returns an empty slice if the ID has not disconnected recently or if history is disabled.
+	DisconnectHistory(ID) []DisconnectRecord
 }
 
 // Manager supplies a hub for connecting and disconnecting devices as well as
@@ -105,13 +150,61 @@ func NewManager(o *Options, cf ConnectionFactory) Manager {
 		logger: o.logger(),
 
 		connectionFactory:      cf,
+		idExtractor:            o.idExtractor(),
 		keyFunc:                o.keyFunc(),
+		connectAuthenticator:   o.connectAuthenticator(),
+		upgradeHook:            o.upgradeHook(),
 		registry:               newRegistry(o.initialCapacity()),
 		deviceMessageQueueSize: o.deviceMessageQueueSize(),
+		qosWeights:             o.qosWeights(),
+		eventHistorySize:       o.eventHistorySize(),
 		pingPeriod:             o.pingPeriod(),
 		authDelay:              o.authDelay(),
+		keepalivePeriod:        o.keepalivePeriod(),
+		keepaliveTimeout:       o.keepaliveTimeout(),
+		maxMessageSize:         o.maxMessageSize(),
+		clock:                  o.clock(),
+		gate:                   o.gate(),
+
+		listeners:               o.listeners(),
+		measures:                newMeasures(o.metricsProvider()),
+		dispatchTimeout:         o.dispatchTimeout(),
+		dispatchTimeoutResponse: o.dispatchTimeoutResponse(),
+	}
+
+	if size := o.disconnectHistorySize(); size > 0 {
+		m.disconnectHistory = newDisconnectHistory(size, o.disconnectHistoryTTL())
+	}
+
+	var unknownTypes []string
+	m.inboundPolicy, unknownTypes = newInboundPolicy(o)
+	for _, name := range unknownTypes {
+		m.logger.Error("Ignoring unknown allowed message type: %s", name)
+	}
+
+	if window := o.dedupeWindow(); window > 0 {
+		m.deduper = newDeduper(o.dedupeSize(), window, o.dedupeHashing())
+		m.deduper.now = m.clock.Now
+	}
+
+	if sink := o.mirrorSink(); sink != nil {
+		m.mirror = newMirror(m.logger, sink, o.mirrorPercentage(), o.mirrorMaxPending(), m.measures.mirror)
+	}
 
-		listeners: o.listeners(),
+	if o.forwardTTL() > 0 {
+		if fb, err := newForwardBuffer(o, m.logger, m.clock, m.measures); err != nil {
+			m.logger.Error("Unable to create store-and-forward buffer: %s", err)
+		} else {
+			m.forward = fb
+		}
+	}
+
+	if o.profileLabels() {
+		m.profileBuckets = o.profileBuckets()
+		m.profilePartners = make(map[string]bool)
+		for _, partner := range o.profilePartners() {
+			m.profilePartners[partner] = true
+		}
 	}
 
 	return m
@@ -124,17 +217,106 @@ type manager struct {
 	connectionFactory ConnectionFactory
 	keyFunc           KeyFunc
 
+	// idExtractor derives device IDs from connection requests.  If nil, the ID must be in the request Context.
+	idExtractor IDExtractor
+
+	// connectAuthenticator decides whether devices may connect.  If nil, all devices are allowed.
+	connectAuthenticator ConnectAuthenticator
+
+	// upgradeHook customizes each websocket upgrade response.  If nil, the response headers are used as is.
+	upgradeHook UpgradeHook
+
 	registry *registry
 
 	deviceMessageQueueSize int
+	qosWeights             qosWeights
 	pingPeriod             time.Duration
 	authDelay              time.Duration
 
+	// keepalivePeriod is the interval between protocol-level keepalives.  If zero,
+	// no keepalives are sent and keepaliveTimeout is not enforced.
+	keepalivePeriod  time.Duration
+	keepaliveTimeout time.Duration
+
+	// profileBuckets is the number of device ID hash buckets used in pprof labels.
+	// If zero, pumps are not labeled.
+	profileBuckets int
+
+	// profilePartners is the set of partners which are labeled by name in pprof labels
+	profilePartners map[string]bool
+
+	// disconnectHistory remembers recent disconnections.  If nil, history is disabled.
+	disconnectHistory *disconnectHistory
+
+	// eventHistorySize is the number of events remembered for each device.  If zero, event history is disabled.
+	eventHistorySize int
+
+	// maxMessageSize is the largest frame accepted from a device.  If zero, frames are not limited.
+	maxMessageSize int
+
+	// inboundPolicy limits the messages accepted from devices
+	inboundPolicy inboundPolicy
+
+	// deduper drops inbound messages that were recently received.  If nil, messages are not deduplicated.
+	deduper *deduper
+
+	// mirror copies a sample of inbound messages to a MirrorSink.  If nil, messages are not mirrored.
+	mirror *mirror
+
 	listeners []Listener
+	measures  measures
+
+	// dispatchTimeout is the time listeners have to handle each event.  If zero, listeners are invoked with no deadline.
+	dispatchTimeout time.Duration
+
+	// dispatchTimeoutResponse indicates whether device requests that time out during dispatch are answered with an error
+	dispatchTimeoutResponse bool
+
+	// clock drives all of this manager's timing
+	clock Clock
+
+	// gate, if non-nil, controls the admission of new connections
+	gate *Gate
+
+	// forward, if non-nil, retains messages routed to devices which are not connected
+	forward *forwardBuffer
+
+	// active is the number of connections whose pumps have not yet closed
+	active int32
 }
 
 func (m *manager) Connect(response http.ResponseWriter, request *http.Request, responseHeader http.Header) (Interface, error) {
 	m.logger.Debug("Connect(%s, %v)", request.URL, request.Header)
+	started := m.clock.Now()
+	m.connectStage(ConnectStageStarted, started)
+
+	if m.gate != nil && !m.gate.IsOpen() {
+		m.measures.gateRejects.Add(1)
+		httperror.Format(
+			response,
+			m.gate.RejectStatus(),
+			ErrorGateClosed,
+		)
+
+		return nil, ErrorGateClosed
+	}
+
+	if m.idExtractor != nil {
+		id, err := m.idExtractor.ExtractID(request)
+		if err != nil {
+			idError := fmt.Errorf("Could not extract device id: %s", err)
+			httperror.Format(
+				response,
+				http.StatusBadRequest,
+				idError,
+			)
+
+			return nil, idError
+		}
+
+		request = WithIDRequest(id, request)
+	}
+
 	id, ok := GetID(request.Context())
 	if !ok {
 		httperror.Format(
@@ -146,6 +328,8 @@ func (m *manager) Connect(response http.ResponseWriter, request *http.Request, r
 		return nil, ErrorMissingDeviceNameContext
 	}
 
+	m.connectStage(ConnectStageAuthenticated, started)
+
 	var (
 		encodedConvey = request.Header.Get(ConveyHeader)
 		convey        Convey
@@ -166,6 +350,43 @@ func (m *manager) Connect(response http.ResponseWriter, request *http.Request, r
 		}
 	}
 
+	m.connectStage(ConnectStageConveyParsed, started)
+
+	var attributes map[string]interface{}
+	if m.connectAuthenticator != nil {
+		authentication, err := m.connectAuthenticator.AuthenticateConnect(id, convey, request)
+		if err != nil {
+			authError := fmt.Errorf("Unable to authenticate device [%s]: %s", id, err)
+			httperror.Format(
+				response,
+				http.StatusServiceUnavailable,
+				authError,
+			)
+
+			return nil, authError
+		}
+
+		if !authentication.Allow {
+			reason := authentication.Reason
+			if len(reason) == 0 {
+				reason = ErrorConnectDenied.Error()
+			}
+
+			m.logger.Debug("Device [%s] denied: %s", id, reason)
+			httperror.Format(
+				response,
+				authentication.statusCode(),
+				reason,
+			)
+
+			return nil, ErrorConnectDenied
+		}
+
+		attributes = authentication.Attributes
+	}
+
+	m.connectStage(ConnectStageAuthorized, started)
+
 	var initialKey Key
 	if initialKey, err = m.keyFunc(id, convey, request); err != nil {
 		keyError := fmt.Errorf("Unable to obtain key for device [%s]: %s", id, err)
@@ -178,24 +399,163 @@ func (m *manager) Connect(response http.ResponseWriter, request *http.Request, r
 		return nil, keyError
 	}
 
+	if m.upgradeHook != nil {
+		responseHeader = copyHeader(responseHeader)
+		m.upgradeHook.BeforeUpgrade(id, convey, request, responseHeader)
+	}
+
 	c, err := m.connectionFactory.NewConnection(response, request, responseHeader)
 	if err != nil {
 		return nil, err
 	}
 
-	d := newDevice(id, initialKey, convey, encodedConvey, m.deviceMessageQueueSize)
+	d := newDevice(id, initialKey, convey, encodedConvey, m.deviceMessageQueueSize, m.qosWeights)
+	d.connection = c
+	d.now = m.clock.Now
+	d.partner = partnerID(attributes)
+	d.attributes = attributes
+	d.touch(m.clock.Now())
+
+	// register the control frame callbacks before the pumps start, so that no frames are missed
+	c.SetPongCallback(m.pongCallbackFor(d))
+	c.SetControlCallback(d.controlFrame)
+
+	if m.eventHistorySize > 0 {
+		d.history = newEventHistory(m.eventHistorySize)
+	}
+
 	closeOnce := new(sync.Once)
-	go m.readPump(d, c, closeOnce)
-	go m.writePump(d, c, closeOnce)
-	m.registry.add(d)
+
+	var labels []string
+	if m.profileBuckets > 0 {
+		labels = profileLabels(id, d.partner, m.profileBuckets, m.profilePartners)
+	}
+
+	// count the device before starting the pumps, since a pump which fails immediately decrements the count
+	atomic.AddInt32(&m.active, 1)
+	goLabeled(labels, "read", func() { m.readPump(d, c, closeOnce, started) })
+	goLabeled(labels, "write", func() { m.writePump(d, c, closeOnce) })
+	if m.forward != nil {
+		m.forward.flush(d, func() { m.registry.add(d) })
+	} else {
+		m.registry.add(d)
+	}
+
+	m.measures.connect.Add(1)
+	m.measures.connections.Add(1)
+	m.connectStage(ConnectStageRegistered, started)
 
 	return d, nil
 }
 
+// connectStage records that a connection attempt which began at the given time has reached a stage of the connect funnel
+func (m *manager) connectStage(stage string, started time.Time) {
+	m.measures.connectStage.With(StageLabel, stage).Add(1)
+	if stage != ConnectStageStarted {
+		m.measures.connectStageLatency.With(StageLabel, stage).Observe(m.clock.Now().Sub(started).Seconds())
+	}
+}
+
 func (m *manager) dispatch(e *Event) {
+	if d, ok := e.Device.(*device); ok && d.history != nil {
+		d.history.add(newHistoryRecord(m.clock.Now().UTC(), e))
+	}
+
+	if m.dispatchTimeout > 0 && len(m.listeners) > 0 {
+		m.dispatchWithTimeout(e)
+		return
+	}
+
+	for _, listener := range m.listeners {
+		listener(e)
+	}
+}
+
+// dispatchWithTimeout invokes the listeners in order on the calling goroutine, under a context which is cancelled
+// once the dispatch timeout elapses.  Listeners are expected to honor that context.  Once it is cancelled, any
+// remaining listeners are skipped, so that each event costs the pump at most the timeout plus the time the
+// current listener takes to notice the cancellation.
+func (m *manager) dispatchWithTimeout(e *Event) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		timer       = m.clock.AfterFunc(m.dispatchTimeout, cancel)
+	)
+
+	defer timer.Stop()
+	defer cancel()
+	e.ctx = ctx
+	defer func() { e.ctx = nil }()
+
 	for _, listener := range m.listeners {
 		listener(e)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		m.measures.dispatchTimeouts.Add(1)
+		m.logger.Error("Listeners did not handle %s event for device [%s] within %s", e.Type, e.Device.ID(), m.dispatchTimeout)
+		if m.dispatchTimeoutResponse {
+			m.respondDispatchTimeout(e)
+		}
+	}
+}
+
+// respondDispatchTimeout answers a request received from a device with a 504 status, to tell the device
+// that its request was not handled in time.  Events that do not carry such a request are ignored.
+func (m *manager) respondDispatchTimeout(e *Event) {
+	d, ok := e.Device.(*device)
+	if !ok {
+		return
+	}
+
+	request, ok := e.Message.(*wrp.Message)
+	if !ok || request.Type != wrp.SimpleRequestResponseMessageType || len(request.TransactionUUID) == 0 {
+		return
+	}
+
+	m.respondStatus(d, request, http.StatusGatewayTimeout)
+}
+
+// respondStatus answers a request received from a device with a response carrying only a status
+func (m *manager) respondStatus(d *device, request *wrp.Message, status int64) {
+	response := &wrp.Message{
+		Type:            request.Type,
+		Source:          request.Destination,
+		Destination:     request.Source,
+		TransactionUUID: request.TransactionUUID,
+	}
+
+	response.SetStatus(status)
+
+	// the response is enqueued directly, rather than via Send, since this is not a new transaction.
+	// the pump which received the request never waits, so the response is dropped if the device's queue is full.
+	if err := d.trySendRequest(&Request{Message: response, Format: wrp.Msgpack}); err != nil {
+		m.logger.Error("Unable to send %d response to device [%s]: %s", status, d.id, err)
+	}
+}
+
+// enforceInboundPolicy checks a message received from a device against the inbound policy.  Messages that
+// violate the policy are answered with a 4xx status, if the device expects a response.  This method returns
+// true if the message may be processed.  If the device must be disconnected, the violation is returned.
+func (m *manager) enforceInboundPolicy(d *device, message *wrp.Message, bucket *inboundBucket) (bool, error) {
+	reason, violation := m.inboundPolicy.check(message, bucket, m.clock.Now())
+	if violation == nil {
+		return true, nil
+	}
+
+	m.measures.policyViolations.With(PolicyReasonLabel, reason).Add(1)
+	m.logger.Error("Device [%s] sent %s message that violates the inbound policy: %s", d.id, message.Type, violation)
+	if m.inboundPolicy.disconnect {
+		return false, violation
+	}
+
+	if expectsResponse(message) {
+		m.respondStatus(d, message, policyViolationStatus(reason))
 	}
+
+	return false, nil
 }
 
 // pumpClose handles the proper shutdown and logging of a device's pumps.
@@ -220,10 +580,31 @@ func (m *manager) pumpClose(d *device, c Connection, pumpError error) {
 		m.logger.Error("Error closing connection for device [%s]: %s", d.id, closeError)
 	}
 
+	m.measures.disconnect.Add(1)
+	m.measures.connections.Add(-1)
+	defer atomic.AddInt32(&m.active, -1)
+
+	if m.disconnectHistory != nil {
+		// a pump only exits without an error when the device was closed via the manager
+		reason := DisconnectReasonRequested
+		if pumpError != nil {
+			reason = pumpError.Error()
+		}
+
+		m.disconnectHistory.add(DisconnectRecord{
+			ID:          d.id,
+			Key:         d.Key(),
+			ConnectedAt: d.statistics.ConnectedAt(),
+			Time:        m.clock.Now().UTC(),
+			Reason:      reason,
+		})
+	}
+
 	m.dispatch(
 		&Event{
 			Type:   Disconnect,
 			Device: d,
+			Error:  pumpError,
 		},
 	)
 }
@@ -235,6 +616,8 @@ func (m *manager) pongCallbackFor(d *device) func(string) {
 	event := new(Event)
 
 	return func(data string) {
+		d.controlFrame(PongFrame, []byte(data))
+
 		event.Clear()
 		event.Type = Pong
 		event.Device = d
@@ -244,21 +627,23 @@ func (m *manager) pongCallbackFor(d *device) func(string) {
 }
 
 // readPump is the goroutine which handles the stream of WRP messages from a device.
-// This goroutine exits when any error occurs on the connection.
-func (m *manager) readPump(d *device, c Connection, closeOnce *sync.Once) {
+// This goroutine exits when any error occurs on the connection.  The started time is when
+// the device's connection attempt began, and is used to measure the connect funnel.
+func (m *manager) readPump(d *device, c Connection, closeOnce *sync.Once, started time.Time) {
 	m.logger.Debug("readPump(%s)", d.id)
 
 	var (
-		frameRead bool
-		readError error
-		event     Event // reuse the same event as a carrier of data to listeners
-		decoder   = wrp.NewDecoder(nil, wrp.Msgpack)
+		frameRead   bool
+		messageSeen bool
+		readError   error
+		event       Event // reuse the same event as a carrier of data to listeners
+		decoder     = wrp.NewDecoder(nil, wrp.Msgpack)
+		bucket      = m.inboundPolicy.newBucket(m.clock.Now())
 	)
 
 	// all the read pump has to do is ensure the device and the connection are closed
 	// it is the write pump's responsibility to do further cleanup
 	defer closeOnce.Do(func() { m.pumpClose(d, c, readError) })
-	c.SetPongCallback(m.pongCallbackFor(d))
 
 	for {
 		var frameBuffer bytes.Buffer
@@ -275,7 +660,14 @@ func (m *manager) readPump(d *device, c Connection, closeOnce *sync.Once) {
 			rawFrame = frameBuffer.Bytes()
 		)
 
+		d.touch(m.clock.Now())
 		d.statistics.AddBytesReceived(uint32(len(rawFrame)))
+		if m.maxMessageSize > 0 && len(rawFrame) > m.maxMessageSize {
+			// connections created by other ConnectionFactory implementations may not enforce the limit
+			readError = ErrorMessageTooLarge
+			return
+		}
+
 		decoder.ResetBytes(rawFrame)
 		if decodeError := decoder.Decode(message); decodeError != nil {
 			// malformed WRP messages are allowed: the read pump will keep on chugging
@@ -283,7 +675,41 @@ func (m *manager) readPump(d *device, c Connection, closeOnce *sync.Once) {
 			continue
 		}
 
+		if !messageSeen {
+			messageSeen = true
+			m.connectStage(ConnectStageFirstMessage, started)
+		}
+
 		d.statistics.AddMessagesReceived(1)
+		if m.inboundPolicy.enabled() {
+			var accepted bool
+			if accepted, readError = m.enforceInboundPolicy(d, message, bucket); readError != nil {
+				return
+			} else if !accepted {
+				continue
+			}
+		}
+
+		// the device's partner is authoritative, regardless of what the device put in the message
+		if stamped, stampError := stampPartner(d, message, rawFrame); stampError != nil {
+			m.logger.Error("Skipping frame from device [%s] which could not be stamped with its partner: %s", d.id, stampError)
+			continue
+		} else {
+			rawFrame = stamped
+		}
+
+		if m.deduper != nil {
+			if id := m.deduper.id(message); m.deduper.duplicate(d.id, id) {
+				m.logger.Debug("Dropping duplicate message [%s] from device [%s]", id, d.id)
+				m.measures.duplicates.Add(1)
+				continue
+			}
+		}
+
+		if m.mirror != nil {
+			m.mirror.mirror(d, message, rawFrame)
+		}
+
 		event.SetMessageReceived(d, message, wrp.Msgpack, rawFrame)
 
 		// update any waiting transaction
@@ -326,9 +752,21 @@ func (m *manager) writePump(d *device, c Connection, closeOnce *sync.Once) {
 		encoder     = wrp.NewEncoder(nil, wrp.Msgpack)
 		writeError  error
 		pingMessage = []byte(fmt.Sprintf("ping[%s]", d.id))
-		pingTicker  = time.NewTicker(m.pingPeriod)
+		pingTicker  = m.clock.NewTicker(m.pingPeriod)
+
+		// the keepalive channel is nil when protocol-level keepalives are disabled,
+		// which means that its select case never fires
+		keepalive       <-chan time.Time
+		lastActivity    = m.clock.Now()
+		lastMessageSeen uint32
 	)
 
+	if m.keepalivePeriod > 0 {
+		keepaliveTicker := m.clock.NewTicker(m.keepalivePeriod)
+		defer keepaliveTicker.Stop()
+		keepalive = keepaliveTicker.C()
+	}
+
 	m.dispatch(&event)
 
 	// cleanup: we not only ensure that the device and connection are closed but also
@@ -346,23 +784,18 @@ func (m *manager) writePump(d *device, c Connection, closeOnce *sync.Once) {
 		}
 
 		// drain the messages, dispatching them as message failed events.  we never close
-		// the message channel, so just drain until a receive would block.
+		// the message queues, so just drain until a receive would block.
 		//
 		// Nil is passed explicitly as the error to indicate that these messages failed due
 		// to the device disconnecting, not due to an actual I/O error.
-		for {
-			select {
-			case undeliverable := <-d.messages:
-				event.SetRequestFailed(d, undeliverable.request, writeError)
-				m.dispatch(&event)
-			default:
-				break
-			}
-		}
+		d.messages.drain(func(undeliverable *Request) {
+			event.SetRequestFailed(d, undeliverable, writeError)
+			m.dispatch(&event)
+		})
 	}()
 
 	// wait for the delay, then send an auth status request to the device
-	time.AfterFunc(m.authDelay, func() {
+	m.clock.AfterFunc(m.authDelay, func() {
 		// TODO: This will keep the device from being garbage collected until the timer
 		// triggers.  This is only a problem if a device connects then disconnects faster
 		// than the authDelay setting.
@@ -374,10 +807,20 @@ func (m *manager) writePump(d *device, c Connection, closeOnce *sync.Once) {
 
 		select {
 		case <-d.shutdown:
-			writeError = c.SendClose()
+			if payload, ok := d.closePayload.Load().([]byte); ok {
+				writeError = c.SendControl(CloseFrame, payload)
+			} else {
+				writeError = c.SendClose()
+			}
+
 			return
 
-		case envelope = <-d.messages:
+		case <-d.messages.ready():
+			if envelope = d.messages.next(); envelope == nil {
+				// another message's notification, which has already been serviced
+				continue
+			}
+
 			if frame, writeError = c.NextWriter(); writeError == nil {
 				var frameContents []byte
 				if envelope.request.Format == wrp.Msgpack && len(envelope.request.Contents) > 0 {
@@ -394,6 +837,7 @@ func (m *manager) writePump(d *device, c Connection, closeOnce *sync.Once) {
 					if bytesSent, writeError = frame.Write(frameContents); writeError == nil {
 						d.statistics.AddBytesSent(uint32(bytesSent))
 						d.statistics.AddMessagesSent(1)
+						m.measures.messageLatency.Observe(m.clock.Now().Sub(envelope.enqueued).Seconds())
 						writeError = frame.Close()
 					} else {
 						// don't mask the original error, but ensure the frame is closed
@@ -412,12 +856,43 @@ func (m *manager) writePump(d *device, c Connection, closeOnce *sync.Once) {
 			close(envelope.complete)
 			m.dispatch(&event)
 
-		case <-pingTicker.C:
+		case <-pingTicker.C():
 			writeError = c.Ping(pingMessage)
+
+		case now := <-keepalive:
+			// any message from the device counts as a response to our keepalives
+			if messagesReceived := d.statistics.MessagesReceived(); messagesReceived != lastMessageSeen {
+				lastMessageSeen = messagesReceived
+				lastActivity = now
+			} else if now.Sub(lastActivity) > m.keepaliveTimeout {
+				writeError = ErrorKeepaliveTimeout
+				return
+			}
+
+			writeError = m.sendKeepalive(d, c)
 		}
 	}
 }
 
+// sendKeepalive writes a protocol-level keepalive message to a device's connection
+func (m *manager) sendKeepalive(d *device, c Connection) error {
+	frame, err := c.NextWriter()
+	if err != nil {
+		return err
+	}
+
+	bytesSent, err := frame.Write(keepaliveContents)
+	if err != nil {
+		// don't mask the original error, but ensure the frame is closed
+		frame.Close()
+		return err
+	}
+
+	d.statistics.AddBytesSent(uint32(bytesSent))
+	d.statistics.AddMessagesSent(1)
+	return frame.Close()
+}
+
 // wrapVisitor produces an internal visitor that wraps a delegate
 // and preserves encapsulation
 func (m *manager) wrapVisitor(delegate func(Interface)) func(*device) {
@@ -451,6 +926,31 @@ func (m *manager) DisconnectIf(filter func(ID) bool) int {
 	})
 }
 
+func (m *manager) Drain(ctx context.Context) error {
+	ticker := m.clock.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if count := m.DisconnectIf(func(ID) bool { return true }); count > 0 {
+			m.logger.Info("Disconnected %d device(s) while draining", count)
+		}
+
+		if atomic.LoadInt32(&m.active) <= 0 {
+			if m.forward != nil {
+				m.forward.close()
+			}
+
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+		}
+	}
+}
+
 func (m *manager) Statistics(id ID) (result Statistics, err error) {
 	count := m.registry.visitID(id, func(d *device) {
 		result = d.Statistics()
@@ -473,12 +973,186 @@ func (m *manager) VisitAll(visitor func(Interface)) int {
 	return m.registry.visitAll(m.wrapVisitor(visitor))
 }
 
+// shardsPerWorker is the number of registry shards created for each visiting goroutine.  Using more shards
+// than goroutines keeps all the goroutines busy when devices are unevenly distributed among the shards.
+const shardsPerWorker = 4
+
+func (m *manager) VisitConcurrently(parallelism int, visitor func(Interface)) int {
+	count, _ := m.VisitConcurrentlyContext(context.Background(), parallelism, visitor)
+	return count
+}
+
+func (m *manager) VisitConcurrentlyContext(ctx context.Context, parallelism int, visitor func(Interface)) (int, error) {
+	if parallelism < 1 {
+		parallelism = runtime.NumCPU()
+	}
+
+	var (
+		shards    = make(chan []*device, parallelism*shardsPerWorker)
+		count     int64
+		waitGroup sync.WaitGroup
+	)
+
+	for _, shard := range m.registry.shards(parallelism * shardsPerWorker) {
+		if len(shard) > 0 {
+			shards <- shard
+		}
+	}
+
+	close(shards)
+	waitGroup.Add(parallelism)
+	for worker := 0; worker < parallelism; worker++ {
+		go func() {
+			defer waitGroup.Done()
+			for shard := range shards {
+				for _, d := range shard {
+					if ctx.Err() != nil {
+						return
+					}
+
+					visitor(d)
+					atomic.AddInt64(&count, 1)
+				}
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+	return int(count), ctx.Err()
+}
+
+func (m *manager) DisconnectHistory(id ID) []DisconnectRecord {
+	if m.disconnectHistory == nil {
+		return []DisconnectRecord{}
+	}
+
+	records := m.disconnectHistory.get(id)
+	if records == nil {
+		records = []DisconnectRecord{}
+	}
+
+	return records
+}
+
 func (m *manager) Route(request *Request) (*Response, error) {
-	if destination, err := request.ID(); err != nil {
+	return m.RouteContext(request.Context(), request)
+}
+
+func (m *manager) RouteContext(ctx context.Context, request *Request) (response *Response, err error) {
+	ctx, cancel := joinContext(ctx, request.Context())
+	defer cancel()
+
+	request, span := startRouteSpan(ctx, request)
+	defer func() {
+		span.SetError(err)
+		span.Finish()
+	}()
+
+	// a request whose context is already done is never routed, nor retained for a disconnected device
+	if err := ctx.Err(); err != nil {
 		return nil, err
-	} else if d, err := m.registry.getOne(destination); err != nil {
+	}
+
+	if destination, err := request.ID(); err != nil {
 		return nil, err
 	} else {
+		d, err := m.registry.getOne(destination)
+		if err == ErrorDeviceNotFound && m.forward != nil && len(request.TransactionKey()) == 0 {
+			d, err = m.forward.bufferMissing(destination, request, m.registry.getOne)
+		}
+
+		if err == ErrorDeviceForwarded {
+			span.SetTag("device.forwarded", true)
+			return nil, err
+		} else if err != nil {
+			return nil, err
+		}
+
+		span.SetTag("device.id", string(destination))
 		return d.Send(request)
 	}
 }
+
+// startRouteSpan begins the "device.route" span for a request, which is a child of the trace context in the
+// given context or, failing that, in the metadata of the request's message.  The returned Request is a copy
+// whose Context is the given context along with the span, so the caller's Request is never modified.  When the
+// message is a *wrp.Message, the span's context is written into the metadata of a copy of that message, so that
+// the device and any responses continue the trace.  In that case, the copied message is encoded again before
+// being sent to the device.
+func startRouteSpan(ctx context.Context, request *Request) (*Request, tracing.Span) {
+	message, _ := request.Message.(*wrp.Message)
+	span, ctx := tracing.StartSpan(tracing.MessageContext(ctx, message), "device.route")
+
+	routed := *request
+	routed.ctx = ctx
+	if message != nil {
+		traced := *message
+		traced.Metadata = make(map[string]string, len(message.Metadata)+1)
+		for k, v := range message.Metadata {
+			traced.Metadata[k] = v
+		}
+
+		if tracing.InjectMessage(span.Context(), &traced) {
+			routed.Message = &traced
+			routed.Contents = nil
+		}
+	}
+
+	return &routed, span
+}
+
+// joinContext produces a context which is done as soon as either ctx or other is done.  The returned CancelFunc
+// must always be called to release the resources associated with the joined context.  If both contexts are the
+// same, or if other can never be done, ctx is returned as is.
+func joinContext(ctx, other context.Context) (context.Context, context.CancelFunc) {
+	if ctx == other || other.Done() == nil {
+		return ctx, func() {}
+	}
+
+	joined, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-other.Done():
+			cancel()
+		case <-joined.Done():
+		}
+	}()
+
+	return &joinedContext{Context: joined, other: other}, cancel
+}
+
+// joinedContext is the context produced by joinContext.  It reports the error and deadline of whichever of
+// the two contexts applies, and looks up values in both.
+type joinedContext struct {
+	context.Context
+	other context.Context
+}
+
+func (jc *joinedContext) Deadline() (time.Time, bool) {
+	deadline, ok := jc.Context.Deadline()
+	if otherDeadline, otherOk := jc.other.Deadline(); otherOk && (!ok || otherDeadline.Before(deadline)) {
+		return otherDeadline, true
+	}
+
+	return deadline, ok
+}
+
+func (jc *joinedContext) Err() error {
+	err := jc.Context.Err()
+	if err == context.Canceled {
+		// the cancellation may have come from the other context, whose own error is more informative
+		if otherErr := jc.other.Err(); otherErr != nil {
+			return otherErr
+		}
+	}
+
+	return err
+}
+
+func (jc *joinedContext) Value(key interface{}) interface{} {
+	if value := jc.Context.Value(key); value != nil {
+		return value
+	}
+
+	return jc.other.Value(key)
+}
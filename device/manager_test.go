@@ -1,19 +1,27 @@
 package device
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/tracing"
+	"github.com/Comcast/webpa-common/tracing/tracingtest"
 	"github.com/Comcast/webpa-common/wrp"
 	"github.com/justinas/alice"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -102,6 +110,58 @@ func testManagerConnectMissingDeviceContext(t *testing.T) {
 	assert.Equal(response.Code, http.StatusInternalServerError)
 }
 
+func testManagerConnectIDExtractorError(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		options = &Options{
+			Logger:      logging.TestLogger(t),
+			IDExtractor: HeaderIDExtractor(""),
+		}
+
+		manager  = NewManager(options, nil)
+		response = httptest.NewRecorder()
+		request  = WithIDRequest(ID("mac:112233445566"), httptest.NewRequest("POST", "http://localhost.com", nil))
+	)
+
+	device, err := manager.Connect(response, request, nil)
+	assert.Nil(device)
+	assert.Error(err)
+	assert.Equal(http.StatusBadRequest, response.Code)
+}
+
+func testManagerConnectIDExtractor(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		options = &Options{
+			Logger:      logging.TestLogger(t),
+			IDExtractor: IDExtractors{ConveyIDExtractor("hw-mac"), HeaderIDExtractor("")},
+		}
+
+		connectionFactory = new(mockConnectionFactory)
+		manager           = NewManager(options, connectionFactory)
+		response          = httptest.NewRecorder()
+		request           = httptest.NewRequest("POST", "http://localhost.com", nil)
+		expectedError     = errors.New("expected error")
+	)
+
+	request.Header.Set(DeviceNameHeader, "mac:112233445566")
+	connectionFactory.On(
+		"NewConnection",
+		response,
+		mock.MatchedBy(func(r *http.Request) bool {
+			id, ok := GetID(r.Context())
+			return ok && id == ID("mac:112233445566")
+		}),
+		http.Header(nil),
+	).Once().Return(nil, expectedError)
+
+	device, actualError := manager.Connect(response, request, nil)
+	assert.Nil(device)
+	assert.Equal(expectedError, actualError)
+
+	connectionFactory.AssertExpectations(t)
+}
+
 func testManagerConnectBadConveyHeader(t *testing.T) {
 	assert := assert.New(t)
 	options := &Options{
@@ -244,9 +304,52 @@ func testManagerConnectVisit(t *testing.T) {
 	deviceSet.assertDistributionOfIDs(assert, testDeviceIDs)
 }
 
+func testManagerConnectProfileLabels(t *testing.T) {
+	var (
+		assert         = assert.New(t)
+		connectWait    = new(sync.WaitGroup)
+		disconnectWait = new(sync.WaitGroup)
+
+		options = &Options{
+			Logger:          logging.TestLogger(t),
+			ProfileLabels:   true,
+			ProfileBuckets:  4,
+			ProfilePartners: []string{"comcast"},
+			Listeners: []Listener{
+				func(event *Event) {
+					switch event.Type {
+					case Connect:
+						connectWait.Done()
+					case Disconnect:
+						disconnectWait.Done()
+					}
+				},
+			},
+		}
+
+		manager, server, connectURL = startWebsocketServer(options)
+	)
+
+	defer server.Close()
+	connectWait.Add(testConnectionCount)
+	disconnectWait.Add(testConnectionCount)
+
+	// the pumps of labeled devices behave exactly as unlabeled ones
+	dialer := NewDialer(options, nil)
+	testDevices := connectTestDevices(t, assert, dialer, connectURL)
+	defer closeTestDevices(assert, testDevices)
+
+	connectWait.Wait()
+	for id, connectionCount := range testDeviceIDs {
+		assert.Equal(connectionCount, manager.Disconnect(id))
+	}
+
+	disconnectWait.Wait()
+}
+
 func testManagerPongCallbackFor(t *testing.T) {
 	assert := assert.New(t)
-	expectedDevice := newDevice(ID("ponged device"), Key("expected"), nil, "", 1)
+	expectedDevice := newDevice(ID("ponged device"), Key("expected"), nil, "", 1, defaultQOSWeights)
 	expectedData := "expected pong data"
 	listenerCalled := false
 
@@ -308,6 +411,17 @@ func testManagerDisconnect(t *testing.T) {
 	close(disconnections)
 	assert.Equal(testConnectionCount, len(disconnections))
 
+	for id, connectionCount := range testDeviceIDs {
+		history := manager.DisconnectHistory(id)
+		assert.Len(history, connectionCount)
+		for _, record := range history {
+			assert.Equal(id, record.ID)
+			assert.Equal(DisconnectReasonRequested, record.Reason)
+		}
+	}
+
+	assert.Empty(manager.DisconnectHistory(ID("nosuch")))
+
 	deviceSet := make(deviceSet)
 	deviceSet.drain(disconnections)
 	assert.Equal(testConnectionCount, deviceSet.len())
@@ -471,8 +585,8 @@ func testManagerRouteNonUniqueID(t *testing.T) {
 			},
 		}
 
-		device1 = newDevice(ID("mac:112233445566"), Key("123"), nil, "", 1)
-		device2 = newDevice(ID("mac:112233445566"), Key("234"), nil, "", 1)
+		device1 = newDevice(ID("mac:112233445566"), Key("123"), nil, "", 1, defaultQOSWeights)
+		device2 = newDevice(ID("mac:112233445566"), Key("234"), nil, "", 1, defaultQOSWeights)
 
 		connectionFactory = new(mockConnectionFactory)
 		manager           = NewManager(nil, connectionFactory).(*manager)
@@ -488,6 +602,170 @@ func testManagerRouteNonUniqueID(t *testing.T) {
 	connectionFactory.AssertExpectations(t)
 }
 
+func testManagerRouteTracing(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		tracer  = tracingtest.NewTracer()
+		remote  = tracing.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}
+		options = &Options{Logger: logging.TestLogger(t), AuthDelay: time.Millisecond}
+
+		manager, server, connectURL = startWebsocketServer(options)
+	)
+
+	defer server.Close()
+	defer tracer.Install()()
+
+	connection, _, err := NewDialer(options, nil).Dial(connectURL, "mac:112233445566", nil, nil)
+	require.NoError(err)
+	defer connection.Close()
+
+	// the auth status is always sent first
+	message, err := expectMessage(connection)
+	require.NoError(err)
+	require.Equal(wrp.AuthMessageType, message.Type)
+
+	routed := &wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "dns:somewhere.com",
+		Destination: "mac:112233445566",
+		Payload:     []byte("payload"),
+	}
+
+	// the contents are stale once the trace context is injected, so they must be encoded again
+	contents := wrp.MustEncode(routed, wrp.Msgpack)
+	tracing.InjectMessage(remote, routed)
+
+	// events have no response
+	request := &Request{Message: routed, Format: wrp.Msgpack, Contents: contents}
+	response, err := manager.Route(request)
+	require.NoError(err)
+	assert.Nil(response)
+
+	// neither the caller's request nor its message is modified
+	assert.Equal(routed, request.Message)
+	assert.Equal(contents, request.Contents)
+	assert.Equal(tracing.FormatTraceParent(remote), routed.Metadata[tracing.TraceParentMetadataKey])
+
+	spans := tracer.Spans()
+	require.Len(spans, 1)
+	assert.Equal("device.route", spans[0].Name)
+	assert.Equal(remote, spans[0].Parent)
+	assert.Equal("mac:112233445566", spans[0].Tags["device.id"])
+	assert.NoError(spans[0].Error)
+	assert.True(spans[0].Finished)
+
+	message, err = expectMessage(connection)
+	require.NoError(err)
+	assert.Equal(wrp.SimpleEventMessageType, message.Type)
+	actual, ok := tracing.ExtractMessage(message)
+	assert.True(ok)
+	assert.Equal(remote.TraceID, actual.TraceID)
+	assert.NotEqual(remote.SpanID, actual.SpanID)
+}
+
+func testManagerRouteContextDone(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		ctx, cancel = context.WithCancel(context.Background())
+		request     = &Request{
+			Message: &wrp.Message{
+				Type:        wrp.SimpleEventMessageType,
+				Destination: "mac:112233445566",
+			},
+		}
+
+		manager = NewManager(&Options{Logger: logging.TestLogger(t), ForwardTTL: time.Minute}, nil).(*manager)
+	)
+
+	cancel()
+	response, err := manager.RouteContext(ctx, request)
+	assert.Nil(response)
+	assert.Equal(context.Canceled, err)
+	assert.Empty(manager.forward.byID)
+}
+
+func testManagerRouteContextDeadline(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		options = &Options{Logger: &logging.LoggerWriter{Writer: ioutil.Discard}, AuthDelay: time.Millisecond}
+
+		manager, server, connectURL = startWebsocketServer(options)
+	)
+
+	defer server.Close()
+
+	connection, _, err := NewDialer(options, nil).Dial(connectURL, "mac:112233445566", nil, nil)
+	require.NoError(err)
+	defer connection.Close()
+
+	// the auth status is always sent first, and ensures the device is registered
+	message, err := expectMessage(connection)
+	require.NoError(err)
+	require.Equal(wrp.AuthMessageType, message.Type)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the device never responds, so the transaction outlives the context
+	response, err := manager.(ContextRouter).RouteContext(ctx, &Request{
+		Message: &wrp.Message{
+			Type:            wrp.SimpleRequestResponseMessageType,
+			Source:          "dns:somewhere.com",
+			Destination:     "mac:112233445566",
+			TransactionUUID: "test-transaction",
+		},
+		Format: wrp.Msgpack,
+	})
+
+	assert.Nil(response)
+	assert.Equal(context.DeadlineExceeded, err)
+
+	message, err = expectMessage(connection)
+	require.NoError(err)
+	assert.Equal("test-transaction", message.TransactionUUID)
+}
+
+func testManagerRouteContextRequestDeadline(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		options = &Options{Logger: &logging.LoggerWriter{Writer: ioutil.Discard}, AuthDelay: time.Millisecond}
+
+		manager, server, connectURL = startWebsocketServer(options)
+	)
+
+	defer server.Close()
+
+	connection, _, err := NewDialer(options, nil).Dial(connectURL, "mac:112233445566", nil, nil)
+	require.NoError(err)
+	defer connection.Close()
+
+	message, err := expectMessage(connection)
+	require.NoError(err)
+	require.Equal(wrp.AuthMessageType, message.Type)
+
+	requestCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	request := (&Request{
+		Message: &wrp.Message{
+			Type:            wrp.SimpleRequestResponseMessageType,
+			Source:          "dns:somewhere.com",
+			Destination:     "mac:112233445566",
+			TransactionUUID: "test-transaction",
+		},
+		Format: wrp.Msgpack,
+	}).WithContext(requestCtx)
+
+	// the request's own context still bounds the routing, and the request keeps its context
+	response, err := manager.(ContextRouter).RouteContext(context.Background(), request)
+	assert.Nil(response)
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.Equal(requestCtx, request.Context())
+}
+
 func testManagerPingPong(t *testing.T) {
 	var (
 		assert      = assert.New(t)
@@ -553,25 +831,264 @@ func testManagerPingPong(t *testing.T) {
 	pongWait.Wait()
 }
 
+func testManagerKeepaliveTimeout(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		connectWait = new(sync.WaitGroup)
+		disconnects = make(chan error, testConnectionCount)
+
+		options = &Options{
+			Logger: logging.TestLogger(t),
+			Listeners: []Listener{
+				func(event *Event) {
+					switch event.Type {
+					case Connect:
+						connectWait.Done()
+					case Disconnect:
+						disconnects <- event.Error
+					}
+				},
+			},
+			KeepalivePeriod:  100 * time.Millisecond,
+			KeepaliveTimeout: 300 * time.Millisecond,
+		}
+	)
+
+	connectWait.Add(testConnectionCount)
+
+	var (
+		manager, server, connectURL = startWebsocketServer(options)
+		dialer                      = NewDialer(options, nil)
+		testDevices                 = connectTestDevices(t, assert, dialer, connectURL)
+		keepalives                  = make(chan struct{}, testConnectionCount)
+	)
+
+	defer server.Close()
+	defer func() {
+		for _, connections := range testDevices {
+			for _, c := range connections {
+				c.Close()
+			}
+		}
+	}()
+
+	connectWait.Wait()
+
+	// the devices read their frames, but never send anything back
+	for _, connections := range testDevices {
+		for _, c := range connections {
+			go func(c Connection) {
+				decoder := wrp.NewDecoder(nil, wrp.Msgpack)
+				keepaliveSeen := false
+				for {
+					var frame bytes.Buffer
+					if _, err := c.Read(&frame); err != nil {
+						return
+					}
+
+					var message wrp.Message
+					decoder.ResetBytes(frame.Bytes())
+					if decoder.Decode(&message) == nil && message.Type == wrp.ServiceAliveMessageType && !keepaliveSeen {
+						keepaliveSeen = true
+						keepalives <- struct{}{}
+					}
+				}
+			}(c)
+		}
+	}
+
+	timeout := time.After(10 * time.Second)
+	for count := 0; count < testConnectionCount; count++ {
+		select {
+		case <-keepalives:
+		case <-timeout:
+			assert.FailNow("Not all devices received keepalives within the timeout")
+		}
+	}
+
+	for count := 0; count < testConnectionCount; count++ {
+		select {
+		case err := <-disconnects:
+			assert.Equal(ErrorKeepaliveTimeout, err)
+		case <-timeout:
+			assert.FailNow("Not all devices were disconnected within the timeout")
+		}
+	}
+
+	for id, connections := range testDevices {
+		history := manager.DisconnectHistory(id)
+		if assert.Len(history, len(connections)) {
+			assert.Equal(ErrorKeepaliveTimeout.Error(), history[0].Reason)
+		}
+	}
+}
+
+func testManagerDrain(t *testing.T) {
+	assert := assert.New(t)
+	connectWait := new(sync.WaitGroup)
+	connectWait.Add(testConnectionCount)
+
+	options := &Options{
+		Logger: logging.TestLogger(t),
+		Listeners: []Listener{
+			func(event *Event) {
+				if event.Type == Connect {
+					connectWait.Done()
+				}
+			},
+		},
+	}
+
+	m, server, connectURL := startWebsocketServer(options)
+	defer server.Close()
+
+	dialer := NewDialer(options, nil)
+	testDevices := connectTestDevices(t, assert, dialer, connectURL)
+	defer closeTestDevices(assert, testDevices)
+
+	connectWait.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assert.NoError(m.Drain(ctx))
+	assert.Zero(m.VisitAll(func(Interface) {}))
+	assert.Zero(m.(*manager).active)
+}
+
+func testManagerDrainTimeout(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		m           = NewManager(&Options{Logger: logging.TestLogger(t)}, nil).(*manager)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+
+	// simulates a connection whose pumps never close
+	m.active = 1
+	cancel()
+	assert.Equal(context.Canceled, m.Drain(ctx))
+}
+
+func testManagerVisitConcurrently(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		m      = &manager{registry: testRegistry(t, assert)}
+
+		expectVisited = expectsDevices(singleDevice, doubleDevice1, doubleDevice2, manyDevice1, manyDevice2, manyDevice3, manyDevice4, manyDevice5)
+	)
+
+	for _, parallelism := range []int{-1, 0, 1, 2, 8} {
+		var (
+			lock          sync.Mutex
+			actualVisited = deviceSet{}
+		)
+
+		count := m.VisitConcurrently(parallelism, func(d Interface) {
+			lock.Lock()
+			actualVisited.add(d)
+			lock.Unlock()
+		})
+
+		assert.Equal(len(expectVisited), count)
+		assert.Equal(expectVisited, actualVisited)
+	}
+}
+
+func testManagerVisitConcurrentlyCancel(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		m           = &manager{registry: testRegistry(t, assert)}
+		ctx, cancel = context.WithCancel(context.Background())
+		visited     int32
+	)
+
+	count, err := m.VisitConcurrentlyContext(ctx, 1, func(Interface) {
+		// cancel partway through, so the remaining devices are not visited
+		if atomic.AddInt32(&visited, 1) == 3 {
+			cancel()
+		}
+	})
+
+	assert.Equal(context.Canceled, err)
+	assert.Equal(3, count)
+	assert.Equal(int32(3), atomic.LoadInt32(&visited))
+
+	count, err = m.VisitConcurrentlyContext(ctx, 4, func(Interface) {
+		assert.Fail("No devices should be visited once the context is cancelled")
+	})
+
+	assert.Equal(context.Canceled, err)
+	assert.Zero(count)
+}
+
 func TestManager(t *testing.T) {
 	t.Run("Connect", func(t *testing.T) {
 		t.Run("MissingDeviceContext", testManagerConnectMissingDeviceContext)
+		t.Run("IDExtractorError", testManagerConnectIDExtractorError)
+		t.Run("IDExtractor", testManagerConnectIDExtractor)
 		t.Run("BadConveyHeader", testManagerConnectBadConveyHeader)
 		t.Run("KeyError", testManagerConnectKeyError)
 		t.Run("ConnectionFactoryError", testManagerConnectConnectionFactoryError)
 		t.Run("Visit", testManagerConnectVisit)
+		t.Run("ProfileLabels", testManagerConnectProfileLabels)
 	})
 
 	t.Run("Route", func(t *testing.T) {
 		t.Run("BadDestination", testManagerRouteBadDestination)
 		t.Run("DeviceNotFound", testManagerRouteDeviceNotFound)
 		t.Run("NonUniqueID", testManagerRouteNonUniqueID)
+		t.Run("Tracing", testManagerRouteTracing)
+		t.Run("ContextDone", testManagerRouteContextDone)
+		t.Run("ContextDeadline", testManagerRouteContextDeadline)
+		t.Run("ContextRequestDeadline", testManagerRouteContextRequestDeadline)
 	})
 
+	t.Run("VisitConcurrently", testManagerVisitConcurrently)
+	t.Run("VisitConcurrentlyCancel", testManagerVisitConcurrentlyCancel)
 	t.Run("Disconnect", testManagerDisconnect)
 	t.Run("DisconnectOne", testManagerDisconnectOne)
 	t.Run("DisconnectIf", testManagerDisconnectIf)
+	t.Run("Drain", testManagerDrain)
+	t.Run("DrainTimeout", testManagerDrainTimeout)
 
 	t.Run("PongCallbackFor", testManagerPongCallbackFor)
 	t.Run("PingPong", testManagerPingPong)
+	t.Run("KeepaliveTimeout", testManagerKeepaliveTimeout)
+}
+
+func TestJoinContext(t *testing.T) {
+	type key struct{}
+	type otherKey struct{}
+
+	var (
+		assert = assert.New(t)
+		ctx    = context.WithValue(context.Background(), key{}, "ctx")
+	)
+
+	joined, cancel := joinContext(ctx, context.Background())
+	assert.Equal(ctx, joined)
+	cancel()
+
+	joined, cancel = joinContext(ctx, ctx)
+	assert.Equal(ctx, joined)
+	cancel()
+
+	deadline := time.Now().Add(time.Hour)
+	other, otherCancel := context.WithDeadline(context.WithValue(context.Background(), otherKey{}, "value"), deadline)
+	joined, cancel = joinContext(ctx, other)
+	defer cancel()
+
+	assert.NoError(joined.Err())
+	assert.Equal("ctx", joined.Value(key{}))
+	assert.Equal("value", joined.Value(otherKey{}))
+	actualDeadline, ok := joined.Deadline()
+	assert.True(ok)
+	assert.Equal(deadline, actualDeadline)
+
+	otherCancel()
+	select {
+	case <-joined.Done():
+		assert.Equal(context.Canceled, joined.Err())
+	case <-time.After(5 * time.Second):
+		assert.Fail("The joined context should be done when the other context is done")
+	}
 }
@@ -0,0 +1,277 @@
+package device
+
+import (
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// ConnectionCountGauge is the number of devices currently connected
+	ConnectionCountGauge = "device_connection_count"
+
+	// ConnectCounter is the total number of device connections
+	ConnectCounter = "device_connect_count"
+
+	// DisconnectCounter is the total number of device disconnections
+	DisconnectCounter = "device_disconnect_count"
+
+	// MessageLatencyHistogram is the time, in seconds, between a message being sent to a device
+	// and that message being written to the device's connection
+	MessageLatencyHistogram = "device_message_latency_seconds"
+
+	// DuplicateMessageCounter is the total number of inbound device messages dropped as duplicates
+	DuplicateMessageCounter = "device_duplicate_message_count"
+
+	// ConnectStageCounter is the total number of connection attempts which reached each stage of the connect funnel
+	ConnectStageCounter = "device_connect_stage_count"
+
+	// ConnectStageLatencyHistogram is the time, in seconds, between a connection attempt starting and
+	// that attempt reaching each subsequent stage of the connect funnel
+	ConnectStageLatencyHistogram = "device_connect_stage_latency_seconds"
+
+	// DispatchTimeoutCounter is the total number of events whose listeners did not finish within the dispatch timeout
+	DispatchTimeoutCounter = "device_dispatch_timeout_count"
+
+	// MirrorCounter is the total number of inbound device messages selected for mirroring, by outcome
+	MirrorCounter = "device_mirror_count"
+
+	// MirrorOutcomeLabel is the label identifying what became of a mirrored message
+	MirrorOutcomeLabel = "outcome"
+
+	// MirrorSuccess is the outcome of messages accepted by the MirrorSink
+	MirrorSuccess = "success"
+
+	// MirrorFailure is the outcome of messages for which the MirrorSink returned an error
+	MirrorFailure = "failure"
+
+	// MirrorDropped is the outcome of messages dropped because too many mirrored messages were pending
+	MirrorDropped = "dropped"
+
+	// ForwardCounter is the total number of messages for disconnected devices handled by the store-and-forward
+	// buffer, by outcome
+	ForwardCounter = "device_forward_count"
+
+	// ForwardPendingGauge is the number of messages currently retained for disconnected devices
+	ForwardPendingGauge = "device_forward_pending"
+
+	// ForwardOutcomeLabel is the label identifying what became of a message handled by the store-and-forward buffer
+	ForwardOutcomeLabel = "outcome"
+
+	// ForwardBuffered is the outcome of messages retained for a disconnected device
+	ForwardBuffered = "buffered"
+
+	// ForwardExpired is the outcome of retained messages discarded because their device did not reconnect in time
+	ForwardExpired = "expired"
+
+	// ForwardFlushed is the outcome of retained messages sent to their device once it reconnected
+	ForwardFlushed = "flushed"
+
+	// ForwardDropped is the outcome of messages which could not be retained or flushed
+	ForwardDropped = "dropped"
+
+	// PolicyViolationCounter is the total number of inbound device messages which violated the inbound policy, by reason
+	PolicyViolationCounter = "device_policy_violation_count"
+
+	// GateStatusGauge is 1 while the device Gate admits new connections and 0 while it is closed
+	GateStatusGauge = "device_gate_status"
+
+	// GateRejectCounter is the total number of connection attempts rejected because the device Gate was closed
+	GateRejectCounter = "device_gate_reject_count"
+
+	// ChurnRateGauge is the average of the connect and disconnect rates within each of a Churn's windows
+	ChurnRateGauge = "device_churn_rate"
+
+	// ConnectRateGauge is the number of device connections per second within each of a Churn's windows
+	ConnectRateGauge = "device_connect_rate"
+
+	// DisconnectRateGauge is the number of device disconnections per second within each of a Churn's windows
+	DisconnectRateGauge = "device_disconnect_rate"
+
+	// MessageRateGauge is the number of device messages, sent and received, per second within each of a Churn's windows
+	MessageRateGauge = "device_message_rate"
+
+	// WindowLabel is the label identifying the sliding window of a Churn gauge, e.g. "5m"
+	WindowLabel = "window"
+
+	// PolicyReasonLabel is the label identifying which inbound policy was violated, e.g. PolicyPayloadTooLarge
+	PolicyReasonLabel = "reason"
+
+	// StageLabel is the label identifying a stage of the connect funnel
+	StageLabel = "stage"
+
+	// ConnectStageStarted is the stage at which a connection request, i.e. a websocket upgrade, was received
+	ConnectStageStarted = "started"
+
+	// ConnectStageAuthenticated is the stage at which the device's identity was established.  Attempts
+	// that fail before this stage were rejected for authentication reasons.
+	ConnectStageAuthenticated = "authenticated"
+
+	// ConnectStageConveyParsed is the stage at which any convey header was parsed.  Attempts that fail
+	// before this stage sent malformed requests.
+	ConnectStageConveyParsed = "convey_parsed"
+
+	// ConnectStageAuthorized is the stage at which the Manager's ConnectAuthenticator, if any, allowed the
+	// device to connect.  Attempts that fail before this stage were denied or could not be authenticated.
+	ConnectStageAuthorized = "authorized"
+
+	// ConnectStageRegistered is the stage at which the websocket upgrade completed and the device was
+	// registered.  Attempts that fail before this stage were rejected for protocol or capacity reasons.
+	ConnectStageRegistered = "registered"
+
+	// ConnectStageFirstMessage is the stage at which the first WRP message was received from the device
+	ConnectStageFirstMessage = "first_message"
+)
+
+// Metrics is the xmetrics.Module for this package
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name: ConnectionCountGauge,
+			Type: xmetrics.GaugeType,
+			Help: "The number of devices currently connected",
+		},
+		{
+			Name: ConnectCounter,
+			Type: xmetrics.CounterType,
+			Help: "The total number of device connections",
+		},
+		{
+			Name: DisconnectCounter,
+			Type: xmetrics.CounterType,
+			Help: "The total number of device disconnections",
+		},
+		{
+			Name:    MessageLatencyHistogram,
+			Type:    xmetrics.HistogramType,
+			Help:    "The time in seconds between a message being sent to a device and being written to its connection",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30},
+		},
+		{
+			Name: DuplicateMessageCounter,
+			Type: xmetrics.CounterType,
+			Help: "The total number of inbound device messages dropped as duplicates",
+		},
+		{
+			Name:       ConnectStageCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of connection attempts which reached each stage of the connect funnel",
+			LabelNames: []string{StageLabel},
+		},
+		{
+			Name:       ConnectStageLatencyHistogram,
+			Type:       xmetrics.HistogramType,
+			Help:       "The time in seconds between a connection attempt starting and reaching each stage of the connect funnel",
+			Buckets:    []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60},
+			LabelNames: []string{StageLabel},
+		},
+		{
+			Name: DispatchTimeoutCounter,
+			Type: xmetrics.CounterType,
+			Help: "The total number of events whose listeners did not finish within the dispatch timeout",
+		},
+		{
+			Name:       MirrorCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of inbound device messages selected for mirroring, by outcome",
+			LabelNames: []string{MirrorOutcomeLabel},
+		},
+		{
+			Name:       PolicyViolationCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of inbound device messages which violated the inbound policy, by reason",
+			LabelNames: []string{PolicyReasonLabel},
+		},
+		{
+			Name:       ForwardCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of messages for disconnected devices handled by the store-and-forward buffer, by outcome",
+			LabelNames: []string{ForwardOutcomeLabel},
+		},
+		{
+			Name: ForwardPendingGauge,
+			Type: xmetrics.GaugeType,
+			Help: "The number of messages currently retained for disconnected devices",
+		},
+		{
+			Name: GateStatusGauge,
+			Type: xmetrics.GaugeType,
+			Help: "1 while the device gate admits new connections, 0 while it is closed",
+		},
+		{
+			Name: GateRejectCounter,
+			Type: xmetrics.CounterType,
+			Help: "The total number of connection attempts rejected because the device gate was closed",
+		},
+		{
+			Name:       ChurnRateGauge,
+			Type:       xmetrics.GaugeType,
+			Help:       "The average of the device connect and disconnect rates within a sliding window",
+			LabelNames: []string{WindowLabel},
+		},
+		{
+			Name:       ConnectRateGauge,
+			Type:       xmetrics.GaugeType,
+			Help:       "The number of device connections per second within a sliding window",
+			LabelNames: []string{WindowLabel},
+		},
+		{
+			Name:       DisconnectRateGauge,
+			Type:       xmetrics.GaugeType,
+			Help:       "The number of device disconnections per second within a sliding window",
+			LabelNames: []string{WindowLabel},
+		},
+		{
+			Name:       MessageRateGauge,
+			Type:       xmetrics.GaugeType,
+			Help:       "The number of device messages, sent and received, per second within a sliding window",
+			LabelNames: []string{WindowLabel},
+		},
+	}
+}
+
+// measures is the set of metrics updated by a manager
+type measures struct {
+	connections    metrics.Gauge
+	connect        metrics.Counter
+	disconnect     metrics.Counter
+	messageLatency metrics.Histogram
+	duplicates     metrics.Counter
+
+	connectStage        metrics.Counter
+	connectStageLatency metrics.Histogram
+
+	dispatchTimeouts metrics.Counter
+
+	mirror metrics.Counter
+
+	policyViolations metrics.Counter
+
+	gateRejects metrics.Counter
+
+	forward        metrics.Counter
+	forwardPending metrics.Gauge
+}
+
+func newMeasures(p xmetrics.Provider) measures {
+	return measures{
+		connections:    p.NewGauge(ConnectionCountGauge),
+		connect:        p.NewCounter(ConnectCounter),
+		disconnect:     p.NewCounter(DisconnectCounter),
+		messageLatency: p.NewHistogram(MessageLatencyHistogram),
+		duplicates:     p.NewCounter(DuplicateMessageCounter),
+
+		connectStage:        p.NewCounter(ConnectStageCounter),
+		connectStageLatency: p.NewHistogram(ConnectStageLatencyHistogram),
+
+		dispatchTimeouts: p.NewCounter(DispatchTimeoutCounter),
+
+		mirror: p.NewCounter(MirrorCounter),
+
+		policyViolations: p.NewCounter(PolicyViolationCounter),
+
+		gateRejects: p.NewCounter(GateRejectCounter),
+
+		forward:        p.NewCounter(ForwardCounter),
+		forwardPending: p.NewGauge(ForwardPendingGauge),
+	}
+}
@@ -0,0 +1,194 @@
+package device
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock/clocktest"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	assert.NotNil(t, registry)
+	assert.NoError(t, err)
+}
+
+func TestManagerMetrics(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+		events        = make(chan EventType, 10)
+
+		options = &Options{
+			Logger:          logging.TestLogger(t),
+			AuthDelay:       50 * time.Millisecond,
+			MetricsProvider: registry,
+			Listeners: []Listener{
+				func(event *Event) {
+					if event.Type == MessageSent || event.Type == MessageReceived || event.Type == Disconnect {
+						events <- event.Type
+					}
+				},
+			},
+		}
+	)
+
+	require.NoError(err)
+	require.NotNil(registry)
+
+	scrape := func() string {
+		response := httptest.NewRecorder()
+		registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+		return response.Body.String()
+	}
+
+	manager, server, connectURL := startWebsocketServer(options)
+	defer server.Close()
+
+	dialer := NewDialer(options, nil)
+	connection, _, err := dialer.Dial(connectURL, "mac:112233445566", nil, nil)
+	require.NoError(err)
+	require.NotNil(connection)
+	defer connection.Close()
+
+	// the authorization status message is the first message sent to each device
+	select {
+	case eventType := <-events:
+		assert.Equal(MessageSent, eventType)
+	case <-time.After(5 * time.Second):
+		require.Fail("No message was sent to the device")
+	}
+
+	// the first message from the device completes the connect funnel
+	_, err = connection.Write(wrp.MustEncode(
+		&wrp.Message{Type: wrp.SimpleEventMessageType, Source: "mac:112233445566", Destination: "event:test"},
+		wrp.Msgpack,
+	))
+
+	require.NoError(err)
+	select {
+	case eventType := <-events:
+		assert.Equal(MessageReceived, eventType)
+	case <-time.After(5 * time.Second):
+		require.Fail("No message was received from the device")
+	}
+
+	output := scrape()
+	assert.Contains(output, ConnectionCountGauge+" 1")
+	assert.Contains(output, ConnectCounter+" 1")
+	assert.Contains(output, MessageLatencyHistogram+"_count 1")
+
+	for _, stage := range []string{ConnectStageStarted, ConnectStageAuthenticated, ConnectStageConveyParsed, ConnectStageAuthorized, ConnectStageRegistered, ConnectStageFirstMessage} {
+		assert.Contains(output, ConnectStageCounter+`{stage="`+stage+`"} 1`)
+	}
+
+	assert.Contains(output, ConnectStageLatencyHistogram+`_count{stage="first_message"} 1`)
+
+	assert.Equal(1, manager.Disconnect(ID("mac:112233445566")))
+	select {
+	case eventType := <-events:
+		assert.Equal(Disconnect, eventType)
+	case <-time.After(5 * time.Second):
+		require.Fail("The device was not disconnected")
+	}
+
+	output = scrape()
+	assert.Contains(output, ConnectionCountGauge+" 0")
+	assert.Contains(output, DisconnectCounter+" 1")
+}
+
+func TestManagerConnectFunnel(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+	)
+
+	require.NoError(err)
+	manager := NewManager(&Options{Logger: logging.TestLogger(t), MetricsProvider: registry}, nil)
+
+	// no device identity
+	d, err := manager.Connect(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), nil)
+	assert.Nil(d)
+	assert.Equal(ErrorMissingDeviceNameContext, err)
+
+	// a malformed convey header
+	request := WithIDRequest(ID("mac:112233445566"), httptest.NewRequest("GET", "/", nil))
+	request.Header.Set(ConveyHeader, "this is not a valid convey")
+	d, err = manager.Connect(httptest.NewRecorder(), request, nil)
+	assert.Nil(d)
+	assert.Error(err)
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	output := response.Body.String()
+
+	assert.Contains(output, ConnectStageCounter+`{stage="started"} 2`)
+	assert.Contains(output, ConnectStageCounter+`{stage="authenticated"} 1`)
+	assert.NotContains(output, ConnectStageCounter+`{stage="convey_parsed"}`)
+	assert.NotContains(output, ConnectStageCounter+`{stage="registered"}`)
+	assert.Contains(output, ConnectStageLatencyHistogram+`_count{stage="authenticated"} 1`)
+}
+
+func TestManagerMessageLatencyClock(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+		clock         = clocktest.NewClock(time.Unix(1000, 0))
+		events        = make(chan EventType, 10)
+
+		options = &Options{
+			Logger:          logging.TestLogger(t),
+			MetricsProvider: registry,
+			Clock:           clock,
+			Listeners: []Listener{
+				func(event *Event) {
+					if event.Type == MessageSent {
+						events <- event.Type
+					}
+				},
+			},
+		}
+	)
+
+	require.NoError(err)
+	require.NotNil(registry)
+
+	_, server, connectURL := startWebsocketServer(options)
+	defer server.Close()
+
+	dialer := NewDialer(options, nil)
+	connection, _, err := dialer.Dial(connectURL, "mac:112233445566", nil, nil)
+	require.NoError(err)
+	require.NotNil(connection)
+	defer connection.Close()
+
+	// the authorization status message is enqueued once the auth delay elapses on the clock,
+	// and since the clock does not move again before it is written, its latency is exactly zero.
+	// The write pump's ping ticker and auth delay timer must exist before the clock moves.
+	clock.BlockUntil(2)
+	clock.Add(options.authDelay())
+	select {
+	case <-events:
+	case <-time.After(5 * time.Second):
+		require.Fail("No message was sent to the device")
+	}
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	output := response.Body.String()
+
+	assert.Contains(output, MessageLatencyHistogram+"_count 1")
+	assert.Contains(output, MessageLatencyHistogram+"_sum 0\n")
+}
@@ -0,0 +1,104 @@
+package device
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/go-kit/kit/metrics"
+)
+
+// MirrorSink receives copies of inbound device messages, e.g. for shadow testing a new processing
+// pipeline with production traffic.  The message and contents must be treated as read-only, since they
+// are shared with the primary dispatch of the message.  Implementations must be safe for concurrent use.
+type MirrorSink interface {
+	Mirror(d Interface, message *wrp.Message, contents []byte) error
+}
+
+// MirrorSinkFunc is a function type that implements MirrorSink
+type MirrorSinkFunc func(Interface, *wrp.Message, []byte) error
+
+func (f MirrorSinkFunc) Mirror(d Interface, message *wrp.Message, contents []byte) error {
+	return f(d, message, contents)
+}
+
+// ListenerMirrorSink is a MirrorSink which delivers each mirrored message to a separate set of Listeners
+// as a MessageReceived event, exactly as a Manager would.  This allows a new pipeline of listeners to be
+// run alongside the primary pipeline.
+type ListenerMirrorSink struct {
+	Listeners []Listener
+}
+
+func (s *ListenerMirrorSink) Mirror(d Interface, message *wrp.Message, contents []byte) error {
+	event := new(Event)
+	event.SetMessageReceived(d, message, wrp.Msgpack, contents)
+	for _, l := range s.Listeners {
+		l(event)
+	}
+
+	return nil
+}
+
+// mirror samples inbound messages and hands them to a MirrorSink without blocking the read pump
+type mirror struct {
+	logger     logging.Logger
+	sink       MirrorSink
+	percentage float64
+	pending    chan struct{}
+	outcomes   metrics.Counter
+
+	sampleLock sync.Mutex
+	sample     func() float64
+}
+
+func newMirror(logger logging.Logger, sink MirrorSink, percentage float64, maxPending int, outcomes metrics.Counter) *mirror {
+	return &mirror{
+		logger:     logger,
+		sink:       sink,
+		percentage: percentage,
+		pending:    make(chan struct{}, maxPending),
+		outcomes:   outcomes,
+		sample:     rand.New(rand.NewSource(time.Now().UnixNano())).Float64,
+	}
+}
+
+// selected determines whether the next message is mirrored
+func (m *mirror) selected() bool {
+	if m.percentage >= 100 {
+		return true
+	}
+
+	m.sampleLock.Lock()
+	value := m.sample()
+	m.sampleLock.Unlock()
+	return value*100 < m.percentage
+}
+
+// mirror asynchronously sends a sample of messages to the sink.  When the maximum number of mirrored
+// messages are pending, the message is dropped rather than delaying the device.
+func (m *mirror) mirror(d Interface, message *wrp.Message, contents []byte) {
+	if !m.selected() {
+		return
+	}
+
+	select {
+	case m.pending <- struct{}{}:
+	default:
+		m.outcomes.With(MirrorOutcomeLabel, MirrorDropped).Add(1)
+		return
+	}
+
+	// the sink gets its own copy of the message fields, so that listeners in the primary pipeline cannot race with it
+	copied := *message
+	go func() {
+		defer func() { <-m.pending }()
+		if err := m.sink.Mirror(d, &copied, contents); err != nil {
+			m.logger.Debug("Unable to mirror message from device [%s]: %s", d.ID(), err)
+			m.outcomes.With(MirrorOutcomeLabel, MirrorFailure).Add(1)
+		} else {
+			m.outcomes.With(MirrorOutcomeLabel, MirrorSuccess).Add(1)
+		}
+	}()
+}
@@ -0,0 +1,179 @@
+package device
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/go-kit/kit/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outcomeCounter is a metrics.Counter which tallies mirror outcomes
+type outcomeCounter struct {
+	lock     *sync.Mutex
+	counts   map[string]float64
+	outcome  string
+	observed chan string
+}
+
+func newOutcomeCounter() *outcomeCounter {
+	return &outcomeCounter{
+		lock:     new(sync.Mutex),
+		counts:   make(map[string]float64),
+		observed: make(chan string, 100),
+	}
+}
+
+func (c *outcomeCounter) With(labelValues ...string) metrics.Counter {
+	clone := *c
+	clone.outcome = labelValues[1]
+	return &clone
+}
+
+func (c *outcomeCounter) Add(delta float64) {
+	c.lock.Lock()
+	c.counts[c.outcome] += delta
+	c.lock.Unlock()
+	c.observed <- c.outcome
+}
+
+func (c *outcomeCounter) expect(t *testing.T, outcome string) {
+	select {
+	case actual := <-c.observed:
+		assert.Equal(t, outcome, actual)
+	case <-time.After(time.Second):
+		assert.Fail(t, "No mirror outcome was observed", outcome)
+	}
+}
+
+// wait waits for the given number of outcomes, in any order
+func (c *outcomeCounter) wait(t *testing.T, count int) {
+	for ; count > 0; count-- {
+		select {
+		case <-c.observed:
+		case <-time.After(time.Second):
+			assert.Fail(t, "Too few mirror outcomes were observed")
+			return
+		}
+	}
+}
+
+func TestMirrorSample(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		outcomes = newOutcomeCounter()
+		sink     = MirrorSinkFunc(func(Interface, *wrp.Message, []byte) error { return nil })
+		samples  = []float64{0.1, 0.25, 0.5, 0.9}
+		m        = newMirror(logging.TestLogger(t), sink, 25, 10, outcomes)
+		d        = newDevice(ID("mac:112233445566"), Key("test"), nil, "", 1, defaultQOSWeights)
+	)
+
+	m.sample = func() float64 {
+		next := samples[0]
+		samples = samples[1:]
+		return next
+	}
+
+	// only samples below 25% are mirrored
+	for range []int{0, 1, 2, 3} {
+		m.mirror(d, new(wrp.Message), nil)
+	}
+
+	outcomes.expect(t, MirrorSuccess)
+	assert.Empty(samples)
+	assert.Empty(outcomes.observed)
+
+	// at 100%, no sample is taken
+	m = newMirror(logging.TestLogger(t), sink, 100, 10, outcomes)
+	m.sample = func() float64 {
+		assert.Fail("No sample should be taken")
+		return 0
+	}
+
+	m.mirror(d, new(wrp.Message), nil)
+	outcomes.expect(t, MirrorSuccess)
+}
+
+func TestMirrorOutcomes(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		outcomes = newOutcomeCounter()
+		release  = make(chan struct{})
+		mirrored = make(chan *wrp.Message, 10)
+		sink     = MirrorSinkFunc(func(d Interface, message *wrp.Message, contents []byte) error {
+			<-release
+			mirrored <- message
+			if message.Source == "fail" {
+				return errors.New("expected")
+			}
+
+			return nil
+		})
+
+		m = newMirror(logging.TestLogger(t), sink, 100, 2, outcomes)
+		d = newDevice(ID("mac:112233445566"), Key("test"), nil, "", 1, defaultQOSWeights)
+
+		original = &wrp.Message{Source: "succeed"}
+	)
+
+	m.mirror(d, original, nil)
+	m.mirror(d, &wrp.Message{Source: "fail"}, nil)
+
+	// the sink is blocked with the maximum pending messages, so this one is dropped
+	m.mirror(d, &wrp.Message{Source: "dropped"}, nil)
+	outcomes.expect(t, MirrorDropped)
+
+	// the sink receives a copy, unaffected by later changes to the original message
+	original.Source = "changed"
+	close(release)
+
+	sources := make(map[string]bool)
+	for range []int{0, 1} {
+		select {
+		case message := <-mirrored:
+			sources[message.Source] = true
+		case <-time.After(time.Second):
+			require.Fail("The sink was not called")
+		}
+	}
+
+	assert.Equal(map[string]bool{"succeed": true, "fail": true}, sources)
+
+	outcomes.wait(t, 2)
+	outcomes.lock.Lock()
+	assert.Equal(map[string]float64{MirrorSuccess: 1, MirrorFailure: 1, MirrorDropped: 1}, outcomes.counts)
+	outcomes.lock.Unlock()
+}
+
+func TestListenerMirrorSink(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		d        = newDevice(ID("mac:112233445566"), Key("test"), nil, "", 1, defaultQOSWeights)
+		message  = &wrp.Message{Type: wrp.SimpleEventMessageType, Source: "mac:112233445566"}
+		contents = []byte("contents")
+		events   []Event
+
+		sink = &ListenerMirrorSink{
+			Listeners: []Listener{
+				func(e *Event) { events = append(events, *e) },
+				func(e *Event) { events = append(events, *e) },
+			},
+		}
+	)
+
+	assert.NoError(sink.Mirror(d, message, contents))
+	assert.Len(events, 2)
+	for _, e := range events {
+		assert.Equal(MessageReceived, e.Type)
+		assert.True(d == e.Device)
+		assert.Equal(message, e.Message)
+		assert.Equal(wrp.Msgpack, e.Format)
+		assert.Equal(contents, e.Contents)
+	}
+}
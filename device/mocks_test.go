@@ -1,6 +1,7 @@
 package device
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/stretchr/testify/assert"
@@ -36,6 +37,15 @@ func (m *mockDevice) Convey() Convey {
 	return m.Called().Get(0).(Convey)
 }
 
+func (m *mockDevice) Attributes() map[string]interface{} {
+	first, _ := m.Called().Get(0).(map[string]interface{})
+	return first
+}
+
+func (m *mockDevice) Partner() string {
+	return m.Called().String(0)
+}
+
 func (m *mockDevice) EncodedConvey() string {
 	return m.Called().String(0)
 }
@@ -63,6 +73,24 @@ func (m *mockDevice) Statistics() Statistics {
 	return first
 }
 
+func (m *mockDevice) History() []HistoryRecord {
+	arguments := m.Called()
+	first, _ := arguments.Get(0).([]HistoryRecord)
+	return first
+}
+
+func (m *mockDevice) SendPing(payload []byte) error {
+	return m.Called(payload).Error(0)
+}
+
+func (m *mockDevice) SendClose(code int, text string) error {
+	return m.Called(code, text).Error(0)
+}
+
+func (m *mockDevice) SetControlFrameListener(listener ControlFrameListener) {
+	m.Called(listener)
+}
+
 func (m *mockDevice) Send(request *Request) (*Response, error) {
 	arguments := m.Called(request)
 	first, _ := arguments.Get(0).(*Response)
@@ -150,6 +178,12 @@ func (m *mockRouter) Route(request *Request) (*Response, error) {
 	return first, arguments.Error(1)
 }
 
+func (m *mockRouter) RouteContext(ctx context.Context, request *Request) (*Response, error) {
+	arguments := m.Called(ctx, request)
+	first, _ := arguments.Get(0).(*Response)
+	return first, arguments.Error(1)
+}
+
 type mockConnector struct {
 	mock.Mock
 }
@@ -171,3 +205,44 @@ func (m *mockConnector) DisconnectOne(key Key) int {
 func (m *mockConnector) DisconnectIf(predicate func(ID) bool) int {
 	return m.Called(predicate).Int(0)
 }
+
+func (m *mockConnector) Drain(ctx context.Context) error {
+	return m.Called(ctx).Error(0)
+}
+
+type mockRegistry struct {
+	mock.Mock
+}
+
+func (m *mockRegistry) Statistics(id ID) (Statistics, error) {
+	arguments := m.Called(id)
+	first, _ := arguments.Get(0).(Statistics)
+	return first, arguments.Error(1)
+}
+
+func (m *mockRegistry) VisitIf(filter func(ID) bool, visitor func(Interface)) int {
+	return m.Called(filter, visitor).Int(0)
+}
+
+func (m *mockRegistry) VisitAll(visitor func(Interface)) int {
+	return m.Called(visitor).Int(0)
+}
+
+func (m *mockRegistry) VisitConcurrently(parallelism int, visitor func(Interface)) int {
+	return m.Called(parallelism, visitor).Int(0)
+}
+
+func (m *mockRegistry) VisitConcurrentlyContext(ctx context.Context, parallelism int, visitor func(Interface)) (int, error) {
+	arguments := m.Called(ctx, parallelism, visitor)
+	return arguments.Int(0), arguments.Error(1)
+}
+
+func (m *mockRegistry) DisconnectHistory(id ID) []DisconnectRecord {
+	arguments := m.Called(id)
+	first, _ := arguments.Get(0).([]DisconnectRecord)
+	return first
+}
+
+func (m *mockRegistry) Devices(filter Filter, cursor Cursor) Page {
+	return m.Called(filter, cursor).Get(0).(Page)
+}
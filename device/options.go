@@ -1,9 +1,12 @@
 package device
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/Comcast/webpa-common/xmetrics"
 )
 
 const (
@@ -27,6 +30,27 @@ const (
 	DefaultReadBufferSize         = 4096
 	DefaultWriteBufferSize        = 4096
 	DefaultDeviceMessageQueueSize = 100
+	DefaultProfileBuckets         = 16
+	DefaultDisconnectHistorySize  = 10000
+	DefaultDedupeSize             = 10000
+	DefaultMirrorPercentage       = 100.0
+	DefaultMirrorMaxPending       = 1000
+	DefaultInboundBurst           = 10
+	DefaultForwardMaxMessages     = 100
+	DefaultForwardMaxMemory       = 16 * 1024 * 1024
+	DefaultForwardMaxSpill        = 256 * 1024 * 1024
+
+	DefaultDisconnectHistoryTTL time.Duration = time.Hour
+
+	// The default QOSWeights, which give each QOS level twice the share of the level below it
+	DefaultQOSLowWeight      = 1
+	DefaultQOSMediumWeight   = 2
+	DefaultQOSHighWeight     = 4
+	DefaultQOSCriticalWeight = 8
+
+	// DefaultKeepaliveTimeoutPeriods is the number of keepalive periods that make up the
+	// default KeepaliveTimeout
+	DefaultKeepaliveTimeoutPeriods = 3
 )
 
 // Options represent the available configuration options for components
@@ -59,10 +83,27 @@ type Options struct {
 	// Subprotocols is the optional slice of websocket subprotocols to use.
 	Subprotocols []string
 
-	// DeviceMessageQueueSize is the capacity of the channel which stores messages waiting
-	// to be transmitted to a device.  If not supplied, DefaultDeviceMessageQueueSize is used.
+	// CheckOrigin, if supplied, decides whether the Origin of a websocket upgrade request is acceptable.
+	// If not supplied, the gorilla default is used, which rejects requests whose Origin does not match the Host.
+	CheckOrigin func(*http.Request) bool `json:"-"`
+
+	// ResponseHeader is the optional set of headers sent with every websocket upgrade response.  Headers
+	// supplied for a particular connection, e.g. by a ConnectHandler or the UpgradeHook, take precedence.
+	ResponseHeader http.Header
+
+	// UpgradeHook, if supplied, customizes the headers of each device's websocket upgrade response
+	UpgradeHook UpgradeHook `json:"-"`
+
+	// DeviceMessageQueueSize is the total number of messages, across all QOS levels, which can wait to be
+	// transmitted to a device.  If not supplied, DefaultDeviceMessageQueueSize is used.
 	DeviceMessageQueueSize int
 
+	// QOSWeights are the relative shares of each device's outbound messages given to each QOS level,
+	// indexed by wrp.QOSLevel.  Higher levels are always serviced first, but once a level has sent its weight
+	// in messages it must wait for lower levels, which prevents bulk traffic from being starved.  Missing or
+	// nonpositive weights are replaced by the corresponding defaults, e.g. DefaultQOSLowWeight.
+	QOSWeights []int
+
 	// PingPeriod is the time between pings sent to each device
 	PingPeriod time.Duration
 
@@ -83,13 +124,159 @@ type Options struct {
 	// Listeners contains the event sinks for managers created using these options
 	Listeners []Listener
 
+	// IDExtractor derives the ID of each device as it connects.  If not supplied, the device ID must be
+	// placed into the connection request's Context, e.g. by UseID.  IDExtractors can be used to try
+	// several strategies in turn.
+	IDExtractor IDExtractor
+
 	// KeyFunc is the factory function for Keys, used when devices connect.
 	// If this value is nil, then UUIDKeyFunc is used along with crypto/rand's Reader.
 	KeyFunc KeyFunc
 
+	// ConnectAuthenticator decides whether each device may connect, before the websocket upgrade.
+	// If not supplied, every device with a valid ID and convey is allowed to connect.
+	ConnectAuthenticator ConnectAuthenticator
+
 	// Logger is the output sink for log messages.  If not supplied, log output
 	// is sent to logging.DefaultLogger().
 	Logger logging.Logger
+
+	// ProfileLabels enables pprof labels on each device's read and write pumps.  Labels
+	// include the device's ID hash bucket and partner, which allows CPU profiles to attribute
+	// time spent in pumps to cohorts of devices.
+	ProfileLabels bool
+
+	// ProfileBuckets is the number of hash buckets into which device IDs are grouped when
+	// ProfileLabels is enabled.  If not supplied, DefaultProfileBuckets is used.
+	ProfileBuckets int
+
+	// ProfilePartners are the partners which appear by name in pprof labels when ProfileLabels is enabled.
+	// Devices with any other partner are labeled with OtherPartner.
+	ProfilePartners []string
+
+	// KeepalivePeriod is the time between WRP ServiceAlive messages sent to each device.  Unlike
+	// websocket pings, these protocol-level keepalives survive intermediaries that strip control frames.
+	// If not supplied, protocol-level keepalives are disabled.
+	KeepalivePeriod time.Duration
+
+	// KeepaliveTimeout is the length of time a device may go without sending any WRP message
+	// before it is disconnected with ErrorKeepaliveTimeout.  This timeout is only enforced when
+	// KeepalivePeriod is set.  If not supplied, DefaultKeepaliveTimeoutPeriods times the KeepalivePeriod is used.
+	KeepaliveTimeout time.Duration
+
+	// DisconnectHistorySize is the maximum number of device IDs whose recent disconnections are remembered.
+	// If not supplied, DefaultDisconnectHistorySize is used.  If negative, no disconnections are remembered.
+	DisconnectHistorySize int
+
+	// DisconnectHistoryTTL is the length of time a disconnection is remembered.  If not supplied,
+	// DefaultDisconnectHistoryTTL is used.
+	DisconnectHistoryTTL time.Duration
+
+	// DedupeWindow is the length of time during which an inbound message with the same source and transaction
+	// UUID as an earlier message is considered a duplicate, e.g. a client retry.  Duplicates are dropped before
+	// they are dispatched to listeners.  If not supplied, inbound messages are not deduplicated.
+	DedupeWindow time.Duration
+
+	// DedupeSize is the maximum number of messages remembered for deduplication.  If not supplied,
+	// DefaultDedupeSize is used.  This option is ignored unless DedupeWindow is set.
+	DedupeSize int
+
+	// DedupeHashing, if supplied, extends deduplication to inbound messages without a transaction UUID.  Such
+	// messages are identified by their wrp content hash, computed using this Hashing, so that a message resent
+	// with identical content within the DedupeWindow is dropped.  This option is ignored unless DedupeWindow is set.
+	DedupeHashing *wrp.Hashing
+
+	// MaxMessageSize is the largest WRP frame, in bytes, accepted from a device.  A device which sends a larger
+	// frame is disconnected with ErrorMessageTooLarge, before the frame is buffered.  If not supplied, frames are
+	// not limited.
+	MaxMessageSize int
+
+	// MaxPayloadSize is the largest decoded WRP payload, in bytes, accepted from a device.  If not supplied,
+	// payloads are not limited.
+	MaxPayloadSize int
+
+	// AllowedMessageTypes are the names of the WRP message types, e.g. "SimpleEvent", accepted from devices.
+	// If not supplied, all message types are accepted.
+	AllowedMessageTypes []string
+
+	// InboundRate is the sustained number of WRP messages per second accepted from each device.  If not supplied,
+	// inbound messages are not rate limited.
+	InboundRate float64
+
+	// InboundBurst is the number of WRP messages a device may send at once before InboundRate applies.  If not
+	// supplied, DefaultInboundBurst is used.  This option is ignored unless InboundRate is set.
+	InboundBurst int
+
+	// DisconnectOnPolicyViolation closes the connection of any device which sends a message that violates the
+	// MaxPayloadSize, AllowedMessageTypes, or InboundRate policies.  Otherwise, such messages are dropped and, if the
+	// device expects a response, the device is answered with a 4xx status.  Either way, violations are never
+	// dispatched to listeners.
+	DisconnectOnPolicyViolation bool
+
+	// EventHistorySize is the number of recent events, such as messages sent and received, remembered for
+	// each connected device.  If not supplied, event history is disabled.
+	EventHistorySize int
+
+	// DispatchTimeout is the length of time the Listeners have to handle each event.  The deadline is carried
+	// by Event.Context(), which listeners that call downstream services should honor.  Listeners are still invoked
+	// synchronously and in order, but once the timeout elapses the remaining listeners are skipped.
+	// If not supplied, listeners are invoked with no deadline.
+	DispatchTimeout time.Duration
+
+	// DispatchTimeoutResponse enables error responses to devices when a request received from a device, i.e. a
+	// SimpleRequestResponse message with a transaction UUID, is not handled within the DispatchTimeout.  The
+	// response carries a status of 504 (Gateway Timeout).  This option is ignored unless DispatchTimeout is set.
+	DispatchTimeoutResponse bool
+
+	// MirrorSink, if supplied, receives copies of a sample of inbound device messages, e.g. to shadow test a
+	// new processing pipeline with production traffic.  Mirroring is asynchronous and never affects the primary
+	// dispatch of messages to listeners.  Duplicates dropped by deduplication are not mirrored.
+	MirrorSink MirrorSink `json:"-"`
+
+	// MirrorPercentage is the percentage, greater than 0 and at most 100, of inbound messages that are
+	// mirrored.  If not supplied, DefaultMirrorPercentage is used.  This option is ignored unless MirrorSink is set.
+	MirrorPercentage float64
+
+	// MirrorMaxPending is the maximum number of mirrored messages that may be waiting on the MirrorSink.
+	// Further messages are dropped, so that a slow sink cannot slow down devices.  If not supplied,
+	// DefaultMirrorMaxPending is used.  This option is ignored unless MirrorSink is set.
+	MirrorMaxPending int
+
+	// ForwardTTL enables store-and-forward of messages routed to devices which are not connected, e.g. during a
+	// short reconnect.  Messages are retained for this length of time and sent once the device reconnects, ahead of
+	// any message routed to it afterward.  Routing a retained message returns ErrorDeviceForwarded.  Only messages
+	// which do not await a response, i.e. those without a transaction key, are retained.  Retained messages are
+	// discarded, and the spill directory removed, once the Manager is drained.  If not supplied, messages routed to
+	// disconnected devices are rejected with ErrorDeviceNotFound.
+	ForwardTTL time.Duration
+
+	// ForwardMaxMessages is the maximum number of messages retained for any one device.  If not supplied,
+	// DefaultForwardMaxMessages is used.  This option is ignored unless ForwardTTL is set.
+	ForwardMaxMessages int
+
+	// ForwardMaxMemory is the maximum number of bytes of retained messages held in memory.  If not supplied,
+	// DefaultForwardMaxMemory is used.  This option is ignored unless ForwardTTL is set.
+	ForwardMaxMemory int
+
+	// ForwardSpillDirectory, if supplied, is where retained messages are written once ForwardMaxMemory is
+	// reached.  Otherwise, such messages are rejected.  This option is ignored unless ForwardTTL is set.
+	ForwardSpillDirectory string
+
+	// ForwardMaxSpill is the maximum number of bytes of retained messages written to the ForwardSpillDirectory.
+	// If not supplied, DefaultForwardMaxSpill is used.  This option is ignored unless ForwardSpillDirectory is set.
+	ForwardMaxSpill int
+
+	// Gate, if supplied, controls the admission of new device connections.  While the Gate is closed,
+	// connection attempts are rejected with the Gate's RejectStatus.  Existing connections are unaffected.
+	Gate *Gate `json:"-"`
+
+	// MetricsProvider is the source of the metrics declared by Metrics.  If not supplied,
+	// metrics are discarded.
+	MetricsProvider xmetrics.Provider
+
+	// Clock is the source of time for pings, keepalives, and draining.  If not supplied,
+	// SystemClock() is used.  Tests may supply a fake Clock, such as devicetest.Clock.
+	Clock Clock `json:"-"`
 }
 
 func (o *Options) deviceMessageQueueSize() int {
@@ -100,6 +287,25 @@ func (o *Options) deviceMessageQueueSize() int {
 	return DefaultDeviceMessageQueueSize
 }
 
+func (o *Options) qosWeights() qosWeights {
+	weights := qosWeights{
+		wrp.QOSLow:      DefaultQOSLowWeight,
+		wrp.QOSMedium:   DefaultQOSMediumWeight,
+		wrp.QOSHigh:     DefaultQOSHighWeight,
+		wrp.QOSCritical: DefaultQOSCriticalWeight,
+	}
+
+	if o != nil {
+		for level, weight := range o.QOSWeights {
+			if level < len(weights) && weight > 0 {
+				weights[level] = weight
+			}
+		}
+	}
+
+	return weights
+}
+
 func (o *Options) handshakeTimeout() time.Duration {
 	if o != nil && o.HandshakeTimeout > 0 {
 		return o.HandshakeTimeout
@@ -197,6 +403,55 @@ func (o *Options) subprotocols() (subprotocols []string) {
 	return
 }
 
+func (o *Options) checkOrigin() func(*http.Request) bool {
+	if o != nil {
+		return o.CheckOrigin
+	}
+
+	return nil
+}
+
+// responseHeader returns a copy of the ResponseHeader with canonical names, since configuration
+// sources such as Viper do not preserve the case of keys
+func (o *Options) responseHeader() http.Header {
+	if o == nil || len(o.ResponseHeader) == 0 {
+		return nil
+	}
+
+	header := make(http.Header, len(o.ResponseHeader))
+	for name, values := range o.ResponseHeader {
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+
+	return header
+}
+
+func (o *Options) upgradeHook() UpgradeHook {
+	if o != nil {
+		return o.UpgradeHook
+	}
+
+	return nil
+}
+
+func (o *Options) idExtractor() IDExtractor {
+	if o != nil {
+		return o.IDExtractor
+	}
+
+	return nil
+}
+
+func (o *Options) connectAuthenticator() ConnectAuthenticator {
+	if o != nil {
+		return o.ConnectAuthenticator
+	}
+
+	return nil
+}
+
 func (o *Options) keyFunc() KeyFunc {
 	if o != nil && o.KeyFunc != nil {
 		return o.KeyFunc
@@ -220,3 +475,231 @@ func (o *Options) listeners() []Listener {
 
 	return nil
 }
+
+func (o *Options) profileLabels() bool {
+	return o != nil && o.ProfileLabels
+}
+
+func (o *Options) profileBuckets() int {
+	if o != nil && o.ProfileBuckets > 0 {
+		return o.ProfileBuckets
+	}
+
+	return DefaultProfileBuckets
+}
+
+func (o *Options) profilePartners() []string {
+	if o != nil {
+		return o.ProfilePartners
+	}
+
+	return nil
+}
+
+func (o *Options) keepalivePeriod() time.Duration {
+	if o != nil && o.KeepalivePeriod > 0 {
+		return o.KeepalivePeriod
+	}
+
+	return 0
+}
+
+func (o *Options) keepaliveTimeout() time.Duration {
+	if o != nil && o.KeepaliveTimeout > 0 {
+		return o.KeepaliveTimeout
+	}
+
+	return DefaultKeepaliveTimeoutPeriods * o.keepalivePeriod()
+}
+
+func (o *Options) disconnectHistorySize() int {
+	if o != nil && o.DisconnectHistorySize != 0 {
+		return o.DisconnectHistorySize
+	}
+
+	return DefaultDisconnectHistorySize
+}
+
+func (o *Options) disconnectHistoryTTL() time.Duration {
+	if o != nil && o.DisconnectHistoryTTL > 0 {
+		return o.DisconnectHistoryTTL
+	}
+
+	return DefaultDisconnectHistoryTTL
+}
+
+func (o *Options) dedupeWindow() time.Duration {
+	if o != nil && o.DedupeWindow > 0 {
+		return o.DedupeWindow
+	}
+
+	return 0
+}
+
+func (o *Options) dedupeSize() int {
+	if o != nil && o.DedupeSize > 0 {
+		return o.DedupeSize
+	}
+
+	return DefaultDedupeSize
+}
+
+func (o *Options) dedupeHashing() *wrp.Hashing {
+	if o != nil {
+		return o.DedupeHashing
+	}
+
+	return nil
+}
+
+func (o *Options) maxMessageSize() int {
+	if o != nil && o.MaxMessageSize > 0 {
+		return o.MaxMessageSize
+	}
+
+	return 0
+}
+
+func (o *Options) maxPayloadSize() int {
+	if o != nil && o.MaxPayloadSize > 0 {
+		return o.MaxPayloadSize
+	}
+
+	return 0
+}
+
+func (o *Options) allowedMessageTypes() []string {
+	if o != nil {
+		return o.AllowedMessageTypes
+	}
+
+	return nil
+}
+
+func (o *Options) inboundRate() float64 {
+	if o != nil && o.InboundRate > 0 {
+		return o.InboundRate
+	}
+
+	return 0
+}
+
+func (o *Options) inboundBurst() int {
+	if o != nil && o.InboundBurst > 0 {
+		return o.InboundBurst
+	}
+
+	return DefaultInboundBurst
+}
+
+func (o *Options) disconnectOnPolicyViolation() bool {
+	return o != nil && o.DisconnectOnPolicyViolation
+}
+
+func (o *Options) eventHistorySize() int {
+	if o != nil && o.EventHistorySize > 0 {
+		return o.EventHistorySize
+	}
+
+	return 0
+}
+
+func (o *Options) dispatchTimeout() time.Duration {
+	if o != nil && o.DispatchTimeout > 0 {
+		return o.DispatchTimeout
+	}
+
+	return 0
+}
+
+func (o *Options) dispatchTimeoutResponse() bool {
+	return o != nil && o.DispatchTimeoutResponse
+}
+
+func (o *Options) mirrorSink() MirrorSink {
+	if o != nil {
+		return o.MirrorSink
+	}
+
+	return nil
+}
+
+func (o *Options) mirrorPercentage() float64 {
+	if o != nil && o.MirrorPercentage > 0 && o.MirrorPercentage <= 100 {
+		return o.MirrorPercentage
+	}
+
+	return DefaultMirrorPercentage
+}
+
+func (o *Options) mirrorMaxPending() int {
+	if o != nil && o.MirrorMaxPending > 0 {
+		return o.MirrorMaxPending
+	}
+
+	return DefaultMirrorMaxPending
+}
+
+func (o *Options) forwardTTL() time.Duration {
+	if o != nil && o.ForwardTTL > 0 {
+		return o.ForwardTTL
+	}
+
+	return 0
+}
+
+func (o *Options) forwardMaxMessages() int {
+	if o != nil && o.ForwardMaxMessages > 0 {
+		return o.ForwardMaxMessages
+	}
+
+	return DefaultForwardMaxMessages
+}
+
+func (o *Options) forwardMaxMemory() int {
+	if o != nil && o.ForwardMaxMemory > 0 {
+		return o.ForwardMaxMemory
+	}
+
+	return DefaultForwardMaxMemory
+}
+
+func (o *Options) forwardSpillDirectory() string {
+	if o != nil {
+		return o.ForwardSpillDirectory
+	}
+
+	return ""
+}
+
+func (o *Options) forwardMaxSpill() int {
+	if o != nil && o.ForwardMaxSpill > 0 {
+		return o.ForwardMaxSpill
+	}
+
+	return DefaultForwardMaxSpill
+}
+
+func (o *Options) gate() *Gate {
+	if o != nil {
+		return o.Gate
+	}
+
+	return nil
+}
+
+func (o *Options) metricsProvider() xmetrics.Provider {
+	if o != nil && o.MetricsProvider != nil {
+		return o.MetricsProvider
+	}
+
+	return xmetrics.NewDiscardProvider()
+}
+
+func (o *Options) clock() Clock {
+	if o != nil && o.Clock != nil {
+		return o.Clock
+	}
+
+	return SystemClock()
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/Comcast/webpa-common/xmetrics"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,6 +18,7 @@ func TestOptionsDefault(t *testing.T) {
 		t.Log(o)
 
 		assert.Equal(DefaultDeviceMessageQueueSize, o.deviceMessageQueueSize())
+		assert.Equal(qosWeights{DefaultQOSLowWeight, DefaultQOSMediumWeight, DefaultQOSHighWeight, DefaultQOSCriticalWeight}, o.qosWeights())
 		assert.Equal(DefaultHandshakeTimeout, o.handshakeTimeout())
 		assert.Equal(DefaultDecoderPoolSize, o.decoderPoolSize())
 		assert.Equal(DefaultEncoderPoolSize, o.encoderPoolSize())
@@ -27,16 +30,52 @@ func TestOptionsDefault(t *testing.T) {
 		assert.Equal(DefaultReadBufferSize, o.readBufferSize())
 		assert.Equal(DefaultWriteBufferSize, o.writeBufferSize())
 		assert.Empty(o.subprotocols())
+		assert.Nil(o.checkOrigin())
+		assert.Nil(o.responseHeader())
+		assert.Nil(o.upgradeHook())
+		assert.Nil(o.idExtractor())
+		assert.Nil(o.connectAuthenticator())
 		assert.NotNil(o.keyFunc())
 		assert.NotNil(o.logger())
 		assert.Empty(o.listeners())
+		assert.False(o.profileLabels())
+		assert.Equal(DefaultProfileBuckets, o.profileBuckets())
+		assert.Empty(o.profilePartners())
+		assert.Zero(o.keepalivePeriod())
+		assert.Zero(o.keepaliveTimeout())
+		assert.Equal(DefaultDisconnectHistorySize, o.disconnectHistorySize())
+		assert.Equal(DefaultDisconnectHistoryTTL, o.disconnectHistoryTTL())
+		assert.Zero(o.dedupeWindow())
+		assert.Equal(DefaultDedupeSize, o.dedupeSize())
+		assert.Nil(o.dedupeHashing())
+		assert.Zero(o.maxMessageSize())
+		assert.Zero(o.maxPayloadSize())
+		assert.Empty(o.allowedMessageTypes())
+		assert.Zero(o.inboundRate())
+		assert.Equal(DefaultInboundBurst, o.inboundBurst())
+		assert.False(o.disconnectOnPolicyViolation())
+		assert.Zero(o.eventHistorySize())
+		assert.Zero(o.dispatchTimeout())
+		assert.False(o.dispatchTimeoutResponse())
+		assert.Nil(o.mirrorSink())
+		assert.Equal(DefaultMirrorPercentage, o.mirrorPercentage())
+		assert.Equal(DefaultMirrorMaxPending, o.mirrorMaxPending())
+		assert.Zero(o.forwardTTL())
+		assert.Equal(DefaultForwardMaxMessages, o.forwardMaxMessages())
+		assert.Equal(DefaultForwardMaxMemory, o.forwardMaxMemory())
+		assert.Empty(o.forwardSpillDirectory())
+		assert.Equal(DefaultForwardMaxSpill, o.forwardMaxSpill())
+		assert.Nil(o.gate())
+		assert.NotNil(o.metricsProvider())
+		assert.Equal(SystemClock(), o.clock())
 	}
 }
 
 func TestOptions(t *testing.T) {
 	var (
-		assert         = assert.New(t)
-		expectedLogger = logging.DefaultLogger()
+		assert          = assert.New(t)
+		expectedLogger  = logging.DefaultLogger()
+		expectedMetrics = xmetrics.NewDiscardProvider()
 
 		expectedKey     = Key("TestOptions key")
 		expectedKeyFunc = func(ID, Convey, *http.Request) (Key, error) {
@@ -44,25 +83,60 @@ func TestOptions(t *testing.T) {
 		}
 
 		o = Options{
-			HandshakeTimeout:       DefaultHandshakeTimeout + 12377123*time.Second,
-			DecoderPoolSize:        672393,
-			EncoderPoolSize:        1034571,
-			InitialCapacity:        DefaultInitialCapacity + 4719,
-			ReadBufferSize:         DefaultReadBufferSize + 48729,
-			WriteBufferSize:        DefaultWriteBufferSize + 926,
-			Subprotocols:           []string{"foobar"},
-			DeviceMessageQueueSize: DefaultDeviceMessageQueueSize + 287342,
-			IdlePeriod:             DefaultIdlePeriod + 3472*time.Minute,
-			PingPeriod:             DefaultPingPeriod + 384*time.Millisecond,
-			AuthDelay:              DefaultAuthDelay + 88*time.Millisecond,
-			WriteTimeout:           DefaultWriteTimeout + 327193*time.Second,
-			KeyFunc:                expectedKeyFunc,
-			Logger:                 expectedLogger,
-			Listeners:              []Listener{func(*Event) {}},
+			HandshakeTimeout:            DefaultHandshakeTimeout + 12377123*time.Second,
+			DecoderPoolSize:             672393,
+			EncoderPoolSize:             1034571,
+			InitialCapacity:             DefaultInitialCapacity + 4719,
+			ReadBufferSize:              DefaultReadBufferSize + 48729,
+			WriteBufferSize:             DefaultWriteBufferSize + 926,
+			Subprotocols:                []string{"foobar"},
+			CheckOrigin:                 func(*http.Request) bool { return true },
+			ResponseHeader:              http.Header{"x-webpa-node": {"node1"}},
+			UpgradeHook:                 UpgradeHookFunc(func(ID, Convey, *http.Request, http.Header) {}),
+			DeviceMessageQueueSize:      DefaultDeviceMessageQueueSize + 287342,
+			QOSWeights:                  []int{3, 5, 7, 11},
+			IdlePeriod:                  DefaultIdlePeriod + 3472*time.Minute,
+			PingPeriod:                  DefaultPingPeriod + 384*time.Millisecond,
+			AuthDelay:                   DefaultAuthDelay + 88*time.Millisecond,
+			WriteTimeout:                DefaultWriteTimeout + 327193*time.Second,
+			IDExtractor:                 HeaderIDExtractor(""),
+			KeyFunc:                     expectedKeyFunc,
+			Logger:                      expectedLogger,
+			Listeners:                   []Listener{func(*Event) {}},
+			ProfileLabels:               true,
+			ProfileBuckets:              DefaultProfileBuckets + 17,
+			ProfilePartners:             []string{"comcast"},
+			KeepalivePeriod:             30 * time.Second,
+			KeepaliveTimeout:            47 * time.Second,
+			DisconnectHistorySize:       -1,
+			DisconnectHistoryTTL:        15 * time.Minute,
+			DedupeWindow:                2 * time.Minute,
+			DedupeSize:                  DefaultDedupeSize + 12,
+			DedupeHashing:               &wrp.Hashing{ExcludedMetadata: []string{"/trace"}},
+			MaxMessageSize:              65536,
+			MaxPayloadSize:              32768,
+			AllowedMessageTypes:         []string{"SimpleEvent"},
+			InboundRate:                 2.5,
+			InboundBurst:                DefaultInboundBurst + 3,
+			DisconnectOnPolicyViolation: true,
+			EventHistorySize:            50,
+			DispatchTimeout:             5 * time.Second,
+			DispatchTimeoutResponse:     true,
+			MirrorSink:                  new(ListenerMirrorSink),
+			MirrorPercentage:            12.5,
+			MirrorMaxPending:            DefaultMirrorMaxPending + 17,
+			ForwardTTL:                  2 * time.Minute,
+			ForwardMaxMessages:          DefaultForwardMaxMessages + 5,
+			ForwardMaxMemory:            1024,
+			ForwardSpillDirectory:       "/var/spool/forward",
+			ForwardMaxSpill:             4096,
+			Gate:                        NewGate(nil),
+			MetricsProvider:             expectedMetrics,
 		}
 	)
 
 	assert.Equal(o.DeviceMessageQueueSize, o.deviceMessageQueueSize())
+	assert.Equal(qosWeights{3, 5, 7, 11}, o.qosWeights())
 	assert.Equal(o.HandshakeTimeout, o.handshakeTimeout())
 	assert.Equal(o.DecoderPoolSize, o.decoderPoolSize())
 	assert.Equal(o.EncoderPoolSize, o.encoderPoolSize())
@@ -74,8 +148,41 @@ func TestOptions(t *testing.T) {
 	assert.Equal(o.ReadBufferSize, o.readBufferSize())
 	assert.Equal(o.WriteBufferSize, o.writeBufferSize())
 	assert.Equal(o.Subprotocols, o.subprotocols())
+	assert.NotNil(o.checkOrigin())
+	assert.Equal(http.Header{"X-Webpa-Node": {"node1"}}, o.responseHeader())
+	assert.NotNil(o.upgradeHook())
 	assert.Equal(expectedLogger, o.logger())
+	assert.NotNil(o.idExtractor())
 	assert.Equal(o.Listeners, o.listeners())
+	assert.True(o.profileLabels())
+	assert.Equal(o.ProfileBuckets, o.profileBuckets())
+	assert.Equal(o.ProfilePartners, o.profilePartners())
+	assert.Equal(o.KeepalivePeriod, o.keepalivePeriod())
+	assert.Equal(o.KeepaliveTimeout, o.keepaliveTimeout())
+	assert.Equal(o.DisconnectHistorySize, o.disconnectHistorySize())
+	assert.Equal(o.DisconnectHistoryTTL, o.disconnectHistoryTTL())
+	assert.Equal(o.DedupeWindow, o.dedupeWindow())
+	assert.Equal(o.DedupeSize, o.dedupeSize())
+	assert.Equal(o.DedupeHashing, o.dedupeHashing())
+	assert.Equal(o.MaxMessageSize, o.maxMessageSize())
+	assert.Equal(o.MaxPayloadSize, o.maxPayloadSize())
+	assert.Equal(o.AllowedMessageTypes, o.allowedMessageTypes())
+	assert.Equal(o.InboundRate, o.inboundRate())
+	assert.Equal(o.InboundBurst, o.inboundBurst())
+	assert.True(o.disconnectOnPolicyViolation())
+	assert.Equal(o.EventHistorySize, o.eventHistorySize())
+	assert.Equal(o.DispatchTimeout, o.dispatchTimeout())
+	assert.True(o.dispatchTimeoutResponse())
+	assert.Equal(o.MirrorSink, o.mirrorSink())
+	assert.Equal(o.MirrorPercentage, o.mirrorPercentage())
+	assert.Equal(o.MirrorMaxPending, o.mirrorMaxPending())
+	assert.Equal(o.ForwardTTL, o.forwardTTL())
+	assert.Equal(o.ForwardMaxMessages, o.forwardMaxMessages())
+	assert.Equal(o.ForwardMaxMemory, o.forwardMaxMemory())
+	assert.Equal(o.ForwardSpillDirectory, o.forwardSpillDirectory())
+	assert.Equal(o.ForwardMaxSpill, o.forwardMaxSpill())
+	assert.Equal(o.Gate, o.gate())
+	assert.Equal(expectedMetrics, o.metricsProvider())
 
 	actualKeyFunc := o.keyFunc()
 	if assert.NotNil(actualKeyFunc) {
@@ -84,3 +191,22 @@ func TestOptions(t *testing.T) {
 		assert.Nil(err)
 	}
 }
+
+func TestOptionsInvalidMirrorPercentage(t *testing.T) {
+	assert := assert.New(t)
+	for _, percentage := range []float64{-1, 0, 100.5} {
+		assert.Equal(DefaultMirrorPercentage, (&Options{MirrorPercentage: percentage}).mirrorPercentage())
+	}
+}
+
+func TestOptionsDefaultKeepaliveTimeout(t *testing.T) {
+	assert := assert.New(t)
+	o := Options{KeepalivePeriod: 10 * time.Second}
+	assert.Equal(DefaultKeepaliveTimeoutPeriods*o.KeepalivePeriod, o.keepaliveTimeout())
+}
+
+func TestOptionsPartialQOSWeights(t *testing.T) {
+	assert := assert.New(t)
+	o := Options{QOSWeights: []int{0, 3, -1, 20, 50}}
+	assert.Equal(qosWeights{DefaultQOSLowWeight, 3, DefaultQOSHighWeight, 20}, o.qosWeights())
+}
@@ -0,0 +1,35 @@
+package device
+
+import (
+	"github.com/Comcast/webpa-common/wrp"
+)
+
+const (
+	// PartnerIDAttribute is the ConnectAuthentication attribute which, when set to a string, establishes the
+	// partner of a device.  A ConnectAuthenticator sets this from a trusted source, e.g. a claim of the device's JWT.
+	PartnerIDAttribute = "partner-id"
+)
+
+// partnerID determines the partner of a connecting device from its authenticated attributes.  Anything the
+// device supplies about itself, such as its convey or HTTP headers, is never consulted, since a device could
+// then claim any partner.  The empty string is returned if the device has no authenticated partner.
+func partnerID(attributes map[string]interface{}) string {
+	partner, _ := attributes[PartnerIDAttribute].(string)
+	return partner
+}
+
+// stampPartner records a device's partner in a message received from that device, replacing any partner the
+// device claimed for itself.  If the message changes, it is encoded again and the new frame is returned.
+// Otherwise, the original frame is returned.
+func stampPartner(d *device, message *wrp.Message, frame []byte) ([]byte, error) {
+	if !wrp.SetPartnerID(message, d.partner) {
+		return frame, nil
+	}
+
+	var stamped []byte
+	if err := wrp.NewEncoderBytes(&stamped, wrp.Msgpack).Encode(message); err != nil {
+		return nil, err
+	}
+
+	return stamped, nil
+}
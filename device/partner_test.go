@@ -0,0 +1,143 @@
+package device
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartnerID(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(partnerID(nil))
+	assert.Empty(partnerID(map[string]interface{}{}))
+	assert.Empty(partnerID(map[string]interface{}{PartnerIDAttribute: 123}))
+	assert.Equal("attribute", partnerID(map[string]interface{}{PartnerIDAttribute: "attribute"}))
+}
+
+func TestStampPartner(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		d       = &device{partner: "comcast"}
+		message = &wrp.Message{Type: wrp.SimpleEventMessageType, Destination: "event:test"}
+		frame   = wrp.MustEncode(message, wrp.Msgpack)
+	)
+
+	stamped, err := stampPartner(d, message, frame)
+	require.NoError(err)
+	assert.Equal("comcast", wrp.PartnerID(message))
+
+	var decoded wrp.Message
+	require.NoError(wrp.NewDecoderBytes(stamped, wrp.Msgpack).Decode(&decoded))
+	assert.Equal("comcast", wrp.PartnerID(&decoded))
+
+	// a message which already has the device's partner is untouched
+	unchanged, err := stampPartner(d, message, stamped)
+	require.NoError(err)
+	assert.True(&stamped[0] == &unchanged[0])
+
+	// a device without a partner cannot claim one
+	d.partner = ""
+	stamped, err = stampPartner(d, message, stamped)
+	require.NoError(err)
+	assert.Empty(wrp.PartnerID(message))
+}
+
+func TestManagerPartner(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		connects = make(chan Interface, 1)
+		received = make(chan *Event, 1)
+		options  = &Options{
+			Logger:    &logging.LoggerWriter{Writer: ioutil.Discard},
+			AuthDelay: time.Millisecond,
+			ConnectAuthenticator: ConnectAuthenticatorFunc(func(id ID, convey Convey, request *http.Request) (ConnectAuthentication, error) {
+				// only the authenticator can establish a partner, so claims from the device itself are ignored
+				if request.Header.Get("X-Test-Authenticated") != "true" {
+					return ConnectAuthentication{Allow: true}, nil
+				}
+
+				return ConnectAuthentication{
+					Allow:      true,
+					Attributes: map[string]interface{}{PartnerIDAttribute: "comcast"},
+				}, nil
+			}),
+			Listeners: []Listener{
+				func(e *Event) {
+					switch e.Type {
+					case Connect:
+						connects <- e.Device
+					case MessageReceived:
+						// events are reused, so a copy must be made
+						copyOf := *e
+						copyOf.Contents = append([]byte(nil), e.Contents...)
+						received <- &copyOf
+					}
+				},
+			},
+		}
+
+		_, server, connectURL = startWebsocketServer(options)
+	)
+
+	defer server.Close()
+
+	// a device cannot claim a partner for itself
+	unauthenticated, _, err := NewDialer(options, nil).Dial(
+		connectURL,
+		"mac:665544332211",
+		nil,
+		http.Header{"X-Webpa-Partner-Id": []string{"cox"}},
+	)
+
+	require.NoError(err)
+	defer unauthenticated.Close()
+
+	select {
+	case d := <-connects:
+		assert.Empty(d.Partner())
+	case <-time.After(5 * time.Second):
+		require.Fail("The device did not connect")
+	}
+
+	header := http.Header{"X-Test-Authenticated": []string{"true"}}
+	connection, _, err := NewDialer(options, nil).Dial(connectURL, "mac:112233445566", nil, header)
+	require.NoError(err)
+	defer connection.Close()
+
+	select {
+	case d := <-connects:
+		assert.Equal("comcast", d.Partner())
+	case <-time.After(5 * time.Second):
+		require.Fail("The device did not connect")
+	}
+
+	// the device cannot impersonate another partner
+	require.NoError(writeMessage(&wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "mac:112233445566",
+		Destination: "event:test",
+		Metadata:    map[string]string{wrp.PartnerIDMetadataKey: "cox"},
+	}, connection))
+
+	select {
+	case e := <-received:
+		assert.Equal("comcast", wrp.PartnerID(e.Message.(*wrp.Message)))
+
+		var decoded wrp.Message
+		require.NoError(wrp.NewDecoderBytes(e.Contents, wrp.Msgpack).Decode(&decoded))
+		assert.Equal("comcast", wrp.PartnerID(&decoded))
+	case <-time.After(5 * time.Second):
+		assert.Fail("No message was received")
+	}
+}
@@ -0,0 +1,94 @@
+package device
+
+import (
+	"sync"
+
+	"github.com/Comcast/webpa-common/wrp"
+)
+
+// PreparedMessage is a WRP message which is encoded at most once per format, no matter how many devices it
+// is sent to.  Similar to websocket.PreparedMessage, this type is useful when broadcasting the same message
+// to many devices, as the encoded bytes are shared by every Request created from it.
+//
+// The message must not be modified once prepared, and the encoded bytes must be treated as read-only.  For that
+// reason, prepared requests are sent directly to devices rather than through Manager.Route, which may add
+// tracing metadata to a message.
+type PreparedMessage struct {
+	message   wrp.Typed
+	encodings []preparedEncoding
+}
+
+// preparedEncoding is the encoding of a PreparedMessage in a single format
+type preparedEncoding struct {
+	once     sync.Once
+	contents []byte
+	err      error
+}
+
+// NewPreparedMessage prepares a WRP message for sending to multiple devices.  No encoding is done until
+// the message is first sent or its bytes are requested.
+func NewPreparedMessage(message wrp.Typed) *PreparedMessage {
+	return &PreparedMessage{
+		message:   message,
+		encodings: make([]preparedEncoding, len(wrp.Formats())),
+	}
+}
+
+// Message returns the WRP message which was prepared
+func (pm *PreparedMessage) Message() wrp.Typed {
+	return pm.message
+}
+
+// encode produces the message in the given format
+func (pm *PreparedMessage) encode(f wrp.Format) ([]byte, error) {
+	var contents []byte
+	if err := wrp.NewEncoderBytes(&contents, f).Encode(pm.message); err != nil {
+		return nil, err
+	}
+
+	return contents, nil
+}
+
+// Bytes returns the message encoded in the given format, encoding it only the first time a format is requested.
+// Formats registered after this message was prepared are encoded each time.
+func (pm *PreparedMessage) Bytes(f wrp.Format) ([]byte, error) {
+	if f < 0 || int(f) >= len(pm.encodings) {
+		return pm.encode(f)
+	}
+
+	encoding := &pm.encodings[f]
+	encoding.once.Do(func() {
+		encoding.contents, encoding.err = pm.encode(f)
+	})
+
+	return encoding.contents, encoding.err
+}
+
+// Request creates a new Request for this message, whose Contents are the shared Msgpack encoding
+// that devices receive.  Each device requires its own Request, as the Manager tracks each delivery separately.
+func (pm *PreparedMessage) Request() (*Request, error) {
+	contents, err := pm.Bytes(wrp.Msgpack)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Request{
+		Message:  pm.message,
+		Format:   wrp.Msgpack,
+		Contents: contents,
+	}, nil
+}
+
+// Send sends this message to a device without encoding it again.  Typically, this method is invoked
+// by a visitor passed to one of the Registry's visit methods:
+//
+//	prepared := device.NewPreparedMessage(message)
+//	manager.VisitConcurrently(0, func(d device.Interface) { prepared.Send(d) })
+func (pm *PreparedMessage) Send(d Interface) (*Response, error) {
+	request, err := pm.Request()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Send(request)
+}
@@ -0,0 +1,77 @@
+package device
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreparedMessage(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		message  = &wrp.SimpleEvent{Source: "dns:talaria", Destination: "event:broadcast", Payload: []byte("hello")}
+		prepared = NewPreparedMessage(message)
+	)
+
+	assert.Equal(message, prepared.Message())
+
+	for _, f := range []wrp.Format{wrp.Msgpack, wrp.JSON} {
+		first, err := prepared.Bytes(f)
+		require.NoError(err)
+		assert.Equal(wrp.MustEncode(message, f), first)
+
+		// the encoded bytes are shared, rather than encoded again
+		second, err := prepared.Bytes(f)
+		require.NoError(err)
+		assert.True(&first[0] == &second[0])
+	}
+
+	first, err := prepared.Request()
+	require.NoError(err)
+	second, err := prepared.Request()
+	require.NoError(err)
+
+	assert.False(first == second, "Each device requires its own Request")
+	assert.Equal(message, first.Message)
+	assert.Equal(wrp.Msgpack, first.Format)
+	assert.Equal(wrp.MustEncode(message, wrp.Msgpack), first.Contents)
+	assert.True(&first.Contents[0] == &second.Contents[0])
+}
+
+func TestPreparedMessageSend(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		prepared = NewPreparedMessage(&wrp.SimpleEvent{Destination: "event:broadcast", Payload: []byte("hello")})
+		expected = errors.New("expected")
+
+		devices = []*mockDevice{new(mockDevice), new(mockDevice)}
+	)
+
+	contents, err := prepared.Bytes(wrp.Msgpack)
+	assert.NoError(err)
+
+	sharesContents := mock.MatchedBy(func(request *Request) bool {
+		return request.Format == wrp.Msgpack && &request.Contents[0] == &contents[0]
+	})
+
+	devices[0].On("Send", sharesContents).Return(nil, nil).Once()
+	devices[1].On("Send", sharesContents).Return(nil, expected).Once()
+
+	response, err := prepared.Send(devices[0])
+	assert.Nil(response)
+	assert.NoError(err)
+
+	response, err = prepared.Send(devices[1])
+	assert.Nil(response)
+	assert.Equal(expected, err)
+
+	for _, d := range devices {
+		d.AssertExpectations(t)
+	}
+}
@@ -0,0 +1,66 @@
+package device
+
+import (
+	"context"
+	"hash/fnv"
+	"runtime/pprof"
+	"strconv"
+)
+
+const (
+	// ProfileBucketLabel is the pprof label holding the hash bucket of a device's ID
+	ProfileBucketLabel = "device.bucket"
+
+	// ProfilePartnerLabel is the pprof label holding the partner of a device
+	ProfilePartnerLabel = "device.partner"
+
+	// ProfilePumpLabel is the pprof label identifying the pump goroutine, either "read" or "write"
+	ProfilePumpLabel = "device.pump"
+
+	// UnknownPartner is the partner label used when a device supplies no partner
+	UnknownPartner = "unknown"
+
+	// OtherPartner is the partner label used when a device's partner is not one of the configured
+	// profile partners
+	OtherPartner = "other"
+)
+
+// profileBucket hashes a device ID into one of a fixed number of buckets.  Bucketing
+// keeps the cardinality of profiling labels bounded regardless of the number of devices.
+func profileBucket(id ID, buckets int) string {
+	hash := fnv.New32a()
+	hash.Write(id.Bytes())
+	return strconv.FormatUint(uint64(hash.Sum32()%uint32(buckets)), 10)
+}
+
+// profileLabels produces the pprof label pairs describing a connecting device.  Partners are supplied
+// by devices, so any partner not in the known set is collapsed into OtherPartner to keep the
+// cardinality of the partner label bounded.
+func profileLabels(id ID, partner string, buckets int, known map[string]bool) []string {
+	if len(partner) == 0 {
+		partner = UnknownPartner
+	} else if !known[partner] {
+		partner = OtherPartner
+	}
+
+	return []string{
+		ProfileBucketLabel, profileBucket(id, buckets),
+		ProfilePartnerLabel, partner,
+	}
+}
+
+// goLabeled runs the given pump in its own goroutine.  If labels is nonempty, the goroutine
+// is tagged with those labels along with a label for the pump name, so that CPU profiles
+// attribute time spent in the pump to device cohorts.
+func goLabeled(labels []string, pump string, f func()) {
+	if len(labels) == 0 {
+		go f()
+		return
+	}
+
+	go pprof.Do(
+		context.Background(),
+		pprof.Labels(append(labels, ProfilePumpLabel, pump)...),
+		func(context.Context) { f() },
+	)
+}
@@ -0,0 +1,69 @@
+package device
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, buckets := range []int{1, 2, 16, 1000} {
+		for id := range testDeviceIDs {
+			t.Logf("buckets=%d, id=%s", buckets, id)
+			bucket := profileBucket(id, buckets)
+			assert.Equal(bucket, profileBucket(id, buckets))
+
+			value, err := strconv.Atoi(bucket)
+			assert.NoError(err)
+			assert.True(value >= 0 && value < buckets)
+		}
+	}
+}
+
+func TestProfileLabels(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		id     = ID("mac:112233445566")
+		known  = map[string]bool{"comcast": true}
+	)
+
+	assert.Equal(
+		[]string{ProfileBucketLabel, profileBucket(id, 16), ProfilePartnerLabel, UnknownPartner},
+		profileLabels(id, "", 16, known),
+	)
+
+	assert.Equal(
+		[]string{ProfileBucketLabel, profileBucket(id, 16), ProfilePartnerLabel, "comcast"},
+		profileLabels(id, "comcast", 16, known),
+	)
+
+	assert.Equal(
+		[]string{ProfileBucketLabel, profileBucket(id, 16), ProfilePartnerLabel, OtherPartner},
+		profileLabels(id, "some-arbitrary-partner", 16, known),
+	)
+
+	assert.Equal(
+		[]string{ProfileBucketLabel, profileBucket(id, 16), ProfilePartnerLabel, OtherPartner},
+		profileLabels(id, "comcast", 16, nil),
+	)
+}
+
+func TestGoLabeled(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, labels := range [][]string{nil, []string{ProfileBucketLabel, "1", ProfilePartnerLabel, "comcast"}} {
+		t.Logf("%v", labels)
+		done := make(chan struct{})
+		goLabeled(labels, "read", func() { close(done) })
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			assert.Fail("The function did not run")
+		}
+	}
+}
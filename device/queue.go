@@ -0,0 +1,144 @@
+package device
+
+import (
+	"sync/atomic"
+
+	"github.com/Comcast/webpa-common/wrp"
+)
+
+// qosWeights holds the weight of each wrp.QOSLevel, indexed by level
+type qosWeights [wrp.QOSLevels]int
+
+// closedReady is an always-ready channel, used to signal that a messageQueue has work waiting
+var closedReady = make(chan struct{})
+
+func init() {
+	close(closedReady)
+}
+
+// messageQueue holds the messages waiting to be written to a device, with one queue for each QOS level.
+// Levels are serviced using weighted round robin:  in each round, a level may send up to its weight in messages,
+// and higher levels are always serviced first.  Higher priority messages therefore preempt lower priority ones,
+// while lower priority messages are guaranteed their share of each round and cannot be starved.
+//
+// The queue as a whole holds at most its size in messages, no matter how they are spread across levels.
+// Each message occupies a slot from the time it is enqueued until the write pump dequeues it.
+//
+// Any goroutine may enqueue messages, but only the write pump may dequeue them.
+type messageQueue struct {
+	levels  [wrp.QOSLevels]chan *envelope
+	slots   chan struct{}
+	weights qosWeights
+	notify  chan struct{}
+
+	// held contains the message, if any, at the head of each level.  These fields are
+	// only accessed by the write pump, with the exception of heldCount.
+	held      [wrp.QOSLevels]*envelope
+	heldCount int32
+	credits   qosWeights
+}
+
+func newMessageQueue(size int, weights qosWeights) *messageQueue {
+	q := &messageQueue{
+		slots:   make(chan struct{}, size),
+		weights: weights,
+		notify:  make(chan struct{}, 1),
+		credits: weights,
+	}
+
+	// since the slots bound the total, no level can ever fill up
+	for level := range q.levels {
+		q.levels[level] = make(chan *envelope, size)
+	}
+
+	return q
+}
+
+// reserve returns the channel on which a slot is reserved for a message.  After a successful send
+// on that channel, a goroutine must invoke put with the message.
+func (q *messageQueue) reserve() chan<- struct{} {
+	return q.slots
+}
+
+// put enqueues a message, at its request's QOS level, in a previously reserved slot
+func (q *messageQueue) put(e *envelope) {
+	q.levels[e.request.QOSLevel()] <- e
+	q.signal()
+}
+
+// signal notifies the write pump that a message has been enqueued
+func (q *messageQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// len returns the total number of messages waiting, across all levels
+func (q *messageQueue) len() int {
+	count := int(atomic.LoadInt32(&q.heldCount))
+	for _, level := range q.levels {
+		count += len(level)
+	}
+
+	return count
+}
+
+// ready returns a channel which is ready when there may be messages to dequeue
+func (q *messageQueue) ready() <-chan struct{} {
+	if q.len() > 0 {
+		return closedReady
+	}
+
+	return q.notify
+}
+
+// fill moves the head of each level into held, without blocking
+func (q *messageQueue) fill() {
+	for level, held := range q.held {
+		if held != nil {
+			continue
+		}
+
+		select {
+		case e := <-q.levels[level]:
+			q.held[level] = e
+			atomic.AddInt32(&q.heldCount, 1)
+		default:
+		}
+	}
+}
+
+// take removes and returns the held message for a level
+func (q *messageQueue) take(level int) *envelope {
+	e := q.held[level]
+	q.held[level] = nil
+	atomic.AddInt32(&q.heldCount, -1)
+	<-q.slots
+	return e
+}
+
+// next dequeues the next message to write to the device, or returns nil if no messages are waiting
+func (q *messageQueue) next() *envelope {
+	q.fill()
+	for round := 0; round < 2; round++ {
+		for level := wrp.QOSLevels - 1; level >= 0; level-- {
+			if q.held[level] != nil && q.credits[level] > 0 {
+				q.credits[level]--
+				return q.take(level)
+			}
+		}
+
+		// every level with waiting messages has used up its share of this round
+		q.credits = q.weights
+	}
+
+	return nil
+}
+
+// drain dequeues all waiting messages without blocking, passing each message's request to the given function
+func (q *messageQueue) drain(f func(*Request)) {
+	for e := q.next(); e != nil; e = q.next() {
+		f(e.request)
+	}
+}
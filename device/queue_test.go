@@ -0,0 +1,152 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var defaultQOSWeights = (*Options)(nil).qosWeights()
+
+func testMessageQueueEnqueue(q *messageQueue, level wrp.QOSLevel, count int) {
+	for repeat := 0; repeat < count; repeat++ {
+		q.reserve() <- struct{}{}
+		q.put(&envelope{request: &Request{Message: &wrp.Message{QualityOfService: wrp.QOSValue(level) * 25}}})
+	}
+}
+
+func testMessageQueueLevels(q *messageQueue, count int) []wrp.QOSLevel {
+	var levels []wrp.QOSLevel
+	for repeat := 0; repeat < count; repeat++ {
+		e := q.next()
+		if e == nil {
+			break
+		}
+
+		levels = append(levels, e.request.QOSLevel())
+	}
+
+	return levels
+}
+
+func TestMessageQueueEmpty(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		q      = newMessageQueue(1, defaultQOSWeights)
+	)
+
+	assert.Zero(q.len())
+	assert.Nil(q.next())
+
+	select {
+	case <-q.ready():
+		assert.Fail("An empty queue should not be ready")
+	default:
+	}
+
+	q.drain(func(*Request) {
+		assert.Fail("An empty queue should not drain anything")
+	})
+}
+
+func TestMessageQueueReady(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		q       = newMessageQueue(5, defaultQOSWeights)
+	)
+
+	testMessageQueueEnqueue(q, wrp.QOSLow, 3)
+	assert.Equal(3, q.len())
+
+	// the queue stays ready until every message, including held messages, has been dequeued
+	for expected := 2; expected >= 0; expected-- {
+		select {
+		case <-q.ready():
+		default:
+			require.Fail("The queue should be ready")
+		}
+
+		require.NotNil(q.next())
+		assert.Equal(expected, q.len())
+	}
+
+	// a leftover notification wakes the write pump, but there is nothing to dequeue
+	<-q.ready()
+	assert.Nil(q.next())
+}
+
+func TestMessageQueueWeights(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		q      = newMessageQueue(20, qosWeights{1, 1, 2, 3})
+	)
+
+	testMessageQueueEnqueue(q, wrp.QOSLow, 3)
+	testMessageQueueEnqueue(q, wrp.QOSHigh, 3)
+	testMessageQueueEnqueue(q, wrp.QOSCritical, 5)
+	assert.Equal(11, q.len())
+
+	// each round, the critical level goes first, but every level gets its share
+	assert.Equal(
+		[]wrp.QOSLevel{
+			wrp.QOSCritical, wrp.QOSCritical, wrp.QOSCritical, wrp.QOSHigh, wrp.QOSHigh, wrp.QOSLow,
+			wrp.QOSCritical, wrp.QOSCritical, wrp.QOSHigh, wrp.QOSLow,
+			wrp.QOSLow,
+		},
+		testMessageQueueLevels(q, 20),
+	)
+
+	assert.Zero(q.len())
+}
+
+func TestMessageQueuePreemption(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		q      = newMessageQueue(20, defaultQOSWeights)
+	)
+
+	testMessageQueueEnqueue(q, wrp.QOSLow, 10)
+	assert.Equal([]wrp.QOSLevel{wrp.QOSLow, wrp.QOSLow}, testMessageQueueLevels(q, 2))
+
+	testMessageQueueEnqueue(q, wrp.QOSCritical, 1)
+	testMessageQueueEnqueue(q, wrp.QOSMedium, 1)
+	assert.Equal([]wrp.QOSLevel{wrp.QOSCritical, wrp.QOSMedium, wrp.QOSLow}, testMessageQueueLevels(q, 3))
+
+	var drained int
+	q.drain(func(request *Request) {
+		assert.Equal(wrp.QOSLow, request.QOSLevel())
+		drained++
+	})
+
+	assert.Equal(7, drained)
+	assert.Zero(q.len())
+}
+
+func TestMessageQueueSize(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		q      = newMessageQueue(3, defaultQOSWeights)
+	)
+
+	testMessageQueueEnqueue(q, wrp.QOSLow, 2)
+	testMessageQueueEnqueue(q, wrp.QOSCritical, 1)
+	assert.Equal(3, q.len())
+
+	// the size bounds the whole queue, not each level
+	select {
+	case q.reserve() <- struct{}{}:
+		assert.Fail("A full queue should not have a free slot")
+	default:
+	}
+
+	// held messages keep their slots until they are dequeued
+	q.fill()
+	assert.NotNil(q.next())
+	testMessageQueueEnqueue(q, wrp.QOSMedium, 1)
+	assert.Equal(3, q.len())
+	assert.Equal([]wrp.QOSLevel{wrp.QOSMedium, wrp.QOSLow, wrp.QOSLow}, testMessageQueueLevels(q, 3))
+	assert.Zero(q.len())
+}
@@ -1,6 +1,9 @@
 package device
 
 import (
+	"container/heap"
+	"hash/fnv"
+	"sort"
 	"sync"
 )
 
@@ -148,6 +151,59 @@ func (r *registry) visitIf(filter func(ID) bool, visitor func(*device)) (count i
 	return
 }
 
+// shards partitions the registered devices into n shards, with all the devices for an ID placed in the same
+// shard.  The read lock is held only while the shards are built, so the devices in each shard can be visited
+// without blocking connections and disconnections.
+func (r *registry) shards(n int) [][]*device {
+	shards := make([][]*device, n)
+	r.RLock()
+	for id, duplicates := range r.byID {
+		index := shardOf(id, n)
+		shards[index] = append(shards[index], duplicates...)
+	}
+
+	r.RUnlock()
+	return shards
+}
+
+// shardOf returns the shard, from 0 to n-1, to which an ID belongs
+func shardOf(id ID, n int) int {
+	hasher := fnv.New32a()
+	hasher.Write(id.Bytes())
+	return int(hasher.Sum32() % uint32(n))
+}
+
+// lowestIDs returns, in order, up to n of the lowest distinct IDs having at least one device accepted by the filter
+func (r *registry) lowestIDs(n int, filter func(*device) bool) []ID {
+	if n < 1 {
+		return nil
+	}
+
+	ids := make(idHeap, 0, n+1)
+
+	r.RLock()
+	for id, duplicates := range r.byID {
+		if len(ids) == n && id >= ids[0] {
+			continue
+		}
+
+		for _, d := range duplicates {
+			if filter(d) {
+				heap.Push(&ids, id)
+				if len(ids) > n {
+					heap.Pop(&ids)
+				}
+
+				break
+			}
+		}
+	}
+
+	r.RUnlock()
+	sort.Sort(idSlice(ids))
+	return ids
+}
+
 func (r *registry) getOne(id ID) (d *device, err error) {
 	r.RLock()
 	duplicates := r.byID[id]
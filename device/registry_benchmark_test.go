@@ -24,7 +24,7 @@ func benchmarkRegistry(b *testing.B, initialCapacity uint32) {
 			)
 
 			lock.Lock()
-			registry.add(newDevice(id, key, nil, "", 1))
+			registry.add(newDevice(id, key, nil, "", 1, defaultQOSWeights))
 			lock.Unlock()
 
 			lock.RLock()
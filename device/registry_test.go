@@ -9,29 +9,29 @@ import (
 var (
 	nosuchID     = ID("nosuch ID")
 	nosuchKey    = Key("nosuch key")
-	nosuchDevice = newDevice(nosuchID, nosuchKey, nil, "", 1)
+	nosuchDevice = newDevice(nosuchID, nosuchKey, nil, "", 1, defaultQOSWeights)
 
 	singleID     = ID("single")
 	singleKey    = Key("single key")
-	singleDevice = newDevice(singleID, singleKey, nil, "", 1)
+	singleDevice = newDevice(singleID, singleKey, nil, "", 1, defaultQOSWeights)
 
 	doubleID      = ID("double")
 	doubleKey1    = Key("double key 1")
-	doubleDevice1 = newDevice(doubleID, doubleKey1, nil, "", 1)
+	doubleDevice1 = newDevice(doubleID, doubleKey1, nil, "", 1, defaultQOSWeights)
 	doubleKey2    = Key("double key 2")
-	doubleDevice2 = newDevice(doubleID, doubleKey2, nil, "", 1)
+	doubleDevice2 = newDevice(doubleID, doubleKey2, nil, "", 1, defaultQOSWeights)
 
 	manyID      = ID("many")
 	manyKey1    = Key("many key 1")
-	manyDevice1 = newDevice(manyID, manyKey1, nil, "", 1)
+	manyDevice1 = newDevice(manyID, manyKey1, nil, "", 1, defaultQOSWeights)
 	manyKey2    = Key("many key 2")
-	manyDevice2 = newDevice(manyID, manyKey2, nil, "", 1)
+	manyDevice2 = newDevice(manyID, manyKey2, nil, "", 1, defaultQOSWeights)
 	manyKey3    = Key("many key 3")
-	manyDevice3 = newDevice(manyID, manyKey3, nil, "", 1)
+	manyDevice3 = newDevice(manyID, manyKey3, nil, "", 1, defaultQOSWeights)
 	manyKey4    = Key("many key 4")
-	manyDevice4 = newDevice(manyID, manyKey4, nil, "", 1)
+	manyDevice4 = newDevice(manyID, manyKey4, nil, "", 1, defaultQOSWeights)
 	manyKey5    = Key("many key 5")
-	manyDevice5 = newDevice(manyID, manyKey5, nil, "", 1)
+	manyDevice5 = newDevice(manyID, manyKey5, nil, "", 1, defaultQOSWeights)
 )
 
 func testRegistry(t *testing.T, assert *assert.Assertions) *registry {
@@ -56,7 +56,7 @@ func TestRegistryDuplicateDevice(t *testing.T) {
 	assert := assert.New(t)
 	registry := testRegistry(t, assert)
 
-	duplicateDevice := newDevice(ID("duplicate device"), Key("key # 1"), nil, "", 1)
+	duplicateDevice := newDevice(ID("duplicate device"), Key("key # 1"), nil, "", 1, defaultQOSWeights)
 	assert.Nil(registry.add(duplicateDevice))
 	duplicateDevice.updateKey(Key("key #2"))
 	assert.Equal(ErrorDuplicateDevice, registry.add(duplicateDevice))
@@ -158,10 +158,39 @@ func TestRegistryVisitAll(t *testing.T) {
 	assert.Equal(expectVisited, actualVisited)
 }
 
+func TestRegistryShards(t *testing.T) {
+	assert := assert.New(t)
+	registry := testRegistry(t, assert)
+
+	for _, n := range []int{1, 2, 3, 16} {
+		var (
+			shards        = registry.shards(n)
+			actualVisited = deviceSet{}
+			shardByID     = make(map[ID]int)
+		)
+
+		assert.Len(shards, n)
+		for index, shard := range shards {
+			for _, d := range shard {
+				actualVisited[d] = true
+
+				// every device for an ID is in the same shard
+				if previous, ok := shardByID[d.ID()]; ok {
+					assert.Equal(previous, index)
+				} else {
+					shardByID[d.ID()] = index
+				}
+			}
+		}
+
+		assert.Equal(expectsDevices(singleDevice, doubleDevice1, doubleDevice2, manyDevice1, manyDevice2, manyDevice3, manyDevice4, manyDevice5), actualVisited)
+	}
+}
+
 func TestRegistryAddDuplicateKey(t *testing.T) {
 	assert := assert.New(t)
 	registry := testRegistry(t, assert)
-	duplicate := newDevice(singleID, singleKey, nil, "", 1)
+	duplicate := newDevice(singleID, singleKey, nil, "", 1, defaultQOSWeights)
 	assert.Equal(ErrorDuplicateKey, registry.add(duplicate))
 }
 
@@ -258,3 +287,24 @@ func TestRegistryRemoveAll(t *testing.T) {
 		assert.Equal(record.expectVisitAll, actualVisitAll)
 	}
 }
+
+func TestRegistryLowestIDs(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		registry = testRegistry(t, assert)
+		all      = func(*device) bool { return true }
+	)
+
+	// IDs are distinct even when they have duplicate devices
+	assert.Equal([]ID{doubleID, manyID, singleID}, registry.lowestIDs(10, all))
+	assert.Equal([]ID{doubleID, manyID}, registry.lowestIDs(2, all))
+	assert.Empty(registry.lowestIDs(0, all))
+
+	// an ID is selected if any of its devices is accepted
+	assert.Equal(
+		[]ID{manyID, singleID},
+		registry.lowestIDs(10, func(d *device) bool { return d == manyDevice3 || d == singleDevice }),
+	)
+
+	assert.Empty(registry.lowestIDs(10, func(*device) bool { return false }))
+}
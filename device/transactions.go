@@ -40,6 +40,21 @@ func (r *Request) TransactionKey() (key string) {
 	return
 }
 
+// QOSLevel returns the QOS level at which this request is queued for delivery.  If Message is nil
+// or is not a type which carries a QOS value, this method returns wrp.QOSLow.
+func (r *Request) QOSLevel() wrp.QOSLevel {
+	switch message := r.Message.(type) {
+	case *wrp.Message:
+		return message.QualityOfService.Level()
+	case *wrp.SimpleRequestResponse:
+		return message.QualityOfService.Level()
+	case *wrp.SimpleEvent:
+		return message.QualityOfService.Level()
+	default:
+		return wrp.QOSLow
+	}
+}
+
 // Context returns the context.Context object associated with this Request.
 // This method never returns nil.  If no context is associated with this Request,
 // this method returns context.Background().
@@ -86,7 +101,7 @@ func DecodeRequest(source io.Reader, pool *wrp.DecoderPool) (*Request, error) {
 
 	message := new(wrp.Message)
 	if err := pool.DecodeBytes(message, contents); err != nil {
-		return nil, err
+		return nil, httperror.Wrap(httperror.InvalidWRPFormat, err)
 	}
 
 	return &Request{
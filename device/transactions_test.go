@@ -62,9 +62,21 @@ func testRequestID(t *testing.T) {
 	assert.Error(err)
 }
 
+func testRequestQOSLevel(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(wrp.QOSLow, new(Request).QOSLevel())
+	assert.Equal(wrp.QOSLow, (&Request{Message: new(wrp.AuthorizationStatus)}).QOSLevel())
+	assert.Equal(wrp.QOSLow, (&Request{Message: new(wrp.Message)}).QOSLevel())
+	assert.Equal(wrp.QOSCritical, (&Request{Message: &wrp.Message{QualityOfService: 99}}).QOSLevel())
+	assert.Equal(wrp.QOSHigh, (&Request{Message: &wrp.SimpleRequestResponse{QualityOfService: wrp.QOSHighValue}}).QOSLevel())
+	assert.Equal(wrp.QOSMedium, (&Request{Message: &wrp.SimpleEvent{QualityOfService: 30}}).QOSLevel())
+}
+
 func TestRequest(t *testing.T) {
 	t.Run("Context", testRequestContext)
 	t.Run("ID", testRequestID)
+	t.Run("QOSLevel", testRequestQOSLevel)
 }
 
 func testDecodeRequest(t *testing.T, message wrp.Routable, format wrp.Format) {
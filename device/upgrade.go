@@ -0,0 +1,53 @@
+package device
+
+import (
+	"net/http"
+)
+
+// UpgradeHook customizes the response to a device's websocket upgrade.  A Manager invokes its UpgradeHook
+// once the device has been authenticated, just before the upgrade, with the headers that will be sent in the
+// 101 (Switching Protocols) response.  Hooks typically add headers which the device uses once connected,
+// such as the node it was assigned to or the server time:
+//
+//	UpgradeHookFunc(func(id ID, convey Convey, request *http.Request, header http.Header) {
+//		header.Set("X-Webpa-Node", nodeID)
+//		header.Set("X-Webpa-Server-Time", time.Now().UTC().Format(time.RFC3339))
+//	})
+//
+// The header is a copy owned by the connection attempt, so hooks may modify it freely.
+type UpgradeHook interface {
+	BeforeUpgrade(id ID, convey Convey, request *http.Request, header http.Header)
+}
+
+// UpgradeHookFunc is a function type that implements UpgradeHook
+type UpgradeHookFunc func(ID, Convey, *http.Request, http.Header)
+
+func (f UpgradeHookFunc) BeforeUpgrade(id ID, convey Convey, request *http.Request, header http.Header) {
+	f(id, convey, request, header)
+}
+
+// copyHeader creates a deep copy of an HTTP header, so that the copy can be modified without
+// affecting the original.  A nil header is copied as an empty header.
+func copyHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for name, values := range header {
+		clone[name] = append([]string(nil), values...)
+	}
+
+	return clone
+}
+
+// mergeHeader returns the headers sent with an upgrade response, which are the defaults overridden
+// by any header of the same name supplied for the particular connection
+func mergeHeader(defaults, header http.Header) http.Header {
+	if len(defaults) == 0 {
+		return header
+	}
+
+	merged := copyHeader(defaults)
+	for name, values := range header {
+		merged[name] = values
+	}
+
+	return merged
+}
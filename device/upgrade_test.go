@@ -0,0 +1,151 @@
+package device
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradeHookFunc(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		request = httptest.NewRequest("GET", "/", nil)
+		header  = make(http.Header)
+
+		hook = UpgradeHookFunc(func(id ID, convey Convey, actual *http.Request, h http.Header) {
+			assert.Equal(ID("mac:112233445566"), id)
+			assert.Equal(Convey{"foo": "bar"}, convey)
+			assert.True(request == actual)
+			h.Set("X-Webpa-Node", "node1")
+		})
+	)
+
+	hook.BeforeUpgrade(ID("mac:112233445566"), Convey{"foo": "bar"}, request, header)
+	assert.Equal("node1", header.Get("X-Webpa-Node"))
+}
+
+func TestCopyHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(http.Header{}, copyHeader(nil))
+
+	original := http.Header{"X-Test": make([]string, 1, 2)}
+	original["X-Test"][0] = "original"
+
+	clone := copyHeader(original)
+	assert.Equal(original, clone)
+
+	// appending to the copy never writes into the original's spare capacity
+	clone.Add("X-Test", "added")
+	clone.Set("X-Other", "other")
+	assert.Equal(http.Header{"X-Test": {"original"}}, original)
+	assert.Equal([]string{"original", ""}, original["X-Test"][:2])
+}
+
+func TestMergeHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	header := http.Header{"X-Test": {"connection"}}
+	assert.Equal(header, mergeHeader(nil, header))
+	assert.Nil(mergeHeader(nil, nil))
+
+	defaults := http.Header{"X-Test": {"default"}, "X-Default": {"default"}}
+	assert.Equal(defaults, mergeHeader(defaults, nil))
+	assert.Equal(
+		http.Header{"X-Test": {"connection"}, "X-Default": {"default"}},
+		mergeHeader(defaults, header),
+	)
+
+	// the defaults are never modified
+	assert.Equal(http.Header{"X-Test": {"default"}, "X-Default": {"default"}}, defaults)
+}
+
+func TestManagerUpgradeHook(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		disconnected = make(chan struct{}, 1)
+		options      = &Options{
+			Logger:         logging.TestLogger(t),
+			Listeners:      []Listener{disconnectListener(disconnected)},
+			ResponseHeader: http.Header{"x-webpa-node": {"default"}, "X-Webpa-Region": {"east"}},
+			UpgradeHook: UpgradeHookFunc(func(id ID, convey Convey, request *http.Request, header http.Header) {
+				header.Set("X-Webpa-Node", "node1")
+				header.Set("X-Webpa-Device", string(id))
+			}),
+		}
+	)
+
+	_, server, connectURL := startWebsocketServer(options)
+	defer server.Close()
+
+	connection, response, err := NewDialer(options, nil).Dial(connectURL, "mac:112233445566", nil, nil)
+	require.NoError(err)
+	require.NotNil(connection)
+
+	assert.Equal(http.StatusSwitchingProtocols, response.StatusCode)
+	assert.Equal("node1", response.Header.Get("X-Webpa-Node"))
+	assert.Equal("east", response.Header.Get("X-Webpa-Region"))
+	assert.Equal("mac:112233445566", response.Header.Get("X-Webpa-Device"))
+
+	connection.Close()
+	waitForDisconnect(t, disconnected)
+}
+
+func TestManagerCheckOrigin(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		disconnected = make(chan struct{}, 1)
+		options      = &Options{
+			Logger:    logging.TestLogger(t),
+			Listeners: []Listener{disconnectListener(disconnected)},
+			CheckOrigin: func(request *http.Request) bool {
+				return request.Header.Get("Origin") == "https://trusted.example.com"
+			},
+		}
+	)
+
+	_, server, connectURL := startWebsocketServer(options)
+	defer server.Close()
+
+	dialer := NewDialer(options, nil)
+	connection, response, err := dialer.Dial(connectURL, "mac:112233445566", nil, http.Header{"Origin": {"https://untrusted.example.com"}})
+	assert.Nil(connection)
+	assert.Error(err)
+	if assert.NotNil(response) {
+		assert.Equal(http.StatusForbidden, response.StatusCode)
+	}
+
+	connection, _, err = dialer.Dial(connectURL, "mac:112233445566", nil, http.Header{"Origin": {"https://trusted.example.com"}})
+	require.NoError(err)
+	require.NotNil(connection)
+
+	connection.Close()
+	waitForDisconnect(t, disconnected)
+}
+
+// disconnectListener signals each device disconnection, so that tests do not end while the
+// manager is still logging
+func disconnectListener(disconnected chan<- struct{}) Listener {
+	return func(e *Event) {
+		if e.Type == Disconnect {
+			disconnected <- struct{}{}
+		}
+	}
+}
+
+func waitForDisconnect(t *testing.T, disconnected <-chan struct{}) {
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "The device did not disconnect")
+	}
+}
@@ -2,6 +2,7 @@ package device
 
 import (
 	"bytes"
+	"net/http"
 	"testing"
 	"time"
 
@@ -43,6 +44,34 @@ func TestNewOptions(t *testing.T) {
 	)
 }
 
+func TestNewOptionsResponseHeader(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		require       = require.New(t)
+		logger        = logging.DefaultLogger()
+		configuration = `{
+			"device": {
+				"manager": {
+					"responseHeader": {"X-Webpa-Node": ["node1"]}
+				}
+			}
+		}`
+
+		v = viper.New()
+	)
+
+	v.SetConfigType("json")
+	require.Nil(v.ReadConfig(bytes.NewBufferString(configuration)))
+
+	o, err := NewOptions(logger, v.Sub(DeviceManagerKey))
+	require.NotNil(o)
+	assert.Nil(err)
+
+	// viper lowercases keys, so the header names are canonicalized when used
+	assert.Equal(http.Header{"x-webpa-node": {"node1"}}, o.ResponseHeader)
+	assert.Equal(http.Header{"X-Webpa-Node": {"node1"}}, o.responseHeader())
+}
+
 func TestNewOptionsUnmarshalError(t *testing.T) {
 	var (
 		assert        = assert.New(t)
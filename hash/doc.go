@@ -1,4 +1,5 @@
 /*
-Package hash provides a simple API for managing service hashes.
+Package hash provides a simple API for managing service hashes, along with a consistent hash Ring
+and a Router which keeps a Ring up to date with service discovery.
 */
 package hash
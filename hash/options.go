@@ -0,0 +1,59 @@
+package hash
+
+import (
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/service"
+	"time"
+)
+
+// Options configures a Router
+type Options struct {
+	// Logger is used for all of a Router's output.  If unset, logging.DefaultLogger() is used.
+	Logger logging.Logger `json:"-"`
+
+	// VnodeCount is the number of points on the ring for each unit of member weight.  If unset,
+	// service.DefaultVnodeCount is used.
+	VnodeCount int `json:"vnodeCount"`
+
+	// Weights assigns weights to nodes, keyed by base URL, e.g. "https://node1.comcast.net:8080".
+	// Nodes not present in this map have a weight of 1.
+	Weights map[string]int `json:"weights,omitempty"`
+
+	// UpdateDelay is passed as the Timeout of the service.Subscription created by Router.Subscribe,
+	// which damps rehashing when the topology is flapping.  If unset, updates are applied immediately.
+	UpdateDelay time.Duration `json:"updateDelay"`
+}
+
+func (o *Options) logger() logging.Logger {
+	if o != nil && o.Logger != nil {
+		return o.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+func (o *Options) vnodeCount() int {
+	if o != nil && o.VnodeCount > 0 {
+		return o.VnodeCount
+	}
+
+	return service.DefaultVnodeCount
+}
+
+func (o *Options) weight(node string) int {
+	if o != nil {
+		if weight, ok := o.Weights[node]; ok && weight > 0 {
+			return weight
+		}
+	}
+
+	return 1
+}
+
+func (o *Options) updateDelay() time.Duration {
+	if o != nil && o.UpdateDelay > 0 {
+		return o.UpdateDelay
+	}
+
+	return 0
+}
@@ -0,0 +1,40 @@
+package hash
+
+import (
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/service"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestOptionsDefault(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, o := range []*Options{nil, new(Options)} {
+		assert.NotNil(o.logger())
+		assert.Equal(service.DefaultVnodeCount, o.vnodeCount())
+		assert.Equal(1, o.weight("http://node1.comcast.net:8080"))
+		assert.Zero(o.updateDelay())
+	}
+}
+
+func TestOptions(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		logger = logging.TestLogger(t)
+		o      = &Options{
+			Logger:      logger,
+			VnodeCount:  57,
+			Weights:     map[string]int{"http://node1.comcast.net:8080": 3, "http://node2.comcast.net:8080": -1},
+			UpdateDelay: 15 * time.Second,
+		}
+	)
+
+	assert.Equal(logger, o.logger())
+	assert.Equal(57, o.vnodeCount())
+	assert.Equal(3, o.weight("http://node1.comcast.net:8080"))
+	assert.Equal(1, o.weight("http://node2.comcast.net:8080"))
+	assert.Equal(1, o.weight("http://node3.comcast.net:8080"))
+	assert.Equal(15*time.Second, o.updateDelay())
+}
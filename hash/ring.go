@@ -0,0 +1,176 @@
+package hash
+
+import (
+	"errors"
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrorNoNodes = errors.New("There are no nodes in the hash ring")
+)
+
+// Member is a node participating in a Ring.  A member with a larger Weight owns proportionally more
+// of the ring, which is useful when nodes have different capacities.
+type Member struct {
+	// Node is the value returned by Get for keys owned by this member, typically a base URL
+	Node string
+
+	// Weight multiplies the number of vnodes this member has.  Values less than 1 are treated as 1.
+	Weight int
+}
+
+func (m Member) weight() int {
+	if m.Weight > 0 {
+		return m.Weight
+	}
+
+	return 1
+}
+
+// Ring is an immutable consistent hash of nodes.  Each member is placed on the ring at a number of
+// points, or vnodes, so that keys are spread evenly and only the keys of changed nodes move when
+// the membership changes.  Ring implements ServiceHash.
+type Ring struct {
+	members []Member
+	points  []uint32
+	owners  map[uint32]string
+}
+
+var _ ServiceHash = (*Ring)(nil)
+
+// NewRing creates a Ring with vnodeCount points for each unit of weight of each member.  Members are
+// placed in sorted order, so that the same membership always produces the same ring regardless of the
+// order in which members are supplied.  Duplicate nodes are merged, keeping the last weight.
+func NewRing(vnodeCount int, members []Member) *Ring {
+	if vnodeCount < 1 {
+		vnodeCount = 1
+	}
+
+	weights := make(map[string]int, len(members))
+	for _, member := range members {
+		weights[member.Node] = member.weight()
+	}
+
+	r := &Ring{
+		members: make([]Member, 0, len(weights)),
+		owners:  make(map[uint32]string),
+	}
+
+	for node, weight := range weights {
+		r.members = append(r.members, Member{Node: node, Weight: weight})
+	}
+
+	sort.Slice(r.members, func(i, j int) bool { return r.members[i].Node < r.members[j].Node })
+	for _, member := range r.members {
+		for vnode := 0; vnode < vnodeCount*member.Weight; vnode++ {
+			point := crc32.ChecksumIEEE([]byte(member.Node + "|" + strconv.Itoa(vnode)))
+			if _, collision := r.owners[point]; !collision {
+				r.owners[point] = member.Node
+				r.points = append(r.points, point)
+			}
+		}
+	}
+
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// Get returns the node which owns the given key, e.g. a device ID
+func (r *Ring) Get(key []byte) (string, error) {
+	if r == nil || len(r.points) == 0 {
+		return "", ErrorNoNodes
+	}
+
+	return r.owners[r.points[r.search(key)]], nil
+}
+
+// search returns the index of the point which owns the given key
+func (r *Ring) search(key []byte) int {
+	hash := crc32.ChecksumIEEE(key)
+	index := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if index == len(r.points) {
+		index = 0
+	}
+
+	return index
+}
+
+// GetN returns up to n distinct nodes for the given key, in order of preference.  The first node is
+// the one returned by Get, and each subsequent node is the next distinct node around the ring, which is
+// the node that would own the key if the previous nodes were removed.  This is useful for retrying
+// against another node when the owner cannot be reached.
+func (r *Ring) GetN(key []byte, n int) ([]string, error) {
+	if r == nil || len(r.points) == 0 {
+		return nil, ErrorNoNodes
+	}
+
+	if n > len(r.members) {
+		n = len(r.members)
+	}
+
+	var (
+		nodes = make([]string, 0, n)
+		seen  = make(map[string]bool, n)
+		start = r.search(key)
+	)
+
+	for offset := 0; offset < len(r.points) && len(nodes) < n; offset++ {
+		node := r.owners[r.points[(start+offset)%len(r.points)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes, nil
+}
+
+// Len returns the number of members in this ring
+func (r *Ring) Len() int {
+	if r == nil {
+		return 0
+	}
+
+	return len(r.members)
+}
+
+// Members returns a copy of the members of this ring, sorted by node
+func (r *Ring) Members() []Member {
+	if r == nil {
+		return nil
+	}
+
+	return append([]Member(nil), r.members...)
+}
+
+// Nodes returns the sorted nodes of this ring
+func (r *Ring) Nodes() []string {
+	if r == nil {
+		return nil
+	}
+
+	nodes := make([]string, len(r.members))
+	for index, member := range r.members {
+		nodes[index] = member.Node
+	}
+
+	return nodes
+}
+
+// Equal tests if two rings have the same members with the same weights.  Rings with equal
+// membership and the same vnode count hash keys identically.
+func (r *Ring) Equal(other *Ring) bool {
+	if r.Len() != other.Len() {
+		return false
+	}
+
+	for index := 0; index < r.Len(); index++ {
+		if r.members[index] != other.members[index] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,134 @@
+package hash
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRingEmpty(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, r := range []*Ring{nil, NewRing(0, nil)} {
+		node, err := r.Get([]byte("mac:112233445566"))
+		assert.Empty(node)
+		assert.Equal(ErrorNoNodes, err)
+		assert.Zero(r.Len())
+		assert.Empty(r.Members())
+		assert.Empty(r.Nodes())
+
+		nodes, err := r.GetN([]byte("mac:112233445566"), 2)
+		assert.Empty(nodes)
+		assert.Equal(ErrorNoNodes, err)
+	}
+
+	assert.True((*Ring)(nil).Equal(NewRing(10, nil)))
+}
+
+func TestRing(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		r = NewRing(100, []Member{
+			{Node: "http://node2.comcast.net:8080"},
+			{Node: "http://node1.comcast.net:8080", Weight: 2},
+			{Node: "http://node2.comcast.net:8080", Weight: -1},
+		})
+	)
+
+	require.Equal(2, r.Len())
+	assert.Equal(
+		[]Member{{Node: "http://node1.comcast.net:8080", Weight: 2}, {Node: "http://node2.comcast.net:8080", Weight: 1}},
+		r.Members(),
+	)
+
+	assert.Equal([]string{"http://node1.comcast.net:8080", "http://node2.comcast.net:8080"}, r.Nodes())
+
+	// the order of members does not matter
+	same := NewRing(100, []Member{
+		{Node: "http://node1.comcast.net:8080", Weight: 2},
+		{Node: "http://node2.comcast.net:8080"},
+	})
+
+	assert.True(r.Equal(same))
+	assert.False(r.Equal(NewRing(100, []Member{{Node: "http://node1.comcast.net:8080"}, {Node: "http://node2.comcast.net:8080"}})))
+
+	counts := make(map[string]int)
+	for index := 0; index < 10000; index++ {
+		key := []byte(fmt.Sprintf("mac:%012x", index))
+		node, err := r.Get(key)
+		require.NoError(err)
+		counts[node]++
+
+		sameNode, err := same.Get(key)
+		require.NoError(err)
+		assert.Equal(node, sameNode)
+	}
+
+	// node1 has twice the weight, so it should own roughly twice the keys
+	assert.InDelta(2.0, float64(counts["http://node1.comcast.net:8080"])/float64(counts["http://node2.comcast.net:8080"]), 0.5)
+}
+
+func TestRingMembershipChange(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		before = NewRing(211, []Member{{Node: "node1"}, {Node: "node2"}, {Node: "node3"}})
+		after  = NewRing(211, []Member{{Node: "node1"}, {Node: "node2"}, {Node: "node3"}, {Node: "node4"}})
+	)
+
+	for index := 0; index < 10000; index++ {
+		key := []byte(fmt.Sprintf("mac:%012x", index))
+		beforeNode, err := before.Get(key)
+		require.NoError(err)
+
+		afterNode, err := after.Get(key)
+		require.NoError(err)
+
+		// adding a node only moves keys onto that node
+		if beforeNode != afterNode {
+			assert.Equal("node4", afterNode)
+		}
+	}
+}
+
+func TestRingGetN(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		r = NewRing(211, []Member{{Node: "node1"}, {Node: "node2"}, {Node: "node3"}})
+	)
+
+	for index := 0; index < 1000; index++ {
+		key := []byte(fmt.Sprintf("mac:%012x", index))
+		owner, err := r.Get(key)
+		require.NoError(err)
+
+		nodes, err := r.GetN(key, 2)
+		require.NoError(err)
+		require.Len(nodes, 2)
+		assert.Equal(owner, nodes[0])
+		assert.NotEqual(nodes[0], nodes[1])
+
+		// the second node is the owner once the first is removed
+		var remaining []Member
+		for _, node := range []string{"node1", "node2", "node3"} {
+			if node != nodes[0] {
+				remaining = append(remaining, Member{Node: node})
+			}
+		}
+
+		next, err := NewRing(211, remaining).Get(key)
+		require.NoError(err)
+		assert.Equal(next, nodes[1])
+
+		all, err := r.GetN(key, 10)
+		require.NoError(err)
+		assert.Len(all, 3)
+		assert.Equal(nodes, all[:2])
+	}
+}
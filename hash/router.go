@@ -0,0 +1,134 @@
+package hash
+
+import (
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/service"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Router routes keys, typically device IDs, to nodes via a consistent hash Ring which is rebuilt
+// as the topology changes.  Each time the ring changes, the new ring is sent on the Rehash channel
+// so that callers can react, e.g. by disconnecting devices this node no longer owns.
+//
+// A Router is usually kept up to date by service discovery via Subscribe, though Update may be
+// called directly.  Router implements ServiceHash, and is safe for concurrent use.
+type Router struct {
+	logger      logging.Logger
+	options     *Options
+	vnodeCount  int
+	updateDelay time.Duration
+
+	updateLock sync.Mutex
+	ring       atomic.Value
+	rehash     chan *Ring
+}
+
+var _ ServiceHash = (*Router)(nil)
+
+// NewRouter creates a Router with an empty ring.  Get returns ErrorNoNodes until Update is called
+// with at least one valid endpoint.
+func NewRouter(o *Options) *Router {
+	r := &Router{
+		logger:      o.logger(),
+		options:     o,
+		vnodeCount:  o.vnodeCount(),
+		updateDelay: o.updateDelay(),
+		rehash:      make(chan *Ring, 1),
+	}
+
+	r.ring.Store(NewRing(r.vnodeCount, nil))
+	return r
+}
+
+// Ring returns the current Ring
+func (r *Router) Ring() *Ring {
+	return r.ring.Load().(*Ring)
+}
+
+// Get returns the node which currently owns the given key
+func (r *Router) Get(key []byte) (string, error) {
+	return r.Ring().Get(key)
+}
+
+// GetN returns up to n distinct nodes for the given key from the current ring, in order of preference
+func (r *Router) GetN(key []byte, n int) ([]string, error) {
+	return r.Ring().GetN(key, n)
+}
+
+// Rehash returns the channel on which new rings are sent when the topology changes.  Only the
+// most recent ring is kept, so a slow reader skips intermediate rings rather than blocking updates.
+func (r *Router) Rehash() <-chan *Ring {
+	return r.rehash
+}
+
+// Update rebuilds the ring from endpoints of the form produced by a service.Watch.  Invalid endpoints
+// are skipped.  If the resulting membership is unchanged, the current ring is kept and no rehash occurs.
+// This method has the signature of a service.Subscription Listener.
+func (r *Router) Update(endpoints []string) {
+	members := make([]Member, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		node, err := service.ParseHostPort(endpoint)
+		if err != nil {
+			r.logger.Error("Skipping bad endpoint [%s]: %s", endpoint, err)
+			continue
+		}
+
+		members = append(members, Member{Node: node, Weight: r.options.weight(node)})
+	}
+
+	newRing := NewRing(r.vnodeCount, members)
+
+	r.updateLock.Lock()
+	defer r.updateLock.Unlock()
+
+	if newRing.Equal(r.Ring()) {
+		return
+	}
+
+	r.logger.Info("Rehashing to nodes: %v", newRing.Nodes())
+	r.ring.Store(newRing)
+
+	// replace any ring the reader has not yet received
+	select {
+	case <-r.rehash:
+	default:
+	}
+
+	r.rehash <- newRing
+}
+
+// Subscribe keeps this Router up to date with the watches produced by the given Watcher, such as a
+// service.Discovery.  The ring is built from the watch's current endpoints before this method returns.
+// The returned Subscription is running, and the caller is responsible for cancelling it.
+func (r *Router) Subscribe(watcher service.Watcher) (*service.Subscription, error) {
+	subscription := &service.Subscription{
+		Logger:    r.logger,
+		Registrar: primingWatcher{watcher, r},
+		Listener:  r.Update,
+		Timeout:   r.updateDelay,
+	}
+
+	if err := subscription.Run(); err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+// primingWatcher updates a Router with the initial endpoints of each watch, since a Subscription
+// only dispatches endpoints when they change
+type primingWatcher struct {
+	watcher service.Watcher
+	router  *Router
+}
+
+func (p primingWatcher) Watch() (service.Watch, error) {
+	watch, err := p.watcher.Watch()
+	if err == nil {
+		p.router.Update(watch.Endpoints())
+	}
+
+	return watch, err
+}
@@ -0,0 +1,165 @@
+package hash
+
+import (
+	"errors"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testWatch is a service.Watch whose endpoints are changed by test code
+type testWatch struct {
+	lock      sync.Mutex
+	endpoints []string
+	event     chan struct{}
+	closed    bool
+}
+
+func newTestWatch(endpoints ...string) *testWatch {
+	return &testWatch{
+		endpoints: endpoints,
+		event:     make(chan struct{}, 1),
+	}
+}
+
+func (w *testWatch) update(endpoints ...string) {
+	w.lock.Lock()
+	w.endpoints = endpoints
+	w.lock.Unlock()
+	w.event <- struct{}{}
+}
+
+// String keeps the Subscription's logging from reading this watch's fields via reflection
+func (w *testWatch) String() string {
+	return "testWatch"
+}
+
+func (w *testWatch) Close() {
+	w.lock.Lock()
+	w.closed = true
+	w.lock.Unlock()
+}
+
+func (w *testWatch) IsClosed() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.closed
+}
+
+func (w *testWatch) Event() <-chan struct{} {
+	return w.event
+}
+
+func (w *testWatch) Endpoints() []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.endpoints
+}
+
+type testWatcher struct {
+	watch service.Watch
+	err   error
+}
+
+func (w testWatcher) Watch() (service.Watch, error) {
+	return w.watch, w.err
+}
+
+func TestRouter(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		router  = NewRouter(&Options{
+			Logger:  logging.TestLogger(t),
+			Weights: map[string]int{"https://node1.comcast.net:8080": 2},
+		})
+	)
+
+	node, err := router.Get([]byte("mac:112233445566"))
+	assert.Empty(node)
+	assert.Equal(ErrorNoNodes, err)
+
+	router.Update([]string{"[https://node1.comcast.net]:8080", "node2.comcast.net:8080", "this is not valid"})
+	ring := <-router.Rehash()
+	require.NotNil(ring)
+	assert.Equal(ring, router.Ring())
+	assert.Equal(
+		[]Member{{Node: "http://node2.comcast.net:8080", Weight: 1}, {Node: "https://node1.comcast.net:8080", Weight: 2}},
+		ring.Members(),
+	)
+
+	node, err = router.Get([]byte("mac:112233445566"))
+	assert.Contains(ring.Nodes(), node)
+	assert.NoError(err)
+
+	nodes, err := router.GetN([]byte("mac:112233445566"), 2)
+	require.Len(nodes, 2)
+	assert.Equal(node, nodes[0])
+	assert.NotEqual(nodes[0], nodes[1])
+	assert.NoError(err)
+
+	// the same membership does not rehash
+	router.Update([]string{"node2.comcast.net:8080", "[https://node1.comcast.net]:8080"})
+	select {
+	case <-router.Rehash():
+		assert.Fail("No rehash should have occurred")
+	default:
+	}
+
+	assert.Equal(ring, router.Ring())
+
+	// a slow reader only sees the latest ring
+	router.Update([]string{"node2.comcast.net:8080"})
+	router.Update([]string{"node3.comcast.net:8080"})
+	ring = <-router.Rehash()
+	assert.Equal([]string{"http://node3.comcast.net:8080"}, ring.Nodes())
+
+	select {
+	case <-router.Rehash():
+		assert.Fail("Only the latest ring should have been kept")
+	default:
+	}
+}
+
+func TestRouterSubscribe(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		router  = NewRouter(&Options{Logger: logging.TestLogger(t)})
+		watch   = newTestWatch("node1.comcast.net:8080")
+	)
+
+	subscription, err := router.Subscribe(testWatcher{watch: watch})
+	require.NotNil(subscription)
+	require.NoError(err)
+	defer subscription.Cancel()
+
+	// the initial endpoints are hashed before Subscribe returns
+	assert.Equal([]string{"http://node1.comcast.net:8080"}, router.Ring().Nodes())
+	<-router.Rehash()
+
+	watch.update("node1.comcast.net:8080", "node2.comcast.net:8080")
+	select {
+	case ring := <-router.Rehash():
+		assert.Equal([]string{"http://node1.comcast.net:8080", "http://node2.comcast.net:8080"}, ring.Nodes())
+	case <-time.After(5 * time.Second):
+		assert.Fail("No rehash occurred")
+	}
+}
+
+func TestRouterSubscribeError(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		expectedError = errors.New("expected")
+		router        = NewRouter(&Options{Logger: logging.TestLogger(t)})
+	)
+
+	subscription, err := router.Subscribe(testWatcher{err: expectedError})
+	assert.Nil(subscription)
+	assert.Equal(expectedError, err)
+	assert.Zero(router.Ring().Len())
+}
@@ -0,0 +1,420 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CheckStatus is the outcome of a health check
+type CheckStatus string
+
+const (
+	CheckPass    CheckStatus = "pass"
+	CheckFail    CheckStatus = "fail"
+	CheckPending CheckStatus = "pending"
+
+	DefaultCheckInterval time.Duration = 10 * time.Second
+	DefaultCheckTimeout  time.Duration = 5 * time.Second
+
+	// ReadyPath is the conventional path of the readiness endpoint
+	ReadyPath = "/health/ready"
+
+	// LivePath is the conventional path of the liveness endpoint
+	LivePath = "/health/live"
+)
+
+var (
+	ErrorCheckNoName        = errors.New("Health checks must be named")
+	ErrorCheckNoFunc        = errors.New("Health checks must have a function")
+	ErrorCheckDuplicateName = errors.New("Duplicate health check")
+	ErrorCheckerStarted     = errors.New("Health checks cannot be registered once the checker is running")
+)
+
+// CheckFunc tests a single aspect of an application's health, returning an error if that aspect is unhealthy.
+// Implementations should honor the Context, which is cancelled when the check times out.
+type CheckFunc func(context.Context) error
+
+// Check is a named health check which is executed periodically
+type Check struct {
+	// Name identifies the check, e.g. "database"
+	Name string
+
+	// Func performs the check
+	Func CheckFunc
+
+	// Interval is how often the check is executed.  If not supplied, DefaultCheckInterval is used.
+	Interval time.Duration
+
+	// Timeout is the time allowed for each execution of the check.  If not supplied, DefaultCheckTimeout is used.
+	Timeout time.Duration
+
+	// Liveness indicates that this check determines whether the application is alive.  Every check
+	// contributes to readiness, but only liveness checks contribute to liveness.  Liveness checks should be
+	// limited to conditions that a restart would fix, such as a deadlock.
+	Liveness bool
+}
+
+func (c *Check) interval() time.Duration {
+	if c.Interval > 0 {
+		return c.Interval
+	}
+
+	return DefaultCheckInterval
+}
+
+func (c *Check) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+
+	return DefaultCheckTimeout
+}
+
+// CheckResult is the most recent outcome of a health check
+type CheckResult struct {
+	Name        string      `json:"name"`
+	Status      CheckStatus `json:"status"`
+	Liveness    bool        `json:"liveness"`
+	Error       string      `json:"error,omitempty"`
+	LastChecked time.Time   `json:"lastChecked,omitempty"`
+	Duration    string      `json:"duration,omitempty"`
+}
+
+// checkState holds a registered check along with its latest result
+type checkState struct {
+	check   Check
+	result  CheckResult
+	running bool
+}
+
+// Checker executes a set of health checks and aggregates their results into readiness and liveness.
+// The application is ready when every check passes, and is alive when no liveness check fails.  A check
+// is pending until it first completes, which makes the application not ready but still alive, so that
+// a slow start does not cause a restart.
+//
+// A Checker is safe for concurrent use.
+type Checker struct {
+	lock        sync.RWMutex
+	now         func() time.Time
+	checks      map[string]*checkState
+	order       []string
+	started     bool
+	draining    bool
+	maintenance bool
+}
+
+// NewChecker creates an empty Checker
+func NewChecker() *Checker {
+	return &Checker{
+		now:    time.Now,
+		checks: make(map[string]*checkState),
+	}
+}
+
+// Register adds a health check.  Checks must be registered before Run is called.
+func (c *Checker) Register(check Check) error {
+	if len(check.Name) == 0 {
+		return ErrorCheckNoName
+	} else if check.Func == nil {
+		return ErrorCheckNoFunc
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.started {
+		return ErrorCheckerStarted
+	} else if _, ok := c.checks[check.Name]; ok {
+		return ErrorCheckDuplicateName
+	}
+
+	c.checks[check.Name] = &checkState{
+		check: check,
+		result: CheckResult{
+			Name:     check.Name,
+			Status:   CheckPending,
+			Liveness: check.Liveness,
+		},
+	}
+
+	c.order = append(c.order, check.Name)
+	return nil
+}
+
+// execute runs a single check once, with its timeout, and records the result.  If the previous
+// execution of the check has not yet returned, this method does nothing.
+func (c *Checker) execute(name string) {
+	c.lock.Lock()
+	state := c.checks[name]
+	if state.running {
+		c.lock.Unlock()
+		return
+	}
+
+	state.running = true
+	check := state.check
+	c.lock.Unlock()
+
+	var (
+		start       = c.now()
+		ctx, cancel = context.WithTimeout(context.Background(), check.timeout())
+		done        = make(chan error, 1)
+		err         error
+	)
+
+	defer cancel()
+	go func() {
+		// the check may ignore its Context, so this goroutine can outlive the timeout
+		defer func() {
+			c.lock.Lock()
+			state.running = false
+			c.lock.Unlock()
+		}()
+
+		done <- check.Func(ctx)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("Health check timed out after %s", check.timeout())
+	}
+
+	result := CheckResult{
+		Name:        check.Name,
+		Status:      CheckPass,
+		Liveness:    check.Liveness,
+		LastChecked: start,
+		Duration:    c.now().Sub(start).String(),
+	}
+
+	if err != nil {
+		result.Status = CheckFail
+		result.Error = err.Error()
+	}
+
+	c.lock.Lock()
+	state.result = result
+	c.lock.Unlock()
+}
+
+// CheckNow executes every check once, concurrently, and returns when all have completed or timed out
+func (c *Checker) CheckNow() {
+	c.lock.RLock()
+	names := append([]string(nil), c.order...)
+	c.lock.RUnlock()
+
+	var waitGroup sync.WaitGroup
+	for _, name := range names {
+		waitGroup.Add(1)
+		go func(name string) {
+			defer waitGroup.Done()
+			c.execute(name)
+		}(name)
+	}
+
+	waitGroup.Wait()
+}
+
+// Run executes each check immediately and then at its interval until shutdown is closed.
+// This method is idempotent, and implements concurrent.Runnable.
+func (c *Checker) Run(waitGroup *sync.WaitGroup, shutdown <-chan struct{}) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.started {
+		return nil
+	}
+
+	c.started = true
+	for _, name := range c.order {
+		waitGroup.Add(1)
+		go func(name string, interval time.Duration) {
+			defer waitGroup.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			c.execute(name)
+			for {
+				select {
+				case <-shutdown:
+					return
+				case <-ticker.C:
+					c.execute(name)
+				}
+			}
+		}(name, c.checks[name].check.interval())
+	}
+
+	return nil
+}
+
+// Results returns the latest result of every check, in registration order
+func (c *Checker) Results() []CheckResult {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	results := make([]CheckResult, 0, len(c.order))
+	for _, name := range c.order {
+		results = append(results, c.checks[name].result)
+	}
+
+	return results
+}
+
+// Drain marks the application as not ready, regardless of its checks, so that load balancers stop
+// routing traffic to it while it shuts down.  Liveness is not affected.  This method cannot be undone.
+func (c *Checker) Drain() {
+	c.lock.Lock()
+	c.draining = true
+	c.lock.Unlock()
+}
+
+// Draining tests if Drain has been called
+func (c *Checker) Draining() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.draining
+}
+
+// SetMaintenance turns maintenance mode on or off.  While in maintenance, the application reports
+// not ready, just as when draining, but unlike Drain this can be undone.  Liveness is not affected.
+func (c *Checker) SetMaintenance(maintenance bool) {
+	c.lock.Lock()
+	c.maintenance = maintenance
+	c.lock.Unlock()
+}
+
+// Maintenance tests if the application is in maintenance mode
+func (c *Checker) Maintenance() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.maintenance
+}
+
+// unavailable tests if the application is draining or in maintenance, either of which makes it not ready
+func (c *Checker) unavailable() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.draining || c.maintenance
+}
+
+// Ready tests if every check has passed and the application is neither draining nor in maintenance
+func (c *Checker) Ready() bool {
+	return !c.unavailable() && aggregate(c.Results(), false) == CheckPass
+}
+
+// Live tests if no liveness check has failed
+func (c *Checker) Live() bool {
+	return aggregate(c.Results(), true) == CheckPass
+}
+
+// aggregate computes the overall status of a set of results.  For liveness, only liveness checks
+// are considered and pending checks pass.  For readiness, every check must pass.
+func aggregate(results []CheckResult, liveness bool) CheckStatus {
+	for _, result := range results {
+		if liveness && (!result.Liveness || result.Status == CheckPending) {
+			continue
+		}
+
+		if result.Status != CheckPass {
+			return CheckFail
+		}
+	}
+
+	return CheckPass
+}
+
+// checkResponse is the JSON body written by the readiness and liveness endpoints
+type checkResponse struct {
+	Status CheckStatus   `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// serve writes the aggregate status along with the relevant results.  The response status is
+// 200 if the aggregate status is pass, and 503 otherwise.
+func (c *Checker) serve(response http.ResponseWriter, liveness bool) {
+	results := c.Results()
+	body := checkResponse{Checks: make([]CheckResult, 0, len(results))}
+	for _, result := range results {
+		if !liveness || result.Liveness {
+			body.Checks = append(body.Checks, result)
+		}
+	}
+
+	body.Status = aggregate(body.Checks, liveness)
+	if !liveness && c.unavailable() {
+		body.Status = CheckFail
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(response, `{"message": "%s"}`, err.Error())
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	if body.Status != CheckPass {
+		response.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	response.Write(data)
+}
+
+// ReadyHandler returns the readiness endpoint, which reports every check.  The endpoint reports
+// failure once the Checker is draining, and while it is in maintenance.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		c.serve(response, false)
+	})
+}
+
+// LiveHandler returns the liveness endpoint, which reports only liveness checks
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		c.serve(response, true)
+	})
+}
+
+// maintenanceState is the JSON body accepted and written by the maintenance endpoint
+type maintenanceState struct {
+	Maintenance bool `json:"maintenance"`
+}
+
+// MaintenanceHandler returns an endpoint which controls maintenance mode.  A GET reports whether
+// maintenance mode is on, while a PUT or POST with a body such as {"maintenance": true} changes it.
+// This endpoint is intended for an authorized admin API, not the public health server.
+func (c *Checker) MaintenanceHandler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+
+		case http.MethodPut, http.MethodPost:
+			var state maintenanceState
+			if err := json.NewDecoder(request.Body).Decode(&state); err != nil {
+				response.Header().Set("Content-Type", "application/json")
+				response.WriteHeader(http.StatusBadRequest)
+				data, _ := json.Marshal(map[string]string{"message": err.Error()})
+				response.Write(data)
+				return
+			}
+
+			c.SetMaintenance(state.Maintenance)
+
+		default:
+			response.Header().Set("Allow", "GET, PUT, POST")
+			response.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		data, _ := json.Marshal(maintenanceState{Maintenance: c.Maintenance()})
+		response.Header().Set("Content-Type", "application/json")
+		response.Write(data)
+	})
+}
@@ -0,0 +1,279 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	check := Check{}
+	assert.Equal(DefaultCheckInterval, check.interval())
+	assert.Equal(DefaultCheckTimeout, check.timeout())
+
+	check = Check{Interval: time.Minute, Timeout: time.Second}
+	assert.Equal(time.Minute, check.interval())
+	assert.Equal(time.Second, check.timeout())
+}
+
+func TestCheckerRegister(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		checker = NewChecker()
+		pass    = func(context.Context) error { return nil }
+	)
+
+	assert.Equal(ErrorCheckNoName, checker.Register(Check{Func: pass}))
+	assert.Equal(ErrorCheckNoFunc, checker.Register(Check{Name: "database"}))
+	assert.NoError(checker.Register(Check{Name: "database", Func: pass}))
+	assert.Equal(ErrorCheckDuplicateName, checker.Register(Check{Name: "database", Func: pass}))
+
+	var (
+		waitGroup = new(sync.WaitGroup)
+		shutdown  = make(chan struct{})
+	)
+
+	assert.NoError(checker.Run(waitGroup, shutdown))
+	assert.NoError(checker.Run(waitGroup, shutdown))
+	assert.Equal(ErrorCheckerStarted, checker.Register(Check{Name: "cache", Func: pass}))
+
+	close(shutdown)
+	waitGroup.Wait()
+}
+
+func TestChecker(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		checker = NewChecker()
+
+		databaseError atomic.Value
+		deadlocked    int32
+	)
+
+	databaseError.Store("")
+	require.NoError(checker.Register(Check{
+		Name: "database",
+		Func: func(context.Context) error {
+			if message := databaseError.Load().(string); len(message) > 0 {
+				return errors.New(message)
+			}
+
+			return nil
+		},
+	}))
+
+	require.NoError(checker.Register(Check{
+		Name:     "deadlock",
+		Liveness: true,
+		Timeout:  10 * time.Millisecond,
+		Func: func(ctx context.Context) error {
+			if atomic.LoadInt32(&deadlocked) == 1 {
+				<-ctx.Done()
+			}
+
+			return nil
+		},
+	}))
+
+	results := checker.Results()
+	require.Len(results, 2)
+	assert.Equal("database", results[0].Name)
+	assert.Equal(CheckPending, results[0].Status)
+	assert.False(results[0].Liveness)
+	assert.Equal("deadlock", results[1].Name)
+	assert.Equal(CheckPending, results[1].Status)
+	assert.True(results[1].Liveness)
+	assert.False(checker.Ready())
+	assert.True(checker.Live())
+
+	checker.CheckNow()
+	results = checker.Results()
+	assert.Equal(CheckPass, results[0].Status)
+	assert.Equal(CheckPass, results[1].Status)
+	assert.False(results[0].LastChecked.IsZero())
+	assert.NotEmpty(results[0].Duration)
+	assert.True(checker.Ready())
+	assert.True(checker.Live())
+
+	databaseError.Store("connection refused")
+	checker.CheckNow()
+	results = checker.Results()
+	assert.Equal(CheckFail, results[0].Status)
+	assert.Equal("connection refused", results[0].Error)
+	assert.False(checker.Ready())
+	assert.True(checker.Live())
+
+	databaseError.Store("")
+	atomic.StoreInt32(&deadlocked, 1)
+	checker.CheckNow()
+	results = checker.Results()
+	assert.Equal(CheckPass, results[0].Status)
+	assert.Equal(CheckFail, results[1].Status)
+	assert.Contains(results[1].Error, "timed out")
+	assert.False(checker.Ready())
+	assert.False(checker.Live())
+}
+
+func testCheckerEndpoint(t *testing.T, handler http.Handler, expectedCode int) checkResponse {
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, expectedCode, response.Code)
+	assert.Equal(t, "application/json", response.HeaderMap.Get("Content-Type"))
+
+	var body checkResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	return body
+}
+
+func TestCheckerEndpoints(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		checker = NewChecker()
+
+		ready = checker.ReadyHandler()
+		live  = checker.LiveHandler()
+	)
+
+	body := testCheckerEndpoint(t, ready, http.StatusOK)
+	assert.Equal(CheckPass, body.Status)
+	assert.Empty(body.Checks)
+
+	require.NoError(checker.Register(Check{Name: "database", Func: func(context.Context) error { return errors.New("down") }}))
+	require.NoError(checker.Register(Check{Name: "loop", Liveness: true, Func: func(context.Context) error { return nil }}))
+
+	body = testCheckerEndpoint(t, ready, http.StatusServiceUnavailable)
+	assert.Equal(CheckFail, body.Status)
+	assert.Len(body.Checks, 2)
+
+	body = testCheckerEndpoint(t, live, http.StatusOK)
+	assert.Equal(CheckPass, body.Status)
+	require.Len(body.Checks, 1)
+	assert.Equal(CheckPending, body.Checks[0].Status)
+
+	checker.CheckNow()
+	body = testCheckerEndpoint(t, ready, http.StatusServiceUnavailable)
+	require.Len(body.Checks, 2)
+	assert.Equal(CheckFail, body.Checks[0].Status)
+	assert.Equal("down", body.Checks[0].Error)
+	assert.Equal(CheckPass, body.Checks[1].Status)
+
+	body = testCheckerEndpoint(t, live, http.StatusOK)
+	require.Len(body.Checks, 1)
+	assert.Equal("loop", body.Checks[0].Name)
+	assert.Equal(CheckPass, body.Checks[0].Status)
+}
+
+func TestCheckerDrain(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		checker = NewChecker()
+	)
+
+	require.NoError(checker.Register(Check{Name: "loop", Liveness: true, Func: func(context.Context) error { return nil }}))
+	checker.CheckNow()
+	assert.False(checker.Draining())
+	assert.True(checker.Ready())
+	assert.True(checker.Live())
+
+	checker.Drain()
+	assert.True(checker.Draining())
+	assert.False(checker.Ready())
+	assert.True(checker.Live())
+
+	body := testCheckerEndpoint(t, checker.ReadyHandler(), http.StatusServiceUnavailable)
+	assert.Equal(CheckFail, body.Status)
+	require.Len(body.Checks, 1)
+	assert.Equal(CheckPass, body.Checks[0].Status)
+
+	body = testCheckerEndpoint(t, checker.LiveHandler(), http.StatusOK)
+	assert.Equal(CheckPass, body.Status)
+}
+
+func TestCheckerMaintenance(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		checker = NewChecker()
+		handler = checker.MaintenanceHandler()
+
+		serve = func(method, body string, expectedStatus int) string {
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, httptest.NewRequest(method, "/maintenance", strings.NewReader(body)))
+			assert.Equal(expectedStatus, response.Code)
+			return response.Body.String()
+		}
+	)
+
+	require.NoError(checker.Register(Check{Name: "loop", Liveness: true, Func: func(context.Context) error { return nil }}))
+	checker.CheckNow()
+	assert.False(checker.Maintenance())
+	assert.True(checker.Ready())
+	assert.JSONEq(`{"maintenance": false}`, serve("GET", "", http.StatusOK))
+
+	assert.JSONEq(`{"maintenance": true}`, serve("PUT", `{"maintenance": true}`, http.StatusOK))
+	assert.True(checker.Maintenance())
+	assert.False(checker.Ready())
+	assert.True(checker.Live())
+	assert.Equal(CheckFail, testCheckerEndpoint(t, checker.ReadyHandler(), http.StatusServiceUnavailable).Status)
+
+	serve("POST", "this is not JSON", http.StatusBadRequest)
+	serve("DELETE", "", http.StatusMethodNotAllowed)
+	assert.True(checker.Maintenance())
+
+	// unlike draining, maintenance can be undone
+	assert.JSONEq(`{"maintenance": false}`, serve("POST", `{"maintenance": false}`, http.StatusOK))
+	assert.False(checker.Maintenance())
+	assert.True(checker.Ready())
+}
+
+func TestCheckerRun(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		checker = NewChecker()
+		calls   = make(chan struct{}, 10)
+
+		waitGroup = new(sync.WaitGroup)
+		shutdown  = make(chan struct{})
+	)
+
+	require.NoError(checker.Register(Check{
+		Name:     "test",
+		Interval: 10 * time.Millisecond,
+		Func: func(context.Context) error {
+			select {
+			case calls <- struct{}{}:
+			default:
+			}
+
+			return nil
+		},
+	}))
+
+	require.NoError(checker.Run(waitGroup, shutdown))
+	for repeat := 0; repeat < 2; repeat++ {
+		select {
+		case <-calls:
+		case <-time.After(5 * time.Second):
+			assert.Fail("The check was not executed")
+		}
+	}
+
+	close(shutdown)
+	waitGroup.Wait()
+	assert.Equal(CheckPass, checker.Results()[0].Status)
+}
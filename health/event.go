@@ -0,0 +1,139 @@
+package health
+
+import (
+	"strings"
+	"time"
+)
+
+// EventType describes how an Event changes the health snapshot
+type EventType int
+
+const (
+	// CounterEvent adds the event's Value to its stat
+	CounterEvent EventType = iota
+
+	// GaugeEvent sets the event's stat to its Value
+	GaugeEvent
+
+	// StatusEvent sets the status of the event's Source
+	StatusEvent
+)
+
+func (et EventType) String() string {
+	switch et {
+	case CounterEvent:
+		return "counter"
+	case GaugeEvent:
+		return "gauge"
+	case StatusEvent:
+		return "status"
+	default:
+		return "invalid"
+	}
+}
+
+// Event is a health delta pushed by a subsystem, such as a device manager or an SNS server.  Events are
+// aggregated into the health snapshot and are also dispatched to any EventListeners.
+type Event struct {
+	// Source is the subsystem which published this event, e.g. "device".  When supplied, the stat
+	// this event changes is qualified with the source, e.g. "device.TotalConnections".
+	Source string
+
+	// Type determines how this event changes the health snapshot
+	Type EventType
+
+	// Stat is the statistic changed by counter and gauge events
+	Stat Stat
+
+	// Value is the amount added by counter events or the value set by gauge events
+	Value int
+
+	// Status is the new status of the Source for status events, e.g. "ready"
+	Status string
+
+	// Time is when the event occurred.  If not supplied, the time the event is published is used.
+	Time time.Time
+}
+
+// Counter creates an event which adds delta to a stat
+func Counter(stat Stat, delta int) Event {
+	return Event{Type: CounterEvent, Stat: stat, Value: delta}
+}
+
+// Gauge creates an event which sets a stat to a value
+func Gauge(stat Stat, value int) Event {
+	return Event{Type: GaugeEvent, Stat: stat, Value: value}
+}
+
+// StatusChange creates an event which sets the status of a subsystem
+func StatusChange(source, status string) Event {
+	return Event{Source: source, Type: StatusEvent, Status: status}
+}
+
+// Key returns the stat this event changes, qualified with the event's Source if there is one
+func (e Event) Key() Stat {
+	if len(e.Source) > 0 && !strings.HasPrefix(string(e.Stat), e.Source+".") {
+		return Stat(e.Source + "." + string(e.Stat))
+	}
+
+	return e.Stat
+}
+
+// apply aggregates this event into a set of stats and subsystem statuses
+func (e Event) apply(stats Stats, statuses map[string]string) {
+	switch e.Type {
+	case CounterEvent:
+		stats[e.Key()] += e.Value
+	case GaugeEvent:
+		stats[e.Key()] = e.Value
+	case StatusEvent:
+		statuses[e.Source] = e.Status
+	}
+}
+
+// Publisher is the sink for health events.  *Health is the usual implementation.
+type Publisher interface {
+	Publish(Event)
+}
+
+// PublisherFunc is a function type that implements Publisher
+type PublisherFunc func(Event)
+
+func (f PublisherFunc) Publish(e Event) {
+	f(e)
+}
+
+// SourcePublisher returns a Publisher which stamps each event with the given source before passing it
+// to the delegate.  Events which already have a source are left alone.  If the delegate is nil,
+// a Publisher which discards all events is returned, so subsystems can publish unconditionally.
+func SourcePublisher(delegate Publisher, source string) Publisher {
+	if delegate == nil {
+		return PublisherFunc(func(Event) {})
+	}
+
+	return PublisherFunc(func(e Event) {
+		if len(e.Source) == 0 {
+			e.Source = source
+		}
+
+		delegate.Publish(e)
+	})
+}
+
+// EventListener receives each event published to a Health object, after the event has been aggregated
+type EventListener interface {
+	OnEvent(Event)
+}
+
+// EventListenerFunc is a function type that implements EventListener
+type EventListenerFunc func(Event)
+
+func (f EventListenerFunc) OnEvent(e Event) {
+	f(e)
+}
+
+// Snapshot is a point-in-time copy of the aggregated health of an application
+type Snapshot struct {
+	Stats    Stats             `json:"stats"`
+	Statuses map[string]string `json:"statuses"`
+}
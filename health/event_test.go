@@ -0,0 +1,123 @@
+package health
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventTypeString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("counter", CounterEvent.String())
+	assert.Equal("gauge", GaugeEvent.String())
+	assert.Equal("status", StatusEvent.String())
+	assert.Equal("invalid", EventType(-1).String())
+}
+
+func TestEventKey(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(Stat("TotalConnections"), Counter("TotalConnections", 1).Key())
+
+	event := Gauge("ConnectedDevices", 12)
+	event.Source = "device"
+	assert.Equal(Stat("device.ConnectedDevices"), event.Key())
+
+	event.Stat = "device.ConnectedDevices"
+	assert.Equal(Stat("device.ConnectedDevices"), event.Key())
+}
+
+func TestEventApply(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		stats    = Stats{"TotalConnections": 5}
+		statuses = make(map[string]string)
+	)
+
+	Counter("TotalConnections", 2).apply(stats, statuses)
+	Counter("TotalDisconnections", 1).apply(stats, statuses)
+	Gauge("ConnectedDevices", 12).apply(stats, statuses)
+	Gauge("ConnectedDevices", 7).apply(stats, statuses)
+	StatusChange("sns", "ready").apply(stats, statuses)
+
+	assert.Equal(Stats{"TotalConnections": 7, "TotalDisconnections": 1, "ConnectedDevices": 7}, stats)
+	assert.Equal(map[string]string{"sns": "ready"}, statuses)
+}
+
+func TestSourcePublisher(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		published []Event
+		delegate  = PublisherFunc(func(e Event) { published = append(published, e) })
+		p         = SourcePublisher(delegate, "device")
+	)
+
+	p.Publish(Counter("TotalConnections", 1))
+	p.Publish(StatusChange("sns", "ready"))
+
+	assert.Equal(
+		[]Event{
+			{Source: "device", Type: CounterEvent, Stat: "TotalConnections", Value: 1},
+			{Source: "sns", Type: StatusEvent, Status: "ready"},
+		},
+		published,
+	)
+
+	assert.NotPanics(func() {
+		SourcePublisher(nil, "device").Publish(Counter("TotalConnections", 1))
+	})
+}
+
+func TestHealthPublish(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		h       = setupHealth()
+
+		waitGroup = new(sync.WaitGroup)
+		shutdown  = make(chan struct{})
+		received  = make(chan Event, 10)
+	)
+
+	h.Run(waitGroup, shutdown)
+	defer func() {
+		close(shutdown)
+		waitGroup.Wait()
+	}()
+
+	h.Subscribe(EventListenerFunc(func(e Event) { received <- e }))
+
+	devices := h.Publisher("device")
+	devices.Publish(Counter("TotalConnections", 1))
+	devices.Publish(Counter("TotalConnections", 1))
+	devices.Publish(Gauge("ConnectedDevices", 2))
+	h.Publisher("sns").Publish(StatusChange("", "ready"))
+	h.Publish(Counter(TotalRequestsReceived, 3))
+
+	for repeat := 0; repeat < 5; repeat++ {
+		select {
+		case e := <-received:
+			assert.False(e.Time.IsZero())
+		case <-time.After(5 * time.Second):
+			require.Fail("The event was not dispatched to the listener")
+		}
+	}
+
+	snapshot := h.Snapshot()
+	assert.Equal(2, snapshot.Stats["device.TotalConnections"])
+	assert.Equal(2, snapshot.Stats["device.ConnectedDevices"])
+	assert.Equal(3, snapshot.Stats[TotalRequestsReceived])
+	assert.Equal(map[string]string{"sns": "ready"}, snapshot.Statuses)
+
+	// snapshots are copies
+	snapshot.Statuses["sns"] = "not ready"
+	assert.Equal("ready", h.Snapshot().Statuses["sns"])
+
+	data, err := json.Marshal(snapshot)
+	require.NoError(err)
+	assert.Contains(string(data), `"device.TotalConnections":2`)
+	assert.Contains(string(data), `"statuses":{"sns":"not ready"}`)
+}
@@ -41,11 +41,17 @@ type Health struct {
 	log              logging.Logger
 	events           chan HealthFunc
 	statsListeners   []StatsListener
+	statuses         map[string]string
+	eventListeners   []EventListener
 	memInfoReader    *MemInfoReader
+	checker          *Checker
 	once             sync.Once
 }
 
-var _ Monitor = (*Health)(nil)
+var (
+	_ Monitor   = (*Health)(nil)
+	_ Publisher = (*Health)(nil)
+)
 
 // RequestTracker is an Alice-style constructor that wraps the given delegate in request-tracking
 // code.
@@ -90,6 +96,55 @@ func (h *Health) SendEvent(healthFunc HealthFunc) {
 	h.events <- healthFunc
 }
 
+// Publish aggregates a health event into this Health's snapshot, then dispatches the event
+// to any EventListeners.  Like SendEvent, this method places the event on the internal queue.
+func (h *Health) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	h.SendEvent(func(stats Stats) {
+		e.apply(stats, h.statuses)
+		for _, listener := range h.eventListeners {
+			listener.OnEvent(e)
+		}
+	})
+}
+
+// Publisher returns a Publisher for a single subsystem.  Each event published through the returned
+// Publisher is attributed to the given source.
+func (h *Health) Publisher(source string) Publisher {
+	return SourcePublisher(h, source)
+}
+
+// Subscribe adds a listener for the events published to this Health.  As with AddStatsListener,
+// this method is asynchronous.
+func (h *Health) Subscribe(listener EventListener) {
+	h.SendEvent(func(Stats) {
+		h.eventListeners = append(h.eventListeners, listener)
+	})
+}
+
+// Snapshot returns a copy of the current stats along with the statuses reported by subsystems
+func (h *Health) Snapshot() Snapshot {
+	output := make(chan Snapshot, 1)
+	h.SendEvent(func(stats Stats) {
+		stats.UpdateMemory(h.memInfoReader)
+		snapshot := Snapshot{
+			Stats:    stats.Clone(),
+			Statuses: make(map[string]string, len(h.statuses)),
+		}
+
+		for source, status := range h.statuses {
+			snapshot.Statuses[source] = status
+		}
+
+		output <- snapshot
+	})
+
+	return <-output
+}
+
 // New creates a Health object with the given statistics.
 func New(interval time.Duration, log logging.Logger, options ...Option) *Health {
 	initialStats := NewStats(options)
@@ -98,10 +153,18 @@ func New(interval time.Duration, log logging.Logger, options ...Option) *Health
 		stats:            initialStats,
 		statDumpInterval: interval,
 		log:              log,
+		statuses:         make(map[string]string),
 		memInfoReader:    &MemInfoReader{},
+		checker:          NewChecker(),
 	}
 }
 
+// Checker returns the health checks of this Health object.  Checks must be registered
+// before this Health object is Run, which also runs the checks.
+func (h *Health) Checker() *Checker {
+	return h.checker
+}
+
 // Run executes this Health object.  This method is idempotent:  once a
 // Health object is Run, it cannot be Run again.
 func (h *Health) Run(waitGroup *sync.WaitGroup, shutdown <-chan struct{}) error {
@@ -134,6 +197,8 @@ func (h *Health) Run(waitGroup *sync.WaitGroup, shutdown <-chan struct{}) error
 				}
 			}
 		}()
+
+		h.checker.Run(waitGroup, shutdown)
 	})
 
 	return nil
@@ -0,0 +1,208 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// RequestCounter is the total number of HTTP requests served, by route, method, and status code class
+	RequestCounter = "http_request_count"
+
+	// RequestErrorCounter is the total number of HTTP requests which failed, by route and method.  A request
+	// fails if its handler panics or responds with a status code of 500 or greater.
+	RequestErrorCounter = "http_request_error_count"
+
+	// RequestDurationHistogram is the time, in seconds, taken to serve HTTP requests, by route and method
+	RequestDurationHistogram = "http_request_duration_seconds"
+
+	// RouteLabel is the label identifying the normalized route of a request, e.g. "/api/v2/device/{deviceID}"
+	RouteLabel = "route"
+
+	// MethodLabel is the label identifying the HTTP method of a request
+	MethodLabel = "method"
+
+	// CodeLabel is the label identifying the class of a response's status code, e.g. "2xx"
+	CodeLabel = "code"
+
+	// UnmatchedRoute is the route of requests which cannot be normalized.  Raw URLs are never used
+	// as labels, since they would produce an unbounded number of series.
+	UnmatchedRoute = "unmatched"
+
+	// OtherMethod is the method label of requests with nonstandard HTTP methods
+	OtherMethod = "OTHER"
+)
+
+// Metrics is the xmetrics.Module for the HTTP SLIs in this package
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name:       RequestCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of HTTP requests served, by route, method, and status code class",
+			LabelNames: []string{RouteLabel, MethodLabel, CodeLabel},
+		},
+		{
+			Name:       RequestErrorCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of HTTP requests which panicked or responded with a server error",
+			LabelNames: []string{RouteLabel, MethodLabel},
+		},
+		{
+			Name:       RequestDurationHistogram,
+			Type:       xmetrics.HistogramType,
+			Help:       "The time in seconds taken to serve HTTP requests",
+			Buckets:    []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			LabelNames: []string{RouteLabel, MethodLabel},
+		},
+	}
+}
+
+// standardMethods are the HTTP methods which are used as labels as is
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+func normalizeMethod(method string) string {
+	if standardMethods[method] {
+		return method
+	}
+
+	return OtherMethod
+}
+
+// codeClass returns the label for a status code.  A handler that never writes a header implicitly responds with 200.
+func codeClass(statusCode int) string {
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	return fmt.Sprintf("%dxx", statusCode/100)
+}
+
+// routeTemplate returns the path template of a mux route, or UnmatchedRoute if one is not available
+func routeTemplate(route *mux.Route) string {
+	if route != nil {
+		if template, err := route.GetPathTemplate(); err == nil && len(template) > 0 {
+			return template
+		}
+	}
+
+	return UnmatchedRoute
+}
+
+// SLIStat returns the labeled health statistic for a metric of a route,
+// e.g. "SLIRequests[route=/api/v2/device/{deviceID}]"
+func SLIStat(metric, route string) Stat {
+	return Stat(fmt.Sprintf("SLI%s[route=%s]", metric, route))
+}
+
+// SLI is a source of Alice-style constructors which record per-route request rates, error rates,
+// and latencies.  Routes are normalized to path templates, so every service decorated with an SLI
+// reports consistent, bounded sets of labels.  An SLI is safe for concurrent use.
+type SLI struct {
+	requests metrics.Counter
+	errors   metrics.Counter
+	duration metrics.Histogram
+	monitor  Monitor
+	now      func() time.Time
+}
+
+// NewSLI creates an SLI which records metrics with the given provider.  If the provider is nil, metrics are discarded.
+// If a Monitor is supplied, the request and error totals of each route are also sent to it as SLIStat statistics.
+func NewSLI(provider xmetrics.Provider, monitor Monitor) *SLI {
+	if provider == nil {
+		provider = xmetrics.NewDiscardProvider()
+	}
+
+	return &SLI{
+		requests: provider.NewCounter(RequestCounter),
+		errors:   provider.NewCounter(RequestErrorCounter),
+		duration: provider.NewHistogram(RequestDurationHistogram),
+		monitor:  monitor,
+		now:      time.Now,
+	}
+}
+
+// Then decorates a handler, normalizing each request's route to the path template of the gorilla mux route
+// which matched it.  The delegate may either be a handler registered with a mux route or a *mux.Router itself.
+// Requests which match no route are recorded with the UnmatchedRoute.
+func (s *SLI) Then(delegate http.Handler) http.Handler {
+	router, _ := delegate.(*mux.Router)
+	return s.decorate(delegate, func(request *http.Request) string {
+		if route := mux.CurrentRoute(request); route != nil {
+			return routeTemplate(route)
+		}
+
+		if router != nil {
+			var match mux.RouteMatch
+			if router.Match(request, &match) {
+				return routeTemplate(match.Route)
+			}
+		}
+
+		return UnmatchedRoute
+	})
+}
+
+// Route returns an Alice-style constructor which records every request with the given route.  This is useful
+// for handlers not served by gorilla mux.
+func (s *SLI) Route(route string) func(http.Handler) http.Handler {
+	return func(delegate http.Handler) http.Handler {
+		return s.decorate(delegate, func(*http.Request) string { return route })
+	}
+}
+
+func (s *SLI) decorate(delegate http.Handler, route func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		var (
+			start           = s.now()
+			wrappedResponse = Wrap(response)
+			success         = false
+		)
+
+		defer func() {
+			var (
+				r          = route(request)
+				method     = normalizeMethod(request.Method)
+				statusCode = wrappedResponse.StatusCode()
+			)
+
+			if !success {
+				// the delegate panicked, which will be reported as a server error
+				statusCode = http.StatusInternalServerError
+			}
+
+			s.requests.With(RouteLabel, r, MethodLabel, method, CodeLabel, codeClass(statusCode)).Add(1)
+			s.duration.With(RouteLabel, r, MethodLabel, method).Observe(s.now().Sub(start).Seconds())
+
+			failed := statusCode >= 500
+			if failed {
+				s.errors.With(RouteLabel, r, MethodLabel, method).Add(1)
+			}
+
+			if s.monitor != nil {
+				s.monitor.SendEvent(Inc(SLIStat("Requests", r), 1))
+				if failed {
+					s.monitor.SendEvent(Inc(SLIStat("Errors", r), 1))
+				}
+			}
+		}()
+
+		delegate.ServeHTTP(wrappedResponse, request)
+		success = true
+	})
+}
@@ -0,0 +1,180 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statsMonitor is a Monitor which applies events synchronously to a Stats map
+type statsMonitor struct {
+	lock  sync.Mutex
+	stats Stats
+}
+
+func (m *statsMonitor) SendEvent(f HealthFunc) {
+	m.lock.Lock()
+	f(m.stats)
+	m.lock.Unlock()
+}
+
+func (m *statsMonitor) ServeHTTP(http.ResponseWriter, *http.Request) {
+}
+
+func TestSLIMetrics(t *testing.T) {
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	assert.NotNil(t, registry)
+	assert.NoError(t, err)
+}
+
+func TestNewSLIDefaults(t *testing.T) {
+	assert := assert.New(t)
+	sli := NewSLI(nil, nil)
+	require.NotNil(t, sli)
+
+	response := httptest.NewRecorder()
+	sli.Route("/test")(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		response.WriteHeader(http.StatusAccepted)
+	})).ServeHTTP(response, httptest.NewRequest("GET", "/test", nil))
+
+	assert.Equal(http.StatusAccepted, response.Code)
+}
+
+func TestNormalizeMethod(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("GET", normalizeMethod("GET"))
+	assert.Equal("DELETE", normalizeMethod("DELETE"))
+	assert.Equal(OtherMethod, normalizeMethod("PROPFIND"))
+	assert.Equal(OtherMethod, normalizeMethod("get"))
+}
+
+func TestCodeClass(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("2xx", codeClass(0))
+	assert.Equal("2xx", codeClass(http.StatusNoContent))
+	assert.Equal("4xx", codeClass(http.StatusNotFound))
+	assert.Equal("5xx", codeClass(http.StatusServiceUnavailable))
+}
+
+func TestSLI(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+		monitor       = &statsMonitor{stats: make(Stats)}
+		now           = time.Now()
+	)
+
+	require.NoError(err)
+	sli := NewSLI(registry, monitor)
+	sli.now = func() time.Time {
+		// every request appears to take 10 milliseconds
+		now = now.Add(10 * time.Millisecond)
+		return now
+	}
+
+	router := mux.NewRouter()
+	router.Handle("/devices/{deviceID}", sli.Then(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if mux.Vars(request)["deviceID"] == "missing" {
+			response.WriteHeader(http.StatusNotFound)
+		} else if mux.Vars(request)["deviceID"] == "broken" {
+			response.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))).Methods("GET", "PROPFIND")
+
+	router.Handle("/panic", sli.Then(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("expected")
+	})))
+
+	for _, target := range []string{"/devices/mac:112233445566", "/devices/mac:665544332211", "/devices/missing", "/devices/broken"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PROPFIND", "/devices/mac:112233445566", nil))
+	assert.Panics(func() {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/panic", nil))
+	})
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	output := response.Body.String()
+
+	assert.Contains(output, RequestCounter+`{code="2xx",method="GET",route="/devices/{deviceID}"} 2`)
+	assert.Contains(output, RequestCounter+`{code="4xx",method="GET",route="/devices/{deviceID}"} 1`)
+	assert.Contains(output, RequestCounter+`{code="5xx",method="GET",route="/devices/{deviceID}"} 1`)
+	assert.Contains(output, RequestCounter+`{code="2xx",method="OTHER",route="/devices/{deviceID}"} 1`)
+	assert.Contains(output, RequestCounter+`{code="5xx",method="POST",route="/panic"} 1`)
+	assert.Contains(output, RequestErrorCounter+`{method="GET",route="/devices/{deviceID}"} 1`)
+	assert.Contains(output, RequestErrorCounter+`{method="POST",route="/panic"} 1`)
+	assert.Contains(output, RequestDurationHistogram+`_count{method="GET",route="/devices/{deviceID}"} 4`)
+	assert.NotContains(output, "mac:112233445566")
+
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	assert.Equal(
+		Stats{
+			SLIStat("Requests", "/devices/{deviceID}"): 5,
+			SLIStat("Errors", "/devices/{deviceID}"):   1,
+			SLIStat("Requests", "/panic"):              1,
+			SLIStat("Errors", "/panic"):                1,
+		},
+		monitor.stats,
+	)
+}
+
+func TestSLIRouter(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+		router        = mux.NewRouter()
+	)
+
+	require.NoError(err)
+	router.HandleFunc("/hooks/{id}", func(http.ResponseWriter, *http.Request) {})
+
+	// the whole router is decorated, so routes are matched before dispatch
+	handler := NewSLI(registry, nil).Then(router)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hooks/1234", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nosuch/1234", nil))
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	output := response.Body.String()
+
+	assert.Contains(output, RequestCounter+`{code="2xx",method="GET",route="/hooks/{id}"} 1`)
+	assert.Contains(output, RequestCounter+`{code="4xx",method="GET",route="unmatched"} 1`)
+	assert.NotContains(output, "1234")
+}
+
+func TestSLIRoute(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+	)
+
+	require.NoError(err)
+	handler := NewSLI(registry, nil).Route("legacy")(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		response.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/legacy/1234", nil))
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	output := response.Body.String()
+
+	assert.Contains(output, RequestCounter+`{code="5xx",method="DELETE",route="legacy"} 1`)
+	assert.Contains(output, RequestErrorCounter+`{method="DELETE",route="legacy"} 1`)
+}
@@ -0,0 +1,295 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SLOState is the health of a single objective, determined by how fast its error budget is burning
+type SLOState string
+
+const (
+	SLOHealthy  SLOState = "healthy"
+	SLOAtRisk   SLOState = "at_risk"
+	SLOCritical SLOState = "critical"
+
+	DefaultSLOWindow           time.Duration = time.Hour
+	DefaultSLOWarningBurnRate                = 2.0
+	DefaultSLOCriticalBurnRate               = 10.0
+
+	// sloBuckets is the number of buckets into which each objective's window is divided
+	sloBuckets = 60
+
+	// sloEpsilon absorbs floating point error when comparing burn rates, e.g. 1 - 0.99 is slightly more than 0.01
+	sloEpsilon = 1e-9
+)
+
+var (
+	ErrorSLONoName        = errors.New("Service level objectives must be named")
+	ErrorSLOInvalidTarget = errors.New("Service level objective targets must be greater than 0 and less than 1")
+	ErrorSLODuplicateName = errors.New("Duplicate service level objective")
+)
+
+// Objective describes a service level objective for a named operation, such as message routing or
+// webhook delivery.  The error budget of an objective is 1 - Target.  The burn rate is the ratio of the
+// actual failure rate within the rolling Window to the error budget, so a burn rate of 1 consumes the budget
+// exactly as fast as the objective allows.
+type Objective struct {
+	// Name identifies the operation, e.g. "routing"
+	Name string `json:"name"`
+
+	// Target is the objective's success ratio, e.g. 0.999
+	Target float64 `json:"target"`
+
+	// Window is the rolling period over which success is measured.  If not supplied, DefaultSLOWindow is used.
+	Window time.Duration `json:"window"`
+
+	// WarningBurnRate is the burn rate at which the objective is at risk.  If not supplied,
+	// DefaultSLOWarningBurnRate is used.
+	WarningBurnRate float64 `json:"warningBurnRate"`
+
+	// CriticalBurnRate is the burn rate at which the objective is critical.  If not supplied,
+	// DefaultSLOCriticalBurnRate is used.
+	CriticalBurnRate float64 `json:"criticalBurnRate"`
+}
+
+func (o *Objective) window() time.Duration {
+	if o.Window > 0 {
+		return o.Window
+	}
+
+	return DefaultSLOWindow
+}
+
+func (o *Objective) warningBurnRate() float64 {
+	if o.WarningBurnRate > 0 {
+		return o.WarningBurnRate
+	}
+
+	return DefaultSLOWarningBurnRate
+}
+
+func (o *Objective) criticalBurnRate() float64 {
+	if o.CriticalBurnRate > 0 {
+		return o.CriticalBurnRate
+	}
+
+	return DefaultSLOCriticalBurnRate
+}
+
+// SLOStatus is a snapshot of an objective's performance over its rolling window
+type SLOStatus struct {
+	Name         string   `json:"name"`
+	Target       float64  `json:"target"`
+	Window       string   `json:"window"`
+	Total        int      `json:"total"`
+	Failures     int      `json:"failures"`
+	SuccessRatio float64  `json:"successRatio"`
+	BurnRate     float64  `json:"burnRate"`
+	State        SLOState `json:"state"`
+}
+
+// sloBucket counts the outcomes within one slice of an objective's window
+type sloBucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+// sloSeries is the rolling record of outcomes for a single objective
+type sloSeries struct {
+	objective Objective
+	width     time.Duration
+	buckets   [sloBuckets]sloBucket
+}
+
+// bucket returns the bucket for the given time, resetting it if it holds stale counts
+func (s *sloSeries) bucket(now time.Time) *sloBucket {
+	start := now.Truncate(s.width)
+	b := &s.buckets[(start.UnixNano()/int64(s.width))%sloBuckets]
+	if !b.start.Equal(start) {
+		*b = sloBucket{start: start}
+	}
+
+	return b
+}
+
+func (s *sloSeries) status(now time.Time) SLOStatus {
+	status := SLOStatus{
+		Name:         s.objective.Name,
+		Target:       s.objective.Target,
+		Window:       s.objective.window().String(),
+		SuccessRatio: 1,
+		State:        SLOHealthy,
+	}
+
+	oldest := now.Truncate(s.width).Add(-s.width * (sloBuckets - 1))
+	for _, b := range s.buckets {
+		if !b.start.Before(oldest) && !b.start.After(now) {
+			status.Total += b.total
+			status.Failures += b.failures
+		}
+	}
+
+	if status.Total > 0 {
+		failureRatio := float64(status.Failures) / float64(status.Total)
+		status.SuccessRatio = 1 - failureRatio
+		status.BurnRate = failureRatio / (1 - s.objective.Target)
+	}
+
+	switch {
+	case status.BurnRate+sloEpsilon >= s.objective.criticalBurnRate():
+		status.State = SLOCritical
+	case status.BurnRate+sloEpsilon >= s.objective.warningBurnRate():
+		status.State = SLOAtRisk
+	}
+
+	return status
+}
+
+// SLOTracker computes rolling success ratios and error budget burn rates for a set of objectives.
+// Outcomes are recorded by operation name, and outcomes for operations without an objective are ignored.
+// An SLOTracker is safe for concurrent use.
+type SLOTracker struct {
+	lock   sync.Mutex
+	now    func() time.Time
+	series map[string]*sloSeries
+}
+
+// NewSLOTracker creates an SLOTracker for the given objectives.  An error is returned if any
+// objective is unnamed, has a target outside (0, 1), or shares a name with another objective.
+func NewSLOTracker(objectives ...Objective) (*SLOTracker, error) {
+	tracker := &SLOTracker{
+		now:    time.Now,
+		series: make(map[string]*sloSeries, len(objectives)),
+	}
+
+	for _, objective := range objectives {
+		if len(objective.Name) == 0 {
+			return nil, ErrorSLONoName
+		} else if objective.Target <= 0 || objective.Target >= 1 {
+			return nil, ErrorSLOInvalidTarget
+		} else if _, ok := tracker.series[objective.Name]; ok {
+			return nil, ErrorSLODuplicateName
+		}
+
+		width := objective.window() / sloBuckets
+		if width <= 0 {
+			width = 1
+		}
+
+		tracker.series[objective.Name] = &sloSeries{
+			objective: objective,
+			width:     width,
+		}
+	}
+
+	return tracker, nil
+}
+
+// Record counts the outcome of a single operation against its objective
+func (t *SLOTracker) Record(name string, success bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if s, ok := t.series[name]; ok {
+		b := s.bucket(t.now())
+		b.total++
+		if !success {
+			b.failures++
+		}
+	}
+}
+
+// Status returns the current status of a single objective
+func (t *SLOTracker) Status(name string) (SLOStatus, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if s, ok := t.series[name]; ok {
+		return s.status(t.now()), true
+	}
+
+	return SLOStatus{}, false
+}
+
+// Statuses returns the current status of every objective, ordered by name
+func (t *SLOTracker) Statuses() []SLOStatus {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var (
+		now      = t.now()
+		statuses = make([]SLOStatus, 0, len(t.series))
+	)
+
+	for _, s := range t.series {
+		statuses = append(statuses, s.status(now))
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// SLOStat returns the labeled health statistic for a metric of an objective,
+// e.g. "SLOBurnRatePermille[operation=routing]"
+func SLOStat(metric, name string) Stat {
+	return Stat(fmt.Sprintf("SLO%s[operation=%s]", metric, name))
+}
+
+// sloStateValues are the integer values of SLOStates reported as health statistics
+var sloStateValues = map[SLOState]int{
+	SLOHealthy:  0,
+	SLOAtRisk:   1,
+	SLOCritical: 2,
+}
+
+// Update returns a HealthFunc which sets the current SLO metrics in a Stats map.  Since Stats are integers,
+// burn rates are reported in thousandths and success ratios in millionths.  States are reported as 0 for healthy,
+// 1 for at risk, and 2 for critical.  A typical use is to send this function to a Monitor at regular intervals.
+func (t *SLOTracker) Update() HealthFunc {
+	statuses := t.Statuses()
+	return func(stats Stats) {
+		for _, status := range statuses {
+			stats[SLOStat("BurnRatePermille", status.Name)] = int(status.BurnRate * 1000)
+			stats[SLOStat("SuccessRatioPPM", status.Name)] = int(status.SuccessRatio * 1000000)
+			stats[SLOStat("State", status.Name)] = sloStateValues[status.State]
+		}
+	}
+}
+
+// RequestTracker returns an Alice-style constructor that records the outcome of each request against
+// the named objective.  Responses with status codes of 500 or greater, as well as panics, are failures.
+// Client errors do not consume the error budget.
+func (t *SLOTracker) RequestTracker(name string) func(http.Handler) http.Handler {
+	return func(delegate http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			wrappedResponse := Wrap(response)
+			success := false
+			defer func() {
+				t.Record(name, success && wrappedResponse.StatusCode() < 500)
+			}()
+
+			delegate.ServeHTTP(wrappedResponse, request)
+			success = true
+		})
+	}
+}
+
+// ServeHTTP writes the status of every objective as JSON
+func (t *SLOTracker) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	data, err := json.Marshal(t.Statuses())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(response, `{"message": "%s"}`, err.Error())
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(data)
+}
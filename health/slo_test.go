@@ -0,0 +1,161 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSLOTrackerInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	for objectives, expectedError := range map[*[]Objective]error{
+		{{Target: 0.99}}:               ErrorSLONoName,
+		{{Name: "routing"}}:            ErrorSLOInvalidTarget,
+		{{Name: "routing", Target: 1}}: ErrorSLOInvalidTarget,
+		{{Name: "routing", Target: 0.9}, {Name: "routing", Target: 0.99}}: ErrorSLODuplicateName,
+	} {
+		tracker, err := NewSLOTracker(*objectives...)
+		assert.Nil(tracker)
+		assert.Equal(expectedError, err)
+	}
+}
+
+func TestSLOTracker(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		now     = time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+	)
+
+	tracker, err := NewSLOTracker(
+		Objective{Name: "routing", Target: 0.99, Window: time.Minute},
+		Objective{Name: "delivery", Target: 0.9, WarningBurnRate: 1, CriticalBurnRate: 5},
+	)
+
+	require.NoError(err)
+	tracker.now = func() time.Time { return now }
+
+	status, ok := tracker.Status("nosuch")
+	assert.False(ok)
+
+	status, ok = tracker.Status("routing")
+	assert.True(ok)
+	assert.Equal(
+		SLOStatus{Name: "routing", Target: 0.99, Window: "1m0s", SuccessRatio: 1, State: SLOHealthy},
+		status,
+	)
+
+	// 1% failures burns the routing budget at exactly 1
+	for index := 0; index < 100; index++ {
+		tracker.Record("routing", index != 0)
+		tracker.Record("nosuch", false)
+	}
+
+	status, _ = tracker.Status("routing")
+	assert.Equal(100, status.Total)
+	assert.Equal(1, status.Failures)
+	assert.InDelta(0.99, status.SuccessRatio, 0.0001)
+	assert.InDelta(1.0, status.BurnRate, 0.0001)
+	assert.Equal(SLOHealthy, status.State)
+
+	now = now.Add(30 * time.Second)
+	for index := 0; index < 10; index++ {
+		tracker.Record("routing", false)
+	}
+
+	status, _ = tracker.Status("routing")
+	assert.Equal(110, status.Total)
+	assert.Equal(11, status.Failures)
+	assert.InDelta(10.0, status.BurnRate, 0.0001)
+	assert.Equal(SLOCritical, status.State)
+
+	// the first batch of outcomes falls out of the window
+	now = now.Add(45 * time.Second)
+	tracker.Record("routing", true)
+	status, _ = tracker.Status("routing")
+	assert.Equal(11, status.Total)
+	assert.Equal(10, status.Failures)
+
+	now = now.Add(2 * time.Minute)
+	status, _ = tracker.Status("routing")
+	assert.Zero(status.Total)
+	assert.Equal(SLOHealthy, status.State)
+
+	tracker.Record("delivery", true)
+	tracker.Record("delivery", false)
+	tracker.Record("delivery", true)
+	tracker.Record("delivery", true)
+	tracker.Record("delivery", true)
+
+	statuses := tracker.Statuses()
+	require.Len(statuses, 2)
+	assert.Equal("delivery", statuses[0].Name)
+	assert.Equal("1h0m0s", statuses[0].Window)
+	assert.InDelta(2.0, statuses[0].BurnRate, 0.0001)
+	assert.Equal(SLOAtRisk, statuses[0].State)
+	assert.Equal("routing", statuses[1].Name)
+
+	stats := make(Stats)
+	tracker.Update()(stats)
+	assert.Equal(
+		Stats{
+			SLOStat("BurnRatePermille", "delivery"): 2000,
+			SLOStat("SuccessRatioPPM", "delivery"):  800000,
+			SLOStat("State", "delivery"):            1,
+			SLOStat("BurnRatePermille", "routing"):  0,
+			SLOStat("SuccessRatioPPM", "routing"):   1000000,
+			SLOStat("State", "routing"):             0,
+		},
+		stats,
+	)
+
+	response := httptest.NewRecorder()
+	tracker.ServeHTTP(response, httptest.NewRequest("GET", "/slo", nil))
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal("application/json", response.HeaderMap.Get("Content-Type"))
+
+	var served []SLOStatus
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &served))
+	assert.Equal(statuses, served)
+}
+
+func TestSLOTrackerRequestTracker(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	tracker, err := NewSLOTracker(Objective{Name: "api", Target: 0.5})
+	require.NoError(err)
+
+	handler := tracker.RequestTracker("api")(
+		http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			switch request.URL.Path {
+			case "/panic":
+				panic("expected")
+			case "/notfound":
+				response.WriteHeader(http.StatusNotFound)
+			case "/error":
+				response.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}),
+	)
+
+	for _, path := range []string{"/", "/notfound", "/error"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	assert.Panics(func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	})
+
+	status, _ := tracker.Status("api")
+	assert.Equal(4, status.Total)
+	assert.Equal(2, status.Failures)
+}
@@ -1,4 +1,8 @@
 /*
 Package httperror provides simple HTTP response formatting targetted at reporting errors as JSON.
+
+This package also defines the typed errors shared across webpa-common.  Each Error has a Kind, which
+maps onto a single HTTP status code, so that consuming services can classify errors without matching
+their text.
 */
 package httperror
@@ -0,0 +1,164 @@
+package httperror
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Kind identifies a category of error which consuming services handle in the same way, regardless of
+// the text of the error.  Each Kind maps onto a single HTTP status code.
+type Kind int
+
+const (
+	// Unknown is the Kind of errors which were not created by this package
+	Unknown Kind = iota
+
+	// DeviceNotFound indicates that a device is not connected
+	DeviceNotFound
+
+	// DeviceBusy indicates that a device cannot accept any more messages
+	DeviceBusy
+
+	// InvalidWRPFormat indicates that a WRP message could not be decoded
+	InvalidWRPFormat
+
+	// ValidatorRejected indicates that a request's credentials failed validation
+	ValidatorRejected
+
+	// WebhookExpired indicates that a webhook registration expires before it could be used
+	WebhookExpired
+)
+
+var (
+	kindNames = map[Kind]string{
+		Unknown:           "Unknown",
+		DeviceNotFound:    "DeviceNotFound",
+		DeviceBusy:        "DeviceBusy",
+		InvalidWRPFormat:  "InvalidWRPFormat",
+		ValidatorRejected: "ValidatorRejected",
+		WebhookExpired:    "WebhookExpired",
+	}
+
+	// kindStatusCodes is the one place each Kind is mapped onto an HTTP status code
+	kindStatusCodes = map[Kind]int{
+		DeviceNotFound:    http.StatusNotFound,
+		DeviceBusy:        http.StatusServiceUnavailable,
+		InvalidWRPFormat:  http.StatusBadRequest,
+		ValidatorRejected: http.StatusForbidden,
+		WebhookExpired:    http.StatusGone,
+	}
+)
+
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// StatusCode returns the HTTP status code for this Kind, which is http.StatusInternalServerError for Unknown
+func (k Kind) StatusCode() int {
+	if code, ok := kindStatusCodes[k]; ok {
+		return code
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Error is a typed error with a Kind, optionally wrapping the error that caused it.  Callers compare the
+// Kind, via KindOf, rather than matching the text of errors.
+type Error struct {
+	Kind Kind
+	Text string
+	Err  error
+}
+
+// New creates an Error of the given Kind with a fixed text.  Packages use this function to declare their
+// sentinel errors, which can still be compared with ==.
+func New(k Kind, text string) *Error {
+	return &Error{Kind: k, Text: text}
+}
+
+// Wrap creates an Error of the given Kind whose text is that of the wrapped error.  A nil error
+// is returned as nil.
+func Wrap(k Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{Kind: k, Err: err}
+}
+
+func (e *Error) Error() string {
+	switch {
+	case len(e.Text) > 0 && e.Err != nil:
+		return e.Text + ": " + e.Err.Error()
+	case e.Err != nil:
+		return e.Err.Error()
+	default:
+		return e.Text
+	}
+}
+
+// Cause returns the wrapped error, if any
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// Unwrap is a synonym for Cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an *Error of the same Kind, so that any error of a Kind matches
+// any other error of that Kind
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind
+}
+
+// StatusCode returns the HTTP status code for this error's Kind
+func (e *Error) StatusCode() int {
+	return e.Kind.StatusCode()
+}
+
+// causer is implemented by errors which wrap another error
+type causer interface {
+	Cause() error
+}
+
+// KindOf returns the Kind of the first *Error in an error's chain of causes, or Unknown
+// if there is no such error
+func KindOf(err error) Kind {
+	for err != nil {
+		if e, ok := err.(*Error); ok {
+			return e.Kind
+		}
+
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+
+		err = c.Cause()
+	}
+
+	return Unknown
+}
+
+// StatusCode returns the HTTP status code for an error, using the Kind of the error.  If the error
+// has no Kind, defaultCode is returned.
+func StatusCode(err error, defaultCode int) int {
+	if k := KindOf(err); k != Unknown {
+		return k.StatusCode()
+	}
+
+	return defaultCode
+}
+
+// Write formats an error as a JSON response, using the status code for the error's Kind or
+// defaultCode if the error has no Kind
+func Write(response http.ResponseWriter, err error, defaultCode int) (int, error) {
+	return Format(response, StatusCode(err, defaultCode), err)
+}
@@ -0,0 +1,93 @@
+package httperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKind(t *testing.T) {
+	assert := assert.New(t)
+
+	for kind, expected := range map[Kind]int{
+		Unknown:           http.StatusInternalServerError,
+		DeviceNotFound:    http.StatusNotFound,
+		DeviceBusy:        http.StatusServiceUnavailable,
+		InvalidWRPFormat:  http.StatusBadRequest,
+		ValidatorRejected: http.StatusForbidden,
+		WebhookExpired:    http.StatusGone,
+		Kind(100):         http.StatusInternalServerError,
+	} {
+		assert.Equal(expected, kind.StatusCode(), kind.String())
+	}
+
+	assert.Equal("DeviceNotFound", DeviceNotFound.String())
+	assert.Equal("Kind(100)", Kind(100).String())
+}
+
+func TestError(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		cause    = errors.New("expected")
+		sentinel = New(DeviceBusy, "busy")
+	)
+
+	assert.Equal("busy", sentinel.Error())
+	assert.Nil(sentinel.Cause())
+	assert.Equal(http.StatusServiceUnavailable, sentinel.StatusCode())
+
+	assert.Nil(Wrap(InvalidWRPFormat, nil))
+
+	wrapped := Wrap(InvalidWRPFormat, cause).(*Error)
+	assert.Equal("expected", wrapped.Error())
+	assert.Equal(cause, wrapped.Cause())
+	assert.Equal(cause, wrapped.Unwrap())
+
+	described := &Error{Kind: DeviceNotFound, Text: "lookup failed", Err: cause}
+	assert.Equal("lookup failed: expected", described.Error())
+
+	assert.True(sentinel.Is(New(DeviceBusy, "another")))
+	assert.False(sentinel.Is(New(DeviceNotFound, "busy")))
+	assert.False(sentinel.Is(cause))
+}
+
+// causeError is an error wrapper of the sort produced by github.com/pkg/errors
+type causeError struct {
+	cause error
+}
+
+func (c causeError) Error() string { return "wrapped: " + c.cause.Error() }
+func (c causeError) Cause() error  { return c.cause }
+
+func TestKindOf(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(Unknown, KindOf(nil))
+	assert.Equal(Unknown, KindOf(errors.New("untyped")))
+	assert.Equal(Unknown, KindOf(causeError{errors.New("untyped")}))
+	assert.Equal(DeviceNotFound, KindOf(New(DeviceNotFound, "missing")))
+	assert.Equal(WebhookExpired, KindOf(causeError{causeError{New(WebhookExpired, "expired")}}))
+
+	assert.Equal(http.StatusNotFound, StatusCode(New(DeviceNotFound, "missing"), http.StatusTeapot))
+	assert.Equal(http.StatusTeapot, StatusCode(errors.New("untyped"), http.StatusTeapot))
+}
+
+func TestWrite(t *testing.T) {
+	assert := assert.New(t)
+
+	for err, expected := range map[error]int{
+		New(ValidatorRejected, "denied"): http.StatusForbidden,
+		errors.New("untyped"):            http.StatusBadRequest,
+	} {
+		response := httptest.NewRecorder()
+		count, writeErr := Write(response, err, http.StatusBadRequest)
+		assert.True(count > 0)
+		assert.NoError(writeErr)
+		assert.Equal(expected, response.Code)
+		assert.JSONEq(fmt.Sprintf(`{"code": %d, "message": "%s"}`, expected, err), response.Body.String())
+	}
+}
@@ -0,0 +1,143 @@
+package httppool
+
+import (
+	"errors"
+	"github.com/go-kit/kit/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+var (
+	ErrorBreakerOpen = errors.New("The circuit breaker for that host is open")
+)
+
+// BreakerOptions configures the per-host circuit breakers of a Client.  A host's breaker trips
+// after a number of consecutive failures, where a failure is either a transport error or a 5xx response.
+// While tripped, requests to that host fail immediately with ErrorBreakerOpen.  Once the cooldown has
+// elapsed, a single trial request is let through:  if it succeeds the breaker resets, otherwise it trips again.
+type BreakerOptions struct {
+	// Threshold is the number of consecutive failures which trips a host's breaker.
+	// If nonpositive, DefaultBreakerThreshold is used.
+	Threshold int
+
+	// Cooldown is the length of time a tripped breaker rejects requests before allowing a trial.
+	// If nonpositive, DefaultBreakerCooldown is used.
+	Cooldown time.Duration
+}
+
+func (o *BreakerOptions) threshold() int {
+	if o != nil && o.Threshold > 0 {
+		return o.Threshold
+	}
+
+	return DefaultBreakerThreshold
+}
+
+func (o *BreakerOptions) cooldown() time.Duration {
+	if o != nil && o.Cooldown > 0 {
+		return o.Cooldown
+	}
+
+	return DefaultBreakerCooldown
+}
+
+// breaker is the state of a single host's circuit
+type breaker struct {
+	failures int
+	open     bool
+	openedAt time.Time
+	trial    bool
+}
+
+// breakers tracks a circuit breaker for each host
+type breakers struct {
+	lock      sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+	hosts     map[string]*breaker
+
+	trips       metrics.Counter
+	openCircuit metrics.Gauge
+}
+
+func newBreakers(o *BreakerOptions, trips metrics.Counter, openCircuit metrics.Gauge) *breakers {
+	return &breakers{
+		threshold:   o.threshold(),
+		cooldown:    o.cooldown(),
+		now:         time.Now,
+		hosts:       make(map[string]*breaker),
+		trips:       trips,
+		openCircuit: openCircuit,
+	}
+}
+
+// allow determines if a request to the given host may proceed.  While a host's breaker is open,
+// this method returns ErrorBreakerOpen except for the single trial request after the cooldown.
+func (b *breakers) allow(host string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	state := b.hosts[host]
+	if state == nil || !state.open {
+		return nil
+	}
+
+	if state.trial || b.now().Sub(state.openedAt) < b.cooldown {
+		return ErrorBreakerOpen
+	}
+
+	state.trial = true
+	return nil
+}
+
+// isOpen tests whether the given host's breaker is currently open.  Unlike allow,
+// this method never starts a trial.
+func (b *breakers) isOpen(host string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	state := b.hosts[host]
+	return state != nil && state.open
+}
+
+// record updates the given host's breaker with the outcome of a request
+func (b *breakers) record(host string, failed bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	state := b.hosts[host]
+	if !failed {
+		if state != nil {
+			if state.open {
+				b.openCircuit.Add(-1)
+			}
+
+			delete(b.hosts, host)
+		}
+
+		return
+	}
+
+	if state == nil {
+		state = new(breaker)
+		b.hosts[host] = state
+	}
+
+	state.failures++
+	if state.open {
+		// a failed trial starts another cooldown
+		state.trial = false
+		state.openedAt = b.now()
+	} else if state.failures >= b.threshold {
+		state.open = true
+		state.openedAt = b.now()
+		b.trips.Add(1)
+		b.openCircuit.Add(1)
+	}
+}
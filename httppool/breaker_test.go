@@ -0,0 +1,64 @@
+package httppool
+
+import (
+	"github.com/go-kit/kit/metrics/generic"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBreakerOptionsDefaults(t *testing.T) {
+	assert := assert.New(t)
+	for _, o := range []*BreakerOptions{nil, new(BreakerOptions), &BreakerOptions{Threshold: -1, Cooldown: -1}} {
+		assert.Equal(DefaultBreakerThreshold, o.threshold())
+		assert.Equal(DefaultBreakerCooldown, o.cooldown())
+	}
+}
+
+func TestBreakers(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		trips       = generic.NewCounter("trips")
+		openCircuit = generic.NewGauge("open")
+		b           = newBreakers(&BreakerOptions{Threshold: 2, Cooldown: time.Minute}, trips, openCircuit)
+		now         = time.Now()
+	)
+
+	b.now = func() time.Time { return now }
+
+	assert.NoError(b.allow("host1"))
+	b.record("host1", true)
+	assert.NoError(b.allow("host1"))
+
+	// a success resets the consecutive failures
+	b.record("host1", false)
+	b.record("host1", true)
+	assert.NoError(b.allow("host1"))
+	assert.False(b.isOpen("host1"))
+	b.record("host1", true)
+	assert.True(b.isOpen("host1"))
+	assert.Equal(ErrorBreakerOpen, b.allow("host1"))
+	assert.Equal(1.0, trips.Value())
+	assert.Equal(1.0, openCircuit.Value())
+
+	// breakers are independent for each host
+	assert.NoError(b.allow("host2"))
+
+	// after the cooldown, exactly one trial is allowed
+	now = now.Add(time.Minute)
+	assert.NoError(b.allow("host1"))
+	assert.Equal(ErrorBreakerOpen, b.allow("host1"))
+
+	// a failed trial starts another cooldown
+	b.record("host1", true)
+	assert.Equal(ErrorBreakerOpen, b.allow("host1"))
+	assert.Equal(1.0, trips.Value())
+
+	now = now.Add(time.Minute)
+	assert.NoError(b.allow("host1"))
+	b.record("host1", false)
+	assert.False(b.isOpen("host1"))
+	assert.NoError(b.allow("host1"))
+	assert.NoError(b.allow("host1"))
+	assert.Equal(0.0, openCircuit.Value())
+}
@@ -1,9 +1,11 @@
 package httppool
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/xmetrics"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -60,6 +62,36 @@ type Client struct {
 	// Period is the interval between requests on EACH worker.  If this
 	// value is zero or negative, the workers will not be rate-limited.
 	Period time.Duration
+
+	// ConnectionListener is the optional sink for connection statistics, such as connection
+	// reuse and DNS and TLS latencies.  If not supplied, requests are not traced.
+	ConnectionListener ConnectionListener
+
+	// KeepaliveProbe optionally configures validation of pooled connections prior to use.
+	// If not supplied, no probes are sent.
+	KeepaliveProbe *KeepaliveProbe
+
+	// Timeout is the limit on each HTTP transaction, including reading the response body
+	// in the task's Consumer.  If this value is zero or negative, transactions have no timeout
+	// beyond any imposed by the Handler or the request's context.
+	Timeout time.Duration
+
+	// Breaker optionally configures per-host circuit breakers.  If not supplied, requests are
+	// always sent regardless of prior failures.
+	Breaker *BreakerOptions
+
+	// Retries is the maximum number of times a failed transaction is retried.  Retries are limited
+	// by the RetryBudget, and only requests whose bodies can be rewound are retried.  If this value
+	// is zero or negative, no retries are made.
+	Retries int
+
+	// RetryBudget limits retries to a fraction of overall requests.  If not supplied and Retries is
+	// positive, DefaultRetryRatio and DefaultRetryBurst are used.
+	RetryBudget *RetryBudget
+
+	// MetricsProvider is the source of the metrics declared by Metrics.  If not supplied,
+	// metrics are discarded.
+	MetricsProvider xmetrics.Provider
 }
 
 func (client *Client) name() string {
@@ -102,6 +134,14 @@ func (client *Client) handler() transactionHandler {
 	return http.DefaultClient
 }
 
+func (client *Client) metricsProvider() xmetrics.Provider {
+	if client.MetricsProvider != nil {
+		return client.MetricsProvider
+	}
+
+	return xmetrics.NewDiscardProvider()
+}
+
 // Start starts the pool of goroutines and returns a DispatchCloser which
 // can be used to send tasks and shut down the pool.
 func (client *Client) Start() (dispatcher DispatchCloser) {
@@ -119,29 +159,43 @@ func (client *Client) Start() (dispatcher DispatchCloser) {
 		copy(listeners, client.Listeners)
 	}
 
+	var prober *prober
+	if client.KeepaliveProbe != nil {
+		prober = newProber(client.KeepaliveProbe)
+	}
+
+	pooled := pooledDispatcher{
+		name:               name,
+		handler:            client.handler(),
+		listeners:          listeners,
+		connectionListener: client.ConnectionListener,
+		prober:             prober,
+		logger:             logger,
+		tasks:              make(chan Task, client.queueSize()),
+		timeout:            client.Timeout,
+		measures:           newMeasures(name, client.metricsProvider()),
+	}
+
+	if client.Breaker != nil {
+		pooled.breakers = newBreakers(client.Breaker, pooled.measures.trips, pooled.measures.openCircuit)
+	}
+
+	if client.Retries > 0 {
+		pooled.retries = client.Retries
+		pooled.budget = newRetryBudget(client.RetryBudget)
+	}
+
 	if client.Period > 0 {
 		limited := &limitedClientDispatcher{
-			pooledDispatcher: pooledDispatcher{
-				name:      name,
-				handler:   client.handler(),
-				listeners: listeners,
-				logger:    logger,
-				tasks:     make(chan Task, client.queueSize()),
-			},
-			period: client.Period,
+			pooledDispatcher: pooled,
+			period:           client.Period,
 		}
 
 		worker = limited.worker
 		dispatcher = limited
 	} else {
 		unlimited := &unlimitedClientDispatcher{
-			pooledDispatcher: pooledDispatcher{
-				name:      name,
-				handler:   client.handler(),
-				listeners: listeners,
-				logger:    logger,
-				tasks:     make(chan Task, client.queueSize()),
-			},
+			pooledDispatcher: pooled,
 		}
 
 		worker = unlimited.worker
@@ -189,12 +243,31 @@ func (w *workerContext) dispatch(eventType EventType, eventError error) {
 // pooledDispatcher supplies the common state and logic for all
 // Client-based dispatchers
 type pooledDispatcher struct {
-	state     int32
-	name      string
-	handler   transactionHandler
-	logger    logging.Logger
-	listeners []Listener
-	tasks     chan Task
+	state              int32
+	name               string
+	handler            transactionHandler
+	logger             logging.Logger
+	listeners          []Listener
+	connectionListener ConnectionListener
+	prober             *prober
+	tasks              chan Task
+	timeout            time.Duration
+
+	// breakers is nil when circuit breaking is disabled
+	breakers *breakers
+
+	// retries is the maximum number of retries per task, and budget is nil when retries are disabled
+	retries int
+	budget  *retryBudget
+
+	measures measures
+}
+
+// updateQueueDepth records the current number of queued tasks
+func (pooled *pooledDispatcher) updateQueueDepth() {
+	if pooled.measures.queueDepth != nil {
+		pooled.measures.queueDepth.Set(float64(len(pooled.tasks)))
+	}
 }
 
 // dispatch sends the given event to all configured listeners
@@ -236,6 +309,7 @@ func (pooled *pooledDispatcher) Send(task Task) (err error) {
 			err = ErrorClosed
 		}
 
+		pooled.updateQueueDepth()
 		pooled.dispatch(eventType, err)
 	}()
 
@@ -256,6 +330,7 @@ func (pooled *pooledDispatcher) Offer(task Task) (taken bool, err error) {
 			eventType = EventTypeReject
 		}
 
+		pooled.updateQueueDepth()
 		pooled.dispatch(eventType, err)
 	}()
 
@@ -271,46 +346,78 @@ func (pooled *pooledDispatcher) Offer(task Task) (taken bool, err error) {
 
 // handleTask takes care of using a task to create the request
 // and then sending that request to the handler
-func (pooled *pooledDispatcher) handleTask(context *workerContext, task Task) {
-	pooled.logger.Debug("%s.handleTask(%d, %v)", pooled.name, context.id, task)
-	context.dispatch(EventTypeStart, nil)
+func (pooled *pooledDispatcher) handleTask(wc *workerContext, task Task) {
+	pooled.logger.Debug("%s.handleTask(%d, %v)", pooled.name, wc.id, task)
+	wc.dispatch(EventTypeStart, nil)
 
 	var err error
 
 	defer func() {
 		// prevent panics from killing a worker
 		if r := recover(); r != nil {
-			pooled.logger.Error("%s[%d] encountered a panic: %s", pooled.name, context.id, r)
-			context.dispatch(EventTypeFinish, fmt.Errorf("%s", r))
+			pooled.logger.Error("%s[%d] encountered a panic: %s", pooled.name, wc.id, r)
+			wc.dispatch(EventTypeFinish, fmt.Errorf("%s", r))
 		} else {
-			context.dispatch(EventTypeFinish, err)
+			wc.dispatch(EventTypeFinish, err)
 		}
 	}()
 
 	request, consumer, err := task()
 	if err != nil {
-		pooled.logger.Error("%s[%d] received an error from a task: %s", pooled.name, context.id, err)
+		pooled.logger.Error("%s[%d] received an error from a task: %s", pooled.name, wc.id, err)
 		return
 	} else if request == nil {
-		pooled.logger.Error("Worker %d received a nil request", context.id)
+		pooled.logger.Error("Worker %d received a nil request", wc.id)
 		return
 	}
 
-	response, err := pooled.handler.Do(request)
-	if response != nil && response.Body != nil {
-		defer func() {
-			// if the consumer already cleaned things up, CopyBuffer will return EOF
-			// use a canonical cleanup buffer to ease GC pressure
-			if _, err := io.CopyBuffer(ioutil.Discard, response.Body, context.cleanupBuffer); err != nil && err != io.EOF {
-				pooled.logger.Error("%s[%d] encountered an error while consuming the response body: %s", pooled.name, context.id, err)
-			}
+	if pooled.prober != nil {
+		if probeError := pooled.prober.check(pooled.handler, request); probeError != nil {
+			pooled.logger.Warn("%s[%d] keepalive probe of %s failed: %s", pooled.name, wc.id, request.URL.Host, probeError)
+		}
+	}
+
+	if pooled.connectionListener != nil {
+		request = traceRequest(request, pooled.connectionListener)
+	}
 
-			response.Body.Close()
-		}()
+	if pooled.budget != nil {
+		pooled.budget.deposit()
+	}
+
+	var (
+		response *http.Response
+		cancel   func()
+	)
+
+	for attempt := 0; ; attempt++ {
+		response, cancel, err = pooled.transact(request)
+		if attempt >= pooled.retries || !failed(response, err) {
+			break
+		} else if pooled.breakers != nil && pooled.breakers.isOpen(request.URL.Host) {
+			// don't spend the retry budget on a host that is known to be down
+			break
+		}
+
+		next, ok := rewind(request)
+		if !ok || !pooled.budget.withdraw() {
+			break
+		}
+
+		pooled.logger.Warn("%s[%d] retrying %s after failed attempt %d", pooled.name, wc.id, request.URL, attempt+1)
+		pooled.cleanup(wc, response)
+		cancel()
+		pooled.measures.retries.Add(1)
+		request = next
+	}
+
+	defer cancel()
+	if response != nil && response.Body != nil {
+		defer pooled.cleanup(wc, response)
 	}
 
 	if err != nil {
-		pooled.logger.Error("%s[%d] HTTP transaction resulted in error: %s", pooled.name, context.id, err)
+		pooled.logger.Error("%s[%d] HTTP transaction resulted in error: %s", pooled.name, wc.id, err)
 		return
 	}
 
@@ -319,17 +426,71 @@ func (pooled *pooledDispatcher) handleTask(context *workerContext, task Task) {
 	}
 }
 
+// transact performs a single HTTP transaction, honoring the host's circuit breaker and the transaction timeout.
+// The returned cancellation function must be invoked once the response has been consumed.
+func (pooled *pooledDispatcher) transact(request *http.Request) (*http.Response, context.CancelFunc, error) {
+	var (
+		host   = request.URL.Host
+		cancel = context.CancelFunc(func() {})
+	)
+
+	if pooled.breakers != nil {
+		if err := pooled.breakers.allow(host); err != nil {
+			pooled.countRequest(false, err)
+			return nil, cancel, err
+		}
+	}
+
+	if pooled.timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(request.Context(), pooled.timeout)
+		request = request.WithContext(ctx)
+	}
+
+	response, err := pooled.handler.Do(request)
+	transactionFailed := failed(response, err)
+	if pooled.breakers != nil {
+		pooled.breakers.record(host, transactionFailed)
+	}
+
+	pooled.countRequest(transactionFailed, err)
+	return response, cancel, err
+}
+
+// countRequest increments the request counter with the outcome of a transaction
+func (pooled *pooledDispatcher) countRequest(failed bool, err error) {
+	if pooled.measures.requests != nil {
+		pooled.measures.requests.With(OutcomeLabel, outcome(failed, err)).Add(1)
+	}
+}
+
+// cleanup consumes and closes a response body, so that the underlying connection can be reused
+func (pooled *pooledDispatcher) cleanup(wc *workerContext, response *http.Response) {
+	if response == nil || response.Body == nil {
+		return
+	}
+
+	// if the consumer already cleaned things up, CopyBuffer will return EOF
+	// use a canonical cleanup buffer to ease GC pressure
+	if _, err := io.CopyBuffer(ioutil.Discard, response.Body, wc.cleanupBuffer); err != nil && err != io.EOF {
+		pooled.logger.Error("%s[%d] encountered an error while consuming the response body: %s", pooled.name, wc.id, err)
+	}
+
+	response.Body.Close()
+}
+
 // unlimitedClientDispatcher is a DispatchCloser that provides
 // access to a pool of goroutines that is not rate limited.
 type unlimitedClientDispatcher struct {
 	pooledDispatcher
 }
 
-func (unlimited *unlimitedClientDispatcher) worker(context *workerContext) {
-	unlimited.logger.Debug("%s Unlimited Worker %d starting", unlimited.name, context.id)
+func (unlimited *unlimitedClientDispatcher) worker(wc *workerContext) {
+	unlimited.logger.Debug("%s Unlimited Worker %d starting", unlimited.name, wc.id)
 
 	for task := range unlimited.tasks {
-		unlimited.handleTask(context, task)
+		unlimited.updateQueueDepth()
+		unlimited.handleTask(wc, task)
 	}
 }
 
@@ -340,13 +501,14 @@ type limitedClientDispatcher struct {
 	period time.Duration
 }
 
-func (limited *limitedClientDispatcher) worker(context *workerContext) {
-	limited.logger.Debug("%s Rate-limited Worker %d starting", limited.name, context.id)
+func (limited *limitedClientDispatcher) worker(wc *workerContext) {
+	limited.logger.Debug("%s Rate-limited Worker %d starting", limited.name, wc.id)
 	ticker := time.NewTicker(limited.period)
 	defer ticker.Stop()
 
 	for task := range limited.tasks {
+		limited.updateQueueDepth()
 		<-ticker.C
-		limited.handleTask(context, task)
+		limited.handleTask(wc, task)
 	}
 }
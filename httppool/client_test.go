@@ -6,10 +6,15 @@ import (
 	"github.com/Comcast/webpa-common/logging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -600,3 +605,100 @@ func TestOfferUsingListenerWhenTransactionError(t *testing.T) {
 	mockListener.AssertExpectations(t)
 	mockTransactionHandler.AssertExpectations(t)
 }
+
+func TestClientTimeout(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		release = make(chan struct{})
+
+		server = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			select {
+			case <-release:
+			case <-request.Context().Done():
+			}
+		}))
+
+		finished = make(finishListener, 1)
+		client   = Client{
+			Logger:    testLogger,
+			Workers:   1,
+			Timeout:   10 * time.Millisecond,
+			Listeners: []Listener{finished},
+		}
+
+		dispatcher = client.Start()
+	)
+
+	defer server.Close()
+	defer close(release)
+	defer dispatcher.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(err)
+	require.NoError(dispatcher.Send(RequestTask(request, func(*http.Response, *http.Request) {
+		assert.Fail("The consumer should not have been invoked")
+	})))
+
+	select {
+	case err := <-finished:
+		assert.Error(err)
+	case <-time.After(5 * time.Second):
+		assert.Fail("The transaction did not time out")
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		attempts int32
+
+		server = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			body, _ := ioutil.ReadAll(request.Body)
+			if string(body) != "payload" {
+				response.WriteHeader(http.StatusBadRequest)
+			} else if atomic.AddInt32(&attempts, 1) < 3 {
+				response.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+
+		finished = make(finishListener, 1)
+		client   = Client{
+			Logger:      testLogger,
+			Workers:     1,
+			Retries:     5,
+			RetryBudget: &RetryBudget{Burst: 2},
+			Listeners:   []Listener{finished},
+		}
+
+		dispatcher = client.Start()
+		status     int
+	)
+
+	defer server.Close()
+	defer dispatcher.Close()
+
+	// the request body is resent with each retry
+	request, err := http.NewRequest("POST", server.URL, strings.NewReader("payload"))
+	require.NoError(err)
+	require.NoError(dispatcher.Send(RequestTask(request, func(response *http.Response, _ *http.Request) {
+		status = response.StatusCode
+	})))
+
+	assert.NoError(<-finished)
+	assert.Equal(http.StatusOK, status)
+	assert.Equal(int32(3), atomic.LoadInt32(&attempts))
+
+	// the budget has been spent, so the next failure is not retried
+	atomic.StoreInt32(&attempts, 0)
+	request, err = http.NewRequest("POST", server.URL, strings.NewReader("payload"))
+	require.NoError(err)
+	require.NoError(dispatcher.Send(RequestTask(request, func(response *http.Response, _ *http.Request) {
+		status = response.StatusCode
+	})))
+
+	assert.NoError(<-finished)
+	assert.Equal(http.StatusServiceUnavailable, status)
+	assert.Equal(int32(1), atomic.LoadInt32(&attempts))
+}
@@ -1,5 +1,9 @@
 /*
 Package httppool provides a simple, configurable worker pool for dispatching HTTP transactions
-to servers.
+to servers, along with a Fanout which forwards requests for a device to the node that owns it.
+
+Pools are bounded:  a fixed number of workers drain a fixed-size queue, so that a downstream outage
+backs up the queue rather than spawning goroutines.  Each pool can optionally impose a timeout on
+transactions, trip per-host circuit breakers, and retry failures within a budget.
 */
 package httppool
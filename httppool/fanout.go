@@ -0,0 +1,225 @@
+package httppool
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Comcast/webpa-common/device"
+	"github.com/Comcast/webpa-common/httperror"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/service"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultFanoutAttempts is the number of nodes a Fanout tries when none is configured
+	DefaultFanoutAttempts = 2
+)
+
+var (
+	ErrorNoFanoutLocator = errors.New("No NodeLocator configured")
+)
+
+// hopHeaders are the hop-by-hop headers, which apply only to a single connection and so are not forwarded
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders deletes the hop-by-hop headers from a header, including any listed in its Connection header
+func removeHopHeaders(header http.Header) {
+	for _, value := range header["Connection"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				header.Del(name)
+			}
+		}
+	}
+
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// NodeLocator produces the nodes responsible for a key, in order of preference.  *hash.Ring and
+// *hash.Router implement this interface.
+type NodeLocator interface {
+	GetN(key []byte, n int) ([]string, error)
+}
+
+// Fanout forwards requests for a device to the node which owns that device, e.g. the talaria holding the
+// device's connection.  The owner is found via a NodeLocator, usually a hash.Router kept up to date by
+// service discovery.  If the owner cannot be reached, or responds with http.StatusServiceUnavailable as it
+// does while draining, the request is retried against the next candidate node.  The first other response
+// is returned.
+//
+// The request body, such as a WRP message, is buffered so that it can be sent to each candidate.
+type Fanout struct {
+	// Locator resolves the candidate nodes for a device.  This field is required.
+	Locator NodeLocator
+
+	// Handler is any type that has a method with the signature Do(*http.Request) (*http.Response, error)
+	// If not supplied, the http.DefaultClient is used.
+	Handler transactionHandler
+
+	// Attempts is the maximum number of nodes tried for each request.  If this value is less than one (1),
+	// DefaultFanoutAttempts is used.
+	Attempts int
+
+	// IDExtractor determines the device of each request served via ServeHTTP.  If not supplied,
+	// the device name header is used.
+	IDExtractor device.IDExtractor
+
+	// Logger is the logging strategy used by this Fanout.  If not supplied, logging.DefaultLogger() is used.
+	Logger logging.Logger
+}
+
+func (f *Fanout) handler() transactionHandler {
+	if f.Handler != nil {
+		return f.Handler
+	}
+
+	return http.DefaultClient
+}
+
+func (f *Fanout) attempts() int {
+	if f.Attempts > 0 {
+		return f.Attempts
+	}
+
+	return DefaultFanoutAttempts
+}
+
+func (f *Fanout) idExtractor() device.IDExtractor {
+	if f.IDExtractor != nil {
+		return f.IDExtractor
+	}
+
+	return device.HeaderIDExtractor(device.DeviceNameHeader)
+}
+
+func (f *Fanout) logger() logging.Logger {
+	if f.Logger != nil {
+		return f.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+// newRequest creates the request forwarded to a single node
+func newRequest(node string, original *http.Request, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	request, err := http.NewRequest(original.Method, service.ReplaceHostPort(node, original.URL), reader)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range original.Header {
+		request.Header[name] = append([]string(nil), values...)
+	}
+
+	removeHopHeaders(request.Header)
+
+	return request.WithContext(original.Context()), nil
+}
+
+// Do forwards a request for the given device to the nodes responsible for it, returning the first
+// response which is not http.StatusServiceUnavailable.  If every attempt fails, the last response or
+// error is returned.  As with an http.Client, the caller must close the body of the returned response.
+//
+// The request's URL supplies the path, query, and fragment sent to each node, so a request received
+// by a server may be passed as is.  The original request's body is consumed and closed.
+func (f *Fanout) Do(id device.ID, request *http.Request) (*http.Response, error) {
+	if f.Locator == nil {
+		return nil, ErrorNoFanoutLocator
+	}
+
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	nodes, err := f.Locator.GetN(id.Bytes(), f.attempts())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		logger   = f.logger()
+		handler  = f.handler()
+		response *http.Response
+	)
+
+	for index, node := range nodes {
+		if response != nil {
+			// discard the previous unavailable response in favor of this attempt
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+			response = nil
+		}
+
+		var forward *http.Request
+		if forward, err = newRequest(node, request, body); err != nil {
+			return nil, err
+		}
+
+		response, err = handler.Do(forward)
+		switch {
+		case err != nil:
+			logger.Error("Unable to forward request for device [%s] to [%s] (attempt %d of %d): %s", id, node, index+1, len(nodes), err)
+			if request.Context().Err() != nil {
+				return nil, err
+			}
+
+		case response.StatusCode == http.StatusServiceUnavailable:
+			logger.Error("Node [%s] is unavailable for device [%s] (attempt %d of %d)", node, id, index+1, len(nodes))
+
+		default:
+			return response, nil
+		}
+	}
+
+	return response, err
+}
+
+// ServeHTTP acts as a reverse proxy, forwarding each request to the node which owns the request's device
+func (f *Fanout) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	id, err := f.idExtractor().ExtractID(request)
+	if err != nil {
+		httperror.Format(response, http.StatusBadRequest, err)
+		return
+	}
+
+	nodeResponse, err := f.Do(id, request)
+	if err != nil {
+		httperror.Formatf(response, http.StatusBadGateway, "Unable to forward request for device [%s]: %s", id, err)
+		return
+	}
+
+	defer nodeResponse.Body.Close()
+	for name, values := range nodeResponse.Header {
+		response.Header()[name] = values
+	}
+
+	removeHopHeaders(response.Header())
+
+	response.WriteHeader(nodeResponse.StatusCode)
+	io.Copy(response, nodeResponse.Body)
+}
@@ -0,0 +1,218 @@
+package httppool
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Comcast/webpa-common/device"
+	"github.com/Comcast/webpa-common/hash"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fixedLocator is a NodeLocator which always returns the same nodes
+type fixedLocator []string
+
+func (l fixedLocator) GetN(key []byte, n int) ([]string, error) {
+	if len(l) == 0 {
+		return nil, hash.ErrorNoNodes
+	}
+
+	if n > len(l) {
+		n = len(l)
+	}
+
+	return l[:n], nil
+}
+
+// testNode is a server which records the WRP messages it receives
+type testNode struct {
+	*httptest.Server
+	status   int
+	messages []*wrp.Message
+	headers  []http.Header
+}
+
+func newTestNode(t *testing.T, status int) *testNode {
+	node := &testNode{status: status}
+	node.Server = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		message := new(wrp.Message)
+		if assert.NoError(t, wrp.NewDecoder(request.Body, wrp.Msgpack).Decode(message)) {
+			node.messages = append(node.messages, message)
+		}
+
+		node.headers = append(node.headers, request.Header)
+		response.Header().Set("X-Node", node.URL)
+		response.WriteHeader(node.status)
+		response.Write([]byte(request.URL.Path + "?" + request.URL.RawQuery))
+	}))
+
+	return node
+}
+
+func testFanoutBody(t *testing.T) []byte {
+	var buffer bytes.Buffer
+	require.NoError(t, wrp.NewEncoder(&buffer, wrp.Msgpack).Encode(&wrp.Message{
+		Type:        wrp.SimpleRequestResponseMessageType,
+		Source:      "dns:scytale.comcast.net",
+		Destination: "mac:112233445566/config",
+		Payload:     []byte("payload"),
+	}))
+
+	return buffer.Bytes()
+}
+
+func TestFanoutNoLocator(t *testing.T) {
+	assert := assert.New(t)
+
+	response, err := new(Fanout).Do(device.ID("mac:112233445566"), httptest.NewRequest("POST", "/api/v2/device", nil))
+	assert.Nil(response)
+	assert.Equal(ErrorNoFanoutLocator, err)
+}
+
+func TestFanoutNoNodes(t *testing.T) {
+	assert := assert.New(t)
+
+	response, err := (&Fanout{Locator: fixedLocator{}}).Do(device.ID("mac:112233445566"), httptest.NewRequest("POST", "/api/v2/device", nil))
+	assert.Nil(response)
+	assert.Equal(hash.ErrorNoNodes, err)
+}
+
+func TestFanoutDo(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		body    = testFanoutBody(t)
+
+		unavailable = newTestNode(t, http.StatusServiceUnavailable)
+		owner       = newTestNode(t, http.StatusOK)
+		other       = newTestNode(t, http.StatusOK)
+
+		// a node which refuses connections
+		down = httptest.NewServer(http.NotFoundHandler())
+	)
+
+	defer unavailable.Close()
+	defer owner.Close()
+	defer other.Close()
+	down.Close()
+
+	fanout := &Fanout{
+		Locator:  fixedLocator{down.URL, unavailable.URL, owner.URL, other.URL},
+		Attempts: 3,
+		Logger:   testLogger,
+	}
+
+	request := httptest.NewRequest("POST", "/api/v2/device?foo=bar", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/msgpack")
+	request.Header.Set("Connection", "close, X-Hop")
+	request.Header.Set("X-Hop", "value")
+
+	response, err := fanout.Do(device.ID("mac:112233445566"), request)
+	require.NoError(err)
+	require.NotNil(response)
+	defer response.Body.Close()
+
+	assert.Equal(http.StatusOK, response.StatusCode)
+	assert.Equal(owner.URL, response.Header.Get("X-Node"))
+	responseBody, err := ioutil.ReadAll(response.Body)
+	assert.NoError(err)
+	assert.Equal("/api/v2/device?foo=bar", string(responseBody))
+
+	// the WRP body was sent intact to each node tried
+	for _, node := range []*testNode{unavailable, owner} {
+		require.Len(node.messages, 1)
+		assert.Equal("mac:112233445566/config", node.messages[0].Destination)
+		assert.Equal([]byte("payload"), node.messages[0].Payload)
+		assert.Equal("application/msgpack", node.headers[0].Get("Content-Type"))
+		assert.Empty(node.headers[0].Get("Connection"))
+		assert.Empty(node.headers[0].Get("X-Hop"))
+	}
+
+	assert.Empty(other.messages)
+}
+
+func TestFanoutDoAllUnavailable(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		first   = newTestNode(t, http.StatusServiceUnavailable)
+		second  = newTestNode(t, http.StatusServiceUnavailable)
+		fanout  = &Fanout{Locator: fixedLocator{first.URL, second.URL}, Logger: testLogger}
+	)
+
+	defer first.Close()
+	defer second.Close()
+
+	response, err := fanout.Do(device.ID("mac:112233445566"), httptest.NewRequest("POST", "/", bytes.NewReader(testFanoutBody(t))))
+	require.NoError(err)
+	require.NotNil(response)
+	response.Body.Close()
+
+	// the last response is returned
+	assert.Equal(http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(second.URL, response.Header.Get("X-Node"))
+}
+
+func TestFanoutDoError(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		expectedError = errors.New("expected")
+		handler       = new(mockTransactionHandler)
+		fanout        = &Fanout{Locator: fixedLocator{"http://node1.comcast.net:8080", "http://node2.comcast.net:8080"}, Handler: handler, Logger: testLogger}
+	)
+
+	handler.On("Do", requestToHost("node1.comcast.net:8080")).Return(nil, expectedError).Once()
+	handler.On("Do", requestToHost("node2.comcast.net:8080")).Return(nil, expectedError).Once()
+
+	response, err := fanout.Do(device.ID("mac:112233445566"), httptest.NewRequest("GET", "/", nil))
+	assert.Nil(response)
+	assert.Equal(expectedError, err)
+	handler.AssertExpectations(t)
+}
+
+func TestFanoutServeHTTP(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		owner  = newTestNode(t, http.StatusAccepted)
+		fanout = &Fanout{Locator: fixedLocator{owner.URL}, Logger: testLogger}
+	)
+
+	defer owner.Close()
+
+	// no device ID
+	response := httptest.NewRecorder()
+	fanout.ServeHTTP(response, httptest.NewRequest("POST", "/api/v2/device", bytes.NewReader(testFanoutBody(t))))
+	assert.Equal(http.StatusBadRequest, response.Code)
+	assert.Empty(owner.messages)
+
+	request := httptest.NewRequest("POST", "/api/v2/device", bytes.NewReader(testFanoutBody(t)))
+	request.Header.Set(device.DeviceNameHeader, "mac:112233445566")
+	response = httptest.NewRecorder()
+	fanout.ServeHTTP(response, request)
+	assert.Equal(http.StatusAccepted, response.Code)
+	assert.Equal(owner.URL, response.Header().Get("X-Node"))
+	assert.Equal("/api/v2/device?", response.Body.String())
+	assert.Len(owner.messages, 1)
+
+	// no node can be reached
+	fanout.Locator = fixedLocator{}
+	request = httptest.NewRequest("POST", "/api/v2/device", bytes.NewReader(testFanoutBody(t)))
+	request.Header.Set(device.DeviceNameHeader, "mac:112233445566")
+	response = httptest.NewRecorder()
+	fanout.ServeHTTP(response, request)
+	assert.Equal(http.StatusBadGateway, response.Code)
+	assert.True(strings.Contains(response.Body.String(), "mac:112233445566"))
+}
+
+func requestToHost(host string) interface{} {
+	return mock.MatchedBy(func(request *http.Request) bool {
+		return request.URL.Host == host
+	})
+}
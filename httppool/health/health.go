@@ -3,6 +3,7 @@ package health
 import (
 	"github.com/Comcast/webpa-common/health"
 	"github.com/Comcast/webpa-common/httppool"
+	"time"
 )
 
 const (
@@ -10,6 +11,15 @@ const (
 	TotalNotificationsRejected  health.Stat = "TotalNotificationsRejected"
 	TotalNotificationsSucceeded health.Stat = "TotalNotificationsSucceeded"
 	TotalNotificationsFailed    health.Stat = "TotalNotificationsFailed"
+
+	TotalConnectionsReused        health.Stat = "TotalConnectionsReused"
+	TotalConnectionsDialed        health.Stat = "TotalConnectionsDialed"
+	TotalDNSLookups               health.Stat = "TotalDNSLookups"
+	TotalDNSLookupErrors          health.Stat = "TotalDNSLookupErrors"
+	TotalDNSLookupMilliseconds    health.Stat = "TotalDNSLookupMilliseconds"
+	TotalTLSHandshakes            health.Stat = "TotalTLSHandshakes"
+	TotalTLSHandshakeErrors       health.Stat = "TotalTLSHandshakeErrors"
+	TotalTLSHandshakeMilliseconds health.Stat = "TotalTLSHandshakeMilliseconds"
 )
 
 // listener is an internal httppool.Listener that delegates to the given
@@ -37,3 +47,41 @@ func (l *listener) On(event httppool.Event) {
 func Listener(monitor health.Monitor) httppool.Listener {
 	return &listener{monitor}
 }
+
+// connectionListener is an internal httppool.ConnectionListener that delegates to
+// the given health monitor.  Latencies are accumulated as total milliseconds, which
+// can be divided by the corresponding counts to obtain averages.
+type connectionListener struct {
+	monitor health.Monitor
+}
+
+func (l *connectionListener) ConnectionObtained(reused bool) {
+	if reused {
+		l.monitor.SendEvent(health.Inc(TotalConnectionsReused, 1))
+	} else {
+		l.monitor.SendEvent(health.Inc(TotalConnectionsDialed, 1))
+	}
+}
+
+func (l *connectionListener) DNSLookup(latency time.Duration, err error) {
+	l.latency(TotalDNSLookups, TotalDNSLookupErrors, TotalDNSLookupMilliseconds, latency, err)
+}
+
+func (l *connectionListener) TLSHandshake(latency time.Duration, err error) {
+	l.latency(TotalTLSHandshakes, TotalTLSHandshakeErrors, TotalTLSHandshakeMilliseconds, latency, err)
+}
+
+func (l *connectionListener) latency(count, errors, milliseconds health.Stat, latency time.Duration, err error) {
+	l.monitor.SendEvent(func(stats health.Stats) {
+		stats[count] += 1
+		stats[milliseconds] += int(latency / time.Millisecond)
+		if err != nil {
+			stats[errors] += 1
+		}
+	})
+}
+
+// ConnectionListener constructs an httppool.ConnectionListener that dispatches to a health Monitor
+func ConnectionListener(monitor health.Monitor) httppool.ConnectionListener {
+	return &connectionListener{monitor}
+}
@@ -4,9 +4,11 @@ import (
 	"errors"
 	"github.com/Comcast/webpa-common/health"
 	"github.com/Comcast/webpa-common/httppool"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"net/http"
 	"testing"
+	"time"
 )
 
 type mockMonitor struct {
@@ -105,3 +107,51 @@ func TestListenerEventTypeNotMonitored(t *testing.T) {
 	mockEvent.AssertExpectations(t)
 	mockMonitor.AssertExpectations(t)
 }
+
+func TestConnectionListener(t *testing.T) {
+	var testData = []struct {
+		apply    func(httppool.ConnectionListener)
+		expected health.Stats
+	}{
+		{
+			apply:    func(l httppool.ConnectionListener) { l.ConnectionObtained(true) },
+			expected: health.Stats{TotalConnectionsReused: 1},
+		},
+		{
+			apply:    func(l httppool.ConnectionListener) { l.ConnectionObtained(false) },
+			expected: health.Stats{TotalConnectionsDialed: 1},
+		},
+		{
+			apply:    func(l httppool.ConnectionListener) { l.DNSLookup(15*time.Millisecond, nil) },
+			expected: health.Stats{TotalDNSLookups: 1, TotalDNSLookupMilliseconds: 15},
+		},
+		{
+			apply:    func(l httppool.ConnectionListener) { l.DNSLookup(3*time.Millisecond, errors.New("expected")) },
+			expected: health.Stats{TotalDNSLookups: 1, TotalDNSLookupMilliseconds: 3, TotalDNSLookupErrors: 1},
+		},
+		{
+			apply:    func(l httppool.ConnectionListener) { l.TLSHandshake(120*time.Millisecond, nil) },
+			expected: health.Stats{TotalTLSHandshakes: 1, TotalTLSHandshakeMilliseconds: 120},
+		},
+		{
+			apply:    func(l httppool.ConnectionListener) { l.TLSHandshake(time.Second, errors.New("expected")) },
+			expected: health.Stats{TotalTLSHandshakes: 1, TotalTLSHandshakeMilliseconds: 1000, TotalTLSHandshakeErrors: 1},
+		},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record.expected)
+
+		actual := make(health.Stats)
+		mockMonitor := &mockMonitor{}
+		mockMonitor.On("SendEvent", mock.AnythingOfType("health.HealthFunc")).
+			Run(func(arguments mock.Arguments) {
+				arguments.Get(0).(health.HealthFunc)(actual)
+			}).
+			Once()
+
+		record.apply(ConnectionListener(mockMonitor))
+		assert.Equal(t, record.expected, actual)
+		mockMonitor.AssertExpectations(t)
+	}
+}
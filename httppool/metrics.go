@@ -0,0 +1,105 @@
+package httppool
+
+import (
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// QueueDepthGauge is the number of tasks waiting in a pool's queue
+	QueueDepthGauge = "httppool_queue_depth"
+
+	// RequestCounter is the total number of HTTP transactions attempted by a pool, including retries
+	RequestCounter = "httppool_request_count"
+
+	// RetryCounter is the total number of retries made by a pool
+	RetryCounter = "httppool_retry_count"
+
+	// BreakerTripCounter is the total number of times a host's circuit breaker has tripped
+	BreakerTripCounter = "httppool_breaker_trip_count"
+
+	// OpenBreakerGauge is the number of hosts whose circuit breakers are currently open
+	OpenBreakerGauge = "httppool_open_breakers"
+
+	// PoolLabel is the label whose value is the name of the pool
+	PoolLabel = "pool"
+
+	// OutcomeLabel is the label whose value is one of the Outcome constants
+	OutcomeLabel = "outcome"
+
+	// OutcomeSuccess indicates a transaction which produced a non-5xx response
+	OutcomeSuccess = "success"
+
+	// OutcomeFailure indicates a transaction which produced a transport error or a 5xx response
+	OutcomeFailure = "failure"
+
+	// OutcomeBreakerOpen indicates a transaction which was not attempted because the host's breaker was open
+	OutcomeBreakerOpen = "breaker_open"
+)
+
+// Metrics is the xmetrics.Module for this package
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name:       QueueDepthGauge,
+			Type:       xmetrics.GaugeType,
+			Help:       "The number of tasks waiting in a pool's queue",
+			LabelNames: []string{PoolLabel},
+		},
+		{
+			Name:       RequestCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of HTTP transactions attempted by a pool, including retries",
+			LabelNames: []string{PoolLabel, OutcomeLabel},
+		},
+		{
+			Name:       RetryCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of retries made by a pool",
+			LabelNames: []string{PoolLabel},
+		},
+		{
+			Name:       BreakerTripCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of times a host's circuit breaker has tripped",
+			LabelNames: []string{PoolLabel},
+		},
+		{
+			Name:       OpenBreakerGauge,
+			Type:       xmetrics.GaugeType,
+			Help:       "The number of hosts whose circuit breakers are currently open",
+			LabelNames: []string{PoolLabel},
+		},
+	}
+}
+
+// measures is the set of metrics updated by a pooled dispatcher
+type measures struct {
+	queueDepth  metrics.Gauge
+	requests    metrics.Counter
+	retries     metrics.Counter
+	trips       metrics.Counter
+	openCircuit metrics.Gauge
+}
+
+func newMeasures(pool string, p xmetrics.Provider) measures {
+	return measures{
+		queueDepth:  p.NewGauge(QueueDepthGauge).With(PoolLabel, pool),
+		requests:    p.NewCounter(RequestCounter).With(PoolLabel, pool),
+		retries:     p.NewCounter(RetryCounter).With(PoolLabel, pool),
+		trips:       p.NewCounter(BreakerTripCounter).With(PoolLabel, pool),
+		openCircuit: p.NewGauge(OpenBreakerGauge).With(PoolLabel, pool),
+	}
+}
+
+// outcome returns the OutcomeLabel value for an HTTP transaction
+func outcome(failed bool, err error) string {
+	switch {
+	case err == ErrorBreakerOpen:
+		return OutcomeBreakerOpen
+	case failed:
+		return OutcomeFailure
+	default:
+		return OutcomeSuccess
+	}
+}
@@ -0,0 +1,85 @@
+package httppool
+
+import (
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	assert.NotNil(t, registry)
+	assert.NoError(t, err)
+}
+
+func TestClientMetrics(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		attempts int32
+
+		server = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			response.WriteHeader(http.StatusServiceUnavailable)
+		}))
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+	)
+
+	require.NoError(err)
+	defer server.Close()
+
+	var (
+		client = Client{
+			Name:            "test",
+			Logger:          testLogger,
+			Workers:         1,
+			Retries:         1,
+			Breaker:         &BreakerOptions{Threshold: 3, Cooldown: time.Hour},
+			MetricsProvider: registry,
+		}
+
+		finished = make(finishListener, 3)
+		statuses []int
+	)
+
+	client.Listeners = []Listener{finished}
+	dispatcher := client.Start()
+	consumer := func(response *http.Response, _ *http.Request) {
+		statuses = append(statuses, response.StatusCode)
+	}
+
+	// the first task is retried, which trips the breaker on the third attempt
+	for i := 0; i < 3; i++ {
+		request, err := http.NewRequest("GET", server.URL, nil)
+		require.NoError(err)
+
+		require.NoError(dispatcher.Send(RequestTask(request, consumer)))
+	}
+
+	assert.NoError(<-finished)
+	assert.NoError(<-finished)
+
+	// the last task is rejected by the breaker, so its consumer is never invoked
+	assert.Equal(ErrorBreakerOpen, <-finished)
+	require.NoError(dispatcher.Close())
+
+	assert.Equal(int32(3), atomic.LoadInt32(&attempts))
+	assert.Equal([]int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}, statuses)
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	output := response.Body.String()
+
+	assert.Contains(output, RequestCounter+`{outcome="failure",pool="test"} 3`)
+	assert.Contains(output, RequestCounter+`{outcome="breaker_open",pool="test"} 1`)
+	assert.Contains(output, RetryCounter+`{pool="test"} 1`)
+	assert.Contains(output, BreakerTripCounter+`{pool="test"} 1`)
+	assert.Contains(output, OpenBreakerGauge+`{pool="test"} 1`)
+	assert.Contains(output, QueueDepthGauge+`{pool="test"} 0`)
+}
@@ -127,3 +127,12 @@ func matchEvent(eventType EventType, eventError error) interface{} {
 		},
 	)
 }
+
+// finishListener is a Listener which receives the error of each finished task
+type finishListener chan error
+
+func (f finishListener) On(event Event) {
+	if event.Type() == EventTypeFinish {
+		f <- event.Err()
+	}
+}
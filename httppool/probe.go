@@ -0,0 +1,128 @@
+package httppool
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultProbeMethod        = "HEAD"
+	DefaultProbePath          = "/"
+	DefaultProbeIdleThreshold = 30 * time.Second
+)
+
+// idleCloser is implemented by transaction handlers, such as *http.Transport, which
+// can discard their idle pooled connections
+type idleCloser interface {
+	CloseIdleConnections()
+}
+
+// KeepaliveProbe configures the validation of pooled connections prior to use.  Servers,
+// particularly flaky webhook receivers, often silently drop idle keepalive connections.  The
+// first request sent over such a connection fails before receiving any bytes.
+//
+// When a host has not been contacted for longer than the IdleThreshold, a lightweight probe request
+// is sent to that host first.  If the probe fails, the handler's idle connections are closed (provided
+// the handler supports CloseIdleConnections) so that the real request is sent over a fresh connection.
+type KeepaliveProbe struct {
+	// Method is the HTTP method of probe requests.  If not supplied, DefaultProbeMethod is used.
+	Method string
+
+	// Path is the URL path of probe requests.  If not supplied, DefaultProbePath is used.
+	Path string
+
+	// IdleThreshold is the length of time a host must go uncontacted before a probe is sent.
+	// If not supplied, DefaultProbeIdleThreshold is used.
+	IdleThreshold time.Duration
+}
+
+func (p *KeepaliveProbe) method() string {
+	if p != nil && len(p.Method) > 0 {
+		return p.Method
+	}
+
+	return DefaultProbeMethod
+}
+
+func (p *KeepaliveProbe) path() string {
+	if p != nil && len(p.Path) > 0 {
+		return p.Path
+	}
+
+	return DefaultProbePath
+}
+
+func (p *KeepaliveProbe) idleThreshold() time.Duration {
+	if p != nil && p.IdleThreshold > 0 {
+		return p.IdleThreshold
+	}
+
+	return DefaultProbeIdleThreshold
+}
+
+// prober is the runtime state of a KeepaliveProbe, shared by all workers in a pool
+type prober struct {
+	method        string
+	path          string
+	idleThreshold time.Duration
+	now           func() time.Time
+
+	lock     sync.Mutex
+	lastUsed map[string]time.Time
+}
+
+func newProber(p *KeepaliveProbe) *prober {
+	return &prober{
+		method:        p.method(),
+		path:          p.path(),
+		idleThreshold: p.idleThreshold(),
+		now:           time.Now,
+		lastUsed:      make(map[string]time.Time),
+	}
+}
+
+// touch records the use of a host, returning true if the host had been idle
+// past the threshold (or never used)
+func (p *prober) touch(host string) bool {
+	now := p.now()
+	p.lock.Lock()
+	lastUsed, ok := p.lastUsed[host]
+	p.lastUsed[host] = now
+	p.lock.Unlock()
+
+	return !ok || now.Sub(lastUsed) > p.idleThreshold
+}
+
+// check probes the host of the given request if it has been idle.  The returned error is the
+// error from the probe, if any, which callers will typically just log.
+func (p *prober) check(handler transactionHandler, request *http.Request) error {
+	if !p.touch(request.URL.Host) {
+		return nil
+	}
+
+	probeURL := *request.URL
+	probeURL.Path = p.path
+	probeURL.RawPath = ""
+	probeURL.RawQuery = ""
+	probeURL.Fragment = ""
+
+	probe, err := http.NewRequest(p.method, probeURL.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	probe = probe.WithContext(request.Context())
+	response, err := handler.Do(probe)
+	if response != nil && response.Body != nil {
+		response.Body.Close()
+	}
+
+	if err != nil {
+		if closer, ok := handler.(idleCloser); ok {
+			closer.CloseIdleConnections()
+		}
+	}
+
+	return err
+}
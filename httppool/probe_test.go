@@ -0,0 +1,125 @@
+package httppool
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type mockIdleCloserHandler struct {
+	mockTransactionHandler
+}
+
+func (handler *mockIdleCloserHandler) CloseIdleConnections() {
+	handler.Called()
+}
+
+func matchProbe(method, url string) interface{} {
+	return mock.MatchedBy(func(request *http.Request) bool {
+		return request.Method == method && request.URL.String() == url
+	})
+}
+
+func TestKeepaliveProbeDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, p := range []*KeepaliveProbe{nil, new(KeepaliveProbe)} {
+		t.Log(p)
+		assert.Equal(DefaultProbeMethod, p.method())
+		assert.Equal(DefaultProbePath, p.path())
+		assert.Equal(DefaultProbeIdleThreshold, p.idleThreshold())
+	}
+}
+
+func TestKeepaliveProbe(t *testing.T) {
+	assert := assert.New(t)
+	p := &KeepaliveProbe{
+		Method:        "OPTIONS",
+		Path:          "/health",
+		IdleThreshold: time.Minute,
+	}
+
+	assert.Equal(p.Method, p.method())
+	assert.Equal(p.Path, p.path())
+	assert.Equal(p.IdleThreshold, p.idleThreshold())
+}
+
+func TestProberCheck(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		handler = &mockIdleCloserHandler{}
+		current = time.Now()
+		request = MustNewRequest("POST", "http://example.com/hook?foo=bar")
+		other   = MustNewRequest("POST", "https://other.com/hook")
+
+		prober = newProber(&KeepaliveProbe{IdleThreshold: time.Minute})
+	)
+
+	prober.now = func() time.Time { return current }
+
+	// first contact with a host always probes
+	handler.On("Do", matchProbe("HEAD", "http://example.com/")).Return(&http.Response{}, nil).Once()
+	assert.NoError(prober.check(handler, request))
+	handler.AssertExpectations(t)
+
+	// within the threshold, no probe
+	current = current.Add(time.Minute)
+	assert.NoError(prober.check(handler, request))
+	handler.AssertExpectations(t)
+
+	// other hosts are tracked separately, and failed probes discard idle connections
+	expectedError := errors.New("expected")
+	handler.On("Do", matchProbe("HEAD", "https://other.com/")).Return(nil, expectedError).Once()
+	handler.On("CloseIdleConnections").Once()
+	assert.Equal(expectedError, prober.check(handler, other))
+	handler.AssertExpectations(t)
+
+	// past the threshold
+	current = current.Add(time.Minute + time.Second)
+	handler.On("Do", matchProbe("HEAD", "http://example.com/")).Return(nil, expectedError).Once()
+	handler.On("CloseIdleConnections").Once()
+	assert.Equal(expectedError, prober.check(handler, request))
+	handler.AssertExpectations(t)
+}
+
+func TestProberCheckNoIdleCloser(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		handler       = &mockTransactionHandler{}
+		expectedError = errors.New("expected")
+		prober        = newProber(&KeepaliveProbe{Method: "OPTIONS", Path: "/health"})
+	)
+
+	handler.On("Do", matchProbe("OPTIONS", "http://example.com/health")).Return(nil, expectedError).Once()
+	assert.Equal(expectedError, prober.check(handler, MustNewRequest("GET", "http://example.com/foo")))
+	handler.AssertExpectations(t)
+}
+
+func TestClientKeepaliveProbe(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		handler = &mockTransactionHandler{}
+		request = MustNewRequest("GET", "http://example.com/foo")
+
+		dispatcher = (&Client{
+			Handler:        handler,
+			Logger:         testLogger,
+			Workers:        1,
+			KeepaliveProbe: &KeepaliveProbe{},
+		}).Start()
+
+		done = make(chan struct{})
+	)
+
+	handler.On("Do", matchProbe("HEAD", "http://example.com/")).Return(nil, errors.New("expected")).Once()
+	handler.On("Do", request).Return(nil, errors.New("expected")).Run(func(mock.Arguments) { close(done) }).Once()
+
+	assert.NoError(dispatcher.Send(RequestTask(request, nil)))
+	<-done
+	assert.NoError(dispatcher.Close())
+
+	handler.AssertExpectations(t)
+}
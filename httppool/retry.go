@@ -0,0 +1,106 @@
+package httppool
+
+import (
+	"net/http"
+	"sync"
+)
+
+const (
+	DefaultRetryRatio = 0.1
+	DefaultRetryBurst = 10
+)
+
+// RetryBudget limits the retries a Client makes relative to its overall traffic.  During a downstream
+// outage, every request fails and would otherwise be retried, multiplying the load on a struggling server.
+// A budget allows retries to add at most a fixed ratio of extra requests, plus a small burst.
+type RetryBudget struct {
+	// Ratio is the number of retries earned by each request.  For example, a ratio of 0.1 allows
+	// one retry per ten requests.  If nonpositive, DefaultRetryRatio is used.
+	Ratio float64
+
+	// Burst is the maximum number of retries that can be banked, and is also the number of retries
+	// available when a Client starts.  If nonpositive, DefaultRetryBurst is used.
+	Burst int
+}
+
+func (rb *RetryBudget) ratio() float64 {
+	if rb != nil && rb.Ratio > 0 {
+		return rb.Ratio
+	}
+
+	return DefaultRetryRatio
+}
+
+func (rb *RetryBudget) burst() int {
+	if rb != nil && rb.Burst > 0 {
+		return rb.Burst
+	}
+
+	return DefaultRetryBurst
+}
+
+// retryBudget is a token bucket which each request deposits into and each retry withdraws from
+type retryBudget struct {
+	lock   sync.Mutex
+	ratio  float64
+	max    float64
+	tokens float64
+}
+
+func newRetryBudget(rb *RetryBudget) *retryBudget {
+	burst := float64(rb.burst())
+	return &retryBudget{
+		ratio:  rb.ratio(),
+		max:    burst,
+		tokens: burst,
+	}
+}
+
+// deposit credits the budget for a request
+func (b *retryBudget) deposit() {
+	b.lock.Lock()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+
+	b.lock.Unlock()
+}
+
+// withdraw attempts to spend one retry, returning false if the budget is exhausted
+func (b *retryBudget) withdraw() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// failed tests whether the outcome of an HTTP transaction is a failure for the purposes of retries
+// and circuit breakers.  Only transport errors and server errors count as failures.
+func failed(response *http.Response, err error) bool {
+	return err != nil || (response != nil && response.StatusCode >= http.StatusInternalServerError)
+}
+
+// rewind produces a request which can be sent again.  Requests with a body can only be rewound
+// if they supply GetBody, as http.NewRequest does for in-memory bodies.
+func rewind(request *http.Request) (*http.Request, bool) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return request, true
+	} else if request.GetBody == nil {
+		return nil, false
+	}
+
+	body, err := request.GetBody()
+	if err != nil {
+		return nil, false
+	}
+
+	next := request.WithContext(request.Context())
+	next.Body = body
+	return next, true
+}
@@ -0,0 +1,82 @@
+package httppool
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestRetryBudgetDefaults(t *testing.T) {
+	assert := assert.New(t)
+	for _, rb := range []*RetryBudget{nil, new(RetryBudget), &RetryBudget{Ratio: -1.0, Burst: -1}} {
+		assert.Equal(DefaultRetryRatio, rb.ratio())
+		assert.Equal(DefaultRetryBurst, rb.burst())
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		budget = newRetryBudget(&RetryBudget{Ratio: 0.5, Burst: 2})
+	)
+
+	// the budget starts full
+	assert.True(budget.withdraw())
+	assert.True(budget.withdraw())
+	assert.False(budget.withdraw())
+
+	budget.deposit()
+	assert.False(budget.withdraw())
+	budget.deposit()
+	assert.True(budget.withdraw())
+	assert.False(budget.withdraw())
+
+	// deposits never exceed the burst
+	for i := 0; i < 100; i++ {
+		budget.deposit()
+	}
+
+	assert.True(budget.withdraw())
+	assert.True(budget.withdraw())
+	assert.False(budget.withdraw())
+}
+
+func TestFailed(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(failed(nil, errors.New("expected")))
+	assert.True(failed(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil))
+	assert.False(failed(&http.Response{StatusCode: http.StatusNotFound}, nil))
+	assert.False(failed(&http.Response{StatusCode: http.StatusOK}, nil))
+	assert.False(failed(nil, nil))
+}
+
+func TestRewind(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	request := MustNewRequest("GET", "http://example.com")
+	next, ok := rewind(request)
+	assert.True(ok)
+	assert.True(next == request)
+
+	request, err := http.NewRequest("POST", "http://example.com", bytes.NewBufferString("body"))
+	require.NoError(err)
+	ioutil.ReadAll(request.Body)
+
+	next, ok = rewind(request)
+	require.True(ok)
+	body, err := ioutil.ReadAll(next.Body)
+	assert.Equal("body", string(body))
+	assert.NoError(err)
+
+	request.GetBody = nil
+	next, ok = rewind(request)
+	assert.Nil(next)
+	assert.False(ok)
+}
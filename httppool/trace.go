@@ -0,0 +1,50 @@
+package httppool
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// ConnectionListener receives connection-level statistics about the HTTP transactions
+// carried out by a dispatcher.  Implementations must be safe for concurrent use, as
+// all workers in a pool share the same ConnectionListener.
+type ConnectionListener interface {
+	// ConnectionObtained is invoked each time a transaction obtains a connection.  The reused
+	// flag indicates whether the connection came from the idle pool rather than a new dial.
+	ConnectionObtained(reused bool)
+
+	// DNSLookup is invoked when a DNS lookup completes, with the lookup's latency and any error
+	DNSLookup(latency time.Duration, err error)
+
+	// TLSHandshake is invoked when a TLS handshake completes, with the handshake's latency and any error
+	TLSHandshake(latency time.Duration, err error)
+}
+
+// traceRequest returns a copy of the given request whose context carries an httptrace.ClientTrace
+// that reports to the given listener.  A distinct trace is created for each request, since the
+// trace holds the per-request start times.
+func traceRequest(request *http.Request, listener ConnectionListener) *http.Request {
+	var dnsStart, tlsStart time.Time
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			listener.ConnectionObtained(info.Reused)
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			dnsStart = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			listener.DNSLookup(time.Since(dnsStart), info.Err)
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			listener.TLSHandshake(time.Since(tlsStart), err)
+		},
+	}
+
+	return request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+}
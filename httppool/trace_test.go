@@ -0,0 +1,106 @@
+package httppool
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type mockConnectionListener struct {
+	mock.Mock
+}
+
+func (listener *mockConnectionListener) ConnectionObtained(reused bool) {
+	listener.Called(reused)
+}
+
+func (listener *mockConnectionListener) DNSLookup(latency time.Duration, err error) {
+	listener.Called(latency, err)
+}
+
+func (listener *mockConnectionListener) TLSHandshake(latency time.Duration, err error) {
+	listener.Called(latency, err)
+}
+
+func TestTraceRequest(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		listener = &mockConnectionListener{}
+		server   = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.WriteHeader(http.StatusOK)
+		}))
+	)
+
+	defer server.Close()
+
+	listener.On("ConnectionObtained", false).Once()
+	listener.On("ConnectionObtained", true).Once()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	for repeat := 0; repeat < 2; repeat++ {
+		request := traceRequest(MustNewRequest("GET", server.URL), listener)
+		response, err := client.Do(request)
+		if assert.NoError(err) {
+			response.Body.Close()
+		}
+	}
+
+	listener.AssertExpectations(t)
+}
+
+func TestTraceRequestTLS(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		listener = &mockConnectionListener{}
+		server   = httptest.NewTLSServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.WriteHeader(http.StatusOK)
+		}))
+	)
+
+	defer server.Close()
+
+	listener.On("ConnectionObtained", false).Once()
+	listener.On("TLSHandshake", mock.AnythingOfType("time.Duration"), nil).Once()
+
+	response, err := server.Client().Do(traceRequest(MustNewRequest("GET", server.URL), listener))
+	if assert.NoError(err) {
+		response.Body.Close()
+	}
+
+	listener.AssertExpectations(t)
+}
+
+func TestClientConnectionListener(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		listener = &mockConnectionListener{}
+		handler  = &mockTransactionHandler{}
+		consumer = &mockConsumer{}
+		request  = MustNewRequest("GET", "http://example.com/foo")
+
+		dispatcher = (&Client{
+			Handler:            handler,
+			Logger:             testLogger,
+			Workers:            1,
+			ConnectionListener: listener,
+		}).Start()
+
+		done = make(chan struct{})
+	)
+
+	handler.On("Do", mock.MatchedBy(func(actual *http.Request) bool {
+		return actual.URL == request.URL && actual.Context() != request.Context()
+	})).Return(nil, errors.New("expected")).Run(func(mock.Arguments) { close(done) }).Once()
+
+	assert.NoError(dispatcher.Send(RequestTask(request, consumer.Consumer)))
+	<-done
+	assert.NoError(dispatcher.Close())
+
+	handler.AssertExpectations(t)
+	listener.AssertExpectations(t)
+	consumer.AssertExpectations(t)
+}
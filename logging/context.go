@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"context"
+)
+
+// contextKey is the type of the context keys used by this package
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// WithLogger returns a new Context carrying the given StructuredLogger
+func WithLogger(parent context.Context, logger StructuredLogger) context.Context {
+	return context.WithValue(parent, loggerKey, logger)
+}
+
+// FromContext returns the StructuredLogger carried by the given Context, such as the
+// per-request logger installed by a RequestHandler.  If the Context carries no logger,
+// DefaultLogger adapted via Structured is returned.  This function never returns nil.
+func FromContext(ctx context.Context) StructuredLogger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey).(StructuredLogger); ok {
+			return logger
+		}
+	}
+
+	return Structured(DefaultLogger())
+}
+
+// PrintfFromContext is a convenience for printf-style code, such as handlers with a configured
+// Logger.  If the given Context carries a StructuredLogger, it is returned adapted via Printf so that
+// log output is correlated with the request.  Otherwise, fallback is returned.
+func PrintfFromContext(ctx context.Context, fallback Logger) Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey).(StructuredLogger); ok {
+			return Printf(logger)
+		}
+	}
+
+	return fallback
+}
+
+// WithRequestID returns a new Context carrying the given request ID
+func WithRequestID(parent context.Context, requestID string) context.Context {
+	return context.WithValue(parent, requestIDKey, requestID)
+}
+
+// GetRequestID returns the request ID carried by the given Context, if any
+func GetRequestID(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	requestID, ok := ctx.Value(requestIDKey).(string)
+	return requestID, ok
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	var (
+		assert           = assert.New(t)
+		recorder, output = testRecorder()
+	)
+
+	assert.NotNil(FromContext(nil))
+	assert.NotNil(FromContext(context.Background()))
+
+	FromContext(WithLogger(context.Background(), recorder)).Warn("from context")
+	assert.Equal([]testLogEntry{{WarnLevel, "from context", nil}}, *output)
+}
+
+func TestPrintfFromContext(t *testing.T) {
+	var (
+		assert           = assert.New(t)
+		recorder, output = testRecorder()
+		fallback         = DefaultLogger()
+	)
+
+	assert.Equal(fallback, PrintfFromContext(nil, fallback))
+	assert.Equal(fallback, PrintfFromContext(context.Background(), fallback))
+
+	logger := PrintfFromContext(WithLogger(context.Background(), recorder), fallback)
+	logger.Error("correlated %d", 1)
+	assert.Equal([]testLogEntry{{ErrorLevel, "correlated 1", nil}}, *output)
+}
+
+func TestGetRequestID(t *testing.T) {
+	assert := assert.New(t)
+
+	requestID, ok := GetRequestID(nil)
+	assert.Empty(requestID)
+	assert.False(ok)
+
+	requestID, ok = GetRequestID(context.Background())
+	assert.Empty(requestID)
+	assert.False(ok)
+
+	requestID, ok = GetRequestID(WithRequestID(context.Background(), "test"))
+	assert.Equal("test", requestID)
+	assert.True(ok)
+}
@@ -1,5 +1,8 @@
 /*
 Package logging provides a common Logger interface together with some infrastructure code.
 Integrations with other logging frameworks are provided in subpackages.
+
+Logger is printf-style.  New code should prefer StructuredLogger, whose entries are a constant message plus
+key/value pairs, and which can be written as JSON via NewJSONLogger.  Structured and Printf adapt between the two.
 */
 package logging
@@ -0,0 +1,4 @@
+/*
+Package gokit integrates the WebPA common structured logging with github.com/go-kit/kit/log.
+*/
+package gokit
@@ -0,0 +1,28 @@
+package gokit
+
+import (
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// New adapts a go-kit Logger onto logging.StructuredLogger.  Each entry is written with go-kit's
+// level package, so level.NewFilter may be used on the go-kit side as an alternative to logging.FilterLevel.
+// The message is written under logging.MessageKey.
+func New(logger log.Logger) logging.StructuredLogger {
+	return logging.StructuredLoggerFunc(func(l logging.Level, message string, keyvals []interface{}) {
+		var leveled log.Logger
+		switch l {
+		case logging.DebugLevel:
+			leveled = level.Debug(logger)
+		case logging.InfoLevel:
+			leveled = level.Info(logger)
+		case logging.WarnLevel:
+			leveled = level.Warn(logger)
+		default:
+			leveled = level.Error(logger)
+		}
+
+		leveled.Log(append([]interface{}{logging.MessageKey, message}, keyvals...)...)
+	})
+}
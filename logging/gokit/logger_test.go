@@ -0,0 +1,69 @@
+package gokit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		output  bytes.Buffer
+		logger  = New(log.NewJSONLogger(&output))
+	)
+
+	var testData = []struct {
+		log           func(string, ...interface{})
+		expectedLevel string
+	}{
+		{logger.Debug, "debug"},
+		{logger.Info, "info"},
+		{logger.Warn, "warn"},
+		{logger.Error, "error"},
+	}
+
+	for _, record := range testData {
+		t.Logf("%s", record.expectedLevel)
+		output.Reset()
+
+		record.log("test message", "id", "mac:112233445566", "error", errors.New("expected"))
+
+		var entry map[string]interface{}
+		require.NoError(json.Unmarshal(output.Bytes(), &entry))
+		assert.Equal(
+			map[string]interface{}{
+				"level": record.expectedLevel,
+				"msg":   "test message",
+				"id":    "mac:112233445566",
+				"error": "expected",
+			},
+			entry,
+		)
+	}
+}
+
+func TestNewFiltered(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		output bytes.Buffer
+		logger = New(level.NewFilter(log.NewLogfmtLogger(&output), level.AllowWarn()))
+	)
+
+	logger.Info("discarded")
+	assert.Empty(output.String())
+
+	logger.Warn("written", "key", "value")
+	assert.Equal("level=warn msg=written key=value\n", output.String())
+
+	output.Reset()
+	logging.FilterLevel(New(log.NewLogfmtLogger(&output)), logging.ErrorLevel).Warn("discarded")
+	assert.Empty(output.String())
+}
@@ -0,0 +1,245 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// LevelParameter is the request parameter, either in the query or a form body, carrying the new level
+	// for a LevelController
+	LevelParameter = "level"
+
+	// ComponentParameter is the optional request parameter naming the component whose level is changed
+	ComponentParameter = "component"
+)
+
+// levelSnapshot is an immutable view of the levels in a LevelController
+type levelSnapshot struct {
+	level      Level
+	components map[string]Level
+}
+
+func (s *levelSnapshot) enabled(component string, level Level) bool {
+	if componentLevel, ok := s.components[component]; ok {
+		return level >= componentLevel
+	}
+
+	return level >= s.level
+}
+
+// LevelController holds the log levels of an application, which can be changed while the application runs.
+// There is a global level plus optional levels for named components, e.g. "device".  A component without
+// its own level uses the global level.  Loggers obtained from Structured or Logger consult the controller
+// on every entry, so changes take effect immediately.
+//
+// Since the controller does all filtering, delegate loggers should write every level they are given.
+//
+// LevelController is also an http.Handler, intended for an administrative port:
+//
+//	GET returns the current levels as JSON, e.g. {"level":"info","components":{"device":"debug"}}
+//	PUT or POST sets the level given by the level parameter, for the component parameter if supplied
+//	DELETE removes the level of the component parameter, so that the component uses the global level again
+//
+// LevelController is safe for concurrent use.  Reading the levels does not require a lock.
+type LevelController struct {
+	lock     sync.Mutex
+	snapshot atomic.Value
+}
+
+// NewLevelController creates a LevelController with the given global level and no component levels
+func NewLevelController(level Level) *LevelController {
+	c := new(LevelController)
+	c.snapshot.Store(&levelSnapshot{level: level})
+	return c
+}
+
+func (c *LevelController) load() *levelSnapshot {
+	return c.snapshot.Load().(*levelSnapshot)
+}
+
+// update replaces the current snapshot with a modified copy
+func (c *LevelController) update(f func(*levelSnapshot)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	current := c.load()
+	next := &levelSnapshot{
+		level:      current.level,
+		components: make(map[string]Level, len(current.components)+1),
+	}
+
+	for component, level := range current.components {
+		next.components[component] = level
+	}
+
+	f(next)
+	c.snapshot.Store(next)
+}
+
+// Level returns the global level
+func (c *LevelController) Level() Level {
+	return c.load().level
+}
+
+// SetLevel changes the global level
+func (c *LevelController) SetLevel(level Level) {
+	c.update(func(s *levelSnapshot) {
+		s.level = level
+	})
+}
+
+// ComponentLevel returns the level in effect for the given component
+func (c *LevelController) ComponentLevel(component string) Level {
+	s := c.load()
+	if level, ok := s.components[component]; ok {
+		return level
+	}
+
+	return s.level
+}
+
+// SetComponentLevel gives a component its own level
+func (c *LevelController) SetComponentLevel(component string, level Level) {
+	c.update(func(s *levelSnapshot) {
+		s.components[component] = level
+	})
+}
+
+// ResetComponentLevel removes a component's own level, so that it uses the global level
+func (c *LevelController) ResetComponentLevel(component string) {
+	c.update(func(s *levelSnapshot) {
+		delete(s.components, component)
+	})
+}
+
+// Enabled tests if entries at the given level are written for the given component
+func (c *LevelController) Enabled(component string, level Level) bool {
+	return c.load().enabled(component, level)
+}
+
+// Structured returns a StructuredLogger for a component which writes to the given delegate only those
+// entries allowed by this controller.  An empty component uses the global level.
+func (c *LevelController) Structured(component string, delegate StructuredLogger) StructuredLogger {
+	return StructuredLoggerFunc(func(level Level, message string, keyvals []interface{}) {
+		if !c.Enabled(component, level) {
+			return
+		}
+
+		switch level {
+		case DebugLevel:
+			delegate.Debug(message, keyvals...)
+		case InfoLevel:
+			delegate.Info(message, keyvals...)
+		case WarnLevel:
+			delegate.Warn(message, keyvals...)
+		default:
+			delegate.Error(message, keyvals...)
+		}
+	})
+}
+
+// Logger returns a printf-style Logger for a component which writes to the given delegate only those
+// entries allowed by this controller.  Trace entries are written when debug entries are.  An empty component
+// uses the global level.
+func (c *LevelController) Logger(component string, delegate Logger) Logger {
+	return &controlledLogger{c, component, delegate}
+}
+
+type controlledLogger struct {
+	controller *LevelController
+	component  string
+	delegate   Logger
+}
+
+func (l *controlledLogger) Trace(parameters ...interface{}) {
+	if l.controller.Enabled(l.component, DebugLevel) {
+		l.delegate.Trace(parameters...)
+	}
+}
+
+func (l *controlledLogger) Debug(parameters ...interface{}) {
+	if l.controller.Enabled(l.component, DebugLevel) {
+		l.delegate.Debug(parameters...)
+	}
+}
+
+func (l *controlledLogger) Info(parameters ...interface{}) {
+	if l.controller.Enabled(l.component, InfoLevel) {
+		l.delegate.Info(parameters...)
+	}
+}
+
+func (l *controlledLogger) Warn(parameters ...interface{}) {
+	if l.controller.Enabled(l.component, WarnLevel) {
+		l.delegate.Warn(parameters...)
+	}
+}
+
+func (l *controlledLogger) Error(parameters ...interface{}) {
+	if l.controller.Enabled(l.component, ErrorLevel) {
+		l.delegate.Error(parameters...)
+	}
+}
+
+// levelsResponse is the JSON representation of a LevelController's levels
+type levelsResponse struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+}
+
+func (c *LevelController) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		level, err := ParseLevel(request.FormValue(LevelParameter))
+		if err != nil {
+			writeLevelError(response, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if component := request.FormValue(ComponentParameter); len(component) > 0 {
+			c.SetComponentLevel(component, level)
+		} else {
+			c.SetLevel(level)
+		}
+
+	case http.MethodDelete:
+		component := request.FormValue(ComponentParameter)
+		if len(component) == 0 {
+			writeLevelError(response, http.StatusBadRequest, fmt.Sprintf("No %s parameter", ComponentParameter))
+			return
+		}
+
+		c.ResetComponentLevel(component)
+
+	default:
+		response.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		writeLevelError(response, http.StatusMethodNotAllowed, fmt.Sprintf("Method not allowed: %s", request.Method))
+		return
+	}
+
+	s := c.load()
+	levels := levelsResponse{
+		Level:      s.level.String(),
+		Components: make(map[string]string, len(s.components)),
+	}
+
+	for component, level := range s.components {
+		levels.Components[component] = level.String()
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(levels)
+}
+
+// writeLevelError writes a JSON error message in the same form used by the secure handlers
+func writeLevelError(response http.ResponseWriter, code int, message string) {
+	encodedMessage, _ := json.Marshal(message)
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(code)
+	fmt.Fprintf(response, `{"message": %s}`, encodedMessage)
+}
@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLevelController(t *testing.T) {
+	assert := assert.New(t)
+	controller := NewLevelController(InfoLevel)
+
+	assert.Equal(InfoLevel, controller.Level())
+	assert.Equal(InfoLevel, controller.ComponentLevel("device"))
+	assert.False(controller.Enabled("device", DebugLevel))
+	assert.True(controller.Enabled("device", InfoLevel))
+
+	controller.SetComponentLevel("device", DebugLevel)
+	assert.Equal(InfoLevel, controller.Level())
+	assert.Equal(DebugLevel, controller.ComponentLevel("device"))
+	assert.True(controller.Enabled("device", DebugLevel))
+	assert.False(controller.Enabled("", DebugLevel))
+
+	controller.SetLevel(ErrorLevel)
+	assert.Equal(ErrorLevel, controller.Level())
+	assert.Equal(DebugLevel, controller.ComponentLevel("device"))
+	assert.False(controller.Enabled("secure", WarnLevel))
+
+	controller.ResetComponentLevel("device")
+	assert.Equal(ErrorLevel, controller.ComponentLevel("device"))
+	assert.False(controller.Enabled("device", DebugLevel))
+}
+
+func TestLevelControllerStructured(t *testing.T) {
+	var (
+		assert           = assert.New(t)
+		controller       = NewLevelController(WarnLevel)
+		recorder, output = testRecorder()
+		logger           = controller.Structured("device", recorder)
+	)
+
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warn", "key", "value")
+	logger.Error("error")
+	assert.Equal(
+		[]testLogEntry{
+			{WarnLevel, "warn", []interface{}{"key", "value"}},
+			{ErrorLevel, "error", nil},
+		},
+		*output,
+	)
+
+	*output = nil
+	controller.SetComponentLevel("device", DebugLevel)
+	logger.Debug("debug")
+	logger.Info("info")
+	assert.Equal(
+		[]testLogEntry{
+			{DebugLevel, "debug", nil},
+			{InfoLevel, "info", nil},
+		},
+		*output,
+	)
+}
+
+func TestLevelControllerLogger(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		controller = NewLevelController(InfoLevel)
+		output     bytes.Buffer
+		logger     = controller.Logger("", &LoggerWriter{&output})
+	)
+
+	logger.Trace("trace")
+	logger.Debug("debug")
+	logger.Info("info %d", 1)
+	logger.Warn("warn")
+	logger.Error("error")
+	assert.Equal("[INFO]  info 1\n[WARN]  warn\n[ERROR] error\n", output.String())
+
+	output.Reset()
+	controller.SetLevel(DebugLevel)
+	logger.Trace("trace")
+	logger.Debug("debug")
+	assert.Equal("[TRACE] trace\n[DEBUG] debug\n", output.String())
+}
+
+func testLevelControllerServeHTTP(t *testing.T, controller *LevelController, request *http.Request, expectedStatus int) map[string]interface{} {
+	response := httptest.NewRecorder()
+	controller.ServeHTTP(response, request)
+	assert.Equal(t, expectedStatus, response.Code)
+	assert.Equal(t, "application/json", response.HeaderMap.Get("Content-Type"))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	return body
+}
+
+func TestLevelControllerServeHTTP(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		controller = NewLevelController(InfoLevel)
+	)
+
+	assert.Equal(
+		map[string]interface{}{"level": "info", "components": map[string]interface{}{}},
+		testLevelControllerServeHTTP(t, controller, httptest.NewRequest("GET", "/", nil), http.StatusOK),
+	)
+
+	assert.Equal(
+		map[string]interface{}{"level": "warn", "components": map[string]interface{}{}},
+		testLevelControllerServeHTTP(t, controller, httptest.NewRequest("PUT", "/?level=WARN", nil), http.StatusOK),
+	)
+
+	request := httptest.NewRequest("POST", "/", strings.NewReader("level=debug&component=device"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(
+		map[string]interface{}{"level": "warn", "components": map[string]interface{}{"device": "debug"}},
+		testLevelControllerServeHTTP(t, controller, request, http.StatusOK),
+	)
+
+	assert.Equal(DebugLevel, controller.ComponentLevel("device"))
+
+	assert.Contains(
+		testLevelControllerServeHTTP(t, controller, httptest.NewRequest("PUT", "/?level=nosuch", nil), http.StatusBadRequest),
+		"message",
+	)
+
+	assert.Contains(
+		testLevelControllerServeHTTP(t, controller, httptest.NewRequest("DELETE", "/", nil), http.StatusBadRequest),
+		"message",
+	)
+
+	assert.Equal(
+		map[string]interface{}{"level": "warn", "components": map[string]interface{}{}},
+		testLevelControllerServeHTTP(t, controller, httptest.NewRequest("DELETE", "/?component=device", nil), http.StatusOK),
+	)
+
+	assert.Contains(
+		testLevelControllerServeHTTP(t, controller, httptest.NewRequest("PATCH", "/", nil), http.StatusMethodNotAllowed),
+		"message",
+	)
+
+	assert.Equal(WarnLevel, controller.Level())
+	assert.Equal(WarnLevel, controller.ComponentLevel("device"))
+}
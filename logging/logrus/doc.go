@@ -0,0 +1,4 @@
+/*
+Package logrus integrates the WebPA common structured logging with github.com/sirupsen/logrus.
+*/
+package logrus
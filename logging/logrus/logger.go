@@ -0,0 +1,44 @@
+package logrus
+
+import (
+	"fmt"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// New adapts a logrus FieldLogger onto logging.StructuredLogger.  Each key/value pair becomes a
+// logrus field, and logrus's own level and formatter apply as usual.  A key with no value is given
+// the value "(MISSING)".
+func New(logger logrus.FieldLogger) logging.StructuredLogger {
+	return logging.StructuredLoggerFunc(func(l logging.Level, message string, keyvals []interface{}) {
+		entry := logger
+		if len(keyvals) > 0 {
+			fields := make(logrus.Fields, (len(keyvals)+1)/2)
+			for index := 0; index < len(keyvals); index += 2 {
+				key, ok := keyvals[index].(string)
+				if !ok {
+					key = fmt.Sprint(keyvals[index])
+				}
+
+				if index+1 < len(keyvals) {
+					fields[key] = keyvals[index+1]
+				} else {
+					fields[key] = "(MISSING)"
+				}
+			}
+
+			entry = logger.WithFields(fields)
+		}
+
+		switch l {
+		case logging.DebugLevel:
+			entry.Debug(message)
+		case logging.InfoLevel:
+			entry.Info(message)
+		case logging.WarnLevel:
+			entry.Warn(message)
+		default:
+			entry.Error(message)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package logrus
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		output   bytes.Buffer
+		delegate = &logrus.Logger{
+			Out:       &output,
+			Formatter: &logrus.JSONFormatter{},
+			Hooks:     make(logrus.LevelHooks),
+			Level:     logrus.DebugLevel,
+		}
+
+		logger = New(delegate)
+	)
+
+	var testData = []struct {
+		log           func(string, ...interface{})
+		expectedLevel string
+	}{
+		{logger.Debug, "debug"},
+		{logger.Info, "info"},
+		{logger.Warn, "warning"},
+		{logger.Error, "error"},
+	}
+
+	for _, record := range testData {
+		t.Logf("%s", record.expectedLevel)
+		output.Reset()
+
+		record.log("test message", "id", "mac:112233445566", 5, "five", "dangling")
+
+		var entry map[string]interface{}
+		require.NoError(json.Unmarshal(output.Bytes(), &entry))
+		assert.Equal(record.expectedLevel, entry["level"])
+		assert.Equal("test message", entry["msg"])
+		assert.Equal("mac:112233445566", entry["id"])
+		assert.Equal("five", entry["5"])
+		assert.Equal("(MISSING)", entry["dangling"])
+	}
+
+	output.Reset()
+	delegate.Level = logrus.WarnLevel
+	logger.Info("discarded")
+	assert.Empty(output.String())
+
+	logger.Warn("no fields")
+	assert.Contains(output.String(), `"msg":"no fields"`)
+}
@@ -0,0 +1,264 @@
+package logtest
+
+import (
+	"fmt"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+)
+
+// AnyLevel is the Expectation level that matches entries of every level
+const AnyLevel logging.Level = -1
+
+// Entry is a single captured log entry
+type Entry struct {
+	// Level is the level of the entry.  Trace entries from a printf-style logger are captured as debug entries.
+	Level logging.Level
+
+	// Message is the message of a structured entry, or the formatted text of a printf-style entry
+	Message string
+
+	// Format is the format string of a printf-style entry.  This field is empty for structured entries.
+	Format string
+
+	// Keyvals are the alternating key/value pairs of a structured entry
+	Keyvals []interface{}
+}
+
+// Field returns the value of the first occurrence of a key in this entry's key/value pairs
+func (e Entry) Field(key string) (interface{}, bool) {
+	for index := 0; index < len(e.Keyvals); index += 2 {
+		if fmt.Sprint(e.Keyvals[index]) == key {
+			if index+1 < len(e.Keyvals) {
+				return e.Keyvals[index+1], true
+			}
+
+			return nil, true
+		}
+	}
+
+	return nil, false
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("[%s] %s %v", e.Level, e.Message, e.Keyvals)
+}
+
+// Expectation describes the entries matched by an assertion
+type Expectation struct {
+	// Level is the level an entry must have.  Use AnyLevel to match entries of every level.
+	Level logging.Level
+
+	// Message, if supplied, is the exact message an entry must have
+	Message string
+
+	// Contains, if supplied, is text that an entry's message must contain
+	Contains string
+
+	// Fields are key/value pairs that an entry must have.  Values are compared with assert.ObjectsAreEqual.
+	Fields map[string]interface{}
+}
+
+// Expect is a convenient way to produce an Expectation for an entry with the given level, message,
+// and key/value pairs.  The message may be empty, in which case any message matches.
+func Expect(level logging.Level, message string, keyvals ...interface{}) Expectation {
+	e := Expectation{
+		Level:   level,
+		Message: message,
+	}
+
+	if len(keyvals) > 0 {
+		e.Fields = make(map[string]interface{}, len(keyvals)/2)
+		for index := 0; index < len(keyvals); index += 2 {
+			var value interface{}
+			if index+1 < len(keyvals) {
+				value = keyvals[index+1]
+			}
+
+			e.Fields[fmt.Sprint(keyvals[index])] = value
+		}
+	}
+
+	return e
+}
+
+// Matches tests if an entry meets this expectation
+func (e Expectation) Matches(entry Entry) bool {
+	if e.Level != AnyLevel && e.Level != entry.Level {
+		return false
+	}
+
+	if (len(e.Message) > 0 && e.Message != entry.Message) || !strings.Contains(entry.Message, e.Contains) {
+		return false
+	}
+
+	for key, expected := range e.Fields {
+		if actual, ok := entry.Field(key); !ok || !assert.ObjectsAreEqual(expected, actual) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e Expectation) String() string {
+	return fmt.Sprintf("{level: %s, message: %q, contains: %q, fields: %v}", levelName(e.Level), e.Message, e.Contains, e.Fields)
+}
+
+func levelName(level logging.Level) string {
+	if level == AnyLevel {
+		return "any"
+	}
+
+	return level.String()
+}
+
+// Capture records log entries for later inspection.  It is safe for concurrent use.
+type Capture struct {
+	lock    sync.Mutex
+	entries []Entry
+}
+
+// New creates an empty Capture
+func New() *Capture {
+	return new(Capture)
+}
+
+func (c *Capture) add(entry Entry) {
+	c.lock.Lock()
+	c.entries = append(c.entries, entry)
+	c.lock.Unlock()
+}
+
+// Structured returns a logging.StructuredLogger which records its entries in this Capture
+func (c *Capture) Structured() logging.StructuredLogger {
+	return logging.StructuredLoggerFunc(func(level logging.Level, message string, keyvals []interface{}) {
+		c.add(Entry{
+			Level:   level,
+			Message: message,
+			Keyvals: append([]interface{}(nil), keyvals...),
+		})
+	})
+}
+
+// Logger returns a printf-style logging.Logger which records its entries in this Capture
+func (c *Capture) Logger() logging.Logger {
+	return printfLogger{c}
+}
+
+type printfLogger struct {
+	capture *Capture
+}
+
+func (l printfLogger) log(level logging.Level, parameters []interface{}) {
+	entry := Entry{Level: level}
+	if len(parameters) > 0 {
+		var ok bool
+		if entry.Format, ok = parameters[0].(string); ok {
+			entry.Message = fmt.Sprintf(entry.Format, parameters[1:]...)
+		} else {
+			entry.Message = fmt.Sprint(parameters...)
+		}
+	}
+
+	l.capture.add(entry)
+}
+
+func (l printfLogger) Trace(parameters ...interface{}) { l.log(logging.DebugLevel, parameters) }
+func (l printfLogger) Debug(parameters ...interface{}) { l.log(logging.DebugLevel, parameters) }
+func (l printfLogger) Info(parameters ...interface{})  { l.log(logging.InfoLevel, parameters) }
+func (l printfLogger) Warn(parameters ...interface{})  { l.log(logging.WarnLevel, parameters) }
+func (l printfLogger) Error(parameters ...interface{}) { l.log(logging.ErrorLevel, parameters) }
+
+// Entries returns a copy of the captured entries, in the order they were written
+func (c *Capture) Entries() []Entry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]Entry(nil), c.entries...)
+}
+
+// Reset discards all captured entries
+func (c *Capture) Reset() {
+	c.lock.Lock()
+	c.entries = nil
+	c.lock.Unlock()
+}
+
+// Find returns the captured entries which meet an expectation
+func (c *Capture) Find(e Expectation) []Entry {
+	var found []Entry
+	for _, entry := range c.Entries() {
+		if e.Matches(entry) {
+			found = append(found, entry)
+		}
+	}
+
+	return found
+}
+
+// Count returns the number of captured entries with the given level, which may be AnyLevel
+func (c *Capture) Count(level logging.Level) int {
+	return len(c.Find(Expectation{Level: level}))
+}
+
+// String returns the captured entries, one per line, for use in failure messages
+func (c *Capture) String() string {
+	var output []string
+	for _, entry := range c.Entries() {
+		output = append(output, entry.String())
+	}
+
+	return strings.Join(output, "\n")
+}
+
+// AssertCount asserts that the number of captured entries with the given level, which may be AnyLevel,
+// is the expected count
+func (c *Capture) AssertCount(t assert.TestingT, level logging.Level, expected int, msgAndArgs ...interface{}) bool {
+	if actual := c.Count(level); actual != expected {
+		return assert.Fail(t, fmt.Sprintf("Expected %d entries at level %s, but found %d:\n%s", expected, levelName(level), actual, c), msgAndArgs...)
+	}
+
+	return true
+}
+
+// AssertLogged asserts that at least one captured entry meets the expectation
+func (c *Capture) AssertLogged(t assert.TestingT, e Expectation, msgAndArgs ...interface{}) bool {
+	if len(c.Find(e)) == 0 {
+		return assert.Fail(t, fmt.Sprintf("No entry matches %s:\n%s", e, c), msgAndArgs...)
+	}
+
+	return true
+}
+
+// AssertNotLogged asserts that no captured entry meets the expectation
+func (c *Capture) AssertNotLogged(t assert.TestingT, e Expectation, msgAndArgs ...interface{}) bool {
+	if found := c.Find(e); len(found) > 0 {
+		return assert.Fail(t, fmt.Sprintf("Unexpected entry matches %s: %s", e, found[0]), msgAndArgs...)
+	}
+
+	return true
+}
+
+// AssertOrdered asserts that the expectations are met by captured entries in the given order.  Other entries
+// may appear before, between, or after the matching entries.
+func (c *Capture) AssertOrdered(t assert.TestingT, expectations ...Expectation) bool {
+	var (
+		entries = c.Entries()
+		next    = 0
+	)
+
+	for _, e := range expectations {
+		for next < len(entries) && !e.Matches(entries[next]) {
+			next++
+		}
+
+		if next >= len(entries) {
+			return assert.Fail(t, fmt.Sprintf("No entry matches %s in order:\n%s", e, c))
+		}
+
+		next++
+	}
+
+	return true
+}
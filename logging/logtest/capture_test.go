@@ -0,0 +1,162 @@
+package logtest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// recordingT is an assert.TestingT that records failures rather than failing the enclosing test
+type recordingT struct {
+	failures []string
+}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestEntryField(t *testing.T) {
+	assert := assert.New(t)
+	entry := Entry{Keyvals: []interface{}{"id", "mac:112233445566", "count", 2, "dangling"}}
+
+	value, ok := entry.Field("id")
+	assert.Equal("mac:112233445566", value)
+	assert.True(ok)
+
+	value, ok = entry.Field("count")
+	assert.Equal(2, value)
+	assert.True(ok)
+
+	value, ok = entry.Field("dangling")
+	assert.Nil(value)
+	assert.True(ok)
+
+	value, ok = entry.Field("nosuch")
+	assert.Nil(value)
+	assert.False(ok)
+}
+
+func TestExpectationMatches(t *testing.T) {
+	var (
+		entry = Entry{Level: logging.WarnLevel, Message: "device disconnected", Keyvals: []interface{}{"id", "mac:112233445566", "reason", errors.New("closed")}}
+
+		testData = []struct {
+			expectation Expectation
+			expected    bool
+		}{
+			{Expectation{Level: AnyLevel}, true},
+			{Expectation{Level: logging.WarnLevel}, true},
+			{Expectation{Level: logging.ErrorLevel}, false},
+			{Expectation{Level: AnyLevel, Message: "device disconnected"}, true},
+			{Expectation{Level: AnyLevel, Message: "device"}, false},
+			{Expectation{Level: AnyLevel, Contains: "disconnect"}, true},
+			{Expectation{Level: AnyLevel, Contains: "connected!"}, false},
+			{Expect(logging.WarnLevel, "", "id", "mac:112233445566"), true},
+			{Expect(logging.WarnLevel, "device disconnected", "reason", errors.New("closed")), true},
+			{Expect(logging.WarnLevel, "", "id", "mac:FFFFFFFFFFFF"), false},
+			{Expect(logging.WarnLevel, "", "nosuch", nil), false},
+		}
+	)
+
+	for _, record := range testData {
+		t.Logf("%s", record.expectation)
+		assert.Equal(t, record.expected, record.expectation.Matches(entry))
+	}
+}
+
+func TestCaptureStructured(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		capture = New()
+		logger  = capture.Structured()
+	)
+
+	logger.Debug("debug", "key", 1)
+	logger.Info("info")
+	logger.Warn("warn")
+	logger.Error("error", "key", 2)
+
+	assert.Equal(
+		[]Entry{
+			{Level: logging.DebugLevel, Message: "debug", Keyvals: []interface{}{"key", 1}},
+			{Level: logging.InfoLevel, Message: "info"},
+			{Level: logging.WarnLevel, Message: "warn"},
+			{Level: logging.ErrorLevel, Message: "error", Keyvals: []interface{}{"key", 2}},
+		},
+		capture.Entries(),
+	)
+
+	assert.Equal(4, capture.Count(AnyLevel))
+	assert.Equal(1, capture.Count(logging.ErrorLevel))
+
+	capture.Reset()
+	assert.Empty(capture.Entries())
+	assert.Equal(0, capture.Count(AnyLevel))
+}
+
+func TestCaptureLogger(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		capture = New()
+		logger  = capture.Logger()
+	)
+
+	logger.Trace("trace %d", 1)
+	logger.Debug("debug")
+	logger.Info("info %s", "value")
+	logger.Warn(42)
+	logger.Error()
+
+	assert.Equal(
+		[]Entry{
+			{Level: logging.DebugLevel, Message: "trace 1", Format: "trace %d"},
+			{Level: logging.DebugLevel, Message: "debug", Format: "debug"},
+			{Level: logging.InfoLevel, Message: "info value", Format: "info %s"},
+			{Level: logging.WarnLevel, Message: "42"},
+			{Level: logging.ErrorLevel},
+		},
+		capture.Entries(),
+	)
+}
+
+func TestCaptureAssertions(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		capture = New()
+		logger  = capture.Structured()
+	)
+
+	logger.Info("starting")
+	logger.Info("device connected", "id", "mac:112233445566")
+	logger.Error("device failed", "id", "mac:112233445566")
+	logger.Info("device disconnected", "id", "mac:112233445566")
+
+	{
+		recorder := new(recordingT)
+		assert.True(capture.AssertCount(recorder, logging.InfoLevel, 3))
+		assert.True(capture.AssertCount(recorder, logging.DebugLevel, 0))
+		assert.True(capture.AssertLogged(recorder, Expect(logging.ErrorLevel, "device failed", "id", "mac:112233445566")))
+		assert.True(capture.AssertNotLogged(recorder, Expect(logging.WarnLevel, "")))
+		assert.True(capture.AssertOrdered(recorder,
+			Expect(logging.InfoLevel, "device connected"),
+			Expectation{Level: AnyLevel, Contains: "disconnected"},
+		))
+
+		assert.Empty(recorder.failures)
+	}
+
+	{
+		recorder := new(recordingT)
+		assert.False(capture.AssertCount(recorder, logging.ErrorLevel, 0))
+		assert.False(capture.AssertLogged(recorder, Expect(logging.InfoLevel, "device failed")))
+		assert.False(capture.AssertNotLogged(recorder, Expect(AnyLevel, "starting")))
+		assert.False(capture.AssertOrdered(recorder,
+			Expect(logging.InfoLevel, "device disconnected"),
+			Expect(logging.InfoLevel, "device connected"),
+		))
+
+		assert.Len(recorder.failures, 4)
+	}
+}
@@ -0,0 +1,15 @@
+/*
+Package logtest provides a capturing logger for tests.  A Capture records every entry written to it, through
+either the printf-style logging.Logger or the logging.StructuredLogger it hands out, and offers assertions
+on the recorded entries:
+
+	capture := logtest.New()
+	component := NewComponent(capture.Logger())
+	component.DoSomething()
+
+	capture.AssertCount(t, logging.ErrorLevel, 0)
+	capture.AssertLogged(t, logtest.Expect(logging.InfoLevel, "device connected", "id", "mac:112233445566"))
+
+This avoids scraping the output of a logging.LoggerWriter, which breaks whenever formatting changes.
+*/
+package logtest
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+const (
+	// DefaultRequestIDHeader is the header which carries request IDs when no header is configured
+	DefaultRequestIDHeader = "X-Request-Id"
+
+	// RequestIDKey is the key under which request IDs are logged by per-request loggers
+	RequestIDKey = "requestID"
+)
+
+// requestIDPattern restricts the request IDs accepted from clients, so that they are safe to log
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestHandler provides Alice-compatible decoration that assigns each request an ID and a logger.
+// A well-formed ID supplied by the client in the header is reused, which allows a request to be traced
+// across services.  Otherwise, a random ID is generated.  The ID is echoed in the response header.
+//
+// The request's Context carries both the ID, available via GetRequestID, and a StructuredLogger preloaded
+// with the ID, method, path, and remote address of the request, available via FromContext.
+type RequestHandler struct {
+	// Logger is the base for per-request loggers.  If not supplied, DefaultLogger adapted via Structured is used.
+	Logger StructuredLogger
+
+	// HeaderName is the request and response header carrying the ID.  If not supplied,
+	// DefaultRequestIDHeader is used.
+	HeaderName string
+}
+
+func (r RequestHandler) logger() StructuredLogger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+
+	return Structured(DefaultLogger())
+}
+
+func (r RequestHandler) headerName() string {
+	if len(r.HeaderName) > 0 {
+		return r.HeaderName
+	}
+
+	return DefaultRequestIDHeader
+}
+
+// Decorate provides an Alice-compatible constructor that assigns request IDs and loggers
+func (r RequestHandler) Decorate(delegate http.Handler) http.Handler {
+	var (
+		logger     = r.logger()
+		headerName = r.headerName()
+	)
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		requestID := request.Header.Get(headerName)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		response.Header().Set(headerName, requestID)
+
+		ctx := WithRequestID(request.Context(), requestID)
+		ctx = WithLogger(
+			ctx,
+			With(
+				logger,
+				RequestIDKey, requestID,
+				"method", request.Method,
+				"path", request.URL.Path,
+				"remoteAddr", request.RemoteAddr,
+			),
+		)
+
+		delegate.ServeHTTP(response, request.WithContext(ctx))
+	})
+}
+
+// newRequestID generates a random, hex-encoded request ID
+func newRequestID() string {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		// the system's random source is broken, which is not recoverable
+		panic(err)
+	}
+
+	return hex.EncodeToString(buffer)
+}
@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestHandler(t *testing.T) {
+	var testData = []struct {
+		headerName     string
+		incoming       string
+		expectIncoming bool
+	}{
+		{"", "", false},
+		{"", "abc-123", true},
+		{"", "contains spaces", false},
+		{"", strings.Repeat("x", 129), false},
+		{"X-Correlation-Id", "", false},
+		{"X-Correlation-Id", "service:1234.5", true},
+	}
+
+	for index, record := range testData {
+		t.Logf("%d", index)
+
+		var (
+			assert           = assert.New(t)
+			recorder, output = testRecorder()
+			actualID         string
+			expectedName     = record.headerName
+			handler          = RequestHandler{Logger: recorder, HeaderName: record.headerName}.Decorate(
+				http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+					actualID, _ = GetRequestID(request.Context())
+					FromContext(request.Context()).Info("handled", "key", "value")
+				}),
+			)
+
+			request  = httptest.NewRequest("GET", "/test", nil)
+			response = httptest.NewRecorder()
+		)
+
+		if len(expectedName) == 0 {
+			expectedName = DefaultRequestIDHeader
+		}
+
+		if len(record.incoming) > 0 {
+			request.Header.Set(expectedName, record.incoming)
+		}
+
+		handler.ServeHTTP(response, request)
+		assert.Equal(actualID, response.HeaderMap.Get(expectedName))
+		if record.expectIncoming {
+			assert.Equal(record.incoming, actualID)
+		} else {
+			assert.Len(actualID, 32)
+		}
+
+		assert.Equal(
+			[]testLogEntry{
+				{
+					InfoLevel,
+					"handled",
+					[]interface{}{
+						RequestIDKey, actualID,
+						"method", "GET",
+						"path", "/test",
+						"remoteAddr", request.RemoteAddr,
+						"key", "value",
+					},
+				},
+			},
+			*output,
+		)
+	}
+}
+
+func TestRequestHandlerDefaultLogger(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		called  = false
+		handler = RequestHandler{}.Decorate(
+			http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+				called = true
+				assert.NotNil(FromContext(request.Context()))
+			}),
+		)
+	)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.True(called)
+}
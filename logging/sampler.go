@@ -0,0 +1,287 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// SuppressedKey is the key under which a sampled logger reports the number of identical
+	// entries that were suppressed since the last one written
+	SuppressedKey = "suppressed"
+
+	DefaultSamplingInterval   time.Duration = time.Second
+	DefaultSamplingFirst                    = 10
+	DefaultSamplingThereafter               = 100
+)
+
+// SamplingRule determines how many identical entries are written in each sampling interval.
+// The first First entries are written, then every Thereafter-th entry after that.  A negative
+// First disables sampling, so that every entry is written.  A negative Thereafter writes nothing
+// after the first First entries.
+type SamplingRule struct {
+	First      int `json:"first"`
+	Thereafter int `json:"thereafter"`
+}
+
+// allows tests if the nth entry within an interval, counting from 1, should be written
+func (r SamplingRule) allows(n int) bool {
+	switch {
+	case r.First < 0 || n <= r.First:
+		return true
+	case r.Thereafter <= 0:
+		return false
+	default:
+		return (n-r.First)%r.Thereafter == 0
+	}
+}
+
+// SamplingOptions configures the sampling of identical log entries.  Entries are identical when they
+// have the same level and message, regardless of their key/value pairs.  For printf-style loggers, the
+// format string is the message.
+//
+// The rule for an entry is taken from Messages, then Levels, then Default.  For example, Levels can
+// exempt errors from sampling with a First of -1, and Messages can tame a particular noisy message.
+type SamplingOptions struct {
+	// Interval is the period over which identical entries are counted.  If not supplied,
+	// DefaultSamplingInterval is used.
+	Interval time.Duration `json:"interval"`
+
+	// Default is the rule used for entries without a more specific rule.  If this rule is
+	// the zero value, DefaultSamplingFirst and DefaultSamplingThereafter are used.
+	Default SamplingRule `json:"default"`
+
+	// Levels are the rules for particular levels
+	Levels map[Level]SamplingRule `json:"levels"`
+
+	// Messages are the rules for particular messages
+	Messages map[string]SamplingRule `json:"messages"`
+}
+
+func (o *SamplingOptions) interval() time.Duration {
+	if o != nil && o.Interval > 0 {
+		return o.Interval
+	}
+
+	return DefaultSamplingInterval
+}
+
+func (o *SamplingOptions) rule(level Level, message string) SamplingRule {
+	if o != nil {
+		if rule, ok := o.Messages[message]; ok {
+			return rule
+		}
+
+		if rule, ok := o.Levels[level]; ok {
+			return rule
+		}
+
+		if o.Default != (SamplingRule{}) {
+			return o.Default
+		}
+	}
+
+	return SamplingRule{First: DefaultSamplingFirst, Thereafter: DefaultSamplingThereafter}
+}
+
+// samplingKey identifies identical entries
+type samplingKey struct {
+	level   Level
+	message string
+}
+
+// samplingCounter tracks the identical entries within the current interval
+type samplingCounter struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// Sampler decides which entries of a noisy logger are written.  Rather than writing every one of a burst
+// of identical entries, a Sampler writes only those allowed by its rules and counts the rest.  The number
+// of entries suppressed since the last entry written is reported with the next identical entry to be written,
+// or as a separate entry once the burst has passed.
+//
+// Sampler is the common infrastructure for Sample and SampleLogger.  It is safe for concurrent use.
+type Sampler struct {
+	options  *SamplingOptions
+	interval time.Duration
+	now      func() time.Time
+
+	lock      sync.Mutex
+	counters  map[samplingKey]*samplingCounter
+	lastSweep time.Time
+
+	suppressed uint64
+}
+
+// NewSampler creates a Sampler from a set of options
+func NewSampler(o *SamplingOptions) *Sampler {
+	return &Sampler{
+		options:  o,
+		interval: o.interval(),
+		now:      time.Now,
+		counters: make(map[samplingKey]*samplingCounter),
+	}
+}
+
+// Suppressed returns the total number of entries this Sampler has suppressed
+func (s *Sampler) Suppressed() uint64 {
+	return atomic.LoadUint64(&s.suppressed)
+}
+
+// samplingReport is a count of suppressed entries which has yet to be written
+type samplingReport struct {
+	samplingKey
+	suppressed int
+}
+
+// sample decides whether an entry should be written.  If so, the number of identical entries suppressed
+// since the last one written is returned along with true.  Reports of suppressed entries for bursts that
+// have passed are also returned, and must be written by the caller.
+func (s *Sampler) sample(level Level, message string) (bool, int, []samplingReport) {
+	var (
+		key     = samplingKey{level, message}
+		now     = s.now()
+		reports []samplingReport
+	)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if now.Sub(s.lastSweep) >= s.interval {
+		reports = s.sweep(now, key)
+	}
+
+	counter, ok := s.counters[key]
+	if !ok || now.Sub(counter.start) >= s.interval {
+		if !ok {
+			counter = new(samplingCounter)
+			s.counters[key] = counter
+		}
+
+		counter.start = now
+		counter.count = 0
+	}
+
+	counter.count++
+	if !s.options.rule(level, message).allows(counter.count) {
+		counter.suppressed++
+		atomic.AddUint64(&s.suppressed, 1)
+		return false, 0, reports
+	}
+
+	suppressed := counter.suppressed
+	counter.suppressed = 0
+	return true, suppressed, reports
+}
+
+// sweep discards the counters of bursts that have passed, reporting any suppressed entries.  The counter
+// for the current key is left alone, since its suppressed entries are reported with the current entry.
+// This method must be called under the lock.
+func (s *Sampler) sweep(now time.Time, current samplingKey) (reports []samplingReport) {
+	s.lastSweep = now
+	for key, counter := range s.counters {
+		if key != current && now.Sub(counter.start) >= s.interval {
+			if counter.suppressed > 0 {
+				reports = append(reports, samplingReport{key, counter.suppressed})
+			}
+
+			delete(s.counters, key)
+		}
+	}
+
+	return
+}
+
+// Sample decorates a StructuredLogger so that bursts of identical entries are sampled.  Entries that
+// are written after others were suppressed carry the number suppressed under SuppressedKey.
+func Sample(delegate StructuredLogger, o *SamplingOptions) StructuredLogger {
+	return NewSampler(o).Structured(delegate)
+}
+
+// Structured returns a StructuredLogger which writes to the given delegate the entries this Sampler allows
+func (s *Sampler) Structured(delegate StructuredLogger) StructuredLogger {
+	write := func(level Level, message string, keyvals []interface{}) {
+		switch level {
+		case DebugLevel:
+			delegate.Debug(message, keyvals...)
+		case InfoLevel:
+			delegate.Info(message, keyvals...)
+		case WarnLevel:
+			delegate.Warn(message, keyvals...)
+		default:
+			delegate.Error(message, keyvals...)
+		}
+	}
+
+	return StructuredLoggerFunc(func(level Level, message string, keyvals []interface{}) {
+		ok, suppressed, reports := s.sample(level, message)
+		for _, report := range reports {
+			write(report.level, report.message, []interface{}{SuppressedKey, report.suppressed})
+		}
+
+		if ok {
+			if suppressed > 0 {
+				keyvals = append(keyvals[:len(keyvals):len(keyvals)], SuppressedKey, suppressed)
+			}
+
+			write(level, message, keyvals)
+		}
+	})
+}
+
+// SampleLogger decorates a printf-style Logger so that bursts of entries with identical format strings
+// are sampled.  Trace entries are sampled as debug entries.  Counts of suppressed entries are written
+// as separate entries following the next entry written.
+func SampleLogger(delegate Logger, o *SamplingOptions) Logger {
+	return &sampledLogger{NewSampler(o), delegate}
+}
+
+type sampledLogger struct {
+	sampler  *Sampler
+	delegate Logger
+}
+
+func (l *sampledLogger) log(level Level, write func(...interface{}), parameters []interface{}) {
+	var format string
+	if len(parameters) > 0 {
+		if format, _ = parameters[0].(string); len(format) == 0 {
+			format = fmt.Sprint(parameters[0])
+		}
+	}
+
+	ok, suppressed, reports := l.sampler.sample(level, format)
+	if ok {
+		write(parameters...)
+		if suppressed > 0 {
+			write("Suppressed %d identical log messages: %s", suppressed, format)
+		}
+	}
+
+	for _, report := range reports {
+		l.delegate.Info("Suppressed %d identical log messages: %s", report.suppressed, report.message)
+	}
+}
+
+func (l *sampledLogger) Trace(parameters ...interface{}) {
+	l.log(DebugLevel, l.delegate.Trace, parameters)
+}
+
+func (l *sampledLogger) Debug(parameters ...interface{}) {
+	l.log(DebugLevel, l.delegate.Debug, parameters)
+}
+
+func (l *sampledLogger) Info(parameters ...interface{}) {
+	l.log(InfoLevel, l.delegate.Info, parameters)
+}
+
+func (l *sampledLogger) Warn(parameters ...interface{}) {
+	l.log(WarnLevel, l.delegate.Warn, parameters)
+}
+
+func (l *sampledLogger) Error(parameters ...interface{}) {
+	l.log(ErrorLevel, l.delegate.Error, parameters)
+}
@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSamplingRule(t *testing.T) {
+	assert := assert.New(t)
+
+	var testData = []struct {
+		rule     SamplingRule
+		expected []bool
+	}{
+		{SamplingRule{First: 2, Thereafter: 3}, []bool{true, true, false, false, true, false, false, true}},
+		{SamplingRule{First: 1, Thereafter: -1}, []bool{true, false, false, false}},
+		{SamplingRule{First: 0, Thereafter: 2}, []bool{false, true, false, true}},
+		{SamplingRule{First: -1}, []bool{true, true, true, true}},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record.rule)
+		for index, expected := range record.expected {
+			assert.Equal(expected, record.rule.allows(index+1))
+		}
+	}
+}
+
+func TestSamplingOptions(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		defaults = SamplingRule{First: DefaultSamplingFirst, Thereafter: DefaultSamplingThereafter}
+	)
+
+	for _, o := range []*SamplingOptions{nil, new(SamplingOptions)} {
+		assert.Equal(DefaultSamplingInterval, o.interval())
+		assert.Equal(defaults, o.rule(InfoLevel, "test"))
+	}
+
+	o := SamplingOptions{
+		Interval: time.Minute,
+		Default:  SamplingRule{First: 5, Thereafter: 50},
+		Levels:   map[Level]SamplingRule{ErrorLevel: {First: -1}},
+		Messages: map[string]SamplingRule{"noisy": {First: 1, Thereafter: -1}},
+	}
+
+	assert.Equal(time.Minute, o.interval())
+	assert.Equal(o.Default, o.rule(InfoLevel, "test"))
+	assert.Equal(SamplingRule{First: -1}, o.rule(ErrorLevel, "test"))
+	assert.Equal(SamplingRule{First: 1, Thereafter: -1}, o.rule(ErrorLevel, "noisy"))
+}
+
+func TestSample(t *testing.T) {
+	var (
+		assert           = assert.New(t)
+		now              = time.Now()
+		recorder, output = testRecorder()
+		sampler          = NewSampler(&SamplingOptions{
+			Interval: time.Second,
+			Default:  SamplingRule{First: 2, Thereafter: -1},
+			Levels:   map[Level]SamplingRule{ErrorLevel: {First: -1}},
+		})
+
+		logger = sampler.Structured(recorder)
+	)
+
+	sampler.now = func() time.Time { return now }
+
+	for index := 0; index < 5; index++ {
+		logger.Info("noisy", "index", index)
+		logger.Error("important")
+	}
+
+	logger.Debug("quiet")
+	assert.Equal(uint64(3), sampler.Suppressed())
+
+	// the next interval reports the suppressed entries along with the first entry written
+	now = now.Add(time.Second)
+	logger.Info("noisy", "index", 5)
+
+	// after a burst passes, suppressed entries are reported on their own
+	for index := 0; index < 3; index++ {
+		logger.Warn("burst")
+	}
+
+	now = now.Add(2 * time.Second)
+	logger.Debug("quiet")
+
+	assert.Equal(uint64(4), sampler.Suppressed())
+	assert.Equal(
+		[]testLogEntry{
+			{InfoLevel, "noisy", []interface{}{"index", 0}},
+			{ErrorLevel, "important", nil},
+			{InfoLevel, "noisy", []interface{}{"index", 1}},
+			{ErrorLevel, "important", nil},
+			{ErrorLevel, "important", nil},
+			{ErrorLevel, "important", nil},
+			{ErrorLevel, "important", nil},
+			{DebugLevel, "quiet", nil},
+			{InfoLevel, "noisy", []interface{}{"index", 5, SuppressedKey, 3}},
+			{WarnLevel, "burst", nil},
+			{WarnLevel, "burst", nil},
+			{WarnLevel, "burst", []interface{}{SuppressedKey, 1}},
+			{DebugLevel, "quiet", nil},
+		},
+		*output,
+	)
+}
+
+func TestSampleLogger(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		output bytes.Buffer
+		logger = SampleLogger(&LoggerWriter{&output}, &SamplingOptions{Interval: time.Hour, Default: SamplingRule{First: 1, Thereafter: 2}})
+	)
+
+	for index := 0; index < 4; index++ {
+		logger.Debug("device %d", index)
+	}
+
+	logger.Trace("device %d", 4)
+	logger.Info(testStringer{"stringer"})
+	logger.Warn()
+	logger.Error("error")
+
+	assert.Equal(
+		debugLevel+"device 0\n"+
+			debugLevel+"device 2\n"+
+			debugLevel+"Suppressed 1 identical log messages: device %d\n"+
+			traceLevel+"device 4\n"+
+			traceLevel+"Suppressed 1 identical log messages: device %d\n"+
+			infoLevel+"stringer\n"+
+			warnLevel+"\n"+
+			errorLevel+"error\n",
+		output.String(),
+	)
+}
@@ -0,0 +1,285 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a structured log entry
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+const (
+	// TimeKey is the key under which a JSONLogger writes the time of each entry
+	TimeKey = "ts"
+
+	// LevelKey is the key under which structured loggers write the level of each entry
+	LevelKey = "level"
+
+	// MessageKey is the key under which structured loggers write the message of each entry
+	MessageKey = "msg"
+
+	// missingValue is logged in place of the value of a key which has none
+	missingValue = "(MISSING)"
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l >= DebugLevel && l <= ErrorLevel {
+		return levelNames[l]
+	}
+
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// ParseLevel returns the Level corresponding to a string, e.g. "warn".  This function is case-insensitive,
+// and accepts "warning" as well as "warn".
+func ParseLevel(value string) (Level, error) {
+	value = strings.ToLower(value)
+	for index, name := range levelNames {
+		if value == name {
+			return Level(index), nil
+		}
+	}
+
+	if value == "warning" {
+		return WarnLevel, nil
+	}
+
+	return DebugLevel, fmt.Errorf("Invalid log level: %s", value)
+}
+
+// StructuredLogger is a leveled logger whose entries consist of a constant message and alternating
+// key/value pairs, e.g. logger.Info("device connected", "id", id, "remoteAddr", remoteAddr).  Unlike
+// Logger, the output of a StructuredLogger can be parsed by machines.
+type StructuredLogger interface {
+	Debug(message string, keyvals ...interface{})
+	Info(message string, keyvals ...interface{})
+	Warn(message string, keyvals ...interface{})
+	Error(message string, keyvals ...interface{})
+}
+
+// LogFunc is a function that writes a single structured log entry at a given level.  Integrations
+// with other logging frameworks need only supply a LogFunc.
+type LogFunc func(level Level, message string, keyvals []interface{})
+
+// StructuredLoggerFunc produces a StructuredLogger which writes all entries through a LogFunc
+func StructuredLoggerFunc(f LogFunc) StructuredLogger {
+	return logFuncLogger(f)
+}
+
+type logFuncLogger LogFunc
+
+func (f logFuncLogger) Debug(message string, keyvals ...interface{}) { f(DebugLevel, message, keyvals) }
+func (f logFuncLogger) Info(message string, keyvals ...interface{})  { f(InfoLevel, message, keyvals) }
+func (f logFuncLogger) Warn(message string, keyvals ...interface{})  { f(WarnLevel, message, keyvals) }
+func (f logFuncLogger) Error(message string, keyvals ...interface{}) { f(ErrorLevel, message, keyvals) }
+
+// FilterLevel returns a StructuredLogger that discards entries below the given level
+func FilterLevel(delegate StructuredLogger, level Level) StructuredLogger {
+	return &levelFilter{delegate, level}
+}
+
+type levelFilter struct {
+	delegate StructuredLogger
+	level    Level
+}
+
+func (f *levelFilter) Debug(message string, keyvals ...interface{}) {
+	if f.level <= DebugLevel {
+		f.delegate.Debug(message, keyvals...)
+	}
+}
+
+func (f *levelFilter) Info(message string, keyvals ...interface{}) {
+	if f.level <= InfoLevel {
+		f.delegate.Info(message, keyvals...)
+	}
+}
+
+func (f *levelFilter) Warn(message string, keyvals ...interface{}) {
+	if f.level <= WarnLevel {
+		f.delegate.Warn(message, keyvals...)
+	}
+}
+
+func (f *levelFilter) Error(message string, keyvals ...interface{}) {
+	if f.level <= ErrorLevel {
+		f.delegate.Error(message, keyvals...)
+	}
+}
+
+// With returns a StructuredLogger that adds the given key/value pairs to every entry,
+// ahead of the entry's own pairs.  This is useful for tagging entries with a component or device ID.
+func With(delegate StructuredLogger, keyvals ...interface{}) StructuredLogger {
+	return StructuredLoggerFunc(func(level Level, message string, entryKeyvals []interface{}) {
+		combined := make([]interface{}, 0, len(keyvals)+len(entryKeyvals))
+		combined = append(combined, keyvals...)
+		combined = append(combined, entryKeyvals...)
+
+		switch level {
+		case DebugLevel:
+			delegate.Debug(message, combined...)
+		case InfoLevel:
+			delegate.Info(message, combined...)
+		case WarnLevel:
+			delegate.Warn(message, combined...)
+		default:
+			delegate.Error(message, combined...)
+		}
+	})
+}
+
+// keyString returns the string form of a key in a key/value list
+func keyString(key interface{}) string {
+	if s, ok := key.(string); ok {
+		return s
+	}
+
+	return fmt.Sprint(key)
+}
+
+// NewJSONLogger produces a StructuredLogger which writes each entry to the given io.Writer as a single
+// line of JSON, e.g. {"level":"info","msg":"device connected","id":"mac:112233445566","ts":"..."}.
+// Errors are written as their messages, and values which cannot be marshalled are written using fmt.
+// Writes are serialized, so the io.Writer need not be safe for concurrent use.
+func NewJSONLogger(output io.Writer) StructuredLogger {
+	var lock sync.Mutex
+
+	return StructuredLoggerFunc(func(level Level, message string, keyvals []interface{}) {
+		entry := make(map[string]interface{}, 3+len(keyvals)/2)
+		for index := 0; index < len(keyvals); index += 2 {
+			var value interface{} = missingValue
+			if index+1 < len(keyvals) {
+				value = jsonValue(keyvals[index+1])
+			}
+
+			entry[keyString(keyvals[index])] = value
+		}
+
+		entry[TimeKey] = time.Now().UTC().Format(time.RFC3339Nano)
+		entry[LevelKey] = level.String()
+		entry[MessageKey] = message
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			// this can only happen if jsonValue missed a case, so fall back to strings
+			for key, value := range entry {
+				entry[key] = fmt.Sprint(value)
+			}
+
+			data, _ = json.Marshal(entry)
+		}
+
+		lock.Lock()
+		output.Write(append(data, '\n'))
+		lock.Unlock()
+	})
+}
+
+// jsonValue converts a logged value into something that marshals sensibly.  Nil values, including
+// typed nil pointers whose methods may not be safe to call, are converted to a literal nil.
+func jsonValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case bool, string, json.Marshaler:
+		return v
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	if _, err := json.Marshal(value); err != nil {
+		return fmt.Sprintf("%+v", value)
+	}
+
+	return value
+}
+
+// Structured adapts a printf-style Logger onto StructuredLogger.  Each entry is written as
+// the message followed by its pairs in key=value form.  This allows code to move to StructuredLogger
+// before the rest of an application does.
+func Structured(logger Logger) StructuredLogger {
+	return StructuredLoggerFunc(func(level Level, message string, keyvals []interface{}) {
+		var buffer bytes.Buffer
+		buffer.WriteString(message)
+		for index := 0; index < len(keyvals); index += 2 {
+			var value interface{} = missingValue
+			if index+1 < len(keyvals) {
+				value = keyvals[index+1]
+			}
+
+			fmt.Fprintf(&buffer, " %s=%v", keyString(keyvals[index]), value)
+		}
+
+		// the buffer is passed as a parameter so that it is never treated as a format string
+		switch level {
+		case DebugLevel:
+			logger.Debug("%s", buffer.String())
+		case InfoLevel:
+			logger.Info("%s", buffer.String())
+		case WarnLevel:
+			logger.Warn("%s", buffer.String())
+		default:
+			logger.Error("%s", buffer.String())
+		}
+	})
+}
+
+// Printf adapts a StructuredLogger onto the printf-style Logger, so that existing code can write to
+// a structured destination.  Each formatted message becomes the message of an entry with no pairs.
+// Trace entries are written at the debug level.
+func Printf(logger StructuredLogger) Logger {
+	return printfAdapter{logger}
+}
+
+type printfAdapter struct {
+	logger StructuredLogger
+}
+
+// format renders printf-style parameters as LoggerWriter does
+func (p printfAdapter) format(parameters []interface{}) string {
+	if len(parameters) == 0 {
+		return ""
+	}
+
+	format, ok := parameters[0].(string)
+	if !ok {
+		format = fmt.Sprint(parameters[0])
+	}
+
+	return fmt.Sprintf(format, parameters[1:]...)
+}
+
+func (p printfAdapter) Trace(parameters ...interface{}) { p.logger.Debug(p.format(parameters)) }
+func (p printfAdapter) Debug(parameters ...interface{}) { p.logger.Debug(p.format(parameters)) }
+func (p printfAdapter) Info(parameters ...interface{})  { p.logger.Info(p.format(parameters)) }
+func (p printfAdapter) Warn(parameters ...interface{})  { p.logger.Warn(p.format(parameters)) }
+func (p printfAdapter) Error(parameters ...interface{}) { p.logger.Error(p.format(parameters)) }
+
+func (p printfAdapter) Printf(format string, parameters ...interface{}) {
+	p.logger.Info(fmt.Sprintf(format, parameters...))
+}
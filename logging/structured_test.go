@@ -0,0 +1,207 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevel(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, level := range []Level{DebugLevel, InfoLevel, WarnLevel, ErrorLevel} {
+		parsed, err := ParseLevel(strings.ToUpper(level.String()))
+		assert.Equal(level, parsed)
+		assert.NoError(err)
+	}
+
+	parsed, err := ParseLevel("Warning")
+	assert.Equal(WarnLevel, parsed)
+	assert.NoError(err)
+
+	_, err = ParseLevel("nosuch")
+	assert.Error(err)
+
+	assert.Equal("Level(99)", Level(99).String())
+}
+
+type testLogEntry struct {
+	level   Level
+	message string
+	keyvals []interface{}
+}
+
+func testRecorder() (StructuredLogger, *[]testLogEntry) {
+	entries := new([]testLogEntry)
+	return StructuredLoggerFunc(func(level Level, message string, keyvals []interface{}) {
+		*entries = append(*entries, testLogEntry{level, message, keyvals})
+	}), entries
+}
+
+func TestFilterLevel(t *testing.T) {
+	var (
+		assert           = assert.New(t)
+		recorder, output = testRecorder()
+		logger           = FilterLevel(recorder, WarnLevel)
+	)
+
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warn", "key", "value")
+	logger.Error("error")
+
+	assert.Equal(
+		[]testLogEntry{
+			{WarnLevel, "warn", []interface{}{"key", "value"}},
+			{ErrorLevel, "error", nil},
+		},
+		*output,
+	)
+}
+
+func TestWith(t *testing.T) {
+	var (
+		assert           = assert.New(t)
+		recorder, output = testRecorder()
+		logger           = With(recorder, "component", "test")
+	)
+
+	logger.Debug("debug", "id", 1)
+	logger.Info("info")
+	logger.Warn("warn")
+	logger.Error("error")
+
+	assert.Equal(
+		[]testLogEntry{
+			{DebugLevel, "debug", []interface{}{"component", "test", "id", 1}},
+			{InfoLevel, "info", []interface{}{"component", "test"}},
+			{WarnLevel, "warn", []interface{}{"component", "test"}},
+			{ErrorLevel, "error", []interface{}{"component", "test"}},
+		},
+		*output,
+	)
+}
+
+func TestJSONLogger(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		output  bytes.Buffer
+		logger  = NewJSONLogger(&output)
+	)
+
+	logger.Warn(
+		"test message",
+		"id", "mac:112233445566",
+		"count", 12,
+		"error", errors.New("expected"),
+		"timeout", 5*time.Second,
+		"channel", make(chan int),
+		7, "dangling",
+	)
+
+	require.True(strings.HasSuffix(output.String(), "}\n"))
+
+	var entry map[string]interface{}
+	require.NoError(json.Unmarshal(output.Bytes(), &entry))
+
+	_, err := time.Parse(time.RFC3339Nano, entry[TimeKey].(string))
+	assert.NoError(err)
+	delete(entry, TimeKey)
+
+	assert.Contains(entry["channel"], "0x")
+	delete(entry, "channel")
+
+	assert.Equal(
+		map[string]interface{}{
+			LevelKey:   "warn",
+			MessageKey: "test message",
+			"id":       "mac:112233445566",
+			"count":    12.0,
+			"error":    "expected",
+			"timeout":  "5s",
+			"7":        "dangling",
+		},
+		entry,
+	)
+
+	output.Reset()
+	logger.Info("missing", "key")
+	require.NoError(json.Unmarshal(output.Bytes(), &entry))
+	assert.Equal(missingValue, entry["key"])
+
+	// a typed nil is logged as null rather than having its methods invoked
+	var nilError *testNilError
+	output.Reset()
+	entry = nil
+	logger.Info("typed nil", "error", nilError, "value", nil)
+	require.NoError(json.Unmarshal(output.Bytes(), &entry))
+	assert.Contains(entry, "error")
+	assert.Nil(entry["error"])
+	assert.Contains(entry, "value")
+	assert.Nil(entry["value"])
+}
+
+// testNilError is an error whose Error method cannot be invoked on a nil pointer
+type testNilError struct {
+	message string
+}
+
+func (e *testNilError) Error() string {
+	return e.message
+}
+
+func TestStructured(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		output bytes.Buffer
+		logger = Structured(&LoggerWriter{&output})
+	)
+
+	logger.Debug("debug", "key", "value")
+	logger.Info("info with %d", "count", 3)
+	logger.Warn("warn", "key")
+	logger.Error("error")
+
+	assert.Equal(
+		debugLevel+"debug key=value\n"+
+			infoLevel+"info with %d count=3\n"+
+			warnLevel+"warn key=(MISSING)\n"+
+			errorLevel+"error\n",
+		output.String(),
+	)
+}
+
+func TestPrintf(t *testing.T) {
+	var (
+		assert           = assert.New(t)
+		recorder, output = testRecorder()
+		logger           = Printf(recorder)
+	)
+
+	logger.Trace("trace %d", 1)
+	logger.Debug("debug %s", "two")
+	logger.Info(testStringer{"info"})
+	logger.Warn()
+	logger.Error("error")
+	logger.(interface {
+		Printf(string, ...interface{})
+	}).Printf("printf %d", 5)
+
+	assert.Equal(
+		[]testLogEntry{
+			{DebugLevel, "trace 1", nil},
+			{DebugLevel, "debug two", nil},
+			{InfoLevel, "info", nil},
+			{WarnLevel, "", nil},
+			{ErrorLevel, "error", nil},
+			{InfoLevel, "printf 5", nil},
+		},
+		*output,
+	)
+}
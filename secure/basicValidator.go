@@ -0,0 +1,46 @@
+package secure
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+)
+
+// BasicValidator verifies Basic tokens against hashed credentials held in a CredentialStore.
+// Unlike ExactMatchValidator, no plaintext credentials need to appear in configuration.
+//
+// A token is valid if its principal exists in the store, its password matches the stored hash,
+// and the principal is allowed to use the request's method.  Tokens of any other type, and Basic
+// tokens that cannot be decoded, are rejected.  Malformed or unsupported stored hashes produce
+// validation errors, as they indicate a configuration problem.
+type BasicValidator struct {
+	// Store supplies the credentials of principals.  This field is required.
+	Store CredentialStore
+}
+
+func (v *BasicValidator) Validate(ctx context.Context, token *Token) (bool, error) {
+	if token.Type() != Basic {
+		return false, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(token.Value())
+	if err != nil {
+		return false, nil
+	}
+
+	separator := bytes.IndexByte(decoded, ':')
+	if separator < 0 {
+		return false, nil
+	}
+
+	credential, ok := v.Store.Credential(string(decoded[:separator]))
+	if !ok {
+		return false, nil
+	}
+
+	if valid, err := credential.Verify(decoded[separator+1:]); !valid || err != nil {
+		return false, err
+	}
+
+	return credential.Allows(RequestMethod(ctx)), nil
+}
@@ -0,0 +1,51 @@
+package secure
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func basicToken(value string) *Token {
+	return &Token{tokenType: Basic, value: base64.StdEncoding.EncodeToString([]byte(value))}
+}
+
+func TestBasicValidator(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		validator = &BasicValidator{
+			Store: CredentialMap{
+				"joe":    Credential{Hash: bcryptHash(t, "secret")},
+				"reader": Credential{Hash: argon2Hash("argon2id", "p:ssword"), Methods: []string{"GET"}},
+				"broken": Credential{Hash: "plaintext"},
+			},
+		}
+	)
+
+	var testData = []struct {
+		token         *Token
+		method        string
+		expectedValid bool
+		expectError   bool
+	}{
+		{basicToken("joe:secret"), "GET", true, false},
+		{basicToken("joe:secret"), "POST", true, false},
+		{basicToken("joe:wrong"), "GET", false, false},
+		{basicToken("joe"), "GET", false, false},
+		{basicToken("nosuch:secret"), "GET", false, false},
+		{basicToken("reader:p:ssword"), "GET", true, false},
+		{basicToken("reader:p:ssword"), "PUT", false, false},
+		{basicToken("broken:plaintext"), "GET", false, true},
+		{&Token{tokenType: Basic, value: "not base64!"}, "GET", false, false},
+		{&Token{tokenType: Bearer, value: base64.StdEncoding.EncodeToString([]byte("joe:secret"))}, "GET", false, false},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		ctx := context.WithValue(context.Background(), "method", record.method)
+		valid, err := validator.Validate(ctx, record.token)
+		assert.Equal(record.expectedValid, valid)
+		assert.Equal(record.expectError, err != nil)
+	}
+}
@@ -0,0 +1,115 @@
+package secure
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"github.com/Comcast/webpa-common/health"
+	"github.com/Comcast/webpa-common/logging"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBreakGlassWindow is the default length of time a break-glass token remains
+	// usable after it is first presented
+	DefaultBreakGlassWindow = 1 * time.Hour
+
+	// BreakGlassTokenUses is the health statistic incremented each time a break-glass token is accepted
+	BreakGlassTokenUses health.Stat = "BreakGlassTokenUses"
+)
+
+var (
+	ErrorInvalidBreakGlassHash = errors.New("Break-glass hash must be a hex-encoded SHA-256 hash")
+)
+
+// BreakGlassValidator accepts a single, statically configured emergency credential.  It is
+// intended for use during an outage of the remote identity infrastructure, e.g. as the last member
+// of a Validators chain behind a JWSValidator.
+//
+// The credential is only accepted as a Bearer token.  Only the SHA-256 hash of the credential is
+// configured, so the credential itself never appears in configuration.  The first time the credential
+// is presented, the validator activates and the credential remains usable for the configured window.
+// After the window elapses, the credential is rejected until the process is restarted with new
+// configuration.
+//
+// Every presentation of the credential is logged at the error level, and every accepted use increments
+// the BreakGlassTokenUses statistic.
+type BreakGlassValidator struct {
+	hash    []byte
+	window  time.Duration
+	logger  logging.Logger
+	monitor health.Monitor
+	now     func() time.Time
+
+	lock      sync.Mutex
+	activated time.Time
+}
+
+// NewBreakGlassValidator creates a BreakGlassValidator for the given hex-encoded SHA-256 hash
+// of the credential's value.  If window is nonpositive, DefaultBreakGlassWindow is used.  If logger
+// is nil, logging.DefaultLogger() is used.  The monitor is optional.
+func NewBreakGlassValidator(hash string, window time.Duration, logger logging.Logger, monitor health.Monitor) (*BreakGlassValidator, error) {
+	decoded, err := hex.DecodeString(hash)
+	if err != nil || len(decoded) != sha256.Size {
+		return nil, ErrorInvalidBreakGlassHash
+	}
+
+	if window <= 0 {
+		window = DefaultBreakGlassWindow
+	}
+
+	if logger == nil {
+		logger = logging.DefaultLogger()
+	}
+
+	return &BreakGlassValidator{
+		hash:    decoded,
+		window:  window,
+		logger:  logger,
+		monitor: monitor,
+		now:     time.Now,
+	}, nil
+}
+
+func (v *BreakGlassValidator) Validate(ctx context.Context, token *Token) (bool, error) {
+	if token.Type() != Bearer {
+		return false, nil
+	}
+
+	actual := sha256.Sum256(token.Bytes())
+	if subtle.ConstantTimeCompare(actual[:], v.hash) != 1 {
+		return false, nil
+	}
+
+	var (
+		method, path = RequestMethod(ctx), RequestPath(ctx)
+		remoteAddr   = RequestRemoteAddr(ctx)
+		requestID    = RequestID(ctx)
+	)
+
+	now := v.now()
+
+	v.lock.Lock()
+	if v.activated.IsZero() {
+		v.activated = now
+		v.logger.Error("BREAK-GLASS TOKEN ACTIVATED, expires at %s", now.Add(v.window).Format(time.RFC3339))
+	}
+
+	expired := now.Sub(v.activated) > v.window
+	v.lock.Unlock()
+
+	if expired {
+		v.logger.Error("BREAK-GLASS TOKEN REJECTED (expired): method=%s, path=%s, remoteAddr=%s, requestID=%s", method, path, remoteAddr, requestID)
+		return false, nil
+	}
+
+	v.logger.Error("BREAK-GLASS TOKEN USED: method=%s, path=%s, remoteAddr=%s, requestID=%s", method, path, remoteAddr, requestID)
+	if v.monitor != nil {
+		v.monitor.SendEvent(health.Inc(BreakGlassTokenUses, 1))
+	}
+
+	return true, nil
+}
@@ -0,0 +1,100 @@
+package secure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/Comcast/webpa-common/health"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+const breakGlassValue = "break glass in case of emergency"
+
+func breakGlassHash(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+func matchBreakGlassUse() interface{} {
+	return mock.MatchedBy(
+		func(healthFunc health.HealthFunc) bool {
+			stats := make(health.Stats, 1)
+			healthFunc(stats)
+
+			return len(stats) == 1 && stats[BreakGlassTokenUses] == 1
+		},
+	)
+}
+
+func TestNewBreakGlassValidatorInvalidHash(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, hash := range []string{"", "not hex", "deadbeef"} {
+		t.Logf("%s", hash)
+		validator, err := NewBreakGlassValidator(hash, 0, nil, nil)
+		assert.Nil(validator)
+		assert.Equal(ErrorInvalidBreakGlassHash, err)
+	}
+}
+
+func TestNewBreakGlassValidatorDefaults(t *testing.T) {
+	assert := assert.New(t)
+	validator, err := NewBreakGlassValidator(breakGlassHash(breakGlassValue), 0, nil, nil)
+	require.NotNil(t, validator)
+	assert.NoError(err)
+	assert.Equal(DefaultBreakGlassWindow, validator.window)
+	assert.NotNil(validator.logger)
+	assert.Nil(validator.monitor)
+
+	valid, err := validator.Validate(context.Background(), &Token{tokenType: Bearer, value: breakGlassValue})
+	assert.True(valid)
+	assert.NoError(err)
+}
+
+func TestBreakGlassValidator(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		monitor = &mockMonitor{}
+		current = time.Now()
+		ctx     = context.WithValue(context.WithValue(context.Background(), "method", "GET"), "path", "/api/v2/device")
+	)
+
+	validator, err := NewBreakGlassValidator(breakGlassHash(breakGlassValue), time.Minute, logging.TestLogger(t), monitor)
+	require.NotNil(t, validator)
+	require.NoError(t, err)
+	validator.now = func() time.Time { return current }
+
+	// other credentials are simply not recognized
+	valid, err := validator.Validate(ctx, &Token{tokenType: Bearer, value: "some other token"})
+	assert.False(valid)
+	assert.NoError(err)
+	assert.True(validator.activated.IsZero())
+
+	monitor.On("SendEvent", matchBreakGlassUse()).Twice()
+	valid, err = validator.Validate(ctx, &Token{tokenType: Bearer, value: breakGlassValue})
+	assert.True(valid)
+	assert.NoError(err)
+	assert.Equal(current, validator.activated)
+
+	// the credential is not accepted under any other scheme
+	valid, err = validator.Validate(ctx, &Token{tokenType: Basic, value: breakGlassValue})
+	assert.False(valid)
+	assert.NoError(err)
+
+	current = current.Add(time.Minute)
+	valid, err = validator.Validate(ctx, &Token{tokenType: Bearer, value: breakGlassValue})
+	assert.True(valid)
+	assert.NoError(err)
+
+	current = current.Add(time.Second)
+	valid, err = validator.Validate(ctx, &Token{tokenType: Bearer, value: breakGlassValue})
+	assert.False(valid)
+	assert.NoError(err)
+
+	monitor.AssertExpectations(t)
+}
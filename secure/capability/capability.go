@@ -0,0 +1,77 @@
+package capability
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Prefix is the leading portion of all WebPA capabilities
+	Prefix = "x1:webpa"
+
+	// AllMethods is the method value which matches any HTTP method
+	AllMethods = "all"
+)
+
+var (
+	ErrorInvalidPrefix = errors.New("Capability does not start with " + Prefix)
+	ErrorInvalidFormat = errors.New("Capability must have the format " + Prefix + ":<api>:<resource>:<method>")
+)
+
+// Capability is a parsed WebPA capability string, suitable for matching against requests
+type Capability struct {
+	value   string
+	method  string
+	pattern *regexp.Regexp
+}
+
+// Parse parses a single capability string.  The resource portion may itself contain colons,
+// since the method is always the last colon-delimited field.
+func Parse(value string) (*Capability, error) {
+	if !strings.HasPrefix(value, Prefix+":") {
+		return nil, ErrorInvalidPrefix
+	}
+
+	pieces := strings.Split(value[len(Prefix)+1:], ":")
+	if len(pieces) < 3 {
+		return nil, ErrorInvalidFormat
+	}
+
+	var (
+		api      = pieces[0]
+		resource = strings.Join(pieces[1:len(pieces)-1], ":")
+		method   = pieces[len(pieces)-1]
+	)
+
+	if len(api) == 0 || len(resource) == 0 || len(method) == 0 {
+		return nil, ErrorInvalidFormat
+	}
+
+	pattern, err := regexp.Compile(fmt.Sprintf("^/%s/[^/]+/%s", api, resource))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Capability{
+		value:   value,
+		method:  method,
+		pattern: pattern,
+	}, nil
+}
+
+// String returns the original capability string
+func (c *Capability) String() string {
+	return c.value
+}
+
+// Match tests if this capability allows the given HTTP method and URL path.  Methods
+// are compared case-insensitively.
+func (c *Capability) Match(method, path string) bool {
+	if c.method != AllMethods && !strings.EqualFold(c.method, method) {
+		return false
+	}
+
+	return c.pattern.MatchString(path)
+}
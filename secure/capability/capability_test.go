@@ -0,0 +1,69 @@
+package capability
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	var testData = []struct {
+		value         string
+		expectedError error
+	}{
+		{"", ErrorInvalidPrefix},
+		{"x1:webpa", ErrorInvalidPrefix},
+		{"x2:webpa:api:.*:all", ErrorInvalidPrefix},
+		{"x1:webpa:api", ErrorInvalidFormat},
+		{"x1:webpa:api:.*", ErrorInvalidFormat},
+		{"x1:webpa::.*:all", ErrorInvalidFormat},
+		{"x1:webpa:api::all", ErrorInvalidFormat},
+		{"x1:webpa:api:.*:", ErrorInvalidFormat},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		capability, err := Parse(record.value)
+		assert.Nil(capability)
+		assert.Equal(record.expectedError, err)
+	}
+
+	capability, err := Parse("x1:webpa:api:(:all")
+	assert.Nil(capability)
+	assert.Error(err)
+}
+
+func TestCapabilityMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	var testData = []struct {
+		value    string
+		method   string
+		path     string
+		expected bool
+	}{
+		{"x1:webpa:api:.*:all", "GET", "/api/v2/device", true},
+		{"x1:webpa:api:.*:all", "DELETE", "/api/v2/hook", true},
+		{"x1:webpa:api:.*:all", "GET", "/other/v2/device", false},
+		{"x1:webpa:api:.*:post", "POST", "/api/v2/device", true},
+		{"x1:webpa:api:.*:post", "post", "/api/v2/device", true},
+		{"x1:webpa:api:.*:post", "GET", "/api/v2/device", false},
+		{"x1:webpa:api:device/.*/config:get", "GET", "/api/v2/device/mac:112233445566/config", true},
+		{"x1:webpa:api:device/.*/config:get", "GET", "/api/v2/device/mac:112233445566/stat", false},
+		{"x1:webpa:api:device/mac:112233445566/stat:get", "GET", "/api/v2/device/mac:112233445566/stat", true},
+		{"x1:webpa:api:hook:post", "POST", "/api/v2/hook", true},
+		{"x1:webpa:api:hook:post", "POST", "/prefix/api/v2/hook", false},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		capability, err := Parse(record.value)
+		require.NotNil(t, capability)
+		require.NoError(t, err)
+
+		assert.Equal(record.value, capability.String())
+		assert.Equal(record.expected, capability.Match(record.method, record.path))
+	}
+}
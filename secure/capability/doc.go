@@ -0,0 +1,16 @@
+/*
+Package capability implements authorization based on the WebPA capabilities claim.
+
+A capability is a colon-delimited string of the form:
+
+	x1:webpa:<api>:<resource>:<method>
+
+where <resource> is a regular expression matched against the request path following
+the API version, and <method> is either an HTTP method or "all".  For example,
+"x1:webpa:api:device/[^/]+/config:get" allows GET requests to paths like /api/v2/device/mac:112233445566/config.
+
+A Policy holds centrally managed route rules, each of which names the capabilities required for the
+routes it matches.  A RemotePolicy fetches its policy from a URL, revalidating it with ETags and falling
+back to a local cache file when the URL is unavailable at startup.
+*/
+package capability
@@ -0,0 +1,139 @@
+package capability
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrorRuleNoPath         = errors.New("Policy rules must have a path")
+	ErrorRuleNoCapabilities = errors.New("Policy rules must list at least one capability")
+)
+
+// Rule is the external representation of a single policy rule.  A rule applies to requests whose method
+// and path match, and allows such a request only if the token carries at least one of the rule's capabilities.
+type Rule struct {
+	// Method is the HTTP method this rule applies to, or AllMethods.  If not supplied, AllMethods is assumed.
+	Method string `json:"method,omitempty"`
+
+	// Path is a regular expression matched against the full request path, e.g. "^/api/v2/device/[^/]+/config"
+	Path string `json:"path"`
+
+	// Capabilities lists the capabilities, any one of which allows requests matching this rule.
+	// Capabilities are compared with the token's claim exactly, rather than being matched against the request.
+	Capabilities []string `json:"capabilities"`
+}
+
+// PolicyDocument is the external, usually JSON, representation of a Policy
+type PolicyDocument struct {
+	// Rules are evaluated in order, and the first matching rule decides whether a request is allowed
+	Rules []Rule `json:"rules"`
+}
+
+// rule is a compiled Rule
+type rule struct {
+	method       string
+	path         *regexp.Regexp
+	capabilities map[string]bool
+}
+
+// Policy is a compiled, immutable set of route rules which is consulted before a token's capabilities
+// are matched against a request.  This allows the capabilities required by routes to be managed centrally.
+type Policy struct {
+	rules []rule
+}
+
+// NewPolicy compiles a PolicyDocument
+func NewPolicy(document PolicyDocument) (*Policy, error) {
+	p := &Policy{
+		rules: make([]rule, 0, len(document.Rules)),
+	}
+
+	for i, r := range document.Rules {
+		if len(r.Path) == 0 {
+			return nil, fmt.Errorf("Rule %d: %s", i, ErrorRuleNoPath)
+		}
+
+		if len(r.Capabilities) == 0 {
+			return nil, fmt.Errorf("Rule %d: %s", i, ErrorRuleNoCapabilities)
+		}
+
+		path, err := regexp.Compile(r.Path)
+		if err != nil {
+			return nil, fmt.Errorf("Rule %d: %s", i, err)
+		}
+
+		compiled := rule{
+			method:       r.Method,
+			path:         path,
+			capabilities: make(map[string]bool, len(r.Capabilities)),
+		}
+
+		if len(compiled.method) == 0 {
+			compiled.method = AllMethods
+		}
+
+		for _, capability := range r.Capabilities {
+			compiled.capabilities[capability] = true
+		}
+
+		p.rules = append(p.rules, compiled)
+	}
+
+	return p, nil
+}
+
+// ParsePolicy compiles the JSON representation of a PolicyDocument
+func ParsePolicy(data []byte) (*Policy, error) {
+	var document PolicyDocument
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	return NewPolicy(document)
+}
+
+// Len returns the number of rules in this policy
+func (p *Policy) Len() int {
+	return len(p.rules)
+}
+
+// Allow evaluates this policy for a request.  If no rule matches the request, matched is false and the
+// policy makes no decision.  Otherwise, allowed reports whether the given Set holds one of the capabilities
+// required by the first matching rule.
+func (p *Policy) Allow(method, path string, held Set) (allowed, matched bool) {
+	for _, r := range p.rules {
+		if r.method != AllMethods && !strings.EqualFold(r.method, method) {
+			continue
+		}
+
+		if !r.path.MatchString(path) {
+			continue
+		}
+
+		for _, capability := range held {
+			if r.capabilities[capability.String()] {
+				return true, true
+			}
+		}
+
+		return false, true
+	}
+
+	return false, false
+}
+
+// PolicySource supplies the current Policy.  A nil Policy means that no policy is in effect.
+type PolicySource interface {
+	Policy() *Policy
+}
+
+// PolicySourceFunc is a function type that implements PolicySource
+type PolicySourceFunc func() *Policy
+
+func (f PolicySourceFunc) Policy() *Policy {
+	return f()
+}
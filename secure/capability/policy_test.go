@@ -0,0 +1,76 @@
+package capability
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewPolicyInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, document := range []PolicyDocument{
+		{Rules: []Rule{{Capabilities: []string{"x1:webpa:api:.*:all"}}}},
+		{Rules: []Rule{{Path: "^/api"}}},
+		{Rules: []Rule{{Path: "(", Capabilities: []string{"x1:webpa:api:.*:all"}}}},
+	} {
+		policy, err := NewPolicy(document)
+		assert.Nil(policy)
+		assert.Error(err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	policy, err := ParsePolicy([]byte(`this is not JSON`))
+	assert.Nil(policy)
+	assert.Error(err)
+
+	policy, err = ParsePolicy([]byte(`{"rules": [
+		{"method": "post", "path": "^/api/v2/hook", "capabilities": ["x1:webpa:api:hook:post", "x1:webpa:api:hook:all"]},
+		{"path": "^/api/v2/device", "capabilities": ["x1:webpa:api:device:all"]}
+	]}`))
+
+	require.NoError(err)
+	require.NotNil(policy)
+	assert.Equal(2, policy.Len())
+
+	hookPost, err := ParseSet("x1:webpa:api:hook:post")
+	require.NoError(err)
+	deviceAll, err := ParseSet("x1:webpa:api:device:all")
+	require.NoError(err)
+
+	var testData = []struct {
+		method          string
+		path            string
+		held            Set
+		expectedAllowed bool
+		expectedMatched bool
+	}{
+		{"POST", "/api/v2/hook", hookPost, true, true},
+		{"POST", "/api/v2/hook", deviceAll, false, true},
+		{"GET", "/api/v2/device/mac:112233445566/stat", deviceAll, true, true},
+		{"GET", "/api/v2/device/mac:112233445566/stat", nil, false, true},
+
+		// the first rule only applies to POST
+		{"GET", "/api/v2/hook", hookPost, false, false},
+		{"GET", "/api/v2/hooks", deviceAll, false, false},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		allowed, matched := policy.Allow(record.method, record.path, record.held)
+		assert.Equal(record.expectedAllowed, allowed)
+		assert.Equal(record.expectedMatched, matched)
+	}
+}
+
+func TestPolicySourceFunc(t *testing.T) {
+	policy, err := NewPolicy(PolicyDocument{})
+	require.NoError(t, err)
+	assert.True(t, policy == PolicySourceFunc(func() *Policy { return policy }).Policy())
+}
@@ -0,0 +1,302 @@
+package capability
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/types"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultPolicyInterval is the default time between revalidations of a remote policy
+	DefaultPolicyInterval time.Duration = 5 * time.Minute
+
+	// DefaultMaxPolicySize is the default limit, in bytes, on the size of a remote policy document
+	DefaultMaxPolicySize int64 = 1024 * 1024
+)
+
+var (
+	ErrorNoPolicyURL = errors.New("A policy URL is required")
+)
+
+// PolicyListener is notified each time a RemotePolicy swaps in a changed policy.  The previous
+// policy is nil when the first policy is loaded.  Listeners are invoked synchronously and must not block.
+type PolicyListener func(previous, current *Policy)
+
+// PolicyOptions configures a RemotePolicy
+type PolicyOptions struct {
+	// URL is the location of the JSON PolicyDocument.  This field is required.
+	URL string `json:"url"`
+
+	// Header supplies any HTTP headers to send when fetching the policy
+	Header http.Header `json:"header"`
+
+	// CacheFile is the optional local file holding the last policy fetched.  If the remote policy
+	// cannot be fetched at startup, the policy in this file is used instead.
+	CacheFile string `json:"cacheFile"`
+
+	// Interval is how often the remote policy is revalidated.  If not supplied, DefaultPolicyInterval is used.
+	Interval types.Duration `json:"interval"`
+
+	// MaxPolicySize is the largest policy document, in bytes, which will be read.  If not supplied,
+	// DefaultMaxPolicySize is used.
+	MaxPolicySize int64 `json:"maxPolicySize"`
+
+	// Client is the HTTP client used to fetch the policy.  If not supplied, http.DefaultClient is used.
+	Client *http.Client `json:"-"`
+
+	// Logger is used to report fetch and cache failures.  If not supplied, logging.DefaultLogger() is used.
+	Logger logging.Logger `json:"-"`
+
+	// Listeners are notified whenever the policy changes
+	Listeners []PolicyListener `json:"-"`
+
+	// Tick is an optional function that produces a channel for time ticks.
+	// Test code can set this field to something that returns a channel under the control of the test.
+	// If not supplied, a time.Ticker is used, which is stopped when the RemotePolicy shuts down.
+	Tick func(time.Duration) <-chan time.Time `json:"-"`
+}
+
+func (o *PolicyOptions) interval() time.Duration {
+	if o != nil && o.Interval > 0 {
+		return time.Duration(o.Interval)
+	}
+
+	return DefaultPolicyInterval
+}
+
+func (o *PolicyOptions) maxPolicySize() int64 {
+	if o != nil && o.MaxPolicySize > 0 {
+		return o.MaxPolicySize
+	}
+
+	return DefaultMaxPolicySize
+}
+
+func (o *PolicyOptions) client() *http.Client {
+	if o != nil && o.Client != nil {
+		return o.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (o *PolicyOptions) logger() logging.Logger {
+	if o != nil && o.Logger != nil {
+		return o.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+// ticker returns the channel of ticks for the given interval, along with a function that stops those ticks
+func (o *PolicyOptions) ticker(interval time.Duration) (<-chan time.Time, func()) {
+	if o != nil && o.Tick != nil {
+		return o.Tick(interval), func() {}
+	}
+
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
+
+// policyCache is the format of a RemotePolicy's cache file
+type policyCache struct {
+	ETag   string          `json:"etag"`
+	Policy json.RawMessage `json:"policy"`
+}
+
+// RemotePolicy is a PolicySource which fetches its Policy from a remote URL.  The policy is revalidated
+// periodically using the ETag of the last response, so that an unchanged policy is neither transferred nor
+// recompiled.  A changed policy is compiled and then atomically swapped in, so requests always see a complete
+// policy.  If a fetch fails, the current policy remains in effect.
+type RemotePolicy struct {
+	options *PolicyOptions
+	current atomic.Value
+
+	updateLock sync.Mutex
+	etag       string
+}
+
+// NewRemotePolicy creates a RemotePolicy and loads its initial policy.  If the remote policy cannot be
+// fetched, the policy in the configured CacheFile is used.  If neither is available, the fetch error is returned.
+func NewRemotePolicy(o *PolicyOptions) (*RemotePolicy, error) {
+	if o == nil || len(o.URL) == 0 {
+		return nil, ErrorNoPolicyURL
+	}
+
+	rp := &RemotePolicy{options: o}
+	if err := rp.Update(); err != nil {
+		logger := o.logger()
+		logger.Error("Unable to fetch policy from %s: %s", o.URL, err)
+		if len(o.CacheFile) == 0 {
+			return nil, err
+		}
+
+		if cacheErr := rp.loadCache(); cacheErr != nil {
+			logger.Error("Unable to load cached policy from %s: %s", o.CacheFile, cacheErr)
+			return nil, err
+		}
+
+		logger.Info("Using cached policy from %s", o.CacheFile)
+	}
+
+	return rp, nil
+}
+
+// Policy returns the current policy
+func (rp *RemotePolicy) Policy() *Policy {
+	p, _ := rp.current.Load().(*Policy)
+	return p
+}
+
+// Update revalidates the policy against the remote URL, swapping in the remote policy if it has changed.
+// If the remote policy cannot be fetched or compiled, the current policy is left in place.
+func (rp *RemotePolicy) Update() error {
+	rp.updateLock.Lock()
+	defer rp.updateLock.Unlock()
+
+	request, err := http.NewRequest(http.MethodGet, rp.options.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	for name, values := range rp.options.Header {
+		for _, value := range values {
+			request.Header.Add(name, value)
+		}
+	}
+
+	if len(rp.etag) > 0 {
+		request.Header.Set("If-None-Match", rp.etag)
+	}
+
+	response, err := rp.options.client().Do(request)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusNotModified:
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("Unexpected policy response status: %d", response.StatusCode)
+	}
+
+	// there is no ResponseWriter to notify, as this is a response body read by a client
+	data, err := ioutil.ReadAll(http.MaxBytesReader(nil, response.Body, rp.options.maxPolicySize()))
+	if err != nil {
+		return err
+	}
+
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return err
+	}
+
+	rp.etag = response.Header.Get("ETag")
+	rp.swap(policy)
+
+	if len(rp.options.CacheFile) > 0 {
+		if err := rp.saveCache(data); err != nil {
+			rp.options.logger().Error("Unable to cache policy to %s: %s", rp.options.CacheFile, err)
+		}
+	}
+
+	return nil
+}
+
+// Run revalidates the policy at the configured interval until shutdown is closed.  This method
+// implements concurrent.Runnable.
+func (rp *RemotePolicy) Run(waitGroup *sync.WaitGroup, shutdown <-chan struct{}) error {
+	ticks, stop := rp.options.ticker(rp.options.interval())
+
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		defer stop()
+
+		for {
+			select {
+			case <-shutdown:
+				return
+			case <-ticks:
+				if err := rp.Update(); err != nil {
+					rp.options.logger().Error("Unable to update policy from %s: %s", rp.options.URL, err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// swap installs a new policy and notifies listeners
+func (rp *RemotePolicy) swap(policy *Policy) {
+	previous := rp.Policy()
+	rp.current.Store(policy)
+	for _, listener := range rp.options.Listeners {
+		listener(previous, policy)
+	}
+}
+
+// loadCache installs the policy held in the cache file
+func (rp *RemotePolicy) loadCache() error {
+	data, err := ioutil.ReadFile(rp.options.CacheFile)
+	if err != nil {
+		return err
+	}
+
+	var cached policyCache
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return err
+	}
+
+	policy, err := ParsePolicy(cached.Policy)
+	if err != nil {
+		return err
+	}
+
+	rp.updateLock.Lock()
+	defer rp.updateLock.Unlock()
+
+	rp.etag = cached.ETag
+	rp.swap(policy)
+	return nil
+}
+
+// saveCache writes the given policy document to the cache file.  The file is replaced atomically, so
+// a failure part way through never corrupts the previously cached policy.
+func (rp *RemotePolicy) saveCache(document []byte) error {
+	data, err := json.Marshal(policyCache{ETag: rp.etag, Policy: document})
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(rp.options.CacheFile), filepath.Base(rp.options.CacheFile))
+	if err != nil {
+		return err
+	}
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	return os.Rename(temp.Name(), rp.options.CacheFile)
+}
@@ -0,0 +1,281 @@
+package capability
+
+import (
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testLogger = &logging.LoggerWriter{Writer: ioutil.Discard}
+
+// policyServer is a scriptable policy endpoint which supports ETag revalidation
+type policyServer struct {
+	lock        sync.Mutex
+	document    string
+	etag        string
+	status      int
+	requests    int
+	notModified int
+}
+
+func (s *policyServer) set(document, etag string) {
+	s.lock.Lock()
+	s.document, s.etag = document, etag
+	s.lock.Unlock()
+}
+
+func (s *policyServer) fail(status int) {
+	s.lock.Lock()
+	s.status = status
+	s.lock.Unlock()
+}
+
+func (s *policyServer) counts() (requests, notModified int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests, s.notModified
+}
+
+func (s *policyServer) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requests++
+	if s.status != 0 {
+		response.WriteHeader(s.status)
+		return
+	}
+
+	if len(s.etag) > 0 && request.Header.Get("If-None-Match") == s.etag {
+		s.notModified++
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	response.Header().Set("ETag", s.etag)
+	response.Write([]byte(s.document))
+}
+
+const (
+	testPolicy1 = `{"rules": [{"path": "^/api/v2/hook", "capabilities": ["x1:webpa:api:hook:all"]}]}`
+	testPolicy2 = `{"rules": [{"path": "^/api/v2/hook", "capabilities": ["x1:webpa:api:hook:all"]}, {"path": "^/api/v2/device", "capabilities": ["x1:webpa:api:device:all"]}]}`
+)
+
+func TestPolicyOptionsDefaults(t *testing.T) {
+	assert := assert.New(t)
+	for _, o := range []*PolicyOptions{nil, new(PolicyOptions)} {
+		assert.Equal(DefaultPolicyInterval, o.interval())
+		assert.Equal(http.DefaultClient, o.client())
+		assert.Equal(DefaultMaxPolicySize, o.maxPolicySize())
+		assert.NotNil(o.logger())
+
+		ticks, stop := o.ticker(time.Hour)
+		assert.NotNil(ticks)
+		stop()
+	}
+}
+
+func TestNewRemotePolicyNoURL(t *testing.T) {
+	assert := assert.New(t)
+	for _, o := range []*PolicyOptions{nil, new(PolicyOptions)} {
+		rp, err := NewRemotePolicy(o)
+		assert.Nil(rp)
+		assert.Equal(ErrorNoPolicyURL, err)
+	}
+}
+
+func TestRemotePolicy(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler = &policyServer{document: testPolicy1, etag: `"1"`}
+		server  = httptest.NewServer(handler)
+
+		changes [][2]*Policy
+	)
+
+	defer server.Close()
+
+	rp, err := NewRemotePolicy(&PolicyOptions{
+		URL:    server.URL,
+		Header: http.Header{"Accept": []string{"application/json"}},
+		Logger: testLogger,
+		Listeners: []PolicyListener{
+			func(previous, current *Policy) {
+				changes = append(changes, [2]*Policy{previous, current})
+			},
+		},
+	})
+
+	require.NoError(err)
+	require.NotNil(rp)
+
+	first := rp.Policy()
+	require.NotNil(first)
+	assert.Equal(1, first.Len())
+	require.Len(changes, 1)
+	assert.Nil(changes[0][0])
+	assert.True(first == changes[0][1])
+
+	// an unchanged policy is revalidated, but not swapped
+	assert.NoError(rp.Update())
+	assert.True(first == rp.Policy())
+	assert.Len(changes, 1)
+	requests, notModified := handler.counts()
+	assert.Equal(2, requests)
+	assert.Equal(1, notModified)
+
+	// a changed policy is swapped in
+	handler.set(testPolicy2, `"2"`)
+	assert.NoError(rp.Update())
+	second := rp.Policy()
+	assert.Equal(2, second.Len())
+	require.Len(changes, 2)
+	assert.True(first == changes[1][0])
+	assert.True(second == changes[1][1])
+
+	// failures leave the current policy in place
+	handler.set(`this is not a policy`, `"3"`)
+	assert.Error(rp.Update())
+	assert.True(second == rp.Policy())
+
+	handler.fail(http.StatusServiceUnavailable)
+	assert.Error(rp.Update())
+	assert.True(second == rp.Policy())
+	assert.Len(changes, 2)
+}
+
+func TestRemotePolicyCacheFallback(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler = &policyServer{document: testPolicy2, etag: `"2"`}
+		server  = httptest.NewServer(handler)
+	)
+
+	defer server.Close()
+
+	directory, err := ioutil.TempDir("", "policy")
+	require.NoError(err)
+	defer os.RemoveAll(directory)
+
+	options := &PolicyOptions{
+		URL:       server.URL,
+		CacheFile: filepath.Join(directory, "policy.json"),
+		Logger:    testLogger,
+	}
+
+	rp, err := NewRemotePolicy(options)
+	require.NoError(err)
+	assert.Equal(2, rp.Policy().Len())
+
+	// the remote policy is unavailable, so the cached copy is used
+	handler.fail(http.StatusInternalServerError)
+	cached, err := NewRemotePolicy(options)
+	require.NoError(err)
+	require.NotNil(cached.Policy())
+	assert.Equal(2, cached.Policy().Len())
+
+	// the cached ETag is used for revalidation once the remote policy is available again
+	handler.fail(0)
+	assert.NoError(cached.Update())
+	assert.Equal(2, cached.Policy().Len())
+	_, notModified := handler.counts()
+	assert.Equal(1, notModified)
+
+	// a corrupt cache is not used
+	require.NoError(ioutil.WriteFile(options.CacheFile, []byte("corrupt"), 0600))
+	handler.fail(http.StatusInternalServerError)
+	rp, err = NewRemotePolicy(options)
+	assert.Nil(rp)
+	assert.Error(err)
+}
+
+func TestNewRemotePolicyUnavailable(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		handler = &policyServer{status: http.StatusNotFound}
+		server  = httptest.NewServer(handler)
+	)
+
+	defer server.Close()
+
+	for _, cacheFile := range []string{"", filepath.Join(os.TempDir(), "nosuch", "policy.json")} {
+		rp, err := NewRemotePolicy(&PolicyOptions{URL: server.URL, CacheFile: cacheFile, Logger: testLogger})
+		assert.Nil(rp)
+		assert.Error(err)
+	}
+}
+
+func TestNewRemotePolicyTooLarge(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		handler = &policyServer{document: testPolicy1}
+		server  = httptest.NewServer(handler)
+	)
+
+	defer server.Close()
+
+	rp, err := NewRemotePolicy(&PolicyOptions{URL: server.URL, MaxPolicySize: int64(len(testPolicy1) - 1), Logger: testLogger})
+	assert.Nil(rp)
+	assert.Error(err)
+
+	rp, err = NewRemotePolicy(&PolicyOptions{URL: server.URL, MaxPolicySize: int64(len(testPolicy1)), Logger: testLogger})
+	assert.NotNil(rp)
+	assert.NoError(err)
+}
+
+func TestRemotePolicyRun(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler = &policyServer{document: testPolicy1, etag: `"1"`}
+		server  = httptest.NewServer(handler)
+
+		ticker  = make(chan time.Time)
+		changed = make(chan *Policy, 1)
+	)
+
+	defer server.Close()
+
+	rp, err := NewRemotePolicy(&PolicyOptions{
+		URL:    server.URL,
+		Logger: testLogger,
+		Tick:   func(time.Duration) <-chan time.Time { return ticker },
+	})
+
+	require.NoError(err)
+	rp.options.Listeners = []PolicyListener{
+		func(_, current *Policy) { changed <- current },
+	}
+
+	var (
+		waitGroup sync.WaitGroup
+		shutdown  = make(chan struct{})
+	)
+
+	require.NoError(rp.Run(&waitGroup, shutdown))
+	handler.set(testPolicy2, `"2"`)
+	ticker <- time.Now()
+
+	select {
+	case current := <-changed:
+		assert.Equal(2, current.Len())
+	case <-time.After(5 * time.Second):
+		assert.Fail("The policy was not updated")
+	}
+
+	close(shutdown)
+	waitGroup.Wait()
+}
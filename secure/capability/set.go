@@ -0,0 +1,54 @@
+package capability
+
+import (
+	"fmt"
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/SermoDigital/jose/jws"
+)
+
+// Set is a collection of capabilities.  A Set matches a request if any of its capabilities do.
+type Set []*Capability
+
+// ParseSet parses each of the given capability strings.  Any single invalid capability
+// causes this function to return an error.
+func ParseSet(values ...string) (Set, error) {
+	set := make(Set, 0, len(values))
+	for _, value := range values {
+		capability, err := Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid capability [%s]: %s", value, err)
+		}
+
+		set = append(set, capability)
+	}
+
+	return set, nil
+}
+
+// FromClaims parses the capabilities claim from a set of JWT claims.  Values in the claim which
+// are not strings or which are not valid capabilities are skipped, as a token may carry capabilities
+// intended for other systems.  If the claim is missing, this function returns an empty Set.
+func FromClaims(claims jws.Claims) Set {
+	values, _ := claims.Get(secure.CapabilitiesClaim).([]interface{})
+	set := make(Set, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			if capability, err := Parse(s); err == nil {
+				set = append(set, capability)
+			}
+		}
+	}
+
+	return set
+}
+
+// Match tests if any capability in this set allows the given HTTP method and URL path
+func (s Set) Match(method, path string) bool {
+	for _, capability := range s {
+		if capability.Match(method, path) {
+			return true
+		}
+	}
+
+	return false
+}
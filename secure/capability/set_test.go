@@ -0,0 +1,49 @@
+package capability
+
+import (
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/SermoDigital/jose/jws"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseSet(t *testing.T) {
+	assert := assert.New(t)
+
+	set, err := ParseSet()
+	assert.Empty(set)
+	assert.NoError(err)
+	assert.False(set.Match("GET", "/api/v2/device"))
+
+	set, err = ParseSet("x1:webpa:api:hook:post", "x1:webpa:api:hooks:get")
+	assert.Len(set, 2)
+	assert.NoError(err)
+	assert.True(set.Match("POST", "/api/v2/hook"))
+	assert.True(set.Match("GET", "/api/v2/hooks"))
+	assert.False(set.Match("GET", "/api/v2/hook"))
+
+	set, err = ParseSet("x1:webpa:api:hook:post", "invalid")
+	assert.Nil(set)
+	assert.Error(err)
+}
+
+func TestFromClaims(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(FromClaims(jws.Claims{}))
+	assert.Empty(FromClaims(jws.Claims{secure.CapabilitiesClaim: "x1:webpa:api:.*:all"}))
+
+	set := FromClaims(jws.Claims{
+		secure.CapabilitiesClaim: []interface{}{
+			"x1:webpa:api:hook:post",
+			123,
+			"x1:someoneelse:api:.*:all",
+			"x1:webpa:api:device/.*/stat:get",
+		},
+	})
+
+	if assert.Len(set, 2) {
+		assert.Equal("x1:webpa:api:hook:post", set[0].String())
+		assert.Equal("x1:webpa:api:device/.*/stat:get", set[1].String())
+	}
+}
@@ -0,0 +1,48 @@
+package capability
+
+import (
+	"context"
+	"github.com/Comcast/webpa-common/secure"
+)
+
+// Validator is a secure.Validator that authorizes requests using the capabilities claim
+// of tokens approved by a delegate.  The delegate, typically a secure.JWSValidator, is responsible
+// for verifying the token.  A Validator can be used as the Validator of an AuthorizationHandler,
+// which supplies the request method and path to validation.
+//
+// If a Policy is in effect and one of its rules matches the request, that rule decides whether the
+// request is allowed.  Otherwise, the token's capabilities are matched against the request.
+type Validator struct {
+	// Delegate verifies tokens prior to capability checks.  This field is required.
+	Delegate secure.Validator
+
+	// Policy is the optional source of route rules, such as a RemotePolicy
+	Policy PolicySource
+}
+
+func (v *Validator) Validate(ctx context.Context, token *secure.Token) (valid bool, err error) {
+	if valid, err = v.Delegate.Validate(ctx, token); !valid || err != nil {
+		return
+	}
+
+	claims := token.Claims()
+	if claims == nil {
+		return false, nil
+	}
+
+	var (
+		held   = FromClaims(claims)
+		method = secure.RequestMethod(ctx)
+		path   = secure.RequestPath(ctx)
+	)
+
+	if v.Policy != nil {
+		if policy := v.Policy.Policy(); policy != nil {
+			if allowed, matched := policy.Allow(method, path, held); matched {
+				return allowed, nil
+			}
+		}
+	}
+
+	return held.Match(method, path), nil
+}
@@ -0,0 +1,194 @@
+package secure
+
+import (
+	"context"
+	"fmt"
+	"github.com/SermoDigital/jose/jws"
+	"regexp"
+	"strings"
+)
+
+const (
+	// CapabilitiesClaim is the name of the claim holding the capabilities granted to a token
+	CapabilitiesClaim = "capabilities"
+
+	// AllowedResourcesClaim is the name of the claim holding the resources a token may access
+	AllowedResourcesClaim = "allowedResources"
+
+	// AllowedPartnersResource is the member of the AllowedResourcesClaim which holds partner IDs
+	AllowedPartnersResource = "allowedPartners"
+)
+
+// ClaimsRule describes the claims that a token must carry in order to access requests
+// matching an HTTP method and URL path pattern.  A ClaimsRule is configurable via JSON.
+type ClaimsRule struct {
+	// Method is the HTTP method to which this rule applies, compared case-insensitively.
+	// If empty, this rule applies to all methods.
+	Method string `json:"method"`
+
+	// Pattern is a regular expression matched against the request's URL path.  As with
+	// regexp.MatchString, matching is not anchored.  If empty, this rule applies to all paths.
+	Pattern string `json:"pattern"`
+
+	// Required contains the names of claims that must be present in the token.
+	Required []string `json:"required"`
+
+	// Capabilities, if nonempty, requires that the token's capabilities claim contain
+	// at least one of these values.
+	Capabilities []string `json:"capabilities"`
+
+	// Partners, if nonempty, requires that the token's allowed partners contain at least
+	// one of these partner IDs.
+	Partners []string `json:"partners"`
+}
+
+// claimsRule is the compiled form of a ClaimsRule
+type claimsRule struct {
+	method       string
+	pattern      *regexp.Regexp
+	required     []string
+	capabilities []string
+	partners     []string
+}
+
+func (r *claimsRule) matches(method, path string) bool {
+	if len(r.method) > 0 && !strings.EqualFold(r.method, method) {
+		return false
+	}
+
+	return r.pattern == nil || r.pattern.MatchString(path)
+}
+
+func (r *claimsRule) allows(claims jws.Claims) bool {
+	for _, name := range r.required {
+		if !claims.Has(name) {
+			return false
+		}
+	}
+
+	if len(r.capabilities) > 0 && !containsAny(claimStrings(claims.Get(CapabilitiesClaim)), r.capabilities) {
+		return false
+	}
+
+	if len(r.partners) > 0 && !containsAny(AllowedPartners(claims), r.partners) {
+		return false
+	}
+
+	return true
+}
+
+// ClaimsValidator enforces claims requirements on tokens that have passed a delegate Validator.
+// The delegate is responsible for verifying the token and its claims, e.g. a JWSValidator.  Once the
+// delegate approves a token, each rule matching the request's method and path must be satisfied by
+// the token's claims.  Requests that match no rules are allowed.
+//
+// Tokens that carry no verified claims are rejected, as there is no way to enforce any rules.
+type ClaimsValidator struct {
+	validator Validator
+	rules     []claimsRule
+}
+
+// NewClaimsValidator compiles the given rules into a ClaimsValidator which decorates the
+// given delegate Validator.  An error is returned if any rule's pattern is not a valid regular expression.
+func NewClaimsValidator(validator Validator, rules ...ClaimsRule) (*ClaimsValidator, error) {
+	compiled := make([]claimsRule, 0, len(rules))
+	for _, rule := range rules {
+		var pattern *regexp.Regexp
+		if len(rule.Pattern) > 0 {
+			var err error
+			if pattern, err = regexp.Compile(rule.Pattern); err != nil {
+				return nil, fmt.Errorf("Invalid claims rule pattern [%s]: %s", rule.Pattern, err)
+			}
+		}
+
+		compiled = append(compiled, claimsRule{
+			method:       rule.Method,
+			pattern:      pattern,
+			required:     rule.Required,
+			capabilities: rule.Capabilities,
+			partners:     rule.Partners,
+		})
+	}
+
+	return &ClaimsValidator{
+		validator: validator,
+		rules:     compiled,
+	}, nil
+}
+
+func (v *ClaimsValidator) Validate(ctx context.Context, token *Token) (valid bool, err error) {
+	if valid, err = v.validator.Validate(ctx, token); !valid || err != nil {
+		return
+	}
+
+	claims := token.Claims()
+	if claims == nil {
+		return false, nil
+	}
+
+	method, path := RequestMethod(ctx), RequestPath(ctx)
+	for index := range v.rules {
+		rule := &v.rules[index]
+		if rule.matches(method, path) && !rule.allows(claims) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// claimStrings converts a decoded claim value into a slice of strings.  Claims decoded from
+// JSON are typically []interface{}, but []string and single strings are supported as well.
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, element := range v {
+			if s, ok := element.(string); ok {
+				values = append(values, s)
+			}
+		}
+
+		return values
+	default:
+		return nil
+	}
+}
+
+// AllowedPartners extracts the partner IDs from the allowedResources claim.  Some issuers
+// send the partners as a single comma-delimited string, so each value is split on commas.
+// If the claims allow no partners, this function returns nil.
+func AllowedPartners(claims jws.Claims) []string {
+	resources, ok := claims.Get(AllowedResourcesClaim).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var partners []string
+	for _, value := range claimStrings(resources[AllowedPartnersResource]) {
+		for _, partner := range strings.Split(value, ",") {
+			if partner = strings.TrimSpace(partner); len(partner) > 0 {
+				partners = append(partners, partner)
+			}
+		}
+	}
+
+	return partners
+}
+
+// containsAny tests if any of the candidates appears in values
+func containsAny(values, candidates []string) bool {
+	for _, value := range values {
+		for _, candidate := range candidates {
+			if value == candidate {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,142 @@
+package secure
+
+import (
+	"context"
+	"errors"
+	"github.com/SermoDigital/jose/jws"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// claimsContext produces the same validation context that AuthorizationHandler does
+func claimsContext(method, path string) context.Context {
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, "method", method)
+	ctx = context.WithValue(ctx, "path", path)
+	return ctx
+}
+
+func TestNewClaimsValidatorInvalidPattern(t *testing.T) {
+	assert := assert.New(t)
+	validator, err := NewClaimsValidator(&MockValidator{}, ClaimsRule{Pattern: "("})
+	assert.Nil(validator)
+	assert.Error(err)
+}
+
+func TestClaimsValidatorDelegate(t *testing.T) {
+	assert := assert.New(t)
+
+	var testData = []struct {
+		delegateValid bool
+		delegateError error
+	}{
+		{false, nil},
+		{false, errors.New("expected")},
+		{true, errors.New("expected")},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		token := &Token{tokenType: Bearer, value: "does not matter", claims: testClaims}
+		ctx := claimsContext("GET", "/api/v2/device")
+
+		delegate := &MockValidator{}
+		delegate.On("Validate", ctx, token).Return(record.delegateValid, record.delegateError).Once()
+
+		validator, err := NewClaimsValidator(delegate)
+		assert.NotNil(validator)
+		assert.NoError(err)
+
+		valid, err := validator.Validate(ctx, token)
+		assert.Equal(record.delegateValid, valid)
+		assert.Equal(record.delegateError, err)
+
+		delegate.AssertExpectations(t)
+	}
+}
+
+func TestClaimsValidatorNoClaims(t *testing.T) {
+	assert := assert.New(t)
+	token := &Token{tokenType: Basic, value: "does not matter"}
+	ctx := claimsContext("GET", "/api/v2/device")
+
+	delegate := &MockValidator{}
+	delegate.On("Validate", ctx, token).Return(true, nil).Once()
+
+	validator, err := NewClaimsValidator(delegate)
+	assert.NotNil(validator)
+	assert.NoError(err)
+
+	valid, err := validator.Validate(ctx, token)
+	assert.False(valid)
+	assert.NoError(err)
+
+	delegate.AssertExpectations(t)
+}
+
+func TestClaimsValidatorRules(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := []ClaimsRule{
+		ClaimsRule{
+			Method:       "post",
+			Pattern:      "^/api/v2/device",
+			Required:     []string{AllowedResourcesClaim},
+			Capabilities: []string{"x1:webpa:api:.*:post"},
+		},
+		ClaimsRule{
+			Pattern:  "/config$",
+			Partners: []string{"cox"},
+		},
+		ClaimsRule{
+			Method:   "DELETE",
+			Required: []string{"admin"},
+		},
+	}
+
+	stringClaims := jws.Claims{
+		CapabilitiesClaim: []string{"x1:webpa:api:.*:post"},
+		AllowedResourcesClaim: map[string]interface{}{
+			AllowedPartnersResource: "comcast",
+		},
+	}
+
+	var testData = []struct {
+		method        string
+		path          string
+		claims        jws.Claims
+		expectedValid bool
+	}{
+		{"GET", "/api/v2/device", testClaims, true},
+		{"POST", "/api/v2/device", testClaims, true},
+		{"POST", "/api/v2/device", stringClaims, true},
+		{"POST", "/api/v2/device", jws.Claims{AllowedResourcesClaim: map[string]interface{}{}}, false},
+		{"POST", "/api/v2/device", jws.Claims{CapabilitiesClaim: []interface{}{"x1:webpa:api:.*:post"}}, false},
+		{"POST", "/api/v2/device", jws.Claims{"sub": "nothing useful"}, false},
+		{"GET", "/api/v2/device/config", testClaims, true},
+		{"GET", "/api/v2/device/config", stringClaims, false},
+		{"GET", "/api/v2/device/config", jws.Claims{"sub": "nothing useful"}, false},
+		{"DELETE", "/api/v2/hook", testClaims, false},
+		{"DELETE", "/api/v2/hook", jws.Claims{"admin": true}, true},
+		{"PUT", "/api/v2/hook", jws.Claims{"sub": "nothing useful"}, true},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		token := &Token{tokenType: Bearer, value: "does not matter", claims: record.claims}
+		ctx := claimsContext(record.method, record.path)
+
+		delegate := &MockValidator{}
+		delegate.On("Validate", ctx, token).Return(true, nil).Once()
+
+		validator, err := NewClaimsValidator(delegate, rules...)
+		assert.NotNil(validator)
+		assert.NoError(err)
+
+		valid, err := validator.Validate(ctx, token)
+		assert.Equal(record.expectedValid, valid)
+		assert.NoError(err)
+
+		delegate.AssertExpectations(t)
+	}
+}
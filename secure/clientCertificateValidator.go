@@ -0,0 +1,93 @@
+package secure
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+)
+
+// ClientCertificateValidator authenticates requests using the TLS client certificate presented
+// by the peer.  The certificate is obtained from the validation context via GetConnectionState, so
+// this validator ignores the token itself.  That allows it to be registered for ClientCertificate tokens
+// in an AuthorizationHandler, or to be chained with token validators.
+//
+// A certificate is accepted when all of the following hold:
+//
+// The certificate chains to Roots.  If Roots is nil, the chain must instead have been verified during the
+// TLS handshake, i.e. via tls.Config.ClientCAs with a ClientAuth of tls.VerifyClientCertIfGiven or stronger.
+//
+// If AllowedSANs is nonempty, at least one of the certificate's DNS names, email addresses, IP addresses,
+// or URIs appears in AllowedSANs.
+//
+// If Pins is nonempty, the SubjectPublicKeyInfo of at least one certificate in the chain presented by the
+// peer matches a pin.  Pins are base64-encoded SHA-256 hashes, as used by HPKP.
+type ClientCertificateValidator struct {
+	Roots       *x509.CertPool
+	AllowedSANs []string
+	Pins        []string
+}
+
+func (v *ClientCertificateValidator) Validate(ctx context.Context, token *Token) (bool, error) {
+	state, ok := GetConnectionState(ctx)
+	if !ok || len(state.PeerCertificates) == 0 {
+		return false, nil
+	}
+
+	leaf := state.PeerCertificates[0]
+	if v.Roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, certificate := range state.PeerCertificates[1:] {
+			intermediates.AddCert(certificate)
+		}
+
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         v.Roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+
+		if err != nil {
+			return false, nil
+		}
+	} else if len(state.VerifiedChains) == 0 {
+		return false, nil
+	}
+
+	if len(v.AllowedSANs) > 0 && !containsAny(subjectAlternativeNames(leaf), v.AllowedSANs) {
+		return false, nil
+	}
+
+	if len(v.Pins) > 0 && !v.pinned(state.PeerCertificates) {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// pinned tests if any of the given certificates has a public key matching one of the configured pins
+func (v *ClientCertificateValidator) pinned(certificates []*x509.Certificate) bool {
+	pins := make([]string, 0, len(certificates))
+	for _, certificate := range certificates {
+		hash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+		pins = append(pins, base64.StdEncoding.EncodeToString(hash[:]))
+	}
+
+	return containsAny(pins, v.Pins)
+}
+
+// subjectAlternativeNames returns the string forms of all SANs in a certificate
+func subjectAlternativeNames(certificate *x509.Certificate) []string {
+	names := make([]string, 0, len(certificate.DNSNames)+len(certificate.EmailAddresses)+len(certificate.IPAddresses)+len(certificate.URIs))
+	names = append(names, certificate.DNSNames...)
+	names = append(names, certificate.EmailAddresses...)
+	for _, ip := range certificate.IPAddresses {
+		names = append(names, ip.String())
+	}
+
+	for _, uri := range certificate.URIs {
+		names = append(names, uri.String())
+	}
+
+	return names
+}
@@ -0,0 +1,171 @@
+package secure
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testCertificate creates a certificate signed by the given parent, or a self-signed CA if parent is nil
+func testCertificate(t *testing.T, serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return certificate, key
+}
+
+func testClientCertificates(t *testing.T) (ca *x509.Certificate, client *x509.Certificate, other *x509.Certificate) {
+	ca, caKey := testCertificate(t, 1, nil, nil, &x509.Certificate{Subject: pkix.Name{CommonName: "Test CA"}})
+	deviceURI, _ := url.Parse("spiffe://example.com/device-management")
+
+	client, _ = testCertificate(t, 2, ca, caKey, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "client"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		DNSNames:    []string{"client.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.1.2.3")},
+		URIs:        []*url.URL{deviceURI},
+	})
+
+	other, _ = testCertificate(t, 3, nil, nil, &x509.Certificate{Subject: pkix.Name{CommonName: "Other CA"}})
+	return
+}
+
+func spkiPin(certificate *x509.Certificate) string {
+	hash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func TestGetConnectionState(t *testing.T) {
+	assert := assert.New(t)
+
+	state, ok := GetConnectionState(nil)
+	assert.Nil(state)
+	assert.False(ok)
+
+	state, ok = GetConnectionState(context.Background())
+	assert.Nil(state)
+	assert.False(ok)
+
+	state, ok = GetConnectionState(WithConnectionState(context.Background(), nil))
+	assert.Nil(state)
+	assert.False(ok)
+
+	expected := new(tls.ConnectionState)
+	state, ok = GetConnectionState(WithConnectionState(context.Background(), expected))
+	assert.Equal(expected, state)
+	assert.True(ok)
+}
+
+func TestNewClientCertificateToken(t *testing.T) {
+	assert := assert.New(t)
+	_, client, other := testClientCertificates(t)
+
+	token := NewClientCertificateToken(client)
+	assert.Equal(ClientCertificate, token.Type())
+	assert.Len(token.Value(), 64)
+	assert.NotEqual(token.Value(), NewClientCertificateToken(other).Value())
+}
+
+func TestClientCertificateValidator(t *testing.T) {
+	var (
+		assert            = assert.New(t)
+		ca, client, other = testClientCertificates(t)
+		roots             = x509.NewCertPool()
+		token             = NewClientCertificateToken(client)
+	)
+
+	roots.AddCert(ca)
+
+	var testData = []struct {
+		validator ClientCertificateValidator
+		state     *tls.ConnectionState
+		expected  bool
+	}{
+		{ClientCertificateValidator{Roots: roots}, nil, false},
+		{ClientCertificateValidator{Roots: roots}, &tls.ConnectionState{}, false},
+		{ClientCertificateValidator{Roots: roots}, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}}, true},
+		{ClientCertificateValidator{Roots: roots}, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{other}}, false},
+		{ClientCertificateValidator{}, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}}, false},
+		{
+			ClientCertificateValidator{},
+			&tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}, VerifiedChains: [][]*x509.Certificate{{client, ca}}},
+			true,
+		},
+		{
+			ClientCertificateValidator{Roots: roots, AllowedSANs: []string{"nosuch.example.com", "client.example.com"}},
+			&tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}},
+			true,
+		},
+		{
+			ClientCertificateValidator{Roots: roots, AllowedSANs: []string{"10.1.2.3"}},
+			&tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}},
+			true,
+		},
+		{
+			ClientCertificateValidator{Roots: roots, AllowedSANs: []string{"spiffe://example.com/device-management"}},
+			&tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}},
+			true,
+		},
+		{
+			ClientCertificateValidator{Roots: roots, AllowedSANs: []string{"nosuch.example.com"}},
+			&tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}},
+			false,
+		},
+		{
+			ClientCertificateValidator{Roots: roots, Pins: []string{spkiPin(client)}},
+			&tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}},
+			true,
+		},
+		{
+			ClientCertificateValidator{Roots: roots, Pins: []string{spkiPin(ca)}},
+			&tls.ConnectionState{PeerCertificates: []*x509.Certificate{client, ca}},
+			true,
+		},
+		{
+			ClientCertificateValidator{Roots: roots, Pins: []string{spkiPin(other)}},
+			&tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}},
+			false,
+		},
+	}
+
+	for index, record := range testData {
+		t.Logf("%d", index)
+		ctx := context.Background()
+		if record.state != nil {
+			ctx = WithConnectionState(ctx, record.state)
+		}
+
+		valid, err := record.validator.Validate(ctx, token)
+		assert.Equal(record.expected, valid)
+		assert.NoError(err)
+	}
+}
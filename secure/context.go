@@ -0,0 +1,188 @@
+package secure
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/SermoDigital/jose/jws"
+	"net/http"
+)
+
+// ContextKey is the key type used by information stored in Contexts from this package
+type ContextKey uint
+
+const (
+	// ClaimsKey is the Context key associated with the verified claims of the token
+	// that authorized a request
+	ClaimsKey ContextKey = iota
+
+	// MethodKey is the Context key associated with the HTTP method of the request being validated
+	MethodKey
+
+	// PathKey is the Context key associated with the URL path of the request being validated
+	PathKey
+
+	// TokenKey is the Context key associated with the Token being validated
+	TokenKey
+
+	// ConnectionStateKey is the Context key associated with the TLS connection state of the request being validated
+	ConnectionStateKey
+
+	// HTTPRequestKey is the Context key associated with the HTTP request being validated
+	HTTPRequestKey
+
+	// RemoteAddrKey is the Context key associated with the network address of the client that sent the request being validated
+	RemoteAddrKey
+
+	// RequestIDKey is the Context key associated with the ID of the request being validated
+	RequestIDKey
+
+	// PrincipalKey is the Context key associated with the principal of the token that authorized a request
+	PrincipalKey
+)
+
+// The untyped Context keys used for the request method and path before MethodKey and PathKey
+// existed.  AuthorizationHandler still sets these, so that existing validators continue to work.
+//
+// Deprecated: use MethodKey and PathKey, or more simply RequestMethod and RequestPath.
+const (
+	LegacyMethodKey = "method"
+	LegacyPathKey   = "path"
+)
+
+// GetClaims returns the verified claims from a Context.  If no claims are present, this
+// function returns false for the second parameter.
+func GetClaims(ctx context.Context) (claims jws.Claims, ok bool) {
+	claims, ok = ctx.Value(ClaimsKey).(jws.Claims)
+	return
+}
+
+// WithClaims returns a new Context with the given claims as a value.
+func WithClaims(claims jws.Claims, parent context.Context) context.Context {
+	return context.WithValue(parent, ClaimsKey, claims)
+}
+
+// WithRequest returns a new Context containing the given HTTP method and URL path, suitable for passing to validators.
+// Both the typed keys and the legacy untyped keys are set.
+func WithRequest(parent context.Context, method, path string) context.Context {
+	ctx := context.WithValue(parent, MethodKey, method)
+	ctx = context.WithValue(ctx, PathKey, path)
+	ctx = context.WithValue(ctx, LegacyMethodKey, method)
+	return context.WithValue(ctx, LegacyPathKey, path)
+}
+
+// WithToken returns a new Context with the given token as a value
+func WithToken(parent context.Context, token *Token) context.Context {
+	return context.WithValue(parent, TokenKey, token)
+}
+
+// GetToken returns the token being validated from a Context.  If no token is present, this
+// function returns false for the second parameter.
+func GetToken(ctx context.Context) (token *Token, ok bool) {
+	token, ok = ctx.Value(TokenKey).(*Token)
+	return
+}
+
+// WithConnectionState returns a new Context with the given TLS connection state as a value
+func WithConnectionState(parent context.Context, state *tls.ConnectionState) context.Context {
+	return context.WithValue(parent, ConnectionStateKey, state)
+}
+
+// GetConnectionState returns the TLS connection state of the request being validated.  If the
+// request was not made over TLS, this function returns false for the second parameter.
+func GetConnectionState(ctx context.Context) (state *tls.ConnectionState, ok bool) {
+	if ctx != nil {
+		state, ok = ctx.Value(ConnectionStateKey).(*tls.ConnectionState)
+	}
+
+	return state, ok && state != nil
+}
+
+// WithHTTPRequest returns a new Context with the given HTTP request as a value.  Validators which
+// need more of the request than its method and path, such as SigV4Validator, obtain it via GetHTTPRequest.
+func WithHTTPRequest(parent context.Context, request *http.Request) context.Context {
+	return context.WithValue(parent, HTTPRequestKey, request)
+}
+
+// GetHTTPRequest returns the HTTP request being validated.  If no request is present, this
+// function returns false for the second parameter.
+func GetHTTPRequest(ctx context.Context) (request *http.Request, ok bool) {
+	if ctx != nil {
+		request, ok = ctx.Value(HTTPRequestKey).(*http.Request)
+	}
+
+	return request, ok && request != nil
+}
+
+// RequestMethod returns the HTTP method that AuthorizationHandler places into the Context
+// passed to validators.  Contexts built with the legacy untyped key are also supported.
+// If no method is present, this function returns the empty string.
+func RequestMethod(ctx context.Context) (method string) {
+	if ctx != nil {
+		var ok bool
+		if method, ok = ctx.Value(MethodKey).(string); !ok {
+			method, _ = ctx.Value(LegacyMethodKey).(string)
+		}
+	}
+
+	return
+}
+
+// RequestPath returns the URL path that AuthorizationHandler places into the Context
+// passed to validators.  Contexts built with the legacy untyped key are also supported.
+// If no path is present, this function returns the empty string.
+func RequestPath(ctx context.Context) (path string) {
+	if ctx != nil {
+		var ok bool
+		if path, ok = ctx.Value(PathKey).(string); !ok {
+			path, _ = ctx.Value(LegacyPathKey).(string)
+		}
+	}
+
+	return
+}
+
+// WithRemoteAddr returns a new Context with the given client network address as a value
+func WithRemoteAddr(parent context.Context, remoteAddr string) context.Context {
+	return context.WithValue(parent, RemoteAddrKey, remoteAddr)
+}
+
+// RequestRemoteAddr returns the network address of the client that sent the request being validated,
+// as reported by http.Request.RemoteAddr.  If no address is present, this function returns the empty string.
+func RequestRemoteAddr(ctx context.Context) (remoteAddr string) {
+	if ctx != nil {
+		remoteAddr, _ = ctx.Value(RemoteAddrKey).(string)
+	}
+
+	return
+}
+
+// WithRequestID returns a new Context with the given request ID as a value
+func WithRequestID(parent context.Context, requestID string) context.Context {
+	return context.WithValue(parent, RequestIDKey, requestID)
+}
+
+// RequestID returns the ID of the request being validated.  If the request has no ID, this
+// function returns the empty string.
+func RequestID(ctx context.Context) (requestID string) {
+	if ctx != nil {
+		requestID, _ = ctx.Value(RequestIDKey).(string)
+	}
+
+	return
+}
+
+// WithPrincipal returns a new Context with the given principal as a value.  AuthorizationHandler sets
+// the principal of each token it approves, so that handlers can record who made a request.
+func WithPrincipal(parent context.Context, principal string) context.Context {
+	return context.WithValue(parent, PrincipalKey, principal)
+}
+
+// RequestPrincipal returns the principal of the token that authorized a request.  If the request was not
+// authorized, or its token has no principal, this function returns the empty string.
+func RequestPrincipal(ctx context.Context) (principal string) {
+	if ctx != nil {
+		principal, _ = ctx.Value(PrincipalKey).(string)
+	}
+
+	return
+}
@@ -0,0 +1,118 @@
+package secure
+
+import (
+	"context"
+	"github.com/SermoDigital/jose/jws"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetClaimsMissing(t *testing.T) {
+	assert := assert.New(t)
+	claims, ok := GetClaims(context.Background())
+	assert.Nil(claims)
+	assert.False(ok)
+}
+
+func TestWithClaims(t *testing.T) {
+	assert := assert.New(t)
+	expected := jws.Claims{"sub": "test"}
+
+	ctx := WithClaims(expected, context.Background())
+	assert.NotNil(ctx)
+
+	actual, ok := GetClaims(ctx)
+	assert.Equal(expected, actual)
+	assert.True(ok)
+}
+
+func TestRequestMethodAndPath(t *testing.T) {
+	assert := assert.New(t)
+	assert.Empty(RequestMethod(nil))
+	assert.Empty(RequestPath(nil))
+	assert.Empty(RequestMethod(context.Background()))
+	assert.Empty(RequestPath(context.Background()))
+
+	ctx := context.WithValue(context.Background(), "method", "GET")
+	ctx = context.WithValue(ctx, "path", "/api/v2/device")
+	assert.Equal("GET", RequestMethod(ctx))
+	assert.Equal("/api/v2/device", RequestPath(ctx))
+
+	ctx = context.WithValue(context.Background(), MethodKey, "PUT")
+	ctx = context.WithValue(ctx, PathKey, "/api/v2/hook")
+	assert.Equal("PUT", RequestMethod(ctx))
+	assert.Equal("/api/v2/hook", RequestPath(ctx))
+}
+
+func TestWithRequest(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		parent = context.WithValue(context.Background(), "parent", "value")
+		ctx    = WithRequest(parent, "POST", "/api/v2/notify")
+	)
+
+	assert.Equal("value", ctx.Value("parent"))
+	assert.Equal("POST", RequestMethod(ctx))
+	assert.Equal("/api/v2/notify", RequestPath(ctx))
+	assert.Equal("POST", ctx.Value(MethodKey))
+	assert.Equal("/api/v2/notify", ctx.Value(PathKey))
+	assert.Equal("POST", ctx.Value(LegacyMethodKey))
+	assert.Equal("/api/v2/notify", ctx.Value(LegacyPathKey))
+}
+
+func TestRequestRemoteAddr(t *testing.T) {
+	assert := assert.New(t)
+	assert.Empty(RequestRemoteAddr(nil))
+	assert.Empty(RequestRemoteAddr(context.Background()))
+	assert.Equal("10.0.0.1:1234", RequestRemoteAddr(WithRemoteAddr(context.Background(), "10.0.0.1:1234")))
+}
+
+func TestRequestID(t *testing.T) {
+	assert := assert.New(t)
+	assert.Empty(RequestID(nil))
+	assert.Empty(RequestID(context.Background()))
+	assert.Equal("abc123", RequestID(WithRequestID(context.Background(), "abc123")))
+}
+
+func TestWithToken(t *testing.T) {
+	assert := assert.New(t)
+
+	token, ok := GetToken(context.Background())
+	assert.Nil(token)
+	assert.False(ok)
+
+	expected := &Token{tokenType: Basic, value: "dGVzdDp0ZXN0Cg=="}
+	token, ok = GetToken(WithToken(context.Background(), expected))
+	assert.Equal(expected, token)
+	assert.True(ok)
+}
+
+func TestGetHTTPRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	request, ok := GetHTTPRequest(nil)
+	assert.Nil(request)
+	assert.False(ok)
+
+	request, ok = GetHTTPRequest(context.Background())
+	assert.Nil(request)
+	assert.False(ok)
+
+	request, ok = GetHTTPRequest(WithHTTPRequest(context.Background(), nil))
+	assert.Nil(request)
+	assert.False(ok)
+
+	expected := httptest.NewRequest("GET", "/", nil)
+	request, ok = GetHTTPRequest(WithHTTPRequest(context.Background(), expected))
+	assert.Equal(expected, request)
+	assert.True(ok)
+}
+
+func TestRequestPrincipal(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(RequestPrincipal(nil))
+	assert.Empty(RequestPrincipal(context.Background()))
+	assert.Equal("joe", RequestPrincipal(WithPrincipal(context.Background(), "joe")))
+}
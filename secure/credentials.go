@@ -0,0 +1,257 @@
+package secure
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Comcast/webpa-common/logging"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCredentialCheckInterval is the default interval at which a FileCredentialStore checks its file for changes
+	DefaultCredentialCheckInterval = 10 * time.Second
+
+	// MaxArgon2Memory is the largest argon2 memory cost, in KiB, accepted in a password hash
+	MaxArgon2Memory = 1024 * 1024
+
+	// MaxArgon2Time is the largest argon2 time cost, i.e. number of passes, accepted in a password hash
+	MaxArgon2Time = 16
+
+	// MaxArgon2Threads is the largest argon2 parallelism accepted in a password hash
+	MaxArgon2Threads = 64
+)
+
+var (
+	ErrorUnsupportedPasswordHash = errors.New("Unsupported password hash format")
+	ErrorInvalidPasswordHash     = errors.New("Invalid password hash")
+)
+
+// Credential is the stored form of a principal's Basic credentials.  A Credential is configurable via JSON.
+type Credential struct {
+	// Hash is the principal's hashed password, in either the modular crypt format produced by
+	// bcrypt ("$2a$...", "$2b$...", or "$2y$...") or the PHC string format produced by argon2
+	// ("$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>").  Plaintext passwords are not supported.
+	Hash string `json:"hash"`
+
+	// Methods, if nonempty, restricts the HTTP methods this principal may use.  Methods are
+	// compared case-insensitively.
+	Methods []string `json:"methods,omitempty"`
+}
+
+// Verify tests if the given password matches this credential's hash.  An error is returned
+// if the hash is malformed or is not in a supported format.
+func (c *Credential) Verify(password []byte) (bool, error) {
+	switch {
+	case strings.HasPrefix(c.Hash, "$2a$"), strings.HasPrefix(c.Hash, "$2b$"), strings.HasPrefix(c.Hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(c.Hash), password)
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+
+		return err == nil, err
+
+	case strings.HasPrefix(c.Hash, "$argon2id$"), strings.HasPrefix(c.Hash, "$argon2i$"):
+		return verifyArgon2(c.Hash, password)
+
+	default:
+		return false, ErrorUnsupportedPasswordHash
+	}
+}
+
+// Allows tests if this credential permits the given HTTP method
+func (c *Credential) Allows(method string) bool {
+	if len(c.Methods) == 0 {
+		return true
+	}
+
+	for _, allowed := range c.Methods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyArgon2 checks a password against an argon2 hash in PHC string format
+func verifyArgon2(hash string, password []byte) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, ErrorInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrorInvalidPasswordHash
+	}
+
+	var (
+		memory, time uint32
+		threads      uint8
+	)
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, ErrorInvalidPasswordHash
+	}
+
+	// bound the cost of each check, since every request with Basic credentials pays it
+	if time == 0 || time > MaxArgon2Time || threads == 0 || threads > MaxArgon2Threads || memory == 0 || memory > MaxArgon2Memory {
+		return false, ErrorInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrorInvalidPasswordHash
+	}
+
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(expected) == 0 {
+		return false, ErrorInvalidPasswordHash
+	}
+
+	var actual []byte
+	if parts[1] == "argon2id" {
+		actual = argon2.IDKey(password, salt, time, memory, threads, uint32(len(expected)))
+	} else {
+		actual = argon2.Key(password, salt, time, memory, threads, uint32(len(expected)))
+	}
+
+	return subtle.ConstantTimeCompare(actual, expected) == 1, nil
+}
+
+// CredentialStore is the strategy for looking up the stored credentials of principals
+type CredentialStore interface {
+	// Credential returns the stored credential for a principal, if any
+	Credential(principal string) (Credential, bool)
+}
+
+// CredentialMap is an in-memory CredentialStore, keyed by principal
+type CredentialMap map[string]Credential
+
+func (m CredentialMap) Credential(principal string) (Credential, bool) {
+	credential, ok := m[principal]
+	return credential, ok
+}
+
+// FileCredentialStore is a CredentialStore backed by a JSON file containing a CredentialMap.
+// The file is checked for modifications at most once per check interval, during lookups, and
+// is reloaded whenever its modification time changes.  If a reload fails, the error is logged
+// and the previously loaded credentials remain in effect.
+type FileCredentialStore struct {
+	path          string
+	checkInterval time.Duration
+	logger        logging.Logger
+	now           func() time.Time
+
+	lock        sync.RWMutex
+	credentials CredentialMap
+	modTime     time.Time
+	lastCheck   time.Time
+}
+
+// NewFileCredentialStore loads the credentials in the given file.  If checkInterval is nonpositive,
+// DefaultCredentialCheckInterval is used.  If logger is nil, logging.DefaultLogger() is used.  An error
+// is returned if the file cannot be loaded initially.
+func NewFileCredentialStore(path string, checkInterval time.Duration, logger logging.Logger) (*FileCredentialStore, error) {
+	if checkInterval <= 0 {
+		checkInterval = DefaultCredentialCheckInterval
+	}
+
+	if logger == nil {
+		logger = logging.DefaultLogger()
+	}
+
+	store := &FileCredentialStore{
+		path:          path,
+		checkInterval: checkInterval,
+		logger:        logger,
+		now:           time.Now,
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.load(info); err != nil {
+		return nil, err
+	}
+
+	store.lastCheck = store.now()
+	return store, nil
+}
+
+// load reads the credentials file, replacing the current credentials.  This method
+// must be called either during construction or while holding the write lock.
+func (s *FileCredentialStore) load(info os.FileInfo) error {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	credentials := make(CredentialMap)
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return fmt.Errorf("Invalid credentials file [%s]: %s", s.path, err)
+	}
+
+	s.credentials = credentials
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// checkForChanges reloads the credentials file if the check interval has elapsed and the file was modified
+func (s *FileCredentialStore) checkForChanges() {
+	now := s.now()
+
+	s.lock.RLock()
+	due := now.Sub(s.lastCheck) >= s.checkInterval
+	s.lock.RUnlock()
+
+	if !due {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// another goroutine may have performed the check while we waited for the lock
+	if now.Sub(s.lastCheck) < s.checkInterval {
+		return
+	}
+
+	s.lastCheck = now
+	info, err := os.Stat(s.path)
+	if err != nil {
+		s.logger.Error("Unable to check credentials file [%s]: %s", s.path, err)
+		return
+	}
+
+	if info.ModTime().Equal(s.modTime) {
+		return
+	}
+
+	if err := s.load(info); err != nil {
+		s.logger.Error("Unable to reload credentials file [%s]: %s", s.path, err)
+		return
+	}
+
+	s.logger.Info("Reloaded credentials file [%s]", s.path)
+}
+
+func (s *FileCredentialStore) Credential(principal string) (Credential, bool) {
+	s.checkForChanges()
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	credential, ok := s.credentials[principal]
+	return credential, ok
+}
@@ -0,0 +1,203 @@
+package secure
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func bcryptHash(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return string(hash)
+}
+
+func argon2Hash(variant, password string) string {
+	var (
+		salt = []byte("0123456789abcdef")
+		key  []byte
+	)
+
+	if variant == "argon2id" {
+		key = argon2.IDKey([]byte(password), salt, 1, 1024, 1, 32)
+	} else {
+		key = argon2.Key([]byte(password), salt, 1, 1024, 1, 32)
+	}
+
+	return fmt.Sprintf(
+		"$%s$v=%d$m=1024,t=1,p=1$%s$%s",
+		variant,
+		argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func TestCredentialVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, hash := range []string{bcryptHash(t, "secret"), argon2Hash("argon2id", "secret"), argon2Hash("argon2i", "secret")} {
+		t.Log(hash)
+		credential := Credential{Hash: hash}
+
+		valid, err := credential.Verify([]byte("secret"))
+		assert.True(valid)
+		assert.NoError(err)
+
+		valid, err = credential.Verify([]byte("wrong"))
+		assert.False(valid)
+		assert.NoError(err)
+	}
+}
+
+func TestCredentialVerifyInvalidHash(t *testing.T) {
+	assert := assert.New(t)
+
+	var testData = []struct {
+		hash          string
+		expectedError error
+	}{
+		{"", ErrorUnsupportedPasswordHash},
+		{"secret", ErrorUnsupportedPasswordHash},
+		{"$1$abcdefgh$abcdefghijklmnopqrstuv", ErrorUnsupportedPasswordHash},
+		{"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA", ErrorInvalidPasswordHash},
+		{"$argon2id$v=1$m=1024,t=1,p=1$c2FsdA$a2V5", ErrorInvalidPasswordHash},
+		{"$argon2id$v=19$nonsense$c2FsdA$a2V5", ErrorInvalidPasswordHash},
+		{"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5", ErrorInvalidPasswordHash},
+		{"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$!!!", ErrorInvalidPasswordHash},
+		{"$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5", ErrorInvalidPasswordHash},
+		{"$argon2id$v=19$m=1024,t=1,p=0$c2FsdA$a2V5", ErrorInvalidPasswordHash},
+		{"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5", ErrorInvalidPasswordHash},
+		{"$argon2id$v=19$m=1048577,t=1,p=1$c2FsdA$a2V5", ErrorInvalidPasswordHash},
+		{"$argon2id$v=19$m=1024,t=17,p=1$c2FsdA$a2V5", ErrorInvalidPasswordHash},
+		{"$argon2id$v=19$m=1024,t=1,p=65$c2FsdA$a2V5", ErrorInvalidPasswordHash},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		credential := Credential{Hash: record.hash}
+		valid, err := credential.Verify([]byte("secret"))
+		assert.False(valid)
+		assert.Equal(record.expectedError, err)
+	}
+
+	valid, err := (&Credential{Hash: "$2a$10$tooshort"}).Verify([]byte("secret"))
+	assert.False(valid)
+	assert.Error(err)
+}
+
+func TestCredentialAllows(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True((&Credential{}).Allows("GET"))
+	assert.True((&Credential{}).Allows(""))
+
+	restricted := Credential{Methods: []string{"get", "HEAD"}}
+	assert.True(restricted.Allows("GET"))
+	assert.True(restricted.Allows("head"))
+	assert.False(restricted.Allows("POST"))
+	assert.False(restricted.Allows(""))
+}
+
+func TestCredentialMap(t *testing.T) {
+	assert := assert.New(t)
+	store := CredentialMap{"joe": Credential{Hash: "hash"}}
+
+	credential, ok := store.Credential("joe")
+	assert.True(ok)
+	assert.Equal("hash", credential.Hash)
+
+	_, ok = store.Credential("nosuch")
+	assert.False(ok)
+}
+
+func writeCredentials(t *testing.T, path, contents string, modTime time.Time) {
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestFileCredentialStore(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		modTime = time.Now().Add(-time.Hour)
+		current = time.Now()
+	)
+
+	directory, err := ioutil.TempDir("", "credentials")
+	require.NoError(err)
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "credentials.json")
+	writeCredentials(t, path, `{"joe": {"hash": "first", "methods": ["GET"]}}`, modTime)
+
+	store, err := NewFileCredentialStore(path, time.Minute, logging.TestLogger(t))
+	require.NoError(err)
+	require.NotNil(store)
+	store.now = func() time.Time { return current }
+	store.lastCheck = current
+
+	credential, ok := store.Credential("joe")
+	assert.True(ok)
+	assert.Equal(Credential{Hash: "first", Methods: []string{"GET"}}, credential)
+
+	// changes are not noticed until the check interval elapses
+	writeCredentials(t, path, `{"joe": {"hash": "second"}}`, modTime.Add(time.Minute))
+	credential, ok = store.Credential("joe")
+	assert.True(ok)
+	assert.Equal("first", credential.Hash)
+
+	current = current.Add(time.Minute)
+	credential, ok = store.Credential("joe")
+	assert.True(ok)
+	assert.Equal("second", credential.Hash)
+
+	// an invalid file leaves the current credentials in effect
+	writeCredentials(t, path, `this is not JSON`, modTime.Add(2*time.Minute))
+	current = current.Add(time.Minute)
+	credential, ok = store.Credential("joe")
+	assert.True(ok)
+	assert.Equal("second", credential.Hash)
+
+	// as does a missing file
+	require.NoError(os.Remove(path))
+	current = current.Add(time.Minute)
+	credential, ok = store.Credential("joe")
+	assert.True(ok)
+	assert.Equal("second", credential.Hash)
+
+	writeCredentials(t, path, `{"bob": {"hash": "third"}}`, modTime.Add(3*time.Minute))
+	current = current.Add(time.Minute)
+	_, ok = store.Credential("joe")
+	assert.False(ok)
+	credential, ok = store.Credential("bob")
+	assert.True(ok)
+	assert.Equal("third", credential.Hash)
+}
+
+func TestNewFileCredentialStoreError(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, err := ioutil.TempDir("", "credentials")
+	require.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "credentials.json")
+	store, err := NewFileCredentialStore(path, 0, nil)
+	assert.Nil(store)
+	assert.Error(err)
+
+	writeCredentials(t, path, `this is not JSON`, time.Now())
+	store, err = NewFileCredentialStore(path, 0, nil)
+	assert.Nil(store)
+	assert.Error(err)
+}
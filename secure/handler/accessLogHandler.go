@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"github.com/Comcast/webpa-common/logging"
+	"net/http"
+	"time"
+)
+
+// AccessLogHandler provides Alice-compatible decoration that logs each request at the info level
+// once it has been handled, including its status code, response size, latency, and request ID if
+// a logging.RequestHandler has assigned one.
+type AccessLogHandler struct {
+	Logger logging.Logger
+}
+
+func (a AccessLogHandler) logger() logging.Logger {
+	if a.Logger != nil {
+		return a.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+// Decorate provides an Alice-compatible constructor that logs requests
+func (a AccessLogHandler) Decorate(delegate http.Handler) http.Handler {
+	logger := a.logger()
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		var (
+			start   = time.Now()
+			wrapper = &statusResponseWriter{ResponseWriter: response}
+		)
+
+		defer func() {
+			// a panic propagates to an outer RecoveryHandler, but is logged here as the error it will become
+			recovered := recover()
+			statusCode := wrapper.statusCode
+			if statusCode == 0 {
+				if recovered != nil {
+					statusCode = http.StatusInternalServerError
+				} else {
+					statusCode = http.StatusOK
+				}
+			}
+
+			requestID, _ := logging.GetRequestID(request.Context())
+			logger.Info(
+				"%s %s %s %d %d %s [%s]",
+				request.RemoteAddr,
+				request.Method,
+				request.URL.RequestURI(),
+				statusCode,
+				wrapper.written,
+				time.Since(start),
+				requestID,
+			)
+
+			if recovered != nil {
+				panic(recovered)
+			}
+		}()
+
+		delegate.ServeHTTP(wrapper, request)
+	})
+}
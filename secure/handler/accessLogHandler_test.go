@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"bytes"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccessLogHandler(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		output  bytes.Buffer
+		handler = AccessLogHandler{Logger: &logging.LoggerWriter{Writer: &output}}.Decorate(
+			http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+				response.WriteHeader(http.StatusCreated)
+				response.Write([]byte("hello"))
+			}),
+		)
+
+		request  = httptest.NewRequest("POST", "/test?foo=bar", nil)
+		response = httptest.NewRecorder()
+	)
+
+	request = request.WithContext(logging.WithRequestID(request.Context(), "abc"))
+	handler.ServeHTTP(response, request)
+
+	assert.Equal(http.StatusCreated, response.Code)
+	assert.Contains(output.String(), "POST /test?foo=bar 201 5 ")
+	assert.Contains(output.String(), "[abc]")
+}
+
+func TestAccessLogHandlerImplicitStatus(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		output  bytes.Buffer
+		handler = AccessLogHandler{Logger: &logging.LoggerWriter{Writer: &output}}.Decorate(
+			http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		)
+	)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+	assert.Contains(output.String(), "GET /test 200 0 ")
+}
+
+func TestAccessLogHandlerPanic(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		output  bytes.Buffer
+		handler = AccessLogHandler{Logger: &logging.LoggerWriter{Writer: &output}}.Decorate(
+			http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				panic("expected")
+			}),
+		)
+	)
+
+	assert.Panics(func() { handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil)) })
+	assert.Contains(output.String(), "GET /test 500 0 ")
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/Comcast/webpa-common/health"
+	"github.com/Comcast/webpa-common/secure"
+	"strings"
+	"time"
+)
+
+// Decision is the outcome of authorizing a single request
+type Decision string
+
+const (
+	Allowed Decision = "Allowed"
+	Denied  Decision = "Denied"
+	Errored Decision = "Errored"
+)
+
+// Reasons recorded with authorization decisions
+const (
+	ReasonValid             = "valid"
+	ReasonMissingHeader     = "missing_header"
+	ReasonInvalidHeader     = "invalid_header"
+	ReasonUnsupportedScheme = "unsupported_scheme"
+	ReasonRejected          = "rejected"
+	ReasonValidationError   = "validation_error"
+	ReasonCancelled         = "cancelled"
+	ReasonAnonymous         = "anonymous"
+)
+
+const (
+	// AuthorizationStatsPrefix is the prefix of all health statistics produced by authorization
+	AuthorizationStatsPrefix = "Authorization"
+
+	// NoValidator is the validator label used when no validator was involved in a decision
+	NoValidator = "none"
+
+	// TotalAuthorizationAllowed is the health statistic counting all allowed requests
+	TotalAuthorizationAllowed health.Stat = AuthorizationStatsPrefix + health.Stat(Allowed)
+
+	// TotalAuthorizationDenied is the health statistic counting all denied requests
+	TotalAuthorizationDenied health.Stat = AuthorizationStatsPrefix + health.Stat(Denied)
+
+	// TotalAuthorizationErrored is the health statistic counting all requests whose validation produced an error
+	TotalAuthorizationErrored health.Stat = AuthorizationStatsPrefix + health.Stat(Errored)
+)
+
+// AuditEntry is the structured record of a single authorization decision
+type AuditEntry struct {
+	Time      time.Time
+	Method    string
+	Path      string
+	Scheme    secure.TokenType
+	Subject   string
+	Validator string
+	Decision  Decision
+	Reason    string
+	Latency   time.Duration
+}
+
+// AuditSink receives an AuditEntry for every request processed by an AuthorizationHandler.
+// Implementations must be safe for concurrent use, and should not retain the entry.
+type AuditSink interface {
+	Audit(*AuditEntry)
+}
+
+// AuditSinkFunc is a function type that implements AuditSink
+type AuditSinkFunc func(*AuditEntry)
+
+func (f AuditSinkFunc) Audit(entry *AuditEntry) {
+	f(entry)
+}
+
+// DecisionStat returns the labeled health statistic for a decision made by a given type
+// of validator for a given reason, e.g. "AuthorizationDenied[validator=secure.JWSValidator,reason=rejected]".
+func DecisionStat(decision Decision, validator, reason string) health.Stat {
+	return health.Stat(
+		fmt.Sprintf("%s%s[validator=%s,reason=%s]", AuthorizationStatsPrefix, decision, validator, reason),
+	)
+}
+
+// validatorType produces the label used for a validator in stats and audit entries
+func validatorType(validator secure.Validator) string {
+	if validator == nil {
+		return NoValidator
+	}
+
+	return strings.TrimPrefix(fmt.Sprintf("%T", validator), "*")
+}
+
+// subject extracts the subject claim, if any, from a token
+func subject(token *secure.Token) string {
+	if token != nil {
+		if claims := token.Claims(); claims != nil {
+			subject, _ := claims.Get("sub").(string)
+			return subject
+		}
+	}
+
+	return ""
+}
+
+// totalStat returns the unlabeled statistic for a decision
+func totalStat(decision Decision) health.Stat {
+	return AuthorizationStatsPrefix + health.Stat(decision)
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"errors"
+	"github.com/Comcast/webpa-common/health"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// testMonitor is a health.Monitor that simply accumulates stats
+type testMonitor struct {
+	lock  sync.Mutex
+	stats health.Stats
+}
+
+func (m *testMonitor) SendEvent(healthFunc health.HealthFunc) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.stats == nil {
+		m.stats = make(health.Stats)
+	}
+
+	healthFunc(m.stats)
+}
+
+func (m *testMonitor) ServeHTTP(http.ResponseWriter, *http.Request) {
+}
+
+func TestDecisionStat(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(
+		health.Stat("AuthorizationDenied[validator=secure.JWSValidator,reason=rejected]"),
+		DecisionStat(Denied, "secure.JWSValidator", ReasonRejected),
+	)
+
+	assert.Equal(TotalAuthorizationAllowed, totalStat(Allowed))
+	assert.Equal(TotalAuthorizationDenied, totalStat(Denied))
+	assert.Equal(TotalAuthorizationErrored, totalStat(Errored))
+}
+
+func TestValidatorType(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(NoValidator, validatorType(nil))
+	assert.Equal("secure.MockValidator", validatorType(&secure.MockValidator{}))
+	assert.Equal("secure.ExactMatchValidator", validatorType(secure.ExactMatchValidator("foo")))
+}
+
+func TestSubject(t *testing.T) {
+	assert := assert.New(t)
+	assert.Empty(subject(nil))
+	assert.Empty(subject(secure.NewSharedSecretToken("no claims here")))
+}
+
+func TestAuthorizationHandlerAudit(t *testing.T) {
+	var testData = []struct {
+		header             string
+		value              string
+		validator          secure.Validator
+		expectedDecision   Decision
+		expectedReason     string
+		expectedValidator  string
+		expectedScheme     secure.TokenType
+		expectedStatusCode int
+	}{
+		{"", "", nil, Denied, ReasonMissingHeader, NoValidator, "", http.StatusForbidden},
+		{secure.AuthorizationHeader, "Garbage", nil, Denied, ReasonInvalidHeader, NoValidator, "", http.StatusForbidden},
+		{"X-Shared-Secret", "secret", nil, Denied, ReasonUnsupportedScheme, NoValidator, secure.SharedSecret, http.StatusForbidden},
+		{secure.AuthorizationHeader, authorizationValue, secure.ExactMatchValidator("nope"), Denied, ReasonRejected, "secure.ExactMatchValidator", secure.Basic, http.StatusForbidden},
+		{secure.AuthorizationHeader, authorizationValue, secure.ExactMatchValidator(tokenValue), Allowed, ReasonValid, "secure.ExactMatchValidator", secure.Basic, 222},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+
+		var (
+			assert  = assert.New(t)
+			monitor = new(testMonitor)
+			entries []*AuditEntry
+
+			handler = AuthorizationHandler{
+				Validator:          secure.ExactMatchValidator("unused"),
+				SharedSecretHeader: "X-Shared-Secret",
+				Logger:             logging.TestLogger(t),
+				Monitor:            monitor,
+				AuditSink:          AuditSinkFunc(func(entry *AuditEntry) { entries = append(entries, entry) }),
+			}
+
+			request, _ = http.NewRequest("POST", "http://test.com/api/v2/device", nil)
+			response   = httptest.NewRecorder()
+
+			mockHttpHandler = &mockHttpHandler{}
+		)
+
+		if record.validator != nil {
+			handler.Validator = record.validator
+		}
+
+		if len(record.header) > 0 {
+			request.Header.Set(record.header, record.value)
+		}
+
+		if record.expectedDecision == Allowed {
+			mockHttpHandler.On("ServeHTTP", response, request).
+				Run(func(arguments mock.Arguments) {
+					arguments.Get(0).(http.ResponseWriter).WriteHeader(record.expectedStatusCode)
+				}).
+				Once()
+		}
+
+		handler.Decorate(mockHttpHandler).ServeHTTP(response, request)
+		assert.Equal(record.expectedStatusCode, response.Code)
+
+		if assert.Len(entries, 1) {
+			entry := entries[0]
+			assert.False(entry.Time.IsZero())
+			assert.Equal("POST", entry.Method)
+			assert.Equal("/api/v2/device", entry.Path)
+			assert.Equal(record.expectedScheme, entry.Scheme)
+			assert.Empty(entry.Subject)
+			assert.Equal(record.expectedValidator, entry.Validator)
+			assert.Equal(record.expectedDecision, entry.Decision)
+			assert.Equal(record.expectedReason, entry.Reason)
+			assert.True(entry.Latency >= 0)
+		}
+
+		assert.Equal(
+			health.Stats{
+				totalStat(record.expectedDecision): 1,
+				DecisionStat(record.expectedDecision, record.expectedValidator, record.expectedReason): 1,
+			},
+			monitor.stats,
+		)
+
+		mockHttpHandler.AssertExpectations(t)
+	}
+}
+
+func TestAuthorizationHandlerAuditError(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		monitor       = new(testMonitor)
+		entries       []*AuditEntry
+		mockValidator = &secure.MockValidator{}
+
+		handler = AuthorizationHandler{
+			Validator: mockValidator,
+			Logger:    logging.TestLogger(t),
+			Monitor:   monitor,
+			AuditSink: AuditSinkFunc(func(entry *AuditEntry) { entries = append(entries, entry) }),
+		}
+
+		request, _ = http.NewRequest("GET", "http://test.com/foo", nil)
+		response   = httptest.NewRecorder()
+	)
+
+	request.Header.Set(secure.AuthorizationHeader, authorizationValue)
+	mockValidator.On("Validate", mock.Anything, mock.Anything).Return(false, errors.New("expected")).Once()
+
+	handler.Decorate(&mockHttpHandler{}).ServeHTTP(response, request)
+	assert.Equal(http.StatusForbidden, response.Code)
+
+	if assert.Len(entries, 1) {
+		assert.Equal(Errored, entries[0].Decision)
+		assert.Equal(ReasonValidationError, entries[0].Reason)
+		assert.Equal("secure.MockValidator", entries[0].Validator)
+	}
+
+	assert.Equal(1, monitor.stats[TotalAuthorizationErrored])
+	assert.Equal(1, monitor.stats[DecisionStat(Errored, "secure.MockValidator", ReasonValidationError)])
+	mockValidator.AssertExpectations(t)
+}
@@ -2,11 +2,17 @@ package handler
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"github.com/Comcast/webpa-common/health"
 	"github.com/Comcast/webpa-common/logging"
 	"github.com/Comcast/webpa-common/secure"
+	"github.com/Comcast/webpa-common/tracing"
+	"github.com/Comcast/webpa-common/xmetrics"
 	"net/http"
 	"os"
+	"time"
 )
 
 const (
@@ -29,18 +35,77 @@ func WriteJsonError(response http.ResponseWriter, code int, message string) erro
 	response.Header().Set(ContentTypeOptionsHeader, NoSniff)
 
 	response.WriteHeader(code)
-	_, err := fmt.Fprintf(response, `{"message": "%s"}`, message)
+	encodedMessage, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(response, `{"message": %s}`, encodedMessage)
 	return err
 }
 
 // AuthorizationHandler provides decoration for http.Handler instances and will
 // ensure that requests pass the validator.  Note that secure.Validators is a Validator
 // implementation that allows chaining validators together via logical OR.
+//
+// Validators may also be registered per authentication scheme.  The scheme of each request's
+// token selects the validator from Validators, falling back to Validator if the scheme has no
+// registered validator.  When SharedSecretHeader is set, requests carrying that header are
+// authenticated with a secure.SharedSecret token made from the header's value, which takes
+// precedence over the authorization header.  Shared secrets are only ever checked by
+// Validators[secure.SharedSecret].  Similarly, when Validators has an entry for secure.ClientCertificate,
+// TLS requests without an authorization header are authenticated with a secure.ClientCertificate token
+// made from the peer's certificate, which is only ever checked by Validators[secure.ClientCertificate].
+//
+// Validators receive a Context derived from the request's Context.  If the client disconnects
+// during validation, the Context is cancelled and no response is written.
+//
+// If the request's Context carries a logger, as installed by a logging.RequestHandler, that logger
+// is used in place of Logger so that log output is correlated with the request.
+//
+// Each authorization decision is counted in the optional Monitor, both in total and labeled by
+// validator type and reason, and is written to the optional AuditSink as a structured AuditEntry.
+// Decisions and their latencies are also recorded in the metrics declared by Metrics, using the
+// optional MetricsProvider.
+//
+// Failed requests receive a response written by the ErrorEncoder.  If no ErrorEncoder is
+// configured, DefaultErrorEncoder is used.
+//
+// When ConcurrentValidation is set, any secure.Validators chain selected for a request is evaluated
+// as secure.ConcurrentValidators, i.e. all of its validators run at once and the first to approve the
+// token wins.  This is useful when a chain contains several slow, remote validators.
+//
+// When ValidatorSource is set, Validator and Validators are ignored.  Instead, each request takes the current
+// ValidatorSet from the source, which allows the validators to be swapped at runtime, e.g. by a ValidatorReloader.
+// A request is validated entirely by the set it started with, so in-flight requests are unaffected by a swap.
+//
+// Each authorization decision is recorded as an "authorization" span, using the tracing package's process-wide Tracer.
+// The span is a child of any trace context in the request's Context or, failing that, in its tracing.TraceParentHeader.
+// That trace context is passed along to the delegate in the request's Context.
+//
+// Requests matching any of the Bypass rules may omit credentials, e.g. for health checks or CORS preflight
+// requests.  Such requests are passed to the delegate and recorded as Allowed with ReasonAnonymous.  A bypassed
+// request which does carry credentials is still validated, so that its claims reach the delegate.
+//
+// When RecordPrincipal is set, the principal of each approved token is placed into the request's Context,
+// where the delegate can obtain it via secure.RequestPrincipal.
 type AuthorizationHandler struct {
-	HeaderName          string
-	ForbiddenStatusCode int
-	Validator           secure.Validator
-	Logger              logging.Logger
+	HeaderName           string
+	ForbiddenStatusCode  int
+	Validator            secure.Validator
+	Validators           map[secure.TokenType]secure.Validator
+	ValidatorSource      ValidatorSource
+	SharedSecretHeader   string
+	Logger               logging.Logger
+	Monitor              health.Monitor
+	AuditSink            AuditSink
+	ErrorEncoder         ErrorEncoder
+	ConcurrentValidation bool
+	MetricsProvider      xmetrics.Provider
+	Bypass               []BypassRule
+	RecordPrincipal      bool
+
+	measures *authorizationMeasures
 }
 
 // headerName returns the authorization header to use, either a.HeaderName
@@ -63,6 +128,55 @@ func (a AuthorizationHandler) forbiddenStatusCode() int {
 	return http.StatusForbidden
 }
 
+// current returns this handler with the validators in effect for a request.  If there is a ValidatorSource,
+// its current ValidatorSet replaces Validator and Validators.
+func (a AuthorizationHandler) current() AuthorizationHandler {
+	if a.ValidatorSource != nil {
+		a.Validator, a.Validators = nil, nil
+		if set := a.ValidatorSource.ValidatorSet(); set != nil {
+			a.Validator, a.Validators = set.Validator, set.Validators
+		}
+	}
+
+	return a
+}
+
+// validator returns the validator for the given token type, or nil if
+// no validator applies to that type.  Shared secrets and client certificates never fall back
+// to a.Validator, since that validator was not configured with them in mind.
+func (a AuthorizationHandler) validator(tokenType secure.TokenType) secure.Validator {
+	validator, ok := a.Validators[tokenType]
+	if !ok {
+		if tokenType == secure.SharedSecret || tokenType == secure.ClientCertificate {
+			return nil
+		}
+
+		validator = a.Validator
+	}
+
+	if chain, ok := validator.(secure.Validators); ok && a.ConcurrentValidation {
+		return secure.ConcurrentValidators(chain)
+	}
+
+	return validator
+}
+
+func (a AuthorizationHandler) errorEncoder() ErrorEncoder {
+	if a.ErrorEncoder != nil {
+		return a.ErrorEncoder
+	}
+
+	return DefaultErrorEncoder
+}
+
+func (a AuthorizationHandler) metricsProvider() xmetrics.Provider {
+	if a.MetricsProvider != nil {
+		return a.MetricsProvider
+	}
+
+	return xmetrics.NewDiscardProvider()
+}
+
 func (a AuthorizationHandler) logger() logging.Logger {
 	if a.Logger != nil {
 		return a.Logger
@@ -71,46 +185,184 @@ func (a AuthorizationHandler) logger() logging.Logger {
 	return &logging.LoggerWriter{os.Stdout}
 }
 
+// sharedSecret returns the value of the shared-secret header, if one is configured
+func (a AuthorizationHandler) sharedSecret(request *http.Request) string {
+	if len(a.SharedSecretHeader) > 0 {
+		return request.Header.Get(a.SharedSecretHeader)
+	}
+
+	return ""
+}
+
+// clientCertificate returns the TLS peer certificate of the request, if a validator
+// is registered for client certificates
+func (a AuthorizationHandler) clientCertificate(request *http.Request) *x509.Certificate {
+	if _, ok := a.Validators[secure.ClientCertificate]; ok && request.TLS != nil && len(request.TLS.PeerCertificates) > 0 {
+		return request.TLS.PeerCertificates[0]
+	}
+
+	return nil
+}
+
+// record publishes an authorization decision to the request's span along with the configured monitor,
+// metrics, and audit sink, if any.  The span is finished.
+func (a AuthorizationHandler) record(request *http.Request, span tracing.Span, start time.Time, token *secure.Token, validator secure.Validator, decision Decision, reason string) {
+	validatorLabel := validatorType(validator)
+	span.SetTag(DecisionLabel, string(decision))
+	span.SetTag(ValidatorLabel, validatorLabel)
+	span.SetTag(ReasonLabel, reason)
+	span.Finish()
+
+	if a.measures != nil {
+		a.measures.decisions.With(DecisionLabel, string(decision), ValidatorLabel, validatorLabel, ReasonLabel, reason).Add(1)
+		a.measures.latency.With(DecisionLabel, string(decision)).Observe(time.Since(start).Seconds())
+	}
+
+	if a.Monitor != nil {
+		a.Monitor.SendEvent(health.Inc(totalStat(decision), 1))
+		a.Monitor.SendEvent(health.Inc(DecisionStat(decision, validatorLabel, reason), 1))
+	}
+
+	if a.AuditSink != nil {
+		entry := &AuditEntry{
+			Time:      start,
+			Method:    request.Method,
+			Path:      request.URL.Path,
+			Subject:   subject(token),
+			Validator: validatorLabel,
+			Decision:  decision,
+			Reason:    reason,
+			Latency:   time.Since(start),
+		}
+
+		if token != nil {
+			entry.Scheme = token.Type()
+		}
+
+		a.AuditSink.Audit(entry)
+	}
+}
+
+// validationContext produces the Context passed to validators.  The Context derives from the request's
+// Context, so that deadlines, tracing information, and cancellation when the client disconnects all propagate
+// through the validator chain.  The request's method, path, remote address, and request ID, along with the token and
+// any TLS connection state, are available to validators via secure.RequestMethod, secure.RequestPath, secure.RequestRemoteAddr,
+// secure.RequestID, secure.GetToken, and secure.GetConnectionState.  Validators which need the entire request can use
+// secure.GetHTTPRequest.
+func validationContext(request *http.Request, token *secure.Token) context.Context {
+	ctx := secure.WithToken(
+		secure.WithHTTPRequest(
+			secure.WithRequest(request.Context(), request.Method, request.URL.Path),
+			request,
+		),
+		token,
+	)
+
+	ctx = secure.WithRemoteAddr(ctx, request.RemoteAddr)
+	if requestID, ok := logging.GetRequestID(request.Context()); ok {
+		ctx = secure.WithRequestID(ctx, requestID)
+	}
+
+	if request.TLS != nil {
+		ctx = secure.WithConnectionState(ctx, request.TLS)
+	}
+
+	return ctx
+}
+
 // Decorate provides an Alice-compatible constructor that validates requests
 // using the configuration specified.
 func (a AuthorizationHandler) Decorate(delegate http.Handler) http.Handler {
 	// if there is no validator, there's no point in decorating anything
-	if a.Validator == nil {
+	if a.ValidatorSource == nil && a.Validator == nil && len(a.Validators) == 0 {
 		return delegate
 	}
 
 	headerName := a.headerName()
 	forbiddenStatusCode := a.forbiddenStatusCode()
+	errorEncoder := a.errorEncoder()
 	logger := a.logger()
+	a.measures = newAuthorizationMeasures(a.metricsProvider())
 
 	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
-		headerValue := request.Header.Get(headerName)
-		if len(headerValue) == 0 {
-			message := fmt.Sprintf("No %s header", headerName)
-			logger.Error(message)
-			WriteJsonError(response, forbiddenStatusCode, message)
-			return
+		start := time.Now()
+		logger := logging.PrintfFromContext(request.Context(), logger)
+
+		// the authorization span is a sibling of whatever the delegate does, so only the incoming trace context is passed along
+		if ctx := tracing.RequestContext(request); ctx != request.Context() {
+			request = request.WithContext(ctx)
 		}
 
-		token, err := secure.ParseAuthorization(headerValue)
-		if err != nil {
-			message := fmt.Sprintf("Invalid authorization header [%s]: %s", headerName, err.Error())
-			logger.Error(message)
-			WriteJsonError(response, forbiddenStatusCode, message)
-			return
+		span, _ := tracing.StartSpan(request.Context(), "authorization")
+
+		// the validators are fixed for the duration of this request, even if the source swaps them
+		a := a.current()
+
+		var token *secure.Token
+		if sharedSecret := a.sharedSecret(request); len(sharedSecret) > 0 {
+			token = secure.NewSharedSecretToken(sharedSecret)
+		} else {
+			headerValue := request.Header.Get(headerName)
+			if len(headerValue) > 0 {
+				var err error
+				token, err = secure.ParseAuthorization(headerValue)
+				if err != nil {
+					err = fmt.Errorf("Invalid authorization header [%s]: %s", headerName, err.Error())
+					logger.Error(err.Error())
+					a.record(request, span, start, nil, nil, Denied, ReasonInvalidHeader)
+					errorEncoder(request.Context(), forbiddenStatusCode, err, response)
+					return
+				}
+			} else if certificate := a.clientCertificate(request); certificate != nil {
+				token = secure.NewClientCertificateToken(certificate)
+			} else if bypassed(a.Bypass, request) {
+				a.record(request, span, start, nil, nil, Allowed, ReasonAnonymous)
+				delegate.ServeHTTP(response, request)
+				return
+			} else {
+				err := fmt.Errorf("No %s header", headerName)
+				logger.Error(err.Error())
+				a.record(request, span, start, nil, nil, Denied, ReasonMissingHeader)
+				errorEncoder(request.Context(), forbiddenStatusCode, err, response)
+				return
+			}
 		}
 
-		ctx := context.Background()
-		ctx = context.WithValue(ctx, "method", request.Method)
-		ctx = context.WithValue(ctx, "path", request.URL.Path)
+		validator := a.validator(token.Type())
+		if validator == nil {
+			err := fmt.Errorf("Unsupported authorization scheme: %s", token.Type())
+			logger.Error(err.Error())
+			a.record(request, span, start, token, nil, Denied, ReasonUnsupportedScheme)
+			errorEncoder(request.Context(), forbiddenStatusCode, err, response)
+			return
+		}
 
-		valid, err := a.Validator.Validate(ctx, token)
-		if err != nil {
+		valid, err := validator.Validate(validationContext(request, token), token)
+		if err != nil && request.Context().Err() == context.Canceled {
+			// the client has gone away, so there's no one to send a response to
+			logger.Debug("Validation cancelled: %s", err.Error())
+			a.record(request, span, start, token, validator, Errored, ReasonCancelled)
+			return
+		} else if err != nil {
 			logger.Error("Validation error: %s", err.Error())
+			span.SetError(err)
+			a.record(request, span, start, token, validator, Errored, ReasonValidationError)
 		} else if valid {
+			a.record(request, span, start, token, validator, Allowed, ReasonValid)
+
 			// if any validator approves, stop and invoke the delegate
+			if claims := token.Claims(); claims != nil {
+				request = request.WithContext(secure.WithClaims(claims, request.Context()))
+			}
+
+			if principal := token.Principal(); a.RecordPrincipal && len(principal) > 0 {
+				request = request.WithContext(secure.WithPrincipal(request.Context(), principal))
+			}
+
 			delegate.ServeHTTP(response, request)
 			return
+		} else {
+			a.record(request, span, start, token, validator, Denied, ReasonRejected)
 		}
 
 		reqLogMsg := fmt.Sprintf("Request {Method: %s, URL: %s, User-Agent: %s, ContentLength: %d, RemoteAddr: %s}",
@@ -118,6 +370,6 @@ func (a AuthorizationHandler) Decorate(delegate http.Handler) http.Handler {
 		                         request.ContentLength, request.RemoteAddr)
 
 		logger.Error("Request denied: %s", reqLogMsg)
-		response.WriteHeader(forbiddenStatusCode)
+		errorEncoder(request.Context(), forbiddenStatusCode, ErrorRequestDenied, response)
 	})
 }
@@ -2,13 +2,18 @@ package handler
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Comcast/webpa-common/logging"
 	"github.com/Comcast/webpa-common/secure"
+	"github.com/Comcast/webpa-common/tracing"
+	"github.com/Comcast/webpa-common/tracing/tracingtest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -126,6 +131,74 @@ func TestAuthorizationHandlerNoAuthorizationHeader(t *testing.T) {
 	}
 }
 
+func TestAuthorizationHandlerBypass(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		require   = require.New(t)
+		rules, _  = ParseBypassRules([]string{"GET /health", "OPTIONS *"})
+		validator = &secure.MockValidator{}
+		entries   []*AuditEntry
+
+		handler = AuthorizationHandler{
+			Validator: validator,
+			Bypass:    rules,
+			Logger:    &logging.LoggerWriter{Writer: ioutil.Discard},
+			AuditSink: AuditSinkFunc(func(entry *AuditEntry) { entries = append(entries, entry) }),
+		}
+	)
+
+	require.Len(rules, 2)
+
+	for _, request := range []*http.Request{
+		httptest.NewRequest("GET", "/health", nil),
+		httptest.NewRequest("OPTIONS", "/api/v2/device", nil),
+	} {
+		entries = nil
+		response := httptest.NewRecorder()
+		mockHttpHandler := &mockHttpHandler{}
+		mockHttpHandler.On("ServeHTTP", response, request).
+			Run(func(arguments mock.Arguments) {
+				arguments.Get(0).(http.ResponseWriter).WriteHeader(http.StatusNoContent)
+			}).
+			Once()
+
+		handler.Decorate(mockHttpHandler).ServeHTTP(response, request)
+		assert.Equal(http.StatusNoContent, response.Code)
+		mockHttpHandler.AssertExpectations(t)
+
+		require.Len(entries, 1)
+		assert.Equal(Allowed, entries[0].Decision)
+		assert.Equal(ReasonAnonymous, entries[0].Reason)
+		assert.Equal(NoValidator, entries[0].Validator)
+	}
+
+	// requests not matching any rule still require credentials
+	for _, request := range []*http.Request{
+		httptest.NewRequest("POST", "/health", nil),
+		httptest.NewRequest("GET", "/health/ready", nil),
+	} {
+		response := httptest.NewRecorder()
+		mockHttpHandler := &mockHttpHandler{}
+
+		handler.Decorate(mockHttpHandler).ServeHTTP(response, request)
+		assert.Equal(http.StatusForbidden, response.Code)
+		mockHttpHandler.AssertExpectations(t)
+	}
+
+	// credentials supplied to a bypassed path are still validated
+	request := httptest.NewRequest("GET", "/health", nil)
+	request.Header.Set(secure.AuthorizationHeader, authorizationValue)
+	token, _ := secure.ParseAuthorization(authorizationValue)
+	validator.On("Validate", validationContext(request, token), token).Return(false, nil).Once()
+
+	response := httptest.NewRecorder()
+	mockHttpHandler := &mockHttpHandler{}
+	handler.Decorate(mockHttpHandler).ServeHTTP(response, request)
+	assert.Equal(http.StatusForbidden, response.Code)
+	validator.AssertExpectations(t)
+	mockHttpHandler.AssertExpectations(t)
+}
+
 func TestAuthorizationHandlerInvalidAuthorizationHeader(t *testing.T) {
 	assert := assert.New(t)
 	customLogger := &logging.LoggerWriter{ioutil.Discard}
@@ -215,10 +288,8 @@ func TestAuthorizationHandlerSuccess(t *testing.T) {
 		request.Header.Set(record.headerName, authorizationValue)
 		response := httptest.NewRecorder()
 
-		ctx := context.Background()
-		ctx = context.WithValue(ctx, "method", request.Method)
-		ctx = context.WithValue(ctx, "path", request.URL.Path)
 		token, _ := secure.ParseAuthorization(authorizationValue)
+		ctx := validationContext(request, token)
 		mockValidator.On("Validate", ctx, token).Return(true, nil).Once()
 
 		mockHttpHandler := &mockHttpHandler{}
@@ -274,10 +345,8 @@ func TestAuthorizationHandlerFailure(t *testing.T) {
 		request, _ := http.NewRequest("GET", "http://test.com/foo", nil)
 		request.Header.Set(record.headerName, authorizationValue)
 
-		ctx := context.Background()
-		ctx = context.WithValue(ctx, "method", request.Method)
-		ctx = context.WithValue(ctx, "path", request.URL.Path)
 		token, _ := secure.ParseAuthorization(authorizationValue)
+		ctx := validationContext(request, token)
 		mockValidator.On("Validate", ctx, token).Return(false, errors.New("expected")).Once()
 
 		response := httptest.NewRecorder()
@@ -291,4 +360,413 @@ func TestAuthorizationHandlerFailure(t *testing.T) {
 		mockValidator.AssertExpectations(t)
 		mockHttpHandler.AssertExpectations(t)
 	}
-}
\ No newline at end of file
+}
+
+func TestAuthorizationHandlerSchemes(t *testing.T) {
+	const sharedSecretHeader = "X-Shared-Secret"
+
+	var testData = []struct {
+		header             string
+		value              string
+		expectedStatusCode int
+	}{
+		{secure.AuthorizationHeader, authorizationValue, 222},
+		{secure.AuthorizationHeader, "Basic cmVqZWN0bWU6cmVqZWN0ZWQK", http.StatusForbidden},
+		{secure.AuthorizationHeader, "Bearer a.jwt.value", 222},
+		{secure.AuthorizationHeader, "Bearer another.jwt.value", http.StatusForbidden},
+		{secure.AuthorizationHeader, "Digest some digest", http.StatusForbidden},
+		{sharedSecretHeader, "the shared secret", 222},
+		{sharedSecretHeader, "the wrong secret", http.StatusForbidden},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+
+		var (
+			assert  = assert.New(t)
+			handler = AuthorizationHandler{
+				Validators: map[secure.TokenType]secure.Validator{
+					secure.Basic:        secure.ExactMatchValidator(tokenValue),
+					secure.Bearer:       secure.ExactMatchValidator("a.jwt.value"),
+					secure.SharedSecret: secure.ExactMatchValidator("the shared secret"),
+				},
+				SharedSecretHeader: sharedSecretHeader,
+				Logger:             logging.TestLogger(t),
+			}
+
+			request, _ = http.NewRequest("GET", "http://test.com/foo", nil)
+			response   = httptest.NewRecorder()
+
+			mockHttpHandler = &mockHttpHandler{}
+		)
+
+		request.Header.Set(record.header, record.value)
+		if record.expectedStatusCode != http.StatusForbidden {
+			mockHttpHandler.On("ServeHTTP", response, request).
+				Run(func(arguments mock.Arguments) {
+					response := arguments.Get(0).(http.ResponseWriter)
+					response.WriteHeader(record.expectedStatusCode)
+				}).
+				Once()
+		}
+
+		decorated := handler.Decorate(mockHttpHandler)
+		assert.NotNil(decorated)
+		decorated.ServeHTTP(response, request)
+		assert.Equal(record.expectedStatusCode, response.Code)
+
+		mockHttpHandler.AssertExpectations(t)
+	}
+}
+
+func TestAuthorizationHandlerSchemeFallback(t *testing.T) {
+	const sharedSecretHeader = "X-Shared-Secret"
+
+	var testData = []struct {
+		header             string
+		value              string
+		expectedStatusCode int
+	}{
+		{secure.AuthorizationHeader, authorizationValue, 222},
+		{secure.AuthorizationHeader, "Bearer " + tokenValue, 222},
+		{sharedSecretHeader, tokenValue, http.StatusForbidden},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+
+		var (
+			assert  = assert.New(t)
+			handler = AuthorizationHandler{
+				Validator:          secure.ExactMatchValidator(tokenValue),
+				SharedSecretHeader: sharedSecretHeader,
+				Logger:             logging.TestLogger(t),
+			}
+
+			request, _ = http.NewRequest("GET", "http://test.com/foo", nil)
+			response   = httptest.NewRecorder()
+
+			mockHttpHandler = &mockHttpHandler{}
+		)
+
+		request.Header.Set(record.header, record.value)
+		if record.expectedStatusCode != http.StatusForbidden {
+			mockHttpHandler.On("ServeHTTP", response, request).
+				Run(func(arguments mock.Arguments) {
+					response := arguments.Get(0).(http.ResponseWriter)
+					response.WriteHeader(record.expectedStatusCode)
+				}).
+				Once()
+		}
+
+		decorated := handler.Decorate(mockHttpHandler)
+		assert.NotNil(decorated)
+		decorated.ServeHTTP(response, request)
+		assert.Equal(record.expectedStatusCode, response.Code)
+
+		mockHttpHandler.AssertExpectations(t)
+	}
+}
+
+func TestAuthorizationHandlerValidatorConcurrency(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		chain  = secure.Validators{secure.ExactMatchValidator("nomatch"), secure.ExactMatchValidator(tokenValue)}
+		single = secure.ExactMatchValidator(tokenValue)
+	)
+
+	assert.Equal(chain, AuthorizationHandler{Validator: chain}.validator(secure.Basic))
+	assert.Equal(secure.ConcurrentValidators(chain), AuthorizationHandler{Validator: chain, ConcurrentValidation: true}.validator(secure.Basic))
+	assert.Equal(
+		secure.ConcurrentValidators(chain),
+		AuthorizationHandler{
+			Validators:           map[secure.TokenType]secure.Validator{secure.SharedSecret: chain},
+			ConcurrentValidation: true,
+		}.validator(secure.SharedSecret),
+	)
+
+	assert.Equal(single, AuthorizationHandler{Validator: single, ConcurrentValidation: true}.validator(secure.Basic))
+	assert.Nil(AuthorizationHandler{Validator: chain, ConcurrentValidation: true}.validator(secure.SharedSecret))
+}
+
+func TestAuthorizationHandlerConcurrentValidation(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		handler = AuthorizationHandler{
+			Validator: secure.Validators{
+				secure.ValidatorFunc(func(ctx context.Context, token *secure.Token) (bool, error) {
+					<-ctx.Done()
+					return false, ctx.Err()
+				}),
+				secure.ExactMatchValidator(tokenValue),
+			},
+			ConcurrentValidation: true,
+			Logger:               logging.TestLogger(t),
+		}
+
+		request, _ = http.NewRequest("GET", "http://test.com/foo", nil)
+		response   = httptest.NewRecorder()
+
+		mockHttpHandler = &mockHttpHandler{}
+	)
+
+	request.Header.Set(secure.AuthorizationHeader, authorizationValue)
+	mockHttpHandler.On("ServeHTTP", response, request).
+		Run(func(arguments mock.Arguments) {
+			response := arguments.Get(0).(http.ResponseWriter)
+			response.WriteHeader(222)
+		}).
+		Once()
+
+	handler.Decorate(mockHttpHandler).ServeHTTP(response, request)
+	assert.Equal(222, response.Code)
+	mockHttpHandler.AssertExpectations(t)
+}
+
+func TestAuthorizationHandlerRequestContext(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		handler = AuthorizationHandler{
+			Validator: secure.ValidatorFunc(func(ctx context.Context, token *secure.Token) (bool, error) {
+				assert.Equal("value", ctx.Value("parent"))
+				assert.Equal("GET", secure.RequestMethod(ctx))
+				assert.Equal("/foo", secure.RequestPath(ctx))
+				assert.Equal("10.0.0.1:1234", secure.RequestRemoteAddr(ctx))
+				assert.Equal("abc123", secure.RequestID(ctx))
+
+				actual, ok := secure.GetToken(ctx)
+				assert.True(ok)
+				assert.Equal(token, actual)
+
+				httpRequest, ok := secure.GetHTTPRequest(ctx)
+				assert.True(ok)
+				assert.Equal("test.com", httpRequest.Host)
+				return true, nil
+			}),
+			Logger: logging.TestLogger(t),
+		}
+
+		request, _ = http.NewRequest("GET", "http://test.com/foo", nil)
+		response   = httptest.NewRecorder()
+
+		mockHttpHandler = &mockHttpHandler{}
+	)
+
+	request = request.WithContext(
+		logging.WithRequestID(context.WithValue(request.Context(), "parent", "value"), "abc123"),
+	)
+
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Set(secure.AuthorizationHeader, authorizationValue)
+	mockHttpHandler.On("ServeHTTP", response, request).Once()
+
+	handler.Decorate(mockHttpHandler).ServeHTTP(response, request)
+	mockHttpHandler.AssertExpectations(t)
+}
+
+func TestAuthorizationHandlerRecordPrincipal(t *testing.T) {
+	for _, recordPrincipal := range []bool{false, true} {
+		t.Run(fmt.Sprintf("RecordPrincipal=%t", recordPrincipal), func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				handler = AuthorizationHandler{
+					Validator:       secure.ExactMatchValidator(tokenValue),
+					Logger:          logging.TestLogger(t),
+					RecordPrincipal: recordPrincipal,
+				}
+
+				request   = httptest.NewRequest("GET", "/foo", nil)
+				response  = httptest.NewRecorder()
+				principal string
+			)
+
+			request.Header.Set(secure.AuthorizationHeader, authorizationValue)
+			handler.Decorate(http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+				principal = secure.RequestPrincipal(request.Context())
+			})).ServeHTTP(response, request)
+
+			if recordPrincipal {
+				assert.Equal("test", principal)
+			} else {
+				assert.Empty(principal)
+			}
+		})
+	}
+}
+
+func TestAuthorizationHandlerClientDisconnect(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		ctx, cancel = context.WithCancel(context.Background())
+		entries     []*AuditEntry
+
+		handler = AuthorizationHandler{
+			Validator: secure.ValidatorFunc(func(ctx context.Context, token *secure.Token) (bool, error) {
+				// simulate the client disconnecting during a slow validation
+				cancel()
+				<-ctx.Done()
+				return false, ctx.Err()
+			}),
+			Logger: logging.TestLogger(t),
+			AuditSink: AuditSinkFunc(func(entry *AuditEntry) {
+				entries = append(entries, entry)
+			}),
+		}
+
+		request, _ = http.NewRequest("GET", "http://test.com/foo", nil)
+		response   = httptest.NewRecorder()
+
+		mockHttpHandler = &mockHttpHandler{}
+	)
+
+	request = request.WithContext(ctx)
+	request.Header.Set(secure.AuthorizationHeader, authorizationValue)
+
+	handler.Decorate(mockHttpHandler).ServeHTTP(response, request)
+	assert.Empty(response.Body.String())
+	mockHttpHandler.AssertExpectations(t)
+
+	if assert.Len(entries, 1) {
+		assert.Equal(Errored, entries[0].Decision)
+		assert.Equal(ReasonCancelled, entries[0].Reason)
+	}
+}
+
+func TestAuthorizationHandlerClientCertificate(t *testing.T) {
+	var (
+		certificate = &x509.Certificate{Raw: []byte("test certificate")}
+		state       = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}}
+	)
+
+	var testData = []struct {
+		state              *tls.ConnectionState
+		validators         map[secure.TokenType]secure.Validator
+		expectedStatusCode int
+	}{
+		{state, nil, http.StatusForbidden},
+		{nil, map[secure.TokenType]secure.Validator{secure.ClientCertificate: secure.ExactMatchValidator("unused")}, http.StatusForbidden},
+		{&tls.ConnectionState{}, map[secure.TokenType]secure.Validator{secure.ClientCertificate: secure.ExactMatchValidator("unused")}, http.StatusForbidden},
+		{
+			state,
+			map[secure.TokenType]secure.Validator{
+				secure.ClientCertificate: secure.ValidatorFunc(func(ctx context.Context, token *secure.Token) (bool, error) {
+					actual, ok := secure.GetConnectionState(ctx)
+					return ok && actual == state && token.Type() == secure.ClientCertificate, nil
+				}),
+			},
+			222,
+		},
+		{
+			state,
+			map[secure.TokenType]secure.Validator{
+				secure.ClientCertificate: secure.ValidatorFunc(func(context.Context, *secure.Token) (bool, error) {
+					return false, nil
+				}),
+			},
+			http.StatusForbidden,
+		},
+	}
+
+	for index, record := range testData {
+		t.Logf("%d", index)
+
+		var (
+			assert  = assert.New(t)
+			handler = AuthorizationHandler{
+				Validator:  secure.ExactMatchValidator(tokenValue),
+				Validators: record.validators,
+				Logger:     logging.TestLogger(t),
+			}
+
+			request, _ = http.NewRequest("GET", "https://test.com/foo", nil)
+			response   = httptest.NewRecorder()
+
+			mockHttpHandler = &mockHttpHandler{}
+		)
+
+		request.TLS = record.state
+		if record.expectedStatusCode != http.StatusForbidden {
+			mockHttpHandler.On("ServeHTTP", response, request).
+				Run(func(arguments mock.Arguments) {
+					response := arguments.Get(0).(http.ResponseWriter)
+					response.WriteHeader(record.expectedStatusCode)
+				}).
+				Once()
+		}
+
+		handler.Decorate(mockHttpHandler).ServeHTTP(response, request)
+		assert.Equal(record.expectedStatusCode, response.Code)
+		mockHttpHandler.AssertExpectations(t)
+	}
+
+	// client certificates never fall back to the default validator
+	assert.Nil(t, AuthorizationHandler{Validator: secure.ExactMatchValidator(tokenValue)}.validator(secure.ClientCertificate))
+}
+
+func TestAuthorizationHandlerRequestLogger(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		messages []string
+		handler  = AuthorizationHandler{
+			Validator: secure.ExactMatchValidator(tokenValue),
+			Logger:    logging.TestLogger(t),
+		}
+
+		requestLogger = logging.StructuredLoggerFunc(func(level logging.Level, message string, keyvals []interface{}) {
+			messages = append(messages, message)
+		})
+
+		request, _ = http.NewRequest("GET", "http://test.com/foo", nil)
+		response   = httptest.NewRecorder()
+	)
+
+	request = request.WithContext(logging.WithLogger(request.Context(), requestLogger))
+	handler.Decorate(new(mockHttpHandler)).ServeHTTP(response, request)
+	assert.Equal(http.StatusForbidden, response.Code)
+	assert.Equal([]string{"No Authorization header"}, messages)
+}
+
+func TestAuthorizationHandlerTracing(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		tracer  = tracingtest.NewTracer()
+		remote  = tracing.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}
+		handler = AuthorizationHandler{
+			Validator: secure.ExactMatchValidator(tokenValue),
+			Logger:    logging.TestLogger(t),
+		}
+
+		delegateContext tracing.SpanContext
+		decorated       = handler.Decorate(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			delegateContext = tracing.SpanContextFromContext(request.Context())
+		}))
+	)
+
+	defer tracer.Install()()
+
+	request, _ := http.NewRequest("GET", "http://test.com/foo", nil)
+	request.Header.Set(secure.AuthorizationHeader, "Basic "+tokenValue)
+	tracing.InjectHeader(remote, request.Header)
+	decorated.ServeHTTP(httptest.NewRecorder(), request)
+
+	// the delegate continues the incoming trace
+	assert.Equal(remote, delegateContext)
+
+	request, _ = http.NewRequest("GET", "http://test.com/foo", nil)
+	decorated.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := tracer.Spans()
+	if assert.Len(spans, 2) {
+		assert.Equal("authorization", spans[0].Name)
+		assert.Equal(remote, spans[0].Parent)
+		assert.Equal(string(Allowed), spans[0].Tags[DecisionLabel])
+		assert.Equal(ReasonValid, spans[0].Tags[ReasonLabel])
+		assert.True(spans[0].Finished)
+
+		assert.Equal("authorization", spans[1].Name)
+		assert.False(spans[1].Parent.IsValid())
+		assert.Equal(string(Denied), spans[1].Tags[DecisionLabel])
+		assert.Equal(ReasonMissingHeader, spans[1].Tags[ReasonLabel])
+		assert.True(spans[1].Finished)
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// AnyPath is the pattern of a BypassRule which matches every path
+const AnyPath = "*"
+
+// BypassRule is a compiled matcher for requests which an AuthorizationHandler admits without credentials,
+// such as health checks or CORS preflight requests.
+type BypassRule struct {
+	// Methods is the set of HTTP methods, in upper case, matched by this rule.  If empty, all methods match.
+	Methods map[string]bool
+
+	// Path is matched against the entire URL path of requests.  If nil, all paths match.
+	Path *regexp.Regexp
+}
+
+// Matches tests if a request is exempted from authorization by this rule
+func (r BypassRule) Matches(request *http.Request) bool {
+	if len(r.Methods) > 0 && !r.Methods[request.Method] {
+		return false
+	}
+
+	return r.Path == nil || r.Path.MatchString(request.URL.Path)
+}
+
+// ParseBypassRule compiles a rule of the form "[METHOD[,METHOD...]] PATH", e.g. "GET /health" or "OPTIONS *".
+// The PATH is a regular expression which must match the entire URL path, or AnyPath to match all paths.  When no
+// methods are given, the rule applies to every method.
+func ParseBypassRule(value string) (BypassRule, error) {
+	var (
+		rule   BypassRule
+		fields = strings.Fields(value)
+		path   string
+	)
+
+	switch len(fields) {
+	case 1:
+		path = fields[0]
+	case 2:
+		rule.Methods = make(map[string]bool)
+		for _, method := range strings.Split(fields[0], ",") {
+			if method = strings.TrimSpace(method); len(method) > 0 {
+				rule.Methods[strings.ToUpper(method)] = true
+			}
+		}
+
+		path = fields[1]
+	default:
+		return BypassRule{}, fmt.Errorf("Invalid bypass rule: %s", value)
+	}
+
+	if path != AnyPath {
+		pattern, err := regexp.Compile("^(?:" + path + ")$")
+		if err != nil {
+			return BypassRule{}, fmt.Errorf("Invalid bypass rule path [%s]: %s", path, err)
+		}
+
+		rule.Path = pattern
+	}
+
+	return rule, nil
+}
+
+// ParseBypassRules compiles a list of rules, as with ParseBypassRule
+func ParseBypassRules(values []string) ([]BypassRule, error) {
+	rules := make([]BypassRule, 0, len(values))
+	for _, value := range values {
+		rule, err := ParseBypassRule(value)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// bypassed tests if any of a list of rules exempts a request from authorization
+func bypassed(rules []BypassRule, request *http.Request) bool {
+	for _, rule := range rules {
+		if rule.Matches(request) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBypassRule(t *testing.T) {
+	testData := []struct {
+		rule     string
+		method   string
+		path     string
+		expected bool
+	}{
+		{"GET /health", "GET", "/health", true},
+		{"GET /health", "get", "/health", false},
+		{"GET /health", "POST", "/health", false},
+		{"GET /health", "GET", "/health/ready", false},
+		{"GET /health", "GET", "/api/health", false},
+		{"get,HEAD /health(/.*)?", "HEAD", "/health/ready", true},
+		{"get,HEAD /health(/.*)?", "GET", "/health", true},
+		{"get,HEAD /health(/.*)?", "GET", "/healthy", false},
+		{"OPTIONS *", "OPTIONS", "/api/v2/device", true},
+		{"OPTIONS *", "GET", "/api/v2/device", false},
+		{"/metrics", "GET", "/metrics", true},
+		{"/metrics", "DELETE", "/metrics", true},
+		{"*", "PUT", "/anything", true},
+	}
+
+	for _, record := range testData {
+		t.Run(record.rule, func(t *testing.T) {
+			rule, err := ParseBypassRule(record.rule)
+			require.NoError(t, err)
+			assert.Equal(t, record.expected, rule.Matches(httptest.NewRequest(record.method, record.path, nil)), "%s %s", record.method, record.path)
+		})
+	}
+}
+
+func TestParseBypassRuleInvalid(t *testing.T) {
+	for _, value := range []string{"", "   ", "GET /health extra", "GET /health(", "["} {
+		t.Run(value, func(t *testing.T) {
+			rule, err := ParseBypassRule(value)
+			assert.Error(t, err)
+			assert.Equal(t, BypassRule{}, rule)
+		})
+	}
+}
+
+func TestParseBypassRules(t *testing.T) {
+	assert := assert.New(t)
+
+	rules, err := ParseBypassRules([]string{"GET /health", "OPTIONS *"})
+	assert.NoError(err)
+	assert.Len(rules, 2)
+	assert.True(bypassed(rules, httptest.NewRequest("GET", "/health", nil)))
+	assert.True(bypassed(rules, httptest.NewRequest("OPTIONS", "/foo", nil)))
+	assert.False(bypassed(rules, httptest.NewRequest("GET", "/foo", nil)))
+	assert.False(bypassed(nil, httptest.NewRequest("GET", "/health", nil)))
+
+	rules, err = ParseBypassRules([]string{"GET /health", "GET ("})
+	assert.Nil(rules)
+	assert.Error(err)
+}
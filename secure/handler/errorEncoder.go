@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Comcast/webpa-common/httperror"
+)
+
+var (
+	// ErrorRequestDenied is the error passed to an ErrorEncoder when a token fails validation.
+	// Details of validation failures are logged rather than sent to clients.  Its Kind is httperror.ValidatorRejected.
+	ErrorRequestDenied = error(httperror.New(httperror.ValidatorRejected, "Request denied"))
+)
+
+// ErrorEncoder writes an error response for a request that failed authorization.  The statusCode
+// is the code configured on the AuthorizationHandler, and ctx is the request's context.  Implementations
+// are free to write whatever envelope a service uses for errors, along with any headers such as WWW-Authenticate.
+type ErrorEncoder func(ctx context.Context, statusCode int, err error, response http.ResponseWriter)
+
+// DefaultErrorEncoder is the ErrorEncoder used when none is configured.  It writes the
+// error's message via WriteJsonError.
+func DefaultErrorEncoder(_ context.Context, statusCode int, err error, response http.ResponseWriter) {
+	WriteJsonError(response, statusCode, err.Error())
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteJsonErrorEscaping(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, expectedMessage := range []string{"", "simple", `has "quotes"`, "has\nnewline and \\ backslash"} {
+		t.Logf("%q", expectedMessage)
+		response := httptest.NewRecorder()
+		assert.NoError(WriteJsonError(response, 418, expectedMessage))
+		assert.Equal(418, response.Code)
+		assert.Equal(JsonContentType, response.HeaderMap.Get(ContentTypeHeader))
+		assert.Equal(NoSniff, response.HeaderMap.Get(ContentTypeOptionsHeader))
+
+		var body map[string]string
+		assert.NoError(json.Unmarshal(response.Body.Bytes(), &body))
+		assert.Equal(expectedMessage, body["message"])
+	}
+}
+
+func TestDefaultErrorEncoder(t *testing.T) {
+	assert := assert.New(t)
+	response := httptest.NewRecorder()
+	DefaultErrorEncoder(context.Background(), 599, errors.New(`a "quoted" error`), response)
+	assert.Equal(599, response.Code)
+
+	var body map[string]string
+	assert.NoError(json.Unmarshal(response.Body.Bytes(), &body))
+	assert.Equal(`a "quoted" error`, body["message"])
+}
+
+func TestAuthorizationHandlerErrorEncoder(t *testing.T) {
+	var testData = []struct {
+		header        string
+		value         string
+		expectedError string
+	}{
+		{"", "", "No Authorization header"},
+		{secure.AuthorizationHeader, `Bad "token"`, `Invalid authorization header [Authorization]: Invalid authorization: Bad "token"`},
+		{secure.AuthorizationHeader, "Digest foo", "Unsupported authorization scheme: Digest"},
+		{secure.AuthorizationHeader, "Basic wrong", ErrorRequestDenied.Error()},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+
+		var (
+			assert     = assert.New(t)
+			request, _ = http.NewRequest("GET", "http://test.com/foo", nil)
+			response   = httptest.NewRecorder()
+			actualCtx  context.Context
+
+			handler = AuthorizationHandler{
+				Validators: map[secure.TokenType]secure.Validator{
+					secure.Basic: secure.ExactMatchValidator(tokenValue),
+				},
+				ForbiddenStatusCode: http.StatusUnauthorized,
+				Logger:              logging.TestLogger(t),
+				ErrorEncoder: func(ctx context.Context, statusCode int, err error, response http.ResponseWriter) {
+					actualCtx = ctx
+					response.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+					response.WriteHeader(statusCode)
+					response.Write([]byte(err.Error()))
+				},
+			}
+		)
+
+		if len(record.header) > 0 {
+			request.Header.Set(record.header, record.value)
+		}
+
+		handler.Decorate(&mockHttpHandler{}).ServeHTTP(response, request)
+		assert.Equal(request.Context(), actualCtx)
+		assert.Equal(http.StatusUnauthorized, response.Code)
+		assert.Equal(`Basic realm="test"`, response.HeaderMap.Get("WWW-Authenticate"))
+		assert.Equal(record.expectedError, response.Body.String())
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Comcast/webpa-common/logging"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrorAddressNotAllowed is the error passed to an ErrorEncoder when a request's remote address is rejected
+	ErrorAddressNotAllowed = errors.New("Address not allowed")
+)
+
+// ParseNetworks parses a list of CIDR blocks, e.g. "10.0.0.0/8".  Plain IP addresses are also
+// accepted and are treated as a network containing only that address.
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid IP address: %s", value)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// IPPolicyHandler provides Alice-compatible decoration that admits requests based on their remote
+// IP address.  A request is rejected if its address falls within any of the Deny networks, or if Allow
+// is nonempty and its address falls within none of the Allow networks.  Rejected requests receive an
+// http.StatusForbidden response written by the ErrorEncoder.
+//
+// Only the connection's remote address is considered.  Forwarding headers such as X-Forwarded-For
+// are ignored, since clients can forge them.
+type IPPolicyHandler struct {
+	Allow        []*net.IPNet
+	Deny         []*net.IPNet
+	Logger       logging.Logger
+	ErrorEncoder ErrorEncoder
+}
+
+func (p IPPolicyHandler) errorEncoder() ErrorEncoder {
+	if p.ErrorEncoder != nil {
+		return p.ErrorEncoder
+	}
+
+	return DefaultErrorEncoder
+}
+
+func (p IPPolicyHandler) logger() logging.Logger {
+	if p.Logger != nil {
+		return p.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+// Allowed tests if the given IP address is admitted by this policy
+func (p IPPolicyHandler) Allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range p.Deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(p.Allow) == 0 {
+		return true
+	}
+
+	for _, network := range p.Allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Decorate provides an Alice-compatible constructor that enforces this IP policy.  If the policy
+// has neither Allow nor Deny networks, the delegate is returned undecorated.
+func (p IPPolicyHandler) Decorate(delegate http.Handler) http.Handler {
+	if len(p.Allow) == 0 && len(p.Deny) == 0 {
+		return delegate
+	}
+
+	var (
+		errorEncoder = p.errorEncoder()
+		logger       = p.logger()
+	)
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if !p.Allowed(net.ParseIP(ByRemoteIP(request))) {
+			logger.Warn("Address not allowed for %s %s: %s", request.Method, request.URL.Path, request.RemoteAddr)
+			errorEncoder(request.Context(), http.StatusForbidden, ErrorAddressNotAllowed, response)
+			return
+		}
+
+		delegate.ServeHTTP(response, request)
+	})
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseNetworks(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	networks, err := ParseNetworks(nil)
+	assert.Empty(networks)
+	assert.NoError(err)
+
+	networks, err = ParseNetworks([]string{"10.0.0.0/8", " 192.168.1.1 ", "fd00::/8", "::1"})
+	require.NoError(err)
+	require.Len(networks, 4)
+	assert.Equal("10.0.0.0/8", networks[0].String())
+	assert.Equal("192.168.1.1/32", networks[1].String())
+	assert.Equal("fd00::/8", networks[2].String())
+	assert.Equal("::1/128", networks[3].String())
+
+	for _, invalid := range []string{"not an ip", "10.0.0.0/99", ""} {
+		networks, err = ParseNetworks([]string{invalid})
+		assert.Nil(networks)
+		assert.Error(err)
+	}
+}
+
+func TestIPPolicyHandlerAllowed(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		allow, _   = ParseNetworks([]string{"10.0.0.0/8"})
+		deny, _    = ParseNetworks([]string{"10.1.0.0/16"})
+		allowOnly  = IPPolicyHandler{Allow: allow}
+		denyOnly   = IPPolicyHandler{Deny: deny}
+		allowDeny  = IPPolicyHandler{Allow: allow, Deny: deny}
+		permissive = IPPolicyHandler{}
+		inside     = net.ParseIP("10.2.3.4")
+		denied     = net.ParseIP("10.1.2.3")
+		outside    = net.ParseIP("192.168.1.1")
+	)
+
+	assert.True(permissive.Allowed(outside))
+	assert.False(permissive.Allowed(nil))
+
+	assert.True(allowOnly.Allowed(inside))
+	assert.True(allowOnly.Allowed(denied))
+	assert.False(allowOnly.Allowed(outside))
+
+	assert.True(denyOnly.Allowed(inside))
+	assert.False(denyOnly.Allowed(denied))
+	assert.True(denyOnly.Allowed(outside))
+
+	assert.True(allowDeny.Allowed(inside))
+	assert.False(allowDeny.Allowed(denied))
+	assert.False(allowDeny.Allowed(outside))
+}
+
+func TestIPPolicyHandlerDecorate(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		allow, _ = ParseNetworks([]string{"10.0.0.0/8"})
+		delegate = http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.WriteHeader(222)
+		})
+	)
+
+	undecorated := IPPolicyHandler{}.Decorate(delegate)
+	assert.NotNil(undecorated)
+
+	handler := IPPolicyHandler{Allow: allow, Logger: logging.TestLogger(t)}.Decorate(delegate)
+	for remoteAddr, expectedStatusCode := range map[string]int{
+		"10.2.3.4:1234":    222,
+		"192.168.1.1:1234": http.StatusForbidden,
+		"garbage":          http.StatusForbidden,
+	} {
+		t.Logf("%s", remoteAddr)
+		request := httptest.NewRequest("GET", "/test", nil)
+		request.RemoteAddr = remoteAddr
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, request)
+		assert.Equal(expectedStatusCode, response.Code)
+	}
+}
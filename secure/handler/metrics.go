@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// AuthorizationDecisionCounter is the total number of authorization decisions made by AuthorizationHandlers
+	AuthorizationDecisionCounter = "authorization_decision_count"
+
+	// AuthorizationLatencyHistogram is the time, in seconds, taken by AuthorizationHandlers to reach a decision
+	AuthorizationLatencyHistogram = "authorization_latency_seconds"
+
+	// ValidatorReloadCounter is the total number of attempts by ValidatorReloaders to load validators
+	ValidatorReloadCounter = "validator_reload_count"
+
+	// DecisionLabel is the label whose value is the Decision
+	DecisionLabel = "decision"
+
+	// ValidatorLabel is the label whose value is the type of validator, as reported in AuditEntry.Validator
+	ValidatorLabel = "validator"
+
+	// ReasonLabel is the label whose value is the reason for the decision, e.g. ReasonRejected
+	ReasonLabel = "reason"
+
+	// OutcomeLabel is the label whose value is the outcome of a validator reload, either SuccessOutcome or FailureOutcome
+	OutcomeLabel = "outcome"
+
+	// SuccessOutcome is the OutcomeLabel value for validators that were loaded
+	SuccessOutcome = "success"
+
+	// FailureOutcome is the OutcomeLabel value for validators that could not be loaded
+	FailureOutcome = "failure"
+)
+
+// Metrics is the xmetrics.Module for this package
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name:       AuthorizationDecisionCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of authorization decisions",
+			LabelNames: []string{DecisionLabel, ValidatorLabel, ReasonLabel},
+		},
+		{
+			Name:       AuthorizationLatencyHistogram,
+			Type:       xmetrics.HistogramType,
+			Help:       "The time in seconds taken to reach an authorization decision",
+			LabelNames: []string{DecisionLabel},
+		},
+		{
+			Name:       ValidatorReloadCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of attempts to reload validators",
+			LabelNames: []string{OutcomeLabel},
+		},
+	}
+}
+
+// authorizationMeasures is the set of metrics updated by a decorated AuthorizationHandler
+type authorizationMeasures struct {
+	decisions metrics.Counter
+	latency   metrics.Histogram
+}
+
+func newAuthorizationMeasures(p xmetrics.Provider) *authorizationMeasures {
+	return &authorizationMeasures{
+		decisions: p.NewCounter(AuthorizationDecisionCounter),
+		latency:   p.NewHistogram(AuthorizationLatencyHistogram),
+	}
+}
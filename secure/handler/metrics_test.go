@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	assert.NotNil(t, registry)
+	assert.NoError(t, err)
+}
+
+func TestAuthorizationHandlerMetrics(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+	)
+
+	require.NoError(err)
+	require.NotNil(registry)
+
+	var (
+		handler = AuthorizationHandler{
+			Validator:       secure.ExactMatchValidator(tokenValue),
+			Logger:          logging.TestLogger(t),
+			MetricsProvider: registry,
+		}
+
+		decorated = handler.Decorate(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			response.WriteHeader(http.StatusOK)
+		}))
+	)
+
+	for _, value := range []string{authorizationValue, "Basic bm9wZTpub3BlCg==", ""} {
+		request := httptest.NewRequest("GET", "/foo", nil)
+		if len(value) > 0 {
+			request.Header.Set(secure.AuthorizationHeader, value)
+		}
+
+		decorated.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	output := response.Body.String()
+
+	assert.Contains(output, AuthorizationDecisionCounter+`{decision="Allowed",reason="valid",validator="secure.ExactMatchValidator"} 1`)
+	assert.Contains(output, AuthorizationDecisionCounter+`{decision="Denied",reason="rejected",validator="secure.ExactMatchValidator"} 1`)
+	assert.Contains(output, AuthorizationDecisionCounter+`{decision="Denied",reason="missing_header",validator="none"} 1`)
+	assert.Contains(output, AuthorizationLatencyHistogram+`_count{decision="Allowed"} 1`)
+	assert.Contains(output, AuthorizationLatencyHistogram+`_count{decision="Denied"} 2`)
+}
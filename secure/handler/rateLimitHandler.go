@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/secure"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// RetryAfterHeader is the header which tells rate limited clients how many seconds to wait
+	RetryAfterHeader = "Retry-After"
+)
+
+var (
+	// ErrorRateLimited is the error passed to an ErrorEncoder when a request exceeds its rate limit
+	ErrorRateLimited = errors.New("Rate limit exceeded")
+)
+
+// RateLimitKeyFunc produces the key under which a request is rate limited.  Requests
+// with the same key share a token bucket.
+type RateLimitKeyFunc func(*http.Request) string
+
+// ByRemoteIP is a RateLimitKeyFunc which limits requests per remote IP address
+func ByRemoteIP(request *http.Request) string {
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		return host
+	}
+
+	return request.RemoteAddr
+}
+
+// ByToken returns a RateLimitKeyFunc which limits requests per token.  When decorating a handler
+// which has already passed an AuthorizationHandler, the subject of the verified claims is used, so
+// that all tokens issued to the same subject share a limit.  Otherwise, the key is a hash of the
+// given authorization header's value.  Requests with no token are limited by remote IP.
+//
+// If headerName is empty, secure.AuthorizationHeader is used.
+func ByToken(headerName string) RateLimitKeyFunc {
+	if len(headerName) == 0 {
+		headerName = secure.AuthorizationHeader
+	}
+
+	return func(request *http.Request) string {
+		if claims, ok := secure.GetClaims(request.Context()); ok {
+			if subject, _ := claims.Get("sub").(string); len(subject) > 0 {
+				return "sub:" + subject
+			}
+		}
+
+		if value := request.Header.Get(headerName); len(value) > 0 {
+			hash := sha256.Sum256([]byte(value))
+			return "token:" + hex.EncodeToString(hash[:])
+		}
+
+		return ByRemoteIP(request)
+	}
+}
+
+// RateLimitHandler provides Alice-compatible decoration that limits the rate of requests using
+// a token bucket per key.  Each bucket holds up to Burst tokens and refills at Rate tokens per second.
+// Requests that find their bucket empty are rejected with http.StatusTooManyRequests and a Retry-After
+// header, with the response body written by the ErrorEncoder.
+//
+// To limit per token, decorate with a RateLimitHandler after an AuthorizationHandler, e.g.
+// alice.New(authorizationHandler.Decorate, rateLimitHandler.Decorate), and use ByToken.
+// Placing the RateLimitHandler first instead protects validators from floods of bad tokens.
+type RateLimitHandler struct {
+	// Rate is the sustained number of requests per second allowed for each key.  If this
+	// value is nonpositive, no rate limiting is done.
+	Rate float64
+
+	// Burst is the maximum number of requests allowed at once for each key.  If not supplied,
+	// Rate rounded up (with a minimum of 1) is used.
+	Burst int
+
+	// KeyFunc determines the key for each request.  If not supplied, ByRemoteIP is used.
+	KeyFunc RateLimitKeyFunc
+
+	Logger       logging.Logger
+	ErrorEncoder ErrorEncoder
+}
+
+func (r RateLimitHandler) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+
+	return int(math.Max(1, math.Ceil(r.Rate)))
+}
+
+func (r RateLimitHandler) keyFunc() RateLimitKeyFunc {
+	if r.KeyFunc != nil {
+		return r.KeyFunc
+	}
+
+	return ByRemoteIP
+}
+
+func (r RateLimitHandler) errorEncoder() ErrorEncoder {
+	if r.ErrorEncoder != nil {
+		return r.ErrorEncoder
+	}
+
+	return DefaultErrorEncoder
+}
+
+func (r RateLimitHandler) logger() logging.Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+// Decorate provides an Alice-compatible constructor that rate limits requests using
+// the configuration specified.  Each decorated handler has its own set of token buckets.
+func (r RateLimitHandler) Decorate(delegate http.Handler) http.Handler {
+	if r.Rate <= 0 {
+		return delegate
+	}
+
+	var (
+		buckets      = newTokenBuckets(r.Rate, r.burst())
+		keyFunc      = r.keyFunc()
+		errorEncoder = r.errorEncoder()
+		logger       = r.logger()
+	)
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		key := keyFunc(request)
+		if wait := buckets.take(key); wait > 0 {
+			logger.Warn("Rate limit exceeded for %s %s", request.Method, request.URL.Path)
+			response.Header().Set(RetryAfterHeader, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			errorEncoder(request.Context(), http.StatusTooManyRequests, ErrorRateLimited, response)
+			return
+		}
+
+		delegate.ServeHTTP(response, request)
+	})
+}
+
+// tokenBucket is the state of a single key's rate limit
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// tokenBuckets is a concurrent set of token buckets keyed by string.  Buckets which have been idle
+// long enough to refill completely are indistinguishable from new buckets, so they are periodically discarded.
+type tokenBuckets struct {
+	rate       float64
+	burst      float64
+	refillTime time.Duration
+	now        func() time.Time
+
+	lock      sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newTokenBuckets(rate float64, burst int) *tokenBuckets {
+	refillTime := time.Duration(float64(burst) / rate * float64(time.Second))
+	if refillTime < time.Second {
+		refillTime = time.Second
+	}
+
+	return &tokenBuckets{
+		rate:       rate,
+		burst:      float64(burst),
+		refillTime: refillTime,
+		now:        time.Now,
+		buckets:    make(map[string]*tokenBucket),
+	}
+}
+
+// take attempts to remove a token from the given key's bucket.  If a token was available, this
+// method returns zero.  Otherwise, this method returns the time until a token will be available.
+func (tb *tokenBuckets) take(key string) time.Duration {
+	now := tb.now()
+
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	if now.Sub(tb.lastSweep) >= tb.refillTime {
+		tb.sweep(now)
+	}
+
+	bucket, ok := tb.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: tb.burst, last: now}
+		tb.buckets[key] = bucket
+	} else {
+		bucket.tokens = math.Min(tb.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*tb.rate)
+		bucket.last = now
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - bucket.tokens) / tb.rate * float64(time.Second))
+}
+
+// sweep discards full buckets.  This method must be called under the lock.
+func (tb *tokenBuckets) sweep(now time.Time) {
+	tb.lastSweep = now
+	for key, bucket := range tb.buckets {
+		if now.Sub(bucket.last) >= tb.refillTime {
+			delete(tb.buckets, key)
+		}
+	}
+}
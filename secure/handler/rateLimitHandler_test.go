@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/SermoDigital/jose/jws"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestByRemoteIP(t *testing.T) {
+	assert := assert.New(t)
+	request := httptest.NewRequest("GET", "http://test.com/foo", nil)
+
+	request.RemoteAddr = "10.1.2.3:5555"
+	assert.Equal("10.1.2.3", ByRemoteIP(request))
+
+	request.RemoteAddr = "[::1]:5555"
+	assert.Equal("::1", ByRemoteIP(request))
+
+	request.RemoteAddr = "unparseable"
+	assert.Equal("unparseable", ByRemoteIP(request))
+}
+
+func TestByToken(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		keyFunc = ByToken("")
+		request = httptest.NewRequest("GET", "http://test.com/foo", nil)
+	)
+
+	request.RemoteAddr = "10.1.2.3:5555"
+	assert.Equal("10.1.2.3", keyFunc(request))
+
+	request.Header.Set(secure.AuthorizationHeader, authorizationValue)
+	tokenKey := keyFunc(request)
+	assert.Contains(tokenKey, "token:")
+	assert.NotContains(tokenKey, tokenValue)
+
+	request.Header.Set(secure.AuthorizationHeader, "Basic other")
+	assert.NotEqual(tokenKey, keyFunc(request))
+
+	// claims without a subject fall back to the token
+	withoutSubject := request.WithContext(secure.WithClaims(jws.Claims{"iss": "test"}, request.Context()))
+	assert.Equal(keyFunc(request), keyFunc(withoutSubject))
+
+	withSubject := request.WithContext(secure.WithClaims(jws.Claims{"sub": "joe"}, request.Context()))
+	assert.Equal("sub:joe", keyFunc(withSubject))
+
+	custom := ByToken("X-Custom")
+	request.Header.Set("X-Custom", authorizationValue)
+	assert.Equal(tokenKey, custom(request))
+}
+
+func TestRateLimitHandlerNoRate(t *testing.T) {
+	assert := assert.New(t)
+	delegate := new(mockHttpHandler)
+	assert.Equal(delegate, RateLimitHandler{}.Decorate(delegate))
+}
+
+func TestRateLimitHandlerDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(1, RateLimitHandler{Rate: 0.5}.burst())
+	assert.Equal(3, RateLimitHandler{Rate: 2.5}.burst())
+	assert.Equal(7, RateLimitHandler{Rate: 2.5, Burst: 7}.burst())
+	assert.NotNil(RateLimitHandler{}.keyFunc())
+	assert.NotNil(RateLimitHandler{}.errorEncoder())
+	assert.NotNil(RateLimitHandler{}.logger())
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		served   int
+		delegate = http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			served++
+			response.WriteHeader(222)
+		})
+
+		encoded []error
+
+		decorated = RateLimitHandler{
+			Rate:   0.01,
+			Burst:  2,
+			Logger: logging.TestLogger(t),
+			ErrorEncoder: func(ctx context.Context, statusCode int, err error, response http.ResponseWriter) {
+				encoded = append(encoded, err)
+				DefaultErrorEncoder(ctx, statusCode, err, response)
+			},
+		}.Decorate(delegate)
+	)
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "http://test.com/foo", nil)
+		request.RemoteAddr = remoteAddr
+		response := httptest.NewRecorder()
+		decorated.ServeHTTP(response, request)
+		return response
+	}
+
+	assert.Equal(222, serve("10.1.2.3:1111").Code)
+	assert.Equal(222, serve("10.1.2.3:2222").Code)
+
+	limited := serve("10.1.2.3:3333")
+	assert.Equal(http.StatusTooManyRequests, limited.Code)
+	assert.Equal("100", limited.HeaderMap.Get(RetryAfterHeader))
+	assert.Equal([]error{ErrorRateLimited}, encoded)
+
+	// other keys have their own buckets
+	assert.Equal(222, serve("10.4.5.6:1111").Code)
+	assert.Equal(3, served)
+}
+
+func TestTokenBuckets(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		current = time.Now()
+		buckets = newTokenBuckets(2, 4)
+	)
+
+	buckets.now = func() time.Time { return current }
+	assert.Equal(2*time.Second, buckets.refillTime)
+
+	for repeat := 0; repeat < 4; repeat++ {
+		assert.Zero(buckets.take("key"))
+	}
+
+	assert.Equal(500*time.Millisecond, buckets.take("key"))
+	assert.Zero(buckets.take("other"))
+
+	current = current.Add(250 * time.Millisecond)
+	assert.Equal(250*time.Millisecond, buckets.take("key"))
+
+	current = current.Add(250 * time.Millisecond)
+	assert.Zero(buckets.take("key"))
+	assert.Equal(500*time.Millisecond, buckets.take("key"))
+
+	// idle buckets are refilled, then discarded by a sweep
+	current = current.Add(time.Hour)
+	assert.Zero(buckets.take("key"))
+	assert.Len(buckets.buckets, 1)
+	for repeat := 0; repeat < 3; repeat++ {
+		assert.Zero(buckets.take("key"))
+	}
+
+	assert.NotZero(buckets.take("key"))
+}
+
+func TestTokenBucketsMinimumRefillTime(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(time.Second, newTokenBuckets(1000, 1).refillTime)
+}
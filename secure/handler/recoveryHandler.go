@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"github.com/Comcast/webpa-common/logging"
+	"net/http"
+	"runtime/debug"
+)
+
+var (
+	// ErrorInternal is the error passed to an ErrorEncoder when a decorated handler panics
+	ErrorInternal = errors.New("Internal server error")
+)
+
+// RecoveryHandler provides Alice-compatible decoration that recovers from panics in the decorated
+// handler.  The panic and its stack are logged, and the client receives an http.StatusInternalServerError
+// response written by the ErrorEncoder.  If the decorated handler had already written a response,
+// nothing further is written.
+//
+// http.ErrAbortHandler is not recovered, since it is the standard way for handlers to abort a response.
+type RecoveryHandler struct {
+	Logger       logging.Logger
+	ErrorEncoder ErrorEncoder
+}
+
+func (r RecoveryHandler) errorEncoder() ErrorEncoder {
+	if r.ErrorEncoder != nil {
+		return r.ErrorEncoder
+	}
+
+	return DefaultErrorEncoder
+}
+
+func (r RecoveryHandler) logger() logging.Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+// Decorate provides an Alice-compatible constructor that recovers from panics
+func (r RecoveryHandler) Decorate(delegate http.Handler) http.Handler {
+	var (
+		errorEncoder = r.errorEncoder()
+		logger       = r.logger()
+	)
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		wrapper := &statusResponseWriter{ResponseWriter: response}
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+
+				logger.Error("Panic while handling %s %s: %v\n%s", request.Method, request.URL.Path, recovered, debug.Stack())
+				if wrapper.statusCode == 0 {
+					errorEncoder(request.Context(), http.StatusInternalServerError, ErrorInternal, response)
+				}
+			}
+		}()
+
+		delegate.ServeHTTP(wrapper, request)
+	})
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecoveryHandler(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		handler = RecoveryHandler{Logger: logging.TestLogger(t)}.Decorate(
+			http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				panic("expected")
+			}),
+		)
+
+		request  = httptest.NewRequest("GET", "/test", nil)
+		response = httptest.NewRecorder()
+	)
+
+	assert.NotPanics(func() { handler.ServeHTTP(response, request) })
+	assert.Equal(http.StatusInternalServerError, response.Code)
+	assert.Equal(JsonContentType, response.HeaderMap.Get(ContentTypeHeader))
+	assert.JSONEq(`{"message": "Internal server error"}`, response.Body.String())
+}
+
+func TestRecoveryHandlerAfterWrite(t *testing.T) {
+	var (
+		assert          = assert.New(t)
+		encoderCalled   = false
+		recoveryHandler = RecoveryHandler{
+			Logger: logging.TestLogger(t),
+			ErrorEncoder: func(context.Context, int, error, http.ResponseWriter) {
+				encoderCalled = true
+			},
+		}
+
+		handler = recoveryHandler.Decorate(
+			http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+				response.WriteHeader(http.StatusAccepted)
+				panic("expected")
+			}),
+		)
+
+		request  = httptest.NewRequest("GET", "/test", nil)
+		response = httptest.NewRecorder()
+	)
+
+	assert.NotPanics(func() { handler.ServeHTTP(response, request) })
+	assert.Equal(http.StatusAccepted, response.Code)
+	assert.False(encoderCalled)
+}
+
+func TestRecoveryHandlerAbort(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		handler = RecoveryHandler{Logger: logging.TestLogger(t)}.Decorate(
+			http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				panic(http.ErrAbortHandler)
+			}),
+		)
+
+		request  = httptest.NewRequest("GET", "/test", nil)
+		response = httptest.NewRecorder()
+	)
+
+	assert.Panics(func() { handler.ServeHTTP(response, request) })
+}
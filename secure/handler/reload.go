@@ -0,0 +1,430 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/Comcast/webpa-common/secure/capability"
+	"github.com/Comcast/webpa-common/secure/key"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/SermoDigital/jose/jwt"
+	"github.com/go-kit/kit/metrics"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultValidatorCheckInterval is how often a ValidatorReloader checks its files for changes
+	DefaultValidatorCheckInterval = 30 * time.Second
+)
+
+var (
+	ErrorNoValidatorLoader = errors.New("A ValidatorLoader is required")
+)
+
+// ValidatorSet is an immutable snapshot of the validators used by an AuthorizationHandler.  The fields
+// have the same meaning as the fields of the same names in AuthorizationHandler.
+type ValidatorSet struct {
+	Validator  secure.Validator
+	Validators map[secure.TokenType]secure.Validator
+}
+
+// ValidatorSource is the strategy for obtaining the ValidatorSet currently in effect.  Implementations
+// must be safe for concurrent use, and must never modify a ValidatorSet once it has been returned.
+type ValidatorSource interface {
+	ValidatorSet() *ValidatorSet
+}
+
+// ValidatorSourceFunc is a function type that implements ValidatorSource
+type ValidatorSourceFunc func() *ValidatorSet
+
+func (f ValidatorSourceFunc) ValidatorSet() *ValidatorSet {
+	return f()
+}
+
+// ValidatorLoader produces a new ValidatorSet, typically from configuration
+type ValidatorLoader func() (*ValidatorSet, error)
+
+// JWTValidatorConfig configures the validation of JWTs signed with a set of keys.  This is the same
+// configuration used for the validators of an application's static configuration, e.g. the
+// config.Config JWTValidators, so that both are described identically.
+type JWTValidatorConfig struct {
+	// Keys is the source of the keys used to verify signatures
+	Keys key.ResolverFactory `json:"keys"`
+
+	// DefaultKeyId is the key id used for tokens that do not specify one.  This is optional.
+	DefaultKeyId string `json:"defaultKeyId,omitempty"`
+
+	// Custom configures the validation of the claims.  This is optional.
+	Custom secure.JWTValidatorFactory `json:"custom"`
+}
+
+// ValidatorConfig is the reloadable, usually JSON, description of an application's validators.
+// Basic tokens are checked against the Basic credentials, and Bearer tokens against the JWT validators.
+// If Capabilities is supplied, Bearer tokens must also carry the capabilities the policy requires of the
+// request, as described by capability.Validator.
+type ValidatorConfig struct {
+	// Basic holds the hashed credentials of the principals allowed to use Basic authentication
+	Basic secure.CredentialMap `json:"basic,omitempty"`
+
+	// JWT configures the validators for Bearer tokens, any one of which may approve a token
+	JWT []JWTValidatorConfig `json:"jwt,omitempty"`
+
+	// Capabilities is the optional policy of capabilities required by routes
+	Capabilities *capability.PolicyDocument `json:"capabilities,omitempty"`
+
+	// TokenCache, if supplied, caches the Bearer tokens approved by the JWT validators so that repeated
+	// requests skip signature verification.  Capabilities are still checked on every request.
+	TokenCache *secure.TokenCacheOptions `json:"tokenCache,omitempty"`
+
+	// MetricsProvider is the source of the metrics declared by secure.Metrics, used when the TokenCache
+	// does not supply its own.  If not supplied, metrics are discarded.
+	MetricsProvider xmetrics.Provider `json:"-"`
+}
+
+// NewValidatorSet builds the validators described by this configuration
+func (c *ValidatorConfig) NewValidatorSet() (*ValidatorSet, error) {
+	set := &ValidatorSet{
+		Validators: make(map[secure.TokenType]secure.Validator),
+	}
+
+	if len(c.Basic) > 0 {
+		set.Validators[secure.Basic] = &secure.BasicValidator{Store: c.Basic}
+	}
+
+	if len(c.JWT) > 0 {
+		chain := make(secure.Validators, 0, len(c.JWT))
+		for i := range c.JWT {
+			resolver, err := c.JWT[i].Keys.NewResolver()
+			if err != nil {
+				return nil, fmt.Errorf("jwt[%d]: %s", i, err)
+			}
+
+			chain = append(chain, secure.JWSValidator{
+				DefaultKeyId:  c.JWT[i].DefaultKeyId,
+				Resolver:      resolver,
+				JWTValidators: []*jwt.Validator{c.JWT[i].Custom.New()},
+			})
+		}
+
+		var bearer secure.Validator = chain
+		if c.TokenCache != nil {
+			tokenCache := *c.TokenCache
+			if tokenCache.MetricsProvider == nil {
+				tokenCache.MetricsProvider = c.MetricsProvider
+			}
+
+			bearer = secure.NewCachingValidator(chain, &tokenCache)
+		}
+
+		if c.Capabilities != nil {
+			policy, err := capability.NewPolicy(*c.Capabilities)
+			if err != nil {
+				return nil, fmt.Errorf("capabilities: %s", err)
+			}
+
+			bearer = &capability.Validator{
+				Delegate: bearer,
+				Policy:   capability.PolicySourceFunc(func() *capability.Policy { return policy }),
+			}
+		}
+
+		set.Validators[secure.Bearer] = bearer
+	}
+
+	return set, nil
+}
+
+// ValidatorFileLoader returns a ValidatorLoader which reads a ValidatorConfig from a JSON file.  The metrics
+// of any token cache are discarded.
+func ValidatorFileLoader(path string) ValidatorLoader {
+	return MeteredValidatorFileLoader(path, nil)
+}
+
+// MeteredValidatorFileLoader returns a ValidatorLoader which reads a ValidatorConfig from a JSON file,
+// using the given provider as the config's MetricsProvider
+func MeteredValidatorFileLoader(path string, provider xmetrics.Provider) ValidatorLoader {
+	return func() (*ValidatorSet, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		config := ValidatorConfig{MetricsProvider: provider}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("Invalid validator file [%s]: %s", path, err)
+		}
+
+		return config.NewValidatorSet()
+	}
+}
+
+// ValidatorReloaderOptions configures a ValidatorReloader
+type ValidatorReloaderOptions struct {
+	// Files are checked for changes, and the validators are reloaded whenever any of them is modified.
+	// If not supplied, the validators are only reloaded on demand.
+	Files []string
+
+	// CheckInterval is how often the files are checked for changes.  If not supplied,
+	// DefaultValidatorCheckInterval is used.
+	CheckInterval time.Duration
+
+	// Logger is used to report reloads.  If not supplied, logging.DefaultLogger() is used.
+	Logger logging.Logger
+
+	// MetricsProvider is the source of the metrics declared by Metrics.  If not supplied, metrics are discarded.
+	MetricsProvider xmetrics.Provider
+}
+
+func (o *ValidatorReloaderOptions) files() []string {
+	if o != nil {
+		return o.Files
+	}
+
+	return nil
+}
+
+func (o *ValidatorReloaderOptions) checkInterval() time.Duration {
+	if o != nil && o.CheckInterval > 0 {
+		return o.CheckInterval
+	}
+
+	return DefaultValidatorCheckInterval
+}
+
+func (o *ValidatorReloaderOptions) logger() logging.Logger {
+	if o != nil && o.Logger != nil {
+		return o.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+func (o *ValidatorReloaderOptions) metricsProvider() xmetrics.Provider {
+	if o != nil && o.MetricsProvider != nil {
+		return o.MetricsProvider
+	}
+
+	return xmetrics.NewDiscardProvider()
+}
+
+// ValidatorStatus is the JSON description of a ValidatorReloader's state
+type ValidatorStatus struct {
+	// Generation counts the successful loads, including the initial load
+	Generation int `json:"generation"`
+
+	// Loaded is when the current validators were loaded
+	Loaded time.Time `json:"loaded"`
+
+	// LastError is the error from the most recent load, if it failed
+	LastError string `json:"lastError,omitempty"`
+}
+
+// ValidatorReloader is a ValidatorSource whose validators are reloaded at runtime, either when its files
+// change or when its Reload method is called.  Policy changes, such as new keys, capabilities, or Basic
+// credentials, therefore take effect without restarting the server.  Each reload builds an entirely new
+// ValidatorSet which is swapped in atomically.  If a reload fails, the previous validators remain in effect.
+//
+// A ValidatorReloader is also an http.Handler suitable for an admin endpoint, e.g. one mounted with
+// server.AdminRouter.Handle.  A GET responds with the ValidatorStatus, and a POST reloads the validators.
+type ValidatorReloader struct {
+	loader        ValidatorLoader
+	files         []string
+	checkInterval time.Duration
+	logger        logging.Logger
+	reloads       metrics.Counter
+
+	// tick is an optional source of ticks used in place of a time.Ticker, and is only set by tests
+	tick func(time.Duration) <-chan time.Time
+
+	// reloadLock serializes reloads, so that a slower load never replaces the result of a later one
+	reloadLock sync.Mutex
+
+	lock     sync.RWMutex
+	set      *ValidatorSet
+	modTimes []time.Time
+	status   ValidatorStatus
+}
+
+// NewValidatorReloader creates a ValidatorReloader and performs the initial load.  An error is returned
+// if the initial load fails.
+func NewValidatorReloader(loader ValidatorLoader, o *ValidatorReloaderOptions) (*ValidatorReloader, error) {
+	if loader == nil {
+		return nil, ErrorNoValidatorLoader
+	}
+
+	r := &ValidatorReloader{
+		loader:        loader,
+		files:         o.files(),
+		checkInterval: o.checkInterval(),
+		logger:        o.logger(),
+		reloads:       o.metricsProvider().NewCounter(ValidatorReloadCounter),
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// fileModTimes returns the modification times of the watched files
+func (r *ValidatorReloader) fileModTimes() ([]time.Time, error) {
+	modTimes := make([]time.Time, len(r.files))
+	for i, name := range r.files {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+
+		modTimes[i] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+// Reload unconditionally loads the validators and swaps them in
+func (r *ValidatorReloader) Reload() error {
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+	return r.reload()
+}
+
+// reload does the work of Reload.  This method must be called under the reloadLock.
+func (r *ValidatorReloader) reload() error {
+	modTimes, err := r.fileModTimes()
+	if err == nil {
+		var set *ValidatorSet
+		if set, err = r.loader(); err == nil {
+			r.lock.Lock()
+			r.set = set
+			r.modTimes = modTimes
+			r.status.Generation++
+			r.status.Loaded = time.Now()
+			r.status.LastError = ""
+			r.lock.Unlock()
+
+			r.reloads.With(OutcomeLabel, SuccessOutcome).Add(1)
+			return nil
+		}
+	}
+
+	r.lock.Lock()
+	r.status.LastError = err.Error()
+	r.lock.Unlock()
+
+	r.reloads.With(OutcomeLabel, FailureOutcome).Add(1)
+	return err
+}
+
+// reloadIfChanged loads the validators if any of the files has been modified since the last load
+func (r *ValidatorReloader) reloadIfChanged() (bool, error) {
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return false, err
+	}
+
+	r.lock.RLock()
+	changed := false
+	for i := range modTimes {
+		if !modTimes[i].Equal(r.modTimes[i]) {
+			changed = true
+			break
+		}
+	}
+
+	r.lock.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	return true, r.reload()
+}
+
+// ValidatorSet returns the current validators
+func (r *ValidatorReloader) ValidatorSet() *ValidatorSet {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.set
+}
+
+// Status returns the current state of this reloader
+func (r *ValidatorReloader) Status() ValidatorStatus {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.status
+}
+
+// Run checks the files for changes until shutdown is closed.  If there are no files, this method does nothing.
+// This method implements concurrent.Runnable.
+func (r *ValidatorReloader) Run(waitGroup *sync.WaitGroup, shutdown <-chan struct{}) error {
+	if len(r.files) == 0 {
+		return nil
+	}
+
+	var (
+		ticks <-chan time.Time
+		stop  = func() {}
+	)
+
+	if r.tick != nil {
+		ticks = r.tick(r.checkInterval)
+	} else {
+		ticker := time.NewTicker(r.checkInterval)
+		ticks, stop = ticker.C, ticker.Stop
+	}
+
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		defer stop()
+
+		for {
+			select {
+			case <-shutdown:
+				return
+
+			case <-ticks:
+				if reloaded, err := r.reloadIfChanged(); err != nil {
+					r.logger.Error("Unable to reload validators: %s", err)
+				} else if reloaded {
+					r.logger.Info("Reloaded validators")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (r *ValidatorReloader) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	code := http.StatusOK
+	switch request.Method {
+	case http.MethodGet:
+
+	case http.MethodPost:
+		if err := r.Reload(); err != nil {
+			r.logger.Error("Unable to reload validators: %s", err)
+			code = http.StatusInternalServerError
+		} else {
+			r.logger.Info("Reloaded validators")
+		}
+
+	default:
+		response.Header().Set("Allow", "GET, POST")
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	response.Header().Set(ContentTypeHeader, JsonContentType)
+	response.WriteHeader(code)
+	json.NewEncoder(response).Encode(r.Status())
+}
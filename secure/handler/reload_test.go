@@ -0,0 +1,458 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/Comcast/webpa-common/secure/capability"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func basicAuthorization(principal, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(principal+":"+password))
+}
+
+// writeValidatorFile writes a ValidatorConfig allowing a single Basic principal, and ensures the
+// file's modification time differs from any previous write
+func writeValidatorFile(t *testing.T, path, principal, password string, modTime time.Time) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(ValidatorConfig{
+		Basic: secure.CredentialMap{principal: {Hash: string(hash)}},
+	})
+
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestValidatorSourceFunc(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		set    = new(ValidatorSet)
+	)
+
+	assert.Equal(set, ValidatorSourceFunc(func() *ValidatorSet { return set }).ValidatorSet())
+}
+
+func TestValidatorReloaderOptionsDefaults(t *testing.T) {
+	assert := assert.New(t)
+	for _, o := range []*ValidatorReloaderOptions{nil, new(ValidatorReloaderOptions)} {
+		assert.Empty(o.files())
+		assert.Equal(DefaultValidatorCheckInterval, o.checkInterval())
+		assert.NotNil(o.logger())
+		assert.NotNil(o.metricsProvider())
+	}
+}
+
+func TestValidatorConfig(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	publicKey, err := filepath.Abs("../jwt-key.pub")
+	require.NoError(err)
+
+	set, err := new(ValidatorConfig).NewValidatorSet()
+	require.NoError(err)
+	assert.Nil(set.Validator)
+	assert.Empty(set.Validators)
+
+	config := ValidatorConfig{
+		Basic: secure.CredentialMap{"joe": {Hash: "$2a$04$notarealhash"}},
+		JWT:   []JWTValidatorConfig{{DefaultKeyId: "current"}},
+	}
+
+	config.JWT[0].Keys.URI = publicKey
+	set, err = config.NewValidatorSet()
+	require.NoError(err)
+	assert.IsType(&secure.BasicValidator{}, set.Validators[secure.Basic])
+	if chain, ok := set.Validators[secure.Bearer].(secure.Validators); assert.True(ok) && assert.Len(chain, 1) {
+		assert.Equal("current", chain[0].(secure.JWSValidator).DefaultKeyId)
+	}
+
+	config.Capabilities = &capability.PolicyDocument{
+		Rules: []capability.Rule{{Path: "^/api/v2/device", Capabilities: []string{"x1:webpa:api:device:all"}}},
+	}
+
+	set, err = config.NewValidatorSet()
+	require.NoError(err)
+	if validator, ok := set.Validators[secure.Bearer].(*capability.Validator); assert.True(ok) {
+		assert.IsType(secure.Validators{}, validator.Delegate)
+		assert.Equal(1, validator.Policy.Policy().Len())
+	}
+
+	// the token cache sits between the capability checks and the JWT validators
+	config.TokenCache = &secure.TokenCacheOptions{MaxSize: 100}
+	set, err = config.NewValidatorSet()
+	require.NoError(err)
+	if validator, ok := set.Validators[secure.Bearer].(*capability.Validator); assert.True(ok) {
+		assert.IsType(&secure.CachingValidator{}, validator.Delegate)
+	}
+
+	config.Capabilities, config.TokenCache = nil, &secure.TokenCacheOptions{}
+	set, err = config.NewValidatorSet()
+	require.NoError(err)
+	assert.IsType(&secure.CachingValidator{}, set.Validators[secure.Bearer])
+
+	config.Capabilities = &capability.PolicyDocument{
+		Rules: []capability.Rule{{Path: "^/api/v2/device", Capabilities: []string{"x1:webpa:api:device:all"}}},
+	}
+
+	config.Capabilities.Rules[0].Path = ""
+	set, err = config.NewValidatorSet()
+	assert.Nil(set)
+	assert.Error(err)
+
+	config.JWT[0].Keys.URI = "http://keys.example.com/{notakeyid}"
+	set, err = config.NewValidatorSet()
+	assert.Nil(set)
+	assert.Error(err)
+}
+
+func TestValidatorFileLoader(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	directory, err := ioutil.TempDir("", "validators")
+	require.NoError(err)
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "validators.json")
+	set, err := ValidatorFileLoader(path)()
+	assert.Nil(set)
+	assert.Error(err)
+
+	require.NoError(ioutil.WriteFile(path, []byte("this is not JSON"), 0600))
+	set, err = ValidatorFileLoader(path)()
+	assert.Nil(set)
+	assert.Error(err)
+
+	writeValidatorFile(t, path, "joe", "secret", time.Now())
+	set, err = ValidatorFileLoader(path)()
+	require.NoError(err)
+	assert.IsType(&secure.BasicValidator{}, set.Validators[secure.Basic])
+}
+
+func TestMeteredValidatorFileLoader(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	publicKey, err := filepath.Abs("../jwt-key.pub")
+	require.NoError(err)
+
+	registry, err := xmetrics.NewRegistry(nil, secure.Metrics)
+	require.NoError(err)
+
+	directory, err := ioutil.TempDir("", "validators")
+	require.NoError(err)
+	defer os.RemoveAll(directory)
+
+	data, err := json.Marshal(publicKey)
+	require.NoError(err)
+
+	path := filepath.Join(directory, "validators.json")
+	require.NoError(ioutil.WriteFile(
+		path,
+		[]byte(`{"jwt": [{"keys": {"uri": `+string(data)+`}, "defaultKeyId": "current"}], "tokenCache": {}}`),
+		0600,
+	))
+
+	set, err := MeteredValidatorFileLoader(path, registry)()
+	require.NoError(err)
+	require.IsType(&secure.CachingValidator{}, set.Validators[secure.Bearer])
+
+	// the token cache created from the file reports its metrics to the provider
+	token, err := secure.ParseAuthorization("Bearer notajwt")
+	require.NoError(err)
+	valid, _ := set.Validators[secure.Bearer].Validate(context.Background(), token)
+	assert.False(valid)
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(response.Body.String(), secure.TokenCacheMissCounter+" 1")
+}
+
+func TestNewValidatorReloader(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := NewValidatorReloader(nil, nil)
+	assert.Nil(r)
+	assert.Equal(ErrorNoValidatorLoader, err)
+
+	expectedError := errors.New("expected")
+	r, err = NewValidatorReloader(func() (*ValidatorSet, error) { return nil, expectedError }, nil)
+	assert.Nil(r)
+	assert.Equal(expectedError, err)
+
+	r, err = NewValidatorReloader(func() (*ValidatorSet, error) { return new(ValidatorSet), nil }, &ValidatorReloaderOptions{Files: []string{"nosuchfile"}})
+	assert.Nil(r)
+	assert.Error(err)
+}
+
+func TestValidatorReloaderReload(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+
+		first  = &ValidatorSet{Validator: secure.ExactMatchValidator("first")}
+		second = &ValidatorSet{Validator: secure.ExactMatchValidator("second")}
+
+		loadError error
+		loaded    = first
+	)
+
+	require.NoError(err)
+	r, err := NewValidatorReloader(
+		func() (*ValidatorSet, error) {
+			if loadError != nil {
+				return nil, loadError
+			}
+
+			return loaded, nil
+		},
+		&ValidatorReloaderOptions{Logger: logging.TestLogger(t), MetricsProvider: registry},
+	)
+
+	require.NoError(err)
+	assert.Equal(first, r.ValidatorSet())
+	assert.Equal(1, r.Status().Generation)
+	assert.False(r.Status().Loaded.IsZero())
+
+	loaded = second
+	assert.NoError(r.Reload())
+	assert.Equal(second, r.ValidatorSet())
+	assert.Equal(2, r.Status().Generation)
+	assert.Empty(r.Status().LastError)
+
+	// a failed reload leaves the current validators in effect
+	loadError = errors.New("expected")
+	assert.Equal(loadError, r.Reload())
+	assert.Equal(second, r.ValidatorSet())
+	assert.Equal(2, r.Status().Generation)
+	assert.Equal("expected", r.Status().LastError)
+
+	// without files, there is nothing to watch
+	assert.NoError(r.Run(new(sync.WaitGroup), make(chan struct{})))
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(response.Body.String(), ValidatorReloadCounter+`{outcome="success"} 2`)
+	assert.Contains(response.Body.String(), ValidatorReloadCounter+`{outcome="failure"} 1`)
+}
+
+func TestValidatorReloaderServeHTTP(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		loadError error
+	)
+
+	r, err := NewValidatorReloader(
+		func() (*ValidatorSet, error) { return new(ValidatorSet), loadError },
+		&ValidatorReloaderOptions{Logger: logging.TestLogger(t)},
+	)
+
+	require.NoError(err)
+
+	status := func(method string, expectedCode int) ValidatorStatus {
+		response := httptest.NewRecorder()
+		r.ServeHTTP(response, httptest.NewRequest(method, "/admin/secure/reload", nil))
+		assert.Equal(expectedCode, response.Code)
+		assert.Equal(JsonContentType, response.Header().Get(ContentTypeHeader))
+
+		var s ValidatorStatus
+		require.NoError(json.Unmarshal(response.Body.Bytes(), &s))
+		return s
+	}
+
+	assert.Equal(1, status("GET", http.StatusOK).Generation)
+	assert.Equal(2, status("POST", http.StatusOK).Generation)
+
+	loadError = errors.New("expected")
+	s := status("POST", http.StatusInternalServerError)
+	assert.Equal(2, s.Generation)
+	assert.Equal("expected", s.LastError)
+
+	response := httptest.NewRecorder()
+	r.ServeHTTP(response, httptest.NewRequest("DELETE", "/admin/secure/reload", nil))
+	assert.Equal(http.StatusMethodNotAllowed, response.Code)
+	assert.Equal("GET, POST", response.Header().Get("Allow"))
+}
+
+func TestValidatorReloaderRun(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		start   = time.Now().Add(-time.Hour)
+	)
+
+	directory, err := ioutil.TempDir("", "validators")
+	require.NoError(err)
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "validators.json")
+	writeValidatorFile(t, path, "joe", "secret", start)
+
+	r, err := NewValidatorReloader(ValidatorFileLoader(path), &ValidatorReloaderOptions{Files: []string{path}, Logger: logging.TestLogger(t)})
+	require.NoError(err)
+
+	var (
+		ticks     = make(chan time.Time)
+		waitGroup = new(sync.WaitGroup)
+		shutdown  = make(chan struct{})
+
+		handler = AuthorizationHandler{
+			Logger:          logging.TestLogger(t),
+			ValidatorSource: r,
+		}
+
+		decorated = handler.Decorate(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			response.WriteHeader(http.StatusOK)
+		}))
+
+		authorize = func(principal, password string) int {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set(secure.AuthorizationHeader, basicAuthorization(principal, password))
+			response := httptest.NewRecorder()
+			decorated.ServeHTTP(response, request)
+			return response.Code
+		}
+
+		// tick delivers one tick, then waits for the reloader to process it by delivering another
+		tick = func() {
+			ticks <- time.Now()
+			ticks <- time.Now()
+		}
+	)
+
+	r.tick = func(d time.Duration) <-chan time.Time {
+		assert.Equal(DefaultValidatorCheckInterval, d)
+		return ticks
+	}
+
+	require.NoError(r.Run(waitGroup, shutdown))
+	defer func() {
+		close(shutdown)
+		waitGroup.Wait()
+	}()
+
+	assert.Equal(http.StatusOK, authorize("joe", "secret"))
+	assert.Equal(http.StatusForbidden, authorize("jane", "secret"))
+
+	// an unchanged file is not reloaded
+	tick()
+	assert.Equal(1, r.Status().Generation)
+
+	writeValidatorFile(t, path, "jane", "secret", start.Add(time.Minute))
+	tick()
+	assert.Equal(2, r.Status().Generation)
+	assert.Equal(http.StatusForbidden, authorize("joe", "secret"))
+	assert.Equal(http.StatusOK, authorize("jane", "secret"))
+
+	// a broken file leaves the previous validators in effect
+	require.NoError(ioutil.WriteFile(path, []byte("this is not JSON"), 0600))
+	require.NoError(os.Chtimes(path, start.Add(2*time.Minute), start.Add(2*time.Minute)))
+	tick()
+	assert.Equal(2, r.Status().Generation)
+	assert.NotEmpty(r.Status().LastError)
+	assert.Equal(http.StatusOK, authorize("jane", "secret"))
+
+	// a missing file is reported, and also leaves the validators in effect
+	require.NoError(os.Remove(path))
+	tick()
+	assert.Equal(http.StatusOK, authorize("jane", "secret"))
+}
+
+func TestAuthorizationHandlerValidatorSource(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		lock    sync.Mutex
+		current *ValidatorSet
+
+		handler = AuthorizationHandler{
+			Logger: logging.TestLogger(t),
+			ValidatorSource: ValidatorSourceFunc(func() *ValidatorSet {
+				lock.Lock()
+				defer lock.Unlock()
+				return current
+			}),
+		}
+
+		swap = func(set *ValidatorSet) {
+			lock.Lock()
+			current = set
+			lock.Unlock()
+		}
+
+		started  = make(chan struct{})
+		finish   = make(chan struct{})
+		finished = make(chan int, 1)
+
+		decorated = handler.Decorate(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			if request.URL.Path == "/slow" {
+				close(started)
+				<-finish
+			}
+
+			response.WriteHeader(http.StatusOK)
+		}))
+
+		authorize = func(path, value string) int {
+			request := httptest.NewRequest("GET", path, nil)
+			request.Header.Set(secure.AuthorizationHeader, value)
+			response := httptest.NewRecorder()
+			decorated.ServeHTTP(response, request)
+			return response.Code
+		}
+	)
+
+	// a source with no current set allows nothing
+	assert.Equal(http.StatusForbidden, authorize("/", "Basic first"))
+
+	swap(&ValidatorSet{Validator: secure.ExactMatchValidator("first")})
+	assert.Equal(http.StatusOK, authorize("/", "Basic first"))
+
+	// an in-flight request completes even when the validators are swapped
+	go func() {
+		finished <- authorize("/slow", "Basic first")
+	}()
+
+	<-started
+	swap(&ValidatorSet{Validators: map[secure.TokenType]secure.Validator{secure.Basic: secure.ExactMatchValidator("second")}})
+	close(finish)
+
+	select {
+	case code := <-finished:
+		assert.Equal(http.StatusOK, code)
+	case <-time.After(5 * time.Second):
+		assert.Fail("The in-flight request did not complete")
+	}
+
+	assert.Equal(http.StatusForbidden, authorize("/", "Basic first"))
+	assert.Equal(http.StatusOK, authorize("/", "Basic second"))
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"errors"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/justinas/alice"
+	"github.com/spf13/viper"
+)
+
+const (
+	// StackKey is the Viper subkey under which StackOptions are typically stored.
+	// In a JSON configuration file, this will be expressed as:
+	//
+	//   {
+	//     /* other stuff can be here */
+	//
+	//     "secure": {
+	//       "requestIDHeader": "X-Request-Id",
+	//       "allow": ["10.0.0.0/8"],
+	//       "deny": ["10.1.2.3"],
+	//       "rateLimit": 50,
+	//       "rateBurst": 100,
+	//       "rateLimitByToken": true
+	//     }
+	//   }
+	StackKey = "secure"
+
+	// DefaultStackRateLimit is the sustained number of requests per second allowed for each client
+	// by a stack when no rate limit is configured
+	DefaultStackRateLimit float64 = 100
+)
+
+var (
+	// ErrorNoValidators is returned when a stack is requested for an AuthorizationHandler that cannot authorize anything
+	ErrorNoValidators = errors.New("A secure stack requires at least one validator")
+)
+
+// StackOptions configures the standard secure middleware stack
+type StackOptions struct {
+	// RequestIDHeader is the header carrying request IDs.  If not supplied, logging.DefaultRequestIDHeader is used.
+	RequestIDHeader string
+
+	// DisableAccessLog turns off access logging
+	DisableAccessLog bool
+
+	// Allow is the list of CIDR blocks or IP addresses from which requests are accepted.
+	// If empty, requests are accepted from any address not in Deny.
+	Allow []string
+
+	// Deny is the list of CIDR blocks or IP addresses from which requests are rejected
+	Deny []string
+
+	// RateLimit is the sustained number of requests per second allowed for each client.  If zero,
+	// DefaultStackRateLimit is used.  If negative, rate limiting is disabled.
+	RateLimit float64
+
+	// RateBurst is the maximum number of requests allowed at once for each client.  If not
+	// supplied, the RateLimitHandler default is used.
+	RateBurst int
+
+	// RateLimitByToken limits requests per authenticated subject or token rather than per remote IP
+	RateLimitByToken bool
+}
+
+// NewStackOptions unmarshals a StackOptions from a Viper environment.  If v is nil, the
+// returned options produce the default stack.
+func NewStackOptions(v *viper.Viper) (o *StackOptions, err error) {
+	o = new(StackOptions)
+	if v != nil {
+		err = v.Unmarshal(o)
+	}
+
+	return
+}
+
+func (o *StackOptions) rateLimit() float64 {
+	if o.RateLimit != 0 {
+		return o.RateLimit
+	}
+
+	return DefaultStackRateLimit
+}
+
+// Chain builds the standard secure middleware stack around the given AuthorizationHandler.  In order, the
+// stack recovers from panics, assigns request IDs and per-request loggers, logs access, enforces the IP policy, authorizes, and rate limits.
+// The logger and the authorization handler's ErrorEncoder are shared by every layer, and the logger is used by
+// the authorization handler if it has none of its own.
+//
+// ErrorNoValidators is returned if the authorization handler has no validators, since such a stack would
+// not be secure.  An error is also returned if the IP policy cannot be parsed.
+func (o *StackOptions) Chain(logger logging.Logger, authorization AuthorizationHandler) (alice.Chain, error) {
+	if authorization.Validator == nil && len(authorization.Validators) == 0 {
+		return alice.Chain{}, ErrorNoValidators
+	}
+
+	allow, err := ParseNetworks(o.Allow)
+	if err != nil {
+		return alice.Chain{}, err
+	}
+
+	deny, err := ParseNetworks(o.Deny)
+	if err != nil {
+		return alice.Chain{}, err
+	}
+
+	if logger == nil {
+		logger = logging.DefaultLogger()
+	}
+
+	if authorization.Logger == nil {
+		authorization.Logger = logger
+	}
+
+	var (
+		errorEncoder = authorization.ErrorEncoder
+		keyFunc      RateLimitKeyFunc
+	)
+
+	if o.RateLimitByToken {
+		keyFunc = ByToken(authorization.HeaderName)
+	}
+
+	constructors := []alice.Constructor{
+		RecoveryHandler{Logger: logger, ErrorEncoder: errorEncoder}.Decorate,
+		logging.RequestHandler{Logger: logging.Structured(logger), HeaderName: o.RequestIDHeader}.Decorate,
+	}
+
+	if !o.DisableAccessLog {
+		constructors = append(constructors, AccessLogHandler{Logger: logger}.Decorate)
+	}
+
+	constructors = append(
+		constructors,
+		IPPolicyHandler{Allow: allow, Deny: deny, Logger: logger, ErrorEncoder: errorEncoder}.Decorate,
+		authorization.Decorate,
+		RateLimitHandler{Rate: o.rateLimit(), Burst: o.RateBurst, KeyFunc: keyFunc, Logger: logger, ErrorEncoder: errorEncoder}.Decorate,
+	)
+
+	return alice.New(constructors...), nil
+}
+
+// NewStack is a one-call construction of the standard secure middleware stack, configured from a Viper
+// environment.  See StackOptions.Chain for the structure of the stack.  Since validators require keys and
+// other resources, they must be supplied via the AuthorizationHandler rather than configuration.
+func NewStack(logger logging.Logger, v *viper.Viper, authorization AuthorizationHandler) (alice.Chain, error) {
+	o, err := NewStackOptions(v)
+	if err != nil {
+		return alice.Chain{}, err
+	}
+
+	return o.Chain(logger, authorization)
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"bytes"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testStackViper(t *testing.T, configuration string) *viper.Viper {
+	v := viper.New()
+	v.SetConfigType("json")
+	require.NoError(t, v.ReadConfig(bytes.NewBufferString(configuration)))
+	return v.Sub(StackKey)
+}
+
+func TestNewStackOptions(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	o, err := NewStackOptions(nil)
+	require.NoError(err)
+	assert.Equal(StackOptions{}, *o)
+	assert.Equal(DefaultStackRateLimit, o.rateLimit())
+
+	o, err = NewStackOptions(testStackViper(t, `{
+		"secure": {
+			"requestIDHeader": "X-Correlation-Id",
+			"disableAccessLog": true,
+			"allow": ["10.0.0.0/8"],
+			"deny": ["10.1.2.3"],
+			"rateLimit": -1,
+			"rateBurst": 5,
+			"rateLimitByToken": true
+		}
+	}`))
+
+	require.NoError(err)
+	assert.Equal(
+		StackOptions{
+			RequestIDHeader:  "X-Correlation-Id",
+			DisableAccessLog: true,
+			Allow:            []string{"10.0.0.0/8"},
+			Deny:             []string{"10.1.2.3"},
+			RateLimit:        -1,
+			RateBurst:        5,
+			RateLimitByToken: true,
+		},
+		*o,
+	)
+}
+
+func TestNewStackInvalid(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		logger        = logging.TestLogger(t)
+		authorization = AuthorizationHandler{Validator: secure.ExactMatchValidator(tokenValue)}
+	)
+
+	_, err := NewStack(logger, nil, AuthorizationHandler{})
+	assert.Equal(ErrorNoValidators, err)
+
+	_, err = NewStack(logger, testStackViper(t, `{"secure": {"allow": ["bad"]}}`), authorization)
+	assert.Error(err)
+
+	_, err = NewStack(logger, testStackViper(t, `{"secure": {"deny": ["bad"]}}`), authorization)
+	assert.Error(err)
+
+	_, err = NewStack(logger, testStackViper(t, `{"secure": {"rateLimit": "not a number"}}`), authorization)
+	assert.Error(err)
+}
+
+func TestNewStack(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		chain, err = NewStack(
+			logging.TestLogger(t),
+			testStackViper(t, `{"secure": {"deny": ["192.168.1.1"], "rateLimit": 1, "rateBurst": 2}}`),
+			AuthorizationHandler{Validator: secure.ExactMatchValidator(tokenValue)},
+		)
+	)
+
+	require.NoError(err)
+	handler := chain.Then(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/panic" {
+			panic("expected")
+		}
+
+		_, ok := logging.GetRequestID(request.Context())
+		assert.True(ok)
+		response.WriteHeader(222)
+	}))
+
+	var testData = []struct {
+		path               string
+		remoteAddr         string
+		authorization      string
+		expectedStatusCode int
+	}{
+		{"/test", "192.168.1.1:1234", authorizationValue, http.StatusForbidden},
+		{"/test", "10.0.0.1:1234", "", http.StatusForbidden},
+		{"/test", "10.0.0.1:1234", authorizationValue, 222},
+		{"/panic", "10.0.0.1:1234", authorizationValue, http.StatusInternalServerError},
+		{"/test", "10.0.0.1:1234", authorizationValue, http.StatusTooManyRequests},
+		{"/test", "10.0.0.2:1234", authorizationValue, 222},
+	}
+
+	for index, record := range testData {
+		t.Logf("%d", index)
+
+		request := httptest.NewRequest("GET", record.path, nil)
+		request.RemoteAddr = record.remoteAddr
+		if len(record.authorization) > 0 {
+			request.Header.Set(secure.AuthorizationHeader, record.authorization)
+		}
+
+		response := httptest.NewRecorder()
+		assert.NotPanics(func() { handler.ServeHTTP(response, request) })
+		assert.Equal(record.expectedStatusCode, response.Code)
+		assert.Len(response.HeaderMap.Get(logging.DefaultRequestIDHeader), 32)
+	}
+}
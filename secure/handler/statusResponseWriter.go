@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// statusResponseWriter records the status code and number of bytes written to a response
+type statusResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	written    int64
+}
+
+func (s *statusResponseWriter) WriteHeader(statusCode int) {
+	if s.statusCode == 0 {
+		s.statusCode = statusCode
+	}
+
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (s *statusResponseWriter) Write(data []byte) (int, error) {
+	if s.statusCode == 0 {
+		s.statusCode = http.StatusOK
+	}
+
+	count, err := s.ResponseWriter.Write(data)
+	s.written += int64(count)
+	return count, err
+}
+
+// Flush delegates to the wrapped ResponseWriter.  If the delegate does not
+// implement http.Flusher, this method does nothing.
+func (s *statusResponseWriter) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
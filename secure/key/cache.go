@@ -2,6 +2,7 @@ package key
 
 import (
 	"github.com/Comcast/webpa-common/concurrent"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,7 +18,10 @@ const (
 // All implementations will block the first time a particular key is accessed
 // and will initialize the value for that key.  Thereafter, all updates happen
 // in a separate goroutine.  This allows HTTP transactions to avoid paying
-// the cost of loading a key after the initial fetch.
+// the cost of loading a key after the initial fetch.  The exception is a cache
+// with a TTL, which reloads an expired key the next time it is accessed.
+//
+// The caches created by this package also implement Refresher.
 type Cache interface {
 	Resolver
 
@@ -36,11 +40,38 @@ type Cache interface {
 	UpdateKeys() (int, []error)
 }
 
+// Listener is notified when a cached key is replaced by a different key, i.e. when the key has been rotated.
+// Listeners are invoked synchronously by the goroutine which loaded the new key, and must not block.
+type Listener func(keyID string, previous, current Pair)
+
+// Refresher is implemented by Resolvers which can reload a key on demand.  This allows clients to
+// pick up a rotated key before its cached copy would otherwise be updated.
+type Refresher interface {
+	// RefreshKey reloads the key associated with the given identifier, bypassing any cache.  Implementations
+	// may return the cached key without reloading it if that key was loaded recently.
+	RefreshKey(keyID string) (Pair, error)
+}
+
+// entry is a cached key together with the time it was loaded
+type entry struct {
+	pair   Pair
+	loaded time.Time
+}
+
 // basicCache contains the internal members common to all cache implementations
 type basicCache struct {
 	delegate   Resolver
 	value      atomic.Value
 	updateLock sync.Mutex
+
+	// ttl is how long a key is used before ResolveKey reloads it.  If nonpositive, keys never expire.
+	ttl time.Duration
+
+	// minRefresh is how old a key must be before RefreshKey will reload it
+	minRefresh time.Duration
+
+	listeners []Listener
+	now       func() time.Time
 }
 
 func (b *basicCache) load() interface{} {
@@ -58,41 +89,109 @@ func (b *basicCache) update(operation func()) {
 	operation()
 }
 
+func (b *basicCache) currentTime() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+
+	return time.Now()
+}
+
+func (b *basicCache) newEntry(pair Pair) entry {
+	return entry{pair: pair, loaded: b.currentTime()}
+}
+
+// expired tests if a cached key has outlived the ttl
+func (b *basicCache) expired(e entry) bool {
+	return b.ttl > 0 && b.currentTime().Sub(e.loaded) >= b.ttl
+}
+
+// refreshable tests if a cached key is old enough to be reloaded by RefreshKey
+func (b *basicCache) refreshable(e entry) bool {
+	return b.currentTime().Sub(e.loaded) >= b.minRefresh
+}
+
+// rotated notifies listeners if a key was replaced by a key with a different public key
+func (b *basicCache) rotated(keyID string, previous, current Pair) {
+	if len(b.listeners) == 0 || previous == nil || current == nil || previous == current {
+		return
+	}
+
+	if reflect.DeepEqual(previous.Public(), current.Public()) {
+		return
+	}
+
+	for _, listener := range b.listeners {
+		listener(keyID, previous, current)
+	}
+}
+
 // singleCache assumes that the delegate Resolver
 // only returns (1) key.
 type singleCache struct {
 	basicCache
 }
 
-func (cache *singleCache) ResolveKey(keyID string) (pair Pair, err error) {
-	var ok bool
-	pair, ok = cache.load().(Pair)
-	if !ok {
-		cache.update(func() {
-			pair, ok = cache.load().(Pair)
-			if !ok {
-				pair, err = cache.delegate.ResolveKey(keyID)
-				if err == nil {
-					cache.store(pair)
-				}
+func (cache *singleCache) fetchEntry() (e entry, ok bool) {
+	e, ok = cache.load().(entry)
+	return
+}
+
+// reload loads the key from the delegate if there is no cached key or if stale reports that the
+// cached key must be replaced.  The stale check happens inside the critical section, so that concurrent
+// reloads only invoke the delegate once.  The previously cached key, if any, is always returned.
+func (cache *singleCache) reload(keyID string, stale func(entry) bool) (pair, previous Pair, err error) {
+	cache.update(func() {
+		existing, ok := cache.fetchEntry()
+		if ok {
+			previous = existing.pair
+			if !stale(existing) {
+				pair = existing.pair
+				return
 			}
-		})
+		}
+
+		pair, err = cache.delegate.ResolveKey(keyID)
+		if err == nil {
+			cache.store(cache.newEntry(pair))
+		}
+	})
+
+	if err == nil {
+		cache.rotated(keyID, previous, pair)
 	}
 
 	return
 }
 
+func (cache *singleCache) ResolveKey(keyID string) (Pair, error) {
+	if existing, ok := cache.fetchEntry(); ok && !cache.expired(existing) {
+		return existing.pair, nil
+	}
+
+	pair, previous, err := cache.reload(keyID, cache.expired)
+	if err != nil && previous != nil {
+		// keep using an expired key until it can be reloaded
+		return previous, nil
+	}
+
+	return pair, err
+}
+
+func (cache *singleCache) RefreshKey(keyID string) (pair Pair, err error) {
+	pair, _, err = cache.reload(keyID, cache.refreshable)
+	return
+}
+
 func (cache *singleCache) UpdateKeys() (count int, errors []error) {
 	count = 1
-	cache.update(func() {
-		// this type of cache is specifically for resolvers which don't use the keyID,
-		// so just pass an empty string in
-		if pair, err := cache.delegate.ResolveKey(dummyKeyId); err == nil {
-			cache.store(pair)
-		} else {
-			errors = []error{err}
-		}
-	})
+
+	// this type of cache is specifically for resolvers which don't use the keyID,
+	// so just pass an empty string in
+	_, _, err := cache.reload(dummyKeyId, func(entry) bool { return true })
+	if err != nil {
+		errors = []error{err}
+	}
 
 	return
 }
@@ -106,66 +205,100 @@ type multiCache struct {
 	basicCache
 }
 
-// fetchPair uses the atomic reference to the keys map and attempts
+// fetchEntry uses the atomic reference to the keys map and attempts
 // to fetch the key from the cache.
-func (cache *multiCache) fetchPair(keyID string) (pair Pair, ok bool) {
-	pairs, ok := cache.load().(map[string]Pair)
+func (cache *multiCache) fetchEntry(keyID string) (e entry, ok bool) {
+	entries, ok := cache.load().(map[string]entry)
 	if ok {
-		pair, ok = pairs[keyID]
+		e, ok = entries[keyID]
 	}
 
 	return
 }
 
-// copyPairs creates a copy of the current key cache.  If no keys are present
+// copyEntries creates a copy of the current key cache.  If no keys are present
 // yet, this method returns a non-nil empty map.
-func (cache *multiCache) copyPairs() map[string]Pair {
-	pairs, _ := cache.load().(map[string]Pair)
+func (cache *multiCache) copyEntries() map[string]entry {
+	entries, _ := cache.load().(map[string]entry)
 
 	// make the capacity 1 larger, since this method is almost always
 	// going to be invoked prior to doing a copy-on-write update.
-	newPairs := make(map[string]Pair, len(pairs)+1)
+	newEntries := make(map[string]entry, len(entries)+1)
 
-	for keyID, pair := range pairs {
-		newPairs[keyID] = pair
+	for keyID, e := range entries {
+		newEntries[keyID] = e
 	}
 
-	return newPairs
+	return newEntries
 }
 
-func (cache *multiCache) ResolveKey(keyID string) (pair Pair, err error) {
-	var ok bool
-	pair, ok = cache.fetchPair(keyID)
-	if !ok {
-		cache.update(func() {
-			pair, ok = cache.fetchPair(keyID)
-			if !ok {
-				pair, err = cache.delegate.ResolveKey(keyID)
-				if err == nil {
-					newPairs := cache.copyPairs()
-					newPairs[keyID] = pair
-					cache.store(newPairs)
-				}
+// reload loads the key with the given id from the delegate if it is not cached or if stale reports that the
+// cached key must be replaced.  The previously cached key, if any, is always returned.
+func (cache *multiCache) reload(keyID string, stale func(entry) bool) (pair, previous Pair, err error) {
+	cache.update(func() {
+		existing, ok := cache.fetchEntry(keyID)
+		if ok {
+			previous = existing.pair
+			if !stale(existing) {
+				pair = existing.pair
+				return
 			}
-		})
+		}
+
+		pair, err = cache.delegate.ResolveKey(keyID)
+		if err == nil {
+			newEntries := cache.copyEntries()
+			newEntries[keyID] = cache.newEntry(pair)
+			cache.store(newEntries)
+		}
+	})
+
+	if err == nil {
+		cache.rotated(keyID, previous, pair)
 	}
 
 	return
 }
 
+func (cache *multiCache) ResolveKey(keyID string) (Pair, error) {
+	if existing, ok := cache.fetchEntry(keyID); ok && !cache.expired(existing) {
+		return existing.pair, nil
+	}
+
+	pair, previous, err := cache.reload(keyID, cache.expired)
+	if err != nil && previous != nil {
+		// keep using an expired key until it can be reloaded
+		return previous, nil
+	}
+
+	return pair, err
+}
+
+func (cache *multiCache) RefreshKey(keyID string) (pair Pair, err error) {
+	pair, _, err = cache.reload(keyID, cache.refreshable)
+	return
+}
+
 func (cache *multiCache) UpdateKeys() (count int, errors []error) {
-	if existingPairs, ok := cache.load().(map[string]Pair); ok {
-		count = len(existingPairs)
+	type rotation struct {
+		keyID             string
+		previous, current Pair
+	}
+
+	var rotations []rotation
+	if existingEntries, ok := cache.load().(map[string]entry); ok {
+		count = len(existingEntries)
 		cache.update(func() {
 			newCount := 0
-			newPairs := make(map[string]Pair, len(existingPairs))
-			for keyID, oldPair := range existingPairs {
+			newEntries := make(map[string]entry, len(existingEntries))
+			for keyID, oldEntry := range existingEntries {
 				if newPair, err := cache.delegate.ResolveKey(keyID); err == nil {
 					newCount++
-					newPairs[keyID] = newPair
+					newEntries[keyID] = cache.newEntry(newPair)
+					rotations = append(rotations, rotation{keyID, oldEntry.pair, newPair})
 				} else {
 					// keep the old key in the event of an error
-					newPairs[keyID] = oldPair
+					newEntries[keyID] = oldEntry
 					errors = append(errors, err)
 				}
 			}
@@ -173,11 +306,15 @@ func (cache *multiCache) UpdateKeys() (count int, errors []error) {
 			// small optimization: don't bother doing the atomic swap
 			// if every key operation failed
 			if newCount > 0 {
-				cache.store(newPairs)
+				cache.store(newEntries)
 			}
 		})
 	}
 
+	for _, r := range rotations {
+		cache.rotated(r.keyID, r.previous, r.current)
+	}
+
 	return
 }
 
@@ -71,7 +71,7 @@ func TestSingleCacheResolveKey(t *testing.T) {
 
 	mock.AssertExpectationsForObjects(t, expectedPair.Mock)
 	mock.AssertExpectationsForObjects(t, resolver.Mock)
-	assert.Equal(expectedPair, cache.load())
+	assert.Equal(expectedPair, cache.load().(entry).pair)
 }
 
 func TestSingleCacheResolveKeyError(t *testing.T) {
@@ -451,3 +451,182 @@ func TestNewUpdater(t *testing.T) {
 		waitGroup.Wait()
 	}
 }
+
+// basicCacheOf returns the basicCache embedded in one of this package's caches
+func basicCacheOf(cache Cache) *basicCache {
+	switch c := cache.(type) {
+	case *singleCache:
+		return &c.basicCache
+	case *multiCache:
+		return &c.basicCache
+	}
+
+	return nil
+}
+
+func TestCacheTTL(t *testing.T) {
+	const keyID = "TestCacheTTL"
+
+	for _, cache := range []Cache{new(singleCache), new(multiCache)} {
+		var (
+			assert        = assert.New(t)
+			now           = time.Now()
+			oldPair       = &MockPair{}
+			newPair       = &MockPair{}
+			expectedError = errors.New("expected")
+			resolver      = &MockResolver{}
+		)
+
+		resolver.On("ResolveKey", keyID).Return(oldPair, nil).Once()
+		resolver.On("ResolveKey", keyID).Return(nil, expectedError).Once()
+		resolver.On("ResolveKey", keyID).Return(newPair, nil).Once()
+
+		b := basicCacheOf(cache)
+		b.delegate = resolver
+		b.ttl = time.Minute
+		b.now = func() time.Time { return now }
+
+		pair, err := cache.ResolveKey(keyID)
+		assert.Equal(oldPair, pair)
+		assert.NoError(err)
+
+		// not yet expired, so the delegate is not invoked
+		now = now.Add(30 * time.Second)
+		pair, err = cache.ResolveKey(keyID)
+		assert.Equal(oldPair, pair)
+		assert.NoError(err)
+
+		// an expired key is still used when it cannot be reloaded
+		now = now.Add(30 * time.Second)
+		pair, err = cache.ResolveKey(keyID)
+		assert.Equal(oldPair, pair)
+		assert.NoError(err)
+
+		pair, err = cache.ResolveKey(keyID)
+		assert.Equal(newPair, pair)
+		assert.NoError(err)
+
+		pair, err = cache.ResolveKey(keyID)
+		assert.Equal(newPair, pair)
+		assert.NoError(err)
+
+		resolver.AssertExpectations(t)
+		oldPair.AssertExpectations(t)
+		newPair.AssertExpectations(t)
+	}
+}
+
+func TestCacheRefreshKey(t *testing.T) {
+	const keyID = "TestCacheRefreshKey"
+
+	for _, cache := range []Cache{new(singleCache), new(multiCache)} {
+		var (
+			assert        = assert.New(t)
+			now           = time.Now()
+			oldPair       = &MockPair{}
+			newPair       = &MockPair{}
+			expectedError = errors.New("expected")
+			resolver      = &MockResolver{}
+		)
+
+		resolver.On("ResolveKey", keyID).Return(oldPair, nil).Once()
+		resolver.On("ResolveKey", keyID).Return(nil, expectedError).Once()
+		resolver.On("ResolveKey", keyID).Return(newPair, nil).Once()
+
+		b := basicCacheOf(cache)
+		b.delegate = resolver
+		b.minRefresh = time.Minute
+		b.now = func() time.Time { return now }
+
+		refresher, ok := cache.(Refresher)
+		if !assert.True(ok) {
+			continue
+		}
+
+		// refreshing an uncached key loads it
+		pair, err := refresher.RefreshKey(keyID)
+		assert.Equal(oldPair, pair)
+		assert.NoError(err)
+
+		// a recently loaded key is not reloaded
+		pair, err = refresher.RefreshKey(keyID)
+		assert.Equal(oldPair, pair)
+		assert.NoError(err)
+
+		now = now.Add(time.Minute)
+		pair, err = refresher.RefreshKey(keyID)
+		assert.Nil(pair)
+		assert.Equal(expectedError, err)
+
+		// the failed refresh leaves the cached key alone
+		pair, err = cache.ResolveKey(keyID)
+		assert.Equal(oldPair, pair)
+		assert.NoError(err)
+
+		pair, err = refresher.RefreshKey(keyID)
+		assert.Equal(newPair, pair)
+		assert.NoError(err)
+
+		pair, err = cache.ResolveKey(keyID)
+		assert.Equal(newPair, pair)
+		assert.NoError(err)
+
+		resolver.AssertExpectations(t)
+		oldPair.AssertExpectations(t)
+		newPair.AssertExpectations(t)
+	}
+}
+
+func TestCacheListeners(t *testing.T) {
+	const keyID = "TestCacheListeners"
+
+	type rotation struct {
+		keyID             string
+		previous, current Pair
+	}
+
+	for _, cache := range []Cache{new(singleCache), new(multiCache)} {
+		var (
+			assert    = assert.New(t)
+			first     = &rsaPair{public: "first"}
+			same      = &rsaPair{public: "first"}
+			rotated   = &rsaPair{public: "rotated"}
+			resolver  = &MockResolver{}
+			rotations []rotation
+		)
+
+		resolver.On("ResolveKey", keyID).Return(first, nil).Once()
+		resolver.On("ResolveKey", mock.AnythingOfType("string")).Return(same, nil).Once()
+		resolver.On("ResolveKey", mock.AnythingOfType("string")).Return(rotated, nil).Once()
+
+		b := basicCacheOf(cache)
+		b.delegate = resolver
+		b.listeners = []Listener{
+			func(keyID string, previous, current Pair) {
+				rotations = append(rotations, rotation{keyID, previous, current})
+			},
+		}
+
+		// the first load is not a rotation
+		pair, err := cache.ResolveKey(keyID)
+		assert.Equal(first, pair)
+		assert.NoError(err)
+		assert.Empty(rotations)
+
+		// reloading the same key is not a rotation
+		count, errs := cache.UpdateKeys()
+		assert.Equal(1, count)
+		assert.Empty(errs)
+		assert.Empty(rotations)
+
+		count, errs = cache.UpdateKeys()
+		assert.Equal(1, count)
+		assert.Empty(errs)
+		if assert.Len(rotations, 1) {
+			assert.Equal(same, rotations[0].previous)
+			assert.Equal(rotated, rotations[0].current)
+		}
+
+		resolver.AssertExpectations(t)
+	}
+}
@@ -1,4 +1,13 @@
 /*
 Package key provides a simple API for loading public and private keys from resources.
+
+Keys may be PEM-encoded, raw DER, or base64-encoded DER, and may be loaded from files, URLs, or data
+embedded in configuration.  Resolvers created by ResolverFactory cache keys, optionally expiring them
+after a TTL, and notify Listeners when a key is rotated.
+
+Keys may instead be held in a Module, such as a hardware security module, so that private keys and HMAC
+secrets never leave it.  PKCS#11 tokens are supported via OpenModule when building with the pkcs11 tag,
+which requires cgo and github.com/miekg/pkcs11.  SoftwareModule is the pure-Go implementation for builds
+without that tag.
 */
 package key
@@ -41,6 +41,20 @@ func (cache *MockCache) UpdateKeys() (int, []error) {
 	}
 }
 
+// MockRefresher is a stretchr mock for a Resolver which is also a Refresher.  It's exposed for other package tests.
+type MockRefresher struct {
+	MockResolver
+}
+
+func (refresher *MockRefresher) RefreshKey(keyId string) (Pair, error) {
+	arguments := refresher.Called(keyId)
+	if pair, ok := arguments.Get(0).(Pair); ok {
+		return pair, arguments.Error(1)
+	}
+
+	return nil, arguments.Error(1)
+}
+
 // MockPair is a stretchr mock for Pair.  It's exposed for other package tests.
 type MockPair struct {
 	mock.Mock
@@ -0,0 +1,121 @@
+package key
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrorPKCS11NotSupported is returned by OpenModule when this package was built without the pkcs11 build tag
+	ErrorPKCS11NotSupported = errors.New("PKCS#11 support requires building with the pkcs11 tag")
+
+	// ErrorNoModuleLibrary is returned by OpenModule when no PKCS#11 library is configured
+	ErrorNoModuleLibrary = errors.New("A PKCS#11 library is required")
+
+	// ErrorUnsupportedHash is returned when a Module does not support the requested hash
+	ErrorUnsupportedHash = errors.New("Unsupported hash")
+)
+
+// Module is a store of keys whose private material may never leave it, such as a hardware security module.
+// Keys are identified by label.  Implementations must be safe for concurrent access.
+//
+// OpenModule provides a Module backed by a PKCS#11 token, and SoftwareModule is the pure-Go implementation
+// used when no hardware is available, e.g. in development and tests.
+type Module interface {
+	// PublicKey returns the public key with the given label
+	PublicKey(label string) (crypto.PublicKey, error)
+
+	// Signer returns a crypto.Signer for the private key with the given label.  Signatures are computed
+	// by the module, so the private key is never exposed.
+	Signer(label string) (crypto.Signer, error)
+
+	// HMAC computes the HMAC of data using the given hash and the secret key with the given label
+	HMAC(label string, h crypto.Hash, data []byte) ([]byte, error)
+
+	// Close releases any resources held by this module
+	Close() error
+}
+
+// ModuleOptions configures access to a PKCS#11 token
+type ModuleOptions struct {
+	// Library is the path to the vendor's PKCS#11 shared library
+	Library string `json:"library"`
+
+	// TokenLabel selects the token holding the keys.  If not supplied, the first token present is used.
+	TokenLabel string `json:"tokenLabel,omitempty"`
+
+	// PIN is the user PIN used to log into the token
+	PIN string `json:"pin"`
+}
+
+// OpenModule opens a PKCS#11 token as a Module.  PKCS#11 support depends upon cgo and the vendor's library,
+// so it is only compiled when building with the pkcs11 tag.  Otherwise, this function returns
+// ErrorPKCS11NotSupported, and SoftwareModule may be used instead.
+func OpenModule(o *ModuleOptions) (Module, error) {
+	if o == nil || len(o.Library) == 0 {
+		return nil, ErrorNoModuleLibrary
+	}
+
+	return openPKCS11(o)
+}
+
+// modulePair is the Pair implementation for keys held in a Module
+type modulePair struct {
+	purpose Purpose
+	public  crypto.PublicKey
+	private crypto.Signer
+}
+
+func (mp *modulePair) Purpose() Purpose {
+	return mp.purpose
+}
+
+func (mp *modulePair) Public() interface{} {
+	return mp.public
+}
+
+func (mp *modulePair) HasPrivate() bool {
+	return mp.private != nil
+}
+
+func (mp *modulePair) Private() interface{} {
+	if mp.private != nil {
+		return mp.private
+	}
+
+	return nil
+}
+
+// ModuleResolver is a Resolver for the keys in a Module, where each key id is the label of a key.  Pairs
+// resolved for purposes which require a private key hold a crypto.Signer as their private key.
+type ModuleResolver struct {
+	Module  Module
+	Purpose Purpose
+}
+
+func (r *ModuleResolver) ResolveKey(keyId string) (Pair, error) {
+	pair := &modulePair{purpose: r.Purpose}
+	if r.Purpose.RequiresPrivateKey() {
+		signer, err := r.Module.Signer(keyId)
+		if err != nil {
+			return nil, err
+		}
+
+		pair.public = signer.Public()
+		pair.private = signer
+	} else {
+		public, err := r.Module.PublicKey(keyId)
+		if err != nil {
+			return nil, err
+		}
+
+		pair.public = public
+	}
+
+	if pair.public == nil {
+		return nil, fmt.Errorf("No public key for %s", keyId)
+	}
+
+	return pair, nil
+}
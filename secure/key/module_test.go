@@ -0,0 +1,87 @@
+package key
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestOpenModule(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, o := range []*ModuleOptions{nil, new(ModuleOptions)} {
+		module, err := OpenModule(o)
+		assert.Nil(module)
+		assert.Equal(ErrorNoModuleLibrary, err)
+	}
+}
+
+func TestModuleResolver(t *testing.T) {
+	var (
+		require = require.New(t)
+		module  = new(SoftwareModule)
+	)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(err)
+	module.AddSigner("signer", privateKey)
+	module.AddPublicKey("verifier", &privateKey.PublicKey)
+
+	t.Run("Verify", func(t *testing.T) {
+		assert := assert.New(t)
+		resolver := &ModuleResolver{Module: module, Purpose: PurposeVerify}
+
+		for _, keyId := range []string{"signer", "verifier"} {
+			pair, err := resolver.ResolveKey(keyId)
+			require.NoError(err)
+			assert.Equal(PurposeVerify, pair.Purpose())
+			assert.Equal(&privateKey.PublicKey, pair.Public())
+			assert.False(pair.HasPrivate())
+			assert.Nil(pair.Private())
+		}
+
+		pair, err := resolver.ResolveKey("nosuch")
+		assert.Nil(pair)
+		assert.Error(err)
+	})
+
+	t.Run("Sign", func(t *testing.T) {
+		assert := assert.New(t)
+		resolver := &ModuleResolver{Module: module, Purpose: PurposeSign}
+
+		pair, err := resolver.ResolveKey("signer")
+		require.NoError(err)
+		assert.Equal(PurposeSign, pair.Purpose())
+		assert.Equal(&privateKey.PublicKey, pair.Public())
+		assert.True(pair.HasPrivate())
+
+		signer, ok := pair.Private().(crypto.Signer)
+		require.True(ok)
+
+		digest := sha256.Sum256([]byte("data"))
+		signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		require.NoError(err)
+		assert.NoError(rsa.VerifyPKCS1v15(&privateKey.PublicKey, crypto.SHA256, digest[:], signature))
+
+		pair, err = resolver.ResolveKey("verifier")
+		assert.Nil(pair)
+		assert.Error(err)
+	})
+
+	t.Run("Factory", func(t *testing.T) {
+		assert := assert.New(t)
+		factory := &ResolverFactory{Purpose: PurposeVerify, Module: module}
+
+		resolver, err := factory.NewResolver()
+		require.NoError(err)
+		assert.Equal(&ModuleResolver{Module: module, Purpose: PurposeVerify}, resolver)
+
+		pair, err := resolver.ResolveKey("verifier")
+		require.NoError(err)
+		assert.Equal(&privateKey.PublicKey, pair.Public())
+	})
+}
@@ -3,15 +3,20 @@ package key
 import (
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"errors"
+	"strings"
 )
 
 var (
-	ErrorPEMRequired                 = errors.New("Keys must be PEM-encoded")
+	ErrorKeyEncoding                 = errors.New("Keys must be PEM-encoded, DER-encoded, or base64-encoded DER")
 	ErrorUnsupportedPrivateKeyFormat = errors.New("Private keys must be in PKCS1 or PKCS8 format")
 	ErrorNotRSAPrivateKey            = errors.New("Only RSA private keys are supported")
 	ErrorNotRSAPublicKey             = errors.New("Only RSA public keys or certificates are suppored")
+
+	// ErrorPEMRequired is the former name of ErrorKeyEncoding, retained for existing clients
+	ErrorPEMRequired = ErrorKeyEncoding
 )
 
 // Parser parses a chunk of bytes into a Pair.  Parser implementations must
@@ -76,19 +81,33 @@ func (p defaultParser) parseRSAPublicKey(purpose Purpose, decoded []byte) (Pair,
 	}, nil
 }
 
+func (p defaultParser) parseDER(purpose Purpose, decoded []byte) (Pair, error) {
+	if purpose.RequiresPrivateKey() {
+		return p.parseRSAPrivateKey(purpose, decoded)
+	} else {
+		return p.parseRSAPublicKey(purpose, decoded)
+	}
+}
+
 func (p defaultParser) ParseKey(purpose Purpose, data []byte) (Pair, error) {
-	block, _ := pem.Decode(data)
-	if block == nil {
-		return nil, ErrorPEMRequired
+	if block, _ := pem.Decode(data); block != nil {
+		return p.parseDER(purpose, block.Bytes)
 	}
 
-	if purpose.RequiresPrivateKey() {
-		return p.parseRSAPrivateKey(purpose, block.Bytes)
-	} else {
-		return p.parseRSAPublicKey(purpose, block.Bytes)
+	// not PEM, so try raw DER, then base64-encoded DER as used for keys embedded in configuration
+	if pair, err := p.parseDER(purpose, data); err == nil {
+		return pair, nil
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		if pair, err := p.parseDER(purpose, decoded); err == nil {
+			return pair, nil
+		}
 	}
+
+	return nil, ErrorKeyEncoding
 }
 
-// DefaultParser is the global, singleton default parser.  All keys submitted to
-// this parser must be PEM-encoded.
+// DefaultParser is the global, singleton default parser.  Keys submitted to this parser may be
+// PEM-encoded, raw DER, or base64-encoded DER.
 var DefaultParser Parser = defaultParser(0)
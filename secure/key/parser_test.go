@@ -1,6 +1,7 @@
 package key
 
 import (
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"github.com/stretchr/testify/assert"
@@ -51,6 +52,41 @@ func TestDefaultParser(t *testing.T) {
 	}
 }
 
+func TestDefaultParserDER(t *testing.T) {
+	assert := assert.New(t)
+
+	var testData = []struct {
+		keyFilePath   string
+		purpose       Purpose
+		expectPrivate bool
+	}{
+		{publicKeyFilePath, PurposeVerify, false},
+		{privateKeyFilePath, PurposeSign, true},
+	}
+
+	for _, record := range testData {
+		t.Logf("%v", record)
+
+		data, err := ioutil.ReadFile(record.keyFilePath)
+		if !assert.Nil(err) {
+			continue
+		}
+
+		block, _ := pem.Decode(data)
+		if !assert.NotNil(block) {
+			continue
+		}
+
+		for _, encoded := range [][]byte{block.Bytes, []byte(base64.StdEncoding.EncodeToString(block.Bytes) + "\n")} {
+			pair, err := DefaultParser.ParseKey(record.purpose, encoded)
+			if assert.Nil(err) && assert.NotNil(pair) {
+				assert.NotNil(pair.Public())
+				assert.Equal(record.expectPrivate, pair.HasPrivate())
+			}
+		}
+	}
+}
+
 func TestDefaultParserString(t *testing.T) {
 	assert := assert.New(t)
 	assert.NotEmpty(fmt.Sprintf("%s", DefaultParser))
@@ -62,7 +98,11 @@ func TestDefaultParserNoPEM(t *testing.T) {
 	notPEM := []byte{9, 9, 9}
 	pair, err := DefaultParser.ParseKey(PurposeVerify, notPEM)
 	assert.Nil(pair)
-	assert.Equal(ErrorPEMRequired, err)
+	assert.Equal(ErrorKeyEncoding, err)
+
+	pair, err = DefaultParser.ParseKey(PurposeVerify, []byte(base64.StdEncoding.EncodeToString(notPEM)))
+	assert.Nil(pair)
+	assert.Equal(ErrorKeyEncoding, err)
 }
 
 func TestDefaultParserInvalidPublicKey(t *testing.T) {
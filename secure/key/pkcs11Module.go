@@ -0,0 +1,244 @@
+//go:build pkcs11
+// +build pkcs11
+
+package key
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+var (
+	// pkcs1Prefixes are the DER-encoded DigestInfo prefixes required by CKM_RSA_PKCS signatures
+	pkcs1Prefixes = map[crypto.Hash][]byte{
+		crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+		crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+		crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+		crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+	}
+
+	hmacMechanisms = map[crypto.Hash]uint{
+		crypto.SHA1:   pkcs11.CKM_SHA_1_HMAC,
+		crypto.SHA256: pkcs11.CKM_SHA256_HMAC,
+		crypto.SHA384: pkcs11.CKM_SHA384_HMAC,
+		crypto.SHA512: pkcs11.CKM_SHA512_HMAC,
+	}
+
+	errorNoToken = errors.New("No PKCS#11 token found")
+)
+
+// pkcs11Module is a Module backed by a single, logged-in session with a PKCS#11 token.  PKCS#11 sessions
+// cannot be used concurrently, so all operations are serialized.
+type pkcs11Module struct {
+	lock    sync.Mutex
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+}
+
+func openPKCS11(o *ModuleOptions) (Module, error) {
+	ctx := pkcs11.New(o.Library)
+	if ctx == nil {
+		return nil, fmt.Errorf("Unable to load PKCS#11 library %s", o.Library)
+	}
+
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, err
+	}
+
+	slot, err := findSlot(ctx, o.TokenLabel)
+	if err == nil {
+		var session pkcs11.SessionHandle
+		if session, err = ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION); err == nil {
+			if err = ctx.Login(session, pkcs11.CKU_USER, o.PIN); err == nil {
+				return &pkcs11Module{ctx: ctx, session: session}, nil
+			}
+
+			ctx.CloseSession(session)
+		}
+	}
+
+	ctx.Finalize()
+	ctx.Destroy()
+	return nil, err
+}
+
+// findSlot returns the slot holding the token with the given label, or the first token if the label is empty
+func findSlot(ctx *pkcs11.Ctx, tokenLabel string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, slot := range slots {
+		if len(tokenLabel) == 0 {
+			return slot, nil
+		}
+
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			return 0, err
+		}
+
+		if strings.TrimSpace(info.Label) == tokenLabel {
+			return slot, nil
+		}
+	}
+
+	return 0, errorNoToken
+}
+
+// findObject returns the handle of the object with the given class and label.  The lock must be held.
+func (m *pkcs11Module) findObject(class uint, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+
+	if err := m.ctx.FindObjectsInit(m.session, template); err != nil {
+		return 0, err
+	}
+
+	objects, _, err := m.ctx.FindObjects(m.session, 1)
+	m.ctx.FindObjectsFinal(m.session)
+	if err != nil {
+		return 0, err
+	} else if len(objects) == 0 {
+		return 0, fmt.Errorf("No key with label %s", label)
+	}
+
+	return objects[0], nil
+}
+
+func (m *pkcs11Module) PublicKey(label string) (crypto.PublicKey, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.publicKey(label)
+}
+
+// publicKey reads an RSA public key from the token.  The lock must be held.
+func (m *pkcs11Module) publicKey(label string) (*rsa.PublicKey, error) {
+	object, err := m.findObject(pkcs11.CKO_PUBLIC_KEY, label)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes, err := m.ctx.GetAttributeValue(m.session, object, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	public := new(rsa.PublicKey)
+	for _, attribute := range attributes {
+		switch attribute.Type {
+		case pkcs11.CKA_MODULUS:
+			public.N = new(big.Int).SetBytes(attribute.Value)
+		case pkcs11.CKA_PUBLIC_EXPONENT:
+			public.E = int(new(big.Int).SetBytes(attribute.Value).Int64())
+		}
+	}
+
+	if public.N == nil || public.E == 0 {
+		return nil, ErrorNotRSAPublicKey
+	}
+
+	return public, nil
+}
+
+func (m *pkcs11Module) Signer(label string) (crypto.Signer, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	public, err := m.publicKey(label)
+	if err != nil {
+		return nil, err
+	}
+
+	private, err := m.findObject(pkcs11.CKO_PRIVATE_KEY, label)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkcs11Signer{module: m, public: public, private: private}, nil
+}
+
+func (m *pkcs11Module) HMAC(label string, h crypto.Hash, data []byte) ([]byte, error) {
+	mechanism, ok := hmacMechanisms[h]
+	if !ok {
+		return nil, ErrorUnsupportedHash
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	secret, err := m.findObject(pkcs11.CKO_SECRET_KEY, label)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.sign(pkcs11.NewMechanism(mechanism, nil), secret, data)
+}
+
+// sign performs a single-part signing operation.  The lock must be held.
+func (m *pkcs11Module) sign(mechanism *pkcs11.Mechanism, key pkcs11.ObjectHandle, data []byte) ([]byte, error) {
+	if err := m.ctx.SignInit(m.session, []*pkcs11.Mechanism{mechanism}, key); err != nil {
+		return nil, err
+	}
+
+	return m.ctx.Sign(m.session, data)
+}
+
+func (m *pkcs11Module) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.ctx.Logout(m.session)
+	m.ctx.CloseSession(m.session)
+	err := m.ctx.Finalize()
+	m.ctx.Destroy()
+	return err
+}
+
+// pkcs11Signer is a crypto.Signer for an RSA private key held by a token.  Only PKCS#1 v1.5
+// signatures are supported.
+type pkcs11Signer struct {
+	module  *pkcs11Module
+	public  *rsa.PublicKey
+	private pkcs11.ObjectHandle
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("RSA-PSS signatures are not supported by PKCS#11 keys")
+	}
+
+	prefix, ok := pkcs1Prefixes[opts.HashFunc()]
+	if !ok {
+		return nil, ErrorUnsupportedHash
+	}
+
+	s.module.lock.Lock()
+	defer s.module.lock.Unlock()
+
+	return s.module.sign(
+		pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil),
+		s.private,
+		append(append([]byte(nil), prefix...), digest...),
+	)
+}
@@ -0,0 +1,9 @@
+//go:build !pkcs11
+// +build !pkcs11
+
+package key
+
+// openPKCS11 is the stand-in for builds without the pkcs11 tag
+func openPKCS11(*ModuleOptions) (Module, error) {
+	return nil, ErrorPKCS11NotSupported
+}
@@ -0,0 +1,17 @@
+//go:build !pkcs11
+// +build !pkcs11
+
+package key
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOpenModuleUnsupported(t *testing.T) {
+	assert := assert.New(t)
+
+	module, err := OpenModule(&ModuleOptions{Library: "/usr/lib/softhsm/libsofthsm2.so"})
+	assert.Nil(module)
+	assert.Equal(ErrorPKCS11NotSupported, err)
+}
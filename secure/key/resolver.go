@@ -1,8 +1,18 @@
 package key
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/Comcast/webpa-common/concurrent"
 	"github.com/Comcast/webpa-common/resource"
+	"time"
+)
+
+var (
+	// ErrorFetchLimit is returned when a key fetch could not start before its wait expired, because
+	// the maximum number of concurrent fetches was reached
+	ErrorFetchLimit = errors.New("Too many concurrent key fetches")
 )
 
 // Resolver loads and parses keys associated with key identifiers.
@@ -80,3 +90,30 @@ func (r *multiResolver) ResolveKey(keyId string) (Pair, error) {
 
 	return r.parseKey(data)
 }
+
+// limitedResolver is a Resolver decorator which bounds the number of concurrent key fetches
+type limitedResolver struct {
+	delegate  Resolver
+	semaphore *concurrent.Semaphore
+	wait      time.Duration
+}
+
+func (r *limitedResolver) String() string {
+	return fmt.Sprintf(
+		"limitedResolver{delegate: %s, limit: %d}",
+		r.delegate,
+		r.semaphore.Size(),
+	)
+}
+
+func (r *limitedResolver) ResolveKey(keyId string) (Pair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.wait)
+	defer cancel()
+
+	if err := r.semaphore.Acquire(ctx, 1); err != nil {
+		return nil, ErrorFetchLimit
+	}
+
+	defer r.semaphore.Release(1)
+	return r.delegate.ResolveKey(keyId)
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/Comcast/webpa-common/concurrent"
 	"github.com/Comcast/webpa-common/resource"
 	"github.com/Comcast/webpa-common/types"
+	"github.com/Comcast/webpa-common/xmetrics"
 	"time"
 )
 
@@ -13,6 +14,15 @@ const (
 	// if there are any parameters.  URI templates accepted by this package have either no parameters
 	// or exactly one (1) parameter with this name.
 	KeyIdParameterName = "keyId"
+
+	// DefaultFetchWait is the default time a key fetch waits for its turn when fetches are limited
+	DefaultFetchWait time.Duration = 5 * time.Second
+
+	// DefaultMinRefreshInterval is the default minimum age of a cached key before Refresher.RefreshKey reloads it
+	DefaultMinRefreshInterval time.Duration = 30 * time.Second
+
+	// FetchSemaphore is the concurrent.SemaphoreLabel value of the metrics for limited key fetches
+	FetchSemaphore = "key_fetch"
 )
 
 var (
@@ -41,8 +51,35 @@ type ResolverFactory struct {
 	// If negative or zero, keys are never refreshed and are cached forever.
 	UpdateInterval types.Duration `json:"updateInterval"`
 
+	// TTL specifies how long a cached key is used before it is reloaded the next time it is resolved.
+	// If the reload fails, the expired key continues to be used.  If negative or zero, keys do not expire.
+	TTL types.Duration `json:"ttl"`
+
+	// MinRefreshInterval is how old a cached key must be before an on-demand refresh, e.g. by a JWSValidator
+	// which encounters a signature that does not verify, reloads it.  If not supplied, DefaultMinRefreshInterval is used.
+	MinRefreshInterval types.Duration `json:"minRefreshInterval"`
+
+	// Listeners are notified whenever a cached key is replaced with a different key
+	Listeners []Listener `json:"-"`
+
 	// Parser is a custom key parser.  If omitted, DefaultParser is used.
 	Parser Parser `json:"-"`
+
+	// Module, if supplied, holds the keys, e.g. in a hardware security module.  Key ids are the labels of
+	// keys in the module, and the resource configuration is ignored.
+	Module Module `json:"-"`
+
+	// MaxConcurrentFetches limits the number of keys fetched at the same time, so that a burst of
+	// unknown key ids cannot overwhelm the key server.  If zero or negative, fetches are not limited.
+	MaxConcurrentFetches int `json:"maxConcurrentFetches"`
+
+	// FetchWait is how long a key fetch waits for its turn once MaxConcurrentFetches is reached, after
+	// which ErrorFetchLimit is returned.  If not supplied, DefaultFetchWait is used.
+	FetchWait types.Duration `json:"fetchWait"`
+
+	// MetricsProvider is the source of the metrics for limited fetches, which are declared by
+	// concurrent.Metrics.  If not supplied, metrics are discarded.
+	MetricsProvider xmetrics.Provider `json:"-"`
 }
 
 func (factory *ResolverFactory) parser() Parser {
@@ -53,9 +90,55 @@ func (factory *ResolverFactory) parser() Parser {
 	return DefaultParser
 }
 
-// NewResolver() creates a Resolver using this factory's configuration.  The
-// returned Resolver always caches keys forever once they have been loaded.
+func (factory *ResolverFactory) fetchWait() time.Duration {
+	if factory.FetchWait > 0 {
+		return time.Duration(factory.FetchWait)
+	}
+
+	return DefaultFetchWait
+}
+
+func (factory *ResolverFactory) minRefreshInterval() time.Duration {
+	if factory.MinRefreshInterval > 0 {
+		return time.Duration(factory.MinRefreshInterval)
+	}
+
+	return DefaultMinRefreshInterval
+}
+
+// initialize sets up the cache state common to all resolvers created by this factory
+func (factory *ResolverFactory) initialize(cache *basicCache, delegate Resolver) {
+	cache.delegate = factory.limit(delegate)
+	cache.ttl = time.Duration(factory.TTL)
+	cache.minRefresh = factory.minRefreshInterval()
+	cache.listeners = factory.Listeners
+}
+
+// limit decorates a resolver to bound its concurrent fetches, if so configured
+func (factory *ResolverFactory) limit(resolver Resolver) Resolver {
+	if factory.MaxConcurrentFetches <= 0 {
+		return resolver
+	}
+
+	return &limitedResolver{
+		delegate:  resolver,
+		semaphore: concurrent.NewSemaphore(FetchSemaphore, int64(factory.MaxConcurrentFetches), factory.MetricsProvider),
+		wait:      factory.fetchWait(),
+	}
+}
+
+// NewResolver() creates a Resolver using this factory's configuration.  The returned
+// Resolver is a Cache, which keeps keys until they expire or are updated, and a Refresher.
+//
+// If this factory has embedded Data, the same key is used for all key ids.  If this factory has a Module,
+// the returned Resolver is a ModuleResolver, which does no caching of its own.
 func (factory *ResolverFactory) NewResolver() (Resolver, error) {
+	if factory.Module != nil {
+		return &ModuleResolver{Module: factory.Module, Purpose: factory.Purpose}, nil
+	} else if len(factory.Data) > 0 {
+		return factory.newSingleCache()
+	}
+
 	expander, err := factory.NewExpander()
 	if err != nil {
 		return nil, err
@@ -65,39 +148,42 @@ func (factory *ResolverFactory) NewResolver() (Resolver, error) {
 	nameCount := len(names)
 	if nameCount == 0 {
 		// the template had no parameters, so we can create a simpler object
-		loader, err := factory.NewLoader()
-		if err != nil {
-			return nil, err
-		}
-
-		return &singleCache{
-			basicCache{
-				delegate: &singleResolver{
-					basicResolver: basicResolver{
-						parser:  factory.parser(),
-						purpose: factory.Purpose,
-					},
-					loader: loader,
-				},
-			},
-		}, nil
+		return factory.newSingleCache()
 	} else if nameCount == 1 && names[0] == KeyIdParameterName {
-		return &multiCache{
-			basicCache{
-				delegate: &multiResolver{
-					basicResolver: basicResolver{
-						parser:  factory.parser(),
-						purpose: factory.Purpose,
-					},
-					expander: expander,
-				},
+		cache := new(multiCache)
+		factory.initialize(&cache.basicCache, &multiResolver{
+			basicResolver: basicResolver{
+				parser:  factory.parser(),
+				purpose: factory.Purpose,
 			},
-		}, nil
+			expander: expander,
+		})
+
+		return cache, nil
 	}
 
 	return nil, ErrorInvalidTemplate
 }
 
+// newSingleCache creates a cache for a resource which holds the only key
+func (factory *ResolverFactory) newSingleCache() (Resolver, error) {
+	loader, err := factory.NewLoader()
+	if err != nil {
+		return nil, err
+	}
+
+	cache := new(singleCache)
+	factory.initialize(&cache.basicCache, &singleResolver{
+		basicResolver: basicResolver{
+			parser:  factory.parser(),
+			purpose: factory.Purpose,
+		},
+		loader: loader,
+	})
+
+	return cache, nil
+}
+
 // NewUpdater uses this factory's configuration to conditionally create a Runnable updater
 // for the given resolver.  This method delegates to the NewUpdater function, and may
 // return a nil Runnable if no updates are necessary.
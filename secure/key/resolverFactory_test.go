@@ -2,12 +2,15 @@ package key
 
 import (
 	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"github.com/Comcast/webpa-common/resource"
 	"github.com/Comcast/webpa-common/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"io/ioutil"
 	"sync"
 	"testing"
 	"time"
@@ -177,3 +180,85 @@ func TestResolverFactoryCustomParser(t *testing.T) {
 	assert.Equal(parser, resolverFactory.parser())
 	mock.AssertExpectationsForObjects(t, parser.Mock)
 }
+
+func TestResolverFactoryLimit(t *testing.T) {
+	assert := assert.New(t)
+	delegate := &MockResolver{}
+
+	factory := ResolverFactory{}
+	assert.Equal(DefaultFetchWait, factory.fetchWait())
+	assert.Equal(delegate, factory.limit(delegate))
+
+	factory.MaxConcurrentFetches = 5
+	factory.FetchWait = types.Duration(time.Second)
+	if limited, ok := factory.limit(delegate).(*limitedResolver); assert.True(ok) {
+		assert.Equal(delegate, limited.delegate)
+		assert.Equal(int64(5), limited.semaphore.Size())
+		assert.Equal(time.Second, limited.wait)
+	}
+
+	factory.URI = publicKeyFilePath
+	resolver, err := factory.NewResolver()
+	assert.NoError(err)
+	if cache, ok := resolver.(*singleCache); assert.True(ok) {
+		assert.IsType(&limitedResolver{}, cache.delegate)
+	}
+}
+
+func TestResolverFactoryCacheOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	factory := ResolverFactory{
+		Factory: resource.Factory{
+			URI: publicKeyFilePathTemplate,
+		},
+		Purpose: PurposeVerify,
+	}
+
+	assert.Equal(DefaultMinRefreshInterval, factory.minRefreshInterval())
+
+	factory.TTL = types.Duration(time.Hour)
+	factory.MinRefreshInterval = types.Duration(time.Minute)
+	factory.Listeners = []Listener{func(string, Pair, Pair) {}}
+
+	resolver, err := factory.NewResolver()
+	assert.NoError(err)
+	if cache, ok := resolver.(*multiCache); assert.True(ok) {
+		assert.Equal(time.Hour, cache.ttl)
+		assert.Equal(time.Minute, cache.minRefresh)
+		assert.Len(cache.listeners, 1)
+		assert.Implements((*Refresher)(nil), resolver)
+	}
+}
+
+func TestResolverFactoryEmbeddedDER(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := ioutil.ReadFile(publicKeyFilePath)
+	if !assert.NoError(err) {
+		return
+	}
+
+	block, _ := pem.Decode(data)
+	if !assert.NotNil(block) {
+		return
+	}
+
+	factory := ResolverFactory{
+		Factory: resource.Factory{
+			Data: base64.StdEncoding.EncodeToString(block.Bytes),
+		},
+		Purpose: PurposeVerify,
+	}
+
+	resolver, err := factory.NewResolver()
+	if !assert.NoError(err) {
+		return
+	}
+
+	pair, err := resolver.ResolveKey(keyId)
+	assert.NoError(err)
+	if assert.NotNil(pair) {
+		assert.IsType(&rsa.PublicKey{}, pair.Public())
+	}
+}
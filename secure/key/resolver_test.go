@@ -3,10 +3,12 @@ package key
 import (
 	"errors"
 	"fmt"
+	"github.com/Comcast/webpa-common/concurrent"
 	"github.com/Comcast/webpa-common/resource"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"testing"
+	"time"
 )
 
 func TestSingleResolver(t *testing.T) {
@@ -150,3 +152,48 @@ func TestMultiResolverBadExpander(t *testing.T) {
 	assert.Nil(key)
 	assert.Equal(expectedError, err)
 }
+
+func TestLimitedResolver(t *testing.T) {
+	var (
+		assert       = assert.New(t)
+		expectedPair = &MockPair{}
+		delegate     = &MockResolver{}
+		entered      = make(chan struct{})
+		release      = make(chan struct{})
+
+		resolver = &limitedResolver{
+			delegate:  delegate,
+			semaphore: concurrent.NewSemaphore(FetchSemaphore, 1, nil),
+			wait:      10 * time.Millisecond,
+		}
+	)
+
+	delegate.On("ResolveKey", "slow").Return(expectedPair, nil).Run(func(mock.Arguments) {
+		close(entered)
+		<-release
+	}).Once()
+
+	delegate.On("ResolveKey", "fast").Return(expectedPair, nil).Once()
+	assert.Contains(fmt.Sprintf("%s", resolver), "limit: 1")
+
+	result := make(chan Pair, 1)
+	go func() {
+		pair, err := resolver.ResolveKey("slow")
+		assert.NoError(err)
+		result <- pair
+	}()
+
+	<-entered
+	pair, err := resolver.ResolveKey("fast")
+	assert.Nil(pair)
+	assert.Equal(ErrorFetchLimit, err)
+
+	close(release)
+	assert.Equal(expectedPair, <-result)
+
+	pair, err = resolver.ResolveKey("fast")
+	assert.Equal(expectedPair, pair)
+	assert.NoError(err)
+
+	delegate.AssertExpectations(t)
+}
@@ -0,0 +1,115 @@
+package key
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"fmt"
+	"sync"
+)
+
+// SoftwareModule is a pure-Go Module which holds its keys in memory.  It is the fallback for builds
+// without PKCS#11 support, and is useful for development and testing against the Module interface.
+//
+// The zero value is an empty module, ready to use.
+type SoftwareModule struct {
+	lock       sync.RWMutex
+	publicKeys map[string]crypto.PublicKey
+	signers    map[string]crypto.Signer
+	secrets    map[string][]byte
+}
+
+// AddPublicKey stores a public key under the given label
+func (m *SoftwareModule) AddPublicKey(label string, public crypto.PublicKey) {
+	m.lock.Lock()
+	if m.publicKeys == nil {
+		m.publicKeys = make(map[string]crypto.PublicKey)
+	}
+
+	m.publicKeys[label] = public
+	m.lock.Unlock()
+}
+
+// AddSigner stores a private key under the given label.  The signer's public key is available under the same label.
+func (m *SoftwareModule) AddSigner(label string, signer crypto.Signer) {
+	m.lock.Lock()
+	if m.signers == nil {
+		m.signers = make(map[string]crypto.Signer)
+	}
+
+	m.signers[label] = signer
+	m.lock.Unlock()
+}
+
+// AddPair stores the keys of a Pair, such as one produced by a Parser, under the given label
+func (m *SoftwareModule) AddPair(label string, pair Pair) error {
+	if pair.HasPrivate() {
+		signer, ok := pair.Private().(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("The private key for %s cannot sign", label)
+		}
+
+		m.AddSigner(label, signer)
+		return nil
+	}
+
+	m.AddPublicKey(label, pair.Public())
+	return nil
+}
+
+// AddSecret stores an HMAC secret under the given label
+func (m *SoftwareModule) AddSecret(label string, secret []byte) {
+	m.lock.Lock()
+	if m.secrets == nil {
+		m.secrets = make(map[string][]byte)
+	}
+
+	m.secrets[label] = append([]byte(nil), secret...)
+	m.lock.Unlock()
+}
+
+func (m *SoftwareModule) PublicKey(label string) (crypto.PublicKey, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if public, ok := m.publicKeys[label]; ok {
+		return public, nil
+	} else if signer, ok := m.signers[label]; ok {
+		return signer.Public(), nil
+	}
+
+	return nil, fmt.Errorf("No public key with label %s", label)
+}
+
+func (m *SoftwareModule) Signer(label string) (crypto.Signer, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if signer, ok := m.signers[label]; ok {
+		return signer, nil
+	}
+
+	return nil, fmt.Errorf("No private key with label %s", label)
+}
+
+func (m *SoftwareModule) HMAC(label string, h crypto.Hash, data []byte) ([]byte, error) {
+	if !h.Available() {
+		return nil, ErrorUnsupportedHash
+	}
+
+	m.lock.RLock()
+	secret, ok := m.secrets[label]
+	m.lock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("No secret key with label %s", label)
+	}
+
+	mac := hmac.New(h.New, secret)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// Close does nothing, as a SoftwareModule holds no external resources
+func (m *SoftwareModule) Close() error {
+	return nil
+}
@@ -0,0 +1,118 @@
+package key
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSoftwareModuleEmpty(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		module = new(SoftwareModule)
+	)
+
+	public, err := module.PublicKey("nosuch")
+	assert.Nil(public)
+	assert.Error(err)
+
+	signer, err := module.Signer("nosuch")
+	assert.Nil(signer)
+	assert.Error(err)
+
+	mac, err := module.HMAC("nosuch", crypto.SHA256, []byte("data"))
+	assert.Nil(mac)
+	assert.Error(err)
+
+	assert.NoError(module.Close())
+}
+
+func TestSoftwareModuleKeys(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		module  = new(SoftwareModule)
+	)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(err)
+
+	module.AddSigner("signer", privateKey)
+	module.AddPublicKey("verifier", &privateKey.PublicKey)
+
+	signer, err := module.Signer("signer")
+	require.NoError(err)
+	assert.Equal(privateKey, signer)
+
+	for _, label := range []string{"signer", "verifier"} {
+		public, err := module.PublicKey(label)
+		assert.NoError(err)
+		assert.Equal(&privateKey.PublicKey, public)
+	}
+
+	signer, err = module.Signer("verifier")
+	assert.Nil(signer)
+	assert.Error(err)
+}
+
+func TestSoftwareModuleAddPair(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		module  = new(SoftwareModule)
+	)
+
+	data, err := ioutil.ReadFile(privateKeyFilePath)
+	require.NoError(err)
+	privatePair, err := DefaultParser.ParseKey(PurposeSign, data)
+	require.NoError(err)
+
+	data, err = ioutil.ReadFile(publicKeyFilePath)
+	require.NoError(err)
+	publicPair, err := DefaultParser.ParseKey(PurposeVerify, data)
+	require.NoError(err)
+
+	assert.NoError(module.AddPair("private", privatePair))
+	assert.NoError(module.AddPair("public", publicPair))
+
+	signer, err := module.Signer("private")
+	assert.NoError(err)
+	assert.Equal(privatePair.Private(), signer)
+
+	public, err := module.PublicKey("public")
+	assert.NoError(err)
+	assert.Equal(publicPair.Public(), public)
+
+	_, err = module.Signer("public")
+	assert.Error(err)
+}
+
+func TestSoftwareModuleHMAC(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		module = new(SoftwareModule)
+		secret = []byte("secret")
+	)
+
+	module.AddSecret("secret", secret)
+
+	// the module keeps its own copy of the secret
+	secret[0] = 'X'
+
+	expected := hmac.New(sha256.New, []byte("secret"))
+	expected.Write([]byte("data"))
+
+	mac, err := module.HMAC("secret", crypto.SHA256, []byte("data"))
+	assert.NoError(err)
+	assert.Equal(expected.Sum(nil), mac)
+
+	mac, err = module.HMAC("secret", crypto.Hash(0), []byte("data"))
+	assert.Nil(mac)
+	assert.Equal(ErrorUnsupportedHash, err)
+}
@@ -0,0 +1,73 @@
+package secure
+
+import (
+	"github.com/Comcast/webpa-common/xmetrics"
+)
+
+const (
+	// TokenCacheHitCounter is the total number of tokens approved from a CachingValidator's cache
+	TokenCacheHitCounter = "token_cache_hit_count"
+
+	// TokenCacheMissCounter is the total number of tokens which a CachingValidator passed to its delegate
+	TokenCacheMissCounter = "token_cache_miss_count"
+
+	// TokenCacheSizeGauge is the number of verified tokens held in a CachingValidator's cache
+	TokenCacheSizeGauge = "token_cache_size"
+
+	// RemoteValidatorTimeoutCounter is the total number of tokens whose RemoteValidator delegate did not respond in time
+	RemoteValidatorTimeoutCounter = "remote_validator_timeout_count"
+
+	// RemoteValidatorBreakerTripCounter is the total number of times a RemoteValidator's breaker has tripped
+	RemoteValidatorBreakerTripCounter = "remote_validator_breaker_trip_count"
+
+	// RemoteValidatorOpenBreakerGauge is the number of RemoteValidators whose breakers are currently open
+	RemoteValidatorOpenBreakerGauge = "remote_validator_open_breakers"
+
+	// RemoteValidatorUnavailableCounter is the total number of tokens decided by the failure policy, by policy
+	RemoteValidatorUnavailableCounter = "remote_validator_unavailable_count"
+
+	// PolicyLabel is the label identifying the failure policy applied to a token, e.g. FailClosedPolicy
+	PolicyLabel = "policy"
+)
+
+// Metrics is the xmetrics.Module for this package
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name: TokenCacheHitCounter,
+			Type: xmetrics.CounterType,
+			Help: "The total number of tokens approved from the token cache",
+		},
+		{
+			Name: TokenCacheMissCounter,
+			Type: xmetrics.CounterType,
+			Help: "The total number of tokens which were not found in the token cache",
+		},
+		{
+			Name: TokenCacheSizeGauge,
+			Type: xmetrics.GaugeType,
+			Help: "The number of verified tokens held in the token cache",
+		},
+		{
+			Name: RemoteValidatorTimeoutCounter,
+			Type: xmetrics.CounterType,
+			Help: "The total number of tokens whose remote validator did not respond in time",
+		},
+		{
+			Name: RemoteValidatorBreakerTripCounter,
+			Type: xmetrics.CounterType,
+			Help: "The total number of times a remote validator's circuit breaker has tripped",
+		},
+		{
+			Name: RemoteValidatorOpenBreakerGauge,
+			Type: xmetrics.GaugeType,
+			Help: "The number of remote validators whose circuit breakers are currently open",
+		},
+		{
+			Name:       RemoteValidatorUnavailableCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of tokens decided by the failure policy because a remote validator was unavailable",
+			LabelNames: []string{PolicyLabel},
+		},
+	}
+}
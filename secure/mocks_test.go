@@ -1,11 +1,13 @@
 package secure
 
 import (
+	"github.com/Comcast/webpa-common/health"
 	"github.com/SermoDigital/jose"
 	"github.com/SermoDigital/jose/crypto"
 	"github.com/SermoDigital/jose/jws"
 	"github.com/SermoDigital/jose/jwt"
 	"github.com/stretchr/testify/mock"
+	"net/http"
 )
 
 type mockJWSParser struct {
@@ -104,3 +106,15 @@ func (j *mockJWS) IsJWT() bool {
 	arguments := j.Called()
 	return arguments.Bool(0)
 }
+
+type mockMonitor struct {
+	mock.Mock
+}
+
+func (monitor *mockMonitor) SendEvent(healthFunc health.HealthFunc) {
+	monitor.Called(healthFunc)
+}
+
+func (monitor *mockMonitor) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	monitor.Called(response, request)
+}
@@ -0,0 +1,313 @@
+package secure
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// DefaultRemoteValidatorTimeout is the default longest time a RemoteValidator waits on its delegate
+	DefaultRemoteValidatorTimeout time.Duration = 5 * time.Second
+
+	// DefaultRemoteValidatorThreshold is the default number of consecutive failures which trips a RemoteValidator's breaker
+	DefaultRemoteValidatorThreshold = 5
+
+	// DefaultRemoteValidatorCooldown is the default length of time a tripped RemoteValidator skips its delegate
+	DefaultRemoteValidatorCooldown time.Duration = 30 * time.Second
+
+	// FailOpenPolicy is the PolicyLabel value of tokens approved because the delegate was unavailable
+	FailOpenPolicy = "fail_open"
+
+	// FailClosedPolicy is the PolicyLabel value of tokens rejected because the delegate was unavailable
+	FailClosedPolicy = "fail_closed"
+)
+
+var (
+	ErrorValidatorTimeout     = errors.New("The validator did not respond in time")
+	ErrorValidatorUnavailable = errors.New("The validator is unavailable")
+)
+
+// RemoteValidatorOptions configures a RemoteValidator
+type RemoteValidatorOptions struct {
+	// Timeout is the longest time to wait on the delegate for each token.  If not supplied,
+	// DefaultRemoteValidatorTimeout is used.
+	Timeout time.Duration `json:"timeout"`
+
+	// Threshold is the number of consecutive failures which trips the breaker.  If not supplied,
+	// DefaultRemoteValidatorThreshold is used.
+	Threshold int `json:"threshold"`
+
+	// Cooldown is the length of time a tripped breaker skips the delegate before allowing a trial.
+	// If not supplied, DefaultRemoteValidatorCooldown is used.
+	Cooldown time.Duration `json:"cooldown"`
+
+	// FailOpen approves tokens while the delegate is unavailable.  By default, such tokens are rejected.
+	// Failing open trades security for availability, and should only be used when the delegate is one of
+	// several safeguards.
+	FailOpen bool `json:"failOpen"`
+
+	// IsFailure classifies the errors returned by the delegate.  Failures count toward the breaker and are subject
+	// to the failure policy, while other errors, e.g. a malformed token, are returned as is.  If not supplied,
+	// timeouts and network errors are failures.
+	IsFailure func(error) bool `json:"-"`
+
+	// Clock is the source of time for timeouts and the breaker.  If not supplied, clock.System() is used.
+	Clock clock.Interface `json:"-"`
+
+	// MetricsProvider is the source of the metrics declared by Metrics.  If not supplied, metrics are discarded.
+	MetricsProvider xmetrics.Provider `json:"-"`
+}
+
+func (o *RemoteValidatorOptions) timeout() time.Duration {
+	if o != nil && o.Timeout > 0 {
+		return o.Timeout
+	}
+
+	return DefaultRemoteValidatorTimeout
+}
+
+func (o *RemoteValidatorOptions) threshold() int {
+	if o != nil && o.Threshold > 0 {
+		return o.Threshold
+	}
+
+	return DefaultRemoteValidatorThreshold
+}
+
+func (o *RemoteValidatorOptions) cooldown() time.Duration {
+	if o != nil && o.Cooldown > 0 {
+		return o.Cooldown
+	}
+
+	return DefaultRemoteValidatorCooldown
+}
+
+func (o *RemoteValidatorOptions) failOpen() bool {
+	return o != nil && o.FailOpen
+}
+
+func (o *RemoteValidatorOptions) isFailure() func(error) bool {
+	if o != nil && o.IsFailure != nil {
+		return o.IsFailure
+	}
+
+	return IsRemoteFailure
+}
+
+func (o *RemoteValidatorOptions) clock() clock.Interface {
+	if o != nil && o.Clock != nil {
+		return o.Clock
+	}
+
+	return clock.System()
+}
+
+func (o *RemoteValidatorOptions) metricsProvider() xmetrics.Provider {
+	if o != nil && o.MetricsProvider != nil {
+		return o.MetricsProvider
+	}
+
+	return xmetrics.NewDiscardProvider()
+}
+
+// IsRemoteFailure is the default RemoteValidatorOptions.IsFailure.  Timeouts, including context deadlines,
+// and network errors indicate that a remote service is unavailable.
+func IsRemoteFailure(err error) bool {
+	if err == ErrorValidatorTimeout || err == context.DeadlineExceeded {
+		return true
+	}
+
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// validationResult is the outcome of a single call to a delegate Validator
+type validationResult struct {
+	valid bool
+	err   error
+}
+
+// RemoteValidator protects requests from a delegate Validator which makes remote calls, such as
+// fetching keys or introspecting tokens.  Each token is given to the delegate with a timeout.  After
+// a number of consecutive failures, i.e. timeouts or network errors, a circuit breaker trips and the
+// delegate is skipped until a cooldown has elapsed.  Then, a single trial token is given to the delegate:
+// if it succeeds the breaker resets, otherwise another cooldown begins.
+//
+// While the delegate is unavailable, tokens are rejected with ErrorValidatorUnavailable or the delegate's
+// error.  If FailOpen is set, such tokens are approved instead.  Either way, a slow identity provider
+// cannot stall every request behind an AuthorizationHandler.
+//
+// The delegate receives a Context which is cancelled on timeout.  A delegate which ignores its Context keeps
+// running in the background, but its result is discarded.  The delegate is given its own copy of the token,
+// and the claims it records are copied back only when it answers in time, so that a late delegate never
+// races with the code which consumes the token.
+type RemoteValidator struct {
+	delegate  Validator
+	timeout   time.Duration
+	threshold int
+	cooldown  time.Duration
+	failOpen  bool
+	isFailure func(error) bool
+	clock     clock.Interface
+
+	timeouts    metrics.Counter
+	trips       metrics.Counter
+	openBreaker metrics.Gauge
+	unavailable metrics.Counter
+
+	lock     sync.Mutex
+	failures int
+	open     bool
+	openedAt time.Time
+	trial    bool
+}
+
+// NewRemoteValidator creates a RemoteValidator around the given delegate
+func NewRemoteValidator(delegate Validator, o *RemoteValidatorOptions) *RemoteValidator {
+	provider := o.metricsProvider()
+	return &RemoteValidator{
+		delegate:    delegate,
+		timeout:     o.timeout(),
+		threshold:   o.threshold(),
+		cooldown:    o.cooldown(),
+		failOpen:    o.failOpen(),
+		isFailure:   o.isFailure(),
+		clock:       o.clock(),
+		timeouts:    provider.NewCounter(RemoteValidatorTimeoutCounter),
+		trips:       provider.NewCounter(RemoteValidatorBreakerTripCounter),
+		openBreaker: provider.NewGauge(RemoteValidatorOpenBreakerGauge),
+		unavailable: provider.NewCounter(RemoteValidatorUnavailableCounter),
+	}
+}
+
+// IsOpen tests whether the breaker is currently open, i.e. whether the delegate is being skipped
+func (v *RemoteValidator) IsOpen() bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.open
+}
+
+func (v *RemoteValidator) Validate(ctx context.Context, token *Token) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if !v.allow() {
+		return v.fail(ErrorValidatorUnavailable)
+	}
+
+	valid, err := v.call(ctx, token)
+	if ctx.Err() != nil {
+		// the caller gave up, which says nothing about the delegate
+		v.abandon()
+		return valid, err
+	}
+
+	if err != nil && v.isFailure(err) {
+		v.record(true)
+		return v.fail(err)
+	}
+
+	v.record(false)
+	return valid, err
+}
+
+// call gives a token to the delegate, waiting no longer than the timeout or the caller's Context
+func (v *RemoteValidator) call(ctx context.Context, token *Token) (bool, error) {
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// buffered, so that a delegate which finishes after a timeout does not block forever
+	results := make(chan validationResult, 1)
+	delegateToken := *token
+	go func() {
+		valid, err := v.delegate.Validate(callCtx, &delegateToken)
+		results <- validationResult{valid, err}
+	}()
+
+	timer := v.clock.NewTimer(v.timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-results:
+		token.claims = delegateToken.claims
+		return r.valid, r.err
+	case <-timer.C():
+		v.timeouts.Add(1)
+		return false, ErrorValidatorTimeout
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// fail applies the failure policy to a token which the delegate could not validate
+func (v *RemoteValidator) fail(cause error) (bool, error) {
+	if v.failOpen {
+		v.unavailable.With(PolicyLabel, FailOpenPolicy).Add(1)
+		return true, nil
+	}
+
+	v.unavailable.With(PolicyLabel, FailClosedPolicy).Add(1)
+	return false, cause
+}
+
+// allow determines if a token may be given to the delegate.  While the breaker is open, this method
+// returns false except for the single trial after the cooldown.
+func (v *RemoteValidator) allow() bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if !v.open {
+		return true
+	}
+
+	if v.trial || v.clock.Now().Sub(v.openedAt) < v.cooldown {
+		return false
+	}
+
+	v.trial = true
+	return true
+}
+
+// abandon releases any trial whose outcome is unknown, so that another trial can take its place
+func (v *RemoteValidator) abandon() {
+	v.lock.Lock()
+	v.trial = false
+	v.lock.Unlock()
+}
+
+// record updates the breaker with the outcome of a call to the delegate
+func (v *RemoteValidator) record(failed bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if !failed {
+		if v.open {
+			v.openBreaker.Add(-1)
+		}
+
+		v.failures = 0
+		v.open = false
+		v.trial = false
+		return
+	}
+
+	v.failures++
+	if v.open {
+		// a failed trial starts another cooldown
+		v.trial = false
+		v.openedAt = v.clock.Now()
+	} else if v.failures >= v.threshold {
+		v.open = true
+		v.openedAt = v.clock.Now()
+		v.trips.Add(1)
+		v.openBreaker.Add(1)
+	}
+}
@@ -0,0 +1,395 @@
+package secure
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock/clocktest"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/SermoDigital/jose/jws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outcomeValidator returns a configurable outcome and counts its calls.  It is safe for concurrent use.
+type outcomeValidator struct {
+	calls int32
+	valid atomic.Value
+	err   atomic.Value
+}
+
+func newOutcomeValidator(valid bool, err error) *outcomeValidator {
+	v := new(outcomeValidator)
+	v.set(valid, err)
+	return v
+}
+
+func (v *outcomeValidator) set(valid bool, err error) {
+	v.valid.Store(valid)
+	v.err.Store(&err)
+}
+
+func (v *outcomeValidator) Validate(context.Context, *Token) (bool, error) {
+	atomic.AddInt32(&v.calls, 1)
+	return v.valid.Load().(bool), *v.err.Load().(*error)
+}
+
+func (v *outcomeValidator) callCount() int {
+	return int(atomic.LoadInt32(&v.calls))
+}
+
+func TestRemoteValidatorOptionsDefaults(t *testing.T) {
+	assert := assert.New(t)
+	for _, o := range []*RemoteValidatorOptions{nil, new(RemoteValidatorOptions)} {
+		assert.Equal(DefaultRemoteValidatorTimeout, o.timeout())
+		assert.Equal(DefaultRemoteValidatorThreshold, o.threshold())
+		assert.Equal(DefaultRemoteValidatorCooldown, o.cooldown())
+		assert.False(o.failOpen())
+		assert.NotNil(o.isFailure())
+		assert.NotNil(o.clock())
+		assert.NotNil(o.metricsProvider())
+	}
+}
+
+func TestRemoteValidatorOptions(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		clock  = clocktest.NewClock(time.Now())
+		o      = RemoteValidatorOptions{
+			Timeout:         time.Second,
+			Threshold:       2,
+			Cooldown:        time.Minute,
+			FailOpen:        true,
+			IsFailure:       func(error) bool { return true },
+			Clock:           clock,
+			MetricsProvider: xmetrics.NewDiscardProvider(),
+		}
+	)
+
+	assert.Equal(o.Timeout, o.timeout())
+	assert.Equal(o.Threshold, o.threshold())
+	assert.Equal(o.Cooldown, o.cooldown())
+	assert.True(o.failOpen())
+	assert.True(o.isFailure()(errors.New("expected")))
+	assert.Equal(clock, o.clock())
+	assert.Equal(o.MetricsProvider, o.metricsProvider())
+}
+
+func TestIsRemoteFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(IsRemoteFailure(ErrorValidatorTimeout))
+	assert.True(IsRemoteFailure(context.DeadlineExceeded))
+	assert.True(IsRemoteFailure(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.True(IsRemoteFailure(&url.Error{Op: "Get", URL: "https://idp.example.com/keys", Err: errors.New("expected")}))
+
+	assert.False(IsRemoteFailure(context.Canceled))
+	assert.False(IsRemoteFailure(ErrorNoSigningMethod))
+	assert.False(IsRemoteFailure(errors.New("expected")))
+}
+
+func TestRemoteValidatorPassThrough(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		token    = &Token{tokenType: Bearer, value: "token"}
+		tokenErr = errors.New("malformed token")
+
+		delegate  = newOutcomeValidator(true, nil)
+		validator = NewRemoteValidator(delegate, &RemoteValidatorOptions{Threshold: 1})
+	)
+
+	valid, err := validator.Validate(context.Background(), token)
+	assert.True(valid)
+	assert.NoError(err)
+
+	delegate.set(false, nil)
+	valid, err = validator.Validate(nil, token)
+	assert.False(valid)
+	assert.NoError(err)
+
+	// errors which are not failures are returned as is, and never trip the breaker
+	delegate.set(false, tokenErr)
+	for repeat := 0; repeat < 3; repeat++ {
+		valid, err = validator.Validate(context.Background(), token)
+		assert.False(valid)
+		assert.Equal(tokenErr, err)
+	}
+
+	assert.False(validator.IsOpen())
+	assert.Equal(5, delegate.callCount())
+}
+
+func TestRemoteValidatorTimeout(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		clock   = clocktest.NewClock(time.Now())
+
+		cancelled = make(chan struct{})
+		delegate  = ValidatorFunc(func(ctx context.Context, token *Token) (bool, error) {
+			<-ctx.Done()
+			close(cancelled)
+			return true, nil
+		})
+
+		validator = NewRemoteValidator(delegate, &RemoteValidatorOptions{Timeout: time.Second, Clock: clock})
+		result    = make(chan validationResult, 1)
+	)
+
+	go func() {
+		valid, err := validator.Validate(context.Background(), &Token{tokenType: Bearer, value: "token"})
+		result <- validationResult{valid, err}
+	}()
+
+	clock.BlockUntil(1)
+	clock.Add(time.Second)
+
+	select {
+	case r := <-result:
+		assert.False(r.valid)
+		assert.Equal(ErrorValidatorTimeout, r.err)
+	case <-time.After(5 * time.Second):
+		require.Fail("Validate did not time out")
+	}
+
+	// the delegate's context is cancelled, so that it stops working on the token
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		assert.Fail("The delegate's context was not cancelled")
+	}
+}
+
+func TestRemoteValidatorCallerCancelled(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		delegate    = ValidatorFunc(func(ctx context.Context, token *Token) (bool, error) {
+			cancel()
+			<-ctx.Done()
+			return false, ctx.Err()
+		})
+
+		validator = NewRemoteValidator(delegate, &RemoteValidatorOptions{
+			Threshold: 1,
+			IsFailure: func(error) bool { return true },
+		})
+	)
+
+	// a caller which gives up says nothing about the delegate, so the breaker is unaffected
+	valid, err := validator.Validate(ctx, &Token{tokenType: Bearer, value: "token"})
+	assert.False(valid)
+	assert.Equal(context.Canceled, err)
+	assert.False(validator.IsOpen())
+}
+
+func TestRemoteValidatorClaims(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		clock   = clocktest.NewClock(time.Now())
+
+		release  = make(chan struct{})
+		finished = make(chan struct{})
+		slow     = ValidatorFunc(func(ctx context.Context, token *Token) (bool, error) {
+			// ignore the context, as a misbehaving delegate would, and record claims after the timeout
+			defer close(finished)
+			<-release
+			token.claims = jws.Claims{"sub": "late"}
+			return true, nil
+		})
+
+		validator = NewRemoteValidator(slow, &RemoteValidatorOptions{Timeout: time.Second, FailOpen: true, Clock: clock})
+		token     = &Token{tokenType: Bearer, value: "token"}
+		result    = make(chan validationResult, 1)
+	)
+
+	go func() {
+		valid, err := validator.Validate(context.Background(), token)
+		result <- validationResult{valid, err}
+	}()
+
+	clock.BlockUntil(1)
+	clock.Add(time.Second)
+
+	select {
+	case r := <-result:
+		assert.True(r.valid)
+		assert.NoError(r.err)
+	case <-time.After(5 * time.Second):
+		require.Fail("Validate did not time out")
+	}
+
+	// the approved token is consumed while the late delegate records its claims
+	close(release)
+	assert.Nil(token.Claims())
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		require.Fail("The delegate did not finish")
+	}
+
+	assert.Nil(token.Claims())
+
+	// claims recorded by a delegate which answers in time are kept
+	fast := NewRemoteValidator(
+		ValidatorFunc(func(ctx context.Context, token *Token) (bool, error) {
+			token.claims = jws.Claims{"sub": "fast"}
+			return true, nil
+		}),
+		nil,
+	)
+
+	valid, err := fast.Validate(context.Background(), token)
+	assert.True(valid)
+	assert.NoError(err)
+	assert.Equal(jws.Claims{"sub": "fast"}, token.Claims())
+}
+
+func TestRemoteValidatorBreaker(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+		clock         = clocktest.NewClock(time.Now())
+		token         = &Token{tokenType: Bearer, value: "token"}
+		unavailable   = &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+
+		delegate = newOutcomeValidator(false, unavailable)
+	)
+
+	require.NoError(err)
+	validator := NewRemoteValidator(delegate, &RemoteValidatorOptions{
+		Threshold:       2,
+		Cooldown:        time.Minute,
+		Clock:           clock,
+		MetricsProvider: registry,
+	})
+
+	// failures reach the caller until the breaker trips
+	for repeat := 0; repeat < 2; repeat++ {
+		valid, err := validator.Validate(context.Background(), token)
+		assert.False(valid)
+		assert.Equal(unavailable, err)
+	}
+
+	assert.True(validator.IsOpen())
+	assert.Equal(2, delegate.callCount())
+
+	// while open, the delegate is skipped
+	valid, err := validator.Validate(context.Background(), token)
+	assert.False(valid)
+	assert.Equal(ErrorValidatorUnavailable, err)
+	assert.Equal(2, delegate.callCount())
+
+	// after the cooldown, a failed trial starts another cooldown
+	clock.Add(time.Minute)
+	valid, err = validator.Validate(context.Background(), token)
+	assert.False(valid)
+	assert.Equal(unavailable, err)
+	assert.Equal(3, delegate.callCount())
+	assert.True(validator.IsOpen())
+
+	valid, err = validator.Validate(context.Background(), token)
+	assert.Equal(ErrorValidatorUnavailable, err)
+	assert.Equal(3, delegate.callCount())
+
+	// a successful trial closes the breaker
+	clock.Add(time.Minute)
+	delegate.set(true, nil)
+	valid, err = validator.Validate(context.Background(), token)
+	assert.True(valid)
+	assert.NoError(err)
+	assert.False(validator.IsOpen())
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	metrics := response.Body.String()
+	assert.Contains(metrics, RemoteValidatorBreakerTripCounter+" 1")
+	assert.Contains(metrics, RemoteValidatorOpenBreakerGauge+" 0")
+	assert.Contains(metrics, RemoteValidatorUnavailableCounter+`{policy="fail_closed"} 5`)
+}
+
+func TestRemoteValidatorTrial(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		clock  = clocktest.NewClock(time.Now())
+		token  = &Token{tokenType: Bearer, value: "token"}
+
+		trialStarted = make(chan struct{})
+		finishTrial  = make(chan struct{})
+		calls        int32
+
+		delegate = ValidatorFunc(func(ctx context.Context, token *Token) (bool, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return false, ErrorValidatorTimeout
+			}
+
+			close(trialStarted)
+			<-finishTrial
+			return true, nil
+		})
+
+		validator = NewRemoteValidator(delegate, &RemoteValidatorOptions{
+			Threshold: 1,
+			Cooldown:  time.Minute,
+			Clock:     clock,
+		})
+	)
+
+	validator.Validate(context.Background(), token)
+	assert.True(validator.IsOpen())
+	clock.Add(time.Minute)
+
+	trialDone := make(chan bool, 1)
+	go func() {
+		valid, _ := validator.Validate(context.Background(), token)
+		trialDone <- valid
+	}()
+
+	// only one trial is allowed at a time
+	<-trialStarted
+	valid, err := validator.Validate(context.Background(), token)
+	assert.False(valid)
+	assert.Equal(ErrorValidatorUnavailable, err)
+
+	close(finishTrial)
+	assert.True(<-trialDone)
+	assert.False(validator.IsOpen())
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestRemoteValidatorFailOpen(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		token  = &Token{tokenType: Bearer, value: "token"}
+
+		delegate  = newOutcomeValidator(false, ErrorValidatorTimeout)
+		validator = NewRemoteValidator(delegate, &RemoteValidatorOptions{Threshold: 1, FailOpen: true})
+	)
+
+	// a failure is approved, as is every token while the breaker is open
+	for repeat := 0; repeat < 2; repeat++ {
+		valid, err := validator.Validate(context.Background(), token)
+		assert.True(valid)
+		assert.NoError(err)
+	}
+
+	assert.True(validator.IsOpen())
+	assert.Equal(1, delegate.callCount())
+
+	// rejections by an available delegate are never overridden
+	other := NewRemoteValidator(newOutcomeValidator(false, nil), &RemoteValidatorOptions{FailOpen: true})
+	valid, err := other.Validate(context.Background(), token)
+	assert.False(valid)
+	assert.NoError(err)
+}
@@ -0,0 +1,248 @@
+package secure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TokenHashPrefix is the prefix of revocation keys computed from a token's hash rather than its jti claim
+	TokenHashPrefix = "sha256:"
+
+	// DefaultRevocationCacheTTL is the default length of time a RemoteRevocationStore caches lookups
+	DefaultRevocationCacheTTL = 1 * time.Minute
+
+	// DefaultRevocationCacheSize is the default maximum number of lookups a RemoteRevocationStore caches
+	DefaultRevocationCacheSize = 10000
+)
+
+// RevocationKey returns the key under which a token's revocation is recorded.  Tokens with a verified
+// jti claim are keyed on that claim.  All other tokens are keyed on the hex-encoded SHA-256 hash of
+// the token's value, prefixed with TokenHashPrefix.
+func RevocationKey(token *Token) string {
+	if claims := token.Claims(); claims != nil {
+		if jti, ok := claims.JWTID(); ok && len(jti) > 0 {
+			return jti
+		}
+	}
+
+	hash := sha256.Sum256(token.Bytes())
+	return TokenHashPrefix + hex.EncodeToString(hash[:])
+}
+
+// RevocationStore is the strategy for looking up revoked tokens
+type RevocationStore interface {
+	// IsRevoked tests if the given revocation key, as produced by RevocationKey, has been revoked.
+	// An error indicates that the store could not determine the revocation status.
+	IsRevoked(ctx context.Context, key string) (bool, error)
+}
+
+// RevocationStoreFunc is a function type that implements RevocationStore
+type RevocationStoreFunc func(context.Context, string) (bool, error)
+
+func (f RevocationStoreFunc) IsRevoked(ctx context.Context, key string) (bool, error) {
+	return f(ctx, key)
+}
+
+// MemoryRevocationStore is an in-process RevocationStore.  Each revocation is held for a given time-to-live,
+// which should generally be the remaining lifetime of the revoked token.  Once the TTL elapses, the token
+// would be rejected for having expired anyway, and the revocation is discarded.
+type MemoryRevocationStore struct {
+	lock    sync.RWMutex
+	revoked map[string]time.Time
+	now     func() time.Time
+}
+
+// NewMemoryRevocationStore creates an empty MemoryRevocationStore
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revoked: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Revoke denies the given revocation key for the given time-to-live.  Revoking a key that is
+// already revoked replaces its TTL.  Expired revocations are purged as a side effect.
+func (s *MemoryRevocationStore) Revoke(key string, ttl time.Duration) {
+	now := s.now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for existing, expiry := range s.revoked {
+		if !now.Before(expiry) {
+			delete(s.revoked, existing)
+		}
+	}
+
+	s.revoked[key] = now.Add(ttl)
+}
+
+// RevokeToken is a convenience for revoking a token by its RevocationKey
+func (s *MemoryRevocationStore) RevokeToken(token *Token, ttl time.Duration) {
+	s.Revoke(RevocationKey(token), ttl)
+}
+
+// Len returns the count of revocations held by this store, including any that have expired but not been purged
+func (s *MemoryRevocationStore) Len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.revoked)
+}
+
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, key string) (bool, error) {
+	s.lock.RLock()
+	expiry, ok := s.revoked[key]
+	s.lock.RUnlock()
+
+	return ok && s.now().Before(expiry), nil
+}
+
+// revocationCacheEntry is a cached result of a remote revocation lookup
+type revocationCacheEntry struct {
+	revoked bool
+	expiry  time.Time
+}
+
+// RemoteRevocationStore looks up revocations from an HTTP deny-list service.  Each lookup issues a GET
+// to the configured URL with the escaped revocation key appended as a path segment.  A 200 response indicates
+// that the key is revoked, while a 404 response indicates that it is not.  Any other response is an error.
+//
+// Lookup results are cached for the configured TTL, so that the service isn't consulted on every request.
+// At most the configured number of results are cached, and when the cache is full an arbitrary result is
+// evicted.  Errors are never cached.
+type RemoteRevocationStore struct {
+	url       string
+	client    *http.Client
+	cacheTTL  time.Duration
+	cacheSize int
+	now       func() time.Time
+
+	lock  sync.RWMutex
+	cache map[string]revocationCacheEntry
+}
+
+// NewRemoteRevocationStore creates a RemoteRevocationStore which consults the deny-list service at
+// the given base URL.  If client is nil, http.DefaultClient is used.  If cacheTTL is nonpositive,
+// DefaultRevocationCacheTTL is used.  If cacheSize is nonpositive, DefaultRevocationCacheSize is used.
+func NewRemoteRevocationStore(baseURL string, client *http.Client, cacheTTL time.Duration, cacheSize int) *RemoteRevocationStore {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if cacheTTL <= 0 {
+		cacheTTL = DefaultRevocationCacheTTL
+	}
+
+	if cacheSize <= 0 {
+		cacheSize = DefaultRevocationCacheSize
+	}
+
+	return &RemoteRevocationStore{
+		url:       strings.TrimSuffix(baseURL, "/"),
+		client:    client,
+		cacheTTL:  cacheTTL,
+		cacheSize: cacheSize,
+		now:       time.Now,
+		cache:     make(map[string]revocationCacheEntry),
+	}
+}
+
+func (s *RemoteRevocationStore) IsRevoked(ctx context.Context, key string) (bool, error) {
+	now := s.now()
+
+	s.lock.RLock()
+	entry, ok := s.cache[key]
+	s.lock.RUnlock()
+
+	if ok && now.Before(entry.expiry) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := s.lookup(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	s.lock.Lock()
+	for existing, cached := range s.cache {
+		if !now.Before(cached.expiry) {
+			delete(s.cache, existing)
+		}
+	}
+
+	if _, ok := s.cache[key]; !ok {
+		// map iteration order is unspecified, so this evicts arbitrary entries
+		for existing := range s.cache {
+			if len(s.cache) < s.cacheSize {
+				break
+			}
+
+			delete(s.cache, existing)
+		}
+	}
+
+	s.cache[key] = revocationCacheEntry{revoked: revoked, expiry: now.Add(s.cacheTTL)}
+	s.lock.Unlock()
+
+	return revoked, nil
+}
+
+// lookup consults the remote deny-list service for a single key
+func (s *RemoteRevocationStore) lookup(ctx context.Context, key string) (bool, error) {
+	request, err := http.NewRequest(http.MethodGet, s.url+"/"+url.PathEscape(key), nil)
+	if err != nil {
+		return false, err
+	}
+
+	if ctx != nil {
+		request = request.WithContext(ctx)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return false, err
+	}
+
+	response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("Unexpected revocation lookup response status: %d", response.StatusCode)
+	}
+}
+
+// RevocationValidator rejects revoked tokens that have passed a delegate Validator.  The delegate,
+// typically a JWSValidator, runs first so that a token's jti claim has been verified before it is used
+// as the revocation key.  Errors from the Store are returned as validation errors, so tokens are never
+// allowed when their revocation status is unknown.
+type RevocationValidator struct {
+	// Delegate verifies tokens prior to revocation checks.  This field is required.
+	Delegate Validator
+
+	// Store is consulted for each token approved by the Delegate.  This field is required.
+	Store RevocationStore
+}
+
+func (v *RevocationValidator) Validate(ctx context.Context, token *Token) (valid bool, err error) {
+	if valid, err = v.Delegate.Validate(ctx, token); !valid || err != nil {
+		return
+	}
+
+	revoked, err := v.Store.IsRevoked(ctx, RevocationKey(token))
+	if err != nil {
+		return false, err
+	}
+
+	return !revoked, nil
+}
@@ -0,0 +1,209 @@
+package secure
+
+import (
+	"context"
+	"errors"
+	"github.com/SermoDigital/jose/jws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRevocationKey(t *testing.T) {
+	assert := assert.New(t)
+
+	withJTI := &Token{tokenType: Bearer, value: "eyJhbGciOiJIUzI1NiJ9.e30.abc", claims: jws.Claims{"jti": "1234"}}
+	assert.Equal("1234", RevocationKey(withJTI))
+
+	withoutJTI := &Token{tokenType: Bearer, value: "eyJhbGciOiJIUzI1NiJ9.e30.abc", claims: jws.Claims{"sub": "test"}}
+	hashKey := RevocationKey(withoutJTI)
+	assert.True(strings.HasPrefix(hashKey, TokenHashPrefix))
+	assert.Len(hashKey, len(TokenHashPrefix)+64)
+
+	noClaims := &Token{tokenType: Basic, value: "dXNlcjpwYXNzd29yZA=="}
+	assert.True(strings.HasPrefix(RevocationKey(noClaims), TokenHashPrefix))
+	assert.NotEqual(hashKey, RevocationKey(noClaims))
+	assert.Equal(RevocationKey(noClaims), RevocationKey(&Token{tokenType: Basic, value: "dXNlcjpwYXNzd29yZA=="}))
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		current = time.Now()
+		store   = NewMemoryRevocationStore()
+	)
+
+	store.now = func() time.Time { return current }
+
+	revoked, err := store.IsRevoked(context.Background(), "1234")
+	assert.False(revoked)
+	assert.NoError(err)
+
+	store.Revoke("1234", time.Minute)
+	revoked, err = store.IsRevoked(context.Background(), "1234")
+	assert.True(revoked)
+	assert.NoError(err)
+
+	store.RevokeToken(&Token{tokenType: Basic, value: "dXNlcjpwYXNzd29yZA=="}, time.Hour)
+	assert.Equal(2, store.Len())
+
+	current = current.Add(2 * time.Minute)
+	revoked, err = store.IsRevoked(context.Background(), "1234")
+	assert.False(revoked)
+	assert.NoError(err)
+
+	store.Revoke("5678", time.Minute)
+	assert.Equal(2, store.Len())
+}
+
+func TestRemoteRevocationStore(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		requests int32
+		current  = time.Now()
+
+		server = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			switch request.URL.Path {
+			case "/revoked/revoked-jti":
+				response.WriteHeader(http.StatusOK)
+			case "/revoked/valid-jti":
+				response.WriteHeader(http.StatusNotFound)
+			default:
+				response.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+	)
+
+	defer server.Close()
+
+	store := NewRemoteRevocationStore(server.URL+"/revoked/", nil, 0, 0)
+	require.NotNil(store)
+	assert.Equal(DefaultRevocationCacheTTL, store.cacheTTL)
+	assert.Equal(DefaultRevocationCacheSize, store.cacheSize)
+	store.now = func() time.Time { return current }
+
+	revoked, err := store.IsRevoked(context.Background(), "revoked-jti")
+	assert.True(revoked)
+	assert.NoError(err)
+
+	revoked, err = store.IsRevoked(context.Background(), "valid-jti")
+	assert.False(revoked)
+	assert.NoError(err)
+	assert.Equal(int32(2), atomic.LoadInt32(&requests))
+
+	// cached
+	revoked, err = store.IsRevoked(context.Background(), "revoked-jti")
+	assert.True(revoked)
+	assert.NoError(err)
+	assert.Equal(int32(2), atomic.LoadInt32(&requests))
+
+	// errors are not cached
+	for repeat := 0; repeat < 2; repeat++ {
+		revoked, err = store.IsRevoked(context.Background(), "error-jti")
+		assert.False(revoked)
+		assert.Error(err)
+	}
+
+	assert.Equal(int32(4), atomic.LoadInt32(&requests))
+
+	// cache expiry
+	current = current.Add(2 * DefaultRevocationCacheTTL)
+	revoked, err = store.IsRevoked(context.Background(), "revoked-jti")
+	assert.True(revoked)
+	assert.NoError(err)
+	assert.Equal(int32(5), atomic.LoadInt32(&requests))
+	assert.Len(store.cache, 1)
+}
+
+func TestRemoteRevocationStoreCacheSize(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		requests int32
+
+		server = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			response.WriteHeader(http.StatusNotFound)
+		}))
+	)
+
+	defer server.Close()
+
+	store := NewRemoteRevocationStore(server.URL, nil, time.Hour, 2)
+	require.NotNil(store)
+
+	for _, key := range []string{"first", "second", "third", "fourth"} {
+		revoked, err := store.IsRevoked(context.Background(), key)
+		assert.False(revoked)
+		assert.NoError(err)
+		assert.True(len(store.cache) <= 2)
+	}
+
+	assert.Equal(int32(4), atomic.LoadInt32(&requests))
+
+	// the most recent lookup is always cached
+	revoked, err := store.IsRevoked(context.Background(), "fourth")
+	assert.False(revoked)
+	assert.NoError(err)
+	assert.Equal(int32(4), atomic.LoadInt32(&requests))
+}
+
+func TestRevocationValidator(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		expectedError = errors.New("expected")
+		token         = &Token{tokenType: Bearer, value: "abc.def.ghi", claims: jws.Claims{"jti": "1234"}}
+		store         = NewMemoryRevocationStore()
+	)
+
+	var testData = []struct {
+		delegateValid bool
+		delegateError error
+		store         RevocationStore
+		expectedValid bool
+		expectedError error
+	}{
+		{false, nil, store, false, nil},
+		{false, expectedError, store, false, expectedError},
+		{true, expectedError, store, true, expectedError},
+		{true, nil, store, true, nil},
+		{
+			true, nil,
+			RevocationStoreFunc(func(ctx context.Context, key string) (bool, error) { return true, nil }),
+			false, nil,
+		},
+		{
+			true, nil,
+			RevocationStoreFunc(func(ctx context.Context, key string) (bool, error) { return false, expectedError }),
+			false, expectedError,
+		},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		delegate := &MockValidator{}
+		delegate.On("Validate", context.Background(), token).Return(record.delegateValid, record.delegateError).Once()
+
+		validator := &RevocationValidator{Delegate: delegate, Store: record.store}
+		valid, err := validator.Validate(context.Background(), token)
+		assert.Equal(record.expectedValid, valid)
+		assert.Equal(record.expectedError, err)
+		delegate.AssertExpectations(t)
+	}
+
+	store.RevokeToken(token, time.Hour)
+	delegate := &MockValidator{}
+	delegate.On("Validate", context.Background(), token).Return(true, nil).Once()
+
+	valid, err := (&RevocationValidator{Delegate: delegate, Store: store}).Validate(context.Background(), token)
+	assert.False(valid)
+	assert.NoError(err)
+	delegate.AssertExpectations(t)
+}
@@ -0,0 +1,336 @@
+package secure
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSigV4MaxSkew is the default amount by which the signing time of a request may differ from the current time
+	DefaultSigV4MaxSkew = 5 * time.Minute
+
+	// DefaultSigV4MaxBodySize is the default limit on the size of request bodies hashed by a SigV4Validator
+	DefaultSigV4MaxBodySize int64 = 1024 * 1024
+
+	// AmzDateHeader is the header carrying the signing time of a SigV4-signed request
+	AmzDateHeader = "X-Amz-Date"
+
+	// AmzContentSHA256Header is the optional header carrying the hex-encoded SHA-256 hash of a SigV4-signed request's body
+	AmzContentSHA256Header = "X-Amz-Content-Sha256"
+
+	// UnsignedPayload is the AmzContentSHA256Header value indicating that the request body is not signed
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	amzDateFormat      = "20060102T150405Z"
+	amzShortDateFormat = "20060102"
+	sigV4Terminator    = "aws4_request"
+)
+
+var (
+	ErrorNoHTTPRequest = errors.New("The validation context does not contain the HTTP request")
+)
+
+// sigV4Authorization is the parsed form of the value of an AWS4-HMAC-SHA256 authorization
+type sigV4Authorization struct {
+	accessKeyID   string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+}
+
+// parseSigV4Authorization parses the value of an AWS4-HMAC-SHA256 token, e.g.
+// "Credential=AKID/20170601/us-east-1/execute-api/aws4_request, SignedHeaders=host;x-amz-date, Signature=..."
+func parseSigV4Authorization(value string) (*sigV4Authorization, error) {
+	var (
+		authorization = new(sigV4Authorization)
+		credential    string
+	)
+
+	for _, field := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid SigV4 authorization field: %s", field)
+		}
+
+		switch parts[0] {
+		case "Credential":
+			credential = parts[1]
+		case "SignedHeaders":
+			authorization.signedHeaders = strings.Split(parts[1], ";")
+		case "Signature":
+			authorization.signature = parts[1]
+		}
+	}
+
+	scope := strings.Split(credential, "/")
+	if len(scope) != 5 || scope[4] != sigV4Terminator {
+		return nil, fmt.Errorf("Invalid SigV4 credential: %s", credential)
+	}
+
+	if len(authorization.signedHeaders) == 0 || len(authorization.signature) == 0 {
+		return nil, errors.New("Incomplete SigV4 authorization")
+	}
+
+	authorization.accessKeyID = scope[0]
+	authorization.date = scope[1]
+	authorization.region = scope[2]
+	authorization.service = scope[3]
+	return authorization, nil
+}
+
+// scope returns the credential scope, e.g. "20170601/us-east-1/execute-api/aws4_request"
+func (a *sigV4Authorization) scope() string {
+	return strings.Join([]string{a.date, a.region, a.service, sigV4Terminator}, "/")
+}
+
+// SigV4Validator verifies AWS Signature Version 4 signatures on requests, such as those made by Lambda functions
+// or API Gateway using IAM credentials.  It validates AWS4 tokens, i.e. Authorization headers of the form
+// "AWS4-HMAC-SHA256 Credential=..., SignedHeaders=..., Signature=...".  Presigned URLs are not supported.
+//
+// Since the signature covers the method, path, query, headers, and body of the request, this validator requires the
+// HTTP request in the validation context, as placed there by AuthorizationHandler.  The body is read to compute its hash
+// and is then replaced, so that it remains available to the handler.
+//
+// A request is valid when its access key is known, its credential scope matches the configured Region and Service, its
+// signing time is within MaxSkew of the current time and agrees with the credential date, the host header is signed, and
+// the signature matches.
+type SigV4Validator struct {
+	// Credentials maps access key IDs onto secret access keys.  This field is required.
+	Credentials map[string]string
+
+	// Region, if supplied, is the only region accepted in credential scopes, e.g. "us-east-1"
+	Region string
+
+	// Service, if supplied, is the only service accepted in credential scopes, e.g. "execute-api"
+	Service string
+
+	// MaxSkew is the maximum difference between a request's signing time and the current time.
+	// If not supplied, DefaultSigV4MaxSkew is used.
+	MaxSkew time.Duration
+
+	// MaxBodySize limits the size of request bodies that are read and hashed.  Larger requests are rejected.
+	// If not supplied, DefaultSigV4MaxBodySize is used.
+	MaxBodySize int64
+
+	// AllowUnsignedPayload permits requests whose AmzContentSHA256Header is UnsignedPayload, in which
+	// case the body is not verified
+	AllowUnsignedPayload bool
+
+	now func() time.Time
+}
+
+func (v *SigV4Validator) maxSkew() time.Duration {
+	if v.MaxSkew > 0 {
+		return v.MaxSkew
+	}
+
+	return DefaultSigV4MaxSkew
+}
+
+func (v *SigV4Validator) maxBodySize() int64 {
+	if v.MaxBodySize > 0 {
+		return v.MaxBodySize
+	}
+
+	return DefaultSigV4MaxBodySize
+}
+
+func (v *SigV4Validator) currentTime() time.Time {
+	if v.now != nil {
+		return v.now()
+	}
+
+	return time.Now()
+}
+
+func (v *SigV4Validator) Validate(ctx context.Context, token *Token) (bool, error) {
+	if token.Type() != AWS4 {
+		return false, nil
+	}
+
+	authorization, err := parseSigV4Authorization(token.Value())
+	if err != nil {
+		return false, nil
+	}
+
+	secret, ok := v.Credentials[authorization.accessKeyID]
+	if !ok {
+		return false, nil
+	}
+
+	if (len(v.Region) > 0 && authorization.region != v.Region) || (len(v.Service) > 0 && authorization.service != v.Service) {
+		return false, nil
+	}
+
+	request, ok := GetHTTPRequest(ctx)
+	if !ok {
+		return false, ErrorNoHTTPRequest
+	}
+
+	signingTime, err := time.Parse(amzDateFormat, request.Header.Get(AmzDateHeader))
+	if err != nil {
+		if signingTime, err = http.ParseTime(request.Header.Get("Date")); err != nil {
+			return false, nil
+		}
+	}
+
+	signingTime = signingTime.UTC()
+	if skew := v.currentTime().Sub(signingTime); skew > v.maxSkew() || skew < -v.maxSkew() {
+		return false, nil
+	}
+
+	if signingTime.Format(amzShortDateFormat) != authorization.date || !containsAny(authorization.signedHeaders, []string{"host"}) {
+		return false, nil
+	}
+
+	payloadHash, err := v.payloadHash(request)
+	if err != nil || len(payloadHash) == 0 {
+		return false, err
+	}
+
+	stringToSign := strings.Join(
+		[]string{
+			string(AWS4),
+			signingTime.Format(amzDateFormat),
+			authorization.scope(),
+			hexSHA256([]byte(canonicalSigV4Request(request, authorization.signedHeaders, payloadHash))),
+		},
+		"\n",
+	)
+
+	key := sigV4HMAC([]byte("AWS4"+secret), authorization.date)
+	key = sigV4HMAC(key, authorization.region)
+	key = sigV4HMAC(key, authorization.service)
+	key = sigV4HMAC(key, sigV4Terminator)
+
+	expected := hex.EncodeToString(sigV4HMAC(key, stringToSign))
+	return hmac.Equal([]byte(expected), []byte(authorization.signature)), nil
+}
+
+// payloadHash computes the hex-encoded SHA-256 hash of the request body, restoring the body afterward.
+// If the request has an AmzContentSHA256Header, it must match the body.  An empty hash with no error indicates
+// that the payload is not acceptable.
+func (v *SigV4Validator) payloadHash(request *http.Request) (string, error) {
+	claimed := request.Header.Get(AmzContentSHA256Header)
+	if claimed == UnsignedPayload {
+		if v.AllowUnsignedPayload {
+			return UnsignedPayload, nil
+		}
+
+		return "", nil
+	}
+
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(io.LimitReader(request.Body, v.maxBodySize()+1))
+		request.Body.Close()
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		} else if int64(len(body)) > v.maxBodySize() {
+			return "", nil
+		}
+	}
+
+	actual := hexSHA256(body)
+	if len(claimed) > 0 && claimed != actual {
+		return "", nil
+	}
+
+	return actual, nil
+}
+
+// canonicalSigV4Request produces the canonical form of a request as defined by SigV4
+func canonicalSigV4Request(request *http.Request, signedHeaders []string, payloadHash string) string {
+	path := request.URL.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	query := request.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	parameters := make([]string, 0, len(query))
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parameters = append(parameters, sigV4Escape(key, true)+"="+sigV4Escape(value, true))
+		}
+	}
+
+	var headers bytes.Buffer
+	for _, name := range signedHeaders {
+		var value string
+		if name == "host" {
+			value = request.Host
+		} else {
+			value = strings.Join(request.Header[http.CanonicalHeaderKey(name)], ",")
+		}
+
+		headers.WriteString(name)
+		headers.WriteByte(':')
+		headers.WriteString(strings.Join(strings.Fields(value), " "))
+		headers.WriteByte('\n')
+	}
+
+	return strings.Join(
+		[]string{
+			request.Method,
+			sigV4Escape(path, false),
+			strings.Join(parameters, "&"),
+			headers.String(),
+			strings.Join(signedHeaders, ";"),
+			payloadHash,
+		},
+		"\n",
+	)
+}
+
+// sigV4Escape percent-encodes every byte other than the unreserved characters of RFC 3986, and
+// optionally the path separator
+func sigV4Escape(value string, escapeSeparator bool) string {
+	var buffer bytes.Buffer
+	for index := 0; index < len(value); index++ {
+		c := value[index]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			buffer.WriteByte(c)
+		case c == '/' && !escapeSeparator:
+			buffer.WriteByte(c)
+		default:
+			fmt.Fprintf(&buffer, "%%%02X", c)
+		}
+	}
+
+	return buffer.String()
+}
+
+func sigV4HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
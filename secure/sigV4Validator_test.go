@@ -0,0 +1,299 @@
+package secure
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	sigV4AccessKeyID = "AKIDEXAMPLE"
+	sigV4Secret      = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// signedSigV4Request produces a server-side request signed by the AWS SDK
+func signedSigV4Request(t *testing.T, method, target, body, service, region string, signTime time.Time, options ...func(*v4.Signer)) *http.Request {
+	var (
+		request = httptest.NewRequest(method, target, strings.NewReader(body))
+		signer  = v4.NewSigner(credentials.NewStaticCredentials(sigV4AccessKeyID, sigV4Secret, ""), options...)
+	)
+
+	// the SDK signs the URL's host, which is not set for server-side requests
+	request.URL.Host = request.Host
+	request.Header.Set("Content-Type", "application/json")
+
+	var seeker io.ReadSeeker
+	if len(body) > 0 {
+		seeker = strings.NewReader(body)
+	}
+
+	_, err := signer.Sign(request, seeker, service, region, signTime)
+	require.NoError(t, err)
+	request.Body = ioutil.NopCloser(strings.NewReader(body))
+	return request
+}
+
+func validateSigV4(t *testing.T, validator *SigV4Validator, request *http.Request) (bool, error) {
+	token, err := ParseAuthorization(request.Header.Get(AuthorizationHeader))
+	require.NoError(t, err)
+	require.Equal(t, AWS4, token.Type())
+
+	return validator.Validate(WithHTTPRequest(context.Background(), request), token)
+}
+
+func TestParseSigV4Authorization(t *testing.T) {
+	assert := assert.New(t)
+
+	authorization, err := parseSigV4Authorization("Credential=AKID/20170601/us-east-1/execute-api/aws4_request, SignedHeaders=host;x-amz-date, Signature=abcdef")
+	assert.NoError(err)
+	if assert.NotNil(authorization) {
+		assert.Equal("AKID", authorization.accessKeyID)
+		assert.Equal("20170601", authorization.date)
+		assert.Equal("us-east-1", authorization.region)
+		assert.Equal("execute-api", authorization.service)
+		assert.Equal([]string{"host", "x-amz-date"}, authorization.signedHeaders)
+		assert.Equal("abcdef", authorization.signature)
+		assert.Equal("20170601/us-east-1/execute-api/aws4_request", authorization.scope())
+	}
+
+	for _, invalid := range []string{
+		"",
+		"Credential",
+		"Credential=AKID/20170601/us-east-1/execute-api, SignedHeaders=host, Signature=abcdef",
+		"Credential=AKID/20170601/us-east-1/execute-api/aws5_request, SignedHeaders=host, Signature=abcdef",
+		"Credential=AKID/20170601/us-east-1/execute-api/aws4_request, Signature=abcdef",
+		"Credential=AKID/20170601/us-east-1/execute-api/aws4_request, SignedHeaders=host",
+	} {
+		authorization, err := parseSigV4Authorization(invalid)
+		assert.Nil(authorization)
+		assert.Error(err)
+	}
+}
+
+func TestSigV4Escape(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("/foo/bar%20baz/A-Z_a.z~0", sigV4Escape("/foo/bar baz/A-Z_a.z~0", false))
+	assert.Equal("%2Ffoo%2Fbar%2520", sigV4Escape("/foo/bar%20", true))
+}
+
+func TestSigV4Validator(t *testing.T) {
+	var (
+		now       = time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+		validator = &SigV4Validator{
+			Credentials: map[string]string{sigV4AccessKeyID: sigV4Secret},
+			Region:      "us-east-1",
+			Service:     "execute-api",
+			now:         func() time.Time { return now },
+		}
+
+		unsignedPayload = func(s *v4.Signer) { s.UnsignedPayload = true }
+	)
+
+	var testData = []struct {
+		description string
+		request     func() *http.Request
+		expected    bool
+	}{
+		{
+			"GET",
+			func() *http.Request {
+				return signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device", "", "execute-api", "us-east-1", now)
+			},
+			true,
+		},
+		{
+			"GET with query",
+			func() *http.Request {
+				return signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device?b=2&a=1&a=0&c=a%20b", "", "execute-api", "us-east-1", now)
+			},
+			true,
+		},
+		{
+			"escaped path",
+			func() *http.Request {
+				return signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device/mac%3A112233445566/stat", "", "execute-api", "us-east-1", now)
+			},
+			true,
+		},
+		{
+			"POST",
+			func() *http.Request {
+				return signedSigV4Request(t, "POST", "http://webpa.example.com/api/v2/device", `{"id":"mac:112233445566"}`, "execute-api", "us-east-1", now)
+			},
+			true,
+		},
+		{
+			"small skew",
+			func() *http.Request {
+				return signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device", "", "execute-api", "us-east-1", now.Add(-4*time.Minute))
+			},
+			true,
+		},
+		{
+			"tampered body",
+			func() *http.Request {
+				request := signedSigV4Request(t, "POST", "http://webpa.example.com/api/v2/device", `{"id":"mac:112233445566"}`, "execute-api", "us-east-1", now)
+				request.Body = ioutil.NopCloser(strings.NewReader(`{"id":"mac:665544332211"}`))
+				return request
+			},
+			false,
+		},
+		{
+			"tampered query",
+			func() *http.Request {
+				request := signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device?a=1", "", "execute-api", "us-east-1", now)
+				request.URL.RawQuery = "a=2"
+				return request
+			},
+			false,
+		},
+		{
+			"tampered method",
+			func() *http.Request {
+				request := signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device", "", "execute-api", "us-east-1", now)
+				request.Method = "DELETE"
+				return request
+			},
+			false,
+		},
+		{
+			"tampered signed header",
+			func() *http.Request {
+				request := signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device", "", "execute-api", "us-east-1", now)
+				request.Header.Set("Content-Type", "text/plain")
+				return request
+			},
+			false,
+		},
+		{
+			"wrong region",
+			func() *http.Request {
+				return signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device", "", "execute-api", "us-west-2", now)
+			},
+			false,
+		},
+		{
+			"wrong service",
+			func() *http.Request {
+				return signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device", "", "lambda", "us-east-1", now)
+			},
+			false,
+		},
+		{
+			"expired",
+			func() *http.Request {
+				return signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device", "", "execute-api", "us-east-1", now.Add(-6*time.Minute))
+			},
+			false,
+		},
+		{
+			"future",
+			func() *http.Request {
+				return signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device", "", "execute-api", "us-east-1", now.Add(6*time.Minute))
+			},
+			false,
+		},
+		{
+			"no date",
+			func() *http.Request {
+				request := signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device", "", "execute-api", "us-east-1", now)
+				request.Header.Del(AmzDateHeader)
+				return request
+			},
+			false,
+		},
+		{
+			"unknown access key",
+			func() *http.Request {
+				request := signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device", "", "execute-api", "us-east-1", now)
+				request.Header.Set(AuthorizationHeader, strings.Replace(request.Header.Get(AuthorizationHeader), sigV4AccessKeyID, "AKIDUNKNOWN", 1))
+				return request
+			},
+			false,
+		},
+		{
+			"unsigned payload",
+			func() *http.Request {
+				return signedSigV4Request(t, "POST", "http://webpa.example.com/api/v2/device", `{"id":"mac:112233445566"}`, "execute-api", "us-east-1", now, unsignedPayload)
+			},
+			false,
+		},
+	}
+
+	for _, record := range testData {
+		t.Run(record.description, func(t *testing.T) {
+			valid, err := validateSigV4(t, validator, record.request())
+			assert.Equal(t, record.expected, valid)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestSigV4ValidatorBody(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now       = time.Now()
+		body      = `{"id":"mac:112233445566"}`
+		validator = &SigV4Validator{Credentials: map[string]string{sigV4AccessKeyID: sigV4Secret}}
+		request   = signedSigV4Request(t, "PUT", "http://webpa.example.com/api/v2/device", body, "execute-api", "us-east-1", now)
+	)
+
+	valid, err := validateSigV4(t, validator, request)
+	assert.True(valid)
+	assert.NoError(err)
+
+	// the body must still be available to the handler
+	actual, err := ioutil.ReadAll(request.Body)
+	require.NoError(err)
+	assert.Equal(body, string(actual))
+
+	request = signedSigV4Request(t, "PUT", "http://webpa.example.com/api/v2/device", body, "execute-api", "us-east-1", now)
+	validator.MaxBodySize = 4
+	valid, err = validateSigV4(t, validator, request)
+	assert.False(valid)
+	assert.NoError(err)
+}
+
+func TestSigV4ValidatorUnsignedPayload(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		validator = &SigV4Validator{Credentials: map[string]string{sigV4AccessKeyID: sigV4Secret}, AllowUnsignedPayload: true}
+		request   = signedSigV4Request(t, "POST", "http://webpa.example.com/api/v2/device", "unverified", "execute-api", "us-east-1", time.Now(), func(s *v4.Signer) { s.UnsignedPayload = true })
+	)
+
+	assert.Equal(UnsignedPayload, request.Header.Get(AmzContentSHA256Header))
+	valid, err := validateSigV4(t, validator, request)
+	assert.True(valid)
+	assert.NoError(err)
+}
+
+func TestSigV4ValidatorNoRequest(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		validator = &SigV4Validator{Credentials: map[string]string{sigV4AccessKeyID: sigV4Secret}}
+		request   = signedSigV4Request(t, "GET", "http://webpa.example.com/api/v2/device", "", "execute-api", "us-east-1", time.Now())
+	)
+
+	token, err := ParseAuthorization(request.Header.Get(AuthorizationHeader))
+	if assert.NoError(err) {
+		valid, err := validator.Validate(context.Background(), token)
+		assert.False(valid)
+		assert.Equal(ErrorNoHTTPRequest, err)
+	}
+
+	valid, err := validator.Validate(context.Background(), &Token{tokenType: Bearer, value: "test"})
+	assert.False(valid)
+	assert.NoError(err)
+}
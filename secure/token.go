@@ -1,7 +1,13 @@
 package secure
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"github.com/SermoDigital/jose/jws"
 	"net/http"
 	"regexp"
 	"strings"
@@ -16,6 +22,18 @@ const (
 	Basic               TokenType = "Basic"
 	Bearer              TokenType = "Bearer"
 	Digest              TokenType = "Digest"
+
+	// AWS4 is the type of tokens carrying AWS Signature Version 4 authorizations
+	AWS4 TokenType = "AWS4-HMAC-SHA256"
+
+	// SharedSecret is the type of tokens carried in a dedicated shared-secret header rather
+	// than in the Authorization header.  ParseAuthorization never produces tokens of this type.
+	SharedSecret TokenType = "SharedSecret"
+
+	// ClientCertificate is the type of tokens representing a TLS client certificate.  The value of such
+	// a token is the hex-encoded SHA-256 fingerprint of the certificate.  ParseAuthorization never produces
+	// tokens of this type.
+	ClientCertificate TokenType = "ClientCertificate"
 )
 
 // ParseTokenType returns the TokenType corresponding to a string.
@@ -28,6 +46,8 @@ func ParseTokenType(value string) (TokenType, error) {
 		return Bearer, nil
 	case strings.EqualFold(string(Digest), value):
 		return Digest, nil
+	case strings.EqualFold(string(AWS4), value):
+		return AWS4, nil
 	default:
 		return Invalid, fmt.Errorf("Invalid token type: %s", value)
 	}
@@ -37,6 +57,7 @@ func ParseTokenType(value string) (TokenType, error) {
 type Token struct {
 	tokenType TokenType
 	value     string
+	claims    jws.Claims
 }
 
 // String returns an on-the-wire representation of this token, suitable
@@ -62,14 +83,43 @@ func (t *Token) Bytes() []byte {
 	return []byte(t.value)
 }
 
+// Claims returns the verified claims associated with this token.  Validators which
+// verify claim-bearing tokens, such as JWSValidator, set the claims only after the token
+// has passed verification.  This method returns nil if no validator has verified any claims.
+func (t *Token) Claims() jws.Claims {
+	return t.claims
+}
+
+// Principal returns the identity this token was issued to:  the subject of the verified claims, or the
+// username of a Basic token.  Since tokens are not verified when parsed, the principal should only be trusted
+// once a validator has approved this token.  Tokens with no identity return the empty string.
+func (t *Token) Principal() string {
+	if t.claims != nil {
+		if subject, _ := t.claims.Get("sub").(string); len(subject) > 0 {
+			return subject
+		}
+	}
+
+	if t.tokenType == Basic {
+		if decoded, err := base64.StdEncoding.DecodeString(t.value); err == nil {
+			if separator := bytes.IndexByte(decoded, ':'); separator > 0 {
+				return string(decoded[:separator])
+			}
+		}
+	}
+
+	return ""
+}
+
 // authorizationPattern is the regular expression that all Authorization
 // strings must match to be supported by WebPA.
 var authorizationPattern = regexp.MustCompile(
 	fmt.Sprintf(
-		`(?P<tokenType>(?i)%s|%s|%s)\s+(?P<value>.*)`,
+		`(?P<tokenType>(?i)%s|%s|%s|%s)\s+(?P<value>.*)`,
 		Basic,
 		Bearer,
 		Digest,
+		AWS4,
 	),
 )
 
@@ -105,3 +155,21 @@ func NewToken(request *http.Request) (*Token, error) {
 
 	return ParseAuthorization(value)
 }
+
+// NewSharedSecretToken creates a Token of type SharedSecret with the given value, which
+// is typically the value of a dedicated shared-secret header.
+func NewSharedSecretToken(value string) *Token {
+	return &Token{
+		tokenType: SharedSecret,
+		value:     value,
+	}
+}
+
+// NewClientCertificateToken creates a Token of type ClientCertificate for the given TLS peer certificate
+func NewClientCertificateToken(certificate *x509.Certificate) *Token {
+	fingerprint := sha256.Sum256(certificate.Raw)
+	return &Token{
+		tokenType: ClientCertificate,
+		value:     hex.EncodeToString(fingerprint[:]),
+	}
+}
@@ -0,0 +1,198 @@
+package secure
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/SermoDigital/jose/jws"
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// DefaultTokenCacheSize is the default maximum number of verified tokens held by a CachingValidator
+	DefaultTokenCacheSize = 10000
+
+	// DefaultTokenCacheTTL is the default longest time a CachingValidator holds a verified token
+	DefaultTokenCacheTTL time.Duration = 5 * time.Minute
+)
+
+// TokenCacheOptions configures a CachingValidator
+type TokenCacheOptions struct {
+	// MaxSize is the maximum number of verified tokens held.  When the cache is full, the least recently
+	// used token is evicted.  If not supplied, DefaultTokenCacheSize is used.
+	MaxSize int `json:"maxSize"`
+
+	// TTL is the longest time a verified token is held, regardless of its exp claim.  This bounds how long
+	// a token remains approved after, for example, its signing key is withdrawn.  If not supplied,
+	// DefaultTokenCacheTTL is used.
+	TTL time.Duration `json:"ttl"`
+
+	// Clock is the source of time used to expire tokens.  If not supplied, clock.System() is used.
+	Clock clock.Interface `json:"-"`
+
+	// MetricsProvider is the source of the metrics declared by Metrics.  If not supplied, metrics are discarded.
+	MetricsProvider xmetrics.Provider `json:"-"`
+}
+
+func (o *TokenCacheOptions) maxSize() int {
+	if o != nil && o.MaxSize > 0 {
+		return o.MaxSize
+	}
+
+	return DefaultTokenCacheSize
+}
+
+func (o *TokenCacheOptions) ttl() time.Duration {
+	if o != nil && o.TTL > 0 {
+		return o.TTL
+	}
+
+	return DefaultTokenCacheTTL
+}
+
+func (o *TokenCacheOptions) clock() clock.Interface {
+	if o != nil && o.Clock != nil {
+		return o.Clock
+	}
+
+	return clock.System()
+}
+
+func (o *TokenCacheOptions) metricsProvider() xmetrics.Provider {
+	if o != nil && o.MetricsProvider != nil {
+		return o.MetricsProvider
+	}
+
+	return xmetrics.NewDiscardProvider()
+}
+
+// tokenCacheEntry is a single verified token
+type tokenCacheEntry struct {
+	value  string
+	claims jws.Claims
+	expiry time.Time
+}
+
+// CachingValidator remembers the bearer tokens approved by a delegate Validator, typically a JWSValidator,
+// so that repeated requests with the same token skip parsing and signature verification.  Each token is held
+// no later than its exp claim, nor longer than the configured TTL.  Only approved tokens carrying verified
+// claims are cached:  rejected tokens, errors, and tokens other than bearer tokens always go to the delegate.
+//
+// Checks which must happen on every request, such as revocation, should wrap a CachingValidator rather
+// than being wrapped by it.
+type CachingValidator struct {
+	delegate Validator
+	maxSize  int
+	ttl      time.Duration
+	now      func() time.Time
+
+	hits   metrics.Counter
+	misses metrics.Counter
+	size   metrics.Gauge
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// NewCachingValidator creates a CachingValidator in front of the given delegate
+func NewCachingValidator(delegate Validator, o *TokenCacheOptions) *CachingValidator {
+	provider := o.metricsProvider()
+	return &CachingValidator{
+		delegate: delegate,
+		maxSize:  o.maxSize(),
+		ttl:      o.ttl(),
+		now:      o.clock().Now,
+		hits:     provider.NewCounter(TokenCacheHitCounter),
+		misses:   provider.NewCounter(TokenCacheMissCounter),
+		size:     provider.NewGauge(TokenCacheSizeGauge),
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Len returns the number of tokens held in the cache, including any that have expired but not been purged
+func (v *CachingValidator) Len() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.order.Len()
+}
+
+// lookup returns the claims of a cached token, if present and unexpired
+func (v *CachingValidator) lookup(value string, now time.Time) (jws.Claims, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	element, ok := v.entries[value]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*tokenCacheEntry)
+	if !now.Before(entry.expiry) {
+		v.remove(element)
+		return nil, false
+	}
+
+	v.order.MoveToFront(element)
+	return entry.claims, true
+}
+
+// store caches a verified token, evicting the least recently used token if the cache is full
+func (v *CachingValidator) store(value string, claims jws.Claims, now time.Time) {
+	expiry := now.Add(v.ttl)
+	if exp, ok := claims.Expiration(); ok && exp.Before(expiry) {
+		expiry = exp
+	}
+
+	if !now.Before(expiry) {
+		return
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if element, ok := v.entries[value]; ok {
+		v.remove(element)
+	}
+
+	for v.order.Len() >= v.maxSize {
+		v.remove(v.order.Back())
+	}
+
+	v.entries[value] = v.order.PushFront(&tokenCacheEntry{value: value, claims: claims, expiry: expiry})
+	v.size.Set(float64(v.order.Len()))
+}
+
+// remove discards a cached token.  This method must be called under the lock.
+func (v *CachingValidator) remove(element *list.Element) {
+	v.order.Remove(element)
+	delete(v.entries, element.Value.(*tokenCacheEntry).value)
+	v.size.Set(float64(v.order.Len()))
+}
+
+func (v *CachingValidator) Validate(ctx context.Context, token *Token) (valid bool, err error) {
+	if token.Type() != Bearer {
+		return v.delegate.Validate(ctx, token)
+	}
+
+	now := v.now()
+	if claims, ok := v.lookup(token.Value(), now); ok {
+		v.hits.Add(1)
+		token.claims = claims
+		return true, nil
+	}
+
+	v.misses.Add(1)
+	if valid, err = v.delegate.Validate(ctx, token); valid && err == nil {
+		if claims := token.Claims(); claims != nil {
+			v.store(token.Value(), claims, now)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,204 @@
+package secure
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock/clocktest"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/SermoDigital/jose/jws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingValidator approves tokens with the given claims, as a JWSValidator would, and counts its calls
+type countingValidator struct {
+	calls  int
+	claims map[string]jws.Claims
+	err    error
+}
+
+func (v *countingValidator) Validate(ctx context.Context, token *Token) (bool, error) {
+	v.calls++
+	if v.err != nil {
+		return false, v.err
+	}
+
+	claims, ok := v.claims[token.Value()]
+	if ok {
+		token.claims = claims
+	}
+
+	return ok, nil
+}
+
+func TestTokenCacheOptionsDefaults(t *testing.T) {
+	assert := assert.New(t)
+	for _, o := range []*TokenCacheOptions{nil, new(TokenCacheOptions)} {
+		assert.Equal(DefaultTokenCacheSize, o.maxSize())
+		assert.Equal(DefaultTokenCacheTTL, o.ttl())
+		assert.NotNil(o.metricsProvider())
+	}
+}
+
+func TestSecureMetrics(t *testing.T) {
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	assert.NotNil(t, registry)
+	assert.NoError(t, err)
+}
+
+func TestCachingValidator(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+		now           = time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+		clock         = clocktest.NewClock(now)
+		delegate      = &countingValidator{
+			claims: map[string]jws.Claims{
+				"noexp":   {"sub": "noexp"},
+				"soon":    {"sub": "soon", "exp": float64(now.Add(time.Minute).Unix())},
+				"expired": {"sub": "expired", "exp": float64(now.Add(-time.Minute).Unix())},
+			},
+		}
+	)
+
+	require.NoError(err)
+	validator := NewCachingValidator(delegate, &TokenCacheOptions{TTL: time.Hour, MetricsProvider: registry, Clock: clock})
+
+	for _, value := range []string{"noexp", "soon", "noexp", "soon"} {
+		token := &Token{tokenType: Bearer, value: value}
+		valid, err := validator.Validate(context.Background(), token)
+		assert.True(valid)
+		assert.NoError(err)
+		assert.Equal(value, token.Claims()["sub"])
+	}
+
+	assert.Equal(2, delegate.calls)
+	assert.Equal(2, validator.Len())
+
+	// tokens which expire immediately are never cached
+	for repeat := 0; repeat < 2; repeat++ {
+		valid, err := validator.Validate(context.Background(), &Token{tokenType: Bearer, value: "expired"})
+		assert.True(valid)
+		assert.NoError(err)
+	}
+
+	assert.Equal(4, delegate.calls)
+
+	// rejections are never cached
+	for repeat := 0; repeat < 2; repeat++ {
+		valid, err := validator.Validate(context.Background(), &Token{tokenType: Bearer, value: "unknown"})
+		assert.False(valid)
+		assert.NoError(err)
+	}
+
+	assert.Equal(6, delegate.calls)
+
+	// a token is held no later than its exp claim
+	clock.Add(time.Minute)
+	validator.Validate(context.Background(), &Token{tokenType: Bearer, value: "soon"})
+	assert.Equal(7, delegate.calls)
+
+	// nor longer than the TTL
+	validator.Validate(context.Background(), &Token{tokenType: Bearer, value: "noexp"})
+	assert.Equal(7, delegate.calls)
+	clock.Add(time.Hour)
+	validator.Validate(context.Background(), &Token{tokenType: Bearer, value: "noexp"})
+	assert.Equal(8, delegate.calls)
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	output := response.Body.String()
+	assert.Contains(output, TokenCacheHitCounter+" 3")
+	assert.Contains(output, TokenCacheMissCounter+" 8")
+	assert.Contains(output, TokenCacheSizeGauge+" 1")
+}
+
+func TestCachingValidatorEviction(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		delegate = &countingValidator{
+			claims: map[string]jws.Claims{"a": {}, "b": {}, "c": {}},
+		}
+
+		validator = NewCachingValidator(delegate, &TokenCacheOptions{MaxSize: 2})
+		validate  = func(value string) {
+			valid, err := validator.Validate(context.Background(), &Token{tokenType: Bearer, value: value})
+			assert.True(valid)
+			assert.NoError(err)
+		}
+	)
+
+	validate("a")
+	validate("b")
+	validate("a") // a is now the most recently used
+	validate("c") // b is evicted
+	assert.Equal(3, delegate.calls)
+	assert.Equal(2, validator.Len())
+
+	validate("a")
+	validate("c")
+	assert.Equal(3, delegate.calls)
+
+	validate("b")
+	assert.Equal(4, delegate.calls)
+	assert.Equal(2, validator.Len())
+}
+
+func TestCachingValidatorBypass(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		expectedError = errors.New("expected")
+		delegate      = &countingValidator{
+			claims: map[string]jws.Claims{"abc": {}},
+		}
+
+		validator = NewCachingValidator(delegate, nil)
+	)
+
+	// tokens other than bearer tokens always go to the delegate
+	for repeat := 0; repeat < 2; repeat++ {
+		valid, err := validator.Validate(context.Background(), &Token{tokenType: Basic, value: "abc"})
+		assert.True(valid)
+		assert.NoError(err)
+	}
+
+	assert.Equal(2, delegate.calls)
+	assert.Zero(validator.Len())
+
+	// errors are never cached
+	delegate.err = expectedError
+	for repeat := 0; repeat < 2; repeat++ {
+		valid, err := validator.Validate(context.Background(), &Token{tokenType: Bearer, value: "abc"})
+		assert.False(valid)
+		assert.Equal(expectedError, err)
+	}
+
+	assert.Equal(4, delegate.calls)
+	assert.Zero(validator.Len())
+}
+
+func TestCachingValidatorJWS(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		require   = require.New(t)
+		validator = NewCachingValidator(JWSValidator{Resolver: publicKeyResolver}, nil)
+	)
+
+	for repeat := 0; repeat < 2; repeat++ {
+		token, err := ParseAuthorization("Bearer " + string(testSerializedJWT))
+		require.NoError(err)
+
+		valid, err := validator.Validate(context.Background(), token)
+		assert.True(valid)
+		assert.NoError(err)
+		assert.Equal(testClaims["capabilities"], token.Claims().Get(CapabilitiesClaim))
+	}
+
+	assert.Equal(1, validator.Len())
+}
@@ -87,11 +87,12 @@ func resolveKeys(infoLogger *log.Logger, c *Configuration, privateKeys map[strin
 			return err
 		}
 
-		if resolvedPair.HasPrivate() {
-			privateKeys[keyID] = resolvedPair.Private().(*rsa.PrivateKey)
-		} else {
-			return fmt.Errorf("The key %s did not resolve to an RSA private key")
+		privateKey, ok := resolvedPair.Private().(*rsa.PrivateKey)
+		if !resolvedPair.HasPrivate() || !ok {
+			return fmt.Errorf("The key %s did not resolve to an RSA private key", keyID)
 		}
+
+		privateKeys[keyID] = privateKey
 	}
 
 	return nil
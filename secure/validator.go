@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Comcast/webpa-common/secure/key"
+	"github.com/SermoDigital/jose/crypto"
 	"github.com/SermoDigital/jose/jws"
 	"github.com/SermoDigital/jose/jwt"
+	"math"
 	"regexp"
 	"strings"
 	"time"
@@ -36,11 +38,17 @@ func (v ValidatorFunc) Validate(ctx context.Context, token *Token) (bool, error)
 
 // Validators is an aggregate Validator.  A Validators instance considers a token
 // valid if any of its validators considers it valid.  An empty Validators rejects
-// all tokens.
+// all tokens.  If the context is cancelled, the remaining validators are skipped and
+// the context's error is returned.
 type Validators []Validator
 
 func (v Validators) Validate(ctx context.Context, token *Token) (valid bool, err error) {
 	for _, validator := range v {
+		// stop evaluating the chain once the caller, e.g. a disconnected client, has given up
+		if ctx != nil && ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+
 		if valid, err = validator.Validate(ctx, token); valid && err == nil {
 			return
 		}
@@ -49,6 +57,63 @@ func (v Validators) Validate(ctx context.Context, token *Token) (valid bool, err
 	return
 }
 
+// ConcurrentValidators is an aggregate Validator with the same semantics as Validators, except that
+// all of its validators are evaluated concurrently.  As soon as any validator considers a token valid,
+// the context passed to the remaining validators is cancelled and the token is approved.  This reduces
+// the worst-case latency of chains containing several slow, remote validators.
+//
+// Each validator is given its own copy of the token, so that validators which record claims do not
+// race with each other.  Only the claims recorded by the approving validator are copied back to the token.
+//
+// If no validator approves the token, the result of the last validator in the chain is returned,
+// just as with Validators.  An empty ConcurrentValidators rejects all tokens.
+type ConcurrentValidators []Validator
+
+// concurrentResult is the outcome of one validator within a ConcurrentValidators
+type concurrentResult struct {
+	index int
+	token *Token
+	valid bool
+	err   error
+}
+
+func (v ConcurrentValidators) Validate(ctx context.Context, token *Token) (bool, error) {
+	if len(v) == 0 {
+		return false, nil
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the channel is buffered so that outstanding validators never block after we return
+	results := make(chan concurrentResult, len(v))
+	for index, validator := range v {
+		go func(index int, validator Validator, token Token) {
+			valid, err := validator.Validate(ctx, &token)
+			results <- concurrentResult{index, &token, valid, err}
+		}(index, validator, *token)
+	}
+
+	var last concurrentResult
+	for remaining := len(v); remaining > 0; remaining-- {
+		result := <-results
+		if result.valid && result.err == nil {
+			token.claims = result.token.claims
+			return true, nil
+		}
+
+		if result.index == len(v)-1 {
+			last = result
+		}
+	}
+
+	return last.valid, last.err
+}
+
 // ExactMatchValidator simply matches a token's value (exluding the prefix, such as "Basic"),
 // to a string.
 type ExactMatchValidator string
@@ -63,7 +128,10 @@ func (v ExactMatchValidator) Validate(ctx context.Context, token *Token) (bool,
 	return false, nil
 }
 
-// JWSValidator provides validation for JWT tokens encoded as JWS.
+// JWSValidator provides validation for JWT tokens encoded as JWS.  If the Resolver is also a
+// key.Refresher, as are the resolvers created by key.ResolverFactory, a token whose signature cannot be
+// verified is checked once more against a refreshed key.  This allows keys to be rotated without waiting
+// for cached keys to be updated.
 type JWSValidator struct {
 	DefaultKeyId  string
 	Resolver      key.Resolver
@@ -79,16 +147,26 @@ func capabilityValidation(ctx context.Context, capability string) (valid_capabil
 	   pieces[0] == "x1"    && 
 	   pieces[1] == "webpa" {
 		
-		method_value, ok := ctx.Value("method").(string)
-		if ok && (pieces[4] == "all" || strings.EqualFold(pieces[4], method_value)) {
+		method_value := RequestMethod(ctx)
+		if len(method_value) > 0 && (pieces[4] == "all" || strings.EqualFold(pieces[4], method_value)) {
 			claimPath := fmt.Sprintf("/%s/[^/]+/%s", pieces[2],pieces[3])
-			valid_capabilities, _ = regexp.MatchString(claimPath, ctx.Value("path").(string))
+			valid_capabilities, _ = regexp.MatchString(claimPath, RequestPath(ctx))
 		}
 	}
 	
 	return
 }
 
+// verify validates the signature of a token using the given key
+func (v JWSValidator) verify(jwsToken jws.JWS, pair key.Pair, signingMethod crypto.SigningMethod) error {
+	if len(v.JWTValidators) > 0 {
+		// all JWS implementations also implement jwt.JWT
+		return jwsToken.(jwt.JWT).Validate(pair.Public(), signingMethod, v.JWTValidators...)
+	}
+
+	return jwsToken.Verify(pair.Public(), signingMethod)
+}
+
 func (v JWSValidator) Validate(ctx context.Context, token *Token) (valid bool, err error) {
 	if token.Type() != Bearer {
 		return
@@ -127,12 +205,14 @@ func (v JWSValidator) Validate(ctx context.Context, token *Token) (valid bool, e
 		return
 	}
 	
-	// validate the signature
-	if len(v.JWTValidators) > 0 {
-		// all JWS implementations also implement jwt.JWT
-		err = jwsToken.(jwt.JWT).Validate(pair.Public(), signingMethod, v.JWTValidators...)
-	} else {
-		err = jwsToken.Verify(pair.Public(), signingMethod)
+	err = v.verify(jwsToken, pair, signingMethod)
+	if err != nil {
+		// the key may have been rotated since it was cached, so try once more with a refreshed key
+		if refresher, ok := v.Resolver.(key.Refresher); ok {
+			if refreshed, refreshErr := refresher.RefreshKey(keyId); refreshErr == nil && refreshed != pair {
+				err = v.verify(jwsToken, refreshed, signingMethod)
+			}
+		}
 	}
 
 	if nil != err {
@@ -140,7 +220,8 @@ func (v JWSValidator) Validate(ctx context.Context, token *Token) (valid bool, e
 	}
 
 	// validate jwt token claims capabilities
-	if caps, capOkay := jwsToken.Payload().(jws.Claims).Get("capabilities").([]interface{}); capOkay && len(caps) > 0 {
+	claims, _ := jwsToken.Payload().(jws.Claims)
+	if caps, capOkay := claims.Get(CapabilitiesClaim).([]interface{}); capOkay && len(caps) > 0 {
 	
 /*  commenting out for now
     1. remove code in use below
@@ -157,6 +238,7 @@ func (v JWSValidator) Validate(ctx context.Context, token *Token) (valid bool, e
 */
 		// *****  REMOVE THIS CODE AFTER BRING BACK THE COMMENTED CODE ABOVE *****
 		// ***** vvvvvvvvvvvvvvv *****
+		token.claims = claims
 		return true, nil
 		// ***** ^^^^^^^^^^^^^^^ *****
 		
@@ -166,11 +248,72 @@ func (v JWSValidator) Validate(ctx context.Context, token *Token) (valid bool, e
 	return
 }
 
+// ClaimEnforcement determines how a time-based claim, i.e. exp, nbf, or iat, is checked by the
+// jwt.Validator instances created by a JWTValidatorFactory
+type ClaimEnforcement string
+
+const (
+	// ClaimOptional checks a claim only when it is present.  This is the default for exp and nbf.
+	ClaimOptional ClaimEnforcement = "optional"
+
+	// ClaimRequired rejects tokens which do not carry a valid claim
+	ClaimRequired ClaimEnforcement = "required"
+
+	// ClaimIgnored never checks a claim.  This is the default for iat.
+	ClaimIgnored ClaimEnforcement = "ignored"
+)
+
+const (
+	// unboundedLeeway is the EXP and NBF leeway of the jwt.Validator instances created by a JWTValidatorFactory.
+	// The SermoDigital library always checks exp and nbf against the system clock, using these leeways, after
+	// a validator's Fn.  An unbounded leeway disables that check, leaving the exp and nbf claims to the
+	// factory's own time checks.
+	unboundedLeeway time.Duration = math.MaxInt64
+)
+
+var (
+	ErrorMissingExpClaim = errors.New("Missing exp claim")
+	ErrorMissingNbfClaim = errors.New("Missing nbf claim")
+	ErrorMissingIatClaim = errors.New("Missing iat claim")
+)
+
+// enforcement returns the effective ClaimEnforcement for a configured value.  Unrecognized values
+// are treated as ClaimRequired, so that a misconfiguration never weakens validation.
+func (ce ClaimEnforcement) enforcement(defaultValue ClaimEnforcement) ClaimEnforcement {
+	switch ClaimEnforcement(strings.ToLower(string(ce))) {
+	case "":
+		return defaultValue
+	case ClaimOptional:
+		return ClaimOptional
+	case ClaimIgnored:
+		return ClaimIgnored
+	default:
+		return ClaimRequired
+	}
+}
+
 // JWTValidatorFactory is a configurable factory for *jwt.Validator instances
 type JWTValidatorFactory struct {
 	Expected  jwt.Claims `json:"expected"`
 	ExpLeeway int        `json:"expLeeway"`
 	NbfLeeway int        `json:"nbfLeeway"`
+
+	// Skew is the clock skew, in seconds, tolerated between token issuers and this server.  It applies to
+	// each of the exp, nbf, and iat claims, in addition to ExpLeeway and NbfLeeway.
+	Skew int `json:"skew"`
+
+	// ExpEnforcement determines how the exp claim is checked.  If not supplied, ClaimOptional is used.
+	ExpEnforcement ClaimEnforcement `json:"expEnforcement"`
+
+	// NbfEnforcement determines how the nbf claim is checked.  If not supplied, ClaimOptional is used.
+	NbfEnforcement ClaimEnforcement `json:"nbfEnforcement"`
+
+	// IatEnforcement determines how the iat claim is checked.  A token is rejected if it was issued in
+	// the future, allowing for Skew.  If not supplied, ClaimIgnored is used.
+	IatEnforcement ClaimEnforcement `json:"iatEnforcement"`
+
+	// NowFunc is the source of the current time used to check claims.  If not supplied, time.Now is used.
+	NowFunc func() time.Time `json:"-"`
 }
 
 func (f *JWTValidatorFactory) expLeeway() time.Duration {
@@ -189,20 +332,83 @@ func (f *JWTValidatorFactory) nbfLeeway() time.Duration {
 	return 0
 }
 
+func (f *JWTValidatorFactory) skew() time.Duration {
+	if f.Skew > 0 {
+		return time.Duration(f.Skew) * time.Second
+	}
+
+	return 0
+}
+
+func (f *JWTValidatorFactory) now() func() time.Time {
+	if f.NowFunc != nil {
+		return f.NowFunc
+	}
+
+	return time.Now
+}
+
+// timeValidator returns the function which checks the exp, nbf, and iat claims of tokens
+func (f *JWTValidatorFactory) timeValidator(expLeeway, nbfLeeway time.Duration) jwt.ValidateFunc {
+	var (
+		now            = f.now()
+		skew           = f.skew()
+		expEnforcement = f.ExpEnforcement.enforcement(ClaimOptional)
+		nbfEnforcement = f.NbfEnforcement.enforcement(ClaimOptional)
+		iatEnforcement = f.IatEnforcement.enforcement(ClaimIgnored)
+	)
+
+	return func(claims jwt.Claims) error {
+		current := now()
+
+		if expEnforcement != ClaimIgnored {
+			if exp, ok := claims.Expiration(); ok {
+				if current.After(exp.Add(expLeeway)) {
+					return jwt.ErrTokenIsExpired
+				}
+			} else if expEnforcement == ClaimRequired {
+				return ErrorMissingExpClaim
+			}
+		}
+
+		if nbfEnforcement != ClaimIgnored {
+			if nbf, ok := claims.NotBefore(); ok {
+				if !current.After(nbf.Add(-nbfLeeway)) {
+					return jwt.ErrTokenNotYetValid
+				}
+			} else if nbfEnforcement == ClaimRequired {
+				return ErrorMissingNbfClaim
+			}
+		}
+
+		if iatEnforcement != ClaimIgnored {
+			if iat, ok := claims.IssuedAt(); ok {
+				if iat.After(current.Add(skew)) {
+					return jwt.ErrInvalidIATClaim
+				}
+			} else if iatEnforcement == ClaimRequired {
+				return ErrorMissingIatClaim
+			}
+		}
+
+		return nil
+	}
+}
+
 // New returns a jwt.Validator using the configuration expected claims (if any)
-// and a validator function that checks the exp and nbf claims.
-//
-// The SermoDigital library doesn't appear to do anything with the EXP and NBF
-// members of jwt.Validator, but this Factory Method populates them anyway.
+// and a validator function that checks the exp, nbf, and iat claims as configured.
+// The time checks are made only by the validator function, so the returned jwt.Validator
+// has unbounded EXP and NBF leeways.
 func (f *JWTValidatorFactory) New(custom ...jwt.ValidateFunc) *jwt.Validator {
-	expLeeway := f.expLeeway()
-	nbfLeeway := f.nbfLeeway()
+	expLeeway := f.expLeeway() + f.skew()
+	nbfLeeway := f.nbfLeeway() + f.skew()
 
 	var validateFunc jwt.ValidateFunc
+	timeValidator := f.timeValidator(expLeeway, nbfLeeway)
 	customCount := len(custom)
 	if customCount > 0 {
 		validateFunc = func(claims jwt.Claims) (err error) {
-			err = claims.Validate(time.Now(), expLeeway, nbfLeeway)
+			err = timeValidator(claims)
 			for index := 0; index < customCount && err == nil; index++ {
 				err = custom[index](claims)
 			}
@@ -210,16 +416,14 @@ func (f *JWTValidatorFactory) New(custom ...jwt.ValidateFunc) *jwt.Validator {
 			return
 		}
 	} else {
-		// if no custom validate functions were passed, use a simpler function
-		validateFunc = func(claims jwt.Claims) error {
-			return claims.Validate(time.Now(), expLeeway, nbfLeeway)
-		}
+		// if no custom validate functions were passed, the time checks are all that's needed
+		validateFunc = timeValidator
 	}
 
 	return &jwt.Validator{
 		Expected: f.Expected,
-		EXP:      expLeeway,
-		NBF:      nbfLeeway,
+		EXP:      unboundedLeeway,
+		NBF:      unboundedLeeway,
 		Fn:       validateFunc,
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/Comcast/webpa-common/secure/key"
 	"github.com/SermoDigital/jose"
+	"github.com/SermoDigital/jose/crypto"
 	"github.com/SermoDigital/jose/jws"
 	"github.com/SermoDigital/jose/jwt"
 	"github.com/stretchr/testify/assert"
@@ -102,6 +103,108 @@ func TestValidators(t *testing.T) {
 	}
 }
 
+func TestValidatorsCancelled(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		ctx, cancel = context.WithCancel(context.Background())
+		token       = &Token{}
+		first       = &MockValidator{}
+		second      = &MockValidator{}
+	)
+
+	first.On("Validate", ctx, token).Run(func(mock.Arguments) { cancel() }).Return(false, nil).Once()
+
+	valid, err := Validators{first, second}.Validate(ctx, token)
+	assert.False(valid)
+	assert.Equal(context.Canceled, err)
+	first.AssertExpectations(t)
+	second.AssertExpectations(t)
+}
+
+func TestConcurrentValidatorsEmpty(t *testing.T) {
+	assert := assert.New(t)
+	valid, err := ConcurrentValidators{}.Validate(nil, &Token{})
+	assert.False(valid)
+	assert.NoError(err)
+}
+
+func TestConcurrentValidators(t *testing.T) {
+	assert := assert.New(t)
+	var testData = [][]bool{
+		[]bool{true},
+		[]bool{false},
+		[]bool{true, false},
+		[]bool{false, true},
+		[]bool{false, false},
+		[]bool{false, true, false},
+		[]bool{false, false, true},
+	}
+
+	for _, record := range testData {
+		t.Logf("%v", record)
+		var (
+			token         = &Token{tokenType: Bearer, value: "abc"}
+			validators    = make(ConcurrentValidators, 0, len(record))
+			expectedValid bool
+			expectedError error
+		)
+
+		for index, success := range record {
+			var err error
+			if !success {
+				err = fmt.Errorf("expected validator error #%d", index)
+			}
+
+			expectedValid = expectedValid || success
+			if !expectedValid {
+				expectedError = err
+			} else {
+				expectedError = nil
+			}
+
+			validators = append(validators, ValidatorFunc(func(ctx context.Context, copy *Token) (bool, error) {
+				assert.NotNil(ctx)
+				assert.Equal(token.Value(), copy.Value())
+				return success, err
+			}))
+		}
+
+		valid, err := validators.Validate(nil, token)
+		assert.Equal(expectedValid, valid)
+		assert.Equal(expectedError, err)
+	}
+}
+
+func TestConcurrentValidatorsShortCircuit(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		token     = &Token{tokenType: Bearer, value: "abc"}
+		cancelled = make(chan struct{})
+
+		slow = ValidatorFunc(func(ctx context.Context, token *Token) (bool, error) {
+			<-ctx.Done()
+			close(cancelled)
+			return false, ctx.Err()
+		})
+
+		fast = ValidatorFunc(func(ctx context.Context, token *Token) (bool, error) {
+			token.claims = jws.Claims{"sub": "fast"}
+			return true, nil
+		})
+	)
+
+	valid, err := ConcurrentValidators{slow, fast}.Validate(context.Background(), token)
+	assert.True(valid)
+	assert.NoError(err)
+	assert.Equal(jws.Claims{"sub": "fast"}, token.Claims())
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		assert.Fail("The slow validator was not cancelled")
+	}
+}
+
 func TestExactMatchValidator(t *testing.T) {
 	assert := assert.New(t)
 
@@ -510,6 +613,11 @@ func TestJWSValidatorVerify(t *testing.T) {
 		valid, err := validator.Validate(ctx, token)
 		assert.Equal(record.expectedValid, valid)
 		assert.Equal(record.expectedVerifyError, err)
+		if record.expectedValid {
+			assert.Equal(testClaims, token.Claims())
+		} else {
+			assert.Nil(token.Claims())
+		}
 
 		mockPair.AssertExpectations(t)
 		mockResolver.AssertExpectations(t)
@@ -518,6 +626,77 @@ func TestJWSValidatorVerify(t *testing.T) {
 	}
 }
 
+func TestJWSValidatorRefresh(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		verifyError   = errors.New("expected Verify error")
+		refreshError  = errors.New("expected RefreshKey error")
+		signingMethod = jws.GetSigningMethod("RS256")
+	)
+
+	var testData = []struct {
+		rotated       bool
+		refreshError  error
+		expectedValid bool
+	}{
+		{true, nil, true},
+		{false, nil, false},
+		{true, refreshError, false},
+	}
+
+	for _, record := range testData {
+		t.Logf("%v", record)
+		token := &Token{tokenType: Bearer, value: "does not matter"}
+
+		cachedPair := &key.MockPair{}
+		cachedPair.On("Public").Return(interface{}("cached")).Once()
+
+		refreshedPair := cachedPair
+		if record.rotated {
+			refreshedPair = &key.MockPair{}
+		}
+
+		mockRefresher := &key.MockRefresher{}
+		mockRefresher.On("ResolveKey", "rotated").Return(cachedPair, nil).Once()
+		if record.refreshError != nil {
+			mockRefresher.On("RefreshKey", "rotated").Return(nil, record.refreshError).Once()
+		} else {
+			mockRefresher.On("RefreshKey", "rotated").Return(refreshedPair, nil).Once()
+		}
+
+		mockJWS := &mockJWS{}
+		mockJWS.On("Protected").Return(jose.Protected{"alg": "RS256", "kid": "rotated"}).Once()
+		mockJWS.On("Verify", interface{}("cached"), signingMethod).Return(verifyError).Once()
+		if record.rotated && record.refreshError == nil {
+			refreshedPair.On("Public").Return(interface{}("refreshed")).Once()
+			mockJWS.On("Verify", interface{}("refreshed"), signingMethod).Return(nil).Once()
+			mockJWS.On("Payload").Return(testClaims).Once()
+		}
+
+		mockJWSParser := &mockJWSParser{}
+		mockJWSParser.On("ParseJWS", token).Return(mockJWS, nil).Once()
+
+		validator := &JWSValidator{
+			Resolver: mockRefresher,
+			Parser:   mockJWSParser,
+		}
+
+		valid, err := validator.Validate(context.Background(), token)
+		assert.Equal(record.expectedValid, valid)
+		if record.expectedValid {
+			assert.NoError(err)
+		} else {
+			assert.Equal(verifyError, err)
+		}
+
+		cachedPair.AssertExpectations(t)
+		refreshedPair.AssertExpectations(t)
+		mockRefresher.AssertExpectations(t)
+		mockJWS.AssertExpectations(t)
+		mockJWSParser.AssertExpectations(t)
+	}
+}
+
 func TestJWSValidatorValidate(t *testing.T) {
 	assert := assert.New(t)
 
@@ -701,3 +880,196 @@ func TestJWTValidatorFactory(t *testing.T) {
 		}
 	}
 }
+
+func TestClaimEnforcement(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(ClaimOptional, ClaimEnforcement("").enforcement(ClaimOptional))
+	assert.Equal(ClaimIgnored, ClaimEnforcement("").enforcement(ClaimIgnored))
+	assert.Equal(ClaimOptional, ClaimOptional.enforcement(ClaimIgnored))
+	assert.Equal(ClaimRequired, ClaimRequired.enforcement(ClaimOptional))
+	assert.Equal(ClaimIgnored, ClaimEnforcement("IGNORED").enforcement(ClaimOptional))
+
+	// misconfigurations fail closed
+	assert.Equal(ClaimRequired, ClaimEnforcement("nonsense").enforcement(ClaimIgnored))
+}
+
+func TestJWTValidatorFactoryTimeClaims(t *testing.T) {
+	var (
+		now     = time.Unix(1500000000, 0)
+		nowFunc = func() time.Time { return now }
+
+		testData = []struct {
+			claims   jwt.Claims
+			factory  JWTValidatorFactory
+			expected error
+		}{
+			{
+				claims:   jwt.Claims{"exp": now.Unix() - 10},
+				factory:  JWTValidatorFactory{NowFunc: nowFunc},
+				expected: jwt.ErrTokenIsExpired,
+			},
+			{
+				claims:  jwt.Claims{"exp": now.Unix() - 10},
+				factory: JWTValidatorFactory{NowFunc: nowFunc, Skew: 30},
+			},
+			{
+				claims:   jwt.Claims{"exp": now.Unix() - 40},
+				factory:  JWTValidatorFactory{NowFunc: nowFunc, Skew: 30},
+				expected: jwt.ErrTokenIsExpired,
+			},
+			{
+				claims:  jwt.Claims{"exp": now.Unix() - 40},
+				factory: JWTValidatorFactory{NowFunc: nowFunc, Skew: 30, ExpLeeway: 30},
+			},
+			{
+				claims:  jwt.Claims{"exp": now.Unix() - 3600},
+				factory: JWTValidatorFactory{NowFunc: nowFunc, ExpEnforcement: ClaimIgnored},
+			},
+			{
+				claims:   jwt.Claims{},
+				factory:  JWTValidatorFactory{NowFunc: nowFunc, ExpEnforcement: ClaimRequired},
+				expected: ErrorMissingExpClaim,
+			},
+			{
+				claims:   jwt.Claims{"nbf": now.Unix() + 10},
+				factory:  JWTValidatorFactory{NowFunc: nowFunc},
+				expected: jwt.ErrTokenNotYetValid,
+			},
+			{
+				claims:  jwt.Claims{"nbf": now.Unix() + 10},
+				factory: JWTValidatorFactory{NowFunc: nowFunc, Skew: 30},
+			},
+			{
+				claims:  jwt.Claims{"nbf": now.Unix() + 3600},
+				factory: JWTValidatorFactory{NowFunc: nowFunc, NbfEnforcement: ClaimIgnored},
+			},
+			{
+				claims:   jwt.Claims{"exp": now.Unix() + 3600},
+				factory:  JWTValidatorFactory{NowFunc: nowFunc, NbfEnforcement: ClaimRequired},
+				expected: ErrorMissingNbfClaim,
+			},
+			{
+				claims:  jwt.Claims{"iat": now.Unix() + 3600},
+				factory: JWTValidatorFactory{NowFunc: nowFunc},
+			},
+			{
+				claims:   jwt.Claims{"iat": now.Unix() + 10},
+				factory:  JWTValidatorFactory{NowFunc: nowFunc, IatEnforcement: ClaimOptional},
+				expected: jwt.ErrInvalidIATClaim,
+			},
+			{
+				claims:  jwt.Claims{"iat": now.Unix() + 10},
+				factory: JWTValidatorFactory{NowFunc: nowFunc, IatEnforcement: ClaimOptional, Skew: 30},
+			},
+			{
+				claims:  jwt.Claims{"iat": now.Unix() - 10},
+				factory: JWTValidatorFactory{NowFunc: nowFunc, IatEnforcement: ClaimRequired},
+			},
+			{
+				claims:   jwt.Claims{},
+				factory:  JWTValidatorFactory{NowFunc: nowFunc, IatEnforcement: ClaimRequired},
+				expected: ErrorMissingIatClaim,
+			},
+			{
+				claims: jwt.Claims{"exp": now.Unix() + 60, "nbf": now.Unix() - 60, "iat": now.Unix() - 60},
+				factory: JWTValidatorFactory{
+					NowFunc:        nowFunc,
+					ExpEnforcement: ClaimRequired,
+					NbfEnforcement: ClaimRequired,
+					IatEnforcement: ClaimRequired,
+				},
+			},
+		}
+	)
+
+	for i, record := range testData {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			var (
+				assert    = assert.New(t)
+				validator = record.factory.New()
+				mockJWS   = &mockJWS{}
+			)
+
+			if !assert.NotNil(validator) {
+				return
+			}
+
+			assert.Equal(unboundedLeeway, validator.EXP)
+			assert.Equal(unboundedLeeway, validator.NBF)
+
+			mockJWS.On("Claims").Return(record.claims).Once()
+			assert.Equal(record.expected, validator.Validate(mockJWS))
+			mockJWS.AssertExpectations(t)
+		})
+	}
+}
+
+func TestJWSValidatorTimeClaims(t *testing.T) {
+	pair, err := privateKeyResolver.ResolveKey("")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var (
+		now      = time.Now()
+		testData = []struct {
+			claims   jws.Claims
+			factory  JWTValidatorFactory
+			expected error
+		}{
+			{
+				claims:  jws.Claims{"exp": now.Unix() - 3600},
+				factory: JWTValidatorFactory{ExpEnforcement: ClaimIgnored},
+			},
+			{
+				claims:  jws.Claims{"nbf": now.Unix() + 3600},
+				factory: JWTValidatorFactory{NbfEnforcement: ClaimIgnored},
+			},
+			{
+				claims:  jws.Claims{"exp": now.Unix() - 3600},
+				factory: JWTValidatorFactory{NowFunc: func() time.Time { return now.Add(-2 * time.Hour) }},
+			},
+			{
+				claims:   jws.Claims{"exp": now.Unix() + 3600},
+				factory:  JWTValidatorFactory{NowFunc: func() time.Time { return now.Add(2 * time.Hour) }},
+				expected: jwt.ErrTokenIsExpired,
+			},
+			{
+				claims:   jws.Claims{"nbf": now.Unix() - 3600},
+				factory:  JWTValidatorFactory{NowFunc: func() time.Time { return now.Add(-2 * time.Hour) }},
+				expected: jwt.ErrTokenNotYetValid,
+			},
+		}
+	)
+
+	for i, record := range testData {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert := assert.New(t)
+
+			claims := jws.Claims{"capabilities": []interface{}{"x1:webpa:api:.*:all"}}
+			for k, v := range record.claims {
+				claims.Set(k, v)
+			}
+
+			serialized, err := jws.NewJWT(claims, crypto.SigningMethodRS256).Serialize(pair.Private())
+			if !assert.NoError(err) {
+				return
+			}
+
+			validator := JWSValidator{
+				Resolver:      publicKeyResolver,
+				JWTValidators: []*jwt.Validator{record.factory.New()},
+			}
+
+			valid, err := validator.Validate(context.Background(), &Token{tokenType: Bearer, value: string(serialized)})
+			if record.expected != nil {
+				assert.False(valid)
+				assert.Equal(record.expected, err)
+			} else {
+				assert.True(valid)
+				assert.NoError(err)
+			}
+		})
+	}
+}
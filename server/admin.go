@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// AdminPath is the path prefix under which an AdminRouter mounts its endpoints
+	AdminPath = "/admin"
+
+	// adminIndexEndpoint and adminUnknownEndpoint label requests for the endpoint list and
+	// for paths with no endpoint
+	adminIndexEndpoint   = "index"
+	adminUnknownEndpoint = "unknown"
+)
+
+var (
+	ErrorAdminAuthorizationRequired = errors.New("The admin API requires authorization")
+	ErrorAdminEndpointName          = errors.New("Admin endpoint names must be nonempty and must not begin or end with a slash")
+	ErrorAdminEndpointExists        = errors.New("That admin endpoint already exists")
+)
+
+// adminAuditKey is the Context key of the adminAudit for an admin request
+type adminAuditKey struct{}
+
+// adminAudit holds what is known about an admin request for its audit log entry
+type adminAudit struct {
+	endpoint string
+	subject  string
+}
+
+// adminResponseWriter records the status code written for an admin request
+type adminResponseWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *adminResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *adminResponseWriter) Write(data []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+// adminIndex is the JSON body describing the endpoints of an AdminRouter
+type adminIndex struct {
+	Endpoints []string `json:"endpoints"`
+}
+
+// AdminRouter serves the control endpoints of an application, such as log levels, drain, and maintenance
+// mode, under AdminPath.  Other packages contribute endpoints via Handle, each of which is mounted at
+// AdminPath + "/" + name, e.g. /admin/logging/level.  A GET of AdminPath itself lists the endpoints.
+//
+// Every request, including requests for unknown endpoints, must pass the router's authorization, which is
+// mandatory.  Every request is also written to the audit log, with the subject of the authorizing token when
+// one is available, and counted in the metrics declared by Metrics.
+type AdminRouter struct {
+	logger   logging.Logger
+	requests metrics.Counter
+	handler  http.Handler
+
+	lock      sync.RWMutex
+	endpoints map[string]http.Handler
+}
+
+// NewAdminRouter creates an AdminRouter.  The authorization decorator is required, and would typically be
+// the Decorate method of a secure/handler.AuthorizationHandler.  The metrics provider is optional.
+func NewAdminRouter(logger logging.Logger, authorization func(http.Handler) http.Handler, p xmetrics.Provider) (*AdminRouter, error) {
+	if authorization == nil {
+		return nil, ErrorAdminAuthorizationRequired
+	}
+
+	if p == nil {
+		p = xmetrics.NewDiscardProvider()
+	}
+
+	a := &AdminRouter{
+		logger:    logger,
+		requests:  p.NewCounter(AdminRequestCounter),
+		endpoints: make(map[string]http.Handler),
+	}
+
+	a.handler = authorization(http.HandlerFunc(a.dispatch))
+	return a, nil
+}
+
+// Handle mounts an endpoint at AdminPath + "/" + name.  The name may contain slashes, e.g. "logging/level",
+// and the endpoint receives the request with its full path.
+func (a *AdminRouter) Handle(name string, handler http.Handler) error {
+	if len(name) == 0 || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") {
+		return ErrorAdminEndpointName
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if _, ok := a.endpoints[name]; ok {
+		return ErrorAdminEndpointExists
+	}
+
+	a.endpoints[name] = handler
+	return nil
+}
+
+// Names returns the sorted names of the mounted endpoints
+func (a *AdminRouter) Names() []string {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	names := make([]string, 0, len(a.endpoints))
+	for name := range a.endpoints {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// route finds the endpoint for a request path, preferring the longest matching name
+func (a *AdminRouter) route(path string) (string, http.Handler) {
+	if path == AdminPath || path == AdminPath+"/" {
+		return adminIndexEndpoint, nil
+	}
+
+	if !strings.HasPrefix(path, AdminPath+"/") {
+		return adminUnknownEndpoint, nil
+	}
+
+	var (
+		rest    = strings.TrimPrefix(path, AdminPath+"/")
+		name    = adminUnknownEndpoint
+		handler http.Handler
+	)
+
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	for candidate, candidateHandler := range a.endpoints {
+		if (rest == candidate || strings.HasPrefix(rest, candidate+"/")) && (handler == nil || len(candidate) > len(name)) {
+			name = candidate
+			handler = candidateHandler
+		}
+	}
+
+	return name, handler
+}
+
+// dispatch serves a request which has passed authorization
+func (a *AdminRouter) dispatch(response http.ResponseWriter, request *http.Request) {
+	audit, _ := request.Context().Value(adminAuditKey{}).(*adminAudit)
+	if claims, ok := secure.GetClaims(request.Context()); ok && audit != nil {
+		audit.subject, _ = claims.Get("sub").(string)
+	}
+
+	name, handler := a.route(request.URL.Path)
+	switch {
+	case handler != nil:
+		handler.ServeHTTP(response, request)
+
+	case name == adminIndexEndpoint && request.Method == http.MethodGet:
+		response.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(response).Encode(adminIndex{Endpoints: a.Names()})
+
+	case name == adminIndexEndpoint:
+		response.Header().Set("Allow", http.MethodGet)
+		response.WriteHeader(http.StatusMethodNotAllowed)
+
+	default:
+		http.NotFound(response, request)
+	}
+}
+
+func (a *AdminRouter) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	var (
+		start    = time.Now()
+		name, _  = a.route(request.URL.Path)
+		audit    = &adminAudit{endpoint: name}
+		recorder = &adminResponseWriter{ResponseWriter: response}
+	)
+
+	a.handler.ServeHTTP(recorder, request.WithContext(context.WithValue(request.Context(), adminAuditKey{}, audit)))
+	if recorder.code == 0 {
+		recorder.code = http.StatusOK
+	}
+
+	a.requests.With(EndpointLabel, audit.endpoint, CodeLabel, strconv.Itoa(recorder.code)).Add(1)
+	a.logger.Info(
+		"Admin request: method=%s path=%s endpoint=%s remoteAddr=%s subject=%s code=%d duration=%s",
+		request.Method,
+		request.URL.Path,
+		audit.endpoint,
+		request.RemoteAddr,
+		audit.subject,
+		recorder.code,
+		time.Since(start),
+	)
+}
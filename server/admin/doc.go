@@ -0,0 +1,8 @@
+/*
+Package admin provides the standard operational endpoints of a WebPA application, such as device
+statistics, the device gate, the webhook registry, pool metrics, and pprof.  The endpoints are mounted
+on a server.AdminRouter, usually by assigning the result of Endpoints to WebPA.AdminEndpoints, so that
+they share the router's authorization, auditing, and metrics.  Setting WebPA.Admin serves all of them on
+a dedicated port.
+*/
+package admin
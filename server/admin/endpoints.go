@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/Comcast/webpa-common/device"
+	"github.com/Comcast/webpa-common/httppool"
+	"github.com/Comcast/webpa-common/server"
+	"github.com/Comcast/webpa-common/webhook"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DevicesEndpoint is the name of the endpoint which pages through the connected devices
+	DevicesEndpoint = "devices"
+
+	// DeviceStatsEndpoint is the name of the endpoint which summarizes the connected devices
+	DeviceStatsEndpoint = "devices/stats"
+
+	// GateEndpoint is the name of the endpoint which opens and closes the device gate
+	GateEndpoint = "devices/gate"
+
+	// WebhooksEndpoint is the name of the endpoint which dumps the webhook registry
+	WebhooksEndpoint = "webhooks"
+
+	// PoolsEndpoint is the name of the endpoint which serves the metrics of HTTP dispatcher pools
+	PoolsEndpoint = "pools"
+
+	// PprofEndpoint is the name of the endpoint which serves the runtime profiles of net/http/pprof
+	PprofEndpoint = "pprof"
+)
+
+// Options describes the components controlled by the standard admin endpoints.  An endpoint is only
+// mounted when the component it needs is supplied.  Drain, log level, and maintenance endpoints are
+// always provided by server.WebPA itself.
+type Options struct {
+	// Devices is the device registry, usually a device.Manager, described by DevicesEndpoint and DeviceStatsEndpoint.
+	// DevicesEndpoint is only mounted if the registry also implements device.Enumerator.
+	Devices device.Registry
+
+	// Churn is the optional tracker of recent device activity included by DeviceStatsEndpoint
+	Churn *device.Churn
+
+	// Gate is the device admission gate controlled by GateEndpoint
+	Gate *device.Gate
+
+	// Webhooks is the webhook registry dumped by WebhooksEndpoint
+	Webhooks webhook.List
+
+	// Metrics is the source of the pool metrics served by PoolsEndpoint, usually an xmetrics.Registry's Gatherer
+	Metrics prometheus.Gatherer
+
+	// Pprof enables PprofEndpoint
+	Pprof bool
+}
+
+// Endpoints returns the standard admin endpoints, keyed by name, for the configured components.  The returned
+// map is suitable for server.WebPA.AdminEndpoints and may be extended with application-specific endpoints.
+func Endpoints(o *Options) map[string]http.Handler {
+	endpoints := make(map[string]http.Handler)
+	if o == nil {
+		return endpoints
+	}
+
+	if o.Devices != nil {
+		if enumerator, ok := o.Devices.(device.Enumerator); ok {
+			endpoints[DevicesEndpoint] = &device.DevicesHandler{Enumerator: enumerator}
+		}
+
+		endpoints[DeviceStatsEndpoint] = &DeviceStatsHandler{Registry: o.Devices, Churn: o.Churn}
+	}
+
+	if o.Gate != nil {
+		endpoints[GateEndpoint] = &device.GateHandler{Gate: o.Gate}
+	}
+
+	if o.Webhooks != nil {
+		endpoints[WebhooksEndpoint] = &WebhooksHandler{List: o.Webhooks}
+	}
+
+	if o.Metrics != nil {
+		endpoints[PoolsEndpoint] = NewMetricsHandler(o.Metrics, xmetrics.Module(httppool.Metrics))
+	}
+
+	if o.Pprof {
+		endpoints[PprofEndpoint] = NewPprofHandler(server.AdminPath + "/" + PprofEndpoint)
+	}
+
+	return endpoints
+}
@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/Comcast/webpa-common/device"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointsNoComponents(t *testing.T) {
+	assert := assert.New(t)
+	assert.Empty(Endpoints(nil))
+	assert.Empty(Endpoints(new(Options)))
+}
+
+func TestEndpoints(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		options = &device.Options{Logger: &logging.LoggerWriter{Writer: ioutil.Discard}}
+
+		endpoints = Endpoints(&Options{
+			Devices:  device.NewManager(options, nil),
+			Gate:     device.NewGate(nil),
+			Webhooks: webhook.NewList(nil),
+			Metrics:  prometheus.NewRegistry(),
+			Pprof:    true,
+		})
+
+		names []string
+	)
+
+	for name, handler := range endpoints {
+		assert.NotNil(handler)
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	assert.Equal(
+		[]string{DevicesEndpoint, GateEndpoint, DeviceStatsEndpoint, PoolsEndpoint, PprofEndpoint, WebhooksEndpoint},
+		names,
+	)
+}
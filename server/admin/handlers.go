@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Comcast/webpa-common/device"
+	"github.com/Comcast/webpa-common/httperror"
+	"github.com/Comcast/webpa-common/webhook"
+)
+
+// RedactedSecret replaces the secrets of webhooks dumped by WebhooksHandler
+const RedactedSecret = webhook.RedactedSecret
+
+// DeviceStats is the JSON summary of the connected devices served by DeviceStatsHandler
+type DeviceStats struct {
+	Connected        int    `json:"connected"`
+	BytesSent        uint64 `json:"bytesSent"`
+	MessagesSent     uint64 `json:"messagesSent"`
+	BytesReceived    uint64 `json:"bytesReceived"`
+	MessagesReceived uint64 `json:"messagesReceived"`
+
+	// Churn is the recent activity within each sliding window, present only when a device.Churn is configured
+	Churn []device.ChurnStats `json:"churn,omitempty"`
+}
+
+// DeviceStatsHandler summarizes the statistics of every connected device.  Since every device is visited,
+// this handler is intended for occasional operational use rather than for monitoring.  The churn
+// gauges of a device.Churn are better suited to monitoring.
+type DeviceStatsHandler struct {
+	Registry device.Registry
+
+	// Churn is the optional tracker of recent device activity included in the summary
+	Churn *device.Churn
+}
+
+func (dsh *DeviceStatsHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	var stats DeviceStats
+	stats.Connected = dsh.Registry.VisitAll(func(d device.Interface) {
+		s := d.Statistics()
+		stats.BytesSent += uint64(s.BytesSent())
+		stats.MessagesSent += uint64(s.MessagesSent())
+		stats.BytesReceived += uint64(s.BytesReceived())
+		stats.MessagesReceived += uint64(s.MessagesReceived())
+	})
+
+	if dsh.Churn != nil {
+		stats.Churn = dsh.Churn.Stats()
+	}
+
+	writeJSON(response, stats)
+}
+
+// WebhooksHandler dumps the webhooks currently known to a registry as a JSON array.  The secret of each
+// webhook is replaced with RedactedSecret.
+type WebhooksHandler struct {
+	List webhook.List
+}
+
+func (wh *WebhooksHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	hooks := make([]webhook.W, 0, wh.List.Len())
+	for i := 0; i < wh.List.Len(); i++ {
+		if w := wh.List.Get(i); w != nil {
+			hook := *w
+			if len(hook.Config.Secret) > 0 {
+				hook.Config.Secret = RedactedSecret
+			}
+
+			hooks = append(hooks, hook)
+		}
+	}
+
+	writeJSON(response, hooks)
+}
+
+// writeJSON writes the JSON representation of a value as the response
+func writeJSON(response http.ResponseWriter, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		httperror.Format(response, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(data)
+}
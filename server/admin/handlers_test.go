@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/device"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceStatsHandler(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		options = &device.Options{Logger: &logging.LoggerWriter{Writer: ioutil.Discard}}
+
+		handler  = &DeviceStatsHandler{Registry: device.NewManager(options, nil)}
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal("application/json", response.HeaderMap.Get("Content-Type"))
+
+	var stats DeviceStats
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &stats))
+	assert.Equal(DeviceStats{}, stats)
+}
+
+func TestDeviceStatsHandlerChurn(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		options = &device.Options{Logger: &logging.LoggerWriter{Writer: ioutil.Discard}}
+		churn   = device.NewChurn(&device.ChurnOptions{Windows: []time.Duration{time.Minute}})
+
+		handler  = &DeviceStatsHandler{Registry: device.NewManager(options, nil), Churn: churn}
+		response = httptest.NewRecorder()
+	)
+
+	churn.OnDeviceEvent(&device.Event{Type: device.Connect})
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusOK, response.Code)
+
+	var stats DeviceStats
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &stats))
+	require.Len(stats.Churn, 1)
+	assert.Equal("1m", stats.Churn[0].Window)
+	assert.Equal(1, stats.Churn[0].Connects)
+	assert.True(stats.Churn[0].ConnectRate > 0)
+}
+
+func TestWebhooksHandler(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		hooks = []webhook.W{
+			{Events: []string{"iot"}, Until: time.Now().Add(time.Hour)},
+			{Events: []string{"device-status"}, Until: time.Now().Add(time.Hour)},
+		}
+
+		response = httptest.NewRecorder()
+	)
+
+	hooks[0].Config.URL = "http://first.example.com"
+	hooks[0].Config.Secret = "this is a secret"
+	hooks[1].Config.URL = "http://second.example.com"
+
+	handler := &WebhooksHandler{List: webhook.NewList(hooks)}
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal("application/json", response.HeaderMap.Get("Content-Type"))
+	assert.NotContains(response.Body.String(), "this is a secret")
+
+	var actual []webhook.W
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &actual))
+	require.Len(actual, 2)
+	assert.Equal("http://first.example.com", actual[0].Config.URL)
+	assert.Equal(RedactedSecret, actual[0].Config.Secret)
+	assert.Equal("http://second.example.com", actual[1].Config.URL)
+	assert.Empty(actual[1].Config.Secret)
+
+	// the registry itself retains the secret
+	assert.Equal("this is a secret", handler.List.Get(0).Config.Secret)
+}
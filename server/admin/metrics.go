@@ -0,0 +1,57 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// NewMetricsHandler returns a handler which serves, in the Prometheus exposition format, the metrics gathered by g
+// that are declared by the given modules.  Metrics match regardless of any namespace or subsystem prefix, so that
+// e.g. httppool.Metrics selects "webpa_talaria_httppool_queue_depth".
+func NewMetricsHandler(g prometheus.Gatherer, modules ...xmetrics.Module) http.Handler {
+	var names []string
+	for _, m := range modules {
+		for _, metric := range m() {
+			names = append(names, metric.Name)
+		}
+	}
+
+	return promhttp.HandlerFor(
+		prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			families, err := g.Gather()
+			selected := make([]*dto.MetricFamily, 0, len(families))
+			for _, family := range families {
+				if declared(names, family.GetName()) {
+					selected = append(selected, family)
+				}
+			}
+
+			return selected, err
+		}),
+		promhttp.HandlerOpts{},
+	)
+}
+
+// sampleSuffixes are the suffixes of the individual series of histograms and summaries
+var sampleSuffixes = []string{"", "_bucket", "_sum", "_count"}
+
+// declared tests if a gathered metric name is one of the declared names, allowing for a namespace and subsystem.
+// The name must match in full, optionally followed by one of the complete suffixes of a histogram or summary
+// series, e.g. "queue_latency_bucket".
+func declared(names []string, gathered string) bool {
+	for _, name := range names {
+		for _, suffix := range sampleSuffixes {
+			full := name + suffix
+			if gathered == full || strings.HasSuffix(gathered, "_"+full) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
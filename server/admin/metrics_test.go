@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Comcast/webpa-common/httppool"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testOtherMetrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{Name: "other_count", Type: xmetrics.CounterType},
+	}
+}
+
+func TestNewMetricsHandler(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	registry, err := xmetrics.NewRegistry(
+		&xmetrics.Options{Namespace: "webpa", Subsystem: "test"},
+		httppool.Metrics,
+		testOtherMetrics,
+	)
+
+	require.NoError(err)
+	require.NotNil(registry)
+
+	registry.NewGauge(httppool.QueueDepthGauge).With(httppool.PoolLabel, "test").Set(3.0)
+	registry.NewCounter("other_count").Add(1.0)
+
+	var (
+		handler  = NewMetricsHandler(registry.Gatherer(), httppool.Metrics)
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Contains(response.Body.String(), "webpa_test_"+httppool.QueueDepthGauge)
+	assert.NotContains(response.Body.String(), "other_count")
+}
+
+func TestDeclared(t *testing.T) {
+	assert := assert.New(t)
+	names := []string{"queue_depth"}
+
+	assert.True(declared(names, "queue_depth"))
+	assert.True(declared(names, "webpa_talaria_queue_depth"))
+	assert.False(declared(names, "webpa_talaria_max_queue_depth_total"))
+	assert.False(declared(names, "webpa_talaria_myqueue_depth"))
+	assert.True(declared(names, "queue_depth_bucket"))
+	assert.True(declared(names, "webpa_talaria_queue_depth_sum"))
+	assert.True(declared(names, "webpa_talaria_queue_depth_count"))
+	assert.False(declared(names, "webpa_talaria_queue_depth_buckets"))
+	assert.False(declared(names, "webpa_talaria_queue_depth_max"))
+	assert.False(declared(nil, "queue_depth"))
+}
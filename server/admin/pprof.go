@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// NewPprofHandler returns a handler which serves the net/http/pprof profiles beneath the given path, e.g.
+// /admin/pprof/heap.  A request for the path itself serves the index of profiles.
+func NewPprofHandler(path string) http.Handler {
+	path = strings.TrimSuffix(path, "/")
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		switch name := strings.Trim(strings.TrimPrefix(request.URL.Path, path), "/"); name {
+		case "":
+			// pprof.Index links to profiles relative to the request, so the index must be served from a directory path
+			if !strings.HasSuffix(request.URL.Path, "/") {
+				http.Redirect(response, request, path+"/", http.StatusMovedPermanently)
+				return
+			}
+
+			pprof.Index(response, request)
+		case "cmdline":
+			pprof.Cmdline(response, request)
+		case "profile":
+			pprof.Profile(response, request)
+		case "symbol":
+			pprof.Symbol(response, request)
+		case "trace":
+			pprof.Trace(response, request)
+		default:
+			pprof.Handler(name).ServeHTTP(response, request)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPprofHandler(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		handler = NewPprofHandler("/admin/pprof/")
+	)
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/admin/pprof", nil))
+	assert.Equal(http.StatusMovedPermanently, response.Code)
+	assert.Equal("/admin/pprof/", response.HeaderMap.Get("Location"))
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/admin/pprof/", nil))
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Contains(response.Body.String(), "goroutine")
+
+	for _, name := range []string{"cmdline", "goroutine", "heap"} {
+		response = httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", "/admin/pprof/"+name, nil))
+		assert.Equal(http.StatusOK, response.Code, name)
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Comcast/webpa-common/health"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/logging/logtest"
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/SermoDigital/jose/jws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAdminAuthorization allows requests with the header "Authorization: test", supplying claims
+// with a subject the way an AuthorizationHandler does
+func testAdminAuthorization(delegate http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Authorization") != "test" {
+			response.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		claims := jws.Claims{"sub": "operator"}
+		delegate.ServeHTTP(response, request.WithContext(secure.WithClaims(claims, request.Context())))
+	})
+}
+
+func TestNewAdminRouterNoAuthorization(t *testing.T) {
+	assert := assert.New(t)
+
+	admin, err := NewAdminRouter(logging.DefaultLogger(), nil, nil)
+	assert.Nil(admin)
+	assert.Equal(ErrorAdminAuthorizationRequired, err)
+}
+
+func TestAdminRouter(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		require     = require.New(t)
+		capture     = logtest.New()
+		registry, _ = xmetrics.NewRegistry(nil, Metrics)
+
+		admin, err = NewAdminRouter(capture.Logger(), testAdminAuthorization, registry)
+
+		endpoint = func(name string) http.Handler {
+			return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				response.Header().Set("X-Endpoint", name)
+				response.WriteHeader(http.StatusAccepted)
+			})
+		}
+
+		serve = func(method, path string, authorized bool) *httptest.ResponseRecorder {
+			request := httptest.NewRequest(method, path, nil)
+			if authorized {
+				request.Header.Set("Authorization", "test")
+			}
+
+			response := httptest.NewRecorder()
+			admin.ServeHTTP(response, request)
+			return response
+		}
+	)
+
+	require.NotNil(registry)
+	require.NotNil(admin)
+	require.NoError(err)
+
+	require.NoError(admin.Handle("logging/level", endpoint("logging/level")))
+	require.NoError(admin.Handle("logging", endpoint("logging")))
+	require.NoError(admin.Handle("drain", endpoint("drain")))
+	assert.Equal(ErrorAdminEndpointExists, admin.Handle("drain", endpoint("drain")))
+	assert.Equal(ErrorAdminEndpointName, admin.Handle("", endpoint("")))
+	assert.Equal(ErrorAdminEndpointName, admin.Handle("/drain", endpoint("drain")))
+	assert.Equal(ErrorAdminEndpointName, admin.Handle("drain/", endpoint("drain")))
+	assert.Equal([]string{"drain", "logging", "logging/level"}, admin.Names())
+
+	response := serve("GET", AdminPath, true)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.JSONEq(`{"endpoints": ["drain", "logging", "logging/level"]}`, response.Body.String())
+	assert.Equal(http.StatusMethodNotAllowed, serve("POST", AdminPath+"/", true).Code)
+
+	// the longest matching name wins
+	for path, expected := range map[string]string{
+		AdminPath + "/drain":               "drain",
+		AdminPath + "/logging":             "logging",
+		AdminPath + "/logging/other":       "logging",
+		AdminPath + "/logging/level":       "logging/level",
+		AdminPath + "/logging/level/extra": "logging/level",
+	} {
+		response := serve("POST", path, true)
+		assert.Equal(http.StatusAccepted, response.Code, path)
+		assert.Equal(expected, response.Header().Get("X-Endpoint"), path)
+	}
+
+	assert.Equal(http.StatusNotFound, serve("GET", AdminPath+"/nosuch", true).Code)
+	assert.Equal(http.StatusNotFound, serve("GET", AdminPath+"/drainage", true).Code)
+
+	// authorization is mandatory, even for unknown endpoints
+	assert.Equal(http.StatusForbidden, serve("POST", AdminPath+"/drain", false).Code)
+	assert.Equal(http.StatusForbidden, serve("GET", AdminPath+"/nosuch", false).Code)
+	assert.Equal(http.StatusForbidden, serve("GET", AdminPath, false).Code)
+
+	capture.AssertLogged(t, logtest.Expectation{Level: logtest.AnyLevel, Contains: "method=POST path=/admin/drain endpoint=drain remoteAddr=192.0.2.1:1234 subject=operator code=202"})
+	capture.AssertLogged(t, logtest.Expectation{Level: logtest.AnyLevel, Contains: "method=POST path=/admin/drain endpoint=drain remoteAddr=192.0.2.1:1234 subject= code=403"})
+
+	metrics := httptest.NewRecorder()
+	registry.ServeHTTP(metrics, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(metrics.Body.String(), AdminRequestCounter+`{code="202",endpoint="drain"} 1`)
+	assert.Contains(metrics.Body.String(), AdminRequestCounter+`{code="403",endpoint="drain"} 1`)
+	assert.Contains(metrics.Body.String(), AdminRequestCounter+`{code="404",endpoint="unknown"} 2`)
+	assert.Contains(metrics.Body.String(), AdminRequestCounter+`{code="200",endpoint="index"} 1`)
+}
+
+func TestWebPAAdmin(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		checker = health.NewChecker()
+		webPA   = WebPA{
+			Levels:             logging.NewLevelController(logging.InfoLevel),
+			AdminAuthorization: testAdminAuthorization,
+			AdminEndpoints:     map[string]http.Handler{"killswitch": http.NotFoundHandler()},
+		}
+
+		lifecycle = NewLifecycle(nil, logtest.New().Logger(), checker, nil)
+	)
+
+	admin, err := (&WebPA{}).newAdminRouter(logging.DefaultLogger(), lifecycle, checker)
+	assert.Nil(admin)
+	assert.NoError(err)
+
+	admin, err = webPA.newAdminRouter(logging.DefaultLogger(), lifecycle, checker)
+	require.NotNil(admin)
+	require.NoError(err)
+	assert.Equal([]string{"drain", "killswitch", "logging/level", "maintenance"}, admin.Names())
+
+	handler := webPA.pprofHandler(admin)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", AdminPath, nil))
+	assert.Equal(http.StatusForbidden, response.Code)
+
+	request := httptest.NewRequest("PUT", AdminPath+"/logging/level?level=debug", nil)
+	request.Header.Set("Authorization", "test")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal(logging.DebugLevel, webPA.Levels.Level())
+
+	// the unauthenticated log level endpoint is still served
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", LogLevelPath, nil))
+	assert.Equal(http.StatusOK, response.Code)
+}
+
+func TestWebPAAdminHandler(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		webPA   = WebPA{
+			Levels:             logging.NewLevelController(logging.InfoLevel),
+			AdminAuthorization: testAdminAuthorization,
+		}
+
+		lifecycle = NewLifecycle(nil, logtest.New().Logger(), nil, nil)
+	)
+
+	admin, err := webPA.newAdminRouter(logging.DefaultLogger(), lifecycle, nil)
+	require.NotNil(admin)
+	require.NoError(err)
+
+	handler := webPA.adminHandler(admin)
+	request := httptest.NewRequest("GET", AdminPath, nil)
+	request.Header.Set("Authorization", "test")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+
+	// the dedicated admin server serves nothing outside of the admin API
+	for _, path := range []string{LogLevelPath, "/debug/pprof/"} {
+		response = httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		assert.Equal(http.StatusNotFound, response.Code)
+	}
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Comcast/webpa-common/health"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/xmetrics"
+)
+
+const (
+	DefaultRequestDrainTimeout    time.Duration = 30 * time.Second
+	DefaultConnectionDrainTimeout time.Duration = 30 * time.Second
+)
+
+// Shutdown describes how a WebPA application shuts down.  Typically, this struct has its values
+// injected via Viper.
+type Shutdown struct {
+	// ReadinessDelay is the time between reporting not ready and no longer accepting connections, which
+	// gives load balancers the chance to stop routing traffic to the application.  If not supplied,
+	// there is no delay.
+	ReadinessDelay time.Duration
+
+	// RequestDrainTimeout is the time allowed for in-flight HTTP requests to complete.  If not supplied,
+	// DefaultRequestDrainTimeout is used.
+	RequestDrainTimeout time.Duration
+
+	// ConnectionDrainTimeout is the time allowed for long-lived connections, such as those of devices,
+	// to close.  If not supplied, DefaultConnectionDrainTimeout is used.
+	ConnectionDrainTimeout time.Duration
+}
+
+func (s *Shutdown) readinessDelay() time.Duration {
+	if s != nil && s.ReadinessDelay > 0 {
+		return s.ReadinessDelay
+	}
+
+	return 0
+}
+
+func (s *Shutdown) requestDrainTimeout() time.Duration {
+	if s != nil && s.RequestDrainTimeout > 0 {
+		return s.RequestDrainTimeout
+	}
+
+	return DefaultRequestDrainTimeout
+}
+
+func (s *Shutdown) connectionDrainTimeout() time.Duration {
+	if s != nil && s.ConnectionDrainTimeout > 0 {
+		return s.ConnectionDrainTimeout
+	}
+
+	return DefaultConnectionDrainTimeout
+}
+
+// Drainer is a component with long-lived connections that must be closed during shutdown, such as a
+// device.Manager.  Drain should return once every connection has closed, or return the context's error
+// once the context is done.
+type Drainer interface {
+	Drain(context.Context) error
+}
+
+// DrainerFunc is a function type that implements Drainer
+type DrainerFunc func(context.Context) error
+
+func (f DrainerFunc) Drain(ctx context.Context) error {
+	return f(ctx)
+}
+
+type namedServer struct {
+	name   string
+	server *http.Server
+}
+
+type namedDrainer struct {
+	name    string
+	drainer Drainer
+}
+
+type namedCloser struct {
+	name   string
+	closer io.Closer
+}
+
+// Lifecycle coordinates the graceful shutdown of an application.  When shut down, a Lifecycle:
+//
+//	(1) marks the application as not ready, via its health.Checker, then waits for the ReadinessDelay
+//	(2) stops its servers from accepting connections, then concurrently waits for in-flight HTTP requests
+//	    and drains long-lived connections, each up to its configured timeout
+//	(3) closes its servers, which terminates any connections that remain, followed by its closers
+//
+// Closers are intended for servers which must remain available until the very end, such as the
+// health server.  A Lifecycle is safe for concurrent use.
+type Lifecycle struct {
+	shutdown *Shutdown
+	logger   logging.Logger
+	checker  *health.Checker
+	measures lifecycleMeasures
+	after    func(time.Duration) <-chan time.Time
+
+	lock     sync.Mutex
+	servers  []namedServer
+	drainers []namedDrainer
+	closers  []namedCloser
+
+	once sync.Once
+	err  error
+}
+
+// NewLifecycle creates a Lifecycle.  The checker and the metrics provider are optional.
+func NewLifecycle(s *Shutdown, logger logging.Logger, checker *health.Checker, p xmetrics.Provider) *Lifecycle {
+	return &Lifecycle{
+		shutdown: s,
+		logger:   logger,
+		checker:  checker,
+		measures: newLifecycleMeasures(p),
+		after:    time.After,
+	}
+}
+
+// AddServer registers a server whose in-flight requests are drained during shutdown
+func (l *Lifecycle) AddServer(name string, server *http.Server) {
+	l.lock.Lock()
+	l.servers = append(l.servers, namedServer{name, server})
+	l.lock.Unlock()
+}
+
+// AddDrainer registers a component whose long-lived connections are drained during shutdown
+func (l *Lifecycle) AddDrainer(name string, drainer Drainer) {
+	l.lock.Lock()
+	l.drainers = append(l.drainers, namedDrainer{name, drainer})
+	l.lock.Unlock()
+}
+
+// AddCloser registers something which is closed once everything else has shut down
+func (l *Lifecycle) AddCloser(name string, closer io.Closer) {
+	l.lock.Lock()
+	l.closers = append(l.closers, namedCloser{name, closer})
+	l.lock.Unlock()
+}
+
+// Shutdown gracefully shuts down everything registered with this Lifecycle, returning once it is done.
+// The returned error is the first encountered, such as a drain timing out.  This method is idempotent:
+// subsequent calls return the result of the first.
+func (l *Lifecycle) Shutdown() error {
+	l.once.Do(func() {
+		l.err = l.run()
+	})
+
+	return l.err
+}
+
+func (l *Lifecycle) run() error {
+	start := time.Now()
+
+	l.logger.Info("Shutting down")
+	l.measures.shuttingDown.Set(1)
+	defer l.measures.shuttingDown.Set(0)
+
+	if l.checker != nil {
+		l.logger.Info("Reporting not ready")
+		l.checker.Drain()
+	}
+
+	if delay := l.shutdown.readinessDelay(); delay > 0 {
+		l.logger.Info("Waiting %s for load balancers to notice", delay)
+		<-l.after(delay)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// each component drains concurrently, but only this goroutine logs and records the results
+	type drainResult struct {
+		name    string
+		timeout time.Duration
+		err     error
+	}
+
+	var (
+		waitGroup sync.WaitGroup
+		results   = make([]drainResult, 0, len(l.servers)+len(l.drainers))
+	)
+
+	drain := func(name string, timeout time.Duration, f func(context.Context) error) {
+		l.logger.Info("Draining [%s]", name)
+		results = append(results, drainResult{name: name, timeout: timeout})
+		result := &results[len(results)-1]
+
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			result.err = f(ctx)
+		}()
+	}
+
+	for _, s := range l.servers {
+		drain(s.name, l.shutdown.requestDrainTimeout(), s.server.Shutdown)
+	}
+
+	for _, d := range l.drainers {
+		drain(d.name, l.shutdown.connectionDrainTimeout(), d.drainer.Drain)
+	}
+
+	waitGroup.Wait()
+
+	var firstErr error
+	for _, r := range results {
+		switch {
+		case r.err == nil:
+			l.logger.Info("Drained [%s]", r.name)
+			continue
+
+		case r.err == context.DeadlineExceeded:
+			l.measures.drainTimeouts.With(ComponentLabel, r.name).Add(1)
+			l.logger.Error("[%s] did not drain within %s", r.name, r.timeout)
+
+		default:
+			l.logger.Error("Unable to drain [%s]: %s", r.name, r.err)
+		}
+
+		if firstErr == nil {
+			firstErr = r.err
+		}
+	}
+
+	for _, s := range l.servers {
+		if err := s.server.Close(); err != nil {
+			l.logger.Error("Unable to close [%s]: %s", s.name, err)
+		}
+	}
+
+	for _, c := range l.closers {
+		if err := c.closer.Close(); err != nil {
+			l.logger.Error("Unable to close [%s]: %s", c.name, err)
+		}
+	}
+
+	l.logger.Info("Shut down in %s", time.Since(start))
+	return firstErr
+}
+
+// DrainHandler returns an admin endpoint which begins a graceful shutdown, exactly as if the application
+// had been told to shut down.  Only POST is accepted.  The response, 202 Accepted, is written before the
+// shutdown starts, since the shutdown stops the server handling the request.  The process itself does
+// not exit, which allows an operator to drain a node before it is terminated.
+func (l *Lifecycle) DrainHandler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost {
+			response.Header().Set("Allow", http.MethodPost)
+			response.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		l.logger.Info("Drain requested by %s", request.RemoteAddr)
+		response.WriteHeader(http.StatusAccepted)
+		go l.Shutdown()
+	})
+}
+
+// Run shuts down this Lifecycle once the shutdown channel is closed.  The shutdown is part of the
+// WaitGroup, so that waiting on the WaitGroup waits for the application to drain.  This method
+// implements concurrent.Runnable.
+func (l *Lifecycle) Run(waitGroup *sync.WaitGroup, shutdown <-chan struct{}) error {
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		<-shutdown
+		l.Shutdown()
+	}()
+
+	return nil
+}
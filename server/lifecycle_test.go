@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/health"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/logging/logtest"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCloser is an io.Closer which counts how many times it is closed
+type testCloser struct {
+	lock   sync.Mutex
+	closed int
+	err    error
+}
+
+func (c *testCloser) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed++
+	return c.err
+}
+
+func (c *testCloser) count() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.closed
+}
+
+func TestShutdownDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, s := range []*Shutdown{nil, new(Shutdown)} {
+		assert.Zero(s.readinessDelay())
+		assert.Equal(DefaultRequestDrainTimeout, s.requestDrainTimeout())
+		assert.Equal(DefaultConnectionDrainTimeout, s.connectionDrainTimeout())
+	}
+
+	s := &Shutdown{ReadinessDelay: time.Second, RequestDrainTimeout: 2 * time.Second, ConnectionDrainTimeout: 3 * time.Second}
+	assert.Equal(time.Second, s.readinessDelay())
+	assert.Equal(2*time.Second, s.requestDrainTimeout())
+	assert.Equal(3*time.Second, s.connectionDrainTimeout())
+}
+
+func TestLifecycleShutdown(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		capture = logtest.New()
+		checker = health.NewChecker()
+
+		entered = make(chan struct{})
+		release = make(chan struct{})
+		server  = &http.Server{
+			Handler: http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				close(entered)
+				<-release
+				response.WriteHeader(http.StatusAccepted)
+			}),
+		}
+
+		drained = make(chan struct{})
+		drainer = DrainerFunc(func(ctx context.Context) error {
+			close(drained)
+			return nil
+		})
+
+		closer = new(testCloser)
+		delays = make(chan time.Time)
+
+		lifecycle = NewLifecycle(&Shutdown{ReadinessDelay: time.Minute}, capture.Logger(), checker, nil)
+	)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	go server.Serve(listener)
+
+	lifecycle.after = func(d time.Duration) <-chan time.Time {
+		assert.Equal(time.Minute, d)
+		return delays
+	}
+
+	lifecycle.AddServer("test", server)
+	lifecycle.AddDrainer("devices", drainer)
+	lifecycle.AddCloser("test.health", closer)
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String())
+		assert.NoError(err)
+		responses <- response
+	}()
+
+	<-entered
+	result := make(chan error, 1)
+	go func() {
+		result <- lifecycle.Shutdown()
+	}()
+
+	// the readiness delay can only be received once the checker is draining
+	delays <- time.Now()
+	assert.True(checker.Draining())
+	assert.False(checker.Ready())
+
+	<-drained
+	select {
+	case <-result:
+		assert.Fail("Shutdown should wait for in-flight requests")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.Zero(closer.count())
+	close(release)
+
+	select {
+	case err := <-result:
+		assert.NoError(err)
+	case <-time.After(10 * time.Second):
+		require.Fail("Shutdown did not complete")
+	}
+
+	response := <-responses
+	require.NotNil(response)
+	assert.Equal(http.StatusAccepted, response.StatusCode)
+	ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	assert.Equal(1, closer.count())
+	assert.Equal(http.ErrServerClosed, server.Serve(listener))
+
+	capture.AssertCount(t, logging.ErrorLevel, 0)
+	capture.AssertOrdered(t,
+		logtest.Expect(logging.InfoLevel, "Shutting down"),
+		logtest.Expect(logging.InfoLevel, "Reporting not ready"),
+		logtest.Expectation{Level: logging.InfoLevel, Contains: "Shut down in"},
+	)
+
+	capture.AssertLogged(t, logtest.Expect(logging.InfoLevel, "Drained [test]"))
+	capture.AssertLogged(t, logtest.Expect(logging.InfoLevel, "Drained [devices]"))
+
+	// subsequent shutdowns do nothing
+	assert.NoError(lifecycle.Shutdown())
+	assert.Equal(1, closer.count())
+}
+
+func TestLifecycleDrainTimeout(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		capture = logtest.New()
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+		closer        = &testCloser{err: errors.New("expected")}
+
+		lifecycle = NewLifecycle(&Shutdown{ConnectionDrainTimeout: 10 * time.Millisecond}, capture.Logger(), nil, registry)
+	)
+
+	require.NoError(err)
+	lifecycle.AddDrainer("devices", DrainerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	lifecycle.AddDrainer("other", DrainerFunc(func(context.Context) error {
+		return errors.New("expected")
+	}))
+
+	lifecycle.AddCloser("test.health", closer)
+
+	assert.Error(lifecycle.Shutdown())
+	assert.Equal(1, closer.count())
+
+	capture.AssertLogged(t, logtest.Expectation{Level: logging.ErrorLevel, Contains: "[devices] did not drain"})
+	capture.AssertLogged(t, logtest.Expect(logging.ErrorLevel, "Unable to drain [other]: expected"))
+	capture.AssertLogged(t, logtest.Expect(logging.ErrorLevel, "Unable to close [test.health]: expected"))
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(response.Body.String(), `server_drain_timeout_count{component="devices"} 1`)
+	assert.NotContains(response.Body.String(), `server_drain_timeout_count{component="other"}`)
+	assert.Contains(response.Body.String(), "server_shutdown_in_progress 0")
+}
+
+func TestLifecycleRun(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		closer    = new(testCloser)
+		lifecycle = NewLifecycle(nil, logtest.New().Logger(), nil, nil)
+
+		waitGroup = new(sync.WaitGroup)
+		shutdown  = make(chan struct{})
+	)
+
+	lifecycle.AddCloser("test", closer)
+	assert.NoError(lifecycle.Run(waitGroup, shutdown))
+	assert.Zero(closer.count())
+
+	close(shutdown)
+	waitGroup.Wait()
+	assert.Equal(1, closer.count())
+}
+
+func TestLifecycleDrainHandler(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		checker   = health.NewChecker()
+		closed    = make(chan struct{})
+		lifecycle = NewLifecycle(nil, logtest.New().Logger(), checker, nil)
+		handler   = lifecycle.DrainHandler()
+	)
+
+	lifecycle.AddDrainer("test", DrainerFunc(func(context.Context) error {
+		close(closed)
+		return nil
+	}))
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/drain", nil))
+	assert.Equal(http.StatusMethodNotAllowed, response.Code)
+	assert.False(checker.Draining())
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("POST", "/drain", nil))
+	assert.Equal(http.StatusAccepted, response.Code)
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		assert.Fail("The drain did not start")
+	}
+
+	assert.True(checker.Draining())
+}
@@ -5,8 +5,23 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"strings"
 )
 
+// initialLevel converts a configured golog level into the starting level of a logging.LevelController.
+// TRACE becomes the debug level, and anything unrecognized, including FATAL, becomes the error level.
+func initialLevel(value string) logging.Level {
+	if level, err := logging.ParseLevel(value); err == nil {
+		return level
+	}
+
+	if strings.EqualFold(value, "TRACE") {
+		return logging.DebugLevel
+	}
+
+	return logging.ErrorLevel
+}
+
 // NewErrorLog creates a new logging.Logger appropriate for http.Server.ErrorLog
 func NewErrorLog(serverName string, logger logging.Logger) *log.Logger {
 	return log.New(&logging.ErrorWriter{logger}, serverName, log.LstdFlags|log.LUTC)
@@ -7,6 +7,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"sync"
 	"testing"
 )
 
@@ -14,9 +15,21 @@ const (
 	serverName = "serverName"
 )
 
+// lockedWriter serializes writes, since components such as a Lifecycle and a Health log concurrently
+type lockedWriter struct {
+	lock   sync.Mutex
+	buffer *bytes.Buffer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.buffer.Write(p)
+}
+
 func newTestLogger() (verify *bytes.Buffer, logger logging.Logger) {
 	verify = new(bytes.Buffer)
-	logger = &logging.LoggerWriter{verify}
+	logger = &logging.LoggerWriter{&lockedWriter{buffer: verify}}
 	return
 }
 
@@ -64,3 +77,25 @@ func TestNewConnectionStateLogger(t *testing.T) {
 
 	assertConnState(assert, verify, connectionLogFunc)
 }
+
+func TestInitialLevel(t *testing.T) {
+	assert := assert.New(t)
+
+	var testData = []struct {
+		value    string
+		expected logging.Level
+	}{
+		{"TRACE", logging.DebugLevel},
+		{"DEBUG", logging.DebugLevel},
+		{"INFO", logging.InfoLevel},
+		{"WARN", logging.WarnLevel},
+		{"ERROR", logging.ErrorLevel},
+		{"FATAL", logging.ErrorLevel},
+		{"", logging.ErrorLevel},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		assert.Equal(record.expected, initialLevel(record.value))
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// ShutdownInProgressGauge is 1 while a Lifecycle is shutting down, and 0 otherwise
+	ShutdownInProgressGauge = "server_shutdown_in_progress"
+
+	// DrainTimeoutCounter is the number of servers and drainers which did not drain before their deadlines
+	DrainTimeoutCounter = "server_drain_timeout_count"
+
+	// AdminRequestCounter is the number of requests to an AdminRouter
+	AdminRequestCounter = "server_admin_request_count"
+
+	// RouteRequestCounter is the number of requests served by each instrumented route
+	RouteRequestCounter = "server_route_request_count"
+
+	// RouteRequestDurationHistogram is the time taken to serve requests on each instrumented route
+	RouteRequestDurationHistogram = "server_route_request_duration_seconds"
+
+	// RouteResponseSizeHistogram is the size of the response bodies written by each instrumented route
+	RouteResponseSizeHistogram = "server_route_response_size_bytes"
+
+	// ComponentLabel is the label identifying the server or drainer of a DrainTimeoutCounter
+	ComponentLabel = "component"
+
+	// EndpointLabel is the label identifying the admin endpoint of an AdminRequestCounter
+	EndpointLabel = "endpoint"
+
+	// CodeLabel is the label holding the HTTP status code of an AdminRequestCounter
+	CodeLabel = "code"
+
+	// RouteLabel is the label identifying the route of the route metrics, usually a path template
+	RouteLabel = "route"
+
+	// StatusClassLabel is the label holding the class of the HTTP status code of the route metrics, e.g. "2xx"
+	StatusClassLabel = "class"
+)
+
+// Metrics is the xmetrics.Module for this package
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name: ShutdownInProgressGauge,
+			Type: xmetrics.GaugeType,
+			Help: "Whether the application is shutting down",
+		},
+		{
+			Name:       DrainTimeoutCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The number of components which did not drain before their deadlines during shutdown",
+			LabelNames: []string{ComponentLabel},
+		},
+		{
+			Name:       AdminRequestCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The number of requests to the admin API",
+			LabelNames: []string{EndpointLabel, CodeLabel},
+		},
+		{
+			Name:       RouteRequestCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The number of requests served by each route",
+			LabelNames: []string{RouteLabel, StatusClassLabel},
+		},
+		{
+			Name:       RouteRequestDurationHistogram,
+			Type:       xmetrics.HistogramType,
+			Help:       "The time taken to serve requests on each route",
+			LabelNames: []string{RouteLabel, StatusClassLabel},
+		},
+		{
+			Name:       RouteResponseSizeHistogram,
+			Type:       xmetrics.HistogramType,
+			Help:       "The size of the response bodies written by each route",
+			LabelNames: []string{RouteLabel, StatusClassLabel},
+			Buckets:    []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576},
+		},
+	}
+}
+
+// lifecycleMeasures is the set of metrics updated by a Lifecycle
+type lifecycleMeasures struct {
+	shuttingDown  metrics.Gauge
+	drainTimeouts metrics.Counter
+}
+
+func newLifecycleMeasures(p xmetrics.Provider) lifecycleMeasures {
+	if p == nil {
+		p = xmetrics.NewDiscardProvider()
+	}
+
+	return lifecycleMeasures{
+		shuttingDown:  p.NewGauge(ShutdownInProgressGauge),
+		drainTimeouts: p.NewCounter(DrainTimeoutCounter),
+	}
+}
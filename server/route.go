@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+)
+
+// routeResponseWriter records the status code and the size of the body written for a request.  Since
+// instrumented routes may upgrade to websockets or stream, hijacking and flushing are passed through.
+type routeResponseWriter struct {
+	http.ResponseWriter
+	code int
+	size int
+}
+
+func (w *routeResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *routeResponseWriter) Write(data []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+
+	count, err := w.ResponseWriter.Write(data)
+	w.size += count
+	return count, err
+}
+
+func (w *routeResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		// a hijacked connection is reported as switching protocols, as with a websocket upgrade
+		if w.code == 0 {
+			w.code = http.StatusSwitchingProtocols
+		}
+
+		return hijacker.Hijack()
+	}
+
+	return nil, nil, errors.New("Wrapped response does not implement http.Hijacker")
+}
+
+func (w *routeResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// statusClass returns the label value for the class of a status code, e.g. "2xx" for 204
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// RouteMetrics returns an Alice-compatible constructor which instruments a handler as the given route.
+// The number of requests, their durations, and the sizes of their response bodies are recorded in the
+// metrics declared by Metrics, labelled with the route and the class of each response's status code.
+// If the provider is nil, metrics are discarded.
+func RouteMetrics(route string, p xmetrics.Provider) alice.Constructor {
+	if p == nil {
+		p = xmetrics.NewDiscardProvider()
+	}
+
+	var (
+		requests = p.NewCounter(RouteRequestCounter)
+		duration = p.NewHistogram(RouteRequestDurationHistogram)
+		size     = p.NewHistogram(RouteResponseSizeHistogram)
+	)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			var (
+				start    = time.Now()
+				recorder = &routeResponseWriter{ResponseWriter: response}
+			)
+
+			next.ServeHTTP(recorder, request)
+			if recorder.code == 0 {
+				recorder.code = http.StatusOK
+			}
+
+			labelValues := []string{RouteLabel, route, StatusClassLabel, statusClass(recorder.code)}
+			requests.With(labelValues...).Add(1)
+			duration.With(labelValues...).Observe(time.Since(start).Seconds())
+			size.With(labelValues...).Observe(float64(recorder.size))
+		})
+	}
+}
+
+// Router is a gorilla mux.Router which instruments its routes with RouteMetrics.  Each route registered
+// via Handle or HandleFunc is labelled with its path template, so that requests for, e.g., /devices/{id}
+// share a single set of metrics.  Handlers attached by other means, such as to a mux.Route or a subrouter
+// obtained from the embedded mux.Router, are not instrumented.
+type Router struct {
+	*mux.Router
+	provider xmetrics.Provider
+}
+
+// NewRouter creates a Router which records route metrics with the given provider.  If the provider
+// is nil, metrics are discarded.
+func NewRouter(p xmetrics.Provider) *Router {
+	return &Router{
+		Router:   mux.NewRouter(),
+		provider: p,
+	}
+}
+
+// Handle registers an instrumented handler for the given path template
+func (r *Router) Handle(path string, handler http.Handler) *mux.Route {
+	return r.Router.Handle(path, RouteMetrics(path, r.provider)(handler))
+}
+
+// HandleFunc registers an instrumented handler function for the given path template
+func (r *Router) HandleFunc(path string, f func(http.ResponseWriter, *http.Request)) *mux.Route {
+	return r.Handle(path, http.HandlerFunc(f))
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/justinas/alice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrapeRouteMetrics(registry *xmetrics.Registry) string {
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	return response.Body.String()
+}
+
+func TestStatusClass(t *testing.T) {
+	assert := assert.New(t)
+	for code, expected := range map[int]string{
+		0:                             "unknown",
+		http.StatusSwitchingProtocols: "1xx",
+		http.StatusOK:                 "2xx",
+		http.StatusNoContent:          "2xx",
+		http.StatusFound:              "3xx",
+		http.StatusNotFound:           "4xx",
+		http.StatusServiceUnavailable: "5xx",
+		600:                           "unknown",
+	} {
+		assert.Equal(expected, statusClass(code), fmt.Sprintf("%d", code))
+	}
+}
+
+func TestRouteMetrics(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	require.NoError(err)
+
+	handler := alice.New(RouteMetrics("/test", registry)).ThenFunc(func(response http.ResponseWriter, request *http.Request) {
+		switch request.URL.Query().Get("status") {
+		case "missing":
+			response.WriteHeader(http.StatusNotFound)
+		case "empty":
+		default:
+			response.Write([]byte("hello"))
+		}
+	})
+
+	for _, query := range []string{"", "", "?status=missing", "?status=empty"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test"+query, nil))
+	}
+
+	output := scrapeRouteMetrics(registry)
+	assert.Contains(output, RouteRequestCounter+`{class="2xx",route="/test"} 3`)
+	assert.Contains(output, RouteRequestCounter+`{class="4xx",route="/test"} 1`)
+	assert.Contains(output, RouteRequestDurationHistogram+`_count{class="2xx",route="/test"} 3`)
+	assert.Contains(output, RouteResponseSizeHistogram+`_sum{class="2xx",route="/test"} 10`)
+	assert.Contains(output, RouteResponseSizeHistogram+`_sum{class="4xx",route="/test"} 0`)
+}
+
+func TestRouteMetricsNilProvider(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		response = httptest.NewRecorder()
+		handler  = RouteMetrics("/test", nil)(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.WriteHeader(http.StatusAccepted)
+		}))
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/test", nil))
+	assert.Equal(http.StatusAccepted, response.Code)
+}
+
+func TestRouteResponseWriter(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		delegate = httptest.NewRecorder()
+		recorder = &routeResponseWriter{ResponseWriter: delegate}
+	)
+
+	recorder.Flush()
+	assert.True(delegate.Flushed)
+
+	// httptest.ResponseRecorder cannot be hijacked
+	conn, buffer, err := recorder.Hijack()
+	assert.Nil(conn)
+	assert.Nil(buffer)
+	assert.Error(err)
+	assert.Zero(recorder.code)
+}
+
+func TestRouter(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	require.NoError(err)
+
+	webPA := &WebPA{MetricsProvider: registry}
+	router := webPA.NewRouter()
+	require.NotNil(router)
+
+	router.HandleFunc("/devices/{id}", func(response http.ResponseWriter, _ *http.Request) {
+		response.Write([]byte("device"))
+	}).Methods("GET")
+
+	router.Handle("/status", http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		response.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	for _, path := range []string{"/devices/mac:112233445566", "/devices/mac:665544332211", "/status", "/nosuch"} {
+		response, err := http.Get(server.URL + path)
+		require.NoError(err)
+		response.Body.Close()
+	}
+
+	output := scrapeRouteMetrics(registry)
+	assert.Contains(output, RouteRequestCounter+`{class="2xx",route="/devices/{id}"} 2`)
+	assert.Contains(output, RouteRequestCounter+`{class="5xx",route="/status"} 1`)
+	assert.False(strings.Contains(output, "/nosuch"), "Unrouted requests are not instrumented")
+}
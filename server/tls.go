@@ -0,0 +1,341 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Comcast/webpa-common/logging"
+)
+
+const (
+	// DefaultCertificateReloadInterval is how often certificate files are checked for changes
+	DefaultCertificateReloadInterval time.Duration = time.Minute
+)
+
+var (
+	// ErrorNoClientCAs is returned when client certificates must be verified but no client CA file is configured
+	ErrorNoClientCAs = errors.New("Verifying client certificates requires a client CA file")
+
+	// clientAuthTypes maps the configurable names of client authentication policies onto their tls values
+	clientAuthTypes = map[string]tls.ClientAuthType{
+		"":                 tls.NoClientCert,
+		"none":             tls.NoClientCert,
+		"request":          tls.RequestClientCert,
+		"require":          tls.RequireAnyClientCert,
+		"verifyIfGiven":    tls.VerifyClientCertIfGiven,
+		"requireAndVerify": tls.RequireAndVerifyClientCert,
+	}
+
+	// tlsVersions maps the configurable names of TLS versions onto their tls values
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+	}
+
+	// cipherSuites maps the names of the cipher suites implemented by crypto/tls onto their values
+	cipherSuites = map[string]uint16{
+		"TLS_RSA_WITH_RC4_128_SHA":                tls.TLS_RSA_WITH_RC4_128_SHA,
+		"TLS_RSA_WITH_3DES_EDE_CBC_SHA":           tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+		"TLS_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+		"TLS_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		"TLS_RSA_WITH_AES_128_CBC_SHA256":         tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+		"TLS_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+		"TLS_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+		"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA":        tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+		"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+		"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+		"TLS_ECDHE_RSA_WITH_RC4_128_SHA":          tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+		"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":     tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+		"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+		"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+		"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	}
+)
+
+// TLS describes the optional TLS settings of a server, beyond its certificate and key files.  These settings
+// only apply to servers which have both a certificate file and a key file.
+type TLS struct {
+	// ClientAuth is the policy for TLS client certificates, which is one of "none", "request", "require",
+	// "verifyIfGiven", or "requireAndVerify".  If not supplied, client certificates are not requested.
+	ClientAuth string
+
+	// ClientCAFile is the PEM file containing the certificate authorities used to verify client certificates.
+	// This field is required when ClientAuth is "verifyIfGiven" or "requireAndVerify".
+	ClientCAFile string
+
+	// MinVersion is the minimum TLS version accepted, which is one of "1.0", "1.1", or "1.2".
+	// If not supplied, the crypto/tls default is used.
+	MinVersion string
+
+	// CipherSuites are the names of the enabled cipher suites, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256".
+	// If not supplied, the crypto/tls defaults are used.
+	CipherSuites []string
+
+	// ReloadInterval is how often the certificate and key files are checked for changes.  If not supplied,
+	// DefaultCertificateReloadInterval is used.  If negative, the files are only reloaded on SIGHUP.
+	ReloadInterval time.Duration
+}
+
+func (t *TLS) clientAuth() (tls.ClientAuthType, error) {
+	var name string
+	if t != nil {
+		name = t.ClientAuth
+	}
+
+	if clientAuth, ok := clientAuthTypes[name]; ok {
+		return clientAuth, nil
+	}
+
+	return tls.NoClientCert, fmt.Errorf("Invalid client auth: %s", name)
+}
+
+func (t *TLS) minVersion() (uint16, error) {
+	if t == nil || len(t.MinVersion) == 0 {
+		return 0, nil
+	}
+
+	if version, ok := tlsVersions[t.MinVersion]; ok {
+		return version, nil
+	}
+
+	return 0, fmt.Errorf("Invalid TLS version: %s", t.MinVersion)
+}
+
+func (t *TLS) cipherSuites() ([]uint16, error) {
+	if t == nil || len(t.CipherSuites) == 0 {
+		return nil, nil
+	}
+
+	suites := make([]uint16, 0, len(t.CipherSuites))
+	for _, name := range t.CipherSuites {
+		suite, ok := cipherSuites[name]
+		if !ok {
+			return nil, fmt.Errorf("Invalid cipher suite: %s", name)
+		}
+
+		suites = append(suites, suite)
+	}
+
+	return suites, nil
+}
+
+func (t *TLS) reloadInterval() time.Duration {
+	if t != nil && t.ReloadInterval != 0 {
+		return t.ReloadInterval
+	}
+
+	return DefaultCertificateReloadInterval
+}
+
+// NewConfig creates a tls.Config whose certificate is supplied by the given CertificateReloader
+func (t *TLS) NewConfig(reloader *CertificateReloader) (*tls.Config, error) {
+	clientAuth, err := t.clientAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	minVersion, err := t.minVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	suites, err := t.cipherSuites()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		ClientAuth:     clientAuth,
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+	}
+
+	if t != nil && len(t.ClientCAFile) > 0 {
+		data, err := ioutil.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("No certificates found in client CA file %s", t.ClientCAFile)
+		}
+	} else if clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert {
+		return nil, ErrorNoClientCAs
+	}
+
+	return config, nil
+}
+
+// CertificateReloader supplies a server's certificate, reloading it from its files when they change or when
+// the process receives SIGHUP.  This allows certificates to be rotated without restarting the server, which
+// would drop every connection.  If a reload fails, the previous certificate remains in use.
+type CertificateReloader struct {
+	certificateFile string
+	keyFile         string
+	interval        time.Duration
+	logger          logging.Logger
+
+	lock        sync.RWMutex
+	certificate *tls.Certificate
+	modTimes    [2]time.Time
+
+	// tick is an optional source of ticks used in place of a time.Ticker, and is only set by tests
+	tick    func(time.Duration) <-chan time.Time
+	signals func() (<-chan os.Signal, func())
+}
+
+// NewCertificateReloader creates a CertificateReloader and loads the initial certificate.  The interval
+// is how often the files are checked for changes.  If nonpositive, the files are only reloaded on SIGHUP.
+func NewCertificateReloader(certificateFile, keyFile string, interval time.Duration, logger logging.Logger) (*CertificateReloader, error) {
+	if logger == nil {
+		logger = logging.DefaultLogger()
+	}
+
+	r := &CertificateReloader{
+		certificateFile: certificateFile,
+		keyFile:         keyFile,
+		interval:        interval,
+		logger:          logger,
+		signals: func() (<-chan os.Signal, func()) {
+			hangup := make(chan os.Signal, 1)
+			signal.Notify(hangup, syscall.SIGHUP)
+			return hangup, func() { signal.Stop(hangup) }
+		},
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// fileModTimes returns the modification times of the certificate and key files
+func (r *CertificateReloader) fileModTimes() (modTimes [2]time.Time, err error) {
+	for index, name := range []string{r.certificateFile, r.keyFile} {
+		var info os.FileInfo
+		if info, err = os.Stat(name); err != nil {
+			return
+		}
+
+		modTimes[index] = info.ModTime()
+	}
+
+	return
+}
+
+// Reload unconditionally loads the certificate from its files
+func (r *CertificateReloader) Reload() error {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.certificateFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	r.certificate = &certificate
+	r.modTimes = modTimes
+	r.lock.Unlock()
+
+	return nil
+}
+
+// reloadIfChanged loads the certificate if either of its files has been modified since the last load
+func (r *CertificateReloader) reloadIfChanged() error {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return err
+	}
+
+	r.lock.RLock()
+	changed := modTimes != r.modTimes
+	r.lock.RUnlock()
+
+	if changed {
+		return r.Reload()
+	}
+
+	return nil
+}
+
+// Certificate returns the current certificate
+func (r *CertificateReloader) Certificate() *tls.Certificate {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.certificate
+}
+
+// GetCertificate returns the current certificate.  This method is used as tls.Config.GetCertificate.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// Run watches for changes to the certificate files, and for SIGHUP, until shutdown is closed.  This
+// method implements concurrent.Runnable.
+func (r *CertificateReloader) Run(waitGroup *sync.WaitGroup, shutdown <-chan struct{}) error {
+	var (
+		ticks    <-chan time.Time
+		stopTick = func() {}
+	)
+
+	if r.interval > 0 {
+		if r.tick != nil {
+			ticks = r.tick(r.interval)
+		} else {
+			ticker := time.NewTicker(r.interval)
+			ticks, stopTick = ticker.C, ticker.Stop
+		}
+	}
+
+	hangup, stop := r.signals()
+
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		defer stop()
+		defer stopTick()
+
+		for {
+			select {
+			case <-shutdown:
+				return
+
+			case <-ticks:
+				if err := r.reloadIfChanged(); err != nil {
+					r.logger.Error("Unable to reload certificate %s: %s", r.certificateFile, err)
+				}
+
+			case <-hangup:
+				if err := r.Reload(); err != nil {
+					r.logger.Error("Unable to reload certificate %s: %s", r.certificateFile, err)
+				} else {
+					r.logger.Info("Reloaded certificate %s", r.certificateFile)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
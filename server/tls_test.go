@@ -0,0 +1,236 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key to PEM files in the given directory
+func writeTestCertificate(t *testing.T, directory, commonName string) (certificateFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certificateFile = filepath.Join(directory, "server.cert")
+	keyFile = filepath.Join(directory, "server.key")
+	require.NoError(t, ioutil.WriteFile(certificateFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600))
+	return
+}
+
+func newTestDirectory(t *testing.T) (string, func()) {
+	directory, err := ioutil.TempDir("", "webpa-server")
+	require.NoError(t, err)
+	return directory, func() { os.RemoveAll(directory) }
+}
+
+func commonName(t *testing.T, certificate *tls.Certificate) string {
+	require.NotNil(t, certificate)
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestTLSDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tlsOptions := range []*TLS{nil, new(TLS)} {
+		clientAuth, err := tlsOptions.clientAuth()
+		assert.Equal(tls.NoClientCert, clientAuth)
+		assert.NoError(err)
+
+		minVersion, err := tlsOptions.minVersion()
+		assert.Zero(minVersion)
+		assert.NoError(err)
+
+		suites, err := tlsOptions.cipherSuites()
+		assert.Nil(suites)
+		assert.NoError(err)
+
+		assert.Equal(DefaultCertificateReloadInterval, tlsOptions.reloadInterval())
+	}
+}
+
+func TestTLSNewConfig(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		directory, cleanup = newTestDirectory(t)
+	)
+
+	defer cleanup()
+	certificateFile, keyFile := writeTestCertificate(t, directory, "test")
+
+	reloader, err := NewCertificateReloader(certificateFile, keyFile, -1, nil)
+	require.NoError(err)
+	require.NotNil(reloader)
+
+	t.Run("Defaults", func(t *testing.T) {
+		config, err := (*TLS)(nil).NewConfig(reloader)
+		require.NoError(err)
+		require.NotNil(config)
+
+		assert.Equal(tls.NoClientCert, config.ClientAuth)
+		assert.Nil(config.ClientCAs)
+		assert.Zero(config.MinVersion)
+		assert.Empty(config.CipherSuites)
+		assert.Empty(config.Certificates)
+
+		certificate, err := config.GetCertificate(nil)
+		assert.NoError(err)
+		assert.Equal("test", commonName(t, certificate))
+	})
+
+	t.Run("Full", func(t *testing.T) {
+		config, err := (&TLS{
+			ClientAuth:     "requireAndVerify",
+			ClientCAFile:   certificateFile,
+			MinVersion:     "1.2",
+			CipherSuites:   []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			ReloadInterval: 15 * time.Second,
+		}).NewConfig(reloader)
+
+		require.NoError(err)
+		require.NotNil(config)
+
+		assert.Equal(tls.RequireAndVerifyClientCert, config.ClientAuth)
+		assert.Len(config.ClientCAs.Subjects(), 1)
+		assert.Equal(uint16(tls.VersionTLS12), config.MinVersion)
+		assert.Equal(
+			[]uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+			config.CipherSuites,
+		)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, tlsOptions := range []*TLS{
+			{ClientAuth: "nosuch"},
+			{MinVersion: "0.9"},
+			{CipherSuites: []string{"TLS_NOSUCH_CIPHER"}},
+			{ClientAuth: "verifyIfGiven"},
+			{ClientAuth: "requireAndVerify", ClientCAFile: filepath.Join(directory, "nosuch.pem")},
+			{ClientAuth: "requireAndVerify", ClientCAFile: keyFile},
+		} {
+			t.Logf("%#v", tlsOptions)
+			config, err := tlsOptions.NewConfig(reloader)
+			assert.Nil(config)
+			assert.Error(err)
+		}
+	})
+}
+
+func TestNewCertificateReloaderMissingFiles(t *testing.T) {
+	directory, cleanup := newTestDirectory(t)
+	defer cleanup()
+
+	reloader, err := NewCertificateReloader(filepath.Join(directory, "nosuch.cert"), filepath.Join(directory, "nosuch.key"), time.Minute, nil)
+	assert.Nil(t, reloader)
+	assert.Error(t, err)
+}
+
+func TestCertificateReloader(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		directory, cleanup = newTestDirectory(t)
+	)
+
+	defer cleanup()
+	certificateFile, keyFile := writeTestCertificate(t, directory, "first")
+
+	var (
+		_, logger     = newTestLogger()
+		reloader, err = NewCertificateReloader(certificateFile, keyFile, time.Minute, logger)
+
+		ticks   = make(chan time.Time)
+		hangup  = make(chan os.Signal)
+		stopped = make(chan struct{})
+	)
+
+	require.NoError(err)
+	require.NotNil(reloader)
+	assert.Equal("first", commonName(t, reloader.Certificate()))
+
+	reloader.tick = func(d time.Duration) <-chan time.Time {
+		assert.Equal(time.Minute, d)
+		return ticks
+	}
+
+	reloader.signals = func() (<-chan os.Signal, func()) {
+		return hangup, func() { close(stopped) }
+	}
+
+	var (
+		waitGroup = new(sync.WaitGroup)
+		shutdown  = make(chan struct{})
+	)
+
+	require.NoError(reloader.Run(waitGroup, shutdown))
+
+	// unchanged files are not reloaded
+	original := reloader.Certificate()
+	ticks <- time.Now()
+	ticks <- time.Now()
+	assert.True(original == reloader.Certificate())
+
+	// rotated files are picked up by the next tick
+	writeTestCertificate(t, directory, "second")
+	future := time.Now().Add(time.Minute)
+	require.NoError(os.Chtimes(certificateFile, future, future))
+	ticks <- time.Now()
+	ticks <- time.Now()
+	assert.Equal("second", commonName(t, reloader.Certificate()))
+
+	// a failed reload leaves the current certificate in place
+	require.NoError(ioutil.WriteFile(keyFile, []byte("this is not a key"), 0600))
+	hangup <- os.Interrupt
+	hangup <- os.Interrupt
+	assert.Equal("second", commonName(t, reloader.Certificate()))
+
+	// SIGHUP reloads unconditionally
+	writeTestCertificate(t, directory, "third")
+	hangup <- os.Interrupt
+	ticks <- time.Now()
+	assert.Equal("third", commonName(t, reloader.Certificate()))
+
+	close(shutdown)
+	waitGroup.Wait()
+
+	select {
+	case <-stopped:
+	default:
+		assert.Fail("Signals should have been stopped")
+	}
+}
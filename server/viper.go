@@ -35,6 +35,10 @@ const (
 	// logging information pertinent to the pprof server.
 	PprofSuffix = "pprof"
 
+	// AdminSuffix is the suffix appended to the server name, along with a period (.), for
+	// logging information pertinent to the dedicated admin server.
+	AdminSuffix = "admin"
+
 	// FileFlagName is the name of the command-line flag for specifying an alternate
 	// configuration file for Viper to hunt for.
 	FileFlagName = "file"
@@ -78,6 +82,9 @@ func ConfigureViper(applicationName string, f *pflag.FlagSet, v *viper.Viper) (e
 	v.SetDefault("pprof.name", fmt.Sprintf("%s.%s", applicationName, PprofSuffix))
 	v.SetDefault("pprof.logConnectionState", DefaultLogConnectionState)
 
+	v.SetDefault("admin.name", fmt.Sprintf("%s.%s", applicationName, AdminSuffix))
+	v.SetDefault("admin.logConnectionState", DefaultLogConnectionState)
+
 	configName := applicationName
 	if f != nil {
 		if fileFlag := f.Lookup(FileFlagName); fileFlag != nil {
@@ -150,6 +157,10 @@ is done for the unmarshalled configuration.
 This function always returns a logger, regardless of any errors.  This allows clients to use the returned
 logger when reporting errors.  This function falls back to a logger that writes to os.Stdout if it cannot
 create a logger from the Viper environment.
+
+The returned logger is filtered by the returned WebPA's Levels, which starts out at the configured log level.
+Loggers for individual components, e.g. webPA.Levels.Logger("device", logger), can then have their levels
+changed at runtime through the pprof server.
 */
 func Initialize(applicationName string, arguments []string, f *pflag.FlagSet, v *viper.Viper) (logger logging.Logger, webPA *WebPA, err error) {
 	defer func() {
@@ -177,6 +188,14 @@ func Initialize(applicationName string, arguments []string, f *pflag.FlagSet, v
 		return
 	}
 
-	logger, err = webPA.Log.NewLogger(applicationName)
+	webPA.Levels = logging.NewLevelController(initialLevel(webPA.Log.Level))
+
+	// the LevelController does the filtering, so the underlying logger must write everything
+	factory := webPA.Log
+	factory.Level = "TRACE"
+	if logger, err = factory.NewLogger(applicationName); err == nil {
+		logger = webPA.Levels.Logger("", logger)
+	}
+
 	return
 }
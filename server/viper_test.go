@@ -2,9 +2,11 @@ package server
 
 import (
 	"fmt"
+	"github.com/Comcast/webpa-common/logging"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 )
 
@@ -150,3 +152,18 @@ func TestInitializeWhenWebPANewLoggerError(t *testing.T) {
 	assert.Nil(webPA)
 	assert.NotNil(err)
 }
+
+func TestInitializeLevels(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		logger, webPA, err = Initialize("example", nil, nil, viper.New())
+	)
+
+	require.NoError(err)
+	require.NotNil(webPA)
+	assert.NotNil(logger)
+	require.NotNil(webPA.Levels)
+	assert.Equal(logging.InfoLevel, webPA.Levels.Level())
+}
@@ -10,6 +10,12 @@ import (
 	"github.com/Comcast/webpa-common/health"
 	"github.com/Comcast/webpa-common/logging"
 	"github.com/Comcast/webpa-common/logging/golog"
+	"github.com/Comcast/webpa-common/xmetrics"
+)
+
+const (
+	// LogLevelPath is the path on the pprof server at which a WebPA's log levels are served
+	LogLevelPath = "/logging/level"
 )
 
 var (
@@ -34,31 +40,46 @@ type Secure interface {
 // ListenAndServe invokes the appropriate server method based on the secure information.
 // If Secure.Certificate() returns both a certificateFile and a keyFile, e.ListenAndServeTLS()
 // is called to start the server.  Otherwise, e.ListenAndServe() is used.
+//
+// If the executor is an *http.Server whose TLSConfig supplies certificates via GetCertificate, as
+// with a CertificateReloader, the files are not passed to ListenAndServeTLS.  Otherwise, the server
+// would only ever use the certificate loaded at startup.
 func ListenAndServe(logger logging.Logger, s Secure, e executor) {
 	certificateFile, keyFile := s.Certificate()
 	if len(certificateFile) > 0 && len(keyFile) > 0 {
+		if server, ok := e.(*http.Server); ok && server.TLSConfig != nil && server.TLSConfig.GetCertificate != nil {
+			certificateFile, keyFile = "", ""
+		}
+
 		go func() {
-			logger.Error(
-				e.ListenAndServeTLS(certificateFile, keyFile),
-			)
+			logError(logger, e.ListenAndServeTLS(certificateFile, keyFile))
 		}()
 	} else {
 		go func() {
-			logger.Error(
-				e.ListenAndServe(),
-			)
+			logError(logger, e.ListenAndServe())
 		}()
 	}
 }
 
+// logError logs the error returned by an executor, unless it indicates that the server was shut down
+func logError(logger logging.Logger, err error) {
+	if err != http.ErrServerClosed {
+		logger.Error(err)
+	}
+}
+
 // Basic describes a simple HTTP server.  Typically, this struct has its values
 // injected via Viper.  See the New function in this package.
+//
+// When both CertificateFile and KeyFile are supplied, the server uses TLS as configured by the
+// optional TLS field.
 type Basic struct {
 	Name               string
 	Address            string
 	CertificateFile    string
 	KeyFile            string
 	LogConnectionState bool
+	TLS                *TLS
 }
 
 func (b *Basic) Certificate() (certificateFile, keyFile string) {
@@ -70,12 +91,28 @@ func (b *Basic) Certificate() (certificateFile, keyFile string) {
 // the behavior of http.Server.
 //
 // This method returns nil if the configured address is empty, effectively disabling
-// this server from startup.
+// this server from startup.  It also returns nil if the TLS configuration is invalid, after
+// logging the error.
+//
+// The certificate of a TLS server created by this method is not reloaded.  WebPA.Prepare
+// creates servers whose certificates are reloaded when their files change.
 func (b *Basic) New(logger logging.Logger, handler http.Handler) *http.Server {
-	if len(b.Address) == 0 {
+	server, _, err := b.newServer(logger, handler)
+	if err != nil {
+		logger.Error("Unable to configure TLS for [%s]: %s", b.Name, err)
 		return nil
 	}
 
+	return server
+}
+
+// newServer creates an http.Server along with the CertificateReloader which supplies its certificate.
+// The reloader is nil if the server does not use TLS.
+func (b *Basic) newServer(logger logging.Logger, handler http.Handler) (*http.Server, *CertificateReloader, error) {
+	if len(b.Address) == 0 {
+		return nil, nil, nil
+	}
+
 	server := &http.Server{
 		Addr:     b.Address,
 		Handler:  handler,
@@ -86,7 +123,20 @@ func (b *Basic) New(logger logging.Logger, handler http.Handler) *http.Server {
 		server.ConnState = NewConnectionStateLogger(b.Name, logger)
 	}
 
-	return server
+	var reloader *CertificateReloader
+	if len(b.CertificateFile) > 0 && len(b.KeyFile) > 0 {
+		var err error
+		reloader, err = NewCertificateReloader(b.CertificateFile, b.KeyFile, b.TLS.reloadInterval(), logger)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if server.TLSConfig, err = b.TLS.NewConfig(reloader); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return server, reloader, nil
 }
 
 // Health represents a configurable factory for a Health server.
@@ -108,7 +158,8 @@ func (h *Health) Certificate() (certificateFile, keyFile string) {
 }
 
 // New creates both a health.Health monitor (which is also an HTTP handler) and an HTTP server
-// which services health requests.
+// which services health requests.  Along with the statistics at /health, the server exposes the
+// readiness and liveness of the monitor's health checks at health.ReadyPath and health.LivePath.
 //
 // This method returns nils if the configured Address is empty, which effectively disables
 // the health server.
@@ -130,6 +181,8 @@ func (h *Health) New(logger logging.Logger) (handler *health.Health, server *htt
 
 	mux := http.NewServeMux()
 	mux.Handle("/health", handler)
+	mux.Handle(health.ReadyPath, handler.Checker().ReadyHandler())
+	mux.Handle(health.LivePath, handler.Checker().LiveHandler())
 
 	server = &http.Server{
 		Addr:     h.Address,
@@ -165,6 +218,104 @@ type WebPA struct {
 
 	// Log is the logging configuration for this application.
 	Log golog.LoggerFactory
+
+	// Levels allows the log levels of this application to be changed at runtime.  If set,
+	// it is served at LogLevelPath on the pprof server.  Initialize sets this field.
+	Levels *logging.LevelController `json:"-"`
+
+	// Shutdown configures the graceful shutdown of this application.  If not supplied, defaults are used.
+	Shutdown *Shutdown
+
+	// Drainers are the components, keyed by name, whose long-lived connections are drained during
+	// shutdown, e.g. a device.Manager.
+	Drainers map[string]Drainer `json:"-"`
+
+	// MetricsProvider is the source of the metrics declared by Metrics.  If not supplied, metrics are discarded.
+	MetricsProvider xmetrics.Provider `json:"-"`
+
+	// AdminAuthorization opts in to the admin API, which is served at AdminPath on the pprof server by an
+	// AdminRouter.  Every admin request must pass this decorator, e.g. the Decorate method of a
+	// secure/handler.AuthorizationHandler.  If nil, there is no admin API.
+	AdminAuthorization func(http.Handler) http.Handler `json:"-"`
+
+	// AdminEndpoints are the admin endpoints, keyed by name, contributed by other packages, e.g. kill switches
+	// or device control.  These are mounted along with the standard endpoints: "logging/level" when Levels
+	// is set, "drain", and "maintenance" when there is a health server.  The server/admin package provides
+	// the endpoints for the common components.
+	AdminEndpoints map[string]http.Handler `json:"-"`
+
+	// Admin describes a dedicated server for the admin API.  If its Address is set, the admin API is served
+	// only by this server rather than by the pprof server, so that it can be firewalled separately.  This
+	// server is ignored unless AdminAuthorization is set.
+	Admin Basic
+}
+
+// NewRouter creates a Router for the primary handler whose routes are instrumented with this WebPA's MetricsProvider
+func (w *WebPA) NewRouter() *Router {
+	return NewRouter(w.MetricsProvider)
+}
+
+// newAdminRouter creates the AdminRouter for this WebPA, with the standard endpoints and any AdminEndpoints.
+// If AdminAuthorization is not set, this method returns nil.
+func (w *WebPA) newAdminRouter(logger logging.Logger, lifecycle *Lifecycle, checker *health.Checker) (*AdminRouter, error) {
+	if w.AdminAuthorization == nil {
+		return nil, nil
+	}
+
+	admin, err := NewAdminRouter(logger, w.AdminAuthorization, w.MetricsProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := map[string]http.Handler{"drain": lifecycle.DrainHandler()}
+	if w.Levels != nil {
+		endpoints["logging/level"] = w.Levels
+	}
+
+	if checker != nil {
+		endpoints["maintenance"] = checker.MaintenanceHandler()
+	}
+
+	for name, handler := range w.AdminEndpoints {
+		endpoints[name] = handler
+	}
+
+	for name, handler := range endpoints {
+		if err := admin.Handle(name, handler); err != nil {
+			return nil, err
+		}
+	}
+
+	return admin, nil
+}
+
+// pprofHandler returns the handler for the pprof server, which is http.DefaultServeMux
+// along with the log levels and the admin API, if any
+func (w *WebPA) pprofHandler(admin *AdminRouter) http.Handler {
+	if w.Levels == nil && admin == nil {
+		return http.DefaultServeMux
+	}
+
+	mux := http.NewServeMux()
+	if w.Levels != nil {
+		mux.Handle(LogLevelPath, w.Levels)
+	}
+
+	if admin != nil {
+		mux.Handle(AdminPath, admin)
+		mux.Handle(AdminPath+"/", admin)
+	}
+
+	mux.Handle("/", http.DefaultServeMux)
+	return mux
+}
+
+// adminHandler returns the handler for the dedicated admin server, which serves nothing but the admin API
+func (w *WebPA) adminHandler(admin *AdminRouter) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(AdminPath, admin)
+	mux.Handle(AdminPath+"/", admin)
+	return mux
 }
 
 // Prepare gets a WebPA server ready for execution.  This method does not return errors, but the returned
@@ -173,37 +324,85 @@ type WebPA struct {
 //
 // The supplied http.Handler is used for the primary server.  If the alternate server has an address,
 // it will also be used for that server.  The health server uses an internally create handler, while the pprof
-// server uses http.DefaultServeMux.  The health Monitor created from configuration is returned so that other
-// infrastructure can make use of it.
+// server uses http.DefaultServeMux plus the log level endpoint, if Levels is set, and the admin API, if AdminAuthorization
+// is set and there is no dedicated Admin server.  The health Monitor created from configuration is returned so that other infrastructure can make use of it.
+//
+// The certificates of TLS servers are reloaded when their files change or when the process receives SIGHUP,
+// so that certificates can be rotated without dropping connections.
+//
+// Closing the shutdown channel gracefully shuts down the servers as described by Lifecycle, using the
+// Shutdown configuration and Drainers.  The health server reports not ready and stays up until everything
+// else has drained.  Waiting on the WaitGroup waits for the shutdown to finish, so that an application
+// which uses concurrent.Await with SIGTERM drains before exiting.
 func (w *WebPA) Prepare(logger logging.Logger, primaryHandler http.Handler) (health.Monitor, concurrent.Runnable) {
 	healthHandler, healthServer := w.Health.New(logger)
 	return healthHandler, concurrent.RunnableFunc(func(waitGroup *sync.WaitGroup, shutdown <-chan struct{}) error {
+		var checker *health.Checker
+		if healthHandler != nil {
+			checker = healthHandler.Checker()
+		}
+
+		lifecycle := NewLifecycle(w.Shutdown, logger, checker, w.MetricsProvider)
+		for name, drainer := range w.Drainers {
+			lifecycle.AddDrainer(name, drainer)
+		}
+
 		if healthHandler != nil && healthServer != nil {
 			logger.Info("Starting [%s] on [%s]", w.Health.Name, w.Health.Address)
 			ListenAndServe(logger, &w.Health, healthServer)
+			lifecycle.AddCloser(w.Health.Name, healthServer)
 			healthHandler.Run(waitGroup, shutdown)
 
 			// wrap the primary handler in the RequestTracker decorator
 			primaryHandler = healthHandler.RequestTracker(primaryHandler)
 		}
 
-		if pprofServer := w.Pprof.New(logger, nil); pprofServer != nil {
-			logger.Info("Starting [%s] on [%s]", w.Pprof.Name, w.Pprof.Address)
-			ListenAndServe(logger, &w.Pprof, pprofServer)
+		start := func(b *Basic, handler http.Handler) (bool, error) {
+			server, reloader, err := b.newServer(logger, handler)
+			if err != nil {
+				return false, err
+			} else if server == nil {
+				return false, nil
+			}
+
+			if reloader != nil {
+				reloader.Run(waitGroup, shutdown)
+			}
+
+			logger.Info("Starting [%s] on [%s]", b.Name, b.Address)
+			ListenAndServe(logger, b, server)
+			lifecycle.AddServer(b.Name, server)
+			return true, nil
+		}
+
+		admin, err := w.newAdminRouter(logger, lifecycle, checker)
+		if err != nil {
+			return err
 		}
 
-		if primaryServer := w.Primary.New(logger, primaryHandler); primaryServer != nil {
-			logger.Info("Starting [%s] on [%s]", w.Primary.Name, w.Primary.Address)
-			ListenAndServe(logger, &w.Primary, primaryServer)
-		} else {
+		if admin != nil && len(w.Admin.Address) > 0 {
+			if _, err := start(&w.Admin, w.adminHandler(admin)); err != nil {
+				return err
+			}
+
+			// the admin API is only served on its dedicated port
+			admin = nil
+		}
+
+		if _, err := start(&w.Pprof, w.pprofHandler(admin)); err != nil {
+			return err
+		}
+
+		if started, err := start(&w.Primary, primaryHandler); err != nil {
+			return err
+		} else if !started {
 			return ErrorNoPrimaryAddress
 		}
 
-		if alternateServer := w.Alternate.New(logger, primaryHandler); alternateServer != nil {
-			logger.Info("Starting [%s] on [%s]", w.Alternate.Name, w.Alternate.Address)
-			ListenAndServe(logger, &w.Alternate, alternateServer)
+		if _, err := start(&w.Alternate, primaryHandler); err != nil {
+			return err
 		}
 
-		return nil
+		return lifecycle.Run(waitGroup, shutdown)
 	})
 }
@@ -1,12 +1,17 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
-//	"github.com/Comcast/webpa-common/health"
+	"github.com/Comcast/webpa-common/health"
+	"github.com/Comcast/webpa-common/logging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -205,6 +210,69 @@ func TestBasicNew(t *testing.T) {
 	}
 }
 
+func TestBasicNewTLS(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		directory, cleanup = newTestDirectory(t)
+	)
+
+	defer cleanup()
+	certificateFile, keyFile := writeTestCertificate(t, directory, "test")
+
+	t.Run("Valid", func(t *testing.T) {
+		var (
+			_, logger = newTestLogger()
+			basic     = Basic{
+				Name:            "TestBasicNewTLS",
+				Address:         ":443",
+				CertificateFile: certificateFile,
+				KeyFile:         keyFile,
+				TLS:             &TLS{ClientAuth: "request", MinVersion: "1.2"},
+			}
+
+			server = basic.New(logger, nil)
+		)
+
+		require.NotNil(server)
+		require.NotNil(server.TLSConfig)
+		assert.NotNil(server.TLSConfig.GetCertificate)
+		assert.Equal(tls.RequestClientCert, server.TLSConfig.ClientAuth)
+		assert.Equal(uint16(tls.VersionTLS12), server.TLSConfig.MinVersion)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		var (
+			verify, logger = newTestLogger()
+			basic          = Basic{
+				Name:            "TestBasicNewTLS",
+				Address:         ":443",
+				CertificateFile: certificateFile,
+				KeyFile:         keyFile,
+				TLS:             &TLS{MinVersion: "0.9"},
+			}
+		)
+
+		assert.Nil(basic.New(logger, nil))
+		assertBufferContains(assert, verify, "TestBasicNewTLS", "0.9")
+	})
+
+	t.Run("MissingFiles", func(t *testing.T) {
+		var (
+			_, logger = newTestLogger()
+			basic     = Basic{
+				Name:            "TestBasicNewTLS",
+				Address:         ":443",
+				CertificateFile: filepath.Join(directory, "nosuch.cert"),
+				KeyFile:         filepath.Join(directory, "nosuch.key"),
+			}
+		)
+
+		assert.Nil(basic.New(logger, nil))
+	})
+}
+
 func TestHealthCertificate(t *testing.T) {
 	var (
 		assert   = assert.New(t)
@@ -278,7 +346,7 @@ func TestHealthNew(t *testing.T) {
 
 		var (
 			verify, logger = newTestLogger()
-			health         = Health{
+			h              = Health{
 				Name:               expectedName,
 				Address:            record.address,
 				LogConnectionState: record.logConnectionState,
@@ -286,7 +354,7 @@ func TestHealthNew(t *testing.T) {
 				Options:            record.options,
 			}
 
-			handler, server = health.New(logger)
+			handler, server = h.New(logger)
 		)
 
 		if len(record.address) > 0 {
@@ -296,6 +364,14 @@ func TestHealthNew(t *testing.T) {
 			assert.IsType(expectedHandlerType, server.Handler)
 			assertErrorLog(assert, verify, expectedName, server.ErrorLog)
 
+			response := httptest.NewRecorder()
+			server.Handler.ServeHTTP(response, httptest.NewRequest("GET", health.ReadyPath, nil))
+			assert.Equal(http.StatusOK, response.Code)
+
+			response = httptest.NewRecorder()
+			server.Handler.ServeHTTP(response, httptest.NewRequest("GET", health.LivePath, nil))
+			assert.Equal(http.StatusOK, response.Code)
+
 			if record.logConnectionState {
 				assertConnState(assert, verify, server.ConnState)
 			} else {
@@ -338,6 +414,7 @@ func TestWebPA(t *testing.T) {
 		assert  = assert.New(t)
 		require = require.New(t)
 		handler = new(mockHandler)
+		drained = false
 
 		// synthesize a WebPA instance that will start everything,
 		// close to how it would be unmarshalled from Viper.
@@ -360,6 +437,12 @@ func TestWebPA(t *testing.T) {
 				Name:    "test.pprof",
 				Address: ":0",
 			},
+			Drainers: map[string]Drainer{
+				"test.drainer": DrainerFunc(func(context.Context) error {
+					drained = true
+					return nil
+				}),
+			},
 		}
 
 		_, logger         = newTestLogger()
@@ -375,7 +458,53 @@ func TestWebPA(t *testing.T) {
 	)
 
 	assert.Nil(runnable.Run(waitGroup, shutdown))
+	assert.False(drained)
 	close(shutdown)
-	waitGroup.Wait() // the http.Server instances will still be running after this returns
+	waitGroup.Wait() // the http.Server instances are shut down by the time this returns
+	assert.True(drained)
+	handler.AssertExpectations(t)
+}
+
+func TestWebPAInvalidTLS(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		handler = new(mockHandler)
+		webPA   = WebPA{
+			Primary: Basic{
+				Name:            "test",
+				Address:         ":0",
+				CertificateFile: "nosuch.cert",
+				KeyFile:         "nosuch.key",
+			},
+		}
+
+		_, logger   = newTestLogger()
+		_, runnable = webPA.Prepare(logger, handler)
+
+		waitGroup = new(sync.WaitGroup)
+		shutdown  = make(chan struct{})
+	)
+
+	defer close(shutdown)
+	assert.Error(runnable.Run(waitGroup, shutdown))
+	waitGroup.Wait()
 	handler.AssertExpectations(t)
 }
+
+func TestWebPAPprofHandler(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		webPA  = WebPA{}
+	)
+
+	assert.Equal(http.DefaultServeMux, webPA.pprofHandler(nil))
+
+	webPA.Levels = logging.NewLevelController(logging.InfoLevel)
+	handler := webPA.pprofHandler(nil)
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("PUT", LogLevelPath+"?level=debug&component=device", nil))
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal(logging.DebugLevel, webPA.Levels.ComponentLevel("device"))
+	assert.Equal(logging.InfoLevel, webPA.Levels.Level())
+}
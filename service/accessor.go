@@ -22,9 +22,16 @@ var (
 // to the URL.  All base URLs returned by this function are guaranteed to have a
 // scheme, host, and port.
 //
-// The go.serversets library returns endpoints in this format.  This function is
+// The go.serversets library returns endpoints in this format, with any scheme inside the
+// brackets, e.g. "[https://host]:8080".  Values with the scheme outside the host and port,
+// e.g. "https://[fe80::1]:8080" as produced for Consul, are also accepted.  This function is
 // used to turn and endpoint into a valid base URL for a given service.
 func ParseHostPort(value string) (baseURL string, err error) {
+	scheme := "http"
+	if index := strings.Index(value, "://"); index > 0 && value[0] != '[' {
+		scheme, value = value[:index], value[index+3:]
+	}
+
 	var host, portString string
 	host, portString, err = net.SplitHostPort(value)
 	if err != nil {
@@ -34,7 +41,7 @@ func ParseHostPort(value string) (baseURL string, err error) {
 	if strings.Contains(host, "://") {
 		baseURL = fmt.Sprintf("%s:%s", host, portString)
 	} else {
-		baseURL = fmt.Sprintf("http://%s:%s", host, portString)
+		baseURL = fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, portString))
 	}
 
 	return
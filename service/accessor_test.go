@@ -20,6 +20,10 @@ func TestParseHostPort(t *testing.T) {
 			{"localhost:8080", "http://localhost:8080", false},
 			{"[http://something.comcast.net]:8080", "http://something.comcast.net:8080", false},
 			{"[https://65.71.145.16]:8080", "https://65.71.145.16:8080", false},
+			{"https://something.comcast.net:8080", "https://something.comcast.net:8080", false},
+			{"https://[fe80::1]:8080", "https://[fe80::1]:8080", false},
+			{"[fe80::1]:8080", "http://[fe80::1]:8080", false},
+			{"https://something.comcast.net", "", true},
 			{"", "", true},
 			{"localhost", "", true},
 			{"something.comcast.net", "", true},
@@ -0,0 +1,531 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Comcast/webpa-common/logging"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ConsulTokenHeader is the header carrying the ACL token of requests to a Consul agent
+	ConsulTokenHeader = "X-Consul-Token"
+
+	// ConsulIndexHeader is the header carrying the index used by Consul blocking queries
+	ConsulIndexHeader = "X-Consul-Index"
+
+	// consulWaitTime is the longest time a Consul blocking query waits for a change
+	consulWaitTime = 5 * time.Minute
+)
+
+// consulService is the service definition registered with a Consul agent
+type consulService struct {
+	ID      string       `json:"ID"`
+	Name    string       `json:"Name"`
+	Address string       `json:"Address"`
+	Port    int          `json:"Port"`
+	Tags    []string     `json:"Tags"`
+	Check   *consulCheck `json:"Check,omitempty"`
+}
+
+// consulCheck is a TTL health check, whose status is reported by the registering node
+type consulCheck struct {
+	CheckID string `json:"CheckID"`
+	Name    string `json:"Name"`
+	TTL     string `json:"TTL"`
+}
+
+// consulServiceEntry is the subset of each entry returned by the Consul health endpoint used by this package
+type consulServiceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+
+	Service consulService `json:"Service"`
+}
+
+// endpoint produces the watched endpoint for this entry, in the same form as go.serversets.  The scheme is
+// carried in the service tags, since Consul has no notion of one.
+func (e *consulServiceEntry) endpoint() string {
+	address := e.Service.Address
+	if len(address) == 0 {
+		address = e.Node.Address
+	}
+
+	scheme := DefaultScheme
+	for _, tag := range e.Service.Tags {
+		if _, ok := defaultPorts[tag]; ok {
+			scheme = tag
+			break
+		}
+	}
+
+	return scheme + "://" + net.JoinHostPort(address, strconv.Itoa(e.Service.Port))
+}
+
+// consulRegistration is a service registered by this node, along with the goroutine reporting its health
+type consulRegistration struct {
+	id       string
+	checkID  string
+	shutdown chan struct{}
+	stopped  sync.WaitGroup
+}
+
+// consulDiscovery is the Discovery implementation for ConsulBackend.  It talks to a Consul agent
+// via its HTTP API.  Each registration has a TTL check, which is kept up to date with the result
+// of the PingFunc.
+type consulDiscovery struct {
+	logger            logging.Logger
+	client            *http.Client
+	address           string
+	token             string
+	serviceName       string
+	pingFunc          func() error
+	checkInterval     time.Duration
+	reconnectDelay    time.Duration
+	maxReconnectDelay time.Duration
+
+	lock          sync.Mutex
+	registrations map[string]*consulRegistration
+}
+
+func newConsulDiscovery(o *Options) *consulDiscovery {
+	return &consulDiscovery{
+		logger:            o.logger(),
+		client:            http.DefaultClient,
+		address:           o.consulAddress(),
+		token:             o.consulToken(),
+		serviceName:       o.serviceName(),
+		pingFunc:          o.pingFunc(),
+		checkInterval:     o.checkInterval(),
+		reconnectDelay:    o.reconnectDelay(),
+		maxReconnectDelay: o.maxReconnectDelay(),
+		registrations:     make(map[string]*consulRegistration),
+	}
+}
+
+// send sends a request to the Consul agent, returning the response regardless of its status.  A []byte body
+// is sent as is, while any other body is encoded as JSON.
+func (c *consulDiscovery) send(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequest(method, c.address+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.token) > 0 {
+		request.Header.Set(ConsulTokenHeader, c.token)
+	}
+
+	return c.client.Do(request.WithContext(ctx))
+}
+
+// do sends a request to the Consul agent, returning the response if its status is 200
+func (c *consulDiscovery) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	response, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, c.statusError(method, path, response)
+	}
+
+	return response, nil
+}
+
+// statusError produces the error for an unexpected response status, consuming the response
+func (c *consulDiscovery) statusError(method, path string, response *http.Response) error {
+	message, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	return fmt.Errorf("Consul request %s %s returned status %d: %s", method, path, response.StatusCode, bytes.TrimSpace(message))
+}
+
+// put sends a PUT to the Consul agent, discarding the response body
+func (c *consulDiscovery) put(path string, body interface{}) error {
+	response, err := c.do(context.Background(), http.MethodPut, path, body)
+	if err != nil {
+		return err
+	}
+
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+	return nil
+}
+
+func (c *consulDiscovery) Register(registration string) error {
+	host, port, err := ParseRegistration(registration)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.registrations[registration]; ok {
+		return ErrorAlreadyRegistered
+	}
+
+	var (
+		hostParts = strings.SplitN(host, "://", 2)
+		id        = fmt.Sprintf("%s-%s-%d", c.serviceName, hostParts[1], port)
+		r         = &consulRegistration{
+			id:       id,
+			checkID:  "service:" + id,
+			shutdown: make(chan struct{}),
+		}
+	)
+
+	err = c.put(
+		"/v1/agent/service/register",
+		&consulService{
+			ID:      id,
+			Name:    c.serviceName,
+			Address: hostParts[1],
+			Port:    int(port),
+			Tags:    []string{hostParts[0]},
+			Check: &consulCheck{
+				CheckID: r.checkID,
+				Name:    c.serviceName + " ping",
+				TTL:     (3 * c.checkInterval).String(),
+			},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	c.registrations[registration] = r
+	r.stopped.Add(1)
+	go c.report(r)
+	return nil
+}
+
+// report updates the TTL check of a registration with the result of the PingFunc, immediately
+// and then at the check interval, until the registration is withdrawn
+func (c *consulDiscovery) report(r *consulRegistration) {
+	defer r.stopped.Done()
+	ticker := time.NewTicker(c.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		path := "/v1/agent/check/pass/" + url.PathEscape(r.checkID)
+		if c.pingFunc != nil {
+			if pingErr := c.pingFunc(); pingErr != nil {
+				path = "/v1/agent/check/fail/" + url.PathEscape(r.checkID) + "?note=" + url.QueryEscape(pingErr.Error())
+			}
+		}
+
+		if err := c.put(path, nil); err != nil {
+			c.logger.Error("Unable to update Consul check %s: %s", r.checkID, err)
+		}
+
+		select {
+		case <-r.shutdown:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *consulDiscovery) Deregister(registration string) error {
+	c.lock.Lock()
+	r, ok := c.registrations[registration]
+	delete(c.registrations, registration)
+	c.lock.Unlock()
+
+	if !ok {
+		return ErrorNotRegistered
+	}
+
+	close(r.shutdown)
+	r.stopped.Wait()
+	return c.put("/v1/agent/service/deregister/"+url.PathEscape(r.id), nil)
+}
+
+// query fetches the healthy instances of the service.  If index is nonzero, this is a blocking
+// query which waits for the instances to change from those at that index.
+func (c *consulDiscovery) query(ctx context.Context, index uint64) ([]string, uint64, error) {
+	path := fmt.Sprintf(
+		"/v1/health/service/%s?passing=true&index=%d&wait=%s",
+		url.PathEscape(c.serviceName),
+		index,
+		consulWaitTime,
+	)
+
+	response, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer response.Body.Close()
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(response.Body).Decode(&entries); err != nil {
+		return nil, 0, err
+	}
+
+	newIndex, err := strconv.ParseUint(response.Header.Get(ConsulIndexHeader), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Invalid %s header: %s", ConsulIndexHeader, err)
+	}
+
+	endpoints := make([]string, 0, len(entries))
+	for index := range entries {
+		endpoints = append(endpoints, entries[index].endpoint())
+	}
+
+	sort.Strings(endpoints)
+	return endpoints, newIndex, nil
+}
+
+func (c *consulDiscovery) Watch() (Watch, error) {
+	return newReconnectingWatch(c.logger, c.newWatch, c.reconnectDelay, c.maxReconnectDelay)
+}
+
+// newWatch creates a single Consul watch, which closes itself if a query fails
+func (c *consulDiscovery) newWatch() (Watch, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	endpoints, index, err := c.query(ctx, 0)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	w := &consulWatch{
+		discovery: c,
+		ctx:       ctx,
+		cancel:    cancel,
+		event:     make(chan struct{}, 1),
+		endpoints: endpoints,
+	}
+
+	w.stopped.Add(1)
+	go w.monitor(index)
+	return w, nil
+}
+
+// consulWatch is a Watch driven by Consul blocking queries
+type consulWatch struct {
+	discovery *consulDiscovery
+	ctx       context.Context
+	cancel    func()
+	event     chan struct{}
+	stopped   sync.WaitGroup
+
+	lock      sync.RWMutex
+	endpoints []string
+}
+
+// monitor runs blocking queries until this watch is closed or a query fails
+func (w *consulWatch) monitor(index uint64) {
+	defer w.stopped.Done()
+	defer close(w.event)
+	defer w.cancel()
+
+	for {
+		endpoints, newIndex, err := w.discovery.query(w.ctx, index)
+		if err != nil {
+			if w.ctx.Err() == nil {
+				w.discovery.logger.Error("Consul watch failed: %s", err)
+			}
+
+			return
+		}
+
+		if newIndex == index {
+			// the blocking query timed out with no changes
+			continue
+		} else if newIndex < index {
+			// the index went backwards, e.g. the agent was restarted, so start over
+			newIndex = 0
+		}
+
+		index = newIndex
+		w.lock.Lock()
+		w.endpoints = endpoints
+		w.lock.Unlock()
+
+		select {
+		case w.event <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *consulWatch) Close() {
+	w.cancel()
+	w.stopped.Wait()
+}
+
+func (w *consulWatch) IsClosed() bool {
+	return w.ctx.Err() != nil
+}
+
+func (w *consulWatch) Event() <-chan struct{} {
+	return w.event
+}
+
+func (w *consulWatch) Endpoints() []string {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.endpoints
+}
+
+// metadataPath is the path of a metadata key in the Consul KV store.  Keys are scoped by service name.
+func (c *consulDiscovery) metadataPath(key string) string {
+	return "/v1/kv/" + url.PathEscape(c.serviceName) + "/" + strings.TrimLeft(key, "/")
+}
+
+func (c *consulDiscovery) PutMetadata(key string, value []byte) error {
+	return c.put(c.metadataPath(key), value)
+}
+
+// getMetadata fetches a metadata value, which is nil if the key does not exist.  If index is nonzero, this
+// is a blocking query which waits for the value to change from that at that index.
+func (c *consulDiscovery) getMetadata(ctx context.Context, key string, index uint64) ([]byte, uint64, error) {
+	path := fmt.Sprintf("%s?raw&index=%d&wait=%s", c.metadataPath(key), index, consulWaitTime)
+	response, err := c.send(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var value []byte
+	switch response.StatusCode {
+	case http.StatusOK:
+		value, err = ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+
+	case http.StatusNotFound:
+		// a missing key still carries an index, which can be used to wait for the key to be created
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+
+	default:
+		return nil, 0, c.statusError(http.MethodGet, path, response)
+	}
+
+	newIndex, err := strconv.ParseUint(response.Header.Get(ConsulIndexHeader), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Invalid %s header: %s", ConsulIndexHeader, err)
+	}
+
+	return value, newIndex, nil
+}
+
+func (c *consulDiscovery) WatchMetadata(key string) (MetadataWatch, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	value, index, err := c.getMetadata(ctx, key, 0)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	w := &consulMetadataWatch{
+		discovery: c,
+		key:       key,
+		ctx:       ctx,
+		cancel:    cancel,
+		event:     make(chan struct{}, 1),
+		value:     value,
+	}
+
+	w.stopped.Add(1)
+	go w.monitor(index)
+	return w, nil
+}
+
+// consulMetadataWatch is a MetadataWatch driven by Consul blocking queries against the KV store
+type consulMetadataWatch struct {
+	discovery *consulDiscovery
+	key       string
+	ctx       context.Context
+	cancel    func()
+	event     chan struct{}
+	stopped   sync.WaitGroup
+
+	lock  sync.RWMutex
+	value []byte
+}
+
+// monitor runs blocking queries until this watch is closed or a query fails
+func (w *consulMetadataWatch) monitor(index uint64) {
+	defer w.stopped.Done()
+	defer close(w.event)
+	defer w.cancel()
+
+	for {
+		value, newIndex, err := w.discovery.getMetadata(w.ctx, w.key, index)
+		if err != nil {
+			if w.ctx.Err() == nil {
+				w.discovery.logger.Error("Consul metadata watch on %s failed: %s", w.key, err)
+			}
+
+			return
+		}
+
+		if newIndex == index {
+			// the blocking query timed out with no changes
+			continue
+		} else if newIndex < index {
+			// the index went backwards, e.g. the agent was restarted, so start over
+			newIndex = 0
+		}
+
+		index = newIndex
+		w.lock.Lock()
+		w.value = value
+		w.lock.Unlock()
+
+		select {
+		case w.event <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *consulMetadataWatch) Close() {
+	w.cancel()
+	w.stopped.Wait()
+}
+
+func (w *consulMetadataWatch) IsClosed() bool {
+	return w.ctx.Err() != nil
+}
+
+func (w *consulMetadataWatch) Event() <-chan struct{} {
+	return w.event
+}
+
+func (w *consulMetadataWatch) Value() []byte {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.value
+}
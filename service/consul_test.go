@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsul is a minimal Consul agent which serves the endpoints used by consulDiscovery
+type fakeConsul struct {
+	t     *testing.T
+	lock  sync.Mutex
+	index uint64
+
+	tokens   []string
+	services map[string]consulService
+	checks   map[string]string
+	kv       map[string][]byte
+	changed  chan struct{}
+}
+
+func newFakeConsul(t *testing.T) *fakeConsul {
+	return &fakeConsul{
+		t:        t,
+		index:    1,
+		services: make(map[string]consulService),
+		checks:   make(map[string]string),
+		kv:       make(map[string][]byte),
+		changed:  make(chan struct{}),
+	}
+}
+
+// change bumps the index and wakes any blocking queries.  The lock must be held.
+func (f *fakeConsul) change() {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) checkStatus(checkID string) string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.checks[checkID]
+}
+
+func (f *fakeConsul) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	f.lock.Lock()
+	f.tokens = append(f.tokens, request.Header.Get(ConsulTokenHeader))
+	path := request.URL.Path
+
+	switch {
+	case path == "/v1/agent/service/register":
+		var service consulService
+		if err := json.NewDecoder(request.Body).Decode(&service); err != nil {
+			f.lock.Unlock()
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		f.services[service.ID] = service
+		f.checks[service.Check.CheckID] = "critical"
+		f.change()
+		f.lock.Unlock()
+
+	case strings.HasPrefix(path, "/v1/agent/service/deregister/"):
+		id := strings.TrimPrefix(path, "/v1/agent/service/deregister/")
+		delete(f.services, id)
+		delete(f.checks, "service:"+id)
+		f.change()
+		f.lock.Unlock()
+
+	case strings.HasPrefix(path, "/v1/agent/check/"):
+		parts := strings.SplitN(strings.TrimPrefix(path, "/v1/agent/check/"), "/", 2)
+		status := "passing"
+		if parts[0] == "fail" {
+			status = "critical"
+		}
+
+		if f.checks[parts[1]] != status {
+			f.checks[parts[1]] = status
+			f.change()
+		}
+
+		f.lock.Unlock()
+
+	case strings.HasPrefix(path, "/v1/health/service/"):
+		index, _ := strconv.ParseUint(request.URL.Query().Get("index"), 10, 64)
+		if index == f.index {
+			changed := f.changed
+			f.lock.Unlock()
+			select {
+			case <-changed:
+			case <-request.Context().Done():
+				return
+			}
+
+			f.lock.Lock()
+		}
+
+		entries := []consulServiceEntry{}
+		for _, service := range f.services {
+			if f.checks[service.Check.CheckID] == "passing" {
+				var entry consulServiceEntry
+				entry.Node.Address = "node.comcast.net"
+				entry.Service = service
+				entries = append(entries, entry)
+			}
+		}
+
+		response.Header().Set(ConsulIndexHeader, strconv.FormatUint(f.index, 10))
+		f.lock.Unlock()
+		json.NewEncoder(response).Encode(entries)
+
+	case strings.HasPrefix(path, "/v1/kv/") && request.Method == http.MethodPut:
+		value, _ := ioutil.ReadAll(request.Body)
+		f.kv[strings.TrimPrefix(path, "/v1/kv/")] = value
+		f.change()
+		f.lock.Unlock()
+		response.Write([]byte("true"))
+
+	case strings.HasPrefix(path, "/v1/kv/"):
+		index, _ := strconv.ParseUint(request.URL.Query().Get("index"), 10, 64)
+		if index == f.index {
+			changed := f.changed
+			f.lock.Unlock()
+			select {
+			case <-changed:
+			case <-request.Context().Done():
+				return
+			}
+
+			f.lock.Lock()
+		}
+
+		value, ok := f.kv[strings.TrimPrefix(path, "/v1/kv/")]
+		response.Header().Set(ConsulIndexHeader, strconv.FormatUint(f.index, 10))
+		f.lock.Unlock()
+		if !ok {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		response.Write(value)
+
+	default:
+		f.lock.Unlock()
+		response.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestConsulServiceEntryEndpoint(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		entry  consulServiceEntry
+	)
+
+	entry.Node.Address = "node.comcast.net"
+	entry.Service.Port = 8080
+	assert.Equal("http://node.comcast.net:8080", entry.endpoint())
+
+	entry.Service.Address = "service.comcast.net"
+	entry.Service.Tags = []string{"something", "https"}
+	assert.Equal("https://service.comcast.net:8080", entry.endpoint())
+
+	entry.Service.Address = "fe80::1"
+	assert.Equal("https://[fe80::1]:8080", entry.endpoint())
+}
+
+func TestConsulDiscovery(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		consul  = newFakeConsul(t)
+		server  = httptest.NewServer(consul)
+
+		d = newConsulDiscovery(&Options{
+			Logger:        logging.TestLogger(t),
+			Backend:       ConsulBackend,
+			ConsulAddress: server.URL + "/",
+			ConsulToken:   "token",
+			ServiceName:   "consul",
+			CheckInterval: time.Hour,
+		})
+	)
+
+	defer server.Close()
+
+	w, err := d.Watch()
+	require.NotNil(w)
+	require.NoError(err)
+	defer w.Close()
+	assert.Empty(w.Endpoints())
+
+	waitForEndpoints := func(expected []string) {
+		timeout := time.After(5 * time.Second)
+		for {
+			if actual := w.Endpoints(); reflect.DeepEqual(expected, actual) {
+				return
+			}
+
+			select {
+			case <-w.Event():
+			case <-timeout:
+				assert.Fail("Endpoints not updated", "expected %v, actual %v", expected, w.Endpoints())
+				return
+			}
+		}
+	}
+
+	require.NoError(d.Register("https://node1.comcast.net:8080"))
+	assert.Equal(ErrorAlreadyRegistered, d.Register("https://node1.comcast.net:8080"))
+	require.NoError(d.Register("node2.comcast.net:8081"))
+	waitForEndpoints([]string{"http://node2.comcast.net:8081", "https://node1.comcast.net:8080"})
+	assert.Equal("passing", consul.checkStatus("service:consul-node1.comcast.net-8080"))
+
+	assert.NoError(d.Deregister("https://node1.comcast.net:8080"))
+	assert.Equal(ErrorNotRegistered, d.Deregister("https://node1.comcast.net:8080"))
+	waitForEndpoints([]string{"http://node2.comcast.net:8081"})
+
+	assert.NoError(d.Deregister("node2.comcast.net:8081"))
+	waitForEndpoints([]string{})
+
+	consul.lock.Lock()
+	for _, token := range consul.tokens {
+		assert.Equal("token", token)
+	}
+
+	consul.lock.Unlock()
+}
+
+func TestConsulDiscoveryPingFailure(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		consul = newFakeConsul(t)
+		server = httptest.NewServer(consul)
+
+		d = newConsulDiscovery(&Options{
+			Logger:        logging.TestLogger(t),
+			ConsulAddress: server.URL,
+			ServiceName:   "consul",
+			CheckInterval: time.Hour,
+			PingFunc:      func() error { return errors.New("expected") },
+		})
+	)
+
+	defer server.Close()
+	assert.NoError(d.Register("http://node1.comcast.net:8080"))
+
+	timeout := time.After(5 * time.Second)
+	for consul.checkStatus("service:consul-node1.comcast.net-8080") != "critical" {
+		select {
+		case <-timeout:
+			assert.Fail("The check was not failed")
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	endpoints, _, err := d.query(context.Background(), 0)
+	assert.Empty(endpoints)
+	assert.NoError(err)
+	assert.NoError(d.Deregister("http://node1.comcast.net:8080"))
+}
+
+func TestConsulDiscoveryUnavailable(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		server = httptest.NewServer(http.NotFoundHandler())
+
+		d = newConsulDiscovery(&Options{
+			Logger:        logging.TestLogger(t),
+			ConsulAddress: server.URL,
+		})
+	)
+
+	defer server.Close()
+
+	w, err := d.Watch()
+	assert.Nil(w)
+	assert.Error(err)
+
+	assert.Error(d.Register("http://node1.comcast.net:8080"))
+	assert.Equal(ErrorNotRegistered, d.Deregister("http://node1.comcast.net:8080"))
+}
+
+func TestConsulDiscoveryMetadata(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		consul  = newFakeConsul(t)
+		server  = httptest.NewServer(consul)
+
+		d = newConsulDiscovery(&Options{
+			Logger:        logging.TestLogger(t),
+			ConsulAddress: server.URL,
+			ServiceName:   "consul",
+		})
+	)
+
+	defer server.Close()
+
+	store, err := NewMetadataStore(d)
+	require.NoError(err)
+
+	w, err := store.WatchMetadata("topology")
+	require.NotNil(w)
+	require.NoError(err)
+	assert.Nil(w.Value())
+	assert.False(w.IsClosed())
+
+	waitForValue := func(expected string) {
+		timeout := time.After(5 * time.Second)
+		for string(w.Value()) != expected {
+			select {
+			case <-w.Event():
+			case <-timeout:
+				assert.Fail("Value not updated", "expected %s, actual %s", expected, w.Value())
+				return
+			}
+		}
+	}
+
+	require.NoError(store.PutMetadata("topology", []byte(`{"version": 1}`)))
+	waitForValue(`{"version": 1}`)
+
+	require.NoError(store.PutMetadata("/topology", []byte(`{"version": 2}`)))
+	waitForValue(`{"version": 2}`)
+
+	consul.lock.Lock()
+	assert.Equal([]byte(`{"version": 2}`), consul.kv["consul/topology"])
+	consul.lock.Unlock()
+
+	w.Close()
+	assert.True(w.IsClosed())
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/strava/go.serversets"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorNotRegistered     = errors.New("That registration has not been registered")
+	ErrorAlreadyRegistered = errors.New("That registration has already been registered")
+)
+
+// Discovery registers this node with a service discovery backend and watches the healthy instances
+// of the service, independent of the backend in use.  Registrations have the form accepted by
+// ParseRegistration, and the endpoints of a Watch have the form accepted by ParseHostPort, so a
+// Discovery can drive an UpdatableAccessor via a Subscription.
+//
+// Watches produced by a Discovery are reestablished, with exponential backoff, when they are lost.
+type Discovery interface {
+	Watcher
+
+	// Register announces this node under the given registration, e.g. "https://node1.comcast.net:8080"
+	Register(registration string) error
+
+	// Deregister withdraws a registration made with Register
+	Deregister(registration string) error
+}
+
+// NewDiscovery creates the Discovery for the configured backend.  Registrations are not made by this
+// function.  Use RegisterAllWith for that.
+//
+// Because of limitations with the underlying go.serversets library, this function should be called
+// at most once per process when using ZookeeperBackend.
+func NewDiscovery(o *Options) (Discovery, error) {
+	switch backend := o.backend(); backend {
+	case ZookeeperBackend:
+		return newZookeeperDiscovery(o, NewRegistrar(o)), nil
+
+	case ConsulBackend:
+		return newConsulDiscovery(o), nil
+
+	default:
+		return nil, fmt.Errorf("Unsupported service discovery backend: %s", backend)
+	}
+}
+
+// RegisterAllWith registers all the registrations found in o.Registrations with the given Discovery.
+// If any registration fails, the registrations already made are withdrawn.
+func RegisterAllWith(d Discovery, o *Options) error {
+	logger := o.logger()
+	for index, registration := range o.registrations() {
+		logger.Info("Registering: %s", registration)
+		if err := d.Register(registration); err != nil {
+			for _, previous := range o.registrations()[:index] {
+				d.Deregister(previous)
+			}
+
+			return fmt.Errorf("Unable to register %s: %s", registration, err)
+		}
+	}
+
+	return nil
+}
+
+// zookeeperDiscovery is the Discovery implementation for ZookeeperBackend, which delegates to a Registrar
+type zookeeperDiscovery struct {
+	logger            logging.Logger
+	registrar         Registrar
+	pingFunc          func() error
+	reconnectDelay    time.Duration
+	maxReconnectDelay time.Duration
+
+	lock      sync.Mutex
+	endpoints map[string]*serversets.Endpoint
+}
+
+func newZookeeperDiscovery(o *Options, registrar Registrar) *zookeeperDiscovery {
+	return &zookeeperDiscovery{
+		logger:            o.logger(),
+		registrar:         registrar,
+		pingFunc:          o.pingFunc(),
+		reconnectDelay:    o.reconnectDelay(),
+		maxReconnectDelay: o.maxReconnectDelay(),
+		endpoints:         make(map[string]*serversets.Endpoint),
+	}
+}
+
+func (z *zookeeperDiscovery) Register(registration string) error {
+	host, port, err := ParseRegistration(registration)
+	if err != nil {
+		return err
+	}
+
+	z.lock.Lock()
+	defer z.lock.Unlock()
+
+	if _, ok := z.endpoints[registration]; ok {
+		return ErrorAlreadyRegistered
+	}
+
+	endpoint, err := z.registrar.RegisterEndpoint(host, int(port), z.pingFunc)
+	if err != nil {
+		return err
+	}
+
+	z.endpoints[registration] = endpoint
+	return nil
+}
+
+func (z *zookeeperDiscovery) Deregister(registration string) error {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+
+	endpoint, ok := z.endpoints[registration]
+	if !ok {
+		return ErrorNotRegistered
+	}
+
+	delete(z.endpoints, registration)
+	if endpoint != nil {
+		endpoint.Close()
+	}
+
+	return nil
+}
+
+func (z *zookeeperDiscovery) Watch() (Watch, error) {
+	return newReconnectingWatch(z.logger, z.registrar.Watch, z.reconnectDelay, z.maxReconnectDelay)
+}
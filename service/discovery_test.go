@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewDiscovery(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := NewDiscovery(&Options{Backend: ConsulBackend, Logger: logging.TestLogger(t)})
+	assert.NotNil(d)
+	assert.NoError(err)
+	assert.IsType(&consulDiscovery{}, d)
+
+	d, err = NewDiscovery(&Options{Backend: "nosuch", Logger: logging.TestLogger(t)})
+	assert.Nil(d)
+	assert.Error(err)
+}
+
+func TestZookeeperDiscovery(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		require       = require.New(t)
+		registrar     = new(mockRegistrar)
+		expectedError = errors.New("expected")
+
+		d = newZookeeperDiscovery(&Options{Logger: logging.TestLogger(t)}, registrar)
+	)
+
+	registrar.On("RegisterEndpoint", "https://node1.comcast.net", 8080, mock.MatchedBy(nilPingFunc)).Return(nil, nil).Once()
+	registrar.On("RegisterEndpoint", "http://node2.comcast.net", 80, mock.MatchedBy(nilPingFunc)).Return(nil, expectedError).Once()
+
+	assert.Error(d.Register("http://node1.comcast.net:99999"))
+	assert.Equal(ErrorNotRegistered, d.Deregister("https://node1.comcast.net:8080"))
+
+	require.NoError(d.Register("https://node1.comcast.net:8080"))
+	assert.Equal(ErrorAlreadyRegistered, d.Register("https://node1.comcast.net:8080"))
+	assert.Equal(expectedError, d.Register("http://node2.comcast.net"))
+
+	assert.NoError(d.Deregister("https://node1.comcast.net:8080"))
+	assert.Equal(ErrorNotRegistered, d.Deregister("https://node1.comcast.net:8080"))
+
+	registrar.AssertExpectations(t)
+}
+
+func TestZookeeperDiscoveryWatch(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		require       = require.New(t)
+		registrar     = new(mockRegistrar)
+		expectedError = errors.New("expected")
+
+		d = newZookeeperDiscovery(&Options{Logger: logging.TestLogger(t)}, registrar)
+	)
+
+	registrar.On("Watch").Return(nil, expectedError).Once()
+	w, err := d.Watch()
+	assert.Nil(w)
+	assert.Equal(expectedError, err)
+
+	var (
+		delegate = new(mockWatch)
+		event    = make(chan struct{})
+	)
+
+	delegate.On("Endpoints").Return([]string{"http://node1.comcast.net:8080"}).Once()
+	delegate.On("Event").Return((<-chan struct{})(event))
+	delegate.On("Close").Once()
+	registrar.On("Watch").Return(delegate, nil).Once()
+
+	w, err = d.Watch()
+	require.NotNil(w)
+	require.NoError(err)
+	assert.Equal([]string{"http://node1.comcast.net:8080"}, w.Endpoints())
+	assert.False(w.IsClosed())
+
+	w.Close()
+	assert.True(w.IsClosed())
+
+	registrar.AssertExpectations(t)
+	delegate.AssertExpectations(t)
+}
+
+func TestRegisterAllWith(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		registrar     = new(mockRegistrar)
+		expectedError = errors.New("expected")
+
+		o = &Options{
+			Logger:        logging.TestLogger(t),
+			Registrations: []string{"https://node1.comcast.net:8080", "http://node2.comcast.net"},
+		}
+
+		d = newZookeeperDiscovery(o, registrar)
+	)
+
+	registrar.On("RegisterEndpoint", "https://node1.comcast.net", 8080, mock.MatchedBy(nilPingFunc)).Return(nil, nil).Twice()
+	registrar.On("RegisterEndpoint", "http://node2.comcast.net", 80, mock.MatchedBy(nilPingFunc)).Return(nil, nil).Once()
+	assert.NoError(RegisterAllWith(d, o))
+	assert.Len(d.endpoints, 2)
+
+	// a failed registration withdraws the previous ones
+	d = newZookeeperDiscovery(o, registrar)
+	registrar.On("RegisterEndpoint", "http://node2.comcast.net", 80, mock.MatchedBy(nilPingFunc)).Return(nil, expectedError).Once()
+	assert.Error(RegisterAllWith(d, o))
+	assert.Empty(d.endpoints)
+
+	registrar.AssertExpectations(t)
+}
@@ -1,4 +1,5 @@
 /*
-Package service provides basic integration with go.serversets
+Package service provides basic integration with go.serversets, along with a backend-neutral
+Discovery API with ZooKeeper and Consul implementations.
 */
 package service
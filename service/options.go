@@ -17,6 +17,18 @@ const (
 	DefaultEnvironment   = serversets.Local
 	DefaultServiceName   = "test"
 	DefaultVnodeCount    = 211
+
+	// ZookeeperBackend is the Backend which registers and watches endpoints via go.serversets.  This is the default.
+	ZookeeperBackend = "zookeeper"
+
+	// ConsulBackend is the Backend which registers and watches endpoints via the HTTP API of a Consul agent
+	ConsulBackend = "consul"
+
+	DefaultBackend           = ZookeeperBackend
+	DefaultConsulAddress     = "http://localhost:8500"
+	DefaultCheckInterval     = 10 * time.Second
+	DefaultReconnectDelay    = time.Second
+	DefaultMaxReconnectDelay = time.Minute
 )
 
 // Options represents the set of configurable attributes for service discovery and registration
@@ -60,6 +72,30 @@ type Options struct {
 	// PingFunc is the callback function used to determine if this application is still able
 	// to respond to requests.  This can be nil, and there is no default.
 	PingFunc func() error `json:"-"`
+
+	// Backend selects the service discovery implementation used by NewDiscovery, which is either
+	// ZookeeperBackend or ConsulBackend.  If unset, DefaultBackend is used.
+	Backend string `json:"backend,omitempty"`
+
+	// ConsulAddress is the base URL of the Consul agent used by ConsulBackend.  If unset,
+	// DefaultConsulAddress is used.
+	ConsulAddress string `json:"consulAddress,omitempty"`
+
+	// ConsulToken is the optional ACL token sent with requests to the Consul agent.
+	ConsulToken string `json:"consulToken,omitempty"`
+
+	// CheckInterval is how often a Consul registration reports the result of PingFunc to its
+	// agent.  A registration becomes unhealthy if it does not report within 3 intervals.
+	// If unset, DefaultCheckInterval is used.
+	CheckInterval time.Duration `json:"checkInterval"`
+
+	// ReconnectDelay is the initial delay before a lost watch is reestablished.  The delay doubles with
+	// each failed attempt, up to MaxReconnectDelay.  If unset, DefaultReconnectDelay is used.
+	ReconnectDelay time.Duration `json:"reconnectDelay"`
+
+	// MaxReconnectDelay is the limit on the delay between attempts to reestablish a lost watch.
+	// If unset, DefaultMaxReconnectDelay is used.
+	MaxReconnectDelay time.Duration `json:"maxReconnectDelay"`
 }
 
 func (o *Options) logger() logging.Logger {
@@ -155,3 +191,51 @@ func (o *Options) pingFunc() func() error {
 
 	return nil
 }
+
+func (o *Options) backend() string {
+	if o != nil && len(o.Backend) > 0 {
+		return o.Backend
+	}
+
+	return DefaultBackend
+}
+
+func (o *Options) consulAddress() string {
+	if o != nil && len(o.ConsulAddress) > 0 {
+		return strings.TrimRight(o.ConsulAddress, "/")
+	}
+
+	return DefaultConsulAddress
+}
+
+func (o *Options) consulToken() string {
+	if o != nil {
+		return o.ConsulToken
+	}
+
+	return ""
+}
+
+func (o *Options) checkInterval() time.Duration {
+	if o != nil && o.CheckInterval > 0 {
+		return o.CheckInterval
+	}
+
+	return DefaultCheckInterval
+}
+
+func (o *Options) reconnectDelay() time.Duration {
+	if o != nil && o.ReconnectDelay > 0 {
+		return o.ReconnectDelay
+	}
+
+	return DefaultReconnectDelay
+}
+
+func (o *Options) maxReconnectDelay() time.Duration {
+	if o != nil && o.MaxReconnectDelay > 0 {
+		return o.MaxReconnectDelay
+	}
+
+	return DefaultMaxReconnectDelay
+}
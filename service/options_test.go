@@ -25,9 +25,36 @@ func TestOptionsDefault(t *testing.T) {
 		assert.Empty(o.registrations())
 		assert.Equal(DefaultVnodeCount, o.vnodeCount())
 		assert.Nil(o.pingFunc())
+		assert.Equal(DefaultBackend, o.backend())
+		assert.Equal(DefaultConsulAddress, o.consulAddress())
+		assert.Empty(o.consulToken())
+		assert.Equal(DefaultCheckInterval, o.checkInterval())
+		assert.Equal(DefaultReconnectDelay, o.reconnectDelay())
+		assert.Equal(DefaultMaxReconnectDelay, o.maxReconnectDelay())
 	}
 }
 
+func TestOptionsDiscovery(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		o      = &Options{
+			Backend:           ConsulBackend,
+			ConsulAddress:     "http://consul.comcast.net:8500/",
+			ConsulToken:       "token",
+			CheckInterval:     3 * time.Second,
+			ReconnectDelay:    250 * time.Millisecond,
+			MaxReconnectDelay: 5 * time.Second,
+		}
+	)
+
+	assert.Equal(ConsulBackend, o.backend())
+	assert.Equal("http://consul.comcast.net:8500", o.consulAddress())
+	assert.Equal("token", o.consulToken())
+	assert.Equal(3*time.Second, o.checkInterval())
+	assert.Equal(250*time.Millisecond, o.reconnectDelay())
+	assert.Equal(5*time.Second, o.maxReconnectDelay())
+}
+
 func TestOptions(t *testing.T) {
 	assert := assert.New(t)
 	logger := logging.TestLogger(t)
@@ -0,0 +1,509 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Comcast/webpa-common/backoff"
+	"github.com/Comcast/webpa-common/logging"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// TopologyPending is the phase of a Topology which has been announced but not yet applied.  Nodes use
+	// this phase to drain the devices which will hash elsewhere once the topology is committed.
+	TopologyPending = "pending"
+
+	// TopologyCommitted is the phase of a Topology which is in effect
+	TopologyCommitted = "committed"
+
+	// DefaultTopologyKey is the metadata key under which topologies are published
+	DefaultTopologyKey = "topology"
+
+	// DefaultDrainPeriod is the default time between publishing a pending topology and committing it
+	DefaultDrainPeriod = 5 * time.Minute
+)
+
+var (
+	ErrorNoMetadataStore = errors.New("The service discovery backend does not support metadata")
+)
+
+// MetadataWatch is a Watch over a single metadata value
+type MetadataWatch interface {
+	Close()
+	IsClosed() bool
+	Event() <-chan struct{}
+
+	// Value returns the current metadata value, which is nil if the value has not been set
+	Value() []byte
+}
+
+// MetadataStore is implemented by Discovery backends which can share small values, such as a Topology,
+// among all the nodes of a service.  The Discovery returned by NewDiscovery for ConsulBackend implements
+// this interface using the Consul KV store.  The ZookeeperBackend does not support metadata.
+type MetadataStore interface {
+	// PutMetadata sets the value of a metadata key
+	PutMetadata(key string, value []byte) error
+
+	// WatchMetadata produces a watch over a metadata key, which need not exist yet
+	WatchMetadata(key string) (MetadataWatch, error)
+}
+
+// NewMetadataStore returns the MetadataStore of a Discovery, or ErrorNoMetadataStore if the
+// Discovery's backend does not support metadata
+func NewMetadataStore(d Discovery) (MetadataStore, error) {
+	if store, ok := d.(MetadataStore); ok {
+		return store, nil
+	}
+
+	return nil, ErrorNoMetadataStore
+}
+
+// Topology is the published state of the service's hash ring, as exchanged through a MetadataStore.
+// A rebalancing happens in two phases.  First, the new set of endpoints is published as TopologyPending,
+// which gives nodes DrainPeriod to gradually disconnect the devices that will hash to other nodes.  Then,
+// the same endpoints are published as TopologyCommitted, at which point every node switches its hash ring.
+// This avoids the stampede of reconnections which happens when the ring changes abruptly.
+type Topology struct {
+	// Version increases with each new set of endpoints
+	Version uint64 `json:"version"`
+
+	// Phase is either TopologyPending or TopologyCommitted
+	Phase string `json:"phase"`
+
+	// Endpoints are the sorted endpoints of the hash ring, in the form accepted by ParseHostPort
+	Endpoints []string `json:"endpoints"`
+
+	// DrainPeriod is the time between the pending and committed phases of this topology
+	DrainPeriod time.Duration `json:"drainPeriod"`
+}
+
+// Coordinator drives the two-phase rebalancing protocol.  Each change in membership is published as a
+// pending Topology, which is committed once the drain period has elapsed.  If membership changes again
+// before the commit, the newer endpoints replace the pending topology and the drain period starts over.
+//
+// The Update method is typically used as the Listener of a Subscription to the service's Discovery.
+// Only one Coordinator should run for a given service, e.g. on a node selected through configuration.
+type Coordinator struct {
+	// Logger is the optional Logger used by this coordinator.  If not supplied, logging.DefaultLogger() is used.
+	Logger logging.Logger
+
+	// Store is where topologies are published.  This field is required.
+	Store MetadataStore
+
+	// Key is the metadata key for topologies.  If not supplied, DefaultTopologyKey is used.
+	Key string
+
+	// DrainPeriod is the time between publishing a pending topology and committing it.  If not supplied,
+	// DefaultDrainPeriod is used.
+	DrainPeriod time.Duration
+
+	// After is an optional function which is used to produce a time channel for the drain period.
+	// If this field is nil, time.After is used.
+	After func(time.Duration) <-chan time.Time
+
+	lock     sync.Mutex
+	seeded   bool
+	current  Topology
+	shutdown chan struct{}
+}
+
+func (c *Coordinator) logger() logging.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+func (c *Coordinator) key() string {
+	if len(c.Key) > 0 {
+		return c.Key
+	}
+
+	return DefaultTopologyKey
+}
+
+func (c *Coordinator) drainPeriod() time.Duration {
+	if c.DrainPeriod > 0 {
+		return c.DrainPeriod
+	}
+
+	return DefaultDrainPeriod
+}
+
+func (c *Coordinator) after() func(time.Duration) <-chan time.Time {
+	if c.After != nil {
+		return c.After
+	}
+
+	return time.After
+}
+
+// Current returns the topology most recently published by this coordinator
+func (c *Coordinator) Current() Topology {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.current
+}
+
+// Update starts a rebalancing for the given endpoints, unless they are already pending or committed.
+// Before its first update, a coordinator resumes from the topology already published in the Store, so that
+// a restarted coordinator continues the version sequence and still drains devices.  Only when no topology
+// has ever been published are the endpoints committed immediately, since there is no previous ring from
+// which devices need to be drained.
+func (c *Coordinator) Update(endpoints []string) {
+	endpoints = normalizeEndpoints(endpoints)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.seed(); err != nil {
+		c.logger().Error("Unable to read the published topology: %s", err)
+		return
+	}
+
+	if c.current.Version > 0 && reflect.DeepEqual(endpoints, c.current.Endpoints) {
+		return
+	}
+
+	next := Topology{
+		Version:     c.current.Version + 1,
+		Phase:       TopologyPending,
+		Endpoints:   endpoints,
+		DrainPeriod: c.drainPeriod(),
+	}
+
+	if c.current.Version == 0 {
+		next.Phase = TopologyCommitted
+	}
+
+	if err := c.publish(next); err != nil {
+		c.logger().Error("Unable to publish %s topology version %d: %s", next.Phase, next.Version, err)
+		return
+	}
+
+	if next.Phase == TopologyPending {
+		c.scheduleCommit(next)
+	}
+}
+
+// seed loads the currently published topology the first time it is called.  If that topology is still
+// pending, its commit is rescheduled.  This method must be called under the lock.
+func (c *Coordinator) seed() error {
+	if c.seeded {
+		return nil
+	}
+
+	watch, err := c.Store.WatchMetadata(c.key())
+	if err != nil {
+		return err
+	}
+
+	value := watch.Value()
+	watch.Close()
+
+	if len(value) > 0 {
+		var published Topology
+		if err := json.Unmarshal(value, &published); err != nil {
+			return err
+		}
+
+		c.current = published
+		c.logger().Info("Resuming from %s topology version %d: %v", published.Phase, published.Version, published.Endpoints)
+		if published.Phase == TopologyPending {
+			c.scheduleCommit(published)
+		}
+	}
+
+	c.seeded = true
+	return nil
+}
+
+// scheduleCommit starts the drain period for a pending topology.  This method must be called under the lock.
+func (c *Coordinator) scheduleCommit(pending Topology) {
+	if c.shutdown == nil {
+		c.shutdown = make(chan struct{})
+	}
+
+	drainPeriod := pending.DrainPeriod
+	if drainPeriod <= 0 {
+		drainPeriod = c.drainPeriod()
+	}
+
+	go c.commitAfter(pending.Version, c.after()(drainPeriod), c.shutdown)
+}
+
+// Stop abandons any pending topology.  A later call to Update will resume coordination.
+func (c *Coordinator) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.shutdown != nil {
+		close(c.shutdown)
+		c.shutdown = nil
+	}
+}
+
+// commitAfter commits the given version of the topology once the drain period elapses, provided
+// that a newer topology has not been published in the meantime
+func (c *Coordinator) commitAfter(version uint64, drained <-chan time.Time, shutdown <-chan struct{}) {
+	select {
+	case <-shutdown:
+		return
+	case <-drained:
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.current.Version != version || c.current.Phase != TopologyPending {
+		return
+	}
+
+	committed := c.current
+	committed.Phase = TopologyCommitted
+	if err := c.publish(committed); err != nil {
+		c.logger().Error("Unable to commit topology version %d: %s", version, err)
+	}
+}
+
+// publish writes a topology to the store, making it current if successful.  This method must be called under the lock.
+func (c *Coordinator) publish(t Topology) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Store.PutMetadata(c.key(), data); err != nil {
+		return err
+	}
+
+	c.logger().Info("Published %s topology version %d: %v", t.Phase, t.Version, t.Endpoints)
+	c.current = t
+	return nil
+}
+
+// normalizeEndpoints produces the sorted, deduped copy of a set of endpoints
+func normalizeEndpoints(endpoints []string) []string {
+	var (
+		normalized = make([]string, 0, len(endpoints))
+		dedupe     = make(map[string]bool, len(endpoints))
+	)
+
+	for _, endpoint := range endpoints {
+		if !dedupe[endpoint] {
+			dedupe[endpoint] = true
+			normalized = append(normalized, endpoint)
+		}
+	}
+
+	sort.Strings(normalized)
+	return normalized
+}
+
+// Rebalancer follows the topologies published by a Coordinator.  Each node of a service runs a Rebalancer,
+// which drains devices when a topology is pending and updates the node's hash ring when it is committed.
+// A node using a Rebalancer should not also subscribe its Accessor directly to service discovery, as that
+// would change the ring before devices have been drained.
+type Rebalancer struct {
+	// Logger is the optional Logger used by this rebalancer.  If not supplied, logging.DefaultLogger() is used.
+	Logger logging.Logger
+
+	// Store is the source of topologies.  This field is required.
+	Store MetadataStore
+
+	// Key is the metadata key for topologies.  If not supplied, DefaultTopologyKey is used.
+	Key string
+
+	// Factory creates the Accessor for a pending topology.  If not supplied, NewAccessorFactory(nil) is used.
+	Factory AccessorFactory
+
+	// Accessor is updated with the endpoints of each committed topology.  This field is required.
+	Accessor UpdatableAccessor
+
+	// Drain is invoked with the hash ring of each pending topology along with its drain period.  Implementations
+	// should disconnect, spread out over the drain period, the devices which the pending ring hashes to other nodes.
+	// This function must not block.  This field is optional.
+	Drain func(pending Accessor, period time.Duration)
+
+	// ReconnectDelay is the initial delay before a lost watch is reestablished.  The delay doubles with
+	// each failed attempt, up to MaxReconnectDelay.  If unset, DefaultReconnectDelay is used.
+	ReconnectDelay time.Duration
+
+	// MaxReconnectDelay is the limit on the delay between attempts to reestablish a lost watch.
+	// If unset, DefaultMaxReconnectDelay is used.
+	MaxReconnectDelay time.Duration
+
+	// After is an optional function which is used to produce a time channel for reconnection delays.
+	// If this field is nil, time.After is used.
+	After func(time.Duration) <-chan time.Time
+
+	mutex    sync.Mutex
+	shutdown chan struct{}
+	stopped  sync.WaitGroup
+}
+
+func (r *Rebalancer) logger() logging.Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+func (r *Rebalancer) key() string {
+	if len(r.Key) > 0 {
+		return r.Key
+	}
+
+	return DefaultTopologyKey
+}
+
+func (r *Rebalancer) factory() AccessorFactory {
+	if r.Factory != nil {
+		return r.Factory
+	}
+
+	return NewAccessorFactory(nil)
+}
+
+func (r *Rebalancer) after() func(time.Duration) <-chan time.Time {
+	if r.After != nil {
+		return r.After
+	}
+
+	return time.After
+}
+
+func (r *Rebalancer) newBackoff() backoff.Exponential {
+	b := backoff.Exponential{Initial: DefaultReconnectDelay, Max: DefaultMaxReconnectDelay}
+	if r.ReconnectDelay > 0 {
+		b.Initial = r.ReconnectDelay
+	}
+
+	if r.MaxReconnectDelay > 0 {
+		b.Max = r.MaxReconnectDelay
+	}
+
+	return b
+}
+
+// Run begins following topologies.  The initial watch is established before this method returns,
+// and any committed topology is applied immediately.  This method returns ErrorAlreadyRunning if this
+// instance is already running.
+func (r *Rebalancer) Run() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.shutdown != nil {
+		return ErrorAlreadyRunning
+	}
+
+	watch, err := r.Store.WatchMetadata(r.key())
+	if err != nil {
+		return err
+	}
+
+	r.shutdown = make(chan struct{})
+	r.stopped.Add(1)
+	go r.monitor(watch, r.shutdown)
+	return nil
+}
+
+// Cancel stops following topologies.  This method returns ErrorNotRunning if this instance was not running.
+func (r *Rebalancer) Cancel() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.shutdown == nil {
+		return ErrorNotRunning
+	}
+
+	close(r.shutdown)
+	r.shutdown = nil
+	r.stopped.Wait()
+	return nil
+}
+
+// monitor applies topologies from the watch until shutdown, reestablishing the watch if it is lost
+func (r *Rebalancer) monitor(watch MetadataWatch, shutdown <-chan struct{}) {
+	defer r.stopped.Done()
+
+	var (
+		logger  = r.logger()
+		retry   = r.newBackoff()
+		applied Topology
+	)
+
+	applied = r.apply(applied, watch.Value())
+	for {
+		select {
+		case <-shutdown:
+			watch.Close()
+			return
+
+		case _, ok := <-watch.Event():
+			if ok && !watch.IsClosed() {
+				applied = r.apply(applied, watch.Value())
+				continue
+			}
+		}
+
+		logger.Error("Topology watch lost, reconnecting")
+		watch.Close()
+		for watch = nil; watch == nil; {
+			delay := retry.Next()
+			select {
+			case <-shutdown:
+				return
+			case <-r.after()(delay):
+			}
+
+			var err error
+			if watch, err = r.Store.WatchMetadata(r.key()); err != nil {
+				logger.Error("Unable to reconnect topology watch after %s: %s", delay, err)
+			}
+		}
+
+		retry.Reset()
+		applied = r.apply(applied, watch.Value())
+	}
+}
+
+// apply acts on a published topology, if it differs from the last one applied, and returns the topology
+// that is now in effect
+func (r *Rebalancer) apply(applied Topology, value []byte) Topology {
+	if len(value) == 0 {
+		return applied
+	}
+
+	var t Topology
+	if err := json.Unmarshal(value, &t); err != nil {
+		r.logger().Error("Invalid topology: %s", err)
+		return applied
+	}
+
+	if t.Version == applied.Version && t.Phase == applied.Phase {
+		return applied
+	}
+
+	switch t.Phase {
+	case TopologyPending:
+		r.logger().Info("Draining for pending topology version %d over %s: %v", t.Version, t.DrainPeriod, t.Endpoints)
+		if r.Drain != nil {
+			pending, _ := r.factory().New(t.Endpoints)
+			r.Drain(pending, t.DrainPeriod)
+		}
+
+	case TopologyCommitted:
+		r.logger().Info("Applying committed topology version %d: %v", t.Version, t.Endpoints)
+		r.Accessor.Update(t.Endpoints)
+
+	default:
+		r.logger().Error("Ignoring topology version %d with unrecognized phase: %s", t.Version, t.Phase)
+		return applied
+	}
+
+	return t
+}
@@ -0,0 +1,427 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is an in-memory MetadataStore
+type memoryStore struct {
+	lock     sync.Mutex
+	values   map[string][]byte
+	watches  []*memoryWatch
+	putError error
+	watched  chan *memoryWatch
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		values:  make(map[string][]byte),
+		watched: make(chan *memoryWatch, 10),
+	}
+}
+
+func (s *memoryStore) PutMetadata(key string, value []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.putError != nil {
+		return s.putError
+	}
+
+	s.values[key] = value
+	for _, w := range s.watches {
+		if w.key == key {
+			w.set(value)
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) WatchMetadata(key string) (MetadataWatch, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	w := &memoryWatch{key: key, value: s.values[key], event: make(chan struct{}, 1)}
+	s.watches = append(s.watches, w)
+	s.watched <- w
+	return w, nil
+}
+
+// topology decodes the topology published under DefaultTopologyKey
+func (s *memoryStore) topology(t *testing.T) Topology {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var topology Topology
+	require.NoError(t, json.Unmarshal(s.values[DefaultTopologyKey], &topology))
+	return topology
+}
+
+type memoryWatch struct {
+	key       string
+	lock      sync.Mutex
+	value     []byte
+	closed    bool
+	closeOnce sync.Once
+	event     chan struct{}
+}
+
+func (w *memoryWatch) set(value []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return
+	}
+
+	w.value = value
+
+	select {
+	case w.event <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memoryWatch) Close() {
+	w.closeOnce.Do(func() {
+		w.lock.Lock()
+		w.closed = true
+		w.lock.Unlock()
+		close(w.event)
+	})
+}
+
+func (w *memoryWatch) IsClosed() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.closed
+}
+
+func (w *memoryWatch) Event() <-chan struct{} {
+	return w.event
+}
+
+func (w *memoryWatch) Value() []byte {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.value
+}
+
+// recordingAccessor is an UpdatableAccessor which reports each update
+type recordingAccessor struct {
+	mockAccessor
+	updates chan []string
+}
+
+func (r *recordingAccessor) Update(endpoints []string) {
+	r.updates <- endpoints
+}
+
+func TestNewMetadataStore(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := NewMetadataStore(newZookeeperDiscovery(nil, new(mockRegistrar)))
+	assert.Nil(store)
+	assert.Equal(ErrorNoMetadataStore, err)
+
+	consul := newConsulDiscovery(nil)
+	store, err = NewMetadataStore(consul)
+	assert.Equal(consul, store)
+	assert.NoError(err)
+}
+
+func TestNormalizeEndpoints(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{}, normalizeEndpoints(nil))
+	assert.Equal(
+		[]string{"a:8080", "b:8080"},
+		normalizeEndpoints([]string{"b:8080", "a:8080", "b:8080"}),
+	)
+}
+
+func TestCoordinator(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		store   = newMemoryStore()
+		timers  = make(chan chan time.Time, 10)
+
+		coordinator = Coordinator{
+			Logger:      logging.TestLogger(t),
+			Store:       store,
+			DrainPeriod: time.Minute,
+			After: func(d time.Duration) <-chan time.Time {
+				assert.Equal(time.Minute, d)
+				timer := make(chan time.Time, 1)
+				timers <- timer
+				return timer
+			},
+		}
+
+		nextTimer = func() chan time.Time {
+			select {
+			case timer := <-timers:
+				return timer
+			case <-time.After(5 * time.Second):
+				require.FailNow("No drain period was started")
+				return nil
+			}
+		}
+
+		waitForCommit = func(version uint64) {
+			timeout := time.After(5 * time.Second)
+			for coordinator.Current().Phase != TopologyCommitted || coordinator.Current().Version != version {
+				select {
+				case <-timeout:
+					require.FailNow("The topology was not committed", "version %d", version)
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		}
+	)
+
+	defer coordinator.Stop()
+
+	// the first set of endpoints is committed immediately
+	coordinator.Update([]string{"b:8080", "a:8080"})
+	assert.Equal(
+		Topology{Version: 1, Phase: TopologyCommitted, Endpoints: []string{"a:8080", "b:8080"}, DrainPeriod: time.Minute},
+		store.topology(t),
+	)
+
+	// an unchanged set of endpoints does nothing
+	coordinator.Update([]string{"a:8080", "b:8080"})
+	assert.Equal(uint64(1), store.topology(t).Version)
+	assert.Empty(timers)
+
+	coordinator.Update([]string{"a:8080", "b:8080", "c:8080"})
+	assert.Equal(
+		Topology{Version: 2, Phase: TopologyPending, Endpoints: []string{"a:8080", "b:8080", "c:8080"}, DrainPeriod: time.Minute},
+		store.topology(t),
+	)
+
+	nextTimer() <- time.Now()
+	waitForCommit(2)
+	assert.Equal(TopologyCommitted, store.topology(t).Phase)
+	assert.Equal(uint64(2), store.topology(t).Version)
+
+	// a newer pending topology supersedes one which has not yet been committed
+	coordinator.Update([]string{"a:8080"})
+	superseded := nextTimer()
+	coordinator.Update([]string{"a:8080", "c:8080"})
+	current := nextTimer()
+	assert.Equal(uint64(4), store.topology(t).Version)
+
+	superseded <- time.Now()
+	current <- time.Now()
+	waitForCommit(4)
+	assert.Equal(
+		Topology{Version: 4, Phase: TopologyCommitted, Endpoints: []string{"a:8080", "c:8080"}, DrainPeriod: time.Minute},
+		store.topology(t),
+	)
+}
+
+func TestCoordinatorResume(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		store   = newMemoryStore()
+		timers  = make(chan chan time.Time, 10)
+
+		newCoordinator = func() *Coordinator {
+			return &Coordinator{
+				Logger:      logging.TestLogger(t),
+				Store:       store,
+				DrainPeriod: time.Minute,
+				After: func(d time.Duration) <-chan time.Time {
+					timer := make(chan time.Time, 1)
+					timers <- timer
+					return timer
+				},
+			}
+		}
+
+		publish = func(topology Topology) {
+			data, err := json.Marshal(topology)
+			require.NoError(err)
+			require.NoError(store.PutMetadata(DefaultTopologyKey, data))
+		}
+	)
+
+	// a restarted coordinator continues from the committed topology rather than committing abruptly
+	publish(Topology{Version: 3, Phase: TopologyCommitted, Endpoints: []string{"a:8080", "b:8080"}, DrainPeriod: time.Minute})
+	restarted := newCoordinator()
+	defer restarted.Stop()
+
+	restarted.Update([]string{"b:8080", "a:8080"})
+	assert.Equal(uint64(3), store.topology(t).Version)
+	assert.Empty(timers)
+
+	restarted.Update([]string{"a:8080", "b:8080", "c:8080"})
+	assert.Equal(
+		Topology{Version: 4, Phase: TopologyPending, Endpoints: []string{"a:8080", "b:8080", "c:8080"}, DrainPeriod: time.Minute},
+		store.topology(t),
+	)
+
+	assert.Len(timers, 1)
+
+	// a pending topology left behind by a previous coordinator is still committed
+	publish(Topology{Version: 5, Phase: TopologyPending, Endpoints: []string{"a:8080"}, DrainPeriod: time.Minute})
+	resumed := newCoordinator()
+	defer resumed.Stop()
+
+	resumed.Update([]string{"a:8080"})
+	assert.Equal(uint64(5), resumed.Current().Version)
+
+	var drained chan time.Time
+	for len(timers) > 0 {
+		drained = <-timers
+	}
+
+	require.NotNil(drained)
+	drained <- time.Now()
+
+	timeout := time.After(5 * time.Second)
+	for resumed.Current().Phase != TopologyCommitted {
+		select {
+		case <-timeout:
+			require.FailNow("The resumed topology was not committed")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	assert.Equal(
+		Topology{Version: 5, Phase: TopologyCommitted, Endpoints: []string{"a:8080"}, DrainPeriod: time.Minute},
+		store.topology(t),
+	)
+}
+
+func TestCoordinatorPublishError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		store  = newMemoryStore()
+
+		coordinator = Coordinator{
+			Logger: logging.TestLogger(t),
+			Store:  store,
+		}
+	)
+
+	store.putError = errors.New("expected")
+	coordinator.Update([]string{"a:8080"})
+	assert.Zero(coordinator.Current().Version)
+
+	store.putError = nil
+	coordinator.Update([]string{"a:8080"})
+	assert.Equal(
+		Topology{Version: 1, Phase: TopologyCommitted, Endpoints: []string{"a:8080"}, DrainPeriod: DefaultDrainPeriod},
+		coordinator.Current(),
+	)
+}
+
+func TestRebalancer(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		store    = newMemoryStore()
+		accessor = &recordingAccessor{updates: make(chan []string, 10)}
+		drains   = make(chan time.Duration, 10)
+
+		rebalancer = Rebalancer{
+			Logger:   logging.TestLogger(t),
+			Store:    store,
+			Accessor: accessor,
+			Drain: func(pending Accessor, period time.Duration) {
+				instance, err := pending.Get([]byte("mac:112233445566"))
+				assert.Equal("http://a:8080", instance)
+				assert.NoError(err)
+				drains <- period
+			},
+			After: func(time.Duration) <-chan time.Time {
+				immediate := make(chan time.Time, 1)
+				immediate <- time.Now()
+				return immediate
+			},
+		}
+
+		publish = func(topology Topology) {
+			data, err := json.Marshal(topology)
+			require.NoError(err)
+			require.NoError(store.PutMetadata(DefaultTopologyKey, data))
+		}
+
+		expectUpdate = func(expected []string) {
+			select {
+			case actual := <-accessor.updates:
+				assert.Equal(expected, actual)
+			case <-time.After(5 * time.Second):
+				assert.Fail("The accessor was not updated", "expected %v", expected)
+			}
+		}
+
+		expectDrain = func(expected time.Duration) {
+			select {
+			case actual := <-drains:
+				assert.Equal(expected, actual)
+			case <-time.After(5 * time.Second):
+				assert.Fail("No drain occurred")
+			}
+		}
+	)
+
+	publish(Topology{Version: 1, Phase: TopologyCommitted, Endpoints: []string{"b:8080"}})
+	assert.Equal(ErrorNotRunning, rebalancer.Cancel())
+	require.NoError(rebalancer.Run())
+	assert.Equal(ErrorAlreadyRunning, rebalancer.Run())
+	watch := <-store.watched
+
+	// the committed topology in effect at startup is applied immediately
+	expectUpdate([]string{"b:8080"})
+
+	publish(Topology{Version: 2, Phase: TopologyPending, Endpoints: []string{"a:8080"}, DrainPeriod: time.Minute})
+	expectDrain(time.Minute)
+
+	publish(Topology{Version: 2, Phase: TopologyCommitted, Endpoints: []string{"a:8080"}, DrainPeriod: time.Minute})
+	expectUpdate([]string{"a:8080"})
+
+	// a lost watch is reestablished, without reapplying the current topology
+	watch.Close()
+	<-store.watched
+	publish(Topology{Version: 3, Phase: TopologyCommitted, Endpoints: []string{"a:8080", "c:8080"}})
+	expectUpdate([]string{"a:8080", "c:8080"})
+
+	assert.NoError(rebalancer.Cancel())
+	assert.Empty(accessor.updates)
+	assert.Empty(drains)
+}
+
+func TestRebalancerInvalidTopology(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		store    = newMemoryStore()
+		accessor = &recordingAccessor{updates: make(chan []string, 10)}
+
+		rebalancer = Rebalancer{
+			Logger:   logging.TestLogger(t),
+			Store:    store,
+			Accessor: accessor,
+		}
+	)
+
+	applied := rebalancer.apply(Topology{}, []byte("this is not JSON"))
+	assert.Zero(applied.Version)
+
+	applied = rebalancer.apply(applied, []byte(`{"version": 1, "phase": "unknown"}`))
+	assert.Zero(applied.Version)
+
+	// a pending topology with no Drain function is simply noted
+	applied = rebalancer.apply(applied, []byte(`{"version": 1, "phase": "pending"}`))
+	assert.Equal(uint64(1), applied.Version)
+	assert.Empty(accessor.updates)
+}
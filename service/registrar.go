@@ -15,10 +15,15 @@ type Watch interface {
 	Endpoints() []string
 }
 
+// Watcher is the source of Watch instances.  Both Registrar and Discovery implement this interface.
+type Watcher interface {
+	Watch() (Watch, error)
+}
+
 // Registrar is the interface which is used to register and watch endpoints
 type Registrar interface {
+	Watcher
 	RegisterEndpoint(string, int, func() error) (*serversets.Endpoint, error)
-	Watch() (Watch, error)
 }
 
 // registrar is an internal type used to make ServerSet conform to the Registrar interface
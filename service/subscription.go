@@ -18,8 +18,9 @@ type Subscription struct {
 	// Logger is the option Logger used by this subscription.  If not supplied, it defaults to logging.DefaultLogger().
 	Logger logging.Logger
 
-	// Registrar is the service registration component used to create a Watch.
-	Registrar Registrar
+	// Registrar is the service registration component used to create a Watch.  Any Watcher,
+	// such as a Discovery, may be used.
+	Registrar Watcher
 
 	// Listener is the sink for service endpoint updates.  This field is required, and must not
 	// be changed concurrently with any methods of this type.
@@ -41,3 +41,20 @@ func Initialize(logger logging.Logger, pingFunc func() error, v *viper.Viper) (o
 	re, err = RegisterAll(r, o)
 	return
 }
+
+// InitializeDiscovery is the analog of Initialize for the backend-neutral Discovery API.  The backend
+// is selected by the configuration, and all configured registrations are made before returning.
+func InitializeDiscovery(logger logging.Logger, pingFunc func() error, v *viper.Viper) (o *Options, d Discovery, err error) {
+	o, err = NewOptions(logger, pingFunc, v)
+	if err != nil {
+		return
+	}
+
+	d, err = NewDiscovery(o)
+	if err != nil {
+		return
+	}
+
+	err = RegisterAllWith(d, o)
+	return
+}
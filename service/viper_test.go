@@ -63,3 +63,24 @@ func TestNewOptionsNoPingFunc(t *testing.T) {
 	assert.Equal("foobar", o.Connection)
 	assert.Equal([]string{"host1:1234", "host2:5678"}, o.Servers)
 }
+
+func TestInitializeDiscoveryUnsupportedBackend(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		require       = require.New(t)
+		configuration = bytes.NewBufferString(`{
+			"backend": "nosuch"
+		}`)
+
+		v = viper.New()
+	)
+
+	v.SetConfigType("json")
+	require.Nil(v.ReadConfig(configuration))
+
+	o, d, err := InitializeDiscovery(logging.DefaultLogger(), nil, v)
+	require.NotNil(o)
+	assert.Equal("nosuch", o.Backend)
+	assert.Nil(d)
+	assert.Error(err)
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"github.com/Comcast/webpa-common/backoff"
+	"github.com/Comcast/webpa-common/logging"
+	"sync"
+	"time"
+)
+
+// reconnectingWatch is a Watch which reestablishes its delegate when the delegate is lost, i.e. when
+// the delegate's event channel is closed without this Watch having been closed.  Attempts to reestablish
+// the delegate are spaced out with exponential backoff.  While disconnected, the last known endpoints are kept.
+type reconnectingWatch struct {
+	logger   logging.Logger
+	newWatch func() (Watch, error)
+	backoff  backoff.Exponential
+	after    func(time.Duration) <-chan time.Time
+
+	event     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	waitGroup sync.WaitGroup
+
+	lock      sync.RWMutex
+	endpoints []string
+}
+
+// newReconnectingWatch establishes the initial delegate, returning any error, and then begins
+// monitoring it
+func newReconnectingWatch(logger logging.Logger, newWatch func() (Watch, error), initialDelay, maxDelay time.Duration) (*reconnectingWatch, error) {
+	return startReconnectingWatch(logger, newWatch, initialDelay, maxDelay, time.After)
+}
+
+func startReconnectingWatch(logger logging.Logger, newWatch func() (Watch, error), initialDelay, maxDelay time.Duration, after func(time.Duration) <-chan time.Time) (*reconnectingWatch, error) {
+	delegate, err := newWatch()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &reconnectingWatch{
+		logger:    logger,
+		newWatch:  newWatch,
+		backoff:   backoff.Exponential{Initial: initialDelay, Max: maxDelay},
+		after:     after,
+		event:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		endpoints: delegate.Endpoints(),
+	}
+
+	w.waitGroup.Add(1)
+	go w.monitor(delegate)
+	return w, nil
+}
+
+func (w *reconnectingWatch) update(endpoints []string) {
+	w.lock.Lock()
+	w.endpoints = endpoints
+	w.lock.Unlock()
+
+	select {
+	case w.event <- struct{}{}:
+	default:
+	}
+}
+
+// monitor forwards the delegate's events until this Watch is closed, reestablishing the delegate as necessary
+func (w *reconnectingWatch) monitor(delegate Watch) {
+	defer w.waitGroup.Done()
+
+	for {
+		if !w.forward(delegate) {
+			return
+		}
+
+		w.logger.Error("Service discovery watch lost, reconnecting")
+		if delegate = w.reconnect(); delegate == nil {
+			return
+		}
+
+		w.logger.Info("Service discovery watch reestablished")
+		w.update(delegate.Endpoints())
+	}
+}
+
+// forward dispatches the delegate's events.  This method returns false if this Watch was closed, and
+// true if the delegate was lost.
+func (w *reconnectingWatch) forward(delegate Watch) bool {
+	for {
+		select {
+		case <-w.done:
+			delegate.Close()
+			return false
+
+		case _, ok := <-delegate.Event():
+			if !ok || delegate.IsClosed() {
+				delegate.Close()
+				return true
+			}
+
+			w.update(delegate.Endpoints())
+		}
+	}
+}
+
+// reconnect attempts to reestablish the delegate with exponential backoff, returning nil if this
+// Watch is closed first
+func (w *reconnectingWatch) reconnect() Watch {
+	defer w.backoff.Reset()
+
+	for {
+		delay := w.backoff.Next()
+		select {
+		case <-w.done:
+			return nil
+		case <-w.after(delay):
+		}
+
+		delegate, err := w.newWatch()
+		if err == nil {
+			return delegate
+		}
+
+		w.logger.Error("Unable to reconnect service discovery watch after %s: %s", delay, err)
+	}
+}
+
+func (w *reconnectingWatch) Close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.waitGroup.Wait()
+		close(w.event)
+	})
+}
+
+func (w *reconnectingWatch) IsClosed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *reconnectingWatch) Event() <-chan struct{} {
+	return w.event
+}
+
+func (w *reconnectingWatch) Endpoints() []string {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.endpoints
+}
@@ -1,8 +1,13 @@
 package service
 
 import (
+	"errors"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // TestWatch is a Watch implementation designed to test go.serversets event loops.
@@ -93,3 +98,109 @@ func NewTestWatch(t *testing.T) *TestWatch {
 		endpoints: make(chan []string),
 	}
 }
+
+func TestReconnectingWatchInitialError(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		expectedError = errors.New("expected")
+	)
+
+	w, err := newReconnectingWatch(
+		logging.TestLogger(t),
+		func() (Watch, error) { return nil, expectedError },
+		time.Second,
+		time.Minute,
+	)
+
+	assert.Nil(w)
+	assert.Equal(expectedError, err)
+}
+
+func TestReconnectingWatch(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		firstEvent  = make(chan struct{}, 1)
+		first       = new(mockWatch)
+		secondEvent = make(chan struct{}, 1)
+		second      = new(mockWatch)
+
+		delegates = make(chan Watch, 3)
+		delays    = make(chan time.Duration, 3)
+		timer     = make(chan time.Time)
+	)
+
+	first.On("Endpoints").Return([]string{"http://node1.comcast.net:8080"}).Once()
+	first.On("Event").Return((<-chan struct{})(firstEvent))
+	first.On("IsClosed").Return(false).Once()
+	first.On("Endpoints").Return([]string{"http://node2.comcast.net:8080"}).Once()
+	first.On("Close").Once()
+
+	second.On("Endpoints").Return([]string{"http://node3.comcast.net:8080"}).Once()
+	second.On("Event").Return((<-chan struct{})(secondEvent))
+	second.On("Close").Once()
+
+	delegates <- first
+	delegates <- nil
+	delegates <- second
+
+	w, err := startReconnectingWatch(
+		logging.TestLogger(t),
+		func() (Watch, error) {
+			if delegate := <-delegates; delegate != nil {
+				return delegate, nil
+			}
+
+			return nil, errors.New("expected")
+		},
+		time.Second,
+		time.Minute,
+		func(d time.Duration) <-chan time.Time {
+			delays <- d
+			return timer
+		},
+	)
+
+	require.NotNil(w)
+	require.NoError(err)
+	assert.Equal([]string{"http://node1.comcast.net:8080"}, w.Endpoints())
+
+	// events from the delegate are forwarded
+	firstEvent <- struct{}{}
+	select {
+	case <-w.Event():
+	case <-time.After(5 * time.Second):
+		assert.Fail("No event was forwarded")
+	}
+
+	assert.Equal([]string{"http://node2.comcast.net:8080"}, w.Endpoints())
+
+	// losing the delegate reconnects with exponential backoff, keeping the last endpoints meanwhile
+	close(firstEvent)
+	assert.Equal(time.Second, <-delays)
+	assert.Equal([]string{"http://node2.comcast.net:8080"}, w.Endpoints())
+	timer <- time.Time{}
+	assert.Equal(2*time.Second, <-delays)
+	timer <- time.Time{}
+
+	select {
+	case <-w.Event():
+	case <-time.After(5 * time.Second):
+		assert.Fail("No event was sent on reconnection")
+	}
+
+	assert.Equal([]string{"http://node3.comcast.net:8080"}, w.Endpoints())
+	assert.Equal(time.Second, w.backoff.Next(), "The backoff should have been reset")
+
+	assert.False(w.IsClosed())
+	w.Close()
+	assert.True(w.IsClosed())
+	w.Close()
+
+	_, ok := <-w.Event()
+	assert.False(ok)
+
+	first.AssertExpectations(t)
+	second.AssertExpectations(t)
+}
@@ -1,5 +1,8 @@
 /*
 Package store implements some additional atomic value storage on top of sync/atomic.
 In particular, this means transparent caching of arbitrary values.
+
+This package also provides SnapshotStore, which holds versioned, namespaced configuration
+values with an auditable history that can be rolled back.
 */
 package store
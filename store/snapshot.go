@@ -0,0 +1,213 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSnapshotHistory is the default number of snapshots retained for each namespace
+	DefaultSnapshotHistory = 100
+)
+
+var (
+	ErrorNoSuchNamespace = errors.New("No snapshots exist for that namespace")
+	ErrorNoSuchVersion   = errors.New("That version does not exist or is no longer retained")
+)
+
+// Snapshot is a single, immutable version of a namespace's value.  Snapshots record who made each
+// change and why, so that changes made by operators to runtime-tunable subsystems are auditable.
+type Snapshot struct {
+	// Namespace identifies the subsystem this snapshot configures, e.g. "ratelimit" or "logging"
+	Namespace string `json:"namespace"`
+
+	// Version is the position of this snapshot in its namespace's history.  Versions start at 1 and
+	// increase by 1 with every change, including rollbacks.
+	Version uint64 `json:"version"`
+
+	// Value is the configuration value.  Values should be treated as immutable once stored.
+	Value interface{} `json:"value"`
+
+	// Time is when this snapshot was stored
+	Time time.Time `json:"time"`
+
+	// Author identifies who made this change
+	Author string `json:"author,omitempty"`
+
+	// Comment describes why this change was made
+	Comment string `json:"comment,omitempty"`
+
+	// RollbackOf is the version whose value was restored by this snapshot, or zero
+	// if this snapshot was not produced by a rollback
+	RollbackOf uint64 `json:"rollbackOf,omitempty"`
+}
+
+// SnapshotListener is notified of each new snapshot stored in a SnapshotStore.  Listeners are
+// invoked synchronously, after the snapshot has been stored and in the order snapshots were stored.
+// Listeners may read from the store, but must not modify the snapshot or write to the store.
+type SnapshotListener func(*Snapshot)
+
+// snapshotHistory is the retained history of a single namespace
+type snapshotHistory struct {
+	snapshots   []*Snapshot
+	nextVersion uint64
+}
+
+// SnapshotStore holds versioned values for any number of namespaces.  Each namespace retains
+// a bounded history of snapshots, and can be rolled back to any retained version.  A rollback
+// is itself recorded as a new snapshot, so history is never rewritten.
+type SnapshotStore struct {
+	historySize int
+	listeners   []SnapshotListener
+	now         func() time.Time
+
+	lock       sync.RWMutex
+	namespaces map[string]*snapshotHistory
+
+	// notifyLock serializes notifications, so that listeners never see a snapshot after a newer one
+	notifyLock sync.Mutex
+}
+
+// NewSnapshotStore creates an empty SnapshotStore which retains at most historySize snapshots per
+// namespace.  If historySize is nonpositive, DefaultSnapshotHistory is used.  The given listeners are
+// notified of every change, including rollbacks.
+func NewSnapshotStore(historySize int, listeners ...SnapshotListener) *SnapshotStore {
+	if historySize < 1 {
+		historySize = DefaultSnapshotHistory
+	}
+
+	return &SnapshotStore{
+		historySize: historySize,
+		listeners:   listeners,
+		now:         time.Now,
+		namespaces:  make(map[string]*snapshotHistory),
+	}
+}
+
+// Put stores a new version of a namespace's value, returning the resulting snapshot
+func (s *SnapshotStore) Put(namespace string, value interface{}, author, comment string) *Snapshot {
+	return s.store(namespace, value, author, comment, 0)
+}
+
+// Rollback restores the value of a previous version of a namespace.  The restored value is stored
+// as a new version, with RollbackOf set to the given version.  An error is returned if the namespace
+// does not exist or the version is not retained.
+func (s *SnapshotStore) Rollback(namespace string, version uint64, author, comment string) (*Snapshot, error) {
+	target, err := s.Get(namespace, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.store(namespace, target.Value, author, comment, version), nil
+}
+
+// store appends a snapshot to a namespace's history, then notifies listeners.  The notification lock is
+// taken before the store is unlocked, so notifications are delivered in the order snapshots were stored.
+func (s *SnapshotStore) store(namespace string, value interface{}, author, comment string, rollbackOf uint64) *Snapshot {
+	s.lock.Lock()
+	history, ok := s.namespaces[namespace]
+	if !ok {
+		history = &snapshotHistory{nextVersion: 1}
+		s.namespaces[namespace] = history
+	}
+
+	snapshot := &Snapshot{
+		Namespace:  namespace,
+		Version:    history.nextVersion,
+		Value:      value,
+		Time:       s.now(),
+		Author:     author,
+		Comment:    comment,
+		RollbackOf: rollbackOf,
+	}
+
+	history.nextVersion++
+	history.snapshots = append(history.snapshots, snapshot)
+	if excess := len(history.snapshots) - s.historySize; excess > 0 {
+		// copy, so that discarded snapshots can be garbage collected
+		history.snapshots = append([]*Snapshot(nil), history.snapshots[excess:]...)
+	}
+
+	s.notifyLock.Lock()
+	defer s.notifyLock.Unlock()
+	s.lock.Unlock()
+
+	for _, listener := range s.listeners {
+		listener(snapshot)
+	}
+
+	return snapshot
+}
+
+// Current returns the most recent snapshot of a namespace
+func (s *SnapshotStore) Current(namespace string) (*Snapshot, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	history, ok := s.namespaces[namespace]
+	if !ok {
+		return nil, ErrorNoSuchNamespace
+	}
+
+	return history.snapshots[len(history.snapshots)-1], nil
+}
+
+// Get returns a specific version of a namespace
+func (s *SnapshotStore) Get(namespace string, version uint64) (*Snapshot, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	history, ok := s.namespaces[namespace]
+	if !ok {
+		return nil, ErrorNoSuchNamespace
+	}
+
+	// versions are contiguous, so the retained snapshots can be indexed directly
+	oldest := history.snapshots[0].Version
+	if version < oldest || version >= history.nextVersion {
+		return nil, ErrorNoSuchVersion
+	}
+
+	return history.snapshots[version-oldest], nil
+}
+
+// History returns the retained snapshots of a namespace, oldest first
+func (s *SnapshotStore) History(namespace string) ([]*Snapshot, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	history, ok := s.namespaces[namespace]
+	if !ok {
+		return nil, ErrorNoSuchNamespace
+	}
+
+	return append([]*Snapshot(nil), history.snapshots...), nil
+}
+
+// Namespaces returns the sorted names of all namespaces in this store
+func (s *SnapshotStore) Namespaces() []string {
+	s.lock.RLock()
+	names := make([]string, 0, len(s.namespaces))
+	for name := range s.namespaces {
+		names = append(names, name)
+	}
+
+	s.lock.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Value returns a Value which always loads the current value of the given namespace.  This
+// allows runtime-tunable subsystems to consume snapshots the same way as any other Value.
+func (s *SnapshotStore) Value(namespace string) Value {
+	return ValueFunc(func() (interface{}, error) {
+		snapshot, err := s.Current(namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		return snapshot.Value, nil
+	})
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnapshotStoreEmpty(t *testing.T) {
+	assert := assert.New(t)
+	store := NewSnapshotStore(0)
+	assert.Equal(DefaultSnapshotHistory, store.historySize)
+
+	current, err := store.Current("nosuch")
+	assert.Nil(current)
+	assert.Equal(ErrorNoSuchNamespace, err)
+
+	snapshot, err := store.Get("nosuch", 1)
+	assert.Nil(snapshot)
+	assert.Equal(ErrorNoSuchNamespace, err)
+
+	history, err := store.History("nosuch")
+	assert.Nil(history)
+	assert.Equal(ErrorNoSuchNamespace, err)
+
+	snapshot, err = store.Rollback("nosuch", 1, "joe", "undo")
+	assert.Nil(snapshot)
+	assert.Equal(ErrorNoSuchNamespace, err)
+
+	value, err := store.Value("nosuch").Load()
+	assert.Nil(value)
+	assert.Equal(ErrorNoSuchNamespace, err)
+
+	assert.Empty(store.Namespaces())
+}
+
+func TestSnapshotStore(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		expected = time.Now()
+		notified []*Snapshot
+		store    = NewSnapshotStore(3, func(s *Snapshot) { notified = append(notified, s) })
+	)
+
+	store.now = func() time.Time { return expected }
+
+	first := store.Put("ratelimit", 100, "joe", "initial")
+	assert.Equal(
+		&Snapshot{Namespace: "ratelimit", Version: 1, Value: 100, Time: expected, Author: "joe", Comment: "initial"},
+		first,
+	)
+
+	store.Put("logging", "DEBUG", "bob", "")
+	second := store.Put("ratelimit", 200, "joe", "more")
+	assert.Equal(uint64(2), second.Version)
+	assert.Equal([]string{"logging", "ratelimit"}, store.Namespaces())
+
+	current, err := store.Current("ratelimit")
+	assert.NoError(err)
+	assert.Equal(second, current)
+
+	value, err := store.Value("ratelimit").Load()
+	assert.NoError(err)
+	assert.Equal(200, value)
+
+	rollback, err := store.Rollback("ratelimit", 1, "ops", "too permissive")
+	require.NoError(err)
+	assert.Equal(uint64(3), rollback.Version)
+	assert.Equal(uint64(1), rollback.RollbackOf)
+	assert.Equal(100, rollback.Value)
+	assert.Equal("ops", rollback.Author)
+
+	value, err = store.Value("ratelimit").Load()
+	assert.NoError(err)
+	assert.Equal(100, value)
+
+	for version := uint64(1); version <= 3; version++ {
+		snapshot, err := store.Get("ratelimit", version)
+		assert.NoError(err)
+		assert.Equal(version, snapshot.Version)
+	}
+
+	snapshot, err := store.Get("ratelimit", 4)
+	assert.Nil(snapshot)
+	assert.Equal(ErrorNoSuchVersion, err)
+
+	// exceed the history size
+	fourth := store.Put("ratelimit", 300, "joe", "")
+	history, err := store.History("ratelimit")
+	assert.NoError(err)
+	assert.Equal([]*Snapshot{second, rollback, fourth}, history)
+
+	snapshot, err = store.Get("ratelimit", 1)
+	assert.Nil(snapshot)
+	assert.Equal(ErrorNoSuchVersion, err)
+
+	snapshot, err = store.Rollback("ratelimit", 1, "ops", "")
+	assert.Nil(snapshot)
+	assert.Equal(ErrorNoSuchVersion, err)
+
+	snapshot, err = store.Get("ratelimit", 2)
+	assert.NoError(err)
+	assert.Equal(second, snapshot)
+
+	// modifying the returned history does not affect the store
+	history[0] = nil
+	history, err = store.History("ratelimit")
+	assert.NoError(err)
+	assert.Equal(second, history[0])
+
+	assert.Len(notified, 5)
+	assert.Equal(rollback, notified[3])
+}
+
+func TestSnapshotStoreListeners(t *testing.T) {
+	const puts = 50
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		store    *SnapshotStore
+		versions []uint64
+	)
+
+	store = NewSnapshotStore(puts, func(snapshot *Snapshot) {
+		// the snapshot is stored before listeners are notified
+		current, err := store.Current(snapshot.Namespace)
+		require.NoError(err)
+		assert.True(current.Version >= snapshot.Version)
+
+		versions = append(versions, snapshot.Version)
+	})
+
+	var waitGroup sync.WaitGroup
+	for repeat := 0; repeat < puts; repeat++ {
+		waitGroup.Add(1)
+		go func(value int) {
+			defer waitGroup.Done()
+			store.Put("test", value, "joe", "concurrent")
+		}(repeat)
+	}
+
+	waitGroup.Wait()
+
+	// notifications are delivered in version order
+	require.Len(versions, puts)
+	for index, version := range versions {
+		assert.Equal(uint64(index+1), version)
+	}
+}
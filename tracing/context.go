@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+)
+
+// contextKey is the type of the context keys used by this package
+type contextKey int
+
+const spanKey contextKey = iota
+
+// WithSpan returns a new Context carrying the given Span, which becomes the parent of spans started
+// from that Context
+func WithSpan(parent context.Context, span Span) context.Context {
+	return context.WithValue(parent, spanKey, span)
+}
+
+// WithSpanContext returns a new Context carrying a remote SpanContext, such as one extracted from an
+// incoming request, which becomes the parent of spans started from that Context
+func WithSpanContext(parent context.Context, sc SpanContext) context.Context {
+	return WithSpan(parent, nopSpan{sc})
+}
+
+// SpanFromContext returns the Span carried by the given Context, if any
+func SpanFromContext(ctx context.Context) (Span, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+
+	span, ok := ctx.Value(spanKey).(Span)
+	return span, ok
+}
+
+// SpanContextFromContext returns the SpanContext of the Span carried by the given Context.  If the Context
+// carries no Span, the zero SpanContext is returned.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span, ok := SpanFromContext(ctx); ok {
+		return span.Context()
+	}
+
+	return SpanContext{}
+}
+
+// StartSpan uses the process-wide Tracer to begin a span which is a child of the span carried by the given
+// Context, if any.  The new span is returned along with a Context carrying it.
+func StartSpan(ctx context.Context, name string) (Span, context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	span := GetTracer().StartSpan(name, SpanContextFromContext(ctx))
+	return span, WithSpan(ctx, span)
+}
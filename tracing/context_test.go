@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpanFromContext(t *testing.T) {
+	assert := assert.New(t)
+
+	span, ok := SpanFromContext(nil)
+	assert.Nil(span)
+	assert.False(ok)
+
+	span, ok = SpanFromContext(context.Background())
+	assert.Nil(span)
+	assert.False(ok)
+	assert.Equal(SpanContext{}, SpanContextFromContext(context.Background()))
+
+	expected := nopSpan{SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}}
+	span, ok = SpanFromContext(WithSpan(context.Background(), expected))
+	assert.Equal(expected, span)
+	assert.True(ok)
+
+	ctx := WithSpanContext(context.Background(), expected.context)
+	assert.Equal(expected.context, SpanContextFromContext(ctx))
+}
+
+func TestStartSpan(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		remote = SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}
+	)
+
+	// with the default tracer, the remote context propagates unchanged
+	span, ctx := StartSpan(WithSpanContext(context.Background(), remote), "test")
+	assert.Equal(remote, span.Context())
+	assert.Equal(remote, SpanContextFromContext(ctx))
+
+	span, ctx = StartSpan(nil, "test")
+	assert.Equal(SpanContext{}, span.Context())
+	assert.NotNil(ctx)
+
+	tracer := new(testTracer)
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	span, ctx = StartSpan(context.Background(), "child")
+	actual, ok := SpanFromContext(ctx)
+	assert.Equal(span, actual)
+	assert.True(ok)
+	assert.Equal([]string{"child"}, tracer.names)
+}
@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Comcast/webpa-common/wrp"
+)
+
+const (
+	// TraceParentHeader is the HTTP header which carries trace context, as defined by the W3C Trace Context specification
+	TraceParentHeader = "Traceparent"
+
+	// TraceParentMetadataKey is the WRP metadata key which carries trace context, in the same format as TraceParentHeader
+	TraceParentMetadataKey = "traceparent"
+
+	traceParentVersion = "00"
+	sampledFlag        = 0x01
+)
+
+var (
+	ErrorInvalidTraceParent = errors.New("Invalid traceparent value")
+)
+
+// FormatTraceParent renders a SpanContext as a W3C traceparent value.  An invalid SpanContext
+// produces an empty string.
+func FormatTraceParent(sc SpanContext) string {
+	if !sc.IsValid() {
+		return ""
+	}
+
+	var flags byte
+	if sc.Sampled {
+		flags |= sampledFlag
+	}
+
+	return fmt.Sprintf("%s-%s-%s-%02x", traceParentVersion, sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceParent parses a W3C traceparent value
+func ParseTraceParent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || parts[0] == "ff" || len(parts[0]) != 2 || (parts[0] == traceParentVersion && len(parts) != 4) {
+		return SpanContext{}, ErrorInvalidTraceParent
+	}
+
+	traceID, spanID := strings.ToLower(parts[1]), strings.ToLower(parts[2])
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) || !isHexID(parts[3], 2) {
+		return SpanContext{}, ErrorInvalidTraceParent
+	}
+
+	flags, _ := hex.DecodeString(parts[3])
+	return SpanContext{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Sampled: flags[0]&sampledFlag != 0,
+	}, nil
+}
+
+// isHexID tests if value is a hexadecimal string of the given length with at least one nonzero digit
+func isHexID(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+
+	if _, err := hex.DecodeString(value); err != nil {
+		return false
+	}
+
+	return length == 2 || strings.Trim(value, "0") != ""
+}
+
+// InjectHeader writes a SpanContext into HTTP headers.  An invalid SpanContext is not written.
+func InjectHeader(sc SpanContext, header http.Header) {
+	if value := FormatTraceParent(sc); len(value) > 0 {
+		header.Set(TraceParentHeader, value)
+	}
+}
+
+// ExtractHeader reads a SpanContext from HTTP headers.  The second return value is false if the
+// headers carry no valid trace context.
+func ExtractHeader(header http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceParent(header.Get(TraceParentHeader))
+	return sc, err == nil
+}
+
+// InjectMessage writes a SpanContext into the metadata of a WRP message, creating the metadata as necessary.
+// An invalid SpanContext is not written.  This function returns true if the message was changed.
+func InjectMessage(sc SpanContext, message *wrp.Message) bool {
+	value := FormatTraceParent(sc)
+	if len(value) == 0 || message.Metadata[TraceParentMetadataKey] == value {
+		return false
+	}
+
+	if message.Metadata == nil {
+		message.Metadata = make(map[string]string, 1)
+	}
+
+	message.Metadata[TraceParentMetadataKey] = value
+	return true
+}
+
+// ExtractMessage reads a SpanContext from the metadata of a WRP message.  The second return value is false
+// if the message carries no valid trace context.
+func ExtractMessage(message *wrp.Message) (SpanContext, bool) {
+	sc, err := ParseTraceParent(message.Metadata[TraceParentMetadataKey])
+	return sc, err == nil
+}
+
+// RequestContext returns the Context of an HTTP request, ensuring that it carries any trace context sent by
+// the client.  If the request's Context already carries a span, such as one started by earlier middleware,
+// the request's Context is returned unchanged.
+func RequestContext(request *http.Request) context.Context {
+	ctx := request.Context()
+	if _, ok := SpanFromContext(ctx); ok {
+		return ctx
+	}
+
+	if sc, ok := ExtractHeader(request.Header); ok {
+		return WithSpanContext(ctx, sc)
+	}
+
+	return ctx
+}
+
+// MessageContext returns a Context which carries the trace context of a WRP message.  If the given Context
+// already carries a span, it is returned unchanged.  Trace context from the transport, e.g. HTTP headers,
+// therefore takes precedence over any trace context in the message.
+func MessageContext(ctx context.Context, message *wrp.Message) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if _, ok := SpanFromContext(ctx); ok || message == nil {
+		return ctx
+	}
+
+	if sc, ok := ExtractMessage(message); ok {
+		return WithSpanContext(ctx, sc)
+	}
+
+	return ctx
+}
@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSpanContext = SpanContext{
+	TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+	SpanID:  "00f067aa0ba902b7",
+	Sampled: true,
+}
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestFormatTraceParent(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(testTraceParent, FormatTraceParent(testSpanContext))
+	assert.Equal(
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		FormatTraceParent(SpanContext{TraceID: testSpanContext.TraceID, SpanID: testSpanContext.SpanID}),
+	)
+
+	assert.Empty(FormatTraceParent(SpanContext{}))
+}
+
+func TestParseTraceParent(t *testing.T) {
+	testData := []struct {
+		value    string
+		expected SpanContext
+		valid    bool
+	}{
+		{testTraceParent, testSpanContext, true},
+		{" 00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01 ", testSpanContext, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", SpanContext{TraceID: testSpanContext.TraceID, SpanID: testSpanContext.SpanID}, true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", testSpanContext, true},
+		{"", SpanContext{}, false},
+		{"garbage", SpanContext{}, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", SpanContext{}, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", SpanContext{}, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", SpanContext{}, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", SpanContext{}, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", SpanContext{}, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bz-01", SpanContext{}, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1", SpanContext{}, false},
+	}
+
+	for _, record := range testData {
+		t.Run(record.value, func(t *testing.T) {
+			assert := assert.New(t)
+			actual, err := ParseTraceParent(record.value)
+			assert.Equal(record.expected, actual)
+			if record.valid {
+				assert.NoError(err)
+			} else {
+				assert.Equal(ErrorInvalidTraceParent, err)
+			}
+		})
+	}
+}
+
+func TestHeaderPropagation(t *testing.T) {
+	assert := assert.New(t)
+
+	header := make(http.Header)
+	InjectHeader(SpanContext{}, header)
+	assert.Empty(header)
+
+	sc, ok := ExtractHeader(header)
+	assert.Equal(SpanContext{}, sc)
+	assert.False(ok)
+
+	InjectHeader(testSpanContext, header)
+	assert.Equal(testTraceParent, header.Get(TraceParentHeader))
+
+	sc, ok = ExtractHeader(header)
+	assert.Equal(testSpanContext, sc)
+	assert.True(ok)
+}
+
+func TestMessagePropagation(t *testing.T) {
+	assert := assert.New(t)
+
+	message := new(wrp.Message)
+	assert.False(InjectMessage(SpanContext{}, message))
+	assert.Nil(message.Metadata)
+
+	sc, ok := ExtractMessage(message)
+	assert.Equal(SpanContext{}, sc)
+	assert.False(ok)
+
+	assert.True(InjectMessage(testSpanContext, message))
+	assert.Equal(map[string]string{TraceParentMetadataKey: testTraceParent}, message.Metadata)
+	assert.False(InjectMessage(testSpanContext, message))
+
+	sc, ok = ExtractMessage(message)
+	assert.Equal(testSpanContext, sc)
+	assert.True(ok)
+}
+
+func TestRequestContext(t *testing.T) {
+	assert := assert.New(t)
+
+	request := httptest.NewRequest("GET", "/", nil)
+	assert.Equal(request.Context(), RequestContext(request))
+
+	request.Header.Set(TraceParentHeader, testTraceParent)
+	assert.Equal(testSpanContext, SpanContextFromContext(RequestContext(request)))
+
+	// a span already in the context takes precedence over the header
+	existing := SpanContext{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331"}
+	request = request.WithContext(WithSpanContext(request.Context(), existing))
+	assert.Equal(existing, SpanContextFromContext(RequestContext(request)))
+}
+
+func TestMessageContext(t *testing.T) {
+	assert := assert.New(t)
+
+	message := new(wrp.Message)
+	assert.Equal(context.Background(), MessageContext(nil, message))
+	assert.Equal(context.Background(), MessageContext(context.Background(), nil))
+
+	InjectMessage(testSpanContext, message)
+	assert.Equal(testSpanContext, SpanContextFromContext(MessageContext(context.Background(), message)))
+
+	existing := SpanContext{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331"}
+	ctx := WithSpanContext(context.Background(), existing)
+	assert.Equal(existing, SpanContextFromContext(MessageContext(ctx, message)))
+}
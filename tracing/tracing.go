@@ -0,0 +1,109 @@
+/*
+Package tracing provides the hooks through which webpa-common participates in distributed traces.
+
+The infrastructure in this library, such as the secure/handler.AuthorizationHandler, device routing, WRP
+negotiation, and webhook delivery, creates spans using the process-wide Tracer set with SetTracer.  Any
+tracing system, e.g. OpenTracing or OpenTelemetry, can be plugged in by adapting it to the Tracer interface.
+By default, a no-op Tracer is used which creates no spans of its own but still propagates any incoming trace
+context, so that traces passing through a server are not broken.
+
+Trace context crosses service boundaries as a W3C traceparent value, carried in the TraceParentHeader of HTTP
+requests and in the TraceParentMetadataKey of WRP message metadata.
+*/
+package tracing
+
+import (
+	"sync"
+)
+
+// SpanContext is the portion of a span that is propagated across service boundaries
+type SpanContext struct {
+	// TraceID identifies the entire trace, as 32 lowercase hexadecimal characters
+	TraceID string
+
+	// SpanID identifies a single span within the trace, as 16 lowercase hexadecimal characters
+	SpanID string
+
+	// Sampled indicates whether the trace is being recorded
+	Sampled bool
+}
+
+// IsValid tests if this SpanContext identifies a span.  The zero value is not valid.
+func (sc SpanContext) IsValid() bool {
+	return len(sc.TraceID) > 0 && len(sc.SpanID) > 0
+}
+
+// Span is a single, timed operation within a trace
+type Span interface {
+	// Context returns the SpanContext which identifies this span to its children
+	Context() SpanContext
+
+	// SetTag annotates this span with a key/value pair
+	SetTag(key string, value interface{})
+
+	// SetError marks this span as failed.  A nil error is ignored.
+	SetError(err error)
+
+	// Finish completes this span.  Calling any other method after Finish has undefined results.
+	Finish()
+}
+
+// Tracer creates spans.  Implementations must be safe for concurrent use.
+type Tracer interface {
+	// StartSpan begins a new span with the given operation name.  If the parent is valid, the new span
+	// is its child.  Otherwise, the new span starts a new trace.
+	StartSpan(name string, parent SpanContext) Span
+}
+
+// nopTracer is the default Tracer
+type nopTracer struct{}
+
+func (nopTracer) StartSpan(name string, parent SpanContext) Span {
+	return nopSpan{parent}
+}
+
+// nopSpan is a Span which records nothing.  Its context is that of its parent, so that
+// any incoming trace context is propagated unchanged.
+type nopSpan struct {
+	context SpanContext
+}
+
+func (ns nopSpan) Context() SpanContext {
+	return ns.context
+}
+
+func (ns nopSpan) SetTag(string, interface{}) {}
+func (ns nopSpan) SetError(error)             {}
+func (ns nopSpan) Finish()                    {}
+
+// NopTracer returns a Tracer which creates no spans of its own.  The spans it returns carry their parent's
+// SpanContext, so trace context is still propagated.
+func NopTracer() Tracer {
+	return nopTracer{}
+}
+
+var global struct {
+	lock   sync.RWMutex
+	tracer Tracer
+}
+
+// SetTracer sets the process-wide Tracer used by the infrastructure in this library.  A nil Tracer
+// restores the default, NopTracer().  This function is typically called once, during initialization.
+func SetTracer(t Tracer) {
+	global.lock.Lock()
+	global.tracer = t
+	global.lock.Unlock()
+}
+
+// GetTracer returns the process-wide Tracer.  This function never returns nil.
+func GetTracer() Tracer {
+	global.lock.RLock()
+	t := global.tracer
+	global.lock.RUnlock()
+
+	if t != nil {
+		return t
+	}
+
+	return NopTracer()
+}
@@ -0,0 +1,58 @@
+package tracing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testTracer is a minimal Tracer which records the names of the spans it starts
+type testTracer struct {
+	names []string
+}
+
+func (tt *testTracer) StartSpan(name string, parent SpanContext) Span {
+	tt.names = append(tt.names, name)
+	return nopSpan{SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}}
+}
+
+func TestSpanContextIsValid(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(SpanContext{}.IsValid())
+	assert.False(SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"}.IsValid())
+	assert.False(SpanContext{SpanID: "00f067aa0ba902b7"}.IsValid())
+	assert.True(SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}.IsValid())
+}
+
+func TestNopTracer(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		parent = SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}
+		span   = NopTracer().StartSpan("test", parent)
+	)
+
+	assert.Equal(parent, span.Context())
+	span.SetTag("key", "value")
+	span.SetError(errors.New("expected"))
+	span.Finish()
+
+	assert.Equal(SpanContext{}, NopTracer().StartSpan("test", SpanContext{}).Context())
+}
+
+func TestSetTracer(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(NopTracer(), GetTracer())
+
+	tracer := new(testTracer)
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	assert.Equal(tracer, GetTracer())
+	GetTracer().StartSpan("test", SpanContext{})
+	assert.Equal([]string{"test"}, tracer.names)
+
+	SetTracer(nil)
+	assert.Equal(NopTracer(), GetTracer())
+}
@@ -0,0 +1,130 @@
+/*
+Package tracingtest provides a Tracer which records spans, so that tests can verify the spans created by code
+under test.
+*/
+package tracingtest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Comcast/webpa-common/tracing"
+)
+
+// Span is a span recorded by a Tracer
+type Span struct {
+	tracer  *Tracer
+	context tracing.SpanContext
+
+	// Name is the operation name passed to StartSpan
+	Name string
+
+	// Parent is the parent SpanContext passed to StartSpan
+	Parent tracing.SpanContext
+
+	// Tags holds the tags set on this span
+	Tags map[string]interface{}
+
+	// Error is the last error set on this span
+	Error error
+
+	// Finished indicates whether Finish has been called
+	Finished bool
+}
+
+func (s *Span) Context() tracing.SpanContext {
+	return s.context
+}
+
+func (s *Span) SetTag(key string, value interface{}) {
+	s.tracer.lock.Lock()
+	s.Tags[key] = value
+	s.tracer.lock.Unlock()
+}
+
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.tracer.lock.Lock()
+		s.Error = err
+		s.tracer.lock.Unlock()
+	}
+}
+
+func (s *Span) Finish() {
+	s.tracer.lock.Lock()
+	s.Finished = true
+	s.tracer.lock.Unlock()
+}
+
+// Tracer is a tracing.Tracer which records every span it starts.  Span and trace identifiers are
+// assigned sequentially, and every trace is sampled.
+type Tracer struct {
+	lock  sync.Mutex
+	next  uint64
+	spans []*Span
+}
+
+// NewTracer creates an empty Tracer
+func NewTracer() *Tracer {
+	return new(Tracer)
+}
+
+func (t *Tracer) StartSpan(name string, parent tracing.SpanContext) tracing.Span {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.next++
+	context := tracing.SpanContext{
+		TraceID: parent.TraceID,
+		SpanID:  fmt.Sprintf("%016x", t.next),
+		Sampled: true,
+	}
+
+	if !parent.IsValid() {
+		context.TraceID = fmt.Sprintf("%032x", t.next)
+	}
+
+	span := &Span{
+		tracer:  t,
+		context: context,
+		Name:    name,
+		Parent:  parent,
+		Tags:    make(map[string]interface{}),
+	}
+
+	t.spans = append(t.spans, span)
+	return span
+}
+
+// Spans returns copies of all the spans started so far, in the order they were started
+func (t *Tracer) Spans() []Span {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	spans := make([]Span, len(t.spans))
+	for i, s := range t.spans {
+		spans[i] = *s
+		spans[i].Tags = make(map[string]interface{}, len(s.Tags))
+		for k, v := range s.Tags {
+			spans[i].Tags[k] = v
+		}
+	}
+
+	return spans
+}
+
+// Install sets this Tracer as the process-wide tracer, returning a function which restores the default.
+// Tests typically use this as:
+//
+//	defer tracingtest.NewTracer().Install()()
+//
+// or, to examine the spans:
+//
+//	tracer := tracingtest.NewTracer()
+//	defer tracer.Install()()
+func (t *Tracer) Install() func() {
+	tracing.SetTracer(t)
+	return func() {
+		tracing.SetTracer(nil)
+	}
+}
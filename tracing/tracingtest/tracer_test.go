@@ -0,0 +1,46 @@
+package tracingtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Comcast/webpa-common/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracer(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		tracer = NewTracer()
+	)
+
+	restore := tracer.Install()
+	assert.Equal(tracer, tracing.GetTracer())
+
+	root, ctx := tracing.StartSpan(context.Background(), "root")
+	child, _ := tracing.StartSpan(ctx, "child")
+	child.SetTag("key", "value")
+	child.SetError(nil)
+	child.SetError(errors.New("expected"))
+	child.Finish()
+
+	restore()
+	assert.Equal(tracing.NopTracer(), tracing.GetTracer())
+
+	spans := tracer.Spans()
+	if assert.Len(spans, 2) {
+		assert.Equal("root", spans[0].Name)
+		assert.False(spans[0].Parent.IsValid())
+		assert.True(root.Context().IsValid())
+		assert.False(spans[0].Finished)
+
+		assert.Equal("child", spans[1].Name)
+		assert.Equal(root.Context(), spans[1].Parent)
+		assert.Equal(root.Context().TraceID, child.Context().TraceID)
+		assert.NotEqual(root.Context().SpanID, child.Context().SpanID)
+		assert.Equal(map[string]interface{}{"key": "value"}, spans[1].Tags)
+		assert.Equal(errors.New("expected"), spans[1].Error)
+		assert.True(spans[1].Finished)
+	}
+}
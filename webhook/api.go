@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/Comcast/webpa-common/secure/handler"
+)
+
+const (
+	// OwnerParameter is the query parameter which restricts a listing to the hooks of a single owner
+	OwnerParameter = "owner"
+
+	// EventParameter is the query parameter which restricts a listing to the hooks receiving an event type
+	EventParameter = "event"
+
+	// URLParameter is the query parameter identifying the hook to delete
+	URLParameter = "url"
+
+	// RedactedSecret replaces the secrets of webhooks listed to principals other than their owners
+	RedactedSecret = "<redacted>"
+)
+
+var (
+	ErrNotOwner      = errors.New("The webhook is owned by another principal")
+	ErrNoSuchWebhook = errors.New("No webhook is registered with that URL")
+	ErrNoPrincipal   = errors.New("The request's credentials do not identify a principal")
+)
+
+// deletedUntil is the expiration published for a deleted hook.  Since it has already passed,
+// every instance removes the hook when the update arrives.
+var deletedUntil = time.Unix(0, 0).UTC()
+
+// ownedBy tests if this hook is owned by the given principal.  Hooks registered without credentials have no owner.
+func (w *W) ownedBy(principal string) bool {
+	return len(w.Owner) > 0 && w.Owner == principal
+}
+
+// redacted returns a copy of this hook suitable for listing to a principal.  Unless the principal owns the hook,
+// its secret is replaced with RedactedSecret.
+func (w *W) redacted(principal string) W {
+	copyOf := *w
+	if len(copyOf.Config.Secret) > 0 && !w.ownedBy(principal) {
+		copyOf.Config.Secret = RedactedSecret
+	}
+
+	return copyOf
+}
+
+// canManage tests if a principal may replace or delete a hook.  An owned hook may only be managed by its owner.
+// A hook without an owner, e.g. one registered before owners were recorded, may be managed by Admins.  When the
+// registry is served without authorization, requests have no principal and manage unowned hooks as they always have.
+func (r *Registry) canManage(w *W, principal string) bool {
+	if len(w.Owner) > 0 {
+		return w.Owner == principal
+	}
+
+	if len(principal) == 0 {
+		return true
+	}
+
+	for _, admin := range r.Admins {
+		if admin == principal {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewAPIHandler returns the self-service HTTP API for this registry, decorated by the given
+// AuthorizationHandler.  The principal of each request's credentials is recorded as the owner of
+// the hooks it registers, so requests whose credentials have no principal are rejected with ErrNoPrincipal.
+// The handler dispatches on the request method:
+//
+//	POST   registers or replaces a hook, as with UpdateRegistry
+//	GET    lists hooks, optionally filtered by OwnerParameter and EventParameter, as with GetRegistry
+//	DELETE removes the hook identified by URLParameter, as with DeleteRegistry
+func (r *Registry) NewAPIHandler(authorization handler.AuthorizationHandler) http.Handler {
+	authorization.RecordPrincipal = true
+	return authorization.Decorate(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if len(secure.RequestPrincipal(request.Context())) == 0 {
+			jsonResponse(response, http.StatusForbidden, ErrNoPrincipal.Error())
+			return
+		}
+
+		switch request.Method {
+		case "POST":
+			r.UpdateRegistry(response, request)
+		case "GET":
+			r.GetRegistry(response, request)
+		case "DELETE":
+			r.DeleteRegistry(response, request)
+		default:
+			response.Header().Set("Allow", "DELETE, GET, POST")
+			jsonResponse(response, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}))
+}
@@ -0,0 +1,192 @@
+package webhook
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/Comcast/webpa-common/secure/handler"
+	AWS "github.com/Comcast/webpa-common/webhook/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier is an AWS.Notifier which captures published messages
+type recordingNotifier struct {
+	AWS.Notifier
+	published []W
+}
+
+func (n *recordingNotifier) PublishMessage(message string) {
+	n.TryPublishMessage(message)
+}
+
+func (n *recordingNotifier) TryPublishMessage(message string) error {
+	var w W
+	if err := json.Unmarshal([]byte(message), &w); err != nil {
+		return err
+	}
+
+	n.published = append(n.published, w)
+	return nil
+}
+
+func basicAuthorization(principal string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(principal+":password"))
+}
+
+func testAPIHook(url, owner string, events ...string) W {
+	w := W{Events: events, Owner: owner, Until: time.Now().Add(time.Hour)}
+	w.Config.URL = url
+	w.Config.Secret = "secret of " + url
+	return w
+}
+
+func TestRegistryAPI(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		notifier = new(recordingNotifier)
+		registry = NewRegistry(&monitor{
+			list: NewList([]W{
+				testAPIHook("https://alice.example.com/hook", "alice", "iot"),
+				testAPIHook("https://anyone.example.com/hook", "", "online", "offline"),
+			}),
+			Notifier: notifier,
+			validator: NewValidator(&ValidationOptions{
+				Resolver: testResolver(map[string][]string{
+					"alice.example.com": {"203.0.113.1"},
+					"bob.example.com":   {"203.0.113.2"},
+				}),
+			}),
+		})
+
+		api = registry.NewAPIHandler(handler.AuthorizationHandler{
+			Validator: secure.ValidatorFunc(func(context.Context, *secure.Token) (bool, error) { return true, nil }),
+		})
+	)
+
+	registry.Admins = []string{"admin"}
+
+	serve := func(method, target, principal, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		if len(principal) > 0 {
+			request.Header.Set(secure.AuthorizationHeader, basicAuthorization(principal))
+		}
+
+		response := httptest.NewRecorder()
+		api.ServeHTTP(response, request)
+		return response
+	}
+
+	hooks := func(target, principal string) []W {
+		response := serve("GET", target, principal, "")
+		require.Equal(http.StatusOK, response.Code)
+
+		var hooks []W
+		require.NoError(json.Unmarshal(response.Body.Bytes(), &hooks))
+		return hooks
+	}
+
+	list := func(target string) []string {
+		var urls []string
+		for _, w := range hooks(target, "alice") {
+			urls = append(urls, w.Config.URL)
+		}
+
+		return urls
+	}
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		assert.Equal(http.StatusForbidden, serve("GET", "/hooks", "", "").Code)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		assert.Equal([]string{"https://alice.example.com/hook", "https://anyone.example.com/hook"}, list("/hooks"))
+		assert.Equal([]string{"https://alice.example.com/hook"}, list("/hooks?owner=alice"))
+		assert.Equal([]string{"https://anyone.example.com/hook"}, list("/hooks?owner="))
+		assert.Equal([]string{"https://anyone.example.com/hook"}, list("/hooks?event=offline"))
+		assert.Empty(list("/hooks?owner=alice&event=offline"))
+	})
+
+	t.Run("Secrets", func(t *testing.T) {
+		listed := hooks("/hooks", "alice")
+		require.Len(listed, 2)
+		assert.Equal("secret of https://alice.example.com/hook", listed[0].Config.Secret)
+		assert.Equal(RedactedSecret, listed[1].Config.Secret)
+
+		listed = hooks("/hooks", "bob")
+		require.Len(listed, 2)
+		assert.Equal(RedactedSecret, listed[0].Config.Secret)
+		assert.Equal(RedactedSecret, listed[1].Config.Secret)
+
+		// listing never changes the registered hooks
+		assert.Equal("secret of https://alice.example.com/hook", registry.find("https://alice.example.com/hook").Config.Secret)
+	})
+
+	t.Run("Register", func(t *testing.T) {
+		// the owner is always the registering principal
+		response := serve("POST", "/hooks", "bob", `{"config": {"url": "https://bob.example.com/hook"}, "events": ["iot"], "owner": "alice"}`)
+		assert.Equal(http.StatusOK, response.Code)
+		require.Len(notifier.published, 1)
+		assert.Equal("bob", notifier.published[0].Owner)
+
+		response = serve("POST", "/hooks", "bob", `{"config": {"url": "https://alice.example.com/hook"}, "events": ["iot"]}`)
+		assert.Equal(http.StatusForbidden, response.Code)
+		assert.Len(notifier.published, 1)
+
+		response = serve("POST", "/hooks", "alice", `{"config": {"url": "https://alice.example.com/hook"}, "events": ["online"]}`)
+		assert.Equal(http.StatusOK, response.Code)
+		require.Len(notifier.published, 2)
+		assert.Equal("alice", notifier.published[1].Owner)
+		assert.Equal([]string{"online"}, notifier.published[1].Events)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		notifier.published = nil
+
+		assert.Equal(http.StatusNotFound, serve("DELETE", "/hooks?url=https://nosuch.example.com/hook", "alice", "").Code)
+		assert.Equal(http.StatusForbidden, serve("DELETE", "/hooks?url=https://alice.example.com/hook", "bob", "").Code)
+		assert.Equal(http.StatusForbidden, serve("DELETE", "/hooks?url=https://alice.example.com/hook", "admin", "").Code)
+		assert.Equal(http.StatusForbidden, serve("DELETE", "/hooks?url=https://anyone.example.com/hook", "bob", "").Code)
+		assert.Empty(notifier.published)
+
+		assert.Equal(http.StatusOK, serve("DELETE", "/hooks?url=https://alice.example.com/hook", "alice", "").Code)
+		assert.Equal(http.StatusOK, serve("DELETE", "/hooks?url=https://anyone.example.com/hook", "admin", "").Code)
+		require.Len(notifier.published, 2)
+		for _, w := range notifier.published {
+			assert.True(w.Until.Before(time.Now()))
+		}
+
+		// instances remove deleted hooks when the published update arrives
+		registry.m.list.Update(notifier.published)
+		assert.Zero(registry.m.list.Len())
+	})
+
+	t.Run("Unsynced", func(t *testing.T) {
+		// another instance accepted bob's registration before alice's hook reached it
+		registry.m.list.Update([]W{testAPIHook("https://alice.example.com/hook", "alice", "iot")})
+		registry.m.list.Update([]W{testAPIHook("https://alice.example.com/hook", "bob", "online")})
+		require.Equal(1, registry.m.list.Len())
+		assert.Equal("alice", registry.m.list.Get(0).Owner)
+		assert.Equal([]string{"iot"}, registry.m.list.Get(0).Events)
+
+		deleted := testAPIHook("https://alice.example.com/hook", "bob", "iot")
+		deleted.Until = time.Now().Add(-time.Hour)
+		registry.m.list.Update([]W{deleted})
+		assert.Equal(1, registry.m.list.Len())
+	})
+
+	t.Run("MethodNotAllowed", func(t *testing.T) {
+		response := serve("PUT", "/hooks", "alice", "")
+		assert.Equal(http.StatusMethodNotAllowed, response.Code)
+		assert.Equal("DELETE, GET, POST", response.Header().Get("Allow"))
+	})
+}
@@ -0,0 +1,22 @@
+package aws
+
+import "github.com/aws/aws-sdk-go/aws/awserr"
+
+// credentialErrorCodes are the AWS error codes which indicate that the credentials in use are
+// no longer accepted, as happens when temporary role credentials rotate
+var credentialErrorCodes = map[string]bool{
+	"ExpiredToken":          true,
+	"ExpiredTokenException": true,
+	"InvalidClientTokenId":  true,
+	"RequestExpired":        true,
+	"SignatureDoesNotMatch": true,
+}
+
+// isCredentialError tests if an error returned by an AWS API call was caused by rejected credentials
+func isCredentialError(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return credentialErrorCodes[awsErr.Code()]
+	}
+
+	return false
+}
@@ -0,0 +1,19 @@
+package aws
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsCredentialError(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isCredentialError(awserr.New("ExpiredToken", "expired", nil)))
+	assert.True(isCredentialError(awserr.New("InvalidClientTokenId", "invalid", nil)))
+	assert.False(isCredentialError(awserr.New("NotFound", "no such topic", nil)))
+	assert.False(isCredentialError(errors.New("ExpiredToken")))
+	assert.False(isCredentialError(nil))
+}
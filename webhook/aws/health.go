@@ -0,0 +1,23 @@
+package aws
+
+import (
+	"github.com/Comcast/webpa-common/health"
+)
+
+const (
+	// HealthSource is the source of the health events published by an SNSServer
+	HealthSource = "sns"
+
+	// StatusReady and StatusNotReady are the statuses an SNSServer publishes as its subscription changes
+	StatusReady    = "ready"
+	StatusNotReady = "not ready"
+
+	TotalDataPayloadReceived health.Stat = "TotalDataPayloadReceived"
+	TotalDataPayloadSent     health.Stat = "TotalDataPayloadSent"
+)
+
+// healthPublisher returns the Publisher for this server's health events, which discards
+// the events if no Health publisher has been set
+func (ss *SNSServer) healthPublisher() health.Publisher {
+	return health.SourcePublisher(ss.Health, HealthSource)
+}
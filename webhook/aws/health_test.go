@@ -0,0 +1,40 @@
+package aws
+
+import (
+	"github.com/Comcast/webpa-common/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSNSServerHealthEvents(t *testing.T) {
+	var (
+		assert       = assert.New(t)
+		ss, _, mv, _ = SetUpTestSNSServer()
+		published    []health.Event
+	)
+
+	ss.Health = health.PublisherFunc(func(e health.Event) { published = append(published, e) })
+	ss.subscriptionArn.Store("testSubscriptionArn")
+	mv.On("Validate", mock.AnythingOfType("*aws.SNSMessage")).Return(true, nil)
+
+	request := newSNSRequest(NOTIF_MSG, NotificationType)
+	request.Header.Set("x-amz-sns-subscription-arn", "testSubscriptionArn")
+	response := httptest.NewRecorder()
+
+	assert.NotNil(ss.NotificationHandle(response, request))
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal(
+		[]health.Event{{Source: HealthSource, Type: health.CounterEvent, Stat: TotalDataPayloadReceived, Value: len(NOTIF_MSG)}},
+		published,
+	)
+}
+
+func TestSNSServerHealthPublisherDefault(t *testing.T) {
+	ss := new(SNSServer)
+	assert.NotPanics(t, func() {
+		ss.healthPublisher().Publish(health.StatusChange(HealthSource, StatusReady))
+	})
+}
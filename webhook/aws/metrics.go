@@ -0,0 +1,63 @@
+package aws
+
+import (
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// PublishQueueDepthGauge is the number of messages waiting to be published to the SNS topic
+	PublishQueueDepthGauge = "sns_publish_queue_depth"
+
+	// PublishQueueCapacityGauge is the maximum number of messages which may wait to be published
+	PublishQueueCapacityGauge = "sns_publish_queue_capacity"
+
+	// PublishDroppedCounter is the total number of messages dropped because the publish queue was full
+	PublishDroppedCounter = "sns_publish_dropped_count"
+
+	// ReasonLabel is the label identifying why a message was dropped
+	ReasonLabel = "reason"
+
+	// OverflowReason is the reason for messages dropped immediately under OverflowDrop
+	OverflowReason = "overflow"
+
+	// TimeoutReason is the reason for messages dropped after the PublishTimeout under OverflowBlock
+	TimeoutReason = "timeout"
+)
+
+// Metrics is the xmetrics.Module for this package
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name: PublishQueueDepthGauge,
+			Type: xmetrics.GaugeType,
+			Help: "The number of messages waiting to be published to the SNS topic",
+		},
+		{
+			Name: PublishQueueCapacityGauge,
+			Type: xmetrics.GaugeType,
+			Help: "The maximum number of messages which may wait to be published to the SNS topic",
+		},
+		{
+			Name:       PublishDroppedCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of messages dropped because the SNS publish queue was full",
+			LabelNames: []string{ReasonLabel},
+		},
+	}
+}
+
+// measures is the set of metrics updated by an SNSServer
+type measures struct {
+	queueDepth    metrics.Gauge
+	queueCapacity metrics.Gauge
+	dropped       metrics.Counter
+}
+
+func newMeasures(p xmetrics.Provider) measures {
+	return measures{
+		queueDepth:    p.NewGauge(PublishQueueDepthGauge),
+		queueCapacity: p.NewGauge(PublishQueueCapacityGauge),
+		dropped:       p.NewCounter(PublishDroppedCounter),
+	}
+}
@@ -0,0 +1,134 @@
+package aws
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock/clocktest"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	assert.NotNil(t, registry)
+	assert.NoError(t, err)
+}
+
+// newTestPublishServer produces an initialized SNSServer whose publish queue is never drained
+func newTestPublishServer(t *testing.T, config SNSConfig) (*SNSServer, func() string) {
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	require.NoError(t, err)
+
+	awsCfg, err := NewAWSConfig(nil)
+	require.NoError(t, err)
+
+	awsCfg.Sns.PublishQueueSize = config.PublishQueueSize
+	awsCfg.Sns.Overflow = config.Overflow
+	awsCfg.Sns.PublishTimeout = config.PublishTimeout
+
+	ss := &SNSServer{
+		Config:          *awsCfg,
+		SVC:             &MockSVC{},
+		SNSValidator:    &MockValidator{},
+		MetricsProvider: registry,
+	}
+
+	ss.Initialize(mux.NewRouter(), nil, nil, nil)
+
+	scrape := func() string {
+		response := httptest.NewRecorder()
+		registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+		return response.Body.String()
+	}
+
+	return ss, scrape
+}
+
+func TestPublishMessageDefaultQueue(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		ss, scrape = newTestPublishServer(t, SNSConfig{})
+	)
+
+	assert.Equal(DefaultPublishQueueSize, cap(ss.notificationData))
+	assert.NoError(ss.TryPublishMessage(TEST_HOOK))
+
+	output := scrape()
+	assert.Contains(output, PublishQueueCapacityGauge+" 10")
+	assert.Contains(output, PublishQueueDepthGauge+" 1")
+}
+
+func TestNewNotifierMetricsProvider(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	require.NoError(err)
+
+	notifier, err := NewNotifier(nil, registry)
+	require.NoError(err)
+	notifier.Initialize(mux.NewRouter(), nil, nil, nil)
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(response.Body.String(), PublishQueueCapacityGauge+" 10")
+}
+
+func TestPublishMessageOverflowDrop(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		ss, scrape = newTestPublishServer(t, SNSConfig{PublishQueueSize: 2, Overflow: OverflowDrop})
+	)
+
+	assert.NoError(ss.TryPublishMessage(TEST_HOOK))
+	assert.NoError(ss.TryPublishMessage(TEST_HOOK))
+	assert.Equal(ErrorPublishQueueFull, ss.TryPublishMessage(TEST_HOOK))
+	assert.Equal(ErrorPublishQueueFull, ss.TryPublishMessage(TEST_HOOK))
+
+	output := scrape()
+	assert.Contains(output, PublishQueueCapacityGauge+" 2")
+	assert.Contains(output, PublishQueueDepthGauge+" 2")
+	assert.Contains(output, PublishDroppedCounter+`{reason="overflow"} 2`)
+}
+
+func TestPublishMessageOverflowBlock(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		require    = require.New(t)
+		ss, scrape = newTestPublishServer(t, SNSConfig{PublishQueueSize: 1, PublishTimeout: time.Minute})
+		clock      = clocktest.NewClock(time.Now())
+		result     = make(chan error, 1)
+	)
+
+	ss.Clock = clock
+	require.NoError(ss.TryPublishMessage(TEST_HOOK))
+
+	// nothing drains the queue, so the publish times out
+	go func() { result <- ss.TryPublishMessage(TEST_HOOK) }()
+	clock.BlockUntil(1)
+	clock.Add(time.Minute - time.Millisecond)
+	select {
+	case <-result:
+		assert.Fail("The publish should not have timed out yet")
+	default:
+	}
+
+	clock.Add(time.Millisecond)
+	assert.Equal(ErrorPublishTimeout, <-result)
+
+	// room made while blocked allows the publish to succeed
+	go func() { result <- ss.TryPublishMessage(TEST_HOOK) }()
+	clock.BlockUntil(1)
+	<-ss.notificationData
+	assert.NoError(<-result)
+
+	output := scrape()
+	assert.Contains(output, PublishQueueDepthGauge+" 1")
+	assert.Contains(output, PublishDroppedCounter+`{reason="timeout"} 1`)
+}
@@ -35,6 +35,21 @@ func (m *MockSVC) Unsubscribe(input *sns.UnsubscribeInput) (*sns.UnsubscribeOutp
 	return args.Get(0).(*sns.UnsubscribeOutput), args.Error(1)
 }
 
+func (m *MockSVC) CreateTopic(input *sns.CreateTopicInput) (*sns.CreateTopicOutput, error) {
+	args := m.Called(input)
+	return args.Get(0).(*sns.CreateTopicOutput), args.Error(1)
+}
+
+func (m *MockSVC) GetTopicAttributes(input *sns.GetTopicAttributesInput) (*sns.GetTopicAttributesOutput, error) {
+	args := m.Called(input)
+	return args.Get(0).(*sns.GetTopicAttributesOutput), args.Error(1)
+}
+
+func (m *MockSVC) SetTopicAttributes(input *sns.SetTopicAttributesInput) (*sns.SetTopicAttributesOutput, error) {
+	args := m.Called(input)
+	return args.Get(0).(*sns.SetTopicAttributesOutput), args.Error(1)
+}
+
 func (m *MockValidator) Validate(msg *SNSMessage) (bool, error) {
 	args := m.Called(msg)
 	return args.Get(0).(bool), args.Error(1)
@@ -0,0 +1,270 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+)
+
+const (
+	// SelfUrlStatic uses the self URL passed to Initialize as is.  This is the default.
+	SelfUrlStatic = "static"
+
+	// SelfUrlEnv takes the host of the self URL from an environment variable
+	SelfUrlEnv = "env"
+
+	// SelfUrlInterface takes the host of the self URL from the first IPv4 address of a network interface
+	SelfUrlInterface = "interface"
+
+	// SelfUrlEC2 takes the host of the self URL from the EC2 instance metadata
+	SelfUrlEC2 = "ec2"
+
+	DefaultSelfUrlEnvVar      = "SNS_SELF_HOST"
+	DefaultSelfUrlEC2Metadata = "local-ipv4"
+)
+
+var (
+	ErrorNoSelfHost           = errors.New("No host could be determined for the SNS self url")
+	ErrorNoInterfaceAddress   = errors.New("The network interface has no usable IPv4 address")
+	ErrorInvalidSelfUrlSource = errors.New("Invalid SNS self url source")
+)
+
+// SelfUrlConfig describes how an SNSServer determines the URL it advertises to SNS.  In autoscaling
+// groups, each instance's address is only known at runtime, so the host is derived dynamically while
+// the scheme, port, and path still come from the self URL passed to Initialize and the SNS UrlPath.
+type SelfUrlConfig struct {
+	// Source is where the host comes from:  SelfUrlStatic, SelfUrlEnv, SelfUrlInterface, or SelfUrlEC2.
+	// If not supplied, SelfUrlStatic is used.
+	Source string `json:"source"`
+
+	// EnvVar is the environment variable holding the host, optionally with a port, for SelfUrlEnv.
+	// If not supplied, DefaultSelfUrlEnvVar is used.
+	EnvVar string `json:"envVar"`
+
+	// Interface is the name of the network interface used by SelfUrlInterface, e.g. "eth0"
+	Interface string `json:"interface"`
+
+	// EC2Metadata is the instance metadata path, such as "public-hostname", used by SelfUrlEC2.
+	// If not supplied, DefaultSelfUrlEC2Metadata is used.
+	EC2Metadata string `json:"ec2Metadata"`
+
+	// RefreshInterval is how often the host is derived again once the server has started.  When the
+	// host changes, the server subscribes with the new URL and drops the old subscription.  If not
+	// supplied, the host is only derived once, in Initialize.
+	RefreshInterval time.Duration `json:"refreshInterval"`
+}
+
+func (c *SelfUrlConfig) source() string {
+	if len(c.Source) > 0 {
+		return c.Source
+	}
+
+	return SelfUrlStatic
+}
+
+func (c *SelfUrlConfig) envVar() string {
+	if len(c.EnvVar) > 0 {
+		return c.EnvVar
+	}
+
+	return DefaultSelfUrlEnvVar
+}
+
+func (c *SelfUrlConfig) ec2Metadata() string {
+	if len(c.EC2Metadata) > 0 {
+		return c.EC2Metadata
+	}
+
+	return DefaultSelfUrlEC2Metadata
+}
+
+// SelfHostFunc returns the host, optionally with a port, which an SNSServer advertises to SNS
+type SelfHostFunc func() (string, error)
+
+// NewSelfHostFunc creates the SelfHostFunc described by the given configuration.  The ConfigProvider,
+// normally the AWS session, is only used for SelfUrlEC2.  A nil function is returned for SelfUrlStatic.
+func NewSelfHostFunc(c SelfUrlConfig, p client.ConfigProvider) (SelfHostFunc, error) {
+	switch c.source() {
+	case SelfUrlStatic:
+		return nil, nil
+
+	case SelfUrlEnv:
+		return EnvSelfHost(c.envVar()), nil
+
+	case SelfUrlInterface:
+		if len(c.Interface) == 0 {
+			return nil, fmt.Errorf("no network interface configured for the %s self url source", SelfUrlInterface)
+		}
+
+		return InterfaceSelfHost(c.Interface), nil
+
+	case SelfUrlEC2:
+		if p == nil {
+			return nil, fmt.Errorf("no AWS session available for the %s self url source", SelfUrlEC2)
+		}
+
+		return EC2SelfHost(ec2metadata.New(p), c.ec2Metadata()), nil
+
+	default:
+		return nil, ErrorInvalidSelfUrlSource
+	}
+}
+
+// EnvSelfHost returns a SelfHostFunc which reads the host from an environment variable
+func EnvSelfHost(name string) SelfHostFunc {
+	return func() (string, error) {
+		if host := strings.TrimSpace(os.Getenv(name)); len(host) > 0 {
+			return host, nil
+		}
+
+		return "", ErrorNoSelfHost
+	}
+}
+
+// InterfaceSelfHost returns a SelfHostFunc which uses the first IPv4 address of a network interface
+func InterfaceSelfHost(name string) SelfHostFunc {
+	return func() (string, error) {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return "", err
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return "", err
+		}
+
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				if ip := ipNet.IP.To4(); ip != nil && !ip.IsLoopback() {
+					return ip.String(), nil
+				}
+			}
+		}
+
+		return "", ErrorNoInterfaceAddress
+	}
+}
+
+// EC2SelfHost returns a SelfHostFunc which reads the host from the EC2 instance metadata at the given path
+func EC2SelfHost(metadata *ec2metadata.EC2Metadata, path string) SelfHostFunc {
+	return func() (string, error) {
+		host, err := metadata.GetMetadata(path)
+		if err != nil {
+			return "", err
+		}
+
+		if host = strings.TrimSpace(host); len(host) == 0 {
+			return "", ErrorNoSelfHost
+		}
+
+		return host, nil
+	}
+}
+
+// withSelfHost returns a copy of a self URL with its host replaced.  The port of the original URL
+// is kept unless the new host supplies its own.
+func withSelfHost(selfUrl *url.URL, host string) *url.URL {
+	derived := *selfUrl
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		derived.Host = host
+	} else if port := selfUrl.Port(); len(port) > 0 {
+		derived.Host = net.JoinHostPort(host, port)
+	} else {
+		derived.Host = host
+	}
+
+	return &derived
+}
+
+// deriveSelfUrl applies the SelfHost function, if any, to the current self URL.  If no host can be
+// determined, the current self URL is returned along with the error.
+func (ss *SNSServer) deriveSelfUrl() (*url.URL, error) {
+	current := ss.selfUrl()
+	if ss.SelfHost == nil {
+		return current, nil
+	}
+
+	host, err := ss.SelfHost()
+	if err != nil {
+		return current, err
+	}
+
+	return withSelfHost(current, host), nil
+}
+
+// selfUrl returns the URL currently advertised to SNS
+func (ss *SNSServer) selfUrl() *url.URL {
+	ss.selfUrlLock.RLock()
+	defer ss.selfUrlLock.RUnlock()
+	return ss.SelfUrl
+}
+
+// refreshSelfUrl derives the self URL again and, if it has changed, subscribes with the new URL.  The previous
+// subscription keeps delivering notifications until the new one is confirmed, at which point it is unsubscribed.
+// This method returns true if the self URL changed.
+func (ss *SNSServer) refreshSelfUrl() bool {
+	derived, err := ss.deriveSelfUrl()
+	if err != nil {
+		ss.Error("SNS unable to derive self url, keeping %s: %v", ss.selfUrl(), err)
+		return false
+	}
+
+	ss.selfUrlLock.Lock()
+	if derived.String() == ss.SelfUrl.String() {
+		ss.selfUrlLock.Unlock()
+		return false
+	}
+
+	previous := ss.SelfUrl
+	ss.SelfUrl = derived
+
+	// if an earlier change is still awaiting confirmation, the subscription to retire is still the confirmed one
+	if previousArn, _ := ss.subscriptionArn.Load().(string); len(ss.retiringArn) == 0 && isSubscriptionArn(previousArn) {
+		ss.retiringArn = previousArn
+	}
+
+	ss.selfUrlLock.Unlock()
+
+	ss.Error("SNS self url changed from %s to %s, subscribing again", previous, derived)
+	ss.Subscribe()
+	return true
+}
+
+// retireSubscription unsubscribes the subscription for a previous self url, if any, now that the given
+// subscription has been confirmed
+func (ss *SNSServer) retireSubscription(confirmedArn string) {
+	ss.selfUrlLock.Lock()
+	retiringArn := ss.retiringArn
+	if retiringArn != confirmedArn {
+		ss.retiringArn = ""
+	}
+
+	ss.selfUrlLock.Unlock()
+
+	if len(retiringArn) > 0 && retiringArn != confirmedArn {
+		ss.unsubscribe(retiringArn)
+	}
+}
+
+// watchSelfUrl periodically refreshes the self URL until stop is closed
+func (ss *SNSServer) watchSelfUrl(interval time.Duration, stop <-chan struct{}) {
+	ticker := ss.clock().NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			ss.refreshSelfUrl()
+		}
+	}
+}
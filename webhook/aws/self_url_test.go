@@ -0,0 +1,240 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock/clocktest"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfUrlConfigDefaults(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		c      SelfUrlConfig
+	)
+
+	assert.Equal(SelfUrlStatic, c.source())
+	assert.Equal(DefaultSelfUrlEnvVar, c.envVar())
+	assert.Equal(DefaultSelfUrlEC2Metadata, c.ec2Metadata())
+}
+
+func TestNewSelfHostFunc(t *testing.T) {
+	assert := assert.New(t)
+
+	f, err := NewSelfHostFunc(SelfUrlConfig{}, nil)
+	assert.Nil(f)
+	assert.NoError(err)
+
+	f, err = NewSelfHostFunc(SelfUrlConfig{Source: SelfUrlEnv}, nil)
+	assert.NotNil(f)
+	assert.NoError(err)
+
+	f, err = NewSelfHostFunc(SelfUrlConfig{Source: SelfUrlInterface}, nil)
+	assert.Nil(f)
+	assert.Error(err)
+
+	f, err = NewSelfHostFunc(SelfUrlConfig{Source: SelfUrlInterface, Interface: "eth0"}, nil)
+	assert.NotNil(f)
+	assert.NoError(err)
+
+	f, err = NewSelfHostFunc(SelfUrlConfig{Source: SelfUrlEC2}, nil)
+	assert.Nil(f)
+	assert.Error(err)
+
+	f, err = NewSelfHostFunc(SelfUrlConfig{Source: "dns"}, nil)
+	assert.Nil(f)
+	assert.Equal(ErrorInvalidSelfUrlSource, err)
+}
+
+func TestEnvSelfHost(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		name   = "TEST_SNS_SELF_HOST"
+		f      = EnvSelfHost(name)
+	)
+
+	defer os.Unsetenv(name)
+
+	os.Unsetenv(name)
+	host, err := f()
+	assert.Empty(host)
+	assert.Equal(ErrorNoSelfHost, err)
+
+	os.Setenv(name, " 10.1.2.3 ")
+	host, err = f()
+	assert.Equal("10.1.2.3", host)
+	assert.NoError(err)
+}
+
+func TestInterfaceSelfHost(t *testing.T) {
+	host, err := InterfaceSelfHost("nosuchinterface0")()
+	assert.Empty(t, host)
+	assert.Error(t, err)
+}
+
+func TestWithSelfHost(t *testing.T) {
+	testData := []struct {
+		selfUrl  string
+		host     string
+		expected string
+	}{
+		{"http://localhost:8080/api/v2/aws/sns", "10.1.2.3", "http://10.1.2.3:8080/api/v2/aws/sns"},
+		{"https://localhost/api/v2/aws/sns", "webhook.example.com", "https://webhook.example.com/api/v2/aws/sns"},
+		{"http://localhost:8080/api/v2/aws/sns", "10.1.2.3:9090", "http://10.1.2.3:9090/api/v2/aws/sns"},
+		{"http://localhost:8080/api", "fe80::1", "http://[fe80::1]:8080/api"},
+	}
+
+	for _, record := range testData {
+		t.Run(record.expected, func(t *testing.T) {
+			selfUrl, err := url.Parse(record.selfUrl)
+			require.NoError(t, err)
+
+			derived := withSelfHost(selfUrl, record.host)
+			assert.Equal(t, record.expected, derived.String())
+			assert.Equal(t, record.selfUrl, selfUrl.String(), "The original url should not be modified")
+		})
+	}
+}
+
+func TestInitializeDerivesSelfUrl(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		awsCfg  = SetUpTestViperInstance(TEST_AWS_CONFIG)
+		cfg, _  = NewAWSConfig(awsCfg)
+		ss      = &SNSServer{Config: *cfg, SVC: &MockSVC{}, SNSValidator: &MockValidator{}}
+		selfUrl = &url.URL{Scheme: "http", Host: "localhost:8080"}
+	)
+
+	ss.SelfHost = func() (string, error) { return "10.1.2.3", nil }
+	ss.Initialize(nil, selfUrl, nil, nil)
+	assert.Equal("http://10.1.2.3:8080/api/v2/aws/sns", ss.SelfUrl.String())
+
+	// a failure leaves the configured self url in place
+	ss = &SNSServer{Config: *cfg, SVC: &MockSVC{}, SNSValidator: &MockValidator{}}
+	ss.SelfHost = func() (string, error) { return "", errors.New("expected") }
+	ss.Initialize(nil, &url.URL{Scheme: "http", Host: "localhost:8080"}, nil, nil)
+	assert.Equal("http://localhost:8080/api/v2/aws/sns", ss.SelfUrl.String())
+}
+
+func TestRefreshSelfUrl(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		ss, m, _, _ = SetUpTestSNSServer()
+		host        = "10.1.2.3"
+		oldArn      = "arn:aws:sns:us-east-1:1234:test-topic:old"
+		newArn      = "pending confirmation"
+		confirmed   = "arn:aws:sns:us-east-1:1234:test-topic:new"
+	)
+
+	ss.SelfUrl = &url.URL{Scheme: "http", Host: "10.1.2.3:8080", Path: ss.Config.Sns.UrlPath}
+	ss.SelfHost = func() (string, error) { return host, nil }
+	ss.subscriptionArn.Store(oldArn)
+
+	assert.False(ss.refreshSelfUrl())
+
+	m.On("Subscribe", &sns.SubscribeInput{
+		Protocol: &ss.SelfUrl.Scheme,
+		TopicArn: &ss.Config.Sns.TopicArn,
+		Endpoint: stringPointer("http://10.4.5.6:8080/api/v2/aws/sns"),
+	}).Return(&sns.SubscribeOutput{SubscriptionArn: &newArn}, nil).Once()
+
+	// the old subscription is kept until the new one is confirmed
+	host = "10.4.5.6"
+	assert.True(ss.refreshSelfUrl())
+	assert.Equal("http://10.4.5.6:8080/api/v2/aws/sns", ss.selfUrl().String())
+	m.AssertNotCalled(t, "Unsubscribe", mock.Anything)
+
+	m.On("Unsubscribe", &sns.UnsubscribeInput{SubscriptionArn: &oldArn}).Return(&sns.UnsubscribeOutput{}, nil).Once()
+	ss.retireSubscription(confirmed)
+	m.AssertExpectations(t)
+
+	// once retired, a later confirmation unsubscribes nothing
+	ss.retireSubscription(confirmed)
+	m.AssertNumberOfCalls(t, "Unsubscribe", 1)
+
+	// failures to derive the host keep the current url
+	ss.SelfHost = func() (string, error) { return "", errors.New("expected") }
+	assert.False(ss.refreshSelfUrl())
+	assert.Equal("http://10.4.5.6:8080/api/v2/aws/sns", ss.selfUrl().String())
+}
+
+func TestAdditionalUrlPaths(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		awsCfg = SetUpTestViperInstance(TEST_AWS_CONFIG)
+		cfg, _ = NewAWSConfig(awsCfg)
+		m      = &MockSVC{}
+		mv     = &MockValidator{}
+		router = mux.NewRouter()
+		subArn = "arn:aws:sns:us-east-1:1234:test-topic:sub"
+	)
+
+	cfg.Sns.AdditionalUrlPaths = []string{"/webhook/sns"}
+	ss := &SNSServer{Config: *cfg, SVC: m, SNSValidator: mv}
+	ss.Initialize(router, nil, nil, nil)
+
+	mv.On("Validate", mock.AnythingOfType("*aws.SNSMessage")).Return(true, nil)
+	m.On("ConfirmSubscription", mock.AnythingOfType("*sns.ConfirmSubscriptionInput")).Return(&sns.ConfirmSubscriptionOutput{
+		SubscriptionArn: &subArn}, nil).Twice()
+
+	for i, path := range []string{"/api/v2/aws/sns", "/webhook/sns"} {
+		// each confirmation needs its own MessageId, as replays are refused
+		body := strings.Replace(TEST_SUB_MSG, "165545c9-2a5c-472c-8df2-7ff2be2b3b1b", fmt.Sprintf("165545c9-2a5c-472c-8df2-7ff2be2b3b1%d", i), 1)
+		request := httptest.NewRequest("POST", path, strings.NewReader(body))
+		request.Header.Set("x-amz-sns-message-type", "SubscriptionConfirmation")
+		response := httptest.NewRecorder()
+
+		router.ServeHTTP(response, request)
+		assert.Equal(http.StatusOK, response.Code, path)
+
+		<-ss.subscriptionData
+	}
+
+	m.AssertExpectations(t)
+
+	request := httptest.NewRequest("POST", "/other", strings.NewReader(TEST_SUB_MSG))
+	request.Header.Set("x-amz-sns-message-type", "SubscriptionConfirmation")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(http.StatusNotFound, response.Code)
+}
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+func TestWatchSelfUrlStop(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		ss, _, _, _ = SetUpTestSNSServer()
+		stop        = make(chan struct{})
+		stopped     = make(chan struct{})
+	)
+
+	ss.Clock = clocktest.NewClock(time.Now())
+	go func() {
+		defer close(stopped)
+		ss.watchSelfUrl(time.Minute, stop)
+	}()
+
+	close(stop)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		assert.Fail("watchSelfUrl did not stop")
+	}
+}
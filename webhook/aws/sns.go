@@ -1,33 +1,180 @@
 package aws
 
 import (
+	"errors"
+	"github.com/Comcast/webpa-common/clock"
+	"github.com/Comcast/webpa-common/health"
 	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/xmetrics"
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/defaults"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/aws/aws-sdk-go/service/sns/snsiface"
 )
 
 type AWSConfig struct {
+	// AccessKey and SecretKey are static credentials for the SNS API.  If both are omitted, credentials
+	// are obtained from the default chain instead:  the environment, the shared credentials file, and then
+	// the ECS task or EC2 instance role.  Role credentials are refreshed automatically as they rotate.
 	AccessKey string    `json:"accessKey"`
 	SecretKey string    `json:"secretKey"`
 	Env       string    `json:"env"`
 	Sns       SNSConfig `json:"sns"`
 }
 
+const (
+	// OverflowBlock makes PublishMessage wait, up to the PublishTimeout, for room in a full publish queue
+	OverflowBlock = "block"
+
+	// OverflowDrop makes PublishMessage immediately drop messages when the publish queue is full
+	OverflowDrop = "drop"
+
+	DefaultPublishQueueSize                = 10
+	DefaultPublishTimeout    time.Duration = 5 * time.Second
+	DefaultRetryInitialDelay time.Duration = time.Second
+	DefaultRetryMaxDelay     time.Duration = time.Minute
+)
+
+var (
+	// ErrorPublishQueueFull is returned by TryPublishMessage when a message is dropped because the publish queue is full
+	ErrorPublishQueueFull = errors.New("The SNS publish queue is full")
+
+	// ErrorPublishTimeout is returned by TryPublishMessage when the publish queue stayed full for the PublishTimeout
+	ErrorPublishTimeout = errors.New("Timed out waiting for room in the SNS publish queue")
+
+	// ErrorUnsignedNotAllowed is returned by NewSNSServer when the memory client is configured without
+	// InsecureUnsignedMessages, since that client's messages are not signed
+	ErrorUnsignedNotAllowed = errors.New("The memory SNS client requires insecureUnsignedMessages, since its messages are not signed")
+)
+
 type SNSConfig struct {
 	Protocol string `json:"protocol"`
 	Region   string `json:"region"`
 	TopicArn string `json:"topicArn"`
 	UrlPath  string `json:"urlPath"` //uri path to register mux
+
+	// AdditionalUrlPaths are further paths on which subscription confirmations and notifications are
+	// accepted, e.g. when a load balancer rewrites paths.  Only UrlPath is advertised to SNS.
+	AdditionalUrlPaths []string `json:"additionalUrlPaths"`
+
+	// SelfUrl describes how the URL advertised to SNS is determined
+	SelfUrl SelfUrlConfig `json:"selfUrl"`
+
+	// PublishQueueSize is the number of messages which may wait to be published to the topic.  If not
+	// supplied, DefaultPublishQueueSize is used.
+	PublishQueueSize int `json:"publishQueueSize"`
+
+	// Overflow is what happens to messages published when the queue is full, either OverflowBlock
+	// or OverflowDrop.  If not supplied, OverflowBlock is used.
+	Overflow string `json:"overflow"`
+
+	// PublishTimeout is how long PublishMessage blocks on a full queue when Overflow is OverflowBlock.
+	// If not supplied, DefaultPublishTimeout is used.
+	PublishTimeout time.Duration `json:"publishTimeout"`
+
+	// RetryInitialDelay is the delay before the first retry of a failed subscription to the topic.  Each
+	// subsequent retry waits twice as long, up to RetryMaxDelay.  If not supplied, DefaultRetryInitialDelay is used.
+	RetryInitialDelay time.Duration `json:"retryInitialDelay"`
+
+	// RetryMaxDelay is the longest delay between retries of a failed subscription.  If not supplied,
+	// DefaultRetryMaxDelay is used.
+	RetryMaxDelay time.Duration `json:"retryMaxDelay"`
+
+	// MaxBodySize is the largest POST body, in bytes, accepted from SNS.  Larger bodies are refused with
+	// http.StatusRequestEntityTooLarge.  If not supplied, DefaultMaxBodySize is used.
+	MaxBodySize int64 `json:"maxBodySize"`
+
+	// ReplayWindow is how long the MessageId of each accepted message is remembered.  A message whose
+	// MessageId was accepted within this window is refused as a replay.  If not supplied, DefaultReplayWindow is used.
+	ReplayWindow time.Duration `json:"replayWindow"`
+
+	// MaxMessageAge, if supplied, is the greatest difference allowed between a message's Timestamp and the
+	// current time.  It should not exceed the ReplayWindow, so that a message cannot be replayed once its
+	// MessageId is forgotten.  If not supplied, message timestamps are not checked.
+	MaxMessageAge time.Duration `json:"maxMessageAge"`
+
+	// Client selects the implementation of the SNS API, one of SNSClientAWS, SNSClientLocalstack, or
+	// SNSClientMemory.  The alternatives allow the full webhook flow to be exercised without AWS.  If not
+	// supplied, SNSClientAWS is used.
+	Client string `json:"client"`
+
+	// InsecureUnsignedMessages must be set to use SNSClientMemory.  Since the memory client's messages are not
+	// signed, the server then accepts any message posted to it, which must never be allowed in production.
+	InsecureUnsignedMessages bool `json:"insecureUnsignedMessages"`
+
+	// Endpoint, if supplied, overrides the URL of the SNS API.  The localstack client defaults this to
+	// DefaultLocalstackEndpoint, while the memory client ignores it.
+	Endpoint string `json:"endpoint"`
+
+	// Topic describes how the topic is created and which attributes it must have.  If not supplied,
+	// the topic must already exist and its attributes are not checked.
+	Topic TopicConfig `json:"topic"`
+}
+
+func (c *SNSConfig) client() string {
+	if len(c.Client) > 0 {
+		return c.Client
+	}
+
+	return SNSClientAWS
+}
+
+func (c *SNSConfig) endpoint() string {
+	if len(c.Endpoint) == 0 && c.client() == SNSClientLocalstack {
+		return DefaultLocalstackEndpoint
+	}
+
+	return c.Endpoint
+}
+
+func (c *SNSConfig) publishQueueSize() int {
+	if c.PublishQueueSize > 0 {
+		return c.PublishQueueSize
+	}
+
+	return DefaultPublishQueueSize
+}
+
+func (c *SNSConfig) publishTimeout() time.Duration {
+	if c.PublishTimeout > 0 {
+		return c.PublishTimeout
+	}
+
+	return DefaultPublishTimeout
+}
+
+func (c *SNSConfig) retryInitialDelay() time.Duration {
+	if c.RetryInitialDelay > 0 {
+		return c.RetryInitialDelay
+	}
+
+	return DefaultRetryInitialDelay
+}
+
+func (c *SNSConfig) retryMaxDelay() time.Duration {
+	if c.RetryMaxDelay > 0 {
+		return c.RetryMaxDelay
+	}
+
+	return DefaultRetryMaxDelay
+}
+
+func (c *SNSConfig) replayWindow() time.Duration {
+	if c.ReplayWindow > 0 {
+		return c.ReplayWindow
+	}
+
+	return DefaultReplayWindow
 }
 
 type SNSServer struct {
@@ -39,6 +186,54 @@ type SNSServer struct {
 	SNSValidator
 	logging.Logger
 	notificationData chan string
+
+	// MetricsProvider is the source of the metrics declared by Metrics.  If not supplied, metrics are discarded.
+	MetricsProvider xmetrics.Provider
+
+	// Client, if set, is used in place of SVC.  It allows implementations of only the subset of the SNS API
+	// used by this server, such as a MemorySNS.
+	Client SNSClient
+
+	// Clock is the source of time for retries, publish timeouts, self url refreshes, and message age checks.
+	// If not supplied, clock.System() is used.
+	Clock clock.Interface
+
+	measures measures
+
+	// Health, if set, receives this server's health events:  the sizes of the payloads sent and received,
+	// and a status event whenever the subscription becomes ready or not ready.
+	Health health.Publisher
+
+	// SelfHost, if set, derives the host of the SelfUrl at runtime.  NewSNSServer sets this from
+	// the SNS SelfUrl configuration.
+	SelfHost SelfHostFunc
+
+	selfUrlLock sync.RWMutex
+
+	// retiringArn is the confirmed subscription for a previous self url, which is unsubscribed once the
+	// subscription for the current self url is confirmed.  This field is guarded by the selfUrlLock.
+	retiringArn string
+
+	// stopSelfUrl stops the refreshing of the self url.  This field is guarded by the selfUrlLock.
+	stopSelfUrl chan struct{}
+
+	// subscribeLock orders the status of a new subscription before the confirmation of that subscription
+	subscribeLock sync.Mutex
+
+	// credentials are those used by SVC, if known, so that they can be refreshed when rejected
+	credentials *credentials.Credentials
+
+	readyInit sync.Once
+	readyOnce sync.Once
+	ready     chan struct{}
+
+	// stopped is closed by Unsubscribe, which ends any retries of Subscribe
+	stoppedInit sync.Once
+	stoppedOnce sync.Once
+	stopped     chan struct{}
+
+	// messageIds holds the MessageIds accepted within the ReplayWindow
+	messageIds messageIdCache
 }
 
 // Notifier interface implements the various notification server functionalities
@@ -47,13 +242,31 @@ type Notifier interface {
 	Initialize(*mux.Router, *url.URL, http.Handler, logging.Logger)
 	PrepareAndStart()
 	Subscribe()
+	Ready() <-chan struct{}
 	PublishMessage(string)
 	Unsubscribe()
 	NotificationHandle(http.ResponseWriter, *http.Request) []byte
 	ValidateSubscriptionArn(string) bool
 }
 
-// NewSNSServer creates SNSServer instance using viper config
+// CheckedPublisher is implemented by Notifiers which report whether a message was accepted for publishing.
+// Clients should type-assert a Notifier to this interface before falling back to PublishMessage.
+type CheckedPublisher interface {
+	// TryPublishMessage queues the given message for publishing, returning an error if the message was dropped
+	TryPublishMessage(string) error
+}
+
+// client returns the SNS API used by this server:  the Client if set, otherwise the SVC
+func (ss *SNSServer) client() SNSClient {
+	if ss.Client != nil {
+		return ss.Client
+	}
+
+	return ss.SVC
+}
+
+// NewSNSServer creates SNSServer instance using viper config.  The configured SNS client determines whether
+// the server talks to AWS, to localstack, or to an in-memory SNS.
 func NewSNSServer(v *viper.Viper) (ss *SNSServer, err error) {
 
 	var cfg *AWSConfig
@@ -61,12 +274,42 @@ func NewSNSServer(v *viper.Viper) (ss *SNSServer, err error) {
 		return nil, err
 	}
 
-	cred := credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, "")
+	if cfg.Sns.client() == SNSClientMemory {
+		// there is no AWS session, and the messages delivered in memory are not signed
+		if !cfg.Sns.InsecureUnsignedMessages {
+			return nil, ErrorUnsignedNotAllowed
+		}
+
+		ss = &SNSServer{
+			Config:       *cfg,
+			Client:       NewMemorySNS(nil),
+			SNSValidator: unsignedValidator{},
+		}
 
-	sess, aws_err := session.NewSession(&aws.Config{
-		Region:      aws.String(cfg.Sns.Region),
-		Credentials: cred,
-	})
+		if ss.SelfHost, err = NewSelfHostFunc(cfg.Sns.SelfUrl, nil); err != nil {
+			return nil, err
+		}
+
+		return ss, nil
+	}
+
+	awsCfg := defaults.Config().WithRegion(cfg.Sns.Region)
+	if endpoint := cfg.Sns.endpoint(); len(endpoint) > 0 {
+		awsCfg = awsCfg.WithEndpoint(endpoint)
+	}
+
+	var cred *credentials.Credentials
+	switch {
+	case cfg.AccessKey != "" || cfg.SecretKey != "":
+		cred = credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, "")
+	case cfg.Sns.client() == SNSClientLocalstack:
+		// localstack accepts any credentials, so none need be configured
+		cred = credentials.NewStaticCredentials(localstackCredential, localstackCredential, "")
+	default:
+		cred = defaults.CredChain(awsCfg, defaults.Handlers())
+	}
+
+	sess, aws_err := session.NewSession(awsCfg.WithCredentials(cred))
 	if aws_err != nil {
 		return nil, aws_err
 	}
@@ -74,8 +317,13 @@ func NewSNSServer(v *viper.Viper) (ss *SNSServer, err error) {
 	svc := sns.New(sess)
 	// Initialize the server
 	ss = &SNSServer{
-		Config: *cfg,
-		SVC:    svc,
+		Config:      *cfg,
+		SVC:         svc,
+		credentials: cred,
+	}
+
+	if ss.SelfHost, err = NewSelfHostFunc(cfg.Sns.SelfUrl, sess); err != nil {
+		return nil, err
 	}
 
 	ss.SNSValidator = NewSNSValidator()
@@ -83,9 +331,19 @@ func NewSNSServer(v *viper.Viper) (ss *SNSServer, err error) {
 	return ss, nil
 }
 
-// NewNotifier creates Notifier instance using the viper config
-func NewNotifier(v *viper.Viper) (Notifier, error) {
-	return NewSNSServer(v)
+// NewNotifier creates Notifier instance using the viper config.  If a provider is supplied, the first one is
+// the source of the metrics declared by Metrics.
+func NewNotifier(v *viper.Viper, providers ...xmetrics.Provider) (Notifier, error) {
+	ss, err := NewSNSServer(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(providers) > 0 {
+		ss.MetricsProvider = providers[0]
+	}
+
+	return ss, nil
 }
 
 // Initialize initializes the SNSServer fields
@@ -113,7 +371,15 @@ func (ss *SNSServer) Initialize(rtr *mux.Router, selfUrl *url.URL, handler http.
 		}
 	}
 	ss.subscriptionData = make(chan string, 5)
-	ss.notificationData = make(chan string, 10)
+	ss.notificationData = make(chan string, ss.Config.Sns.publishQueueSize())
+
+	provider := ss.MetricsProvider
+	if provider == nil {
+		provider = xmetrics.NewDiscardProvider()
+	}
+
+	ss.measures = newMeasures(provider)
+	ss.measures.queueCapacity.Set(float64(cap(ss.notificationData)))
 
 	// set up logger
 	if logger != nil {
@@ -122,6 +388,12 @@ func (ss *SNSServer) Initialize(rtr *mux.Router, selfUrl *url.URL, handler http.
 		ss.Logger = logging.DefaultLogger()
 	}
 
+	if derived, err := ss.deriveSelfUrl(); err != nil {
+		ss.Error("SNS unable to derive self url, using %s: %v", ss.SelfUrl, err)
+	} else {
+		ss.SelfUrl = derived
+	}
+
 	ss.Debug("SNS self url endpoint: [%s], protocol [%s]", ss.SelfUrl.String(), ss.SelfUrl.Scheme)
 
 	// Set various SNS POST routes
@@ -138,6 +410,16 @@ func (ss *SNSServer) PrepareAndStart() {
 	go ss.listenSubscriptionData()
 
 	ss.Subscribe()
+
+	if interval := ss.Config.Sns.SelfUrl.RefreshInterval; ss.SelfHost != nil && interval > 0 {
+		ss.selfUrlLock.Lock()
+		if ss.stopSelfUrl == nil {
+			ss.stopSelfUrl = make(chan struct{})
+			go ss.watchSelfUrl(interval, ss.stopSelfUrl)
+		}
+
+		ss.selfUrlLock.Unlock()
+	}
 }
 
 // Go routine that continuosly listens on SubscriptionData channel for updates to SubscriptionArn
@@ -154,8 +436,11 @@ func (ss *SNSServer) listenSubscriptionData() {
 		case data := <-ss.subscriptionData:
 			ss.Debug("listenSubscriptionData ", data)
 			ss.subscriptionArn.Store(data)
-			if !strings.EqualFold("", data) && !strings.EqualFold("pending confirmation", data) {
+			if isSubscriptionArn(data) {
 				ss.Debug("SNS is ready, subscription arn is cfg %v", data)
+				ss.readyOnce.Do(func() { close(ss.readyChannel()) })
+				ss.healthPublisher().Publish(health.StatusChange(HealthSource, StatusReady))
+				ss.retireSubscription(data)
 
 				// start listenAndPublishMessage go routine
 				quit = make(chan struct{})
@@ -167,12 +452,47 @@ func (ss *SNSServer) listenSubscriptionData() {
 				if nil != quit {
 					ss.Error("SNS is not ready now as subscription arn is changed cfg %v", data)
 					close(quit)
+					quit = nil
+					ss.healthPublisher().Publish(health.StatusChange(HealthSource, StatusNotReady))
 				}
 			}
 		}
 	}
 }
 
+// isSubscriptionArn tests if a value returned by SNS is the ARN of a confirmed subscription
+func isSubscriptionArn(data string) bool {
+	return !strings.EqualFold("", data) && !strings.EqualFold(pendingConfirmation, data)
+}
+
+// readyChannel lazily creates the channel returned by Ready, so that Ready may be called before Initialize
+func (ss *SNSServer) readyChannel() chan struct{} {
+	ss.readyInit.Do(func() { ss.ready = make(chan struct{}) })
+	return ss.ready
+}
+
+// stoppedChannel lazily creates the channel which Unsubscribe closes
+func (ss *SNSServer) stoppedChannel() chan struct{} {
+	ss.stoppedInit.Do(func() { ss.stopped = make(chan struct{}) })
+	return ss.stopped
+}
+
+// Ready returns a channel which is closed once the subscription to the SNS topic is confirmed,
+// i.e. once notifications can be received and messages published.  Servers should delay reporting
+// themselves as ready until this channel is closed.
+func (ss *SNSServer) Ready() <-chan struct{} {
+	return ss.readyChannel()
+}
+
+// expireCredentials forces the credentials to be retrieved again before the next API call, if
+// the given error shows that the current credentials were rejected
+func (ss *SNSServer) expireCredentials(err error) {
+	if ss.credentials != nil && isCredentialError(err) {
+		ss.Error("SNS credentials were rejected, refreshing: %v", err)
+		ss.credentials.Expire()
+	}
+}
+
 // Validate that SubscriptionArn received in AWS request matches the cached config data
 func (ss *SNSServer) ValidateSubscriptionArn(reqSubscriptionArn string) bool {
 
@@ -185,3 +505,11 @@ func (ss *SNSServer) ValidateSubscriptionArn(reqSubscriptionArn string) bool {
 		return false
 	}
 }
+
+func (ss *SNSServer) clock() clock.Interface {
+	if ss.Clock != nil {
+		return ss.Clock
+	}
+
+	return clock.System()
+}
@@ -0,0 +1,305 @@
+package aws
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+const (
+	// SNSClientAWS selects the real SNS API.  This is the default.
+	SNSClientAWS = "aws"
+
+	// SNSClientLocalstack selects an SNS API emulated by localstack, at the configured Endpoint or DefaultLocalstackEndpoint
+	SNSClientLocalstack = "localstack"
+
+	// SNSClientMemory selects a MemorySNS, which needs neither AWS nor credentials.  Messages delivered by a
+	// MemorySNS are not signed, so this client must only be used for testing and local development, and
+	// requires InsecureUnsignedMessages to be set.
+	SNSClientMemory = "memory"
+
+	// DefaultLocalstackEndpoint is the SNS endpoint used by the localstack client when no Endpoint is configured
+	DefaultLocalstackEndpoint = "http://localhost:4566"
+
+	// localstackCredential is the access key and secret key used with localstack when none are configured
+	localstackCredential = "test"
+
+	// SubscriptionArnHeader is sent along with each notification, and identifies the subscription
+	SubscriptionArnHeader = "X-Amz-Sns-Subscription-Arn"
+
+	pendingConfirmation = "pending confirmation"
+
+	// memoryTopicArnPrefix is prepended to the names of topics created by a MemorySNS
+	memoryTopicArnPrefix = "arn:aws:sns:memory:000000000000:"
+)
+
+var (
+	ErrorUnknownSubscription = errors.New("The SNS subscription does not exist")
+	ErrorInvalidToken        = errors.New("The SNS subscription confirmation token is invalid")
+)
+
+// SNSClient is the subset of the SNS API used by an SNSServer.  The API client for the real SNS, or for
+// localstack, implements this interface, as does MemorySNS.
+type SNSClient interface {
+	Subscribe(*sns.SubscribeInput) (*sns.SubscribeOutput, error)
+	ConfirmSubscription(*sns.ConfirmSubscriptionInput) (*sns.ConfirmSubscriptionOutput, error)
+	Publish(*sns.PublishInput) (*sns.PublishOutput, error)
+	Unsubscribe(*sns.UnsubscribeInput) (*sns.UnsubscribeOutput, error)
+}
+
+// memorySubscription is an HTTP endpoint subscribed to a MemorySNS topic
+type memorySubscription struct {
+	arn       string
+	topicArn  string
+	endpoint  string
+	token     string
+	confirmed bool
+}
+
+// MemorySNS is an in-process SNSClient which delivers messages to subscribed HTTP endpoints the way SNS does,
+// i.e. subscription confirmations and notifications are POSTed asynchronously to each endpoint.  Every topic
+// exists implicitly.  Messages are not signed, so an SNSServer using a MemorySNS must not validate signatures.
+type MemorySNS struct {
+	client *http.Client
+
+	lock          sync.Mutex
+	subscriptions map[string]*memorySubscription
+	attributes    map[string]map[string]string
+
+	// deliveries tracks the messages being POSTed, so that Wait can be used to synchronize with them
+	deliveries sync.WaitGroup
+}
+
+// NewMemorySNS creates a MemorySNS which delivers messages with the given HTTP client.  If the client is nil,
+// http.DefaultClient is used.
+func NewMemorySNS(client *http.Client) *MemorySNS {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &MemorySNS{
+		client:        client,
+		subscriptions: make(map[string]*memorySubscription),
+		attributes:    make(map[string]map[string]string),
+	}
+}
+
+// nextId produces a random, version 4 UUID, used for subscriptions, tokens, and message ids.  Since subscription
+// ARNs and tokens are built from these, they cannot be guessed from the ones already issued.
+func (m *MemorySNS) nextId() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(err)
+	}
+
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+// Subscribe adds a pending subscription and sends its SubscriptionConfirmation to the endpoint
+func (m *MemorySNS) Subscribe(input *sns.SubscribeInput) (*sns.SubscribeOutput, error) {
+	topicArn, endpoint := aws.StringValue(input.TopicArn), aws.StringValue(input.Endpoint)
+	if len(topicArn) == 0 || len(endpoint) == 0 {
+		return nil, fmt.Errorf("invalid subscription of endpoint %q to topic %q", endpoint, topicArn)
+	}
+
+	m.lock.Lock()
+	s := &memorySubscription{
+		topicArn: topicArn,
+		endpoint: endpoint,
+		token:    strings.Replace(m.nextId(), "-", "", -1),
+	}
+
+	s.arn = topicArn + ":" + m.nextId()
+	m.subscriptions[s.arn] = s
+	message := m.newMessage(SubscriptionConfirmationType, topicArn)
+	m.lock.Unlock()
+
+	message.Token = s.token
+	message.Message = "You have chosen to subscribe to the topic " + topicArn
+	message.SubscribeURL = fmt.Sprintf("memory://sns/?Action=ConfirmSubscription&TopicArn=%s&Token=%s", topicArn, s.token)
+	m.deliver(s, message)
+
+	return &sns.SubscribeOutput{SubscriptionArn: aws.String(pendingConfirmation)}, nil
+}
+
+// ConfirmSubscription confirms the subscription to which a token was sent
+func (m *MemorySNS) ConfirmSubscription(input *sns.ConfirmSubscriptionInput) (*sns.ConfirmSubscriptionOutput, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, s := range m.subscriptions {
+		if s.token == aws.StringValue(input.Token) && s.topicArn == aws.StringValue(input.TopicArn) {
+			s.confirmed = true
+			return &sns.ConfirmSubscriptionOutput{SubscriptionArn: aws.String(s.arn)}, nil
+		}
+	}
+
+	return nil, ErrorInvalidToken
+}
+
+// Publish sends a Notification to each confirmed subscription of the topic
+func (m *MemorySNS) Publish(input *sns.PublishInput) (*sns.PublishOutput, error) {
+	topicArn := aws.StringValue(input.TopicArn)
+
+	m.lock.Lock()
+	var subscriptions []*memorySubscription
+	for _, s := range m.subscriptions {
+		if s.confirmed && s.topicArn == topicArn {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+
+	message := m.newMessage(NotificationType, topicArn)
+	m.lock.Unlock()
+
+	message.Subject = aws.StringValue(input.Subject)
+	message.Message = aws.StringValue(input.Message)
+	if len(input.MessageAttributes) > 0 {
+		message.MessageAttributes = make(map[string]MsgAttr, len(input.MessageAttributes))
+		for name, value := range input.MessageAttributes {
+			message.MessageAttributes[name] = MsgAttr{
+				Type:  aws.StringValue(value.DataType),
+				Value: aws.StringValue(value.StringValue),
+			}
+		}
+	}
+
+	for _, s := range subscriptions {
+		m.deliver(s, message)
+	}
+
+	return &sns.PublishOutput{MessageId: aws.String(message.MessageId)}, nil
+}
+
+// Unsubscribe removes a subscription
+func (m *MemorySNS) Unsubscribe(input *sns.UnsubscribeInput) (*sns.UnsubscribeOutput, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	arn := aws.StringValue(input.SubscriptionArn)
+	if _, ok := m.subscriptions[arn]; !ok {
+		return nil, ErrorUnknownSubscription
+	}
+
+	delete(m.subscriptions, arn)
+	return &sns.UnsubscribeOutput{}, nil
+}
+
+// CreateTopic returns the ARN of the named topic.  Since every topic exists implicitly, a topic whose attributes
+// have been set keeps its ARN, and any other topic is given an ARN in the memoryTopicArnPrefix namespace.
+func (m *MemorySNS) CreateTopic(input *sns.CreateTopicInput) (*sns.CreateTopicOutput, error) {
+	name := aws.StringValue(input.Name)
+	if len(name) == 0 {
+		return nil, errors.New("invalid topic name")
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for topicArn := range m.attributes {
+		if topicName(topicArn) == name {
+			return &sns.CreateTopicOutput{TopicArn: aws.String(topicArn)}, nil
+		}
+	}
+
+	topicArn := memoryTopicArnPrefix + name
+	m.attributes[topicArn] = make(map[string]string)
+	return &sns.CreateTopicOutput{TopicArn: aws.String(topicArn)}, nil
+}
+
+// GetTopicAttributes returns the attributes that have been set on a topic, along with its TopicArn
+func (m *MemorySNS) GetTopicAttributes(input *sns.GetTopicAttributesInput) (*sns.GetTopicAttributesOutput, error) {
+	topicArn := aws.StringValue(input.TopicArn)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	attributes := map[string]*string{"TopicArn": aws.String(topicArn)}
+	for name, value := range m.attributes[topicArn] {
+		attributes[name] = aws.String(value)
+	}
+
+	return &sns.GetTopicAttributesOutput{Attributes: attributes}, nil
+}
+
+// SetTopicAttributes stores a single attribute of a topic.  Attributes have no effect on delivery.
+func (m *MemorySNS) SetTopicAttributes(input *sns.SetTopicAttributesInput) (*sns.SetTopicAttributesOutput, error) {
+	topicArn, name := aws.StringValue(input.TopicArn), aws.StringValue(input.AttributeName)
+	if len(topicArn) == 0 || len(name) == 0 {
+		return nil, fmt.Errorf("invalid attribute %q of topic %q", name, topicArn)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	attributes := m.attributes[topicArn]
+	if attributes == nil {
+		attributes = make(map[string]string)
+		m.attributes[topicArn] = attributes
+	}
+
+	attributes[name] = aws.StringValue(input.AttributeValue)
+	return &sns.SetTopicAttributesOutput{}, nil
+}
+
+// Wait blocks until every message sent so far has been delivered, or has failed to be delivered
+func (m *MemorySNS) Wait() {
+	m.deliveries.Wait()
+}
+
+// newMessage creates an unsigned SNS message.  The lock must be held.
+func (m *MemorySNS) newMessage(messageType, topicArn string) SNSMessage {
+	return SNSMessage{
+		Type:      messageType,
+		MessageId: m.nextId(),
+		TopicArn:  topicArn,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// deliver asynchronously POSTs a message to a subscription's endpoint.  As with SNS, failed deliveries are dropped.
+func (m *MemorySNS) deliver(s *memorySubscription, message SNSMessage) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+
+	request, err := http.NewRequest("POST", s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+
+	request.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+	request.Header.Set(MessageTypeHeader, message.Type)
+	request.Header.Set(MessageIdHeader, message.MessageId)
+	request.Header.Set(TopicArnHeader, message.TopicArn)
+	if message.Type == NotificationType {
+		request.Header.Set(SubscriptionArnHeader, s.arn)
+	}
+
+	m.deliveries.Add(1)
+	go func() {
+		defer m.deliveries.Done()
+		if response, err := m.client.Do(request); err == nil {
+			response.Body.Close()
+		}
+	}()
+}
+
+// unsignedValidator accepts every message.  It is only used with a MemorySNS, whose messages are not signed.
+type unsignedValidator struct{}
+
+func (unsignedValidator) Validate(*SNSMessage) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,146 @@
+package aws
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMemoryConfig = `{"aws": {"env": "test", "sns": {
+	"client": "memory", "insecureUnsignedMessages": true, "region": "us-east-1", "protocol": "http",
+	"topicArn": "arn:aws:sns:us-east-1:1234:test-topic", "urlPath": "/api/v2/aws/sns"
+}}}`
+
+func TestMemorySNS(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		received = make(chan SNSMessage, 10)
+		server   = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			msg, _, err := DecodeSNSMessage(request, 0)
+			if assert.NoError(err) {
+				assert.Equal(msg.Type, request.Header.Get(MessageTypeHeader))
+				received <- *msg
+			}
+		}))
+
+		m = NewMemorySNS(nil)
+	)
+
+	defer server.Close()
+
+	subscribed, err := m.Subscribe(&sns.SubscribeInput{
+		Protocol: aws.String("http"),
+		TopicArn: aws.String("arn:aws:sns:us-east-1:1234:test-topic"),
+		Endpoint: aws.String(server.URL),
+	})
+
+	require.NoError(err)
+	assert.Equal(pendingConfirmation, aws.StringValue(subscribed.SubscriptionArn))
+	m.Wait()
+
+	// nothing is delivered to a subscription which is not confirmed
+	published, err := m.Publish(&sns.PublishInput{TopicArn: aws.String("arn:aws:sns:us-east-1:1234:test-topic"), Message: aws.String("lost")})
+	require.NoError(err)
+	assert.NotEmpty(aws.StringValue(published.MessageId))
+	m.Wait()
+
+	require.Len(received, 1)
+	confirmation := <-received
+	assert.Equal(SubscriptionConfirmationType, confirmation.Type)
+	assert.NotEmpty(confirmation.Token)
+	assert.NotEmpty(confirmation.SubscribeURL)
+
+	_, err = m.ConfirmSubscription(&sns.ConfirmSubscriptionInput{TopicArn: aws.String(confirmation.TopicArn), Token: aws.String("bad token")})
+	assert.Equal(ErrorInvalidToken, err)
+
+	confirmed, err := m.ConfirmSubscription(&sns.ConfirmSubscriptionInput{
+		TopicArn: aws.String(confirmation.TopicArn),
+		Token:    aws.String(confirmation.Token),
+	})
+
+	require.NoError(err)
+	subscriptionArn := aws.StringValue(confirmed.SubscriptionArn)
+	assert.True(isSubscriptionArn(subscriptionArn))
+
+	_, err = m.Publish(&sns.PublishInput{
+		TopicArn: aws.String("arn:aws:sns:us-east-1:1234:test-topic"),
+		Subject:  aws.String("subject"),
+		Message:  aws.String("message"),
+		MessageAttributes: map[string]*sns.MessageAttributeValue{
+			MSG_ATTR: {DataType: aws.String("String"), StringValue: aws.String("test")},
+		},
+	})
+
+	require.NoError(err)
+	m.Wait()
+	require.Len(received, 1)
+	notification := <-received
+	assert.Equal(NotificationType, notification.Type)
+	assert.Equal("subject", notification.Subject)
+	assert.Equal("message", notification.Message)
+	assert.Equal(MsgAttr{Type: "String", Value: "test"}, notification.MessageAttributes[MSG_ATTR])
+
+	_, err = m.Unsubscribe(&sns.UnsubscribeInput{SubscriptionArn: aws.String(subscriptionArn)})
+	assert.NoError(err)
+	_, err = m.Unsubscribe(&sns.UnsubscribeInput{SubscriptionArn: aws.String(subscriptionArn)})
+	assert.Equal(ErrorUnknownSubscription, err)
+}
+
+func TestSNSServerWithMemorySNS(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		notifications = make(chan []byte, 1)
+		router        = mux.NewRouter()
+		server        = httptest.NewServer(router)
+	)
+
+	defer server.Close()
+
+	ss, err := NewSNSServer(SetUpTestViperInstance(testMemoryConfig))
+	require.NoError(err)
+	require.IsType(new(MemorySNS), ss.Client)
+	assert.Nil(ss.SVC)
+
+	selfUrl, err := url.Parse(server.URL)
+	require.NoError(err)
+
+	ss.Initialize(
+		router,
+		selfUrl,
+		http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			if message := ss.NotificationHandle(response, request); message != nil {
+				notifications <- message
+			}
+		}),
+		&logging.LoggerWriter{Writer: ioutil.Discard},
+	)
+
+	ss.PrepareAndStart()
+	select {
+	case <-ss.Ready():
+	case <-time.After(5 * time.Second):
+		require.Fail("The subscription was not confirmed")
+	}
+
+	require.NoError(ss.TryPublishMessage("the webhooks"))
+	select {
+	case message := <-notifications:
+		assert.Equal("the webhooks", string(message))
+	case <-time.After(5 * time.Second):
+		assert.Fail("No notification was received")
+	}
+}
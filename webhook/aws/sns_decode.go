@@ -0,0 +1,243 @@
+package aws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Comcast/webpa-common/httperror"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// SNS message types, which are sent both in the message's Type field and in the MessageTypeHeader
+	SubscriptionConfirmationType = "SubscriptionConfirmation"
+	NotificationType             = "Notification"
+	UnsubscribeConfirmationType  = "UnsubscribeConfirmation"
+
+	// Headers sent by SNS along with each message, which must agree with the message itself
+	MessageTypeHeader = "X-Amz-Sns-Message-Type"
+	MessageIdHeader   = "X-Amz-Sns-Message-Id"
+	TopicArnHeader    = "X-Amz-Sns-Topic-Arn"
+
+	// DefaultMaxBodySize is the largest SNS POST body accepted when no MaxBodySize is configured.  SNS messages
+	// are at most 256KB, but escaping the message within the JSON body can considerably increase its size.
+	DefaultMaxBodySize int64 = 1024 * 1024
+
+	// DefaultReplayWindow is how long a MessageId is remembered when no ReplayWindow is configured
+	DefaultReplayWindow time.Duration = time.Hour
+)
+
+var (
+	ErrorBodyTooLarge       = errors.New("The SNS message body is too large")
+	ErrorWrongMessageType   = errors.New("The SNS message has the wrong type for this endpoint")
+	ErrorReplayedMessage    = errors.New("The SNS message has already been received")
+	ErrorStaleMessage       = errors.New("The SNS message timestamp is outside the accepted range")
+	ErrorInvalidMessageTime = errors.New("The SNS message timestamp is invalid")
+)
+
+// snsFields is the set of JSON fields permitted in an SNS message
+var snsFields = map[string]bool{
+	"Type":              true,
+	"MessageId":         true,
+	"Token":             true,
+	"TopicArn":          true,
+	"Subject":           true,
+	"Message":           true,
+	"SubscribeURL":      true,
+	"Timestamp":         true,
+	"SignatureVersion":  true,
+	"Signature":         true,
+	"SigningCertURL":    true,
+	"UnsubscribeURL":    true,
+	"MessageAttributes": true,
+}
+
+// requiredFields returns the fields which must be nonempty in an SNS message of the given type.  The fields
+// used to verify the signature are checked by the SNSValidator instead.
+func requiredFields(msg *SNSMessage) map[string]string {
+	required := map[string]string{
+		"MessageId": msg.MessageId,
+		"TopicArn":  msg.TopicArn,
+		"Timestamp": msg.Timestamp,
+	}
+
+	switch msg.Type {
+	case SubscriptionConfirmationType, UnsubscribeConfirmationType:
+		required["Token"] = msg.Token
+		required["SubscribeURL"] = msg.SubscribeURL
+	}
+
+	return required
+}
+
+// DecodeSNSMessage strictly decodes the body of an SNS POST.  Unlike DecodeJSONMessage, the body is limited to
+// maxBodySize bytes, unknown fields are rejected, the fields required for the message's type must be present,
+// and the message must agree with the SNS headers sent along with it.  The MessageTypeHeader is required, while
+// the MessageIdHeader and TopicArnHeader are checked if present.  If maxBodySize is not positive, DefaultMaxBodySize
+// is used.
+//
+// The raw body is returned along with the decoded message.
+func DecodeSNSMessage(req *http.Request, maxBodySize int64) (*SNSMessage, []byte, error) {
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+
+	if req.ContentLength > maxBodySize {
+		return nil, nil, ErrorBodyTooLarge
+	}
+
+	raw, err := ioutil.ReadAll(io.LimitReader(req.Body, maxBodySize+1))
+	if err != nil {
+		return nil, nil, err
+	} else if int64(len(raw)) > maxBodySize {
+		return nil, nil, ErrorBodyTooLarge
+	} else if len(raw) == 0 {
+		return nil, nil, ErrJsonEmpty
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, nil, err
+	}
+
+	for name := range fields {
+		if !snsFields[name] {
+			return nil, nil, fmt.Errorf("Unknown SNS message field: %s", name)
+		}
+	}
+
+	msg := new(SNSMessage)
+	if err := json.Unmarshal(raw, msg); err != nil {
+		return nil, nil, err
+	}
+
+	switch msg.Type {
+	case SubscriptionConfirmationType, NotificationType, UnsubscribeConfirmationType:
+	default:
+		return nil, nil, fmt.Errorf("Invalid SNS message type: %q", msg.Type)
+	}
+
+	for name, value := range requiredFields(msg) {
+		if len(value) == 0 {
+			return nil, nil, fmt.Errorf("Missing SNS message field: %s", name)
+		}
+	}
+
+	if messageType := req.Header.Get(MessageTypeHeader); messageType != msg.Type {
+		return nil, nil, fmt.Errorf("SNS message type %q does not match the %s header %q", msg.Type, MessageTypeHeader, messageType)
+	}
+
+	if messageId := req.Header.Get(MessageIdHeader); len(messageId) > 0 && messageId != msg.MessageId {
+		return nil, nil, fmt.Errorf("SNS message id %q does not match the %s header %q", msg.MessageId, MessageIdHeader, messageId)
+	}
+
+	if topicArn := req.Header.Get(TopicArnHeader); len(topicArn) > 0 && topicArn != msg.TopicArn {
+		return nil, nil, fmt.Errorf("SNS topic %q does not match the %s header %q", msg.TopicArn, TopicArnHeader, topicArn)
+	}
+
+	return msg, raw, nil
+}
+
+// decodeMessage decodes and checks an SNS POST of the given type, writing an error response if the
+// message is unacceptable.  A nil message is returned in that case.
+func (ss *SNSServer) decodeMessage(rw http.ResponseWriter, req *http.Request, expectedType string) (*SNSMessage, []byte) {
+	msg, raw, err := DecodeSNSMessage(req, ss.Config.Sns.MaxBodySize)
+	if err == ErrorBodyTooLarge {
+		ss.Error("SNS read req body error %v", err)
+		httperror.Format(rw, http.StatusRequestEntityTooLarge, "request body too large")
+		return nil, nil
+	} else if err != nil {
+		ss.Error("SNS read req body error %v", err)
+		httperror.Format(rw, http.StatusBadRequest, "request body error")
+		return nil, nil
+	}
+
+	if msg.Type != expectedType {
+		ss.Error("SNS message type %s received, expected %s", msg.Type, expectedType)
+		httperror.Format(rw, http.StatusBadRequest, ErrorWrongMessageType.Error())
+		return nil, nil
+	}
+
+	if err := ss.checkTimestamp(msg, ss.clock().Now()); err != nil {
+		ss.Error("SNS message %s rejected: %v", msg.MessageId, err)
+		httperror.Format(rw, http.StatusBadRequest, err.Error())
+		return nil, nil
+	}
+
+	return msg, raw
+}
+
+// checkTimestamp rejects messages older than the configured MaxMessageAge, or as far in the future
+func (ss *SNSServer) checkTimestamp(msg *SNSMessage, now time.Time) error {
+	maxAge := ss.Config.Sns.MaxMessageAge
+	if maxAge <= 0 {
+		return nil
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, msg.Timestamp)
+	if err != nil {
+		return ErrorInvalidMessageTime
+	}
+
+	if age := now.Sub(timestamp); age > maxAge || age < -maxAge {
+		return ErrorStaleMessage
+	}
+
+	return nil
+}
+
+// acceptOnce records the MessageId of a fully validated message, writing an error response if that
+// MessageId has already been accepted within the ReplayWindow.  This method returns true if the message
+// has not been seen before.  Only authentic messages should be recorded, so that forged messages cannot
+// be used to block genuine ones.
+func (ss *SNSServer) acceptOnce(rw http.ResponseWriter, msg *SNSMessage) bool {
+	if ss.messageIds.add(msg.MessageId, ss.Config.Sns.replayWindow(), ss.clock().Now()) {
+		return true
+	}
+
+	ss.Error("SNS message %s rejected: %v", msg.MessageId, ErrorReplayedMessage)
+	httperror.Format(rw, http.StatusBadRequest, ErrorReplayedMessage.Error())
+	return false
+}
+
+// messageIdCache remembers the MessageIds received within a window of time.  The zero value is ready to use.
+type messageIdCache struct {
+	lock  sync.Mutex
+	seen  map[string]bool
+	order []messageIdEntry
+}
+
+type messageIdEntry struct {
+	id       string
+	received time.Time
+}
+
+// add records a MessageId, returning false if it was already received within the window
+func (c *messageIdCache) add(id string, window time.Duration, now time.Time) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// entries are in the order received, so expired entries are always at the front
+	expired := 0
+	for ; expired < len(c.order) && now.Sub(c.order[expired].received) > window; expired++ {
+		delete(c.seen, c.order[expired].id)
+	}
+
+	c.order = c.order[expired:]
+
+	if c.seen[id] {
+		return false
+	}
+
+	if c.seen == nil {
+		c.seen = make(map[string]bool)
+	}
+
+	c.seen[id] = true
+	c.order = append(c.order, messageIdEntry{id: id, received: now})
+	return true
+}
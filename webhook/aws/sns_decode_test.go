@@ -0,0 +1,213 @@
+package aws
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSNSRequest(body, messageType string) *http.Request {
+	request := httptest.NewRequest("POST", "/api/v2/aws/sns", strings.NewReader(body))
+	request.Header.Set(MessageTypeHeader, messageType)
+	return request
+}
+
+func TestDecodeSNSMessage(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		request = newSNSRequest(NOTIF_MSG, NotificationType)
+	)
+
+	request.Header.Set(MessageIdHeader, "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324")
+	request.Header.Set(TopicArnHeader, "arn:aws:sns:us-east-1:1234:test-topic")
+
+	msg, raw, err := DecodeSNSMessage(request, 0)
+	require.NoError(err)
+	require.NotNil(msg)
+	assert.Equal([]byte(NOTIF_MSG), raw)
+	assert.Equal(NotificationType, msg.Type)
+	assert.Equal("Hello world!", msg.Message)
+	assert.Equal("test", msg.MessageAttributes[MSG_ATTR].Value)
+
+	msg, _, err = DecodeSNSMessage(newSNSRequest(TEST_SUB_MSG, SubscriptionConfirmationType), int64(len(TEST_SUB_MSG)))
+	require.NoError(err)
+	assert.Equal(SubscriptionConfirmationType, msg.Type)
+}
+
+func TestDecodeSNSMessageInvalid(t *testing.T) {
+	withField := func(body, field, value string) string {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &fields); err != nil {
+			panic(err)
+		}
+
+		if len(value) > 0 {
+			fields[field] = value
+		} else {
+			delete(fields, field)
+		}
+
+		encoded, _ := json.Marshal(fields)
+		return string(encoded)
+	}
+
+	testData := []struct {
+		description string
+		request     *http.Request
+		maxBodySize int64
+		expected    error
+	}{
+		{"empty", newSNSRequest("", NotificationType), 0, ErrJsonEmpty},
+		{"too large", newSNSRequest(NOTIF_MSG, NotificationType), int64(len(NOTIF_MSG) - 1), ErrorBodyTooLarge},
+		{"not json", newSNSRequest("this is not json", NotificationType), 0, nil},
+		{"trailing data", newSNSRequest(NOTIF_MSG+"{}", NotificationType), 0, nil},
+		{"wrong field type", newSNSRequest(TEST_SNS_ERR_MSG, NotificationType), 0, nil},
+		{"unknown field", newSNSRequest(withField(NOTIF_MSG, "Extra", "value"), NotificationType), 0, nil},
+		{"unknown type", newSNSRequest(withField(NOTIF_MSG, "Type", "Bogus"), "Bogus"), 0, nil},
+		{"missing message id", newSNSRequest(withField(NOTIF_MSG, "MessageId", ""), NotificationType), 0, nil},
+		{"missing token", newSNSRequest(withField(TEST_SUB_MSG, "Token", ""), SubscriptionConfirmationType), 0, nil},
+		{"type header mismatch", newSNSRequest(NOTIF_MSG, SubscriptionConfirmationType), 0, nil},
+		{"missing type header", newSNSRequest(NOTIF_MSG, ""), 0, nil},
+		{
+			"message id header mismatch",
+			func() *http.Request {
+				request := newSNSRequest(NOTIF_MSG, NotificationType)
+				request.Header.Set(MessageIdHeader, "another-message-id")
+				return request
+			}(),
+			0,
+			nil,
+		},
+		{
+			"topic header mismatch",
+			func() *http.Request {
+				request := newSNSRequest(NOTIF_MSG, NotificationType)
+				request.Header.Set(TopicArnHeader, "arn:aws:sns:us-east-1:1234:another-topic")
+				return request
+			}(),
+			0,
+			nil,
+		},
+	}
+
+	for _, record := range testData {
+		t.Run(record.description, func(t *testing.T) {
+			assert := assert.New(t)
+			msg, raw, err := DecodeSNSMessage(record.request, record.maxBodySize)
+			assert.Nil(msg)
+			assert.Nil(raw)
+			if record.expected != nil {
+				assert.Equal(record.expected, err)
+			} else {
+				assert.Error(err)
+			}
+		})
+	}
+}
+
+func TestMessageIdCache(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		cache  messageIdCache
+		now    = time.Now()
+	)
+
+	assert.True(cache.add("one", time.Minute, now))
+	assert.False(cache.add("one", time.Minute, now.Add(time.Second)))
+	assert.True(cache.add("two", time.Minute, now.Add(30*time.Second)))
+
+	// "one" expires, while "two" is still within the window
+	assert.True(cache.add("one", time.Minute, now.Add(61*time.Second)))
+	assert.False(cache.add("two", time.Minute, now.Add(61*time.Second)))
+	assert.Len(cache.order, 2)
+	assert.Len(cache.seen, 2)
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		ss     = new(SNSServer)
+		now    = time.Now()
+		msg    = &SNSMessage{Timestamp: "2012-05-02T00:54:06.655Z"}
+	)
+
+	// timestamps are not checked by default
+	assert.NoError(ss.checkTimestamp(msg, now))
+
+	ss.Config.Sns.MaxMessageAge = time.Minute
+	assert.Equal(ErrorStaleMessage, ss.checkTimestamp(msg, now))
+
+	msg.Timestamp = now.Add(-30 * time.Second).UTC().Format(time.RFC3339)
+	assert.NoError(ss.checkTimestamp(msg, now))
+
+	msg.Timestamp = now.Add(2 * time.Minute).UTC().Format(time.RFC3339)
+	assert.Equal(ErrorStaleMessage, ss.checkTimestamp(msg, now))
+
+	msg.Timestamp = "yesterday"
+	assert.Equal(ErrorInvalidMessageTime, ss.checkTimestamp(msg, now))
+}
+
+func TestNotificationHandleReplay(t *testing.T) {
+	var (
+		assert       = assert.New(t)
+		ss, m, mv, _ = SetUpTestSNSServer()
+	)
+
+	ss.subscriptionArn.Store("testSubscriptionArn")
+	mv.On("Validate", mock.AnythingOfType("*aws.SNSMessage")).Return(true, nil)
+
+	for repeat, expectedStatus := range []int{http.StatusOK, http.StatusBadRequest} {
+		request := newSNSRequest(NOTIF_MSG, NotificationType)
+		request.Header.Set("x-amz-sns-subscription-arn", "testSubscriptionArn")
+		response := httptest.NewRecorder()
+
+		message := ss.NotificationHandle(response, request)
+		assert.Equal(expectedStatus, response.Code, "repeat %d", repeat)
+		if expectedStatus == http.StatusOK {
+			assert.Equal([]byte("Hello world!"), message)
+		} else {
+			assert.Nil(message)
+			body, _ := ioutil.ReadAll(response.Body)
+			assert.Contains(string(body), ErrorReplayedMessage.Error())
+		}
+	}
+
+	m.AssertExpectations(t)
+	mv.AssertExpectations(t)
+}
+
+func TestNotificationHandleRejectsInvalidMessages(t *testing.T) {
+	var (
+		assert       = assert.New(t)
+		ss, m, mv, _ = SetUpTestSNSServer()
+	)
+
+	ss.subscriptionArn.Store("testSubscriptionArn")
+	ss.Config.Sns.MaxBodySize = 64
+
+	request := newSNSRequest(NOTIF_MSG, NotificationType)
+	request.Header.Set("x-amz-sns-subscription-arn", "testSubscriptionArn")
+	response := httptest.NewRecorder()
+	assert.Nil(ss.NotificationHandle(response, request))
+	assert.Equal(http.StatusRequestEntityTooLarge, response.Code)
+
+	// a confirmation sent to the notification handler is refused
+	ss.Config.Sns.MaxBodySize = 0
+	request = newSNSRequest(TEST_SUB_MSG, SubscriptionConfirmationType)
+	request.Header.Set("x-amz-sns-subscription-arn", "testSubscriptionArn")
+	response = httptest.NewRecorder()
+	assert.Nil(ss.NotificationHandle(response, request))
+	assert.Equal(http.StatusBadRequest, response.Code)
+
+	// signatures are never checked for rejected messages
+	m.AssertExpectations(t)
+	mv.AssertExpectations(t)
+}
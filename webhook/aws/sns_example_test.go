@@ -26,7 +26,6 @@ func TestSNSReadyAndPublishSuccess(t *testing.T) {
 }
 
 func TestSNSReadyToNotReadySwitchAndBack(t *testing.T) {
-	assert := assert.New(t)
 	expectedSubArn := "pending confirmation"
 
 	ss, m, mv, _ := SetUpTestSNSServer()
@@ -40,37 +39,35 @@ func TestSNSReadyToNotReadySwitchAndBack(t *testing.T) {
 		SubscriptionArn: &expectedSubArn}, nil)
 	// Subscribe again to change SNS to not ready
 	ss.Subscribe()
+	waitForSubscriptionArn(t, ss, expectedSubArn)
 
-	time.Sleep(1 * time.Second)
-
-	assert.Equal(ss.subscriptionArn.Load().(string), expectedSubArn)
-
-	// listenAndPublishMessage is terminated hence no mock need for PublishInput
+	// listenAndPublishMessage is terminated, so the message is only published once SNS is ready again
+	queued := expectPublish(m)
 	ss.PublishMessage(TEST_HOOK)
 
-	// SNS Ready and Publish again
-	testSubConf(t, m, mv, ss)
+	// SNS Ready and Publish again, with a new MessageId as replayed confirmations are refused
+	testSubConfMessage(t, m, mv, ss, strings.Replace(TEST_SUB_MSG, "165545c9-2a5c-472c-8df2-7ff2be2b3b1b", "165545c9-2a5c-472c-8df2-7ff2be2b3b1c", 1))
+	waitForPublish(t, queued)
 	testPublish(t, m, ss)
 
 	m.AssertExpectations(t)
 }
 
 func testSubscribe(t *testing.T, m *MockSVC, ss *SNSServer) {
-	assert := assert.New(t)
 	expectedSubArn := "pending confirmation"
 
 	// mocking SNS subscribe response
 	m.On("Subscribe", mock.AnythingOfType("*sns.SubscribeInput")).Return(&sns.SubscribeOutput{
 		SubscriptionArn: &expectedSubArn}, nil)
 	ss.PrepareAndStart()
-
-	// wait such that listenSubscriptionData go routine will update the SubscriptionArn value
-	time.Sleep(1 * time.Second)
-
-	assert.Equal(ss.subscriptionArn.Load().(string), expectedSubArn)
+	waitForSubscriptionArn(t, ss, expectedSubArn)
 }
 
 func testSubConf(t *testing.T, m *MockSVC, mv *MockValidator, ss *SNSServer) {
+	testSubConfMessage(t, m, mv, ss, TEST_SUB_MSG)
+}
+
+func testSubConfMessage(t *testing.T, m *MockSVC, mv *MockValidator, ss *SNSServer, body string) {
 	assert := assert.New(t)
 
 	confSubArn := "testSubscriptionArn"
@@ -81,7 +78,7 @@ func testSubConf(t *testing.T, m *MockSVC, mv *MockValidator, ss *SNSServer) {
 	mv.On("Validate", mock.AnythingOfType("*aws.SNSMessage")).Return(true, nil).Once()
 
 	// Mocking AWS SubscriptionConfirmation POST call using http client
-	req := httptest.NewRequest("POST", ss.SelfUrl.String()+ss.Config.Sns.UrlPath, strings.NewReader(TEST_SUB_MSG))
+	req := httptest.NewRequest("POST", ss.SelfUrl.String()+ss.Config.Sns.UrlPath, strings.NewReader(body))
 	req.Header.Add("x-amz-sns-message-type", "SubscriptionConfirmation")
 
 	w := httptest.NewRecorder()
@@ -89,22 +86,49 @@ func testSubConf(t *testing.T, m *MockSVC, mv *MockValidator, ss *SNSServer) {
 	resp := w.Result()
 
 	assert.Equal(http.StatusOK, resp.StatusCode)
+	waitForSubscriptionArn(t, ss, confSubArn)
+}
 
-	// wait such that listenSubscriptionData go routine will update the SubscriptionArn value
-	time.Sleep(1 * time.Second)
-
-	assert.Equal(ss.subscriptionArn.Load().(string), confSubArn)
+func testPublish(t *testing.T, m *MockSVC, ss *SNSServer) {
+	published := expectPublish(m)
+	ss.PublishMessage(TEST_HOOK)
+	waitForPublish(t, published)
+}
 
+// waitForSubscriptionArn waits until the listenSubscriptionData goroutine has stored the expected subscription arn
+func waitForSubscriptionArn(t *testing.T, ss *SNSServer, expected string) {
+	timeout := time.After(5 * time.Second)
+	for {
+		if actual, _ := ss.subscriptionArn.Load().(string); actual == expected {
+			return
+		}
+
+		select {
+		case <-timeout:
+			assert.Fail(t, "The subscription arn was not updated", "expected %s", expected)
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
 }
 
-func testPublish(t *testing.T, m *MockSVC, ss *SNSServer) {
-	// mocking SNS Publish response
-	m.On("Publish", mock.AnythingOfType("*sns.PublishInput")).Return(&sns.PublishOutput{}, nil)
+// expectPublish mocks a single SNS publish.  The returned channel receives the message once it is published.
+func expectPublish(m *MockSVC) <-chan string {
+	published := make(chan string, 1)
+	m.On("Publish", mock.AnythingOfType("*sns.PublishInput")).Return(&sns.PublishOutput{}, nil).Once().Run(func(arguments mock.Arguments) {
+		published <- *arguments.Get(0).(*sns.PublishInput).Message
+	})
 
-	ss.PublishMessage(TEST_HOOK)
+	return published
+}
 
-	// wait such that listenAndPublishMessage go routine will publish message
-	time.Sleep(1 * time.Second)
+// waitForPublish waits until the listenAndPublishMessage goroutine publishes a message expected by expectPublish
+func waitForPublish(t *testing.T, published <-chan string) {
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "The message was not published")
+	}
 }
 
 func TestSNSSubConfValidateErr(t *testing.T) {
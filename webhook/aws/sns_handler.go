@@ -1,11 +1,12 @@
 package aws
 
 import (
+	"github.com/Comcast/webpa-common/backoff"
+	"github.com/Comcast/webpa-common/health"
 	"github.com/Comcast/webpa-common/httperror"
 	"github.com/gorilla/mux"
 	"net/http"
 	"strings"
-	"time"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sns"
 )
@@ -85,6 +86,13 @@ type SNSMessage struct {
 
 // Define handlers for various AWS SNS POST calls
 func (ss *SNSServer) SetSNSRoutes(urlPath string, r *mux.Router, handler http.Handler) {
+	ss.setSNSRoutes(urlPath, r, handler)
+	for _, additionalPath := range ss.Config.Sns.AdditionalUrlPaths {
+		ss.setSNSRoutes(additionalPath, r, handler)
+	}
+}
+
+func (ss *SNSServer) setSNSRoutes(urlPath string, r *mux.Router, handler http.Handler) {
 
 	r.HandleFunc(urlPath, ss.SubscribeConfirmHandle).Methods("POST").Headers("x-amz-sns-message-type", "SubscriptionConfirmation")
 	if handler != nil {
@@ -103,55 +111,72 @@ func (ss *SNSServer) SetSNSRoutes(urlPath string, r *mux.Router, handler http.Ha
 // Subscribe to AWS SNS Topic to receive notifications
 func (ss *SNSServer) Subscribe() {
 
+	selfUrl := ss.selfUrl()
 	params := &sns.SubscribeInput{
-		Protocol: aws.String(ss.SelfUrl.Scheme),      // Required
+		Protocol: aws.String(selfUrl.Scheme),         // Required
 		TopicArn: aws.String(ss.Config.Sns.TopicArn), // Required
-		Endpoint: aws.String(ss.SelfUrl.String()),
+		Endpoint: aws.String(selfUrl.String()),
 	}
 
 	ss.Debug("subscribe params: %+v\n\n", params)
 
-	resp, err := ss.SVC.Subscribe(params)
-	if err != nil {
-		attemptNum := 1
+	// Subscribe both checks the credentials and looks up the topic, so failures are retried with
+	// backoff until the topic is usable, e.g. while credentials are provisioned or the topic is created.
+	// The topic is reconciled before each attempt, so a topic which cannot be reconciled is never subscribed to.
+	retry := backoff.Exponential{Initial: ss.Config.Sns.retryInitialDelay(), Max: ss.Config.Sns.retryMaxDelay()}
+	attemptNum := 1
+	err := ss.reconcileAndSubscribe(params)
+	for err != nil {
 		ss.Error("SNS subscribe error (attempt %d failed): %v", attemptNum, err)
-		attemptNum++
+		ss.expireCredentials(err)
 
-		// this is so tests do not timeout
-		if *params.TopicArn == "arn:aws:sns:us-east-1:1234:test-topic" ||
-		   *params.Endpoint == "http://host:port/api/v2/aws/sns" {
+		timer := ss.clock().NewTimer(retry.Next())
+		select {
+		case <-timer.C():
+		case <-ss.stoppedChannel():
+			timer.Stop()
+			ss.Error("SNS subscribe abandoned after %d attempts", attemptNum)
 			return
 		}
 
-		for {
-			time.Sleep(time.Second * 5)
-			
-			resp, err = ss.SVC.Subscribe(params)
-			if err != nil {
-				ss.Error("SNS subscribe error (attempt %d failed): %v", attemptNum, err)
-			} else {
-				break
-			}
-			
-			attemptNum++
-		}
+		attemptNum++
+		err = ss.reconcileAndSubscribe(params)
+	}
+}
+
+// reconcileAndSubscribe reconciles the topic, then makes a single attempt to subscribe to it
+func (ss *SNSServer) reconcileAndSubscribe(params *sns.SubscribeInput) error {
+	if err := ss.reconcileTopic(); err != nil {
+		return err
+	}
+
+	return ss.trySubscribe(params)
+}
+
+// trySubscribe makes a single attempt to subscribe to the topic.  The subscription's initial status, usually
+// pending confirmation, is recorded before any confirmation can be, since SNS may send the confirmation before
+// the Subscribe call even returns.
+func (ss *SNSServer) trySubscribe(params *sns.SubscribeInput) error {
+	ss.subscribeLock.Lock()
+	defer ss.subscribeLock.Unlock()
+
+	resp, err := ss.client().Subscribe(params)
+	if err != nil {
+		return err
 	}
 
 	ss.Debug("SNS subscribe resp: %v", resp)
 
 	// Add SubscriptionArn to subscription data channel
 	ss.subscriptionData <- *resp.SubscriptionArn
+	return nil
 }
 
 // POST handler to receive SNS Confirmation Message
 func (ss *SNSServer) SubscribeConfirmHandle(rw http.ResponseWriter, req *http.Request) {
 
-	msg := new(SNSMessage)
-
-	raw, err := DecodeJSONMessage(req, msg)
-	if err != nil {
-		ss.Error("SNS read req body error %v", err)
-		httperror.Format(rw, http.StatusBadRequest, "request body error")
+	msg, raw := ss.decodeMessage(rw, req, SubscriptionConfirmationType)
+	if msg == nil {
 		return
 	}
 
@@ -171,7 +196,11 @@ func (ss *SNSServer) SubscribeConfirmHandle(rw http.ResponseWriter, req *http.Re
 		return
 	}
 
-	// TODO: health.SendEvent(HTH.Set("TotalDataPayloadReceived", int(len(raw)) ))
+	if !ss.acceptOnce(rw, msg) {
+		return
+	}
+
+	ss.healthPublisher().Publish(health.Counter(TotalDataPayloadReceived, len(raw)))
 
 	ss.Debug("SNS confirmation payload raw [%v]", string(raw))
 	ss.Debug("SNS confirmation payload msg [%#v]", msg)
@@ -180,7 +209,7 @@ func (ss *SNSServer) SubscribeConfirmHandle(rw http.ResponseWriter, req *http.Re
 		Token:    aws.String(msg.Token),    // Required
 		TopicArn: aws.String(msg.TopicArn), // Required
 	}
-	resp, err := ss.SVC.ConfirmSubscription(params)
+	resp, err := ss.client().ConfirmSubscription(params)
 	if err != nil {
 		ss.Error("SNS confirm error %v", err)
 		// TODO return error response
@@ -189,8 +218,10 @@ func (ss *SNSServer) SubscribeConfirmHandle(rw http.ResponseWriter, req *http.Re
 
 	ss.Debug("SNS confirm response: %v", resp)
 
-	// Add SubscriptionArn to subscription data channel
+	// Add SubscriptionArn to subscription data channel, after the status of any subscription in progress
+	ss.subscribeLock.Lock()
 	ss.subscriptionData <- *resp.SubscriptionArn
+	ss.subscribeLock.Unlock()
 
 }
 
@@ -198,18 +229,14 @@ func (ss *SNSServer) SubscribeConfirmHandle(rw http.ResponseWriter, req *http.Re
 // the actual message which is json webhook content
 func (ss *SNSServer) NotificationHandle(rw http.ResponseWriter, req *http.Request) []byte {
 
-	subArn := req.Header.Get("X-Amz-Sns-Subscription-Arn")
+	subArn := req.Header.Get(SubscriptionArnHeader)
 	if !ss.ValidateSubscriptionArn(subArn) {
 		httperror.Format(rw, http.StatusBadRequest, "SubscriptionARN does not match")
 		return nil
 	}
 
-	msg := new(SNSMessage)
-
-	raw, err := DecodeJSONMessage(req, msg)
-	if err != nil {
-		ss.Error("SNS read req body error %v", err)
-		httperror.Format(rw, http.StatusBadRequest, "request body error")
+	msg, raw := ss.decodeMessage(rw, req, NotificationType)
+	if msg == nil {
 		return nil
 	}
 
@@ -220,7 +247,7 @@ func (ss *SNSServer) NotificationHandle(rw http.ResponseWriter, req *http.Reques
 		httperror.Format(rw, http.StatusBadRequest, SNS_VALIDATION_ERR)
 		return nil
 	}
-	// TODO: health.SendEvent(HTH.Set("TotalDataPayloadReceived", int(len(raw)) ))
+	ss.healthPublisher().Publish(health.Counter(TotalDataPayloadReceived, len(raw)))
 
 	ss.Debug("SNS notification payload raw [%v]", string(raw))
 	ss.Debug("SNS notification payload msg [%#v]", msg)
@@ -244,16 +271,52 @@ func (ss *SNSServer) NotificationHandle(rw http.ResponseWriter, req *http.Reques
 		return nil
 	}
 
+	if !ss.acceptOnce(rw, msg) {
+		return nil
+	}
+
 	return []byte(msg.Message)
 }
 
 // Publish Notification message to AWS SNS topic
+// The message is queued for publishing, as with TryPublishMessage.  A dropped message is only logged.
 func (ss *SNSServer) PublishMessage(message string) {
+	ss.TryPublishMessage(message)
+}
+
+// TryPublishMessage queues a Notification message for publishing to the AWS SNS topic.  If the queue
+// is full, the configured Overflow determines whether this method waits for room or drops the message.
+// An error is returned if the message was dropped.
+func (ss *SNSServer) TryPublishMessage(message string) error {
 
 	ss.Debug("SNS PublishMessage called %v ", message)
 
 	// push Notification message onto notif data channel
-	ss.notificationData <- message
+	select {
+	case ss.notificationData <- message:
+		ss.measures.queueDepth.Set(float64(len(ss.notificationData)))
+		return nil
+	default:
+	}
+
+	if ss.Config.Sns.Overflow == OverflowDrop {
+		ss.Error("SNS publish queue is full, dropping message")
+		ss.measures.dropped.With(ReasonLabel, OverflowReason).Add(1)
+		return ErrorPublishQueueFull
+	}
+
+	timer := ss.clock().NewTimer(ss.Config.Sns.publishTimeout())
+	defer timer.Stop()
+
+	select {
+	case ss.notificationData <- message:
+		ss.measures.queueDepth.Set(float64(len(ss.notificationData)))
+		return nil
+	case <-timer.C():
+		ss.Error("SNS publish queue stayed full, dropping message")
+		ss.measures.dropped.With(ReasonLabel, TimeoutReason).Add(1)
+		return ErrorPublishTimeout
+	}
 }
 
 // listenAndPublishMessage go routine listens for data on notificationData channel
@@ -263,6 +326,7 @@ func (ss *SNSServer) listenAndPublishMessage(quit <-chan struct{}) {
 	for {
 		select {
 		case message := <-ss.notificationData:
+			ss.measures.queueDepth.Set(float64(len(ss.notificationData)))
 
 			params := &sns.PublishInput{
 				Message: aws.String(message), // Required
@@ -275,13 +339,15 @@ func (ss *SNSServer) listenAndPublishMessage(quit <-chan struct{}) {
 				Subject:  aws.String("new webhook"),
 				TopicArn: aws.String(ss.Config.Sns.TopicArn),
 			}
-			resp, err := ss.SVC.Publish(params)
+			resp, err := ss.client().Publish(params)
 
 			if err != nil {
 				ss.Error("SNS send message error %v", err)
+				ss.expireCredentials(err)
+			} else {
+				ss.healthPublisher().Publish(health.Counter(TotalDataPayloadSent, len(message)))
 			}
 			ss.Debug("SNS send message resp: %v", resp)
-		// TODO : health.SendEvent(HTH.Set("TotalDataPayloadSent", int(len([]byte(resp.GoString()))) ))
 
 		// To terminate the go routine when SNS is not ready, so dont allow publish message
 		case <-quit:
@@ -290,14 +356,33 @@ func (ss *SNSServer) listenAndPublishMessage(quit <-chan struct{}) {
 	}
 }
 
-// Unsubscribe from receiving notifications
+// Unsubscribe from receiving notifications.  This also stops refreshing the self url, so that a later
+// change of host does not subscribe again, and ends any retries of a failed Subscribe.
 func (ss *SNSServer) Unsubscribe() {
+	ss.stoppedOnce.Do(func() { close(ss.stoppedChannel()) })
+
+	ss.selfUrlLock.Lock()
+	if ss.stopSelfUrl != nil {
+		close(ss.stopSelfUrl)
+		ss.stopSelfUrl = nil
+	}
+
+	ss.selfUrlLock.Unlock()
+
+	// a Subscribe which never succeeded has nothing to unsubscribe
+	if subscriptionArn, _ := ss.subscriptionArn.Load().(string); len(subscriptionArn) > 0 {
+		ss.unsubscribe(subscriptionArn)
+	}
+}
+
+// unsubscribe removes the given subscription
+func (ss *SNSServer) unsubscribe(subscriptionArn string) {
 
 	params := &sns.UnsubscribeInput{
-		SubscriptionArn: aws.String(ss.subscriptionArn.Load().(string)), // Required
+		SubscriptionArn: aws.String(subscriptionArn), // Required
 	}
 
-	resp, err := ss.SVC.Unsubscribe(params)
+	resp, err := ss.client().Unsubscribe(params)
 
 	if err != nil {
 		ss.Error("SNS Unsubscribe error ", err.Error())
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/Comcast/webpa-common/clock/clocktest"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
@@ -80,7 +81,6 @@ func SetUpTestSNSServer() (*SNSServer, *MockSVC, *MockValidator, *mux.Router) {
 func TestSubscribeSuccess(t *testing.T) {
 	fmt.Println("\n\nTestSubscribeSuccess")
 
-	assert := assert.New(t)
 	expectedSubArn := "pending confirmation"
 
 	ss, m, _, _ := SetUpTestSNSServer()
@@ -89,11 +89,7 @@ func TestSubscribeSuccess(t *testing.T) {
 	ss.PrepareAndStart()
 
 	m.AssertExpectations(t)
-
-	// wait such that listenSubscriptionData go routine will update the SubscriptionArn value
-	time.Sleep(1 * time.Second)
-
-	assert.Equal(ss.subscriptionArn.Load().(string), expectedSubArn)
+	waitForSubscriptionArn(t, ss, expectedSubArn)
 }
 
 func TestSubscribeError(t *testing.T) {
@@ -105,17 +101,38 @@ func TestSubscribeError(t *testing.T) {
 	m.On("Subscribe", mock.AnythingOfType("*sns.SubscribeInput")).Return(&sns.SubscribeOutput{},
 		fmt.Errorf("%s", "InvalidClientTokenId"))
 
-	ss.PrepareAndStart()
+	testAbandonSubscribe(t, ss)
 
 	m.AssertExpectations(t)
 
-	// wait such that listenSubscriptionData will update the SubscriptionArn value
-	time.Sleep(1 * time.Second)
-
+	// a failed subscription never reaches listenSubscriptionData
 	assert.Nil(ss.subscriptionArn.Load())
 
 }
 
+// testAbandonSubscribe starts the given server, whose subscription is expected to fail, and verifies
+// that Unsubscribe ends the retries
+func testAbandonSubscribe(t *testing.T, ss *SNSServer) {
+	clock := clocktest.NewClock(time.Now())
+	ss.Clock = clock
+
+	started := make(chan struct{})
+	go func() {
+		defer close(started)
+		ss.PrepareAndStart()
+	}()
+
+	// the failed subscription waits on the clock before retrying
+	clock.BlockUntil(1)
+	ss.Unsubscribe()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Unsubscribe did not end the subscribe retries")
+	}
+}
+
 func TestUnsubscribeSuccess(t *testing.T) {
 	fmt.Println("\n\nTestUnsubscribeSuccess")
 
@@ -123,10 +140,6 @@ func TestUnsubscribeSuccess(t *testing.T) {
 	testSubscribe(t, m, ss)
 
 	m.On("Unsubscribe", mock.AnythingOfType("*sns.UnsubscribeInput")).Return(&sns.UnsubscribeOutput{}, nil)
-
-	// wait such that listenSubscriptionData go routine will update the SubscriptionArn value
-	time.Sleep(1 * time.Second)
-
 	ss.Unsubscribe()
 
 	m.AssertExpectations(t)
@@ -183,11 +196,9 @@ func TestNotificationHandleSuccess(t *testing.T) {
 	testSubConf(t, m, mv, ss)
 
 	// mocking SNS Publish response
-	m.On("Publish", mock.AnythingOfType("*sns.PublishInput")).Return(&sns.PublishOutput{}, nil)
-
+	published := expectPublish(m)
 	ss.PublishMessage(pub_msg)
-
-	time.Sleep(1 * time.Second)
+	waitForPublish(t, published)
 
 	mv.On("Validate", mock.AnythingOfType("*aws.SNSMessage")).Return(true, nil)
 
@@ -2,11 +2,18 @@ package aws
 
 import (
 	"fmt"
+	"github.com/Comcast/webpa-common/clock/clocktest"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -98,7 +105,126 @@ func TestSubscribeSelfURL_Nil(t *testing.T) {
 	}
 	m.On("Subscribe", expectedInput).Return(&sns.SubscribeOutput{}, fmt.Errorf("%s", "Unreachable"))
 
-	ss.PrepareAndStart()
+	testAbandonSubscribe(t, ss)
 
 	m.AssertExpectations(t)
 }
+
+func TestNewSNSServerDefaultCredentials(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	v := SetUpTestViperInstance(`{"aws": {"env": "test", "sns": {
+		"region": "us-east-1", "protocol": "http", "topicArn": "arn:aws:sns:us-east-1:1234:test-topic", "urlPath": "/api/v2/aws/sns"
+	}}}`)
+
+	ss, err := NewSNSServer(v)
+	require.NoError(err)
+	require.NotNil(ss)
+	assert.NotNil(ss.credentials)
+	assert.Empty(ss.Config.AccessKey)
+}
+
+func TestNewSNSServerLocalstack(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	v := SetUpTestViperInstance(`{"aws": {"env": "test", "sns": {
+		"client": "localstack", "region": "us-east-1", "protocol": "http",
+		"topicArn": "arn:aws:sns:us-east-1:1234:test-topic", "urlPath": "/api/v2/aws/sns"
+	}}}`)
+
+	ss, err := NewSNSServer(v)
+	require.NoError(err)
+	require.NotNil(ss)
+	require.IsType(new(sns.SNS), ss.SVC)
+	assert.Equal(DefaultLocalstackEndpoint, ss.SVC.(*sns.SNS).Endpoint)
+
+	// localstack needs no credentials
+	value, err := ss.credentials.Get()
+	require.NoError(err)
+	assert.Equal(localstackCredential, value.AccessKeyID)
+}
+
+func TestNewSNSServerMemory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ss, err := NewSNSServer(SetUpTestViperInstance(testMemoryConfig))
+	require.NoError(err)
+	require.NotNil(ss)
+	assert.IsType(new(MemorySNS), ss.Client)
+	assert.Equal(unsignedValidator{}, ss.SNSValidator)
+	assert.Nil(ss.credentials)
+}
+
+func TestNewSNSServerMemoryNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	// unsigned messages must be explicitly allowed
+	ss, err := NewSNSServer(SetUpTestViperInstance(strings.Replace(testMemoryConfig, `"insecureUnsignedMessages": true, `, "", 1)))
+	assert.Nil(ss)
+	assert.Equal(ErrorUnsignedNotAllowed, err)
+}
+
+func TestSubscribeRetry(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		ss, m, _, _ = SetUpTestSNSServer()
+		provider    = &credentials.StaticProvider{Value: credentials.Value{AccessKeyID: "key", SecretAccessKey: "secret"}}
+		subArn      = "arn:aws:sns:us-east-1:1234:retry-topic:sub"
+	)
+
+	clock := clocktest.NewClock(time.Now())
+	ss.Clock = clock
+	ss.Config.Sns.TopicArn = "arn:aws:sns:us-east-1:1234:retry-topic"
+	ss.Config.Sns.RetryInitialDelay = time.Second
+	ss.Config.Sns.RetryMaxDelay = 2 * time.Second
+	ss.SelfUrl, _ = url.Parse("http://webhook.example.com/api/v2/aws/sns")
+	ss.credentials = credentials.NewCredentials(provider)
+	ss.credentials.Get()
+	assert.False(ss.credentials.IsExpired())
+
+	m.On("Subscribe", mock.AnythingOfType("*sns.SubscribeInput")).
+		Return(&sns.SubscribeOutput{}, awserr.New("NotFound", "topic does not exist", nil)).Once()
+	m.On("Subscribe", mock.AnythingOfType("*sns.SubscribeInput")).
+		Return(&sns.SubscribeOutput{}, awserr.New("ExpiredToken", "the security token has expired", nil)).Once()
+	m.On("Subscribe", mock.AnythingOfType("*sns.SubscribeInput")).
+		Return(&sns.SubscribeOutput{SubscriptionArn: &subArn}, nil).Once()
+
+	select {
+	case <-ss.Ready():
+		assert.Fail("The server should not be ready before subscribing")
+	default:
+	}
+
+	subscribed := make(chan struct{})
+	go func() {
+		defer close(subscribed)
+		ss.PrepareAndStart()
+	}()
+
+	// each failed attempt waits on the clock before retrying
+	for attempt := 0; attempt < 2; attempt++ {
+		clock.BlockUntil(1)
+		clock.Add(2 * time.Second)
+	}
+
+	select {
+	case <-subscribed:
+	case <-time.After(5 * time.Second):
+		assert.Fail("Subscribe did not return once the retries were exhausted")
+	}
+
+	m.AssertExpectations(t)
+	assert.True(ss.credentials.IsExpired(), "Rejected credentials should be refreshed")
+
+	select {
+	case <-ss.Ready():
+	case <-time.After(5 * time.Second):
+		assert.Fail("The server did not become ready once subscribed")
+	}
+
+	assert.Equal(subArn, ss.subscriptionArn.Load())
+}
@@ -0,0 +1,156 @@
+package aws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+const (
+	// DeliveryPolicyAttribute is the SNS topic attribute holding the JSON delivery policy for HTTP endpoints
+	DeliveryPolicyAttribute = "DeliveryPolicy"
+
+	// KmsMasterKeyIdAttribute is the SNS topic attribute holding the KMS key used for server-side encryption
+	KmsMasterKeyIdAttribute = "KmsMasterKeyId"
+)
+
+var (
+	// ErrorTopicManagementUnsupported is returned when the topic must be reconciled but the SNSClient
+	// does not implement TopicClient
+	ErrorTopicManagementUnsupported = errors.New("The SNS client cannot manage topics")
+)
+
+// TopicConfig describes the SNS topic which is reconciled at startup, before subscribing to it.  A server
+// whose topic cannot be reconciled never subscribes, and so never becomes ready.  By default, the topic
+// is assumed to have been provisioned already and is left as is.
+type TopicConfig struct {
+	// Create indicates whether the topic named by the TopicArn is created when it does not exist
+	Create bool `json:"create"`
+
+	// DeliveryPolicy, if supplied, is the JSON delivery policy required of the topic
+	DeliveryPolicy string `json:"deliveryPolicy"`
+
+	// KmsMasterKeyId, if supplied, is the KMS key the topic must use for server-side encryption
+	KmsMasterKeyId string `json:"kmsMasterKeyId"`
+}
+
+// required returns every attribute the topic must have
+func (tc *TopicConfig) required() map[string]string {
+	required := make(map[string]string, 2)
+	if len(tc.DeliveryPolicy) > 0 {
+		required[DeliveryPolicyAttribute] = tc.DeliveryPolicy
+	}
+
+	if len(tc.KmsMasterKeyId) > 0 {
+		required[KmsMasterKeyIdAttribute] = tc.KmsMasterKeyId
+	}
+
+	return required
+}
+
+// enabled tests if the topic is reconciled at all
+func (tc *TopicConfig) enabled() bool {
+	return tc.Create || len(tc.required()) > 0
+}
+
+// TopicClient is implemented by SNS clients which can manage topics.  The AWS client and MemorySNS
+// both implement this interface.
+type TopicClient interface {
+	CreateTopic(*sns.CreateTopicInput) (*sns.CreateTopicOutput, error)
+	GetTopicAttributes(*sns.GetTopicAttributesInput) (*sns.GetTopicAttributesOutput, error)
+	SetTopicAttributes(*sns.SetTopicAttributesInput) (*sns.SetTopicAttributesOutput, error)
+}
+
+// topicName returns the name of a topic, which is the last field of its ARN
+func topicName(topicArn string) string {
+	return topicArn[strings.LastIndexByte(topicArn, ':')+1:]
+}
+
+// isTopicNotFound tests if an error from SNS indicates that a topic does not exist
+func isTopicNotFound(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == sns.ErrCodeNotFoundException
+}
+
+// attributeEquals tests if a topic attribute has the required value.  Attributes holding JSON, such as
+// delivery policies, are compared by content, since SNS does not preserve their formatting.
+func attributeEquals(actual, required string) bool {
+	if actual == required {
+		return true
+	}
+
+	var actualJSON, requiredJSON interface{}
+	if json.Unmarshal([]byte(actual), &actualJSON) != nil || json.Unmarshal([]byte(required), &requiredJSON) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(actualJSON, requiredJSON)
+}
+
+// reconcileTopic creates the configured topic if it is absent and Create is set, then sets any required
+// attributes which the topic lacks
+func (ss *SNSServer) reconcileTopic() error {
+	topic := &ss.Config.Sns.Topic
+	if !topic.enabled() {
+		return nil
+	}
+
+	client, ok := ss.client().(TopicClient)
+	if !ok {
+		return ErrorTopicManagementUnsupported
+	}
+
+	topicArn := ss.Config.Sns.TopicArn
+	output, err := client.GetTopicAttributes(&sns.GetTopicAttributesInput{TopicArn: aws.String(topicArn)})
+	if err != nil {
+		if !topic.Create || !isTopicNotFound(err) {
+			return err
+		}
+
+		created, err := client.CreateTopic(&sns.CreateTopicInput{Name: aws.String(topicName(topicArn))})
+		if err != nil {
+			return err
+		}
+
+		if createdArn := aws.StringValue(created.TopicArn); createdArn != topicArn {
+			return fmt.Errorf("SNS created topic %s rather than the configured topic %s", createdArn, topicArn)
+		}
+
+		ss.Info("SNS created topic %s", topicArn)
+		output = &sns.GetTopicAttributesOutput{}
+	}
+
+	required := topic.required()
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		if attributeEquals(aws.StringValue(output.Attributes[name]), required[name]) {
+			continue
+		}
+
+		_, err := client.SetTopicAttributes(&sns.SetTopicAttributesInput{
+			TopicArn:       aws.String(topicArn),
+			AttributeName:  aws.String(name),
+			AttributeValue: aws.String(required[name]),
+		})
+
+		if err != nil {
+			return fmt.Errorf("Unable to set SNS topic attribute %s: %s", name, err)
+		}
+
+		ss.Info("SNS set topic attribute %s on %s", name, topicArn)
+	}
+
+	return nil
+}
@@ -0,0 +1,251 @@
+package aws
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock/clocktest"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testTopicConfig = `{"aws": {"env": "test", "sns": {
+	"client": "memory", "insecureUnsignedMessages": true, "region": "us-east-1", "protocol": "http",
+	"topicArn": "arn:aws:sns:us-east-1:1234:test-topic", "urlPath": "/api/v2/aws/sns",
+	"topic": {
+		"create": true,
+		"deliveryPolicy": "{\"healthyRetryPolicy\": {\"numRetries\": 5}}",
+		"kmsMasterKeyId": "alias/aws/sns"
+	}
+}}}`
+
+// snsClientOnly hides the topic management methods of an SNSClient
+type snsClientOnly struct {
+	SNSClient
+}
+
+func TestTopicConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	var empty TopicConfig
+	assert.False(empty.enabled())
+	assert.Empty(empty.required())
+
+	assert.True((&TopicConfig{Create: true}).enabled())
+
+	full := TopicConfig{DeliveryPolicy: "{}", KmsMasterKeyId: "key"}
+	assert.True(full.enabled())
+	assert.Equal(map[string]string{DeliveryPolicyAttribute: "{}", KmsMasterKeyIdAttribute: "key"}, full.required())
+}
+
+func TestTopicConfigFromViper(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	config, err := NewAWSConfig(SetUpTestViperInstance(testTopicConfig))
+	require.NoError(err)
+
+	topic := config.Sns.Topic
+	assert.True(topic.Create)
+	assert.Equal(`{"healthyRetryPolicy": {"numRetries": 5}}`, topic.DeliveryPolicy)
+	assert.Equal("alias/aws/sns", topic.KmsMasterKeyId)
+}
+
+func TestTopicName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("test-topic", topicName("arn:aws:sns:us-east-1:1234:test-topic"))
+	assert.Equal("test-topic", topicName("test-topic"))
+}
+
+func TestAttributeEquals(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(attributeEquals("key", "key"))
+	assert.False(attributeEquals("key", "other"))
+	assert.False(attributeEquals("", "key"))
+	assert.True(attributeEquals(`{"a": 1, "b": [1, 2]}`, `{"b":[1,2],"a":1}`))
+	assert.False(attributeEquals(`{"a": 1}`, `{"a": 2}`))
+}
+
+func TestReconcileTopicDisabled(t *testing.T) {
+	ss, m, _, _ := SetUpTestSNSServer()
+	assert.NoError(t, ss.reconcileTopic())
+	m.AssertExpectations(t)
+}
+
+func TestReconcileTopicUnsupported(t *testing.T) {
+	ss, m, _, _ := SetUpTestSNSServer()
+	ss.Client = snsClientOnly{m}
+	ss.Config.Sns.Topic.Create = true
+
+	assert.Equal(t, ErrorTopicManagementUnsupported, ss.reconcileTopic())
+	m.AssertExpectations(t)
+}
+
+func TestReconcileTopicCreate(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		ss, m, _, _ = SetUpTestSNSServer()
+		topicArn    = "arn:aws:sns:us-east-1:1234:new-topic"
+	)
+
+	ss.Config.Sns.TopicArn = topicArn
+	ss.Config.Sns.Topic = TopicConfig{Create: true, KmsMasterKeyId: "alias/aws/sns"}
+
+	m.On("GetTopicAttributes", &sns.GetTopicAttributesInput{TopicArn: aws.String(topicArn)}).
+		Return(&sns.GetTopicAttributesOutput{}, awserr.New(sns.ErrCodeNotFoundException, "topic does not exist", nil)).Once()
+	m.On("CreateTopic", &sns.CreateTopicInput{Name: aws.String("new-topic")}).
+		Return(&sns.CreateTopicOutput{TopicArn: aws.String(topicArn)}, nil).Once()
+	m.On("SetTopicAttributes", &sns.SetTopicAttributesInput{
+		TopicArn:       aws.String(topicArn),
+		AttributeName:  aws.String(KmsMasterKeyIdAttribute),
+		AttributeValue: aws.String("alias/aws/sns"),
+	}).Return(&sns.SetTopicAttributesOutput{}, nil).Once()
+
+	assert.NoError(ss.reconcileTopic())
+	m.AssertExpectations(t)
+}
+
+func TestReconcileTopicNotFound(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		ss, m, _, _ = SetUpTestSNSServer()
+		notFound    = awserr.New(sns.ErrCodeNotFoundException, "topic does not exist", nil)
+	)
+
+	// without Create, a missing topic is an error
+	ss.Config.Sns.Topic = TopicConfig{DeliveryPolicy: "{}"}
+	m.On("GetTopicAttributes", mock.AnythingOfType("*sns.GetTopicAttributesInput")).
+		Return(&sns.GetTopicAttributesOutput{}, notFound).Once()
+
+	assert.Equal(notFound, ss.reconcileTopic())
+	m.AssertExpectations(t)
+}
+
+func TestReconcileTopicCreatedWrongArn(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		ss, m, _, _ = SetUpTestSNSServer()
+	)
+
+	ss.Config.Sns.Topic = TopicConfig{Create: true}
+	m.On("GetTopicAttributes", mock.AnythingOfType("*sns.GetTopicAttributesInput")).
+		Return(&sns.GetTopicAttributesOutput{}, awserr.New(sns.ErrCodeNotFoundException, "topic does not exist", nil)).Once()
+	m.On("CreateTopic", mock.AnythingOfType("*sns.CreateTopicInput")).
+		Return(&sns.CreateTopicOutput{TopicArn: aws.String("arn:aws:sns:us-west-2:5678:test-topic")}, nil).Once()
+
+	assert.Error(ss.reconcileTopic())
+	m.AssertExpectations(t)
+}
+
+func TestReconcileTopicAttributes(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		ss, m, _, _ = SetUpTestSNSServer()
+		topicArn    = ss.Config.Sns.TopicArn
+	)
+
+	ss.Config.Sns.Topic = TopicConfig{
+		DeliveryPolicy: `{"healthyRetryPolicy": {"numRetries": 5}}`,
+		KmsMasterKeyId: "alias/aws/sns",
+	}
+
+	// the delivery policy matches despite its formatting, so only the key is set
+	m.On("GetTopicAttributes", mock.AnythingOfType("*sns.GetTopicAttributesInput")).
+		Return(&sns.GetTopicAttributesOutput{Attributes: map[string]*string{
+			DeliveryPolicyAttribute: aws.String(`{"healthyRetryPolicy":{"numRetries":5}}`),
+			KmsMasterKeyIdAttribute: aws.String("some-other-key"),
+		}}, nil).Once()
+	m.On("SetTopicAttributes", &sns.SetTopicAttributesInput{
+		TopicArn:       aws.String(topicArn),
+		AttributeName:  aws.String(KmsMasterKeyIdAttribute),
+		AttributeValue: aws.String("alias/aws/sns"),
+	}).Return(&sns.SetTopicAttributesOutput{}, errors.New("expected")).Once()
+
+	assert.Error(ss.reconcileTopic())
+	m.AssertExpectations(t)
+}
+
+func TestReconcileTopicWithMemorySNS(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	ss, err := NewSNSServer(SetUpTestViperInstance(testTopicConfig))
+	require.NoError(err)
+
+	selfUrl, _ := url.Parse("http://webhook.example.com/api/v2/aws/sns")
+	ss.Initialize(mux.NewRouter(), selfUrl, nil, &logging.LoggerWriter{Writer: ioutil.Discard})
+	require.NoError(ss.reconcileTopic())
+
+	output, err := ss.Client.(*MemorySNS).GetTopicAttributes(&sns.GetTopicAttributesInput{TopicArn: aws.String(ss.Config.Sns.TopicArn)})
+	require.NoError(err)
+	assert.Equal(`{"healthyRetryPolicy": {"numRetries": 5}}`, aws.StringValue(output.Attributes[DeliveryPolicyAttribute]))
+	assert.Equal("alias/aws/sns", aws.StringValue(output.Attributes[KmsMasterKeyIdAttribute]))
+
+	// once reconciled, nothing more is set
+	require.NoError(ss.reconcileTopic())
+
+	created, err := ss.Client.(*MemorySNS).CreateTopic(&sns.CreateTopicInput{Name: aws.String("test-topic")})
+	require.NoError(err)
+	assert.Equal(ss.Config.Sns.TopicArn, aws.StringValue(created.TopicArn))
+}
+
+func TestReconcileTopicBlocksSubscribe(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		ss, m, _, _ = SetUpTestSNSServer()
+		provider    = &credentials.StaticProvider{Value: credentials.Value{AccessKeyID: "key", SecretAccessKey: "secret"}}
+		subArn      = "arn:aws:sns:us-east-1:1234:secure-topic:sub"
+	)
+
+	clock := clocktest.NewClock(time.Now())
+	ss.Clock = clock
+	ss.Config.Sns.TopicArn = "arn:aws:sns:us-east-1:1234:secure-topic"
+	ss.Config.Sns.RetryInitialDelay = time.Second
+	ss.Config.Sns.RetryMaxDelay = 2 * time.Second
+	ss.Config.Sns.Topic = TopicConfig{KmsMasterKeyId: "alias/aws/sns"}
+	ss.SelfUrl, _ = url.Parse("http://webhook.example.com/api/v2/aws/sns")
+	ss.credentials = credentials.NewCredentials(provider)
+	ss.credentials.Get()
+
+	m.On("GetTopicAttributes", mock.AnythingOfType("*sns.GetTopicAttributesInput")).
+		Return(&sns.GetTopicAttributesOutput{}, awserr.New("AuthorizationError", "not authorized", nil)).Once()
+	m.On("GetTopicAttributes", mock.AnythingOfType("*sns.GetTopicAttributesInput")).
+		Return(&sns.GetTopicAttributesOutput{Attributes: map[string]*string{
+			KmsMasterKeyIdAttribute: aws.String("alias/aws/sns"),
+		}}, nil).Once()
+	m.On("Subscribe", mock.AnythingOfType("*sns.SubscribeInput")).
+		Return(&sns.SubscribeOutput{SubscriptionArn: &subArn}, nil).Once()
+
+	subscribed := make(chan struct{})
+	go func() {
+		defer close(subscribed)
+		ss.PrepareAndStart()
+	}()
+
+	// the failed reconciliation waits on the clock, without subscribing, before retrying
+	clock.BlockUntil(1)
+	m.AssertNotCalled(t, "Subscribe", mock.AnythingOfType("*sns.SubscribeInput"))
+	clock.Add(2 * time.Second)
+
+	select {
+	case <-subscribed:
+	case <-time.After(5 * time.Second):
+		assert.Fail("Subscribe did not return once the topic was reconciled")
+	}
+
+	m.AssertExpectations(t)
+}
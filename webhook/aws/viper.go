@@ -35,7 +35,8 @@ func NewAWSConfig(v *viper.Viper) (c *AWSConfig, err error) {
 		return nil, err
 	}
 
-	if "" == c.AccessKey || c.SecretKey == "" {
+	// either both keys are supplied, or neither is and the default credential chain is used
+	if ("" == c.AccessKey) != (c.SecretKey == "") {
 		return nil, fmt.Errorf("invalid AWS accesskey or secretkey")
 	}
 
@@ -43,5 +44,21 @@ func NewAWSConfig(v *viper.Viper) (c *AWSConfig, err error) {
 		return nil, fmt.Errorf("invalid sns config %#v", c.Sns)
 	}
 
+	if c.Sns.Overflow != "" && c.Sns.Overflow != OverflowBlock && c.Sns.Overflow != OverflowDrop {
+		return nil, fmt.Errorf("invalid sns overflow %q", c.Sns.Overflow)
+	}
+
+	switch c.Sns.client() {
+	case SNSClientAWS, SNSClientLocalstack, SNSClientMemory:
+	default:
+		return nil, fmt.Errorf("invalid sns client %q", c.Sns.Client)
+	}
+
+	switch c.Sns.SelfUrl.source() {
+	case SelfUrlStatic, SelfUrlEnv, SelfUrlInterface, SelfUrlEC2:
+	default:
+		return nil, fmt.Errorf("invalid sns self url source %q", c.Sns.SelfUrl.Source)
+	}
+
 	return
 }
@@ -157,3 +157,143 @@ func TestNewAWSConfig_ViperNil(t *testing.T) {
 	assert.Equal(c.Sns.UrlPath, "/api/v2/aws/sns")
 
 }
+
+func TestNewAWSConfig_Overflow(t *testing.T) {
+	testData := []struct {
+		overflow string
+		valid    bool
+	}{
+		{"", true},
+		{OverflowBlock, true},
+		{OverflowDrop, true},
+		{"discard", false},
+	}
+
+	for _, record := range testData {
+		t.Run(record.overflow, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+				cfg     = bytes.NewBufferString(`{
+					"aws": {
+						"accessKey": "accessKey",
+						"secretKey": "secretKey",
+						"sns": {
+							"region": "us-east-1",
+							"topicArn": "arn:aws:sns:us-east-1:1234:test-topic",
+							"urlPath": "/api",
+							"publishQueueSize": 50,
+							"overflow": "` + record.overflow + `"
+						}
+					}
+				}`)
+
+				v = viper.New()
+			)
+
+			v.SetConfigType("json")
+			require.Nil(v.ReadConfig(cfg))
+
+			c, err := NewAWSConfig(v)
+			if record.valid {
+				assert.NoError(err)
+				require.NotNil(c)
+				assert.Equal(record.overflow, c.Sns.Overflow)
+				assert.Equal(50, c.Sns.PublishQueueSize)
+				assert.Equal(DefaultPublishTimeout, c.Sns.publishTimeout())
+			} else {
+				assert.Error(err)
+				assert.Nil(c)
+			}
+		})
+	}
+}
+
+func TestNewAWSConfig_Client(t *testing.T) {
+	testData := []struct {
+		client           string
+		valid            bool
+		expectedEndpoint string
+	}{
+		{"", true, ""},
+		{SNSClientAWS, true, ""},
+		{SNSClientLocalstack, true, DefaultLocalstackEndpoint},
+		{SNSClientMemory, true, ""},
+		{"sqs", false, ""},
+	}
+
+	for _, record := range testData {
+		t.Run(record.client, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+				cfg     = bytes.NewBufferString(`{
+					"aws": {
+						"sns": {
+							"client": "` + record.client + `",
+							"region": "us-east-1",
+							"topicArn": "arn:aws:sns:us-east-1:1234:test-topic",
+							"urlPath": "/api"
+						}
+					}
+				}`)
+
+				v = viper.New()
+			)
+
+			v.SetConfigType("json")
+			require.Nil(v.ReadConfig(cfg))
+
+			c, err := NewAWSConfig(v)
+			if record.valid {
+				assert.NoError(err)
+				require.NotNil(c)
+				assert.Equal(record.expectedEndpoint, c.Sns.endpoint())
+			} else {
+				assert.Error(err)
+				assert.Nil(c)
+			}
+		})
+	}
+}
+
+func TestNewAWSConfig_SelfUrlSource(t *testing.T) {
+	for _, source := range []string{"", SelfUrlStatic, SelfUrlEnv, SelfUrlInterface, SelfUrlEC2, "dns"} {
+		t.Run(source, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+				cfg     = bytes.NewBufferString(`{
+					"aws": {
+						"accessKey": "accessKey",
+						"secretKey": "secretKey",
+						"sns": {
+							"region": "us-east-1",
+							"topicArn": "arn:aws:sns:us-east-1:1234:test-topic",
+							"urlPath": "/api",
+							"additionalUrlPaths": ["/alternate"],
+							"selfUrl": {"source": "` + source + `", "interface": "eth0"}
+						}
+					}
+				}`)
+
+				v = viper.New()
+			)
+
+			v.SetConfigType("json")
+			require.Nil(v.ReadConfig(cfg))
+
+			c, err := NewAWSConfig(v)
+			if source == "dns" {
+				assert.Error(err)
+				assert.Nil(c)
+			} else {
+				assert.NoError(err)
+				require.NotNil(c)
+				assert.Equal(source, c.Sns.SelfUrl.Source)
+				assert.Equal("eth0", c.Sns.SelfUrl.Interface)
+				assert.Equal([]string{"/alternate"}, c.Sns.AdditionalUrlPaths)
+			}
+		})
+	}
+}
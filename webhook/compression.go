@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GzipEncoding is the content coding used to compress deliveries
+	GzipEncoding = "gzip"
+
+	// AcceptEncodingHeader is the header with which a receiver advertises the encodings it accepts,
+	// either in its registration's AcceptEncoding or in its responses to deliveries
+	AcceptEncodingHeader = "Accept-Encoding"
+
+	// ContentEncodingHeader is the delivery header identifying a compressed body
+	ContentEncodingHeader = "Content-Encoding"
+
+	// DefaultCompressionMinSize is the smallest payload, in bytes, that is compressed when no minimum is configured.
+	// Smaller payloads gain little from compression, and may even grow.
+	DefaultCompressionMinSize = 1024
+)
+
+// CompressionOptions configures the compression of deliveries to receivers which accept gzip
+type CompressionOptions struct {
+	// MinSize is the smallest payload, in bytes, that is compressed.  If not supplied, DefaultCompressionMinSize is used.
+	MinSize int `json:"minSize"`
+
+	// Level is the gzip compression level, from gzip.BestSpeed to gzip.BestCompression.  If not supplied,
+	// or if out of range, gzip.DefaultCompression is used.
+	Level int `json:"level"`
+
+	// MetricsProvider is the source of the metrics declared by Metrics.  If not supplied, metrics are discarded.
+	MetricsProvider xmetrics.Provider `json:"-"`
+}
+
+func (o *CompressionOptions) minSize() int {
+	if o != nil && o.MinSize > 0 {
+		return o.MinSize
+	}
+
+	return DefaultCompressionMinSize
+}
+
+func (o *CompressionOptions) level() int {
+	if o != nil && o.Level >= gzip.BestSpeed && o.Level <= gzip.BestCompression {
+		return o.Level
+	}
+
+	return gzip.DefaultCompression
+}
+
+func (o *CompressionOptions) metricsProvider() xmetrics.Provider {
+	if o != nil && o.MetricsProvider != nil {
+		return o.MetricsProvider
+	}
+
+	return xmetrics.NewDiscardProvider()
+}
+
+// acceptsGzip tests if an Accept-Encoding value admits gzip.  Encodings given a quality of zero are refused.
+func acceptsGzip(value string) bool {
+	for _, element := range strings.Split(value, ",") {
+		parameters := strings.Split(element, ";")
+		coding := strings.TrimSpace(parameters[0])
+		if !strings.EqualFold(coding, GzipEncoding) && coding != "*" {
+			continue
+		}
+
+		refused := false
+		for _, parameter := range parameters[1:] {
+			parameter = strings.Replace(parameter, " ", "", -1)
+			if strings.HasPrefix(parameter, "q=0") && strings.Trim(parameter[3:], ".0") == "" {
+				refused = true
+			}
+		}
+
+		if !refused {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Compressor gzips delivery bodies for receivers which accept compression.  A receiver accepts compression
+// either by registering with an AcceptEncoding that includes gzip, or by advertising gzip in the Accept-Encoding
+// header of its responses.  What a receiver advertises in its responses takes precedence over its registration,
+// which allows a receiver to turn compression on or off without reregistering.
+//
+// A Compressor is safe for concurrent use.
+type Compressor struct {
+	minSize  int
+	level    int
+	measures compressionMeasures
+
+	lock       sync.RWMutex
+	advertised map[string]bool
+}
+
+// NewCompressor creates a Compressor from a set of options, which may be nil
+func NewCompressor(o *CompressionOptions) *Compressor {
+	return &Compressor{
+		minSize:    o.minSize(),
+		level:      o.level(),
+		measures:   newCompressionMeasures(o.metricsProvider()),
+		advertised: make(map[string]bool),
+	}
+}
+
+// Accepts tests whether deliveries to the given webhook may be compressed
+func (c *Compressor) Accepts(w *W) bool {
+	c.lock.RLock()
+	accepts, ok := c.advertised[w.ID()]
+	c.lock.RUnlock()
+
+	if ok {
+		return accepts
+	}
+
+	return acceptsGzip(w.Config.AcceptEncoding)
+}
+
+// Observe updates what is known about a webhook's receiver from its response to a delivery.  An Accept-Encoding
+// header determines whether subsequent deliveries are compressed, and a 415 (Unsupported Media Type) response turns
+// compression off for the receiver.  Responses with neither change nothing.
+func (c *Compressor) Observe(w *W, response *http.Response) {
+	var accepts bool
+	if response.StatusCode == http.StatusUnsupportedMediaType {
+		accepts = false
+	} else if values, ok := response.Header[AcceptEncodingHeader]; ok {
+		accepts = acceptsGzip(strings.Join(values, ","))
+	} else {
+		return
+	}
+
+	c.lock.Lock()
+	c.advertised[w.ID()] = accepts
+	c.lock.Unlock()
+}
+
+// Forget discards what has been learned about a webhook's receiver from its responses, e.g. once the webhook expires
+func (c *Compressor) Forget(w *W) {
+	c.lock.Lock()
+	delete(c.advertised, w.ID())
+	c.lock.Unlock()
+}
+
+// Compress produces the delivery body for a webhook.  If the webhook accepts compression and the body is at
+// least the minimum size, the gzipped body is returned along with GzipEncoding, which is the value for the
+// ContentEncodingHeader.  Otherwise, the body is returned unchanged with an empty encoding.  A body which does
+// not shrink when compressed is also delivered unchanged.
+//
+// Deliveries are signed after compression, so that the signature covers the body as transmitted.
+func (c *Compressor) Compress(w *W, body []byte) ([]byte, string, error) {
+	if len(body) < c.minSize || !c.Accepts(w) {
+		return body, "", nil
+	}
+
+	var (
+		start      = time.Now()
+		compressed bytes.Buffer
+	)
+
+	writer, err := gzip.NewWriterLevel(&compressed, c.level)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err := writer.Write(body); err != nil {
+		return nil, "", err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+
+	c.measures.duration.Observe(time.Since(start).Seconds())
+	c.measures.ratio.Observe(float64(compressed.Len()) / float64(len(body)))
+	if compressed.Len() >= len(body) {
+		return body, "", nil
+	}
+
+	c.measures.saved.Add(float64(len(body) - compressed.Len()))
+	return compressed.Bytes(), GzipEncoding, nil
+}
@@ -0,0 +1,177 @@
+package webhook
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gunzip(t *testing.T, compressed []byte) []byte {
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	defer reader.Close()
+
+	decompressed, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	return decompressed
+}
+
+func TestCompressionOptionsDefaults(t *testing.T) {
+	assert := assert.New(t)
+	for _, o := range []*CompressionOptions{nil, new(CompressionOptions), {Level: 42}} {
+		assert.Equal(DefaultCompressionMinSize, o.minSize())
+		assert.Equal(gzip.DefaultCompression, o.level())
+		assert.NotNil(o.metricsProvider())
+	}
+}
+
+func TestCompressionOptions(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+		o             = CompressionOptions{MinSize: 10, Level: gzip.BestSpeed, MetricsProvider: registry}
+	)
+
+	require.NoError(t, err)
+
+	assert.Equal(10, o.minSize())
+	assert.Equal(gzip.BestSpeed, o.level())
+	assert.Equal(registry, o.metricsProvider())
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	testData := []struct {
+		value    string
+		expected bool
+	}{
+		{"", false},
+		{"identity", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{"deflate, gzip", true},
+		{"deflate,gzip;q=0.5", true},
+		{"*", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.000", false},
+		{"gzip;q=0.001", true},
+		{"*;q=0", false},
+		{"gzip;q=0, *", true},
+	}
+
+	for _, record := range testData {
+		t.Run(record.value, func(t *testing.T) {
+			assert.Equal(t, record.expected, acceptsGzip(record.value))
+		})
+	}
+}
+
+func TestCompressorAccepts(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		compressor = NewCompressor(nil)
+
+		registered W
+		plain      W
+	)
+
+	registered.Config.URL = "http://registered.example.com"
+	registered.Config.AcceptEncoding = "gzip"
+	plain.Config.URL = "http://plain.example.com"
+
+	assert.True(compressor.Accepts(&registered))
+	assert.False(compressor.Accepts(&plain))
+
+	// responses without Accept-Encoding or a 415 change nothing
+	compressor.Observe(&registered, &http.Response{StatusCode: http.StatusOK, Header: http.Header{}})
+	assert.True(compressor.Accepts(&registered))
+
+	// the receiver's responses take precedence over its registration
+	compressor.Observe(&plain, &http.Response{StatusCode: http.StatusOK, Header: http.Header{AcceptEncodingHeader: {"gzip"}}})
+	assert.True(compressor.Accepts(&plain))
+
+	compressor.Observe(&registered, &http.Response{StatusCode: http.StatusOK, Header: http.Header{AcceptEncodingHeader: {"identity"}}})
+	assert.False(compressor.Accepts(&registered))
+
+	compressor.Observe(&plain, &http.Response{StatusCode: http.StatusUnsupportedMediaType, Header: http.Header{AcceptEncodingHeader: {"gzip"}}})
+	assert.False(compressor.Accepts(&plain))
+
+	compressor.Forget(&registered)
+	compressor.Forget(&plain)
+	assert.True(compressor.Accepts(&registered))
+	assert.False(compressor.Accepts(&plain))
+}
+
+func TestCompressorCompress(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		require       = require.New(t)
+		registry, err = xmetrics.NewRegistry(nil, Metrics)
+		compressor    = NewCompressor(&CompressionOptions{MinSize: 100, MetricsProvider: registry})
+
+		large = []byte(strings.Repeat("a highly compressible payload ", 100))
+		small = []byte("too small to compress")
+
+		w W
+	)
+
+	require.NoError(err)
+
+	w.Config.URL = "http://receiver.example.com"
+
+	scrape := func() string {
+		response := httptest.NewRecorder()
+		registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+		return response.Body.String()
+	}
+
+	// the receiver does not accept compression
+	body, encoding, err := compressor.Compress(&w, large)
+	assert.Equal(large, body)
+	assert.Empty(encoding)
+	assert.NoError(err)
+
+	w.Config.AcceptEncoding = "gzip"
+	body, encoding, err = compressor.Compress(&w, small)
+	assert.Equal(small, body)
+	assert.Empty(encoding)
+	assert.NoError(err)
+	assert.NotContains(scrape(), CompressionDurationHistogram+"_count 1")
+
+	body, encoding, err = compressor.Compress(&w, large)
+	require.NoError(err)
+	assert.Equal(GzipEncoding, encoding)
+	assert.True(len(body) < len(large))
+	assert.Equal(large, gunzip(t, body))
+
+	output := scrape()
+	assert.Contains(output, CompressionDurationHistogram+"_count 1")
+	assert.Contains(output, CompressionRatioHistogram+"_count 1")
+	assert.NotContains(output, CompressionSavedBytesCounter+" 0")
+}
+
+func TestCompressorIncompressible(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		compressor = NewCompressor(&CompressionOptions{MinSize: 1})
+
+		// a single byte always grows when gzipped
+		payload = []byte("x")
+
+		w W
+	)
+
+	w.Config.URL = "http://receiver.example.com"
+	w.Config.AcceptEncoding = "gzip"
+
+	body, encoding, err := compressor.Compress(&w, payload)
+	assert.Equal(payload, body)
+	assert.Empty(encoding)
+	assert.NoError(err)
+}
@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Comcast/webpa-common/wrp"
+)
+
+// EventType is the normalized classification of an event sent by a device
+type EventType string
+
+const (
+	// DeviceOnlineEvent is the type of device-status events announcing that a device connected
+	DeviceOnlineEvent EventType = "device-online"
+
+	// DeviceOfflineEvent is the type of device-status events announcing that a device disconnected
+	DeviceOfflineEvent EventType = "device-offline"
+
+	// RebootAckEvent is the type of device-status events acknowledging that a device is about to reboot
+	RebootAckEvent EventType = "reboot-ack"
+
+	// DeviceStatusEvent is the type of any other device-status event
+	DeviceStatusEvent EventType = "device-status"
+
+	// IoTEvent is the type of events sent on behalf of IoT peripherals attached to a device
+	IoTEvent EventType = "iot"
+)
+
+const (
+	// EventScheme is the scheme of the Destination of WRP messages which are events, e.g. "event:iot"
+	EventScheme = "event:"
+
+	deviceStatusName = "device-status"
+	iotName          = "iot"
+
+	onlineStatus        = "online"
+	offlineStatus       = "offline"
+	rebootPendingStatus = "reboot-pending"
+
+	// the payload fields which identify the kind of a device-status event that does not name its status
+	reasonForClosureField = "reason-for-closure"
+	rebootReasonField     = "reboot-reason"
+)
+
+var (
+	ErrNotAnEvent = errors.New("The WRP message is not an event")
+)
+
+// Event is an inbound device message normalized for matching against webhooks
+type Event struct {
+	// Type is the classification of this event
+	Type EventType
+
+	// Name is the event name, i.e. the message's Destination without the EventScheme, e.g.
+	// "device-status/mac:112233445566/online"
+	Name string
+
+	// DeviceID is the device which sent this event, i.e. the message's Source without any service suffix
+	DeviceID string
+
+	// PartnerID is the partner of the device which sent this event, taken from the message's metadata
+	PartnerID string
+
+	// Message is the WRP message from which this event was derived
+	Message *wrp.Message
+}
+
+// NewEvent classifies an inbound device message.  Device-status events are classified by the status that ends
+// their name, e.g. "event:device-status/mac:112233445566/offline", or failing that by the fields of their JSON
+// payload.  Other events are typed by the first segment of their name, e.g. "event:iot/zigbee" is an IoTEvent.
+// If the message's Destination is not an event, ErrNotAnEvent is returned.
+func NewEvent(message *wrp.Message) (*Event, error) {
+	if !strings.HasPrefix(message.Destination, EventScheme) {
+		return nil, ErrNotAnEvent
+	}
+
+	name := strings.TrimPrefix(message.Destination, EventScheme)
+	if len(name) == 0 {
+		return nil, ErrNotAnEvent
+	}
+
+	event := &Event{
+		Name:      name,
+		DeviceID:  strings.SplitN(message.Source, "/", 2)[0],
+		PartnerID: wrp.PartnerID(message),
+		Message:   message,
+	}
+
+	segments := strings.Split(name, "/")
+	switch segments[0] {
+	case deviceStatusName:
+		event.Type = deviceStatusType(segments[len(segments)-1], message)
+	case iotName:
+		event.Type = IoTEvent
+	default:
+		event.Type = EventType(segments[0])
+	}
+
+	return event, nil
+}
+
+// deviceStatusType classifies a device-status event by its trailing status or, if it has none, its payload schema
+func deviceStatusType(status string, message *wrp.Message) EventType {
+	switch status {
+	case onlineStatus:
+		return DeviceOnlineEvent
+	case offlineStatus:
+		return DeviceOfflineEvent
+	case rebootPendingStatus:
+		return RebootAckEvent
+	}
+
+	if len(message.ContentType) == 0 || strings.HasPrefix(message.ContentType, wrp.JSON.ContentType()) {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(message.Payload, &fields) == nil {
+			if _, ok := fields[reasonForClosureField]; ok {
+				return DeviceOfflineEvent
+			} else if _, ok := fields[rebootReasonField]; ok {
+				return RebootAckEvent
+			}
+		}
+	}
+
+	return DeviceStatusEvent
+}
+
+// Matches tests if an event should be delivered to this webhook.  An event matches when any of the webhook's
+// Events expressions matches either its Name or its Type, and any of the Matcher.DeviceId expressions matches its
+// DeviceID.  An empty list of expressions matches everything.  A webhook scoped to partners only matches events
+// from one of those partners, so events without a partner never match such a webhook.
+func (w *W) Matches(e *Event) bool {
+	if len(w.PartnerIDs) > 0 && !containsPartner(w.PartnerIDs, e.PartnerID) {
+		return false
+	}
+
+	if !matchesAny(w.Events, e.Name) && (len(e.Type) == 0 || !matchesAny(w.Events, string(e.Type))) {
+		return false
+	}
+
+	return matchesAny(w.Matcher.DeviceId, e.DeviceID)
+}
+
+// matchesAny tests if value matches any of the given regular expressions.  An empty list matches everything.
+func matchesAny(expressions []string, value string) bool {
+	if len(expressions) == 0 {
+		return true
+	}
+
+	for _, expression := range expressions {
+		if matched, err := regexp.MatchString(expression, value); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEvent(t *testing.T) {
+	testData := []struct {
+		message          wrp.Message
+		expectedType     EventType
+		expectedName     string
+		expectedDeviceID string
+	}{
+		{
+			message:          wrp.Message{Source: "mac:112233445566", Destination: "event:device-status/mac:112233445566/online"},
+			expectedType:     DeviceOnlineEvent,
+			expectedName:     "device-status/mac:112233445566/online",
+			expectedDeviceID: "mac:112233445566",
+		},
+		{
+			message:          wrp.Message{Source: "mac:112233445566", Destination: "event:device-status/mac:112233445566/offline"},
+			expectedType:     DeviceOfflineEvent,
+			expectedName:     "device-status/mac:112233445566/offline",
+			expectedDeviceID: "mac:112233445566",
+		},
+		{
+			message:          wrp.Message{Source: "mac:112233445566", Destination: "event:device-status/mac:112233445566/reboot-pending"},
+			expectedType:     RebootAckEvent,
+			expectedName:     "device-status/mac:112233445566/reboot-pending",
+			expectedDeviceID: "mac:112233445566",
+		},
+		{
+			message: wrp.Message{
+				Source:      "mac:112233445566",
+				Destination: "event:device-status/mac:112233445566",
+				ContentType: "application/json",
+				Payload:     []byte(`{"id": "mac:112233445566", "reason-for-closure": "ping miss"}`),
+			},
+			expectedType:     DeviceOfflineEvent,
+			expectedName:     "device-status/mac:112233445566",
+			expectedDeviceID: "mac:112233445566",
+		},
+		{
+			message: wrp.Message{
+				Source:      "mac:112233445566",
+				Destination: "event:device-status/mac:112233445566",
+				Payload:     []byte(`{"id": "mac:112233445566", "reboot-reason": "firmware upgrade"}`),
+			},
+			expectedType:     RebootAckEvent,
+			expectedName:     "device-status/mac:112233445566",
+			expectedDeviceID: "mac:112233445566",
+		},
+		{
+			message: wrp.Message{
+				Source:      "mac:112233445566",
+				Destination: "event:device-status/mac:112233445566",
+				ContentType: "application/octet-stream",
+				Payload:     []byte(`{"reason-for-closure": "ping miss"}`),
+			},
+			expectedType:     DeviceStatusEvent,
+			expectedName:     "device-status/mac:112233445566",
+			expectedDeviceID: "mac:112233445566",
+		},
+		{
+			message: wrp.Message{
+				Source:      "mac:112233445566",
+				Destination: "event:device-status",
+				Payload:     []byte("not json"),
+			},
+			expectedType:     DeviceStatusEvent,
+			expectedName:     "device-status",
+			expectedDeviceID: "mac:112233445566",
+		},
+		{
+			message:          wrp.Message{Source: "mac:112233445566/zigbee", Destination: "event:iot/zigbee/sensor"},
+			expectedType:     IoTEvent,
+			expectedName:     "iot/zigbee/sensor",
+			expectedDeviceID: "mac:112233445566",
+		},
+		{
+			message:          wrp.Message{Source: "serial:1234", Destination: "event:firmware-upgrade/complete"},
+			expectedType:     EventType("firmware-upgrade"),
+			expectedName:     "firmware-upgrade/complete",
+			expectedDeviceID: "serial:1234",
+		},
+	}
+
+	for i, record := range testData {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+			)
+
+			event, err := NewEvent(&record.message)
+			require.NoError(err)
+			require.NotNil(event)
+			assert.Equal(record.expectedType, event.Type)
+			assert.Equal(record.expectedName, event.Name)
+			assert.Equal(record.expectedDeviceID, event.DeviceID)
+			assert.True(&record.message == event.Message)
+		})
+	}
+}
+
+func TestNewEventNotAnEvent(t *testing.T) {
+	assert := assert.New(t)
+	for _, destination := range []string{"", "event:", "mac:112233445566/config", "dns:talaria.example.com"} {
+		event, err := NewEvent(&wrp.Message{Source: "mac:112233445566", Destination: destination})
+		assert.Nil(event)
+		assert.Equal(ErrNotAnEvent, err)
+	}
+}
+
+func TestWMatches(t *testing.T) {
+	var (
+		online = &Event{Type: DeviceOnlineEvent, Name: "device-status/mac:112233445566/online", DeviceID: "mac:112233445566"}
+		iot    = &Event{Type: IoTEvent, Name: "iot/zigbee", DeviceID: "serial:1234"}
+
+		testData = []struct {
+			events   []string
+			deviceID []string
+			event    *Event
+			expected bool
+		}{
+			{nil, nil, online, true},
+			{[]string{".*"}, []string{".*"}, online, true},
+			{[]string{"device-status/.*"}, nil, online, true},
+			{[]string{"^device-online$"}, nil, online, true},
+			{[]string{"^device-offline$"}, nil, online, false},
+			{[]string{"iot"}, nil, online, false},
+			{[]string{"iot"}, nil, iot, true},
+			{[]string{"iot"}, []string{"^mac:"}, iot, false},
+			{[]string{"iot", "device-status"}, []string{"^mac:", "^serial:"}, iot, true},
+			{[]string{"^$"}, nil, &Event{Name: "foo"}, false},
+		}
+	)
+
+	for i, record := range testData {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			w := W{Events: record.events}
+			w.Matcher.DeviceId = record.deviceID
+			assert.Equal(t, record.expected, w.Matches(record.event))
+		})
+	}
+}
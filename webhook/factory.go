@@ -1,6 +1,7 @@
 package webhook
 
 import (
+	"github.com/Comcast/webpa-common/clock"
 	"github.com/Comcast/webpa-common/httperror"
 	AWS "github.com/Comcast/webpa-common/webhook/aws"
 	"github.com/spf13/viper"
@@ -20,6 +21,10 @@ type Factory struct {
 	// Test code can set this field to something that returns a channel under the control of the test.
 	Tick func(time.Duration) <-chan time.Time `json:"-"`
 
+	// Clock is the optional source of time for the undertaker, which discards expired webhooks.  It is
+	// also the source of the undertaker's ticks when Tick is not supplied.  If not supplied, clock.System() is used.
+	Clock clock.Interface `json:"-"`
+
 	// UndertakerInterval is how often the undertaker is invoked
 	UndertakerInterval time.Duration `json:"undertakerInterval"`
 
@@ -30,11 +35,24 @@ type Factory struct {
 	// internal handler for webhook
 	m *monitor `json:"-"`
 
+	// compressor is created on demand and shared by deliveries and the registry
+	compressor *Compressor `json:"-"`
+
 	// internal handler for AWS SNS Server
 	AWS.Notifier `json:"-"`
 
 	// StartConfig is the contains the data need to obtain the current system's listeners
 	Start *StartConfig `json:"start"`
+
+	// Probe is the optional configuration for probing the health of webhook receivers
+	Probe *ProbeOptions `json:"probe"`
+
+	// Compression is the optional configuration for compressing deliveries to receivers which accept gzip
+	Compression *CompressionOptions `json:"compression"`
+
+	// Validation is the optional configuration for validating registrations.  By default, only https
+	// URLs which resolve to public addresses are accepted.
+	Validation *ValidationOptions `json:"validation"`
 }
 
 // NewFactory creates a Factory from a Viper environment.  This function always returns
@@ -74,9 +92,18 @@ func (f *Factory) SetList(ul UpdatableList) {
 	f.m.list = ul
 }
 
+func (f *Factory) clock() clock.Interface {
+	if f.Clock != nil {
+		return f.Clock
+	}
+
+	return clock.System()
+}
+
 func (f *Factory) Prune(items []W) (list []W) {
+	now := f.clock().Now()
 	for i := 0; i < len(items); i++ {
-		if items[i].Until.After(time.Now()) {
+		if items[i].Until.After(now) {
 			list = append(list, items[i])
 		}
 	}
@@ -84,19 +111,58 @@ func (f *Factory) Prune(items []W) (list []W) {
 	return
 }
 
+// NewProber returns a Prober for the given webhooks using this Factory's probe configuration.
+// Unless the probe configuration supplies its own Client, probes are sent with NewDeliveryClient.
+// The returned Prober must be started via its Run method.
+func (f *Factory) NewProber(list List) *Prober {
+	var probe ProbeOptions
+	if f.Probe != nil {
+		probe = *f.Probe
+	}
+
+	if probe.Client == nil {
+		probe.Client = f.NewDeliveryClient()
+	}
+
+	return NewProber(list, &probe)
+}
+
+// NewDeliveryClient returns an HTTP client for sending requests to webhook receivers.  Connections are
+// checked against this Factory's validation configuration as they are dialed, so a registered host whose
+// DNS is later changed to point at a private address cannot be used to reach internal services.
+func (f *Factory) NewDeliveryClient() *http.Client {
+	return &http.Client{Transport: NewValidator(f.Validation).NewTransport()}
+}
+
+// NewCompressor returns the Compressor for deliveries using this Factory's compression configuration.
+// Every call returns the same Compressor, which forgets each webhook once it is removed from the registry
+// created by NewRegistryAndHandler.
+func (f *Factory) NewCompressor() *Compressor {
+	if f.compressor == nil {
+		f.compressor = NewCompressor(f.Compression)
+	}
+
+	return f.compressor
+}
+
 // NewRegistryAndHandler returns a List instance for accessing webhooks and an HTTP handler
 // which can receive updates from external systems.
 func (f *Factory) NewRegistryAndHandler() (Registry, http.Handler) {
 	tick := f.Tick
 	if tick == nil {
-		tick = time.Tick
+		tick = func(d time.Duration) <-chan time.Time {
+			return f.clock().NewTicker(d).C()
+		}
 	}
 
 	monitor := &monitor{
-		list:             NewList(nil),
+		list:             newList(nil, f.clock()),
+		clock:            f.clock(),
 		undertaker:       f.undertaker,
 		changes:          make(chan []W, 10),
 		undertakerTicker: tick(f.UndertakerInterval),
+		validator:        NewValidator(f.Validation),
+		compressor:       f.NewCompressor(),
 	}
 	f.m = monitor
 	f.m.Notifier = f.Notifier
@@ -122,23 +188,58 @@ type monitor struct {
 	undertakerTicker <-chan time.Time
 	AWS.Notifier
 	externalUpdate func([]W)
+	validator      *Validator
+	compressor     *Compressor
+	clock          clock.Interface
+}
+
+// now returns the current time according to this monitor's clock, which defaults to the system clock
+func (m *monitor) now() time.Time {
+	if m.clock != nil {
+		return m.clock.Now()
+	}
+
+	return time.Now()
 }
 
 func (m *monitor) listen() {
 	for {
 		select {
 		case update := <-m.changes:
-			m.list.Update(update)
+			m.modify(func() { m.list.Update(update) })
 
 			if m.externalUpdate != nil {
 				m.externalUpdate(update)
 			}
 		case <-m.undertakerTicker:
-			m.list.Filter(m.undertaker)
+			m.modify(func() { m.list.Filter(m.undertaker) })
 		}
 	}
 }
 
+// modify applies a change to the list, then has the compressor forget every webhook which the change removed
+func (m *monitor) modify(change func()) {
+	if m.compressor == nil {
+		change()
+		return
+	}
+
+	before := make(map[string]W, m.list.Len())
+	for i := 0; i < m.list.Len(); i++ {
+		w := m.list.Get(i)
+		before[w.ID()] = *w
+	}
+
+	change()
+	for i := 0; i < m.list.Len(); i++ {
+		delete(before, m.list.Get(i).ID())
+	}
+
+	for _, w := range before {
+		m.compressor.Forget(&w)
+	}
+}
+
 // sendNewHooks handles delivery of []W to monitor.changes
 func (m *monitor) sendNewHooks(newHooks []W) {
 	select {
@@ -157,9 +258,10 @@ func (m *monitor) ServeHTTP(response http.ResponseWriter, request *http.Request)
 	}
 
 	// transform message to W
-	w, err := NewW(message, "")
+	now := m.now()
+	w, err := newW(message, "", now)
 	if nil != err {
-		w, err = doOldHookConvert(message)
+		w, err = doOldHookConvert(message, now)
 	}
 	if nil != err {
 		httperror.Format(response, http.StatusBadRequest, "Notification Message JSON unmarshall failed")
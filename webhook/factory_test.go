@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock/clocktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFactoryPrune(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		start  = time.Now()
+		clock  = clocktest.NewClock(start)
+		f      = &Factory{Clock: clock}
+
+		expiring = W{Until: start.Add(time.Minute)}
+		lasting  = W{Until: start.Add(time.Hour)}
+	)
+
+	expiring.Config.URL = "http://expiring.example.com"
+	lasting.Config.URL = "http://lasting.example.com"
+
+	assert.Len(f.Prune([]W{expiring, lasting}), 2)
+	clock.Add(time.Minute)
+	assert.Equal([]W{lasting}, f.Prune([]W{expiring, lasting}))
+}
+
+func TestFactoryUndertaker(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		start   = time.Now()
+		clock   = clocktest.NewClock(start)
+
+		expiring = W{Until: start.Add(time.Minute)}
+		lasting  = W{Until: start.Add(time.Hour)}
+	)
+
+	expiring.Config.URL = "http://expiring.example.com"
+	lasting.Config.URL = "http://lasting.example.com"
+
+	f, err := NewFactory(nil)
+	require.NoError(err)
+	f.Clock = clock
+	f.UndertakerInterval = 30 * time.Second
+
+	f.NewRegistryAndHandler()
+	list := f.m.list
+	list.Update([]W{expiring, lasting})
+	require.Equal(2, list.Len())
+
+	// the receiver advertised gzip, which the compressor forgets once the hook expires
+	compressor := f.NewCompressor()
+	assert.True(compressor == f.m.compressor)
+	compressor.Observe(&expiring, &http.Response{StatusCode: http.StatusOK, Header: http.Header{AcceptEncodingHeader: {"gzip"}}})
+	require.True(compressor.Accepts(&expiring))
+
+	// the undertaker's ticker is created before the monitor starts listening
+	clock.BlockUntil(1)
+	clock.Add(30 * time.Second)
+	assert.Equal(2, list.Len())
+
+	clock.Add(30 * time.Second)
+	deadline := time.Now().Add(5 * time.Second)
+	for list.Len() != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	require.Equal(1, list.Len())
+	assert.Equal(lasting.Config.URL, list.Get(0).Config.URL)
+
+	for compressor.Accepts(&expiring) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.False(compressor.Accepts(&expiring))
+}
@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Comcast/webpa-common/wrp"
+)
+
+// DeliveryFormat determines how events are encoded in the requests delivered to a webhook
+type DeliveryFormat string
+
+const (
+	// DeliverRaw delivers each event's payload as the request body, with the remaining WRP fields mapped
+	// to HTTP headers as with wrp.WRPToHeader.  This is the default format.
+	DeliverRaw DeliveryFormat = "raw"
+
+	// DeliverMsgpack delivers each event as a complete WRP message encoded as Msgpack
+	DeliverMsgpack DeliveryFormat = "msgpack"
+
+	// DeliverJSON delivers each event as a complete WRP message encoded as JSON
+	DeliverJSON DeliveryFormat = "json"
+)
+
+const (
+	// DestinationHeader is the header holding the WRP destination of events delivered in the raw format
+	DestinationHeader = "X-Webpa-Destination"
+
+	// ContentTypeHeader is the header identifying the media type of a delivery body
+	ContentTypeHeader = "Content-Type"
+)
+
+// deliveryFormat returns the effective delivery format for this webhook
+func (w *W) deliveryFormat() DeliveryFormat {
+	if len(w.Config.DeliveryFormat) > 0 {
+		return w.Config.DeliveryFormat
+	}
+
+	return DeliverRaw
+}
+
+// validateDeliveryFormat checks the delivery format configuration of this webhook
+func (w *W) validateDeliveryFormat() error {
+	switch w.deliveryFormat() {
+	case DeliverRaw, DeliverMsgpack, DeliverJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid delivery format: %s", w.Config.DeliveryFormat)
+	}
+}
+
+// Delivery is the body and headers of the request which delivers an event to a webhook
+type Delivery struct {
+	Body   []byte
+	Header http.Header
+}
+
+// Transcoder produces deliveries in the format each webhook registered for, using pooled WRP encoders
+// and decoders.  A Transcoder is safe for concurrent use.
+type Transcoder struct {
+	encoders map[wrp.Format]*wrp.EncoderPool
+	decoders map[wrp.Format]*wrp.DecoderPool
+}
+
+// NewTranscoder creates a Transcoder whose pools are created by the given factory, which may be nil
+func NewTranscoder(pf *wrp.PoolFactory) *Transcoder {
+	if pf == nil {
+		pf = new(wrp.PoolFactory)
+	}
+
+	t := &Transcoder{
+		encoders: make(map[wrp.Format]*wrp.EncoderPool, 2),
+		decoders: make(map[wrp.Format]*wrp.DecoderPool, 2),
+	}
+
+	for _, f := range []wrp.Format{wrp.Msgpack, wrp.JSON} {
+		t.encoders[f] = pf.NewEncoderPool(f)
+		t.decoders[f] = pf.NewDecoderPool(f)
+	}
+
+	return t
+}
+
+// Transcode produces the delivery of an event to a webhook.  For the raw format, the Content-Type is the
+// message's ContentType or, if the message has none, the webhook's configured ContentType.
+func (t *Transcoder) Transcode(w *W, message *wrp.Message) (*Delivery, error) {
+	switch w.deliveryFormat() {
+	case DeliverMsgpack:
+		return t.encode(wrp.Msgpack, message)
+
+	case DeliverJSON:
+		return t.encode(wrp.JSON, message)
+
+	case DeliverRaw:
+		header, err := wrp.WRPToHeader(message)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(message.Destination) > 0 {
+			header.Set(DestinationHeader, message.Destination)
+		}
+
+		if len(message.ContentType) > 0 {
+			header.Set(ContentTypeHeader, message.ContentType)
+		} else if len(w.Config.ContentType) > 0 {
+			header.Set(ContentTypeHeader, w.Config.ContentType)
+		}
+
+		return &Delivery{Body: message.Payload, Header: header}, nil
+
+	default:
+		return nil, w.validateDeliveryFormat()
+	}
+}
+
+// TranscodeBytes is like Transcode, but for an event which is still encoded in the given format
+func (t *Transcoder) TranscodeBytes(w *W, f wrp.Format, contents []byte) (*Delivery, error) {
+	decoders, ok := t.decoders[f]
+	if !ok {
+		return nil, fmt.Errorf("unsupported WRP format: %s", f)
+	}
+
+	message := new(wrp.Message)
+	if err := decoders.DecodeBytes(message, contents); err != nil {
+		return nil, err
+	}
+
+	return t.Transcode(w, message)
+}
+
+// encode produces a delivery of a complete WRP message in the given format
+func (t *Transcoder) encode(f wrp.Format, message *wrp.Message) (*Delivery, error) {
+	var body []byte
+	if err := t.encoders[f].EncodeBytes(&body, message); err != nil {
+		return nil, err
+	}
+
+	return &Delivery{
+		Body:   body,
+		Header: http.Header{ContentTypeHeader: []string{f.ContentType()}},
+	}, nil
+}
@@ -0,0 +1,156 @@
+package webhook
+
+import (
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func testDeliveryMessage() *wrp.Message {
+	return &wrp.Message{
+		Type:            wrp.SimpleEventMessageType,
+		Source:          "mac:112233445566",
+		Destination:     "event:device-status/online",
+		TransactionUUID: "transaction-1",
+		ContentType:     "application/json",
+		Payload:         []byte(`{"status": "online"}`),
+	}
+}
+
+func testTranscodeRaw(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		require    = require.New(t)
+		transcoder = NewTranscoder(nil)
+		message    = testDeliveryMessage()
+		w          W
+	)
+
+	delivery, err := transcoder.Transcode(&w, message)
+	require.NoError(err)
+	assert.Equal(message.Payload, delivery.Body)
+	assert.Equal("application/json", delivery.Header.Get(ContentTypeHeader))
+	assert.Equal("SimpleEvent", delivery.Header.Get(wrp.MsgTypeHeader))
+	assert.Equal("mac:112233445566", delivery.Header.Get(wrp.SourceHeader))
+	assert.Equal("transaction-1", delivery.Header.Get(wrp.TransactionUuidHeader))
+	assert.Equal("event:device-status/online", delivery.Header.Get(DestinationHeader))
+
+	// the webhook's content type applies when the message has none
+	message.ContentType = ""
+	w.Config.ContentType = "text/plain"
+	w.Config.DeliveryFormat = DeliverRaw
+	delivery, err = transcoder.Transcode(&w, message)
+	require.NoError(err)
+	assert.Equal("text/plain", delivery.Header.Get(ContentTypeHeader))
+
+	message.Type = wrp.MessageType(-1)
+	delivery, err = transcoder.Transcode(&w, message)
+	assert.Nil(delivery)
+	assert.Equal(wrp.ErrInvalidMsgType, err)
+}
+
+func testTranscodeWRP(t *testing.T) {
+	testData := []struct {
+		deliveryFormat DeliveryFormat
+		format         wrp.Format
+	}{
+		{DeliverMsgpack, wrp.Msgpack},
+		{DeliverJSON, wrp.JSON},
+	}
+
+	for _, record := range testData {
+		t.Run(string(record.deliveryFormat), func(t *testing.T) {
+			var (
+				assert     = assert.New(t)
+				require    = require.New(t)
+				transcoder = NewTranscoder(new(wrp.PoolFactory))
+				message    = testDeliveryMessage()
+				w          W
+			)
+
+			w.Config.DeliveryFormat = record.deliveryFormat
+			delivery, err := transcoder.Transcode(&w, message)
+			require.NoError(err)
+			assert.Equal(record.format.ContentType(), delivery.Header.Get(ContentTypeHeader))
+			assert.Empty(delivery.Header.Get(wrp.MsgTypeHeader))
+
+			var decoded wrp.Message
+			require.NoError(wrp.NewDecoderBytes(delivery.Body, record.format).Decode(&decoded))
+			assert.Equal(*message, decoded)
+		})
+	}
+}
+
+func testTranscodeBytes(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		require    = require.New(t)
+		transcoder = NewTranscoder(nil)
+		message    = testDeliveryMessage()
+		contents   = wrp.MustEncode(message, wrp.Msgpack)
+		w          W
+	)
+
+	// msgpack in, JSON out
+	w.Config.DeliveryFormat = DeliverJSON
+	delivery, err := transcoder.TranscodeBytes(&w, wrp.Msgpack, contents)
+	require.NoError(err)
+
+	var decoded wrp.Message
+	require.NoError(wrp.NewDecoderBytes(delivery.Body, wrp.JSON).Decode(&decoded))
+	assert.Equal(*message, decoded)
+
+	// msgpack in, raw out
+	w.Config.DeliveryFormat = DeliverRaw
+	delivery, err = transcoder.TranscodeBytes(&w, wrp.Msgpack, contents)
+	require.NoError(err)
+	assert.Equal(message.Payload, delivery.Body)
+
+	delivery, err = transcoder.TranscodeBytes(&w, wrp.Msgpack, []byte("this is not msgpack"))
+	assert.Nil(delivery)
+	assert.Error(err)
+
+	delivery, err = transcoder.TranscodeBytes(&w, wrp.Format(999), contents)
+	assert.Nil(delivery)
+	assert.Error(err)
+}
+
+func testTranscodeInvalidFormat(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		w      W
+	)
+
+	w.Config.DeliveryFormat = "xml"
+	delivery, err := NewTranscoder(nil).Transcode(&w, testDeliveryMessage())
+	assert.Nil(delivery)
+	assert.Error(err)
+}
+
+func TestTranscoder(t *testing.T) {
+	t.Run("Raw", testTranscodeRaw)
+	t.Run("WRP", testTranscodeWRP)
+	t.Run("Bytes", testTranscodeBytes)
+	t.Run("InvalidFormat", testTranscodeInvalidFormat)
+}
+
+func TestNewWDeliveryFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	w, err := NewW([]byte(`{"config": {"url": "http://receiver.com/hook", "delivery_format": "msgpack"}, "events": [".*"]}`), "")
+	assert.NoError(err)
+	if assert.NotNil(w) {
+		assert.Equal(DeliverMsgpack, w.deliveryFormat())
+	}
+
+	w, err = NewW([]byte(`{"config": {"url": "http://receiver.com/hook"}, "events": [".*"]}`), "")
+	assert.NoError(err)
+	if assert.NotNil(w) {
+		assert.Equal(DeliverRaw, w.deliveryFormat())
+	}
+
+	w, err = NewW([]byte(`{"config": {"url": "http://receiver.com/hook", "delivery_format": "xml"}, "events": [".*"]}`), "")
+	assert.Nil(w)
+	assert.Error(err)
+}
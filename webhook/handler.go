@@ -5,11 +5,18 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+
+	"github.com/Comcast/webpa-common/httperror"
+	"github.com/Comcast/webpa-common/secure"
+	AWS "github.com/Comcast/webpa-common/webhook/aws"
 )
 
 type Registry struct {
 	m       *monitor
 	Changes chan []W
+
+	// Admins are the principals which may replace or delete hooks that have no owner
+	Admins []string
 }
 
 func NewRegistry(mon *monitor) Registry {
@@ -26,11 +33,34 @@ func jsonResponse(rw http.ResponseWriter, code int, msg string) {
 	rw.Write([]byte(fmt.Sprintf(`{"message":"%s"}`, msg)))
 }
 
-// get is an api call to return all the registered listeners
+// get is an api call to return all the registered listeners.  Registrants whose credentials
+// are restricted to partners only see the listeners of those partners, and only see the secrets of
+// the listeners they own.  The listing can be filtered with the OwnerParameter and EventParameter query parameters.
 func (r *Registry) GetRegistry(rw http.ResponseWriter, req *http.Request) {
-	var items []*W
+	var (
+		items     []W
+		allowed   = allowedPartners(req.Context())
+		principal = secure.RequestPrincipal(req.Context())
+		query     = req.URL.Query()
+		owner     = query.Get(OwnerParameter)
+		event     = query.Get(EventParameter)
+	)
+
 	for i := 0; i < r.m.list.Len(); i++ {
-		items = append(items, r.m.list.Get(i))
+		w := r.m.list.Get(i)
+		if !w.visibleTo(allowed) {
+			continue
+		}
+
+		if _, ok := query[OwnerParameter]; ok && w.Owner != owner {
+			continue
+		}
+
+		if len(event) > 0 && !matchesAny(w.Events, event) {
+			continue
+		}
+
+		items = append(items, w.redacted(principal))
 	}
 
 	if msg, err := json.Marshal(items); err != nil {
@@ -41,24 +71,88 @@ func (r *Registry) GetRegistry(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
-// update is an api call to processes a listenener registration for adding and updating
+// update is an api call to processes a listenener registration for adding and updating.
+// Registrations are scoped to the partners allowed by the registrant's credentials.  The principal
+// of those credentials, if any, is recorded as the listener's owner, and a listener owned by another
+// principal cannot be replaced.  Since registrations reach the list asynchronously, each instance also
+// refuses updates from other owners as they arrive.
 func (r *Registry) UpdateRegistry(rw http.ResponseWriter, req *http.Request) {
 	payload, err := ioutil.ReadAll(req.Body)
 	req.Body.Close()
 
-	w, err := NewW(payload, req.RemoteAddr)
+	w, err := newW(payload, req.RemoteAddr, r.m.now())
 	if err != nil {
 		jsonResponse(rw, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	// owners are never taken from the registration itself
+	principal := secure.RequestPrincipal(req.Context())
+	if existing := r.find(w.ID()); existing != nil && !r.canManage(existing, principal) {
+		jsonResponse(rw, http.StatusForbidden, ErrNotOwner.Error())
+		return
+	}
+
+	w.Owner = principal
+	if err := scopePartners(req.Context(), w); err != nil {
+		jsonResponse(rw, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if err := r.m.validator.Validate(w); err != nil {
+		jsonResponse(rw, httperror.StatusCode(err, http.StatusBadRequest), err.Error())
+		return
+	}
+
+	r.publish(rw, w)
+}
+
+// delete is an api call to remove the listener whose URL is given by the URLParameter query parameter.
+// Only the listener's owner, or an admin for listeners without owners, may remove it.
+func (r *Registry) DeleteRegistry(rw http.ResponseWriter, req *http.Request) {
+	w := r.find(req.URL.Query().Get(URLParameter))
+	if w == nil || !w.visibleTo(allowedPartners(req.Context())) {
+		jsonResponse(rw, http.StatusNotFound, ErrNoSuchWebhook.Error())
+		return
+	}
+
+	if !r.canManage(w, secure.RequestPrincipal(req.Context())) {
+		jsonResponse(rw, http.StatusForbidden, ErrNotOwner.Error())
+		return
+	}
+
+	deleted := *w
+	deleted.Until = deletedUntil
+	r.publish(rw, &deleted)
+}
+
+// publish sends a listener to every instance via the Notifier
+func (r *Registry) publish(rw http.ResponseWriter, w *W) {
 	s, err := json.Marshal(w)
 	if err != nil {
 		jsonResponse(rw, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	r.m.Notifier.PublishMessage(string(s))
+	if publisher, ok := r.m.Notifier.(AWS.CheckedPublisher); ok {
+		if err := publisher.TryPublishMessage(string(s)); err != nil {
+			jsonResponse(rw, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+	} else {
+		r.m.Notifier.PublishMessage(string(s))
+	}
 
 	jsonResponse(rw, http.StatusOK, "Success")
 }
+
+// find returns the listener with the given ID, or nil if there is no such listener
+func (r *Registry) find(id string) *W {
+	for i := 0; i < r.m.list.Len(); i++ {
+		if w := r.m.list.Get(i); w.ID() == id {
+			return w
+		}
+	}
+
+	return nil
+}
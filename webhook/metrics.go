@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// ProbeCounter is the total number of probes of webhook receivers
+	ProbeCounter = "webhook_probe_count"
+
+	// NotificationCounter is the total number of suspension and resumption notifications sent to webhook owners
+	NotificationCounter = "webhook_notification_count"
+
+	// SuspendedGauge is the number of webhooks whose delivery is currently suspended
+	SuspendedGauge = "webhook_suspended_count"
+
+	// CompressionRatioHistogram is the size of each compressed delivery body relative to its original size
+	CompressionRatioHistogram = "webhook_compression_ratio"
+
+	// CompressionDurationHistogram is the time, in seconds, spent compressing each delivery body
+	CompressionDurationHistogram = "webhook_compression_duration_seconds"
+
+	// CompressionSavedBytesCounter is the total number of bytes by which compression reduced delivery bodies
+	CompressionSavedBytesCounter = "webhook_compression_saved_bytes"
+
+	// OutcomeLabel is the label whose value is either "success" or "failure"
+	OutcomeLabel = "outcome"
+
+	// EventLabel is the label whose value is the EventHeader value of a notification
+	EventLabel = "event"
+)
+
+// Metrics is the xmetrics.Module for this package
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name:       ProbeCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of probes of webhook receivers",
+			LabelNames: []string{OutcomeLabel},
+		},
+		{
+			Name:       NotificationCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of suspension and resumption notifications sent to webhook owners",
+			LabelNames: []string{EventLabel, OutcomeLabel},
+		},
+		{
+			Name: SuspendedGauge,
+			Type: xmetrics.GaugeType,
+			Help: "The number of webhooks whose delivery is currently suspended",
+		},
+		{
+			Name:    CompressionRatioHistogram,
+			Type:    xmetrics.HistogramType,
+			Help:    "The size of each compressed delivery body relative to its original size",
+			Buckets: []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1},
+		},
+		{
+			Name:    CompressionDurationHistogram,
+			Type:    xmetrics.HistogramType,
+			Help:    "The time in seconds spent compressing each delivery body",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1},
+		},
+		{
+			Name: CompressionSavedBytesCounter,
+			Type: xmetrics.CounterType,
+			Help: "The total number of bytes by which compression reduced delivery bodies",
+		},
+	}
+}
+
+// outcome returns the OutcomeLabel value for an error
+func outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+
+	return "success"
+}
+
+// probeMeasures is the set of metrics updated by a Prober
+type probeMeasures struct {
+	probes        metrics.Counter
+	notifications metrics.Counter
+	suspended     metrics.Gauge
+}
+
+func newProbeMeasures(p xmetrics.Provider) probeMeasures {
+	return probeMeasures{
+		probes:        p.NewCounter(ProbeCounter),
+		notifications: p.NewCounter(NotificationCounter),
+		suspended:     p.NewGauge(SuspendedGauge),
+	}
+}
+
+// compressionMeasures is the set of metrics updated by a Compressor
+type compressionMeasures struct {
+	ratio    metrics.Histogram
+	duration metrics.Histogram
+	saved    metrics.Counter
+}
+
+func newCompressionMeasures(p xmetrics.Provider) compressionMeasures {
+	return compressionMeasures{
+		ratio:    p.NewHistogram(CompressionRatioHistogram),
+		duration: p.NewHistogram(CompressionDurationHistogram),
+		saved:    p.NewCounter(CompressionSavedBytesCounter),
+	}
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"github.com/Comcast/webpa-common/concurrent"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	assert.NotNil(t, registry)
+	assert.NoError(t, err)
+}
+
+func TestProberMetrics(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		receiver = &testReceiver{status: http.StatusOK}
+		owner    = &testReceiver{status: http.StatusOK}
+
+		receiverServer = httptest.NewServer(receiver)
+		ownerServer    = httptest.NewServer(owner)
+
+		registry, err = xmetrics.NewRegistry(nil, Metrics, concurrent.Metrics)
+
+		w W
+	)
+
+	require.NoError(err)
+	require.NotNil(registry)
+
+	defer receiverServer.Close()
+	defer ownerServer.Close()
+
+	w.Config.URL = receiverServer.URL
+	w.FailureURL = ownerServer.URL
+	w.Events = []string{".*"}
+	w.Until = time.Now().Add(time.Hour)
+
+	var (
+		list   = NewList([]W{w})
+		prober = NewProber(list, &ProbeOptions{SuspendAfter: 1, MetricsProvider: registry})
+	)
+
+	scrape := func() string {
+		response := httptest.NewRecorder()
+		registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+		return response.Body.String()
+	}
+
+	prober.ProbeAll()
+	output := scrape()
+	assert.Contains(output, ProbeCounter+`{outcome="success"} 1`)
+	assert.NotContains(output, NotificationCounter+"{")
+	assert.Contains(output, concurrent.SemaphoreWaitHistogram+`_count{semaphore="`+ProbeSemaphore+`"} 1`)
+
+	receiver.setStatus(http.StatusBadGateway)
+	prober.ProbeAll()
+	require.True(prober.Suspended(w.ID()))
+
+	output = scrape()
+	assert.Contains(output, ProbeCounter+`{outcome="failure"} 1`)
+	assert.Contains(output, NotificationCounter+`{event="suspended",outcome="success"} 1`)
+	assert.Contains(output, SuspendedGauge+" 1")
+
+	// forgetting a suspended webhook removes it from the gauge
+	list.Filter(func([]W) []W { return nil })
+	prober.ProbeAll()
+	assert.Contains(scrape(), SuspendedGauge+" 0")
+}
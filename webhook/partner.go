@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Comcast/webpa-common/secure"
+)
+
+var (
+	ErrPartnerNotAllowed = errors.New("The webhook's partners are not allowed by the registration's credentials")
+)
+
+// allowedPartners returns the partners allowed by the claims in a context, or nil if the claims do not
+// restrict partners or if there are no claims at all
+func allowedPartners(ctx context.Context) []string {
+	if claims, ok := secure.GetClaims(ctx); ok {
+		return secure.AllowedPartners(claims)
+	}
+
+	return nil
+}
+
+// scopePartners restricts a webhook registration to the partners allowed by the registrant's credentials.
+// A registration which names no partners is scoped to every allowed partner, while a registration which names
+// a partner that is not allowed is refused with ErrPartnerNotAllowed.  Registrations made without partner
+// restrictions, e.g. by operators, are left as is.
+func scopePartners(ctx context.Context, w *W) error {
+	allowed := allowedPartners(ctx)
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	if len(w.PartnerIDs) == 0 {
+		w.PartnerIDs = append([]string(nil), allowed...)
+		return nil
+	}
+
+	for _, partnerID := range w.PartnerIDs {
+		if !containsPartner(allowed, partnerID) {
+			return ErrPartnerNotAllowed
+		}
+	}
+
+	return nil
+}
+
+// visibleTo tests if a webhook may be seen by a registrant allowed the given partners.  A registrant without
+// partner restrictions sees every webhook, while others only see webhooks scoped to at least one of their partners.
+func (w *W) visibleTo(allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, partnerID := range w.PartnerIDs {
+		if containsPartner(allowed, partnerID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsPartner tests if a partner appears in a list of partners
+func containsPartner(partnerIDs []string, partnerID string) bool {
+	for _, candidate := range partnerIDs {
+		if candidate == partnerID {
+			return true
+		}
+	}
+
+	return false
+}
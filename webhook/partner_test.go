@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/secure"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/SermoDigital/jose/jws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// partnerContext produces a context carrying claims which allow the given partners
+func partnerContext(partners ...string) context.Context {
+	var allowed []interface{}
+	for _, partner := range partners {
+		allowed = append(allowed, partner)
+	}
+
+	return secure.WithClaims(
+		jws.Claims{secure.AllowedResourcesClaim: map[string]interface{}{secure.AllowedPartnersResource: allowed}},
+		context.Background(),
+	)
+}
+
+func TestScopePartners(t *testing.T) {
+	testData := []struct {
+		ctx              context.Context
+		partnerIDs       []string
+		expectedPartners []string
+		expectedErr      error
+	}{
+		{context.Background(), nil, nil, nil},
+		{context.Background(), []string{"comcast"}, []string{"comcast"}, nil},
+		{secure.WithClaims(jws.Claims{"sub": "operator"}, context.Background()), nil, nil, nil},
+		{partnerContext("comcast", "cox"), nil, []string{"comcast", "cox"}, nil},
+		{partnerContext("comcast", "cox"), []string{"cox"}, []string{"cox"}, nil},
+		{partnerContext("comcast"), []string{"comcast", "cox"}, []string{"comcast", "cox"}, ErrPartnerNotAllowed},
+	}
+
+	for i, record := range testData {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert := assert.New(t)
+			w := W{PartnerIDs: record.partnerIDs}
+			assert.Equal(record.expectedErr, scopePartners(record.ctx, &w))
+			assert.Equal(record.expectedPartners, w.PartnerIDs)
+		})
+	}
+}
+
+func TestWVisibleTo(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True((&W{}).visibleTo(nil))
+	assert.True((&W{PartnerIDs: []string{"comcast"}}).visibleTo(nil))
+	assert.False((&W{}).visibleTo([]string{"comcast"}))
+	assert.False((&W{PartnerIDs: []string{"cox"}}).visibleTo([]string{"comcast"}))
+	assert.True((&W{PartnerIDs: []string{"cox", "comcast"}}).visibleTo([]string{"comcast"}))
+}
+
+func TestWMatchesPartner(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		message = &wrp.Message{
+			Source:      "mac:112233445566",
+			Destination: "event:device-status/mac:112233445566/online",
+		}
+	)
+
+	wrp.SetPartnerID(message, "comcast")
+	event, err := NewEvent(message)
+	require.NoError(err)
+	assert.Equal("comcast", event.PartnerID)
+
+	assert.True((&W{}).Matches(event))
+	assert.True((&W{PartnerIDs: []string{"comcast"}}).Matches(event))
+	assert.True((&W{PartnerIDs: []string{"cox", "comcast"}}).Matches(event))
+	assert.False((&W{PartnerIDs: []string{"cox"}}).Matches(event))
+
+	// events without a partner are never delivered to the webhooks of a partner
+	event.PartnerID = ""
+	assert.True((&W{}).Matches(event))
+	assert.False((&W{PartnerIDs: []string{"comcast"}}).Matches(event))
+}
+
+func TestRegistryPartners(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		hooks = []W{
+			{Until: time.Now().Add(time.Hour), PartnerIDs: []string{"comcast"}},
+			{Until: time.Now().Add(time.Hour), PartnerIDs: []string{"cox"}},
+			{Until: time.Now().Add(time.Hour)},
+		}
+	)
+
+	hooks[0].Config.URL = "http://comcast.example.com"
+	hooks[1].Config.URL = "http://cox.example.com"
+	hooks[2].Config.URL = "http://everyone.example.com"
+
+	registry := NewRegistry(&monitor{list: NewList(hooks)})
+
+	t.Run("Get", func(t *testing.T) {
+		for _, record := range []struct {
+			ctx          context.Context
+			expectedURLs []string
+		}{
+			{context.Background(), []string{"http://comcast.example.com", "http://cox.example.com", "http://everyone.example.com"}},
+			{partnerContext("cox"), []string{"http://cox.example.com"}},
+			{partnerContext("comcast", "cox"), []string{"http://comcast.example.com", "http://cox.example.com"}},
+		} {
+			response := httptest.NewRecorder()
+			registry.GetRegistry(response, httptest.NewRequest("GET", "/hooks", nil).WithContext(record.ctx))
+			assert.Equal(http.StatusOK, response.Code)
+
+			var actual []W
+			require.NoError(json.Unmarshal(response.Body.Bytes(), &actual))
+
+			var urls []string
+			for _, w := range actual {
+				urls = append(urls, w.Config.URL)
+			}
+
+			assert.Equal(record.expectedURLs, urls)
+		}
+	})
+
+	t.Run("UpdateNotAllowed", func(t *testing.T) {
+		var (
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest(
+				"POST",
+				"/hook",
+				bytes.NewBufferString(`{"config": {"url": "http://cox.example.com"}, "events": [".*"], "partner_ids": ["cox"]}`),
+			)
+		)
+
+		registry.UpdateRegistry(response, request.WithContext(partnerContext("comcast")))
+		assert.Equal(http.StatusForbidden, response.Code)
+	})
+}
@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// PayloadPolicy determines what happens to events whose payloads exceed a webhook's maximum payload size
+type PayloadPolicy string
+
+const (
+	// PayloadReject drops oversized events altogether.  This is the default policy.
+	PayloadReject PayloadPolicy = "reject"
+
+	// PayloadTruncate delivers the first MaxPayloadSize bytes of oversized events, flagged as truncated
+	PayloadTruncate PayloadPolicy = "truncate"
+
+	// PayloadLink delivers oversized events with no body, but with a link from which the full payload can be fetched
+	PayloadLink PayloadPolicy = "link"
+)
+
+const (
+	// PayloadSizeHeader is the delivery header holding the original size of a limited payload
+	PayloadSizeHeader = "X-Webpa-Payload-Size"
+
+	// PayloadTruncatedHeader is the delivery header flagging a truncated payload
+	PayloadTruncatedHeader = "X-Webpa-Payload-Truncated"
+
+	// PayloadLinkHeader is the delivery header holding the link to fetch a payload that was not delivered inline
+	PayloadLinkHeader = "X-Webpa-Payload-Link"
+)
+
+var (
+	ErrPayloadTooLarge = errors.New("Payload exceeds the maximum size for this webhook")
+	ErrNoPayloadLinker = errors.New("No PayloadLinker supplied for the link payload policy")
+)
+
+// PayloadLinker produces a URL from which a receiver can fetch the given payload.  Delivery engines
+// that support the link policy supply an implementation, e.g. one which stores payloads in a blob store.
+type PayloadLinker func(payload []byte) (string, error)
+
+// Payload is an event payload after a webhook's size limits have been applied
+type Payload struct {
+	// Body is the payload to deliver inline.  This will be nil if the payload must be fetched via Link.
+	Body []byte
+
+	// OriginalSize is the size, in bytes, of the payload before limits were applied
+	OriginalSize int
+
+	// Truncated indicates that Body contains only the beginning of the original payload
+	Truncated bool
+
+	// Link is the URL from which the full payload can be fetched, if the payload was not delivered inline
+	Link string
+}
+
+// Limited tests if this payload differs from the original event payload
+func (p *Payload) Limited() bool {
+	return p.Truncated || len(p.Link) > 0
+}
+
+// Headers returns the delivery headers describing how this payload was limited.  If the
+// payload was not limited, this method returns nil.
+func (p *Payload) Headers() map[string]string {
+	if !p.Limited() {
+		return nil
+	}
+
+	headers := map[string]string{
+		PayloadSizeHeader: strconv.Itoa(p.OriginalSize),
+	}
+
+	if p.Truncated {
+		headers[PayloadTruncatedHeader] = "true"
+	}
+
+	if len(p.Link) > 0 {
+		headers[PayloadLinkHeader] = p.Link
+	}
+
+	return headers
+}
+
+// payloadPolicy returns the effective payload policy for this webhook
+func (w *W) payloadPolicy() PayloadPolicy {
+	if len(w.Config.PayloadPolicy) > 0 {
+		return w.Config.PayloadPolicy
+	}
+
+	return PayloadReject
+}
+
+// validatePayloadLimits checks the payload size configuration of this webhook
+func (w *W) validatePayloadLimits() error {
+	if w.Config.MaxPayloadSize < 0 {
+		return errors.New("invalid max payload size")
+	}
+
+	switch w.payloadPolicy() {
+	case PayloadReject, PayloadTruncate, PayloadLink:
+		return nil
+	default:
+		return fmt.Errorf("invalid payload policy: %s", w.Config.PayloadPolicy)
+	}
+}
+
+// LimitPayload applies this webhook's maximum payload size to an event payload.  Payloads within
+// the limit, or any payload when no limit is configured, are returned unchanged.  Oversized payloads are
+// handled according to the webhook's PayloadPolicy:
+//
+// PayloadReject returns ErrPayloadTooLarge, and the event should not be delivered.
+//
+// PayloadTruncate returns the first MaxPayloadSize bytes of the payload, flagged as truncated.
+//
+// PayloadLink uses the linker to obtain a URL for the full payload, and returns a payload with no body.
+func (w *W) LimitPayload(payload []byte, linker PayloadLinker) (*Payload, error) {
+	result := &Payload{
+		Body:         payload,
+		OriginalSize: len(payload),
+	}
+
+	if w.Config.MaxPayloadSize <= 0 || len(payload) <= w.Config.MaxPayloadSize {
+		return result, nil
+	}
+
+	switch w.payloadPolicy() {
+	case PayloadTruncate:
+		result.Body = payload[:w.Config.MaxPayloadSize]
+		result.Truncated = true
+		return result, nil
+
+	case PayloadLink:
+		if linker == nil {
+			return nil, ErrNoPayloadLinker
+		}
+
+		link, err := linker(payload)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Body = nil
+		result.Link = link
+		return result, nil
+
+	default:
+		return nil, ErrPayloadTooLarge
+	}
+}
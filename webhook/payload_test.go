@@ -0,0 +1,145 @@
+package webhook
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func testLimitPayloadUnlimited(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		payload = []byte("this is a payload")
+		w       W
+	)
+
+	result, err := w.LimitPayload(payload, nil)
+	assert.NoError(err)
+	assert.Equal(payload, result.Body)
+	assert.Equal(len(payload), result.OriginalSize)
+	assert.False(result.Limited())
+	assert.Nil(result.Headers())
+}
+
+func testLimitPayloadWithinLimit(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		payload = []byte("small")
+		w       W
+	)
+
+	w.Config.MaxPayloadSize = len(payload)
+	result, err := w.LimitPayload(payload, nil)
+	assert.NoError(err)
+	assert.Equal(payload, result.Body)
+	assert.False(result.Limited())
+}
+
+func testLimitPayloadReject(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		payload = []byte("this is a payload")
+		w       W
+	)
+
+	w.Config.MaxPayloadSize = 4
+	result, err := w.LimitPayload(payload, nil)
+	assert.Nil(result)
+	assert.Equal(ErrPayloadTooLarge, err)
+
+	w.Config.PayloadPolicy = PayloadReject
+	result, err = w.LimitPayload(payload, nil)
+	assert.Nil(result)
+	assert.Equal(ErrPayloadTooLarge, err)
+}
+
+func testLimitPayloadTruncate(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		payload = []byte("this is a payload")
+		w       W
+	)
+
+	w.Config.MaxPayloadSize = 4
+	w.Config.PayloadPolicy = PayloadTruncate
+	result, err := w.LimitPayload(payload, nil)
+	assert.NoError(err)
+	assert.Equal([]byte("this"), result.Body)
+	assert.True(result.Truncated)
+	assert.Empty(result.Link)
+	assert.True(result.Limited())
+	assert.Equal(
+		map[string]string{
+			PayloadSizeHeader:      "17",
+			PayloadTruncatedHeader: "true",
+		},
+		result.Headers(),
+	)
+}
+
+func testLimitPayloadLink(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		payload = []byte("this is a payload")
+		w       W
+	)
+
+	w.Config.MaxPayloadSize = 4
+	w.Config.PayloadPolicy = PayloadLink
+
+	result, err := w.LimitPayload(payload, nil)
+	assert.Nil(result)
+	assert.Equal(ErrNoPayloadLinker, err)
+
+	expectedError := errors.New("expected")
+	result, err = w.LimitPayload(payload, func(p []byte) (string, error) {
+		return "", expectedError
+	})
+
+	assert.Nil(result)
+	assert.Equal(expectedError, err)
+
+	result, err = w.LimitPayload(payload, func(p []byte) (string, error) {
+		assert.Equal(payload, p)
+		return "http://payloads.example.com/1234", nil
+	})
+
+	assert.NoError(err)
+	assert.Nil(result.Body)
+	assert.False(result.Truncated)
+	assert.Equal("http://payloads.example.com/1234", result.Link)
+	assert.Equal(
+		map[string]string{
+			PayloadSizeHeader: "17",
+			PayloadLinkHeader: "http://payloads.example.com/1234",
+		},
+		result.Headers(),
+	)
+}
+
+func TestLimitPayload(t *testing.T) {
+	t.Run("Unlimited", testLimitPayloadUnlimited)
+	t.Run("WithinLimit", testLimitPayloadWithinLimit)
+	t.Run("Reject", testLimitPayloadReject)
+	t.Run("Truncate", testLimitPayloadTruncate)
+	t.Run("Link", testLimitPayloadLink)
+}
+
+func TestValidatePayloadLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, policy := range []PayloadPolicy{"", PayloadReject, PayloadTruncate, PayloadLink} {
+		var w W
+		w.Config.MaxPayloadSize = 100
+		w.Config.PayloadPolicy = policy
+		assert.NoError(w.validatePayloadLimits())
+	}
+
+	var w W
+	w.Config.PayloadPolicy = "nosuch"
+	assert.Error(w.validatePayloadLimits())
+
+	w.Config.PayloadPolicy = PayloadTruncate
+	w.Config.MaxPayloadSize = -1
+	assert.Error(w.validatePayloadLimits())
+}
@@ -0,0 +1,464 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Comcast/webpa-common/concurrent"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ProbeMethod determines how webhook receivers are probed
+type ProbeMethod string
+
+const (
+	// ProbeHead sends a HEAD request to the receiver.  Any response other than a 5xx counts as healthy,
+	// since a receiver which only accepts POSTs will often answer with 405.  This is the default method.
+	ProbeHead ProbeMethod = "head"
+
+	// ProbePing POSTs a signed ping event to the receiver, which must answer with a 2xx
+	ProbePing ProbeMethod = "ping"
+)
+
+const (
+	DefaultProbeInterval       time.Duration = 30 * time.Second
+	DefaultProbeTimeout        time.Duration = 5 * time.Second
+	DefaultSuspendAfter                      = 3
+	DefaultResumeAfter                       = 2
+	DefaultMaxConcurrentProbes               = 10
+
+	// ProbeSemaphore is the concurrent.SemaphoreLabel value of the metrics for concurrent probes
+	ProbeSemaphore = "webhook_probe"
+
+	// EventHeader is the header identifying the kind of event sent to a receiver by probes and notifications
+	EventHeader = "X-Webpa-Event"
+
+	// SignatureHeader is the header carrying the SHA1 HMAC of a request body, computed with the webhook's
+	// secret.  The value has the form "sha1=<hex digest>".
+	SignatureHeader = "X-Webpa-Signature"
+
+	// PingEvent is the EventHeader value of ping probes
+	PingEvent = "ping"
+
+	// SuspendedEvent is the EventHeader value of the notification sent to a webhook's FailureURL on suspension
+	SuspendedEvent = "suspended"
+
+	// ResumedEvent is the EventHeader value of the notification sent to a webhook's FailureURL on resumption
+	ResumedEvent = "resumed"
+)
+
+// ProbeOptions configures the health probing of webhook receivers
+type ProbeOptions struct {
+	// Interval is how often every webhook is probed.  If not supplied, DefaultProbeInterval is used.
+	Interval time.Duration `json:"interval"`
+
+	// Timeout is the time allowed for each probe.  If not supplied, DefaultProbeTimeout is used.
+	Timeout time.Duration `json:"timeout"`
+
+	// Method is how receivers are probed.  If not supplied, ProbeHead is used.
+	Method ProbeMethod `json:"method"`
+
+	// SuspendAfter is the number of consecutive failed probes that suspends delivery to a webhook.
+	// If not supplied, DefaultSuspendAfter is used.
+	SuspendAfter int `json:"suspendAfter"`
+
+	// ResumeAfter is the number of consecutive successful probes that resumes delivery to a suspended
+	// webhook.  If not supplied, DefaultResumeAfter is used.
+	ResumeAfter int `json:"resumeAfter"`
+
+	// MaxConcurrentProbes limits the number of webhooks probed, and notified of suspensions and
+	// resumptions, at the same time.  If not supplied, DefaultMaxConcurrentProbes is used.
+	MaxConcurrentProbes int `json:"maxConcurrentProbes"`
+
+	// Client is the HTTP client used for probes and notifications.  If not supplied, http.DefaultClient is used.
+	Client *http.Client `json:"-"`
+
+	// Logger is the logger used to report suspensions.  If not supplied, logging.DefaultLogger() is used.
+	Logger logging.Logger `json:"-"`
+
+	// MetricsProvider is the source of the metrics declared by Metrics, along with the metrics for limited probes,
+	// which are declared by concurrent.Metrics.  If not supplied, metrics are discarded.
+	MetricsProvider xmetrics.Provider `json:"-"`
+
+	// Signer signs the probes and notifications sent to webhooks with secrets.  If not supplied, SecretSigner is used.
+	Signer Signer `json:"-"`
+
+	// Tick is an optional function that produces a channel for time ticks.
+	// Test code can set this field to something that returns a channel under the control of the test.
+	// If not supplied, a time.Ticker is used, which is stopped when the Prober shuts down.
+	Tick func(time.Duration) <-chan time.Time `json:"-"`
+}
+
+func (o *ProbeOptions) interval() time.Duration {
+	if o != nil && o.Interval > 0 {
+		return o.Interval
+	}
+
+	return DefaultProbeInterval
+}
+
+func (o *ProbeOptions) timeout() time.Duration {
+	if o != nil && o.Timeout > 0 {
+		return o.Timeout
+	}
+
+	return DefaultProbeTimeout
+}
+
+func (o *ProbeOptions) method() ProbeMethod {
+	if o != nil && len(o.Method) > 0 {
+		return o.Method
+	}
+
+	return ProbeHead
+}
+
+func (o *ProbeOptions) suspendAfter() int {
+	if o != nil && o.SuspendAfter > 0 {
+		return o.SuspendAfter
+	}
+
+	return DefaultSuspendAfter
+}
+
+func (o *ProbeOptions) resumeAfter() int {
+	if o != nil && o.ResumeAfter > 0 {
+		return o.ResumeAfter
+	}
+
+	return DefaultResumeAfter
+}
+
+func (o *ProbeOptions) maxConcurrentProbes() int {
+	if o != nil && o.MaxConcurrentProbes > 0 {
+		return o.MaxConcurrentProbes
+	}
+
+	return DefaultMaxConcurrentProbes
+}
+
+func (o *ProbeOptions) client() *http.Client {
+	if o != nil && o.Client != nil {
+		return o.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (o *ProbeOptions) logger() logging.Logger {
+	if o != nil && o.Logger != nil {
+		return o.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+func (o *ProbeOptions) metricsProvider() xmetrics.Provider {
+	if o != nil && o.MetricsProvider != nil {
+		return o.MetricsProvider
+	}
+
+	return xmetrics.NewDiscardProvider()
+}
+
+func (o *ProbeOptions) signer() Signer {
+	if o != nil && o.Signer != nil {
+		return o.Signer
+	}
+
+	return SecretSigner{}
+}
+
+// ticker returns the channel of ticks for the given interval, along with a function that stops those ticks
+func (o *ProbeOptions) ticker(interval time.Duration) (<-chan time.Time, func()) {
+	if o != nil && o.Tick != nil {
+		return o.Tick(interval), func() {}
+	}
+
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
+
+// ProbeStatus describes the health of a single webhook receiver
+type ProbeStatus struct {
+	ID                   string    `json:"id"`
+	Suspended            bool      `json:"suspended"`
+	SuspendedAt          time.Time `json:"suspended_at,omitempty"`
+	ConsecutiveFailures  int       `json:"consecutive_failures"`
+	ConsecutiveSuccesses int       `json:"consecutive_successes"`
+	LastProbe            time.Time `json:"last_probe"`
+	LastError            string    `json:"last_error,omitempty"`
+}
+
+// probeEvent is the body of pings and owner notifications
+type probeEvent struct {
+	Event string    `json:"event"`
+	ID    string    `json:"id"`
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
+}
+
+// Prober periodically probes the receivers of a List of webhooks.  A webhook whose receiver fails
+// SuspendAfter consecutive probes is suspended, and is resumed once its receiver passes ResumeAfter consecutive
+// probes.  Each suspension and resumption is announced to the webhook's FailureURL, if it has one.
+//
+// Delivery engines consult Suspended before delivering to a webhook, so that their queues do not back up
+// behind dead receivers.  Requests to receivers are signed with the webhook's secret via SignatureHeader, using the
+// configured Signer.
+type Prober struct {
+	options   *ProbeOptions
+	list      List
+	now       func() time.Time
+	measures  probeMeasures
+	semaphore *concurrent.Semaphore
+
+	lock     sync.RWMutex
+	statuses map[string]*ProbeStatus
+}
+
+// NewProber creates a Prober for the given webhooks
+func NewProber(list List, o *ProbeOptions) *Prober {
+	provider := o.metricsProvider()
+	return &Prober{
+		options:   o,
+		list:      list,
+		now:       time.Now,
+		measures:  newProbeMeasures(provider),
+		semaphore: concurrent.NewSemaphore(ProbeSemaphore, int64(o.maxConcurrentProbes()), provider),
+		statuses:  make(map[string]*ProbeStatus),
+	}
+}
+
+// Suspended tests if delivery to the webhook with the given ID is currently suspended
+func (p *Prober) Suspended(id string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	status, ok := p.statuses[id]
+	return ok && status.Suspended
+}
+
+// Status returns the probe status of the webhook with the given ID
+func (p *Prober) Status(id string) (ProbeStatus, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if status, ok := p.statuses[id]; ok {
+		return *status, true
+	}
+
+	return ProbeStatus{}, false
+}
+
+// ProbeAll probes every webhook in the list once, concurrently, and returns when all probes have finished.
+// At most MaxConcurrentProbes webhooks are probed at the same time.  Webhooks which have left the list are forgotten.
+func (p *Prober) ProbeAll() {
+	var (
+		waitGroup sync.WaitGroup
+		current   = make(map[string]bool, p.list.Len())
+	)
+
+	for index := 0; index < p.list.Len(); index++ {
+		w := *p.list.Get(index)
+		current[w.ID()] = true
+
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			// the weight never exceeds the size, and the context is never done, so this cannot fail
+			p.semaphore.Acquire(context.Background(), 1)
+			defer p.semaphore.Release(1)
+
+			p.record(&w, p.Probe(&w))
+		}()
+	}
+
+	waitGroup.Wait()
+
+	p.lock.Lock()
+	for id, status := range p.statuses {
+		if !current[id] {
+			if status.Suspended {
+				p.measures.suspended.Add(-1)
+			}
+
+			delete(p.statuses, id)
+		}
+	}
+
+	p.lock.Unlock()
+}
+
+// Probe sends a single probe to a webhook's receiver, returning an error if the receiver is unhealthy.
+// The webhook's status is not affected.
+func (p *Prober) Probe(w *W) error {
+	if p.options.method() == ProbePing {
+		return p.send(w, w.Config.URL, PingEvent, "")
+	}
+
+	request, err := http.NewRequest(http.MethodHead, w.Config.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := p.do(request)
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+	if response.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("Probe of %s returned status %d", w.Config.URL, response.StatusCode)
+	}
+
+	return nil
+}
+
+// do executes a request with the configured client and timeout
+func (p *Prober) do(request *http.Request) (*http.Response, error) {
+	client := *p.options.client()
+	client.Timeout = p.options.timeout()
+	return client.Do(request)
+}
+
+// send POSTs a signed probe event to the given URL, which must respond with a 2xx
+func (p *Prober) send(w *W, url, event, reason string) error {
+	body, err := json.Marshal(probeEvent{Event: event, ID: w.ID(), Time: p.now().UTC(), Error: reason})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, event)
+	if len(w.Config.Secret) > 0 {
+		signature, err := p.options.signer().Sign(w, body)
+		if err != nil {
+			return err
+		}
+
+		request.Header.Set(SignatureHeader, signature)
+	}
+
+	response, err := p.do(request)
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s sent to %s returned status %d", event, url, response.StatusCode)
+	}
+
+	return nil
+}
+
+// record updates a webhook's status with the result of a probe, suspending or resuming the webhook as necessary
+func (p *Prober) record(w *W, probeErr error) {
+	var (
+		id    = w.ID()
+		now   = p.now()
+		event string
+	)
+
+	p.measures.probes.With(OutcomeLabel, outcome(probeErr)).Add(1)
+
+	p.lock.Lock()
+	status, ok := p.statuses[id]
+	if !ok {
+		status = &ProbeStatus{ID: id}
+		p.statuses[id] = status
+	}
+
+	status.LastProbe = now
+	if probeErr != nil {
+		status.LastError = probeErr.Error()
+		status.ConsecutiveFailures++
+		status.ConsecutiveSuccesses = 0
+		if !status.Suspended && status.ConsecutiveFailures >= p.options.suspendAfter() {
+			status.Suspended = true
+			status.SuspendedAt = now
+			event = SuspendedEvent
+			p.measures.suspended.Add(1)
+		}
+	} else {
+		status.LastError = ""
+		status.ConsecutiveSuccesses++
+		status.ConsecutiveFailures = 0
+		if status.Suspended && status.ConsecutiveSuccesses >= p.options.resumeAfter() {
+			status.Suspended = false
+			status.SuspendedAt = time.Time{}
+			event = ResumedEvent
+			p.measures.suspended.Add(-1)
+		}
+	}
+
+	p.lock.Unlock()
+
+	if len(event) == 0 {
+		return
+	}
+
+	logger := p.options.logger()
+	if event == SuspendedEvent {
+		logger.Error("Suspending delivery to webhook %s: %s", id, probeErr)
+	} else {
+		logger.Info("Resuming delivery to webhook %s", id)
+	}
+
+	if len(w.FailureURL) > 0 {
+		reason := ""
+		if probeErr != nil {
+			reason = probeErr.Error()
+		}
+
+		err := p.send(w, w.FailureURL, event, reason)
+		p.measures.notifications.With(EventLabel, event, OutcomeLabel, outcome(err)).Add(1)
+		if err != nil {
+			logger.Error("Unable to notify %s of webhook %s being %s: %s", w.FailureURL, id, event, err)
+		}
+	}
+}
+
+// Run starts probing the webhooks at the configured interval until shutdown is closed.  This method
+// implements concurrent.Runnable.
+func (p *Prober) Run(waitGroup *sync.WaitGroup, shutdown <-chan struct{}) error {
+	ticks, stop := p.options.ticker(p.options.interval())
+
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		defer stop()
+
+		for {
+			select {
+			case <-shutdown:
+				return
+			case <-ticks:
+				p.ProbeAll()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Sign computes the SignatureHeader value for a request body
+func Sign(secret string, body []byte) string {
+	h := hmac.New(sha1.New, []byte(secret))
+	h.Write(body)
+	return "sha1=" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,305 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProbeOptionsDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, o := range []*ProbeOptions{nil, new(ProbeOptions)} {
+		assert.Equal(DefaultProbeInterval, o.interval())
+		assert.Equal(DefaultProbeTimeout, o.timeout())
+		assert.Equal(ProbeHead, o.method())
+		assert.Equal(DefaultSuspendAfter, o.suspendAfter())
+		assert.Equal(DefaultResumeAfter, o.resumeAfter())
+		assert.Equal(DefaultMaxConcurrentProbes, o.maxConcurrentProbes())
+		assert.Equal(http.DefaultClient, o.client())
+		assert.NotNil(o.logger())
+		assert.NotNil(o.metricsProvider())
+		assert.Equal(SecretSigner{}, o.signer())
+
+		ticks, stop := o.ticker(time.Hour)
+		assert.NotNil(ticks)
+		stop()
+	}
+}
+
+func TestSign(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("sha1=a18991ff7e4513a1c2d2ee51e3a8e99ca891d9cd", Sign("secret", []byte("body")))
+	assert.NotEqual(Sign("secret", []byte("body")), Sign("other", []byte("body")))
+}
+
+// testReceiver is a webhook receiver whose health is under the control of a test
+type testReceiver struct {
+	status int32
+
+	lock     sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *testReceiver) setStatus(status int) {
+	atomic.StoreInt32(&r.status, int32(status))
+}
+
+func (r *testReceiver) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	body, _ := ioutil.ReadAll(request.Body)
+
+	r.lock.Lock()
+	r.requests = append(r.requests, request)
+	r.bodies = append(r.bodies, body)
+	r.lock.Unlock()
+
+	response.WriteHeader(int(atomic.LoadInt32(&r.status)))
+}
+
+func testProbeHead(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		receiver = &testReceiver{status: http.StatusMethodNotAllowed}
+		server   = httptest.NewServer(receiver)
+		prober   = NewProber(NewList(nil), nil)
+		w        W
+	)
+
+	defer server.Close()
+	w.Config.URL = server.URL
+
+	assert.NoError(prober.Probe(&w))
+	require.Len(t, receiver.requests, 1)
+	assert.Equal(http.MethodHead, receiver.requests[0].Method)
+
+	receiver.setStatus(http.StatusServiceUnavailable)
+	assert.Error(prober.Probe(&w))
+
+	w.Config.URL = "http://127.0.0.1:1/nosuch"
+	assert.Error(prober.Probe(&w))
+}
+
+func testProbePing(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		receiver = &testReceiver{status: http.StatusOK}
+		server   = httptest.NewServer(receiver)
+		prober   = NewProber(NewList(nil), &ProbeOptions{Method: ProbePing})
+		w        W
+	)
+
+	defer server.Close()
+	w.Config.URL = server.URL
+	w.Config.Secret = "secret"
+
+	assert.NoError(prober.Probe(&w))
+	require.Len(receiver.requests, 1)
+	assert.Equal(http.MethodPost, receiver.requests[0].Method)
+	assert.Equal(PingEvent, receiver.requests[0].Header.Get(EventHeader))
+	assert.Equal(Sign("secret", receiver.bodies[0]), receiver.requests[0].Header.Get(SignatureHeader))
+
+	var event probeEvent
+	require.NoError(json.Unmarshal(receiver.bodies[0], &event))
+	assert.Equal(PingEvent, event.Event)
+	assert.Equal(server.URL, event.ID)
+
+	receiver.setStatus(http.StatusMethodNotAllowed)
+	assert.Error(prober.Probe(&w))
+}
+
+func TestProbe(t *testing.T) {
+	t.Run("Head", testProbeHead)
+	t.Run("Ping", testProbePing)
+}
+
+func TestProberSuspendAndResume(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		receiver = &testReceiver{status: http.StatusOK}
+		owner    = &testReceiver{status: http.StatusOK}
+
+		receiverServer = httptest.NewServer(receiver)
+		ownerServer    = httptest.NewServer(owner)
+
+		w W
+	)
+
+	defer receiverServer.Close()
+	defer ownerServer.Close()
+
+	w.Config.URL = receiverServer.URL
+	w.Config.Secret = "secret"
+	w.FailureURL = ownerServer.URL
+	w.Events = []string{".*"}
+	w.Until = time.Now().Add(time.Hour)
+
+	var (
+		list   = NewList([]W{w})
+		prober = NewProber(list, &ProbeOptions{SuspendAfter: 2, ResumeAfter: 2})
+	)
+
+	_, ok := prober.Status(w.ID())
+	assert.False(ok)
+	assert.False(prober.Suspended(w.ID()))
+
+	prober.ProbeAll()
+	status, ok := prober.Status(w.ID())
+	assert.True(ok)
+	assert.False(status.Suspended)
+	assert.Equal(1, status.ConsecutiveSuccesses)
+
+	receiver.setStatus(http.StatusBadGateway)
+	prober.ProbeAll()
+	assert.False(prober.Suspended(w.ID()))
+	assert.Empty(owner.requests)
+
+	prober.ProbeAll()
+	assert.True(prober.Suspended(w.ID()))
+	status, _ = prober.Status(w.ID())
+	assert.Equal(2, status.ConsecutiveFailures)
+	assert.NotEmpty(status.LastError)
+	assert.False(status.SuspendedAt.IsZero())
+
+	require.Len(owner.requests, 1)
+	assert.Equal(SuspendedEvent, owner.requests[0].Header.Get(EventHeader))
+	assert.Equal(Sign("secret", owner.bodies[0]), owner.requests[0].Header.Get(SignatureHeader))
+
+	// further failures do not notify the owner again
+	prober.ProbeAll()
+	assert.True(prober.Suspended(w.ID()))
+	assert.Len(owner.requests, 1)
+
+	receiver.setStatus(http.StatusOK)
+	prober.ProbeAll()
+	assert.True(prober.Suspended(w.ID()))
+
+	prober.ProbeAll()
+	assert.False(prober.Suspended(w.ID()))
+	status, _ = prober.Status(w.ID())
+	assert.Empty(status.LastError)
+	assert.True(status.SuspendedAt.IsZero())
+
+	require.Len(owner.requests, 2)
+	assert.Equal(ResumedEvent, owner.requests[1].Header.Get(EventHeader))
+
+	// webhooks that leave the list are forgotten
+	list.Filter(func([]W) []W { return nil })
+	prober.ProbeAll()
+	_, ok = prober.Status(w.ID())
+	assert.False(ok)
+}
+
+// concurrencyReceiver is a webhook receiver which records the greatest number of requests it handled at once
+type concurrencyReceiver struct {
+	current int32
+	max     int32
+}
+
+func (r *concurrencyReceiver) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	current := atomic.AddInt32(&r.current, 1)
+	defer atomic.AddInt32(&r.current, -1)
+
+	for {
+		max := atomic.LoadInt32(&r.max)
+		if current <= max || atomic.CompareAndSwapInt32(&r.max, max, current) {
+			break
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestProberMaxConcurrentProbes(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		receiver = new(concurrencyReceiver)
+		server   = httptest.NewServer(receiver)
+		webhooks []W
+	)
+
+	defer server.Close()
+	for index := 0; index < 5; index++ {
+		var w W
+		w.Config.URL = fmt.Sprintf("%s/%d", server.URL, index)
+		w.Until = time.Now().Add(time.Hour)
+		webhooks = append(webhooks, w)
+	}
+
+	prober := NewProber(NewList(webhooks), &ProbeOptions{MaxConcurrentProbes: 2})
+	prober.ProbeAll()
+
+	assert.Equal(int32(2), atomic.LoadInt32(&receiver.max))
+	for _, w := range webhooks {
+		status, ok := prober.Status(w.ID())
+		assert.True(ok)
+		assert.Equal(1, status.ConsecutiveSuccesses)
+	}
+}
+
+func TestProberRun(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		receiver = &testReceiver{status: http.StatusOK}
+		server   = httptest.NewServer(receiver)
+		ticks    = make(chan time.Time)
+		w        W
+	)
+
+	defer server.Close()
+	w.Config.URL = server.URL
+	w.Until = time.Now().Add(time.Hour)
+
+	var (
+		prober = NewProber(NewList([]W{w}), &ProbeOptions{
+			Interval: time.Minute,
+			Tick: func(d time.Duration) <-chan time.Time {
+				assert.Equal(time.Minute, d)
+				return ticks
+			},
+		})
+
+		waitGroup = new(sync.WaitGroup)
+		shutdown  = make(chan struct{})
+	)
+
+	assert.NoError(prober.Run(waitGroup, shutdown))
+	ticks <- time.Now()
+	ticks <- time.Now() // the second tick can only be received once the first round has finished
+
+	status, ok := prober.Status(w.ID())
+	assert.True(ok)
+	assert.True(status.ConsecutiveSuccesses >= 1)
+
+	close(shutdown)
+	waitGroup.Wait()
+}
+
+func TestFactoryNewProber(t *testing.T) {
+	assert := assert.New(t)
+
+	f, err := NewFactory(nil)
+	assert.NoError(err)
+	if prober := f.NewProber(NewList(nil)); assert.NotNil(prober) {
+		assert.NotEqual(http.DefaultClient, prober.options.client())
+		assert.IsType(&http.Transport{}, prober.options.client().Transport)
+	}
+
+	f.Probe = &ProbeOptions{Method: ProbePing}
+	assert.Equal(ProbePing, f.NewProber(NewList(nil)).options.method())
+
+	client := new(http.Client)
+	f.Probe.Client = client
+	assert.Equal(client, f.NewProber(NewList(nil)).options.client())
+}
@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"crypto"
+	"encoding/hex"
+	"errors"
+	"github.com/Comcast/webpa-common/secure/key"
+)
+
+var (
+	ErrNoSigningKey = errors.New("No signing key is configured for the webhook's owner")
+)
+
+// Signer computes the SignatureHeader value for a request body sent to a webhook.  Signers are only
+// consulted for webhooks which have a secret.  Implementations must be safe for concurrent use.
+type Signer interface {
+	Sign(w *W, body []byte) (string, error)
+}
+
+// SignerFunc is a function type that implements Signer
+type SignerFunc func(*W, []byte) (string, error)
+
+func (f SignerFunc) Sign(w *W, body []byte) (string, error) {
+	return f(w, body)
+}
+
+// SecretSigner is the default Signer, which signs with each webhook's secret as the Sign function does
+type SecretSigner struct{}
+
+func (SecretSigner) Sign(w *W, body []byte) (string, error) {
+	return Sign(w.Config.Secret, body), nil
+}
+
+// ModuleSigner is a Signer whose HMAC secrets are held in a key.Module, such as a hardware security module,
+// so that they never appear in memory or in registrations.  Since registrations are untrusted, a registration
+// never names the key which signs its requests.  Instead, Labels maps the Owner of each webhook, which is always
+// set from the registrant's credentials, to the label of its HMAC key in the module.  Webhooks whose owners have
+// no label cannot be signed.  The signatures are identical to those of SecretSigner for the same secrets.
+type ModuleSigner struct {
+	Module key.Module
+
+	// Labels is the server-side mapping of webhook owners to the labels of their HMAC keys
+	Labels map[string]string
+}
+
+func (s ModuleSigner) Sign(w *W, body []byte) (string, error) {
+	label, ok := s.Labels[w.Owner]
+	if !ok {
+		return "", ErrNoSigningKey
+	}
+
+	mac, err := s.Module.HMAC(label, crypto.SHA1, body)
+	if err != nil {
+		return "", err
+	}
+
+	return "sha1=" + hex.EncodeToString(mac), nil
+}
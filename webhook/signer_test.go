@@ -0,0 +1,92 @@
+package webhook
+
+import (
+	"errors"
+	"github.com/Comcast/webpa-common/secure/key"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecretSigner(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		w      W
+	)
+
+	w.Config.Secret = "secret"
+	signature, err := SecretSigner{}.Sign(&w, []byte("body"))
+	assert.NoError(err)
+	assert.Equal(Sign("secret", []byte("body")), signature)
+}
+
+func TestModuleSigner(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		module = new(key.SoftwareModule)
+		signer = ModuleSigner{
+			Module: module,
+			Labels: map[string]string{"owner": "webhook-key", "misconfigured": "nosuch"},
+		}
+
+		w W
+	)
+
+	module.AddSecret("webhook-key", []byte("secret"))
+	module.AddSecret("other-key", []byte("other"))
+	w.Owner = "owner"
+
+	// the registration's secret never selects the key
+	w.Config.Secret = "other-key"
+	signature, err := signer.Sign(&w, []byte("body"))
+	assert.NoError(err)
+	assert.Equal(Sign("secret", []byte("body")), signature)
+
+	w.Owner = "misconfigured"
+	signature, err = signer.Sign(&w, []byte("body"))
+	assert.Error(err)
+	assert.Empty(signature)
+
+	for _, owner := range []string{"", "other-key", "unknown"} {
+		w.Owner = owner
+		signature, err = signer.Sign(&w, []byte("body"))
+		assert.Equal(ErrNoSigningKey, err)
+		assert.Empty(signature)
+	}
+}
+
+func TestProberSigner(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		receiver = &testReceiver{status: http.StatusOK}
+		server   = httptest.NewServer(receiver)
+		module   = new(key.SoftwareModule)
+		w        W
+	)
+
+	defer server.Close()
+	module.AddSecret("webhook-key", []byte("secret"))
+	w.Config.URL = server.URL
+	w.Config.Secret = "webhook-key"
+	w.Owner = "owner"
+
+	prober := NewProber(NewList(nil), &ProbeOptions{
+		Method: ProbePing,
+		Signer: ModuleSigner{Module: module, Labels: map[string]string{"owner": "webhook-key"}},
+	})
+	assert.NoError(prober.Probe(&w))
+	require.Len(receiver.requests, 1)
+	assert.Equal(Sign("secret", receiver.bodies[0]), receiver.requests[0].Header.Get(SignatureHeader))
+
+	// a signing failure fails the probe without contacting the receiver
+	prober = NewProber(NewList(nil), &ProbeOptions{
+		Method: ProbePing,
+		Signer: SignerFunc(func(*W, []byte) (string, error) { return "", errors.New("expected") }),
+	})
+
+	assert.Error(prober.Probe(&w))
+	assert.Len(receiver.requests, 1)
+}
@@ -156,7 +156,7 @@ func (sc *StartConfig) GetCurrentSystemsHooks(rc chan Result) {
 
 		// temporary fix to convert old webhook struct to new.
 		if err != nil && strings.HasPrefix(err.Error(), "parsing time") {
-			hooks, err = convertOldHooksToNewHooks(body)
+			hooks, err = convertOldHooksToNewHooks(body, time.Now())
 		}
 
 		rChan <- Result{hooks, err}
@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"github.com/Comcast/webpa-common/tracing"
+	"net/http"
+)
+
+const (
+	// DeliveryURLTag is the span tag whose value is the URL of the webhook receiving a delivery
+	DeliveryURLTag = "webhook.url"
+
+	// DeliveryEventTag is the span tag whose value is the EventHeader of a delivery
+	DeliveryEventTag = "webhook.event"
+
+	// DeliveryStatusTag is the span tag whose value is the HTTP status code returned by a webhook's receiver
+	DeliveryStatusTag = "http.status_code"
+)
+
+// StartDelivery begins the "webhook.delivery" span for a request sent to a webhook's receiver, using the
+// tracing package's process-wide Tracer.  The span is a child of the trace context in the request's Context,
+// e.g. the trace of the event being delivered.  The span's context is written to the request's
+// tracing.TraceParentHeader, so that the receiver can continue the trace.
+//
+// Delivery engines must finish the returned span, typically with FinishDelivery.
+func StartDelivery(w *W, request *http.Request) tracing.Span {
+	span, _ := tracing.StartSpan(request.Context(), "webhook.delivery")
+	span.SetTag(DeliveryURLTag, w.Config.URL)
+	if event := request.Header.Get(EventHeader); len(event) > 0 {
+		span.SetTag(DeliveryEventTag, event)
+	}
+
+	tracing.InjectHeader(span.Context(), request.Header)
+	return span
+}
+
+// FinishDelivery records the outcome of a delivery in its span, then finishes the span.  Either the response
+// or the error may be nil.
+func FinishDelivery(span tracing.Span, response *http.Response, err error) {
+	if response != nil {
+		span.SetTag(DeliveryStatusTag, response.StatusCode)
+	}
+
+	span.SetError(err)
+	span.Finish()
+}
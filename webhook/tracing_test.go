@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"github.com/Comcast/webpa-common/tracing"
+	"github.com/Comcast/webpa-common/tracing/tracingtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStartDelivery(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		tracer  = tracingtest.NewTracer()
+		remote  = tracing.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}
+
+		w       = new(W)
+		request = httptest.NewRequest("POST", "http://receiver.example.com/events", nil)
+	)
+
+	defer tracer.Install()()
+
+	w.Config.URL = "http://receiver.example.com/events"
+	request = request.WithContext(tracing.WithSpanContext(context.Background(), remote))
+	request.Header.Set(EventHeader, "device-status")
+
+	span := StartDelivery(w, request)
+	sc, ok := tracing.ExtractHeader(request.Header)
+	assert.True(ok)
+	assert.Equal(span.Context(), sc)
+	assert.Equal(remote.TraceID, sc.TraceID)
+
+	FinishDelivery(span, &http.Response{StatusCode: http.StatusAccepted}, nil)
+
+	span = StartDelivery(w, httptest.NewRequest("POST", "http://receiver.example.com/events", nil))
+	FinishDelivery(span, nil, errors.New("expected"))
+
+	spans := tracer.Spans()
+	require.Len(spans, 2)
+
+	assert.Equal("webhook.delivery", spans[0].Name)
+	assert.Equal(remote, spans[0].Parent)
+	assert.Equal(
+		map[string]interface{}{
+			DeliveryURLTag:    "http://receiver.example.com/events",
+			DeliveryEventTag:  "device-status",
+			DeliveryStatusTag: http.StatusAccepted,
+		},
+		spans[0].Tags,
+	)
+
+	assert.NoError(spans[0].Error)
+	assert.True(spans[0].Finished)
+
+	assert.False(spans[1].Parent.IsValid())
+	assert.Equal(map[string]interface{}{DeliveryURLTag: "http://receiver.example.com/events"}, spans[1].Tags)
+	assert.Equal(errors.New("expected"), spans[1].Error)
+	assert.True(spans[1].Finished)
+}
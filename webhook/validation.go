@@ -0,0 +1,320 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Comcast/webpa-common/httperror"
+)
+
+var (
+	ErrInvalidURL     = errors.New("Webhook URLs must be absolute http or https URLs")
+	ErrInsecureURL    = errors.New("Webhook URLs must use https")
+	ErrPrivateAddress = errors.New("Webhook URLs must not resolve to private, loopback, or link-local addresses")
+	ErrNoAddresses    = errors.New("Webhook URL host did not resolve to any addresses")
+	ErrEmptyPattern   = errors.New("Webhook event and device id patterns must not be blank")
+	ErrWebhookExpired = httperror.New(httperror.WebhookExpired, "Webhook registrations must not have already expired")
+)
+
+// privateNetworks are the address ranges which webhooks may not target unless ValidationOptions.AllowPrivate is set
+var privateNetworks []*net.IPNet
+
+func init() {
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+
+		privateNetworks = append(privateNetworks, network)
+	}
+}
+
+func isPrivate(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsMulticast() {
+		return true
+	}
+
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidationOptions configures the validation of webhook registrations
+type ValidationOptions struct {
+	// AllowHTTP permits webhook URLs with the http scheme.  By default, only https URLs are accepted.
+	AllowHTTP bool `json:"allowHTTP"`
+
+	// AllowPrivate permits webhook URLs which resolve to private, loopback, or link-local addresses.
+	// By default, such URLs are rejected to prevent registrations from reaching internal services.
+	AllowPrivate bool `json:"allowPrivate"`
+
+	// MaxDuration is the longest time a registration may live.  If not supplied, or if greater than
+	// DEFAULT_EXPIRATION_DURATION, DEFAULT_EXPIRATION_DURATION is used.
+	MaxDuration time.Duration `json:"maxDuration"`
+
+	// Resolver looks up the addresses of webhook URL hosts.  If not supplied, net.LookupIP is used.
+	Resolver func(host string) ([]net.IP, error) `json:"-"`
+
+	// Now is the source of the current time, used to cap expirations.  If not supplied, time.Now is used.
+	Now func() time.Time `json:"-"`
+}
+
+func (o *ValidationOptions) allowHTTP() bool {
+	return o != nil && o.AllowHTTP
+}
+
+func (o *ValidationOptions) allowPrivate() bool {
+	return o != nil && o.AllowPrivate
+}
+
+func (o *ValidationOptions) maxDuration() time.Duration {
+	if o != nil && o.MaxDuration > 0 && o.MaxDuration < DEFAULT_EXPIRATION_DURATION {
+		return o.MaxDuration
+	}
+
+	return DEFAULT_EXPIRATION_DURATION
+}
+
+func (o *ValidationOptions) resolver() func(string) ([]net.IP, error) {
+	if o != nil && o.Resolver != nil {
+		return o.Resolver
+	}
+
+	return net.LookupIP
+}
+
+func (o *ValidationOptions) now() func() time.Time {
+	if o != nil && o.Now != nil {
+		return o.Now
+	}
+
+	return time.Now
+}
+
+// Validator checks and canonicalizes webhook registrations before they are inserted into a registry,
+// so that malformed or dangerous registrations are rejected up front rather than failing at delivery time.
+type Validator struct {
+	allowHTTP    bool
+	allowPrivate bool
+	maxDuration  time.Duration
+	resolver     func(string) ([]net.IP, error)
+	now          func() time.Time
+}
+
+// NewValidator creates a Validator from a set of options, which may be nil to take all defaults
+func NewValidator(o *ValidationOptions) *Validator {
+	return &Validator{
+		allowHTTP:    o.allowHTTP(),
+		allowPrivate: o.allowPrivate(),
+		maxDuration:  o.maxDuration(),
+		resolver:     o.resolver(),
+		now:          o.now(),
+	}
+}
+
+// Validate checks a webhook and canonicalizes it in place.  On success:
+//
+// The URL and FailureURL have lowercase schemes and hosts, no default ports, and no fragments.  Since
+// a webhook's ID is its URL, this ensures that equivalent registrations replace each other.
+//
+// Events and device id patterns are trimmed, compile as regular expressions, and have no duplicates.
+//
+// The Duration and Until do not exceed the maximum duration from now, and an Until in the past is rejected
+// with ErrWebhookExpired.
+func (v *Validator) Validate(w *W) error {
+	var err error
+	if w.Config.URL, err = v.canonicalURL(w.Config.URL); err != nil {
+		return err
+	}
+
+	if len(strings.TrimSpace(w.FailureURL)) > 0 {
+		if w.FailureURL, err = v.canonicalURL(w.FailureURL); err != nil {
+			return err
+		}
+	}
+
+	// content types are not parsed, since shorthands such as "json" are accepted at delivery
+	w.Config.ContentType = strings.TrimSpace(w.Config.ContentType)
+
+	if w.Events, err = canonicalPatterns(w.Events); err != nil {
+		return err
+	} else if len(w.Events) == 0 {
+		return errors.New("invalid events")
+	}
+
+	if w.Matcher.DeviceId, err = canonicalPatterns(w.Matcher.DeviceId); err != nil {
+		return err
+	}
+
+	if w.Duration <= 0 || w.Duration > v.maxDuration {
+		w.Duration = v.maxDuration
+	}
+
+	now := v.now()
+	if !w.Until.IsZero() && !w.Until.After(now) {
+		return ErrWebhookExpired
+	}
+
+	if latest := now.Add(w.Duration); w.Until.IsZero() || w.Until.After(latest) {
+		w.Until = latest
+	}
+
+	return nil
+}
+
+// canonicalURL checks that a URL is acceptable as a webhook target, returning its canonical form
+func (v *Validator) canonicalURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %s", raw, err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if (u.Scheme != "https" && u.Scheme != "http") || len(u.Hostname()) == 0 {
+		return "", ErrInvalidURL
+	} else if u.Scheme == "http" && !v.allowHTTP {
+		return "", ErrInsecureURL
+	}
+
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		port = ""
+	}
+
+	if !v.allowPrivate {
+		if err := v.checkHost(host); err != nil {
+			return "", err
+		}
+	}
+
+	if strings.Contains(host, ":") {
+		// IPv6 literals must remain bracketed
+		host = "[" + host + "]"
+	}
+
+	if len(port) > 0 {
+		u.Host = host + ":" + port
+	} else {
+		u.Host = host
+	}
+
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+// checkHost resolves a host, rejecting it if any of its addresses are private
+func (v *Validator) checkHost(host string) error {
+	_, err := v.resolve(host)
+	return err
+}
+
+// resolve returns the addresses of a host, which may be an IP literal.  Every address is checked, since a host
+// with a mix of public and private addresses could still be used to reach internal services.
+func (v *Validator) resolve(host string) ([]net.IP, error) {
+	addresses := []net.IP{net.ParseIP(host)}
+	if addresses[0] == nil {
+		var err error
+		if addresses, err = v.resolver(host); err != nil {
+			return nil, fmt.Errorf("unable to resolve webhook host %q: %s", host, err)
+		} else if len(addresses) == 0 {
+			return nil, ErrNoAddresses
+		}
+	}
+
+	for _, address := range addresses {
+		if isPrivate(address) {
+			return nil, ErrPrivateAddress
+		}
+	}
+
+	return addresses, nil
+}
+
+// DialContext dials a webhook receiver, and can be used as the DialContext of an http.Transport.
+// Validate only checks the addresses a host resolved to at registration time, so a host whose DNS later
+// changes could still be used to reach internal services.  This method closes that gap by resolving the
+// host again, rejecting it with ErrPrivateAddress if any address is private, and then dialing one of the
+// addresses that were checked rather than resolving the host a second time.
+func (v *Validator) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if v.allowPrivate {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := v.resolve(host)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ip := range addresses {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+
+	return nil, err
+}
+
+// NewTransport returns an http.Transport for webhook deliveries which dials through DialContext, so that
+// deliveries are subject to the same address restrictions as registrations.  Proxies are not used, since a
+// proxy would resolve the receiver's host on its own.
+func (v *Validator) NewTransport() *http.Transport {
+	return &http.Transport{
+		DialContext:           v.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// canonicalPatterns trims and compiles a list of regular expressions, removing duplicates
+func canonicalPatterns(patterns []string) ([]string, error) {
+	var (
+		canonical []string
+		seen      = make(map[string]bool, len(patterns))
+	)
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if len(pattern) == 0 {
+			return nil, ErrEmptyPattern
+		} else if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+		} else if !seen[pattern] {
+			seen[pattern] = true
+			canonical = append(canonical, pattern)
+		}
+	}
+
+	return canonical, nil
+}
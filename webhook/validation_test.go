@@ -0,0 +1,272 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/httperror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testResolver resolves a fixed set of hosts
+func testResolver(hosts map[string][]string) func(string) ([]net.IP, error) {
+	return func(host string) ([]net.IP, error) {
+		addresses, ok := hosts[host]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+
+		var ips []net.IP
+		for _, address := range addresses {
+			ips = append(ips, net.ParseIP(address))
+		}
+
+		return ips, nil
+	}
+}
+
+func newValidationHook(url string) *W {
+	w := new(W)
+	w.Config.URL = url
+	w.Events = []string{".*"}
+	return w
+}
+
+func TestValidationOptionsDefaults(t *testing.T) {
+	assert := assert.New(t)
+	for _, o := range []*ValidationOptions{nil, new(ValidationOptions)} {
+		assert.False(o.allowHTTP())
+		assert.False(o.allowPrivate())
+		assert.Equal(DEFAULT_EXPIRATION_DURATION, o.maxDuration())
+		assert.NotNil(o.resolver())
+		assert.NotNil(o.now())
+	}
+
+	o := &ValidationOptions{MaxDuration: time.Hour}
+	assert.Equal(DEFAULT_EXPIRATION_DURATION, o.maxDuration())
+
+	o.MaxDuration = time.Minute
+	assert.Equal(time.Minute, o.maxDuration())
+}
+
+func TestIsPrivate(t *testing.T) {
+	assert := assert.New(t)
+	for _, address := range []string{"0.0.0.0", "10.1.2.3", "100.64.0.1", "127.0.0.1", "169.254.169.254", "172.16.0.1", "172.31.255.255", "192.168.1.1", "224.0.0.1", "::", "::1", "fd00::1", "fe80::1", "::ffff:127.0.0.1"} {
+		assert.True(isPrivate(net.ParseIP(address)), address)
+	}
+
+	for _, address := range []string{"8.8.8.8", "172.32.0.1", "100.128.0.1", "2001:4860:4860::8888"} {
+		assert.False(isPrivate(net.ParseIP(address)), address)
+	}
+}
+
+func TestValidatorURL(t *testing.T) {
+	validator := NewValidator(&ValidationOptions{
+		Resolver: testResolver(map[string][]string{
+			"example.com":  {"93.184.216.34"},
+			"internal.net": {"10.0.0.5"},
+			"mixed.net":    {"93.184.216.34", "127.0.0.1"},
+			"empty.net":    {},
+		}),
+	})
+
+	testData := []struct {
+		url         string
+		expectedURL string
+		expectedErr error
+	}{
+		{url: "https://example.com/hook", expectedURL: "https://example.com/hook"},
+		{url: "  HTTPS://Example.COM:443/Hook#fragment ", expectedURL: "https://example.com/Hook"},
+		{url: "https://example.com:8443/hook?x=1", expectedURL: "https://example.com:8443/hook?x=1"},
+		{url: "https://93.184.216.34/hook", expectedURL: "https://93.184.216.34/hook"},
+		{url: "http://example.com/hook", expectedErr: ErrInsecureURL},
+		{url: "ftp://example.com/hook", expectedErr: ErrInvalidURL},
+		{url: "/hook", expectedErr: ErrInvalidURL},
+		{url: "", expectedErr: ErrInvalidURL},
+		{url: "https://internal.net/hook", expectedErr: ErrPrivateAddress},
+		{url: "https://mixed.net/hook", expectedErr: ErrPrivateAddress},
+		{url: "https://127.0.0.1/hook", expectedErr: ErrPrivateAddress},
+		{url: "https://[::1]:8080/hook", expectedErr: ErrPrivateAddress},
+		{url: "https://169.254.169.254/latest/meta-data", expectedErr: ErrPrivateAddress},
+		{url: "https://empty.net/hook", expectedErr: ErrNoAddresses},
+	}
+
+	for _, record := range testData {
+		t.Run(record.url, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+				w      = newValidationHook(record.url)
+				err    = validator.Validate(w)
+			)
+
+			if record.expectedErr != nil {
+				assert.Equal(record.expectedErr, err)
+			} else {
+				assert.NoError(err)
+				assert.Equal(record.expectedURL, w.Config.URL)
+			}
+		})
+	}
+
+	t.Run("Unresolvable", func(t *testing.T) {
+		assert.Error(t, validator.Validate(newValidationHook("https://nosuch.net/hook")))
+	})
+}
+
+func TestValidatorAllowHTTPAndPrivate(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		validator = NewValidator(&ValidationOptions{AllowHTTP: true, AllowPrivate: true})
+		w         = newValidationHook("HTTP://LOCALHOST:80/hook")
+	)
+
+	assert.NoError(validator.Validate(w))
+	assert.Equal("http://localhost/hook", w.Config.URL)
+
+	w = newValidationHook("http://[::1]:8080/hook")
+	assert.NoError(validator.Validate(w))
+	assert.Equal("http://[::1]:8080/hook", w.Config.URL)
+}
+
+func TestValidatorFailureURL(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		validator = NewValidator(&ValidationOptions{Resolver: testResolver(map[string][]string{"example.com": {"93.184.216.34"}})})
+		w         = newValidationHook("https://example.com/hook")
+	)
+
+	w.FailureURL = "https://EXAMPLE.com/failure"
+	assert.NoError(validator.Validate(w))
+	assert.Equal("https://example.com/failure", w.FailureURL)
+
+	w.FailureURL = "https://10.0.0.1/failure"
+	assert.Equal(ErrPrivateAddress, validator.Validate(w))
+}
+
+func TestValidatorPatterns(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		validator = NewValidator(&ValidationOptions{AllowPrivate: true})
+		w         = newValidationHook("https://127.0.0.1/hook")
+	)
+
+	w.Config.ContentType = " json "
+	w.Events = []string{" device-status.* ", "iot", "device-status.*"}
+	w.Matcher.DeviceId = []string{"mac:.*", "mac:.*"}
+	assert.NoError(validator.Validate(w))
+	assert.Equal("json", w.Config.ContentType)
+	assert.Equal([]string{"device-status.*", "iot"}, w.Events)
+	assert.Equal([]string{"mac:.*"}, w.Matcher.DeviceId)
+
+	w.Events = []string{"device-status(.*"}
+	assert.Error(validator.Validate(w))
+
+	w.Events = []string{"iot", "  "}
+	assert.Equal(ErrEmptyPattern, validator.Validate(w))
+
+	w.Events = nil
+	assert.Error(validator.Validate(w))
+
+	w.Events = []string{"iot"}
+	w.Matcher.DeviceId = []string{"mac:[0-9"}
+	assert.Error(validator.Validate(w))
+}
+
+func TestValidatorDuration(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		require   = require.New(t)
+		now       = time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+		validator = NewValidator(&ValidationOptions{
+			AllowPrivate: true,
+			MaxDuration:  time.Minute,
+			Now:          func() time.Time { return now },
+		})
+	)
+
+	w := newValidationHook("https://127.0.0.1/hook")
+	require.NoError(validator.Validate(w))
+	assert.Equal(time.Minute, w.Duration)
+	assert.Equal(now.Add(time.Minute), w.Until)
+
+	w = newValidationHook("https://127.0.0.1/hook")
+	w.Duration = 30 * time.Second
+	w.Until = now.Add(10 * time.Second)
+	require.NoError(validator.Validate(w))
+	assert.Equal(30*time.Second, w.Duration)
+	assert.Equal(now.Add(10*time.Second), w.Until)
+
+	// an explicit expiration cannot be used to outlive the maximum duration
+	w = newValidationHook("https://127.0.0.1/hook")
+	w.Duration = time.Hour
+	w.Until = now.Add(365 * 24 * time.Hour)
+	require.NoError(validator.Validate(w))
+	assert.Equal(time.Minute, w.Duration)
+	assert.Equal(now.Add(time.Minute), w.Until)
+}
+
+func TestValidatorExpired(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		now       = time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+		validator = NewValidator(&ValidationOptions{
+			AllowPrivate: true,
+			MaxDuration:  time.Minute,
+			Now:          func() time.Time { return now },
+		})
+	)
+
+	w := newValidationHook("https://127.0.0.1/hook")
+	w.Until = now.Add(-time.Second)
+	assert.Equal(ErrWebhookExpired, validator.Validate(w))
+	assert.Equal(httperror.WebhookExpired, httperror.KindOf(validator.Validate(w)))
+
+	w.Until = now
+	assert.Equal(ErrWebhookExpired, validator.Validate(w))
+}
+
+func TestValidatorDialContext(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		server  = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.WriteHeader(http.StatusAccepted)
+		}))
+	)
+
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(err)
+
+	// the host was public when registered, but now resolves to the loopback test server
+	rebound := "http://rebound.example.com:" + serverURL.Port() + "/hook"
+	resolver := testResolver(map[string][]string{"rebound.example.com": {serverURL.Hostname()}})
+
+	validator := NewValidator(&ValidationOptions{AllowHTTP: true, Resolver: resolver})
+	conn, err := validator.DialContext(context.Background(), "tcp", serverURL.Host)
+	assert.Nil(conn)
+	assert.Equal(ErrPrivateAddress, err)
+
+	client := &http.Client{Transport: validator.NewTransport()}
+	response, err := client.Get(rebound)
+	assert.Nil(response)
+	assert.Error(err)
+
+	validator = NewValidator(&ValidationOptions{AllowHTTP: true, AllowPrivate: true, Resolver: resolver})
+	client = &http.Client{Transport: validator.NewTransport()}
+	response, err = client.Get(server.URL)
+	require.NoError(err)
+	response.Body.Close()
+	assert.Equal(http.StatusAccepted, response.StatusCode)
+
+	conn, err = NewValidator(&ValidationOptions{Resolver: resolver}).DialContext(context.Background(), "tcp", "nosuch.example.com:80")
+	assert.Nil(conn)
+	assert.Error(err)
+}
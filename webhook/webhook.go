@@ -6,6 +6,8 @@ import (
 	"net"
 	"sync/atomic"
 	"time"
+
+	"github.com/Comcast/webpa-common/clock"
 )
 
 const (
@@ -34,6 +36,22 @@ type W struct {
 		// The secret to use for the SHA1 HMAC.
 		// Optional, set to "" to disable behavior.
 		Secret string `json:"secret,omitempty"`
+
+		// The maximum size, in bytes, of event payloads delivered to this webhook.
+		// Optional, set to 0 to disable behavior.
+		MaxPayloadSize int `json:"max_payload_size,omitempty"`
+
+		// What to do with events whose payloads exceed MaxPayloadSize.
+		// Optional, defaults to PayloadReject.
+		PayloadPolicy PayloadPolicy `json:"payload_policy,omitempty"`
+
+		// The encodings accepted for delivered events, in the form of an Accept-Encoding header, e.g. "gzip".
+		// Optional, set to "" to disable compression unless the receiver advertises it in its responses.
+		AcceptEncoding string `json:"accept_encoding,omitempty"`
+
+		// How events are encoded for delivery:  DeliverRaw, DeliverMsgpack, or DeliverJSON.
+		// Optional, defaults to DeliverRaw.
+		DeliveryFormat DeliveryFormat `json:"delivery_format,omitempty"`
 	} `json:"config"`
 
 	// The URL to notify when we cut off a client due to overflow.
@@ -49,6 +67,10 @@ type W struct {
 		DeviceId []string `json:"device_id"`
 	} `json:"matcher,omitempty"`
 
+	// The partners, i.e. tenants, whose events are delivered to this hook.
+	// Optional, set to nil to receive the events of every partner.
+	PartnerIDs []string `json:"partner_ids,omitempty"`
+
 	// The specified duration for this hook to live
 	Duration time.Duration `json:"duration"`
 
@@ -57,9 +79,18 @@ type W struct {
 
 	// The address that performed the registration
 	Address string `json:"registered_from_address"`
+
+	// The principal whose credentials performed the registration.  Only the owner may
+	// replace or delete this hook.  Empty for hooks registered without credentials.
+	Owner string `json:"owner,omitempty"`
 }
 
 func NewW(jsonString []byte, ip string) (w *W, err error) {
+	return newW(jsonString, ip, clock.System().Now())
+}
+
+// newW is NewW with the current time supplied, which is used to compute Until when it is not set
+func newW(jsonString []byte, ip string, now time.Time) (w *W, err error) {
 	w = new(W)
 
 	err = json.Unmarshal(jsonString, w)
@@ -73,14 +104,14 @@ func NewW(jsonString []byte, ip string) (w *W, err error) {
 		w = &wa[0]
 	}
 
-	err = w.sanitize(ip)
+	err = w.sanitize(ip, now)
 	if nil != err {
 		w = nil
 	}
 	return
 }
 
-func (w *W) sanitize(ip string) (err error) {
+func (w *W) sanitize(ip string, now time.Time) (err error) {
 
 	if "" == w.Config.URL {
 		err = errors.New("invalid Config URL")
@@ -94,6 +125,14 @@ func (w *W) sanitize(ip string) (err error) {
 
 	// TODO Validate content type ?  What about different types?
 
+	if err = w.validatePayloadLimits(); err != nil {
+		return
+	}
+
+	if err = w.validateDeliveryFormat(); err != nil {
+		return
+	}
+
 	if 0 == len(w.Matcher.DeviceId) {
 		w.Matcher.DeviceId = []string{".*"} // match anything
 	}
@@ -113,7 +152,7 @@ func (w *W) sanitize(ip string) (err error) {
 	}
 
 	if &w.Until == nil || w.Until.Equal(time.Time{}) {
-		w.Until = time.Now().Add(w.Duration)
+		w.Until = now.Add(w.Duration)
 	}
 
 	return
@@ -144,6 +183,7 @@ type UpdatableList interface {
 
 type updatableList struct {
 	value atomic.Value
+	clock clock.Interface
 }
 
 func (ul *updatableList) set(list []W) {
@@ -169,41 +209,46 @@ func (ul *updatableList) Get(index int) *W {
 	return nil
 }
 
+// replaces tests if this hook may replace an existing hook with the same ID.  A hook which has an owner
+// can only be replaced by its owner, which holds on every instance no matter the order in which
+// registrations arrive.
+func (w *W) replaces(existing *W) bool {
+	return len(existing.Owner) == 0 || existing.Owner == w.Owner
+}
+
+// Update applies each new item in turn.  An item which has not expired replaces the existing item with the
+// same ID, or is added if there is none.  An item which has already expired, such as a deleted hook, removes
+// the existing item.  In either case, an item owned by another principal is left as it is.  The stored list
+// is never modified in place, since readers may be holding items obtained via Get.
 func (ul *updatableList) Update(newItems []W) {
 	for _, newItem := range newItems {
-		found := false
-		var items []*W
-		for i := 0; i < ul.Len(); i++ {
-			items = append(items, ul.Get(i))
-		}
-
-		// we want to add items that will expire in the future
-		if newItem.Until.After(time.Now()) {
-			for i := 0; i < len(items) && !found; i++ {
-				if items[i].ID() == newItem.ID() {
-					found = true
-
-					items[i].Matcher = newItem.Matcher
-					items[i].Events = newItem.Events
-					items[i].Config.ContentType = newItem.Config.ContentType
-					items[i].Config.Secret = newItem.Config.Secret
-					items[i].Until = newItem.Until
-				}
+		var (
+			list, _   = ul.value.Load().([]W)
+			itemsCopy = make([]W, 0, len(list)+1)
+			found     = false
+			live      = newItem.Until.After(ul.clock.Now())
+		)
+
+		for i := range list {
+			if list[i].ID() != newItem.ID() {
+				itemsCopy = append(itemsCopy, list[i])
+				continue
 			}
 
-			// add item
-			if !found {
-				items = append(items, &newItem)
-			}
-
-			var itemsCopy []W
-			for _, i := range items {
-				itemsCopy = append(itemsCopy, *i)
+			found = true
+			if !newItem.replaces(&list[i]) {
+				// a registration by another principal, which was accepted before this hook was known
+				itemsCopy = append(itemsCopy, list[i])
+			} else if live {
+				itemsCopy = append(itemsCopy, newItem)
 			}
+		}
 
-			// store items
-			ul.set(itemsCopy)
+		if !found && live {
+			itemsCopy = append(itemsCopy, newItem)
 		}
+
+		ul.set(itemsCopy)
 	}
 }
 
@@ -221,7 +266,12 @@ func (ul *updatableList) Filter(filter func([]W) []W) {
 // NewList just creates an UpdatableList.  Don't forget:
 // NewList(nil) is valid!
 func NewList(initial []W) UpdatableList {
-	ul := &updatableList{}
+	return newList(initial, clock.System())
+}
+
+// newList creates an UpdatableList which uses the given clock to decide whether updates have expired
+func newList(initial []W, c clock.Interface) UpdatableList {
+	ul := &updatableList{clock: c}
 	ul.Update(initial)
 	return ul
 }
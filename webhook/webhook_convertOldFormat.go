@@ -38,17 +38,17 @@ type oldW struct {
 	Address string `json:"registered_from_address"`
 }
 
-func doOldHookConvert(jsonString []byte) (w *W, err error) {
+func doOldHookConvert(jsonString []byte, now time.Time) (w *W, err error) {
 	old := new(oldW)
 	err = json.Unmarshal(jsonString, old)
 	if err != nil {
 		return
 	}
 
-	return oldToNewHookConversion(old)
+	return oldToNewHookConversion(old, now)
 }
 
-func oldToNewHookConversion(old *oldW) (w *W, err error) {
+func oldToNewHookConversion(old *oldW, now time.Time) (w *W, err error) {
 	w = new(W)
 	w.Config.URL = old.Config.URL
 	w.Config.ContentType = old.Config.ContentType
@@ -67,7 +67,7 @@ func oldToNewHookConversion(old *oldW) (w *W, err error) {
 		w.Until = time.Unix(old.Until, 0)
 	}
 
-	err = w.sanitize("")
+	err = w.sanitize("", now)
 	if nil != err {
 		w = nil
 	}
@@ -75,7 +75,7 @@ func oldToNewHookConversion(old *oldW) (w *W, err error) {
 	return
 }
 
-func convertOldHooksToNewHooks(body []byte) (hooks []W, err error) {
+func convertOldHooksToNewHooks(body []byte, now time.Time) (hooks []W, err error) {
 	var oldHooks []oldW
 	err = json.Unmarshal(body, &oldHooks)
 	if err != nil {
@@ -84,7 +84,7 @@ func convertOldHooksToNewHooks(body []byte) (hooks []W, err error) {
 
 	for _, oldHook := range oldHooks {
 		var old *W
-		old, err = oldToNewHookConversion(&oldHook)
+		old, err = oldToNewHookConversion(&oldHook, now)
 		if nil != err {
 			hooks = nil
 			return
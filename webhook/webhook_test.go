@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock/clocktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUpdate(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		original = testAPIHook("https://receiver.example.com/hook", "alice", "iot")
+		list     = NewList([]W{original})
+		held     = list.Get(0)
+	)
+
+	// an update replaces every field of the existing hook
+	updated := testAPIHook("https://receiver.example.com/hook", "alice", "online")
+	updated.Config.AcceptEncoding = "gzip"
+	updated.Config.DeliveryFormat = DeliverJSON
+	list.Update([]W{updated})
+
+	require.Equal(1, list.Len())
+	assert.Equal(updated, *list.Get(0))
+
+	// items already obtained from the list are never modified
+	assert.Equal(original, *held)
+
+	expired := updated
+	expired.Until = time.Now().Add(-time.Hour)
+	list.Update([]W{expired})
+	assert.Zero(list.Len())
+}
+
+func TestListUpdateClock(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now   = time.Date(2017, time.June, 1, 0, 0, 0, 0, time.UTC)
+		clock = clocktest.NewClock(now)
+		list  = newList(nil, clock)
+
+		hook = testAPIHook("https://receiver.example.com/hook", "alice", "iot")
+	)
+
+	// expiry is judged by the list's clock, not the system clock
+	hook.Until = now.Add(time.Minute)
+	list.Update([]W{hook})
+	require.Equal(1, list.Len())
+
+	clock.Add(2 * time.Minute)
+	list.Update([]W{hook})
+	assert.Zero(list.Len())
+}
+
+func TestNewWUntil(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now = time.Date(2017, time.June, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	w, err := newW([]byte(`{"config": {"url": "https://receiver.example.com/hook"}, "events": ["iot"], "duration": 60000000000}`), "", now)
+	require.NoError(err)
+	require.NotNil(w)
+	assert.Equal(now.Add(time.Minute), w.Until)
+}
@@ -0,0 +1,9 @@
+/*
+Package webhooktest provides an in-memory harness for testing the webhook registration and delivery pipeline.
+
+A fake SNS implements the AWS SNS API over HTTP, so a real aws.SNSServer can subscribe, confirm, publish,
+and receive notifications without AWS credentials or network access.  A Harness wires that fake into a
+webhook Factory and registry served by a test server, and Receivers act as scriptable webhook endpoints
+whose latency and failure rate can be controlled by tests.
+*/
+package webhooktest
@@ -0,0 +1,385 @@
+package webhooktest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/webhook"
+	AWS "github.com/Comcast/webpa-common/webhook/aws"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// RegistrationPath is the path of the harness endpoint which accepts webhook registrations
+	RegistrationPath = "/hook"
+
+	// HooksPath is the path of the harness endpoint which returns all registered webhooks
+	HooksPath = "/hooks"
+
+	// readyTimeout is how long NewHarness waits for the SNS subscription to be confirmed
+	readyTimeout = 5 * time.Second
+)
+
+var (
+	ErrorHookTimeout = errors.New("Timed out waiting for webhook")
+	ErrorNotReady    = errors.New("Timed out waiting for the SNS subscription to be confirmed")
+)
+
+// Options configures a Harness
+type Options struct {
+	// Logger is used by the SNS server and prober.  If not supplied, logging.DefaultLogger() is used.
+	Logger logging.Logger
+
+	// Client is used for registrations, SNS messages, and deliveries.  If not supplied, a client with a 5 second timeout is used.
+	Client *http.Client
+
+	// Probe configures the harness Prober.  If not supplied, the webhook package defaults are used with
+	// the harness Client and Logger.
+	Probe *webhook.ProbeOptions
+
+	// Compression configures the compression of deliveries.  If not supplied, the webhook package defaults are used.
+	Compression *webhook.CompressionOptions
+
+	// Signer signs deliveries to webhooks with secrets.  If not supplied, webhook.SecretSigner is used.
+	Signer webhook.Signer
+
+	// Validation configures the validation of registrations.  If not supplied, http URLs and private
+	// addresses are allowed, since Receivers are local httptest servers.
+	Validation *webhook.ValidationOptions
+}
+
+func (o *Options) logger() logging.Logger {
+	if o != nil && o.Logger != nil {
+		return o.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+func (o *Options) client() *http.Client {
+	if o != nil && o.Client != nil {
+		return o.Client
+	}
+
+	return &http.Client{Timeout: 5 * time.Second}
+}
+
+func (o *Options) probe() *webhook.ProbeOptions {
+	if o != nil && o.Probe != nil {
+		return o.Probe
+	}
+
+	return new(webhook.ProbeOptions)
+}
+
+func (o *Options) signer() webhook.Signer {
+	if o != nil && o.Signer != nil {
+		return o.Signer
+	}
+
+	return webhook.SecretSigner{}
+}
+
+func (o *Options) validation() *webhook.ValidationOptions {
+	if o != nil && o.Validation != nil {
+		return o.Validation
+	}
+
+	return &webhook.ValidationOptions{AllowHTTP: true, AllowPrivate: true}
+}
+
+func (o *Options) compression() *webhook.CompressionOptions {
+	if o != nil {
+		return o.Compression
+	}
+
+	return nil
+}
+
+// Harness runs the complete webhook registration pipeline in memory.  Registrations posted to the harness
+// are published through a real SNSServer to a fake SNS, which delivers them back to the harness where they
+// update List.  Deliver then sends events to the registered webhooks, typically Receivers.
+type Harness struct {
+	// SNS is the fake AWS SNS service used by Notifier
+	SNS *SNS
+
+	// Notifier is the SNS server which publishes and receives webhook registrations
+	Notifier *AWS.SNSServer
+
+	// Factory is the webhook Factory used to create the registry
+	Factory *webhook.Factory
+
+	// Registry is the registration API served by the harness
+	Registry webhook.Registry
+
+	// List holds the webhooks received from SNS
+	List webhook.UpdatableList
+
+	// Prober probes the webhooks in List.  Deliver skips webhooks which it has suspended.
+	Prober *webhook.Prober
+
+	// Compressor compresses deliveries to the webhooks which accept gzip
+	Compressor *webhook.Compressor
+
+	// Transcoder produces each delivery in the webhook's DeliveryFormat
+	Transcoder *webhook.Transcoder
+
+	// Signer signs deliveries to webhooks with secrets
+	Signer webhook.Signer
+
+	client *http.Client
+	server *httptest.Server
+}
+
+// NewHarness creates and starts a Harness.  When this function returns, the harness is subscribed to
+// the fake SNS and ready for registrations.
+func NewHarness(o *Options) (*Harness, error) {
+	factory, err := webhook.NewFactory(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := AWS.NewAWSConfig(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		client = o.client()
+		logger = o.logger()
+		h      = &Harness{
+			SNS:     NewSNS(client),
+			Factory: factory,
+			List:    webhook.NewList(nil),
+			client:  client,
+		}
+	)
+
+	h.Notifier = &AWS.SNSServer{
+		Config:       *config,
+		SVC:          h.SNS,
+		SNSValidator: AcceptValidator{},
+	}
+
+	factory.Notifier = h.Notifier
+	factory.Validation = o.validation()
+	registry, handler := factory.NewRegistryAndHandler()
+	factory.SetList(h.List)
+	h.Registry = registry
+
+	probe := *o.probe()
+	if probe.Client == nil {
+		probe.Client = client
+	}
+
+	if probe.Logger == nil {
+		probe.Logger = logger
+	}
+
+	h.Prober = webhook.NewProber(h.List, &probe)
+	h.Compressor = webhook.NewCompressor(o.compression())
+	h.Transcoder = webhook.NewTranscoder(nil)
+	h.Signer = o.signer()
+
+	router := mux.NewRouter()
+	router.HandleFunc(RegistrationPath, h.Registry.UpdateRegistry).Methods("POST")
+	router.HandleFunc(HooksPath, h.Registry.GetRegistry).Methods("GET")
+	h.server = httptest.NewServer(router)
+
+	selfURL, err := url.Parse(h.server.URL)
+	if err != nil {
+		h.server.Close()
+		return nil, err
+	}
+
+	h.Notifier.Initialize(router, selfURL, handler, logger)
+	h.Notifier.PrepareAndStart()
+	if err := h.SNS.ConfirmAll(); err != nil {
+		h.server.Close()
+		return nil, err
+	}
+
+	select {
+	case <-h.Notifier.Ready():
+	case <-time.After(readyTimeout):
+		h.Notifier.Unsubscribe()
+		h.server.Close()
+		return nil, ErrorNotReady
+	}
+
+	return h, nil
+}
+
+// URL returns the base URL of the harness server
+func (h *Harness) URL() string {
+	return h.server.URL
+}
+
+// Close shuts down the harness server
+func (h *Harness) Close() {
+	h.server.Close()
+}
+
+// Register posts a webhook registration to the harness, just as an external client would
+func (h *Harness) Register(w webhook.W) error {
+	body, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	response, err := h.client.Post(h.server.URL+RegistrationPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Registration returned status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// WaitForHook blocks until a webhook with the given ID appears in List.  Since registrations are
+// delivered through SNS, a webhook is not available immediately after Register returns.
+func (h *Harness) WaitForHook(id string, timeout time.Duration) (*webhook.W, error) {
+	expired := time.After(timeout)
+	for {
+		for i := 0; i < h.List.Len(); i++ {
+			if w := h.List.Get(i); w.ID() == id {
+				return w, nil
+			}
+		}
+
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-expired:
+			return nil, ErrorHookTimeout
+		}
+	}
+}
+
+// Deliver sends an event to each registered webhook whose event and device id expressions match, skipping
+// webhooks that Prober has suspended.  The event is a WRP SimpleEvent from the device, whose Destination is the
+// event name.  Webhooks may match either the event name or its type, as classified by webhook.NewEvent,
+// e.g. "device-online".  Each webhook's payload limits are applied, the event is produced in the webhook's DeliveryFormat,
+// the body is compressed if the webhook accepts gzip and, if the webhook has a secret, the request is signed.
+// This function returns the number of successful deliveries along with the first error encountered, if any.
+//
+// The event comes from a device without a partner, so webhooks restricted to partners never receive it.
+// Use DeliverContext to deliver the events of a partner's devices.
+func (h *Harness) Deliver(event, deviceID string, payload []byte) (int, error) {
+	return h.DeliverContext(context.Background(), event, deviceID, "", payload)
+}
+
+// DeliverContext is like Deliver, except that each delivery is made with the given Context and the event comes
+// from a device of the given partner, which may be empty.  Each delivery is traced via webhook.StartDelivery,
+// as a child of any trace context carried by the Context.
+func (h *Harness) DeliverContext(ctx context.Context, event, deviceID, partnerID string, payload []byte) (delivered int, err error) {
+	message := &wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      deviceID,
+		Destination: webhook.EventScheme + event,
+		Payload:     payload,
+	}
+
+	wrp.SetPartnerID(message, partnerID)
+	e, err := webhook.NewEvent(message)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < h.List.Len(); i++ {
+		w := h.List.Get(i)
+		if !w.Matches(e) || h.Prober.Suspended(w.ID()) {
+			continue
+		}
+
+		if deliverErr := h.deliver(ctx, w, event, message); deliverErr != nil {
+			if err == nil {
+				err = deliverErr
+			}
+
+			continue
+		}
+
+		delivered++
+	}
+
+	return
+}
+
+func (h *Harness) deliver(ctx context.Context, w *webhook.W, event string, message *wrp.Message) error {
+	limited, err := w.LimitPayload(message.Payload, nil)
+	if err != nil {
+		return err
+	}
+
+	limitedMessage := *message
+	limitedMessage.Payload = limited.Body
+	delivery, err := h.Transcoder.Transcode(w, &limitedMessage)
+	if err != nil {
+		return err
+	}
+
+	body, encoding, err := h.Compressor.Compress(w, delivery.Body)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, w.Config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for name, values := range delivery.Header {
+		request.Header[name] = values
+	}
+
+	if contentType := request.Header.Get(webhook.ContentTypeHeader); len(contentType) > 0 && !strings.Contains(contentType, "/") {
+		request.Header.Set(webhook.ContentTypeHeader, "application/"+contentType)
+	}
+
+	request.Header.Set(webhook.EventHeader, event)
+	if len(w.Config.Secret) > 0 {
+		signature, err := h.Signer.Sign(w, body)
+		if err != nil {
+			return err
+		}
+
+		request.Header.Set(webhook.SignatureHeader, signature)
+	}
+
+	if len(encoding) > 0 {
+		request.Header.Set(webhook.ContentEncodingHeader, encoding)
+	}
+
+	for name, value := range limited.Headers() {
+		request.Header.Set(name, value)
+	}
+
+	request = request.WithContext(ctx)
+	span := webhook.StartDelivery(w, request)
+	response, err := h.client.Do(request)
+	webhook.FinishDelivery(span, response, err)
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+	h.Compressor.Observe(w, response)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("Delivery to %s returned status %d", w.Config.URL, response.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,462 @@
+package webhooktest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/Comcast/webpa-common/secure/key"
+	"github.com/Comcast/webpa-common/tracing"
+	"github.com/Comcast/webpa-common/tracing/tracingtest"
+	"github.com/Comcast/webpa-common/webhook"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestHarness(t *testing.T, o *Options) *Harness {
+	if o == nil {
+		o = new(Options)
+	}
+
+	o.Logger = &logging.LoggerWriter{Writer: ioutil.Discard}
+	h, err := NewHarness(o)
+	require.NoError(t, err)
+	require.NotNil(t, h)
+	return h
+}
+
+func newTestHook(url string, events ...string) webhook.W {
+	var w webhook.W
+	w.Config.URL = url
+	w.Config.ContentType = "json"
+	w.Config.Secret = "secret"
+	w.Events = events
+	return w
+}
+
+func TestHarnessOptionsDefaults(t *testing.T) {
+	assert := assert.New(t)
+	for _, o := range []*Options{nil, new(Options)} {
+		assert.NotNil(o.logger())
+		assert.NotNil(o.client())
+		assert.NotNil(o.probe())
+		assert.Equal(webhook.SecretSigner{}, o.signer())
+		assert.Equal(&webhook.ValidationOptions{AllowHTTP: true, AllowPrivate: true}, o.validation())
+	}
+}
+
+func TestHarnessValidation(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		h        = newTestHarness(t, &Options{Validation: new(webhook.ValidationOptions)})
+		receiver = NewReceiver(1)
+	)
+
+	defer h.Close()
+	defer receiver.Close()
+
+	// strict validation rejects the insecure, loopback receiver before it is published
+	assert.Error(h.Register(newTestHook(receiver.URL(), ".*")))
+	assert.Error(h.Register(newTestHook(strings.Replace(receiver.URL(), "http:", "https:", 1), ".*")))
+	assert.Empty(h.SNS.Published())
+}
+
+func TestHarnessRegistrationToDelivery(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		h        = newTestHarness(t, nil)
+		receiver = NewReceiver(1)
+		other    = NewReceiver(2)
+	)
+
+	defer h.Close()
+	defer receiver.Close()
+	defer other.Close()
+
+	total, confirmed := h.SNS.Subscriptions()
+	assert.Equal(1, total)
+	assert.Equal(1, confirmed)
+
+	require.NoError(h.Register(newTestHook(receiver.URL(), "device-status.*")))
+	require.NoError(h.Register(newTestHook(other.URL(), "iot")))
+
+	w, err := h.WaitForHook(receiver.URL(), 5*time.Second)
+	require.NoError(err)
+	assert.Equal([]string{"device-status.*"}, w.Events)
+	_, err = h.WaitForHook(other.URL(), 5*time.Second)
+	require.NoError(err)
+
+	// each registration went through SNS
+	assert.Len(h.SNS.Published(), 2)
+
+	// the registry API reports both hooks
+	response, err := http.Get(h.URL() + HooksPath)
+	require.NoError(err)
+	var hooks []webhook.W
+	require.NoError(json.NewDecoder(response.Body).Decode(&hooks))
+	response.Body.Close()
+	assert.Len(hooks, 2)
+
+	delivered, err := h.Deliver("device-status/mac:112233445566/online", "mac:112233445566", []byte(`{"online":true}`))
+	assert.Equal(1, delivered)
+	assert.NoError(err)
+
+	requests, err := receiver.Wait(1, time.Second)
+	require.NoError(err)
+	assert.Equal(`{"online":true}`, string(requests[0].Body))
+	assert.Equal("device-status/mac:112233445566/online", requests[0].Event())
+	assert.Equal("application/json", requests[0].Header.Get("Content-Type"))
+	assert.True(requests[0].Verify("secret"))
+	assert.Empty(other.Requests())
+}
+
+func TestHarnessDeliverEventType(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		h        = newTestHarness(t, nil)
+		receiver = NewReceiver(1)
+	)
+
+	defer h.Close()
+	defer receiver.Close()
+
+	require.NoError(h.Register(newTestHook(receiver.URL(), string(webhook.DeviceOfflineEvent))))
+	_, err := h.WaitForHook(receiver.URL(), 5*time.Second)
+	require.NoError(err)
+
+	// the hook matches the type of the event rather than its name
+	delivered, err := h.Deliver("device-status/mac:112233445566/online", "mac:112233445566", []byte(`{"online":true}`))
+	assert.Equal(0, delivered)
+	assert.NoError(err)
+
+	delivered, err = h.Deliver("device-status/mac:112233445566/offline", "mac:112233445566", []byte(`{"online":false}`))
+	assert.Equal(1, delivered)
+	assert.NoError(err)
+
+	requests, err := receiver.Wait(1, time.Second)
+	require.NoError(err)
+	assert.Equal("device-status/mac:112233445566/offline", requests[0].Event())
+
+	delivered, err = h.Deliver("", "mac:112233445566", nil)
+	assert.Equal(0, delivered)
+	assert.Equal(webhook.ErrNotAnEvent, err)
+}
+
+func TestHarnessFailureInjection(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		h        = newTestHarness(t, nil)
+		receiver = NewReceiver(1)
+	)
+
+	defer h.Close()
+	defer receiver.Close()
+
+	require.NoError(h.Register(newTestHook(receiver.URL(), ".*")))
+	_, err := h.WaitForHook(receiver.URL(), 5*time.Second)
+	require.NoError(err)
+
+	receiver.SetFailureRate(1.0, http.StatusBadGateway)
+	delivered, err := h.Deliver("test", "mac:112233445566", []byte("payload"))
+	assert.Equal(0, delivered)
+	assert.Error(err)
+
+	receiver.SetFailureRate(0.0, http.StatusBadGateway)
+	delivered, err = h.Deliver("test", "mac:112233445566", []byte("payload"))
+	assert.Equal(1, delivered)
+	assert.NoError(err)
+
+	requests := receiver.Requests()
+	require.Len(requests, 2)
+	assert.Equal(http.StatusBadGateway, requests[0].Status)
+	assert.Equal(http.StatusOK, requests[1].Status)
+}
+
+func TestHarnessPayloadLimits(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		h        = newTestHarness(t, nil)
+		receiver = NewReceiver(1)
+		w        = newTestHook(receiver.URL(), ".*")
+	)
+
+	defer h.Close()
+	defer receiver.Close()
+
+	w.Config.MaxPayloadSize = 4
+	w.Config.PayloadPolicy = webhook.PayloadTruncate
+	require.NoError(h.Register(w))
+	_, err := h.WaitForHook(receiver.URL(), 5*time.Second)
+	require.NoError(err)
+
+	delivered, err := h.Deliver("test", "mac:112233445566", []byte("too large"))
+	assert.Equal(1, delivered)
+	assert.NoError(err)
+
+	requests, err := receiver.Wait(1, time.Second)
+	require.NoError(err)
+	assert.Equal("too ", string(requests[0].Body))
+	assert.Equal("true", requests[0].Header.Get(webhook.PayloadTruncatedHeader))
+	assert.Equal("9", requests[0].Header.Get(webhook.PayloadSizeHeader))
+	assert.True(requests[0].Verify("secret"))
+}
+
+func TestHarnessSuspension(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		h        = newTestHarness(t, &Options{Probe: &webhook.ProbeOptions{SuspendAfter: 2, ResumeAfter: 1}})
+		receiver = NewReceiver(1)
+		failure  = NewReceiver(2)
+		w        = newTestHook(receiver.URL(), ".*")
+	)
+
+	defer h.Close()
+	defer receiver.Close()
+	defer failure.Close()
+
+	w.FailureURL = failure.URL()
+	require.NoError(h.Register(w))
+	_, err := h.WaitForHook(receiver.URL(), 5*time.Second)
+	require.NoError(err)
+
+	receiver.SetFailureRate(1.0, http.StatusServiceUnavailable)
+	h.Prober.ProbeAll()
+	assert.False(h.Prober.Suspended(receiver.URL()))
+	h.Prober.ProbeAll()
+	assert.True(h.Prober.Suspended(receiver.URL()))
+
+	requests, err := failure.Wait(1, time.Second)
+	require.NoError(err)
+	assert.Equal(webhook.SuspendedEvent, requests[0].Event())
+	assert.True(requests[0].Verify("secret"))
+
+	// suspended webhooks are skipped
+	receiver.SetFailureRate(0.0, http.StatusServiceUnavailable)
+	delivered, err := h.Deliver("test", "mac:112233445566", []byte("payload"))
+	assert.Equal(0, delivered)
+	assert.NoError(err)
+	assert.Len(receiver.Requests(), 2)
+
+	h.Prober.ProbeAll()
+	assert.False(h.Prober.Suspended(receiver.URL()))
+	requests, err = failure.Wait(2, time.Second)
+	require.NoError(err)
+	assert.Equal(webhook.ResumedEvent, requests[1].Event())
+
+	delivered, err = h.Deliver("test", "mac:112233445566", []byte("payload"))
+	assert.Equal(1, delivered)
+	assert.NoError(err)
+}
+
+func TestHarnessCompression(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		h        = newTestHarness(t, &Options{Compression: &webhook.CompressionOptions{MinSize: 16}})
+		receiver = NewReceiver(1)
+		w        = newTestHook(receiver.URL(), ".*")
+		payload  = []byte(strings.Repeat(`{"online":true}`, 10))
+	)
+
+	defer h.Close()
+	defer receiver.Close()
+
+	w.Config.AcceptEncoding = "gzip"
+	require.NoError(h.Register(w))
+	_, err := h.WaitForHook(receiver.URL(), 5*time.Second)
+	require.NoError(err)
+
+	delivered, err := h.Deliver("test", "mac:112233445566", payload)
+	assert.Equal(1, delivered)
+	assert.NoError(err)
+
+	requests, err := receiver.Wait(1, time.Second)
+	require.NoError(err)
+	assert.Equal(webhook.GzipEncoding, requests[0].Header.Get(webhook.ContentEncodingHeader))
+	assert.True(len(requests[0].Body) < len(payload))
+	assert.True(requests[0].Verify("secret"))
+
+	decompressed, err := requests[0].Payload()
+	require.NoError(err)
+	assert.Equal(payload, decompressed)
+
+	// the receiver turns compression off in its responses, without reregistering
+	receiver.SetAcceptEncoding("identity")
+	delivered, err = h.Deliver("test", "mac:112233445566", payload)
+	assert.Equal(1, delivered)
+	assert.NoError(err)
+
+	delivered, err = h.Deliver("test", "mac:112233445566", payload)
+	assert.Equal(1, delivered)
+	assert.NoError(err)
+
+	requests, err = receiver.Wait(3, time.Second)
+	require.NoError(err)
+	assert.Equal(webhook.GzipEncoding, requests[1].Header.Get(webhook.ContentEncodingHeader))
+	assert.Empty(requests[2].Header.Get(webhook.ContentEncodingHeader))
+	assert.Equal(payload, requests[2].Body)
+	assert.True(requests[2].Verify("secret"))
+}
+
+func TestHarnessDeliveryFormat(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		h        = newTestHarness(t, nil)
+		raw      = NewReceiver(1)
+		encoded  = NewReceiver(2)
+		jsonHook = newTestHook(encoded.URL(), "iot")
+	)
+
+	defer h.Close()
+	defer raw.Close()
+	defer encoded.Close()
+
+	jsonHook.Config.DeliveryFormat = webhook.DeliverJSON
+	require.NoError(h.Register(newTestHook(raw.URL(), "iot")))
+	require.NoError(h.Register(jsonHook))
+	_, err := h.WaitForHook(raw.URL(), 5*time.Second)
+	require.NoError(err)
+	_, err = h.WaitForHook(encoded.URL(), 5*time.Second)
+	require.NoError(err)
+
+	delivered, err := h.Deliver("iot", "mac:112233445566", []byte(`{"temperature":21}`))
+	assert.Equal(2, delivered)
+	assert.NoError(err)
+
+	// the raw format delivers the payload, with the other WRP fields as headers
+	requests, err := raw.Wait(1, time.Second)
+	require.NoError(err)
+	assert.Equal(`{"temperature":21}`, string(requests[0].Body))
+	assert.Equal("application/json", requests[0].Header.Get(webhook.ContentTypeHeader))
+	assert.Equal("event:iot", requests[0].Header.Get(webhook.DestinationHeader))
+
+	// the JSON format delivers the complete event, signed as transmitted
+	requests, err = encoded.Wait(1, time.Second)
+	require.NoError(err)
+	assert.Equal(wrp.JSON.ContentType(), requests[0].Header.Get(webhook.ContentTypeHeader))
+	assert.True(requests[0].Verify("secret"))
+
+	var message wrp.Message
+	require.NoError(wrp.NewDecoderBytes(requests[0].Body, wrp.JSON).Decode(&message))
+	assert.Equal(wrp.SimpleEventMessageType, message.Type)
+	assert.Equal("mac:112233445566", message.Source)
+	assert.Equal("event:iot", message.Destination)
+	assert.Equal(`{"temperature":21}`, string(message.Payload))
+}
+
+func TestHarnessSigner(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		module  = new(key.SoftwareModule)
+
+		// registrations through the harness carry no credentials, so the hook has no owner
+		h = newTestHarness(t, &Options{
+			Signer: webhook.ModuleSigner{Module: module, Labels: map[string]string{"": "receiver-key"}},
+		})
+
+		receiver = NewReceiver(1)
+		w        = newTestHook(receiver.URL(), ".*")
+	)
+
+	defer h.Close()
+	defer receiver.Close()
+
+	// the key is chosen by the server, whatever the registration's secret says
+	module.AddSecret("receiver-key", []byte("secret"))
+	module.AddSecret("other-key", []byte("other"))
+	w.Config.Secret = "other-key"
+	require.NoError(h.Register(w))
+	_, err := h.WaitForHook(receiver.URL(), 5*time.Second)
+	require.NoError(err)
+
+	delivered, err := h.Deliver("test", "mac:112233445566", []byte(`{"online":true}`))
+	assert.Equal(1, delivered)
+	assert.NoError(err)
+
+	requests, err := receiver.Wait(1, time.Second)
+	require.NoError(err)
+	assert.True(requests[0].Verify("secret"))
+	assert.False(requests[0].Verify("other"))
+}
+
+func TestHarnessDeliverContext(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		tracer   = tracingtest.NewTracer()
+		remote   = tracing.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}
+		h        = newTestHarness(t, nil)
+		receiver = NewReceiver(1)
+	)
+
+	defer h.Close()
+	defer receiver.Close()
+
+	require.NoError(h.Register(newTestHook(receiver.URL(), ".*")))
+	_, err := h.WaitForHook(receiver.URL(), 5*time.Second)
+	require.NoError(err)
+
+	defer tracer.Install()()
+	delivered, err := h.DeliverContext(tracing.WithSpanContext(context.Background(), remote), "test", "mac:112233445566", "", []byte("payload"))
+	assert.Equal(1, delivered)
+	assert.NoError(err)
+
+	requests, err := receiver.Wait(1, time.Second)
+	require.NoError(err)
+
+	spans := tracer.Spans()
+	require.Len(spans, 1)
+	assert.Equal("webhook.delivery", spans[0].Name)
+	assert.Equal(remote, spans[0].Parent)
+	assert.Equal(http.StatusOK, spans[0].Tags[webhook.DeliveryStatusTag])
+	assert.True(spans[0].Finished)
+
+	// the receiver can continue the trace
+	sc, ok := tracing.ExtractHeader(requests[0].Header)
+	assert.True(ok)
+	assert.Equal(spans[0].Context(), sc)
+}
+
+func TestHarnessDeliverPartner(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		h        = newTestHarness(t, nil)
+		receiver = NewReceiver(1)
+		w        = newTestHook(receiver.URL(), ".*")
+	)
+
+	defer h.Close()
+	defer receiver.Close()
+
+	w.PartnerIDs = []string{"comcast"}
+	require.NoError(h.Register(w))
+	_, err := h.WaitForHook(receiver.URL(), 5*time.Second)
+	require.NoError(err)
+
+	// events from devices of other partners, or of no partner, are not delivered
+	for _, partnerID := range []string{"", "cox"} {
+		delivered, err := h.DeliverContext(context.Background(), "test", "mac:112233445566", partnerID, []byte("payload"))
+		assert.Zero(delivered)
+		assert.NoError(err)
+	}
+
+	delivered, err := h.DeliverContext(context.Background(), "test", "mac:112233445566", "comcast", []byte("payload"))
+	assert.Equal(1, delivered)
+	assert.NoError(err)
+
+	_, err = receiver.Wait(1, time.Second)
+	assert.NoError(err)
+}
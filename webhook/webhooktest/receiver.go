@@ -0,0 +1,181 @@
+package webhooktest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"github.com/Comcast/webpa-common/webhook"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorWaitTimeout = errors.New("Timed out waiting for requests")
+)
+
+// Request is a request received by a Receiver
+type Request struct {
+	Method string
+	Header http.Header
+	Body   []byte
+
+	// Status is the status code the Receiver answered with
+	Status int
+}
+
+// Event returns the EventHeader value of this request
+func (r Request) Event() string {
+	return r.Header.Get(webhook.EventHeader)
+}
+
+// Verify tests whether this request carries a valid SignatureHeader for the given secret
+func (r Request) Verify(secret string) bool {
+	return r.Header.Get(webhook.SignatureHeader) == webhook.Sign(secret, r.Body)
+}
+
+// Payload returns the body of this request, decompressed if it was delivered with gzip content encoding
+func (r Request) Payload() ([]byte, error) {
+	if r.Header.Get(webhook.ContentEncodingHeader) != webhook.GzipEncoding {
+		return r.Body, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(r.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// Receiver is a scriptable webhook receiver backed by an HTTP test server.  A Receiver records each request
+// it gets, and can be made to respond slowly or to fail some fraction of requests.
+type Receiver struct {
+	server *httptest.Server
+
+	lock           sync.Mutex
+	latency        time.Duration
+	failureRate    float64
+	failureStatus  int
+	acceptEncoding string
+	random         *rand.Rand
+	requests       []Request
+	changed        chan struct{}
+}
+
+// NewReceiver starts a Receiver.  The seed determines which requests fail when a failure rate is set,
+// so that tests are repeatable.
+func NewReceiver(seed int64) *Receiver {
+	r := &Receiver{
+		failureStatus: http.StatusInternalServerError,
+		random:        rand.New(rand.NewSource(seed)),
+		changed:       make(chan struct{}),
+	}
+
+	r.server = httptest.NewServer(r)
+	return r
+}
+
+// URL returns the base URL of this receiver
+func (r *Receiver) URL() string {
+	return r.server.URL
+}
+
+// Close shuts down this receiver's server
+func (r *Receiver) Close() {
+	r.server.Close()
+}
+
+// SetLatency sets the time this receiver waits before answering each request
+func (r *Receiver) SetLatency(latency time.Duration) {
+	r.lock.Lock()
+	r.latency = latency
+	r.lock.Unlock()
+}
+
+// SetFailureRate sets the fraction of requests, from 0.0 to 1.0, that this receiver answers with
+// the given status code instead of 200
+func (r *Receiver) SetFailureRate(failureRate float64, status int) {
+	r.lock.Lock()
+	r.failureRate = failureRate
+	r.failureStatus = status
+	r.lock.Unlock()
+}
+
+// SetAcceptEncoding sets the Accept-Encoding header this receiver includes in its responses, which advertises
+// the encodings it accepts for deliveries.  An empty value removes the header.
+func (r *Receiver) SetAcceptEncoding(acceptEncoding string) {
+	r.lock.Lock()
+	r.acceptEncoding = acceptEncoding
+	r.lock.Unlock()
+}
+
+// Requests returns the requests received so far, in order
+func (r *Receiver) Requests() []Request {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Request(nil), r.requests...)
+}
+
+// Wait blocks until this receiver has received at least count requests, returning the requests
+// received so far.  If the timeout elapses first, ErrorWaitTimeout is returned.
+func (r *Receiver) Wait(count int, timeout time.Duration) ([]Request, error) {
+	expired := time.After(timeout)
+	for {
+		r.lock.Lock()
+		requests, changed := append([]Request(nil), r.requests...), r.changed
+		r.lock.Unlock()
+
+		if len(requests) >= count {
+			return requests, nil
+		}
+
+		select {
+		case <-changed:
+		case <-expired:
+			return requests, ErrorWaitTimeout
+		}
+	}
+}
+
+func (r *Receiver) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	body, _ := ioutil.ReadAll(request.Body)
+
+	r.lock.Lock()
+	latency, acceptEncoding := r.latency, r.acceptEncoding
+	status := http.StatusOK
+	if r.failureRate >= 1.0 || (r.failureRate > 0.0 && r.random.Float64() < r.failureRate) {
+		status = r.failureStatus
+	}
+
+	r.lock.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-request.Context().Done():
+		}
+	}
+
+	r.lock.Lock()
+	r.requests = append(r.requests, Request{
+		Method: request.Method,
+		Header: request.Header,
+		Body:   body,
+		Status: status,
+	})
+
+	close(r.changed)
+	r.changed = make(chan struct{})
+	r.lock.Unlock()
+
+	if len(acceptEncoding) > 0 {
+		response.Header().Set(webhook.AcceptEncodingHeader, acceptEncoding)
+	}
+
+	response.WriteHeader(status)
+}
@@ -0,0 +1,146 @@
+package webhooktest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/Comcast/webpa-common/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func post(t *testing.T, url string, body []byte) int {
+	response, err := http.Post(url, "text/plain", bytes.NewReader(body))
+	require.NoError(t, err)
+	response.Body.Close()
+	return response.StatusCode
+}
+
+func TestReceiver(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		receiver = NewReceiver(1)
+	)
+
+	defer receiver.Close()
+
+	_, err := receiver.Wait(1, 10*time.Millisecond)
+	assert.Equal(ErrorWaitTimeout, err)
+
+	assert.Equal(http.StatusOK, post(t, receiver.URL(), []byte("first")))
+	requests, err := receiver.Wait(1, time.Second)
+	require.NoError(err)
+	require.Len(requests, 1)
+	assert.Equal("POST", requests[0].Method)
+	assert.Equal("first", string(requests[0].Body))
+	assert.Equal(http.StatusOK, requests[0].Status)
+
+	receiver.SetFailureRate(1.0, http.StatusServiceUnavailable)
+	assert.Equal(http.StatusServiceUnavailable, post(t, receiver.URL(), []byte("second")))
+
+	receiver.SetFailureRate(0.0, http.StatusServiceUnavailable)
+	receiver.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	assert.Equal(http.StatusOK, post(t, receiver.URL(), []byte("third")))
+	assert.True(time.Since(start) >= 50*time.Millisecond)
+
+	requests = receiver.Requests()
+	require.Len(requests, 3)
+	assert.Equal(http.StatusServiceUnavailable, requests[1].Status)
+	assert.Equal(http.StatusOK, requests[2].Status)
+}
+
+func TestReceiverFailureRate(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		counts []int
+	)
+
+	// the same seed always fails the same requests
+	for run := 0; run < 2; run++ {
+		receiver := NewReceiver(42)
+		receiver.SetFailureRate(0.5, http.StatusInternalServerError)
+
+		failures := 0
+		for i := 0; i < 100; i++ {
+			if post(t, receiver.URL(), nil) == http.StatusInternalServerError {
+				failures++
+			}
+		}
+
+		receiver.Close()
+		counts = append(counts, failures)
+	}
+
+	assert.Equal(counts[0], counts[1])
+	assert.True(counts[0] > 25 && counts[0] < 75)
+}
+
+func TestRequest(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		request = Request{
+			Header: http.Header{},
+			Body:   []byte("body"),
+		}
+	)
+
+	request.Header.Set(webhook.EventHeader, "test")
+	request.Header.Set(webhook.SignatureHeader, webhook.Sign("secret", request.Body))
+
+	assert.Equal("test", request.Event())
+	assert.True(request.Verify("secret"))
+	assert.False(request.Verify("other"))
+
+	payload, err := request.Payload()
+	assert.Equal([]byte("body"), payload)
+	assert.NoError(err)
+}
+
+func TestRequestPayloadGzip(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		require    = require.New(t)
+		compressed bytes.Buffer
+		writer     = gzip.NewWriter(&compressed)
+	)
+
+	_, err := writer.Write([]byte("compressed body"))
+	require.NoError(err)
+	require.NoError(writer.Close())
+
+	request := Request{Header: http.Header{}, Body: compressed.Bytes()}
+	request.Header.Set(webhook.ContentEncodingHeader, webhook.GzipEncoding)
+	payload, err := request.Payload()
+	assert.Equal([]byte("compressed body"), payload)
+	assert.NoError(err)
+
+	request.Body = []byte("not gzipped")
+	payload, err = request.Payload()
+	assert.Nil(payload)
+	assert.Error(err)
+}
+
+func TestReceiverAcceptEncoding(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		receiver = NewReceiver(1)
+	)
+
+	defer receiver.Close()
+
+	response, err := http.Post(receiver.URL(), "text/plain", bytes.NewReader([]byte("body")))
+	require.NoError(err)
+	response.Body.Close()
+	assert.Empty(response.Header.Get(webhook.AcceptEncodingHeader))
+
+	receiver.SetAcceptEncoding("gzip")
+	response, err = http.Post(receiver.URL(), "text/plain", bytes.NewReader([]byte("body")))
+	require.NoError(err)
+	response.Body.Close()
+	assert.Equal("gzip", response.Header.Get(webhook.AcceptEncodingHeader))
+}
@@ -0,0 +1,267 @@
+package webhooktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	AWS "github.com/Comcast/webpa-common/webhook/aws"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// PendingConfirmation is the subscription ARN returned by Subscribe, as with AWS SNS
+	PendingConfirmation = "pending confirmation"
+)
+
+var (
+	ErrorNoSuchSubscription = errors.New("No such subscription")
+	ErrorMissingParameter   = errors.New("A required parameter is missing")
+)
+
+// subscription is a single HTTP endpoint subscribed to a topic
+type subscription struct {
+	arn       string
+	topicArn  string
+	endpoint  string
+	token     string
+	confirmed bool
+}
+
+// SNS is an in-memory fake of the AWS SNS service which delivers subscription confirmations and
+// notifications over HTTP, just as AWS does.  Only the operations used by the webhook/aws package
+// are implemented.  Messages posted by this fake are not signed, so the subscribing server must use
+// an SNSValidator which accepts all messages, such as AcceptValidator.
+type SNS struct {
+	snsiface.SNSAPI
+
+	client        *http.Client
+	lock          sync.Mutex
+	nextID        int
+	subscriptions map[string]*subscription
+	published     []string
+}
+
+// NewSNS creates a fake SNS service which uses the given client to post messages to subscribers.
+// If client is nil, http.DefaultClient is used.
+func NewSNS(client *http.Client) *SNS {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &SNS{
+		client:        client,
+		subscriptions: make(map[string]*subscription),
+	}
+}
+
+// Subscribe registers an endpoint with a topic.  As with AWS, the subscription must be confirmed before
+// notifications are delivered.  The confirmation message is not sent until ConfirmAll is called.
+func (s *SNS) Subscribe(input *sns.SubscribeInput) (*sns.SubscribeOutput, error) {
+	if input.TopicArn == nil || input.Endpoint == nil {
+		return nil, ErrorMissingParameter
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.nextID++
+	sub := &subscription{
+		arn:      fmt.Sprintf("%s:%d", *input.TopicArn, s.nextID),
+		topicArn: *input.TopicArn,
+		endpoint: *input.Endpoint,
+		token:    fmt.Sprintf("token-%d", s.nextID),
+	}
+
+	s.subscriptions[sub.arn] = sub
+	return &sns.SubscribeOutput{SubscriptionArn: aws.String(PendingConfirmation)}, nil
+}
+
+// ConfirmSubscription confirms a subscription using the token sent in its confirmation message
+func (s *SNS) ConfirmSubscription(input *sns.ConfirmSubscriptionInput) (*sns.ConfirmSubscriptionOutput, error) {
+	if input.TopicArn == nil || input.Token == nil {
+		return nil, ErrorMissingParameter
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, sub := range s.subscriptions {
+		if sub.topicArn == *input.TopicArn && sub.token == *input.Token {
+			sub.confirmed = true
+			return &sns.ConfirmSubscriptionOutput{SubscriptionArn: aws.String(sub.arn)}, nil
+		}
+	}
+
+	return nil, ErrorNoSuchSubscription
+}
+
+// Publish delivers a notification to each confirmed subscriber of the topic.  Unlike AWS, delivery
+// is synchronous, and the first delivery failure is returned.
+func (s *SNS) Publish(input *sns.PublishInput) (*sns.PublishOutput, error) {
+	if input.TopicArn == nil || input.Message == nil {
+		return nil, ErrorMissingParameter
+	}
+
+	s.lock.Lock()
+	s.nextID++
+	messageID := fmt.Sprintf("message-%d", s.nextID)
+	s.published = append(s.published, *input.Message)
+
+	var subscribers []subscription
+	for _, sub := range s.subscriptions {
+		if sub.confirmed && sub.topicArn == *input.TopicArn {
+			subscribers = append(subscribers, *sub)
+		}
+	}
+
+	s.lock.Unlock()
+
+	message := AWS.SNSMessage{
+		Type:              "Notification",
+		MessageId:         messageID,
+		TopicArn:          *input.TopicArn,
+		Message:           *input.Message,
+		Timestamp:         time.Now().UTC().Format(time.RFC3339),
+		SignatureVersion:  "1",
+		MessageAttributes: make(map[string]AWS.MsgAttr, len(input.MessageAttributes)),
+	}
+
+	if input.Subject != nil {
+		message.Subject = *input.Subject
+	}
+
+	for name, value := range input.MessageAttributes {
+		if value != nil && value.DataType != nil && value.StringValue != nil {
+			message.MessageAttributes[name] = AWS.MsgAttr{Type: *value.DataType, Value: *value.StringValue}
+		}
+	}
+
+	var err error
+	for _, sub := range subscribers {
+		message.UnsubscribeURL = "http://sns.test/?Action=Unsubscribe&SubscriptionArn=" + sub.arn
+		if postErr := s.post(sub, &message); postErr != nil && err == nil {
+			err = postErr
+		}
+	}
+
+	return &sns.PublishOutput{MessageId: aws.String(messageID)}, err
+}
+
+// Unsubscribe removes a subscription
+func (s *SNS) Unsubscribe(input *sns.UnsubscribeInput) (*sns.UnsubscribeOutput, error) {
+	if input.SubscriptionArn == nil {
+		return nil, ErrorMissingParameter
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.subscriptions[*input.SubscriptionArn]; !ok {
+		return nil, ErrorNoSuchSubscription
+	}
+
+	delete(s.subscriptions, *input.SubscriptionArn)
+	return new(sns.UnsubscribeOutput), nil
+}
+
+// ConfirmAll sends a confirmation message to each subscriber which has not yet confirmed.  Subscribers
+// confirm by invoking ConfirmSubscription, normally from their confirmation handler.
+func (s *SNS) ConfirmAll() error {
+	s.lock.Lock()
+	var pending []subscription
+	for _, sub := range s.subscriptions {
+		if !sub.confirmed {
+			pending = append(pending, *sub)
+		}
+	}
+
+	s.lock.Unlock()
+
+	for _, sub := range pending {
+		message := AWS.SNSMessage{
+			Type:             "SubscriptionConfirmation",
+			MessageId:        "confirm-" + sub.token,
+			Token:            sub.token,
+			TopicArn:         sub.topicArn,
+			Message:          "You have chosen to subscribe to the topic " + sub.topicArn,
+			SubscribeURL:     "http://sns.test/?Action=ConfirmSubscription&Token=" + sub.token,
+			Timestamp:        time.Now().UTC().Format(time.RFC3339),
+			SignatureVersion: "1",
+		}
+
+		if err := s.post(sub, &message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Subscriptions returns the number of subscriptions, and how many of those are confirmed
+func (s *SNS) Subscriptions() (total, confirmed int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, sub := range s.subscriptions {
+		total++
+		if sub.confirmed {
+			confirmed++
+		}
+	}
+
+	return
+}
+
+// Published returns the messages published so far, in order
+func (s *SNS) Published() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.published...)
+}
+
+// post sends a message to a subscriber, using the same headers as AWS
+func (s *SNS) post(sub subscription, message *AWS.SNSMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, sub.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+	request.Header.Set("x-amz-sns-message-type", message.Type)
+	request.Header.Set("x-amz-sns-message-id", message.MessageId)
+	request.Header.Set("x-amz-sns-topic-arn", message.TopicArn)
+	if message.Type == "Notification" {
+		request.Header.Set("x-amz-sns-subscription-arn", sub.arn)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s sent to %s returned status %d", message.Type, sub.endpoint, response.StatusCode)
+	}
+
+	return nil
+}
+
+// AcceptValidator is an SNSValidator which accepts every message.  Use it with a server subscribed to
+// the fake SNS, whose messages are not signed.
+type AcceptValidator struct{}
+
+func (AcceptValidator) Validate(*AWS.SNSMessage) (bool, error) {
+	return true, nil
+}
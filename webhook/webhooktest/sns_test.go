@@ -0,0 +1,116 @@
+package webhooktest
+
+import (
+	"encoding/json"
+	AWS "github.com/Comcast/webpa-common/webhook/aws"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSNS(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		fake     = NewSNS(nil)
+		topicArn = "arn:aws:sns:us-east-1:1234:test-topic"
+		messages = make(chan AWS.SNSMessage, 10)
+		headers  = make(chan http.Header, 10)
+
+		server = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			var message AWS.SNSMessage
+			body, _ := ioutil.ReadAll(request.Body)
+			if err := json.Unmarshal(body, &message); err != nil {
+				response.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			messages <- message
+			headers <- request.Header
+		}))
+	)
+
+	defer server.Close()
+
+	_, err := fake.Subscribe(&sns.SubscribeInput{TopicArn: aws.String(topicArn)})
+	assert.Equal(ErrorMissingParameter, err)
+
+	subscribeOutput, err := fake.Subscribe(&sns.SubscribeInput{
+		Protocol: aws.String("http"),
+		TopicArn: aws.String(topicArn),
+		Endpoint: aws.String(server.URL),
+	})
+
+	require.NoError(err)
+	assert.Equal(PendingConfirmation, *subscribeOutput.SubscriptionArn)
+
+	total, confirmed := fake.Subscriptions()
+	assert.Equal(1, total)
+	assert.Equal(0, confirmed)
+
+	// unconfirmed subscriptions are not sent notifications
+	_, err = fake.Publish(&sns.PublishInput{TopicArn: aws.String(topicArn), Message: aws.String("ignored")})
+	assert.NoError(err)
+	assert.Len(messages, 0)
+
+	require.NoError(fake.ConfirmAll())
+	confirmation := <-messages
+	assert.Equal("SubscriptionConfirmation", confirmation.Type)
+	assert.Equal(topicArn, confirmation.TopicArn)
+	assert.Equal("SubscriptionConfirmation", (<-headers).Get("x-amz-sns-message-type"))
+
+	_, err = fake.ConfirmSubscription(&sns.ConfirmSubscriptionInput{TopicArn: aws.String(topicArn), Token: aws.String("nosuch")})
+	assert.Equal(ErrorNoSuchSubscription, err)
+
+	confirmOutput, err := fake.ConfirmSubscription(&sns.ConfirmSubscriptionInput{
+		TopicArn: aws.String(topicArn),
+		Token:    aws.String(confirmation.Token),
+	})
+
+	require.NoError(err)
+	subscriptionArn := *confirmOutput.SubscriptionArn
+	assert.NotEqual(PendingConfirmation, subscriptionArn)
+
+	total, confirmed = fake.Subscriptions()
+	assert.Equal(1, total)
+	assert.Equal(1, confirmed)
+
+	publishOutput, err := fake.Publish(&sns.PublishInput{
+		TopicArn: aws.String(topicArn),
+		Message:  aws.String("hello"),
+		Subject:  aws.String("greeting"),
+		MessageAttributes: map[string]*sns.MessageAttributeValue{
+			"scytale.env": {DataType: aws.String("String"), StringValue: aws.String("test")},
+		},
+	})
+
+	require.NoError(err)
+	notification := <-messages
+	assert.Equal("Notification", notification.Type)
+	assert.Equal(*publishOutput.MessageId, notification.MessageId)
+	assert.Equal("hello", notification.Message)
+	assert.Equal("greeting", notification.Subject)
+	assert.Equal(AWS.MsgAttr{Type: "String", Value: "test"}, notification.MessageAttributes["scytale.env"])
+	assert.Equal(subscriptionArn, (<-headers).Get("x-amz-sns-subscription-arn"))
+	assert.Equal([]string{"ignored", "hello"}, fake.Published())
+
+	_, err = fake.Unsubscribe(&sns.UnsubscribeInput{SubscriptionArn: aws.String(subscriptionArn)})
+	assert.NoError(err)
+	_, err = fake.Unsubscribe(&sns.UnsubscribeInput{SubscriptionArn: aws.String(subscriptionArn)})
+	assert.Equal(ErrorNoSuchSubscription, err)
+
+	total, _ = fake.Subscriptions()
+	assert.Equal(0, total)
+}
+
+func TestAcceptValidator(t *testing.T) {
+	valid, err := AcceptValidator{}.Validate(new(AWS.SNSMessage))
+	assert.True(t, valid)
+	assert.NoError(t, err)
+}
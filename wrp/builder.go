@@ -0,0 +1,110 @@
+package wrp
+
+// NewSimpleRequestResponse creates a generic Message of type SimpleRequestResponseMessageType.  The returned
+// Message can be further customized using its With methods, e.g.:
+//
+//	message := NewSimpleRequestResponse("dns:myserver.com", "mac:112233445566", payload).
+//		WithTransaction("a unique identifier").
+//		WithContentType("application/json")
+func NewSimpleRequestResponse(source, destination string, payload []byte) *Message {
+	return &Message{
+		Type:        SimpleRequestResponseMessageType,
+		Source:      source,
+		Destination: destination,
+		Payload:     payload,
+	}
+}
+
+// NewSimpleEvent creates a generic Message of type SimpleEventMessageType
+func NewSimpleEvent(source, destination string, payload []byte) *Message {
+	return &Message{
+		Type:        SimpleEventMessageType,
+		Source:      source,
+		Destination: destination,
+		Payload:     payload,
+	}
+}
+
+// NewCRUD creates a generic Message for one of the CRUD message types, e.g. RetrieveMessageType,
+// targeting the given path on the destination
+func NewCRUD(messageType MessageType, source, destination, path string) *Message {
+	return &Message{
+		Type:        messageType,
+		Source:      source,
+		Destination: destination,
+		Path:        path,
+	}
+}
+
+// NewResponse creates the reply to a request Message.  The reply has the same Type as the request, with
+// the request's Source and Destination swapped and the same TransactionUUID, so that it is routed back to
+// the original sender.  No other fields, including the Payload, are copied.
+func NewResponse(request *Message, payload []byte) *Message {
+	return &Message{
+		Type:            request.Type,
+		Source:          request.Destination,
+		Destination:     request.Source,
+		TransactionUUID: request.TransactionUUID,
+		Payload:         payload,
+	}
+}
+
+// WithTransaction sets the TransactionUUID of this message, returning this message for chaining
+func (msg *Message) WithTransaction(transactionUUID string) *Message {
+	msg.TransactionUUID = transactionUUID
+	return msg
+}
+
+// WithContentType sets the ContentType of this message's payload, returning this message for chaining
+func (msg *Message) WithContentType(contentType string) *Message {
+	msg.ContentType = contentType
+	return msg
+}
+
+// WithAccept sets the Accept field of this message, returning this message for chaining
+func (msg *Message) WithAccept(accept string) *Message {
+	msg.Accept = accept
+	return msg
+}
+
+// WithPath sets the Path of this message, returning this message for chaining
+func (msg *Message) WithPath(path string) *Message {
+	msg.Path = path
+	return msg
+}
+
+// WithPayload sets the Payload of this message, returning this message for chaining
+func (msg *Message) WithPayload(payload []byte) *Message {
+	msg.Payload = payload
+	return msg
+}
+
+// WithHeaders appends to the Headers of this message, returning this message for chaining
+func (msg *Message) WithHeaders(headers ...string) *Message {
+	msg.Headers = append(msg.Headers, headers...)
+	return msg
+}
+
+// WithMetadata merges the given key/value pairs into the Metadata of this message, creating the Metadata
+// map as necessary.  Existing keys are overwritten.  This method returns this message for chaining.
+func (msg *Message) WithMetadata(metadata map[string]string) *Message {
+	if len(metadata) == 0 {
+		return msg
+	}
+
+	if msg.Metadata == nil {
+		msg.Metadata = make(map[string]string, len(metadata))
+	}
+
+	for key, value := range metadata {
+		msg.Metadata[key] = value
+	}
+
+	return msg
+}
+
+// WithQOS sets the QualityOfService of this message, returning this message for chaining
+func (msg *Message) WithQOS(value QOSValue) *Message {
+	msg.QualityOfService = value
+	return msg
+}
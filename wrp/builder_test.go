@@ -0,0 +1,97 @@
+package wrp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSimpleRequestResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	message := NewSimpleRequestResponse("dns:myserver.com", "mac:112233445566", []byte("payload")).
+		WithTransaction("a unique identifier").
+		WithContentType("application/json").
+		WithAccept("application/json").
+		WithHeaders("X-Header-1", "X-Header-2").
+		WithMetadata(map[string]string{"key1": "value1"}).
+		WithMetadata(map[string]string{"key2": "value2"}).
+		WithQOS(QOSHighValue)
+
+	assert.Equal(
+		&Message{
+			Type:             SimpleRequestResponseMessageType,
+			Source:           "dns:myserver.com",
+			Destination:      "mac:112233445566",
+			TransactionUUID:  "a unique identifier",
+			ContentType:      "application/json",
+			Accept:           "application/json",
+			Headers:          []string{"X-Header-1", "X-Header-2"},
+			Metadata:         map[string]string{"key1": "value1", "key2": "value2"},
+			Payload:          []byte("payload"),
+			QualityOfService: QOSHighValue,
+		},
+		message,
+	)
+
+	assert.Equal(message, message.WithMetadata(nil))
+	assert.Len(message.Metadata, 2)
+}
+
+func TestNewSimpleEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(
+		&Message{
+			Type:        SimpleEventMessageType,
+			Source:      "mac:112233445566",
+			Destination: "event:device-status",
+			Payload:     []byte("payload"),
+		},
+		NewSimpleEvent("mac:112233445566", "event:device-status", []byte("payload")),
+	)
+}
+
+func TestNewCRUD(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(
+		&Message{
+			Type:            RetrieveMessageType,
+			Source:          "dns:myserver.com",
+			Destination:     "mac:112233445566",
+			TransactionUUID: "a unique identifier",
+			Path:            "/some/other/path",
+			Payload:         []byte("payload"),
+		},
+		NewCRUD(RetrieveMessageType, "dns:myserver.com", "mac:112233445566", "/some/path").
+			WithTransaction("a unique identifier").
+			WithPath("/some/other/path").
+			WithPayload([]byte("payload")),
+	)
+}
+
+func TestNewResponse(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		request = NewSimpleRequestResponse("dns:myserver.com", "mac:112233445566", []byte("request")).
+			WithTransaction("a unique identifier").
+			WithContentType("text/plain").
+			WithMetadata(map[string]string{"key": "value"})
+
+		response = NewResponse(request, []byte("response")).SetStatus(200)
+	)
+
+	assert.Equal(SimpleRequestResponseMessageType, response.Type)
+	assert.Equal("mac:112233445566", response.Source)
+	assert.Equal("dns:myserver.com", response.Destination)
+	assert.Equal("a unique identifier", response.TransactionUUID)
+	assert.Equal([]byte("response"), response.Payload)
+	assert.Empty(response.ContentType)
+	assert.Empty(response.Metadata)
+	assert.Equal(int64(200), *response.Status)
+
+	// the request is unchanged
+	assert.Equal("dns:myserver.com", request.Source)
+	assert.Equal([]byte("request"), request.Payload)
+}
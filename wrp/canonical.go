@@ -0,0 +1,109 @@
+package wrp
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/ugorji/go/codec"
+)
+
+// canonicalMsgpackHandle produces the canonical Msgpack form.  Values are decoded generically, with every
+// map keyed by strings, and encoded with sorted map keys.
+var canonicalMsgpackHandle = codec.MsgpackHandle{
+	BasicHandle: codec.BasicHandle{
+		TypeInfos: codec.NewTypeInfos([]string{"wrp"}),
+		EncodeOptions: codec.EncodeOptions{
+			Canonical: true,
+		},
+		DecodeOptions: codec.DecodeOptions{
+			MapType: reflect.TypeOf(map[string]interface{}(nil)),
+		},
+	},
+}
+
+// canonicalEncoder is an Encoder which produces canonical Msgpack.  Each value is first encoded normally,
+// then decoded generically so that struct fields become map entries, and finally reencoded canonically.
+type canonicalEncoder struct {
+	buffer  []byte
+	source  Encoder
+	decoder *codec.Decoder
+
+	// the embedded Encoder writes canonical output and supplies Reset and ResetBytes
+	*codec.Encoder
+}
+
+func newCanonicalEncoder(output *codec.Encoder) *canonicalEncoder {
+	ce := &canonicalEncoder{
+		decoder: codec.NewDecoderBytes(nil, &canonicalMsgpackHandle),
+		Encoder: output,
+	}
+
+	ce.source = NewEncoderBytes(&ce.buffer, Msgpack)
+	return ce
+}
+
+// NewCanonicalEncoder produces an Encoder which writes canonical Msgpack.  Canonical output is
+// deterministic:  map keys, including the fields of a Message, are sorted and every number is written
+// in its smallest Msgpack representation.  Strings and binary values are both written as Msgpack strings,
+// just as the Msgpack format does.  This makes canonical output suitable for signatures, checksums,
+// and deduplication keys computed over encoded messages, since it does not vary with the encoder which
+// produced a message or with the field order of the Message type.
+//
+// Canonical output decodes like any other Msgpack, so it can be read with a Decoder for the Msgpack format.
+func NewCanonicalEncoder(output io.Writer) Encoder {
+	return newCanonicalEncoder(codec.NewEncoder(output, &canonicalMsgpackHandle))
+}
+
+// NewCanonicalEncoderBytes produces an Encoder which writes canonical Msgpack to a byte slice
+func NewCanonicalEncoderBytes(output *[]byte) Encoder {
+	return newCanonicalEncoder(codec.NewEncoderBytes(output, &canonicalMsgpackHandle))
+}
+
+// Encode writes the canonical form of a value.  As with other Encoders, a value which implements
+// EncodeListener is notified first.
+func (ce *canonicalEncoder) Encode(value interface{}) error {
+	ce.source.ResetBytes(&ce.buffer)
+	if err := ce.source.Encode(value); err != nil {
+		return err
+	}
+
+	ce.decoder.ResetBytes(ce.buffer)
+	return canonicalize(ce.decoder, ce.Encoder)
+}
+
+// canonicalize transfers a single Msgpack value from a decoder to a canonical encoder
+func canonicalize(decoder *codec.Decoder, encoder *codec.Encoder) error {
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+
+	return encoder.Encode(value)
+}
+
+// EncodeCanonical returns the canonical Msgpack form of a value, such as a *Message.  Equal messages
+// always produce the same bytes.
+func EncodeCanonical(value interface{}) ([]byte, error) {
+	var output []byte
+	if err := NewCanonicalEncoderBytes(&output).Encode(value); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// Canonicalize converts Msgpack produced by any encoder into its canonical form, as produced by
+// EncodeCanonical.  The contents must hold a single Msgpack value whose maps are keyed by strings,
+// which is true of all WRP messages.  Unlike decoding into a Message, fields unknown to this package
+// are preserved.
+func Canonicalize(contents []byte) ([]byte, error) {
+	var output []byte
+	if err := canonicalize(
+		codec.NewDecoderBytes(contents, &canonicalMsgpackHandle),
+		codec.NewEncoderBytes(&output, &canonicalMsgpackHandle),
+	); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
@@ -0,0 +1,162 @@
+package wrp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectedCanonicalEvent is the canonical form of a SimpleEvent from "a" to "b", with sorted keys
+var expectedCanonicalEvent = []byte{
+	0x83,
+	0xa4, 'd', 'e', 's', 't', 0xa1, 'b',
+	0xa8, 'm', 's', 'g', '_', 't', 'y', 'p', 'e', 0x04,
+	0xa6, 's', 'o', 'u', 'r', 'c', 'e', 0xa1, 'a',
+}
+
+type failingListener struct{}
+
+func (failingListener) BeforeEncode() error {
+	return errors.New("expected")
+}
+
+func TestEncodeCanonical(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	// the listener sets the message type, and keys are sorted rather than in field order
+	canonical, err := EncodeCanonical(&SimpleEvent{Source: "a", Destination: "b"})
+	require.NoError(err)
+	assert.Equal(expectedCanonicalEvent, canonical)
+
+	canonical, err = EncodeCanonical(failingListener{})
+	assert.Nil(canonical)
+	assert.Error(err)
+}
+
+func TestEncodeCanonicalDeterministic(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		status  = int64(200)
+		message = Message{
+			Type:            SimpleRequestResponseMessageType,
+			Source:          "dns:talaria.example.com",
+			Destination:     "mac:112233445566/config",
+			TransactionUUID: "1234",
+			Status:          &status,
+			Headers:         []string{"X-Header-1", "X-Header-2"},
+			Metadata: map[string]string{
+				"trace": "1", "region": "east", "node": "talaria-1", "boot-time": "1499200000",
+				"fw-name": "TG1682", "hw-model": "xb3", "last-reconnect-reason": "ping_miss",
+			},
+			Payload: []byte("payload"),
+		}
+	)
+
+	expected, err := EncodeCanonical(&message)
+	require.NoError(err)
+
+	// map iteration order varies, but canonical output does not
+	for repeat := 0; repeat < 20; repeat++ {
+		actual, err := EncodeCanonical(&message)
+		require.NoError(err)
+		assert.Equal(expected, actual)
+	}
+
+	// canonical output is ordinary msgpack
+	var decoded Message
+	require.NoError(NewDecoderBytes(expected, Msgpack).Decode(&decoded))
+	assert.Equal(message, decoded)
+
+	// canonicalization is idempotent
+	canonicalized, err := Canonicalize(expected)
+	require.NoError(err)
+	assert.Equal(expected, canonicalized)
+}
+
+func TestCanonicalize(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	// the same event, with unsorted keys, a 64-bit message type, and the str8 and bin8 types used by other encoders
+	canonical, err := Canonicalize([]byte{
+		0x83,
+		0xa6, 's', 'o', 'u', 'r', 'c', 'e', 0xc4, 0x01, 'a',
+		0xa8, 'm', 's', 'g', '_', 't', 'y', 'p', 'e', 0xd3, 0, 0, 0, 0, 0, 0, 0, 0x04,
+		0xd9, 0x04, 'd', 'e', 's', 't', 0xd9, 0x01, 'b',
+	})
+
+	require.NoError(err)
+	assert.Equal(expectedCanonicalEvent, canonical)
+
+	// nested maps are sorted, and fields unknown to Message are preserved
+	canonical, err = Canonicalize([]byte{
+		0x82,
+		0xa7, 'u', 'n', 'k', 'n', 'o', 'w', 'n', 0xcd, 0x00, 0x05,
+		0xa8, 'm', 'e', 't', 'a', 'd', 'a', 't', 'a', 0x82, 0xa1, 'z', 0xa1, '1', 0xa1, 'a', 0xa1, '2',
+	})
+
+	require.NoError(err)
+	assert.Equal(
+		[]byte{
+			0x82,
+			0xa8, 'm', 'e', 't', 'a', 'd', 'a', 't', 'a', 0x82, 0xa1, 'a', 0xa1, '2', 0xa1, 'z', 0xa1, '1',
+			0xa7, 'u', 'n', 'k', 'n', 'o', 'w', 'n', 0x05,
+		},
+		canonical,
+	)
+
+	canonical, err = Canonicalize([]byte{0xc1})
+	assert.Nil(canonical)
+	assert.Error(err)
+}
+
+func TestCanonicalEncoder(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		first, second bytes.Buffer
+		encoder       = NewCanonicalEncoder(&first)
+	)
+
+	require.NoError(encoder.Encode(&SimpleEvent{Source: "a", Destination: "b"}))
+	assert.Equal(expectedCanonicalEvent, first.Bytes())
+
+	encoder.Reset(&second)
+	require.NoError(encoder.Encode(&SimpleEvent{Source: "a", Destination: "b"}))
+	assert.Equal(expectedCanonicalEvent, second.Bytes())
+	assert.Equal(expectedCanonicalEvent, first.Bytes())
+
+	var output []byte
+	encoder.ResetBytes(&output)
+	require.NoError(encoder.Encode(&SimpleEvent{Source: "a", Destination: "b"}))
+	assert.Equal(expectedCanonicalEvent, output)
+
+	output = nil
+	require.NoError(NewCanonicalEncoderBytes(&output).Encode(&SimpleEvent{Source: "a", Destination: "b"}))
+	assert.Equal(expectedCanonicalEvent, output)
+}
+
+func TestCanonicalEncoderPool(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		output []byte
+		pool   = NewCanonicalEncoderPool(1)
+	)
+
+	testEncoderPool(assert, Msgpack, pool, &output)
+	assert.IsType(new(canonicalEncoder), pool.New())
+
+	require.NoError(t, pool.EncodeBytes(&output, &SimpleEvent{Source: "a", Destination: "b"}))
+	assert.Equal(expectedCanonicalEvent, output)
+}
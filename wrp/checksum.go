@@ -0,0 +1,137 @@
+package wrp
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+const (
+	// ChecksumMetadataKey is the metadata key holding the checksum of a message's payload, in the form
+	// "algorithm:hex digest".  Messages without this key have no checksum.
+	ChecksumMetadataKey = "payload-checksum"
+
+	// CRC32Checksum is the algorithm for CRC-32 checksums, using the IEEE polynomial
+	CRC32Checksum = "crc32"
+
+	// XXHashChecksum is the algorithm for 64-bit xxHash checksums
+	XXHashChecksum = "xxhash"
+)
+
+var (
+	ErrorUnsupportedChecksum = errors.New("Unsupported WRP payload checksum algorithm")
+	ErrorInvalidChecksum     = errors.New("Invalid WRP payload checksum")
+	ErrorChecksumMismatch    = errors.New("The WRP payload does not match its checksum")
+)
+
+// Checksum configures the payload checksums computed by an EncoderPool and verified by a DecoderPool.
+// Checksums detect payloads corrupted somewhere between the encoding and decoding of a message.
+type Checksum struct {
+	// Algorithm is the checksum algorithm used by encoders, either CRC32Checksum or XXHashChecksum.  If not
+	// supplied, CRC32Checksum is used.  Decoders verify checksums computed with any supported algorithm.
+	Algorithm string
+
+	// Reject indicates whether decoders fail with an error when a payload does not match its checksum.
+	// By default, mismatches are only counted.
+	Reject bool
+}
+
+func (c *Checksum) algorithm() string {
+	if c != nil && len(c.Algorithm) > 0 {
+		return strings.ToLower(c.Algorithm)
+	}
+
+	return CRC32Checksum
+}
+
+func (c *Checksum) reject() bool {
+	return c != nil && c.Reject
+}
+
+// validate checks that this configuration names a supported algorithm
+func (c *Checksum) validate() error {
+	_, err := computeChecksum(c.algorithm(), nil)
+	return err
+}
+
+// computeChecksum returns the metadata value holding the checksum of a payload
+func computeChecksum(algorithm string, payload []byte) (string, error) {
+	switch strings.ToLower(algorithm) {
+	case CRC32Checksum:
+		return fmt.Sprintf("%s:%08x", CRC32Checksum, crc32.ChecksumIEEE(payload)), nil
+	case XXHashChecksum:
+		return fmt.Sprintf("%s:%016x", XXHashChecksum, xxhash64(payload)), nil
+	default:
+		return "", ErrorUnsupportedChecksum
+	}
+}
+
+// ChecksumPayload records the checksum of a message's payload in its metadata, replacing any existing
+// checksum.  Messages whose payloads are empty are left unchanged.
+func ChecksumPayload(message *Message, algorithm string) error {
+	if len(message.Payload) == 0 {
+		return nil
+	}
+
+	checksum, err := computeChecksum(algorithm, message.Payload)
+	if err != nil {
+		return err
+	}
+
+	if message.Metadata == nil {
+		message.Metadata = make(map[string]string, 1)
+	}
+
+	message.Metadata[ChecksumMetadataKey] = checksum
+	return nil
+}
+
+// VerifyPayload checks a message's payload against the checksum in its metadata, returning ErrorChecksumMismatch
+// if the payload has been corrupted.  Messages without a checksum are not verified.
+func VerifyPayload(message *Message) error {
+	expected := message.Metadata[ChecksumMetadataKey]
+	if len(expected) == 0 {
+		return nil
+	}
+
+	separator := strings.IndexByte(expected, ':')
+	if separator < 1 {
+		return ErrorInvalidChecksum
+	}
+
+	actual, err := computeChecksum(expected[:separator], message.Payload)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(expected, actual) {
+		return ErrorChecksumMismatch
+	}
+
+	return nil
+}
+
+// checksummedCopy returns a copy of a *Message source with the checksum of its payload in its metadata,
+// so that the caller's message is not modified.  Other sources, and messages with empty payloads, are
+// returned as is.
+func checksummedCopy(source interface{}, c *Checksum) (interface{}, error) {
+	message, ok := source.(*Message)
+	if !ok || len(message.Payload) == 0 {
+		return source, nil
+	}
+
+	checksum, err := computeChecksum(c.algorithm(), message.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	clone := *message
+	clone.Metadata = make(map[string]string, len(message.Metadata)+1)
+	for key, value := range message.Metadata {
+		clone.Metadata[key] = value
+	}
+
+	clone.Metadata[ChecksumMetadataKey] = checksum
+	return &clone, nil
+}
@@ -0,0 +1,215 @@
+package wrp
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksumDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	var c *Checksum
+	assert.Equal(CRC32Checksum, c.algorithm())
+	assert.False(c.reject())
+	assert.NoError(c.validate())
+
+	c = &Checksum{Algorithm: "XXHash", Reject: true}
+	assert.Equal(XXHashChecksum, c.algorithm())
+	assert.True(c.reject())
+	assert.NoError(c.validate())
+
+	c.Algorithm = "md5"
+	assert.Equal(ErrorUnsupportedChecksum, c.validate())
+}
+
+func TestChecksumPayload(t *testing.T) {
+	for _, algorithm := range []string{CRC32Checksum, XXHashChecksum, "CRC32"} {
+		t.Run(algorithm, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+
+				message = &Message{Type: SimpleEventMessageType, Payload: []byte("the payload")}
+			)
+
+			require.NoError(ChecksumPayload(message, algorithm))
+			assert.True(strings.HasPrefix(message.Metadata[ChecksumMetadataKey], strings.ToLower(algorithm)+":"))
+			assert.NoError(VerifyPayload(message))
+
+			message.Payload[0] ^= 0xFF
+			assert.Equal(ErrorChecksumMismatch, VerifyPayload(message))
+
+			// checksumming again replaces the stale checksum
+			require.NoError(ChecksumPayload(message, algorithm))
+			assert.NoError(VerifyPayload(message))
+		})
+	}
+}
+
+func TestChecksumPayloadEdgeCases(t *testing.T) {
+	assert := assert.New(t)
+
+	empty := new(Message)
+	assert.NoError(ChecksumPayload(empty, CRC32Checksum))
+	assert.Nil(empty.Metadata)
+	assert.NoError(VerifyPayload(empty))
+
+	message := &Message{Payload: []byte("the payload")}
+	assert.Equal(ErrorUnsupportedChecksum, ChecksumPayload(message, "md5"))
+	assert.Nil(message.Metadata)
+
+	for value, expected := range map[string]error{
+		"nocolon":  ErrorInvalidChecksum,
+		":1234":    ErrorInvalidChecksum,
+		"md5:1234": ErrorUnsupportedChecksum,
+		"crc32:00": ErrorChecksumMismatch,
+	} {
+		message.Metadata = map[string]string{ChecksumMetadataKey: value}
+		assert.Equal(expected, VerifyPayload(message), value)
+	}
+}
+
+func TestChecksummingPools(t *testing.T) {
+	for _, format := range []Format{Msgpack, JSON} {
+		for _, algorithm := range []string{CRC32Checksum, XXHashChecksum} {
+			t.Run(fmt.Sprintf("%s/%s", format, algorithm), func(t *testing.T) {
+				var (
+					assert  = assert.New(t)
+					require = require.New(t)
+
+					original = &Message{
+						Type:     SimpleEventMessageType,
+						Source:   "mac:112233445566",
+						Metadata: map[string]string{"/key": "value"},
+						Payload:  []byte(strings.Repeat("telemetry ", 100)),
+					}
+
+					decoderPool = NewVerifyingDecoderPool(1, format, Checksum{Reject: true})
+					encoded     []byte
+					buffer      bytes.Buffer
+				)
+
+				encoderPool, err := NewChecksummingEncoderPool(1, format, Checksum{Algorithm: algorithm})
+				require.NoError(err)
+				require.NotNil(encoderPool)
+
+				require.NoError(encoderPool.EncodeBytes(&encoded, original))
+				require.NoError(encoderPool.Encode(&buffer, original))
+
+				// the caller's message is never modified
+				assert.Equal(map[string]string{"/key": "value"}, original.Metadata)
+
+				var decoded Message
+				require.NoError(decoderPool.DecodeBytes(&decoded, encoded))
+				assert.Equal(original.Payload, decoded.Payload)
+				assert.Equal("value", decoded.Metadata["/key"])
+				assert.True(strings.HasPrefix(decoded.Metadata[ChecksumMetadataKey], algorithm+":"))
+
+				decoded = Message{}
+				require.NoError(decoderPool.Decode(&decoded, &buffer))
+				assert.Equal(original.Payload, decoded.Payload)
+			})
+		}
+	}
+}
+
+func TestChecksummingPoolsWithCompression(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		factory = &PoolFactory{
+			Compression:   &Compression{Threshold: 1},
+			Decompression: &Decompression{},
+			Checksum:      &Checksum{Reject: true},
+		}
+
+		original = &Message{Type: SimpleEventMessageType, Payload: []byte(strings.Repeat("telemetry ", 100))}
+		encoded  []byte
+	)
+
+	require.NoError(factory.NewEncoderPool(Msgpack).EncodeBytes(&encoded, original))
+
+	// the checksum is of the uncompressed payload, and survives compression
+	var raw Message
+	require.NoError(NewDecoderBytes(encoded, Msgpack).Decode(&raw))
+	assert.Equal(GzipEncoding, raw.Metadata[ContentEncodingMetadataKey])
+	assert.Equal(ErrorChecksumMismatch, VerifyPayload(&raw))
+
+	var decoded Message
+	require.NoError(factory.NewDecoderPool(Msgpack).DecodeBytes(&decoded, encoded))
+	assert.Equal(original.Payload, decoded.Payload)
+	assert.NotContains(decoded.Metadata, ContentEncodingMetadataKey)
+
+	// a payload which is not decompressed cannot be verified, so it is not rejected
+	decoded = Message{}
+	require.NoError(NewVerifyingDecoderPool(1, Msgpack, Checksum{Reject: true}).DecodeBytes(&decoded, encoded))
+	assert.Equal(raw.Payload, decoded.Payload)
+}
+
+func TestVerifyingDecoderPoolCorruption(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		corrupt = &Message{
+			Type:     SimpleEventMessageType,
+			Metadata: map[string]string{ChecksumMetadataKey: "crc32:00000000"},
+			Payload:  []byte("corrupted in transit"),
+		}
+
+		invalid = &Message{
+			Type:     SimpleEventMessageType,
+			Metadata: map[string]string{ChecksumMetadataKey: "md5:1234"},
+			Payload:  []byte("unsupported algorithm"),
+		}
+
+		corruptEncoded []byte
+		invalidEncoded []byte
+	)
+
+	require.NoError(NewEncoderBytes(&corruptEncoded, Msgpack).Encode(corrupt))
+	require.NoError(NewEncoderBytes(&invalidEncoded, Msgpack).Encode(invalid))
+
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	require.NoError(err)
+
+	// by default, corruption is only counted
+	lenient := newDecoderPool(1, Msgpack, registry, &Checksum{}, nil)
+	var decoded Message
+	assert.NoError(lenient.DecodeBytes(&decoded, corruptEncoded))
+	assert.Equal(corrupt.Payload, decoded.Payload)
+
+	strict := newDecoderPool(1, Msgpack, registry, &Checksum{Reject: true}, nil)
+	decoded = Message{}
+	assert.Equal(ErrorChecksumMismatch, strict.DecodeBytes(&decoded, corruptEncoded))
+	decoded = Message{}
+	assert.Equal(ErrorUnsupportedChecksum, strict.DecodeBytes(&decoded, invalidEncoded))
+
+	// pools which do not verify checksums ignore them
+	decoded = Message{}
+	assert.NoError(newDecoderPool(1, Msgpack, registry, nil, nil).DecodeBytes(&decoded, corruptEncoded))
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	output := response.Body.String()
+
+	assert.Contains(output, PayloadChecksumCounter+`{format="Msgpack",outcome="corrupt",pool="decoder"} 2`)
+	assert.Contains(output, PayloadChecksumCounter+`{format="Msgpack",outcome="invalid",pool="decoder"} 1`)
+	assert.NotContains(output, `outcome="valid"`)
+}
+
+func TestNewChecksummingEncoderPoolInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	encoderPool, err := NewChecksummingEncoderPool(1, Msgpack, Checksum{Algorithm: "md5"})
+	assert.Nil(encoderPool)
+	assert.Equal(ErrorUnsupportedChecksum, err)
+}
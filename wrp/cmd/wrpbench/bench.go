@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Comcast/webpa-common/wrp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Shape describes the messages used in a benchmark
+type Shape struct {
+	Type     string
+	Payload  int
+	Headers  int
+	Metadata int
+	Spans    int
+}
+
+// Message produces a wrp.Message with this shape
+func (s Shape) Message() (*wrp.Message, error) {
+	message := &wrp.Message{
+		Source:          "dns:wrpbench.example.com/service",
+		Destination:     "mac:112233445566/config",
+		TransactionUUID: "2a1a9d4c-5d3b-4b2e-9a49-8d3b8f1e1a7c",
+		ContentType:     "application/octet-stream",
+	}
+
+	switch strings.ToLower(s.Type) {
+	case "event":
+		message.Type = wrp.SimpleEventMessageType
+	case "request":
+		message.Type = wrp.SimpleRequestResponseMessageType
+	default:
+		return nil, fmt.Errorf("Unsupported message type: %s", s.Type)
+	}
+
+	if s.Payload > 0 {
+		message.Payload = make([]byte, s.Payload)
+		for i := range message.Payload {
+			message.Payload[i] = byte('a' + i%26)
+		}
+	}
+
+	for i := 0; i < s.Headers; i++ {
+		message.Headers = append(message.Headers, fmt.Sprintf("X-Header-%d: value-%d", i, i))
+	}
+
+	if s.Metadata > 0 {
+		message.Metadata = make(map[string]string, s.Metadata)
+		for i := 0; i < s.Metadata; i++ {
+			message.Metadata[fmt.Sprintf("/metadata/key-%d", i)] = fmt.Sprintf("value-%d", i)
+		}
+	}
+
+	for i := 0; i < s.Spans; i++ {
+		message.Spans = append(message.Spans, []string{fmt.Sprintf("span-%d", i), "1503529560", "1234"})
+	}
+
+	return message, nil
+}
+
+// parseFormat converts a command line format name into a wrp.Format
+func parseFormat(value string) (wrp.Format, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "msgpack":
+		return wrp.Msgpack, nil
+	case "json":
+		return wrp.JSON, nil
+	default:
+		return wrp.Format(-1), fmt.Errorf("Unsupported format: %s", value)
+	}
+}
+
+// Result holds the measurements for one operation in one format
+type Result struct {
+	Format    wrp.Format
+	Operation string
+	Size      int
+	Ops       int64
+	Elapsed   time.Duration
+	Allocs    uint64
+	Bytes     uint64
+}
+
+// NsPerOp is the mean time, in nanoseconds, taken by each operation
+func (r Result) NsPerOp() int64 {
+	if r.Ops == 0 {
+		return 0
+	}
+
+	return r.Elapsed.Nanoseconds() / r.Ops
+}
+
+// OpsPerSecond is the overall throughput
+func (r Result) OpsPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(r.Ops) / r.Elapsed.Seconds()
+}
+
+// MBPerSecond is the throughput in megabytes of encoded messages
+func (r Result) MBPerSecond() float64 {
+	return r.OpsPerSecond() * float64(r.Size) / 1e6
+}
+
+// AllocsPerOp is the mean number of heap allocations made by each operation
+func (r Result) AllocsPerOp() uint64 {
+	if r.Ops == 0 {
+		return 0
+	}
+
+	return r.Allocs / uint64(r.Ops)
+}
+
+// BytesPerOp is the mean number of heap bytes allocated by each operation
+func (r Result) BytesPerOp() uint64 {
+	if r.Ops == 0 {
+		return 0
+	}
+
+	return r.Bytes / uint64(r.Ops)
+}
+
+// measure runs an operation repeatedly from the given number of goroutines until the duration elapses.
+// Allocations are taken from the runtime's memory statistics, so measurements should not run concurrently.
+func measure(duration time.Duration, concurrency int, operation func() error) (Result, error) {
+	var (
+		ops      int64
+		stop     int32
+		firstErr atomic.Value
+		wg       sync.WaitGroup
+		before   runtime.MemStats
+		after    runtime.MemStats
+	)
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&stop) == 0 {
+				if err := operation(); err != nil {
+					firstErr.Store(err)
+					atomic.StoreInt32(&stop, 1)
+					return
+				}
+
+				atomic.AddInt64(&ops, 1)
+			}
+		}()
+	}
+
+	time.Sleep(duration)
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	if err, ok := firstErr.Load().(error); ok {
+		return Result{}, err
+	}
+
+	return Result{
+		Ops:     ops,
+		Elapsed: elapsed,
+		Allocs:  after.Mallocs - before.Mallocs,
+		Bytes:   after.TotalAlloc - before.TotalAlloc,
+	}, nil
+}
+
+// Benchmark measures encoding and decoding of a message in a format.  If poolSize is positive, encoders
+// and decoders are taken from wrp pools of that size.  Otherwise, each operation creates its own.
+func Benchmark(message *wrp.Message, f wrp.Format, poolSize int, duration time.Duration, concurrency int) ([]Result, error) {
+	encoded := wrp.MustEncode(message, f)
+
+	var encode, decode func() error
+	if poolSize > 0 {
+		var (
+			encoders = wrp.NewEncoderPool(poolSize, f)
+			decoders = wrp.NewDecoderPool(poolSize, f)
+		)
+
+		encode = func() error {
+			var output []byte
+			return encoders.EncodeBytes(&output, message)
+		}
+
+		decode = func() error {
+			return decoders.DecodeBytes(new(wrp.Message), encoded)
+		}
+	} else {
+		encode = func() error {
+			var output []byte
+			return wrp.NewEncoderBytes(&output, f).Encode(message)
+		}
+
+		decode = func() error {
+			return wrp.NewDecoderBytes(encoded, f).Decode(new(wrp.Message))
+		}
+	}
+
+	var results []Result
+	for _, operation := range []struct {
+		name string
+		run  func() error
+	}{
+		{"encode", encode},
+		{"decode", decode},
+	} {
+		result, err := measure(duration, concurrency, operation.run)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %s", f, operation.name, err)
+		}
+
+		result.Format = f
+		result.Operation = operation.name
+		result.Size = len(encoded)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
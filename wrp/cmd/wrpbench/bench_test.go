@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShapeMessage(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	message, err := Shape{Type: "Event", Payload: 30, Headers: 2, Metadata: 3, Spans: 1}.Message()
+	require.NoError(err)
+	require.NotNil(message)
+	assert.Equal(wrp.SimpleEventMessageType, message.Type)
+	assert.Len(message.Payload, 30)
+	assert.Equal(byte('a'), message.Payload[26])
+	assert.Len(message.Headers, 2)
+	assert.Len(message.Metadata, 3)
+	assert.Len(message.Spans, 1)
+
+	message, err = Shape{Type: "request"}.Message()
+	require.NoError(err)
+	require.NotNil(message)
+	assert.Equal(wrp.SimpleRequestResponseMessageType, message.Type)
+	assert.Empty(message.Payload)
+	assert.Empty(message.Metadata)
+
+	message, err = Shape{Type: "nosuch"}.Message()
+	assert.Nil(message)
+	assert.Error(err)
+}
+
+func TestParseFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	for value, expected := range map[string]wrp.Format{"msgpack": wrp.Msgpack, " JSON ": wrp.JSON} {
+		actual, err := parseFormat(value)
+		assert.Equal(expected, actual)
+		assert.NoError(err)
+	}
+
+	_, err := parseFormat("xml")
+	assert.Error(err)
+}
+
+func TestResult(t *testing.T) {
+	assert := assert.New(t)
+
+	var empty Result
+	assert.Zero(empty.NsPerOp())
+	assert.Zero(empty.OpsPerSecond())
+	assert.Zero(empty.MBPerSecond())
+	assert.Zero(empty.AllocsPerOp())
+	assert.Zero(empty.BytesPerOp())
+
+	result := Result{Size: 1000, Ops: 4, Elapsed: 2 * time.Second, Allocs: 8, Bytes: 400}
+	assert.Equal(int64(500000000), result.NsPerOp())
+	assert.Equal(2.0, result.OpsPerSecond())
+	assert.Equal(0.002, result.MBPerSecond())
+	assert.Equal(uint64(2), result.AllocsPerOp())
+	assert.Equal(uint64(100), result.BytesPerOp())
+}
+
+func TestBenchmark(t *testing.T) {
+	message, err := Shape{Type: "event", Payload: 64, Headers: 1, Metadata: 1, Spans: 1}.Message()
+	require.NoError(t, err)
+
+	for _, f := range []wrp.Format{wrp.Msgpack, wrp.JSON} {
+		for _, poolSize := range []int{0, 2} {
+			t.Run(fmt.Sprintf("%s/pool=%d", f, poolSize), func(t *testing.T) {
+				var (
+					assert  = assert.New(t)
+					require = require.New(t)
+				)
+
+				results, err := Benchmark(message, f, poolSize, 10*time.Millisecond, 2)
+				require.NoError(err)
+				require.Len(results, 2)
+
+				for index, operation := range []string{"encode", "decode"} {
+					assert.Equal(f, results[index].Format)
+					assert.Equal(operation, results[index].Operation)
+					assert.Equal(len(wrp.MustEncode(message, f)), results[index].Size)
+					assert.True(results[index].Ops > 0)
+					assert.True(results[index].Elapsed > 0)
+				}
+			})
+		}
+	}
+}
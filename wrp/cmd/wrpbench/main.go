@@ -0,0 +1,85 @@
+// wrpbench measures WRP encode and decode throughput and allocations for configurable message shapes.
+// Its output can be used to catch codec regressions and to size the wrp encoder and decoder pools.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type Arguments struct {
+	Shape       Shape
+	Formats     string
+	PoolSize    int
+	Duration    time.Duration
+	Concurrency int
+}
+
+func report(output io.Writer, results []Result) {
+	writer := tabwriter.NewWriter(output, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "format\toperation\tsize (B)\tops/s\tns/op\tMB/s\tallocs/op\tB/op\t")
+	for _, r := range results {
+		fmt.Fprintf(
+			writer,
+			"%s\t%s\t%d\t%.0f\t%d\t%.2f\t%d\t%d\t\n",
+			r.Format, r.Operation, r.Size, r.OpsPerSecond(), r.NsPerOp(), r.MBPerSecond(), r.AllocsPerOp(), r.BytesPerOp(),
+		)
+	}
+
+	writer.Flush()
+}
+
+func wrpbench(arguments Arguments) int {
+	message, err := arguments.Shape.Message()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	if arguments.Duration <= 0 || arguments.Concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "The duration and concurrency must be positive")
+		return 1
+	}
+
+	var results []Result
+	for _, name := range strings.Split(arguments.Formats, ",") {
+		f, err := parseFormat(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+
+		formatResults, err := Benchmark(message, f, arguments.PoolSize, arguments.Duration, arguments.Concurrency)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+
+		results = append(results, formatResults...)
+	}
+
+	report(os.Stdout, results)
+	return 0
+}
+
+func main() {
+	var arguments Arguments
+	flag.StringVar(&arguments.Shape.Type, "type", "event", "the message type: event or request")
+	flag.IntVar(&arguments.Shape.Payload, "payload", 1024, "the payload size in bytes")
+	flag.IntVar(&arguments.Shape.Headers, "headers", 0, "the number of headers in each message")
+	flag.IntVar(&arguments.Shape.Metadata, "metadata", 0, "the number of metadata entries in each message")
+	flag.IntVar(&arguments.Shape.Spans, "spans", 0, "the number of spans in each message")
+	flag.StringVar(&arguments.Formats, "formats", "msgpack,json", "a comma-separated list of formats to measure")
+	flag.IntVar(&arguments.PoolSize, "pool", 0, "the encoder and decoder pool size.  If not positive, no pools are used.")
+	flag.DurationVar(&arguments.Duration, "duration", time.Second, "the length of time each operation is measured")
+	flag.IntVar(&arguments.Concurrency, "concurrency", runtime.GOMAXPROCS(0), "the number of goroutines performing each operation")
+	flag.Parse()
+
+	os.Exit(wrpbench(arguments))
+}
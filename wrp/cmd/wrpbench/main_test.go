@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		output bytes.Buffer
+	)
+
+	report(&output, []Result{
+		{Format: wrp.Msgpack, Operation: "encode", Size: 100, Ops: 10, Elapsed: time.Second},
+		{Format: wrp.JSON, Operation: "decode", Size: 200, Ops: 20, Elapsed: time.Second},
+	})
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Len(lines, 3)
+	assert.Contains(lines[0], "ops/s")
+	assert.Contains(lines[1], "encode")
+	assert.Contains(lines[2], "decode")
+}
+
+func TestWrpbench(t *testing.T) {
+	assert := assert.New(t)
+
+	valid := Arguments{
+		Shape:       Shape{Type: "event", Payload: 16},
+		Formats:     "msgpack,json",
+		PoolSize:    1,
+		Duration:    10 * time.Millisecond,
+		Concurrency: 1,
+	}
+
+	assert.Equal(0, wrpbench(valid))
+
+	badType := valid
+	badType.Shape.Type = "nosuch"
+	assert.Equal(1, wrpbench(badType))
+
+	badFormat := valid
+	badFormat.Formats = "msgpack,xml"
+	assert.Equal(1, wrpbench(badFormat))
+
+	badDuration := valid
+	badDuration.Duration = 0
+	assert.Equal(1, wrpbench(badDuration))
+
+	badConcurrency := valid
+	badConcurrency.Concurrency = 0
+	assert.Equal(1, wrpbench(badConcurrency))
+}
@@ -0,0 +1,240 @@
+package wrp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	// ContentEncodingMetadataKey is the metadata key identifying the content encoding of a compressed
+	// payload.  Messages without this key have uncompressed payloads.
+	ContentEncodingMetadataKey = "content-encoding"
+
+	// GzipEncoding is the content encoding for gzip compressed payloads
+	GzipEncoding = "gzip"
+
+	// DeflateEncoding is the content encoding for payloads compressed in the zlib format, as with HTTP
+	DeflateEncoding = "deflate"
+
+	// IdentityEncoding is the content encoding for uncompressed payloads
+	IdentityEncoding = "identity"
+
+	// DefaultCompressionThreshold is the smallest payload, in bytes, that an EncoderPool compresses
+	// when no threshold is configured
+	DefaultCompressionThreshold = 1024
+
+	// DefaultMaxDecompressedSize is the largest payload, in bytes, that is decompressed when no maximum
+	// is configured
+	DefaultMaxDecompressedSize = 1024 * 1024
+)
+
+var (
+	ErrorUnsupportedEncoding  = errors.New("Unsupported WRP payload content encoding")
+	ErrorDecompressedTooLarge = errors.New("The decompressed WRP payload exceeds the maximum size")
+)
+
+// Compression configures the transparent compression of message payloads by an EncoderPool
+type Compression struct {
+	// Encoding is the content encoding used, either GzipEncoding or DeflateEncoding.  If not supplied,
+	// GzipEncoding is used.
+	Encoding string
+
+	// Threshold is the smallest payload, in bytes, that is compressed.  If not supplied,
+	// DefaultCompressionThreshold is used.
+	Threshold int
+}
+
+func (c *Compression) encoding() string {
+	if c != nil && len(c.Encoding) > 0 {
+		return c.Encoding
+	}
+
+	return GzipEncoding
+}
+
+func (c *Compression) threshold() int {
+	if c != nil && c.Threshold > 0 {
+		return c.Threshold
+	}
+
+	return DefaultCompressionThreshold
+}
+
+// validate checks that this configuration names a supported encoding
+func (c *Compression) validate() error {
+	_, err := newCompressor(c.encoding(), ioutil.Discard)
+	return err
+}
+
+// Decompression configures the decompression of message payloads by a DecoderPool.  Since a small compressed
+// payload can inflate to an enormous size, decompression is never done unless configured and the size of each
+// decompressed payload is limited.
+type Decompression struct {
+	// MaxPayloadSize is the largest decompressed payload, in bytes.  Payloads which would decompress to
+	// a larger size are rejected with ErrorDecompressedTooLarge.  If not supplied, DefaultMaxDecompressedSize
+	// is used.
+	MaxPayloadSize int
+}
+
+func (d *Decompression) maxPayloadSize() int {
+	if d != nil && d.MaxPayloadSize > 0 {
+		return d.MaxPayloadSize
+	}
+
+	return DefaultMaxDecompressedSize
+}
+
+// newCompressor returns the writer which compresses output with the given content encoding
+func newCompressor(encoding string, output io.Writer) (io.WriteCloser, error) {
+	switch strings.ToLower(encoding) {
+	case GzipEncoding:
+		return gzip.NewWriter(output), nil
+	case DeflateEncoding:
+		return zlib.NewWriter(output), nil
+	default:
+		return nil, ErrorUnsupportedEncoding
+	}
+}
+
+// newDecompressor returns the reader which decompresses input with the given content encoding
+func newDecompressor(encoding string, input io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(encoding) {
+	case GzipEncoding:
+		return gzip.NewReader(input)
+	case DeflateEncoding:
+		return zlib.NewReader(input)
+	default:
+		return nil, ErrorUnsupportedEncoding
+	}
+}
+
+// isCompressed tests whether a message's payload is compressed with a supported content encoding
+func isCompressed(message *Message) bool {
+	switch strings.ToLower(message.Metadata[ContentEncodingMetadataKey]) {
+	case GzipEncoding, DeflateEncoding:
+		return true
+	default:
+		return false
+	}
+}
+
+// compress returns a payload compressed with the given content encoding
+func compress(encoding string, payload []byte) ([]byte, error) {
+	var output bytes.Buffer
+	compressor, err := newCompressor(encoding, &output)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := compressor.Write(payload); err != nil {
+		return nil, err
+	}
+
+	if err := compressor.Close(); err != nil {
+		return nil, err
+	}
+
+	return output.Bytes(), nil
+}
+
+// CompressPayload compresses a message's payload with the given content encoding, recording the
+// encoding in the message's metadata.  Messages whose payloads are empty or already compressed
+// are left unchanged.
+func CompressPayload(message *Message, encoding string) error {
+	if len(message.Payload) == 0 || len(message.Metadata[ContentEncodingMetadataKey]) > 0 {
+		return nil
+	}
+
+	compressed, err := compress(encoding, message.Payload)
+	if err != nil {
+		return err
+	}
+
+	if message.Metadata == nil {
+		message.Metadata = make(map[string]string, 1)
+	}
+
+	message.Metadata[ContentEncodingMetadataKey] = strings.ToLower(encoding)
+	message.Payload = compressed
+	return nil
+}
+
+// DecompressPayload restores a payload compressed by CompressPayload or an EncoderPool, removing the
+// content encoding from the message's metadata.  Payloads which would decompress to more than maxSize bytes
+// are rejected with ErrorDecompressedTooLarge.  If maxSize is nonpositive, DefaultMaxDecompressedSize is used.
+//
+// Messages without a content encoding, or with an encoding other than GzipEncoding or DeflateEncoding such as
+// IdentityEncoding, are left unchanged.
+func DecompressPayload(message *Message, maxSize int) error {
+	if !isCompressed(message) {
+		return nil
+	}
+
+	decompressor, err := newDecompressor(message.Metadata[ContentEncodingMetadataKey], bytes.NewReader(message.Payload))
+	if err != nil {
+		return err
+	}
+
+	if maxSize < 1 {
+		maxSize = DefaultMaxDecompressedSize
+	}
+
+	// read one byte past the maximum, so that an oversized payload can be detected without inflating all of it
+	defer decompressor.Close()
+	payload, err := ioutil.ReadAll(io.LimitReader(decompressor, int64(maxSize)+1))
+	if err != nil {
+		return err
+	} else if len(payload) > maxSize {
+		return ErrorDecompressedTooLarge
+	}
+
+	delete(message.Metadata, ContentEncodingMetadataKey)
+	if len(message.Metadata) == 0 {
+		message.Metadata = nil
+	}
+
+	message.Payload = payload
+	return nil
+}
+
+// compressedCopy returns the message an EncoderPool actually encodes for a source.  If the source is
+// a *Message whose payload is at least the threshold, a copy with a compressed payload is returned
+// so that the caller's message is not modified.  Otherwise, the source itself is returned.  A payload
+// which does not shrink is sent uncompressed.
+func compressedCopy(source interface{}, c *Compression) (interface{}, error) {
+	message, ok := source.(*Message)
+	if !ok || len(message.Payload) < c.threshold() || len(message.Metadata[ContentEncodingMetadataKey]) > 0 {
+		return source, nil
+	}
+
+	compressed, err := compress(c.encoding(), message.Payload)
+	if err != nil {
+		return nil, err
+	} else if len(compressed) >= len(message.Payload) {
+		return source, nil
+	}
+
+	clone := *message
+	clone.Payload = compressed
+	clone.Metadata = make(map[string]string, len(message.Metadata)+1)
+	for key, value := range message.Metadata {
+		clone.Metadata[key] = value
+	}
+
+	clone.Metadata[ContentEncodingMetadataKey] = strings.ToLower(c.encoding())
+	return &clone, nil
+}
+
+// decompressDestination decompresses the payload of a decoded *Message.  Other destinations are ignored.
+func decompressDestination(destination interface{}, d *Decompression) error {
+	if message, ok := destination.(*Message); ok {
+		return DecompressPayload(message, d.maxPayloadSize())
+	}
+
+	return nil
+}
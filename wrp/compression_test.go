@@ -0,0 +1,248 @@
+package wrp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	var c *Compression
+	assert.Equal(GzipEncoding, c.encoding())
+	assert.Equal(DefaultCompressionThreshold, c.threshold())
+	assert.NoError(c.validate())
+
+	c = &Compression{Encoding: DeflateEncoding, Threshold: 16}
+	assert.Equal(DeflateEncoding, c.encoding())
+	assert.Equal(16, c.threshold())
+	assert.NoError(c.validate())
+
+	c.Encoding = "br"
+	assert.Equal(ErrorUnsupportedEncoding, c.validate())
+}
+
+func TestDecompressionDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	var d *Decompression
+	assert.Equal(DefaultMaxDecompressedSize, d.maxPayloadSize())
+
+	d = &Decompression{MaxPayloadSize: 16}
+	assert.Equal(16, d.maxPayloadSize())
+}
+
+func TestCompressPayload(t *testing.T) {
+	for _, encoding := range []string{GzipEncoding, DeflateEncoding, "GZIP"} {
+		t.Run(encoding, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+
+				payload = []byte(strings.Repeat("telemetry ", 100))
+				message = &Message{Type: SimpleEventMessageType, Payload: payload}
+			)
+
+			require.NoError(CompressPayload(message, encoding))
+			assert.Equal(strings.ToLower(encoding), message.Metadata[ContentEncodingMetadataKey])
+			assert.True(len(message.Payload) < len(payload))
+
+			// compressing again does nothing
+			compressed := message.Payload
+			require.NoError(CompressPayload(message, encoding))
+			assert.Equal(compressed, message.Payload)
+
+			require.NoError(DecompressPayload(message, 0))
+			assert.Equal(payload, message.Payload)
+			assert.Nil(message.Metadata)
+		})
+	}
+}
+
+func TestCompressPayloadEdgeCases(t *testing.T) {
+	assert := assert.New(t)
+
+	empty := new(Message)
+	assert.NoError(CompressPayload(empty, GzipEncoding))
+	assert.Nil(empty.Metadata)
+
+	message := &Message{Payload: []byte("payload")}
+	assert.Equal(ErrorUnsupportedEncoding, CompressPayload(message, "br"))
+	assert.Equal([]byte("payload"), message.Payload)
+
+	// other metadata is preserved
+	message.Metadata = map[string]string{"/key": "value"}
+	assert.NoError(CompressPayload(message, DeflateEncoding))
+	assert.NoError(DecompressPayload(message, 0))
+	assert.Equal(map[string]string{"/key": "value"}, message.Metadata)
+	assert.Equal([]byte("payload"), message.Payload)
+
+	// uncompressed messages are left alone
+	assert.NoError(DecompressPayload(message, 0))
+	assert.Equal([]byte("payload"), message.Payload)
+
+	// as are other encodings, which are passed through untouched
+	for _, encoding := range []string{IdentityEncoding, "br"} {
+		other := &Message{Payload: []byte("payload"), Metadata: map[string]string{ContentEncodingMetadataKey: encoding}}
+		assert.NoError(DecompressPayload(other, 0))
+		assert.Equal([]byte("payload"), other.Payload)
+		assert.Equal(encoding, other.Metadata[ContentEncodingMetadataKey])
+	}
+
+	corrupt := &Message{Payload: []byte("not gzip"), Metadata: map[string]string{ContentEncodingMetadataKey: GzipEncoding}}
+	assert.Error(DecompressPayload(corrupt, 0))
+	assert.Equal([]byte("not gzip"), corrupt.Payload)
+}
+
+func TestDecompressPayloadTooLarge(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		// a highly compressible payload, as with a decompression bomb
+		payload = make([]byte, 64*1024)
+		message = &Message{Type: SimpleEventMessageType, Payload: payload}
+	)
+
+	require.NoError(CompressPayload(message, GzipEncoding))
+	compressed := message.Payload
+	assert.True(len(compressed) < 1024)
+
+	assert.Equal(ErrorDecompressedTooLarge, DecompressPayload(message, len(payload)-1))
+	assert.Equal(compressed, message.Payload)
+	assert.Equal(GzipEncoding, message.Metadata[ContentEncodingMetadataKey])
+
+	// a payload of exactly the maximum size is allowed
+	require.NoError(DecompressPayload(message, len(payload)))
+	assert.Equal(payload, message.Payload)
+}
+
+func TestDecompressingDecoderPool(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		original = &Message{Type: SimpleEventMessageType, Payload: []byte(strings.Repeat("telemetry ", 100))}
+		encoded  []byte
+	)
+
+	encoderPool, err := NewCompressingEncoderPool(1, Msgpack, Compression{Threshold: 1})
+	require.NoError(err)
+	require.NoError(encoderPool.EncodeBytes(&encoded, original))
+
+	// decompression is opt-in, so an ordinary decoder pool leaves the payload compressed
+	var raw Message
+	require.NoError(NewDecoderPool(1, Msgpack).DecodeBytes(&raw, encoded))
+	assert.Equal(GzipEncoding, raw.Metadata[ContentEncodingMetadataKey])
+
+	var decoded Message
+	require.NoError(NewDecompressingDecoderPool(1, Msgpack, Decompression{}).DecodeBytes(&decoded, encoded))
+	assert.Equal(*original, decoded)
+
+	decoded = Message{}
+	assert.Equal(
+		ErrorDecompressedTooLarge,
+		NewDecompressingDecoderPool(1, Msgpack, Decompression{MaxPayloadSize: 100}).DecodeBytes(&decoded, encoded),
+	)
+}
+
+func TestCompressingEncoderPool(t *testing.T) {
+	for _, format := range []Format{Msgpack, JSON} {
+		t.Run(format.String(), func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+
+				large = []byte(strings.Repeat("telemetry ", 100))
+				small = []byte("small")
+
+				decoderPool = NewDecompressingDecoderPool(1, format, Decompression{})
+			)
+
+			encoderPool, err := NewCompressingEncoderPool(1, format, Compression{Threshold: 100})
+			require.NoError(err)
+			require.NotNil(encoderPool)
+
+			for _, payload := range [][]byte{large, small} {
+				var (
+					original = &Message{
+						Type:     SimpleEventMessageType,
+						Source:   "mac:112233445566",
+						Metadata: map[string]string{"/key": "value"},
+						Payload:  payload,
+					}
+
+					encoded []byte
+					buffer  bytes.Buffer
+				)
+
+				require.NoError(encoderPool.EncodeBytes(&encoded, original))
+				require.NoError(encoderPool.Encode(&buffer, original))
+
+				// the caller's message is never modified
+				assert.Equal(payload, original.Payload)
+				assert.Equal(map[string]string{"/key": "value"}, original.Metadata)
+
+				// a plain decoder sees the compressed form
+				var raw Message
+				require.NoError(NewDecoderBytes(encoded, format).Decode(&raw))
+				if len(payload) >= 100 {
+					assert.Equal(GzipEncoding, raw.Metadata[ContentEncodingMetadataKey])
+					assert.True(len(raw.Payload) < len(payload))
+				} else {
+					assert.NotContains(raw.Metadata, ContentEncodingMetadataKey)
+					assert.Equal(payload, raw.Payload)
+				}
+
+				// the decoder pool restores the original
+				var decoded Message
+				require.NoError(decoderPool.DecodeBytes(&decoded, encoded))
+				assert.Equal(*original, decoded)
+
+				decoded = Message{}
+				require.NoError(decoderPool.Decode(&decoded, &buffer))
+				assert.Equal(*original, decoded)
+			}
+		})
+	}
+}
+
+func TestCompressingEncoderPoolIncompressible(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		// a short payload grows when compressed, so it is sent as is
+		message = &Message{Type: SimpleEventMessageType, Payload: []byte("abcdefghij")}
+		encoded []byte
+	)
+
+	encoderPool, err := NewCompressingEncoderPool(1, Msgpack, Compression{Encoding: DeflateEncoding, Threshold: 1})
+	require.NoError(err)
+	require.NoError(encoderPool.EncodeBytes(&encoded, message))
+
+	var raw Message
+	require.NoError(NewDecoderBytes(encoded, Msgpack).Decode(&raw))
+	assert.Equal(message.Payload, raw.Payload)
+	assert.Empty(raw.Metadata)
+
+	// sources other than *Message are never compressed
+	event := &SimpleEvent{Source: "test", Destination: "event:test", Payload: []byte(strings.Repeat("x", 100))}
+	require.NoError(encoderPool.EncodeBytes(&encoded, event))
+
+	var decoded SimpleEvent
+	require.NoError(NewDecoderPool(1, Msgpack).DecodeBytes(&decoded, encoded))
+	assert.Equal(event.Payload, decoded.Payload)
+}
+
+func TestNewCompressingEncoderPoolInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	encoderPool, err := NewCompressingEncoderPool(1, Msgpack, Compression{Encoding: "br"})
+	assert.Nil(encoderPool)
+	assert.Equal(ErrorUnsupportedEncoding, err)
+}
@@ -0,0 +1,224 @@
+package wrp
+
+import "errors"
+
+var (
+	ErrMissingSource      = errors.New("Missing source")
+	ErrMissingDestination = errors.New("Missing destination")
+	ErrMissingPath        = errors.New("Missing path")
+	ErrMissingServiceName = errors.New("Missing service name")
+	ErrMissingURL         = errors.New("Missing URL")
+)
+
+// checkType produces an error if the actual message type is not one of the expected types
+func checkType(actual MessageType, expected ...MessageType) error {
+	for _, e := range expected {
+		if actual == e {
+			return nil
+		}
+	}
+
+	return ErrInvalidMsgType
+}
+
+// checkRouting verifies the fields common to all Routable messages
+func checkRouting(source, destination string) error {
+	if len(source) == 0 {
+		return ErrMissingSource
+	}
+
+	if len(destination) == 0 {
+		return ErrMissingDestination
+	}
+
+	return nil
+}
+
+// Validate checks that this message has the correct type and all required fields.
+func (msg *SimpleRequestResponse) Validate() error {
+	if err := checkType(msg.Type, SimpleRequestResponseMessageType); err != nil {
+		return err
+	}
+
+	return checkRouting(msg.Source, msg.Destination)
+}
+
+// FromMessage copies the fields of a generic Message into this instance, then validates the result.
+// Slices, maps, and pointers are shared with the source Message rather than copied.
+func (msg *SimpleRequestResponse) FromMessage(m *Message) error {
+	*msg = SimpleRequestResponse{
+		Type:                    m.Type,
+		Source:                  m.Source,
+		Destination:             m.Destination,
+		ContentType:             m.ContentType,
+		Accept:                  m.Accept,
+		TransactionUUID:         m.TransactionUUID,
+		Status:                  m.Status,
+		RequestDeliveryResponse: m.RequestDeliveryResponse,
+		Headers:                 m.Headers,
+		Metadata:                m.Metadata,
+		Spans:                   m.Spans,
+		IncludeSpans:            m.IncludeSpans,
+		Payload:                 m.Payload,
+		QualityOfService:        m.QualityOfService,
+	}
+
+	return msg.Validate()
+}
+
+// ToMessage produces a generic Message with the same fields as this instance.  The Type
+// of the returned Message is always SimpleRequestResponseMessageType.
+func (msg *SimpleRequestResponse) ToMessage() *Message {
+	return &Message{
+		Type:                    SimpleRequestResponseMessageType,
+		Source:                  msg.Source,
+		Destination:             msg.Destination,
+		ContentType:             msg.ContentType,
+		Accept:                  msg.Accept,
+		TransactionUUID:         msg.TransactionUUID,
+		Status:                  msg.Status,
+		RequestDeliveryResponse: msg.RequestDeliveryResponse,
+		Headers:                 msg.Headers,
+		Metadata:                msg.Metadata,
+		Spans:                   msg.Spans,
+		IncludeSpans:            msg.IncludeSpans,
+		Payload:                 msg.Payload,
+		QualityOfService:        msg.QualityOfService,
+	}
+}
+
+// Validate checks that this message has the correct type and all required fields.
+func (msg *SimpleEvent) Validate() error {
+	if err := checkType(msg.Type, SimpleEventMessageType); err != nil {
+		return err
+	}
+
+	return checkRouting(msg.Source, msg.Destination)
+}
+
+// FromMessage copies the fields of a generic Message into this instance, then validates the result.
+// Slices and maps are shared with the source Message rather than copied.
+func (msg *SimpleEvent) FromMessage(m *Message) error {
+	*msg = SimpleEvent{
+		Type:             m.Type,
+		Source:           m.Source,
+		Destination:      m.Destination,
+		ContentType:      m.ContentType,
+		Headers:          m.Headers,
+		Metadata:         m.Metadata,
+		Payload:          m.Payload,
+		QualityOfService: m.QualityOfService,
+	}
+
+	return msg.Validate()
+}
+
+// ToMessage produces a generic Message with the same fields as this instance.  The Type
+// of the returned Message is always SimpleEventMessageType.
+func (msg *SimpleEvent) ToMessage() *Message {
+	return &Message{
+		Type:             SimpleEventMessageType,
+		Source:           msg.Source,
+		Destination:      msg.Destination,
+		ContentType:      msg.ContentType,
+		Headers:          msg.Headers,
+		Metadata:         msg.Metadata,
+		Payload:          msg.Payload,
+		QualityOfService: msg.QualityOfService,
+	}
+}
+
+// Validate checks that this message has one of the CRUD types and all required fields.
+func (msg *CRUD) Validate() error {
+	if err := checkType(msg.Type, CreateMessageType, RetrieveMessageType, UpdateMessageType, DeleteMessageType); err != nil {
+		return err
+	}
+
+	if err := checkRouting(msg.Source, msg.Destination); err != nil {
+		return err
+	}
+
+	if len(msg.Path) == 0 {
+		return ErrMissingPath
+	}
+
+	return nil
+}
+
+// FromMessage copies the fields of a generic Message into this instance, then validates the result.
+// Slices, maps, and pointers are shared with the source Message rather than copied.
+func (msg *CRUD) FromMessage(m *Message) error {
+	*msg = CRUD{
+		Type:                    m.Type,
+		Source:                  m.Source,
+		Destination:             m.Destination,
+		TransactionUUID:         m.TransactionUUID,
+		Headers:                 m.Headers,
+		Metadata:                m.Metadata,
+		Spans:                   m.Spans,
+		IncludeSpans:            m.IncludeSpans,
+		Status:                  m.Status,
+		RequestDeliveryResponse: m.RequestDeliveryResponse,
+		Path:                    m.Path,
+		Objects:                 m.Objects,
+	}
+
+	return msg.Validate()
+}
+
+// ToMessage produces a generic Message with the same fields as this instance.  Since CRUD
+// covers several message types, the Type field is copied as is.
+func (msg *CRUD) ToMessage() *Message {
+	return &Message{
+		Type:                    msg.Type,
+		Source:                  msg.Source,
+		Destination:             msg.Destination,
+		TransactionUUID:         msg.TransactionUUID,
+		Headers:                 msg.Headers,
+		Metadata:                msg.Metadata,
+		Spans:                   msg.Spans,
+		IncludeSpans:            msg.IncludeSpans,
+		Status:                  msg.Status,
+		RequestDeliveryResponse: msg.RequestDeliveryResponse,
+		Path:                    msg.Path,
+		Objects:                 msg.Objects,
+	}
+}
+
+// Validate checks that this message has the correct type and all required fields.
+func (msg *ServiceRegistration) Validate() error {
+	if err := checkType(msg.Type, ServiceRegistrationMessageType); err != nil {
+		return err
+	}
+
+	if len(msg.ServiceName) == 0 {
+		return ErrMissingServiceName
+	}
+
+	if len(msg.URL) == 0 {
+		return ErrMissingURL
+	}
+
+	return nil
+}
+
+// FromMessage copies the fields of a generic Message into this instance, then validates the result.
+func (msg *ServiceRegistration) FromMessage(m *Message) error {
+	*msg = ServiceRegistration{
+		Type:        m.Type,
+		ServiceName: m.ServiceName,
+		URL:         m.URL,
+	}
+
+	return msg.Validate()
+}
+
+// ToMessage produces a generic Message with the same fields as this instance.  The Type
+// of the returned Message is always ServiceRegistrationMessageType.
+func (msg *ServiceRegistration) ToMessage() *Message {
+	return &Message{
+		Type:        ServiceRegistrationMessageType,
+		ServiceName: msg.ServiceName,
+		URL:         msg.URL,
+	}
+}
@@ -0,0 +1,165 @@
+package wrp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSimpleRequestResponseConversion(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		status       int64 = 200
+		rdr          int64 = 0
+		includeSpans       = true
+
+		testData = []struct {
+			message       Message
+			expectedError error
+		}{
+			{
+				Message{
+					Type:                    SimpleRequestResponseMessageType,
+					Source:                  "dns:external.com",
+					Destination:             "mac:112233445566",
+					ContentType:             "application/json",
+					Accept:                  "application/json",
+					TransactionUUID:         "DEADBEEF",
+					Status:                  &status,
+					RequestDeliveryResponse: &rdr,
+					Headers:                 []string{"X-Header-1"},
+					Metadata:                map[string]string{"foo": "bar"},
+					Spans:                   [][]string{[]string{"1", "2"}},
+					IncludeSpans:            &includeSpans,
+					Payload:                 []byte{1, 2, 3},
+					QualityOfService:        QOSCriticalValue,
+				},
+				nil,
+			},
+			{Message{Type: SimpleEventMessageType, Source: "a", Destination: "b"}, ErrInvalidMsgType},
+			{Message{Type: SimpleRequestResponseMessageType, Destination: "b"}, ErrMissingSource},
+			{Message{Type: SimpleRequestResponseMessageType, Source: "a"}, ErrMissingDestination},
+		}
+	)
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		var typed SimpleRequestResponse
+		assert.Equal(record.expectedError, typed.FromMessage(&record.message))
+		assert.Equal(record.message.Source, typed.Source)
+		assert.Equal(record.message.Destination, typed.Destination)
+
+		if record.expectedError == nil {
+			assert.Equal(&record.message, typed.ToMessage())
+		}
+	}
+}
+
+func TestSimpleEventConversion(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		testData = []struct {
+			message       Message
+			expectedError error
+		}{
+			{
+				Message{
+					Type:             SimpleEventMessageType,
+					Source:           "mac:112233445566",
+					Destination:      "event:device-status",
+					ContentType:      "application/json",
+					Headers:          []string{"X-Header-1"},
+					Metadata:         map[string]string{"foo": "bar"},
+					Payload:          []byte{1, 2, 3},
+					QualityOfService: QOSHighValue,
+				},
+				nil,
+			},
+			{Message{Type: SimpleRequestResponseMessageType, Source: "a", Destination: "b"}, ErrInvalidMsgType},
+			{Message{Type: SimpleEventMessageType, Destination: "b"}, ErrMissingSource},
+			{Message{Type: SimpleEventMessageType, Source: "a"}, ErrMissingDestination},
+		}
+	)
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		var typed SimpleEvent
+		assert.Equal(record.expectedError, typed.FromMessage(&record.message))
+
+		if record.expectedError == nil {
+			assert.Equal(&record.message, typed.ToMessage())
+		}
+	}
+}
+
+func TestCRUDConversion(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		status       int64 = 201
+		includeSpans       = false
+
+		testData = []struct {
+			message       Message
+			expectedError error
+		}{
+			{
+				Message{
+					Type:            CreateMessageType,
+					Source:          "dns:external.com",
+					Destination:     "mac:112233445566",
+					TransactionUUID: "DEADBEEF",
+					Headers:         []string{"X-Header-1"},
+					Metadata:        map[string]string{"foo": "bar"},
+					IncludeSpans:    &includeSpans,
+					Status:          &status,
+					Path:            "/foo/bar",
+					Objects:         "some objects",
+				},
+				nil,
+			},
+			{Message{Type: RetrieveMessageType, Source: "a", Destination: "b", Path: "/"}, nil},
+			{Message{Type: UpdateMessageType, Source: "a", Destination: "b", Path: "/"}, nil},
+			{Message{Type: DeleteMessageType, Source: "a", Destination: "b", Path: "/"}, nil},
+			{Message{Type: SimpleEventMessageType, Source: "a", Destination: "b", Path: "/"}, ErrInvalidMsgType},
+			{Message{Type: CreateMessageType, Destination: "b", Path: "/"}, ErrMissingSource},
+			{Message{Type: CreateMessageType, Source: "a", Path: "/"}, ErrMissingDestination},
+			{Message{Type: CreateMessageType, Source: "a", Destination: "b"}, ErrMissingPath},
+		}
+	)
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		var typed CRUD
+		assert.Equal(record.expectedError, typed.FromMessage(&record.message))
+
+		if record.expectedError == nil {
+			assert.Equal(&record.message, typed.ToMessage())
+		}
+	}
+}
+
+func TestServiceRegistrationConversion(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		testData = []struct {
+			message       Message
+			expectedError error
+		}{
+			{Message{Type: ServiceRegistrationMessageType, ServiceName: "config", URL: "tcp://127.0.0.1:1234"}, nil},
+			{Message{Type: ServiceAliveMessageType, ServiceName: "config", URL: "tcp://127.0.0.1:1234"}, ErrInvalidMsgType},
+			{Message{Type: ServiceRegistrationMessageType, URL: "tcp://127.0.0.1:1234"}, ErrMissingServiceName},
+			{Message{Type: ServiceRegistrationMessageType, ServiceName: "config"}, ErrMissingURL},
+		}
+	)
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		var typed ServiceRegistration
+		assert.Equal(record.expectedError, typed.FromMessage(&record.message))
+
+		if record.expectedError == nil {
+			assert.Equal(&record.message, typed.ToMessage())
+		}
+	}
+}
@@ -77,5 +77,14 @@ Some common uses of this package include:
 		return buffer.Bytes(), nil
 	}
 
+(5) Building generic messages and their responses:
+
+	request := NewSimpleRequestResponse("dns:myserver.com", "mac:112233445566", payload).
+		WithTransaction("a unique identifier").
+		WithContentType("application/json")
+
+	// the response is routed back to the request's source, with the same transaction
+	response := NewResponse(request, responsePayload).SetStatus(200)
+
 */
 package wrp
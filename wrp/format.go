@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"reflect"
+	"strings"
 
+	"github.com/Comcast/webpa-common/httperror"
 	"github.com/ugorji/go/codec"
 )
 
 // Format indicates which format is desired.
 // The zero value indicates Msgpack, which means by default other
-// infrastructure can assume msgpack-formatted data.
+// infrastructure can assume msgpack-formatted data.  Formats beyond
+// the builtin Msgpack and JSON can be added with RegisterFormat.
 type Format int
 
 const (
@@ -37,25 +41,45 @@ var (
 
 // ContentType returns the MIME type associated with this format
 func (f Format) ContentType() string {
+	formatRegistry.lock.RLock()
+	defer formatRegistry.lock.RUnlock()
+	return f.contentTypeLocked()
+}
+
+func (f Format) contentTypeLocked() string {
 	switch f {
 	case Msgpack:
 		return "application/msgpack"
 	case JSON:
 		return "application/json"
-	default:
-		return "application/octet-stream"
 	}
+
+	if rf, ok := f.registeredLocked(); ok {
+		return rf.factory.ContentType()
+	}
+
+	return "application/octet-stream"
 }
 
 func (f Format) String() string {
+	formatRegistry.lock.RLock()
+	defer formatRegistry.lock.RUnlock()
+	return f.stringLocked()
+}
+
+func (f Format) stringLocked() string {
 	switch f {
 	case Msgpack:
 		return "Msgpack"
 	case JSON:
 		return "JSON"
-	default:
-		return InvalidFormatString
 	}
+
+	if rf, ok := f.registeredLocked(); ok {
+		return rf.name
+	}
+
+	return InvalidFormatString
 }
 
 // handle looks up the appropriate codec.Handle for this format constant.
@@ -113,6 +137,10 @@ type Decoder interface {
 // NewEncoder produces a ugorji Encoder using the appropriate WRP configuration
 // for the given format
 func NewEncoder(output io.Writer, f Format) Encoder {
+	if rf, ok := f.registered(); ok {
+		return listenerEncoder{rf.factory.NewEncoder(output)}
+	}
+
 	return &encoderDecorator{
 		codec.NewEncoder(output, f.handle()),
 	}
@@ -121,6 +149,10 @@ func NewEncoder(output io.Writer, f Format) Encoder {
 // NewEncoderBytes produces a ugorji Encoder using the appropriate WRP configuration
 // for the given format
 func NewEncoderBytes(output *[]byte, f Format) Encoder {
+	if rf, ok := f.registered(); ok {
+		return listenerEncoder{rf.factory.NewEncoderBytes(output)}
+	}
+
 	return &encoderDecorator{
 		codec.NewEncoderBytes(output, f.handle()),
 	}
@@ -129,12 +161,20 @@ func NewEncoderBytes(output *[]byte, f Format) Encoder {
 // NewDecoder produces a ugorji Decoder using the appropriate WRP configuration
 // for the given format
 func NewDecoder(input io.Reader, f Format) Decoder {
+	if rf, ok := f.registered(); ok {
+		return rf.factory.NewDecoder(input)
+	}
+
 	return codec.NewDecoder(input, f.handle())
 }
 
 // NewDecoderBytes produces a ugorji Decoder using the appropriate WRP configuration
 // for the given format
 func NewDecoderBytes(input []byte, f Format) Decoder {
+	if rf, ok := f.registered(); ok {
+		return rf.factory.NewDecoderBytes(input)
+	}
+
 	return codec.NewDecoderBytes(input, f.handle())
 }
 
@@ -151,6 +191,54 @@ func TranscodeMessage(target Encoder, source Decoder) (msg *Message, err error)
 	return
 }
 
+// DefaultDecodeFormats is the order in which TryDecode attempts formats when none are supplied
+var DefaultDecodeFormats = []Format{Msgpack, JSON}
+
+// TryDecode decodes contents into a destination, such as a *Message, by attempting each format in order until
+// one succeeds.  If no formats are supplied, DefaultDecodeFormats is used.  The format which succeeded is returned.
+// This is useful when a single endpoint receives a mix of encodings, e.g. while device firmware migrates from
+// JSON to Msgpack.
+//
+// Before each attempt after the first, a pointer destination is reset to its zero value so that fields from a
+// failed attempt do not leak into the result.  If every format fails, the returned error describes each failure.
+func TryDecode(destination interface{}, contents []byte, formats ...Format) (Format, error) {
+	if len(formats) == 0 {
+		formats = DefaultDecodeFormats
+	}
+
+	failures := make([]string, 0, len(formats))
+	for i, f := range formats {
+		if !f.valid() {
+			failures = append(failures, fmt.Sprintf("%d: Invalid format", f))
+			continue
+		}
+
+		if i > 0 {
+			resetDestination(destination)
+		}
+
+		err := NewDecoderBytes(contents, f).Decode(destination)
+		if err == nil {
+			return f, nil
+		}
+
+		failures = append(failures, fmt.Sprintf("%s: %s", f, err))
+	}
+
+	resetDestination(destination)
+	return Format(-1), httperror.New(
+		httperror.InvalidWRPFormat,
+		fmt.Sprintf("Unable to decode WRP contents [%s]", strings.Join(failures, ", ")),
+	)
+}
+
+// resetDestination sets the value a decode destination points to back to its zero value
+func resetDestination(destination interface{}) {
+	if v := reflect.ValueOf(destination); v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+}
+
 // MustEncode is a convenience function that attempts to encode a given message.  A panic
 // is raised on any error.  This function is handy for package initialization.
 func MustEncode(message interface{}, f Format) []byte {
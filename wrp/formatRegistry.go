@@ -0,0 +1,174 @@
+package wrp
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/ugorji/go/codec"
+)
+
+var (
+	ErrorInvalidFormatFactory    = errors.New("A format requires a name and a FormatFactory")
+	ErrorFormatAlreadyRegistered = errors.New("A format with that name is already registered")
+	ErrorContentTypeAlreadyInUse = errors.New("A format with that content type is already registered")
+)
+
+// FormatFactory creates the encoders and decoders for a WRP format registered with RegisterFormat.
+// Implementations must be safe for concurrent use.
+type FormatFactory interface {
+	// ContentType is the MIME type of messages in this format, e.g. "application/cbor"
+	ContentType() string
+
+	NewEncoder(io.Writer) Encoder
+	NewEncoderBytes(*[]byte) Encoder
+	NewDecoder(io.Reader) Decoder
+	NewDecoderBytes([]byte) Decoder
+}
+
+// codecFormat is a FormatFactory backed by a ugorji codec.Handle
+type codecFormat struct {
+	contentType string
+	handle      codec.Handle
+}
+
+// NewCodecFormat returns a FormatFactory for any ugorji codec.Handle, such as a codec.CborHandle.  So that
+// WRP messages are encoded with their usual field names, the handle's TypeInfos should be created with
+// codec.NewTypeInfos([]string{"wrp"}).
+func NewCodecFormat(contentType string, h codec.Handle) FormatFactory {
+	return codecFormat{contentType: contentType, handle: h}
+}
+
+func (cf codecFormat) ContentType() string {
+	return cf.contentType
+}
+
+func (cf codecFormat) NewEncoder(output io.Writer) Encoder {
+	return codec.NewEncoder(output, cf.handle)
+}
+
+func (cf codecFormat) NewEncoderBytes(output *[]byte) Encoder {
+	return codec.NewEncoderBytes(output, cf.handle)
+}
+
+func (cf codecFormat) NewDecoder(input io.Reader) Decoder {
+	return codec.NewDecoder(input, cf.handle)
+}
+
+func (cf codecFormat) NewDecoderBytes(input []byte) Decoder {
+	return codec.NewDecoderBytes(input, cf.handle)
+}
+
+// listenerEncoder gives the Encoders of registered formats the same EncodeListener semantics as the builtin formats
+type listenerEncoder struct {
+	Encoder
+}
+
+func (le listenerEncoder) Encode(value interface{}) error {
+	if listener, ok := value.(EncodeListener); ok {
+		if err := listener.BeforeEncode(); err != nil {
+			return err
+		}
+	}
+
+	return le.Encoder.Encode(value)
+}
+
+// registeredFormat is a format added with RegisterFormat
+type registeredFormat struct {
+	name    string
+	factory FormatFactory
+}
+
+// formatRegistry holds the registered formats, which are numbered consecutively after the builtin formats
+var formatRegistry struct {
+	lock    sync.RWMutex
+	formats []registeredFormat
+}
+
+// firstRegisteredFormat is the Format value assigned to the first registered format
+const firstRegisteredFormat = JSON + 1
+
+// RegisterFormat adds a new WRP format, returning the Format value that identifies it.  Once registered, the
+// format can be used anywhere a builtin format can, such as with NewEncoder, NewDecoder, and the pools.  Names and
+// content types must be unique, ignoring case, among all formats including Msgpack and JSON.  Formats cannot be
+// unregistered, so this function is typically called during initialization.
+func RegisterFormat(name string, factory FormatFactory) (Format, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 || factory == nil {
+		return Format(-1), ErrorInvalidFormatFactory
+	}
+
+	formatRegistry.lock.Lock()
+	defer formatRegistry.lock.Unlock()
+
+	for _, f := range formatsLocked() {
+		if strings.EqualFold(name, f.stringLocked()) {
+			return Format(-1), ErrorFormatAlreadyRegistered
+		} else if strings.EqualFold(factory.ContentType(), f.contentTypeLocked()) {
+			return Format(-1), ErrorContentTypeAlreadyInUse
+		}
+	}
+
+	formatRegistry.formats = append(formatRegistry.formats, registeredFormat{name: name, factory: factory})
+	return firstRegisteredFormat + Format(len(formatRegistry.formats)-1), nil
+}
+
+// Formats returns all the available formats, starting with the builtin formats followed by
+// the registered formats in the order they were registered
+func Formats() []Format {
+	formatRegistry.lock.RLock()
+	defer formatRegistry.lock.RUnlock()
+	return formatsLocked()
+}
+
+// FormatByName returns the format with the given name, ignoring case, e.g. "msgpack".  The second
+// return value is false if there is no such format.
+func FormatByName(name string) (Format, bool) {
+	formatRegistry.lock.RLock()
+	defer formatRegistry.lock.RUnlock()
+
+	for _, f := range formatsLocked() {
+		if strings.EqualFold(name, f.stringLocked()) {
+			return f, true
+		}
+	}
+
+	return Format(-1), false
+}
+
+// formatsLocked returns all the available formats.  This function must be called under the registry lock.
+func formatsLocked() []Format {
+	all := []Format{Msgpack, JSON}
+	for i := range formatRegistry.formats {
+		all = append(all, firstRegisteredFormat+Format(i))
+	}
+
+	return all
+}
+
+// valid tests if this format is either a builtin format or was added with RegisterFormat
+func (f Format) valid() bool {
+	if f == Msgpack || f == JSON {
+		return true
+	}
+
+	_, ok := f.registered()
+	return ok
+}
+
+// registered returns the registration of this format, if it was added with RegisterFormat
+func (f Format) registered() (registeredFormat, bool) {
+	formatRegistry.lock.RLock()
+	defer formatRegistry.lock.RUnlock()
+	return f.registeredLocked()
+}
+
+func (f Format) registeredLocked() (registeredFormat, bool) {
+	if index := int(f - firstRegisteredFormat); index >= 0 && index < len(formatRegistry.formats) {
+		return formatRegistry.formats[index], true
+	}
+
+	return registeredFormat{}, false
+}
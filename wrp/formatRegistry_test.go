@@ -0,0 +1,138 @@
+package wrp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+)
+
+// testCBOR is registered once per test binary, since formats cannot be unregistered
+var testCBOR = func() Format {
+	f, err := RegisterFormat("CBOR", NewCodecFormat("application/cbor", &codec.CborHandle{
+		BasicHandle: codec.BasicHandle{
+			TypeInfos: codec.NewTypeInfos([]string{"wrp"}),
+		},
+	}))
+
+	if err != nil {
+		panic(err)
+	}
+
+	return f
+}()
+
+func TestRegisterFormatInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := RegisterFormat("", NewCodecFormat("application/x-empty", new(codec.CborHandle)))
+	assert.Equal(ErrorInvalidFormatFactory, err)
+
+	_, err = RegisterFormat("Nil", nil)
+	assert.Equal(ErrorInvalidFormatFactory, err)
+
+	_, err = RegisterFormat("msgpack", NewCodecFormat("application/x-another-msgpack", new(codec.MsgpackHandle)))
+	assert.Equal(ErrorFormatAlreadyRegistered, err)
+
+	_, err = RegisterFormat("cbor", NewCodecFormat("application/x-another-cbor", new(codec.CborHandle)))
+	assert.Equal(ErrorFormatAlreadyRegistered, err)
+
+	_, err = RegisterFormat("AnotherJSON", NewCodecFormat("Application/JSON", new(codec.JsonHandle)))
+	assert.Equal(ErrorContentTypeAlreadyInUse, err)
+
+	assert.Equal([]Format{Msgpack, JSON, testCBOR}, Formats())
+}
+
+func TestRegisteredFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(firstRegisteredFormat, testCBOR)
+	assert.Equal("CBOR", testCBOR.String())
+	assert.Equal("application/cbor", testCBOR.ContentType())
+	assert.True(testCBOR.valid())
+	assert.True(Msgpack.valid())
+	assert.False(Format(999).valid())
+	assert.False(Format(-1).valid())
+
+	for name, expected := range map[string]Format{"cbor": testCBOR, "MSGPACK": Msgpack, "json": JSON} {
+		actual, ok := FormatByName(name)
+		assert.True(ok)
+		assert.Equal(expected, actual)
+	}
+
+	_, ok := FormatByName("protobuf")
+	assert.False(ok)
+}
+
+func TestRegisteredFormatEncoding(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		original = Message{
+			Type:            SimpleRequestResponseMessageType,
+			Source:          "dns:somewhere.com",
+			Destination:     "mac:112233445566",
+			TransactionUUID: "a unique identifier",
+			Payload:         []byte("payload"),
+		}
+	)
+
+	var output bytes.Buffer
+	require.NoError(NewEncoder(&output, testCBOR).Encode(&original))
+
+	decoded := new(Message)
+	require.NoError(NewDecoder(&output, testCBOR).Decode(decoded))
+	assert.Equal(original, *decoded)
+
+	var encoded []byte
+	require.NoError(NewEncoderBytes(&encoded, testCBOR).Encode(&original))
+	assert.NotEqual(MustEncode(&original, Msgpack), encoded)
+
+	decoded = new(Message)
+	require.NoError(NewDecoderBytes(encoded, testCBOR).Decode(decoded))
+	assert.Equal(original, *decoded)
+
+	// registered formats can be transcoded to and from the builtin formats
+	var transcoded bytes.Buffer
+	message, err := TranscodeMessage(NewEncoder(&transcoded, JSON), NewDecoderBytes(encoded, testCBOR))
+	require.NoError(err)
+	assert.Equal(original, *message)
+	assert.Contains(transcoded.String(), "a unique identifier")
+}
+
+func TestRegisteredFormatPools(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		original = &SimpleEvent{Source: "mac:112233445566", Destination: "event:test", Payload: []byte("payload")}
+
+		encoders = NewEncoderPool(1, testCBOR)
+		decoders = NewDecoderPool(1, testCBOR)
+		encoded  []byte
+	)
+
+	assert.Equal(testCBOR, encoders.Format())
+	assert.Equal(testCBOR, decoders.Format())
+	require.NoError(encoders.EncodeBytes(&encoded, original))
+
+	decoded := new(SimpleEvent)
+	require.NoError(decoders.DecodeBytes(decoded, encoded))
+	assert.Equal(original, decoded)
+}
+
+func TestRegisteredFormatEncodeListener(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		message = new(mockEncodeListener)
+	)
+
+	message.On("BeforeEncode").Once().Return(errors.New("expected"))
+	assert.Panics(func() {
+		MustEncode(message, testCBOR)
+	})
+
+	message.AssertExpectations(t)
+}
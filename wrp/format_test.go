@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/Comcast/webpa-common/httperror"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -261,3 +262,71 @@ func TestTranscodeMessage(t *testing.T) {
 		}
 	}
 }
+
+func TestTryDecode(t *testing.T) {
+	original := &Message{
+		Type:        SimpleEventMessageType,
+		Source:      "mac:112233445566",
+		Destination: "event:device-status",
+		Metadata:    map[string]string{"firmware": "1.2.3"},
+		Payload:     []byte("hi!"),
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		for _, f := range []Format{Msgpack, JSON} {
+			t.Run(f.String(), func(t *testing.T) {
+				var (
+					assert  = assert.New(t)
+					decoded Message
+				)
+
+				actual, err := TryDecode(&decoded, MustEncode(original, f))
+				assert.NoError(err)
+				assert.Equal(f, actual)
+				assert.Equal(*original, decoded)
+			})
+		}
+	})
+
+	t.Run("ExplicitOrder", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			decoded Message
+		)
+
+		actual, err := TryDecode(&decoded, MustEncode(original, JSON), JSON, Msgpack)
+		assert.NoError(err)
+		assert.Equal(JSON, actual)
+		assert.Equal(*original, decoded)
+	})
+
+	t.Run("InvalidFormat", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			decoded Message
+		)
+
+		actual, err := TryDecode(&decoded, MustEncode(original, Msgpack), Format(-1), Msgpack)
+		assert.NoError(err)
+		assert.Equal(Msgpack, actual)
+		assert.Equal(*original, decoded)
+	})
+
+	t.Run("NoFormatSucceeds", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			decoded = Message{Source: "leftover"}
+		)
+
+		actual, err := TryDecode(&decoded, MustEncode(original, JSON), Msgpack)
+		assert.Error(err)
+		assert.Equal(Format(-1), actual)
+		assert.Equal(Message{}, decoded)
+
+		actual, err = TryDecode(&decoded, []byte("this is not WRP"))
+		assert.Error(err)
+		assert.Equal(httperror.InvalidWRPFormat, httperror.KindOf(err))
+		assert.Equal(Format(-1), actual)
+		assert.Equal(Message{}, decoded)
+	})
+}
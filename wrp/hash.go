@@ -0,0 +1,161 @@
+package wrp
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"sort"
+)
+
+// Hashing describes how the canonical content hash of a Message is computed.  The hash covers what a
+// Message says rather than how it was delivered, so the same logical message hashes identically no matter
+// which Format it was encoded in or how many times it was retried.  This makes the hash suitable as an
+// idempotency key, e.g. for deduplication.
+//
+// The delivery fields Spans, IncludeSpans, RequestDeliveryResponse, and QualityOfService are never part of
+// the hash, nor are any metadata keys listed in ExcludedMetadata.  The order of metadata is irrelevant, and
+// absent and empty values of headers, metadata, and payload are treated the same, since formats differ in
+// how they represent them.
+type Hashing struct {
+	// ExcludedMetadata holds metadata keys whose values vary between deliveries of the same logical message,
+	// such as timestamps or trace identifiers
+	ExcludedMetadata []string `json:"excludedMetadata,omitempty"`
+}
+
+func (h *Hashing) excluded(key string) bool {
+	if h != nil {
+		for _, candidate := range h.ExcludedMetadata {
+			if key == candidate {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// hashField tags identify each field in the canonical form, so that values cannot be confused with one another
+const (
+	hashType byte = iota + 1
+	hashSource
+	hashDestination
+	hashTransactionUUID
+	hashContentType
+	hashAccept
+	hashStatus
+	hashHeaders
+	hashMetadata
+	hashPath
+	hashObjects
+	hashPayload
+	hashServiceName
+	hashURL
+)
+
+// hashWriter writes the canonical form of a Message.  Every value is length-prefixed, so distinct
+// messages cannot produce the same sequence of bytes.
+type hashWriter struct {
+	hash.Hash
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (w *hashWriter) writeUvarint(value uint64) {
+	n := binary.PutUvarint(w.scratch[:], value)
+	w.Write(w.scratch[:n])
+}
+
+func (w *hashWriter) writeBytes(value []byte) {
+	w.writeUvarint(uint64(len(value)))
+	w.Write(value)
+}
+
+func (w *hashWriter) writeString(value string) {
+	w.writeBytes([]byte(value))
+}
+
+// writeField writes a tagged string field, omitting it entirely when empty
+func (w *hashWriter) writeField(tag byte, value string) {
+	if len(value) > 0 {
+		w.Write([]byte{tag})
+		w.writeString(value)
+	}
+}
+
+// Sum returns the SHA-256 content hash of the given Message.  A nil Message has no hash.
+func (h *Hashing) Sum(msg *Message) []byte {
+	if msg == nil {
+		return nil
+	}
+
+	w := hashWriter{Hash: sha256.New()}
+	w.Write([]byte{hashType})
+	w.writeUvarint(uint64(msg.Type))
+	w.writeField(hashSource, msg.Source)
+	w.writeField(hashDestination, msg.Destination)
+	w.writeField(hashTransactionUUID, msg.TransactionUUID)
+	w.writeField(hashContentType, msg.ContentType)
+	w.writeField(hashAccept, msg.Accept)
+
+	if msg.Status != nil {
+		w.Write([]byte{hashStatus})
+		w.writeUvarint(uint64(*msg.Status))
+	}
+
+	if len(msg.Headers) > 0 {
+		w.Write([]byte{hashHeaders})
+		w.writeUvarint(uint64(len(msg.Headers)))
+		for _, header := range msg.Headers {
+			w.writeString(header)
+		}
+	}
+
+	keys := make([]string, 0, len(msg.Metadata))
+	for key := range msg.Metadata {
+		if !h.excluded(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) > 0 {
+		sort.Strings(keys)
+		w.Write([]byte{hashMetadata})
+		w.writeUvarint(uint64(len(keys)))
+		for _, key := range keys {
+			w.writeString(key)
+			w.writeString(msg.Metadata[key])
+		}
+	}
+
+	w.writeField(hashPath, msg.Path)
+	w.writeField(hashObjects, msg.Objects)
+	if len(msg.Payload) > 0 {
+		w.Write([]byte{hashPayload})
+		w.writeBytes(msg.Payload)
+	}
+
+	w.writeField(hashServiceName, msg.ServiceName)
+	w.writeField(hashURL, msg.URL)
+	return w.Sum(nil)
+}
+
+// Key returns the content hash of the given Message as a hex string, suitable for use as an idempotency
+// key.  A nil Message has an empty key.
+func (h *Hashing) Key(msg *Message) string {
+	if msg == nil {
+		return ""
+	}
+
+	return hex.EncodeToString(h.Sum(msg))
+}
+
+// ContentHash returns the SHA-256 content hash of a Message using the default Hashing, which excludes
+// no metadata
+func ContentHash(msg *Message) []byte {
+	return (*Hashing)(nil).Sum(msg)
+}
+
+// IdempotencyKey returns the content hash of a Message, using the default Hashing, as a hex string
+func IdempotencyKey(msg *Message) string {
+	return (*Hashing)(nil).Key(msg)
+}
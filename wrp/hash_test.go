@@ -0,0 +1,213 @@
+package wrp
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newHashTestMessage() *Message {
+	var (
+		status       int64 = 200
+		rdr          int64 = 1
+		includeSpans       = true
+	)
+
+	return &Message{
+		Type:                    SimpleRequestResponseMessageType,
+		Source:                  "dns:talaria.example.com",
+		Destination:             "mac:112233445566/config",
+		TransactionUUID:         "DEADBEEF",
+		ContentType:             "application/json",
+		Accept:                  "application/json",
+		Status:                  &status,
+		RequestDeliveryResponse: &rdr,
+		Headers:                 []string{"X-First: 1", "X-Second: 2"},
+		Metadata:                map[string]string{"/boot-time": "1234", "/trace": "abc"},
+		Spans:                   [][]string{{"span", "1", "2"}},
+		IncludeSpans:            &includeSpans,
+		Path:                    "/config",
+		Objects:                 "objects",
+		Payload:                 []byte(`{"key": "value"}`),
+		ServiceName:             "config",
+		URL:                     "http://example.com",
+		QualityOfService:        75,
+	}
+}
+
+func TestHashingDefaults(t *testing.T) {
+	assert := assert.New(t)
+	for _, h := range []*Hashing{nil, new(Hashing)} {
+		assert.False(h.excluded("/trace"))
+		assert.Nil(h.Sum(nil))
+		assert.Empty(h.Key(nil))
+	}
+}
+
+func TestHashingSum(t *testing.T) {
+	expected := ContentHash(newHashTestMessage())
+
+	t.Run("Stable", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Len(expected, 32)
+		assert.Equal(expected, ContentHash(newHashTestMessage()))
+		assert.Equal(hex.EncodeToString(expected), IdempotencyKey(newHashTestMessage()))
+	})
+
+	t.Run("Volatile", func(t *testing.T) {
+		assert := assert.New(t)
+		message := newHashTestMessage()
+		message.Spans = nil
+		message.IncludeSpans = nil
+		message.RequestDeliveryResponse = nil
+		message.QualityOfService = 0
+		assert.Equal(expected, ContentHash(message))
+	})
+
+	t.Run("ExcludedMetadata", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			hashing = &Hashing{ExcludedMetadata: []string{"/trace"}}
+			message = newHashTestMessage()
+		)
+
+		message.Metadata["/trace"] = "different"
+		assert.NotEqual(expected, ContentHash(message))
+		assert.Equal(hashing.Sum(newHashTestMessage()), hashing.Sum(message))
+
+		delete(message.Metadata, "/trace")
+		assert.Equal(hashing.Sum(newHashTestMessage()), hashing.Sum(message))
+		assert.NotEqual(expected, hashing.Sum(message))
+	})
+
+	t.Run("Content", func(t *testing.T) {
+		var (
+			assert     = assert.New(t)
+			statusZero int64
+			changes    = []func(*Message){
+				func(m *Message) { m.Type = SimpleEventMessageType },
+				func(m *Message) { m.Source = "dns:other.example.com" },
+				func(m *Message) { m.Destination = "mac:112233445566/other" },
+				func(m *Message) { m.TransactionUUID = "CAFEBABE" },
+				func(m *Message) { m.ContentType = "text/plain" },
+				func(m *Message) { m.Accept = "" },
+				func(m *Message) { m.Status = nil },
+				func(m *Message) { m.Status = &statusZero },
+				func(m *Message) { m.Headers = m.Headers[:1] },
+				func(m *Message) { m.Headers[0], m.Headers[1] = m.Headers[1], m.Headers[0] },
+				func(m *Message) { m.Metadata["/boot-time"] = "5678" },
+				func(m *Message) { m.Metadata["/new"] = "" },
+				func(m *Message) { m.Path = "" },
+				func(m *Message) { m.Objects = "other" },
+				func(m *Message) { m.Payload = append(m.Payload, ' ') },
+				func(m *Message) { m.ServiceName = "other" },
+				func(m *Message) { m.URL = "http://other.example.com" },
+			}
+
+			seen = map[string]int{IdempotencyKey(newHashTestMessage()): -1}
+		)
+
+		for i, change := range changes {
+			message := newHashTestMessage()
+			change(message)
+
+			key := IdempotencyKey(message)
+			previous, collided := seen[key]
+			assert.False(collided, "change %d collides with change %d", i, previous)
+			seen[key] = i
+		}
+	})
+
+	t.Run("Boundaries", func(t *testing.T) {
+		assert := assert.New(t)
+
+		// values are length-prefixed and tagged, so moving bytes between fields changes the hash
+		assert.NotEqual(
+			ContentHash(&Message{Source: "ab", Destination: "c"}),
+			ContentHash(&Message{Source: "a", Destination: "bc"}),
+		)
+
+		assert.NotEqual(
+			ContentHash(&Message{Source: "a"}),
+			ContentHash(&Message{Destination: "a"}),
+		)
+
+		assert.NotEqual(
+			ContentHash(&Message{Headers: []string{"a", "b"}}),
+			ContentHash(&Message{Headers: []string{"ab"}}),
+		)
+
+		assert.NotEqual(
+			ContentHash(&Message{Metadata: map[string]string{"a": "bc"}}),
+			ContentHash(&Message{Metadata: map[string]string{"ab": "c"}}),
+		)
+
+		// absent and empty values are the same
+		assert.Equal(
+			ContentHash(&Message{}),
+			ContentHash(&Message{Headers: []string{}, Metadata: map[string]string{}, Payload: []byte{}}),
+		)
+	})
+}
+
+func TestHashingAcrossFormats(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		expected = ContentHash(newHashTestMessage())
+	)
+
+	for _, f := range []Format{Msgpack, JSON} {
+		t.Logf("format: %s", f)
+
+		var decoded Message
+		require.NoError(NewDecoderBytes(MustEncode(newHashTestMessage(), f), f).Decode(&decoded))
+		assert.Equal(expected, ContentHash(&decoded))
+
+		// transcoding to the other formats preserves the hash
+		for _, target := range []Format{Msgpack, JSON} {
+			var (
+				transcoded []byte
+				message    Message
+			)
+
+			_, err := TranscodeMessage(NewEncoderBytes(&transcoded, target), NewDecoderBytes(MustEncode(newHashTestMessage(), f), f))
+			require.NoError(err)
+			require.NoError(NewDecoderBytes(transcoded, target).Decode(&message))
+			assert.Equal(expected, ContentHash(&message))
+		}
+	}
+
+	// a specific message type encodes to the same content as its equivalent Message
+	var (
+		status int64 = 200
+		simple       = SimpleRequestResponse{
+			Source:          "dns:talaria.example.com",
+			Destination:     "mac:112233445566/config",
+			TransactionUUID: "DEADBEEF",
+			ContentType:     "application/json",
+			Status:          &status,
+			Payload:         []byte("payload"),
+		}
+
+		fromMsgpack Message
+		fromJSON    Message
+	)
+
+	require.NoError(NewDecoderBytes(MustEncode(&simple, Msgpack), Msgpack).Decode(&fromMsgpack))
+	require.NoError(NewDecoderBytes(MustEncode(&simple, JSON), JSON).Decode(&fromJSON))
+	assert.Equal(ContentHash(&fromMsgpack), ContentHash(&fromJSON))
+	assert.Equal(
+		ContentHash(&Message{
+			Type:            SimpleRequestResponseMessageType,
+			Source:          simple.Source,
+			Destination:     simple.Destination,
+			TransactionUUID: simple.TransactionUUID,
+			ContentType:     simple.ContentType,
+			Status:          &status,
+			Payload:         simple.Payload,
+		}),
+		ContentHash(&fromMsgpack),
+	)
+}
@@ -121,6 +121,7 @@ type Message struct {
 	Payload                 []byte            `wrp:"payload,omitempty"`
 	ServiceName             string            `wrp:"service_name,omitempty"`
 	URL                     string            `wrp:"url,omitempty"`
+	QualityOfService        QOSValue          `wrp:"qos,omitempty"`
 }
 
 func (msg *Message) MessageType() MessageType {
@@ -149,6 +150,18 @@ func (msg *Message) Response(newSource string, requestDeliveryResponse int64) Ro
 	return &response
 }
 
+// String renders this message for logging via the DefaultRedaction, so that %v never dumps
+// an entire payload or sensitive metadata.
+func (msg *Message) String() string {
+	return DefaultRedaction().String(msg)
+}
+
+// LogValue returns the key/value pairs that describe this message to a logging.StructuredLogger,
+// redacted via the DefaultRedaction, e.g. logger.Info("message received", msg.LogValue()...)
+func (msg *Message) LogValue() []interface{} {
+	return DefaultRedaction().Keyvals(msg)
+}
+
 // SetStatus simplifies setting the optional Status field, which is a pointer type tagged with omitempty.
 func (msg *Message) SetStatus(value int64) *Message {
 	msg.Status = &value
@@ -205,6 +218,7 @@ type SimpleRequestResponse struct {
 	Spans                   [][]string        `wrp:"spans,omitempty"`
 	IncludeSpans            *bool             `wrp:"include_spans,omitempty"`
 	Payload                 []byte            `wrp:"payload,omitempty"`
+	QualityOfService        QOSValue          `wrp:"qos,omitempty"`
 }
 
 // SetStatus simplifies setting the optional Status field, which is a pointer type tagged with omitempty.
@@ -266,13 +280,14 @@ func (msg *SimpleRequestResponse) Response(newSource string, requestDeliveryResp
 type SimpleEvent struct {
 	// Type is exposed principally for encoding.  This field *must* be set to SimpleEventMessageType,
 	// and is automatically set by the BeforeEncode method.
-	Type        MessageType       `wrp:"msg_type"`
-	Source      string            `wrp:"source"`
-	Destination string            `wrp:"dest"`
-	ContentType string            `wrp:"content_type,omitempty"`
-	Headers     []string          `wrp:"headers,omitempty"`
-	Metadata    map[string]string `wrp:"metadata,omitempty"`
-	Payload     []byte            `wrp:"payload,omitempty"`
+	Type             MessageType       `wrp:"msg_type"`
+	Source           string            `wrp:"source"`
+	Destination      string            `wrp:"dest"`
+	ContentType      string            `wrp:"content_type,omitempty"`
+	Headers          []string          `wrp:"headers,omitempty"`
+	Metadata         map[string]string `wrp:"metadata,omitempty"`
+	Payload          []byte            `wrp:"payload,omitempty"`
+	QualityOfService QOSValue          `wrp:"qos,omitempty"`
 }
 
 func (msg *SimpleEvent) BeforeEncode() error {
@@ -171,6 +171,13 @@ func TestMessage(t *testing.T) {
 				Spans:           [][]string{[]string{"1", "2"}, []string{"3"}},
 				Payload:         []byte{1, 2, 3, 4, 0xff, 0xce},
 			},
+			Message{
+				Type:             SimpleRequestResponseMessageType,
+				Source:           "external.com",
+				Destination:      "mac:FFEEAADD44443333/reboot",
+				TransactionUUID:  "reboot-1",
+				QualityOfService: QOSCriticalValue,
+			},
 			Message{
 				Type:        CreateMessageType,
 				Source:      "wherever.webpa.comcast.net/glorious",
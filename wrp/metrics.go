@@ -0,0 +1,106 @@
+package wrp
+
+import (
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// PoolGetCounter is the total number of encoders or decoders obtained from pools
+	PoolGetCounter = "wrp_pool_get_count"
+
+	// PoolMissCounter is the total number of encoders or decoders that had to be created because a pool was empty
+	PoolMissCounter = "wrp_pool_miss_count"
+
+	// PoolDiscardCounter is the total number of encoders or decoders discarded because a pool was full
+	PoolDiscardCounter = "wrp_pool_discard_count"
+
+	// PoolSizeGauge is the current maximum number of idle encoders or decoders held by pools
+	PoolSizeGauge = "wrp_pool_size"
+
+	// PayloadChecksumCounter is the total number of payload checksums computed by encoder pools or verified by decoder pools
+	PayloadChecksumCounter = "wrp_payload_checksum_count"
+
+	// PoolLabel is the label identifying the kind of pool, either "encoder" or "decoder"
+	PoolLabel = "pool"
+
+	// FormatLabel is the label identifying a pool's Format
+	FormatLabel = "format"
+
+	// ChecksumOutcomeLabel is the label identifying what happened to a payload checksum
+	ChecksumOutcomeLabel = "outcome"
+
+	// ChecksumComputed is the outcome for a checksum computed by an encoder pool
+	ChecksumComputed = "computed"
+
+	// ChecksumValid is the outcome for a payload which matched its checksum
+	ChecksumValid = "valid"
+
+	// ChecksumCorrupt is the outcome for a payload which did not match its checksum
+	ChecksumCorrupt = "corrupt"
+
+	// ChecksumInvalid is the outcome for a checksum which was malformed or used an unsupported algorithm
+	ChecksumInvalid = "invalid"
+)
+
+// Metrics is the xmetrics.Module for this package
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name:       PoolGetCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of encoders or decoders obtained from pools",
+			LabelNames: []string{PoolLabel, FormatLabel},
+		},
+		{
+			Name:       PoolMissCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of encoders or decoders created because a pool was empty",
+			LabelNames: []string{PoolLabel, FormatLabel},
+		},
+		{
+			Name:       PoolDiscardCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of encoders or decoders discarded because a pool was full",
+			LabelNames: []string{PoolLabel, FormatLabel},
+		},
+		{
+			Name:       PoolSizeGauge,
+			Type:       xmetrics.GaugeType,
+			Help:       "The current maximum number of idle encoders or decoders held by pools",
+			LabelNames: []string{PoolLabel, FormatLabel},
+		},
+		{
+			Name:       PayloadChecksumCounter,
+			Type:       xmetrics.CounterType,
+			Help:       "The total number of payload checksums computed or verified by pools",
+			LabelNames: []string{PoolLabel, FormatLabel, ChecksumOutcomeLabel},
+		},
+	}
+}
+
+// poolMeasures is the set of metrics updated by a single pool
+type poolMeasures struct {
+	get     metrics.Counter
+	miss    metrics.Counter
+	discard metrics.Counter
+	size    metrics.Gauge
+
+	// checksum is labelled with ChecksumOutcomeLabel as each checksum is computed or verified
+	checksum metrics.Counter
+}
+
+func newPoolMeasures(p xmetrics.Provider, pool string, f Format) poolMeasures {
+	if p == nil {
+		p = xmetrics.NewDiscardProvider()
+	}
+
+	labelValues := []string{PoolLabel, pool, FormatLabel, f.String()}
+	return poolMeasures{
+		get:      p.NewCounter(PoolGetCounter).With(labelValues...),
+		miss:     p.NewCounter(PoolMissCounter).With(labelValues...),
+		discard:  p.NewCounter(PoolDiscardCounter).With(labelValues...),
+		size:     p.NewGauge(PoolSizeGauge).With(labelValues...),
+		checksum: p.NewCounter(PayloadChecksumCounter).With(labelValues...),
+	}
+}
@@ -0,0 +1,357 @@
+package wrp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultMQTTEventTopic is the default template for topics to which WRP events are published
+	DefaultMQTTEventTopic = "webpa/{device}/event/{event}"
+
+	// DefaultMQTTCommandTopic is the default template for topics from which commands are translated into WRP messages
+	DefaultMQTTCommandTopic = "webpa/{device}/command/{service}"
+
+	// DefaultMQTTCommandSource is the default WRP source of commands received over MQTT
+	DefaultMQTTCommandSource = "dns:mqtt-bridge"
+
+	// MQTTDevicePlaceholder is the topic template placeholder for the device ID, e.g. "mac:112233445566"
+	MQTTDevicePlaceholder = "device"
+
+	// MQTTServicePlaceholder is the topic template placeholder for the service on the device, e.g. "config"
+	MQTTServicePlaceholder = "service"
+
+	// MQTTEventPlaceholder is the topic template placeholder for the event type, e.g. "device-status"
+	MQTTEventPlaceholder = "event"
+
+	// eventPrefix is the prefix of the destinations of WRP events
+	eventPrefix = "event:"
+)
+
+var (
+	ErrMissingTopicValue = errors.New("The message has no value for a topic placeholder")
+	ErrTopicMismatch     = errors.New("The topic does not match the command topic template")
+
+	// placeholderPattern matches placeholders, such as {device}, in topic templates
+	placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+)
+
+// MQTTMessage is a message as published to or received from an MQTT broker
+type MQTTMessage struct {
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retained bool
+}
+
+// MQTTOptions configures an MQTTBridge.  Topic templates are MQTT topic names containing placeholders
+// in braces, e.g. "webpa/{device}/event/{event}".  The supported placeholders are {device}, {service}, and {event}.
+type MQTTOptions struct {
+	// EventTopic is the template for topics to which WRP events are published.  This template may use
+	// any placeholder.  If not supplied, DefaultMQTTEventTopic is used.
+	EventTopic string `json:"eventTopic"`
+
+	// CommandTopic is the template for topics carrying commands for devices.  This template must use
+	// {device}, and may use {service}.  If not supplied, DefaultMQTTCommandTopic is used.
+	CommandTopic string `json:"commandTopic"`
+
+	// CommandSource is the WRP source of commands which do not specify one.  If not supplied,
+	// DefaultMQTTCommandSource is used.
+	CommandSource string `json:"commandSource"`
+
+	// Format is the encoding of WRP messages carried in MQTT payloads.  It is ignored when RawPayload is set.
+	Format Format `json:"format"`
+
+	// RawPayload indicates that MQTT payloads carry only the payloads of WRP messages rather than
+	// entire encoded WRP messages.  This is useful for platforms which know nothing of WRP.
+	RawPayload bool `json:"rawPayload"`
+
+	// ContentType is the content type of commands translated from raw MQTT payloads.  If not
+	// supplied, "application/octet-stream" is used.
+	ContentType string `json:"contentType"`
+
+	// QoS is the MQTT quality of service for published events
+	QoS byte `json:"qos"`
+
+	// Retained indicates whether published events should be retained by the broker
+	Retained bool `json:"retained"`
+}
+
+func (o *MQTTOptions) eventTopic() string {
+	if o != nil && len(o.EventTopic) > 0 {
+		return o.EventTopic
+	}
+
+	return DefaultMQTTEventTopic
+}
+
+func (o *MQTTOptions) commandTopic() string {
+	if o != nil && len(o.CommandTopic) > 0 {
+		return o.CommandTopic
+	}
+
+	return DefaultMQTTCommandTopic
+}
+
+func (o *MQTTOptions) commandSource() string {
+	if o != nil && len(o.CommandSource) > 0 {
+		return o.CommandSource
+	}
+
+	return DefaultMQTTCommandSource
+}
+
+func (o *MQTTOptions) contentType() string {
+	if o != nil && len(o.ContentType) > 0 {
+		return o.ContentType
+	}
+
+	return "application/octet-stream"
+}
+
+// MQTTBridge translates WRP events into MQTT messages, and MQTT commands into WRP messages.  An MQTTBridge
+// only performs translation.  Connecting to a broker, subscribing to the command topics, and routing the
+// resulting WRP messages are left to the application and its choice of MQTT client.
+type MQTTBridge struct {
+	eventTopic     string
+	commandPattern *regexp.Regexp
+	commandSource  string
+	format         Format
+	rawPayload     bool
+	contentType    string
+	qos            byte
+	retained       bool
+}
+
+// NewMQTTBridge creates an MQTTBridge from a set of options.  An error is returned if
+// either topic template is invalid.
+func NewMQTTBridge(o *MQTTOptions) (*MQTTBridge, error) {
+	eventTopic := o.eventTopic()
+	if _, err := parsePlaceholders(eventTopic); err != nil {
+		return nil, err
+	}
+
+	commandTopic := o.commandTopic()
+	placeholders, err := parsePlaceholders(commandTopic)
+	if err != nil {
+		return nil, err
+	} else if placeholders[MQTTEventPlaceholder] {
+		return nil, fmt.Errorf("The command topic template cannot use {%s}: %s", MQTTEventPlaceholder, commandTopic)
+	} else if !placeholders[MQTTDevicePlaceholder] {
+		return nil, fmt.Errorf("The command topic template must use {%s}: %s", MQTTDevicePlaceholder, commandTopic)
+	}
+
+	// each placeholder in the command template matches exactly one topic level
+	var pattern bytes.Buffer
+	pattern.WriteString("^")
+	last := 0
+	for _, match := range placeholderPattern.FindAllStringSubmatchIndex(commandTopic, -1) {
+		pattern.WriteString(regexp.QuoteMeta(commandTopic[last:match[0]]))
+		pattern.WriteString(fmt.Sprintf("(?P<%s>[^/]+)", commandTopic[match[2]:match[3]]))
+		last = match[1]
+	}
+
+	pattern.WriteString(regexp.QuoteMeta(commandTopic[last:]))
+	pattern.WriteString("$")
+
+	commandPattern, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var format Format
+	if o != nil {
+		format = o.Format
+	}
+
+	if !format.valid() {
+		return nil, fmt.Errorf("Invalid format: %d", format)
+	}
+
+	bridge := &MQTTBridge{
+		eventTopic:     eventTopic,
+		commandPattern: commandPattern,
+		commandSource:  o.commandSource(),
+		format:         format,
+		contentType:    o.contentType(),
+	}
+
+	if o != nil {
+		bridge.rawPayload = o.RawPayload
+		bridge.qos = o.QoS
+		bridge.retained = o.Retained
+	}
+
+	return bridge, nil
+}
+
+// parsePlaceholders returns the set of placeholders used in a topic template.  An error is returned if the
+// template uses an unsupported placeholder, uses a placeholder more than once, or contains MQTT wildcards.
+func parsePlaceholders(template string) (map[string]bool, error) {
+	if strings.ContainsAny(template, "+#") {
+		return nil, fmt.Errorf("Topic templates cannot contain wildcards: %s", template)
+	}
+
+	placeholders := make(map[string]bool)
+	for _, match := range placeholderPattern.FindAllStringSubmatch(template, -1) {
+		switch name := match[1]; name {
+		case MQTTDevicePlaceholder, MQTTServicePlaceholder, MQTTEventPlaceholder:
+			if placeholders[name] {
+				return nil, fmt.Errorf("Duplicate topic placeholder {%s}: %s", name, template)
+			}
+
+			placeholders[name] = true
+
+		default:
+			return nil, fmt.Errorf("Unsupported topic placeholder {%s}: %s", name, template)
+		}
+	}
+
+	return placeholders, nil
+}
+
+// topicValues extracts the placeholder values for an event.  Device events have a source of the
+// form "{device}/{service}" and a destination of the form "event:{event}/...".
+func topicValues(msg *Message) map[string]string {
+	values := make(map[string]string, 3)
+
+	device, service := msg.Source, ""
+	if slash := strings.IndexByte(device, '/'); slash >= 0 {
+		device, service = device[:slash], device[slash+1:]
+	}
+
+	values[MQTTDevicePlaceholder] = device
+	values[MQTTServicePlaceholder] = service
+
+	if strings.HasPrefix(msg.Destination, eventPrefix) {
+		event := msg.Destination[len(eventPrefix):]
+		if slash := strings.IndexByte(event, '/'); slash >= 0 {
+			event = event[:slash]
+		}
+
+		values[MQTTEventPlaceholder] = event
+	}
+
+	return values
+}
+
+// EventTopic expands the event topic template for the given WRP event.  ErrMissingTopicValue is
+// returned if the event has no value for a placeholder, or if a value is not a valid topic level.
+func (b *MQTTBridge) EventTopic(msg *Message) (string, error) {
+	var (
+		values  = topicValues(msg)
+		missing bool
+	)
+
+	topic := placeholderPattern.ReplaceAllStringFunc(b.eventTopic, func(placeholder string) string {
+		value := values[placeholder[1:len(placeholder)-1]]
+		if len(value) == 0 || strings.ContainsAny(value, "/+#") {
+			missing = true
+		}
+
+		return value
+	})
+
+	if missing {
+		return "", ErrMissingTopicValue
+	}
+
+	return topic, nil
+}
+
+// ToMQTT translates a WRP event into an MQTT message.  Only SimpleEvent messages can be translated.
+func (b *MQTTBridge) ToMQTT(msg *Message) (*MQTTMessage, error) {
+	if err := checkType(msg.Type, SimpleEventMessageType); err != nil {
+		return nil, err
+	}
+
+	topic, err := b.EventTopic(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	mqttMessage := &MQTTMessage{
+		Topic:    topic,
+		QoS:      b.qos,
+		Retained: b.retained,
+	}
+
+	if b.rawPayload {
+		mqttMessage.Payload = msg.Payload
+	} else if err := NewEncoderBytes(&mqttMessage.Payload, b.format).Encode(msg); err != nil {
+		return nil, err
+	}
+
+	return mqttMessage, nil
+}
+
+// FromMQTT translates an MQTT command into a WRP message.  The topic must match the command topic template,
+// and determines the message's destination as "{device}/{service}", or just "{device}" if the template has no
+// {service}.
+//
+// With raw payloads, the result is a SimpleRequestResponse carrying the MQTT payload.  Otherwise, the MQTT payload
+// must be an encoded WRP message, whose destination is replaced by the one derived from the topic.  In either case,
+// messages without a source are given the configured command source, and request/response messages without a
+// transaction are given a generated transaction UUID.
+func (b *MQTTBridge) FromMQTT(mqttMessage *MQTTMessage) (*Message, error) {
+	match := b.commandPattern.FindStringSubmatch(mqttMessage.Topic)
+	if match == nil {
+		return nil, ErrTopicMismatch
+	}
+
+	var destination, service string
+	for index, name := range b.commandPattern.SubexpNames() {
+		switch name {
+		case MQTTDevicePlaceholder:
+			destination = match[index]
+		case MQTTServicePlaceholder:
+			service = match[index]
+		}
+	}
+
+	if len(service) > 0 {
+		destination = destination + "/" + service
+	}
+
+	msg := new(Message)
+	if b.rawPayload {
+		msg.Type = SimpleRequestResponseMessageType
+		msg.ContentType = b.contentType
+		msg.Payload = mqttMessage.Payload
+	} else if err := NewDecoderBytes(mqttMessage.Payload, b.format).Decode(msg); err != nil {
+		return nil, err
+	}
+
+	msg.Destination = destination
+	if len(msg.Source) == 0 {
+		msg.Source = b.commandSource
+	}
+
+	if msg.Type == SimpleRequestResponseMessageType && len(msg.TransactionUUID) == 0 {
+		transactionUUID, err := newTransactionUUID()
+		if err != nil {
+			return nil, err
+		}
+
+		msg.TransactionUUID = transactionUUID
+	}
+
+	return msg, nil
+}
+
+// newTransactionUUID generates a type 4 UUID for use as a transaction key
+func newTransactionUUID() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+
+	buffer[6] = (buffer[6] | 0x40) & 0x4F
+	buffer[8] = (buffer[8] | 0x80) & 0x8F
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buffer[0:4], buffer[4:6], buffer[6:8], buffer[8:10], buffer[10:]), nil
+}
@@ -0,0 +1,164 @@
+package wrp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewMQTTBridgeDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, o := range []*MQTTOptions{nil, new(MQTTOptions)} {
+		bridge, err := NewMQTTBridge(o)
+		assert.NoError(err)
+		if assert.NotNil(bridge) {
+			assert.Equal(DefaultMQTTEventTopic, bridge.eventTopic)
+			assert.Equal(DefaultMQTTCommandSource, bridge.commandSource)
+			assert.Equal(Msgpack, bridge.format)
+			assert.Equal("application/octet-stream", bridge.contentType)
+			assert.False(bridge.rawPayload)
+		}
+	}
+}
+
+func TestNewMQTTBridgeInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, o := range []*MQTTOptions{
+		{EventTopic: "webpa/{nosuch}"},
+		{EventTopic: "webpa/{device}/{device}"},
+		{EventTopic: "webpa/+/{event}"},
+		{CommandTopic: "webpa/#"},
+		{CommandTopic: "webpa/commands"},
+		{CommandTopic: "webpa/{device}/{event}"},
+		{CommandTopic: "webpa/{device}/{bad}"},
+		{Format: Format(99)},
+	} {
+		t.Logf("%#v", o)
+		bridge, err := NewMQTTBridge(o)
+		assert.Nil(bridge)
+		assert.Error(err)
+	}
+}
+
+func TestMQTTBridgeToMQTT(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		event   = &Message{
+			Type:        SimpleEventMessageType,
+			Source:      "mac:112233445566/parodus",
+			Destination: "event:device-status/mac:112233445566/online",
+			ContentType: "application/json",
+			Payload:     []byte(`{"online": true}`),
+		}
+	)
+
+	bridge, err := NewMQTTBridge(&MQTTOptions{QoS: 1, Retained: true, Format: JSON})
+	require.NoError(err)
+
+	mqttMessage, err := bridge.ToMQTT(event)
+	require.NoError(err)
+	assert.Equal("webpa/mac:112233445566/event/device-status", mqttMessage.Topic)
+	assert.Equal(byte(1), mqttMessage.QoS)
+	assert.True(mqttMessage.Retained)
+
+	var decoded Message
+	require.NoError(NewDecoderBytes(mqttMessage.Payload, JSON).Decode(&decoded))
+	assert.Equal(*event, decoded)
+
+	bridge, err = NewMQTTBridge(&MQTTOptions{EventTopic: "iot/{event}/{device}/{service}", RawPayload: true})
+	require.NoError(err)
+
+	mqttMessage, err = bridge.ToMQTT(event)
+	require.NoError(err)
+	assert.Equal("iot/device-status/mac:112233445566/parodus", mqttMessage.Topic)
+	assert.Equal(event.Payload, mqttMessage.Payload)
+}
+
+func TestMQTTBridgeToMQTTInvalid(t *testing.T) {
+	assert := assert.New(t)
+	bridge, err := NewMQTTBridge(&MQTTOptions{EventTopic: "webpa/{device}/{service}/{event}"})
+	require.NoError(t, err)
+
+	var testData = []struct {
+		message       Message
+		expectedError error
+	}{
+		{Message{Type: SimpleRequestResponseMessageType, Source: "mac:112233445566/config", Destination: "event:test"}, ErrInvalidMsgType},
+		{Message{Type: SimpleEventMessageType, Source: "mac:112233445566", Destination: "event:test"}, ErrMissingTopicValue},
+		{Message{Type: SimpleEventMessageType, Source: "mac:112233445566/config", Destination: "dns:somewhere"}, ErrMissingTopicValue},
+		{Message{Type: SimpleEventMessageType, Source: "/config", Destination: "event:test"}, ErrMissingTopicValue},
+		{Message{Type: SimpleEventMessageType, Source: "mac:112233445566/config", Destination: "event:te+st"}, ErrMissingTopicValue},
+	}
+
+	for _, record := range testData {
+		t.Logf("%#v", record)
+		mqttMessage, err := bridge.ToMQTT(&record.message)
+		assert.Nil(mqttMessage)
+		assert.Equal(record.expectedError, err)
+	}
+}
+
+func TestMQTTBridgeFromMQTTRaw(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	bridge, err := NewMQTTBridge(&MQTTOptions{RawPayload: true, ContentType: "application/json"})
+	require.NoError(err)
+
+	msg, err := bridge.FromMQTT(&MQTTMessage{Topic: "webpa/mac:112233445566/command/config", Payload: []byte(`{"command": "GET"}`)})
+	require.NoError(err)
+	assert.Equal(SimpleRequestResponseMessageType, msg.Type)
+	assert.Equal(DefaultMQTTCommandSource, msg.Source)
+	assert.Equal("mac:112233445566/config", msg.Destination)
+	assert.Equal("application/json", msg.ContentType)
+	assert.Equal([]byte(`{"command": "GET"}`), msg.Payload)
+	assert.Regexp(uuidPattern, msg.TransactionUUID)
+
+	for _, topic := range []string{"webpa/mac:112233445566/command", "webpa/mac:112233445566/command/config/extra", "other/mac:112233445566/command/config"} {
+		msg, err = bridge.FromMQTT(&MQTTMessage{Topic: topic})
+		assert.Nil(msg)
+		assert.Equal(ErrTopicMismatch, err)
+	}
+}
+
+func TestMQTTBridgeFromMQTTEncoded(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	bridge, err := NewMQTTBridge(&MQTTOptions{CommandTopic: "devices/{device}/wrp", CommandSource: "dns:iot.example.com"})
+	require.NoError(err)
+
+	original := Message{
+		Type:            SimpleRequestResponseMessageType,
+		Destination:     "ignored",
+		TransactionUUID: "1234",
+		Payload:         []byte("payload"),
+	}
+
+	msg, err := bridge.FromMQTT(&MQTTMessage{Topic: "devices/mac:112233445566/wrp", Payload: MustEncode(&original, Msgpack)})
+	require.NoError(err)
+	assert.Equal("dns:iot.example.com", msg.Source)
+	assert.Equal("mac:112233445566", msg.Destination)
+	assert.Equal("1234", msg.TransactionUUID)
+	assert.Equal(original.Payload, msg.Payload)
+
+	event := Message{Type: SimpleEventMessageType, Source: "dns:other"}
+	msg, err = bridge.FromMQTT(&MQTTMessage{Topic: "devices/mac:112233445566/wrp", Payload: MustEncode(&event, Msgpack)})
+	require.NoError(err)
+	assert.Equal("dns:other", msg.Source)
+	assert.Empty(msg.TransactionUUID)
+
+	msg, err = bridge.FromMQTT(&MQTTMessage{Topic: "devices/mac:112233445566/wrp", Payload: []byte("this is not msgpack")})
+	assert.Nil(msg)
+	assert.Error(err)
+}
@@ -0,0 +1,34 @@
+package wrp
+
+// PartnerIDMetadataKey is the metadata key which identifies the partner, i.e. the tenant, of the device
+// that sent a message.  Servers set this key on the messages they receive from devices using only the
+// device's authenticated credentials, replacing or removing any value supplied by the device, so that
+// downstream consumers can trust it.  A message from a device with no authenticated partner has no partner.
+const PartnerIDMetadataKey = "partner-id"
+
+// PartnerID returns the partner recorded in a message's metadata, or the empty string if there is none
+func PartnerID(message *Message) string {
+	return message.Metadata[PartnerIDMetadataKey]
+}
+
+// SetPartnerID records a partner in a message's metadata, creating the metadata as necessary.  An empty
+// partnerID removes any partner from the metadata.  This function returns true if the message was changed.
+func SetPartnerID(message *Message, partnerID string) bool {
+	current, ok := message.Metadata[PartnerIDMetadataKey]
+	if len(partnerID) == 0 {
+		if ok {
+			delete(message.Metadata, PartnerIDMetadataKey)
+		}
+
+		return ok
+	} else if ok && current == partnerID {
+		return false
+	}
+
+	if message.Metadata == nil {
+		message.Metadata = make(map[string]string, 1)
+	}
+
+	message.Metadata[PartnerIDMetadataKey] = partnerID
+	return true
+}
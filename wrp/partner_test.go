@@ -0,0 +1,35 @@
+package wrp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartnerID(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(PartnerID(new(Message)))
+	assert.Equal("comcast", PartnerID(&Message{Metadata: map[string]string{PartnerIDMetadataKey: "comcast"}}))
+}
+
+func TestSetPartnerID(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		message = new(Message)
+	)
+
+	assert.False(SetPartnerID(message, ""))
+	assert.Nil(message.Metadata)
+
+	assert.True(SetPartnerID(message, "comcast"))
+	assert.Equal(map[string]string{PartnerIDMetadataKey: "comcast"}, message.Metadata)
+	assert.False(SetPartnerID(message, "comcast"))
+
+	assert.True(SetPartnerID(message, "cox"))
+	assert.Equal("cox", PartnerID(message))
+
+	assert.True(SetPartnerID(message, ""))
+	assert.Empty(message.Metadata)
+	assert.False(SetPartnerID(message, ""))
+}
@@ -2,6 +2,9 @@ package wrp
 
 import (
 	"io"
+
+	"github.com/Comcast/webpa-common/concurrent"
+	"github.com/Comcast/webpa-common/xmetrics"
 )
 
 const (
@@ -12,27 +15,64 @@ const (
 // encode WRP messages.  Unlike a sync.Pool, this pool holds on to its pooled
 // encoders across garbage collections.
 type EncoderPool struct {
-	pool   chan Encoder
-	format Format
+	items       *itemPool
+	format      Format
+	measures    poolMeasures
+	compression *Compression
+	checksum    *Checksum
+	canonical   bool
 }
 
-// NewEncoderPool returns an EncoderPool for a given format.  The initialBufferSize is
-// used when encoding to byte arrays.  If this value is nonpositive, DefaultInitialBufferSize
-// is used instead.
+// NewEncoderPool returns an EncoderPool for a given format.  The poolSize is the maximum number
+// of idle encoders held by the pool.  If this value is nonpositive, DefaultPoolSize is used instead.
+// Encoders are created lazily, so use Warm to populate the pool up front.
 func NewEncoderPool(poolSize int, f Format) *EncoderPool {
-	if poolSize < 1 {
-		poolSize = DefaultPoolSize
+	return newEncoderPool(poolSize, f, nil, nil, nil)
+}
+
+// NewCompressingEncoderPool returns an EncoderPool which transparently compresses the payloads of messages
+// as configured by the given Compression.  Only *Message sources are compressed, and the caller's message is
+// never modified.  The content encoding is recorded under ContentEncodingMetadataKey, which a DecoderPool uses
+// to restore the original payload.
+func NewCompressingEncoderPool(poolSize int, f Format, c Compression) (*EncoderPool, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
 	}
 
-	ep := &EncoderPool{
-		pool:   make(chan Encoder, poolSize),
-		format: f,
+	return newEncoderPool(poolSize, f, nil, &c, nil), nil
+}
+
+// NewChecksummingEncoderPool returns an EncoderPool which records the checksum of each message's payload
+// under ChecksumMetadataKey, using the algorithm of the given Checksum.  As with compression, only *Message
+// sources are affected and the caller's message is never modified.
+func NewChecksummingEncoderPool(poolSize int, f Format, c Checksum) (*EncoderPool, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
 	}
 
-	for repeat := 0; repeat < poolSize; repeat++ {
-		ep.pool <- ep.New()
+	return newEncoderPool(poolSize, f, nil, nil, &c), nil
+}
+
+// NewCanonicalEncoderPool returns an EncoderPool whose encoders produce canonical Msgpack, as described by
+// NewCanonicalEncoder.  Use this pool when the encoded bytes themselves are signed, checksummed, or used as
+// deduplication keys.
+func NewCanonicalEncoderPool(poolSize int) *EncoderPool {
+	ep := newEncoderPool(poolSize, Msgpack, nil, nil, nil)
+	ep.canonical = true
+	return ep
+}
+
+// newEncoderPool creates an EncoderPool which updates metrics from the given provider.  If the Compression
+// is nil, payloads are not compressed.  If the Checksum is nil, payloads are not checksummed.
+func newEncoderPool(poolSize int, f Format, p xmetrics.Provider, c *Compression, cs *Checksum) *EncoderPool {
+	ep := &EncoderPool{
+		format:      f,
+		measures:    newPoolMeasures(p, "encoder", f),
+		compression: c,
+		checksum:    cs,
 	}
 
+	ep.items = newItemPool(poolSize, func() interface{} { return ep.New() }, ep.measures)
 	return ep
 }
 
@@ -45,34 +85,86 @@ func (ep *EncoderPool) Format() Format {
 // This method is used internally to populate and manage the pool, but
 // can also be used externally to obtain a new, unpooled instance.
 func (ep *EncoderPool) New() Encoder {
+	if ep.canonical {
+		return NewCanonicalEncoder(nil)
+	}
+
 	return NewEncoder(nil, ep.format)
 }
 
 // Get returns an Encoder from the pool.  If the pool is empty, a new Encoder is
 // created using the initial pool configuration.  This method never returns nil.
-func (ep *EncoderPool) Get() (encoder Encoder) {
-	select {
-	case encoder = <-ep.pool:
-	default:
-		encoder = ep.New()
-	}
-
-	return
+func (ep *EncoderPool) Get() Encoder {
+	return ep.items.get().(Encoder)
 }
 
 // Put returns an Encoder to the pool.  If this pool is full or if the supplied
 // encoder is nil, this method does nothing.
 func (ep *EncoderPool) Put(encoder Encoder) {
 	if encoder != nil {
-		select {
-		case ep.pool <- encoder:
-		default:
+		ep.items.put(encoder)
+	}
+}
+
+// Size returns the maximum number of idle encoders this pool holds
+func (ep *EncoderPool) Size() int {
+	return ep.items.capacity()
+}
+
+// Idle returns the number of encoders currently idle in this pool
+func (ep *EncoderPool) Idle() int {
+	return ep.items.idleCount()
+}
+
+// Resize changes the maximum number of idle encoders this pool holds.  Shrinking the pool
+// discards any idle encoders beyond the new size, while growing it allocates nothing until
+// encoders are returned with Put.  A nonpositive size is treated as 1.
+func (ep *EncoderPool) Resize(size int) {
+	ep.items.resize(size)
+}
+
+// Warm creates encoders until at least n are idle, never exceeding this pool's size.
+// The number of idle encoders is returned.
+func (ep *EncoderPool) Warm(n int) int {
+	return ep.items.warm(n)
+}
+
+// AutoSize returns a concurrent.Runnable which periodically resizes this pool based on its miss rate,
+// as configured by the given PoolSizing.  A nil PoolSizing uses the defaults.
+func (ep *EncoderPool) AutoSize(ps *PoolSizing) concurrent.Runnable {
+	return ep.items.autoSize(ps)
+}
+
+// prepare returns the value actually encoded for a source, which is a copy with a checksummed and/or
+// compressed payload if this pool checksums or compresses messages.  The checksum is always of the
+// uncompressed payload.
+func (ep *EncoderPool) prepare(source interface{}) (interface{}, error) {
+	if ep.checksum != nil {
+		checksummed, err := checksummedCopy(source, ep.checksum)
+		if err != nil {
+			return nil, err
+		}
+
+		if checksummed != source {
+			ep.measures.checksum.With(ChecksumOutcomeLabel, ChecksumComputed).Add(1)
+			source = checksummed
 		}
 	}
+
+	if ep.compression == nil {
+		return source, nil
+	}
+
+	return compressedCopy(source, ep.compression)
 }
 
 // Encode uses an Encoder from the pool to encode the source into the destination
 func (ep *EncoderPool) Encode(destination io.Writer, source interface{}) error {
+	source, err := ep.prepare(source)
+	if err != nil {
+		return err
+	}
+
 	encoder := ep.Get()
 	defer ep.Put(encoder)
 
@@ -85,6 +177,11 @@ func (ep *EncoderPool) Encode(destination io.Writer, source interface{}) error {
 // using a zero-copy approach.  If destination has points to a slice with adequate capacity,
 // no new memory allocation is done.
 func (ep *EncoderPool) EncodeBytes(destination *[]byte, source interface{}) error {
+	source, err := ep.prepare(source)
+	if err != nil {
+		return err
+	}
+
 	encoder := ep.Get()
 	defer ep.Put(encoder)
 
@@ -94,25 +191,44 @@ func (ep *EncoderPool) EncodeBytes(destination *[]byte, source interface{}) erro
 
 // DecoderPool is a pool of Decoder instances for a specific format
 type DecoderPool struct {
-	pool   chan Decoder
-	format Format
+	items         *itemPool
+	format        Format
+	measures      poolMeasures
+	checksum      *Checksum
+	decompression *Decompression
 }
 
-// NewDecoderPool returns a DecoderPool that works with a given Format
+// NewDecoderPool returns a DecoderPool that works with a given Format.  As with NewEncoderPool,
+// the poolSize is the maximum number of idle decoders, which are created lazily.
 func NewDecoderPool(poolSize int, f Format) *DecoderPool {
-	if poolSize < 1 {
-		poolSize = DefaultPoolSize
-	}
+	return newDecoderPool(poolSize, f, nil, nil, nil)
+}
 
-	dp := &DecoderPool{
-		pool:   make(chan Decoder, poolSize),
-		format: f,
-	}
+// NewVerifyingDecoderPool returns a DecoderPool which verifies the payload of each decoded *Message
+// against the checksum in its metadata, if any.  Mismatches are counted and, if the given Checksum
+// rejects them, are returned as ErrorChecksumMismatch.
+func NewVerifyingDecoderPool(poolSize int, f Format, c Checksum) *DecoderPool {
+	return newDecoderPool(poolSize, f, nil, &c, nil)
+}
+
+// NewDecompressingDecoderPool returns a DecoderPool which restores the payload of each decoded *Message
+// compressed by a compressing EncoderPool, subject to the limits of the given Decompression.  Payloads with
+// other content encodings are left as is.
+func NewDecompressingDecoderPool(poolSize int, f Format, d Decompression) *DecoderPool {
+	return newDecoderPool(poolSize, f, nil, nil, &d)
+}
 
-	for repeat := 0; repeat < poolSize; repeat++ {
-		dp.pool <- dp.New()
+// newDecoderPool creates a DecoderPool which updates metrics from the given provider.  If the Checksum
+// is nil, payloads are not verified.  If the Decompression is nil, payloads are not decompressed.
+func newDecoderPool(poolSize int, f Format, p xmetrics.Provider, c *Checksum, d *Decompression) *DecoderPool {
+	dp := &DecoderPool{
+		format:        f,
+		measures:      newPoolMeasures(p, "decoder", f),
+		checksum:      c,
+		decompression: d,
 	}
 
+	dp.items = newItemPool(poolSize, func() interface{} { return dp.New() }, dp.measures)
 	return dp
 }
 
@@ -130,43 +246,109 @@ func (ep *DecoderPool) New() Decoder {
 
 // Get obtains a Decoder from the pool.  If the pool is empty, a new Decoder is
 // created using the initial pool configuration.  This method never returns nil.
-func (dp *DecoderPool) Get() (decoder Decoder) {
-	select {
-	case decoder = <-dp.pool:
-	default:
-		decoder = dp.New()
-	}
-
-	return
+func (dp *DecoderPool) Get() Decoder {
+	return dp.items.get().(Decoder)
 }
 
 // Put returns a Decoder to the pool.  If this pool is full or if the supplied
 // decoder is nil, this method does nothing.
 func (dp *DecoderPool) Put(decoder Decoder) {
 	if decoder != nil {
-		select {
-		case dp.pool <- decoder:
-		default:
-		}
+		dp.items.put(decoder)
 	}
 }
 
+// Size returns the maximum number of idle decoders this pool holds
+func (dp *DecoderPool) Size() int {
+	return dp.items.capacity()
+}
+
+// Idle returns the number of decoders currently idle in this pool
+func (dp *DecoderPool) Idle() int {
+	return dp.items.idleCount()
+}
+
+// Resize changes the maximum number of idle decoders this pool holds, in the same manner as EncoderPool.Resize
+func (dp *DecoderPool) Resize(size int) {
+	dp.items.resize(size)
+}
+
+// Warm creates decoders until at least n are idle, never exceeding this pool's size.
+// The number of idle decoders is returned.
+func (dp *DecoderPool) Warm(n int) int {
+	return dp.items.warm(n)
+}
+
+// AutoSize returns a concurrent.Runnable which periodically resizes this pool based on its miss rate,
+// as configured by the given PoolSizing.  A nil PoolSizing uses the defaults.
+func (dp *DecoderPool) AutoSize(ps *PoolSizing) concurrent.Runnable {
+	return dp.items.autoSize(ps)
+}
+
 // Decode unmarshals data from the source onto the destination instance, which is
-// normally a pointer to some struct (such as *Message).
+// normally a pointer to some struct (such as *Message).  If this pool decompresses payloads, the payload
+// of a *Message with a content encoding in its metadata is decompressed.  The payload is then verified if
+// this pool verifies checksums.
 func (dp *DecoderPool) Decode(destination interface{}, source io.Reader) error {
 	decoder := dp.Get()
 	defer dp.Put(decoder)
 
 	decoder.Reset(source)
-	return decoder.Decode(destination)
+	if err := decoder.Decode(destination); err != nil {
+		return err
+	}
+
+	return dp.restore(destination)
 }
 
 // DecodeBytes unmarshals data from the source byte slice onto the destination instance.
-// The destination is typically a pointer to a struct, such as *Message.
+// The destination is typically a pointer to a struct, such as *Message.  As with Decode,
+// payloads are decompressed and verified as configured.
 func (dp *DecoderPool) DecodeBytes(destination interface{}, source []byte) error {
 	decoder := dp.Get()
 	defer dp.Put(decoder)
 
 	decoder.ResetBytes(source)
-	return decoder.Decode(destination)
+	if err := decoder.Decode(destination); err != nil {
+		return err
+	}
+
+	return dp.restore(destination)
+}
+
+// restore decompresses the payload of a decoded *Message if this pool decompresses payloads, then verifies
+// it against its checksum if this pool verifies checksums.  Since checksums are computed over uncompressed
+// payloads, a payload which is still compressed is not verified.
+func (dp *DecoderPool) restore(destination interface{}) error {
+	if dp.decompression != nil {
+		if err := decompressDestination(destination, dp.decompression); err != nil {
+			return err
+		}
+	}
+
+	if dp.checksum == nil {
+		return nil
+	}
+
+	message, ok := destination.(*Message)
+	if !ok || len(message.Metadata[ChecksumMetadataKey]) == 0 || isCompressed(message) {
+		return nil
+	}
+
+	err := VerifyPayload(message)
+	switch err {
+	case nil:
+		dp.measures.checksum.With(ChecksumOutcomeLabel, ChecksumValid).Add(1)
+		return nil
+	case ErrorChecksumMismatch:
+		dp.measures.checksum.With(ChecksumOutcomeLabel, ChecksumCorrupt).Add(1)
+	default:
+		dp.measures.checksum.With(ChecksumOutcomeLabel, ChecksumInvalid).Add(1)
+	}
+
+	if dp.checksum.reject() {
+		return err
+	}
+
+	return nil
 }
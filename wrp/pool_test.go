@@ -9,7 +9,7 @@ import (
 
 func testEncoderPool(assert *assert.Assertions, expectedFormat Format, encoderPool *EncoderPool, output *[]byte) {
 	var (
-		initialSize = len(encoderPool.pool)
+		initialSize = encoderPool.Size()
 
 		testMessage = SimpleEvent{
 			Destination: "foobar.com/test",
@@ -22,31 +22,33 @@ func testEncoderPool(assert *assert.Assertions, expectedFormat Format, encoderPo
 
 	assert.Equal(expectedFormat, encoderPool.Format())
 	assert.True(initialSize > 0)
+	assert.Zero(encoderPool.Idle())
+	assert.Equal(initialSize, encoderPool.Warm(initialSize+1))
 
 	assert.NoError(encoderPool.Encode(&buffer, &testMessage))
-	assert.Equal(initialSize, len(encoderPool.pool))
+	assert.Equal(initialSize, encoderPool.Idle())
 	assert.True(buffer.Len() > 0)
 
 	err := encoderPool.EncodeBytes(output, &testMessage)
-	assert.Equal(initialSize, len(encoderPool.pool))
+	assert.Equal(initialSize, encoderPool.Idle())
 	assert.NotEmpty(*output)
 	assert.NoError(err)
 	assert.Equal(*output, buffer.Bytes())
 
-	for len(encoderPool.pool) > 0 {
+	for encoderPool.Idle() > 0 {
 		assert.NotNil(encoderPool.Get())
 	}
 
 	// an exhausted pool should still give out encoders
 	assert.NotNil(encoderPool.Get())
 
-	for len(encoderPool.pool) < initialSize {
+	for encoderPool.Idle() < initialSize {
 		encoderPool.Put(encoderPool.New())
 	}
 
 	// a full pool should silently reject Puts
 	encoderPool.Put(encoderPool.New())
-	assert.Equal(initialSize, len(encoderPool.pool))
+	assert.Equal(initialSize, encoderPool.Idle())
 }
 
 func TestEncoderPool(t *testing.T) {
@@ -79,7 +81,7 @@ func TestEncoderPool(t *testing.T) {
 
 func testDecoderPool(assert *assert.Assertions, format Format, decoderPool *DecoderPool) {
 	var (
-		initialSize = len(decoderPool.pool)
+		initialSize = decoderPool.Size()
 
 		originalMessage = SimpleEvent{
 			Destination: "foobar.com/test",
@@ -97,30 +99,32 @@ func testDecoderPool(assert *assert.Assertions, format Format, decoderPool *Deco
 
 	assert.Equal(format, decoderPool.Format())
 	assert.True(initialSize > 0)
+	assert.Zero(decoderPool.Idle())
+	assert.Equal(initialSize, decoderPool.Warm(initialSize+1))
 
 	testMessage = new(SimpleEvent)
 	assert.NoError(decoderPool.Decode(testMessage, bytes.NewReader(encoded)))
-	assert.Equal(initialSize, len(decoderPool.pool))
+	assert.Equal(initialSize, decoderPool.Idle())
 	assert.Equal(originalMessage, *testMessage)
 
 	assert.NoError(decoderPool.DecodeBytes(testMessage, encoded))
-	assert.Equal(initialSize, len(decoderPool.pool))
+	assert.Equal(initialSize, decoderPool.Idle())
 	assert.Equal(originalMessage, *testMessage)
 
-	for len(decoderPool.pool) > 0 {
+	for decoderPool.Idle() > 0 {
 		assert.NotNil(decoderPool.Get())
 	}
 
 	// an exhausted pool should still give out encoders
 	assert.NotNil(decoderPool.Get())
 
-	for len(decoderPool.pool) < initialSize {
+	for decoderPool.Idle() < initialSize {
 		decoderPool.Put(decoderPool.New())
 	}
 
 	// a full pool should silently reject Puts
 	decoderPool.Put(decoderPool.New())
-	assert.Equal(initialSize, len(decoderPool.pool))
+	assert.Equal(initialSize, decoderPool.Idle())
 }
 
 func TestDecoderPool(t *testing.T) {
@@ -146,3 +150,35 @@ func TestDecoderPool(t *testing.T) {
 		)
 	}
 }
+
+func TestPoolResize(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		encoderPool = NewEncoderPool(10, Msgpack)
+		decoderPool = NewDecoderPool(10, JSON)
+	)
+
+	assert.Equal(10, encoderPool.Size())
+	assert.Equal(10, encoderPool.Warm(10))
+
+	// shrinking drops idle encoders
+	encoderPool.Resize(4)
+	assert.Equal(4, encoderPool.Size())
+	assert.Equal(4, encoderPool.Idle())
+
+	// growing allocates nothing
+	encoderPool.Resize(20)
+	assert.Equal(20, encoderPool.Size())
+	assert.Equal(4, encoderPool.Idle())
+
+	encoderPool.Resize(0)
+	assert.Equal(1, encoderPool.Size())
+	assert.Equal(1, encoderPool.Idle())
+
+	assert.Equal(3, decoderPool.Warm(3))
+	decoderPool.Resize(2)
+	assert.Equal(2, decoderPool.Size())
+	assert.Equal(2, decoderPool.Idle())
+	decoderPool.Put(decoderPool.New())
+	assert.Equal(2, decoderPool.Idle())
+}
@@ -0,0 +1,127 @@
+package wrp
+
+import (
+	"reflect"
+	"strings"
+)
+
+var (
+	// messageFieldNames are the wire names of the Message fields, in struct order.  The position
+	// of each name is the bit used for that field in a Presence.
+	messageFieldNames []string
+
+	// messageFieldIndices maps wire names onto Message struct field indices
+	messageFieldIndices map[string]int
+)
+
+func init() {
+	messageType := reflect.TypeOf(Message{})
+	messageFieldNames = make([]string, 0, messageType.NumField())
+	messageFieldIndices = make(map[string]int, messageType.NumField())
+
+	for index := 0; index < messageType.NumField(); index++ {
+		name := strings.Split(messageType.Field(index).Tag.Get("wrp"), ",")[0]
+		messageFieldNames = append(messageFieldNames, name)
+		messageFieldIndices[name] = index
+	}
+}
+
+// Presence is a bitmap of the Message fields that were explicitly present in an encoded message.
+// Fields are identified by their wire names, e.g. "source" or "status".
+type Presence uint64
+
+// Has tests if the given field is present
+func (p Presence) Has(field string) bool {
+	if index, ok := messageFieldIndices[field]; ok {
+		return p&(1<<uint(index)) != 0
+	}
+
+	return false
+}
+
+// Set marks the given field as present.  Unknown fields are ignored.
+func (p *Presence) Set(field string) {
+	if index, ok := messageFieldIndices[field]; ok {
+		*p |= 1 << uint(index)
+	}
+}
+
+// Clear marks the given field as absent
+func (p *Presence) Clear(field string) {
+	if index, ok := messageFieldIndices[field]; ok {
+		*p &^= 1 << uint(index)
+	}
+}
+
+// Fields returns the wire names of the present fields, in the order they are declared in Message
+func (p Presence) Fields() []string {
+	fields := make([]string, 0, len(messageFieldNames))
+	for index, name := range messageFieldNames {
+		if p&(1<<uint(index)) != 0 {
+			fields = append(fields, name)
+		}
+	}
+
+	return fields
+}
+
+// SparseMessage is a Message along with the set of fields that were present when it was decoded.
+// This allows intermediaries to distinguish a field that was absent from one that was explicitly set
+// to its zero value, e.g. an empty content type in a CRUD partial update, and to re-encode the message
+// without inventing values for absent fields.
+//
+// Code that changes a field of a SparseMessage must also mark that field present.
+type SparseMessage struct {
+	Message
+	Presence Presence
+}
+
+// DecodeSparse decodes a WRP message in the given format, recording which fields are present
+func DecodeSparse(input []byte, f Format) (*SparseMessage, error) {
+	var fields map[string]interface{}
+	if err := NewDecoderBytes(input, f).Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	sparse := new(SparseMessage)
+	if err := NewDecoderBytes(input, f).Decode(&sparse.Message); err != nil {
+		return nil, err
+	}
+
+	for name := range fields {
+		sparse.Presence.Set(name)
+	}
+
+	return sparse, nil
+}
+
+// EncodeSparse encodes exactly the present fields of a SparseMessage in the given format,
+// including any present fields that hold zero values.
+func EncodeSparse(sparse *SparseMessage, f Format) ([]byte, error) {
+	var (
+		message = reflect.ValueOf(&sparse.Message).Elem()
+		fields  = make(map[string]interface{}, len(messageFieldNames))
+		output  []byte
+	)
+
+	for _, name := range sparse.Presence.Fields() {
+		fields[name] = message.Field(messageFieldIndices[name]).Interface()
+	}
+
+	err := NewEncoderBytes(&output, f).Encode(fields)
+	return output, err
+}
+
+// Apply copies the present fields of this SparseMessage onto a target Message, leaving the
+// target's other fields untouched.  This is the usual way to carry out a partial update.
+func (sparse *SparseMessage) Apply(target *Message) {
+	var (
+		source      = reflect.ValueOf(&sparse.Message).Elem()
+		destination = reflect.ValueOf(target).Elem()
+	)
+
+	for _, name := range sparse.Presence.Fields() {
+		index := messageFieldIndices[name]
+		destination.Field(index).Set(source.Field(index))
+	}
+}
@@ -0,0 +1,118 @@
+package wrp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresence(t *testing.T) {
+	assert := assert.New(t)
+
+	var presence Presence
+	assert.Empty(presence.Fields())
+	assert.False(presence.Has("source"))
+
+	presence.Set("status")
+	presence.Set("source")
+	presence.Set("nosuch")
+	assert.True(presence.Has("source"))
+	assert.True(presence.Has("status"))
+	assert.False(presence.Has("nosuch"))
+	assert.Equal([]string{"source", "status"}, presence.Fields())
+
+	presence.Clear("source")
+	presence.Clear("nosuch")
+	assert.False(presence.Has("source"))
+	assert.Equal([]string{"status"}, presence.Fields())
+
+	assert.Len(messageFieldNames, 18)
+	assert.Equal("msg_type", messageFieldNames[0])
+	assert.Equal("url", messageFieldNames[16])
+	assert.Equal("qos", messageFieldNames[17])
+}
+
+func testSparseMessage(t *testing.T, f Format) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		// an update which explicitly clears the content type and zeroes the status
+		original = map[string]interface{}{
+			"msg_type":     int64(UpdateMessageType),
+			"source":       "dns:talaria",
+			"dest":         "mac:112233445566/config",
+			"content_type": "",
+			"status":       int64(0),
+		}
+	)
+
+	sparse, err := DecodeSparse(MustEncode(original, f), f)
+	require.NoError(err)
+	require.NotNil(sparse)
+
+	assert.Equal([]string{"msg_type", "source", "dest", "content_type", "status"}, sparse.Presence.Fields())
+	assert.Equal(UpdateMessageType, sparse.Type)
+	assert.Equal("dns:talaria", sparse.Source)
+	assert.Empty(sparse.ContentType)
+	if assert.NotNil(sparse.Status) {
+		assert.Zero(*sparse.Status)
+	}
+
+	encoded, err := EncodeSparse(sparse, f)
+	require.NoError(err)
+
+	var reencoded map[string]interface{}
+	require.NoError(NewDecoderBytes(encoded, f).Decode(&reencoded))
+	assert.Len(reencoded, len(original))
+	for name := range original {
+		assert.Contains(reencoded, name)
+	}
+
+	// a normal encoding drops the explicitly empty content type
+	var normal map[string]interface{}
+	require.NoError(NewDecoderBytes(MustEncode(&sparse.Message, f), f).Decode(&normal))
+	assert.NotContains(normal, "content_type")
+
+	var (
+		status = int64(200)
+		target = Message{
+			Type:        CreateMessageType,
+			Source:      "dns:original",
+			ContentType: "application/json",
+			Path:        "/config",
+			Status:      &status,
+		}
+	)
+
+	sparse.Apply(&target)
+	assert.Equal(UpdateMessageType, target.Type)
+	assert.Equal("dns:talaria", target.Source)
+	assert.Equal("mac:112233445566/config", target.Destination)
+	assert.Empty(target.ContentType)
+	assert.Equal("/config", target.Path)
+	if assert.NotNil(target.Status) {
+		assert.Zero(*target.Status)
+	}
+}
+
+func TestSparseMessage(t *testing.T) {
+	for _, f := range []Format{Msgpack, JSON} {
+		t.Run(f.String(), func(t *testing.T) {
+			testSparseMessage(t, f)
+		})
+	}
+}
+
+func TestDecodeSparseInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	sparse, err := DecodeSparse([]byte("this is not valid"), JSON)
+	assert.Nil(sparse)
+	assert.Error(err)
+
+	sparse, err = DecodeSparse(MustEncode(map[string]interface{}{"msg_type": "not a number"}, Msgpack), Msgpack)
+	assert.Nil(sparse)
+	assert.Error(err)
+}
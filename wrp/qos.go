@@ -0,0 +1,56 @@
+package wrp
+
+// QOSValue is the quality of service value of a WRP message, from 0 to 99.  Values outside
+// this range are clamped when mapped onto a QOSLevel.
+type QOSValue int
+
+const (
+	QOSLowValue      QOSValue = 0
+	QOSMediumValue   QOSValue = 25
+	QOSHighValue     QOSValue = 50
+	QOSCriticalValue QOSValue = 75
+)
+
+// QOSLevel is the coarse priority class of a QOSValue
+type QOSLevel int
+
+const (
+	QOSLow QOSLevel = iota
+	QOSMedium
+	QOSHigh
+	QOSCritical
+
+	// QOSLevels is the number of distinct QOSLevel values
+	QOSLevels = int(QOSCritical) + 1
+
+	InvalidQOSLevelString = "!!INVALID!!"
+)
+
+// Level returns the QOSLevel this value belongs to
+func (qv QOSValue) Level() QOSLevel {
+	switch {
+	case qv < QOSMediumValue:
+		return QOSLow
+	case qv < QOSHighValue:
+		return QOSMedium
+	case qv < QOSCriticalValue:
+		return QOSHigh
+	default:
+		return QOSCritical
+	}
+}
+
+func (ql QOSLevel) String() string {
+	switch ql {
+	case QOSLow:
+		return "Low"
+	case QOSMedium:
+		return "Medium"
+	case QOSHigh:
+		return "High"
+	case QOSCritical:
+		return "Critical"
+	}
+
+	return InvalidQOSLevelString
+}
@@ -0,0 +1,41 @@
+package wrp
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQOSValueLevel(t *testing.T) {
+	testData := []struct {
+		value    QOSValue
+		expected QOSLevel
+	}{
+		{-1, QOSLow},
+		{QOSLowValue, QOSLow},
+		{QOSMediumValue - 1, QOSLow},
+		{QOSMediumValue, QOSMedium},
+		{QOSHighValue - 1, QOSMedium},
+		{QOSHighValue, QOSHigh},
+		{QOSCriticalValue - 1, QOSHigh},
+		{QOSCriticalValue, QOSCritical},
+		{99, QOSCritical},
+		{100, QOSCritical},
+	}
+
+	for _, record := range testData {
+		t.Run(fmt.Sprintf("%d", record.value), func(t *testing.T) {
+			assert.Equal(t, record.expected, record.value.Level())
+		})
+	}
+}
+
+func TestQOSLevelString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("Low", QOSLow.String())
+	assert.Equal("Medium", QOSMedium.String())
+	assert.Equal("High", QOSHigh.String())
+	assert.Equal("Critical", QOSCritical.String())
+	assert.Equal(InvalidQOSLevelString, QOSLevel(-1).String())
+	assert.Equal(InvalidQOSLevelString, QOSLevel(QOSLevels).String())
+}
@@ -0,0 +1,184 @@
+package wrp
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+const (
+	// DefaultMaxPayloadSize is the number of payload bytes included in the log representation
+	// of a Message when a Redaction does not specify its own limit
+	DefaultMaxPayloadSize = 64
+
+	// MaskedValue replaces the values of masked metadata keys
+	MaskedValue = "****"
+)
+
+// Redaction describes how a Message is rendered for logging.  Payloads are truncated, and the
+// values of sensitive metadata keys are masked, so that logging a Message can neither dump
+// megabytes of payload nor leak PII.
+type Redaction struct {
+	// MaxPayloadSize is the maximum number of payload bytes rendered.  If zero, DefaultMaxPayloadSize
+	// is used.  If negative, no payload bytes are rendered, only the payload's length.
+	MaxPayloadSize int `json:"maxPayloadSize"`
+
+	// MaskedMetadata holds the metadata keys whose values are replaced with MaskedValue
+	MaskedMetadata []string `json:"maskedMetadata,omitempty"`
+}
+
+func (r *Redaction) maxPayloadSize() int {
+	if r != nil && r.MaxPayloadSize != 0 {
+		return r.MaxPayloadSize
+	}
+
+	return DefaultMaxPayloadSize
+}
+
+func (r *Redaction) masked(key string) bool {
+	if r != nil {
+		for _, candidate := range r.MaskedMetadata {
+			if key == candidate {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// metadata returns a copy of the given metadata with the masked values replaced
+func (r *Redaction) metadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	redacted := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		if r.masked(key) {
+			value = MaskedValue
+		}
+
+		redacted[key] = value
+	}
+
+	return redacted
+}
+
+// payload returns the possibly truncated payload, quoted so that binary payloads are safe to log
+func (r *Redaction) payload(payload []byte) string {
+	limit := r.maxPayloadSize()
+	if limit < 0 {
+		return ""
+	} else if len(payload) > limit {
+		return fmt.Sprintf("%q...", payload[:limit])
+	}
+
+	return fmt.Sprintf("%q", payload)
+}
+
+// String renders the given Message as a single line containing its type, routing information,
+// and redacted metadata and payload
+func (r *Redaction) String(msg *Message) string {
+	if msg == nil {
+		return "<nil>"
+	}
+
+	var output bytes.Buffer
+	fmt.Fprintf(
+		&output,
+		"Message{Type: %s, Source: %s, Destination: %s, TransactionUUID: %s",
+		msg.Type,
+		msg.Source,
+		msg.Destination,
+		msg.TransactionUUID,
+	)
+
+	if len(msg.ContentType) > 0 {
+		fmt.Fprintf(&output, ", ContentType: %s", msg.ContentType)
+	}
+
+	if metadata := r.metadata(msg.Metadata); len(metadata) > 0 {
+		keys := make([]string, 0, len(metadata))
+		for key := range metadata {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+		output.WriteString(", Metadata: {")
+		for index, key := range keys {
+			if index > 0 {
+				output.WriteString(", ")
+			}
+
+			fmt.Fprintf(&output, "%s: %s", key, metadata[key])
+		}
+
+		output.WriteString("}")
+	}
+
+	if len(msg.Payload) > 0 {
+		fmt.Fprintf(&output, ", Payload: %d bytes", len(msg.Payload))
+		if payload := r.payload(msg.Payload); len(payload) > 0 {
+			fmt.Fprintf(&output, " %s", payload)
+		}
+	}
+
+	output.WriteString("}")
+	return output.String()
+}
+
+// Keyvals renders the given Message as key/value pairs suitable for a logging.StructuredLogger.
+// Keys are the WRP field names.
+func (r *Redaction) Keyvals(msg *Message) []interface{} {
+	if msg == nil {
+		return nil
+	}
+
+	keyvals := []interface{}{
+		"msg_type", msg.Type.String(),
+		"source", msg.Source,
+		"dest", msg.Destination,
+		"transaction_uuid", msg.TransactionUUID,
+	}
+
+	if len(msg.ContentType) > 0 {
+		keyvals = append(keyvals, "content_type", msg.ContentType)
+	}
+
+	if metadata := r.metadata(msg.Metadata); len(metadata) > 0 {
+		keyvals = append(keyvals, "metadata", metadata)
+	}
+
+	if len(msg.Payload) > 0 {
+		keyvals = append(keyvals, "payload_size", len(msg.Payload))
+		if payload := r.payload(msg.Payload); len(payload) > 0 {
+			keyvals = append(keyvals, "payload", payload)
+		}
+	}
+
+	return keyvals
+}
+
+var defaultRedaction atomic.Value
+
+func init() {
+	defaultRedaction.Store(new(Redaction))
+}
+
+// SetDefaultRedaction changes the Redaction used by Message.String and Message.LogValue.  A nil
+// Redaction restores the defaults, which truncate payloads and mask no metadata.  This function
+// is safe for concurrent use, though typically it is called once at startup.
+func SetDefaultRedaction(r *Redaction) {
+	if r == nil {
+		r = new(Redaction)
+	}
+
+	defaultRedaction.Store(r)
+}
+
+// DefaultRedaction returns the Redaction used by Message.String and Message.LogValue
+func DefaultRedaction() *Redaction {
+	return defaultRedaction.Load().(*Redaction)
+}
@@ -0,0 +1,148 @@
+package wrp
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Comcast/webpa-common/logging"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestRedactionDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, r := range []*Redaction{nil, new(Redaction)} {
+		assert.Equal(DefaultMaxPayloadSize, r.maxPayloadSize())
+		assert.False(r.masked("key"))
+	}
+}
+
+func TestRedactionString(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		r      = &Redaction{MaxPayloadSize: 4, MaskedMetadata: []string{"/secret"}}
+	)
+
+	assert.Equal("<nil>", r.String(nil))
+
+	assert.Equal(
+		"Message{Type: SimpleEvent, Source: dns:source.comcast.net, Destination: mac:112233445566, TransactionUUID: }",
+		r.String(&Message{Type: SimpleEventMessageType, Source: "dns:source.comcast.net", Destination: "mac:112233445566"}),
+	)
+
+	assert.Equal(
+		`Message{Type: SimpleRequestResponse, Source: dns:source.comcast.net, Destination: mac:112233445566, TransactionUUID: 1234, `+
+			`ContentType: text/plain, Metadata: {/public: value, /secret: ****}, Payload: 11 bytes "hell"...}`,
+		r.String(&Message{
+			Type:            SimpleRequestResponseMessageType,
+			Source:          "dns:source.comcast.net",
+			Destination:     "mac:112233445566",
+			TransactionUUID: "1234",
+			ContentType:     "text/plain",
+			Metadata:        map[string]string{"/secret": "pii", "/public": "value"},
+			Payload:         []byte("hello world"),
+		}),
+	)
+
+	assert.Equal(
+		`Message{Type: SimpleEvent, Source: , Destination: , TransactionUUID: , Payload: 2 bytes "\x00\x01"}`,
+		r.String(&Message{Type: SimpleEventMessageType, Payload: []byte{0, 1}}),
+	)
+
+	r.MaxPayloadSize = -1
+	assert.Equal(
+		"Message{Type: SimpleEvent, Source: , Destination: , TransactionUUID: , Payload: 11 bytes}",
+		r.String(&Message{Type: SimpleEventMessageType, Payload: []byte("hello world")}),
+	)
+}
+
+func TestRedactionKeyvals(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		r      = &Redaction{MaxPayloadSize: 4, MaskedMetadata: []string{"/secret"}}
+	)
+
+	assert.Nil(r.Keyvals(nil))
+
+	assert.Equal(
+		[]interface{}{
+			"msg_type", "SimpleRequestResponse",
+			"source", "dns:source.comcast.net",
+			"dest", "mac:112233445566",
+			"transaction_uuid", "1234",
+			"content_type", "text/plain",
+			"metadata", map[string]string{"/secret": MaskedValue, "/public": "value"},
+			"payload_size", 11,
+			"payload", `"hell"...`,
+		},
+		r.Keyvals(&Message{
+			Type:            SimpleRequestResponseMessageType,
+			Source:          "dns:source.comcast.net",
+			Destination:     "mac:112233445566",
+			TransactionUUID: "1234",
+			ContentType:     "text/plain",
+			Metadata:        map[string]string{"/secret": "pii", "/public": "value"},
+			Payload:         []byte("hello world"),
+		}),
+	)
+
+	r.MaxPayloadSize = -1
+	assert.Equal(
+		[]interface{}{
+			"msg_type", "SimpleEvent",
+			"source", "",
+			"dest", "",
+			"transaction_uuid", "",
+			"payload_size", 11,
+		},
+		r.Keyvals(&Message{Type: SimpleEventMessageType, Payload: []byte("hello world")}),
+	)
+}
+
+func TestMessageString(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		payload = bytes.Repeat([]byte("x"), 10*1024*1024)
+		message = &Message{
+			Type:        SimpleEventMessageType,
+			Source:      "dns:source.comcast.net",
+			Destination: "mac:112233445566",
+			Metadata:    map[string]string{"/account": "12345"},
+			Payload:     payload,
+		}
+	)
+
+	defer SetDefaultRedaction(nil)
+
+	output := fmt.Sprintf("%v", message)
+	assert.True(len(output) < 1024)
+	assert.Contains(output, "mac:112233445566")
+	assert.Contains(output, "12345")
+	assert.Equal(message.String(), fmt.Sprint(message))
+
+	SetDefaultRedaction(&Redaction{MaskedMetadata: []string{"/account"}})
+	assert.NotContains(message.String(), "12345")
+	assert.Equal(DefaultRedaction().Keyvals(message), message.LogValue())
+
+	SetDefaultRedaction(nil)
+	assert.Equal(new(Redaction), DefaultRedaction())
+}
+
+func TestMessageLogValue(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		output  bytes.Buffer
+		logger  = logging.NewJSONLogger(&output)
+		message = &Message{
+			Type:        SimpleEventMessageType,
+			Destination: "mac:112233445566",
+			Payload:     bytes.Repeat([]byte("x"), 1024),
+		}
+	)
+
+	logger.Info("message received", message.LogValue()...)
+	assert.Contains(output.String(), `"dest":"mac:112233445566"`)
+	assert.Contains(output.String(), `"payload_size":1024`)
+	assert.True(strings.Count(output.String(), "x") <= DefaultMaxPayloadSize)
+}
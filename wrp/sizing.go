@@ -0,0 +1,295 @@
+package wrp
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock"
+	"github.com/Comcast/webpa-common/concurrent"
+)
+
+const (
+	// DefaultMaxPoolSize is the largest size an automatically sized pool grows to when PoolSizing.MaxSize is not set
+	DefaultMaxPoolSize = 10000
+
+	// DefaultPoolMissRate is the fraction of gets which may miss before an automatically sized pool grows
+	DefaultPoolMissRate = 0.05
+
+	// DefaultPoolSizingInterval is the interval between adjustments of an automatically sized pool
+	DefaultPoolSizingInterval = time.Minute
+)
+
+// PoolSizing configures the automatic resizing of an EncoderPool or DecoderPool.  At each interval,
+// a pool whose miss rate exceeded MissRate grows by the number of misses.  Otherwise, a pool which always
+// had idle encoders or decoders shrinks by half of the fewest that were idle.  The size of the pool always
+// stays within [MinSize, MaxSize].
+type PoolSizing struct {
+	// MinSize is the smallest size of the pool.  If nonpositive, 1 is used.
+	MinSize int
+
+	// MaxSize is the largest size of the pool.  If nonpositive, DefaultMaxPoolSize is used.
+	MaxSize int
+
+	// MissRate is the fraction of gets, between 0 and 1, which may miss before the pool grows.  If nonpositive,
+	// DefaultPoolMissRate is used.
+	MissRate float64
+
+	// Interval is the time between adjustments.  If nonpositive, DefaultPoolSizingInterval is used.
+	Interval time.Duration
+
+	// Clock is the optional clock used to schedule adjustments.  If not supplied, the system clock is used.
+	Clock clock.Interface `json:"-"`
+}
+
+func (ps *PoolSizing) minSize() int {
+	if ps != nil && ps.MinSize > 0 {
+		return ps.MinSize
+	}
+
+	return 1
+}
+
+func (ps *PoolSizing) maxSize() int {
+	if ps != nil && ps.MaxSize > 0 {
+		if min := ps.minSize(); ps.MaxSize < min {
+			return min
+		}
+
+		return ps.MaxSize
+	}
+
+	return DefaultMaxPoolSize
+}
+
+func (ps *PoolSizing) missRate() float64 {
+	if ps != nil && ps.MissRate > 0 {
+		return ps.MissRate
+	}
+
+	return DefaultPoolMissRate
+}
+
+func (ps *PoolSizing) interval() time.Duration {
+	if ps != nil && ps.Interval > 0 {
+		return ps.Interval
+	}
+
+	return DefaultPoolSizingInterval
+}
+
+func (ps *PoolSizing) clock() clock.Interface {
+	if ps != nil && ps.Clock != nil {
+		return ps.Clock
+	}
+
+	return clock.System()
+}
+
+// itemPool is the resizable store of idle encoders or decoders behind EncoderPool and DecoderPool.
+// Idle items are held in a buffered channel, so that gets and puts never take a lock.  Resizing
+// replaces the channel with one of the new capacity.  Items are created lazily, either on a miss
+// or by warm, so a large pool costs nothing until it is used.
+type itemPool struct {
+	// the feedback gathered since the last adjustment, accessed atomically
+	gets     int64
+	misses   int64
+	lowWater int64
+
+	new      func() interface{}
+	measures poolMeasures
+
+	// items holds the current chan interface{} of idle items
+	items atomic.Value
+
+	// resizeLock serializes the operations which replace or fill the channel of idle items
+	resizeLock sync.Mutex
+}
+
+func newItemPool(size int, new func() interface{}, m poolMeasures) *itemPool {
+	if size < 1 {
+		size = DefaultPoolSize
+	}
+
+	ip := &itemPool{
+		new:      new,
+		measures: m,
+	}
+
+	ip.items.Store(make(chan interface{}, size))
+	m.size.Set(float64(size))
+	return ip
+}
+
+// idle returns the current channel of idle items
+func (ip *itemPool) idle() chan interface{} {
+	return ip.items.Load().(chan interface{})
+}
+
+// lower reduces the low water mark to the given number of idle items, if that is lower
+func (ip *itemPool) lower(n int64) {
+	for {
+		current := atomic.LoadInt64(&ip.lowWater)
+		if n >= current || atomic.CompareAndSwapInt64(&ip.lowWater, current, n) {
+			return
+		}
+	}
+}
+
+// get takes an idle item, creating a new one if none are idle
+func (ip *itemPool) get() interface{} {
+	ip.measures.get.Add(1)
+	atomic.AddInt64(&ip.gets, 1)
+
+	idle := ip.idle()
+	select {
+	case item := <-idle:
+		ip.lower(int64(len(idle)))
+		return item
+	default:
+	}
+
+	atomic.AddInt64(&ip.misses, 1)
+	atomic.StoreInt64(&ip.lowWater, 0)
+	ip.measures.miss.Add(1)
+	return ip.new()
+}
+
+// put returns an item to the pool, discarding it if the pool is full.  An item put concurrently with
+// a resize may be dropped along with the replaced channel, which is harmless since it is only idle.
+func (ip *itemPool) put(item interface{}) {
+	select {
+	case ip.idle() <- item:
+	default:
+		ip.measures.discard.Add(1)
+	}
+}
+
+// capacity returns the maximum number of idle items
+func (ip *itemPool) capacity() int {
+	return cap(ip.idle())
+}
+
+// idleCount returns the number of items currently idle
+func (ip *itemPool) idleCount() int {
+	return len(ip.idle())
+}
+
+// resize changes the capacity of the pool, dropping any idle items beyond the new capacity
+func (ip *itemPool) resize(size int) {
+	if size < 1 {
+		size = 1
+	}
+
+	ip.resizeLock.Lock()
+	ip.resizeLocked(size)
+	ip.resizeLock.Unlock()
+}
+
+func (ip *itemPool) resizeLocked(size int) {
+	if previous := ip.idle(); cap(previous) != size {
+		next := make(chan interface{}, size)
+		ip.items.Store(next)
+
+	Transfer:
+		for {
+			select {
+			case item := <-previous:
+				select {
+				case next <- item:
+				default:
+					break Transfer
+				}
+
+			default:
+				break Transfer
+			}
+		}
+
+		ip.lower(int64(len(next)))
+	}
+
+	ip.measures.size.Set(float64(size))
+}
+
+// warm creates items until at least n, bounded by the capacity, are idle.  The number of idle items is returned.
+func (ip *itemPool) warm(n int) int {
+	ip.resizeLock.Lock()
+	defer ip.resizeLock.Unlock()
+
+	idle := ip.idle()
+	if n > cap(idle) {
+		n = cap(idle)
+	}
+
+	for len(idle) < n {
+		select {
+		case idle <- ip.new():
+		default:
+			return len(idle)
+		}
+	}
+
+	return len(idle)
+}
+
+// adjust resizes the pool from the feedback gathered since the last adjustment, then resets that feedback.
+// The new size is returned.
+func (ip *itemPool) adjust(ps *PoolSizing) int {
+	ip.resizeLock.Lock()
+	defer ip.resizeLock.Unlock()
+
+	var (
+		gets     = atomic.SwapInt64(&ip.gets, 0)
+		misses   = atomic.SwapInt64(&ip.misses, 0)
+		lowWater = int(atomic.LoadInt64(&ip.lowWater))
+		size     = ip.capacity()
+	)
+
+	if gets > 0 && float64(misses)/float64(gets) > ps.missRate() {
+		size += int(misses)
+	} else if lowWater > 0 {
+		size -= (lowWater + 1) / 2
+	}
+
+	if min := ps.minSize(); size < min {
+		size = min
+	} else if max := ps.maxSize(); size > max {
+		size = max
+	}
+
+	ip.resizeLocked(size)
+	atomic.StoreInt64(&ip.lowWater, int64(ip.idleCount()))
+	return size
+}
+
+// autoSize returns a concurrent.Runnable which periodically adjusts the pool until shut down
+func (ip *itemPool) autoSize(ps *PoolSizing) concurrent.Runnable {
+	return concurrent.RunnableFunc(func(waitGroup *sync.WaitGroup, shutdown <-chan struct{}) error {
+		ticker := ps.clock().NewTicker(ps.interval())
+
+		// start from a clean slate, so that the first adjustment only reflects this interval
+		ip.resizeLock.Lock()
+		atomic.StoreInt64(&ip.gets, 0)
+		atomic.StoreInt64(&ip.misses, 0)
+		atomic.StoreInt64(&ip.lowWater, int64(ip.idleCount()))
+		ip.resizeLock.Unlock()
+
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-shutdown:
+					return
+				case <-ticker.C():
+					ip.adjust(ps)
+				}
+			}
+		}()
+
+		return nil
+	})
+}
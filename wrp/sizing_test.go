@@ -0,0 +1,129 @@
+package wrp
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Comcast/webpa-common/clock"
+	"github.com/Comcast/webpa-common/clock/clocktest"
+	"github.com/Comcast/webpa-common/xmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolSizingDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	var ps *PoolSizing
+	assert.Equal(1, ps.minSize())
+	assert.Equal(DefaultMaxPoolSize, ps.maxSize())
+	assert.Equal(DefaultPoolMissRate, ps.missRate())
+	assert.Equal(DefaultPoolSizingInterval, ps.interval())
+	assert.Equal(clock.System(), ps.clock())
+
+	fake := clocktest.NewClock(time.Now())
+	ps = &PoolSizing{MinSize: 5, MaxSize: 2, MissRate: 0.5, Interval: time.Second, Clock: fake}
+	assert.Equal(5, ps.minSize())
+	assert.Equal(5, ps.maxSize())
+	assert.Equal(0.5, ps.missRate())
+	assert.Equal(time.Second, ps.interval())
+	assert.Equal(fake, ps.clock())
+}
+
+func TestItemPoolAdjust(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		ps     = &PoolSizing{MinSize: 2, MaxSize: 8, MissRate: 0.25}
+		ip     = newItemPool(4, func() interface{} { return new(int) }, newPoolMeasures(nil, "test", Msgpack))
+	)
+
+	// no feedback leaves the size alone
+	assert.Equal(4, ip.adjust(ps))
+
+	// every get misses on an empty pool, so the pool grows by the number of misses
+	for repeat := 0; repeat < 3; repeat++ {
+		ip.get()
+	}
+
+	assert.Equal(7, ip.adjust(ps))
+
+	// growth is bounded by the maximum
+	for repeat := 0; repeat < 3; repeat++ {
+		ip.get()
+	}
+
+	assert.Equal(8, ip.adjust(ps))
+
+	// an interval in which items were always idle shrinks the pool by half the low water mark
+	assert.Equal(8, ip.warm(8))
+	ip.adjust(ps)
+	for repeat := 0; repeat < 4; repeat++ {
+		ip.put(ip.get())
+	}
+
+	assert.Equal(4, ip.adjust(ps))
+	assert.Equal(4, ip.idleCount())
+
+	// shrinking is bounded by the minimum
+	assert.Equal(2, ip.adjust(ps))
+	assert.Equal(2, ip.adjust(ps))
+	assert.Equal(2, ip.idleCount())
+
+	// one miss in three gets exceeds the threshold, and the pool grows by that miss
+	ip.get()
+	ip.get()
+	ip.get()
+	assert.Equal(2, ip.capacity())
+	assert.Equal(3, ip.adjust(ps))
+}
+
+func TestAutoSize(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		fake     = clocktest.NewClock(time.Now())
+		ps       = &PoolSizing{MaxSize: 50, Interval: time.Minute, Clock: fake}
+		shutdown = make(chan struct{})
+
+		waitGroup sync.WaitGroup
+	)
+
+	registry, err := xmetrics.NewRegistry(nil, Metrics)
+	require.NoError(err)
+
+	encoderPool := newEncoderPool(1, Msgpack, registry, nil, nil)
+	decoderPool := newDecoderPool(1, Msgpack, registry, nil, nil)
+	require.NoError(encoderPool.AutoSize(ps).Run(&waitGroup, shutdown))
+	require.NoError(decoderPool.AutoSize(nil).Run(&waitGroup, shutdown))
+
+	fake.BlockUntil(1)
+
+	// every get in a burst of 10 concurrent encoders misses the lazily populated pool
+	encoders := make([]Encoder, 10)
+	for i := range encoders {
+		encoders[i] = encoderPool.Get()
+	}
+
+	for _, encoder := range encoders {
+		encoderPool.Put(encoder)
+	}
+
+	fake.Add(time.Minute)
+	for encoderPool.Size() == 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Equal(11, encoderPool.Size())
+
+	response := httptest.NewRecorder()
+	registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(response.Body.String(), PoolSizeGauge+`{format="Msgpack",pool="encoder"} 11`)
+
+	close(shutdown)
+	waitGroup.Wait()
+	assert.Zero(fake.Waiters())
+	assert.Equal(1, decoderPool.Size())
+}
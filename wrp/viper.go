@@ -1,6 +1,7 @@
 package wrp
 
 import (
+	"github.com/Comcast/webpa-common/xmetrics"
 	"github.com/spf13/viper"
 )
 
@@ -13,6 +14,22 @@ const (
 type PoolFactory struct {
 	DecoderPoolSize int
 	EncoderPoolSize int
+
+	// Warm indicates whether pools are fully populated when created.  By default, encoders and decoders
+	// are only created as they are needed.
+	Warm bool
+
+	// Compression, if supplied, enables the transparent compression of message payloads by encoder pools
+	Compression *Compression
+
+	// Decompression, if supplied, enables the decompression of message payloads by decoder pools
+	Decompression *Decompression
+
+	// Checksum, if supplied, enables payload checksums, which are computed by encoder pools and verified by decoder pools
+	Checksum *Checksum
+
+	// MetricsProvider is the optional source of the pool metrics declared by Metrics
+	MetricsProvider xmetrics.Provider
 }
 
 func NewPoolFactory(v *viper.Viper) (pf *PoolFactory, err error) {
@@ -21,13 +38,31 @@ func NewPoolFactory(v *viper.Viper) (pf *PoolFactory, err error) {
 		err = v.Unmarshal(pf)
 	}
 
+	if err == nil && pf.Compression != nil {
+		err = pf.Compression.validate()
+	}
+
+	if err == nil && pf.Checksum != nil {
+		err = pf.Checksum.validate()
+	}
+
 	return
 }
 
 func (pf *PoolFactory) NewEncoderPool(f Format) *EncoderPool {
-	return NewEncoderPool(pf.EncoderPoolSize, f)
+	ep := newEncoderPool(pf.EncoderPoolSize, f, pf.MetricsProvider, pf.Compression, pf.Checksum)
+	if pf.Warm {
+		ep.Warm(ep.Size())
+	}
+
+	return ep
 }
 
 func (pf *PoolFactory) NewDecoderPool(f Format) *DecoderPool {
-	return NewDecoderPool(pf.DecoderPoolSize, f)
+	dp := newDecoderPool(pf.DecoderPoolSize, f, pf.MetricsProvider, pf.Checksum, pf.Decompression)
+	if pf.Warm {
+		dp.Warm(dp.Size())
+	}
+
+	return dp
 }
@@ -1,9 +1,11 @@
 package wrp
 
 import (
+	"github.com/Comcast/webpa-common/xmetrics"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"net/http/httptest"
 	"strings"
 	"testing"
 )
@@ -64,4 +66,133 @@ func TestNewPoolFactory(t *testing.T) {
 		assert.NotNil(factory)
 		assert.Error(err)
 	})
+
+	t.Run("WithCompression", func(t *testing.T) {
+		v := viper.New()
+		v.SetConfigType("json")
+		require.NoError(v.ReadConfig(strings.NewReader(`{
+			"wrp": {
+				"compression": {
+					"encoding": "deflate",
+					"threshold": 10
+				},
+				"decompression": {
+					"maxPayloadSize": 1000
+				}
+			}
+		}`)))
+
+		factory, err := NewPoolFactory(v.Sub(ViperKey))
+		require.NotNil(factory)
+		require.NoError(err)
+		require.NotNil(factory.Compression)
+		assert.Equal(DeflateEncoding, factory.Compression.Encoding)
+
+		var (
+			message = &Message{Type: SimpleEventMessageType, Payload: []byte(strings.Repeat("compress me ", 10))}
+			encoded []byte
+			decoded Message
+		)
+
+		require.NoError(factory.NewEncoderPool(Msgpack).EncodeBytes(&encoded, message))
+		require.NoError(NewDecoderBytes(encoded, Msgpack).Decode(&decoded))
+		assert.Equal(DeflateEncoding, decoded.Metadata[ContentEncodingMetadataKey])
+
+		require.NotNil(factory.Decompression)
+		assert.Equal(1000, factory.Decompression.MaxPayloadSize)
+
+		decoded = Message{}
+		require.NoError(factory.NewDecoderPool(Msgpack).DecodeBytes(&decoded, encoded))
+		assert.Equal(message.Payload, decoded.Payload)
+	})
+
+	t.Run("BadCompression", func(t *testing.T) {
+		v := viper.New()
+		v.SetConfigType("json")
+		require.NoError(v.ReadConfig(strings.NewReader(`{
+			"wrp": {
+				"compression": {
+					"encoding": "br"
+				}
+			}
+		}`)))
+
+		factory, err := NewPoolFactory(v.Sub(ViperKey))
+		assert.NotNil(factory)
+		assert.Equal(ErrorUnsupportedEncoding, err)
+	})
+
+	t.Run("WithChecksum", func(t *testing.T) {
+		v := viper.New()
+		v.SetConfigType("json")
+		require.NoError(v.ReadConfig(strings.NewReader(`{
+			"wrp": {
+				"checksum": {
+					"algorithm": "xxhash",
+					"reject": true
+				}
+			}
+		}`)))
+
+		factory, err := NewPoolFactory(v.Sub(ViperKey))
+		require.NotNil(factory)
+		require.NoError(err)
+		require.NotNil(factory.Checksum)
+		assert.Equal(XXHashChecksum, factory.Checksum.Algorithm)
+		assert.True(factory.Checksum.Reject)
+
+		var (
+			message = &Message{Type: SimpleEventMessageType, Payload: []byte("checksum me")}
+			encoded []byte
+			decoded Message
+		)
+
+		require.NoError(factory.NewEncoderPool(Msgpack).EncodeBytes(&encoded, message))
+		require.NoError(factory.NewDecoderPool(Msgpack).DecodeBytes(&decoded, encoded))
+		assert.True(strings.HasPrefix(decoded.Metadata[ChecksumMetadataKey], XXHashChecksum+":"))
+	})
+
+	t.Run("BadChecksum", func(t *testing.T) {
+		v := viper.New()
+		v.SetConfigType("json")
+		require.NoError(v.ReadConfig(strings.NewReader(`{
+			"wrp": {
+				"checksum": {
+					"algorithm": "md5"
+				}
+			}
+		}`)))
+
+		factory, err := NewPoolFactory(v.Sub(ViperKey))
+		assert.NotNil(factory)
+		assert.Equal(ErrorUnsupportedChecksum, err)
+	})
+
+	t.Run("WithMetrics", func(t *testing.T) {
+		registry, err := xmetrics.NewRegistry(nil, Metrics)
+		require.NotNil(registry)
+		require.NoError(err)
+
+		factory := &PoolFactory{DecoderPoolSize: 1, EncoderPoolSize: 1, Warm: true, MetricsProvider: registry}
+		encoderPool := factory.NewEncoderPool(Msgpack)
+		decoderPool := factory.NewDecoderPool(JSON)
+
+		// take two encoders from a pool of one, then return both
+		first, second := encoderPool.Get(), encoderPool.Get()
+		encoderPool.Put(first)
+		encoderPool.Put(second)
+
+		decoderPool.Put(decoderPool.Get())
+
+		response := httptest.NewRecorder()
+		registry.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+		output := response.Body.String()
+
+		assert.Contains(output, PoolGetCounter+`{format="Msgpack",pool="encoder"} 2`)
+		assert.Contains(output, PoolMissCounter+`{format="Msgpack",pool="encoder"} 1`)
+		assert.Contains(output, PoolDiscardCounter+`{format="Msgpack",pool="encoder"} 1`)
+		assert.Contains(output, PoolGetCounter+`{format="JSON",pool="decoder"} 1`)
+		assert.NotContains(output, PoolMissCounter+`{format="JSON",pool="decoder"}`)
+		assert.Contains(output, PoolSizeGauge+`{format="Msgpack",pool="encoder"} 1`)
+	})
 }
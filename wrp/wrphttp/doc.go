@@ -0,0 +1,20 @@
+/*
+Package wrphttp provides HTTP middleware for endpoints that exchange WRP messages.
+
+Rather than each HTTP+WRP endpoint negotiating formats and decoding request bodies itself, a handler is
+decorated by a Negotiator:
+
+	negotiator := wrphttp.NewNegotiator(&wrp.PoolFactory{DecoderPoolSize: 100, EncoderPoolSize: 100}, wrp.Msgpack)
+	router.Handle("/api/v2/device", negotiator.Decorate(http.HandlerFunc(
+		func(response http.ResponseWriter, request *http.Request) {
+			message, _ := wrphttp.GetMessage(request.Context())
+			// ... process the message ...
+			wrphttp.WriteMessage(response, http.StatusOK, reply)
+		},
+	)))
+
+The request's Content-Type selects the format of the request body, which is decoded into a *wrp.Message
+placed in the request's context.  The request's Accept header selects the format of the response, and
+WriteMessage encodes responses in that format.
+*/
+package wrphttp
@@ -0,0 +1,206 @@
+package wrphttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Comcast/webpa-common/httperror"
+	"github.com/Comcast/webpa-common/tracing"
+	"github.com/Comcast/webpa-common/wrp"
+)
+
+const (
+	// ContentTypeHeader is the header whose value selects the format of a request body
+	ContentTypeHeader = "Content-Type"
+
+	// AcceptHeader is the header whose value selects the format of a response body
+	AcceptHeader = "Accept"
+
+	// FormatTag is the span tag whose value is the WRP format being encoded or decoded
+	FormatTag = "wrp.format"
+)
+
+type contextKey int
+
+const (
+	messageKey contextKey = iota
+	formatKey
+)
+
+// WithMessage returns a new Context carrying the given WRP message
+func WithMessage(ctx context.Context, message *wrp.Message) context.Context {
+	return context.WithValue(ctx, messageKey, message)
+}
+
+// GetMessage returns the WRP message decoded from the request body, if any
+func GetMessage(ctx context.Context) (*wrp.Message, bool) {
+	message, ok := ctx.Value(messageKey).(*wrp.Message)
+	return message, ok
+}
+
+// WithFormat returns a new Context carrying the negotiated response format
+func WithFormat(ctx context.Context, f wrp.Format) context.Context {
+	return context.WithValue(ctx, formatKey, f)
+}
+
+// GetFormat returns the negotiated response format, if any
+func GetFormat(ctx context.Context) (wrp.Format, bool) {
+	f, ok := ctx.Value(formatKey).(wrp.Format)
+	return f, ok
+}
+
+// ResponseWriter is the http.ResponseWriter passed to handlers decorated by a Negotiator.  Handlers
+// will usually use WriteMessage rather than this interface directly.
+type ResponseWriter interface {
+	http.ResponseWriter
+
+	// WRPFormat returns the negotiated response format
+	WRPFormat() wrp.Format
+
+	// WriteWRP encodes a WRP message, which may be a *wrp.Message or any of the other WRP types, as the
+	// response body in the negotiated format.  If the message cannot be encoded, nothing is written.
+	WriteWRP(code int, message interface{}) error
+}
+
+// responseWriter is the internal ResponseWriter implementation
+type responseWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	encoders *wrp.EncoderPool
+}
+
+func (rw *responseWriter) WRPFormat() wrp.Format {
+	return rw.encoders.Format()
+}
+
+func (rw *responseWriter) WriteWRP(code int, message interface{}) error {
+	span, _ := tracing.StartSpan(rw.ctx, "wrp.encode")
+	span.SetTag(FormatTag, rw.encoders.Format().String())
+
+	var body []byte
+	err := rw.encoders.EncodeBytes(&body, message)
+	span.SetError(err)
+	span.Finish()
+
+	if err != nil {
+		return err
+	}
+
+	return writeBody(rw, code, rw.encoders.Format(), body)
+}
+
+// writeBody writes an encoded WRP message along with its content headers
+func writeBody(response http.ResponseWriter, code int, f wrp.Format, body []byte) error {
+	response.Header().Set(ContentTypeHeader, f.ContentType())
+	response.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	response.WriteHeader(code)
+	_, err := response.Write(body)
+	return err
+}
+
+// WriteMessage writes a WRP message as the response body.  If the response was decorated by a Negotiator,
+// the message is encoded in the negotiated format.  Otherwise, wrp.Msgpack is used.
+func WriteMessage(response http.ResponseWriter, code int, message interface{}) error {
+	if rw, ok := response.(ResponseWriter); ok {
+		return rw.WriteWRP(code, message)
+	}
+
+	var body []byte
+	if err := wrp.NewEncoderBytes(&body, wrp.Msgpack).Encode(message); err != nil {
+		return err
+	}
+
+	return writeBody(response, code, wrp.Msgpack, body)
+}
+
+// Negotiator is HTTP middleware that handles the WRP boilerplate of endpoints.  For each request, the
+// Content-Type selects the format in which the request body is decoded, and the Accept header selects the
+// format in which responses are encoded.  A request with an unsupported Content-Type is refused with
+// http.StatusUnsupportedMediaType, and one which accepts no WRP format is refused with http.StatusNotAcceptable.
+//
+// A nonempty request body is decoded into a *wrp.Message available via GetMessage.  If the body cannot
+// be decoded, the request is refused with http.StatusBadRequest.  Requests without a body, e.g. GETs, are
+// passed along without a message.
+//
+// Decoding requests and encoding responses are recorded as "wrp.decode" and "wrp.encode" spans, using the
+// tracing package's process-wide Tracer.  The trace context of the request, taken from its headers or, failing
+// that, from the metadata of its WRP message, is passed along to the delegate in the request's Context.
+type Negotiator struct {
+	defaultFormat wrp.Format
+	decoders      map[wrp.Format]*wrp.DecoderPool
+	encoders      map[wrp.Format]*wrp.EncoderPool
+}
+
+// NewNegotiator creates a Negotiator whose encoders and decoders are pooled according to the given
+// PoolFactory, which may be nil.  The default format is assumed for requests without a Content-Type.
+// Formats added with wrp.RegisterFormat are only negotiated if registered before this function is called.
+func NewNegotiator(pf *wrp.PoolFactory, defaultFormat wrp.Format) *Negotiator {
+	if pf == nil {
+		pf = new(wrp.PoolFactory)
+	}
+
+	n := &Negotiator{
+		defaultFormat: defaultFormat,
+		decoders:      make(map[wrp.Format]*wrp.DecoderPool),
+		encoders:      make(map[wrp.Format]*wrp.EncoderPool),
+	}
+
+	for _, f := range wrp.Formats() {
+		n.decoders[f] = pf.NewDecoderPool(f)
+		n.encoders[f] = pf.NewEncoderPool(f)
+	}
+
+	return n
+}
+
+// Decorate provides an Alice-compatible constructor that negotiates WRP formats for the delegate
+func (n *Negotiator) Decorate(delegate http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		requestFormat, err := FormatFromContentType(request.Header.Get(ContentTypeHeader), n.defaultFormat)
+		if _, ok := n.decoders[requestFormat]; err == nil && !ok {
+			err = ErrorUnsupportedContentType
+		}
+
+		if err != nil {
+			httperror.Formatf(response, http.StatusUnsupportedMediaType, "%s: %s", err, request.Header.Get(ContentTypeHeader))
+			return
+		}
+
+		responseFormat, err := FormatFromAccept(request.Header.Get(AcceptHeader), requestFormat)
+		if _, ok := n.encoders[responseFormat]; err == nil && !ok {
+			err = ErrorNotAcceptable
+		}
+
+		if err != nil {
+			httperror.Formatf(response, http.StatusNotAcceptable, "%s: %s", err, request.Header.Get(AcceptHeader))
+			return
+		}
+
+		ctx := WithFormat(tracing.RequestContext(request), responseFormat)
+		if request.Body != nil {
+			span, _ := tracing.StartSpan(ctx, "wrp.decode")
+			span.SetTag(FormatTag, requestFormat.String())
+
+			message := new(wrp.Message)
+			err := n.decoders[requestFormat].Decode(message, request.Body)
+			if err != io.EOF {
+				span.SetError(err)
+			}
+
+			span.Finish()
+			if err == nil {
+				ctx = WithMessage(tracing.MessageContext(ctx, message), message)
+			} else if err != io.EOF {
+				httperror.Formatf(response, httperror.InvalidWRPFormat.StatusCode(), "Could not decode WRP message: %s", err)
+				return
+			}
+		}
+
+		delegate.ServeHTTP(
+			&responseWriter{ResponseWriter: response, ctx: ctx, encoders: n.encoders[responseFormat]},
+			request.WithContext(ctx),
+		)
+	})
+}
@@ -0,0 +1,249 @@
+package wrphttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Comcast/webpa-common/tracing"
+	"github.com/Comcast/webpa-common/tracing/tracingtest"
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext(t *testing.T) {
+	assert := assert.New(t)
+
+	message, ok := GetMessage(context.Background())
+	assert.Nil(message)
+	assert.False(ok)
+
+	f, ok := GetFormat(context.Background())
+	assert.Equal(wrp.Msgpack, f)
+	assert.False(ok)
+
+	expected := &wrp.Message{Type: wrp.SimpleEventMessageType}
+	message, ok = GetMessage(WithMessage(context.Background(), expected))
+	assert.Equal(expected, message)
+	assert.True(ok)
+
+	f, ok = GetFormat(WithFormat(context.Background(), wrp.JSON))
+	assert.Equal(wrp.JSON, f)
+	assert.True(ok)
+}
+
+// failingMessage is a WRP message that cannot be encoded
+type failingMessage struct{}
+
+func (failingMessage) BeforeEncode() error {
+	return errors.New("expected")
+}
+
+func TestWriteMessageUndecorated(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		response = httptest.NewRecorder()
+		expected = &wrp.Message{Type: wrp.SimpleEventMessageType, Source: "test", Destination: "event:test"}
+	)
+
+	require.NoError(WriteMessage(response, http.StatusAccepted, expected))
+	assert.Equal(http.StatusAccepted, response.Code)
+	assert.Equal(wrp.Msgpack.ContentType(), response.Header().Get(ContentTypeHeader))
+
+	var actual wrp.Message
+	require.NoError(wrp.NewDecoderBytes(response.Body.Bytes(), wrp.Msgpack).Decode(&actual))
+	assert.Equal(*expected, actual)
+
+	// a value that cannot be encoded writes nothing
+	response = httptest.NewRecorder()
+	assert.Error(WriteMessage(response, http.StatusOK, failingMessage{}))
+	assert.Empty(response.Body.Bytes())
+	assert.Empty(response.Header())
+}
+
+// echo is a handler which responds with the request's message, or with http.StatusNoContent if there is none
+func echo(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		message, ok := GetMessage(request.Context())
+		if !ok {
+			response.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		f, _ := GetFormat(request.Context())
+		assert.Equal(t, f, response.(ResponseWriter).WRPFormat())
+		assert.NoError(t, WriteMessage(response, http.StatusOK, message))
+	})
+}
+
+func TestNegotiator(t *testing.T) {
+	var (
+		expected = &wrp.Message{
+			Type:            wrp.SimpleRequestResponseMessageType,
+			Source:          "dns:talaria.example.com",
+			Destination:     "mac:112233445566/config",
+			TransactionUUID: "DEADBEEF",
+			Payload:         []byte("payload"),
+		}
+
+		decorated = NewNegotiator(nil, wrp.Msgpack).Decorate(echo(t))
+	)
+
+	testData := []struct {
+		contentType    string
+		accept         string
+		requestFormat  wrp.Format
+		responseFormat wrp.Format
+	}{
+		{"", "", wrp.Msgpack, wrp.Msgpack},
+		{"application/json", "", wrp.JSON, wrp.JSON},
+		{"application/json", "application/msgpack", wrp.JSON, wrp.Msgpack},
+		{"application/msgpack", "application/json", wrp.Msgpack, wrp.JSON},
+		{"application/x-msgpack", "*/*", wrp.Msgpack, wrp.Msgpack},
+	}
+
+	for _, record := range testData {
+		t.Run(record.contentType+"->"+record.accept, func(t *testing.T) {
+			var (
+				assert   = assert.New(t)
+				require  = require.New(t)
+				request  = httptest.NewRequest("POST", "/", bytes.NewReader(wrp.MustEncode(expected, record.requestFormat)))
+				response = httptest.NewRecorder()
+				actual   wrp.Message
+			)
+
+			if len(record.contentType) > 0 {
+				request.Header.Set(ContentTypeHeader, record.contentType)
+			}
+
+			if len(record.accept) > 0 {
+				request.Header.Set(AcceptHeader, record.accept)
+			}
+
+			decorated.ServeHTTP(response, request)
+			assert.Equal(http.StatusOK, response.Code)
+			assert.Equal(record.responseFormat.ContentType(), response.Header().Get(ContentTypeHeader))
+			require.NoError(wrp.NewDecoderBytes(response.Body.Bytes(), record.responseFormat).Decode(&actual))
+			assert.Equal(*expected, actual)
+		})
+	}
+}
+
+func TestNegotiatorNoBody(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		decorated = NewNegotiator(nil, wrp.JSON).Decorate(echo(t))
+	)
+
+	for _, request := range []*http.Request{httptest.NewRequest("GET", "/", nil), httptest.NewRequest("POST", "/", strings.NewReader(""))} {
+		response := httptest.NewRecorder()
+		decorated.ServeHTTP(response, request)
+		assert.Equal(http.StatusNoContent, response.Code)
+	}
+}
+
+func TestNegotiatorTracing(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		tracer  = tracingtest.NewTracer()
+		remote  = tracing.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}
+		message = &wrp.Message{
+			Type:        wrp.SimpleEventMessageType,
+			Source:      "mac:112233445566",
+			Destination: "event:test",
+		}
+
+		delegateContext tracing.SpanContext
+		decorated       = NewNegotiator(nil, wrp.Msgpack).Decorate(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			delegateContext = tracing.SpanContextFromContext(request.Context())
+			echo(t).ServeHTTP(response, request)
+		}))
+	)
+
+	defer tracer.Install()()
+	tracing.InjectMessage(remote, message)
+
+	response := httptest.NewRecorder()
+	decorated.ServeHTTP(response, httptest.NewRequest("POST", "/", bytes.NewReader(wrp.MustEncode(message, wrp.Msgpack))))
+	require.Equal(http.StatusOK, response.Code)
+
+	// the trace context in the message metadata is continued by the delegate
+	assert.Equal(remote, delegateContext)
+
+	spans := tracer.Spans()
+	require.Len(spans, 2)
+
+	assert.Equal("wrp.decode", spans[0].Name)
+	assert.False(spans[0].Parent.IsValid())
+	assert.Equal(wrp.Msgpack.String(), spans[0].Tags[FormatTag])
+	assert.NoError(spans[0].Error)
+	assert.True(spans[0].Finished)
+
+	assert.Equal("wrp.encode", spans[1].Name)
+	assert.Equal(remote, spans[1].Parent)
+	assert.Equal(wrp.Msgpack.String(), spans[1].Tags[FormatTag])
+	assert.True(spans[1].Finished)
+
+	// trace context in the request headers takes precedence
+	header := tracing.SpanContext{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331"}
+	request := httptest.NewRequest("POST", "/", strings.NewReader("this is not msgpack"))
+	tracing.InjectHeader(header, request.Header)
+
+	response = httptest.NewRecorder()
+	decorated.ServeHTTP(response, request)
+	assert.Equal(http.StatusBadRequest, response.Code)
+
+	spans = tracer.Spans()
+	require.Len(spans, 3)
+	assert.Equal("wrp.decode", spans[2].Name)
+	assert.Equal(header, spans[2].Parent)
+	assert.Error(spans[2].Error)
+}
+
+func TestNegotiatorErrors(t *testing.T) {
+	var (
+		decorated = NewNegotiator(&wrp.PoolFactory{DecoderPoolSize: 1, EncoderPoolSize: 1}, wrp.Msgpack).Decorate(
+			http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				t.Error("The delegate should not have been called")
+			}),
+		)
+	)
+
+	testData := []struct {
+		name         string
+		contentType  string
+		accept       string
+		body         string
+		expectedCode int
+	}{
+		{"UnsupportedContentType", "text/plain", "", "", http.StatusUnsupportedMediaType},
+		{"NotAcceptable", "application/json", "text/html", "", http.StatusNotAcceptable},
+		{"Malformed", "application/json", "", "this is not JSON", http.StatusBadRequest},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			var (
+				assert   = assert.New(t)
+				request  = httptest.NewRequest("POST", "/", strings.NewReader(record.body))
+				response = httptest.NewRecorder()
+			)
+
+			request.Header.Set(ContentTypeHeader, record.contentType)
+			if len(record.accept) > 0 {
+				request.Header.Set(AcceptHeader, record.accept)
+			}
+
+			decorated.ServeHTTP(response, request)
+			assert.Equal(record.expectedCode, response.Code)
+			assert.Equal("application/json", response.Header().Get(ContentTypeHeader))
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package wrphttp
+
+import (
+	"errors"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/Comcast/webpa-common/wrp"
+)
+
+var (
+	ErrorUnsupportedContentType = errors.New("Unsupported WRP content type")
+	ErrorNotAcceptable          = errors.New("None of the acceptable media types is a WRP format")
+)
+
+// formats maps the media types of WRP messages onto their formats.  Formats added with wrp.RegisterFormat
+// are matched by their content types, via formatFromMediaType.
+var formats = map[string]wrp.Format{
+	wrp.Msgpack.ContentType(): wrp.Msgpack,
+	"application/x-msgpack":   wrp.Msgpack,
+	wrp.JSON.ContentType():    wrp.JSON,
+}
+
+// formatFromMediaType returns the WRP format, builtin or registered, with the given media type
+func formatFromMediaType(mediaType string) (wrp.Format, bool) {
+	if f, ok := formats[mediaType]; ok {
+		return f, true
+	}
+
+	for _, f := range wrp.Formats() {
+		if strings.EqualFold(mediaType, f.ContentType()) {
+			return f, true
+		}
+	}
+
+	return wrp.Msgpack, false
+}
+
+// FormatFromContentType returns the WRP format denoted by a Content-Type value.  Parameters, such as charset,
+// are ignored.  If the value is empty, the given default format is returned.
+func FormatFromContentType(contentType string, defaultFormat wrp.Format) (wrp.Format, error) {
+	if len(contentType) == 0 {
+		return defaultFormat, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return defaultFormat, ErrorUnsupportedContentType
+	}
+
+	if f, ok := formatFromMediaType(mediaType); ok {
+		return f, nil
+	}
+
+	return defaultFormat, ErrorUnsupportedContentType
+}
+
+// FormatFromAccept returns the WRP format most preferred by an Accept value.  Media ranges are
+// weighed by their quality, with ties going to the earliest listed, and ranges with a quality of zero
+// are refused.  The wildcard ranges */* and application/* accept the preferred format, which is also
+// returned when the value is empty.
+func FormatFromAccept(accept string, preferred wrp.Format) (wrp.Format, error) {
+	if len(strings.TrimSpace(accept)) == 0 {
+		return preferred, nil
+	}
+
+	var (
+		best    = preferred
+		quality = 0.0
+	)
+
+	for _, element := range strings.Split(accept, ",") {
+		mediaType, parameters, err := mime.ParseMediaType(element)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := parameters["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		if q <= quality {
+			continue
+		}
+
+		if f, ok := formatFromMediaType(mediaType); ok {
+			best, quality = f, q
+		} else if mediaType == "*/*" || mediaType == "application/*" {
+			best, quality = preferred, q
+		}
+	}
+
+	if quality > 0 {
+		return best, nil
+	}
+
+	return preferred, ErrorNotAcceptable
+}
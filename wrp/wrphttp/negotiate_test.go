@@ -0,0 +1,86 @@
+package wrphttp
+
+import (
+	"testing"
+
+	"github.com/Comcast/webpa-common/wrp"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
+)
+
+// testCBOR is a registered format, which is negotiated by its content type like the builtin formats
+var testCBOR = func() wrp.Format {
+	f, err := wrp.RegisterFormat("CBOR", wrp.NewCodecFormat("application/cbor", &codec.CborHandle{
+		BasicHandle: codec.BasicHandle{
+			TypeInfos: codec.NewTypeInfos([]string{"wrp"}),
+		},
+	}))
+
+	if err != nil {
+		panic(err)
+	}
+
+	return f
+}()
+
+func TestFormatFromContentType(t *testing.T) {
+	testData := []struct {
+		contentType   string
+		defaultFormat wrp.Format
+		expected      wrp.Format
+		expectedError error
+	}{
+		{"", wrp.Msgpack, wrp.Msgpack, nil},
+		{"", wrp.JSON, wrp.JSON, nil},
+		{"application/msgpack", wrp.JSON, wrp.Msgpack, nil},
+		{"application/x-msgpack", wrp.JSON, wrp.Msgpack, nil},
+		{"application/json", wrp.Msgpack, wrp.JSON, nil},
+		{"Application/JSON; charset=utf-8", wrp.Msgpack, wrp.JSON, nil},
+		{"application/cbor", wrp.Msgpack, testCBOR, nil},
+		{"text/plain", wrp.Msgpack, wrp.Msgpack, ErrorUnsupportedContentType},
+		{"this is not a media type", wrp.JSON, wrp.JSON, ErrorUnsupportedContentType},
+	}
+
+	for _, record := range testData {
+		t.Run(record.contentType, func(t *testing.T) {
+			assert := assert.New(t)
+			actual, err := FormatFromContentType(record.contentType, record.defaultFormat)
+			assert.Equal(record.expected, actual)
+			assert.Equal(record.expectedError, err)
+		})
+	}
+}
+
+func TestFormatFromAccept(t *testing.T) {
+	testData := []struct {
+		accept        string
+		preferred     wrp.Format
+		expected      wrp.Format
+		expectedError error
+	}{
+		{"", wrp.Msgpack, wrp.Msgpack, nil},
+		{"  ", wrp.JSON, wrp.JSON, nil},
+		{"application/json", wrp.Msgpack, wrp.JSON, nil},
+		{"application/msgpack", wrp.JSON, wrp.Msgpack, nil},
+		{"*/*", wrp.JSON, wrp.JSON, nil},
+		{"application/*", wrp.Msgpack, wrp.Msgpack, nil},
+		{"text/html, application/json;q=0.5", wrp.Msgpack, wrp.JSON, nil},
+		{"application/json;q=0.5, application/msgpack", wrp.JSON, wrp.Msgpack, nil},
+		{"application/json, application/msgpack", wrp.Msgpack, wrp.JSON, nil},
+		{"application/msgpack;q=0.1, */*;q=0.9", wrp.JSON, wrp.JSON, nil},
+		{"application/json;q=0, application/x-msgpack;q=0.2", wrp.JSON, wrp.Msgpack, nil},
+		{"application/json;q=nope, application/msgpack", wrp.JSON, wrp.Msgpack, nil},
+		{"application/json;q=0", wrp.JSON, wrp.JSON, ErrorNotAcceptable},
+		{"text/html", wrp.Msgpack, wrp.Msgpack, ErrorNotAcceptable},
+		{"this is not a media type", wrp.Msgpack, wrp.Msgpack, ErrorNotAcceptable},
+	}
+
+	for _, record := range testData {
+		t.Run(record.accept, func(t *testing.T) {
+			assert := assert.New(t)
+			actual, err := FormatFromAccept(record.accept, record.preferred)
+			assert.Equal(record.expected, actual)
+			assert.Equal(record.expectedError, err)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package wrp
+
+import "encoding/binary"
+
+// The xxHash64 primes
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func xxRotate(x uint64, r uint) uint64 {
+	return (x << r) | (x >> (64 - r))
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = xxRotate(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, value uint64) uint64 {
+	acc ^= xxRound(0, value)
+	return acc*xxPrime1 + xxPrime4
+}
+
+// xxhash64 computes the 64-bit xxHash, with a zero seed, of some data.  This is a straightforward
+// implementation of the reference algorithm, kept here so that this package has no further dependencies.
+func xxhash64(data []byte) uint64 {
+	var (
+		length = uint64(len(data))
+		h      uint64
+	)
+
+	if len(data) >= 32 {
+		var (
+			prime1 = xxPrime1
+			v1     = prime1 + xxPrime2
+			v2     = xxPrime2
+			v3     uint64
+			v4     = -prime1
+		)
+
+		for ; len(data) >= 32; data = data[32:] {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(data[0:8]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(data[8:16]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(data[16:24]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(data[24:32]))
+		}
+
+		h = xxRotate(v1, 1) + xxRotate(v2, 7) + xxRotate(v3, 12) + xxRotate(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = xxPrime5
+	}
+
+	h += length
+
+	for ; len(data) >= 8; data = data[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(data[0:8]))
+		h = xxRotate(h, 27)*xxPrime1 + xxPrime4
+	}
+
+	if len(data) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(data[0:4])) * xxPrime1
+		h = xxRotate(h, 23)*xxPrime2 + xxPrime3
+		data = data[4:]
+	}
+
+	for _, b := range data {
+		h ^= uint64(b) * xxPrime5
+		h = xxRotate(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
@@ -0,0 +1,26 @@
+package wrp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXXHash64(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		testData = []struct {
+			data     string
+			expected uint64
+		}{
+			{"", 0xef46db3751d8e999},
+			{"a", 0xd24ec4f1a98c6e5b},
+			{"abc", 0x44bc2cf5ad770999},
+			{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+		}
+	)
+
+	for _, record := range testData {
+		assert.Equal(record.expected, xxhash64([]byte(record.data)), "%q", record.data)
+	}
+}
@@ -0,0 +1,12 @@
+/*
+Package xmetrics provides the metrics infrastructure shared by the other packages in this library.
+
+Components which produce metrics declare them in a Module, such as device.Metrics, and obtain
+their counters, gauges, and histograms from a Provider supplied through their options.  Provider
+hands out go-kit metrics, so instrumented code does not depend on any particular backend.  When no
+Provider is configured, components use NewDiscardProvider.
+
+Registry is the Prometheus implementation of Provider.  It is also the http.Handler which exposes its metrics
+for scraping.
+*/
+package xmetrics
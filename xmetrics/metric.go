@@ -0,0 +1,70 @@
+package xmetrics
+
+import (
+	"errors"
+)
+
+const (
+	CounterType   = "counter"
+	GaugeType     = "gauge"
+	HistogramType = "histogram"
+)
+
+var (
+	ErrorMetricNoName      = errors.New("Metrics must be named")
+	ErrorMetricInvalidType = errors.New("Metrics must be a counter, gauge, or histogram")
+	ErrorMetricDuplicate   = errors.New("Duplicate metric")
+)
+
+// Metric describes a single metric.  Metrics are declared by Modules, and can also be declared
+// or reconfigured in Options.
+type Metric struct {
+	// Name is the name of the metric, unique within a Registry.  The name does not include
+	// any namespace or subsystem.
+	Name string `json:"name"`
+
+	// Type is one of CounterType, GaugeType, or HistogramType
+	Type string `json:"type"`
+
+	// Help is the description of the metric.  If not supplied, the name is used.
+	Help string `json:"help"`
+
+	// Namespace is the optional namespace of this metric, overriding the namespace in Options
+	Namespace string `json:"namespace"`
+
+	// Subsystem is the optional subsystem of this metric, overriding the subsystem in Options
+	Subsystem string `json:"subsystem"`
+
+	// LabelNames are the names of this metric's labels.  Code which uses the metric must supply
+	// values for exactly these labels, in this order, via With.
+	LabelNames []string `json:"labelNames"`
+
+	// Buckets are the upper bounds of a histogram's buckets.  If not supplied for a histogram,
+	// the Prometheus default buckets are used.  This field is ignored for other types of metrics.
+	Buckets []float64 `json:"buckets"`
+}
+
+func (m *Metric) help() string {
+	if len(m.Help) > 0 {
+		return m.Help
+	}
+
+	return m.Name
+}
+
+func (m *Metric) validate() error {
+	if len(m.Name) == 0 {
+		return ErrorMetricNoName
+	}
+
+	switch m.Type {
+	case CounterType, GaugeType, HistogramType:
+		return nil
+	default:
+		return ErrorMetricInvalidType
+	}
+}
+
+// Module is a function which declares a set of metrics.  Each package that produces metrics
+// exposes a Module, conventionally named Metrics.
+type Module func() []Metric
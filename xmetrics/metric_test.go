@@ -0,0 +1,32 @@
+package xmetrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricHelp(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("test", (&Metric{Name: "test"}).help())
+	assert.Equal("a test metric", (&Metric{Name: "test", Help: "a test metric"}).help())
+}
+
+func TestMetricValidate(t *testing.T) {
+	var testData = []struct {
+		metric   Metric
+		expected error
+	}{
+		{Metric{Name: "test", Type: CounterType}, nil},
+		{Metric{Name: "test", Type: GaugeType}, nil},
+		{Metric{Name: "test", Type: HistogramType}, nil},
+		{Metric{Type: CounterType}, ErrorMetricNoName},
+		{Metric{Name: "test"}, ErrorMetricInvalidType},
+		{Metric{Name: "test", Type: "summary"}, ErrorMetricInvalidType},
+	}
+
+	for i, record := range testData {
+		t.Logf("%d: %#v", i, record.metric)
+		assert.Equal(t, record.expected, record.metric.validate())
+	}
+}
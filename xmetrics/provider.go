@@ -0,0 +1,34 @@
+package xmetrics
+
+import (
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+// Provider is a source of named metrics.  Implementations may panic if a name refers to a metric
+// of a different type, since that is a programming error.
+type Provider interface {
+	NewCounter(name string) metrics.Counter
+	NewGauge(name string) metrics.Gauge
+	NewHistogram(name string) metrics.Histogram
+}
+
+// NewDiscardProvider returns a Provider whose metrics discard all observations.  This is the
+// Provider used by components which are not configured with one.
+func NewDiscardProvider() Provider {
+	return discardProvider{}
+}
+
+type discardProvider struct{}
+
+func (discardProvider) NewCounter(string) metrics.Counter {
+	return discard.NewCounter()
+}
+
+func (discardProvider) NewGauge(string) metrics.Gauge {
+	return discard.NewGauge()
+}
+
+func (discardProvider) NewHistogram(string) metrics.Histogram {
+	return discard.NewHistogram()
+}
@@ -0,0 +1,32 @@
+package xmetrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDiscardProvider(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		provider = NewDiscardProvider()
+	)
+
+	if assert.NotNil(provider) {
+		counter := provider.NewCounter("counter")
+		if assert.NotNil(counter) {
+			counter.With("label", "value").Add(1)
+		}
+
+		gauge := provider.NewGauge("gauge")
+		if assert.NotNil(gauge) {
+			gauge.With("label", "value").Set(1)
+			gauge.Add(-1)
+		}
+
+		histogram := provider.NewHistogram("histogram")
+		if assert.NotNil(histogram) {
+			histogram.With("label", "value").Observe(1)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package xmetrics
+
+import (
+	"fmt"
+	"github.com/go-kit/kit/metrics"
+	gokitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"sync"
+)
+
+// Options configures a Registry
+type Options struct {
+	// Namespace is the default namespace of every metric, e.g. "webpa"
+	Namespace string `json:"namespace"`
+
+	// Subsystem is the default subsystem of every metric, e.g. "talaria"
+	Subsystem string `json:"subsystem"`
+
+	// Metrics are additional metric declarations.  A metric with the same name as one
+	// declared by a Module replaces the Module's declaration, which allows configuration
+	// to tune things like histogram buckets.
+	Metrics []Metric `json:"metrics"`
+}
+
+func (o *Options) namespace() string {
+	if o != nil {
+		return o.Namespace
+	}
+
+	return ""
+}
+
+func (o *Options) subsystem() string {
+	if o != nil {
+		return o.Subsystem
+	}
+
+	return ""
+}
+
+func (o *Options) metrics() []Metric {
+	if o != nil {
+		return o.Metrics
+	}
+
+	return nil
+}
+
+// Registry is the Prometheus implementation of Provider.  Every declared metric is registered when the
+// Registry is created, so that it is exposed even before it is first used.  Requesting a metric which was
+// not declared panics, since the labels of such a metric are unknown.
+//
+// A Registry is also an http.Handler which serves its metrics in the Prometheus exposition format.
+// Each Registry has its own underlying prometheus.Registry, so Registries do not interfere with each other
+// or with the Prometheus default registry.
+type Registry struct {
+	options  *Options
+	registry *prometheus.Registry
+	handler  http.Handler
+
+	lock       sync.Mutex
+	collectors map[string]prometheus.Collector
+}
+
+// NewRegistry creates a Registry with the metrics declared by the given modules and options.  An error is
+// returned if any declaration is invalid, or if two modules declare the same metric.
+func NewRegistry(o *Options, modules ...Module) (*Registry, error) {
+	var (
+		declarations = make(map[string]Metric)
+		order        []string
+	)
+
+	for _, module := range modules {
+		for _, metric := range module() {
+			if err := metric.validate(); err != nil {
+				return nil, err
+			} else if _, ok := declarations[metric.Name]; ok {
+				return nil, ErrorMetricDuplicate
+			}
+
+			declarations[metric.Name] = metric
+			order = append(order, metric.Name)
+		}
+	}
+
+	for _, metric := range o.metrics() {
+		if err := metric.validate(); err != nil {
+			return nil, err
+		} else if _, ok := declarations[metric.Name]; !ok {
+			order = append(order, metric.Name)
+		}
+
+		declarations[metric.Name] = metric
+	}
+
+	registry := prometheus.NewRegistry()
+	r := &Registry{
+		options:    o,
+		registry:   registry,
+		handler:    promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+		collectors: make(map[string]prometheus.Collector, len(declarations)),
+	}
+
+	for _, name := range order {
+		if _, err := r.register(declarations[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// register creates the collector for a metric and adds it to the underlying prometheus.Registry.
+// This method must be called under the lock, or during construction.
+func (r *Registry) register(metric Metric) (prometheus.Collector, error) {
+	namespace := metric.Namespace
+	if len(namespace) == 0 {
+		namespace = r.options.namespace()
+	}
+
+	subsystem := metric.Subsystem
+	if len(subsystem) == 0 {
+		subsystem = r.options.subsystem()
+	}
+
+	var collector prometheus.Collector
+	switch metric.Type {
+	case CounterType:
+		collector = prometheus.NewCounterVec(
+			prometheus.CounterOpts{Namespace: namespace, Subsystem: subsystem, Name: metric.Name, Help: metric.help()},
+			metric.LabelNames,
+		)
+
+	case GaugeType:
+		collector = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{Namespace: namespace, Subsystem: subsystem, Name: metric.Name, Help: metric.help()},
+			metric.LabelNames,
+		)
+
+	case HistogramType:
+		collector = prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{Namespace: namespace, Subsystem: subsystem, Name: metric.Name, Help: metric.help(), Buckets: metric.Buckets},
+			metric.LabelNames,
+		)
+
+	default:
+		return nil, ErrorMetricInvalidType
+	}
+
+	if err := r.registry.Register(collector); err != nil {
+		return nil, err
+	}
+
+	r.collectors[metric.Name] = collector
+	return collector, nil
+}
+
+// collector returns the collector for the given name.  This method panics if no metric with that name was
+// declared, as a collector created on demand would have no labels and would fail on first use of With.
+func (r *Registry) collector(name, metricType string) prometheus.Collector {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if collector, ok := r.collectors[name]; ok {
+		return collector
+	}
+
+	panic(fmt.Errorf("The %s %s was not declared.  Add its Module or declare it in Options.Metrics.", metricType, name))
+}
+
+// NewCounter returns the named counter.  This method panics if the name refers to some other type of metric.
+func (r *Registry) NewCounter(name string) metrics.Counter {
+	if counterVec, ok := r.collector(name, CounterType).(*prometheus.CounterVec); ok {
+		return gokitprometheus.NewCounter(counterVec)
+	}
+
+	panic(fmt.Errorf("Metric %s is not a counter", name))
+}
+
+// NewGauge returns the named gauge.  This method panics if the name refers to some other type of metric.
+func (r *Registry) NewGauge(name string) metrics.Gauge {
+	if gaugeVec, ok := r.collector(name, GaugeType).(*prometheus.GaugeVec); ok {
+		return gokitprometheus.NewGauge(gaugeVec)
+	}
+
+	panic(fmt.Errorf("Metric %s is not a gauge", name))
+}
+
+// NewHistogram returns the named histogram.  This method panics if the name refers to some other type of metric.
+func (r *Registry) NewHistogram(name string) metrics.Histogram {
+	if histogramVec, ok := r.collector(name, HistogramType).(*prometheus.HistogramVec); ok {
+		return gokitprometheus.NewHistogram(histogramVec)
+	}
+
+	panic(fmt.Errorf("Metric %s is not a histogram", name))
+}
+
+// Gatherer returns the underlying prometheus.Gatherer, which is useful when this Registry's metrics
+// must be combined with others
+func (r *Registry) Gatherer() prometheus.Gatherer {
+	return r.registry
+}
+
+// ServeHTTP exposes this Registry's metrics for scraping
+func (r *Registry) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	r.handler.ServeHTTP(response, request)
+}
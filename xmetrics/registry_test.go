@@ -0,0 +1,142 @@
+package xmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testModule() []Metric {
+	return []Metric{
+		{Name: "requests", Type: CounterType, Help: "the number of requests", LabelNames: []string{"code"}},
+		{Name: "connections", Type: GaugeType},
+		{Name: "latency", Type: HistogramType, Buckets: []float64{0.1, 1.0}},
+	}
+}
+
+func scrape(t *testing.T, r *Registry) string {
+	response := httptest.NewRecorder()
+	r.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusOK, response.Code)
+	return response.Body.String()
+}
+
+func TestNewRegistry(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	r, err := NewRegistry(&Options{Namespace: "webpa", Subsystem: "test"}, testModule)
+	require.NoError(err)
+	require.NotNil(r)
+	assert.NotNil(r.Gatherer())
+
+	r.NewCounter("requests").With("code", "200").Add(2)
+	r.NewGauge("connections").Set(5)
+	r.NewHistogram("latency").Observe(0.5)
+
+	output := scrape(t, r)
+	assert.Contains(output, "# HELP webpa_test_requests the number of requests")
+	assert.Contains(output, `webpa_test_requests{code="200"} 2`)
+	assert.Contains(output, "# HELP webpa_test_connections connections")
+	assert.Contains(output, "webpa_test_connections 5")
+	assert.Contains(output, `webpa_test_latency_bucket{le="0.1"} 0`)
+	assert.Contains(output, `webpa_test_latency_bucket{le="1"} 1`)
+}
+
+func TestNewRegistryNilOptions(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	r, err := NewRegistry(nil)
+	require.NoError(err)
+	require.NotNil(r)
+
+	// undeclared metrics have no known labels, so requesting them is a programming error
+	assert.Panics(func() { r.NewCounter("undeclared") })
+	assert.Panics(func() { r.NewGauge("undeclared") })
+	assert.Panics(func() { r.NewHistogram("undeclared") })
+}
+
+func TestRegistrySameMetric(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	r, err := NewRegistry(nil, func() []Metric { return []Metric{{Name: "declared", Type: CounterType}} })
+	require.NoError(err)
+
+	// the same underlying metric is returned each time
+	r.NewCounter("declared").Add(1)
+	assert.Contains(scrape(t, r), "declared 1")
+	r.NewCounter("declared").Add(1)
+	assert.Contains(scrape(t, r), "declared 2")
+}
+
+func TestNewRegistryOptionsOverride(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		o = &Options{
+			Metrics: []Metric{
+				{Name: "latency", Type: HistogramType, Buckets: []float64{2.0}},
+				{Name: "extra", Type: GaugeType, Namespace: "custom"},
+			},
+		}
+	)
+
+	r, err := NewRegistry(o, testModule)
+	require.NoError(err)
+	require.NotNil(r)
+
+	r.NewHistogram("latency").Observe(0.5)
+	r.NewGauge("extra").Set(3)
+
+	output := scrape(t, r)
+	assert.Contains(output, `latency_bucket{le="2"} 1`)
+	assert.NotContains(output, `latency_bucket{le="0.1"}`)
+	assert.Contains(output, "custom_extra 3")
+}
+
+func TestNewRegistryErrors(t *testing.T) {
+	var testData = []struct {
+		options  *Options
+		modules  []Module
+		expected error
+	}{
+		{nil, []Module{func() []Metric { return []Metric{{Type: CounterType}} }}, ErrorMetricNoName},
+		{nil, []Module{func() []Metric { return []Metric{{Name: "test", Type: "summary"}} }}, ErrorMetricInvalidType},
+		{nil, []Module{testModule, testModule}, ErrorMetricDuplicate},
+		{&Options{Metrics: []Metric{{Name: "test"}}}, nil, ErrorMetricInvalidType},
+	}
+
+	for i, record := range testData {
+		t.Logf("%d", i)
+		r, err := NewRegistry(record.options, record.modules...)
+		assert.Nil(t, r)
+		assert.Equal(t, record.expected, err)
+	}
+}
+
+func TestRegistryWrongType(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	r, err := NewRegistry(nil, testModule)
+	require.NoError(err)
+	require.NotNil(r)
+
+	assert.Panics(func() { r.NewCounter("connections") })
+	assert.Panics(func() { r.NewGauge("latency") })
+	assert.Panics(func() { r.NewHistogram("requests") })
+}